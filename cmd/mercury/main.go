@@ -0,0 +1,984 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"mercury-relay/internal/backfill"
+	"mercury-relay/internal/backup"
+	"mercury-relay/internal/bench"
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/doctor"
+	"mercury-relay/internal/dump"
+	"mercury-relay/internal/logging"
+	"mercury-relay/internal/mirror"
+	"mercury-relay/internal/normalize"
+	"mercury-relay/internal/onboard"
+	"mercury-relay/internal/quality"
+	"mercury-relay/internal/query"
+	"mercury-relay/internal/reconcile"
+	"mercury-relay/internal/replay"
+	"mercury-relay/internal/storage"
+	"mercury-relay/internal/tracing"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		printUsage()
+		os.Exit(2)
+	}
+
+	switch os.Args[1] {
+	case "init":
+		os.Exit(runInit(os.Args[2:]))
+	case "doctor":
+		os.Exit(runDoctor(os.Args[2:]))
+	case "query", "q":
+		os.Exit(runQuery(os.Args[2:]))
+	case "replay":
+		os.Exit(runReplay(os.Args[2:]))
+	case "sync":
+		os.Exit(runSync(os.Args[2:]))
+	case "backfill":
+		os.Exit(runBackfill(os.Args[2:]))
+	case "export":
+		os.Exit(runExport(os.Args[2:]))
+	case "import":
+		os.Exit(runImport(os.Args[2:]))
+	case "backup":
+		os.Exit(runBackup(os.Args[2:]))
+	case "restore":
+		os.Exit(runRestore(os.Args[2:]))
+	case "migrate":
+		os.Exit(runMigrate(os.Args[2:]))
+	case "bench":
+		os.Exit(runBench(os.Args[2:]))
+	case "profiles":
+		os.Exit(runProfiles(os.Args[2:]))
+	case "help", "-h", "--help":
+		printUsage()
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown command: %s\n\n", os.Args[1])
+		printUsage()
+		os.Exit(2)
+	}
+}
+
+func printUsage() {
+	fmt.Println("Usage: mercury <command> [options]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	fmt.Println("  init [options]             Create a config file, data directories and relay key")
+	fmt.Println("  doctor [options]           Check that a config file can run")
+	fmt.Println("  query [options] <filter>   Query events with the filter DSL")
+	fmt.Println("  replay [options] [filter]  Re-run stored events through pipeline stages")
+	fmt.Println("  sync [options] <url>       Reconcile stored events with a relay (NIP-77)")
+	fmt.Println("  backfill [options] <filter> Import matching events from other relays")
+	fmt.Println("  export [options] [filter]  Dump stored events to JSONL")
+	fmt.Println("  import [options] <file>    Load a JSONL dump, e.g. from strfry or nostream")
+	fmt.Println("  backup [options]           Take a snapshot of the event store now, or list them")
+	fmt.Println("  restore [options] [name]   Load a snapshot, the newest by default")
+	fmt.Println("  migrate [options]          Create or upgrade the Postgres event store schema")
+	fmt.Println("  bench [options]            Run a benchmark scenario against a live relay")
+	fmt.Println("  profiles [name]            List config profiles or show one's settings")
+	fmt.Println()
+	fmt.Println("Filter DSL (terms are space separated, values comma separated):")
+	fmt.Println("  kind=1,30023          event kinds")
+	fmt.Println("  author=npub1...       author npub or hex pubkey")
+	fmt.Println("  id=note1...           event id (note1 or hex)")
+	fmt.Println("  since=2h until=1d     relative (m, h, d, w), unix or YYYY-MM-DD")
+	fmt.Println("  limit=50              maximum number of events")
+	fmt.Println("  #t=bitcoin            single-letter tag filter")
+	fmt.Println()
+	fmt.Println("Example:")
+	fmt.Println("  mercury init -config config.yaml")
+	fmt.Println("  mercury query -format ndjson kind=1 since=2h limit=50 '#t=bitcoin'")
+	fmt.Println("  mercury replay -stages quality,index -rate 200 -checkpoint replay.json kind=30040")
+	fmt.Println("  mercury sync -direction pull wss://relay.example.com kind=30040,30041 since=30d")
+	fmt.Println("  mercury backfill -relays wss://relay.damus.io,wss://nos.lol -checkpoint backfill.json kind=30040,30041 author=npub1...")
+	fmt.Println("  mercury export -format strfry -out books.jsonl kind=30040,30041")
+	fmt.Println("  mercury import strfry-export.jsonl")
+	fmt.Println("  mercury bench -url ws://localhost:8080 -scenario mixed -out bench.json -baseline last.json")
+}
+
+func runQuery(args []string) int {
+	fs := flag.NewFlagSet("query", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "Path to configuration file (local mode)")
+	profile := fs.String("profile", "", "Config profile applied under the config file (see mercury profiles)")
+	remote := fs.String("remote", "", "Mercury REST endpoint, e.g. http://localhost:8082 (skips local storage)")
+	npub := fs.String("npub", os.Getenv("MERCURY_NPUB"), "Npub sent as X-Nostr-Pubkey for remote queries")
+	format := fs.String("format", query.FormatTable, "Output format: table, json or ndjson")
+	timeout := fs.Duration("timeout", 30*time.Second, "Query timeout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	filter, err := query.ParseArgs(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+
+	var source query.Source
+	if *remote != "" {
+		source = query.NewRESTSource(*remote, *npub)
+	} else {
+		cfg, err := config.LoadProfile(*configPath, *profile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Failed to load config: %v\n", err)
+			return 1
+		}
+		eventCache, err := cache.New(cfg.Cache, cfg.Redis)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		defer eventCache.Close()
+		source = query.NewCacheSource(eventCache)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	events, err := source.Query(ctx, filter)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+
+	if err := query.WriteEvents(os.Stdout, events, *format); err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func runReplay(args []string) int {
+	fs := flag.NewFlagSet("replay", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "Path to configuration file")
+	profile := fs.String("profile", "", "Config profile applied under the config file (see mercury profiles)")
+	stages := fs.String("stages", replay.StageIndex, "Comma separated stages: quality, normalize, index, catalog")
+	rate := fs.Int("rate", 0, "Maximum events per second (0 for unlimited)")
+	batch := fs.Int("batch", 500, "Events fetched from storage per page")
+	checkpoint := fs.String("checkpoint", "", "File to record progress in")
+	resume := fs.Bool("resume", false, "Continue from the cursor in -checkpoint")
+	kindsDir := fs.String("kinds", "configs/kinds", "Kind config directory used by the quality stage")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *resume && *checkpoint == "" {
+		fmt.Fprintln(os.Stderr, "❌ -resume requires -checkpoint")
+		return 2
+	}
+
+	filter, err := query.ParseArgs(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+
+	cfg, err := config.LoadProfile(*configPath, *profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to load config: %v\n", err)
+		return 1
+	}
+	logs, err := logging.Setup(cfg.Logging)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	defer logs.Close()
+	stopTracing, err := tracing.Setup(cfg.Tracing)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		stopTracing(ctx)
+	}()
+
+	store, err := storage.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	source, ok := store.(storage.Scanner)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "❌ Storage backend %q can't be scanned for replay\n", cfg.Storage.Backend)
+		return 1
+	}
+	defer store.Close()
+
+	eventCache, err := cache.New(cfg.Cache, cfg.Redis)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	defer eventCache.Close()
+
+	qualityControl := quality.NewController(cfg.Quality, nil, eventCache)
+	if loader, err := quality.NewKindConfigLoaderFromDirectory(*kindsDir); err == nil {
+		qualityControl.SetKindConfigLoader(loader)
+	} else {
+		fmt.Fprintf(os.Stderr, "⚠️  Kind configs not loaded, using default scoring: %v\n", err)
+	}
+
+	engine := replay.NewEngine(source)
+	engine.RegisterStage(replay.NewQualityStage(qualityControl))
+	engine.RegisterStage(replay.NewNormalizeStage(normalize.NewNormalizer()))
+	engine.RegisterStage(replay.NewIndexStage(eventCache))
+	engine.RegisterStage(replay.NewCatalogStage(eventCache))
+	engine.OnProgress(func(p replay.Progress) {
+		fmt.Fprintf(os.Stderr, "scanned=%d replayed=%d skipped=%d failed=%d\n", p.Scanned, p.Replayed, p.Skipped, p.Failed)
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	progress, err := engine.Run(ctx, replay.Options{
+		Stages:         strings.Split(*stages, ","),
+		Filter:         filter,
+		BatchSize:      *batch,
+		Rate:           *rate,
+		CheckpointPath: *checkpoint,
+		Resume:         *resume,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Replay stopped: %v\n", err)
+		if *checkpoint != "" {
+			fmt.Fprintf(os.Stderr, "Resume with: mercury replay -resume -checkpoint %s\n", *checkpoint)
+		}
+		return 1
+	}
+
+	fmt.Printf("✅ Replayed %d of %d events (%d skipped, %d failed) in %s\n",
+		progress.Replayed, progress.Scanned, progress.Skipped, progress.Failed,
+		time.Since(progress.StartedAt).Round(time.Second))
+	if progress.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func runSync(args []string) int {
+	fs := flag.NewFlagSet("sync", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "Path to configuration file")
+	profile := fs.String("profile", "", "Config profile applied under the config file (see mercury profiles)")
+	direction := fs.String("direction", string(reconcile.Both), "Copy missing events: pull, push or both")
+	timeout := fs.Duration("timeout", 10*time.Minute, "Sync timeout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if fs.NArg() < 1 {
+		fmt.Fprintln(os.Stderr, "❌ sync requires the relay URL")
+		return 2
+	}
+	url := fs.Arg(0)
+	dir, err := reconcile.ParseDirection(*direction)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	filter, err := query.ParseArgs(fs.Args()[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+
+	cfg, err := config.LoadProfile(*configPath, *profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to load config: %v\n", err)
+		return 1
+	}
+	logs, err := logging.Setup(cfg.Logging)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	defer logs.Close()
+	stopTracing, err := tracing.Setup(cfg.Tracing)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		stopTracing(ctx)
+	}()
+	eventCache, err := cache.New(cfg.Cache, cfg.Redis)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	defer eventCache.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	result, err := reconcile.Sync(ctx, reconcile.NewCacheStore(eventCache), url, filter, dir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Sync failed: %v\n", err)
+		return 1
+	}
+
+	fmt.Printf("✅ %d local events, %d only on %s, %d only here; pulled %d, pushed %d (%d failed)\n",
+		result.Local, result.Missing, url, result.Extra, result.Pulled, result.Pushed, result.Failed)
+	if result.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func runBackfill(args []string) int {
+	fs := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "Path to configuration file")
+	profile := fs.String("profile", "", "Config profile applied under the config file (see mercury profiles)")
+	relays := fs.String("relays", "", "Comma separated relay URLs to import from")
+	page := fs.Int("page", 500, "Events asked for per request")
+	timeout := fs.Duration("timeout", 30*time.Second, "Timeout of each request to a relay")
+	checkpoint := fs.String("checkpoint", "", "File to record progress in")
+	resume := fs.Bool("resume", false, "Continue the run in -checkpoint with its relays and filter")
+	kindsDir := fs.String("kinds", "configs/kinds", "Kind config directory used by quality control")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if *resume && *checkpoint == "" {
+		fmt.Fprintln(os.Stderr, "❌ -resume requires -checkpoint")
+		return 2
+	}
+	if !*resume && *relays == "" {
+		fmt.Fprintln(os.Stderr, "❌ backfill requires -relays")
+		return 2
+	}
+	filter, err := query.ParseArgs(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+
+	cfg, err := config.LoadProfile(*configPath, *profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to load config: %v\n", err)
+		return 1
+	}
+	logs, err := logging.Setup(cfg.Logging)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	defer logs.Close()
+
+	store, err := storage.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	if store != nil {
+		defer store.Close()
+	}
+	eventCache, err := cache.New(cfg.Cache, cfg.Redis)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	defer eventCache.Close()
+
+	qualityControl := quality.NewController(cfg.Quality, nil, eventCache)
+	if loader, err := quality.NewKindConfigLoaderFromDirectory(*kindsDir); err == nil {
+		qualityControl.SetKindConfigLoader(loader)
+	} else {
+		fmt.Fprintf(os.Stderr, "⚠️  Kind configs not loaded, using default scoring: %v\n", err)
+	}
+
+	b := backfill.NewBackfiller(mirror.NewRelayFetcher(*timeout), qualityControl, eventCache, store)
+	b.SetNormalizer(normalize.NewNormalizer())
+	b.OnProgress(func(p backfill.Progress) {
+		for _, relay := range p.Relays {
+			if relay.Done || relay.Fetched > 0 || relay.Error != "" {
+				fmt.Fprintf(os.Stderr, "%s fetched=%d imported=%d duplicates=%d rejected=%d invalid=%d failed=%d\n",
+					relay.URL, relay.Fetched, relay.Imported, relay.Duplicates, relay.Rejected, relay.Invalid, relay.Failed)
+			}
+		}
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	var urls []string
+	if *relays != "" {
+		urls = strings.Split(*relays, ",")
+	}
+	progress, err := b.Run(ctx, backfill.Options{
+		Relays:         urls,
+		Filter:         filter,
+		PageSize:       *page,
+		CheckpointPath: *checkpoint,
+		Resume:         *resume,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Backfill stopped: %v\n", err)
+		if *checkpoint != "" {
+			fmt.Fprintf(os.Stderr, "Resume with: mercury backfill -resume -checkpoint %s\n", *checkpoint)
+		}
+		return 1
+	}
+
+	total := progress.Totals()
+	fmt.Printf("✅ Imported %d of %d events from %d relays (%d duplicates, %d rejected, %d invalid, %d failed) in %s\n",
+		total.Imported, total.Fetched, len(progress.Relays), total.Duplicates, total.Rejected, total.Invalid, total.Failed,
+		time.Since(progress.StartedAt).Round(time.Second))
+	for _, relay := range progress.Relays {
+		if relay.Error != "" {
+			fmt.Fprintf(os.Stderr, "⚠️  %s: %s\n", relay.URL, relay.Error)
+		}
+	}
+	if !progress.Done || total.Failed > 0 {
+		if *checkpoint != "" {
+			fmt.Fprintf(os.Stderr, "Retry with: mercury backfill -resume -checkpoint %s\n", *checkpoint)
+		}
+		return 1
+	}
+	return 0
+}
+
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "Path to configuration file")
+	profile := fs.String("profile", "", "Config profile applied under the config file (see mercury profiles)")
+	format := fs.String("format", dump.FormatJSONL, "Dump format: jsonl (with Mercury metadata) or strfry (plain NIP-01)")
+	out := fs.String("out", "", "Write the dump to this file instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	filter, err := query.ParseArgs(fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+
+	cfg, err := config.LoadProfile(*configPath, *profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to load config: %v\n", err)
+		return 1
+	}
+	store, err := storage.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	source, ok := store.(storage.Scanner)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "❌ Storage backend %q can't be scanned for export\n", cfg.Storage.Backend)
+		return 1
+	}
+	defer store.Close()
+
+	w := os.Stdout
+	if *out != "" {
+		file, err := os.Create(*out)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Failed to create dump: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		w = file
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	progress, err := dump.Export(ctx, source, w, filter, *format, func(p dump.ExportProgress) {
+		fmt.Fprintf(os.Stderr, "\rscanned=%d exported=%d", p.Scanned, p.Exported)
+	})
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Export stopped: %v\n", err)
+		return 1
+	}
+	fmt.Fprintf(os.Stderr, "✅ Exported %d of %d events in %s\n",
+		progress.Exported, progress.Scanned, time.Since(progress.StartedAt).Round(time.Second))
+	return 0
+}
+
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "Path to configuration file")
+	profile := fs.String("profile", "", "Config profile applied under the config file (see mercury profiles)")
+	kindsDir := fs.String("kinds", "configs/kinds", "Kind config directory used by quality control")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	if fs.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "❌ import requires the dump file (- for stdin)")
+		return 2
+	}
+	r, size := os.Stdin, int64(0)
+	if path := fs.Arg(0); path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Failed to open dump: %v\n", err)
+			return 1
+		}
+		defer file.Close()
+		if info, err := file.Stat(); err == nil {
+			size = info.Size()
+		}
+		r = file
+	}
+
+	cfg, err := config.LoadProfile(*configPath, *profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to load config: %v\n", err)
+		return 1
+	}
+	logs, err := logging.Setup(cfg.Logging)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	defer logs.Close()
+
+	store, err := storage.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	if store != nil {
+		defer store.Close()
+	}
+	eventCache, err := cache.New(cfg.Cache, cfg.Redis)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	defer eventCache.Close()
+
+	qualityControl := quality.NewController(cfg.Quality, nil, eventCache)
+	if loader, err := quality.NewKindConfigLoaderFromDirectory(*kindsDir); err == nil {
+		qualityControl.SetKindConfigLoader(loader)
+	} else {
+		fmt.Fprintf(os.Stderr, "⚠️  Kind configs not loaded, using default scoring: %v\n", err)
+	}
+
+	importer := dump.NewImporter(qualityControl, eventCache, store)
+	importer.SetNormalizer(normalize.NewNormalizer())
+	importer.OnProgress(func(p dump.ImportProgress) {
+		fmt.Fprintf(os.Stderr, "\r%s lines=%d imported=%d duplicates=%d rejected=%d invalid=%d",
+			progressBar(p.Bytes, size), p.Lines, p.Imported, p.Duplicates, p.Rejected, p.Invalid)
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	progress, err := importer.Import(ctx, r)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Import stopped: %v\n", err)
+		fmt.Fprintln(os.Stderr, "Running it again skips the events already imported")
+		return 1
+	}
+	fmt.Printf("✅ Imported %d events from %d lines (%d duplicates, %d rejected, %d invalid, %d failed) in %s\n",
+		progress.Imported, progress.Lines, progress.Duplicates, progress.Rejected, progress.Invalid, progress.Failed,
+		time.Since(progress.StartedAt).Round(time.Second))
+	if progress.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// progressBar draws how much of total is done, or nothing when total is
+// unknown
+func progressBar(done, total int64) string {
+	const width = 30
+	if total <= 0 {
+		return ""
+	}
+	filled := int(min(done, total) * width / total)
+	return fmt.Sprintf("[%s%s] %3d%%", strings.Repeat("#", filled), strings.Repeat(" ", width-filled), min(done, total)*100/total)
+}
+
+func runBackup(args []string) int {
+	fs := flag.NewFlagSet("backup", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "Path to configuration file")
+	profile := fs.String("profile", "", "Config profile applied under the config file (see mercury profiles)")
+	list := fs.Bool("list", false, "Only list the snapshots")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.LoadProfile(*configPath, *profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to load config: %v\n", err)
+		return 1
+	}
+	store, err := storage.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	source, ok := store.(storage.Scanner)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "❌ Storage backend %q can't be scanned for backups\n", cfg.Storage.Backend)
+		return 1
+	}
+	defer store.Close()
+
+	b, err := backup.New(cfg.Backup, source, cfg.SSH.KeyStorage)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if *list {
+		names, err := b.List(ctx)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return 0
+	}
+
+	started := time.Now()
+	name, err := b.Snapshot(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Backup failed: %v\n", err)
+		return 1
+	}
+	fmt.Printf("✅ Wrote %s in %s\n", name, time.Since(started).Round(time.Second))
+	return 0
+}
+
+func runRestore(args []string) int {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "Path to configuration file")
+	profile := fs.String("profile", "", "Config profile applied under the config file (see mercury profiles)")
+	secretKey := fs.String("nsec", os.Getenv("MERCURY_BACKUP_NSEC"), "Secret key of backup.recipient, for encrypted snapshots")
+	kindsDir := fs.String("kinds", "configs/kinds", "Kind config directory used by quality control")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.LoadProfile(*configPath, *profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to load config: %v\n", err)
+		return 1
+	}
+	logs, err := logging.Setup(cfg.Logging)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	defer logs.Close()
+
+	store, err := storage.New(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	if store != nil {
+		defer store.Close()
+	}
+	eventCache, err := cache.New(cfg.Cache, cfg.Redis)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	defer eventCache.Close()
+
+	b, err := backup.New(cfg.Backup, nil, cfg.SSH.KeyStorage)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+
+	qualityControl := quality.NewController(cfg.Quality, nil, eventCache)
+	if loader, err := quality.NewKindConfigLoaderFromDirectory(*kindsDir); err == nil {
+		qualityControl.SetKindConfigLoader(loader)
+	} else {
+		fmt.Fprintf(os.Stderr, "⚠️  Kind configs not loaded, using default scoring: %v\n", err)
+	}
+	importer := dump.NewImporter(qualityControl, eventCache, store)
+	importer.OnProgress(func(p dump.ImportProgress) {
+		fmt.Fprintf(os.Stderr, "\rlines=%d imported=%d duplicates=%d rejected=%d invalid=%d",
+			p.Lines, p.Imported, p.Duplicates, p.Rejected, p.Invalid)
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	result, err := b.Restore(ctx, fs.Arg(0), *secretKey, importer)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Restore failed: %v\n", err)
+		return 1
+	}
+	fmt.Printf("✅ Restored %s taken %s: %d of %d events imported (%d already stored, %d rejected, %d invalid), %d SSH keys\n",
+		result.Snapshot, result.Manifest.CreatedAt.Format(time.RFC3339), result.Events.Imported, result.Manifest.Events,
+		result.Events.Duplicates, result.Events.Rejected, result.Events.Invalid, result.SSHKeys)
+	if result.Events.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "Path to configuration file")
+	profile := fs.String("profile", "", "Config profile applied under the config file (see mercury profiles)")
+	status := fs.Bool("status", false, "Only show the schema version and pending migrations")
+	timeout := fs.Duration("timeout", 30*time.Minute, "Migration timeout")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.LoadProfile(*configPath, *profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to load config: %v\n", err)
+		return 1
+	}
+	logs, err := logging.Setup(cfg.Logging)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	defer logs.Close()
+	store, err := storage.OpenPostgres(cfg.Postgres)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	defer store.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	defer cancel()
+
+	version, err := store.SchemaVersion(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	migrations, err := storage.Migrations()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	fmt.Printf("Schema version: %d\n", version)
+
+	if *status {
+		for _, migration := range migrations {
+			if migration.Version > version {
+				fmt.Printf("  pending %04d_%s\n", migration.Version, migration.Name)
+			}
+		}
+		return 0
+	}
+
+	applied, err := store.Migrate(ctx)
+	for _, migration := range applied {
+		fmt.Printf("  applied %04d_%s\n", migration.Version, migration.Name)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	if len(applied) == 0 {
+		fmt.Println("✅ Schema is up to date")
+	} else {
+		fmt.Printf("✅ Applied %d migrations\n", len(applied))
+	}
+	return 0
+}
+
+func runBench(args []string) int {
+	fs := flag.NewFlagSet("bench", flag.ContinueOnError)
+	url := fs.String("url", "ws://localhost:8080", "Relay WebSocket URL")
+	scenarioName := fs.String("scenario", bench.ScenarioMixed, "Scenario: ingest, fanout, query or mixed")
+	seed := fs.Int64("seed", 1, "Seed for the generated workload")
+	out := fs.String("out", "", "Write the JSON report to this file instead of stdout")
+	baselinePath := fs.String("baseline", "", "Earlier JSON report to check for regressions")
+	tolerance := fs.Float64("tolerance", 0.1, "Allowed slowdown against -baseline, e.g. 0.1 for 10%")
+	label := fs.String("label", "", "Build under test, recorded in the report")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	scenario, err := bench.Lookup(*scenarioName)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+
+	var baseline *bench.Report
+	if *baselinePath != "" {
+		data, err := os.ReadFile(*baselinePath)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Failed to read baseline: %v\n", err)
+			return 1
+		}
+		baseline = &bench.Report{}
+		if err := json.Unmarshal(data, baseline); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Failed to parse baseline: %v\n", err)
+			return 1
+		}
+	}
+
+	plan, err := bench.NewPlan(scenario, *seed, time.Now())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	fmt.Fprintf(os.Stderr, "Running %s against %s...\n", scenario.Name, *url)
+	report, err := bench.Run(ctx, bench.NewRelayTarget(*url), plan, bench.Options{Label: *label})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Benchmark failed: %v\n", err)
+		return 1
+	}
+
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	if *out != "" {
+		if err := os.WriteFile(*out, append(data, '\n'), 0644); err != nil {
+			fmt.Fprintf(os.Stderr, "❌ Failed to write report: %v\n", err)
+			return 1
+		}
+		fmt.Fprintf(os.Stderr, "✅ Report written to %s\n", *out)
+	} else {
+		fmt.Println(string(data))
+	}
+
+	if baseline == nil {
+		return 0
+	}
+	regressions, err := bench.Compare(baseline, report, *tolerance)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+	for _, r := range regressions {
+		fmt.Fprintf(os.Stderr, "⚠️  %s regressed %+.1f%% (%.2f -> %.2f)\n", r.Metric, r.Change*100, r.Baseline, r.Current)
+	}
+	if len(regressions) > 0 {
+		return 1
+	}
+	fmt.Fprintln(os.Stderr, "✅ No regressions against baseline")
+	return 0
+}
+
+func runProfiles(args []string) int {
+	if len(args) == 0 {
+		for _, profile := range config.Profiles() {
+			fmt.Printf("  %-10s %s\n", profile.Name, profile.Description)
+		}
+		fmt.Println()
+		fmt.Println("Select one with -profile, MERCURY_PROFILE or a top-level profile key in the")
+		fmt.Println("config file. Settings in the config file override the profile.")
+		return 0
+	}
+
+	profile, err := config.LookupProfile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 2
+	}
+	fmt.Printf("# %s: %s\n", profile.Name, profile.Description)
+	fmt.Print(strings.TrimPrefix(profile.Settings, "\n"))
+	return 0
+}
+
+func runInit(args []string) int {
+	fs := flag.NewFlagSet("init", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "Path of the configuration file to create")
+	force := fs.Bool("force", false, "Replace an existing configuration file")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if _, err := os.Stat(*configPath); err == nil && !*force {
+		fmt.Fprintf(os.Stderr, "❌ %s already exists; use -force to replace it\n", *configPath)
+		return 1
+	}
+
+	fmt.Println("Mercury Relay setup. Press enter to accept the value in brackets.")
+	fmt.Println()
+	answers, err := onboard.Interview(onboard.NewPrompter(os.Stdin, os.Stdout))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "\n❌ %v\n", err)
+		return 1
+	}
+	result, err := onboard.Apply(answers, *configPath, *force)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+		return 1
+	}
+
+	fmt.Println()
+	fmt.Printf("✅ Wrote %s\n", result.ConfigPath)
+	fmt.Printf("✅ Created %s\n", strings.Join(result.Directories, ", "))
+	fmt.Printf("✅ Relay identity %s (key in %s)\n", result.RelayNpub, answers.KeyPath())
+	if result.CertFile != "" {
+		fmt.Printf("✅ Self-signed TLS certificate %s\n", result.CertFile)
+	}
+	fmt.Println()
+	return runDoctor([]string{"-config", *configPath})
+}
+
+func runDoctor(args []string) int {
+	fs := flag.NewFlagSet("doctor", flag.ContinueOnError)
+	configPath := fs.String("config", "config.yaml", "Path to configuration file")
+	profile := fs.String("profile", "", "Config profile applied under the config file (see mercury profiles)")
+	timeout := fs.Duration("timeout", 10*time.Second, "Time allowed for checks that dial dependencies")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	cfg, err := config.LoadProfile(*configPath, *profile)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ Failed to load config: %v\n", err)
+		return 1
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	report := doctor.Run(ctx, cfg)
+	symbols := map[string]string{doctor.StatusOK: "✅", doctor.StatusWarn: "⚠️ ", doctor.StatusFail: "❌"}
+	for _, check := range report {
+		fmt.Printf("%s %-24s %s\n", symbols[check.Status], check.Name, check.Detail)
+	}
+	if report.Failed() {
+		fmt.Fprintln(os.Stderr, "\n❌ Fix the failed checks before starting the relay")
+		return 1
+	}
+	fmt.Println("\n✅ Ready to start")
+	return 0
+}
@@ -8,6 +8,7 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"strings"
 	"time"
@@ -210,11 +211,12 @@ func handleList(relayURL, npub string) {
 	var result struct {
 		Success bool `json:"success"`
 		Keys    []struct {
-			Name      string `json:"name"`
-			Type      string `json:"type"`
-			CreatedAt string `json:"created_at"`
-			Comment   string `json:"comment"`
-			OwnerNpub string `json:"owner_npub"`
+			Name        string `json:"name"`
+			Type        string `json:"type"`
+			Fingerprint string `json:"fingerprint"`
+			CreatedAt   string `json:"created_at"`
+			Comment     string `json:"comment"`
+			OwnerNpub   string `json:"owner_npub"`
 		} `json:"keys"`
 		Count int `json:"count"`
 	}
@@ -237,6 +239,7 @@ func handleList(relayURL, npub string) {
 	fmt.Printf("📋 Found %d SSH key(s):\n", result.Count)
 	for _, key := range result.Keys {
 		fmt.Printf("  🔑 %s (%s) - Created: %s\n", key.Name, key.Type, key.CreatedAt)
+		fmt.Printf("      Fingerprint: %s\n", key.Fingerprint)
 		if key.Comment != "" {
 			fmt.Printf("      Comment: %s\n", key.Comment)
 		}
@@ -303,6 +306,9 @@ func handleAdd(relayURL, npub string, scanner *bufio.Scanner) {
 
 	if resp.StatusCode == http.StatusCreated {
 		fmt.Printf("✅ SSH key '%s' added successfully\n", name)
+	} else if resp.StatusCode == http.StatusConflict {
+		body, _ := io.ReadAll(resp.Body)
+		fmt.Printf("❌ Duplicate key: %s\n", strings.TrimSpace(string(body)))
 	} else {
 		body, _ := io.ReadAll(resp.Body)
 		fmt.Printf("❌ Error: %s\n", string(body))
@@ -312,7 +318,13 @@ func handleAdd(relayURL, npub string, scanner *bufio.Scanner) {
 func handleRemove(relayURL, npub, keyName string) {
 	fmt.Printf("🗑️  Removing SSH key '%s'...\n", keyName)
 
-	req, err := http.NewRequest("DELETE", relayURL+"/api/v1/ssh-keys/"+keyName, nil)
+	// Fingerprints contain characters that are not path-safe, so they go in the query
+	endpoint := relayURL + "/api/v1/ssh-keys/" + keyName
+	if strings.HasPrefix(keyName, "SHA256:") {
+		endpoint = relayURL + "/api/v1/ssh-keys?fingerprint=" + url.QueryEscape(keyName)
+	}
+
+	req, err := http.NewRequest("DELETE", endpoint, nil)
 	if err != nil {
 		fmt.Printf("❌ Error creating request: %v\n", err)
 		return
@@ -341,6 +353,7 @@ func handleHelp() {
 	fmt.Println("  list                    - List your SSH keys")
 	fmt.Println("  add                     - Add a new SSH key")
 	fmt.Println("  remove <key-name>       - Remove an SSH key")
+	fmt.Println("  remove <SHA256:...>     - Remove an SSH key by fingerprint")
 	fmt.Println("  help                    - Show this help")
 	fmt.Println("  quit/exit               - Exit the program")
 	fmt.Println()
@@ -1,18 +1,23 @@
 package access
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
-	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"mercury-relay/internal/config"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
 )
 
+// defaultQueryTimeout bounds a follow list fetch when none is configured
+const defaultQueryTimeout = 10 * time.Second
+
 type Controller struct {
 	config       config.AccessConfig
 	ownerNpub    string
@@ -20,7 +25,33 @@ type Controller struct {
 	npubMutex    sync.RWMutex
 	lastUpdate   time.Time
 	updateTicker *time.Ticker
-	httpClient   *http.Client
+	queryTimeout time.Duration
+
+	// Public access and the kinds writable without follow list
+	// membership, replaced on config reload
+	policy atomic.Pointer[policy]
+
+	// Unknown pubkeys waiting for, or decided by, admin approval
+	writers *writerQueue
+
+	// Distance of the pubkeys followed beyond the owner's follows, see
+	// wot.go
+	trustGraph map[string]int
+
+	// Pubkeys that paid for write access, see paid.go
+	paid PaidAccess
+
+	// Upstream relays derived from follows' relay lists, see relaylists.go
+	followRelays   []config.UpstreamRelay
+	onFollowRelays func([]config.UpstreamRelay)
+
+	// Lock-free read path for CanWrite/CanRead
+	allowList atomic.Pointer[allowList]
+	decisions decisionCache
+	metrics   decisionMetrics
+
+	// now is time.Now, replaced in tests
+	now func() time.Time
 }
 
 type AccessConfig struct {
@@ -38,19 +69,26 @@ func NewController(config config.AccessConfig) *Controller {
 		ownerNpub = config.AdminNpubs[0]
 	}
 
-	return &Controller{
+	controller := &Controller{
 		config:       config,
 		ownerNpub:    ownerNpub,
 		allowedNpubs: make(map[string]bool),
-		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		writers:      newWriterQueue(config.WritersPath, config.MaxPendingWriters),
+		queryTimeout: config.QueryTimeout,
+		now:          time.Now,
+	}
+	if controller.queryTimeout <= 0 {
+		controller.queryTimeout = defaultQueryTimeout
 	}
+	controller.policy.Store(newPolicy(config))
+	controller.allowList.Store(&allowList{npubs: controller.allowedNpubs, approved: controller.writers.approved()})
+
+	return controller
 }
 
 func (a *Controller) Start(ctx context.Context) error {
 	// Load initial follow list
-	if err := a.loadFollowList(); err != nil {
+	if err := a.refresh(); err != nil {
 		log.Printf("Failed to load initial follow list: %v", err)
 	}
 
@@ -68,39 +106,63 @@ func (a *Controller) Stop() {
 }
 
 func (a *Controller) CanWrite(npub string) bool {
-	// Owner can always write
-	if npub == a.ownerNpub {
-		return true
-	}
+	allowed := a.decide(npub).canWrite
+	a.metrics.record(&a.metrics.writeAllowed, &a.metrics.writeDenied, allowed)
+	return allowed
+}
 
-	// Check if public write is allowed
-	if a.config.AllowPublicWrite {
+// CanWriteKind reports whether npub may publish an event of kind. Kinds in
+// anonymous_write_kinds are open to every pubkey, other kinds need CanWrite.
+func (a *Controller) CanWriteKind(npub string, kind int) bool {
+	if a.policy.Load().anonymousKinds[kind] {
+		a.metrics.anonymousWrites.Add(1)
 		return true
 	}
-
-	// Check if npub is in allowed list
-	a.npubMutex.RLock()
-	defer a.npubMutex.RUnlock()
-
-	return a.allowedNpubs[npub]
+	return a.CanWrite(npub)
 }
 
 func (a *Controller) CanRead(npub string) bool {
-	// Public read is always allowed if configured
-	if a.config.AllowPublicRead {
-		return true
-	}
+	allowed := a.decide(npub).canRead
+	a.metrics.record(&a.metrics.readAllowed, &a.metrics.readDenied, allowed)
+	return allowed
+}
 
-	// Owner can always read
-	if npub == a.ownerNpub {
-		return true
+// decide returns the access decision for npub, served from the decision
+// cache while the allow list version is unchanged and a paid admission it
+// rests on hasn't run out
+func (a *Controller) decide(npub string) decision {
+	list := a.allowList.Load()
+	if d, ok := a.decisions.get(npub, list.version, a.now()); ok {
+		a.metrics.cacheHits.Add(1)
+		return d
 	}
+	a.metrics.cacheMisses.Add(1)
+
+	policy := a.policy.Load()
+	owner := npub == a.ownerNpub
+	allowed := list.npubs[npub] || list.approved[npub]
+	paidUntil, paid := list.paidUntil(npub)
+	d := decision{
+		version:  list.version,
+		expires:  paidUntil,
+		canWrite: owner || policy.publicWrite || allowed || list.wot[npub] > 0 || paid,
+		canRead:  policy.publicRead || owner || allowed,
+	}
+	a.decisions.put(npub, d)
+	return d
+}
 
-	// Check if npub is in allowed list
-	a.npubMutex.RLock()
-	defer a.npubMutex.RUnlock()
-
-	return a.allowedNpubs[npub]
+// publishAllowList swaps in a new allow list snapshot, invalidating every
+// cached decision. Callers must hold npubMutex.
+func (a *Controller) publishAllowList(npubs map[string]bool) {
+	a.allowedNpubs = npubs
+	a.allowList.Store(&allowList{
+		npubs:    npubs,
+		approved: a.writers.approved(),
+		wot:      a.trustGraph,
+		paid:     a.paid,
+		version:  a.allowList.Load().version + 1,
+	})
 }
 
 func (a *Controller) GetAllowedNpubs() []string {
@@ -114,74 +176,95 @@ func (a *Controller) GetAllowedNpubs() []string {
 	return npubs
 }
 
+// AllowsPublicRead reports whether every connection may read, authenticated
+// or not
+func (a *Controller) AllowsPublicRead() bool {
+	return a.policy.Load().publicRead
+}
+
+// AllowsPublicWrite reports whether every pubkey may publish
+func (a *Controller) AllowsPublicWrite() bool {
+	return a.policy.Load().publicWrite
+}
+
+// UpdatePolicy applies reloaded public read/write and anonymous write kind
+// settings, invalidating every cached decision
+func (a *Controller) UpdatePolicy(cfg config.AccessConfig) {
+	a.npubMutex.Lock()
+	defer a.npubMutex.Unlock()
+	a.policy.Store(newPolicy(cfg))
+	a.publishAllowList(a.allowedNpubs)
+}
+
+// IsKnownWriter reports whether npub may write on its own standing, as the
+// owner, a followed npub, a member of the trust graph, an approved writer or
+// a paying one, rather than through public or anonymous writes
+func (a *Controller) IsKnownWriter(npub string) bool {
+	list := a.allowList.Load()
+	return npub == a.ownerNpub || list.npubs[npub] || list.wot[npub] > 0 || list.approved[npub] || list.paidFor(npub)
+}
+
 func (a *Controller) IsOwner(npub string) bool {
 	return npub == a.ownerNpub
 }
 
-func (a *Controller) loadFollowList() error {
-	// Query the owner's Kind 3 (follow list) event
-	req := map[string]interface{}{
-		"ids":   []string{a.ownerNpub},
-		"kinds": []int{3},
-		"limit": 1,
+// WoTDistance returns 0 for the owner, 1 for npubs the owner follows, the
+// depth in the trust graph for npubs further out and -1 for everyone else
+func (a *Controller) WoTDistance(npub string) int {
+	if npub == a.ownerNpub {
+		return 0
+	}
+	list := a.allowList.Load()
+	if list.npubs[npub] {
+		return 1
+	}
+	if depth, ok := list.wot[npub]; ok {
+		return depth
 	}
+	return -1
+}
 
-	reqBody, err := json.Marshal([]interface{}{
-		"REQ",
-		"follow-list",
-		req,
-	})
+func (a *Controller) loadFollowList() error {
+	owner, err := hexPubkey(a.ownerNpub)
 	if err != nil {
-		return fmt.Errorf("failed to marshal request: %w", err)
+		return err
 	}
 
-	// Send request to relay
-	resp, err := a.httpClient.Post(
-		a.config.RelayURL,
-		"application/json",
-		bytes.NewReader(reqBody),
-	)
+	// Query the owner's Kind 3 (follow list) event
+	events, err := a.query(nostr.Filter{
+		Authors: []string{owner},
+		Kinds:   []int{nostr.KindFollowList},
+		Limit:   1,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to query relay: %w", err)
+		return err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("relay returned status: %d", resp.StatusCode)
+	// Relays may hold different versions, the newest wins
+	var latest *nostr.Event
+	for _, event := range events {
+		if event.PubKey == owner && event.Kind == nostr.KindFollowList && (latest == nil || event.CreatedAt > latest.CreatedAt) {
+			latest = event
+		}
 	}
 
-	// Parse response
-	var events []interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
-		return fmt.Errorf("failed to decode response: %w", err)
+	// Relays that answer without the follow list don't empty the allow
+	// list; the one loaded before stays
+	if latest == nil {
+		return fmt.Errorf("no follow list of %s on the source relays", a.ownerNpub)
 	}
 
 	// Extract p tags from Kind 3 event
 	var allowedNpubs = make(map[string]bool)
-
-	for _, eventData := range events {
-		if eventArray, ok := eventData.([]interface{}); ok && len(eventArray) >= 3 {
-			if eventType, ok := eventArray[0].(string); ok && eventType == "EVENT" {
-				if event, ok := eventArray[2].(map[string]interface{}); ok {
-					if tags, ok := event["tags"].([]interface{}); ok {
-						for _, tag := range tags {
-							if tagArray, ok := tag.([]interface{}); ok && len(tagArray) >= 2 {
-								if tagType, ok := tagArray[0].(string); ok && tagType == "p" {
-									if npub, ok := tagArray[1].(string); ok {
-										allowedNpubs[npub] = true
-									}
-								}
-							}
-						}
-					}
-				}
-			}
+	for _, tag := range latest.Tags {
+		if len(tag) >= 2 && tag[0] == "p" {
+			allowedNpubs[tag[1]] = true
 		}
 	}
 
 	// Update allowed npubs
 	a.npubMutex.Lock()
-	a.allowedNpubs = allowedNpubs
+	a.publishAllowList(allowedNpubs)
 	a.lastUpdate = time.Now()
 	a.npubMutex.Unlock()
 
@@ -189,13 +272,96 @@ func (a *Controller) loadFollowList() error {
 	return nil
 }
 
+// sourceRelays returns the relays follow lists are fetched from
+func (a *Controller) sourceRelays() []string {
+	var urls []string
+	seen := make(map[string]bool)
+	for _, url := range append([]string{a.config.RelayURL}, a.config.RelayURLs...) {
+		if url = nostr.NormalizeURL(url); url != "" && !seen[url] {
+			seen[url] = true
+			urls = append(urls, url)
+		}
+	}
+	return urls
+}
+
+// query fetches the events matching filter from the source relays, reading
+// from each until its EOSE or the query timeout. It fails only when no
+// relay could be reached, or none answered in time.
+func (a *Controller) query(filter nostr.Filter) ([]*nostr.Event, error) {
+	urls := a.sourceRelays()
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("no relay to fetch the follow list from")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.queryTimeout)
+	defer cancel()
+	// Closing the pool closes the relay connections it opened
+	pool := nostr.NewSimplePool(ctx)
+	defer pool.Close("query done")
+
+	var connected []string
+	var errs []error
+	for _, url := range urls {
+		if _, err := pool.EnsureRelay(url); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", url, err))
+			continue
+		}
+		connected = append(connected, url)
+	}
+	if len(connected) == 0 {
+		return nil, fmt.Errorf("failed to query relay: %w", errors.Join(errs...))
+	}
+
+	var events []*nostr.Event
+	for event := range pool.FetchMany(ctx, connected, filter) {
+		events = append(events, event.Event)
+	}
+	if ctx.Err() != nil && len(events) == 0 {
+		return nil, fmt.Errorf("failed to query relay: no answer within %s", a.queryTimeout)
+	}
+	return events, nil
+}
+
+// hexPubkey accepts an npub or a hex pubkey
+func hexPubkey(pubkey string) (string, error) {
+	if nostr.IsValidPublicKey(pubkey) {
+		return pubkey, nil
+	}
+	prefix, data, err := nip19.Decode(pubkey)
+	if err != nil || prefix != "npub" {
+		return "", fmt.Errorf("invalid owner pubkey %q: expected an npub or hex pubkey", pubkey)
+	}
+	return data.(string), nil
+}
+
+// refresh reloads the follow list and, as configured, the trust graph and
+// the relays the follows publish to
+func (a *Controller) refresh() error {
+	if err := a.loadFollowList(); err != nil {
+		return err
+	}
+	var errs []error
+	if a.config.WoT.Enabled {
+		if err := a.loadTrustGraph(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if a.config.FollowRelays {
+		if err := a.loadRelayLists(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
 func (a *Controller) updateLoop(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-a.updateTicker.C:
-			if err := a.loadFollowList(); err != nil {
+			if err := a.refresh(); err != nil {
 				log.Printf("Failed to update follow list: %v", err)
 			}
 		}
@@ -206,11 +372,17 @@ func (a *Controller) GetStats() map[string]interface{} {
 	a.npubMutex.RLock()
 	defer a.npubMutex.RUnlock()
 
+	policy := a.policy.Load()
 	return map[string]interface{}{
-		"owner_npub":    a.ownerNpub,
-		"allowed_count": len(a.allowedNpubs),
-		"last_update":   a.lastUpdate,
-		"public_read":   a.config.AllowPublicRead,
-		"public_write":  a.config.AllowPublicWrite,
+		"owner_npub":            a.ownerNpub,
+		"allowed_count":         len(a.allowedNpubs),
+		"follow_relays":         len(a.followRelays),
+		"wot":                   a.wotStats(),
+		"last_update":           a.lastUpdate,
+		"public_read":           policy.publicRead,
+		"public_write":          policy.publicWrite,
+		"anonymous_write_kinds": policy.kinds,
+		"writer_approval":       a.writerStats(),
+		"decisions":             a.metrics.snapshot(),
 	}
 }
@@ -3,14 +3,24 @@ package access
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"mercury-relay/internal/config"
 	"mercury-relay/internal/models"
 	"mercury-relay/test/helpers"
+
+	"github.com/gorilla/websocket"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
 )
 
 func TestWritePermissionCheck(t *testing.T) {
@@ -63,6 +73,24 @@ func TestWritePermissionCheck(t *testing.T) {
 		canWrite := controller.CanWrite("npub1anyone")
 		helpers.AssertBoolEqual(t, true, canWrite)
 	})
+	t.Run("Anonymous write kinds", func(t *testing.T) {
+		cfg := config.AccessConfig{
+			AdminNpubs:          []string{"npub1owner"},
+			AllowPublicWrite:    false,
+			AllowPublicRead:     true,
+			AnonymousWriteKinds: []int{7, 9735},
+		}
+		controller := NewController(cfg)
+
+		// Reactions and zaps are open to anyone, long-form is not
+		helpers.AssertBoolEqual(t, true, controller.CanWriteKind("npub1stranger", 7))
+		helpers.AssertBoolEqual(t, true, controller.CanWriteKind("npub1stranger", 9735))
+		helpers.AssertBoolEqual(t, false, controller.CanWriteKind("npub1stranger", 30023))
+		helpers.AssertBoolEqual(t, true, controller.CanWriteKind("npub1owner", 30023))
+
+		decisions := controller.GetStats()["decisions"].(map[string]interface{})
+		helpers.AssertInt64Equal(t, 2, decisions["anonymous_writes"].(int64))
+	})
 }
 
 func TestReadPermissionCheck(t *testing.T) {
@@ -107,37 +135,68 @@ func TestReadPermissionCheck(t *testing.T) {
 	})
 }
 
+// testRelay answers each REQ with the events handler returns for its
+// filter, then EOSE
+func testRelay(t *testing.T, handler func(filter nostr.Filter) []*nostr.Event) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			var msg []json.RawMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			var label, subID string
+			json.Unmarshal(msg[0], &label)
+			if label != "REQ" || len(msg) < 3 {
+				continue
+			}
+			json.Unmarshal(msg[1], &subID)
+			var filter nostr.Filter
+			json.Unmarshal(msg[2], &filter)
+			for _, event := range handler(filter) {
+				conn.WriteJSON([]interface{}{"EVENT", subID, event})
+			}
+			conn.WriteJSON([]interface{}{"EOSE", subID})
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+// signedEvent returns an event of kind by sk with tags
+func signedEvent(t *testing.T, sk string, kind, createdAt int, tags ...nostr.Tag) *nostr.Event {
+	event := &nostr.Event{Kind: kind, CreatedAt: nostr.Timestamp(createdAt), Tags: nostr.Tags(tags)}
+	if event.Tags == nil {
+		event.Tags = nostr.Tags{}
+	}
+	helpers.AssertNoError(t, event.Sign(sk))
+	return event
+}
+
+// testOwner returns a fresh owner key as secret key, hex pubkey and npub
+func testOwner() (string, string, string) {
+	sk := nostr.GeneratePrivateKey()
+	pubkey, _ := nostr.GetPublicKey(sk)
+	npub, _ := nip19.EncodePublicKey(pubkey)
+	return sk, pubkey, npub
+}
+
 func TestFollowListLoading(t *testing.T) {
 	t.Run("Successful follow list fetch", func(t *testing.T) {
-		eg := models.NewEventGenerator()
-		ownerNpub := eg.GetOwnerNpub()
-		followerNpub := eg.GetFollowerNpub()
+		ownerSK, ownerPubkey, ownerNpub := testOwner()
+		followerNpub := models.NewEventGenerator().GetFollowerNpub()
 
-		// Create mock HTTP server
-		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Simulate Nostr relay response with kind 3 event
-			response := []interface{}{
-				[]interface{}{
-					"EVENT",
-					"follow-list",
-					map[string]interface{}{
-						"id":         "follow_event_id",
-						"pubkey":     ownerNpub,
-						"created_at": 1640995200,
-						"kind":       3,
-						"tags": []interface{}{
-							[]interface{}{"p", followerNpub, "", "follow"},
-						},
-						"content": "",
-						"sig":     "signature",
-					},
-				},
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
-		}))
-		defer server.Close()
+		server := testRelay(t, func(filter nostr.Filter) []*nostr.Event {
+			// The owner's npub is queried as a hex pubkey
+			helpers.AssertStringEqual(t, fmt.Sprint([]string{ownerPubkey}), fmt.Sprint(filter.Authors))
+			helpers.AssertStringEqual(t, "[3]", fmt.Sprint(filter.Kinds))
+			return []*nostr.Event{signedEvent(t, ownerSK, 3, 1640995200, nostr.Tag{"p", followerNpub, "", "follow"})}
+		})
 
 		cfg := config.AccessConfig{
 			AdminNpubs:       []string{ownerNpub},
@@ -154,9 +213,28 @@ func TestFollowListLoading(t *testing.T) {
 		helpers.AssertBoolEqual(t, true, controller.allowedNpubs[followerNpub])
 	})
 
+	t.Run("Newest follow list across relays", func(t *testing.T) {
+		ownerSK, ownerPubkey, _ := testOwner()
+		older := testRelay(t, func(filter nostr.Filter) []*nostr.Event {
+			return []*nostr.Event{signedEvent(t, ownerSK, 3, 100, nostr.Tag{"p", "npub1old"})}
+		})
+		newer := testRelay(t, func(filter nostr.Filter) []*nostr.Event {
+			return []*nostr.Event{signedEvent(t, ownerSK, 3, 200, nostr.Tag{"p", "npub1new"})}
+		})
+		down := httptest.NewServer(http.NotFoundHandler())
+		down.Close()
+
+		controller := NewController(config.AccessConfig{
+			AdminNpubs: []string{ownerPubkey},
+			RelayURL:   older.URL,
+			RelayURLs:  []string{down.URL, newer.URL},
+		})
+		helpers.AssertNoError(t, controller.loadFollowList())
+		helpers.AssertStringEqual(t, "[npub1new]", fmt.Sprint(controller.GetAllowedNpubs()))
+	})
+
 	t.Run("Relay unavailable", func(t *testing.T) {
-		eg := models.NewEventGenerator()
-		ownerNpub := eg.GetOwnerNpub()
+		_, _, ownerNpub := testOwner()
 
 		cfg := config.AccessConfig{
 			AdminNpubs:       []string{ownerNpub},
@@ -176,11 +254,10 @@ func TestFollowListLoading(t *testing.T) {
 		helpers.AssertBoolEqual(t, true, controller.allowedNpubs["npub1existing"])
 	})
 
-	t.Run("Invalid JSON response", func(t *testing.T) {
-		eg := models.NewEventGenerator()
-		ownerNpub := eg.GetOwnerNpub()
+	t.Run("Not a relay", func(t *testing.T) {
+		_, _, ownerNpub := testOwner()
 
-		// Create mock HTTP server returning invalid JSON
+		// Create mock HTTP server that doesn't speak WebSocket
 		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.Write([]byte("invalid json"))
 		}))
@@ -197,40 +274,54 @@ func TestFollowListLoading(t *testing.T) {
 		err := controller.loadFollowList()
 		helpers.AssertError(t, err)
 	})
-}
 
-func TestPeriodicUpdate(t *testing.T) {
-	t.Run("Follow list auto-update", func(t *testing.T) {
-		eg := models.NewEventGenerator()
-		ownerNpub := eg.GetOwnerNpub()
-		followerNpub := eg.GetFollowerNpub()
-
-		updateCount := 0
+	t.Run("Relay never answers", func(t *testing.T) {
+		_, _, ownerNpub := testOwner()
+		upgrader := websocket.Upgrader{}
 		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			updateCount++
-			response := []interface{}{
-				[]interface{}{
-					"EVENT",
-					"follow-list",
-					map[string]interface{}{
-						"id":         "follow_event_id",
-						"pubkey":     ownerNpub,
-						"created_at": 1640995200,
-						"kind":       3,
-						"tags": []interface{}{
-							[]interface{}{"p", followerNpub, "", "follow"},
-						},
-						"content": "",
-						"sig":     "signature",
-					},
-				},
+			conn, err := upgrader.Upgrade(w, r, nil)
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			for {
+				if _, _, err := conn.ReadMessage(); err != nil {
+					return
+				}
 			}
-
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
 		}))
 		defer server.Close()
 
+		controller := NewController(config.AccessConfig{
+			AdminNpubs:   []string{ownerNpub},
+			RelayURL:     server.URL,
+			QueryTimeout: 100 * time.Millisecond,
+		})
+		err := controller.loadFollowList()
+		helpers.AssertErrorContains(t, err, "no answer within")
+	})
+
+	t.Run("Invalid owner", func(t *testing.T) {
+		controller := NewController(config.AccessConfig{
+			AdminNpubs: []string{"npub1owner"},
+			RelayURL:   "ws://127.0.0.1:1",
+		})
+		err := controller.loadFollowList()
+		helpers.AssertErrorContains(t, err, "invalid owner pubkey")
+	})
+}
+
+func TestPeriodicUpdate(t *testing.T) {
+	t.Run("Follow list auto-update", func(t *testing.T) {
+		ownerSK, _, ownerNpub := testOwner()
+		followerNpub := models.NewEventGenerator().GetFollowerNpub()
+
+		var updateCount atomic.Int32
+		server := testRelay(t, func(filter nostr.Filter) []*nostr.Event {
+			updateCount.Add(1)
+			return []*nostr.Event{signedEvent(t, ownerSK, 3, 1640995200, nostr.Tag{"p", followerNpub, "", "follow"})}
+		})
+
 		cfg := config.AccessConfig{
 			AdminNpubs:       []string{ownerNpub},
 			AllowPublicWrite: false,
@@ -250,12 +341,12 @@ func TestPeriodicUpdate(t *testing.T) {
 		time.Sleep(200 * time.Millisecond)
 
 		// Should have made at least one update call
-		if updateCount == 0 {
-			t.Errorf("Expected at least one update call, got %d", updateCount)
+		if updateCount.Load() == 0 {
+			t.Errorf("Expected at least one update call, got %d", updateCount.Load())
 		}
 
 		// Check that follower was added
-		helpers.AssertBoolEqual(t, true, controller.allowedNpubs[followerNpub])
+		helpers.AssertBoolEqual(t, true, controller.IsKnownWriter(followerNpub))
 	})
 
 	t.Run("Update during context cancellation", func(t *testing.T) {
@@ -343,17 +434,13 @@ func TestAccessControlMethods(t *testing.T) {
 }
 
 func TestAccessControlEdgeCases(t *testing.T) {
-	eg := models.NewEventGenerator()
-	ownerNpub := eg.GetOwnerNpub()
+	ownerSK, _, ownerNpub := testOwner()
 
 	t.Run("Empty follow list", func(t *testing.T) {
-		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// Return empty event list
-			response := []interface{}{}
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
-		}))
-		defer server.Close()
+		// The relay has no follow list
+		server := testRelay(t, func(filter nostr.Filter) []*nostr.Event {
+			return nil
+		})
 
 		cfg := config.AccessConfig{
 			AdminNpubs:       []string{ownerNpub},
@@ -362,38 +449,20 @@ func TestAccessControlEdgeCases(t *testing.T) {
 			RelayURL:         server.URL,
 		}
 		controller := NewController(cfg)
+		controller.publishAllowList(map[string]bool{"npub1existing": true})
 
 		err := controller.loadFollowList()
-		helpers.AssertNoError(t, err)
+		helpers.AssertErrorContains(t, err, "no follow list")
 
-		// Allowed list should be empty
-		helpers.AssertIntEqual(t, 0, len(controller.allowedNpubs))
+		// The allow list loaded before is kept
+		helpers.AssertStringEqual(t, "[npub1existing]", fmt.Sprint(controller.GetAllowedNpubs()))
+		helpers.AssertTrue(t, controller.CanWrite("npub1existing"))
 	})
 
 	t.Run("Follow list with no p tags", func(t *testing.T) {
-		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			response := []interface{}{
-				[]interface{}{
-					"EVENT",
-					"follow-list",
-					map[string]interface{}{
-						"id":         "follow_event_id",
-						"pubkey":     ownerNpub,
-						"created_at": 1640995200,
-						"kind":       3,
-						"tags": []interface{}{
-							[]interface{}{"t", "follows"},
-						},
-						"content": "",
-						"sig":     "signature",
-					},
-				},
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
-		}))
-		defer server.Close()
+		server := testRelay(t, func(filter nostr.Filter) []*nostr.Event {
+			return []*nostr.Event{signedEvent(t, ownerSK, 3, 1640995200, nostr.Tag{"t", "follows"})}
+		})
 
 		cfg := config.AccessConfig{
 			AdminNpubs:       []string{ownerNpub},
@@ -410,6 +479,25 @@ func TestAccessControlEdgeCases(t *testing.T) {
 		helpers.AssertIntEqual(t, 0, len(controller.allowedNpubs))
 	})
 
+	t.Run("Forged follow list", func(t *testing.T) {
+		// Signed by someone else, or with a broken signature
+		forged := signedEvent(t, ownerSK, 3, 1640995200, nostr.Tag{"p", "npub1forged"})
+		forged.Sig = strings.Repeat("0", 128)
+		server := testRelay(t, func(filter nostr.Filter) []*nostr.Event {
+			return []*nostr.Event{
+				forged,
+				signedEvent(t, nostr.GeneratePrivateKey(), 3, 1640995200, nostr.Tag{"p", "npub1stranger"}),
+			}
+		})
+
+		controller := NewController(config.AccessConfig{
+			AdminNpubs: []string{ownerNpub},
+			RelayURL:   server.URL,
+		})
+		helpers.AssertErrorContains(t, controller.loadFollowList(), "no follow list")
+		helpers.AssertIntEqual(t, 0, len(controller.allowedNpubs))
+	})
+
 	t.Run("HTTP server error", func(t *testing.T) {
 		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -432,43 +520,19 @@ func TestAccessControlEdgeCases(t *testing.T) {
 // Test integration scenarios
 func TestAccessControlIntegration(t *testing.T) {
 	eg := models.NewEventGenerator()
-	ownerNpub := eg.GetOwnerNpub()
+	ownerSK, _, ownerNpub := testOwner()
 	followerNpub := eg.GetFollowerNpub()
 
 	t.Run("Dynamic follow list updates", func(t *testing.T) {
-		updateCount := 0
-		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			updateCount++
-
+		var updateCount atomic.Int32
+		server := testRelay(t, func(filter nostr.Filter) []*nostr.Event {
 			// First update: follower is included
 			// Second update: follower is removed
-			tags := []interface{}{}
-			if updateCount == 1 {
-				tags = []interface{}{
-					[]interface{}{"p", followerNpub, "", "follow"},
-				}
+			if updateCount.Add(1) == 1 {
+				return []*nostr.Event{signedEvent(t, ownerSK, 3, 1640995200, nostr.Tag{"p", followerNpub, "", "follow"})}
 			}
-
-			response := []interface{}{
-				[]interface{}{
-					"EVENT",
-					"follow-list",
-					map[string]interface{}{
-						"id":         "follow_event_id",
-						"pubkey":     ownerNpub,
-						"created_at": 1640995200,
-						"kind":       3,
-						"tags":       tags,
-						"content":    "",
-						"sig":        "signature",
-					},
-				},
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(response)
-		}))
-		defer server.Close()
+			return []*nostr.Event{signedEvent(t, ownerSK, 3, 1640995300)}
+		})
 
 		cfg := config.AccessConfig{
 			AdminNpubs:       []string{ownerNpub},
@@ -485,14 +549,11 @@ func TestAccessControlIntegration(t *testing.T) {
 		err := controller.Start(ctx)
 		helpers.AssertNoError(t, err)
 
-		// Wait for initial load and first update
-		time.Sleep(50 * time.Millisecond)
-
 		// Follower should be allowed after first update
 		helpers.AssertBoolEqual(t, true, controller.CanWrite(followerNpub))
 
 		// Wait for second update (100ms interval)
-		time.Sleep(110 * time.Millisecond)
+		time.Sleep(150 * time.Millisecond)
 
 		// Follower should no longer be allowed after second update
 		helpers.AssertBoolEqual(t, false, controller.CanWrite(followerNpub))
@@ -511,3 +572,363 @@ func TestAccessControlIntegration(t *testing.T) {
 		helpers.AssertBoolEqual(t, true, controller.CanRead(ownerNpub))
 	})
 }
+
+func TestAccessDecisionCache(t *testing.T) {
+	ownerNpub := "npub1owner"
+	followerNpub := "npub1follower"
+
+	t.Run("Cached decisions are invalidated by a new allow list", func(t *testing.T) {
+		controller := NewController(config.AccessConfig{
+			AdminNpubs:       []string{ownerNpub},
+			AllowPublicWrite: false,
+			AllowPublicRead:  false,
+		})
+
+		helpers.AssertBoolEqual(t, false, controller.CanWrite(followerNpub))
+		helpers.AssertBoolEqual(t, false, controller.CanWrite(followerNpub))
+
+		controller.npubMutex.Lock()
+		controller.publishAllowList(map[string]bool{followerNpub: true})
+		controller.npubMutex.Unlock()
+
+		helpers.AssertBoolEqual(t, true, controller.CanWrite(followerNpub))
+		helpers.AssertBoolEqual(t, true, controller.CanRead(followerNpub))
+
+		decisions := controller.GetStats()["decisions"].(map[string]interface{})
+		helpers.AssertInt64Equal(t, 1, decisions["write_allowed"].(int64))
+		helpers.AssertInt64Equal(t, 2, decisions["write_denied"].(int64))
+		helpers.AssertInt64Equal(t, 1, decisions["read_allowed"].(int64))
+		helpers.AssertInt64Equal(t, 2, decisions["cache_hits"].(int64))
+		helpers.AssertInt64Equal(t, 2, decisions["cache_misses"].(int64))
+	})
+
+	t.Run("Concurrent checks during refresh", func(t *testing.T) {
+		controller := NewController(config.AccessConfig{
+			AdminNpubs: []string{ownerNpub},
+		})
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 1000; j++ {
+					controller.CanWrite(followerNpub)
+					helpers.AssertBoolEqual(t, true, controller.CanWrite(ownerNpub))
+				}
+			}()
+		}
+		for i := 0; i < 100; i++ {
+			controller.npubMutex.Lock()
+			controller.publishAllowList(map[string]bool{followerNpub: i%2 == 0})
+			controller.npubMutex.Unlock()
+		}
+		wg.Wait()
+
+		helpers.AssertBoolEqual(t, false, controller.CanWrite(followerNpub))
+	})
+}
+
+func BenchmarkCanWrite(b *testing.B) {
+	controller := NewController(config.AccessConfig{
+		AdminNpubs: []string{"npub1owner"},
+	})
+	controller.npubMutex.Lock()
+	controller.publishAllowList(map[string]bool{"npub1follower": true})
+	controller.npubMutex.Unlock()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			controller.CanWrite("npub1follower")
+		}
+	})
+}
+
+func TestWriterApproval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "writers.json")
+	cfg := config.AccessConfig{
+		AllowPublicRead: true,
+		WriterApproval:  true,
+		WritersPath:     path,
+	}
+	controller := NewController(cfg)
+
+	sk := nostr.GeneratePrivateKey()
+	writer, _ := nostr.GetPublicKey(sk)
+	event := &nostr.Event{PubKey: writer, CreatedAt: nostr.Now(), Kind: 1, Content: "May I write here?"}
+	event.Sign(sk)
+
+	t.Run("Queues unknown writers", func(t *testing.T) {
+		helpers.AssertFalse(t, controller.CanWrite(writer))
+
+		status, err := controller.RequestWrite(event)
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, string(WriterPending), string(status))
+		controller.RequestWrite(event)
+
+		pending := controller.PendingWriters()
+		helpers.AssertIntEqual(t, 1, len(pending))
+		helpers.AssertStringEqual(t, writer, pending[0].Pubkey)
+		helpers.AssertIntEqual(t, 2, pending[0].Attempts)
+		helpers.AssertStringEqual(t, event.ID, pending[0].Sample.ID)
+	})
+
+	t.Run("Approval grants write access once notified", func(t *testing.T) {
+		helpers.AssertNoError(t, controller.ApproveWriter(writer, "admin"))
+		helpers.AssertTrue(t, controller.CanWrite(writer))
+		helpers.AssertIntEqual(t, 0, len(controller.PendingWriters()))
+
+		helpers.AssertTrue(t, controller.TakeApprovalNotice(writer))
+		helpers.AssertFalse(t, controller.TakeApprovalNotice(writer))
+	})
+
+	t.Run("Approvals survive follow list refreshes and restarts", func(t *testing.T) {
+		controller.npubMutex.Lock()
+		controller.publishAllowList(map[string]bool{})
+		controller.npubMutex.Unlock()
+		helpers.AssertTrue(t, controller.CanWrite(writer))
+
+		restarted := NewController(cfg)
+		helpers.AssertTrue(t, restarted.CanWrite(writer))
+		helpers.AssertFalse(t, restarted.TakeApprovalNotice(writer))
+	})
+
+	t.Run("Denial revokes access", func(t *testing.T) {
+		helpers.AssertNoError(t, controller.DenyWriter(writer, "admin"))
+		helpers.AssertFalse(t, controller.CanWrite(writer))
+
+		status, err := controller.RequestWrite(event)
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, string(WriterDenied), string(status))
+		helpers.AssertIntEqual(t, 0, len(controller.PendingWriters()))
+	})
+
+	t.Run("Bounds the pending queue", func(t *testing.T) {
+		cfg := config.AccessConfig{WriterApproval: true, MaxPendingWriters: 1}
+		controller := NewController(cfg)
+
+		_, err := controller.RequestWrite(&nostr.Event{PubKey: strings.Repeat("a", 64), Kind: 1})
+		helpers.AssertNoError(t, err)
+		_, err = controller.RequestWrite(&nostr.Event{PubKey: strings.Repeat("b", 64), Kind: 1})
+		helpers.AssertTrue(t, errors.Is(err, ErrPendingWritersFull))
+	})
+
+	t.Run("Disabled without writer approval", func(t *testing.T) {
+		_, err := NewController(config.AccessConfig{}).RequestWrite(event)
+		helpers.AssertTrue(t, errors.Is(err, ErrWriterApprovalDisabled))
+	})
+}
+
+func TestUpdatePolicy(t *testing.T) {
+	ownerNpub := "npub1owner"
+	otherNpub := "npub1other"
+	controller := NewController(config.AccessConfig{
+		AdminNpubs:      []string{ownerNpub},
+		AllowPublicRead: true,
+	})
+
+	helpers.AssertBoolEqual(t, true, controller.CanRead(otherNpub))
+	helpers.AssertBoolEqual(t, false, controller.CanWrite(otherNpub))
+	helpers.AssertBoolEqual(t, false, controller.CanWriteKind(otherNpub, 7))
+
+	controller.UpdatePolicy(config.AccessConfig{
+		AdminNpubs:          []string{ownerNpub},
+		AllowPublicWrite:    true,
+		AnonymousWriteKinds: []int{7},
+	})
+
+	// Cached decisions are not served after the policy changes
+	helpers.AssertBoolEqual(t, false, controller.CanRead(otherNpub))
+	helpers.AssertBoolEqual(t, true, controller.CanWrite(otherNpub))
+	helpers.AssertBoolEqual(t, true, controller.CanWriteKind(otherNpub, 7))
+	helpers.AssertBoolEqual(t, true, controller.AllowsPublicWrite())
+	helpers.AssertBoolEqual(t, false, controller.AllowsPublicRead())
+	helpers.AssertBoolEqual(t, true, controller.CanRead(ownerNpub))
+
+	stats := controller.GetStats()
+	helpers.AssertBoolEqual(t, false, stats["public_read"].(bool))
+	helpers.AssertBoolEqual(t, true, stats["public_write"].(bool))
+}
+
+func TestFollowRelays(t *testing.T) {
+	ownerSK, _, ownerNpub := testOwner()
+	alice, bob, stranger := nostr.GeneratePrivateKey(), nostr.GeneratePrivateKey(), nostr.GeneratePrivateKey()
+	alicePubkey, _ := nostr.GetPublicKey(alice)
+	bobPubkey, _ := nostr.GetPublicKey(bob)
+
+	server := testRelay(t, func(filter nostr.Filter) []*nostr.Event {
+		if filter.Kinds[0] == 3 {
+			return []*nostr.Event{signedEvent(t, ownerSK, 3, 100,
+				nostr.Tag{"p", alicePubkey},
+				nostr.Tag{"p", bobPubkey},
+				nostr.Tag{"p", "npub1notahexkey"},
+			)}
+		}
+		helpers.AssertIntEqual(t, 2, len(filter.Authors))
+		return []*nostr.Event{
+			signedEvent(t, alice, 10002, 100, nostr.Tag{"r", "wss://old.example.com"}),
+			signedEvent(t, alice, 10002, 200,
+				nostr.Tag{"r", "wss://shared.example.com"},
+				nostr.Tag{"r", "wss://alice.example.com/", "write"},
+				nostr.Tag{"r", "wss://inbox.example.com", "read"},
+			),
+			signedEvent(t, bob, 10002, 150, nostr.Tag{"r", "wss://shared.example.com/"}),
+			signedEvent(t, stranger, 10002, 300, nostr.Tag{"r", "wss://spam.example.com"}),
+		}
+	})
+
+	cfg := config.AccessConfig{
+		AdminNpubs:      []string{ownerNpub},
+		RelayURL:        server.URL,
+		FollowRelays:    true,
+		MaxFollowRelays: -1,
+	}
+	controller := NewController(cfg)
+	var got []config.UpstreamRelay
+	controller.OnFollowRelays(func(relays []config.UpstreamRelay) { got = relays })
+	helpers.AssertNoError(t, controller.refresh())
+
+	// Relays shared by the most follows come first, read-only and
+	// superseded entries and strangers' lists are ignored
+	helpers.AssertIntEqual(t, 2, len(got))
+	helpers.AssertStringEqual(t, "wss://shared.example.com", got[0].URL)
+	helpers.AssertBoolEqual(t, true, got[0].Enabled)
+	helpers.AssertIntEqual(t, 1, len(got[0].Filters))
+	authors := []string{alicePubkey, bobPubkey}
+	if bobPubkey < alicePubkey {
+		authors = []string{bobPubkey, alicePubkey}
+	}
+	helpers.AssertStringEqual(t, fmt.Sprint(authors), fmt.Sprint(got[0].Filters[0].Authors))
+	helpers.AssertStringEqual(t, "wss://alice.example.com", got[1].URL)
+	helpers.AssertStringEqual(t, fmt.Sprint([]string{alicePubkey}), fmt.Sprint(got[1].Filters[0].Authors))
+	helpers.AssertIntEqual(t, 2, controller.GetStats()["follow_relays"].(int))
+
+	cfg.MaxFollowRelays = 1
+	controller = NewController(cfg)
+	helpers.AssertNoError(t, controller.refresh())
+	helpers.AssertIntEqual(t, 1, len(controller.FollowRelays()))
+	helpers.AssertStringEqual(t, "wss://shared.example.com", controller.FollowRelays()[0].URL)
+
+	// Without follow_relays only the follow list is loaded
+	cfg.FollowRelays = false
+	controller = NewController(cfg)
+	helpers.AssertNoError(t, controller.refresh())
+	helpers.AssertIntEqual(t, 0, len(controller.FollowRelays()))
+}
+
+func TestWoTAccess(t *testing.T) {
+	ownerSK, ownerPubkey, ownerNpub := testOwner()
+	keys := make([]string, 4)
+	pubkeys := make([]string, 4)
+	for i := range keys {
+		keys[i] = nostr.GeneratePrivateKey()
+		pubkeys[i], _ = nostr.GetPublicKey(keys[i])
+	}
+
+	// owner -> 0 -> 1 -> 2 -> 3, and 1 follows the owner back
+	followLists := map[string]*nostr.Event{
+		ownerPubkey: signedEvent(t, ownerSK, 3, 100, nostr.Tag{"p", pubkeys[0]}),
+		pubkeys[0]:  signedEvent(t, keys[0], 3, 100, nostr.Tag{"p", pubkeys[1]}, nostr.Tag{"p", "not-a-pubkey"}),
+		pubkeys[1]:  signedEvent(t, keys[1], 3, 100, nostr.Tag{"p", pubkeys[2]}, nostr.Tag{"p", ownerPubkey}),
+		pubkeys[2]:  signedEvent(t, keys[2], 3, 100, nostr.Tag{"p", pubkeys[3]}),
+	}
+	server := testRelay(t, func(filter nostr.Filter) []*nostr.Event {
+		var events []*nostr.Event
+		for _, author := range filter.Authors {
+			if event, ok := followLists[author]; ok {
+				events = append(events, event)
+			}
+		}
+		return events
+	})
+
+	cfg := config.AccessConfig{
+		AdminNpubs: []string{ownerNpub},
+		RelayURL:   server.URL,
+		WoT: config.WoTAccessConfig{
+			Enabled:         true,
+			Depth:           2,
+			MaxPubkeys:      -1,
+			RateMultipliers: map[int]float64{2: 0.5},
+		},
+	}
+	controller := NewController(cfg)
+	helpers.AssertNoError(t, controller.refresh())
+
+	helpers.AssertBoolEqual(t, true, controller.CanWrite(pubkeys[0]))
+	helpers.AssertBoolEqual(t, true, controller.CanWrite(pubkeys[1]))
+	helpers.AssertBoolEqual(t, false, controller.CanWrite(pubkeys[2]))
+	helpers.AssertBoolEqual(t, true, controller.IsKnownWriter(pubkeys[1]))
+	// The trust graph grants writes only
+	helpers.AssertBoolEqual(t, false, controller.CanRead(pubkeys[1]))
+
+	helpers.AssertIntEqual(t, 1, controller.WoTDistance(pubkeys[0]))
+	helpers.AssertIntEqual(t, 2, controller.WoTDistance(pubkeys[1]))
+	helpers.AssertIntEqual(t, -1, controller.WoTDistance(pubkeys[2]))
+	helpers.AssertTrue(t, controller.RateMultiplier(pubkeys[0]) == 1)
+	helpers.AssertTrue(t, controller.RateMultiplier(pubkeys[1]) == 0.5)
+	helpers.AssertTrue(t, controller.RateMultiplier(pubkeys[2]) == 1)
+
+	wot := controller.GetStats()["wot"].(map[string]interface{})
+	helpers.AssertIntEqual(t, 1, wot["size"].(int))
+
+	// Deeper, until the graph is full
+	cfg.WoT.Depth = 4
+	cfg.WoT.MaxPubkeys = 2
+	controller = NewController(cfg)
+	helpers.AssertNoError(t, controller.refresh())
+	helpers.AssertIntEqual(t, 3, controller.WoTDistance(pubkeys[2]))
+	helpers.AssertIntEqual(t, -1, controller.WoTDistance(pubkeys[3]))
+	helpers.AssertBoolEqual(t, false, controller.CanWrite(pubkeys[3]))
+}
+
+// paidSet admits the pubkeys in it until their time, for good when it is
+// zero
+type paidSet map[string]time.Time
+
+func (p paidSet) AdmittedUntil(pubkey string) (time.Time, bool) {
+	until, ok := p[pubkey]
+	return until, ok
+}
+
+func TestPaidAccess(t *testing.T) {
+	ownerNpub := "npub1owner"
+	payer := "npub1payer"
+	controller := NewController(config.AccessConfig{AdminNpubs: []string{ownerNpub}})
+	helpers.AssertBoolEqual(t, false, controller.CanWrite(payer))
+
+	paid := paidSet{}
+	controller.SetPaidAccess(paid)
+	helpers.AssertBoolEqual(t, false, controller.CanWrite(payer))
+
+	// Cached decisions are not served after an admission
+	paid[payer] = time.Time{}
+	controller.PaidAccessChanged()
+	helpers.AssertBoolEqual(t, true, controller.CanWrite(payer))
+	helpers.AssertBoolEqual(t, true, controller.IsKnownWriter(payer))
+	helpers.AssertBoolEqual(t, false, controller.CanRead(payer))
+
+	delete(paid, payer)
+	controller.PaidAccessChanged()
+	helpers.AssertBoolEqual(t, false, controller.CanWrite(payer))
+}
+
+func TestPaidAccessExpiry(t *testing.T) {
+	payer := "npub1payer"
+	now := time.Unix(1700000000, 0)
+	controller := NewController(config.AccessConfig{AdminNpubs: []string{"npub1owner"}})
+	controller.now = func() time.Time { return now }
+	paid := paidSet{payer: now.Add(time.Hour)}
+	controller.SetPaidAccess(paid)
+
+	helpers.AssertBoolEqual(t, true, controller.CanWrite(payer))
+	helpers.AssertBoolEqual(t, true, controller.CanWrite(payer))
+	helpers.AssertInt64Equal(t, 1, controller.metrics.cacheHits.Load())
+
+	// Nothing announces an admission running out, so the cached decision
+	// must not outlive it
+	now = now.Add(time.Hour)
+	delete(paid, payer)
+	helpers.AssertBoolEqual(t, false, controller.CanWrite(payer))
+	helpers.AssertInt64Equal(t, 1, controller.metrics.cacheHits.Load())
+}
@@ -0,0 +1,132 @@
+package access
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mercury-relay/internal/config"
+)
+
+// maxCachedDecisions bounds the decision cache; it is cleared when full
+const maxCachedDecisions = 100000
+
+// allowList is an immutable snapshot of the allowed npubs. A new snapshot
+// with a higher version is published on every follow list refresh and
+// writer approval, so readers never take a lock.
+type allowList struct {
+	npubs    map[string]bool
+	approved map[string]bool
+	wot      map[string]int // trust graph depth beyond the follows
+	paid     PaidAccess
+	version  uint64
+}
+
+// policy is an immutable snapshot of the public access settings
+type policy struct {
+	publicRead     bool
+	publicWrite    bool
+	kinds          []int
+	anonymousKinds map[int]bool
+}
+
+func newPolicy(cfg config.AccessConfig) *policy {
+	p := &policy{
+		publicRead:     cfg.AllowPublicRead,
+		publicWrite:    cfg.AllowPublicWrite,
+		kinds:          cfg.AnonymousWriteKinds,
+		anonymousKinds: make(map[int]bool, len(cfg.AnonymousWriteKinds)),
+	}
+	for _, kind := range cfg.AnonymousWriteKinds {
+		p.anonymousKinds[kind] = true
+	}
+	return p
+}
+
+// decision is a cached CanWrite/CanRead result, valid while its version
+// matches the current allow list and, for write access that was paid for,
+// until the admission runs out
+type decision struct {
+	version  uint64
+	expires  time.Time // zero when the decision doesn't expire
+	canWrite bool
+	canRead  bool
+}
+
+// decisionCache memoizes per-pubkey access decisions for hot pubkeys
+type decisionCache struct {
+	entries sync.Map // npub -> decision
+	size    atomic.Int64
+}
+
+func (c *decisionCache) get(npub string, version uint64, now time.Time) (decision, bool) {
+	value, ok := c.entries.Load(npub)
+	if !ok {
+		return decision{}, false
+	}
+	d := value.(decision)
+	return d, d.version == version && (d.expires.IsZero() || now.Before(d.expires))
+}
+
+func (c *decisionCache) put(npub string, d decision) {
+	if _, loaded := c.entries.Swap(npub, d); !loaded {
+		if c.size.Add(1) > maxCachedDecisions {
+			c.clear()
+		}
+	}
+}
+
+func (c *decisionCache) clear() {
+	c.entries.Range(func(key, _ interface{}) bool {
+		c.entries.Delete(key)
+		return true
+	})
+	c.size.Store(0)
+}
+
+// decisionMetrics counts access decisions for allow/deny rate reporting
+type decisionMetrics struct {
+	writeAllowed atomic.Int64
+	writeDenied  atomic.Int64
+	readAllowed  atomic.Int64
+	readDenied   atomic.Int64
+	cacheHits    atomic.Int64
+	cacheMisses  atomic.Int64
+
+	// Writes allowed only because the kind is open to anonymous pubkeys
+	anonymousWrites atomic.Int64
+}
+
+func (m *decisionMetrics) record(allowed *atomic.Int64, denied *atomic.Int64, ok bool) {
+	if ok {
+		allowed.Add(1)
+	} else {
+		denied.Add(1)
+	}
+}
+
+func (m *decisionMetrics) snapshot() map[string]interface{} {
+	writeAllowed, writeDenied := m.writeAllowed.Load(), m.writeDenied.Load()
+	readAllowed, readDenied := m.readAllowed.Load(), m.readDenied.Load()
+	hits, misses := m.cacheHits.Load(), m.cacheMisses.Load()
+
+	return map[string]interface{}{
+		"write_allowed":    writeAllowed,
+		"write_denied":     writeDenied,
+		"write_deny_rate":  rate(writeDenied, writeAllowed+writeDenied),
+		"read_allowed":     readAllowed,
+		"read_denied":      readDenied,
+		"read_deny_rate":   rate(readDenied, readAllowed+readDenied),
+		"cache_hits":       hits,
+		"cache_misses":     misses,
+		"cache_hit_rate":   rate(hits, hits+misses),
+		"anonymous_writes": m.anonymousWrites.Load(),
+	}
+}
+
+func rate(n, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) / float64(total)
+}
@@ -0,0 +1,40 @@
+package access
+
+import "time"
+
+// PaidAccess admits pubkeys that paid for write access
+type PaidAccess interface {
+	// AdmittedUntil reports whether pubkey is admitted and until when, the
+	// zero time meaning for good
+	AdmittedUntil(pubkey string) (time.Time, bool)
+}
+
+// SetPaidAccess lets pubkeys admitted by p write
+func (a *Controller) SetPaidAccess(p PaidAccess) {
+	a.npubMutex.Lock()
+	defer a.npubMutex.Unlock()
+	a.paid = p
+	a.publishAllowList(a.allowedNpubs)
+}
+
+// PaidAccessChanged invalidates cached decisions after pubkeys were
+// admitted or lost their admission
+func (a *Controller) PaidAccessChanged() {
+	a.npubMutex.Lock()
+	defer a.npubMutex.Unlock()
+	a.publishAllowList(a.allowedNpubs)
+}
+
+// paidFor reports whether npub paid for write access
+func (l *allowList) paidFor(npub string) bool {
+	_, ok := l.paidUntil(npub)
+	return ok
+}
+
+// paidUntil reports whether npub paid for write access and when it ends
+func (l *allowList) paidUntil(npub string) (time.Time, bool) {
+	if l.paid == nil {
+		return time.Time{}, false
+	}
+	return l.paid.AdmittedUntil(npub)
+}
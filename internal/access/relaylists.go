@@ -0,0 +1,144 @@
+package access
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"mercury-relay/internal/config"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// authorsPerQuery bounds the authors of one relay list query
+const authorsPerQuery = 500
+
+// authorsPerFilter bounds the authors of one upstream filter, so a REQ stays
+// below the message size relays accept
+const authorsPerFilter = 256
+
+// OnFollowRelays calls fn with the upstream relays derived from follows'
+// relay lists whenever they are reloaded
+func (a *Controller) OnFollowRelays(fn func([]config.UpstreamRelay)) {
+	a.npubMutex.Lock()
+	defer a.npubMutex.Unlock()
+	a.onFollowRelays = fn
+}
+
+// FollowRelays returns the upstream relays followed npubs publish to, each
+// filtered to the follows publishing there
+func (a *Controller) FollowRelays() []config.UpstreamRelay {
+	a.npubMutex.RLock()
+	defer a.npubMutex.RUnlock()
+	return a.followRelays
+}
+
+// loadRelayLists fetches the follows' relay lists and hands the relays they
+// write to over to the OnFollowRelays callback
+func (a *Controller) loadRelayLists() error {
+	// Follow lists name hex pubkeys, anything else can't be subscribed to
+	var follows []string
+	followed := make(map[string]bool)
+	for _, pubkey := range a.GetAllowedNpubs() {
+		if nostr.IsValidPublicKey(pubkey) {
+			follows = append(follows, pubkey)
+			followed[pubkey] = true
+		}
+	}
+	sort.Strings(follows)
+
+	latest := make(map[string]*nostr.Event)
+	for start := 0; start < len(follows); start += authorsPerQuery {
+		end := min(start+authorsPerQuery, len(follows))
+		events, err := a.query(nostr.Filter{
+			Authors: follows[start:end],
+			Kinds:   []int{nostr.KindRelayListMetadata},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to load relay lists: %w", err)
+		}
+		for _, event := range events {
+			// Only relay lists by follows count, whatever the relay answered
+			if event.Kind != nostr.KindRelayListMetadata || !followed[event.PubKey] {
+				continue
+			}
+			if current, ok := latest[event.PubKey]; !ok || event.CreatedAt > current.CreatedAt {
+				latest[event.PubKey] = event
+			}
+		}
+	}
+
+	authors := make(map[string][]string)
+	for _, pubkey := range follows {
+		event, ok := latest[pubkey]
+		if !ok {
+			continue
+		}
+		for _, url := range writeRelays(event) {
+			authors[url] = append(authors[url], pubkey)
+		}
+	}
+	relays := followRelays(authors, a.config.MaxFollowRelays)
+
+	a.npubMutex.Lock()
+	a.followRelays = relays
+	fn := a.onFollowRelays
+	a.npubMutex.Unlock()
+
+	log.Printf("Loaded %d relay lists of follows, following %d upstream relays", len(latest), len(relays))
+	if fn != nil {
+		fn(relays)
+	}
+	return nil
+}
+
+// followRelays turns the follows writing to each relay into upstream
+// relays, those shared by the most follows first, at most limit of them
+// unless limit is negative
+func followRelays(authors map[string][]string, limit int) []config.UpstreamRelay {
+	urls := make([]string, 0, len(authors))
+	for url := range authors {
+		urls = append(urls, url)
+	}
+	sort.Slice(urls, func(i, j int) bool {
+		if len(authors[urls[i]]) != len(authors[urls[j]]) {
+			return len(authors[urls[i]]) > len(authors[urls[j]])
+		}
+		return urls[i] < urls[j]
+	})
+	if limit >= 0 && len(urls) > limit {
+		urls = urls[:limit]
+	}
+
+	relays := make([]config.UpstreamRelay, 0, len(urls))
+	for _, url := range urls {
+		relay := config.UpstreamRelay{URL: url, Enabled: true}
+		pubkeys := authors[url]
+		for start := 0; start < len(pubkeys); start += authorsPerFilter {
+			end := min(start+authorsPerFilter, len(pubkeys))
+			relay.Filters = append(relay.Filters, config.UpstreamFilter{Authors: pubkeys[start:end]})
+		}
+		relays = append(relays, relay)
+	}
+	return relays
+}
+
+// writeRelays returns the relays of a relay list event marked "write" or
+// unmarked
+func writeRelays(event *nostr.Event) []string {
+	var relays []string
+	seen := make(map[string]bool)
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "r" {
+			continue
+		}
+		if len(tag) >= 3 && tag[2] == "read" {
+			continue
+		}
+		if url := nostr.NormalizeURL(tag[1]); url != "" && !seen[url] {
+			seen[url] = true
+			relays = append(relays, url)
+		}
+	}
+	return relays
+}
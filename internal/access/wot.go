@@ -0,0 +1,135 @@
+package access
+
+import (
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// loadTrustGraph walks the follow lists of the owner's follows, and of the
+// pubkeys they follow, up to the configured depth and publishes the
+// distance of every pubkey found beyond the follows
+func (a *Controller) loadTrustGraph() error {
+	wot := a.config.WoT
+	owner, err := hexPubkey(a.ownerNpub)
+	if err != nil {
+		return err
+	}
+
+	known := map[string]bool{owner: true}
+	var frontier []string
+	for _, pubkey := range a.GetAllowedNpubs() {
+		if nostr.IsValidPublicKey(pubkey) && !known[pubkey] {
+			known[pubkey] = true
+			frontier = append(frontier, pubkey)
+		}
+	}
+
+	graph := make(map[string]int)
+	full := false
+	for depth := 2; depth <= wot.Depth && len(frontier) > 0 && !full; depth++ {
+		follows, err := a.fetchFollows(frontier)
+		if err != nil {
+			return fmt.Errorf("failed to load trust graph at depth %d: %w", depth, err)
+		}
+		frontier = nil
+		for _, pubkey := range follows {
+			if known[pubkey] {
+				continue
+			}
+			if wot.MaxPubkeys >= 0 && len(graph) >= wot.MaxPubkeys {
+				full = true
+				break
+			}
+			known[pubkey] = true
+			graph[pubkey] = depth
+			frontier = append(frontier, pubkey)
+		}
+	}
+
+	a.npubMutex.Lock()
+	a.trustGraph = graph
+	a.publishAllowList(a.allowedNpubs)
+	a.npubMutex.Unlock()
+
+	if full {
+		log.Printf("Trust graph reached its limit of %d pubkeys", wot.MaxPubkeys)
+	}
+	log.Printf("Loaded trust graph of %d pubkeys up to depth %d", len(graph), wot.Depth)
+	return nil
+}
+
+// fetchFollows returns the pubkeys followed by authors according to their
+// newest follow lists, sorted so a capped graph is the same every time
+func (a *Controller) fetchFollows(authors []string) ([]string, error) {
+	sort.Strings(authors)
+	wanted := make(map[string]bool, len(authors))
+	for _, author := range authors {
+		wanted[author] = true
+	}
+
+	latest := make(map[string]*nostr.Event)
+	for start := 0; start < len(authors); start += authorsPerQuery {
+		end := min(start+authorsPerQuery, len(authors))
+		events, err := a.query(nostr.Filter{
+			Authors: authors[start:end],
+			Kinds:   []int{nostr.KindFollowList},
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, event := range events {
+			if event.Kind != nostr.KindFollowList || !wanted[event.PubKey] {
+				continue
+			}
+			if current, ok := latest[event.PubKey]; !ok || event.CreatedAt > current.CreatedAt {
+				latest[event.PubKey] = event
+			}
+		}
+	}
+
+	var follows []string
+	seen := make(map[string]bool)
+	for _, author := range authors {
+		event, ok := latest[author]
+		if !ok {
+			continue
+		}
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 && tag[0] == "p" && nostr.IsValidPublicKey(tag[1]) && !seen[tag[1]] {
+				seen[tag[1]] = true
+				follows = append(follows, tag[1])
+			}
+		}
+	}
+	return follows, nil
+}
+
+// RateMultiplier scales the event rate of npub by its distance in the trust
+// graph; 1 unless a multiplier is configured for its depth
+func (a *Controller) RateMultiplier(npub string) float64 {
+	if !a.config.WoT.Enabled {
+		return 1
+	}
+	if multiplier, ok := a.config.WoT.RateMultipliers[a.WoTDistance(npub)]; ok {
+		return multiplier
+	}
+	return 1
+}
+
+// wotStats counts the trust graph's pubkeys per depth. Callers must hold
+// npubMutex.
+func (a *Controller) wotStats() map[string]interface{} {
+	depths := make(map[int]int)
+	for _, depth := range a.trustGraph {
+		depths[depth]++
+	}
+	return map[string]interface{}{
+		"enabled":          a.config.WoT.Enabled,
+		"depth":            a.config.WoT.Depth,
+		"size":             len(a.trustGraph),
+		"pubkeys_by_depth": depths,
+	}
+}
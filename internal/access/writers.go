@@ -0,0 +1,295 @@
+package access
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// WriterStatus is where an unknown pubkey stands in the approval workflow
+type WriterStatus string
+
+const (
+	WriterUnknown  WriterStatus = ""
+	WriterPending  WriterStatus = "pending"
+	WriterApproved WriterStatus = "approved"
+	WriterDenied   WriterStatus = "denied"
+)
+
+var (
+	ErrWriterApprovalDisabled = fmt.Errorf("writer approval is disabled")
+	ErrPendingWritersFull     = fmt.Errorf("pending writer queue is full")
+)
+
+// PendingWriter is a pubkey that tried to publish without write access,
+// with the first event it sent so admins can judge the request
+type PendingWriter struct {
+	Pubkey    string       `json:"pubkey"`
+	FirstSeen time.Time    `json:"first_seen"`
+	LastSeen  time.Time    `json:"last_seen"`
+	Attempts  int          `json:"attempts"`
+	Sample    *nostr.Event `json:"sample,omitempty"`
+}
+
+// WriterDecision records an admin approving or denying a pubkey. Notified is
+// set once the writer has been told about an approval.
+type WriterDecision struct {
+	Pubkey    string       `json:"pubkey"`
+	Status    WriterStatus `json:"status"`
+	DecidedAt time.Time    `json:"decided_at"`
+	DecidedBy string       `json:"decided_by,omitempty"`
+	Notified  bool         `json:"notified,omitempty"`
+}
+
+// writerQueue holds pending writers and admin decisions, saved to path after
+// every change
+type writerQueue struct {
+	path       string
+	maxPending int
+	pending    map[string]*PendingWriter
+	decisions  map[string]*WriterDecision
+	mu         sync.Mutex
+}
+
+type writerState struct {
+	Pending   []*PendingWriter  `json:"pending"`
+	Decisions []*WriterDecision `json:"decisions"`
+}
+
+func newWriterQueue(path string, maxPending int) *writerQueue {
+	q := &writerQueue{
+		path:       path,
+		maxPending: maxPending,
+		pending:    make(map[string]*PendingWriter),
+		decisions:  make(map[string]*WriterDecision),
+	}
+	if err := q.load(); err != nil {
+		log.Printf("Failed to load writer approvals: %v", err)
+	}
+	return q
+}
+
+// approved returns the set of approved pubkeys
+func (q *writerQueue) approved() map[string]bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	approved := make(map[string]bool)
+	for pubkey, d := range q.decisions {
+		if d.Status == WriterApproved {
+			approved[pubkey] = true
+		}
+	}
+	return approved
+}
+
+// request records a write attempt from a pubkey without access
+func (q *writerQueue) request(event *nostr.Event, now time.Time) (WriterStatus, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if d, ok := q.decisions[event.PubKey]; ok {
+		return d.Status, nil
+	}
+
+	p, ok := q.pending[event.PubKey]
+	if !ok {
+		if q.maxPending > 0 && len(q.pending) >= q.maxPending {
+			return WriterUnknown, ErrPendingWritersFull
+		}
+		sample := *event
+		p = &PendingWriter{Pubkey: event.PubKey, FirstSeen: now, Sample: &sample}
+		q.pending[event.PubKey] = p
+	}
+	p.LastSeen = now
+	p.Attempts++
+
+	return WriterPending, q.saveLocked()
+}
+
+// decide approves or denies pubkey and drops it from the pending queue
+func (q *writerQueue) decide(pubkey string, status WriterStatus, admin string, now time.Time) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	delete(q.pending, pubkey)
+	q.decisions[pubkey] = &WriterDecision{
+		Pubkey:    pubkey,
+		Status:    status,
+		DecidedAt: now,
+		DecidedBy: admin,
+	}
+	return q.saveLocked()
+}
+
+// takeNotice reports whether pubkey was approved and not yet told so, and
+// marks it as told
+func (q *writerQueue) takeNotice(pubkey string) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	d, ok := q.decisions[pubkey]
+	if !ok || d.Status != WriterApproved || d.Notified {
+		return false
+	}
+	d.Notified = true
+	if err := q.saveLocked(); err != nil {
+		log.Printf("Failed to save writer approvals: %v", err)
+	}
+	return true
+}
+
+func (q *writerQueue) list() []PendingWriter {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	writers := make([]PendingWriter, 0, len(q.pending))
+	for _, p := range q.pending {
+		writers = append(writers, *p)
+	}
+	sort.Slice(writers, func(i, j int) bool { return writers[i].FirstSeen.Before(writers[j].FirstSeen) })
+	return writers
+}
+
+func (q *writerQueue) counts() (pending, approved, denied int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for _, d := range q.decisions {
+		if d.Status == WriterApproved {
+			approved++
+		} else {
+			denied++
+		}
+	}
+	return len(q.pending), approved, denied
+}
+
+func (q *writerQueue) load() error {
+	if q.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(q.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", q.path, err)
+	}
+
+	var state writerState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", q.path, err)
+	}
+	for _, p := range state.Pending {
+		q.pending[p.Pubkey] = p
+	}
+	for _, d := range state.Decisions {
+		q.decisions[d.Pubkey] = d
+	}
+	return nil
+}
+
+// saveLocked atomically writes the queue to path. Callers must hold q.mu.
+func (q *writerQueue) saveLocked() error {
+	if q.path == "" {
+		return nil
+	}
+
+	state := writerState{}
+	for _, p := range q.pending {
+		state.Pending = append(state.Pending, p)
+	}
+	for _, d := range q.decisions {
+		state.Decisions = append(state.Decisions, d)
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode writer approvals: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(q.path), 0755); err != nil {
+		return fmt.Errorf("failed to write writer approvals: %w", err)
+	}
+	tmp := q.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write writer approvals: %w", err)
+	}
+	if err := os.Rename(tmp, q.path); err != nil {
+		return fmt.Errorf("failed to write writer approvals: %w", err)
+	}
+	return nil
+}
+
+// RequestWrite queues the author of an event that was denied write access
+// for admin review and returns where the request stands
+func (a *Controller) RequestWrite(event *nostr.Event) (WriterStatus, error) {
+	if !a.config.WriterApproval {
+		return WriterUnknown, ErrWriterApprovalDisabled
+	}
+	return a.writers.request(event, time.Now())
+}
+
+// PendingWriters lists the queued write requests, oldest first
+func (a *Controller) PendingWriters() []PendingWriter {
+	return a.writers.list()
+}
+
+// ApproveWriter grants pubkey write access. Approvals survive follow list
+// refreshes and restarts.
+func (a *Controller) ApproveWriter(pubkey, admin string) error {
+	return a.decideWriter(pubkey, WriterApproved, admin)
+}
+
+// DenyWriter rejects pubkey's request, or revokes an earlier approval
+func (a *Controller) DenyWriter(pubkey, admin string) error {
+	return a.decideWriter(pubkey, WriterDenied, admin)
+}
+
+func (a *Controller) decideWriter(pubkey string, status WriterStatus, admin string) error {
+	if !nostr.IsValid32ByteHex(pubkey) {
+		return fmt.Errorf("invalid pubkey %q", pubkey)
+	}
+	if err := a.writers.decide(pubkey, status, admin, time.Now()); err != nil {
+		return err
+	}
+
+	a.npubMutex.Lock()
+	a.publishAllowList(a.allowedNpubs)
+	a.npubMutex.Unlock()
+
+	log.Printf("Writer %s %s by %s", pubkey, status, admin)
+	return nil
+}
+
+// ApprovedWriters lists the pubkeys an admin approved as writers
+func (a *Controller) ApprovedWriters() []string {
+	var pubkeys []string
+	for pubkey := range a.writers.approved() {
+		pubkeys = append(pubkeys, pubkey)
+	}
+	sort.Strings(pubkeys)
+	return pubkeys
+}
+
+// TakeApprovalNotice reports, once, that pubkey's write request was approved
+func (a *Controller) TakeApprovalNotice(pubkey string) bool {
+	return a.writers.takeNotice(pubkey)
+}
+
+func (a *Controller) writerStats() map[string]interface{} {
+	pending, approved, denied := a.writers.counts()
+	return map[string]interface{}{
+		"enabled":  a.config.WriterApproval,
+		"pending":  pending,
+		"approved": approved,
+		"denied":   denied,
+	}
+}
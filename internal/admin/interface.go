@@ -3,6 +3,7 @@ package admin
 import (
 	"bufio"
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
@@ -11,13 +12,13 @@ import (
 	"log"
 	"net/http"
 	"os"
-	"strconv"
 	"strings"
 	"time"
 
 	"mercury-relay/internal/config"
 	"mercury-relay/internal/models"
 	"mercury-relay/internal/quality"
+	"mercury-relay/internal/query"
 
 	"github.com/nbd-wtf/go-nostr"
 )
@@ -28,6 +29,7 @@ type Interface struct {
 	kindConfigLoader *quality.KindConfigLoader
 	authenticated    bool
 	userPubkey       string
+	signer           Signer
 }
 
 func NewInterface(config *config.Config) *Interface {
@@ -50,24 +52,35 @@ func NewInterface(config *config.Config) *Interface {
 	}
 }
 
+// BlockNpub blocks an npub or hex pubkey on the running relay
 func (a *Interface) BlockNpub(npub string) error {
-	// This would need to be connected to the quality controller
-	// For now, just log the action
-	log.Printf("Blocking npub: %s", npub)
-	return nil
+	return a.moderate("/api/v1/admin/block", npub)
 }
 
+// UnblockNpub lifts every block on an npub or hex pubkey
 func (a *Interface) UnblockNpub(npub string) error {
-	// This would need to be connected to the quality controller
-	// For now, just log the action
-	log.Printf("Unblocking npub: %s", npub)
-	return nil
+	return a.moderate("/api/v1/admin/unblock", npub)
 }
 
+// ListBlockedNpubs returns the pubkeys the running relay blocks
 func (a *Interface) ListBlockedNpubs() ([]string, error) {
-	// This would need to be connected to the quality controller
-	// For now, return empty list
-	return []string{}, nil
+	var data struct {
+		Blocked []struct {
+			Pubkey string `json:"pubkey"`
+		} `json:"blocked"`
+	}
+	if err := a.adminCall("GET", "/api/v1/admin/blocked", nil, &data); err != nil {
+		return nil, err
+	}
+	blocked := make([]string, len(data.Blocked))
+	for i, b := range data.Blocked {
+		blocked[i] = b.Pubkey
+	}
+	return blocked, nil
+}
+
+func (a *Interface) moderate(path, npub string) error {
+	return a.adminCall("POST", path, map[string]string{"npub": npub, "reason": "admin TUI"}, nil)
 }
 
 func (a *Interface) StartTUI() error {
@@ -97,8 +110,10 @@ func (a *Interface) StartTUI() error {
 		fmt.Print("4. Show stats\n")
 		fmt.Print("5. Query relay\n")
 		fmt.Print("6. Publish note\n")
-		fmt.Print("7. Exit\n")
-		fmt.Print("Choose an option (1-7): ")
+		fmt.Print("7. Remote signer (NIP-46)\n")
+		fmt.Print("8. Pending writers\n")
+		fmt.Print("9. Exit\n")
+		fmt.Print("Choose an option (1-9): ")
 
 		if !scanner.Scan() {
 			break
@@ -120,10 +135,14 @@ func (a *Interface) StartTUI() error {
 		case "6":
 			a.handlePublishNote(scanner)
 		case "7":
+			a.handleRemoteSigner(scanner)
+		case "8":
+			a.handlePendingWriters(scanner)
+		case "9":
 			fmt.Println("Goodbye!")
 			return nil
 		default:
-			fmt.Println("Invalid option. Please choose 1-7.")
+			fmt.Println("Invalid option. Please choose 1-9.")
 		}
 	}
 
@@ -199,6 +218,86 @@ func (a *Interface) handleShowStats() {
 	}
 }
 
+// handleRemoteSigner shows the NIP-46 signer status and lets the operator
+// connect, reconnect or forget a bunker session
+func (a *Interface) handleRemoteSigner(scanner *bufio.Scanner) {
+	fmt.Println("\n=== Remote Signer (NIP-46) ===")
+	if a.signer != nil {
+		fmt.Printf("Signing with: %s\n", a.signer.Description())
+	} else {
+		fmt.Println("Signing with: local key (NSEC)")
+	}
+	fmt.Println("1. Connect to bunker")
+	fmt.Println("2. Disconnect and forget saved session")
+	fmt.Println("3. Back")
+	fmt.Print("Choose (1-3): ")
+
+	if !scanner.Scan() {
+		return
+	}
+
+	switch strings.TrimSpace(scanner.Text()) {
+	case "1":
+		a.connectRemoteSigner(scanner)
+	case "2":
+		a.signer = nil
+		if err := forgetBunkerSession(); err != nil {
+			fmt.Printf("❌ Failed to remove saved session: %v\n", err)
+			return
+		}
+		fmt.Println("✅ Remote signer disconnected. Events will be signed with the NSEC key.")
+	}
+}
+
+// connectRemoteSigner resumes a saved bunker session or connects to a new
+// bunker URI, taken from BUNKER_URL or prompted for
+func (a *Interface) connectRemoteSigner(scanner *bufio.Scanner) bool {
+	onAuth := func(authURL string) {
+		fmt.Printf("🔑 The remote signer requires approval, open: %s\n", authURL)
+	}
+
+	if session, err := loadBunkerSession(); err == nil {
+		fmt.Printf("Found saved session for %s (connected %s)\n", session.UserPubkey, session.ConnectedAt.Format(time.RFC3339))
+		fmt.Print("Reuse it? (y/n): ")
+		if !scanner.Scan() {
+			return false
+		}
+		if strings.ToLower(strings.TrimSpace(scanner.Text())) == "y" {
+			signer, err := resumeBunker(context.Background(), *session, onAuth)
+			if err == nil {
+				a.signer = signer
+				fmt.Printf("✅ Reconnected to %s\n", signer.Description())
+				return true
+			}
+			fmt.Printf("⚠️  Could not resume session: %v\n", err)
+		}
+	}
+
+	bunkerURI := os.Getenv("BUNKER_URL")
+	if bunkerURI == "" {
+		fmt.Print("Enter bunker URI (bunker://<pubkey>?relay=...&secret=...): ")
+		if !scanner.Scan() {
+			return false
+		}
+		bunkerURI = strings.TrimSpace(scanner.Text())
+	}
+	if bunkerURI == "" {
+		fmt.Println("❌ No bunker URI given.")
+		return false
+	}
+
+	fmt.Printf("⏳ Connecting to remote signer (timeout %s)...\n", bunkerConnectTimeout)
+	signer, err := connectBunker(context.Background(), bunkerURI, onAuth)
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return false
+	}
+
+	a.signer = signer
+	fmt.Printf("✅ Connected to %s as %s\n", signer.Description(), signer.pubkey)
+	return true
+}
+
 // authenticate handles user authentication
 func (a *Interface) authenticate() bool {
 	scanner := bufio.NewScanner(os.Stdin)
@@ -207,7 +306,8 @@ func (a *Interface) authenticate() bool {
 	fmt.Println("Choose authentication method:")
 	fmt.Println("1. API Key")
 	fmt.Println("2. Nostr Authentication")
-	fmt.Print("Choose (1-2): ")
+	fmt.Println("3. Remote Signer (NIP-46 bunker)")
+	fmt.Print("Choose (1-3): ")
 
 	if !scanner.Scan() {
 		return false
@@ -220,6 +320,8 @@ func (a *Interface) authenticate() bool {
 		return a.authenticateWithAPIKey(scanner)
 	case "2":
 		return a.authenticateWithNostr(scanner)
+	case "3":
+		return a.authenticateWithBunker(scanner)
 	default:
 		fmt.Println("Invalid choice.")
 		return false
@@ -281,20 +383,36 @@ func (a *Interface) authenticateWithNostr(scanner *bufio.Scanner) bool {
 		return false
 	}
 
-	// Use NSEC from environment to automatically authenticate
-	privKey := a.getPrivateKeyFromEnv()
-	if privKey == "" {
-		fmt.Println("❌ No private key available.")
+	// Use the remote signer if connected, otherwise NSEC from environment
+	pubkey, err := a.currentSigner().PublicKey(context.Background())
+	if err != nil {
+		fmt.Printf("❌ Failed to get public key: %v\n", err)
+		return false
+	}
+
+	return a.completeNostrAuth(pubkey)
+}
+
+// authenticateWithBunker connects to a NIP-46 remote signer and authenticates
+// with the key it holds
+func (a *Interface) authenticateWithBunker(scanner *bufio.Scanner) bool {
+	fmt.Println("\n=== Remote Signer Authentication ===")
+	if !a.connectRemoteSigner(scanner) {
 		return false
 	}
 
-	// Get public key from private key
-	pubkey, err := nostr.GetPublicKey(privKey)
+	pubkey, err := a.signer.PublicKey(context.Background())
 	if err != nil {
 		fmt.Printf("❌ Failed to get public key: %v\n", err)
 		return false
 	}
 
+	return a.completeNostrAuth(pubkey)
+}
+
+// completeNostrAuth checks pubkey against the admin list and proves
+// ownership to the relay with NIP-42
+func (a *Interface) completeNostrAuth(pubkey string) bool {
 	// Check if pubkey is authorized
 	if len(a.config.Access.AdminNpubs) > 0 {
 		authorized := false
@@ -332,176 +450,50 @@ func (a *Interface) generateChallenge() (string, error) {
 	return hex.EncodeToString(bytes), nil
 }
 
-// handleQueryRelay handles relay querying functionality
+// handleQueryRelay prompts for a filter expression and prints matching events
 func (a *Interface) handleQueryRelay(scanner *bufio.Scanner) {
-	fmt.Println("\n=== Relay Query Interface ===")
-	fmt.Println("1. Query events by author")
-	fmt.Println("2. Query events by kind")
-	fmt.Println("3. Query events by tag")
-	fmt.Println("4. Query recent events")
-	fmt.Println("5. Get relay info")
-	fmt.Println("6. Back to main menu")
-	fmt.Print("Choose an option (1-6): ")
-
-	if !scanner.Scan() {
-		return
-	}
-
-	choice := strings.TrimSpace(scanner.Text())
-
-	switch choice {
-	case "1":
-		a.queryEventsByAuthor(scanner)
-	case "2":
-		a.queryEventsByKind(scanner)
-	case "3":
-		a.queryEventsByTag(scanner)
-	case "4":
-		a.queryRecentEvents(scanner)
-	case "5":
-		a.getRelayInfo()
-	case "6":
-		return
-	default:
-		fmt.Println("Invalid option.")
-	}
-}
-
-// queryEventsByAuthor queries events by author pubkey
-func (a *Interface) queryEventsByAuthor(scanner *bufio.Scanner) {
-	fmt.Print("Enter author pubkey (npub or hex): ")
-	if !scanner.Scan() {
-		return
-	}
-	author := strings.TrimSpace(scanner.Text())
-	if author == "" {
-		fmt.Println("Empty author provided.")
-		return
-	}
+	fmt.Println("\n=== Relay Query ===")
+	fmt.Println("Enter a filter, e.g. kind=1 author=npub1... since=2h limit=20 #t=bitcoin")
+	fmt.Println("Type 'info' for relay information or leave empty to go back.")
+	fmt.Print("query> ")
 
-	fmt.Print("Enter limit (default 10): ")
 	if !scanner.Scan() {
 		return
 	}
-	limitStr := strings.TrimSpace(scanner.Text())
-	limit := 10
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil {
-			limit = l
-		}
-	}
-
-	// Create Nostr filter
-	filter := nostr.Filter{
-		Authors: []string{author},
-		Limit:   limit,
-	}
-
-	a.executeQuery("Events by author", filter)
-}
 
-// queryEventsByKind queries events by kind
-func (a *Interface) queryEventsByKind(scanner *bufio.Scanner) {
-	fmt.Print("Enter kind number: ")
-	if !scanner.Scan() {
+	expr := strings.TrimSpace(scanner.Text())
+	switch expr {
+	case "":
 		return
-	}
-	kindStr := strings.TrimSpace(scanner.Text())
-	if kindStr == "" {
-		fmt.Println("Empty kind provided.")
+	case "info":
+		a.getRelayInfo()
 		return
 	}
 
-	kind, err := strconv.Atoi(kindStr)
+	filter, err := query.ParseFilter(expr)
 	if err != nil {
-		fmt.Printf("Invalid kind: %v\n", err)
-		return
-	}
-
-	fmt.Print("Enter limit (default 10): ")
-	if !scanner.Scan() {
-		return
-	}
-	limitStr := strings.TrimSpace(scanner.Text())
-	limit := 10
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil {
-			limit = l
-		}
-	}
-
-	// Create Nostr filter
-	filter := nostr.Filter{
-		Kinds: []int{kind},
-		Limit: limit,
-	}
-
-	a.executeQuery("Events by kind", filter)
-}
-
-// queryEventsByTag queries events by tag
-func (a *Interface) queryEventsByTag(scanner *bufio.Scanner) {
-	fmt.Print("Enter tag name (e.g., 'p', 'e', 't'): ")
-	if !scanner.Scan() {
-		return
-	}
-	tagName := strings.TrimSpace(scanner.Text())
-	if tagName == "" {
-		fmt.Println("Empty tag name provided.")
-		return
-	}
-
-	fmt.Print("Enter tag value: ")
-	if !scanner.Scan() {
+		fmt.Printf("❌ %v\n", err)
 		return
 	}
-	tagValue := strings.TrimSpace(scanner.Text())
-	if tagValue == "" {
-		fmt.Println("Empty tag value provided.")
-		return
-	}
-
-	fmt.Print("Enter limit (default 10): ")
-	if !scanner.Scan() {
-		return
-	}
-	limitStr := strings.TrimSpace(scanner.Text())
-	limit := 10
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil {
-			limit = l
-		}
+	if filter.Limit == 0 {
+		filter.Limit = 20
 	}
 
-	// Create Nostr filter
-	filter := nostr.Filter{
-		Tags:  map[string][]string{tagName: {tagValue}},
-		Limit: limit,
-	}
+	relayURL := fmt.Sprintf("http://%s:%d", a.config.Server.Host, a.config.Server.Port+2) // REST API is on port+2
+	source := query.NewRESTSource(relayURL, a.userPubkey)
 
-	a.executeQuery("Events by tag", filter)
-}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
 
-// queryRecentEvents queries recent events
-func (a *Interface) queryRecentEvents(scanner *bufio.Scanner) {
-	fmt.Print("Enter limit (default 20): ")
-	if !scanner.Scan() {
+	events, err := source.Query(ctx, filter)
+	if err != nil {
+		fmt.Printf("❌ Failed to query relay: %v\n", err)
 		return
 	}
-	limitStr := strings.TrimSpace(scanner.Text())
-	limit := 20
-	if limitStr != "" {
-		if l, err := strconv.Atoi(limitStr); err == nil {
-			limit = l
-		}
-	}
 
-	// Create Nostr filter for recent events
-	filter := nostr.Filter{
-		Limit: limit,
+	if err := query.WriteEvents(os.Stdout, events, query.FormatTable); err != nil {
+		fmt.Printf("❌ Failed to print events: %v\n", err)
 	}
-
-	a.executeQuery("Recent events", filter)
 }
 
 // getRelayInfo gets relay information
@@ -547,88 +539,6 @@ func (a *Interface) getRelayInfo() {
 	fmt.Printf("SSH enabled: %v\n", a.config.SSH.Enabled)
 }
 
-// executeQuery executes a Nostr query against the relay
-func (a *Interface) executeQuery(queryType string, filter nostr.Filter) {
-	fmt.Printf("\n=== %s ===\n", queryType)
-
-	relayURL := fmt.Sprintf("http://%s:%d", a.config.Server.Host, a.config.Server.Port+2) // REST API is on port+2
-
-	// Create Nostr REQ message
-	req := []interface{}{
-		"REQ",
-		"admin-query",
-		filter,
-	}
-
-	// Convert to JSON
-	jsonData, err := json.Marshal(req)
-	if err != nil {
-		fmt.Printf("❌ Failed to create query: %v\n", err)
-		return
-	}
-
-	// Send request to relay
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Post(relayURL+"/", "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		fmt.Printf("❌ Failed to query relay: %v\n", err)
-		return
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		fmt.Printf("❌ Relay returned status: %d\n", resp.StatusCode)
-		return
-	}
-
-	// Read response
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		fmt.Printf("❌ Failed to read response: %v\n", err)
-		return
-	}
-
-	// Parse response
-	var response []interface{}
-	if err := json.Unmarshal(body, &response); err != nil {
-		fmt.Printf("❌ Failed to parse response: %v\n", err)
-		return
-	}
-
-	// Display results
-	if len(response) == 0 {
-		fmt.Println("No events found.")
-		return
-	}
-
-	fmt.Printf("Found %d events:\n", len(response))
-	for i, event := range response {
-		if eventMap, ok := event.(map[string]interface{}); ok {
-			fmt.Printf("\n--- Event %d ---\n", i+1)
-			if id, ok := eventMap["id"].(string); ok {
-				fmt.Printf("ID: %s\n", id)
-			}
-			if pubkey, ok := eventMap["pubkey"].(string); ok {
-				fmt.Printf("Author: %s\n", pubkey)
-			}
-			if kind, ok := eventMap["kind"].(float64); ok {
-				fmt.Printf("Kind: %.0f\n", kind)
-			}
-			if content, ok := eventMap["content"].(string); ok {
-				contentPreview := content
-				if len(contentPreview) > 100 {
-					contentPreview = contentPreview[:100] + "..."
-				}
-				fmt.Printf("Content: %s\n", contentPreview)
-			}
-			if createdAt, ok := eventMap["created_at"].(float64); ok {
-				timestamp := time.Unix(int64(createdAt), 0)
-				fmt.Printf("Created: %s\n", timestamp.Format("2006-01-02 15:04:05"))
-			}
-		}
-	}
-}
-
 // handlePublishNote handles note publishing functionality
 func (a *Interface) handlePublishNote(scanner *bufio.Scanner) {
 	fmt.Println("\n=== Publish Note ===")
@@ -696,7 +606,11 @@ func (a *Interface) publishTextNote(scanner *bufio.Scanner) {
 	tags := a.collectTags(scanner, 1)
 
 	// Create and publish event
-	event := a.createEvent(1, content, tags)
+	event, err := a.createEvent(1, content, tags)
+	if err != nil {
+		fmt.Printf("❌ Failed to sign event: %v\n", err)
+		return
+	}
 	a.publishEvent(event)
 }
 
@@ -748,7 +662,11 @@ func (a *Interface) publishLongFormContent(scanner *bufio.Scanner) {
 	tags = append(tags, []string{"title", title})
 
 	// Create and publish event
-	event := a.createEvent(30023, content, tags)
+	event, err := a.createEvent(30023, content, tags)
+	if err != nil {
+		fmt.Printf("❌ Failed to sign event: %v\n", err)
+		return
+	}
 	a.publishEvent(event)
 }
 
@@ -817,7 +735,11 @@ func (a *Interface) publishPublicationContent(scanner *bufio.Scanner) {
 	tags = append(tags, []string{"d", dTag})
 
 	// Create and publish event
-	event := a.createEvent(30041, content, tags)
+	event, err := a.createEvent(30041, content, tags)
+	if err != nil {
+		fmt.Printf("❌ Failed to sign event: %v\n", err)
+		return
+	}
 	a.publishEvent(event)
 }
 
@@ -872,7 +794,11 @@ func (a *Interface) publishDiscussionThread(scanner *bufio.Scanner) {
 	}
 
 	// Create and publish event
-	event := a.createEvent(11, content, tags)
+	event, err := a.createEvent(11, content, tags)
+	if err != nil {
+		fmt.Printf("❌ Failed to sign event: %v\n", err)
+		return
+	}
 	a.publishEvent(event)
 }
 
@@ -919,11 +845,8 @@ func (a *Interface) collectTags(scanner *bufio.Scanner, kind int) nostr.Tags {
 	return tags
 }
 
-// createEvent creates a Nostr event
-func (a *Interface) createEvent(kind int, content string, tags nostr.Tags) *nostr.Event {
-	// Get private key from environment variable
-	privKey := a.getPrivateKeyFromEnv()
-
+// createEvent creates a Nostr event signed by the current signer
+func (a *Interface) createEvent(kind int, content string, tags nostr.Tags) (*nostr.Event, error) {
 	event := &nostr.Event{
 		Kind:      kind,
 		Content:   content,
@@ -931,10 +854,30 @@ func (a *Interface) createEvent(kind int, content string, tags nostr.Tags) *nost
 		CreatedAt: nostr.Timestamp(time.Now().Unix()),
 	}
 
-	// Sign the event
-	event.Sign(privKey)
+	if err := a.signEvent(event); err != nil {
+		return nil, err
+	}
 
-	return event
+	return event, nil
+}
+
+// signEvent signs event with the remote signer if one is connected, or with
+// the NSEC environment key
+func (a *Interface) signEvent(event *nostr.Event) error {
+	signer := a.currentSigner()
+	if _, remote := signer.(*bunkerSigner); remote {
+		fmt.Printf("⏳ Waiting for %s to approve kind %d (timeout %s)...\n", signer.Description(), event.Kind, bunkerSignTimeout)
+	}
+	return signer.Sign(context.Background(), event)
+}
+
+// currentSigner returns the connected remote signer or a local signer
+// using the NSEC environment key
+func (a *Interface) currentSigner() Signer {
+	if a.signer != nil {
+		return a.signer
+	}
+	return &localSigner{privKey: a.getPrivateKeyFromEnv()}
 }
 
 // publishEvent publishes an event to the relay
@@ -997,10 +940,12 @@ func (a *Interface) publishEvent(event *nostr.Event) {
 	if resp.StatusCode == http.StatusOK {
 		fmt.Println("✅ Event published successfully!")
 
-		// Display the nevent for easy client access
-		nevent := a.generateNevent(event)
-		fmt.Printf("\n🔗 Event Identifier (nevent): %s\n", nevent)
-		fmt.Println("📱 You can use this nevent to find the event in your Nostr client")
+		// Display the nevent, or naddr for replaceable kinds, for easy
+		// client access
+		if identifier, err := a.eventIdentifier(modelsEvent); err == nil {
+			fmt.Printf("\n🔗 Event Identifier: %s\n", identifier)
+			fmt.Println("📱 You can use this identifier to find the event in your Nostr client")
+		}
 	} else {
 		fmt.Printf("❌ Relay returned status: %d\n", resp.StatusCode)
 		// Try to read error message
@@ -1108,8 +1053,6 @@ func (a *Interface) getNostrChallenge(relayURL string) (string, error) {
 
 // createAuthEvent creates a NIP-42 authentication event
 func (a *Interface) createAuthEvent(challenge, relayURL string) *nostr.Event {
-	privKey := a.getPrivateKeyFromEnv()
-
 	// Create kind 22242 authentication event
 	event := &nostr.Event{
 		Kind:    22242,
@@ -1122,7 +1065,10 @@ func (a *Interface) createAuthEvent(challenge, relayURL string) *nostr.Event {
 	}
 
 	// Sign the event
-	event.Sign(privKey)
+	if err := a.signEvent(event); err != nil {
+		fmt.Printf("❌ Failed to sign auth event: %v\n", err)
+		return nil
+	}
 
 	return event
 }
@@ -1164,13 +1110,11 @@ func (a *Interface) publishAuthEvent(relayURL string, authEvent *nostr.Event) bo
 	return resp.StatusCode == http.StatusOK
 }
 
-// generateNevent creates a nevent identifier for the published event
-func (a *Interface) generateNevent(event *nostr.Event) string {
-	// nevent format: nevent1<event_id><relay_url><author_pubkey>
-	// For now, we'll create a simple nevent with just the event ID
-	// In a full implementation, you'd use bech32 encoding
+// eventIdentifier returns the NIP-19 nevent or naddr of a published event
+// with this relay as the hint
+func (a *Interface) eventIdentifier(event *models.Event) (string, error) {
 	relayURL := fmt.Sprintf("ws://%s:%d", a.config.Server.Host, a.config.Server.Port)
-	return fmt.Sprintf("nevent1%s@%s", event.ID, relayURL)
+	return event.Identifier([]string{relayURL})
 }
 
 // generatePrivateKey generates a random private key for testing
@@ -0,0 +1,209 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip46"
+)
+
+const (
+	// bunkerConnectTimeout bounds the initial connect and ping round trips
+	bunkerConnectTimeout = 30 * time.Second
+	// bunkerSignTimeout leaves time to approve the request in the signer app
+	bunkerSignTimeout = 90 * time.Second
+)
+
+// Signer signs events created in the TUI
+type Signer interface {
+	PublicKey(ctx context.Context) (string, error)
+	Sign(ctx context.Context, event *nostr.Event) error
+	Description() string
+}
+
+// localSigner signs with a private key held in memory
+type localSigner struct {
+	privKey string
+}
+
+func (s *localSigner) PublicKey(ctx context.Context) (string, error) {
+	return nostr.GetPublicKey(s.privKey)
+}
+
+func (s *localSigner) Sign(ctx context.Context, event *nostr.Event) error {
+	return event.Sign(s.privKey)
+}
+
+func (s *localSigner) Description() string {
+	return "local key (NSEC)"
+}
+
+// bunkerSigner forwards signing requests to a NIP-46 remote signer
+type bunkerSigner struct {
+	client *nip46.BunkerClient
+	pubkey string
+	target string
+}
+
+func (s *bunkerSigner) PublicKey(ctx context.Context) (string, error) {
+	return s.pubkey, nil
+}
+
+func (s *bunkerSigner) Sign(ctx context.Context, event *nostr.Event) error {
+	ctx, cancel := context.WithTimeout(ctx, bunkerSignTimeout)
+	defer cancel()
+
+	if err := s.client.SignEvent(ctx, event); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("remote signer did not respond within %s", bunkerSignTimeout)
+		}
+		return fmt.Errorf("remote signer refused to sign: %w", err)
+	}
+	if event.PubKey != s.pubkey {
+		return fmt.Errorf("remote signer used pubkey %s, expected %s", event.PubKey, s.pubkey)
+	}
+	return nil
+}
+
+func (s *bunkerSigner) Description() string {
+	return fmt.Sprintf("NIP-46 remote signer %s", s.target)
+}
+
+// bunkerSession is persisted so the TUI can reconnect to the same signer
+// without a new bunker:// secret
+type bunkerSession struct {
+	ClientSecret string    `json:"client_secret"`
+	Target       string    `json:"target"`
+	Relays       []string  `json:"relays"`
+	UserPubkey   string    `json:"user_pubkey"`
+	ConnectedAt  time.Time `json:"connected_at"`
+}
+
+// bunkerSessionPath returns MERCURY_NIP46_SESSION or a file in the user's
+// config directory
+func bunkerSessionPath() (string, error) {
+	if path := os.Getenv("MERCURY_NIP46_SESSION"); path != "" {
+		return path, nil
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate config directory: %w", err)
+	}
+	return filepath.Join(dir, "mercury-relay", "nip46-session.json"), nil
+}
+
+// connectBunker performs the NIP-46 connect handshake with a bunker:// URI
+// (or NIP-05 address) and saves the session for later reuse
+func connectBunker(ctx context.Context, bunkerURI string, onAuth func(string)) (*bunkerSigner, error) {
+	clientSecret := nostr.GeneratePrivateKey()
+
+	ctx, cancel := context.WithTimeout(ctx, bunkerConnectTimeout)
+	defer cancel()
+
+	client, err := nip46.ConnectBunker(ctx, clientSecret, bunkerURI, nil, onAuth)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to remote signer: %w", err)
+	}
+
+	pubkey, err := client.GetPublicKey(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get public key from remote signer: %w", err)
+	}
+
+	session := bunkerSession{
+		ClientSecret: clientSecret,
+		Target:       targetFromBunkerURI(bunkerURI),
+		Relays:       relaysFromBunkerURI(bunkerURI),
+		UserPubkey:   pubkey,
+		ConnectedAt:  time.Now(),
+	}
+	if err := saveBunkerSession(session); err != nil {
+		fmt.Printf("⚠️  Remote signer session not saved: %v\n", err)
+	}
+
+	return &bunkerSigner{client: client, pubkey: pubkey, target: session.Target}, nil
+}
+
+// resumeBunker reconnects using a saved session and pings the signer
+func resumeBunker(ctx context.Context, session bunkerSession, onAuth func(string)) (*bunkerSigner, error) {
+	if session.Target == "" || len(session.Relays) == 0 {
+		return nil, fmt.Errorf("saved session has no signer relays")
+	}
+
+	client := nip46.NewBunker(context.Background(), session.ClientSecret, session.Target, session.Relays, nil, onAuth)
+
+	ctx, cancel := context.WithTimeout(ctx, bunkerConnectTimeout)
+	defer cancel()
+
+	if err := client.Ping(ctx); err != nil {
+		return nil, fmt.Errorf("remote signer is not responding: %w", err)
+	}
+
+	return &bunkerSigner{client: client, pubkey: session.UserPubkey, target: session.Target}, nil
+}
+
+func loadBunkerSession() (*bunkerSession, error) {
+	path, err := bunkerSessionPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var session bunkerSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to parse session file: %w", err)
+	}
+	return &session, nil
+}
+
+func saveBunkerSession(session bunkerSession) error {
+	path, err := bunkerSessionPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("failed to create session directory: %w", err)
+	}
+
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+	// The client secret only authorizes signing requests to this bunker,
+	// but it should still be private to the operator
+	return os.WriteFile(path, data, 0600)
+}
+
+func forgetBunkerSession() error {
+	path, err := bunkerSessionPath()
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func targetFromBunkerURI(bunkerURI string) string {
+	if u, err := url.Parse(bunkerURI); err == nil && u.Scheme == "bunker" {
+		return u.Host
+	}
+	return ""
+}
+
+func relaysFromBunkerURI(bunkerURI string) []string {
+	if u, err := url.Parse(bunkerURI); err == nil {
+		return u.Query()["relay"]
+	}
+	return nil
+}
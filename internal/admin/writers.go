@@ -0,0 +1,163 @@
+package admin
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"mercury-relay/internal/access"
+)
+
+// handlePendingWriters lists pubkeys waiting for write access and lets the
+// operator approve or deny them through the REST API
+func (a *Interface) handlePendingWriters(scanner *bufio.Scanner) {
+	fmt.Println("\n=== Pending Writers ===")
+
+	writers, err := a.fetchPendingWriters()
+	if err != nil {
+		fmt.Printf("❌ %v\n", err)
+		return
+	}
+	if len(writers) == 0 {
+		fmt.Println("No pending writers.")
+		return
+	}
+
+	for i, writer := range writers {
+		fmt.Printf("%d. %s (%d attempts, first seen %s)\n", i+1, writer.Pubkey, writer.Attempts, writer.FirstSeen.Format(time.RFC3339))
+		if writer.Sample != nil {
+			content := writer.Sample.Content
+			if len(content) > 120 {
+				content = content[:120] + "..."
+			}
+			fmt.Printf("   kind %d: %s\n", writer.Sample.Kind, content)
+		}
+	}
+
+	fmt.Println("Enter 'approve <n>' or 'deny <n>', or leave empty to go back.")
+	for {
+		fmt.Print("writers> ")
+		if !scanner.Scan() {
+			return
+		}
+
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			return
+		}
+		if len(fields) != 2 || (fields[0] != "approve" && fields[0] != "deny") {
+			fmt.Println("Usage: approve <n> | deny <n>")
+			continue
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 1 || n > len(writers) {
+			fmt.Printf("Choose a writer between 1 and %d.\n", len(writers))
+			continue
+		}
+
+		pubkey := writers[n-1].Pubkey
+		if err := a.decideWriter(pubkey, fields[0]); err != nil {
+			fmt.Printf("❌ %v\n", err)
+			continue
+		}
+		fmt.Printf("✅ %s: %s\n", fields[0], pubkey)
+	}
+}
+
+func (a *Interface) fetchPendingWriters() ([]access.PendingWriter, error) {
+	resp, err := a.adminRequest("GET", "/api/v1/admin/writers/pending", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Data struct {
+			Writers []access.PendingWriter `json:"writers"`
+		} `json:"data"`
+		Error string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("relay responded with status %d: %s", resp.StatusCode, response.Error)
+	}
+	return response.Data.Writers, nil
+}
+
+func (a *Interface) decideWriter(pubkey, action string) error {
+	resp, err := a.adminRequest("POST", "/api/v1/admin/writers/"+pubkey+"/"+action, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("relay responded with status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// adminRequest calls an admin REST endpoint as the authenticated user,
+// sending body as JSON when it is not nil
+func (a *Interface) adminRequest(method, path string, body interface{}) (*http.Response, error) {
+	relayURL := fmt.Sprintf("http://%s:%d", a.config.Server.Host, a.config.Server.Port+2) // REST API is on port+2
+
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request: %w", err)
+		}
+		reader = bytes.NewReader(encoded)
+	}
+	req, err := http.NewRequest(method, relayURL+path, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("X-Nostr-Pubkey", a.userPubkey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	client := &http.Client{Timeout: 10 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to relay: %w", err)
+	}
+	return resp, nil
+}
+
+// adminCall calls an admin REST endpoint and decodes the data of its
+// response into out, when out is not nil
+func (a *Interface) adminCall(method, path string, body, out interface{}) error {
+	resp, err := a.adminRequest(method, path, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var response struct {
+		Data  json.RawMessage `json:"data"`
+		Error string          `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("relay responded with status %d: %s", resp.StatusCode, response.Error)
+	}
+	if out != nil && len(response.Data) > 0 {
+		if err := json.Unmarshal(response.Data, out); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+// Package annotations keeps private operator notes on pubkeys and events,
+// e.g. "repeat spammer" or "verified author". Notes are only ever shown to
+// admins.
+package annotations
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Target types
+const (
+	TargetPubkey = "pubkey"
+	TargetEvent  = "event"
+)
+
+// MaxNoteLength caps a note in bytes
+const MaxNoteLength = 2000
+
+var (
+	ErrNotFound          = fmt.Errorf("annotation not found")
+	ErrInvalidAnnotation = fmt.Errorf("invalid annotation")
+)
+
+// Annotation is one note on a pubkey or event
+type Annotation struct {
+	ID         string    `json:"id"`
+	TargetType string    `json:"target_type"`
+	Target     string    `json:"target"`
+	Note       string    `json:"note"`
+	Author     string    `json:"author"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// Store holds annotations in memory and saves them to path after every
+// change
+type Store struct {
+	path        string
+	annotations map[string]*Annotation
+	mu          sync.RWMutex
+}
+
+// NewStore loads the annotations saved at path. An empty path keeps them in
+// memory only.
+func NewStore(path string) (*Store, error) {
+	s := &Store{
+		path:        path,
+		annotations: make(map[string]*Annotation),
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Create adds a note to target
+func (s *Store) Create(targetType, target, note, author string) (Annotation, error) {
+	target = strings.ToLower(target)
+	if err := validate(targetType, target, note); err != nil {
+		return Annotation{}, err
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return Annotation{}, fmt.Errorf("failed to generate annotation id: %w", err)
+	}
+	now := time.Now()
+	a := &Annotation{
+		ID:         hex.EncodeToString(id),
+		TargetType: targetType,
+		Target:     target,
+		Note:       strings.TrimSpace(note),
+		Author:     author,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.annotations[a.ID] = a
+	if err := s.saveLocked(); err != nil {
+		delete(s.annotations, a.ID)
+		return Annotation{}, err
+	}
+	return *a, nil
+}
+
+// Update replaces the text of a note
+func (s *Store) Update(id, note, author string) (Annotation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.annotations[id]
+	if !ok {
+		return Annotation{}, ErrNotFound
+	}
+	if err := validate(a.TargetType, a.Target, note); err != nil {
+		return Annotation{}, err
+	}
+
+	before := *a
+	a.Note = strings.TrimSpace(note)
+	a.Author = author
+	a.UpdatedAt = time.Now()
+	if err := s.saveLocked(); err != nil {
+		*a = before
+		return Annotation{}, err
+	}
+	return *a, nil
+}
+
+// Delete removes a note
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.annotations[id]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(s.annotations, id)
+	if err := s.saveLocked(); err != nil {
+		s.annotations[id] = a
+		return err
+	}
+	return nil
+}
+
+// Get returns one note
+func (s *Store) Get(id string) (Annotation, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	a, ok := s.annotations[id]
+	if !ok {
+		return Annotation{}, ErrNotFound
+	}
+	return *a, nil
+}
+
+// List returns notes, oldest first. Empty arguments match everything.
+func (s *Store) List(targetType, target string) []Annotation {
+	target = strings.ToLower(target)
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := []Annotation{}
+	for _, a := range s.annotations {
+		if (targetType == "" || a.TargetType == targetType) && (target == "" || a.Target == target) {
+			list = append(list, *a)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// ForTargets returns the notes on each of targets, oldest first. Targets
+// without notes are left out.
+func (s *Store) ForTargets(targetType string, targets []string) map[string][]Annotation {
+	want := make(map[string]bool, len(targets))
+	for _, target := range targets {
+		want[strings.ToLower(target)] = true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	found := make(map[string][]Annotation)
+	for _, a := range s.annotations {
+		if a.TargetType == targetType && want[a.Target] {
+			found[a.Target] = append(found[a.Target], *a)
+		}
+	}
+	for _, list := range found {
+		sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	}
+	return found
+}
+
+func validate(targetType, target, note string) error {
+	if targetType != TargetPubkey && targetType != TargetEvent {
+		return fmt.Errorf("%w: target type must be %q or %q", ErrInvalidAnnotation, TargetPubkey, TargetEvent)
+	}
+	if !nostr.IsValid32ByteHex(target) {
+		return fmt.Errorf("%w: target must be a 64 character hex %s", ErrInvalidAnnotation, targetType)
+	}
+	note = strings.TrimSpace(note)
+	if note == "" {
+		return fmt.Errorf("%w: note is empty", ErrInvalidAnnotation)
+	}
+	if len(note) > MaxNoteLength {
+		return fmt.Errorf("%w: note is longer than %d bytes", ErrInvalidAnnotation, MaxNoteLength)
+	}
+	return nil
+}
+
+func (s *Store) load() error {
+	if s.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", s.path, err)
+	}
+
+	var list []*Annotation
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+	for _, a := range list {
+		s.annotations[a.ID] = a
+	}
+	return nil
+}
+
+// saveLocked atomically writes the store to path. Callers must hold s.mu.
+func (s *Store) saveLocked() error {
+	if s.path == "" {
+		return nil
+	}
+
+	list := make([]*Annotation, 0, len(s.annotations))
+	for _, a := range s.annotations {
+		list = append(list, a)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode annotations: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to write annotations: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write annotations: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write annotations: %w", err)
+	}
+	return nil
+}
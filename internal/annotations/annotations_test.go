@@ -0,0 +1,71 @@
+package annotations
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mercury-relay/test/helpers"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "annotations.json")
+	store, err := NewStore(path)
+	helpers.AssertNoError(t, err)
+
+	spammer := strings.Repeat("a", 64)
+	author := strings.Repeat("b", 64)
+	event := strings.Repeat("c", 64)
+
+	first, err := store.Create(TargetPubkey, strings.ToUpper(spammer), " repeat spammer ", "npub1admin")
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, spammer, first.Target)
+	helpers.AssertStringEqual(t, "repeat spammer", first.Note)
+	_, err = store.Create(TargetPubkey, author, "verified author", "npub1admin")
+	helpers.AssertNoError(t, err)
+	_, err = store.Create(TargetEvent, event, "left up after appeal", "npub1admin")
+	helpers.AssertNoError(t, err)
+
+	helpers.AssertIntEqual(t, 3, len(store.List("", "")))
+	helpers.AssertIntEqual(t, 2, len(store.List(TargetPubkey, "")))
+	helpers.AssertIntEqual(t, 1, len(store.List(TargetPubkey, spammer)))
+
+	found := store.ForTargets(TargetPubkey, []string{spammer, event, strings.Repeat("d", 64)})
+	helpers.AssertIntEqual(t, 1, len(found))
+	helpers.AssertStringEqual(t, "repeat spammer", found[spammer][0].Note)
+
+	updated, err := store.Update(first.ID, "repeat spammer, second warning", "npub1other")
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, "npub1other", updated.Author)
+	helpers.AssertTrue(t, !updated.UpdatedAt.Before(updated.CreatedAt))
+
+	t.Run("Survives a restart", func(t *testing.T) {
+		reloaded, err := NewStore(path)
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, 3, len(reloaded.List("", "")))
+		got, err := reloaded.Get(first.ID)
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, "repeat spammer, second warning", got.Note)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		helpers.AssertNoError(t, store.Delete(first.ID))
+		_, err := store.Get(first.ID)
+		helpers.AssertTrue(t, errors.Is(err, ErrNotFound))
+		helpers.AssertTrue(t, errors.Is(store.Delete(first.ID), ErrNotFound))
+	})
+
+	t.Run("Rejects invalid notes", func(t *testing.T) {
+		_, err := store.Create("relay", spammer, "note", "npub1admin")
+		helpers.AssertTrue(t, errors.Is(err, ErrInvalidAnnotation))
+		_, err = store.Create(TargetPubkey, "npub1notahex", "note", "npub1admin")
+		helpers.AssertTrue(t, errors.Is(err, ErrInvalidAnnotation))
+		_, err = store.Create(TargetEvent, event, "   ", "npub1admin")
+		helpers.AssertTrue(t, errors.Is(err, ErrInvalidAnnotation))
+		_, err = store.Create(TargetEvent, event, strings.Repeat("x", MaxNoteLength+1), "npub1admin")
+		helpers.AssertTrue(t, errors.Is(err, ErrInvalidAnnotation))
+		_, err = store.Update("missing", "note", "npub1admin")
+		helpers.AssertTrue(t, errors.Is(err, ErrNotFound))
+	})
+}
@@ -10,6 +10,7 @@ import (
 
 	"mercury-relay/internal/cache"
 	"mercury-relay/internal/config"
+	"mercury-relay/internal/problem"
 	"mercury-relay/internal/quality"
 	"mercury-relay/internal/queue"
 	"mercury-relay/internal/storage"
@@ -55,7 +56,7 @@ func (a *AdminAPI) Start() error {
 
 	a.server = &http.Server{
 		Addr:    fmt.Sprintf(":%d", a.config.Port),
-		Handler: a.authenticate(mux),
+		Handler: problem.Middleware(requestLogMiddleware(a.authenticate(mux))),
 	}
 
 	log.Printf("Starting admin API on port %d", a.config.Port)
@@ -67,7 +68,7 @@ func (a *AdminAPI) authenticate(next http.Handler) http.Handler {
 		// Simple API key authentication
 		apiKey := r.Header.Get("X-API-Key")
 		if apiKey != a.config.APIKey {
-			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			problem.Write(w, http.StatusUnauthorized, "", "Unauthorized")
 			return
 		}
 
@@ -101,7 +102,7 @@ func (a *AdminAPI) handleStats(w http.ResponseWriter, r *http.Request) {
 
 func (a *AdminAPI) handleBlock(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Write(w, http.StatusMethodNotAllowed, "", "Method not allowed")
 		return
 	}
 
@@ -110,12 +111,12 @@ func (a *AdminAPI) handleBlock(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, "", "Invalid JSON")
 		return
 	}
 
 	if err := a.qualityControl.BlockNpub(req.Npub); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Write(w, http.StatusInternalServerError, "", err.Error())
 		return
 	}
 
@@ -125,7 +126,7 @@ func (a *AdminAPI) handleBlock(w http.ResponseWriter, r *http.Request) {
 
 func (a *AdminAPI) handleUnblock(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		problem.Write(w, http.StatusMethodNotAllowed, "", "Method not allowed")
 		return
 	}
 
@@ -134,12 +135,12 @@ func (a *AdminAPI) handleUnblock(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, "", "Invalid JSON")
 		return
 	}
 
 	if err := a.qualityControl.UnblockNpub(req.Npub); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		problem.Write(w, http.StatusInternalServerError, "", err.Error())
 		return
 	}
 
@@ -149,9 +150,13 @@ func (a *AdminAPI) handleUnblock(w http.ResponseWriter, r *http.Request) {
 
 func (a *AdminAPI) handleBlocked(w http.ResponseWriter, r *http.Request) {
 	blocked := a.qualityControl.GetBlockedNpubs()
+	sources := make(map[string][]string, len(blocked))
+	for _, npub := range blocked {
+		sources[npub] = a.qualityControl.BlockSources(npub)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string][]string{"blocked": blocked})
+	json.NewEncoder(w).Encode(map[string]interface{}{"blocked": blocked, "sources": sources})
 }
 
 func (a *AdminAPI) handleEvents(w http.ResponseWriter, r *http.Request) {
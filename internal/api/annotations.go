@@ -0,0 +1,149 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"mercury-relay/internal/annotations"
+	"mercury-relay/internal/mirror"
+
+	"github.com/gorilla/mux"
+)
+
+// AnnotationRequest creates or edits an admin note. TargetType and Target
+// are ignored on edits.
+type AnnotationRequest struct {
+	TargetType string `json:"target_type"`
+	Target     string `json:"target"`
+	Note       string `json:"note"`
+}
+
+// SetAnnotations enables the admin notes endpoints and shows notes in the
+// connection and report views
+func (r *RESTAPIServer) SetAnnotations(store *annotations.Store) {
+	r.annotations = store
+}
+
+// HandleGetAnnotations lists notes, optionally for one target_type and
+// target (admin only)
+func (r *RESTAPIServer) HandleGetAnnotations(w http.ResponseWriter, req *http.Request) {
+	if r.annotations == nil {
+		r.sendError(w, "Annotations are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	targetType := req.URL.Query().Get("target_type")
+	target := req.URL.Query().Get("target")
+	if targetType == annotations.TargetPubkey && target != "" {
+		pubkey, err := mirror.ParsePubkey(target)
+		if err != nil {
+			r.sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		target = pubkey
+	}
+
+	list := r.annotations.List(targetType, target)
+	r.sendSuccess(w, map[string]interface{}{
+		"annotations": list,
+		"count":       len(list),
+	})
+}
+
+// HandleCreateAnnotation adds a note to a pubkey or event (admin only)
+func (r *RESTAPIServer) HandleCreateAnnotation(w http.ResponseWriter, req *http.Request) {
+	if r.annotations == nil {
+		r.sendError(w, "Annotations are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	var body AnnotationRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		r.sendError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if body.TargetType == annotations.TargetPubkey {
+		pubkey, err := mirror.ParsePubkey(body.Target)
+		if err != nil {
+			r.sendError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		body.Target = pubkey
+	}
+
+	admin := r.auth.GetAuthenticatedNpub(req)
+	a, err := r.annotations.Create(body.TargetType, body.Target, body.Note, admin)
+	if err != nil {
+		r.sendAnnotationError(w, err)
+		return
+	}
+
+	log.Printf("Admin %s annotated %s %s", admin, a.TargetType, a.Target)
+	r.sendSuccess(w, a)
+}
+
+// HandleUpdateAnnotation replaces the text of a note (admin only)
+func (r *RESTAPIServer) HandleUpdateAnnotation(w http.ResponseWriter, req *http.Request) {
+	if r.annotations == nil {
+		r.sendError(w, "Annotations are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	var body AnnotationRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		r.sendError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	a, err := r.annotations.Update(mux.Vars(req)["id"], body.Note, r.auth.GetAuthenticatedNpub(req))
+	if err != nil {
+		r.sendAnnotationError(w, err)
+		return
+	}
+	r.sendSuccess(w, a)
+}
+
+// HandleDeleteAnnotation removes a note (admin only)
+func (r *RESTAPIServer) HandleDeleteAnnotation(w http.ResponseWriter, req *http.Request) {
+	if r.annotations == nil {
+		r.sendError(w, "Annotations are not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	id := mux.Vars(req)["id"]
+	if err := r.annotations.Delete(id); err != nil {
+		r.sendAnnotationError(w, err)
+		return
+	}
+
+	log.Printf("Admin %s deleted annotation %s", r.auth.GetAuthenticatedNpub(req), id)
+	r.sendSuccess(w, map[string]interface{}{
+		"deleted": id,
+	})
+}
+
+func (r *RESTAPIServer) sendAnnotationError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, annotations.ErrNotFound):
+		r.sendError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, annotations.ErrInvalidAnnotation):
+		r.sendError(w, err.Error(), http.StatusBadRequest)
+	default:
+		r.sendError(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// annotationsFor returns the notes on targets, or nil when annotations are
+// off or none match
+func (r *RESTAPIServer) annotationsFor(targetType string, targets []string) map[string][]annotations.Annotation {
+	if r.annotations == nil || len(targets) == 0 {
+		return nil
+	}
+	found := r.annotations.ForTargets(targetType, targets)
+	if len(found) == 0 {
+		return nil
+	}
+	return found
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"mercury-relay/internal/archive"
+	"mercury-relay/internal/entitlement"
+	"mercury-relay/internal/mirror"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/problem"
+
+	"github.com/gorilla/mux"
+)
+
+// SetArchiver archives finalized books, rendering them with this server's
+// EPUB generator, and enables the archive endpoints
+func (r *RESTAPIServer) SetArchiver(a *archive.Archiver) {
+	r.archiver = a
+	a.SetPackager(r)
+}
+
+// PackageBook renders book as an EPUB and packages it with its sections.
+// Books missing a referenced section or locked to entitled readers are not
+// packaged.
+func (r *RESTAPIServer) PackageBook(ctx context.Context, book *models.Event) (*archive.Package, error) {
+	d := book.Tags.GetD()
+	if d == "" {
+		return nil, fmt.Errorf("%w: book has no identifier", archive.ErrIncomplete)
+	}
+	var metadata map[string]interface{}
+	if err := json.Unmarshal([]byte(book.Content), &metadata); err != nil {
+		metadata = map[string]interface{}{}
+	}
+	if _, ok := metadata["title"]; !ok {
+		if title := book.Tags.Find("title"); title != nil {
+			metadata["title"] = title.Value()
+		}
+	}
+
+	sections, err := r.resolveBookSections(ctx, book, d)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get content: %w", err)
+	}
+	if missing := missingSections(book, sections); missing > 0 || len(sections) == 0 {
+		return nil, fmt.Errorf("%w: %d of its sections are missing", archive.ErrIncomplete, missing)
+	}
+	if entitlement.Locked(book, sections) {
+		return nil, archive.ErrRestricted
+	}
+
+	epub, err := r.generateEPUB(ctx, book, sections, metadata, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate EPUB: %w", err)
+	}
+	return archive.Build(book, r.sortContentEvents(sections), getString(metadata, "title", d), epub)
+}
+
+// missingSections counts the sections book references by address or ID
+// that aren't among sections
+func missingSections(book *models.Event, sections []*models.Event) int {
+	have := make(map[string]bool)
+	for _, section := range sections {
+		have[section.ID] = true
+		have[fmt.Sprintf("30041:%s:%s", section.PubKey, eventDTag(section))] = true
+	}
+	missing := 0
+	for _, tag := range book.Tags {
+		if len(tag) < 2 || (tag[0] != "a" && tag[0] != "e") {
+			continue
+		}
+		if tag[0] == "a" && !strings.HasPrefix(tag[1], "30041:") {
+			continue
+		}
+		if !have[tag[1]] {
+			missing++
+		}
+	}
+	return missing
+}
+
+// HandleArchiveEbook archives a book now, without waiting for it to be
+// finalized. Only its author or an admin may.
+func (r *RESTAPIServer) HandleArchiveEbook(w http.ResponseWriter, req *http.Request) {
+	if r.archiver == nil {
+		r.sendError(w, "Archiving is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	book, ok := r.loadBook(req.Context(), w, mux.Vars(req)["id"])
+	if !ok {
+		return
+	}
+	npub := r.auth.GetAuthenticatedNpub(req)
+	if pubkey, _ := mirror.ParsePubkey(npub); pubkey != book.PubKey && !r.auth.IsAdmin(npub) {
+		r.sendProblem(w, http.StatusForbidden, problem.CodeForbidden, "Only the book's author or an admin can archive it")
+		return
+	}
+
+	pkg, err := r.PackageBook(req.Context(), book)
+	if errors.Is(err, archive.ErrIncomplete) || errors.Is(err, archive.ErrRestricted) {
+		r.sendProblem(w, http.StatusConflict, problem.CodeConflict, err.Error())
+		return
+	}
+	if err != nil {
+		r.sendError(w, fmt.Sprintf("Failed to package book: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	records, err := r.archiver.Archive(req.Context(), pkg)
+	if err != nil {
+		log.Printf("Failed to archive book %s: %v", pkg.Book, err)
+		if len(records) == 0 {
+			r.sendProblem(w, http.StatusBadGateway, problem.CodeUpstreamUnavailable, fmt.Sprintf("Failed to archive book: %v", err))
+			return
+		}
+	}
+	response := map[string]interface{}{
+		"book":     pkg.Book,
+		"event_id": pkg.EventID,
+		"archived": records,
+		"archives": r.archiver.Records(pkg.Book),
+	}
+	if err != nil {
+		response["error"] = err.Error()
+	}
+	r.sendSuccess(w, response)
+}
+
+// HandleGetArchives lists where versions of a book have been archived
+func (r *RESTAPIServer) HandleGetArchives(w http.ResponseWriter, req *http.Request) {
+	if r.archiver == nil {
+		r.sendError(w, "Archiving is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	book, ok := r.loadBook(req.Context(), w, mux.Vars(req)["id"])
+	if !ok {
+		return
+	}
+	address := fmt.Sprintf("%d:%s:%s", archive.KindBook, book.PubKey, book.Tags.GetD())
+	records := r.archiver.Records(address)
+	if records == nil {
+		records = []archive.Record{}
+	}
+	r.sendSuccess(w, map[string]interface{}{
+		"book":     address,
+		"archived": r.archiver.Archived(book.ID),
+		"archives": records,
+	})
+}
@@ -0,0 +1,125 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"mercury-relay/internal/blocklist"
+	"mercury-relay/internal/problem"
+
+	"github.com/gorilla/mux"
+)
+
+// BlockListRequest subscribes to a moderation list. Address is an naddr or
+// "kind:pubkey:d-tag"; Relays are searched besides the configured ones.
+type BlockListRequest struct {
+	Address string   `json:"address"`
+	Relays  []string `json:"relays"`
+}
+
+// SetBlockLists enables the admin block list endpoints
+func (r *RESTAPIServer) SetBlockLists(manager *blocklist.Manager) {
+	r.blockLists = manager
+}
+
+// HandleGetBlockLists lists the subscribed moderation lists (admin only)
+func (r *RESTAPIServer) HandleGetBlockLists(w http.ResponseWriter, req *http.Request) {
+	if r.blockLists == nil {
+		r.sendError(w, "Block lists are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	lists := r.blockLists.Lists()
+	r.sendSuccess(w, map[string]interface{}{
+		"lists": lists,
+		"count": len(lists),
+	})
+}
+
+// HandleSubscribeBlockList subscribes to a moderation list and fetches it
+// right away (admin only)
+func (r *RESTAPIServer) HandleSubscribeBlockList(w http.ResponseWriter, req *http.Request) {
+	if r.blockLists == nil {
+		r.sendError(w, "Block lists are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	var body BlockListRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		r.sendError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	list, err := r.blockLists.Subscribe(body.Address, body.Relays)
+	if err == blocklist.ErrExists {
+		r.sendProblem(w, http.StatusConflict, problem.CodeConflict, err.Error())
+		return
+	}
+	if err != nil {
+		r.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// A fetch failure is kept on the list and retried on the next refresh
+	r.blockLists.Refresh(req.Context(), list.ID)
+	list, _ = r.blockLists.Get(list.ID)
+	r.sendSuccess(w, list)
+}
+
+// HandleGetBlockList shows a moderation list with the pubkeys it blocks
+// (admin only)
+func (r *RESTAPIServer) HandleGetBlockList(w http.ResponseWriter, req *http.Request) {
+	if r.blockLists == nil {
+		r.sendError(w, "Block lists are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	list, err := r.blockLists.Get(mux.Vars(req)["id"])
+	if err != nil {
+		r.sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	r.sendSuccess(w, list)
+}
+
+// HandleRefreshBlockList fetches a moderation list now (admin only)
+func (r *RESTAPIServer) HandleRefreshBlockList(w http.ResponseWriter, req *http.Request) {
+	if r.blockLists == nil {
+		r.sendError(w, "Block lists are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	id := mux.Vars(req)["id"]
+	if err := r.blockLists.Refresh(req.Context(), id); err == blocklist.ErrNotFound {
+		r.sendError(w, err.Error(), http.StatusNotFound)
+		return
+	} else if err != nil {
+		r.sendError(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	list, _ := r.blockLists.Get(id)
+	r.sendSuccess(w, list.Summary())
+}
+
+// HandleUnsubscribeBlockList drops a moderation list and lifts the blocks
+// it made (admin only)
+func (r *RESTAPIServer) HandleUnsubscribeBlockList(w http.ResponseWriter, req *http.Request) {
+	if r.blockLists == nil {
+		r.sendError(w, "Block lists are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	id := mux.Vars(req)["id"]
+	unblocked, err := r.blockLists.Unsubscribe(id)
+	if err == blocklist.ErrNotFound {
+		r.sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		r.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	r.sendSuccess(w, map[string]interface{}{
+		"id":        id,
+		"unblocked": unblocked,
+	})
+}
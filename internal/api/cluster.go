@@ -0,0 +1,8 @@
+package api
+
+import "mercury-relay/internal/cluster"
+
+// SetCluster reports the instances sharing storage in /api/v1/stats
+func (r *RESTAPIServer) SetCluster(node *cluster.Node) {
+	r.cluster = node
+}
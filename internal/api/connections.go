@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"mercury-relay/internal/annotations"
+)
+
+// ConnectionInfo describes one open WebSocket connection
+type ConnectionInfo struct {
+	RemoteAddr    string    `json:"remote_addr"`
+	Pubkey        string    `json:"pubkey,omitempty"`
+	ConnectedAt   time.Time `json:"connected_at"`
+	Subscriptions int       `json:"subscriptions"`
+	REQs          int64     `json:"reqs"`
+	RateLimited   int64     `json:"rate_limited"`
+	ReplayLimited int64     `json:"replay_limited"`
+	ActiveReplays int       `json:"active_replays"`
+	// Refused counts messages refused by any limit; PendingEvents are
+	// events waiting to be written to the client
+	Refused       int64 `json:"refused"`
+	PendingEvents int   `json:"pending_events"`
+	// Annotations are admins' notes on the authenticated pubkey
+	Annotations []annotations.Annotation `json:"annotations,omitempty"`
+}
+
+// ConnectionSource exposes the relay's WebSocket connections and REQ flood
+// protection counters
+type ConnectionSource interface {
+	Connections() []ConnectionInfo
+	REQStats() map[string]int64
+}
+
+// SetConnectionSource enables connection counts in stats and the admin
+// connection view
+func (r *RESTAPIServer) SetConnectionSource(source ConnectionSource) {
+	r.connections = source
+}
+
+// HandleGetConnections lists open WebSocket connections with their REQ
+// counters, most rate limited first (admin only)
+func (r *RESTAPIServer) HandleGetConnections(w http.ResponseWriter, req *http.Request) {
+	if r.connections == nil {
+		r.sendError(w, "Connection tracking is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	connections := r.connections.Connections()
+	sort.SliceStable(connections, func(i, j int) bool {
+		a, b := connections[i], connections[j]
+		if a.RateLimited+a.ReplayLimited != b.RateLimited+b.ReplayLimited {
+			return a.RateLimited+a.ReplayLimited > b.RateLimited+b.ReplayLimited
+		}
+		return a.ConnectedAt.Before(b.ConnectedAt)
+	})
+
+	var pubkeys []string
+	for _, c := range connections {
+		if c.Pubkey != "" {
+			pubkeys = append(pubkeys, c.Pubkey)
+		}
+	}
+	notes := r.annotationsFor(annotations.TargetPubkey, pubkeys)
+	for i := range connections {
+		connections[i].Annotations = notes[connections[i].Pubkey]
+	}
+
+	r.sendSuccess(w, map[string]interface{}{
+		"connections": connections,
+		"count":       len(connections),
+		"reqs":        r.connections.REQStats(),
+	})
+}
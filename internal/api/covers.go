@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/cover"
+	"mercury-relay/internal/models"
+
+	"github.com/gorilla/mux"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// coverCacheSize is how many rendered covers are kept in memory
+const coverCacheSize = 512
+
+// bookCover describes the generated cover for a 30040 event
+func bookCover(bookEvent *models.Event, metadata map[string]interface{}) cover.Book {
+	return cover.Book{
+		Seed:   bookEvent.ID,
+		Title:  getString(metadata, "title", ""),
+		Author: getString(metadata, "author", ""),
+	}
+}
+
+// HandleEbookCover serves a book's cover image. Books with a verified cover
+// file are redirected to it; the rest get a typographic cover rendered as PNG
+// or SVG (?format=svg) at ?width= pixels, which suits catalog thumbnails.
+func (r *RESTAPIServer) HandleEbookCover(w http.ResponseWriter, req *http.Request) {
+	bookID := mux.Vars(req)["id"]
+	if bookID == "" {
+		r.sendError(w, "Book ID is required", http.StatusBadRequest)
+		return
+	}
+
+	format := req.URL.Query().Get("format")
+	if format == "" {
+		format = cover.FormatPNG
+	}
+	if format != cover.FormatPNG && format != cover.FormatSVG {
+		r.sendError(w, fmt.Sprintf("Unsupported cover format: %s", format), http.StatusBadRequest)
+		return
+	}
+
+	width := cover.DefaultWidth
+	if widthStr := req.URL.Query().Get("width"); widthStr != "" {
+		n, err := strconv.Atoi(widthStr)
+		if err != nil || n < cover.MinWidth || n > cover.MaxWidth {
+			r.sendError(w, fmt.Sprintf("Width must be between %d and %d", cover.MinWidth, cover.MaxWidth), http.StatusBadRequest)
+			return
+		}
+		width = n
+	}
+
+	bookEvents, err := cache.Collect(r.cache.GetEvents(req.Context(), nostr.Filter{Kinds: []int{30040}, IDs: []string{bookID}}))
+	if err != nil {
+		r.sendError(w, fmt.Sprintf("Failed to get book: %v", err), http.StatusInternalServerError)
+		return
+	}
+	if len(bookEvents) == 0 {
+		r.sendError(w, "Book not found", http.StatusNotFound)
+		return
+	}
+	bookEvent := bookEvents[0]
+
+	var metadata map[string]interface{}
+	if err := json.Unmarshal([]byte(bookEvent.Content), &metadata); err != nil {
+		metadata = map[string]interface{}{}
+	}
+
+	if file := coverFile(r.resolveBookFiles(req.Context(), bookEvent, metadata)); file != nil && req.URL.Query().Get("generated") != "true" {
+		http.Redirect(w, req, file.URL, http.StatusFound)
+		return
+	}
+
+	book := bookCover(bookEvent, metadata)
+	etag := `"` + cover.Key(book, format, width) + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	if req.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	data, err := r.covers.Render(book, format, width)
+	if err != nil {
+		r.sendError(w, fmt.Sprintf("Failed to generate cover: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", cover.ContentType(format))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
@@ -0,0 +1,13 @@
+package api
+
+import (
+	"net/http"
+
+	"mercury-relay/internal/web"
+)
+
+// HandleDashboard serves the admin dashboard page. The page itself holds no
+// data; its scripts read the admin API with the admin's npub.
+func (r *RESTAPIServer) HandleDashboard(w http.ResponseWriter, req *http.Request) {
+	web.Render(w, req, "dashboard", web.Page{Title: "dashboard.title"})
+}
@@ -0,0 +1,11 @@
+package api
+
+import (
+	"mercury-relay/internal/seen"
+)
+
+// SetSeenIndex answers publishes of events accepted before with status
+// "duplicate" instead of queueing them again
+func (r *RESTAPIServer) SetSeenIndex(index *seen.Index) {
+	r.seen = index
+}
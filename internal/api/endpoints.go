@@ -0,0 +1,102 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/transport"
+)
+
+const (
+	priorityWebSocket = 10
+	priorityGRPC      = 50
+
+	// grpcProbeInterval is how long a gRPC reachability check is reused
+	grpcProbeInterval = 30 * time.Second
+	grpcProbeTimeout  = time.Second
+)
+
+// endpointAdvertiser assembles the endpoints document from the relay URL,
+// the gRPC listener and the transport manager's health checks
+type endpointAdvertiser struct {
+	relayURL  string
+	relayPort int
+	grpc      config.GRPCConfig
+
+	grpcHealthy   bool
+	grpcCheckedAt time.Time
+	mu            sync.Mutex
+}
+
+func newEndpointAdvertiser(relayURL string, cfg *config.Config) *endpointAdvertiser {
+	a := &endpointAdvertiser{relayURL: relayURL}
+	if cfg != nil {
+		a.relayPort = cfg.Server.Port
+		a.grpc = cfg.GRPC
+	}
+	return a
+}
+
+// grpcEndpoint reports the gRPC address when the listener accepts
+// connections. The result of a probe is reused for grpcProbeInterval.
+func (a *endpointAdvertiser) grpcEndpoint() (transport.Endpoint, bool) {
+	if !a.grpc.Enabled || a.grpc.ServerPort == 0 {
+		return transport.Endpoint{}, false
+	}
+	host := a.grpc.ServerHost
+	if host == "" {
+		host = "localhost"
+	}
+	address := net.JoinHostPort(host, fmt.Sprint(a.grpc.ServerPort))
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if time.Since(a.grpcCheckedAt) > grpcProbeInterval {
+		conn, err := net.DialTimeout("tcp", address, grpcProbeTimeout)
+		a.grpcHealthy = err == nil
+		if conn != nil {
+			conn.Close()
+		}
+		a.grpcCheckedAt = time.Now()
+	}
+
+	return transport.Endpoint{Transport: "grpc", URL: "grpc://" + address, Priority: priorityGRPC}, a.grpcHealthy
+}
+
+// HandleEndpoints lists every currently healthy way to reach the relay so
+// clients can fail over between transports
+func (r *RESTAPIServer) HandleEndpoints(w http.ResponseWriter, req *http.Request) {
+	var endpoints []transport.Endpoint
+	if r.endpoints.relayURL != "" {
+		endpoints = append(endpoints, transport.Endpoint{
+			Transport: "websocket",
+			URL:       r.endpoints.relayURL,
+			Priority:  priorityWebSocket,
+		})
+	}
+	if r.transportMgr != nil {
+		endpoints = append(endpoints, r.transportMgr.HealthyEndpoints(r.endpoints.relayPort)...)
+	}
+	if grpc, healthy := r.endpoints.grpcEndpoint(); healthy {
+		endpoints = append(endpoints, grpc)
+	}
+
+	sort.SliceStable(endpoints, func(i, j int) bool {
+		return endpoints[i].Priority < endpoints[j].Priority
+	})
+	if endpoints == nil {
+		endpoints = []transport.Endpoint{}
+	}
+
+	// Health changes quickly, so only let clients cache briefly
+	w.Header().Set("Cache-Control", "public, max-age=30")
+	r.sendSuccess(w, map[string]interface{}{
+		"endpoints":    endpoints,
+		"generated_at": time.Now().Unix(),
+	})
+}
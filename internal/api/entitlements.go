@@ -0,0 +1,223 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/entitlement"
+	"mercury-relay/internal/mirror"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/problem"
+
+	"github.com/gorilla/mux"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// GrantRequest gives a reader access to a book
+type GrantRequest struct {
+	Reader string `json:"reader"` // npub or hex pubkey
+}
+
+// UnlockedSection is a section of a locked book. Encrypted content is
+// NIP-44 encrypted from the relay's key to the reader.
+type UnlockedSection struct {
+	ID        string `json:"id"`
+	D         string `json:"d"`
+	Title     string `json:"title,omitempty"`
+	Content   string `json:"content"`
+	Encrypted bool   `json:"encrypted"`
+}
+
+// SetEntitlements enables serving locked books to entitled readers and the
+// endpoints authors and admins use to grant access
+func (r *RESTAPIServer) SetEntitlements(m *entitlement.Manager) {
+	r.entitlements = m
+}
+
+// HandleUnlockedEbook serves a book's sections to an entitled reader, with
+// encrypted sections re-encrypted to the reader's pubkey. Readers without
+// access get 402 and the book's price.
+func (r *RESTAPIServer) HandleUnlockedEbook(w http.ResponseWriter, req *http.Request) {
+	if r.entitlements == nil {
+		r.sendError(w, "Entitlements are not available", http.StatusServiceUnavailable)
+		return
+	}
+	reader, err := mirror.ParsePubkey(r.auth.GetAuthenticatedNpub(req))
+	if err != nil {
+		r.sendProblem(w, http.StatusUnauthorized, problem.CodeUnauthorized, "Unlocking requires a pubkey")
+		return
+	}
+
+	book, ok := r.loadBook(req.Context(), w, mux.Vars(req)["id"])
+	if !ok {
+		return
+	}
+	address := publicationAddress(book)
+	if !r.entitlements.Entitled(address, reader) {
+		detail := fmt.Sprintf("%s is locked", address)
+		if msats, forSale := entitlement.Price(book); forSale {
+			detail = fmt.Sprintf("%s is locked; zap %d sats to the author to unlock it", address, msats/1000)
+		}
+		r.sendProblem(w, http.StatusPaymentRequired, problem.CodePaymentRequired, detail)
+		return
+	}
+
+	sections, err := r.resolveBookSections(req.Context(), book, dTagOf(book))
+	if err != nil {
+		r.sendError(w, fmt.Sprintf("Failed to get book sections: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	unlocked := make([]UnlockedSection, 0, len(sections))
+	for _, section := range sections {
+		content, err := r.entitlements.Unlock(section, reader)
+		if errors.Is(err, entitlement.ErrNoKey) {
+			r.sendError(w, "This relay cannot unlock encrypted sections", http.StatusServiceUnavailable)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to unlock %s for %s: %v", section.ID, reader, err)
+			r.sendError(w, "Failed to unlock section", http.StatusInternalServerError)
+			return
+		}
+		unlocked = append(unlocked, UnlockedSection{
+			ID:        section.ID,
+			D:         dTagOf(section),
+			Title:     section.Tags.Find("title").Value(),
+			Content:   content,
+			Encrypted: entitlement.Encrypted(section),
+		})
+	}
+
+	r.sendSuccess(w, map[string]interface{}{
+		"book":         address,
+		"relay_pubkey": r.entitlements.PublicKey(),
+		"encryption":   "nip44",
+		"sections":     unlocked,
+	})
+}
+
+// HandleGetEntitlements lists who may read a book (author or admin)
+func (r *RESTAPIServer) HandleGetEntitlements(w http.ResponseWriter, req *http.Request) {
+	book, ok := r.loadManagedBook(w, req)
+	if !ok {
+		return
+	}
+
+	grants := r.entitlements.Grants(publicationAddress(book))
+	r.sendSuccess(w, map[string]interface{}{
+		"entitlements": grants,
+		"count":        len(grants),
+	})
+}
+
+// HandleGrantEntitlement gives a reader access to a book (author or admin)
+func (r *RESTAPIServer) HandleGrantEntitlement(w http.ResponseWriter, req *http.Request) {
+	book, ok := r.loadManagedBook(w, req)
+	if !ok {
+		return
+	}
+
+	var body GrantRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		r.sendError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	reader, err := mirror.ParsePubkey(body.Reader)
+	if err != nil {
+		r.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	granter := r.auth.GetAuthenticatedNpub(req)
+	source := entitlement.SourceAdmin
+	if pubkey, _ := mirror.ParsePubkey(granter); pubkey == book.PubKey {
+		source = entitlement.SourceAuthor
+	}
+	g, err := r.entitlements.Grant(publicationAddress(book), reader, source, granter, "")
+	if err != nil {
+		r.sendEntitlementError(w, err)
+		return
+	}
+
+	log.Printf("%s granted %s access to %s", granter, reader, g.Book)
+	r.sendSuccess(w, g)
+}
+
+// HandleRevokeEntitlement takes a reader's access to a book away (author or
+// admin)
+func (r *RESTAPIServer) HandleRevokeEntitlement(w http.ResponseWriter, req *http.Request) {
+	book, ok := r.loadManagedBook(w, req)
+	if !ok {
+		return
+	}
+	reader, err := mirror.ParsePubkey(mux.Vars(req)["reader"])
+	if err != nil {
+		r.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	address := publicationAddress(book)
+	if err := r.entitlements.Revoke(address, reader); err != nil {
+		r.sendEntitlementError(w, err)
+		return
+	}
+
+	log.Printf("%s revoked %s's access to %s", r.auth.GetAuthenticatedNpub(req), reader, address)
+	r.sendSuccess(w, map[string]string{"book": address, "reader": reader})
+}
+
+// loadBook looks up a publication index by event ID. It writes the error
+// response when ok is false.
+func (r *RESTAPIServer) loadBook(ctx context.Context, w http.ResponseWriter, id string) (*models.Event, bool) {
+	if id == "" {
+		r.sendError(w, "Book ID is required", http.StatusBadRequest)
+		return nil, false
+	}
+	events, err := cache.Collect(r.cache.GetEvents(ctx, nostr.Filter{Kinds: []int{30040}, IDs: []string{id}}))
+	if err != nil {
+		r.sendError(w, fmt.Sprintf("Failed to get book: %v", err), http.StatusInternalServerError)
+		return nil, false
+	}
+	if len(events) == 0 {
+		r.sendError(w, "Book not found", http.StatusNotFound)
+		return nil, false
+	}
+	return events[0], true
+}
+
+// loadManagedBook loads the book in the URL for its author or an admin
+func (r *RESTAPIServer) loadManagedBook(w http.ResponseWriter, req *http.Request) (*models.Event, bool) {
+	if r.entitlements == nil {
+		r.sendError(w, "Entitlements are not available", http.StatusServiceUnavailable)
+		return nil, false
+	}
+	book, ok := r.loadBook(req.Context(), w, mux.Vars(req)["id"])
+	if !ok {
+		return nil, false
+	}
+
+	npub := r.auth.GetAuthenticatedNpub(req)
+	if pubkey, _ := mirror.ParsePubkey(npub); pubkey != book.PubKey && !r.auth.IsAdmin(npub) {
+		r.sendProblem(w, http.StatusForbidden, problem.CodeForbidden, "Only the book's author or an admin can manage access")
+		return nil, false
+	}
+	return book, true
+}
+
+func (r *RESTAPIServer) sendEntitlementError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, entitlement.ErrNotFound):
+		r.sendError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, entitlement.ErrInvalidGrant):
+		r.sendError(w, err.Error(), http.StatusBadRequest)
+	default:
+		log.Printf("Entitlement update failed: %v", err)
+		r.sendError(w, "Failed to save entitlements", http.StatusInternalServerError)
+	}
+}
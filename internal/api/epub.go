@@ -0,0 +1,335 @@
+package api
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash/crc32"
+	"html"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	// epubMaxImageSize bounds each image fetched into an EPUB
+	epubMaxImageSize = 10 << 20
+	// epubMaxImages bounds the images embedded in one EPUB besides the cover
+	epubMaxImages = 100
+	// epubFetchTimeout bounds fetching one image
+	epubFetchTimeout = 15 * time.Second
+)
+
+// epubImageTypes are the image core media types of EPUB 3 and the
+// extension each is stored under
+var epubImageTypes = map[string]string{
+	"image/png":     ".png",
+	"image/jpeg":    ".jpg",
+	"image/gif":     ".gif",
+	"image/webp":    ".webp",
+	"image/svg+xml": ".svg",
+}
+
+const epubStylesheet = `body { font-family: serif; line-height: 1.5; margin: 0 5%; }
+h1, h2, h3, h4 { font-family: sans-serif; line-height: 1.2; page-break-after: avoid; }
+img { max-width: 100%; height: auto; }
+figure { margin: 1em 0; text-align: center; }
+figcaption { font-size: 0.9em; font-style: italic; }
+pre { white-space: pre-wrap; font-size: 0.9em; }
+.cover { margin: 0; padding: 0; text-align: center; }
+.cover img { height: 100%; }
+`
+
+// newImageClient returns the client EPUB images are fetched with. Image
+// URLs come from published events, so private addresses are refused.
+func newImageClient() *http.Client {
+	dialer := &net.Dialer{Timeout: epubFetchTimeout}
+	// Checked on the resolved address, so DNS cannot point inside
+	dialer.Control = func(network, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		ip := net.ParseIP(host)
+		if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+			ip.IsLinkLocalMulticast() || ip.IsUnspecified() || ip.IsMulticast() {
+			return fmt.Errorf("refusing to connect to private address %s", host)
+		}
+		return nil
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	return &http.Client{Timeout: epubFetchTimeout, Transport: transport}
+}
+
+// fetchEPUBImage downloads an image to embed under name plus the extension
+// of its type. A non-empty sum is the SHA-256 the image must match.
+func (r *RESTAPIServer) fetchEPUBImage(ctx context.Context, url, sum, name string) (*EPUBImageData, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := r.imageClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, epubMaxImageSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > epubMaxImageSize {
+		return nil, fmt.Errorf("image is larger than %d bytes", epubMaxImageSize)
+	}
+	if sum != "" {
+		digest := sha256.Sum256(data)
+		if hex.EncodeToString(digest[:]) != sum {
+			return nil, fmt.Errorf("image does not match its SHA-256")
+		}
+	}
+
+	// Sniffing doesn't recognise SVG, which is taken at its declared type
+	mimeType := http.DetectContentType(data)
+	if _, ok := epubImageTypes[mimeType]; !ok {
+		mimeType, _, _ = mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	}
+	ext, ok := epubImageTypes[mimeType]
+	if !ok {
+		return nil, fmt.Errorf("unsupported image type %q", mimeType)
+	}
+	return &EPUBImageData{Href: name + ext, MimeType: mimeType, Data: data, Source: url}, nil
+}
+
+// embedChapterImage fetches one of a chapter's images into book and points
+// the chapter's references to it at the embedded copy. An image the chapter
+// doesn't reference is added after its text as a figure.
+func (r *RESTAPIServer) embedChapterImage(ctx context.Context, book *EPUBBook, chapter *EPUBChapter, image EPUBImage) {
+	if image.URL == "" {
+		return
+	}
+	var embedded *EPUBImageData
+	for i := range book.Images {
+		if book.Images[i].Source == image.URL {
+			embedded = &book.Images[i]
+			break
+		}
+	}
+	if embedded == nil {
+		if len(book.Images) >= epubMaxImages {
+			return
+		}
+		data, err := r.fetchEPUBImage(ctx, image.URL, "", fmt.Sprintf("images/image-%d", len(book.Images)+1))
+		if err != nil {
+			log.Printf("Failed to embed image %s in book %s: %v", image.URL, book.Identifier, err)
+			return
+		}
+		book.Images = append(book.Images, *data)
+		embedded = data
+	}
+
+	referenced := false
+	for _, form := range []string{image.URL, html.EscapeString(image.URL)} {
+		quoted := `"` + form + `"`
+		if strings.Contains(chapter.Content, quoted) {
+			chapter.Content = strings.ReplaceAll(chapter.Content, quoted, `"`+embedded.Href+`"`)
+			referenced = true
+		}
+	}
+	if !referenced {
+		figure := fmt.Sprintf(`<figure><img src="%s" alt="%s"/>`, embedded.Href, html.EscapeString(image.Alt))
+		if image.Caption != "" {
+			figure += "<figcaption>" + html.EscapeString(image.Caption) + "</figcaption>"
+		}
+		chapter.Content += "\n" + figure + "</figure>"
+	}
+}
+
+// createEPUBFile packages book as an EPUB 3 container: the uncompressed
+// mimetype entry first, then the container, package document, navigation,
+// stylesheet, cover, chapters and images
+func (r *RESTAPIServer) createEPUBFile(book *EPUBBook) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	modified := book.Modified.UTC()
+	if modified.IsZero() {
+		modified = time.Now().UTC()
+	}
+
+	write := func(name string, data []byte) error {
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: modified})
+		if err != nil {
+			return fmt.Errorf("failed to add %s: %w", name, err)
+		}
+		if _, err := w.Write(data); err != nil {
+			return fmt.Errorf("failed to write %s: %w", name, err)
+		}
+		return nil
+	}
+
+	type entry struct{ name, data string }
+	files := []entry{
+		{"META-INF/container.xml", epubContainer},
+		{"OEBPS/content.opf", epubPackage(book, modified)},
+		{"OEBPS/nav.xhtml", epubNav(book)},
+		{"OEBPS/style.css", epubStylesheet},
+	}
+	if book.Cover != nil {
+		files = append(files, entry{"OEBPS/cover.xhtml", epubCoverPage(book)})
+	}
+	for i, chapter := range book.Content {
+		files = append(files, entry{fmt.Sprintf("OEBPS/chapter-%d.xhtml", i+1), epubChapterPage(book, chapter)})
+	}
+
+	// Readers identify the container by its first entry: mimetype, stored
+	// with its sizes in the local header and no extra field
+	mimetype := []byte("application/epub+zip")
+	w, err := zw.CreateRaw(&zip.FileHeader{
+		Name:               "mimetype",
+		Method:             zip.Store,
+		CRC32:              crc32.ChecksumIEEE(mimetype),
+		CompressedSize64:   uint64(len(mimetype)),
+		UncompressedSize64: uint64(len(mimetype)),
+	})
+	if err == nil {
+		_, err = w.Write(mimetype)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write mimetype: %w", err)
+	}
+	for _, file := range files {
+		if err := write(file.name, []byte(file.data)); err != nil {
+			return nil, err
+		}
+	}
+	for _, image := range epubImages(book) {
+		if err := write("OEBPS/"+image.Href, image.Data); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish EPUB: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+const epubContainer = `<?xml version="1.0" encoding="UTF-8"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="OEBPS/content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>
+`
+
+// epubImages lists the cover followed by the other embedded images
+func epubImages(book *EPUBBook) []EPUBImageData {
+	var images []EPUBImageData
+	if book.Cover != nil {
+		images = append(images, *book.Cover)
+	}
+	return append(images, book.Images...)
+}
+
+// epubPackage renders the OPF package document
+func epubPackage(book *EPUBBook, modified time.Time) string {
+	esc := html.EscapeString
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8"?>` + "\n")
+	fmt.Fprintf(&b, `<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="book-id" xml:lang="%s">`+"\n", esc(book.Language))
+	b.WriteString(`  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">` + "\n")
+	fmt.Fprintf(&b, "    <dc:identifier id=\"book-id\">urn:nostr:%s</dc:identifier>\n", esc(book.Identifier))
+	fmt.Fprintf(&b, "    <dc:title>%s</dc:title>\n", esc(book.Title))
+	fmt.Fprintf(&b, "    <dc:creator>%s</dc:creator>\n", esc(book.Author))
+	fmt.Fprintf(&b, "    <dc:language>%s</dc:language>\n", esc(book.Language))
+	if book.Description != "" {
+		fmt.Fprintf(&b, "    <dc:description>%s</dc:description>\n", esc(book.Description))
+	}
+	fmt.Fprintf(&b, "    <dc:publisher>%s</dc:publisher>\n", esc(book.Publisher))
+	if book.Date != "" {
+		fmt.Fprintf(&b, "    <dc:date>%s</dc:date>\n", esc(book.Date))
+	}
+	fmt.Fprintf(&b, "    <meta property=\"dcterms:modified\">%s</meta>\n", modified.Format("2006-01-02T15:04:05Z"))
+	if book.Cover != nil {
+		// For EPUB 2 readers
+		b.WriteString("    <meta name=\"cover\" content=\"cover-image\"/>\n")
+	}
+	b.WriteString("  </metadata>\n  <manifest>\n")
+	b.WriteString("    <item id=\"nav\" href=\"nav.xhtml\" media-type=\"application/xhtml+xml\" properties=\"nav\"/>\n")
+	b.WriteString("    <item id=\"css\" href=\"style.css\" media-type=\"text/css\"/>\n")
+	if book.Cover != nil {
+		b.WriteString("    <item id=\"cover\" href=\"cover.xhtml\" media-type=\"application/xhtml+xml\"/>\n")
+		fmt.Fprintf(&b, "    <item id=\"cover-image\" href=\"%s\" media-type=\"%s\" properties=\"cover-image\"/>\n",
+			esc(book.Cover.Href), book.Cover.MimeType)
+	}
+	for i := range book.Content {
+		fmt.Fprintf(&b, "    <item id=\"chapter-%d\" href=\"chapter-%d.xhtml\" media-type=\"application/xhtml+xml\"/>\n", i+1, i+1)
+	}
+	for i, image := range book.Images {
+		fmt.Fprintf(&b, "    <item id=\"image-%d\" href=\"%s\" media-type=\"%s\"/>\n", i+1, esc(image.Href), image.MimeType)
+	}
+	b.WriteString("  </manifest>\n  <spine>\n")
+	if book.Cover != nil {
+		b.WriteString("    <itemref idref=\"cover\"/>\n")
+	}
+	b.WriteString("    <itemref idref=\"nav\" linear=\"no\"/>\n")
+	for i := range book.Content {
+		fmt.Fprintf(&b, "    <itemref idref=\"chapter-%d\"/>\n", i+1)
+	}
+	b.WriteString("  </spine>\n</package>\n")
+	return b.String()
+}
+
+// epubPage wraps body in an XHTML document
+func epubPage(book *EPUBBook, title, body string, nav bool) string {
+	namespaces := `xmlns="http://www.w3.org/1999/xhtml"`
+	if nav {
+		namespaces += ` xmlns:epub="http://www.idpf.org/2007/ops"`
+	}
+	lang := html.EscapeString(book.Language)
+	return fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE html>
+<html %s xml:lang="%s" lang="%s">
+<head>
+  <meta charset="UTF-8"/>
+  <title>%s</title>
+  <link rel="stylesheet" type="text/css" href="style.css"/>
+</head>
+<body>
+%s
+</body>
+</html>
+`, namespaces, lang, lang, html.EscapeString(title), body)
+}
+
+// epubNav renders the navigation document with the table of contents
+func epubNav(book *EPUBBook) string {
+	var b strings.Builder
+	b.WriteString("<nav epub:type=\"toc\" id=\"toc\">\n  <h1>Contents</h1>\n  <ol>\n")
+	for i, chapter := range book.Content {
+		fmt.Fprintf(&b, "    <li><a href=\"chapter-%d.xhtml\">%s</a></li>\n", i+1, html.EscapeString(chapter.Title))
+	}
+	b.WriteString("  </ol>\n</nav>")
+	return epubPage(book, book.Title, b.String(), true)
+}
+
+func epubCoverPage(book *EPUBBook) string {
+	body := fmt.Sprintf(`<div class="cover"><img src="%s" alt="%s"/></div>`,
+		html.EscapeString(book.Cover.Href), html.EscapeString(book.Title))
+	return epubPage(book, book.Title, body, false)
+}
+
+// epubChapterPage renders a chapter
+func epubChapterPage(book *EPUBBook, chapter EPUBChapter) string {
+	body := fmt.Sprintf("<section>\n<h1>%s</h1>\n%s\n</section>", html.EscapeString(chapter.Title), chapter.Content)
+	return epubPage(book, chapter.Title, body, false)
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// eventResponse is an event as the REST API returns it: the signed NIP-01
+// fields plus relay metadata as extension fields clients may ignore
+type eventResponse struct {
+	ID        string          `json:"id"`
+	PubKey    string          `json:"pubkey"`
+	CreatedAt nostr.Timestamp `json:"created_at"`
+	Kind      int             `json:"kind"`
+	Tags      nostr.Tags      `json:"tags"`
+	Content   string          `json:"content"`
+	Sig       string          `json:"sig"`
+	// TrustLabel says how the relay knows the author of an upstream event
+	TrustLabel string `json:"trust_label,omitempty"`
+}
+
+func newEventResponse(event *models.Event) eventResponse {
+	tags := event.Tags
+	if tags == nil {
+		tags = nostr.Tags{} // NIP-01 clients expect an array
+	}
+	return eventResponse{
+		ID:         event.ID,
+		PubKey:     event.PubKey,
+		CreatedAt:  event.CreatedAt,
+		Kind:       event.Kind,
+		Tags:       tags,
+		Content:    event.Content,
+		Sig:        event.Sig,
+		TrustLabel: event.TrustLabel,
+	}
+}
+
+// toEventResponses converts events for a response; nil when there are none
+func toEventResponses(events []*models.Event) []eventResponse {
+	var responses []eventResponse
+	for _, event := range events {
+		responses = append(responses, newEventResponse(event))
+	}
+	return responses
+}
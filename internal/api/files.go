@@ -0,0 +1,90 @@
+package api
+
+import (
+	"context"
+	"log"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// resolveBookFiles finds the kind 1063 file metadata events a publication
+// links to and returns the ones that validate. Links come from "e" tags on the
+// 30040 event (a "cover" marker designates the cover) and from the "cover" and
+// "files" fields of its metadata when they hold event IDs.
+func (r *RESTAPIServer) resolveBookFiles(ctx context.Context, bookEvent *models.Event, metadata map[string]interface{}) []*models.FileMetadata {
+	roles := make(map[string]string)
+	var ids []string
+	link := func(id, role string) {
+		if !nostr.IsValid32ByteHex(id) {
+			return
+		}
+		if _, seen := roles[id]; !seen {
+			ids = append(ids, id)
+		}
+		if role == "cover" || roles[id] == "" {
+			roles[id] = role
+		}
+	}
+
+	for _, tag := range bookEvent.Tags {
+		if len(tag) < 2 || tag[0] != "e" {
+			continue
+		}
+		role := "attachment"
+		if len(tag) >= 4 && tag[3] == "cover" {
+			role = "cover"
+		}
+		link(tag[1], role)
+	}
+	if cover, ok := metadata["cover"].(string); ok {
+		link(cover, "cover")
+	}
+	if files, ok := metadata["files"].([]interface{}); ok {
+		for _, f := range files {
+			if id, ok := f.(string); ok {
+				link(id, "attachment")
+			}
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	events, err := cache.Collect(r.cache.GetEvents(ctx, nostr.Filter{
+		Kinds: []int{models.KindFileMetadata},
+		IDs:   ids,
+	}))
+	if err != nil {
+		log.Printf("Failed to resolve files for book %s: %v", bookEvent.ID, err)
+		return nil
+	}
+
+	var files []*models.FileMetadata
+	for _, event := range events {
+		role, linked := roles[event.ID]
+		if !linked {
+			continue
+		}
+		file, err := models.ParseFileMetadata(event)
+		if err != nil {
+			continue
+		}
+		file.Role = role
+		files = append(files, file)
+	}
+	return files
+}
+
+// coverFile returns the first verified cover image among files
+func coverFile(files []*models.FileMetadata) *models.FileMetadata {
+	for _, file := range files {
+		if file.Role == "cover" && file.IsImage() {
+			return file
+		}
+	}
+	return nil
+}
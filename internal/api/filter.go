@@ -0,0 +1,74 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// filterQuery parses a NIP-01 filter from query parameters: repeated ids,
+// authors and kinds, since, until, limit, #x tag conditions and a NIP-50
+// search string
+func filterQuery(query url.Values) (nostr.Filter, error) {
+	var filter nostr.Filter
+	if ids := query["ids"]; len(ids) > 0 {
+		filter.IDs = ids
+	}
+	if authors := query["authors"]; len(authors) > 0 {
+		filter.Authors = authors
+	}
+	filter.Tags = tagParams(query)
+	filter.Search = query.Get("search")
+	for _, kind := range query["kinds"] {
+		k, err := strconv.Atoi(kind)
+		if err != nil {
+			return filter, fmt.Errorf("invalid kind %q", kind)
+		}
+		filter.Kinds = append(filter.Kinds, k)
+	}
+	for _, bound := range []struct {
+		name string
+		dest **nostr.Timestamp
+	}{{"since", &filter.Since}, {"until", &filter.Until}} {
+		value := query.Get(bound.name)
+		if value == "" {
+			continue
+		}
+		t, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("invalid %s %q", bound.name, value)
+		}
+		timestamp := nostr.Timestamp(t)
+		*bound.dest = &timestamp
+	}
+	if limit := query.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil {
+			return filter, fmt.Errorf("invalid limit %q", limit)
+		}
+		filter.Limit = l
+	}
+	return filter, nil
+}
+
+// tagParams returns the NIP-01 tag conditions given as "#x" query
+// parameters (%23x once encoded). Values are repeated, not comma-separated,
+// since tag values may contain commas.
+func tagParams(query url.Values) nostr.TagMap {
+	var tags nostr.TagMap
+	for key, values := range query {
+		if len(key) != 2 || key[0] != '#' {
+			continue
+		}
+		if c := key[1]; (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+			continue
+		}
+		if tags == nil {
+			tags = make(nostr.TagMap)
+		}
+		tags[key[1:]] = values
+	}
+	return tags
+}
@@ -6,6 +6,8 @@ import (
 	"net/http"
 	"strconv"
 
+	"mercury-relay/internal/problem"
+
 	"github.com/gorilla/mux"
 )
 
@@ -20,14 +22,14 @@ func (r *RESTAPIServer) HandleEventHistory(w http.ResponseWriter, req *http.Requ
 	// Parse kind
 	kind, err := strconv.Atoi(kindStr)
 	if err != nil {
-		http.Error(w, "Invalid kind parameter", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, "", "Invalid kind parameter")
 		return
 	}
 
 	// Get history from cache
 	history, err := r.cache.GetReplaceableEventHistory(kind, pubkey, dTag)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get event history: %v", err), http.StatusInternalServerError)
+		problem.Write(w, http.StatusInternalServerError, "", fmt.Sprintf("Failed to get event history: %v", err))
 		return
 	}
 
@@ -55,26 +57,26 @@ func (r *RESTAPIServer) HandleEventDiff(w http.ResponseWriter, req *http.Request
 	// Parse parameters
 	kind, err := strconv.Atoi(kindStr)
 	if err != nil {
-		http.Error(w, "Invalid kind parameter", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, "", "Invalid kind parameter")
 		return
 	}
 
 	fromVersion, err := strconv.Atoi(fromVersionStr)
 	if err != nil {
-		http.Error(w, "Invalid from_version parameter", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, "", "Invalid from_version parameter")
 		return
 	}
 
 	toVersion, err := strconv.Atoi(toVersionStr)
 	if err != nil {
-		http.Error(w, "Invalid to_version parameter", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, "", "Invalid to_version parameter")
 		return
 	}
 
 	// Get history
 	history, err := r.cache.GetReplaceableEventHistory(kind, pubkey, dTag)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get event history: %v", err), http.StatusInternalServerError)
+		problem.Write(w, http.StatusInternalServerError, "", fmt.Sprintf("Failed to get event history: %v", err))
 		return
 	}
 
@@ -90,7 +92,7 @@ func (r *RESTAPIServer) HandleEventDiff(w http.ResponseWriter, req *http.Request
 	}
 
 	if fromEvent == nil || toEvent == nil {
-		http.Error(w, "Version not found", http.StatusNotFound)
+		problem.Write(w, http.StatusNotFound, "", "Version not found")
 		return
 	}
 
@@ -122,20 +124,20 @@ func (r *RESTAPIServer) HandleEventVersion(w http.ResponseWriter, req *http.Requ
 	// Parse parameters
 	kind, err := strconv.Atoi(kindStr)
 	if err != nil {
-		http.Error(w, "Invalid kind parameter", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, "", "Invalid kind parameter")
 		return
 	}
 
 	version, err := strconv.Atoi(versionStr)
 	if err != nil {
-		http.Error(w, "Invalid version parameter", http.StatusBadRequest)
+		problem.Write(w, http.StatusBadRequest, "", "Invalid version parameter")
 		return
 	}
 
 	// Get history
 	history, err := r.cache.GetReplaceableEventHistory(kind, pubkey, dTag)
 	if err != nil {
-		http.Error(w, fmt.Sprintf("Failed to get event history: %v", err), http.StatusInternalServerError)
+		problem.Write(w, http.StatusInternalServerError, "", fmt.Sprintf("Failed to get event history: %v", err))
 		return
 	}
 
@@ -149,14 +151,14 @@ func (r *RESTAPIServer) HandleEventVersion(w http.ResponseWriter, req *http.Requ
 	}
 
 	if targetVersion == nil {
-		http.Error(w, "Version not found", http.StatusNotFound)
+		problem.Write(w, http.StatusNotFound, "", "Version not found")
 		return
 	}
 
 	// Get the actual event
 	_, ok := targetVersion["event_id"].(string)
 	if !ok {
-		http.Error(w, "Invalid event ID in version", http.StatusInternalServerError)
+		problem.Write(w, http.StatusInternalServerError, "", "Invalid event ID in version")
 		return
 	}
 
@@ -226,7 +228,7 @@ func (r *RESTAPIServer) HandleEventHistoryByID(w http.ResponseWriter, req *http.
 	// Get event from cache to determine kind, pubkey, and d-tag
 	// This would need to be implemented in the cache interface
 	// For now, return an error
-	http.Error(w, "Event history by ID not yet implemented", http.StatusNotImplemented)
+	problem.Write(w, http.StatusNotImplemented, "", "Event history by ID not yet implemented")
 }
 
 // HandleEventDiffByID handles requests for event diff by event IDs
@@ -239,5 +241,5 @@ func (r *RESTAPIServer) HandleEventDiffByID(w http.ResponseWriter, req *http.Req
 	// Get events from cache
 	// This would need to be implemented in the cache interface
 	// For now, return an error
-	http.Error(w, "Event diff by ID not yet implemented", http.StatusNotImplemented)
+	problem.Write(w, http.StatusNotImplemented, "", "Event diff by ID not yet implemented")
 }
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"mercury-relay/internal/idempotency"
+	"mercury-relay/internal/problem"
+)
+
+// maxIdempotencyKeyLength bounds client-chosen idempotency keys
+const maxIdempotencyKeyLength = 255
+
+// responseCapture records a response so it can be kept for retries
+type responseCapture struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (c *responseCapture) Header() http.Header {
+	return c.header
+}
+
+func (c *responseCapture) WriteHeader(status int) {
+	if c.status == 0 {
+		c.status = status
+	}
+}
+
+func (c *responseCapture) Write(data []byte) (int, error) {
+	c.WriteHeader(http.StatusOK)
+	return c.body.Write(data)
+}
+
+// publishOnce publishes at most once per idempotency key. The key is the
+// Idempotency-Key header scoped to the authenticated pubkey, or the event ID
+// when the client sends none. Replayed responses carry Idempotent-Replayed.
+func (r *RESTAPIServer) publishOnce(w http.ResponseWriter, req *http.Request, publishReq *PublishRequest) {
+	key := strings.TrimSpace(req.Header.Get("Idempotency-Key"))
+	switch {
+	case len(key) > maxIdempotencyKeyLength:
+		r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidRequest, fmt.Sprintf("Idempotency-Key is longer than %d characters", maxIdempotencyKeyLength))
+		return
+	case key != "":
+		key = "key:" + req.Header.Get("X-Nostr-Pubkey") + ":" + key
+	case publishReq.Event.ID != "":
+		key = "event:" + publishReq.Event.ID
+	default:
+		r.publish(w, req, publishReq)
+		return
+	}
+
+	var headers http.Header
+	result, replayed, err := r.idempotency.Do(key, publishReq.Event.ID, func() idempotency.Result {
+		capture := &responseCapture{header: make(http.Header)}
+		r.publish(capture, req, publishReq)
+		headers = capture.header
+		return idempotency.Result{
+			Status: capture.status,
+			Header: http.Header{"Content-Type": capture.header.Values("Content-Type")},
+			Body:   capture.body.Bytes(),
+		}
+	})
+	if errors.Is(err, idempotency.ErrMismatch) {
+		r.sendProblem(w, http.StatusUnprocessableEntity, problem.CodeConflict, "Idempotency-Key was already used for a different event")
+		return
+	}
+
+	// The publishing request gets every header it set, retries the stored ones
+	if !replayed {
+		for name, values := range headers {
+			w.Header()[name] = values
+		}
+	} else {
+		for name, values := range result.Header {
+			w.Header()[name] = values
+		}
+		w.Header().Set("Idempotent-Replayed", "true")
+	}
+	w.WriteHeader(result.Status)
+	w.Write(result.Body)
+}
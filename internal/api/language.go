@@ -0,0 +1,45 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"mercury-relay/internal/classify"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+)
+
+// SetLanguageDetection records the language of events published through the
+// REST API
+func (r *RESTAPIServer) SetLanguageDetection(cfg config.LanguageConfig) {
+	r.detectLanguage = cfg.Detect
+}
+
+// languageParam returns the languages asked for with ?lang=, which may be
+// repeated or comma-separated
+func languageParam(req *http.Request) []string {
+	var languages []string
+	for _, value := range req.URL.Query()["lang"] {
+		for _, lang := range strings.Split(value, ",") {
+			if lang = strings.TrimSpace(lang); lang != "" {
+				languages = append(languages, lang)
+			}
+		}
+	}
+	return languages
+}
+
+// filterLanguage keeps the events in one of languages, all of them when
+// none are given
+func filterLanguage(events []*models.Event, languages []string) []*models.Event {
+	if len(languages) == 0 {
+		return events
+	}
+	kept := events[:0:0]
+	for _, event := range events {
+		if classify.MatchesLanguage(classify.EventLanguage(event), languages) {
+			kept = append(kept, event)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,9 @@
+package api
+
+import "mercury-relay/internal/largeobj"
+
+// SetLargeObjects rejects published events over the maximum event size and
+// reports offloading in /api/v1/stats
+func (r *RESTAPIServer) SetLargeObjects(router *largeobj.Router) {
+	r.largeObjects = router
+}
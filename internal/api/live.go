@@ -0,0 +1,22 @@
+package api
+
+import (
+	"net/http"
+
+	"mercury-relay/internal/live"
+)
+
+// SetLive enables the live streams endpoint
+func (r *RESTAPIServer) SetLive(tracker *live.Tracker) {
+	r.live = tracker
+}
+
+// HandleLive lists the NIP-53 live activities streaming through the relay,
+// the most watched first
+func (r *RESTAPIServer) HandleLive(w http.ResponseWriter, req *http.Request) {
+	if r.live == nil {
+		r.sendError(w, "Live activities are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	r.sendSuccess(w, r.live.Live())
+}
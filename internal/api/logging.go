@@ -0,0 +1,57 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"mercury-relay/internal/logging"
+	"mercury-relay/internal/problem"
+)
+
+// requestLogMiddleware gives each request a logger tagged with its request
+// ID and logs the request at debug level once answered. It runs after
+// problem.Middleware, which assigns the ID.
+func requestLogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		logger := slog.With(logging.KeyRequestID, problem.RequestID(req))
+		start := time.Now()
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, req.WithContext(logging.WithLogger(req.Context(), logger)))
+		logger.Debug("REST request", "method", req.Method, "path", req.URL.Path,
+			"status", sw.statusCode(), "duration", time.Since(start), logging.KeyRemote, req.RemoteAddr)
+	})
+}
+
+// statusWriter remembers the status a handler answered with
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sw *statusWriter) WriteHeader(status int) {
+	if sw.status == 0 {
+		sw.status = status
+	}
+	sw.ResponseWriter.WriteHeader(status)
+}
+
+func (sw *statusWriter) Write(p []byte) (int, error) {
+	if sw.status == 0 {
+		sw.status = http.StatusOK
+	}
+	return sw.ResponseWriter.Write(p)
+}
+
+func (sw *statusWriter) Flush() {
+	if flusher, ok := sw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (sw *statusWriter) statusCode() int {
+	if sw.status == 0 {
+		return http.StatusOK
+	}
+	return sw.status
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"mercury-relay/internal/maintenance"
+	"mercury-relay/internal/problem"
+)
+
+// MaintenanceRequest pauses or resumes writes
+type MaintenanceRequest struct {
+	Enabled bool   `json:"enabled"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// SetMaintenance rejects publishes while writes are paused and enables the
+// admin maintenance endpoints
+func (r *RESTAPIServer) SetMaintenance(mode *maintenance.Mode) {
+	r.maintenance = mode
+}
+
+// HandleGetMaintenance shows whether writes are paused (admin only)
+func (r *RESTAPIServer) HandleGetMaintenance(w http.ResponseWriter, req *http.Request) {
+	if r.maintenance == nil {
+		r.sendError(w, "Maintenance mode is not available", http.StatusServiceUnavailable)
+		return
+	}
+	r.sendSuccess(w, r.maintenance.State())
+}
+
+// HandleSetMaintenance pauses or resumes writes (admin only). Reads keep
+// working either way.
+func (r *RESTAPIServer) HandleSetMaintenance(w http.ResponseWriter, req *http.Request) {
+	if r.maintenance == nil {
+		r.sendError(w, "Maintenance mode is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	var maintenanceReq MaintenanceRequest
+	if err := json.NewDecoder(req.Body).Decode(&maintenanceReq); err != nil {
+		r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidRequest, "Invalid JSON")
+		return
+	}
+
+	if maintenanceReq.Enabled {
+		r.maintenance.Enable(maintenanceReq.Reason)
+	} else {
+		r.maintenance.Disable()
+	}
+	r.sendSuccess(w, r.maintenance.State())
+}
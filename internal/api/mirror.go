@@ -0,0 +1,74 @@
+package api
+
+import (
+	"net/http"
+
+	"mercury-relay/internal/mirror"
+	"mercury-relay/internal/models"
+
+	"github.com/gorilla/mux"
+)
+
+// SetMirror marks published events of mirrored authors and enables the
+// admin mirror endpoints
+func (r *RESTAPIServer) SetMirror(m *mirror.Mirror) {
+	r.mirror = m
+}
+
+// markMirrored flags a published event of a mirrored author once its
+// signature checks out. Clients can't set the flag themselves.
+func (r *RESTAPIServer) markMirrored(event *models.Event) {
+	event.Mirrored = false
+	if r.mirror == nil || !r.mirror.IsMirrored(event.PubKey) {
+		return
+	}
+	if ok, err := event.ToNostrEvent().CheckSignature(); err != nil || !ok {
+		return
+	}
+	r.mirror.Mark(event)
+}
+
+// HandleGetMirror lists the mirrored authors with their completeness
+// reports (admin only)
+func (r *RESTAPIServer) HandleGetMirror(w http.ResponseWriter, req *http.Request) {
+	if r.mirror == nil {
+		r.sendError(w, "Mirroring is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	reports := []*mirror.Report{}
+	for _, author := range r.mirror.Authors() {
+		report, err := r.mirror.Report(req.Context(), author)
+		if err != nil {
+			r.sendError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		reports = append(reports, report)
+	}
+
+	r.sendSuccess(w, map[string]interface{}{
+		"authors": reports,
+	})
+}
+
+// HandleGetMirrorReport shows whether every event found for one mirrored
+// author is stored, and what each relay holds (admin only)
+func (r *RESTAPIServer) HandleGetMirrorReport(w http.ResponseWriter, req *http.Request) {
+	if r.mirror == nil {
+		r.sendError(w, "Mirroring is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	pubkey, err := mirror.ParsePubkey(mux.Vars(req)["pubkey"])
+	if err != nil || !r.mirror.IsMirrored(pubkey) {
+		r.sendError(w, "Author is not mirrored", http.StatusNotFound)
+		return
+	}
+
+	report, err := r.mirror.Report(req.Context(), pubkey)
+	if err != nil {
+		r.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	r.sendSuccess(w, report)
+}
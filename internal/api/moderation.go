@@ -0,0 +1,148 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/logging"
+	"mercury-relay/internal/mirror"
+	"mercury-relay/internal/problem"
+)
+
+// moderationLogSize is how many moderation actions are kept for
+// /admin/moderation/log
+const moderationLogSize = 500
+
+// ModerationAction is one block, unblock, release or purge done through
+// the admin API
+type ModerationAction struct {
+	At        time.Time `json:"at"`
+	Admin     string    `json:"admin"`
+	Action    string    `json:"action"`
+	Pubkey    string    `json:"pubkey"`
+	EventID   string    `json:"event_id,omitempty"`
+	Reason    string    `json:"reason,omitempty"`
+	RequestID string    `json:"request_id,omitempty"`
+}
+
+// moderationLog keeps the latest moderation actions, newest last
+type moderationLog struct {
+	actions []ModerationAction
+	mu      sync.Mutex
+}
+
+func (l *moderationLog) add(action ModerationAction) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.actions = append(l.actions, action)
+	if len(l.actions) > moderationLogSize {
+		l.actions = l.actions[len(l.actions)-moderationLogSize:]
+	}
+}
+
+// recent returns up to limit actions, newest first
+func (l *moderationLog) recent(limit int) []ModerationAction {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	recent := make([]ModerationAction, 0, min(limit, len(l.actions)))
+	for i := len(l.actions) - 1; i >= 0 && len(recent) < limit; i-- {
+		recent = append(recent, l.actions[i])
+	}
+	return recent
+}
+
+// BlockedPubkey is a blocked author and who blocked them
+type BlockedPubkey struct {
+	Pubkey  string   `json:"pubkey"`
+	Sources []string `json:"sources"`
+}
+
+type moderationRequest struct {
+	Npub   string `json:"npub"` // npub or hex pubkey
+	Reason string `json:"reason"`
+}
+
+// HandleBlockNpub blocks an author from publishing (admin only)
+func (r *RESTAPIServer) HandleBlockNpub(w http.ResponseWriter, req *http.Request) {
+	r.moderate(w, req, "block", func(pubkey string) error {
+		return r.qualityControl.BlockNpub(pubkey)
+	})
+}
+
+// HandleUnblockNpub lifts every block on an author (admin only)
+func (r *RESTAPIServer) HandleUnblockNpub(w http.ResponseWriter, req *http.Request) {
+	r.moderate(w, req, "unblock", func(pubkey string) error {
+		return r.qualityControl.UnblockNpub(pubkey)
+	})
+}
+
+func (r *RESTAPIServer) moderate(w http.ResponseWriter, req *http.Request, action string, apply func(pubkey string) error) {
+	if r.qualityControl == nil {
+		r.sendProblem(w, http.StatusServiceUnavailable, problem.CodeUnavailable, "Quality control is not enabled")
+		return
+	}
+	var request moderationRequest
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidRequest, "Invalid JSON")
+		return
+	}
+	pubkey, err := mirror.ParsePubkey(request.Npub)
+	if err != nil {
+		r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidRequest, err.Error())
+		return
+	}
+	if err := apply(pubkey); err != nil {
+		r.sendProblem(w, http.StatusInternalServerError, problem.CodeInternal, err.Error())
+		return
+	}
+
+	r.audit(req, ModerationAction{Action: action, Pubkey: pubkey, Reason: request.Reason})
+
+	r.sendSuccess(w, map[string]interface{}{
+		"pubkey":  pubkey,
+		"blocked": r.qualityControl.IsNpubBlocked(pubkey),
+		"sources": r.qualityControl.BlockSources(pubkey),
+	})
+}
+
+// audit records a moderation action by the requesting admin and logs it
+func (r *RESTAPIServer) audit(req *http.Request, record ModerationAction) {
+	record.At = time.Now()
+	record.Admin = r.auth.GetAuthenticatedNpub(req)
+	record.RequestID = problem.RequestID(req)
+	r.moderationLog.add(record)
+	logging.FromContext(req.Context()).Info("Moderation action", "audit", true, "admin", record.Admin,
+		"action", record.Action, "pubkey", record.Pubkey, "event_id", record.EventID, "reason", record.Reason)
+}
+
+// HandleGetBlocked lists blocked authors with the sources blocking them
+// (admin only)
+func (r *RESTAPIServer) HandleGetBlocked(w http.ResponseWriter, req *http.Request) {
+	if r.qualityControl == nil {
+		r.sendProblem(w, http.StatusServiceUnavailable, problem.CodeUnavailable, "Quality control is not enabled")
+		return
+	}
+	blocked := []BlockedPubkey{}
+	for _, pubkey := range r.qualityControl.GetBlockedNpubs() {
+		blocked = append(blocked, BlockedPubkey{Pubkey: pubkey, Sources: r.qualityControl.BlockSources(pubkey)})
+	}
+	r.sendSuccess(w, map[string]interface{}{"blocked": blocked, "count": len(blocked)})
+}
+
+// HandleGetModerationLog returns the latest moderation actions, newest
+// first; ?limit= caps how many (admin only)
+func (r *RESTAPIServer) HandleGetModerationLog(w http.ResponseWriter, req *http.Request) {
+	limit := moderationLogSize
+	if value := req.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n <= 0 {
+			r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidRequest, "limit must be a positive number")
+			return
+		}
+		limit = min(n, moderationLogSize)
+	}
+	r.sendSuccess(w, map[string]interface{}{"actions": r.moderationLog.recent(limit)})
+}
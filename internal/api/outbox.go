@@ -0,0 +1,34 @@
+package api
+
+import (
+	"net/http"
+
+	"mercury-relay/internal/outbox"
+	"mercury-relay/internal/problem"
+)
+
+// SetOutbox enables the admin endpoints reporting outbox delivery
+func (r *RESTAPIServer) SetOutbox(o *outbox.Outbox) {
+	r.outbox = o
+}
+
+// HandleGetOutbox returns the delivery state of every outbox relay (admin
+// only)
+func (r *RESTAPIServer) HandleGetOutbox(w http.ResponseWriter, req *http.Request) {
+	if r.outbox == nil {
+		r.sendProblem(w, http.StatusServiceUnavailable, problem.CodeUnavailable, "Outbox is not enabled")
+		return
+	}
+	r.sendSuccess(w, map[string]interface{}{"relays": r.outbox.Status()})
+}
+
+// HandleRetryOutbox ends the backoff of every outbox relay so pending
+// events are published right away (admin only)
+func (r *RESTAPIServer) HandleRetryOutbox(w http.ResponseWriter, req *http.Request) {
+	if r.outbox == nil {
+		r.sendProblem(w, http.StatusServiceUnavailable, problem.CodeUnavailable, "Outbox is not enabled")
+		return
+	}
+	r.outbox.Retry()
+	r.sendSuccess(w, map[string]interface{}{"relays": r.outbox.Status()})
+}
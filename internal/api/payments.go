@@ -0,0 +1,129 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+
+	"mercury-relay/internal/payments"
+
+	"github.com/gorilla/mux"
+)
+
+// InvoiceRequest asks for an invoice admitting a pubkey once paid
+type InvoiceRequest struct {
+	Pubkey string `json:"pubkey"` // npub or hex pubkey
+}
+
+// SetPayments enables buying write access with an invoice and the admin
+// endpoints for granting and revoking it
+func (r *RESTAPIServer) SetPayments(m *payments.Manager) {
+	r.payments = m
+}
+
+// HandleRequestInvoice returns an invoice that admits the pubkey in the
+// body as a writer once paid. Anyone may pay for any pubkey.
+func (r *RESTAPIServer) HandleRequestInvoice(w http.ResponseWriter, req *http.Request) {
+	if r.payments == nil {
+		r.sendError(w, "Paid access is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	var body InvoiceRequest
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		r.sendError(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	inv, err := r.payments.RequestInvoice(req.Context(), body.Pubkey)
+	if err != nil {
+		r.sendPaymentsError(w, err)
+		return
+	}
+	r.sendSuccess(w, inv)
+}
+
+// HandleGetInvoice reports whether an invoice was paid, and the admission
+// it bought once it was
+func (r *RESTAPIServer) HandleGetInvoice(w http.ResponseWriter, req *http.Request) {
+	if r.payments == nil {
+		r.sendError(w, "Paid access is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	status, err := r.payments.CheckInvoice(req.Context(), mux.Vars(req)["id"])
+	if err != nil {
+		r.sendPaymentsError(w, err)
+		return
+	}
+	r.sendSuccess(w, status)
+}
+
+// HandleGetPayments lists the pubkeys admitted by payment, zaps or an admin,
+// with payment stats (admin only)
+func (r *RESTAPIServer) HandleGetPayments(w http.ResponseWriter, req *http.Request) {
+	if r.payments == nil {
+		r.sendError(w, "Paid access is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	r.sendSuccess(w, map[string]interface{}{
+		"admissions": r.payments.Admissions(),
+		"stats":      r.payments.Stats(),
+	})
+}
+
+// HandleGrantPaidAccess admits a pubkey without payment (admin only)
+func (r *RESTAPIServer) HandleGrantPaidAccess(w http.ResponseWriter, req *http.Request) {
+	if r.payments == nil {
+		r.sendError(w, "Paid access is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	admin := r.auth.GetAuthenticatedNpub(req)
+	a, err := r.payments.Grant(mux.Vars(req)["pubkey"], admin)
+	if err != nil {
+		r.sendPaymentsError(w, err)
+		return
+	}
+
+	log.Printf("%s granted %s paid write access", admin, a.Pubkey)
+	r.sendSuccess(w, a)
+}
+
+// HandleRevokePaidAccess takes a pubkey's admission away (admin only)
+func (r *RESTAPIServer) HandleRevokePaidAccess(w http.ResponseWriter, req *http.Request) {
+	if r.payments == nil {
+		r.sendError(w, "Paid access is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	pubkey := mux.Vars(req)["pubkey"]
+	if err := r.payments.Revoke(pubkey); err != nil {
+		r.sendPaymentsError(w, err)
+		return
+	}
+
+	log.Printf("%s revoked paid write access of %s", r.auth.GetAuthenticatedNpub(req), pubkey)
+	r.sendSuccess(w, map[string]interface{}{
+		"pubkey":  pubkey,
+		"revoked": true,
+	})
+}
+
+func (r *RESTAPIServer) sendPaymentsError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, payments.ErrInvalidPubkey):
+		r.sendError(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, payments.ErrNotFound), errors.Is(err, payments.ErrUnknownInvoice):
+		r.sendError(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, payments.ErrAlreadyAdmitted):
+		r.sendError(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, payments.ErrTooManyInvoices):
+		r.sendError(w, err.Error(), http.StatusTooManyRequests)
+	case errors.Is(err, payments.ErrNoBackend):
+		r.sendError(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		r.sendError(w, err.Error(), http.StatusBadGateway)
+	}
+}
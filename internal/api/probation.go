@@ -0,0 +1,65 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"mercury-relay/internal/mirror"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/probation"
+	"mercury-relay/internal/problem"
+
+	"github.com/gorilla/mux"
+)
+
+// SetProbation holds back events published by pubkeys the relay first saw
+// recently and enables the admin endpoints for reviewing them
+func (r *RESTAPIServer) SetProbation(tracker *probation.Tracker) {
+	r.probation = tracker
+}
+
+// screenProbation applies the author's probation to event. Known writers
+// and mirrored authors are exempt.
+func (r *RESTAPIServer) screenProbation(event *models.Event) (string, bool) {
+	if r.probation == nil || event.Mirrored || (r.accessControl != nil && r.accessControl.IsKnownWriter(event.PubKey)) {
+		return "", true
+	}
+	return r.probation.Screen(event)
+}
+
+// HandleGetProbation lists the pubkeys on probation, newest first, with the
+// limits currently applied to them (admin only)
+func (r *RESTAPIServer) HandleGetProbation(w http.ResponseWriter, req *http.Request) {
+	if r.probation == nil {
+		r.sendProblem(w, http.StatusServiceUnavailable, problem.CodeUnavailable, "Pubkey probation is not enabled")
+		return
+	}
+	pubkeys := r.probation.OnProbation()
+	r.sendSuccess(w, map[string]interface{}{
+		"pubkeys": pubkeys,
+		"count":   len(pubkeys),
+	})
+}
+
+// HandleReleaseProbation ends a pubkey's probation early (admin only)
+func (r *RESTAPIServer) HandleReleaseProbation(w http.ResponseWriter, req *http.Request) {
+	if r.probation == nil {
+		r.sendProblem(w, http.StatusServiceUnavailable, problem.CodeUnavailable, "Pubkey probation is not enabled")
+		return
+	}
+	pubkey, err := mirror.ParsePubkey(mux.Vars(req)["pubkey"])
+	if err != nil {
+		r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidRequest, err.Error())
+		return
+	}
+	if err := r.probation.Release(pubkey); err != nil {
+		if errors.Is(err, probation.ErrNotFound) {
+			r.sendProblem(w, http.StatusNotFound, problem.CodeNotFound, err.Error())
+			return
+		}
+		r.sendProblem(w, http.StatusInternalServerError, problem.CodeInternal, err.Error())
+		return
+	}
+	status, _ := r.probation.Status(pubkey)
+	r.sendSuccess(w, status)
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"net/http/pprof"
+	runtimepprof "runtime/pprof"
+
+	"mercury-relay/internal/problem"
+	"mercury-relay/internal/profiling"
+
+	"github.com/gorilla/mux"
+)
+
+// SetProfiler serves runtime summaries and, when enabled, pprof profiles to
+// admins
+func (r *RESTAPIServer) SetProfiler(p *profiling.Sampler) {
+	r.profiler = p
+}
+
+// HandleRuntimeStats returns the latest runtime sample: goroutines, memory,
+// top allocation sites and lock contention
+func (r *RESTAPIServer) HandleRuntimeStats(w http.ResponseWriter, req *http.Request) {
+	if r.profiler == nil {
+		r.sendError(w, "Runtime profiling is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	r.sendSuccess(w, r.profiler.Summary())
+}
+
+// HandlePprof serves the standard pprof endpoints under
+// /api/v1/debug/pprof/
+func (r *RESTAPIServer) HandlePprof(w http.ResponseWriter, req *http.Request) {
+	if r.profiler == nil || !r.profiler.PprofEnabled() {
+		r.sendProblem(w, http.StatusNotFound, problem.CodeNotFound, "pprof is not enabled")
+		return
+	}
+
+	switch name := mux.Vars(req)["profile"]; name {
+	case "":
+		pprof.Index(w, req)
+	case "cmdline":
+		pprof.Cmdline(w, req)
+	case "profile":
+		pprof.Profile(w, req)
+	case "symbol":
+		pprof.Symbol(w, req)
+	case "trace":
+		pprof.Trace(w, req)
+	default:
+		if runtimepprof.Lookup(name) == nil {
+			r.sendProblem(w, http.StatusNotFound, problem.CodeNotFound, "Unknown profile "+name)
+			return
+		}
+		pprof.Handler(name).ServeHTTP(w, req)
+	}
+}
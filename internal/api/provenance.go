@@ -0,0 +1,44 @@
+package api
+
+import (
+	"net/http"
+
+	"mercury-relay/internal/cache"
+
+	"github.com/gorilla/mux"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// HandleEventProvenance shows how a cached event reached the relay: local
+// WebSocket or REST publishes, upstream relays and replay jobs, with the time
+// of each sighting (admin only)
+func (r *RESTAPIServer) HandleEventProvenance(w http.ResponseWriter, req *http.Request) {
+	eventID := mux.Vars(req)["id"]
+	if !nostr.IsValid32ByteHex(eventID) {
+		r.sendError(w, "Invalid event ID", http.StatusBadRequest)
+		return
+	}
+
+	events, err := cache.Collect(r.cache.GetEvents(req.Context(), nostr.Filter{IDs: []string{eventID}}))
+	if err != nil {
+		r.sendError(w, "Failed to load event", http.StatusInternalServerError)
+		return
+	}
+	if len(events) == 0 {
+		r.sendError(w, "Event not found", http.StatusNotFound)
+		return
+	}
+	event := events[0]
+
+	response := map[string]interface{}{
+		"event_id":   event.ID,
+		"kind":       event.Kind,
+		"pubkey":     event.PubKey,
+		"created_at": event.CreatedAt,
+		"provenance": event.Provenance,
+	}
+	if len(event.Provenance) > 0 {
+		response["first_seen"] = event.Provenance[0].At
+	}
+	r.sendSuccess(w, response)
+}
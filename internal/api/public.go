@@ -0,0 +1,339 @@
+package api
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/classify"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/mirror"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/problem"
+	"mercury-relay/pkg/ebooks"
+
+	"github.com/gorilla/mux"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// publicRenderTimeout bounds one render of a public view
+const publicRenderTimeout = 30 * time.Second
+
+// publicView is one pre-rendered public response
+type publicView struct {
+	render        func(ctx context.Context) (interface{}, error)
+	body          []byte
+	etag          string
+	renderedAt    time.Time
+	lastRequested time.Time
+	refreshing    bool
+}
+
+// publicMirror keeps the pre-rendered responses of the public endpoints.
+// Views are rendered on first request and re-rendered in the background;
+// a failed render keeps serving the previous body.
+type publicMirror struct {
+	config config.PublicMirrorConfig
+	views  map[string]*publicView
+	mu     sync.Mutex
+}
+
+func newPublicMirror(cfg config.PublicMirrorConfig) *publicMirror {
+	return &publicMirror{
+		config: cfg,
+		views:  make(map[string]*publicView),
+	}
+}
+
+// serve writes the view for key, rendering it first if it is new
+func (m *publicMirror) serve(w http.ResponseWriter, req *http.Request, key string, render func(ctx context.Context) (interface{}, error)) {
+	now := time.Now()
+
+	m.mu.Lock()
+	view, ok := m.views[key]
+	if !ok {
+		m.evictLocked(now)
+		view = &publicView{render: render}
+		m.views[key] = view
+	}
+	view.lastRequested = now
+	body, etag, renderedAt := view.body, view.etag, view.renderedAt
+	stale := body != nil && now.Sub(renderedAt) >= m.config.RefreshInterval && !view.refreshing
+	if stale {
+		view.refreshing = true
+	}
+	m.mu.Unlock()
+
+	if body == nil {
+		ctx, cancel := context.WithTimeout(req.Context(), publicRenderTimeout)
+		err := m.refresh(ctx, key, view)
+		cancel()
+		if err != nil {
+			log.Printf("Public mirror render of %s failed: %v", key, err)
+			w.Header().Set("Retry-After", "30")
+			problem.Write(w, http.StatusServiceUnavailable, problem.CodeUnavailable, "Catalog is not available yet")
+			return
+		}
+		m.mu.Lock()
+		body, etag, renderedAt = view.body, view.etag, view.renderedAt
+		m.mu.Unlock()
+	}
+	if stale {
+		go func() {
+			ctx, cancel := context.WithTimeout(context.Background(), publicRenderTimeout)
+			defer cancel()
+			if err := m.refresh(ctx, key, view); err != nil {
+				log.Printf("Public mirror refresh of %s failed, serving stale copy: %v", key, err)
+			}
+		}()
+	}
+
+	maxAge := int(m.config.MaxAge.Seconds())
+	stalePeriod := int(m.config.StaleTTL.Seconds())
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, stale-while-revalidate=%d, stale-if-error=%d", maxAge, stalePeriod, stalePeriod))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", renderedAt.UTC().Format(http.TimeFormat))
+	w.Header().Set("Age", strconv.Itoa(int(now.Sub(renderedAt).Seconds())))
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	if match := req.Header.Get("If-None-Match"); match != "" && match == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// refresh renders view again, keeping the previous body on failure
+func (m *publicMirror) refresh(ctx context.Context, key string, view *publicView) error {
+	defer func() {
+		m.mu.Lock()
+		view.refreshing = false
+		m.mu.Unlock()
+	}()
+
+	data, err := view.render(ctx)
+	if err == nil {
+		var body []byte
+		body, err = json.Marshal(data)
+		if err == nil {
+			sum := sha256.Sum256(body)
+			m.mu.Lock()
+			view.body = body
+			view.etag = `"` + hex.EncodeToString(sum[:8]) + `"`
+			view.renderedAt = time.Now()
+			m.mu.Unlock()
+		}
+	}
+	return err
+}
+
+// evictLocked drops views nobody requested within the stale TTL, then the
+// least recently requested if still full. Callers must hold mu.
+func (m *publicMirror) evictLocked(now time.Time) {
+	for key, view := range m.views {
+		if now.Sub(view.lastRequested) > m.config.StaleTTL {
+			delete(m.views, key)
+		}
+	}
+	if m.config.MaxViews <= 0 || len(m.views) < m.config.MaxViews {
+		return
+	}
+	var oldest string
+	for key, view := range m.views {
+		if oldest == "" || view.lastRequested.Before(m.views[oldest].lastRequested) {
+			oldest = key
+		}
+	}
+	delete(m.views, oldest)
+}
+
+// run re-renders every view each refresh interval until ctx is done
+func (m *publicMirror) run(ctx context.Context) {
+	ticker := time.NewTicker(m.config.RefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.mu.Lock()
+			m.evictLocked(now)
+			due := make(map[string]*publicView)
+			for key, view := range m.views {
+				if !view.refreshing {
+					view.refreshing = true
+					due[key] = view
+				}
+			}
+			m.mu.Unlock()
+
+			for key, view := range due {
+				renderCtx, cancel := context.WithTimeout(ctx, publicRenderTimeout)
+				if err := m.refresh(renderCtx, key, view); err != nil {
+					log.Printf("Public mirror refresh of %s failed, serving stale copy: %v", key, err)
+				}
+				cancel()
+			}
+		}
+	}
+}
+
+// publicAuthor reads the optional author parameter as hex or npub
+func publicAuthor(req *http.Request) (string, error) {
+	author := req.URL.Query().Get("author")
+	if author == "" {
+		return "", nil
+	}
+	return mirror.ParsePubkey(author)
+}
+
+// publicEvents returns the unquarantined events matching filter, newest
+// first
+func (r *RESTAPIServer) publicEvents(ctx context.Context, filter nostr.Filter) ([]*models.Event, error) {
+	if filter.Limit <= 0 || filter.Limit > r.config.PublicMirror.Limit {
+		filter.Limit = r.config.PublicMirror.Limit
+	}
+	events, err := cache.Collect(r.cache.GetEvents(ctx, filter))
+	if err != nil {
+		return nil, err
+	}
+
+	visible := events[:0]
+	for _, event := range events {
+		if !event.IsQuarantined {
+			visible = append(visible, event)
+		}
+	}
+	sort.SliceStable(visible, func(i, j int) bool { return visible[i].CreatedAt > visible[j].CreatedAt })
+	return visible, nil
+}
+
+// HandlePublicEbooks serves the book catalog without authentication
+func (r *RESTAPIServer) HandlePublicEbooks(w http.ResponseWriter, req *http.Request) {
+	author, err := publicAuthor(req)
+	if err != nil {
+		r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	languages := languageParam(req)
+	key := "ebooks:" + author + ":" + strings.ToLower(strings.Join(languages, ","))
+	r.public.serve(w, req, key, func(ctx context.Context) (interface{}, error) {
+		filter := nostr.Filter{Kinds: []int{30040}}
+		if author != "" {
+			filter.Authors = []string{author}
+		}
+		events, err := r.publicEvents(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		list := []ebooks.Ebook{}
+		for _, event := range filterLanguage(events, languages) {
+			if ebook := r.ebookSummary(ctx, event, ""); ebook != nil {
+				list = append(list, *ebook)
+			}
+		}
+		return map[string]interface{}{
+			"count":        len(list),
+			"ebooks":       list,
+			"generated_at": time.Now().Unix(),
+		}, nil
+	})
+}
+
+// HandlePublicArticles serves long-form articles (kind 30023) without
+// authentication
+func (r *RESTAPIServer) HandlePublicArticles(w http.ResponseWriter, req *http.Request) {
+	author, err := publicAuthor(req)
+	if err != nil {
+		r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	languages := languageParam(req)
+	key := "articles:" + author + ":" + strings.ToLower(strings.Join(languages, ","))
+	r.public.serve(w, req, key, func(ctx context.Context) (interface{}, error) {
+		filter := nostr.Filter{Kinds: []int{30023}}
+		if author != "" {
+			filter.Authors = []string{author}
+		}
+		events, err := r.publicEvents(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		articles := []map[string]interface{}{}
+		for _, event := range filterLanguage(events, languages) {
+			article := map[string]interface{}{
+				"id":         event.ID,
+				"author":     event.PubKey,
+				"identifier": event.Tags.GetD(),
+				"created_at": int64(event.CreatedAt),
+				"content":    event.Content,
+				"language":   classify.EventLanguage(event),
+			}
+			for _, name := range []string{"title", "summary", "image", "published_at"} {
+				if tag := event.Tags.Find(name); tag != nil {
+					article[name] = tag[1]
+				}
+			}
+			articles = append(articles, article)
+		}
+		return map[string]interface{}{
+			"count":        len(articles),
+			"articles":     articles,
+			"generated_at": time.Now().Unix(),
+		}, nil
+	})
+}
+
+// HandlePublicEvents serves the events of a safelisted filter without
+// authentication
+func (r *RESTAPIServer) HandlePublicEvents(w http.ResponseWriter, req *http.Request) {
+	name := mux.Vars(req)["filter"]
+	safelisted, ok := r.config.PublicMirror.Filters[name]
+	if !ok {
+		r.sendProblem(w, http.StatusNotFound, problem.CodeNotFound, fmt.Sprintf("No public filter named %q", name))
+		return
+	}
+
+	r.public.serve(w, req, "events:"+name, func(ctx context.Context) (interface{}, error) {
+		filter := nostr.Filter{
+			Kinds:   safelisted.Kinds,
+			Authors: safelisted.Authors,
+			Limit:   safelisted.Limit,
+		}
+		if len(safelisted.Tags) > 0 {
+			filter.Tags = nostr.TagMap(safelisted.Tags)
+		}
+		events, err := r.publicEvents(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+
+		signed := make([]*nostr.Event, 0, len(events))
+		for _, event := range events {
+			signed = append(signed, event.ToNostrEvent())
+		}
+		return map[string]interface{}{
+			"filter":       name,
+			"count":        len(signed),
+			"events":       signed,
+			"generated_at": time.Now().Unix(),
+		}, nil
+	})
+}
@@ -0,0 +1,124 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"mercury-relay/internal/mirror"
+	"mercury-relay/internal/problem"
+	"mercury-relay/internal/push"
+
+	"github.com/gorilla/mux"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// SetPush enables the /subscriptions endpoints for stored push
+// subscriptions
+func (r *RESTAPIServer) SetPush(manager *push.Manager) {
+	r.push = manager
+}
+
+// subscriptionOwner returns the hex pubkey of the authenticated user, or
+// writes an error and returns false
+func (r *RESTAPIServer) subscriptionOwner(w http.ResponseWriter, req *http.Request) (string, bool) {
+	if r.push == nil {
+		r.sendProblem(w, http.StatusServiceUnavailable, problem.CodeUnavailable, "Push subscriptions are not enabled")
+		return "", false
+	}
+	owner, err := mirror.ParsePubkey(r.auth.GetAuthenticatedNpub(req))
+	if err != nil {
+		r.sendProblem(w, http.StatusUnauthorized, problem.CodeUnauthorized, "Push subscriptions require a pubkey")
+		return "", false
+	}
+	return owner, true
+}
+
+// HandleGetSubscriptions lists the user's push subscriptions without their
+// target credentials
+func (r *RESTAPIServer) HandleGetSubscriptions(w http.ResponseWriter, req *http.Request) {
+	owner, ok := r.subscriptionOwner(w, req)
+	if !ok {
+		return
+	}
+	subs := r.push.List(owner)
+	for i := range subs {
+		subs[i] = subs[i].Redacted()
+	}
+	r.sendSuccess(w, map[string]interface{}{
+		"subscriptions": subs,
+		"count":         len(subs),
+	})
+}
+
+// HandleCreateSubscription stores a filter and delivery target. The
+// response is the only time a webhook's signing secret is shown.
+func (r *RESTAPIServer) HandleCreateSubscription(w http.ResponseWriter, req *http.Request) {
+	owner, ok := r.subscriptionOwner(w, req)
+	if !ok {
+		return
+	}
+	var body struct {
+		Name   string       `json:"name"`
+		Filter nostr.Filter `json:"filter"`
+		Target push.Target  `json:"target"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidRequest, "Invalid JSON")
+		return
+	}
+
+	sub, err := r.push.Create(owner, body.Name, body.Filter, body.Target)
+	switch {
+	case errors.Is(err, push.ErrLimit):
+		r.sendProblem(w, http.StatusConflict, problem.CodeQuotaExceeded, err.Error())
+		return
+	case err != nil:
+		r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidRequest, err.Error())
+		return
+	}
+	r.sendSuccess(w, sub)
+}
+
+// HandleGetSubscription returns one of the user's subscriptions with its
+// delivery state
+func (r *RESTAPIServer) HandleGetSubscription(w http.ResponseWriter, req *http.Request) {
+	owner, ok := r.subscriptionOwner(w, req)
+	if !ok {
+		return
+	}
+	sub, err := r.push.Get(owner, mux.Vars(req)["id"])
+	if err != nil {
+		r.sendProblem(w, http.StatusNotFound, problem.CodeNotFound, err.Error())
+		return
+	}
+	r.sendSuccess(w, sub.Redacted())
+}
+
+// HandleDeleteSubscription removes one of the user's subscriptions
+func (r *RESTAPIServer) HandleDeleteSubscription(w http.ResponseWriter, req *http.Request) {
+	owner, ok := r.subscriptionOwner(w, req)
+	if !ok {
+		return
+	}
+	id := mux.Vars(req)["id"]
+	if err := r.push.Delete(owner, id); err != nil {
+		if errors.Is(err, push.ErrNotFound) {
+			r.sendProblem(w, http.StatusNotFound, problem.CodeNotFound, err.Error())
+			return
+		}
+		r.sendProblem(w, http.StatusInternalServerError, problem.CodeInternal, err.Error())
+		return
+	}
+	r.sendSuccess(w, map[string]interface{}{"deleted": id})
+}
+
+// HandleGetVAPIDKey returns the application server key browsers pass to
+// pushManager.subscribe
+func (r *RESTAPIServer) HandleGetVAPIDKey(w http.ResponseWriter, req *http.Request) {
+	if r.push == nil {
+		r.sendProblem(w, http.StatusServiceUnavailable, problem.CodeUnavailable, "Push subscriptions are not enabled")
+		return
+	}
+	r.sendSuccess(w, map[string]interface{}{"public_key": r.push.VAPIDPublicKey()})
+}
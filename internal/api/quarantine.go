@@ -0,0 +1,115 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"mercury-relay/internal/mirror"
+	"mercury-relay/internal/problem"
+	"mercury-relay/internal/quarantine"
+
+	"github.com/gorilla/mux"
+)
+
+// SetQuarantine enables the admin endpoints for reviewing held events
+func (r *RESTAPIServer) SetQuarantine(q *quarantine.Queue) {
+	r.quarantine = q
+}
+
+// HandleGetQuarantine lists the held events, oldest first, with the reason
+// and quality score of each; ?author= narrows to one author (admin only)
+func (r *RESTAPIServer) HandleGetQuarantine(w http.ResponseWriter, req *http.Request) {
+	if r.quarantine == nil {
+		r.sendProblem(w, http.StatusServiceUnavailable, problem.CodeUnavailable, "Quarantine review is not enabled")
+		return
+	}
+	author := req.URL.Query().Get("author")
+	if author != "" {
+		pubkey, err := mirror.ParsePubkey(author)
+		if err != nil {
+			r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidRequest, err.Error())
+			return
+		}
+		author = pubkey
+	}
+	entries := r.quarantine.List(author)
+	r.sendSuccess(w, map[string]interface{}{
+		"events": entries,
+		"count":  len(entries),
+	})
+}
+
+// HandleReleaseQuarantined lets a held event continue to storage and
+// subscribers (admin only)
+func (r *RESTAPIServer) HandleReleaseQuarantined(w http.ResponseWriter, req *http.Request) {
+	r.reviewQuarantined(w, req, "release", r.quarantine.Release)
+}
+
+// HandlePurgeQuarantined deletes a held event for good (admin only)
+func (r *RESTAPIServer) HandlePurgeQuarantined(w http.ResponseWriter, req *http.Request) {
+	r.reviewQuarantined(w, req, "purge", r.quarantine.Purge)
+}
+
+func (r *RESTAPIServer) reviewQuarantined(w http.ResponseWriter, req *http.Request, action string, review func(id string) (quarantine.Entry, error)) {
+	if r.quarantine == nil {
+		r.sendProblem(w, http.StatusServiceUnavailable, problem.CodeUnavailable, "Quarantine review is not enabled")
+		return
+	}
+	entry, err := review(mux.Vars(req)["id"])
+	if err != nil {
+		if errors.Is(err, quarantine.ErrNotFound) {
+			r.sendProblem(w, http.StatusNotFound, problem.CodeNotFound, err.Error())
+			return
+		}
+		r.sendProblem(w, http.StatusInternalServerError, problem.CodeInternal, err.Error())
+		return
+	}
+	r.audit(req, ModerationAction{Action: action, Pubkey: entry.Event.PubKey, EventID: entry.Event.ID, Reason: entry.Reason})
+	r.sendSuccess(w, entry)
+}
+
+// HandleReleaseQuarantineAuthor releases every held event by an author
+// (admin only)
+func (r *RESTAPIServer) HandleReleaseQuarantineAuthor(w http.ResponseWriter, req *http.Request) {
+	r.reviewQuarantineAuthor(w, req, "release", r.quarantine.ReleaseAuthor)
+}
+
+// HandlePurgeQuarantineAuthor deletes every held event by an author (admin
+// only)
+func (r *RESTAPIServer) HandlePurgeQuarantineAuthor(w http.ResponseWriter, req *http.Request) {
+	r.reviewQuarantineAuthor(w, req, "purge", r.quarantine.PurgeAuthor)
+}
+
+func (r *RESTAPIServer) reviewQuarantineAuthor(w http.ResponseWriter, req *http.Request, action string, review func(author string) []quarantine.Entry) {
+	if r.quarantine == nil {
+		r.sendProblem(w, http.StatusServiceUnavailable, problem.CodeUnavailable, "Quarantine review is not enabled")
+		return
+	}
+	var request struct {
+		Author string `json:"author"` // npub or hex pubkey
+	}
+	if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+		r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidRequest, "Invalid JSON")
+		return
+	}
+	author, err := mirror.ParsePubkey(request.Author)
+	if err != nil {
+		r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidRequest, err.Error())
+		return
+	}
+
+	entries := review(author)
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.Event.ID
+	}
+	if len(entries) > 0 {
+		r.audit(req, ModerationAction{Action: action, Pubkey: author})
+	}
+	r.sendSuccess(w, map[string]interface{}{
+		"author": author,
+		"events": ids,
+		"count":  len(ids),
+	})
+}
@@ -0,0 +1,147 @@
+package api
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/problem"
+)
+
+const (
+	rateLimitWindow = time.Minute
+
+	// maxRateLimitClients triggers a sweep of idle clients
+	maxRateLimitClients = 10000
+)
+
+// RateLimitStatus is a client's budget in the current window
+type RateLimitStatus struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+}
+
+// setRateLimitHeaders writes X-RateLimit-Limit, X-RateLimit-Remaining and
+// X-RateLimit-Reset (unix seconds). Exhausted budgets also get Retry-After.
+func setRateLimitHeaders(w http.ResponseWriter, status RateLimitStatus) {
+	w.Header().Set("X-RateLimit-Limit", strconv.Itoa(status.Limit))
+	w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(status.Remaining))
+	w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(status.Reset.Unix(), 10))
+	if status.Remaining == 0 {
+		retry := int(time.Until(status.Reset).Round(time.Second).Seconds())
+		if retry < 1 {
+			retry = 1
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(retry))
+	}
+}
+
+// clientLimiter counts requests per client in a sliding one-minute window
+type clientLimiter struct {
+	limit int
+	hits  map[string][]time.Time
+	mu    sync.Mutex
+}
+
+func newClientLimiter(limit int) *clientLimiter {
+	return &clientLimiter{
+		limit: limit,
+		hits:  make(map[string][]time.Time),
+	}
+}
+
+// take counts a request from client if it is within budget and returns the
+// budget left afterwards
+func (l *clientLimiter) take(client string, now time.Time) (RateLimitStatus, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if len(l.hits) >= maxRateLimitClients {
+		l.sweep(now)
+	}
+
+	cutoff := now.Add(-rateLimitWindow)
+	var hits []time.Time
+	for _, t := range l.hits[client] {
+		if t.After(cutoff) {
+			hits = append(hits, t)
+		}
+	}
+
+	allowed := len(hits) < l.limit
+	if allowed {
+		hits = append(hits, now)
+	}
+	l.hits[client] = hits
+
+	reset := now.Add(rateLimitWindow)
+	if len(hits) > 0 {
+		reset = hits[0].Add(rateLimitWindow)
+	}
+	return RateLimitStatus{
+		Limit:     l.limit,
+		Remaining: l.limit - len(hits),
+		Reset:     reset,
+	}, allowed
+}
+
+// sweep drops clients with no requests in the window. Callers must hold mu.
+func (l *clientLimiter) sweep(now time.Time) {
+	cutoff := now.Add(-rateLimitWindow)
+	for client, hits := range l.hits {
+		if len(hits) == 0 || !hits[len(hits)-1].After(cutoff) {
+			delete(l.hits, client)
+		}
+	}
+}
+
+// rateLimitClient identifies the caller by authenticated npub, falling back
+// to the remote IP
+func (r *RESTAPIServer) rateLimitClient(req *http.Request) string {
+	if npub := req.Header.Get("X-Nostr-Pubkey"); npub != "" {
+		return npub
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// publishRateLimit reports pubkey's publish budget from the quality
+// controller's rate limiter, which counts every validated event
+func (r *RESTAPIServer) publishRateLimit(pubkey string) (RateLimitStatus, bool) {
+	if r.qualityControl == nil {
+		return RateLimitStatus{}, false
+	}
+
+	used, limit, reset := r.qualityControl.RateLimitWindow(pubkey)
+	remaining := limit - used
+	if remaining < 0 {
+		remaining = 0
+	}
+	return RateLimitStatus{Limit: limit, Remaining: remaining, Reset: reset}, true
+}
+
+// isQueryPath reports whether path is one of the query endpoints the client
+// limiter applies to
+func (r *RESTAPIServer) isQueryPath(path string) bool {
+	events, query := r.config.Endpoints.Events, r.config.Endpoints.Query
+	if events == "" {
+		events = "/api/v1/events"
+	}
+	if query == "" {
+		query = "/api/v1/query"
+	}
+	return path == events || path == query || path == "/api/v1/sync"
+}
+
+// writeRateLimited rejects a request that exceeded its budget
+func writeRateLimited(w http.ResponseWriter, status RateLimitStatus) {
+	setRateLimitHeaders(w, status)
+	problem.Write(w, http.StatusTooManyRequests, problem.CodeQuotaExceeded,
+		"Rate limit of "+strconv.Itoa(status.Limit)+" requests per minute exceeded")
+}
@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/problem"
+	"mercury-relay/internal/rejection"
+)
+
+// maxRejectionsLimit caps how many rejections one request returns
+const maxRejectionsLimit = 1000
+
+// SetRejectionLog records events refused by the REST API and serves the
+// buffered rejections to admins
+func (r *RESTAPIServer) SetRejectionLog(l *rejection.Log) {
+	r.rejections = l
+}
+
+// reject records that a published event was refused with message
+func (r *RESTAPIServer) reject(req *http.Request, event *models.Event, message string) {
+	r.rejections.Record(rejection.Rejection{
+		Message: message,
+		EventID: event.ID,
+		Kind:    event.Kind,
+		PubKey:  event.PubKey,
+		Source:  rejection.SourceREST,
+		Remote:  req.RemoteAddr,
+	})
+}
+
+// HandleGetRejections lists recently refused events, newest first, with
+// counts since startup. Filters: reason, kind, pubkey, source and limit.
+func (r *RESTAPIServer) HandleGetRejections(w http.ResponseWriter, req *http.Request) {
+	if r.rejections == nil {
+		r.sendProblem(w, http.StatusServiceUnavailable, problem.CodeUnavailable, "Rejection logging is not enabled")
+		return
+	}
+
+	params := req.URL.Query()
+	query := rejection.Query{
+		Reason: params.Get("reason"),
+		PubKey: params.Get("pubkey"),
+		Source: params.Get("source"),
+		Limit:  100,
+	}
+	if kind := params.Get("kind"); kind != "" {
+		k, err := strconv.Atoi(kind)
+		if err != nil {
+			r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidRequest, "Invalid kind")
+			return
+		}
+		query.Kind = &k
+	}
+	if limit := params.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l <= 0 {
+			r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidRequest, "Invalid limit")
+			return
+		}
+		query.Limit = min(l, maxRejectionsLimit)
+	}
+
+	rejections := r.rejections.Recent(query)
+	r.sendSuccess(w, map[string]interface{}{
+		"rejections": rejections,
+		"count":      len(rejections),
+		"stats":      r.rejections.Stats(),
+	})
+}
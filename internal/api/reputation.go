@@ -0,0 +1,86 @@
+package api
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"mercury-relay/internal/problem"
+	"mercury-relay/internal/reputation"
+)
+
+// defaultReputationLimit is the per-minute budget divided for rate_limit
+// matches when the REST API has no rate limit of its own
+const defaultReputationLimit = 60
+
+// reputationExemptPaths stay open to require_auth matches so they can
+// authenticate
+var reputationExemptPaths = map[string]bool{
+	"/api/v1/health":          true,
+	"/api/v1/nostr/challenge": true,
+	"/api/v1/nostr/auth":      true,
+}
+
+// reputationGate applies IP reputation verdicts to REST requests
+type reputationGate struct {
+	checker *reputation.Checker
+	limiter *clientLimiter
+}
+
+// SetReputation screens every REST request against the IP reputation lists
+func (r *RESTAPIServer) SetReputation(checker *reputation.Checker) {
+	limit := r.config.RateLimitPerMinute
+	if limit <= 0 {
+		limit = defaultReputationLimit
+	}
+	limit /= checker.RateLimitDivisor()
+	if limit < 1 {
+		limit = 1
+	}
+	r.reputation = &reputationGate{
+		checker: checker,
+		limiter: newClientLimiter(limit),
+	}
+}
+
+// reputationMiddleware refuses denied IPs, demands authentication from
+// require_auth matches and gives rate_limit matches a reduced budget across
+// every endpoint
+func (r *RESTAPIServer) reputationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if r.reputation == nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		ip := r.reputation.checker.ClientIP(req)
+		verdict := r.reputation.checker.Check(req.Context(), ip)
+		switch verdict.Action {
+		case reputation.ActionDeny:
+			log.Printf("REST request from %s refused by %s", ip, verdict.Source)
+			r.sendProblem(w, http.StatusForbidden, problem.CodeForbidden, "Requests from this network are not accepted")
+			return
+		case reputation.ActionRequireAuth:
+			if !reputationExemptPaths[req.URL.Path] && !r.auth.AuthenticateRequest(req) {
+				r.sendProblem(w, http.StatusUnauthorized, problem.CodeUnauthorized, "Requests from this network must be authenticated")
+				return
+			}
+		case reputation.ActionRateLimit:
+			if status, allowed := r.reputation.limiter.take(ip.String(), time.Now()); !allowed {
+				writeRateLimited(w, status)
+				return
+			}
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// HandleReputationStats reports IP reputation checks and matches since
+// startup (admin only)
+func (r *RESTAPIServer) HandleReputationStats(w http.ResponseWriter, req *http.Request) {
+	if r.reputation == nil {
+		r.sendError(w, "IP reputation is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	r.sendSuccess(w, r.reputation.checker.Stats())
+}
@@ -3,20 +3,61 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
+	"mercury-relay/internal/access"
+	"mercury-relay/internal/annotations"
+	"mercury-relay/internal/archive"
 	"mercury-relay/internal/auth"
+	"mercury-relay/internal/blocklist"
 	"mercury-relay/internal/cache"
+	"mercury-relay/internal/classify"
+	"mercury-relay/internal/cluster"
 	"mercury-relay/internal/config"
+	"mercury-relay/internal/cover"
+	"mercury-relay/internal/disk"
+	"mercury-relay/internal/entitlement"
+	"mercury-relay/internal/forwarding"
+	"mercury-relay/internal/idempotency"
+	"mercury-relay/internal/identity"
+	"mercury-relay/internal/largeobj"
+	"mercury-relay/internal/live"
+	"mercury-relay/internal/logging"
+	"mercury-relay/internal/maintenance"
+	"mercury-relay/internal/mirror"
 	"mercury-relay/internal/models"
+	"mercury-relay/internal/normalize"
+	"mercury-relay/internal/notice"
+	"mercury-relay/internal/origin"
+	"mercury-relay/internal/outbox"
+	"mercury-relay/internal/payments"
+	"mercury-relay/internal/probation"
+	"mercury-relay/internal/problem"
+	"mercury-relay/internal/profiling"
+	"mercury-relay/internal/push"
 	"mercury-relay/internal/quality"
+	"mercury-relay/internal/quarantine"
 	"mercury-relay/internal/queue"
+	"mercury-relay/internal/rejection"
+	"mercury-relay/internal/render"
+	"mercury-relay/internal/retention"
+	"mercury-relay/internal/search"
+	"mercury-relay/internal/seen"
+	"mercury-relay/internal/storage"
+	"mercury-relay/internal/streaming"
+	"mercury-relay/internal/tracing"
+	"mercury-relay/internal/transport"
+	"mercury-relay/internal/trending"
+	"mercury-relay/internal/web"
+	"mercury-relay/pkg/ebooks"
 
 	"github.com/gorilla/mux"
 	"github.com/nbd-wtf/go-nostr"
@@ -30,6 +71,47 @@ type RESTAPIServer struct {
 	server         *http.Server
 	sshKeyManager  *SSHKeyManager
 	auth           *auth.UniversalAuthenticator
+	transportMgr   *transport.Manager
+	forwarder      *forwarding.Forwarder
+	normalizer     *normalize.Normalizer
+	notices        *notice.Manager
+	queryLimiter   *clientLimiter
+	covers         *cover.Generator
+	imageClient    *http.Client
+	endpoints      *endpointAdvertiser
+	connections    ConnectionSource
+	topics         *topicHub
+	streams        *streamHub
+	mirror         *mirror.Mirror
+	accessControl  *access.Controller
+	trending       *trending.Tracker
+	maintenance    *maintenance.Mode
+	annotations    *annotations.Store
+	reputation     *reputationGate
+	public         *publicMirror
+	detectLanguage bool
+	rejections     *rejection.Log
+	disk           *disk.Monitor
+	entitlements   *entitlement.Manager
+	payments       *payments.Manager
+	identity       *identity.Identity
+	search         *search.Index
+	archiver       *archive.Archiver
+	profiler       *profiling.Sampler
+	probation      *probation.Tracker
+	quarantine     *quarantine.Queue
+	outbox         *outbox.Outbox
+	upstreams      *streaming.UpstreamManager
+	push           *push.Manager
+	cluster        *cluster.Node
+	blockLists     *blocklist.Manager
+	largeObjects   *largeobj.Router
+	live           *live.Tracker
+	idempotency    *idempotency.Store
+	seen           *seen.Index
+	storage        storage.Storage
+	retention      *retention.Pruner
+	moderationLog  moderationLog
 }
 
 type APIResponse struct {
@@ -41,6 +123,8 @@ type APIResponse struct {
 type EventRequest struct {
 	Filter nostr.Filter `json:"filter"`
 	Limit  int          `json:"limit,omitempty"`
+	// Languages keeps events in these ISO 639-1 languages only
+	Languages []string `json:"lang,omitempty"`
 }
 
 type PublishRequest struct {
@@ -48,9 +132,10 @@ type PublishRequest struct {
 }
 
 type HealthResponse struct {
-	Status    string    `json:"status"`
-	Timestamp time.Time `json:"timestamp"`
-	Version   string    `json:"version"`
+	Status      string             `json:"status"`
+	Timestamp   time.Time          `json:"timestamp"`
+	Version     string             `json:"version"`
+	Maintenance *maintenance.State `json:"maintenance,omitempty"`
 }
 
 type StatsResponse struct {
@@ -59,6 +144,13 @@ type StatsResponse struct {
 	CacheSize         int64                  `json:"cache_size"`
 	QueueSize         int64                  `json:"queue_size"`
 	QualityStats      map[string]interface{} `json:"quality_stats"`
+	REQStats          map[string]int64       `json:"req_stats,omitempty"`
+	Storage           map[string]interface{} `json:"storage,omitempty"`
+	StorageBackend    map[string]interface{} `json:"storage_backend,omitempty"`
+	Cluster           *cluster.Status        `json:"cluster,omitempty"`
+	LargeObjects      map[string]interface{} `json:"large_objects,omitempty"`
+	Live              map[string]interface{} `json:"live,omitempty"`
+	Dedup             map[string]interface{} `json:"dedup,omitempty"`
 }
 
 func NewRESTAPIServer(
@@ -71,25 +163,91 @@ func NewRESTAPIServer(
 	cfg *config.Config,
 ) *RESTAPIServer {
 	sshKeyManager := NewSSHKeyManager(sshConfig, relayURL)
+	if cfg != nil {
+		sshKeyManager.csrf.origins = origin.NewChecker(cfg.Server.AllowedOrigins, cfg.Server.TrustForwardedHost)
+	}
 	universalAuth := auth.NewUniversalAuthenticator(cfg, relayURL, cache, rabbitMQ)
-	return &RESTAPIServer{
+	server := &RESTAPIServer{
 		config:         config,
 		qualityControl: qualityControl,
 		rabbitMQ:       rabbitMQ,
 		cache:          cache,
 		sshKeyManager:  sshKeyManager,
 		auth:           universalAuth,
+		covers:         cover.NewGenerator(coverCacheSize),
+		imageClient:    newImageClient(),
+		endpoints:      newEndpointAdvertiser(relayURL, cfg),
+		topics:         newTopicHub(),
+		streams:        newStreamHub(config.Stream),
+	}
+	if config.RateLimitPerMinute > 0 {
+		server.queryLimiter = newClientLimiter(config.RateLimitPerMinute)
+	}
+	if config.PublicMirror.Enabled {
+		server.public = newPublicMirror(config.PublicMirror)
+	}
+	if config.Idempotency.Enabled {
+		store, err := idempotency.NewStore(config.Idempotency)
+		if err != nil {
+			log.Printf("Publish idempotency disabled: %v", err)
+		} else {
+			server.idempotency = store
+		}
 	}
+	return server
+}
+
+// SetDiskMonitor reports storage disk usage in /api/v1/stats
+func (r *RESTAPIServer) SetDiskMonitor(m *disk.Monitor) {
+	r.disk = m
+}
+
+// SetStorage serves events requested by ID from the storage backend once
+// the cache no longer holds them, and reports its stats in /api/v1/stats
+func (r *RESTAPIServer) SetStorage(s storage.Storage) {
+	r.storage = s
+}
+
+// SetTransportManager enables the admin transport endpoints
+func (r *RESTAPIServer) SetTransportManager(transportMgr *transport.Manager) {
+	r.transportMgr = transportMgr
+}
+
+// SetForwarder exposes forwarding delivery metrics through the admin API
+func (r *RESTAPIServer) SetForwarder(forwarder *forwarding.Forwarder) {
+	r.forwarder = forwarder
+}
+
+// SetNormalizer exposes tag normalization metrics through the admin API
+func (r *RESTAPIServer) SetNormalizer(normalizer *normalize.Normalizer) {
+	r.normalizer = normalizer
+}
+
+// SetNoticeManager enables the admin notice endpoints
+func (r *RESTAPIServer) SetNoticeManager(notices *notice.Manager) {
+	r.notices = notices
 }
 
 func (r *RESTAPIServer) Start(ctx context.Context) error {
 	router := mux.NewRouter()
 
+	// Request IDs for correlating responses with logs
+	router.Use(problem.Middleware)
+	router.Use(requestLogMiddleware)
+	router.Use(tracingMiddleware)
+
+	// Signatures over responses, so clients can verify them through mirrors
+	router.Use(r.signingMiddleware)
+
 	// CORS middleware
 	if r.config.CORSEnabled {
 		router.Use(r.corsMiddleware)
 	}
 
+	// IP reputation runs before rate limiting so flagged clients get the
+	// stricter budget
+	router.Use(r.reputationMiddleware)
+
 	// Rate limiting middleware
 	router.Use(r.rateLimitMiddleware)
 
@@ -98,13 +256,50 @@ func (r *RESTAPIServer) Start(ctx context.Context) error {
 	api.HandleFunc("/events", r.auth.RequireAuth(r.HandleGetEvents)).Methods("GET", "POST")
 	api.HandleFunc("/query", r.auth.RequireAuth(r.HandleQuery)).Methods("POST")
 	api.HandleFunc("/publish", r.auth.RequireAuth(r.HandlePublish)).Methods("POST")
+	api.HandleFunc("/sync", r.auth.RequireAuth(r.HandleSync)).Methods("POST")                       // Missing events for a bloom filter of known IDs
 	api.HandleFunc("/stream", r.auth.RequireAuth(r.HandleStream)).Methods("GET")                    // HTTP streaming
 	api.HandleFunc("/sse", r.auth.RequireAuth(r.HandleSSE)).Methods("GET")                          // Server-Sent Events
+	api.HandleFunc("/sse/thread/{id}", r.auth.RequireAuth(r.HandleThreadSSE)).Methods("GET")        // Thread updates
+	api.HandleFunc("/sse/group/{group}", r.auth.RequireAuth(r.HandleGroupSSE)).Methods("GET")       // NIP-29 group chat
+	api.HandleFunc("/trending", r.auth.RequireAuth(r.HandleTrending)).Methods("GET")                // Top notes, articles and books by engagement
+	api.HandleFunc("/live", r.auth.RequireAuth(r.HandleLive)).Methods("GET")                        // NIP-53 streams live now, with viewers
+	api.HandleFunc("/search", r.auth.RequireAuth(r.HandleSearch)).Methods("GET")                    // Full-text search over notes, articles, books and wiki pages
 	api.HandleFunc("/ebooks", r.auth.RequireAuth(r.HandleEbooks)).Methods("GET")                    // E-book specific endpoint
 	api.HandleFunc("/ebooks/{id}/content", r.auth.RequireAuth(r.HandleEbookContent)).Methods("GET") // E-book content with nested structure
 	api.HandleFunc("/ebooks/{id}/epub", r.auth.RequireAuth(r.HandleEbookEPUB)).Methods("GET")       // Generate EPUB from Nostr book
+	api.HandleFunc("/ebooks/{id}/cover", r.auth.RequireAuth(r.HandleEbookCover)).Methods("GET")     // Cover image, generated when the book has none
+	api.HandleFunc("/ebooks/{id}/revisions", r.auth.RequireAuth(r.HandleEbookRevisions)).Methods("GET") // Stored versions of a publication
+	api.HandleFunc("/ebooks/{id}/diff", r.auth.RequireAuth(r.HandleEbookDiff)).Methods("GET")           // Changed sections between two versions
+	api.HandleFunc("/ebooks/{id}/unlocked", r.auth.RequireAuth(r.HandleUnlockedEbook)).Methods("GET")             // Locked sections re-encrypted to an entitled reader
+	api.HandleFunc("/ebooks/{id}/entitlements", r.auth.RequireAuth(r.HandleGetEntitlements)).Methods("GET")       // Readers with access (author or admin)
+	api.HandleFunc("/ebooks/{id}/entitlements", r.auth.RequireAuth(r.HandleGrantEntitlement)).Methods("POST")     // Grant a reader access (author or admin)
+	api.HandleFunc("/ebooks/{id}/entitlements/{reader}", r.auth.RequireAuth(r.HandleRevokeEntitlement)).Methods("DELETE") // Revoke a reader's access (author or admin)
+	api.HandleFunc("/ebooks/{id}/archive", r.auth.RequireAuth(r.HandleArchiveEbook)).Methods("POST")             // Archive to S3 or the Internet Archive (author or admin)
+	api.HandleFunc("/ebooks/{id}/archives", r.auth.RequireAuth(r.HandleGetArchives)).Methods("GET")               // Where versions of a book were archived
+	api.HandleFunc("/subscriptions", r.auth.RequireAuth(r.HandleGetSubscriptions)).Methods("GET")                  // Stored push subscriptions of the user
+	api.HandleFunc("/subscriptions", r.auth.RequireAuth(r.HandleCreateSubscription)).Methods("POST")               // Notify by webhook, ntfy or WebPush while offline
+	api.HandleFunc("/subscriptions/vapid-key", r.HandleGetVAPIDKey).Methods("GET")                                 // Public key for browser WebPush subscriptions
+	api.HandleFunc("/subscriptions/{id}", r.auth.RequireAuth(r.HandleGetSubscription)).Methods("GET")
+	api.HandleFunc("/subscriptions/{id}", r.auth.RequireAuth(r.HandleDeleteSubscription)).Methods("DELETE")
+
+	// Paid write access - open to anyone so unregistered pubkeys can buy it
+	api.HandleFunc("/payments/invoice", r.HandleRequestInvoice).Methods("POST")        // Invoice that buys a pubkey write access
+	api.HandleFunc("/payments/invoice/{id}", r.HandleGetInvoice).Methods("GET") // Whether an invoice was paid
+
 	api.HandleFunc("/health", r.HandleHealth).Methods("GET")                                        // Public health endpoint
+	api.HandleFunc("/endpoints", r.HandleEndpoints).Methods("GET")                                  // Public list of healthy transports
 	api.HandleFunc("/stats", r.auth.RequireAuth(r.HandleStats)).Methods("GET")
+	api.HandleFunc("/stats/runtime", r.auth.RequireAdmin(r.HandleRuntimeStats)).Methods("GET") // Runtime sample for performance triage (admin)
+	api.HandleFunc("/debug/pprof/", r.auth.RequireAdmin(r.HandlePprof)).Methods("GET")          // pprof index (admin, when enabled)
+	api.HandleFunc("/debug/pprof/{profile}", r.auth.RequireAdmin(r.HandlePprof)).Methods("GET", "POST")
+
+	// Public mirror endpoints - read-only, cached and open to anyone
+	if r.public != nil {
+		api.HandleFunc("/public/ebooks", r.HandlePublicEbooks).Methods("GET")
+		api.HandleFunc("/public/articles", r.HandlePublicArticles).Methods("GET")
+		api.HandleFunc("/public/events/{filter}", r.HandlePublicEvents).Methods("GET")
+		go r.public.run(ctx)
+	}
 
 	// Kind-based topic endpoints
 	api.HandleFunc("/kind/{kind}/events", r.auth.RequireAuth(r.HandleKindEvents)).Methods("GET") // Get events by kind
@@ -119,22 +314,79 @@ func (r *RESTAPIServer) Start(ctx context.Context) error {
 	api.HandleFunc("/history/diff/{from_event_id}/{to_event_id}", r.auth.RequireAuth(r.HandleEventDiffByID)).Methods("GET")       // Get diff by event IDs
 
 	// SSH Key Management endpoints
-	api.HandleFunc("/ssh-keys", r.sshKeyManager.HandleUploadSSHKey).Methods("POST")
+	api.HandleFunc("/ssh-keys", r.sshKeyManager.csrf.protect(r.sshKeyManager.HandleUploadSSHKey)).Methods("POST")
 	api.HandleFunc("/ssh-keys", r.sshKeyManager.HandleListSSHKeys).Methods("GET")
-	api.HandleFunc("/ssh-keys/{name}", r.sshKeyManager.HandleDeleteSSHKey).Methods("DELETE")
+	api.HandleFunc("/ssh-keys", r.sshKeyManager.csrf.protect(r.sshKeyManager.HandleDeleteSSHKeyByFingerprint)).Methods("DELETE").Queries("fingerprint", "{fingerprint}")
+	api.HandleFunc("/ssh-keys/{name}", r.sshKeyManager.csrf.protect(r.sshKeyManager.HandleDeleteSSHKey)).Methods("DELETE")
 
 	// Nostr Authentication endpoints
 	api.HandleFunc("/nostr/challenge", r.sshKeyManager.HandleNostrChallenge).Methods("GET")
-	api.HandleFunc("/nostr/auth", r.sshKeyManager.HandleNostrAuth).Methods("POST")
+	api.HandleFunc("/nostr/auth", r.sshKeyManager.csrf.protect(r.sshKeyManager.HandleNostrAuth)).Methods("POST")
 
 	// SSH Key form interface
-	router.HandleFunc("/ssh-keys", r.sshKeyManager.HandleSSHKeyForm).Methods("GET", "POST")
+	router.HandleFunc("/ssh-keys", r.sshKeyManager.csrf.protect(r.sshKeyManager.HandleSSHKeyForm)).Methods("GET", "POST")
+
+	// Admin dashboard page; its scripts call the admin API as the admin
+	router.HandleFunc("/admin", r.HandleDashboard).Methods("GET")
+
+	// Stylesheets and scripts of the HTML pages
+	router.PathPrefix(web.AssetPrefix).Handler(web.Assets()).Methods("GET")
 
 	// Admin-only endpoints
 	api.HandleFunc("/admin/whitelist", r.auth.RequireAdmin(r.HandleGetWhitelist)).Methods("GET")
 	api.HandleFunc("/admin/whitelist", r.auth.RequireAdmin(r.HandleAddToWhitelist)).Methods("POST")
 	api.HandleFunc("/admin/whitelist/{npub}", r.auth.RequireAdmin(r.HandleRemoveFromWhitelist)).Methods("DELETE")
 	api.HandleFunc("/admin/admins", r.auth.RequireAdmin(r.HandleGetAdmins)).Methods("GET")
+	api.HandleFunc("/admin/transports", r.auth.RequireAdmin(r.HandleGetTransports)).Methods("GET")
+	api.HandleFunc("/admin/transports/{name}/enable", r.auth.RequireAdmin(r.HandleEnableTransport)).Methods("POST")
+	api.HandleFunc("/admin/transports/{name}/disable", r.auth.RequireAdmin(r.HandleDisableTransport)).Methods("POST")
+	api.HandleFunc("/admin/forwarding", r.auth.RequireAdmin(r.HandleForwardingStats)).Methods("GET")
+	api.HandleFunc("/admin/outbox", r.auth.RequireAdmin(r.HandleGetOutbox)).Methods("GET")
+	api.HandleFunc("/admin/outbox/retry", r.auth.RequireAdmin(r.HandleRetryOutbox)).Methods("POST")
+	api.HandleFunc("/admin/upstreams", r.auth.RequireAdmin(r.HandleGetUpstreams)).Methods("GET")
+	api.HandleFunc("/admin/events/{id}/provenance", r.auth.RequireAdmin(r.HandleEventProvenance)).Methods("GET")
+	api.HandleFunc("/admin/connections", r.auth.RequireAdmin(r.HandleGetConnections)).Methods("GET")
+	api.HandleFunc("/admin/normalization", r.auth.RequireAdmin(r.HandleNormalizationStats)).Methods("GET")
+	api.HandleFunc("/admin/notices", r.auth.RequireAdmin(r.HandleGetNotices)).Methods("GET")
+	api.HandleFunc("/admin/notices", r.auth.RequireAdmin(r.HandleScheduleNotice)).Methods("POST")
+	api.HandleFunc("/admin/notices/welcome", r.auth.RequireAdmin(r.HandleSetWelcomeNotice)).Methods("PUT")
+	api.HandleFunc("/admin/notices/{id}", r.auth.RequireAdmin(r.HandleCancelNotice)).Methods("DELETE")
+	api.HandleFunc("/admin/reports", r.auth.RequireAdmin(r.HandleGetReportActions)).Methods("GET")
+	api.HandleFunc("/admin/reports/{target}/resolve", r.auth.RequireAdmin(r.HandleResolveReportAction)).Methods("POST")
+	api.HandleFunc("/admin/blocklists", r.auth.RequireAdmin(r.HandleGetBlockLists)).Methods("GET")
+	api.HandleFunc("/admin/blocklists", r.auth.RequireAdmin(r.HandleSubscribeBlockList)).Methods("POST")
+	api.HandleFunc("/admin/blocklists/{id}", r.auth.RequireAdmin(r.HandleGetBlockList)).Methods("GET")
+	api.HandleFunc("/admin/blocklists/{id}", r.auth.RequireAdmin(r.HandleUnsubscribeBlockList)).Methods("DELETE")
+	api.HandleFunc("/admin/blocklists/{id}/refresh", r.auth.RequireAdmin(r.HandleRefreshBlockList)).Methods("POST")
+	api.HandleFunc("/admin/mirror", r.auth.RequireAdmin(r.HandleGetMirror)).Methods("GET")
+	api.HandleFunc("/admin/mirror/{pubkey}", r.auth.RequireAdmin(r.HandleGetMirrorReport)).Methods("GET")
+	api.HandleFunc("/admin/retention", r.auth.RequireAdmin(r.HandleGetRetention)).Methods("GET")
+	api.HandleFunc("/admin/retention/run", r.auth.RequireAdmin(r.HandleRunRetention)).Methods("POST")
+	api.HandleFunc("/admin/maintenance", r.auth.RequireAdmin(r.HandleGetMaintenance)).Methods("GET")
+	api.HandleFunc("/admin/maintenance", r.auth.RequireAdmin(r.HandleSetMaintenance)).Methods("PUT")
+	api.HandleFunc("/admin/writers/pending", r.auth.RequireAdmin(r.HandleGetPendingWriters)).Methods("GET")
+	api.HandleFunc("/admin/writers/{pubkey}/approve", r.auth.RequireAdmin(r.HandleApproveWriter)).Methods("POST")
+	api.HandleFunc("/admin/writers/{pubkey}/deny", r.auth.RequireAdmin(r.HandleDenyWriter)).Methods("POST")
+	api.HandleFunc("/admin/payments", r.auth.RequireAdmin(r.HandleGetPayments)).Methods("GET")
+	api.HandleFunc("/admin/payments/{pubkey}/grant", r.auth.RequireAdmin(r.HandleGrantPaidAccess)).Methods("POST")
+	api.HandleFunc("/admin/payments/{pubkey}", r.auth.RequireAdmin(r.HandleRevokePaidAccess)).Methods("DELETE")
+	api.HandleFunc("/admin/probation", r.auth.RequireAdmin(r.HandleGetProbation)).Methods("GET")
+	api.HandleFunc("/admin/probation/{pubkey}/release", r.auth.RequireAdmin(r.HandleReleaseProbation)).Methods("POST")
+	api.HandleFunc("/admin/quarantine", r.auth.RequireAdmin(r.HandleGetQuarantine)).Methods("GET")
+	api.HandleFunc("/admin/quarantine/release", r.auth.RequireAdmin(r.HandleReleaseQuarantineAuthor)).Methods("POST")
+	api.HandleFunc("/admin/quarantine/purge", r.auth.RequireAdmin(r.HandlePurgeQuarantineAuthor)).Methods("POST")
+	api.HandleFunc("/admin/quarantine/{id}/release", r.auth.RequireAdmin(r.HandleReleaseQuarantined)).Methods("POST")
+	api.HandleFunc("/admin/quarantine/{id}/purge", r.auth.RequireAdmin(r.HandlePurgeQuarantined)).Methods("POST")
+	api.HandleFunc("/admin/annotations", r.auth.RequireAdmin(r.HandleGetAnnotations)).Methods("GET")
+	api.HandleFunc("/admin/annotations", r.auth.RequireAdmin(r.HandleCreateAnnotation)).Methods("POST")
+	api.HandleFunc("/admin/annotations/{id}", r.auth.RequireAdmin(r.HandleUpdateAnnotation)).Methods("PUT")
+	api.HandleFunc("/admin/annotations/{id}", r.auth.RequireAdmin(r.HandleDeleteAnnotation)).Methods("DELETE")
+	api.HandleFunc("/admin/reputation", r.auth.RequireAdmin(r.HandleReputationStats)).Methods("GET")
+	api.HandleFunc("/admin/rejections", r.auth.RequireAdmin(r.HandleGetRejections)).Methods("GET")
+	api.HandleFunc("/admin/block", r.auth.RequireAdmin(r.HandleBlockNpub)).Methods("POST")
+	api.HandleFunc("/admin/unblock", r.auth.RequireAdmin(r.HandleUnblockNpub)).Methods("POST")
+	api.HandleFunc("/admin/blocked", r.auth.RequireAdmin(r.HandleGetBlocked)).Methods("GET")
+	api.HandleFunc("/admin/moderation/log", r.auth.RequireAdmin(r.HandleGetModerationLog)).Methods("GET")
 
 	// Start server
 	r.server = &http.Server{
@@ -165,6 +417,7 @@ func (r *RESTAPIServer) corsMiddleware(next http.Handler) http.Handler {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Expose-Headers", identity.PubkeyHeader+", "+identity.SignatureHeader+", "+identity.TimestampHeader)
 
 		// Handle preflight requests
 		if req.Method == "OPTIONS" {
@@ -176,134 +429,218 @@ func (r *RESTAPIServer) corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// rateLimitMiddleware limits query endpoints to rate_limit_per_minute per
+// client and reports the remaining budget in X-RateLimit-* headers. Publish
+// budgets come from the quality controller in HandlePublish.
 func (r *RESTAPIServer) rateLimitMiddleware(next http.Handler) http.Handler {
-	// Simple rate limiting - in production, use a proper rate limiter
 	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		// TODO: Implement proper rate limiting
+		if r.queryLimiter == nil || !r.isQueryPath(req.URL.Path) {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		status, allowed := r.queryLimiter.take(r.rateLimitClient(req), time.Now())
+		if !allowed {
+			writeRateLimited(w, status)
+			return
+		}
+		setRateLimitHeaders(w, status)
 		next.ServeHTTP(w, req)
 	})
 }
 
 func (r *RESTAPIServer) HandleGetEvents(w http.ResponseWriter, req *http.Request) {
 	var filter nostr.Filter
+	var languages []string
 
 	if req.Method == "GET" {
 		// Parse query parameters
-		if authors := req.URL.Query()["authors"]; len(authors) > 0 {
-			filter.Authors = authors
-		}
-		if kinds := req.URL.Query()["kinds"]; len(kinds) > 0 {
-			for _, kind := range kinds {
-				if k, err := strconv.Atoi(kind); err == nil {
-					filter.Kinds = append(filter.Kinds, k)
-				}
-			}
-		}
-		if since := req.URL.Query().Get("since"); since != "" {
-			if s, err := strconv.ParseInt(since, 10, 64); err == nil {
-				timestamp := nostr.Timestamp(s)
-				filter.Since = &timestamp
-			}
-		}
-		if until := req.URL.Query().Get("until"); until != "" {
-			if u, err := strconv.ParseInt(until, 10, 64); err == nil {
-				timestamp := nostr.Timestamp(u)
-				filter.Until = &timestamp
-			}
-		}
-		if limit := req.URL.Query().Get("limit"); limit != "" {
-			if l, err := strconv.Atoi(limit); err == nil {
-				filter.Limit = l
-			}
+		var err error
+		filter, err = filterQuery(req.URL.Query())
+		if err != nil {
+			r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidFilter, err.Error())
+			return
 		}
+		languages = languageParam(req)
 	} else {
 		// Parse JSON body
 		var eventReq EventRequest
 		if err := json.NewDecoder(req.Body).Decode(&eventReq); err != nil {
-			r.sendError(w, "Invalid JSON", http.StatusBadRequest)
+			r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidFilter, "Invalid JSON")
 			return
 		}
 		filter = eventReq.Filter
 		if eventReq.Limit > 0 {
 			filter.Limit = eventReq.Limit
 		}
+		languages = eventReq.Languages
+	}
+	if !r.checkSearch(w, filter) {
+		return
 	}
 
-	// Get events from cache
-	events, err := r.cache.GetEvents(filter)
+	// Get events from cache, or the search index
+	events, err := r.findEvents(req.Context(), filter)
 	if err != nil {
 		r.sendError(w, fmt.Sprintf("Failed to get events: %v", err), http.StatusInternalServerError)
 		return
 	}
+	events = filterLanguage(events, languages)
 
-	// Convert to Nostr events
-	var nostrEvents []nostr.Event
-	for _, event := range events {
-		nostrEvent := event.ToNostrEvent()
-		nostrEvents = append(nostrEvents, *nostrEvent)
-	}
-
-	r.sendSuccess(w, nostrEvents)
+	r.sendSuccess(w, toEventResponses(events))
 }
 
 func (r *RESTAPIServer) HandleQuery(w http.ResponseWriter, req *http.Request) {
 	var eventReq EventRequest
 	if err := json.NewDecoder(req.Body).Decode(&eventReq); err != nil {
-		r.sendError(w, "Invalid JSON", http.StatusBadRequest)
+		r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidFilter, "Invalid JSON")
 		return
 	}
 
-	// Get events from cache
-	events, err := r.cache.GetEvents(eventReq.Filter)
-	if err != nil {
-		r.sendError(w, fmt.Sprintf("Failed to query events: %v", err), http.StatusInternalServerError)
+	if !r.checkSearch(w, eventReq.Filter) {
 		return
 	}
 
-	// Convert to Nostr events
-	var nostrEvents []nostr.Event
-	for _, event := range events {
-		nostrEvent := event.ToNostrEvent()
-		nostrEvents = append(nostrEvents, *nostrEvent)
+	// Get events from cache, or the search index
+	events, err := r.findEvents(req.Context(), eventReq.Filter)
+	if err != nil {
+		r.sendError(w, fmt.Sprintf("Failed to query events: %v", err), http.StatusInternalServerError)
+		return
 	}
+	events = filterLanguage(events, eventReq.Languages)
 
-	r.sendSuccess(w, nostrEvents)
+	r.sendSuccess(w, toEventResponses(events))
 }
 
 func (r *RESTAPIServer) HandlePublish(w http.ResponseWriter, req *http.Request) {
+	if r.maintenance.Active() {
+		r.sendProblem(w, http.StatusServiceUnavailable, problem.CodeMaintenance, r.maintenance.State().Message())
+		return
+	}
+
 	var publishReq PublishRequest
 	if err := json.NewDecoder(req.Body).Decode(&publishReq); err != nil {
 		r.sendError(w, fmt.Sprintf("Invalid JSON: %v", err), http.StatusBadRequest)
 		return
 	}
 
-	// Validate event
-	if err := publishReq.Event.Validate(); err != nil {
-		r.sendError(w, fmt.Sprintf("Event validation failed: %v", err), http.StatusBadRequest)
+	// Retries of a publish get its first result
+	if r.idempotency != nil {
+		r.publishOnce(w, req, &publishReq)
 		return
 	}
+	r.publish(w, req, &publishReq)
+}
+
+// publish validates, screens and enqueues a decoded publish request
+func (r *RESTAPIServer) publish(w http.ResponseWriter, req *http.Request, publishReq *PublishRequest) {
+	if r.largeObjects != nil {
+		if err := r.largeObjects.Check(&publishReq.Event); err != nil {
+			r.reject(req, &publishReq.Event, fmt.Sprintf("invalid: %v", err))
+			r.sendProblem(w, http.StatusRequestEntityTooLarge, problem.CodeInvalidEvent, err.Error())
+			return
+		}
+	}
+
+	r.markMirrored(&publishReq.Event)
+
+	// Validate event; mirrored authors may republish old events
+	if err := publishReq.Event.Validate(); err != nil && !(publishReq.Event.Mirrored && errors.Is(err, models.ErrEventTooOld)) {
+		r.reject(req, &publishReq.Event, fmt.Sprintf("invalid: %v", err))
+		r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidEvent, fmt.Sprintf("Event validation failed: %v", err))
+		return
+	}
+
+	// Copies of accepted events are acknowledged, not processed again
+	if r.seen != nil && r.seen.Seen(seen.SourceREST, publishReq.Event.ID) {
+		r.sendSuccess(w, map[string]interface{}{
+			"event_id": publishReq.Event.ID,
+			"status":   "duplicate",
+		})
+		return
+	}
+
+	// Provenance and index metadata are recorded by the relay, never taken
+	// from the client
+	publishReq.Event.Provenance = nil
+	publishReq.Event.NormalizedTags = nil
+	publishReq.Event.Language = ""
+	publishReq.Event.TrustLabel = ""
+	publishReq.Event.Offloaded = false
+	publishReq.Event.AddProvenance(models.ProvenanceREST, req.RemoteAddr, req.Header.Get("X-Nostr-Pubkey"))
+	publishReq.Event.TraceID = problem.RequestID(req)
+	if r.detectLanguage {
+		publishReq.Event.Language = classify.EventLanguage(&publishReq.Event)
+	}
+
+	// New pubkeys are rate limited, need proof of work and may be quarantined
+	if message, ok := r.screenProbation(&publishReq.Event); !ok {
+		r.reject(req, &publishReq.Event, message)
+		if strings.HasPrefix(message, "rate-limited:") {
+			r.sendProblem(w, http.StatusTooManyRequests, problem.CodeQuotaExceeded, message)
+		} else {
+			r.sendProblem(w, http.StatusForbidden, problem.CodeForbidden, message)
+		}
+		return
+	}
+
+	// Consumers continue the trace from the span that queues the event
+	_, publish := tracing.Start(req.Context(), tracing.KindProducer, "queue publish")
+	defer publish.End()
+	publishReq.Event.TraceParent = publish.TraceParent()
 
 	// Check quality control (this will also publish to queue)
 	if r.qualityControl != nil {
-		log.Printf("REST API calling quality controller for event %s", publishReq.Event.ID)
-		if err := r.qualityControl.ValidateEvent(&publishReq.Event); err != nil {
-			r.sendError(w, fmt.Sprintf("Quality control failed: %v", err), http.StatusBadRequest)
+		err := r.qualityControl.ValidateEvent(&publishReq.Event)
+		publish.RecordError(err)
+		if status, ok := r.publishRateLimit(publishReq.Event.PubKey); ok {
+			setRateLimitHeaders(w, status)
+		}
+		if err != nil {
+			detail := fmt.Sprintf("Quality control failed: %v", err)
+			switch {
+			case errors.Is(err, quality.ErrRateLimitExceeded):
+				r.reject(req, &publishReq.Event, fmt.Sprintf("rate-limited: %v", err))
+				r.sendProblem(w, http.StatusTooManyRequests, problem.CodeQuotaExceeded, detail)
+			default:
+				r.reject(req, &publishReq.Event, fmt.Sprintf("invalid: quality control failed: %v", err))
+				r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidEvent, detail)
+			}
 			return
 		}
-		log.Printf("REST API quality controller completed for event %s", publishReq.Event.ID)
 	} else {
-		log.Printf("REST API no quality controller, publishing directly to queue for event %s", publishReq.Event.ID)
 		// Fallback: publish directly to queue if no quality control
 		if err := r.rabbitMQ.PublishEvent(&publishReq.Event); err != nil {
+			publish.RecordError(err)
+			r.reject(req, &publishReq.Event, fmt.Sprintf("error: failed to publish event: %v", err))
 			r.sendError(w, fmt.Sprintf("Failed to publish event: %v", err), http.StatusInternalServerError)
 			return
 		}
 	}
 
-	r.sendSuccess(w, map[string]interface{}{
+	if r.seen != nil {
+		r.seen.Add(publishReq.Event.ID)
+	}
+
+	response := map[string]interface{}{
 		"event_id": publishReq.Event.ID,
 		"status":   "published",
-	})
+	}
+	if nevent, err := publishReq.Event.Nevent(r.relayHints()); err == nil {
+		response["nevent"] = nevent
+	}
+	if naddr, err := publishReq.Event.Naddr(r.relayHints()); err == nil {
+		response["naddr"] = naddr
+	}
+	r.sendSuccess(w, response)
+}
+
+// relayHints are the relay URLs put in the NIP-19 identifiers handed out
+func (r *RESTAPIServer) relayHints() []string {
+	if r.endpoints == nil || r.endpoints.relayURL == "" {
+		return nil
+	}
+	return []string{r.endpoints.relayURL}
 }
 
 func (r *RESTAPIServer) HandleHealth(w http.ResponseWriter, req *http.Request) {
@@ -312,6 +649,11 @@ func (r *RESTAPIServer) HandleHealth(w http.ResponseWriter, req *http.Request) {
 		Timestamp: time.Now(),
 		Version:   "1.0.0",
 	}
+	if r.maintenance.Active() {
+		state := r.maintenance.State()
+		health.Status = "maintenance"
+		health.Maintenance = &state
+	}
 
 	r.sendSuccess(w, health)
 }
@@ -334,86 +676,68 @@ func (r *RESTAPIServer) HandleStats(w http.ResponseWriter, req *http.Request) {
 		}
 	}
 
-	r.sendSuccess(w, stats)
-}
-
-func (r *RESTAPIServer) sendSuccess(w http.ResponseWriter, data interface{}) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-
-	response := APIResponse{
-		Success: true,
-		Data:    data,
+	// Connection counts and REQ flood protection counters
+	if r.connections != nil {
+		stats.ActiveConnections = len(r.connections.Connections())
+		stats.REQStats = r.connections.REQStats()
 	}
 
-	json.NewEncoder(w).Encode(response)
-}
-
-func (r *RESTAPIServer) HandleStream(w http.ResponseWriter, req *http.Request) {
-	// HTTP streaming endpoint for server-side rendering
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	w.Header().Set("Transfer-Encoding", "chunked")
-
-	// Parse filter from query parameters
-	var filter nostr.Filter
-	if authors := req.URL.Query()["authors"]; len(authors) > 0 {
-		filter.Authors = authors
+	// Disk usage of the storage paths
+	if r.disk != nil {
+		stats.Storage = r.disk.Stats()
 	}
-	if kinds := req.URL.Query()["kinds"]; len(kinds) > 0 {
-		for _, kind := range kinds {
-			if k, err := strconv.Atoi(kind); err == nil {
-				filter.Kinds = append(filter.Kinds, k)
-			}
+
+	// Event count and size of the storage backend
+	if r.storage != nil {
+		if backendStats, err := r.storage.GetStats(); err == nil {
+			stats.StorageBackend = backendStats
+		} else {
+			log.Printf("Failed to get storage stats: %v", err)
 		}
 	}
-	if since := req.URL.Query().Get("since"); since != "" {
-		if s, err := strconv.ParseInt(since, 10, 64); err == nil {
-			timestamp := nostr.Timestamp(s)
-			filter.Since = &timestamp
+
+	// Instances sharing storage and the jobs they lead
+	if r.cluster != nil {
+		if status, err := r.cluster.Status(req.Context()); err == nil {
+			stats.Cluster = &status
+		} else {
+			log.Printf("Failed to get cluster status: %v", err)
 		}
 	}
-	if until := req.URL.Query().Get("until"); until != "" {
-		if u, err := strconv.ParseInt(until, 10, 64); err == nil {
-			timestamp := nostr.Timestamp(u)
-			filter.Until = &timestamp
-		}
+
+	// Events kept out of the queue and cache
+	if r.largeObjects != nil {
+		stats.LargeObjects = r.largeObjects.Stats()
 	}
-	if limit := req.URL.Query().Get("limit"); limit != "" {
-		if l, err := strconv.Atoi(limit); err == nil {
-			filter.Limit = l
-		}
+
+	// Live activities and their viewers
+	if r.live != nil {
+		stats.Live = r.live.Stats()
 	}
 
-	// Get initial events
-	events, err := r.cache.GetEvents(filter)
-	if err != nil {
-		r.sendError(w, fmt.Sprintf("Failed to get events: %v", err), http.StatusInternalServerError)
-		return
+	// Copies of accepted events that were not processed again
+	if r.seen != nil {
+		stats.Dedup = r.seen.Stats()
 	}
 
-	// Send initial events
-	encoder := json.NewEncoder(w)
-	for _, event := range events {
-		nostrEvent := event.ToNostrEvent()
-		if err := encoder.Encode(map[string]interface{}{
-			"type": "event",
-			"data": *nostrEvent,
-		}); err != nil {
-			return
-		}
-		w.(http.Flusher).Flush()
+	r.sendSuccess(w, stats)
+}
+
+func (r *RESTAPIServer) sendSuccess(w http.ResponseWriter, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+
+	response := APIResponse{
+		Success: true,
+		Data:    data,
 	}
 
-	// TODO: Implement real-time streaming for new events
-	// This would require a subscription mechanism to push new events
-	// as they arrive from the queue or upstream relays
+	json.NewEncoder(w).Encode(response)
 }
 
 func (r *RESTAPIServer) HandleSSE(w http.ResponseWriter, req *http.Request) {
-	// Server-Sent Events endpoint for monitoring and admin purposes
-	// Note: For Nostr event streaming, use WebSocket connections instead
+	// Server-Sent Events endpoint for monitoring and admin purposes, and
+	// for live Nostr events matching a filter (type=events)
 	w.Header().Set("Content-Type", "text/event-stream")
 	w.Header().Set("Cache-Control", "no-cache")
 	w.Header().Set("Connection", "keep-alive")
@@ -430,10 +754,12 @@ func (r *RESTAPIServer) HandleSSE(w http.ResponseWriter, req *http.Request) {
 		r.handleSSEHealth(w, req)
 	case "admin":
 		r.handleSSEAdmin(w, req)
+	case "events":
+		r.handleSSEEvents(w, req)
 	default:
 		// Send initial connection event
 		fmt.Fprintf(w, "event: connected\n")
-		fmt.Fprintf(w, "data: {\"message\": \"Connected to Mercury Relay SSE\", \"endpoints\": [\"stats\", \"health\", \"admin\"]}\n\n")
+		fmt.Fprintf(w, "data: {\"message\": \"Connected to Mercury Relay SSE\", \"endpoints\": [\"stats\", \"health\", \"admin\", \"events\"]}\n\n")
 		w.(http.Flusher).Flush()
 
 		// Keep connection alive with heartbeat
@@ -567,53 +893,19 @@ func (r *RESTAPIServer) HandleEbooks(w http.ResponseWriter, req *http.Request) {
 	}
 
 	// Get ebooks from cache
-	events, err := r.cache.GetEvents(filter)
+	events, err := cache.Collect(r.cache.GetEvents(req.Context(), filter))
 	if err != nil {
 		r.sendError(w, fmt.Sprintf("Failed to get ebooks: %v", err), http.StatusInternalServerError)
 		return
 	}
+	events = filterLanguage(events, languageParam(req))
 
 	// Filter and format for e-paper readers
-	var ebooks []map[string]interface{}
+	list := []ebooks.Ebook{}
 	for _, event := range events {
-		// Parse ebook metadata from content
-		var metadata map[string]interface{}
-		if err := json.Unmarshal([]byte(event.Content), &metadata); err != nil {
-			continue
+		if ebook := r.ebookSummary(req.Context(), event, format); ebook != nil {
+			list = append(list, *ebook)
 		}
-
-		// Check format filter
-		if format != "" {
-			if bookFormat, ok := metadata["format"].(string); ok {
-				if bookFormat != format {
-					continue
-				}
-			}
-		}
-
-		// Extract ebook information
-		ebook := map[string]interface{}{
-			"id":          event.ID,
-			"author":      event.PubKey,
-			"title":       metadata["title"],
-			"author_name": metadata["author"],
-			"format":      metadata["format"],
-			"size":        metadata["size"],
-			"created_at":  int64(event.CreatedAt),
-			"tags":        event.Tags,
-		}
-
-		// Add download URL if available
-		if downloadURL, ok := metadata["download_url"].(string); ok {
-			ebook["download_url"] = downloadURL
-		}
-
-		// Add cover image if available
-		if cover, ok := metadata["cover"].(string); ok {
-			ebook["cover"] = cover
-		}
-
-		ebooks = append(ebooks, ebook)
 	}
 
 	// Set headers optimized for e-paper readers
@@ -622,16 +914,71 @@ func (r *RESTAPIServer) HandleEbooks(w http.ResponseWriter, req *http.Request) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	// Return simplified response for e-paper readers
-	response := map[string]interface{}{
-		"success":   true,
-		"count":     len(ebooks),
-		"ebooks":    ebooks,
-		"timestamp": time.Now().Unix(),
+	response := ebooks.Catalog{
+		Success:   true,
+		Count:     len(list),
+		Ebooks:    list,
+		Timestamp: time.Now().Unix(),
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
+// ebookSummary describes a kind 30040 book for listings, or returns nil when
+// its metadata can't be read or it doesn't match format
+func (r *RESTAPIServer) ebookSummary(ctx context.Context, event *models.Event, format string) *ebooks.Ebook {
+	// Parse ebook metadata from content
+	var metadata map[string]interface{}
+	if err := json.Unmarshal([]byte(event.Content), &metadata); err != nil {
+		return nil
+	}
+
+	// Check format filter
+	if format != "" {
+		if bookFormat, ok := metadata["format"].(string); ok {
+			if bookFormat != format {
+				return nil
+			}
+		}
+	}
+
+	// Extract ebook information
+	ebook := &ebooks.Ebook{
+		ID:          event.ID,
+		Author:      event.PubKey,
+		Title:       getString(metadata, "title", ""),
+		AuthorName:  getString(metadata, "author", ""),
+		Format:      getString(metadata, "format", ""),
+		CreatedAt:   int64(event.CreatedAt),
+		Tags:        event.Tags,
+		DownloadURL: getString(metadata, "download_url", ""),
+		Cover:       getString(metadata, "cover", ""),
+	}
+	ebook.Naddr, _ = event.Naddr(r.relayHints())
+	if size, ok := metadata["size"].(float64); ok {
+		ebook.Size = int64(size)
+	}
+
+	// Prefer verified NIP-94 file references over raw metadata
+	if files := r.resolveBookFiles(ctx, event, metadata); len(files) > 0 {
+		for _, file := range files {
+			ebook.Files = append(ebook.Files, ebooks.File(*file))
+		}
+		if cover := coverFile(files); cover != nil {
+			ebook.Cover = cover.URL
+			ebook.CoverSHA256 = cover.SHA256
+		}
+	}
+
+	// Fall back to a generated typographic cover
+	if ebook.Cover == "" {
+		ebook.Cover = "/api/v1/ebooks/" + event.ID + "/cover"
+		ebook.CoverGenerated = true
+	}
+
+	return ebook
+}
+
 func (r *RESTAPIServer) HandleEbookContent(w http.ResponseWriter, req *http.Request) {
 	// Special function for transmitting e-paper books with nested structure
 	// Supports kind 30040 (Publication Index) with kind 30041 (Publication Content) per NKBIP-01
@@ -669,7 +1016,7 @@ func (r *RESTAPIServer) HandleEbookContent(w http.ResponseWriter, req *http.Requ
 		IDs:   []string{bookID},
 	}
 
-	bookEvents, err := r.cache.GetEvents(bookFilter)
+	bookEvents, err := cache.Collect(r.cache.GetEvents(req.Context(), bookFilter))
 	if err != nil {
 		r.sendError(w, fmt.Sprintf("Failed to get book: %v", err), http.StatusInternalServerError)
 		return
@@ -703,72 +1050,70 @@ func (r *RESTAPIServer) HandleEbookContent(w http.ResponseWriter, req *http.Requ
 		return
 	}
 
-	// Get content events (kind 30041) for this book
-	contentFilter := nostr.Filter{
-		Kinds:   []int{30041},
-		Authors: []string{bookEvent.PubKey},
-	}
-
-	contentEvents, err := r.cache.GetEvents(contentFilter)
+	// Get content events (kind 30041) for this book, including sections
+	// written by collaborators
+	bookContent, err := r.resolveBookSections(req.Context(), bookEvent, bookIdentifier)
 	if err != nil {
 		r.sendError(w, fmt.Sprintf("Failed to get content: %v", err), http.StatusInternalServerError)
 		return
 	}
+	authors := r.sectionAuthors(req.Context(), bookContent)
 
-	// Filter content events by book identifier
-	var bookContent []*models.Event
-	for _, event := range contentEvents {
-		// Check if this content belongs to our book
-		for _, tag := range event.Tags {
-			if len(tag) >= 2 && tag[0] == "a" {
-				// Check if this is an addressable event for our book
-				address := fmt.Sprintf("30040:%s:%s", bookEvent.PubKey, bookIdentifier)
-				if tag[1] == address {
-					bookContent = append(bookContent, event)
-					break
-				}
-			}
+	// Build nested book structure
+	bookStructure := r.buildBookStructure(bookEvent, bookContent, authors, depth)
+	if format == "html" {
+		// Wikilinks point at the linked section's node
+		renderStructure(bookStructure, render.Options{Wikilinks: sectionLinks(bookContent, func(_ int, section *models.Event) string {
+			return "#" + section.ID
+		})})
+	}
+
+	contributors := make([]ebooks.Contributor, 0, len(authors))
+	for _, event := range r.sortContentEvents(bookContent) {
+		if profile, ok := authors[event.PubKey]; ok {
+			contributors = append(contributors, *profile)
+			delete(authors, event.PubKey)
 		}
 	}
 
-	// Build nested book structure
-	bookStructure := r.buildBookStructure(bookEvent, bookContent, depth)
-
 	// Set headers optimized for e-paper readers
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Cache-Control", "public, max-age=7200") // Cache for 2 hours
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 
 	// Return structured book content
-	response := map[string]interface{}{
-		"success": true,
-		"book": map[string]interface{}{
-			"id":          bookEvent.ID,
-			"title":       bookMetadata["title"],
-			"author":      bookMetadata["author"],
-			"description": bookMetadata["description"],
-			"format":      bookMetadata["format"],
-			"language":    bookMetadata["language"],
-			"created_at":  int64(bookEvent.CreatedAt),
-			"structure":   bookStructure,
+	naddr, _ := bookEvent.Naddr(r.relayHints())
+	response := ebooks.Content{
+		Success: true,
+		Book: ebooks.Book{
+			ID:           bookEvent.ID,
+			Title:        getString(bookMetadata, "title", ""),
+			Author:       getString(bookMetadata, "author", ""),
+			Description:  getString(bookMetadata, "description", ""),
+			Format:       getString(bookMetadata, "format", ""),
+			Language:     getString(bookMetadata, "language", ""),
+			Naddr:        naddr,
+			CreatedAt:    int64(bookEvent.CreatedAt),
+			Contributors: contributors,
+			Structure:    bookStructure,
 		},
-		"content_format": format,
-		"include_images": includeImages,
-		"max_depth":      depth,
-		"timestamp":      time.Now().Unix(),
+		ContentFormat: format,
+		IncludeImages: includeImages,
+		MaxDepth:      depth,
+		Timestamp:     time.Now().Unix(),
 	}
 
 	json.NewEncoder(w).Encode(response)
 }
 
-func (r *RESTAPIServer) buildBookStructure(bookEvent *models.Event, contentEvents []*models.Event, maxDepth int) map[string]interface{} {
+func (r *RESTAPIServer) buildBookStructure(bookEvent *models.Event, contentEvents []*models.Event, authors map[string]*ebooks.Contributor, maxDepth int) *ebooks.Node {
 	// Build hierarchical book structure from content events
 	// This creates a tree structure suitable for e-paper readers
 
-	structure := map[string]interface{}{
-		"title":    "Book Structure",
-		"type":     "root",
-		"children": []map[string]interface{}{},
+	structure := &ebooks.Node{
+		Title:    "Book Structure",
+		Type:     "root",
+		Children: []*ebooks.Node{},
 	}
 
 	// Sort content events by creation time and d tag
@@ -776,7 +1121,7 @@ func (r *RESTAPIServer) buildBookStructure(bookEvent *models.Event, contentEvent
 
 	// Build hierarchy based on d tag values
 	// d tag format: "chapter-1", "chapter-1-section-1", etc.
-	stack := []map[string]interface{}{structure}
+	stack := []*ebooks.Node{structure}
 
 	for _, event := range sortedContent {
 		// Get the d tag value
@@ -807,25 +1152,29 @@ func (r *RESTAPIServer) buildBookStructure(bookEvent *models.Event, contentEvent
 		}
 
 		// Create content node
-		contentNode := map[string]interface{}{
-			"id":         event.ID,
-			"title":      content["title"],
-			"type":       content["type"], // chapter, section, subsection, etc.
-			"content":    content["content"],
-			"format":     content["format"], // asciidoc, markdown, etc.
-			"created_at": int64(event.CreatedAt),
-			"children":   []map[string]interface{}{},
+		contentNode := &ebooks.Node{
+			ID:        event.ID,
+			Title:     getString(content, "title", ""),
+			Type:      getString(content, "type", ""), // chapter, section, subsection, etc.
+			Content:   getString(content, "content", ""),
+			Format:    getString(content, "format", ""), // asciidoc, markdown, etc.
+			CreatedAt: int64(event.CreatedAt),
+			Children:  []*ebooks.Node{},
+		}
+
+		// Mark who wrote the section
+		if author, ok := authors[event.PubKey]; ok {
+			contentNode.Author = author
 		}
 
 		// Add images if requested
 		if images, ok := content["images"].([]interface{}); ok {
-			contentNode["images"] = images
+			contentNode.Images = images
 		}
 
 		// Add to parent
-		if parent, ok := stack[len(stack)-1]["children"].([]map[string]interface{}); ok {
-			stack[len(stack)-1]["children"] = append(parent, contentNode)
-		}
+		parent := stack[len(stack)-1]
+		parent.Children = append(parent.Children, contentNode)
 
 		// Add to stack for potential children
 		if depth < maxDepth {
@@ -890,7 +1239,7 @@ func (r *RESTAPIServer) HandleEbookEPUB(w http.ResponseWriter, req *http.Request
 		IDs:   []string{bookID},
 	}
 
-	bookEvents, err := r.cache.GetEvents(bookFilter)
+	bookEvents, err := cache.Collect(r.cache.GetEvents(req.Context(), bookFilter))
 	if err != nil {
 		r.sendError(w, fmt.Sprintf("Failed to get book: %v", err), http.StatusInternalServerError)
 		return
@@ -925,40 +1274,21 @@ func (r *RESTAPIServer) HandleEbookEPUB(w http.ResponseWriter, req *http.Request
 	}
 
 	// Get content events (kind 30041) for this book
-	contentFilter := nostr.Filter{
-		Kinds:   []int{30041},
-		Authors: []string{bookEvent.PubKey},
-	}
-
-	contentEvents, err := r.cache.GetEvents(contentFilter)
+	bookContent, err := r.resolveBookSections(req.Context(), bookEvent, bookIdentifier)
 	if err != nil {
 		r.sendError(w, fmt.Sprintf("Failed to get content: %v", err), http.StatusInternalServerError)
 		return
 	}
 
-	// Filter content events by book identifier
-	var bookContent []*models.Event
-	for _, event := range contentEvents {
-		for _, tag := range event.Tags {
-			if len(tag) >= 2 && tag[0] == "a" {
-				address := fmt.Sprintf("30040:%s:%s", bookEvent.PubKey, bookIdentifier)
-				if tag[1] == address {
-					bookContent = append(bookContent, event)
-					break
-				}
-			}
-		}
-	}
-
 	// Generate EPUB
-	epubData, err := r.generateEPUB(bookEvent, bookContent, bookMetadata, includeImages)
+	epubData, err := r.generateEPUB(req.Context(), bookEvent, bookContent, bookMetadata, includeImages)
 	if err != nil {
 		r.sendError(w, fmt.Sprintf("Failed to generate EPUB: %v", err), http.StatusInternalServerError)
 		return
 	}
 
 	// Set headers for file download
-	filename := fmt.Sprintf("%s.epub", sanitizeFilename(bookMetadata["title"].(string)))
+	filename := fmt.Sprintf("%s.epub", sanitizeFilename(getString(bookMetadata, "title", bookIdentifier)))
 	w.Header().Set("Content-Type", "application/epub+zip")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", filename))
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", len(epubData)))
@@ -968,7 +1298,7 @@ func (r *RESTAPIServer) HandleEbookEPUB(w http.ResponseWriter, req *http.Request
 	w.Write(epubData)
 }
 
-func (r *RESTAPIServer) generateEPUB(bookEvent *models.Event, contentEvents []*models.Event, metadata map[string]interface{}, includeImages bool) ([]byte, error) {
+func (r *RESTAPIServer) generateEPUB(ctx context.Context, bookEvent *models.Event, contentEvents []*models.Event, metadata map[string]interface{}, includeImages bool) ([]byte, error) {
 	// Generate EPUB from Nostr book content
 	// This creates a proper EPUB structure with all necessary files
 
@@ -979,51 +1309,63 @@ func (r *RESTAPIServer) generateEPUB(bookEvent *models.Event, contentEvents []*m
 		Language:    getString(metadata, "language", "en"),
 		Description: getString(metadata, "description", ""),
 		Publisher:   "Mercury Relay",
-		Date:        bookEvent.CreatedAt.Time().Format("2006-01-02"),
+		Date:        bookEvent.CreatedTime().Format("2006-01-02"),
 		Identifier:  bookEvent.ID,
+		Modified:    bookEvent.CreatedTime(),
 		Content:     []EPUBChapter{},
-		Images:      []EPUBImage{},
 	}
 
-	// Sort content events by d tag for proper order
-	sortedContent := r.sortContentEvents(contentEvents)
+	// A verified cover image is embedded; books without one, or whose cover
+	// can't be fetched, get a generated one
+	if file := coverFile(r.resolveBookFiles(ctx, bookEvent, metadata)); file != nil {
+		image, err := r.fetchEPUBImage(ctx, file.URL, file.SHA256, "images/cover")
+		if err != nil {
+			log.Printf("Failed to fetch cover for book %s: %v", bookEvent.ID, err)
+		} else {
+			epub.Cover = image
+		}
+	}
+	if epub.Cover == nil {
+		data, err := r.covers.Render(bookCover(bookEvent, metadata), cover.FormatPNG, cover.DefaultWidth)
+		if err != nil {
+			log.Printf("Failed to generate cover for book %s: %v", bookEvent.ID, err)
+		} else {
+			epub.Cover = &EPUBImageData{Href: "images/cover.png", MimeType: "image/png", Data: data}
+		}
+	}
 
-	// Process content events into EPUB chapters
-	for i, event := range sortedContent {
-		// Parse content
+	// Sort content events by d tag for proper order, skipping sections
+	// whose content doesn't parse
+	var sections []*models.Event
+	var contents []map[string]interface{}
+	for _, event := range r.sortContentEvents(contentEvents) {
 		var content map[string]interface{}
 		if err := json.Unmarshal([]byte(event.Content), &content); err != nil {
 			continue
 		}
+		sections = append(sections, event)
+		contents = append(contents, content)
+	}
 
-		// Get d tag for chapter ordering
-		var dTag string
-		for _, tag := range event.Tags {
-			if len(tag) >= 2 && tag[0] == "d" {
-				dTag = tag[1]
-				break
-			}
-		}
+	// Wikilinks between sections point at their chapters
+	opts := render.Options{Wikilinks: sectionLinks(sections, func(i int, _ *models.Event) string {
+		return fmt.Sprintf("chapter-%d.xhtml", i+1)
+	})}
+
+	// Process content events into EPUB chapters
+	for i, event := range sections {
+		content := contents[i]
 
 		// Create chapter
 		chapter := EPUBChapter{
-			ID:      fmt.Sprintf("chapter-%d", i+1),
-			Title:   getString(content, "title", fmt.Sprintf("Chapter %d", i+1)),
-			Content: getString(content, "content", ""),
-			Format:  getString(content, "format", "asciidoc"),
-			Order:   dTag,
-		}
-
-		// Convert content format if needed
-		if chapter.Format == "asciidoc" {
-			chapter.Content = r.convertAsciiDocToHTML(chapter.Content)
-		} else if chapter.Format == "markdown" {
-			chapter.Content = r.convertMarkdownToHTML(chapter.Content)
+			ID:     fmt.Sprintf("chapter-%d", i+1),
+			Title:  getString(content, "title", fmt.Sprintf("Chapter %d", i+1)),
+			Format: getString(content, "format", render.FormatAsciiDoc),
+			Order:  eventDTag(event),
 		}
+		chapter.Content = render.HTML(getString(content, "content", ""), chapter.Format, opts)
 
-		epub.Content = append(epub.Content, chapter)
-
-		// Process images if requested
+		// Embed images if requested
 		if includeImages {
 			if images, ok := content["images"].([]interface{}); ok {
 				for _, img := range images {
@@ -1034,147 +1376,19 @@ func (r *RESTAPIServer) generateEPUB(bookEvent *models.Event, contentEvents []*m
 							Alt:     getString(imgMap, "alt", ""),
 							Caption: getString(imgMap, "caption", ""),
 						}
-						epub.Images = append(epub.Images, image)
+						r.embedChapterImage(ctx, epub, &chapter, image)
 					}
 				}
 			}
 		}
+
+		epub.Content = append(epub.Content, chapter)
 	}
 
 	// Generate EPUB file
 	return r.createEPUBFile(epub)
 }
 
-func (r *RESTAPIServer) convertAsciiDocToHTML(content string) string {
-	// Simple AsciiDoc to HTML conversion
-	// In a real implementation, you'd use a proper AsciiDoc parser
-
-	// Basic conversions
-	content = strings.ReplaceAll(content, "\n= ", "\n<h1>")
-	content = strings.ReplaceAll(content, "\n== ", "\n<h2>")
-	content = strings.ReplaceAll(content, "\n=== ", "\n<h3>")
-	content = strings.ReplaceAll(content, "\n==== ", "\n<h4>")
-
-	// Close headers
-	content = strings.ReplaceAll(content, "\n<h1>", "\n<h1>")
-	content = strings.ReplaceAll(content, "\n<h2>", "\n<h2>")
-	content = strings.ReplaceAll(content, "\n<h3>", "\n<h3>")
-	content = strings.ReplaceAll(content, "\n<h4>", "\n<h4>")
-
-	// Add closing tags
-	lines := strings.Split(content, "\n")
-	for i, line := range lines {
-		if strings.HasPrefix(line, "<h1>") || strings.HasPrefix(line, "<h2>") ||
-			strings.HasPrefix(line, "<h3>") || strings.HasPrefix(line, "<h4>") {
-			lines[i] = line + "</h1>"
-			if strings.HasPrefix(line, "<h2>") {
-				lines[i] = strings.ReplaceAll(lines[i], "</h1>", "</h2>")
-			} else if strings.HasPrefix(line, "<h3>") {
-				lines[i] = strings.ReplaceAll(lines[i], "</h1>", "</h3>")
-			} else if strings.HasPrefix(line, "<h4>") {
-				lines[i] = strings.ReplaceAll(lines[i], "</h1>", "</h4>")
-			}
-		}
-	}
-
-	// Convert paragraphs
-	content = strings.Join(lines, "\n")
-	content = strings.ReplaceAll(content, "\n\n", "\n<p>")
-	content = strings.ReplaceAll(content, "\n", "<br>\n")
-
-	return content
-}
-
-func (r *RESTAPIServer) convertMarkdownToHTML(content string) string {
-	// Simple Markdown to HTML conversion
-	// In a real implementation, you'd use a proper Markdown parser
-
-	// Headers
-	content = strings.ReplaceAll(content, "\n# ", "\n<h1>")
-	content = strings.ReplaceAll(content, "\n## ", "\n<h2>")
-	content = strings.ReplaceAll(content, "\n### ", "\n<h3>")
-	content = strings.ReplaceAll(content, "\n#### ", "\n<h4>")
-
-	// Bold and italic
-	content = strings.ReplaceAll(content, "**", "<strong>")
-	content = strings.ReplaceAll(content, "*", "<em>")
-
-	// Links
-	content = strings.ReplaceAll(content, "[", "<a href=\"")
-	content = strings.ReplaceAll(content, "](", "\">")
-	content = strings.ReplaceAll(content, ")", "</a>")
-
-	return content
-}
-
-func (r *RESTAPIServer) createEPUBFile(book *EPUBBook) ([]byte, error) {
-	// Create EPUB file structure
-	// This is a simplified implementation - in production you'd use a proper EPUB library
-
-	// For now, return a placeholder that indicates EPUB generation
-	// In a real implementation, you'd create:
-	// - mimetype file
-	// - META-INF/container.xml
-	// - OEBPS/content.opf
-	// - OEBPS/toc.ncx
-	// - OEBPS/*.xhtml files for each chapter
-	// - OEBPS/*.css for styling
-	// - OEBPS/images/* for images
-
-	epubData := fmt.Sprintf(`<?xml version="1.0" encoding="UTF-8"?>
-<package xmlns="http://www.idpf.org/2007/opf" version="2.0" unique-identifier="book-id">
-  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
-    <dc:title>%s</dc:title>
-    <dc:creator>%s</dc:creator>
-    <dc:language>%s</dc:language>
-    <dc:description>%s</dc:description>
-    <dc:publisher>%s</dc:publisher>
-    <dc:date>%s</dc:date>
-    <dc:identifier id="book-id">%s</dc:identifier>
-  </metadata>
-  <manifest>
-    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
-    <item id="css" href="style.css" media-type="text/css"/>
-    <item id="cover" href="cover.xhtml" media-type="application/xhtml+xml"/>
-    %s
-  </manifest>
-  <spine toc="ncx">
-    <itemref idref="cover"/>
-    %s
-  </spine>
-</package>`,
-		book.Title,
-		book.Author,
-		book.Language,
-		book.Description,
-		book.Publisher,
-		book.Date,
-		book.Identifier,
-		r.generateManifestItems(book),
-		r.generateSpineItems(book),
-	)
-
-	// In a real implementation, you'd create a proper ZIP file with all the EPUB structure
-	// For now, return the OPF content as a placeholder
-	return []byte(epubData), nil
-}
-
-func (r *RESTAPIServer) generateManifestItems(book *EPUBBook) string {
-	var items []string
-	for i := range book.Content {
-		items = append(items, fmt.Sprintf(`<item id="chapter-%d" href="chapter-%d.xhtml" media-type="application/xhtml+xml"/>`, i+1, i+1))
-	}
-	return strings.Join(items, "\n    ")
-}
-
-func (r *RESTAPIServer) generateSpineItems(book *EPUBBook) string {
-	var items []string
-	for i := range book.Content {
-		items = append(items, fmt.Sprintf(`<itemref idref="chapter-%d"/>`, i+1))
-	}
-	return strings.Join(items, "\n    ")
-}
-
 func getString(m map[string]interface{}, key, defaultValue string) string {
 	if value, ok := m[key].(string); ok {
 		return value
@@ -1200,14 +1414,16 @@ type EPUBBook struct {
 	Publisher   string
 	Date        string
 	Identifier  string
+	Modified    time.Time
 	Content     []EPUBChapter
-	Images      []EPUBImage
+	Images      []EPUBImageData // embedded chapter images
+	Cover       *EPUBImageData
 }
 
 type EPUBChapter struct {
 	ID      string
 	Title   string
-	Content string
+	Content string // XHTML
 	Format  string
 	Order   string
 }
@@ -1219,16 +1435,25 @@ type EPUBImage struct {
 	Caption string
 }
 
+// EPUBImageData is an image embedded in the EPUB rather than linked
+type EPUBImageData struct {
+	Href     string
+	MimeType string
+	Data     []byte
+	Source   string // URL it was fetched from
+}
+
+// sendError writes a problem+json error with the default code for statusCode
 func (r *RESTAPIServer) sendError(w http.ResponseWriter, message string, statusCode int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(statusCode)
+	r.sendProblem(w, statusCode, "", message)
+}
 
-	response := APIResponse{
-		Success: false,
-		Error:   message,
+// sendProblem writes a problem+json error with an explicit error code
+func (r *RESTAPIServer) sendProblem(w http.ResponseWriter, status int, code, detail string) {
+	if status >= 500 {
+		slog.Error("REST API error", "status", status, logging.KeyRequestID, w.Header().Get(problem.RequestIDHeader), "detail", detail)
 	}
-
-	json.NewEncoder(w).Encode(response)
+	problem.Write(w, status, code, detail)
 }
 
 // Admin handler methods
@@ -1293,6 +1518,251 @@ func (r *RESTAPIServer) HandleGetAdmins(w http.ResponseWriter, req *http.Request
 	})
 }
 
+// HandleGetTransports returns the runtime status of Tor, I2P and SSH (admin only)
+func (r *RESTAPIServer) HandleGetTransports(w http.ResponseWriter, req *http.Request) {
+	if r.transportMgr == nil {
+		r.sendError(w, "Transport manager not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	r.sendSuccess(w, map[string]interface{}{
+		"transports": r.transportMgr.GetTransportStatus(),
+	})
+}
+
+// HandleEnableTransport starts a transport without restarting the relay (admin only)
+func (r *RESTAPIServer) HandleEnableTransport(w http.ResponseWriter, req *http.Request) {
+	r.toggleTransport(w, req, true)
+}
+
+// HandleDisableTransport stops a running transport (admin only)
+func (r *RESTAPIServer) HandleDisableTransport(w http.ResponseWriter, req *http.Request) {
+	r.toggleTransport(w, req, false)
+}
+
+func (r *RESTAPIServer) toggleTransport(w http.ResponseWriter, req *http.Request, enable bool) {
+	if r.transportMgr == nil {
+		r.sendError(w, "Transport manager not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	name := mux.Vars(req)["name"]
+	adminNpub := r.auth.GetAuthenticatedNpub(req)
+
+	var err error
+	action := "disabled"
+	if enable {
+		action = "enabled"
+		err = r.transportMgr.EnableTransport(name)
+	} else {
+		err = r.transportMgr.DisableTransport(name)
+	}
+
+	if errors.Is(err, transport.ErrUnknownTransport) {
+		r.sendError(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		r.sendError(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	log.Printf("Admin %s %s transport %s", adminNpub, action, name)
+	r.sendSuccess(w, map[string]interface{}{
+		"message":    fmt.Sprintf("Transport %s %s", name, action),
+		"transports": r.transportMgr.GetTransportStatus(),
+	})
+}
+
+// HandleForwardingStats returns per-rule delivery metrics for event forwarding (admin only)
+func (r *RESTAPIServer) HandleForwardingStats(w http.ResponseWriter, req *http.Request) {
+	if r.forwarder == nil {
+		r.sendError(w, "Event forwarding is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	r.sendSuccess(w, map[string]interface{}{
+		"rules": r.forwarder.GetStats(),
+	})
+}
+
+// HandleNormalizationStats returns how many tag values were canonicalized at ingest (admin only)
+func (r *RESTAPIServer) HandleNormalizationStats(w http.ResponseWriter, req *http.Request) {
+	if r.normalizer == nil {
+		r.sendError(w, "Tag normalization is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	r.sendSuccess(w, r.normalizer.GetStats())
+}
+
+// HandleGetNotices returns the welcome NOTICE and pending scheduled notices (admin only)
+func (r *RESTAPIServer) HandleGetNotices(w http.ResponseWriter, req *http.Request) {
+	if r.notices == nil {
+		r.sendError(w, "Notices are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	r.sendSuccess(w, map[string]interface{}{
+		"welcome":   r.notices.GetWelcome(),
+		"scheduled": r.notices.List(),
+	})
+}
+
+// HandleSetWelcomeNotice replaces the welcome NOTICE template (admin only)
+func (r *RESTAPIServer) HandleSetWelcomeNotice(w http.ResponseWriter, req *http.Request) {
+	if r.notices == nil {
+		r.sendError(w, "Notices are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	var body struct {
+		Message string `json:"message"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		r.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if err := r.notices.SetWelcome(body.Message); err != nil {
+		r.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Admin %s updated the welcome notice", r.auth.GetAuthenticatedNpub(req))
+	r.sendSuccess(w, map[string]interface{}{
+		"welcome": body.Message,
+	})
+}
+
+// HandleScheduleNotice schedules a broadcast NOTICE (admin only). Omitting
+// "at" broadcasts immediately; "repeat" is a duration such as "24h".
+func (r *RESTAPIServer) HandleScheduleNotice(w http.ResponseWriter, req *http.Request) {
+	if r.notices == nil {
+		r.sendError(w, "Notices are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	var body struct {
+		ID      string    `json:"id"`
+		Message string    `json:"message"`
+		At      time.Time `json:"at"`
+		Repeat  string    `json:"repeat"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+		r.sendError(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	scheduled := config.ScheduledNotice{
+		ID:      body.ID,
+		Message: body.Message,
+		At:      body.At,
+	}
+	if body.Repeat != "" {
+		repeat, err := time.ParseDuration(body.Repeat)
+		if err != nil {
+			r.sendError(w, fmt.Sprintf("Invalid repeat interval: %v", err), http.StatusBadRequest)
+			return
+		}
+		scheduled.Repeat = repeat
+	}
+
+	scheduled, err := r.notices.Schedule(scheduled)
+	if err != nil {
+		r.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	log.Printf("Admin %s scheduled notice %s for %s", r.auth.GetAuthenticatedNpub(req), scheduled.ID, scheduled.At.Format(time.RFC3339))
+	r.sendSuccess(w, scheduled)
+}
+
+// HandleCancelNotice removes a scheduled notice (admin only)
+func (r *RESTAPIServer) HandleCancelNotice(w http.ResponseWriter, req *http.Request) {
+	if r.notices == nil {
+		r.sendError(w, "Notices are not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	id := mux.Vars(req)["id"]
+	if err := r.notices.Cancel(id); err != nil {
+		if errors.Is(err, notice.ErrNoticeNotFound) {
+			r.sendError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		r.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Admin %s cancelled notice %s", r.auth.GetAuthenticatedNpub(req), id)
+	r.sendSuccess(w, map[string]interface{}{
+		"message": fmt.Sprintf("Notice %s cancelled", id),
+	})
+}
+
+// HandleGetReportActions lists actions triggered by weighted reports and the
+// reports behind them (admin only)
+func (r *RESTAPIServer) HandleGetReportActions(w http.ResponseWriter, req *http.Request) {
+	if r.qualityControl == nil {
+		r.sendError(w, "Quality control is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	actions := r.qualityControl.ReportActions()
+	var events, pubkeys []string
+	for _, action := range actions {
+		if action.TargetType == "pubkey" {
+			pubkeys = append(pubkeys, action.Target)
+		} else {
+			events = append(events, action.Target)
+		}
+	}
+
+	response := map[string]interface{}{
+		"actions":   actions,
+		"reporters": r.qualityControl.ReporterStats(),
+	}
+	if notes := r.annotationsFor(annotations.TargetEvent, events); notes != nil {
+		response["event_annotations"] = notes
+	}
+	if notes := r.annotationsFor(annotations.TargetPubkey, pubkeys); notes != nil {
+		response["pubkey_annotations"] = notes
+	}
+	r.sendSuccess(w, response)
+}
+
+// HandleResolveReportAction records whether an automated action was correct
+// (admin only). Overturned actions are reverted.
+func (r *RESTAPIServer) HandleResolveReportAction(w http.ResponseWriter, req *http.Request) {
+	if r.qualityControl == nil {
+		r.sendError(w, "Quality control is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	var body struct {
+		Upheld *bool `json:"upheld"`
+	}
+	if err := json.NewDecoder(req.Body).Decode(&body); err != nil || body.Upheld == nil {
+		r.sendError(w, "Request body must set \"upheld\" to true or false", http.StatusBadRequest)
+		return
+	}
+
+	target := mux.Vars(req)["target"]
+	action, err := r.qualityControl.ResolveReportAction(target, *body.Upheld)
+	if err != nil {
+		if errors.Is(err, quality.ErrReportActionNotFound) {
+			r.sendError(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		r.sendProblem(w, http.StatusConflict, problem.CodeConflict, err.Error())
+		return
+	}
+
+	log.Printf("Admin %s marked report action on %s as %s", r.auth.GetAuthenticatedNpub(req), target, action.Resolution)
+	r.sendSuccess(w, action)
+}
+
 // Kind-based topic handlers
 
 // HandleKindEvents returns events from a specific kind queue
@@ -1,18 +1,66 @@
 package api
 
 import (
+	"archive/zip"
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
-
+	"time"
+
+	"mercury-relay/internal/access"
+	"mercury-relay/internal/annotations"
+	"mercury-relay/internal/archive"
+	"mercury-relay/internal/blocklist"
+	"mercury-relay/internal/bloom"
+	"mercury-relay/internal/cluster"
 	"mercury-relay/internal/config"
+	"mercury-relay/internal/disk"
+	"mercury-relay/internal/entitlement"
+	"mercury-relay/internal/identity"
+	"mercury-relay/internal/largeobj"
+	"mercury-relay/internal/live"
+	"mercury-relay/internal/maintenance"
+	"mercury-relay/internal/mirror"
 	"mercury-relay/internal/models"
+	"mercury-relay/internal/payments"
+	"mercury-relay/internal/probation"
+	"mercury-relay/internal/problem"
+	"mercury-relay/internal/profiling"
+	"mercury-relay/internal/push"
+	"mercury-relay/internal/quality"
+	"mercury-relay/internal/quarantine"
+	"mercury-relay/internal/rejection"
+	"mercury-relay/internal/reputation"
+	"mercury-relay/internal/search"
+	"mercury-relay/internal/seen"
+	"mercury-relay/internal/storage"
+	"mercury-relay/internal/transport"
+	"mercury-relay/internal/trending"
+	"mercury-relay/internal/web"
+	"mercury-relay/pkg/ebooks"
 	"mercury-relay/test/helpers"
 	"mercury-relay/test/mocks"
 
+	"github.com/gorilla/mux"
 	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+	"github.com/nbd-wtf/go-nostr/nip44"
 )
 
 func TestRESTAPIGetEvents(t *testing.T) {
@@ -153,6 +201,40 @@ func TestRESTAPIGetEvents(t *testing.T) {
 		helpers.AssertNoError(t, err)
 		helpers.AssertBoolEqual(t, true, response.Success)
 	})
+
+	t.Run("Query by tags", func(t *testing.T) {
+		mockCache := mocks.NewMockCache()
+		eg := models.NewEventGenerator()
+		npub := eg.GetRandomNpub()
+		root := eg.GenerateTextNote(npub, "Root", nostr.Tags{{"t", "books"}})
+		reply := eg.GenerateTextNote(npub, "Reply", nostr.Tags{{"e", root.ID}, {"t", "books"}})
+		other := eg.GenerateTextNote(npub, "Other", nostr.Tags{{"t", "music"}, {"p", npub}})
+		mockCache.SetEvents([]*models.Event{root, reply, other})
+		server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mockCache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+		query := func(rawQuery string) []interface{} {
+			w := httptest.NewRecorder()
+			server.HandleGetEvents(w, httptest.NewRequest("GET", "/api/v1/events?"+rawQuery, nil))
+			helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+			var response APIResponse
+			helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			events, _ := response.Data.([]interface{})
+			return events
+		}
+		helpers.AssertIntEqual(t, 2, len(query("%23t=books")))
+		helpers.AssertIntEqual(t, 3, len(query("%23t=books&%23t=music")))
+		helpers.AssertIntEqual(t, 1, len(query("%23t=books&%23e="+root.ID)))
+		helpers.AssertIntEqual(t, 0, len(query("%23t=music&%23e="+root.ID)))
+		helpers.AssertIntEqual(t, 1, len(query("ids="+other.ID+"&ids="+root.ID+"&%23p="+npub)))
+
+		// POST takes NIP-01 filters as they are
+		w := httptest.NewRecorder()
+		server.HandleGetEvents(w, httptest.NewRequest("POST", "/api/v1/events", strings.NewReader(`{"filter":{"kinds":[1],"#e":["`+root.ID+`"]}}`)))
+		var response APIResponse
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		events, _ := response.Data.([]interface{})
+		helpers.AssertIntEqual(t, 1, len(events))
+	})
 }
 
 func TestRESTAPIPublish(t *testing.T) {
@@ -198,6 +280,7 @@ func TestRESTAPIPublish(t *testing.T) {
 		err := json.Unmarshal(w.Body.Bytes(), &response)
 		helpers.AssertNoError(t, err)
 		helpers.AssertBoolEqual(t, true, response.Success)
+		helpers.AssertStringContains(t, w.Body.String(), `"nevent":"nevent1`)
 
 		// Verify event was published to queue
 		helpers.AssertIntEqual(t, 1, mockQueue.GetEventCount())
@@ -357,6 +440,318 @@ func TestRESTAPIEbooks(t *testing.T) {
 		ebooks := response["ebooks"].([]interface{})
 		helpers.AssertIntEqual(t, 1, len(ebooks))
 	})
+
+	t.Run("Linked file metadata is verified", func(t *testing.T) {
+		mockCache := mocks.NewMockCache()
+		mockQueue := mocks.NewMockQueue()
+		eg := models.NewEventGenerator()
+		npub := eg.GetRandomNpub()
+
+		cover := &models.Event{
+			ID:     strings.Repeat("c", 64),
+			PubKey: npub,
+			Kind:   models.KindFileMetadata,
+			Tags: nostr.Tags{
+				{"url", "https://cdn.example.com/cover.png"},
+				{"m", "image/png"},
+				{"x", strings.Repeat("ab", 32)},
+			},
+		}
+		broken := &models.Event{
+			ID:     strings.Repeat("d", 64),
+			PubKey: npub,
+			Kind:   models.KindFileMetadata,
+			Tags:   nostr.Tags{{"url", "https://cdn.example.com/a.pdf"}},
+		}
+
+		ebook := eg.GenerateEbook(npub, map[string]interface{}{
+			"title":  "Illustrated Book",
+			"format": "epub",
+			"cover":  "https://unverified.example.com/cover.png",
+		})
+		ebook.Tags = append(ebook.Tags,
+			nostr.Tag{"e", cover.ID, "", "cover"},
+			nostr.Tag{"e", broken.ID},
+		)
+
+		mockCache.SetEvents([]*models.Event{ebook, cover, broken})
+
+		server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mockQueue, mockCache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+		req := httptest.NewRequest("GET", "/api/v1/ebooks", nil)
+		w := httptest.NewRecorder()
+		server.HandleEbooks(w, req)
+
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+
+		var response map[string]interface{}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+		ebooks := response["ebooks"].([]interface{})
+		helpers.AssertIntEqual(t, 1, len(ebooks))
+		book := ebooks[0].(map[string]interface{})
+		helpers.AssertStringEqual(t, "https://cdn.example.com/cover.png", book["cover"].(string))
+
+		files := book["files"].([]interface{})
+		helpers.AssertIntEqual(t, 1, len(files))
+		helpers.AssertStringEqual(t, "cover", files[0].(map[string]interface{})["role"].(string))
+	})
+	t.Run("Multi-author publication content", func(t *testing.T) {
+		mockCache := mocks.NewMockCache()
+		mockQueue := mocks.NewMockQueue()
+		eg := models.NewEventGenerator()
+
+		owner := eg.GetRandomNpub()
+		coauthor := eg.GetRandomNpub()
+		for coauthor == owner {
+			coauthor = eg.GetRandomNpub()
+		}
+		forger := eg.GetRandomNpub()
+		for forger == owner || forger == coauthor {
+			forger = eg.GetRandomNpub()
+		}
+
+		ebook := eg.GenerateEbook(owner, map[string]interface{}{
+			"title":      "Anthology",
+			"identifier": "anthology",
+		})
+		ebook.Tags = append(ebook.Tags, nostr.Tag{"a", "30041:" + coauthor + ":epilogue"})
+
+		intro := eg.GenerateEbookContent(owner, "anthology", map[string]interface{}{
+			"identifier": "intro",
+			"title":      "Introduction",
+		})
+		epilogue := eg.GenerateEbookContent(coauthor, "other-book", map[string]interface{}{
+			"identifier": "epilogue",
+			"title":      "Epilogue",
+		})
+		// Same d tag, but not signed by the pubkey the index addresses
+		forged := eg.GenerateEbookContent(forger, "anthology", map[string]interface{}{
+			"identifier": "epilogue",
+			"title":      "Forged Epilogue",
+		})
+		profile := eg.GenerateUserMetadata(coauthor, map[string]interface{}{"name": "Coauthor"})
+
+		mockCache.SetEvents([]*models.Event{ebook, intro, epilogue, forged, profile})
+
+		server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mockQueue, mockCache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+		req := httptest.NewRequest("GET", "/api/v1/ebooks/"+ebook.ID+"/content", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": ebook.ID})
+		w := httptest.NewRecorder()
+		server.HandleEbookContent(w, req)
+
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+
+		var response map[string]interface{}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+		book := response["book"].(map[string]interface{})
+		sections := book["structure"].(map[string]interface{})["children"].([]interface{})
+		helpers.AssertIntEqual(t, 2, len(sections))
+
+		first := sections[0].(map[string]interface{})
+		helpers.AssertStringEqual(t, "Epilogue", first["title"].(string))
+		author := first["author"].(map[string]interface{})
+		helpers.AssertStringEqual(t, coauthor, author["pubkey"].(string))
+		helpers.AssertStringEqual(t, "Coauthor", author["name"].(string))
+
+		second := sections[1].(map[string]interface{})
+		helpers.AssertStringEqual(t, owner, second["author"].(map[string]interface{})["pubkey"].(string))
+
+		helpers.AssertIntEqual(t, 2, len(book["contributors"].([]interface{})))
+	})
+	t.Run("Content rendered as HTML", func(t *testing.T) {
+		mockCache := mocks.NewMockCache()
+		author := strings.Repeat("a", 64)
+		book := &models.Event{ID: strings.Repeat("b", 64), PubKey: author, Kind: 30040, CreatedAt: nostr.Now(),
+			Tags:    nostr.Tags{{"d", "atlas"}, {"a", "30041:" + author + ":maps"}, {"a", "30041:" + author + ":seas"}},
+			Content: `{"title":"Atlas"}`}
+		maps := &models.Event{ID: strings.Repeat("c", 64), PubKey: author, Kind: 30041, CreatedAt: nostr.Now(),
+			Tags: nostr.Tags{{"d", "maps"}}, Content: `{"title":"Maps","format":"markdown","content":"**North** is up, see [[The Seas]].\n\n- one\n- two"}`}
+		seas := &models.Event{ID: strings.Repeat("e", 64), PubKey: author, Kind: 30041, CreatedAt: nostr.Now(),
+			Tags: nostr.Tags{{"d", "seas"}}, Content: `{"title":"The Seas","content":"== Water\n\nBack to <<maps,the maps>>."}`}
+		mockCache.SetEvents([]*models.Event{book, maps, seas})
+		server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mockCache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+		req := httptest.NewRequest("GET", "/api/v1/ebooks/"+book.ID+"/content?format=html", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": book.ID})
+		w := httptest.NewRecorder()
+		server.HandleEbookContent(w, req)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+
+		var response ebooks.Content
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		sections := response.Book.Structure.Children
+		helpers.AssertIntEqual(t, 2, len(sections))
+		helpers.AssertStringEqual(t, "html", sections[0].Format)
+		helpers.AssertStringEqual(t, `<p><strong>North</strong> is up, see <a class="wikilink" href="#`+seas.ID+`">The Seas</a>.</p>`+"\n<ul>\n<li>one</li>\n<li>two</li>\n</ul>", sections[0].Content)
+		helpers.AssertStringContains(t, sections[1].Content, `<h2 id="_water">Water</h2>`)
+		helpers.AssertStringContains(t, sections[1].Content, `<a class="wikilink" href="#`+maps.ID+`">the maps</a>`)
+	})
+	t.Run("Generated cover for books without one", func(t *testing.T) {
+		mockCache := mocks.NewMockCache()
+		mockQueue := mocks.NewMockQueue()
+		eg := models.NewEventGenerator()
+
+		ebook := eg.GenerateEbook(eg.GetRandomNpub(), map[string]interface{}{
+			"title":  "Plain Book",
+			"author": "Nobody",
+		})
+		mockCache.SetEvents([]*models.Event{ebook})
+
+		server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mockQueue, mockCache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+		w := httptest.NewRecorder()
+		server.HandleEbooks(w, httptest.NewRequest("GET", "/api/v1/ebooks", nil))
+		var response map[string]interface{}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		book := response["ebooks"].([]interface{})[0].(map[string]interface{})
+		helpers.AssertStringEqual(t, "/api/v1/ebooks/"+ebook.ID+"/cover", book["cover"].(string))
+		helpers.AssertBoolEqual(t, true, book["cover_generated"].(bool))
+
+		req := httptest.NewRequest("GET", "/api/v1/ebooks/"+ebook.ID+"/cover?width=200", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": ebook.ID})
+		w = httptest.NewRecorder()
+		server.HandleEbookCover(w, req)
+
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringEqual(t, "image/png", w.Header().Get("Content-Type"))
+		helpers.AssertTrue(t, bytes.HasPrefix(w.Body.Bytes(), []byte("\x89PNG")))
+
+		// Unchanged covers are revalidated with the ETag
+		req = httptest.NewRequest("GET", "/api/v1/ebooks/"+ebook.ID+"/cover?width=200", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": ebook.ID})
+		req.Header.Set("If-None-Match", w.Header().Get("ETag"))
+		w = httptest.NewRecorder()
+		server.HandleEbookCover(w, req)
+		helpers.AssertIntEqual(t, http.StatusNotModified, w.Code)
+
+		req = httptest.NewRequest("GET", "/api/v1/ebooks/"+ebook.ID+"/cover?format=gif", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": ebook.ID})
+		w = httptest.NewRecorder()
+		server.HandleEbookCover(w, req)
+		helpers.AssertIntEqual(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestRESTAPIEbookRevisions(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	npub := "npub1revisionsauthor"
+
+	draft := &models.Event{
+		ID:        strings.Repeat("1", 64),
+		PubKey:    npub,
+		CreatedAt: 100,
+		Kind:      30040,
+		Tags: nostr.Tags{
+			{"d", "my-book"},
+			{"a", "30041:" + npub + ":chapter-1"},
+			{"a", "30041:" + npub + ":chapter-2"},
+		},
+		Content: `{"title":"Draft"}`,
+	}
+	final := &models.Event{
+		ID:        strings.Repeat("2", 64),
+		PubKey:    npub,
+		CreatedAt: 200,
+		Kind:      30040,
+		Tags: nostr.Tags{
+			{"d", "my-book"},
+			{"a", "30041:" + npub + ":chapter-1"},
+			{"a", "30041:" + npub + ":chapter-3"},
+			{"a", "30041:" + npub + ":chapter-2"},
+		},
+		Content: `{"title":"Final"}`,
+	}
+	mockCache.SetEvents([]*models.Event{draft, final})
+	mockCache.SetReplaceableEventHistory(30040, npub, "my-book", []map[string]interface{}{
+		{"event_id": final.ID, "version": float64(2), "created_at": float64(200)},
+		{"event_id": draft.ID, "version": float64(1), "created_at": float64(100)},
+	})
+
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mockCache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+	t.Run("Revisions are listed newest first", func(t *testing.T) {
+		req := mux.SetURLVars(httptest.NewRequest("GET", "/api/v1/ebooks/"+draft.ID+"/revisions", nil), map[string]string{"id": draft.ID})
+		w := httptest.NewRecorder()
+		server.HandleEbookRevisions(w, req)
+
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data struct {
+				Revisions []Revision `json:"revisions"`
+			} `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		helpers.AssertIntEqual(t, 2, len(response.Data.Revisions))
+		helpers.AssertIntEqual(t, 2, response.Data.Revisions[0].Version)
+		helpers.AssertBoolEqual(t, true, response.Data.Revisions[0].Current)
+		helpers.AssertStringEqual(t, draft.ID, response.Data.Revisions[1].EventID)
+	})
+
+	t.Run("Diff defaults to the latest two revisions", func(t *testing.T) {
+		req := mux.SetURLVars(httptest.NewRequest("GET", "/api/v1/ebooks/"+final.ID+"/diff", nil), map[string]string{"id": final.ID})
+		w := httptest.NewRecorder()
+		server.HandleEbookDiff(w, req)
+
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data struct {
+				Diff RevisionDiff `json:"diff"`
+			} `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+		diff := response.Data.Diff
+		helpers.AssertIntEqual(t, 1, len(diff.Metadata))
+		helpers.AssertStringEqual(t, "title", diff.Metadata[0].Section)
+		helpers.AssertStringEqual(t, "Final", diff.Metadata[0].To)
+		helpers.AssertIntEqual(t, 1, len(diff.Sections))
+		helpers.AssertStringEqual(t, "added", diff.Sections[0].Change)
+		helpers.AssertStringEqual(t, "30041:"+npub+":chapter-3", diff.Sections[0].Section)
+	})
+
+	t.Run("Unknown version is not found", func(t *testing.T) {
+		req := mux.SetURLVars(httptest.NewRequest("GET", "/api/v1/ebooks/"+final.ID+"/diff?from=7", nil), map[string]string{"id": final.ID})
+		w := httptest.NewRecorder()
+		server.HandleEbookDiff(w, req)
+
+		helpers.AssertIntEqual(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Content sections are compared by heading", func(t *testing.T) {
+		before := &models.Event{Kind: 30041, Content: "== Intro\nHello\n\n== Middle\nOld text\n\n== Cut\nGone"}
+		after := &models.Event{Kind: 30041, Content: "== Intro\nHello\n\n== Middle\nNew text\n\n== Outro\nBye"}
+
+		diff := diffRevisions(before, after)
+		helpers.AssertIntEqual(t, 3, len(diff.Sections))
+		helpers.AssertStringEqual(t, "Middle", diff.Sections[0].Section)
+		helpers.AssertStringEqual(t, "modified", diff.Sections[0].Change)
+		helpers.AssertStringEqual(t, "Outro", diff.Sections[1].Section)
+		helpers.AssertStringEqual(t, "added", diff.Sections[1].Change)
+		helpers.AssertStringEqual(t, "Cut", diff.Sections[2].Section)
+		helpers.AssertStringEqual(t, "removed", diff.Sections[2].Change)
+	})
+}
+
+func TestRESTAPIProblemResponses(t *testing.T) {
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+	req := httptest.NewRequest("GET", "/api/v1/events?kinds=abc", nil)
+	w := httptest.NewRecorder()
+	problem.Middleware(http.HandlerFunc(server.HandleGetEvents)).ServeHTTP(w, req)
+
+	helpers.AssertIntEqual(t, http.StatusBadRequest, w.Code)
+	helpers.AssertStringEqual(t, problem.ContentType, w.Header().Get("Content-Type"))
+
+	var p problem.Problem
+	helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+	helpers.AssertStringEqual(t, problem.CodeInvalidFilter, p.Code)
+	helpers.AssertStringEqual(t, w.Header().Get(problem.RequestIDHeader), p.RequestID)
+	helpers.AssertTrue(t, p.RequestID != "")
 }
 
 func TestRESTAPIHealth(t *testing.T) {
@@ -396,6 +791,384 @@ func TestRESTAPIHealth(t *testing.T) {
 	})
 }
 
+func TestRESTAPIEndpoints(t *testing.T) {
+	t.Run("Lists reachable transports", func(t *testing.T) {
+		// A listener stands in for the gRPC server
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		helpers.AssertNoError(t, err)
+		defer listener.Close()
+		port := listener.Addr().(*net.TCPAddr).Port
+
+		cfg := &config.Config{GRPC: config.GRPCConfig{Enabled: true, ServerHost: "127.0.0.1", ServerPort: port}}
+		server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "wss://relay.example.com", cfg)
+		server.SetTransportManager(transport.NewManager(config.TorConfig{}, config.I2PConfig{}, config.SSHConfig{}))
+
+		w := httptest.NewRecorder()
+		server.HandleEndpoints(w, httptest.NewRequest("GET", "/api/v1/endpoints", nil))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data struct {
+				Endpoints []transport.Endpoint `json:"endpoints"`
+			} `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+
+		endpoints := response.Data.Endpoints
+		helpers.AssertIntEqual(t, 2, len(endpoints))
+		helpers.AssertStringEqual(t, "websocket", endpoints[0].Transport)
+		helpers.AssertStringEqual(t, "wss://relay.example.com", endpoints[0].URL)
+		helpers.AssertStringEqual(t, "grpc", endpoints[1].Transport)
+		helpers.AssertStringEqual(t, fmt.Sprintf("grpc://127.0.0.1:%d", port), endpoints[1].URL)
+	})
+
+	t.Run("Unreachable gRPC is left out", func(t *testing.T) {
+		// Nothing listens on port 1
+		cfg := &config.Config{GRPC: config.GRPCConfig{Enabled: true, ServerHost: "127.0.0.1", ServerPort: 1}}
+		server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "wss://relay.example.com", cfg)
+
+		w := httptest.NewRecorder()
+		server.HandleEndpoints(w, httptest.NewRequest("GET", "/api/v1/endpoints", nil))
+
+		var response map[string]interface{}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		endpoints := response["data"].(map[string]interface{})["endpoints"].([]interface{})
+		helpers.AssertIntEqual(t, 1, len(endpoints))
+	})
+}
+
+func TestRESTAPIEventProvenance(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mockCache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+	eg := models.NewEventGenerator()
+	note := eg.GenerateTextNote(eg.GetRandomNpub(), "Where did this come from?", nostr.Tags{})
+	note.AddProvenance(models.ProvenanceUpstream, "wss://relay.example.com", "")
+	note.AddProvenance(models.ProvenanceREST, "203.0.113.7:5000", "npub1publisher")
+	mockCache.StoreEvent(note)
+
+	t.Run("Lists sightings in order", func(t *testing.T) {
+		req := mux.SetURLVars(httptest.NewRequest("GET", "/api/v1/admin/events/"+note.ID+"/provenance", nil), map[string]string{"id": note.ID})
+		w := httptest.NewRecorder()
+		server.HandleEventProvenance(w, req)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data struct {
+				EventID    string              `json:"event_id"`
+				Provenance []models.Provenance `json:"provenance"`
+			} `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		helpers.AssertStringEqual(t, note.ID, response.Data.EventID)
+		helpers.AssertIntEqual(t, 2, len(response.Data.Provenance))
+		helpers.AssertStringEqual(t, models.ProvenanceUpstream, response.Data.Provenance[0].Source)
+		helpers.AssertStringEqual(t, "npub1publisher", response.Data.Provenance[1].Pubkey)
+	})
+
+	t.Run("Unknown event", func(t *testing.T) {
+		id := strings.Repeat("a", 64)
+		req := mux.SetURLVars(httptest.NewRequest("GET", "/api/v1/admin/events/"+id+"/provenance", nil), map[string]string{"id": id})
+		w := httptest.NewRecorder()
+		server.HandleEventProvenance(w, req)
+		helpers.AssertIntEqual(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestRESTAPIMirror(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockQueue := mocks.NewMockQueue()
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mockQueue, mockCache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+	sk := nostr.GeneratePrivateKey()
+	owner, _ := nostr.GetPublicKey(sk)
+	m, err := mirror.NewMirror(config.MirrorConfig{Enabled: true, Authors: []string{owner}}, nil, mockCache, nil)
+	helpers.AssertNoError(t, err)
+	server.SetMirror(m)
+
+	publish := func(event *models.Event) {
+		reqBody, _ := json.Marshal(PublishRequest{Event: *event})
+		w := httptest.NewRecorder()
+		server.HandlePublish(w, httptest.NewRequest("POST", "/api/v1/publish", bytes.NewReader(reqBody)))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+	}
+
+	t.Run("Marks signed events of mirrored authors", func(t *testing.T) {
+		mockQueue.Clear()
+		// Older than the usual age limit
+		signed := nostr.Event{PubKey: owner, CreatedAt: nostr.Timestamp(time.Now().Add(-48 * time.Hour).Unix()), Kind: 1, Tags: nostr.Tags{}, Content: "From the archive"}
+		signed.Sign(sk)
+		publish(models.FromNostrEvent(&signed))
+
+		helpers.AssertIntEqual(t, 1, mockQueue.GetEventCount())
+		helpers.AssertTrue(t, mockQueue.GetEvents()[0].Mirrored)
+	})
+
+	t.Run("Ignores the flag from clients", func(t *testing.T) {
+		mockQueue.Clear()
+		eg := models.NewEventGenerator()
+		event := eg.GenerateTextNote(eg.GetRandomNpub(), "Keep me forever", nostr.Tags{})
+		event.Mirrored = true
+		publish(event)
+
+		helpers.AssertIntEqual(t, 1, mockQueue.GetEventCount())
+		helpers.AssertFalse(t, mockQueue.GetEvents()[0].Mirrored)
+	})
+
+	t.Run("Lists mirrored authors", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.HandleGetMirror(w, httptest.NewRequest("GET", "/api/v1/admin/mirror", nil))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data struct {
+				Authors []mirror.Report `json:"authors"`
+			} `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		helpers.AssertIntEqual(t, 1, len(response.Data.Authors))
+		helpers.AssertStringEqual(t, owner, response.Data.Authors[0].Pubkey)
+		// Not synced yet
+		helpers.AssertFalse(t, response.Data.Authors[0].Complete)
+	})
+
+	t.Run("Reports by npub", func(t *testing.T) {
+		npub, _ := nip19.EncodePublicKey(owner)
+		req := mux.SetURLVars(httptest.NewRequest("GET", "/api/v1/admin/mirror/"+npub, nil), map[string]string{"pubkey": npub})
+		w := httptest.NewRecorder()
+		server.HandleGetMirrorReport(w, req)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Unknown author", func(t *testing.T) {
+		other := strings.Repeat("b", 64)
+		req := mux.SetURLVars(httptest.NewRequest("GET", "/api/v1/admin/mirror/"+other, nil), map[string]string{"pubkey": other})
+		w := httptest.NewRecorder()
+		server.HandleGetMirrorReport(w, req)
+		helpers.AssertIntEqual(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestRESTAPITopicSSE(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mockCache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+	eg := models.NewEventGenerator()
+	author := eg.GetRandomNpub()
+	root := eg.GenerateTextNote(author, "What are you reading?", nostr.Tags{})
+	root.Kind = 11
+	comment := eg.GenerateTextNote(author, "A book about relays", nostr.Tags{{"E", root.ID}, {"K", "11"}})
+	comment.Kind = 1111
+	comment.CreatedAt = root.CreatedAt + 1
+	elsewhere := eg.GenerateTextNote(author, "Other thread", nostr.Tags{{"E", strings.Repeat("b", 64)}})
+	elsewhere.Kind = 1111
+	mockCache.StoreEvent(root)
+	mockCache.StoreEvent(comment)
+	mockCache.StoreEvent(elsewhere)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/v1/sse/thread/{id}", server.HandleThreadSSE)
+	router.HandleFunc("/api/v1/sse/group/{group}", server.HandleGroupSSE)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	// readIDs collects event IDs until the next event named until
+	readIDs := func(reader *bufio.Reader, until string) []string {
+		var ids []string
+		for {
+			line, err := reader.ReadString('\n')
+			helpers.AssertNoError(t, err)
+			line = strings.TrimSpace(line)
+			if strings.HasPrefix(line, "id: ") {
+				ids = append(ids, strings.TrimPrefix(line, "id: "))
+			}
+			if line == "event: "+until {
+				return ids
+			}
+		}
+	}
+
+	t.Run("Thread replays stored events then streams new ones", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "/api/v1/sse/thread/" + root.ID)
+		helpers.AssertNoError(t, err)
+		defer resp.Body.Close()
+		helpers.AssertStringEqual(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+		reader := bufio.NewReader(resp.Body)
+		backlog := readIDs(reader, "eose")
+		helpers.AssertIntEqual(t, 2, len(backlog))
+		helpers.AssertStringEqual(t, root.ID, backlog[0])
+		helpers.AssertStringEqual(t, comment.ID, backlog[1])
+
+		reply := eg.GenerateTextNote(author, "Me too", nostr.Tags{{"E", root.ID}})
+		reply.Kind = 1111
+		server.DeliverEvent(elsewhere)
+		server.DeliverEvent(reply)
+
+		line, err := reader.ReadString('\n')
+		for err == nil && !strings.HasPrefix(line, "id: ") {
+			line, err = reader.ReadString('\n')
+		}
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, "id: "+reply.ID, strings.TrimSpace(line))
+	})
+
+	t.Run("Group stream follows the h tag", func(t *testing.T) {
+		chat := eg.GenerateTextNote(author, "gm", nostr.Tags{{"h", "readers"}})
+		chat.Kind = 9
+		mockCache.StoreEvent(chat)
+
+		resp, err := http.Get(ts.URL + "/api/v1/sse/group/readers")
+		helpers.AssertNoError(t, err)
+		defer resp.Body.Close()
+
+		backlog := readIDs(bufio.NewReader(resp.Body), "eose")
+		helpers.AssertIntEqual(t, 1, len(backlog))
+		helpers.AssertStringEqual(t, chat.ID, backlog[0])
+	})
+
+	t.Run("Invalid thread root", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := mux.SetURLVars(httptest.NewRequest("GET", "/api/v1/sse/thread/nope", nil), map[string]string{"id": "nope"})
+		server.HandleThreadSSE(w, req)
+		helpers.AssertIntEqual(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestRESTAPIStream(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	restConfig := config.RESTAPIConfig{Enabled: true, Stream: config.StreamConfig{MaxStreamsPerClient: 1, MaxFilterValues: 3}}
+	server := NewRESTAPIServer(restConfig, nil, mocks.NewMockQueue(), mockCache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+	eg := models.NewEventGenerator()
+	author := strings.Repeat("a", 64)
+	stored := eg.GenerateTextNote(author, "Already here", nostr.Tags{})
+	mockCache.StoreEvent(stored)
+
+	ts := httptest.NewServer(http.HandlerFunc(server.HandleStream))
+	defer ts.Close()
+
+	type message struct {
+		Type string `json:"type"`
+		Data struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	next := func(reader *bufio.Reader) message {
+		line, err := reader.ReadString('\n')
+		helpers.AssertNoError(t, err)
+		var m message
+		helpers.AssertNoError(t, json.Unmarshal([]byte(line), &m))
+		return m
+	}
+
+	t.Run("Stored events then new matching ones", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "?kinds=1&authors=" + author)
+		helpers.AssertNoError(t, err)
+		defer resp.Body.Close()
+		helpers.AssertIntEqual(t, http.StatusOK, resp.StatusCode)
+
+		reader := bufio.NewReader(resp.Body)
+		first := next(reader)
+		helpers.AssertStringEqual(t, "event", first.Type)
+		helpers.AssertStringEqual(t, stored.ID, first.Data.ID)
+		helpers.AssertStringEqual(t, "eose", next(reader).Type)
+
+		// A second stream from the same client is over the limit
+		second, err := http.Get(ts.URL + "?kinds=1")
+		helpers.AssertNoError(t, err)
+		second.Body.Close()
+		helpers.AssertIntEqual(t, http.StatusTooManyRequests, second.StatusCode)
+
+		other := eg.GenerateTextNote(strings.Repeat("b", 64), "Someone else", nostr.Tags{})
+		quarantined := eg.GenerateTextNote(author, "Held back", nostr.Tags{})
+		quarantined.IsQuarantined = true
+		fresh := eg.GenerateTextNote(author, "Just arrived", nostr.Tags{})
+		server.DeliverEvent(stored)
+		server.DeliverEvent(other)
+		server.DeliverEvent(quarantined)
+		server.DeliverEvent(fresh)
+
+		live := next(reader)
+		helpers.AssertStringEqual(t, "event", live.Type)
+		helpers.AssertStringEqual(t, fresh.ID, live.Data.ID)
+	})
+
+	t.Run("Past until ends after stored events", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "?until=1")
+		helpers.AssertNoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, `{"type":"eose"}`, strings.TrimSpace(string(body)))
+	})
+
+	t.Run("Filter limits", func(t *testing.T) {
+		resp, err := http.Get(ts.URL + "?kinds=1&kinds=2&kinds=3&kinds=4")
+		helpers.AssertNoError(t, err)
+		resp.Body.Close()
+		helpers.AssertIntEqual(t, http.StatusBadRequest, resp.StatusCode)
+
+		resp, err = http.Get(ts.URL + "?kinds=note")
+		helpers.AssertNoError(t, err)
+		resp.Body.Close()
+		helpers.AssertIntEqual(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func TestRESTAPISSEEvents(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mockCache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+	eg := models.NewEventGenerator()
+	author := strings.Repeat("a", 64)
+	stored := eg.GenerateTextNote(author, "Already here", nostr.Tags{})
+	mockCache.StoreEvent(stored)
+
+	ts := httptest.NewServer(http.HandlerFunc(server.HandleSSE))
+	defer ts.Close()
+
+	resp, err := http.Get(ts.URL + "?type=events&kinds=1&authors=" + author)
+	helpers.AssertNoError(t, err)
+	defer resp.Body.Close()
+	helpers.AssertStringEqual(t, "text/event-stream", resp.Header.Get("Content-Type"))
+
+	// nextEvent reads up to the next blank line, returning the event name
+	// and its id
+	reader := bufio.NewReader(resp.Body)
+	nextEvent := func() (string, string) {
+		var name, id string
+		for {
+			line, err := reader.ReadString('\n')
+			helpers.AssertNoError(t, err)
+			line = strings.TrimSpace(line)
+			switch {
+			case line == "":
+				return name, id
+			case strings.HasPrefix(line, "event: "):
+				name = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "id: "):
+				id = strings.TrimPrefix(line, "id: ")
+			}
+		}
+	}
+
+	name, id := nextEvent()
+	helpers.AssertStringEqual(t, "nostr", name)
+	helpers.AssertStringEqual(t, stored.ID, id)
+	name, _ = nextEvent()
+	helpers.AssertStringEqual(t, "eose", name)
+
+	other := eg.GenerateTextNote(strings.Repeat("b", 64), "Someone else", nostr.Tags{})
+	fresh := eg.GenerateTextNote(author, "Just arrived", nostr.Tags{})
+	server.DeliverEvent(other)
+	server.DeliverEvent(fresh)
+
+	name, id = nextEvent()
+	helpers.AssertStringEqual(t, "nostr", name)
+	helpers.AssertStringEqual(t, fresh.ID, id)
+}
+
 func TestRESTAPIStats(t *testing.T) {
 	t.Run("Get relay stats", func(t *testing.T) {
 		// Setup
@@ -434,8 +1207,100 @@ func TestRESTAPIStats(t *testing.T) {
 		helpers.AssertIntEqual(t, 0, int(stats["cache_size"].(float64)))
 		helpers.AssertIntEqual(t, 0, int(stats["queue_size"].(float64)))
 	})
+
+	t.Run("Connection and REQ counters", func(t *testing.T) {
+		server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+		server.SetConnectionSource(&fakeConnectionSource{
+			connections: []ConnectionInfo{
+				{RemoteAddr: "10.0.0.1:5000", ConnectedAt: time.Now().Add(-time.Hour), REQs: 12},
+				{RemoteAddr: "10.0.0.2:5000", ConnectedAt: time.Now(), REQs: 20, RateLimited: 300, ActiveReplays: 4},
+			},
+			reqs: map[string]int64{"accepted": 32, "rate_limited": 300, "replay_limited": 0},
+		})
+
+		w := httptest.NewRecorder()
+		server.HandleStats(w, httptest.NewRequest("GET", "/api/v1/stats", nil))
+
+		var stats StatsResponse
+		var response struct {
+			Data *StatsResponse `json:"data"`
+		}
+		response.Data = &stats
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		helpers.AssertIntEqual(t, 2, stats.ActiveConnections)
+		helpers.AssertInt64Equal(t, 300, stats.REQStats["rate_limited"])
+
+		// The admin view lists the noisiest connection first
+		w = httptest.NewRecorder()
+		server.HandleGetConnections(w, httptest.NewRequest("GET", "/api/v1/admin/connections", nil))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+
+		var view struct {
+			Data struct {
+				Connections []ConnectionInfo `json:"connections"`
+				Count       int              `json:"count"`
+			} `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &view))
+		helpers.AssertIntEqual(t, 2, view.Data.Count)
+		helpers.AssertStringEqual(t, "10.0.0.2:5000", view.Data.Connections[0].RemoteAddr)
+		helpers.AssertIntEqual(t, 4, view.Data.Connections[0].ActiveReplays)
+	})
+
+	t.Run("Storage disk usage", func(t *testing.T) {
+		server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+		monitor := disk.NewMonitor(config.DiskConfig{Interval: time.Minute, WarnPercent: 101, CriticalPercent: 102}, t.TempDir())
+		monitor.Check(context.Background())
+		server.SetDiskMonitor(monitor)
+
+		w := httptest.NewRecorder()
+		server.HandleStats(w, httptest.NewRequest("GET", "/api/v1/stats", nil))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data struct {
+				Storage struct {
+					Level string       `json:"level"`
+					Paths []disk.Usage `json:"paths"`
+				} `json:"storage"`
+			} `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		helpers.AssertStringEqual(t, disk.LevelOK, response.Data.Storage.Level)
+		helpers.AssertIntEqual(t, 1, len(response.Data.Storage.Paths))
+	})
+
+	t.Run("Cluster members and job leaders", func(t *testing.T) {
+		server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+		store := cluster.NewMemoryStore()
+		node := cluster.NewNode(config.ClusterConfig{InstanceID: "relay-1", LeaseTTL: time.Minute}, store)
+		server.SetCluster(node)
+		store.Heartbeat(context.Background(), cluster.Member{ID: "relay-1", LastSeen: time.Now()}, time.Minute)
+		store.Heartbeat(context.Background(), cluster.Member{ID: "relay-2", LastSeen: time.Now(), Leading: []string{"archive"}}, time.Minute)
+		store.Acquire(context.Background(), "archive", "relay-2", time.Minute)
+
+		w := httptest.NewRecorder()
+		server.HandleStats(w, httptest.NewRequest("GET", "/api/v1/stats", nil))
+		var response struct {
+			Data StatsResponse `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		status := response.Data.Cluster
+		helpers.AssertNotNil(t, status)
+		helpers.AssertStringEqual(t, "relay-1", status.Instance)
+		helpers.AssertIntEqual(t, 2, len(status.Members))
+		helpers.AssertStringEqual(t, "relay-2", status.Leaders["archive"])
+	})
+}
+
+type fakeConnectionSource struct {
+	connections []ConnectionInfo
+	reqs        map[string]int64
 }
 
+func (f *fakeConnectionSource) Connections() []ConnectionInfo { return f.connections }
+func (f *fakeConnectionSource) REQStats() map[string]int64    { return f.reqs }
+
 func TestRESTAPICORS(t *testing.T) {
 	t.Run("CORS preflight request", func(t *testing.T) {
 		// Setup
@@ -495,9 +1360,76 @@ func TestRESTAPIRateLimiting(t *testing.T) {
 	})
 }
 
-// Mock implementations for testing
+func TestRESTAPIRateLimitHeaders(t *testing.T) {
+	t.Run("Query budget counts down under a burst", func(t *testing.T) {
+		cfg := config.RESTAPIConfig{Enabled: true, RateLimitPerMinute: 3}
+		server := NewRESTAPIServer(cfg, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+		handler := server.rateLimitMiddleware(http.HandlerFunc(server.HandleGetEvents))
 
-type MockQualityController struct{}
+		for i, expected := range []string{"2", "1", "0"} {
+			req := httptest.NewRequest("GET", "/api/v1/events", nil)
+			req.Header.Set("X-Nostr-Pubkey", "npub1burst")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+			helpers.AssertStringEqual(t, "3", w.Header().Get("X-RateLimit-Limit"))
+			helpers.AssertStringEqual(t, expected, w.Header().Get("X-RateLimit-Remaining"))
+			if i == 0 {
+				reset, err := strconv.ParseInt(w.Header().Get("X-RateLimit-Reset"), 10, 64)
+				helpers.AssertNoError(t, err)
+				helpers.AssertTrue(t, reset > time.Now().Unix() && reset <= time.Now().Add(time.Minute).Unix())
+			}
+		}
+
+		req := httptest.NewRequest("GET", "/api/v1/events", nil)
+		req.Header.Set("X-Nostr-Pubkey", "npub1burst")
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+
+		helpers.AssertIntEqual(t, http.StatusTooManyRequests, w.Code)
+		helpers.AssertStringEqual(t, "0", w.Header().Get("X-RateLimit-Remaining"))
+		helpers.AssertNotEqual(t, "", w.Header().Get("Retry-After"))
+
+		// Other clients have their own budget
+		req = httptest.NewRequest("GET", "/api/v1/events", nil)
+		req.Header.Set("X-Nostr-Pubkey", "npub1other")
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		helpers.AssertStringEqual(t, "2", w.Header().Get("X-RateLimit-Remaining"))
+	})
+
+	t.Run("Publish headers follow the quality rate limiter", func(t *testing.T) {
+		mockQueue := mocks.NewMockQueue()
+		mockCache := mocks.NewMockCache()
+		qc := quality.NewController(config.QualityConfig{
+			MaxContentLength:   10000,
+			RateLimitPerMinute: 2,
+		}, mockQueue, mockCache)
+		server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, qc, mockQueue, mockCache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+		eg := models.NewEventGenerator()
+		npub := eg.GetRandomNpub()
+		for i, expected := range []string{"1", "0", "0"} {
+			event := eg.GenerateTextNote(npub, fmt.Sprintf("message %d", i), nostr.Tags{})
+			reqBody, _ := json.Marshal(PublishRequest{Event: *event})
+			w := httptest.NewRecorder()
+			server.HandlePublish(w, httptest.NewRequest("POST", "/api/v1/publish", bytes.NewReader(reqBody)))
+
+			if i < 2 {
+				helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+			} else {
+				helpers.AssertIntEqual(t, http.StatusTooManyRequests, w.Code)
+			}
+			helpers.AssertStringEqual(t, "2", w.Header().Get("X-RateLimit-Limit"))
+			helpers.AssertStringEqual(t, expected, w.Header().Get("X-RateLimit-Remaining"))
+		}
+	})
+}
+
+// Mock implementations for testing
+
+type MockQualityController struct{}
 
 func (m *MockQualityController) ValidateEvent(event *models.Event) error {
 	return nil // Always pass validation for testing
@@ -588,3 +1520,1868 @@ func TestRESTAPIIntegration(t *testing.T) {
 		helpers.AssertIntEqual(t, 1, len(events))
 	})
 }
+
+func TestRESTAPISync(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mockCache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+	eg := models.NewEventGenerator()
+	npub := eg.GetRandomNpub()
+	var notes []*models.Event
+	for i := 0; i < 20; i++ {
+		note := eg.GenerateTextNote(npub, fmt.Sprintf("Note %d", i), nostr.Tags{})
+		notes = append(notes, note)
+		mockCache.StoreEvent(note)
+	}
+	other := eg.GenerateTextNote(npub, "Someone else", nostr.Tags{})
+	other.PubKey = strings.Repeat("0", 64)
+	mockCache.StoreEvent(other)
+
+	have, _ := bloom.New(4096, 7, 1)
+	for _, note := range notes[:15] {
+		helpers.AssertNoError(t, have.Add(note.ID))
+	}
+
+	sync := func(body interface{}) (*httptest.ResponseRecorder, []nostr.Event, bool) {
+		reqBody, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		server.HandleSync(w, httptest.NewRequest("POST", "/api/v1/sync", bytes.NewReader(reqBody)))
+
+		var response struct {
+			Data struct {
+				Events   []nostr.Event `json:"events"`
+				Complete bool          `json:"complete"`
+			} `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response.Data.Events, response.Data.Complete
+	}
+
+	t.Run("Returns only missing events", func(t *testing.T) {
+		w, events, complete := sync(SyncRequest{
+			Filter: nostr.Filter{Authors: []string{notes[0].PubKey}},
+			Bloom:  SyncBloom{Bits: have.Encode(), Hashes: 7, Tweak: 1},
+		})
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertTrue(t, complete)
+		helpers.AssertIntEqual(t, 5, len(events))
+
+		missing := make(map[string]bool)
+		for _, note := range notes[15:] {
+			missing[note.ID] = true
+		}
+		for _, event := range events {
+			helpers.AssertTrue(t, missing[event.ID])
+		}
+	})
+
+	t.Run("Limits the missing events", func(t *testing.T) {
+		_, events, complete := sync(SyncRequest{
+			Filter: nostr.Filter{Authors: []string{notes[0].PubKey}, Limit: 2},
+			Bloom:  SyncBloom{Bits: have.Encode(), Hashes: 7, Tweak: 1},
+		})
+		helpers.AssertIntEqual(t, 2, len(events))
+		helpers.AssertFalse(t, complete)
+	})
+
+	t.Run("Rejects malformed filters", func(t *testing.T) {
+		w, _, _ := sync(SyncRequest{Bloom: SyncBloom{Bits: "not base64!", Hashes: 7}})
+		helpers.AssertIntEqual(t, http.StatusBadRequest, w.Code)
+
+		w, _, _ = sync(SyncRequest{Bloom: SyncBloom{Bits: have.Encode(), Hashes: 0}})
+		helpers.AssertIntEqual(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestRESTAPIWriters(t *testing.T) {
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+	t.Run("Unavailable without access control", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.HandleGetPendingWriters(w, httptest.NewRequest("GET", "/api/v1/admin/writers/pending", nil))
+		helpers.AssertIntEqual(t, http.StatusServiceUnavailable, w.Code)
+	})
+
+	controller := access.NewController(config.AccessConfig{WriterApproval: true})
+	server.SetAccessController(controller)
+
+	writer := strings.Repeat("ab", 32)
+	_, err := controller.RequestWrite(&nostr.Event{PubKey: writer, Kind: 1, Content: "Hello"})
+	helpers.AssertNoError(t, err)
+
+	t.Run("Lists pending writers", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.HandleGetPendingWriters(w, httptest.NewRequest("GET", "/api/v1/admin/writers/pending", nil))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data struct {
+				Writers []access.PendingWriter `json:"writers"`
+			} `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		helpers.AssertIntEqual(t, 1, len(response.Data.Writers))
+		helpers.AssertStringEqual(t, "Hello", response.Data.Writers[0].Sample.Content)
+	})
+
+	t.Run("Approves by npub", func(t *testing.T) {
+		npub, _ := nip19.EncodePublicKey(writer)
+		req := mux.SetURLVars(httptest.NewRequest("POST", "/api/v1/admin/writers/"+npub+"/approve", nil), map[string]string{"pubkey": npub})
+		w := httptest.NewRecorder()
+		server.HandleApproveWriter(w, req)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertTrue(t, controller.CanWrite(writer))
+		helpers.AssertIntEqual(t, 0, len(controller.PendingWriters()))
+	})
+
+	t.Run("Denies", func(t *testing.T) {
+		req := mux.SetURLVars(httptest.NewRequest("POST", "/api/v1/admin/writers/"+writer+"/deny", nil), map[string]string{"pubkey": writer})
+		w := httptest.NewRecorder()
+		server.HandleDenyWriter(w, req)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertFalse(t, controller.CanWrite(writer))
+	})
+
+	t.Run("Rejects invalid pubkeys", func(t *testing.T) {
+		req := mux.SetURLVars(httptest.NewRequest("POST", "/api/v1/admin/writers/nope/approve", nil), map[string]string{"pubkey": "nope"})
+		w := httptest.NewRecorder()
+		server.HandleApproveWriter(w, req)
+		helpers.AssertIntEqual(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestRESTAPITrending(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mockCache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+	t.Run("Unavailable when disabled", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.HandleTrending(w, httptest.NewRequest("GET", "/api/v1/trending", nil))
+		helpers.AssertIntEqual(t, http.StatusServiceUnavailable, w.Code)
+	})
+
+	tracker := trending.NewTracker(config.TrendingConfig{Window: 24 * time.Hour, HalfLife: 6 * time.Hour, CacheTTL: time.Minute}, mockCache)
+	server.SetTrending(tracker)
+
+	eg := models.NewEventGenerator()
+	note := eg.GenerateTextNote(eg.GetRandomNpub(), "Trending note", nostr.Tags{})
+	mockCache.StoreEvent(note)
+	reaction := eg.GenerateTextNote(eg.GetRandomNpub(), "+", nostr.Tags{{"e", note.ID}, {"k", "1"}})
+	reaction.Kind = 7
+	tracker.Record(reaction)
+
+	t.Run("Ranks per kind", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.HandleTrending(w, httptest.NewRequest("GET", "/api/v1/trending?window=6h&kinds=1,30023&limit=5", nil))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data trending.Result `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		helpers.AssertStringEqual(t, "6h0m0s", response.Data.Window)
+		helpers.AssertIntEqual(t, 1, len(response.Data.Kinds[1]))
+		helpers.AssertStringEqual(t, note.ID, response.Data.Kinds[1][0].Event.ID)
+		helpers.AssertIntEqual(t, 1, response.Data.Kinds[1][0].Reactions)
+		helpers.AssertIntEqual(t, 0, len(response.Data.Kinds[30023]))
+	})
+
+	t.Run("Rejects bad parameters", func(t *testing.T) {
+		for _, query := range []string{"window=forever", "window=48h", "kinds=notes", "limit=-1"} {
+			w := httptest.NewRecorder()
+			server.HandleTrending(w, httptest.NewRequest("GET", "/api/v1/trending?"+query, nil))
+			helpers.AssertIntEqual(t, http.StatusBadRequest, w.Code)
+		}
+	})
+}
+
+func TestRESTAPIMaintenance(t *testing.T) {
+	mockQueue := mocks.NewMockQueue()
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mockQueue, mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+	mode := maintenance.New()
+	server.SetMaintenance(mode)
+
+	setMaintenance := func(body MaintenanceRequest) maintenance.State {
+		reqBody, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		server.HandleSetMaintenance(w, httptest.NewRequest("PUT", "/api/v1/admin/maintenance", bytes.NewReader(reqBody)))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data maintenance.State `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Data
+	}
+
+	eg := models.NewEventGenerator()
+	publish := func() *httptest.ResponseRecorder {
+		reqBody, _ := json.Marshal(PublishRequest{Event: *eg.GenerateTextNote(eg.GetRandomNpub(), "Hello", nostr.Tags{})})
+		w := httptest.NewRecorder()
+		server.HandlePublish(w, httptest.NewRequest("POST", "/api/v1/publish", bytes.NewReader(reqBody)))
+		return w
+	}
+
+	state := setMaintenance(MaintenanceRequest{Enabled: true, Reason: "storage migration"})
+	helpers.AssertTrue(t, state.Enabled)
+	helpers.AssertTrue(t, mode.Active())
+
+	t.Run("Rejects publishes", func(t *testing.T) {
+		w := publish()
+		helpers.AssertIntEqual(t, http.StatusServiceUnavailable, w.Code)
+
+		var p problem.Problem
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		helpers.AssertStringEqual(t, problem.CodeMaintenance, p.Code)
+		helpers.AssertStringEqual(t, "maintenance: storage migration", p.Detail)
+		helpers.AssertIntEqual(t, 0, mockQueue.GetEventCount())
+	})
+
+	t.Run("Reports maintenance in health", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.HandleHealth(w, httptest.NewRequest("GET", "/api/v1/health", nil))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringContains(t, w.Body.String(), `"status":"maintenance"`)
+	})
+
+	t.Run("Keeps reads alive", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.HandleGetEvents(w, httptest.NewRequest("GET", "/api/v1/events?kinds=1", nil))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Accepts publishes again once resumed", func(t *testing.T) {
+		state := setMaintenance(MaintenanceRequest{Enabled: false})
+		helpers.AssertFalse(t, state.Enabled)
+		helpers.AssertIntEqual(t, http.StatusOK, publish().Code)
+	})
+}
+
+func TestRESTAPIAnnotations(t *testing.T) {
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+	t.Run("Unavailable when disabled", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.HandleGetAnnotations(w, httptest.NewRequest("GET", "/api/v1/admin/annotations", nil))
+		helpers.AssertIntEqual(t, http.StatusServiceUnavailable, w.Code)
+	})
+
+	store, err := annotations.NewStore("")
+	helpers.AssertNoError(t, err)
+	server.SetAnnotations(store)
+
+	spammer := strings.Repeat("cd", 32)
+	create := func(body AnnotationRequest) (*httptest.ResponseRecorder, annotations.Annotation) {
+		data, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		server.HandleCreateAnnotation(w, httptest.NewRequest("POST", "/api/v1/admin/annotations", bytes.NewReader(data)))
+		var response struct {
+			Data annotations.Annotation `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response.Data
+	}
+
+	npub, _ := nip19.EncodePublicKey(spammer)
+	w, note := create(AnnotationRequest{TargetType: annotations.TargetPubkey, Target: npub, Note: "repeat spammer"})
+	helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+	helpers.AssertStringEqual(t, spammer, note.Target)
+
+	t.Run("Lists notes for a target", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.HandleGetAnnotations(w, httptest.NewRequest("GET", "/api/v1/admin/annotations?target_type=pubkey&target="+npub, nil))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data struct {
+				Annotations []annotations.Annotation `json:"annotations"`
+			} `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		helpers.AssertIntEqual(t, 1, len(response.Data.Annotations))
+		helpers.AssertStringEqual(t, "repeat spammer", response.Data.Annotations[0].Note)
+	})
+
+	t.Run("Shown in the connection view", func(t *testing.T) {
+		server.SetConnectionSource(&fakeConnectionSource{connections: []ConnectionInfo{
+			{RemoteAddr: "10.0.0.1:5000", Pubkey: spammer, ConnectedAt: time.Now()},
+			{RemoteAddr: "10.0.0.2:5000", ConnectedAt: time.Now()},
+		}})
+		w := httptest.NewRecorder()
+		server.HandleGetConnections(w, httptest.NewRequest("GET", "/api/v1/admin/connections", nil))
+
+		var view struct {
+			Data struct {
+				Connections []ConnectionInfo `json:"connections"`
+			} `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &view))
+		helpers.AssertIntEqual(t, 1, len(view.Data.Connections[0].Annotations))
+		helpers.AssertIntEqual(t, 0, len(view.Data.Connections[1].Annotations))
+	})
+
+	t.Run("Updates and deletes", func(t *testing.T) {
+		data, _ := json.Marshal(AnnotationRequest{Note: "repeat spammer, banned"})
+		req := mux.SetURLVars(httptest.NewRequest("PUT", "/api/v1/admin/annotations/"+note.ID, bytes.NewReader(data)), map[string]string{"id": note.ID})
+		w := httptest.NewRecorder()
+		server.HandleUpdateAnnotation(w, req)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		updated, _ := store.Get(note.ID)
+		helpers.AssertStringEqual(t, "repeat spammer, banned", updated.Note)
+
+		req = mux.SetURLVars(httptest.NewRequest("DELETE", "/api/v1/admin/annotations/"+note.ID, nil), map[string]string{"id": note.ID})
+		w = httptest.NewRecorder()
+		server.HandleDeleteAnnotation(w, req)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+
+		w = httptest.NewRecorder()
+		server.HandleDeleteAnnotation(w, req)
+		helpers.AssertIntEqual(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Rejects invalid notes", func(t *testing.T) {
+		w, _ := create(AnnotationRequest{TargetType: annotations.TargetEvent, Target: "nope", Note: "spam"})
+		helpers.AssertIntEqual(t, http.StatusBadRequest, w.Code)
+		w, _ = create(AnnotationRequest{TargetType: annotations.TargetPubkey, Target: spammer})
+		helpers.AssertIntEqual(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestRESTAPIReputation(t *testing.T) {
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true, RateLimitPerMinute: 20}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+	checker, err := reputation.NewChecker(config.ReputationConfig{
+		Enabled:          true,
+		DenyCIDRs:        []string{"203.0.113.0/24"},
+		DenyListAction:   string(reputation.ActionDeny),
+		RateLimitDivisor: 10,
+	})
+	helpers.AssertNoError(t, err)
+	server.SetReputation(checker)
+
+	handler := server.reputationMiddleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/health", nil)
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("Denies listed networks", func(t *testing.T) {
+		w := request("203.0.113.9:5000")
+		helpers.AssertIntEqual(t, http.StatusForbidden, w.Code)
+		helpers.AssertStringContains(t, w.Body.String(), problem.CodeForbidden)
+		helpers.AssertIntEqual(t, http.StatusOK, request("198.51.100.1:5000").Code)
+	})
+
+	t.Run("Rate limits harder", func(t *testing.T) {
+		checker, _ := reputation.NewChecker(config.ReputationConfig{
+			DenyCIDRs:        []string{"198.51.100.0/24"},
+			DenyListAction:   string(reputation.ActionRateLimit),
+			RateLimitDivisor: 10,
+		})
+		server.SetReputation(checker)
+
+		helpers.AssertIntEqual(t, http.StatusOK, request("198.51.100.1:5000").Code)
+		helpers.AssertIntEqual(t, http.StatusOK, request("198.51.100.1:5001").Code)
+		helpers.AssertIntEqual(t, http.StatusTooManyRequests, request("198.51.100.1:5002").Code)
+		helpers.AssertIntEqual(t, http.StatusOK, request("192.0.2.1:5000").Code)
+	})
+
+	t.Run("Requires authentication", func(t *testing.T) {
+		checker, _ := reputation.NewChecker(config.ReputationConfig{
+			DenyCIDRs:      []string{"198.51.100.0/24"},
+			DenyListAction: string(reputation.ActionRequireAuth),
+		})
+		server.SetReputation(checker)
+
+		req := httptest.NewRequest("GET", "/api/v1/endpoints", nil)
+		req.RemoteAddr = "198.51.100.1:5000"
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		helpers.AssertIntEqual(t, http.StatusUnauthorized, w.Code)
+
+		// Health stays reachable
+		helpers.AssertIntEqual(t, http.StatusOK, request("198.51.100.1:5000").Code)
+	})
+
+	t.Run("Stats", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.HandleReputationStats(w, httptest.NewRequest("GET", "/api/v1/admin/reputation", nil))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringContains(t, w.Body.String(), `"require_auth":2`)
+	})
+}
+
+func TestRESTAPIPublicMirror(t *testing.T) {
+	mockCache := mocks.NewMockCacheWithError()
+	author := strings.Repeat("a", 64)
+	now := time.Now()
+	mockCache.SetEvents([]*models.Event{
+		{ID: strings.Repeat("1", 64), PubKey: author, Kind: 30023, CreatedAt: models.Timestamp(now), Content: "Long read",
+			Tags: nostr.Tags{{"d", "first-post"}, {"title", "First Post"}, {"summary", "An introduction"}}},
+		{ID: strings.Repeat("2", 64), PubKey: author, Kind: 30023, CreatedAt: models.Timestamp(now), Content: "Hidden",
+			Tags: nostr.Tags{{"d", "spam"}}, IsQuarantined: true},
+		{ID: strings.Repeat("3", 64), PubKey: author, Kind: 1, CreatedAt: models.Timestamp(now), Content: "Relay news",
+			Tags: nostr.Tags{{"t", "announcement"}}},
+	})
+
+	cfg := config.RESTAPIConfig{
+		Enabled: true,
+		PublicMirror: config.PublicMirrorConfig{
+			Enabled:         true,
+			RefreshInterval: time.Minute,
+			MaxAge:          time.Hour,
+			StaleTTL:        24 * time.Hour,
+			Limit:           50,
+			MaxViews:        10,
+			Filters: map[string]config.PublicFilter{
+				"announcements": {Kinds: []int{1}, Tags: map[string][]string{"t": {"announcement"}}},
+			},
+		},
+	}
+	server := NewRESTAPIServer(cfg, nil, mocks.NewMockQueue(), mockCache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+	get := func(handler http.HandlerFunc, target string, header map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", target, nil)
+		if strings.HasPrefix(target, "/api/v1/public/events/") {
+			req = mux.SetURLVars(req, map[string]string{"filter": strings.TrimPrefix(target, "/api/v1/public/events/")})
+		}
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	t.Run("Serves articles with cache headers", func(t *testing.T) {
+		w := get(server.HandlePublicArticles, "/api/v1/public/articles", nil)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringContains(t, w.Header().Get("Cache-Control"), "public, max-age=3600")
+		helpers.AssertStringContains(t, w.Header().Get("Cache-Control"), "stale-if-error=86400")
+		helpers.AssertStringEqual(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+
+		var body struct {
+			Count    int                      `json:"count"`
+			Articles []map[string]interface{} `json:"articles"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+		helpers.AssertIntEqual(t, 1, body.Count)
+		helpers.AssertStringEqual(t, "First Post", body.Articles[0]["title"].(string))
+		helpers.AssertStringEqual(t, "first-post", body.Articles[0]["identifier"].(string))
+	})
+
+	t.Run("Answers conditional requests", func(t *testing.T) {
+		first := get(server.HandlePublicArticles, "/api/v1/public/articles", nil)
+		etag := first.Header().Get("ETag")
+		helpers.AssertTrue(t, etag != "")
+
+		w := get(server.HandlePublicArticles, "/api/v1/public/articles", map[string]string{"If-None-Match": etag})
+		helpers.AssertIntEqual(t, http.StatusNotModified, w.Code)
+		helpers.AssertIntEqual(t, 0, w.Body.Len())
+	})
+
+	t.Run("Serves the stale copy when the cache fails", func(t *testing.T) {
+		mockCache.SetErrors(nil, fmt.Errorf("redis down"), nil, nil)
+		defer mockCache.SetErrors(nil, nil, nil, nil)
+
+		view := server.public.views["articles::"]
+		helpers.AssertError(t, server.public.refresh(context.Background(), "articles::", view))
+
+		w := get(server.HandlePublicArticles, "/api/v1/public/articles", nil)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringContains(t, w.Body.String(), "First Post")
+
+		// A view that was never rendered has nothing to fall back on
+		other, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+		w = get(server.HandlePublicArticles, "/api/v1/public/articles?author="+other, nil)
+		helpers.AssertIntEqual(t, http.StatusServiceUnavailable, w.Code)
+		helpers.AssertStringEqual(t, "30", w.Header().Get("Retry-After"))
+	})
+
+	t.Run("Serves safelisted filters only", func(t *testing.T) {
+		w := get(server.HandlePublicEvents, "/api/v1/public/events/announcements", nil)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringContains(t, w.Body.String(), "Relay news")
+
+		w = get(server.HandlePublicEvents, "/api/v1/public/events/everything", nil)
+		helpers.AssertIntEqual(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Rejects invalid authors", func(t *testing.T) {
+		w := get(server.HandlePublicEbooks, "/api/v1/public/ebooks?author=nobody", nil)
+		helpers.AssertIntEqual(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestRESTAPICSRF(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Server.AllowedOrigins = []string{"https://app.example.com"}
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", cfg)
+	guard := server.sshKeyManager.csrf
+
+	reached := false
+	protected := guard.protect(func(w http.ResponseWriter, req *http.Request) {
+		reached = true
+		w.WriteHeader(http.StatusNoContent)
+	})
+	post := func(setup func(req *http.Request)) int {
+		reached = false
+		req := httptest.NewRequest("POST", "http://relay.example.com/api/v1/nostr/auth", strings.NewReader("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		setup(req)
+		w := httptest.NewRecorder()
+		protected(w, req)
+		return w.Code
+	}
+
+	// The form page issues the token in a cookie and in the page itself
+	w := httptest.NewRecorder()
+	server.sshKeyManager.HandleSSHKeyForm(w, httptest.NewRequest("GET", "http://relay.example.com/ssh-keys", nil))
+	cookies := w.Result().Cookies()
+	helpers.AssertIntEqual(t, 1, len(cookies))
+	cookie := cookies[0]
+	helpers.AssertStringEqual(t, csrfCookie, cookie.Name)
+	helpers.AssertTrue(t, cookie.HttpOnly)
+	helpers.AssertTrue(t, cookie.SameSite == http.SameSiteStrictMode)
+	helpers.AssertStringContains(t, w.Body.String(), `data-csrf-token="`+cookie.Value+`"`)
+
+	t.Run("Non-browser clients pass", func(t *testing.T) {
+		helpers.AssertIntEqual(t, http.StatusNoContent, post(func(req *http.Request) {}))
+		helpers.AssertTrue(t, reached)
+	})
+
+	t.Run("Browser requests need the token", func(t *testing.T) {
+		code := post(func(req *http.Request) {
+			req.Header.Set("Origin", "http://relay.example.com")
+			req.AddCookie(cookie)
+		})
+		helpers.AssertIntEqual(t, http.StatusForbidden, code)
+		helpers.AssertFalse(t, reached)
+
+		code = post(func(req *http.Request) {
+			req.Header.Set("Origin", "http://relay.example.com")
+			req.AddCookie(cookie)
+			req.Header.Set(csrfHeader, cookie.Value)
+		})
+		helpers.AssertIntEqual(t, http.StatusNoContent, code)
+	})
+
+	t.Run("Rejects forged and mismatched tokens", func(t *testing.T) {
+		forged := &http.Cookie{Name: csrfCookie, Value: "abc.def"}
+		code := post(func(req *http.Request) {
+			req.Header.Set("Sec-Fetch-Site", "same-origin")
+			req.AddCookie(forged)
+			req.Header.Set(csrfHeader, forged.Value)
+		})
+		helpers.AssertIntEqual(t, http.StatusForbidden, code)
+
+		other := httptest.NewRecorder()
+		guard.issue(other, httptest.NewRequest("GET", "/ssh-keys", nil))
+		code = post(func(req *http.Request) {
+			req.Header.Set("Sec-Fetch-Site", "same-origin")
+			req.AddCookie(cookie)
+			req.Header.Set(csrfHeader, other.Result().Cookies()[0].Value)
+		})
+		helpers.AssertIntEqual(t, http.StatusForbidden, code)
+	})
+
+	t.Run("Rejects origins off the allow-list", func(t *testing.T) {
+		code := post(func(req *http.Request) {
+			req.Header.Set("Origin", "https://evil.example.net")
+			req.AddCookie(cookie)
+			req.Header.Set(csrfHeader, cookie.Value)
+		})
+		helpers.AssertIntEqual(t, http.StatusForbidden, code)
+
+		code = post(func(req *http.Request) {
+			req.Header.Set("Origin", "https://app.example.com")
+			req.AddCookie(cookie)
+			req.Header.Set(csrfHeader, cookie.Value)
+		})
+		helpers.AssertIntEqual(t, http.StatusNoContent, code)
+	})
+
+	t.Run("Accepts the token as a form field", func(t *testing.T) {
+		reached = false
+		form := strings.NewReader("name=laptop&" + csrfField + "=" + cookie.Value)
+		req := httptest.NewRequest("POST", "http://relay.example.com/ssh-keys", form)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Origin", "http://relay.example.com")
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		protected(w, req)
+		helpers.AssertIntEqual(t, http.StatusNoContent, w.Code)
+	})
+
+	t.Run("Reuses a valid cookie", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/ssh-keys", nil)
+		req.AddCookie(cookie)
+		w := httptest.NewRecorder()
+		helpers.AssertStringEqual(t, cookie.Value, guard.issue(w, req))
+		helpers.AssertIntEqual(t, 0, len(w.Result().Cookies()))
+	})
+}
+
+func TestRESTAPILanguage(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockQueue := mocks.NewMockQueue()
+	eg := models.NewEventGenerator()
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mockQueue, mockCache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+	german := eg.GenerateTextNote(eg.GetRandomNpub(), "Ich weiß nicht, wie das auf dem Server läuft und ist", nostr.Tags{})
+	english := eg.GenerateTextNote(eg.GetRandomNpub(), "The relay is running and this is what you wanted", nostr.Tags{})
+	labeled := eg.GenerateTextNote(eg.GetRandomNpub(), "gm", nostr.Tags{{"L", "ISO-639-1"}, {"l", "de", "ISO-639-1"}})
+	for _, event := range []*models.Event{german, english, labeled} {
+		helpers.AssertNoError(t, mockCache.StoreEvent(event))
+	}
+
+	getEvents := func(query string) []nostr.Event {
+		w := httptest.NewRecorder()
+		server.HandleGetEvents(w, httptest.NewRequest("GET", "/api/v1/events?kinds=1"+query, nil))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		var response struct {
+			Data []nostr.Event `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		return response.Data
+	}
+
+	t.Run("Filters by ?lang", func(t *testing.T) {
+		helpers.AssertIntEqual(t, 3, len(getEvents("")))
+		helpers.AssertIntEqual(t, 2, len(getEvents("&lang=de")))
+		helpers.AssertIntEqual(t, 3, len(getEvents("&lang=de,en")))
+		helpers.AssertIntEqual(t, 1, len(getEvents("&lang=en")))
+		helpers.AssertIntEqual(t, 0, len(getEvents("&lang=fr")))
+	})
+
+	t.Run("Filters query bodies by lang", func(t *testing.T) {
+		body, _ := json.Marshal(EventRequest{Filter: nostr.Filter{Kinds: []int{1}}, Languages: []string{"en"}})
+		w := httptest.NewRecorder()
+		server.HandleQuery(w, httptest.NewRequest("POST", "/api/v1/query", bytes.NewReader(body)))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringContains(t, w.Body.String(), english.ID)
+		helpers.AssertFalse(t, strings.Contains(w.Body.String(), german.ID))
+	})
+
+	t.Run("Records the language of published events", func(t *testing.T) {
+		publish := func(event *models.Event) *models.Event {
+			mockQueue.Clear()
+			event.Language = "fr" // never taken from the client
+			body, _ := json.Marshal(PublishRequest{Event: *event})
+			w := httptest.NewRecorder()
+			server.HandlePublish(w, httptest.NewRequest("POST", "/api/v1/publish", bytes.NewReader(body)))
+			helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+			return mockQueue.Peek()
+		}
+
+		helpers.AssertStringEqual(t, "", publish(german).Language)
+
+		server.SetLanguageDetection(config.LanguageConfig{Detect: true})
+		defer server.SetLanguageDetection(config.LanguageConfig{})
+		helpers.AssertStringEqual(t, "de", publish(german).Language)
+		helpers.AssertStringEqual(t, "en", publish(english).Language)
+	})
+}
+
+func TestRESTAPIRejections(t *testing.T) {
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+	t.Run("Unavailable without a log", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.HandleGetRejections(w, httptest.NewRequest("GET", "/api/v1/admin/rejections", nil))
+		helpers.AssertIntEqual(t, http.StatusServiceUnavailable, w.Code)
+	})
+
+	server.SetRejectionLog(rejection.NewLog(config.RejectionLogConfig{SampleRate: -1, BufferSize: 10}))
+
+	t.Run("Records refused publishes", func(t *testing.T) {
+		invalid := &models.Event{ID: "", PubKey: "alice", Kind: 1, Content: "no id"}
+		body, _ := json.Marshal(PublishRequest{Event: *invalid})
+		w := httptest.NewRecorder()
+		server.HandlePublish(w, httptest.NewRequest("POST", "/api/v1/publish", bytes.NewReader(body)))
+		helpers.AssertIntEqual(t, http.StatusBadRequest, w.Code)
+
+		w = httptest.NewRecorder()
+		server.HandleGetRejections(w, httptest.NewRequest("GET", "/api/v1/admin/rejections?reason=invalid&kind=1", nil))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Data struct {
+				Rejections []rejection.Rejection `json:"rejections"`
+				Count      int                   `json:"count"`
+			} `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		helpers.AssertIntEqual(t, 1, response.Data.Count)
+		got := response.Data.Rejections[0]
+		helpers.AssertStringEqual(t, "alice", got.PubKey)
+		helpers.AssertStringEqual(t, rejection.SourceREST, got.Source)
+		helpers.AssertStringContains(t, got.Message, "invalid:")
+	})
+
+	t.Run("Rejects bad filters", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.HandleGetRejections(w, httptest.NewRequest("GET", "/api/v1/admin/rejections?kind=note", nil))
+		helpers.AssertIntEqual(t, http.StatusBadRequest, w.Code)
+	})
+}
+
+func TestRESTAPIEntitlements(t *testing.T) {
+	cache := mocks.NewMockCache()
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), cache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+	relayKey := nostr.GeneratePrivateKey()
+	relayPub, _ := nostr.GetPublicKey(relayKey)
+	authorKey := nostr.GeneratePrivateKey()
+	author, _ := nostr.GetPublicKey(authorKey)
+	readerKey := nostr.GeneratePrivateKey()
+	reader, _ := nostr.GetPublicKey(readerKey)
+
+	book := &models.Event{ID: strings.Repeat("b", 64), PubKey: author, Kind: 30040, CreatedAt: nostr.Now(),
+		Tags: nostr.Tags{{"d", "novel"}, {"title", "Novel"}, {"price", "1000", "sats"}}, Content: "{}"}
+	address := "30040:" + author + ":novel"
+	toRelay, _ := nip44.GenerateConversationKey(relayPub, authorKey)
+	ciphertext, _ := nip44.Encrypt("It was a dark and stormy night.", toRelay)
+	section := &models.Event{ID: strings.Repeat("c", 64), PubKey: author, Kind: 30041, CreatedAt: nostr.Now(),
+		Tags: nostr.Tags{{"d", "chapter-1"}, {"title", "Chapter One"}, {"a", address}, {"encrypted", "nip44"}}, Content: ciphertext}
+	helpers.AssertNoError(t, cache.StoreEvent(book))
+	helpers.AssertNoError(t, cache.StoreEvent(section))
+
+	request := func(method, path, pubkey string, body []byte, vars map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewReader(body))
+		req.Header.Set("X-Nostr-Pubkey", pubkey)
+		req = mux.SetURLVars(req, vars)
+		w := httptest.NewRecorder()
+		switch {
+		case strings.HasSuffix(path, "/unlocked"):
+			server.HandleUnlockedEbook(w, req)
+		case method == "POST":
+			server.HandleGrantEntitlement(w, req)
+		case method == "DELETE":
+			server.HandleRevokeEntitlement(w, req)
+		default:
+			server.HandleGetEntitlements(w, req)
+		}
+		return w
+	}
+	unlockPath := "/api/v1/ebooks/" + book.ID + "/unlocked"
+	grantsPath := "/api/v1/ebooks/" + book.ID + "/entitlements"
+	vars := map[string]string{"id": book.ID}
+
+	t.Run("Unavailable without entitlements", func(t *testing.T) {
+		w := request("GET", unlockPath, reader, nil, vars)
+		helpers.AssertIntEqual(t, http.StatusServiceUnavailable, w.Code)
+	})
+
+	m, err := entitlement.NewManager(config.EntitlementsConfig{PrivateKey: relayKey})
+	helpers.AssertNoError(t, err)
+	server.SetEntitlements(m)
+
+	t.Run("Readers without access must pay", func(t *testing.T) {
+		w := request("GET", unlockPath, reader, nil, vars)
+		helpers.AssertIntEqual(t, http.StatusPaymentRequired, w.Code)
+		var p problem.Problem
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &p))
+		helpers.AssertStringEqual(t, problem.CodePaymentRequired, p.Code)
+		helpers.AssertStringContains(t, p.Detail, "1000 sats")
+	})
+
+	t.Run("Only the author or an admin grants access", func(t *testing.T) {
+		body, _ := json.Marshal(GrantRequest{Reader: reader})
+		w := request("POST", grantsPath, reader, body, vars)
+		helpers.AssertIntEqual(t, http.StatusForbidden, w.Code)
+
+		w = request("GET", grantsPath, reader, nil, vars)
+		helpers.AssertIntEqual(t, http.StatusForbidden, w.Code)
+	})
+
+	t.Run("Author grants access and the reader unlocks the book", func(t *testing.T) {
+		npub, _ := nip19.EncodePublicKey(reader)
+		body, _ := json.Marshal(GrantRequest{Reader: npub})
+		w := request("POST", grantsPath, author, body, vars)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertTrue(t, m.Entitled(address, reader))
+		helpers.AssertStringEqual(t, entitlement.SourceAuthor, m.Grants(address)[0].Source)
+
+		w = request("GET", unlockPath, reader, nil, vars)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		var response struct {
+			Data struct {
+				Book        string            `json:"book"`
+				RelayPubkey string            `json:"relay_pubkey"`
+				Sections    []UnlockedSection `json:"sections"`
+			} `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		helpers.AssertStringEqual(t, address, response.Data.Book)
+		helpers.AssertStringEqual(t, relayPub, response.Data.RelayPubkey)
+		helpers.AssertIntEqual(t, 1, len(response.Data.Sections))
+		got := response.Data.Sections[0]
+		helpers.AssertTrue(t, got.Encrypted)
+		helpers.AssertStringEqual(t, "Chapter One", got.Title)
+
+		fromRelay, _ := nip44.GenerateConversationKey(relayPub, readerKey)
+		plaintext, err := nip44.Decrypt(got.Content, fromRelay)
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, "It was a dark and stormy night.", plaintext)
+	})
+
+	t.Run("Author revokes access", func(t *testing.T) {
+		w := request("DELETE", grantsPath+"/"+reader, author, nil, map[string]string{"id": book.ID, "reader": reader})
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+
+		w = request("DELETE", grantsPath+"/"+reader, author, nil, map[string]string{"id": book.ID, "reader": reader})
+		helpers.AssertIntEqual(t, http.StatusNotFound, w.Code)
+
+		w = request("GET", unlockPath, reader, nil, vars)
+		helpers.AssertIntEqual(t, http.StatusPaymentRequired, w.Code)
+	})
+}
+
+func TestRESTAPISignedResponses(t *testing.T) {
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+	health := server.signingMiddleware(http.HandlerFunc(server.HandleHealth))
+
+	t.Run("Unsigned without an identity", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		health.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/health", nil))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringEqual(t, "", w.Header().Get(identity.SignatureHeader))
+	})
+
+	id, err := identity.New(nostr.GeneratePrivateKey(), true, false)
+	helpers.AssertNoError(t, err)
+	server.SetIdentity(id)
+
+	t.Run("Signs the body, method and path", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		health.ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/health?verbose=1", nil))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringEqual(t, id.PublicKey(), w.Header().Get(identity.PubkeyHeader))
+
+		timestamp, err := strconv.ParseInt(w.Header().Get(identity.TimestampHeader), 10, 64)
+		helpers.AssertNoError(t, err)
+		sig := w.Header().Get(identity.SignatureHeader)
+		helpers.AssertTrue(t, identity.Verify(id.PublicKey(), identity.ResponseMessage(timestamp, "GET", "/api/v1/health?verbose=1", w.Body.Bytes()), sig))
+		helpers.AssertFalse(t, identity.Verify(id.PublicKey(), identity.ResponseMessage(timestamp, "GET", "/api/v1/stats", w.Body.Bytes()), sig))
+	})
+
+	t.Run("Keeps error statuses", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.signingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			server.sendError(w, "Book not found", http.StatusNotFound)
+		})).ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/ebooks/x/content", nil))
+		helpers.AssertIntEqual(t, http.StatusNotFound, w.Code)
+		helpers.AssertTrue(t, w.Header().Get(identity.SignatureHeader) != "")
+	})
+
+	t.Run("Streams are sent unsigned", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.signingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			w.Write([]byte("data: one\n\n"))
+			w.(http.Flusher).Flush()
+			w.Write([]byte("data: two\n\n"))
+		})).ServeHTTP(w, httptest.NewRequest("GET", "/api/v1/sse", nil))
+		helpers.AssertStringEqual(t, "data: one\n\ndata: two\n\n", w.Body.String())
+		helpers.AssertStringEqual(t, "", w.Header().Get(identity.SignatureHeader))
+		helpers.AssertTrue(t, w.Flushed)
+	})
+}
+
+func TestRESTAPIPages(t *testing.T) {
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+	pages := map[string]http.HandlerFunc{
+		"/ssh-keys": server.sshKeyManager.HandleSSHKeyForm,
+		"/admin":    server.HandleDashboard,
+	}
+	for path, handler := range pages {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest("GET", path, nil))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringEqual(t, web.ContentSecurityPolicy, w.Header().Get("Content-Security-Policy"))
+		helpers.AssertFalse(t, strings.Contains(w.Body.String(), "<script>"))
+	}
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/admin", nil)
+	req.Header.Set("Accept-Language", "de-DE,de;q=0.9")
+	server.HandleDashboard(w, req)
+	helpers.AssertStringEqual(t, "de", w.Header().Get("Content-Language"))
+	helpers.AssertStringContains(t, w.Body.String(), `<html lang="de">`)
+}
+
+func TestRESTAPITrustLabels(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	mockQueue := mocks.NewMockQueue()
+	eg := models.NewEventGenerator()
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mockQueue, mockCache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+	labeled := eg.GenerateTextNote(eg.GetRandomNpub(), "From upstream", nostr.Tags{})
+	labeled.TrustLabel = "verified-nip05"
+	local := eg.GenerateTextNote(eg.GetRandomNpub(), "Published here", nostr.Tags{})
+	helpers.AssertNoError(t, mockCache.StoreEvent(labeled))
+	helpers.AssertNoError(t, mockCache.StoreEvent(local))
+
+	w := httptest.NewRecorder()
+	server.HandleGetEvents(w, httptest.NewRequest("GET", "/api/v1/events?kinds=1", nil))
+	helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+	var response struct {
+		Data []map[string]interface{} `json:"data"`
+	}
+	helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	helpers.AssertIntEqual(t, 2, len(response.Data))
+	for _, event := range response.Data {
+		label, present := event["trust_label"]
+		if event["id"] == labeled.ID {
+			helpers.AssertTrue(t, label == "verified-nip05")
+		} else {
+			helpers.AssertFalse(t, present)
+		}
+		_, isArray := event["tags"].([]interface{})
+		helpers.AssertTrue(t, isArray)
+	}
+
+	// Clients can't label their own events
+	mockQueue.Clear()
+	forged := eg.GenerateTextNote(eg.GetRandomNpub(), "Trust me", nostr.Tags{})
+	forged.TrustLabel = "owner-wot"
+	body, _ := json.Marshal(PublishRequest{Event: *forged})
+	w = httptest.NewRecorder()
+	server.HandlePublish(w, httptest.NewRequest("POST", "/api/v1/publish", bytes.NewReader(body)))
+	helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+	helpers.AssertStringEqual(t, "", mockQueue.Peek().TrustLabel)
+}
+
+func TestRESTAPISearch(t *testing.T) {
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+	eg := models.NewEventGenerator()
+
+	get := func(query string) (int, map[string]interface{}) {
+		w := httptest.NewRecorder()
+		server.HandleSearch(w, httptest.NewRequest("GET", "/api/v1/search?"+query, nil))
+		var response struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Data
+	}
+
+	code, _ := get("q=anything")
+	helpers.AssertIntEqual(t, http.StatusServiceUnavailable, code)
+
+	idx := search.NewIndex(config.SearchConfig{})
+	server.SetSearchIndex(idx)
+	note := eg.GenerateTextNote(strings.Repeat("a", 64), "Sailing across the fjord", nostr.Tags{})
+	article := eg.GenerateTextNote(eg.GetRandomNpub(), "Notes on sailing", nostr.Tags{{"d", "sailing"}, {"title", "Sailing"}})
+	article.Kind = search.KindArticle
+	idx.Index(note)
+	idx.Index(article)
+
+	code, data := get("q=sailing&limit=1")
+	helpers.AssertIntEqual(t, http.StatusOK, code)
+	helpers.AssertIntEqual(t, 2, int(data["total"].(float64)))
+	helpers.AssertIntEqual(t, 1, int(data["next_offset"].(float64)))
+	facets := data["facets"].(map[string]interface{})
+	helpers.AssertIntEqual(t, 1, int(facets["note"].(float64)))
+	helpers.AssertIntEqual(t, 1, int(facets["article"].(float64)))
+	hit := data["hits"].([]interface{})[0].(map[string]interface{})
+	helpers.AssertStringEqual(t, "article", hit["type"].(string))
+	helpers.AssertStringEqual(t, article.ID, hit["event"].(map[string]interface{})["id"].(string))
+	helpers.AssertStringEqual(t, "<mark>Sailing</mark>", hit["highlights"].(map[string]interface{})["title"].(string))
+
+	code, data = get("q=sailing&types=note&authors=" + note.PubKey)
+	helpers.AssertIntEqual(t, http.StatusOK, code)
+	helpers.AssertIntEqual(t, 1, int(data["total"].(float64)))
+	_, more := data["next_offset"]
+	helpers.AssertFalse(t, more)
+
+	for _, bad := range []string{"q=", "q=sailing&types=video", "q=sailing&authors=nope", "q=sailing&limit=-1"} {
+		code, _ = get(bad)
+		helpers.AssertIntEqual(t, http.StatusBadRequest, code)
+	}
+}
+
+func TestRESTAPIStorageFallback(t *testing.T) {
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+	store, err := storage.NewFile(t.TempDir())
+	helpers.AssertNoError(t, err)
+	defer store.Close()
+	server.SetStorage(store)
+
+	eg := models.NewEventGenerator()
+	archived := eg.GenerateTextNote(strings.Repeat("a", 64), "Aged out of the cache", nostr.Tags{})
+	helpers.AssertNoError(t, store.StoreEvent(archived))
+
+	get := func(query string) []interface{} {
+		w := httptest.NewRecorder()
+		server.HandleGetEvents(w, httptest.NewRequest("GET", "/api/v1/events?"+query, nil))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		var response struct {
+			Data []interface{} `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return response.Data
+	}
+
+	events := get("ids=" + archived.ID)
+	helpers.AssertIntEqual(t, 1, len(events))
+	helpers.AssertStringEqual(t, archived.ID, events[0].(map[string]interface{})["id"].(string))
+
+	// Other conditions still apply
+	helpers.AssertIntEqual(t, 0, len(get("ids="+archived.ID+"&kinds=7")))
+}
+
+func TestRESTAPISearchFilter(t *testing.T) {
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+	eg := models.NewEventGenerator()
+
+	get := func(query string) (int, []interface{}) {
+		w := httptest.NewRecorder()
+		server.HandleGetEvents(w, httptest.NewRequest("GET", "/api/v1/events?"+query, nil))
+		var response struct {
+			Data []interface{} `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Data
+	}
+
+	code, _ := get("search=sailing")
+	helpers.AssertIntEqual(t, http.StatusServiceUnavailable, code)
+
+	idx := search.NewIndex(config.SearchConfig{})
+	server.SetSearchIndex(idx)
+	older := eg.GenerateTextNote(eg.GetRandomNpub(), "Sailing, sailing over the fjord", nostr.Tags{})
+	older.CreatedAt = 100
+	newer := eg.GenerateTextNote(eg.GetRandomNpub(), "Sailing home", nostr.Tags{})
+	newer.CreatedAt = 200
+	idx.Index(older)
+	idx.Index(newer)
+	idx.Index(eg.GenerateTextNote(eg.GetRandomNpub(), "Rowing home", nostr.Tags{}))
+
+	code, events := get("search=sailing&kinds=1")
+	helpers.AssertIntEqual(t, http.StatusOK, code)
+	helpers.AssertIntEqual(t, 2, len(events))
+	helpers.AssertStringEqual(t, older.ID, events[0].(map[string]interface{})["id"].(string))
+
+	code, events = get("search=sailing+sort:recent&limit=1")
+	helpers.AssertIntEqual(t, http.StatusOK, code)
+	helpers.AssertIntEqual(t, 1, len(events))
+	helpers.AssertStringEqual(t, newer.ID, events[0].(map[string]interface{})["id"].(string))
+
+	code, _ = get("search=sort:recent")
+	helpers.AssertIntEqual(t, http.StatusBadRequest, code)
+}
+
+// recordingTarget keeps archived packages in memory
+type recordingTarget struct{ packages []*archive.Package }
+
+func (t *recordingTarget) Name() string { return "memory" }
+
+func (t *recordingTarget) Upload(ctx context.Context, pkg *archive.Package) (string, error) {
+	t.packages = append(t.packages, pkg)
+	return "memory://" + pkg.EventID, nil
+}
+
+func TestRESTAPIArchive(t *testing.T) {
+	cache := mocks.NewMockCache()
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), cache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+	author := strings.Repeat("a", 64)
+	reader := strings.Repeat("d", 64)
+	book := &models.Event{ID: strings.Repeat("b", 64), PubKey: author, Kind: 30040, CreatedAt: nostr.Now(),
+		Tags:    nostr.Tags{{"d", "atlas"}, {"a", "30041:" + author + ":atlas-1"}, {"a", "30041:" + author + ":atlas-2"}},
+		Content: `{"title":"Atlas"}`}
+	section := &models.Event{ID: strings.Repeat("c", 64), PubKey: author, Kind: 30041, CreatedAt: nostr.Now(),
+		Tags: nostr.Tags{{"d", "atlas-1"}}, Content: `{"title":"Maps","content":"North is up."}`}
+	helpers.AssertNoError(t, cache.StoreEvent(book))
+	helpers.AssertNoError(t, cache.StoreEvent(section))
+
+	request := func(method, pubkey string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(method, "/api/v1/ebooks/"+book.ID+"/archive", nil)
+		req.Header.Set("X-Nostr-Pubkey", pubkey)
+		req = mux.SetURLVars(req, map[string]string{"id": book.ID})
+		w := httptest.NewRecorder()
+		if method == "POST" {
+			server.HandleArchiveEbook(w, req)
+		} else {
+			server.HandleGetArchives(w, req)
+		}
+		var response struct {
+			Data map[string]interface{} `json:"data"`
+		}
+		json.Unmarshal(w.Body.Bytes(), &response)
+		return w.Code, response.Data
+	}
+
+	code, _ := request("GET", reader)
+	helpers.AssertIntEqual(t, http.StatusServiceUnavailable, code)
+
+	a, err := archive.NewArchiver(config.ArchiveConfig{}, cache)
+	helpers.AssertNoError(t, err)
+	target := &recordingTarget{}
+	a.AddTarget(target)
+	server.SetArchiver(a)
+
+	t.Run("Only the author or an admin archives", func(t *testing.T) {
+		code, _ := request("POST", reader)
+		helpers.AssertIntEqual(t, http.StatusForbidden, code)
+	})
+
+	t.Run("Incomplete books are not archived", func(t *testing.T) {
+		code, _ := request("POST", author)
+		helpers.AssertIntEqual(t, http.StatusConflict, code)
+		helpers.AssertIntEqual(t, 0, len(target.packages))
+	})
+
+	t.Run("Author archives a complete book", func(t *testing.T) {
+		second := &models.Event{ID: strings.Repeat("e", 64), PubKey: author, Kind: 30041, CreatedAt: nostr.Now(),
+			Tags: nostr.Tags{{"d", "atlas-2"}}, Content: `{"title":"Seas","content":"Mostly water."}`}
+		helpers.AssertNoError(t, cache.StoreEvent(second))
+
+		code, data := request("POST", author)
+		helpers.AssertIntEqual(t, http.StatusOK, code)
+		helpers.AssertIntEqual(t, 1, len(data["archived"].([]interface{})))
+		helpers.AssertIntEqual(t, 1, len(target.packages))
+		pkg := target.packages[0]
+		helpers.AssertStringEqual(t, "atlas.epub", pkg.Files[0].Name)
+		helpers.AssertStringEqual(t, "application/epub+zip", pkg.Files[0].ContentType)
+		helpers.AssertIntEqual(t, 3, strings.Count(string(pkg.Files[1].Data), "\n"))
+	})
+
+	t.Run("Records are listed", func(t *testing.T) {
+		code, data := request("GET", reader)
+		helpers.AssertIntEqual(t, http.StatusOK, code)
+		helpers.AssertTrue(t, data["archived"].(bool))
+		records := data["archives"].([]interface{})
+		helpers.AssertIntEqual(t, 1, len(records))
+		helpers.AssertStringEqual(t, "memory://"+book.ID, records[0].(map[string]interface{})["url"].(string))
+	})
+}
+
+func TestRESTAPIRuntimeStats(t *testing.T) {
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+	pprofRequest := func(profile string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", "/api/v1/debug/pprof/"+profile, nil)
+		req = mux.SetURLVars(req, map[string]string{"profile": profile})
+		w := httptest.NewRecorder()
+		server.HandlePprof(w, req)
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	server.HandleRuntimeStats(w, httptest.NewRequest("GET", "/api/v1/stats/runtime", nil))
+	helpers.AssertIntEqual(t, http.StatusServiceUnavailable, w.Code)
+	helpers.AssertIntEqual(t, http.StatusNotFound, pprofRequest("heap").Code)
+
+	sampler := profiling.NewSampler(config.ProfilingConfig{})
+	server.SetProfiler(sampler)
+
+	t.Run("Runtime summary", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.HandleRuntimeStats(w, httptest.NewRequest("GET", "/api/v1/stats/runtime", nil))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		var response struct {
+			Data profiling.Summary `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		helpers.AssertTrue(t, response.Data.Goroutines > 0)
+		helpers.AssertFalse(t, response.Data.Pprof)
+	})
+
+	t.Run("pprof stays off unless enabled", func(t *testing.T) {
+		helpers.AssertIntEqual(t, http.StatusNotFound, pprofRequest("").Code)
+	})
+
+	t.Run("pprof profiles", func(t *testing.T) {
+		server.SetProfiler(profiling.NewSampler(config.ProfilingConfig{Pprof: true}))
+		w := pprofRequest("")
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringContains(t, w.Body.String(), "goroutine")
+
+		w = pprofRequest("goroutine")
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertTrue(t, w.Body.Len() > 0)
+
+		helpers.AssertIntEqual(t, http.StatusNotFound, pprofRequest("nonsense").Code)
+	})
+}
+
+func TestRESTAPIProbation(t *testing.T) {
+	mockQueue := mocks.NewMockQueue()
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mockQueue, mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+	eg := models.NewEventGenerator()
+	pubkey, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+
+	publish := func(content string) *httptest.ResponseRecorder {
+		event := eg.GenerateTextNote(pubkey, content, nostr.Tags{})
+		body, _ := json.Marshal(PublishRequest{Event: *event})
+		w := httptest.NewRecorder()
+		server.HandlePublish(w, httptest.NewRequest("POST", "/api/v1/publish", bytes.NewReader(body)))
+		return w
+	}
+
+	w := httptest.NewRecorder()
+	server.HandleGetProbation(w, httptest.NewRequest("GET", "/api/v1/admin/probation", nil))
+	helpers.AssertIntEqual(t, http.StatusServiceUnavailable, w.Code)
+
+	tracker, err := probation.NewTracker(config.ProbationConfig{Age: time.Hour, CleanEvents: 1000, RateLimitPerMinute: 2}, 100)
+	helpers.AssertNoError(t, err)
+	server.SetProbation(tracker)
+
+	t.Run("New pubkeys get the probation rate limit", func(t *testing.T) {
+		helpers.AssertIntEqual(t, http.StatusOK, publish("first post from a fresh key").Code)
+		helpers.AssertIntEqual(t, http.StatusOK, publish("second post from a fresh key").Code)
+		w := publish("third post from a fresh key")
+		helpers.AssertIntEqual(t, http.StatusTooManyRequests, w.Code)
+		helpers.AssertStringContains(t, w.Body.String(), "new pubkeys may publish 2 events per minute")
+		helpers.AssertIntEqual(t, 2, mockQueue.GetEventCount())
+	})
+
+	t.Run("Lists pubkeys on probation", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.HandleGetProbation(w, httptest.NewRequest("GET", "/api/v1/admin/probation", nil))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		var response struct {
+			Data struct {
+				Pubkeys []probation.Status `json:"pubkeys"`
+			} `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		helpers.AssertIntEqual(t, 1, len(response.Data.Pubkeys))
+		helpers.AssertStringEqual(t, pubkey, response.Data.Pubkeys[0].Pubkey)
+		helpers.AssertIntEqual(t, 2, response.Data.Pubkeys[0].CleanEvents)
+	})
+
+	t.Run("Admins release pubkeys early", func(t *testing.T) {
+		release := func() *httptest.ResponseRecorder {
+			req := httptest.NewRequest("POST", "/api/v1/admin/probation/"+pubkey+"/release", nil)
+			req = mux.SetURLVars(req, map[string]string{"pubkey": pubkey})
+			w := httptest.NewRecorder()
+			server.HandleReleaseProbation(w, req)
+			return w
+		}
+		helpers.AssertIntEqual(t, http.StatusOK, release().Code)
+		helpers.AssertIntEqual(t, http.StatusOK, publish("no longer held back").Code)
+		helpers.AssertIntEqual(t, http.StatusNotFound, release().Code)
+	})
+
+	t.Run("Proof of work", func(t *testing.T) {
+		tracker, err := probation.NewTracker(config.ProbationConfig{Age: time.Hour, MinPoW: 8}, 100)
+		helpers.AssertNoError(t, err)
+		server.SetProbation(tracker)
+		defer server.SetProbation(nil)
+
+		w := publish("no work attached")
+		helpers.AssertIntEqual(t, http.StatusForbidden, w.Code)
+		helpers.AssertStringContains(t, w.Body.String(), "pow: new pubkeys need 8 bits")
+	})
+}
+
+func TestRESTAPISubscriptions(t *testing.T) {
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+	owner, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	other, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+
+	call := func(handler http.HandlerFunc, method, path, pubkey, body string, vars map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Nostr-Pubkey", pubkey)
+		if vars != nil {
+			req = mux.SetURLVars(req, vars)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	w := call(server.HandleGetSubscriptions, "GET", "/api/v1/subscriptions", owner, "", nil)
+	helpers.AssertIntEqual(t, http.StatusServiceUnavailable, w.Code)
+
+	manager, err := push.NewManager(config.PushConfig{MaxPerUser: 1})
+	helpers.AssertNoError(t, err)
+	server.SetPush(manager)
+
+	var created push.Subscription
+	t.Run("Creates a webhook subscription", func(t *testing.T) {
+		body := `{"name":"replies","filter":{"kinds":[1],"#p":["` + owner + `"]},"target":{"type":"webhook","url":"https://hooks.example.com/nostr"}}`
+		w := call(server.HandleCreateSubscription, "POST", "/api/v1/subscriptions", owner, body, nil)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		var response struct {
+			Data push.Subscription `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		created = response.Data
+		helpers.AssertStringEqual(t, owner, created.Owner)
+		helpers.AssertStringEqual(t, owner, created.Filter.Tags["p"][0])
+		helpers.AssertTrue(t, created.Target.Secret != "")
+
+		w = call(server.HandleCreateSubscription, "POST", "/api/v1/subscriptions", owner, body, nil)
+		helpers.AssertIntEqual(t, http.StatusConflict, w.Code)
+	})
+
+	t.Run("Rejects invalid targets", func(t *testing.T) {
+		body := `{"filter":{},"target":{"type":"webhook","url":"http://127.0.0.1/hook"}}`
+		w := call(server.HandleCreateSubscription, "POST", "/api/v1/subscriptions", other, body, nil)
+		helpers.AssertIntEqual(t, http.StatusBadRequest, w.Code)
+		helpers.AssertStringContains(t, w.Body.String(), "https")
+	})
+
+	t.Run("Lists without secrets", func(t *testing.T) {
+		w := call(server.HandleGetSubscriptions, "GET", "/api/v1/subscriptions", owner, "", nil)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringContains(t, w.Body.String(), created.ID)
+		helpers.AssertFalse(t, strings.Contains(w.Body.String(), created.Target.Secret))
+
+		w = call(server.HandleGetSubscriptions, "GET", "/api/v1/subscriptions", other, "", nil)
+		helpers.AssertFalse(t, strings.Contains(w.Body.String(), created.ID))
+	})
+
+	t.Run("Only the owner sees and deletes a subscription", func(t *testing.T) {
+		vars := map[string]string{"id": created.ID}
+		w := call(server.HandleGetSubscription, "GET", "/api/v1/subscriptions/"+created.ID, other, "", vars)
+		helpers.AssertIntEqual(t, http.StatusNotFound, w.Code)
+		w = call(server.HandleDeleteSubscription, "DELETE", "/api/v1/subscriptions/"+created.ID, other, "", vars)
+		helpers.AssertIntEqual(t, http.StatusNotFound, w.Code)
+
+		w = call(server.HandleGetSubscription, "GET", "/api/v1/subscriptions/"+created.ID, owner, "", vars)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		w = call(server.HandleDeleteSubscription, "DELETE", "/api/v1/subscriptions/"+created.ID, owner, "", vars)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertIntEqual(t, 0, len(manager.List(owner)))
+	})
+
+	t.Run("Serves the VAPID public key", func(t *testing.T) {
+		w := call(server.HandleGetVAPIDKey, "GET", "/api/v1/subscriptions/vapid-key", "", "", nil)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringContains(t, w.Body.String(), manager.VAPIDPublicKey())
+	})
+}
+
+// listRelay serves moderation lists to the block list manager
+type listRelay []*nostr.Event
+
+func (l listRelay) Fetch(ctx context.Context, url string, filter nostr.Filter) ([]*nostr.Event, error) {
+	var matched []*nostr.Event
+	for _, event := range l {
+		if filter.Matches(event) {
+			matched = append(matched, event)
+		}
+	}
+	return matched, nil
+}
+
+func TestRESTAPIBlockLists(t *testing.T) {
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+	call := func(handler http.HandlerFunc, method, path, body string, vars map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		if vars != nil {
+			req = mux.SetURLVars(req, vars)
+		}
+		w := httptest.NewRecorder()
+		handler(w, req)
+		return w
+	}
+
+	w := call(server.HandleGetBlockLists, "GET", "/api/v1/admin/blocklists", "", nil)
+	helpers.AssertIntEqual(t, http.StatusServiceUnavailable, w.Code)
+
+	sk := nostr.GeneratePrivateKey()
+	moderator, _ := nostr.GetPublicKey(sk)
+	spammer, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	list := &nostr.Event{Kind: blocklist.KindPeopleList, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"d", "spam"}, {"p", spammer}}}
+	helpers.AssertNoError(t, list.Sign(sk))
+
+	qc := quality.NewController(config.QualityConfig{MaxContentLength: 10000, RateLimitPerMinute: 100}, mocks.NewMockQueue(), mocks.NewMockCache())
+	qc.BlockNpub(spammer)
+	manager, err := blocklist.NewManager(config.BlockListsConfig{Relays: []string{"wss://lists.example.com"}}, qc)
+	helpers.AssertNoError(t, err)
+	manager.SetFetcher(listRelay{list})
+	server.SetBlockLists(manager)
+	id := "30000:" + moderator + ":spam"
+
+	t.Run("Subscribes and applies a list", func(t *testing.T) {
+		body := `{"address":"30000:` + moderator + `:spam"}`
+		w := call(server.HandleSubscribeBlockList, "POST", "/api/v1/admin/blocklists", body, nil)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringContains(t, w.Body.String(), list.ID)
+		helpers.AssertEqual(t, "[list:"+id+" manual]", fmt.Sprint(qc.BlockSources(spammer)))
+
+		w = call(server.HandleSubscribeBlockList, "POST", "/api/v1/admin/blocklists", body, nil)
+		helpers.AssertIntEqual(t, http.StatusConflict, w.Code)
+		w = call(server.HandleSubscribeBlockList, "POST", "/api/v1/admin/blocklists", `{"address":"1:`+moderator+`:x"}`, nil)
+		helpers.AssertIntEqual(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Lists subscriptions and their pubkeys", func(t *testing.T) {
+		w := call(server.HandleGetBlockLists, "GET", "/api/v1/admin/blocklists", "", nil)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringContains(t, w.Body.String(), `"count":1`)
+		helpers.AssertFalse(t, strings.Contains(w.Body.String(), spammer))
+
+		vars := map[string]string{"id": id}
+		w = call(server.HandleGetBlockList, "GET", "/api/v1/admin/blocklists/"+id, "", vars)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringContains(t, w.Body.String(), spammer)
+
+		w = call(server.HandleRefreshBlockList, "POST", "/api/v1/admin/blocklists/"+id+"/refresh", "", vars)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+	})
+
+	t.Run("Unsubscribing rolls back the list's blocks", func(t *testing.T) {
+		vars := map[string]string{"id": id}
+		w := call(server.HandleUnsubscribeBlockList, "DELETE", "/api/v1/admin/blocklists/"+id, "", vars)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringContains(t, w.Body.String(), `"unblocked":1`)
+		helpers.AssertEqual(t, "[manual]", fmt.Sprint(qc.BlockSources(spammer)))
+
+		w = call(server.HandleUnsubscribeBlockList, "DELETE", "/api/v1/admin/blocklists/"+id, "", vars)
+		helpers.AssertIntEqual(t, http.StatusNotFound, w.Code)
+	})
+}
+
+func TestRESTAPILargeObjects(t *testing.T) {
+	store, err := largeobj.NewFileStore(t.TempDir())
+	helpers.AssertNoError(t, err)
+	router := largeobj.NewRouter(config.LargeObjectConfig{Threshold: 4096, MaxEventSize: 65536}, store)
+	mockQueue := mocks.NewMockQueue()
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, router.Queue(mockQueue), router.Cache(mocks.NewMockCache()), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+	server.SetLargeObjects(router)
+	sk := nostr.GeneratePrivateKey()
+
+	publish := func(image int, offloaded bool) *httptest.ResponseRecorder {
+		event := &nostr.Event{Kind: 1, CreatedAt: nostr.Now(), Content: "cover attached", Tags: nostr.Tags{{"image", "data:image/png;base64," + strings.Repeat("A", image)}}}
+		helpers.AssertNoError(t, event.Sign(sk))
+		published := models.FromNostrEvent(event)
+		published.Offloaded = offloaded
+		body, _ := json.Marshal(PublishRequest{Event: *published})
+		w := httptest.NewRecorder()
+		server.HandlePublish(w, httptest.NewRequest("POST", "/api/v1/publish", bytes.NewReader(body)))
+		return w
+	}
+
+	t.Run("Queues a stub for large events", func(t *testing.T) {
+		helpers.AssertIntEqual(t, http.StatusOK, publish(10000, false).Code)
+		queued := mockQueue.GetEvents()
+		helpers.AssertIntEqual(t, 1, len(queued))
+		helpers.AssertTrue(t, queued[0].Offloaded)
+		helpers.AssertStringEqual(t, "", queued[0].Content)
+		full, err := router.Reassemble(context.Background(), queued[0])
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, "cover attached", full.Content)
+	})
+
+	t.Run("Clients can't mark events offloaded", func(t *testing.T) {
+		helpers.AssertIntEqual(t, http.StatusOK, publish(10, true).Code)
+		queued := mockQueue.GetEvents()
+		helpers.AssertFalse(t, queued[len(queued)-1].Offloaded)
+	})
+
+	t.Run("Rejects events over the maximum size", func(t *testing.T) {
+		w := publish(70000, false)
+		helpers.AssertIntEqual(t, http.StatusRequestEntityTooLarge, w.Code)
+		helpers.AssertStringContains(t, w.Body.String(), "event too large")
+	})
+
+	t.Run("Reports offloading in stats", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.HandleStats(w, httptest.NewRequest("GET", "/api/v1/stats", nil))
+		helpers.AssertStringContains(t, w.Body.String(), `"large_objects":{`)
+		helpers.AssertStringContains(t, w.Body.String(), `"offloaded":1`)
+	})
+}
+
+func TestRESTAPILive(t *testing.T) {
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+	t.Run("Unavailable when not enabled", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.HandleLive(w, httptest.NewRequest("GET", "/api/v1/live", nil))
+		helpers.AssertIntEqual(t, http.StatusServiceUnavailable, w.Code)
+	})
+
+	tracker := live.NewTracker(config.LiveConfig{StaleAfter: time.Hour})
+	server.SetLive(tracker)
+	activity := func(dTag, status string) *models.Event {
+		return &models.Event{ID: dTag, PubKey: "host", Kind: live.KindLiveActivity, CreatedAt: nostr.Now(),
+			Tags: nostr.Tags{{"d", dTag}, {"title", "Reading " + dTag}, {"status", status}}}
+	}
+	tracker.Record(activity("chapter-1", "ended"))
+	tracker.Record(activity("chapter-2", "live"))
+	tracker.Record(&models.Event{ID: "chat", Kind: live.KindLiveChat, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"a", "30311:host:chapter-2"}}})
+	tracker.Watch("viewer", "chat", []string{"30311:host:chapter-2"})
+
+	t.Run("Lists live streams with viewers", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.HandleLive(w, httptest.NewRequest("GET", "/api/v1/live", nil))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		var response struct {
+			Data []live.Activity `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		helpers.AssertIntEqual(t, 1, len(response.Data))
+		helpers.AssertStringEqual(t, "Reading chapter-2", response.Data[0].Title)
+		helpers.AssertIntEqual(t, 1, response.Data[0].Viewers)
+		helpers.AssertInt64Equal(t, 1, response.Data[0].ChatMessages)
+	})
+
+	t.Run("Reports live activities in stats", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.HandleStats(w, httptest.NewRequest("GET", "/api/v1/stats", nil))
+		helpers.AssertStringContains(t, w.Body.String(), `"live":{"live":1,"tracked":2,"viewers":1}`)
+	})
+}
+
+func TestRESTAPIIdempotentPublish(t *testing.T) {
+	mockQueue := mocks.NewMockQueue()
+	cfg := config.RESTAPIConfig{Enabled: true, Idempotency: config.IdempotencyConfig{Enabled: true, Window: time.Hour, Path: filepath.Join(t.TempDir(), "idempotency.jsonl")}}
+	server := NewRESTAPIServer(cfg, nil, mockQueue, mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+
+	signed := func(content string) []byte {
+		event := &nostr.Event{Kind: 1, CreatedAt: nostr.Now(), Content: content}
+		helpers.AssertNoError(t, event.Sign(sk))
+		body, _ := json.Marshal(PublishRequest{Event: *models.FromNostrEvent(event)})
+		return body
+	}
+	publish := func(body []byte, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/v1/publish", bytes.NewReader(body))
+		req.Header.Set("X-Nostr-Pubkey", pk)
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		server.HandlePublish(w, req)
+		return w
+	}
+
+	t.Run("Retry storm enqueues once", func(t *testing.T) {
+		body := signed("retried after a timeout")
+		var wg sync.WaitGroup
+		codes := make(chan int, 20)
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				codes <- publish(body, "retry-1").Code
+			}()
+		}
+		wg.Wait()
+		close(codes)
+		for code := range codes {
+			helpers.AssertIntEqual(t, http.StatusOK, code)
+		}
+		helpers.AssertIntEqual(t, 1, len(mockQueue.GetEvents()))
+
+		w := publish(body, "retry-1")
+		helpers.AssertStringEqual(t, "true", w.Header().Get("Idempotent-Replayed"))
+		helpers.AssertStringContains(t, w.Body.String(), `"status":"published"`)
+		helpers.AssertIntEqual(t, 1, len(mockQueue.GetEvents()))
+	})
+
+	t.Run("Event ID dedupes without a key", func(t *testing.T) {
+		body := signed("no key")
+		helpers.AssertStringEqual(t, "", publish(body, "").Header().Get("Idempotent-Replayed"))
+		helpers.AssertStringEqual(t, "true", publish(body, "").Header().Get("Idempotent-Replayed"))
+		helpers.AssertIntEqual(t, 2, len(mockQueue.GetEvents()))
+	})
+
+	t.Run("Key reused for another event", func(t *testing.T) {
+		w := publish(signed("a different event"), "retry-1")
+		helpers.AssertIntEqual(t, http.StatusUnprocessableEntity, w.Code)
+		helpers.AssertStringContains(t, w.Body.String(), "conflict")
+	})
+
+	t.Run("Failed publishes are retried", func(t *testing.T) {
+		body, _ := json.Marshal(PublishRequest{Event: models.Event{ID: strings.Repeat("0", 64), Kind: 1}})
+		helpers.AssertIntEqual(t, http.StatusBadRequest, publish(body, "bad").Code)
+		w := publish(body, "bad")
+		helpers.AssertIntEqual(t, http.StatusBadRequest, w.Code)
+		helpers.AssertStringEqual(t, "", w.Header().Get("Idempotent-Replayed"))
+	})
+
+	t.Run("Keys too long are refused", func(t *testing.T) {
+		helpers.AssertIntEqual(t, http.StatusBadRequest, publish(signed("long key"), strings.Repeat("k", 300)).Code)
+	})
+}
+
+func TestRESTAPIEbookEPUB(t *testing.T) {
+	var pixel bytes.Buffer
+	helpers.AssertNoError(t, png.Encode(&pixel, image.NewGray(image.Rect(0, 0, 1, 1))))
+	images := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Write(pixel.Bytes())
+	}))
+	defer images.Close()
+
+	cache := mocks.NewMockCache()
+	author := strings.Repeat("a", 64)
+	sum := sha256.Sum256(pixel.Bytes())
+	coverEvent := &models.Event{ID: strings.Repeat("f", 64), PubKey: author, Kind: models.KindFileMetadata, CreatedAt: nostr.Now(),
+		Tags: nostr.Tags{{"url", images.URL + "/cover.png"}, {"m", "image/png"}, {"x", hex.EncodeToString(sum[:])}}}
+	book := &models.Event{ID: strings.Repeat("b", 64), PubKey: author, Kind: 30040, CreatedAt: nostr.Now(),
+		Tags:    nostr.Tags{{"d", "atlas"}, {"a", "30041:" + author + ":atlas-1"}, {"e", coverEvent.ID, "", "cover"}},
+		Content: `{"title":"Atlas & Co","author":"Ana"}`}
+	section := &models.Event{ID: strings.Repeat("c", 64), PubKey: author, Kind: 30041, CreatedAt: nostr.Now(),
+		Tags:    nostr.Tags{{"d", "atlas-1"}},
+		Content: `{"title":"Maps <1>","format":"text","content":"North is up.","images":[{"url":"` + images.URL + `/map.png","alt":"Map","caption":"The world"}]}`}
+	for _, event := range []*models.Event{coverEvent, book, section} {
+		helpers.AssertNoError(t, cache.StoreEvent(event))
+	}
+
+	download := func(server *RESTAPIServer) map[string][]byte {
+		req := httptest.NewRequest("GET", "/api/v1/ebooks/"+book.ID+"/epub?images=true", nil)
+		req = mux.SetURLVars(req, map[string]string{"id": book.ID})
+		w := httptest.NewRecorder()
+		server.HandleEbookEPUB(w, req)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringEqual(t, "application/epub+zip", w.Header().Get("Content-Type"))
+
+		// The mimetype comes first, stored, where readers sniff for it
+		data := w.Body.Bytes()
+		helpers.AssertStringEqual(t, "mimetypeapplication/epub+zip", string(data[30:58]))
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		helpers.AssertNoError(t, err)
+		helpers.AssertEqual(t, zip.Store, zr.File[0].Method)
+
+		files := make(map[string][]byte)
+		for _, file := range zr.File {
+			rc, err := file.Open()
+			helpers.AssertNoError(t, err)
+			content, err := io.ReadAll(rc)
+			rc.Close()
+			helpers.AssertNoError(t, err)
+			files[file.Name] = content
+			if strings.HasSuffix(file.Name, ".xml") || strings.HasSuffix(file.Name, ".opf") || strings.HasSuffix(file.Name, ".xhtml") {
+				decoder := xml.NewDecoder(bytes.NewReader(content))
+				for err == nil {
+					_, err = decoder.Token()
+				}
+				helpers.AssertEqual(t, io.EOF, err)
+			}
+		}
+		return files
+	}
+
+	t.Run("Images are embedded", func(t *testing.T) {
+		server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), cache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+		server.imageClient = images.Client()
+		files := download(server)
+		for _, name := range []string{"META-INF/container.xml", "OEBPS/content.opf", "OEBPS/nav.xhtml", "OEBPS/style.css", "OEBPS/cover.xhtml", "OEBPS/chapter-1.xhtml"} {
+			helpers.AssertTrue(t, files[name] != nil)
+		}
+		helpers.AssertTrue(t, bytes.Equal(pixel.Bytes(), files["OEBPS/images/cover.png"]))
+		helpers.AssertTrue(t, bytes.Equal(pixel.Bytes(), files["OEBPS/images/image-1.png"]))
+		helpers.AssertStringContains(t, string(files["OEBPS/content.opf"]), `href="images/cover.png" media-type="image/png" properties="cover-image"`)
+		helpers.AssertStringContains(t, string(files["OEBPS/content.opf"]), "<dc:title>Atlas &amp; Co</dc:title>")
+		helpers.AssertStringContains(t, string(files["OEBPS/nav.xhtml"]), `<a href="chapter-1.xhtml">Maps &lt;1&gt;</a>`)
+		helpers.AssertStringContains(t, string(files["OEBPS/chapter-1.xhtml"]), `<img src="images/image-1.png" alt="Map"/><figcaption>The world</figcaption>`)
+	})
+
+	t.Run("Private addresses are not fetched", func(t *testing.T) {
+		server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), cache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+		files := download(server)
+		// The cover is generated instead
+		helpers.AssertTrue(t, len(files["OEBPS/images/cover.png"]) > 0)
+		helpers.AssertFalse(t, bytes.Equal(pixel.Bytes(), files["OEBPS/images/cover.png"]))
+		helpers.AssertTrue(t, files["OEBPS/images/image-1.png"] == nil)
+	})
+}
+
+func TestRESTAPIModeration(t *testing.T) {
+	call := func(handler http.HandlerFunc, method, path, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler(w, httptest.NewRequest(method, path, strings.NewReader(body)))
+		return w
+	}
+
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+	w := call(server.HandleGetBlocked, "GET", "/api/v1/admin/blocked", "")
+	helpers.AssertIntEqual(t, http.StatusServiceUnavailable, w.Code)
+
+	qc := quality.NewController(config.QualityConfig{MaxContentLength: 10000, RateLimitPerMinute: 100}, mocks.NewMockQueue(), mocks.NewMockCache())
+	server = NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, qc, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+	spammer, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	npub, _ := nip19.EncodePublicKey(spammer)
+
+	t.Run("Blocks by npub", func(t *testing.T) {
+		w := call(server.HandleBlockNpub, "POST", "/api/v1/admin/block", `{"npub":"`+npub+`","reason":"spam"}`)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertTrue(t, qc.IsNpubBlocked(spammer))
+
+		w = call(server.HandleGetBlocked, "GET", "/api/v1/admin/blocked", "")
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringContains(t, w.Body.String(), spammer)
+		helpers.AssertStringContains(t, w.Body.String(), `"count":1`)
+	})
+
+	t.Run("Rejects bad pubkeys", func(t *testing.T) {
+		w := call(server.HandleBlockNpub, "POST", "/api/v1/admin/block", `{"npub":"npub1nope"}`)
+		helpers.AssertIntEqual(t, http.StatusBadRequest, w.Code)
+		w = call(server.HandleBlockNpub, "POST", "/api/v1/admin/block", `not json`)
+		helpers.AssertIntEqual(t, http.StatusBadRequest, w.Code)
+	})
+
+	t.Run("Unblocks by hex", func(t *testing.T) {
+		w := call(server.HandleUnblockNpub, "POST", "/api/v1/admin/unblock", `{"npub":"`+spammer+`"}`)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertFalse(t, qc.IsNpubBlocked(spammer))
+	})
+
+	t.Run("Keeps an audit log, newest first", func(t *testing.T) {
+		w := call(server.HandleGetModerationLog, "GET", "/api/v1/admin/moderation/log?limit=1", "")
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		var response struct {
+			Data struct {
+				Actions []ModerationAction `json:"actions"`
+			} `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		helpers.AssertIntEqual(t, 1, len(response.Data.Actions))
+		helpers.AssertStringEqual(t, "unblock", response.Data.Actions[0].Action)
+		helpers.AssertStringEqual(t, spammer, response.Data.Actions[0].Pubkey)
+
+		helpers.AssertIntEqual(t, 2, len(server.moderationLog.recent(10)))
+		helpers.AssertStringEqual(t, "spam", server.moderationLog.recent(10)[1].Reason)
+	})
+}
+
+func TestRESTAPIQuarantine(t *testing.T) {
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+	w := httptest.NewRecorder()
+	server.HandleGetQuarantine(w, httptest.NewRequest("GET", "/api/v1/admin/quarantine", nil))
+	helpers.AssertIntEqual(t, http.StatusServiceUnavailable, w.Code)
+
+	q, err := quarantine.NewQueue(config.QuarantineConfig{})
+	helpers.AssertNoError(t, err)
+	var released []string
+	q.OnRelease(func(event *models.Event) { released = append(released, event.ID) })
+	server.SetQuarantine(q)
+
+	spammer, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	npub, _ := nip19.EncodePublicKey(spammer)
+	for _, id := range []string{"e1", "e2", "e3"} {
+		q.Hold(&models.Event{ID: id, PubKey: spammer, IsQuarantined: true, QuarantineReason: "Low quality score"})
+	}
+
+	t.Run("Lists held events by author", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.HandleGetQuarantine(w, httptest.NewRequest("GET", "/api/v1/admin/quarantine?author="+npub, nil))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringContains(t, w.Body.String(), `"count":3`)
+		helpers.AssertStringContains(t, w.Body.String(), "Low quality score")
+	})
+
+	t.Run("Releases one event", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		req := mux.SetURLVars(httptest.NewRequest("POST", "/api/v1/admin/quarantine/e1/release", nil), map[string]string{"id": "e1"})
+		server.HandleReleaseQuarantined(w, req)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringEqual(t, "e1", strings.Join(released, ","))
+
+		w = httptest.NewRecorder()
+		server.HandleReleaseQuarantined(w, req)
+		helpers.AssertIntEqual(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Purges the rest by author", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.HandlePurgeQuarantineAuthor(w, httptest.NewRequest("POST", "/api/v1/admin/quarantine/purge", strings.NewReader(`{"author":"`+npub+`"}`)))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertStringContains(t, w.Body.String(), `"count":2`)
+		helpers.AssertIntEqual(t, 0, q.Len())
+
+		actions := server.moderationLog.recent(10)
+		helpers.AssertIntEqual(t, 2, len(actions))
+		helpers.AssertStringEqual(t, "purge", actions[0].Action)
+		helpers.AssertStringEqual(t, "e1", actions[1].EventID)
+	})
+}
+
+func TestRESTAPIPublishDuplicate(t *testing.T) {
+	mockQueue := mocks.NewMockQueue()
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mockQueue, mocks.NewMockCache(), config.SSHConfig{}, "ws://localhost:8080", &config.Config{})
+	server.SetSeenIndex(seen.NewIndex(100))
+
+	eg := models.NewEventGenerator()
+	body, _ := json.Marshal(PublishRequest{Event: *eg.GenerateTextNote(eg.GetRandomNpub(), "Test message", nostr.Tags{})})
+	publish := func() string {
+		w := httptest.NewRecorder()
+		server.HandlePublish(w, httptest.NewRequest("POST", "/api/v1/publish", bytes.NewReader(body)))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		return w.Body.String()
+	}
+
+	helpers.AssertStringContains(t, publish(), `"status":"published"`)
+	helpers.AssertStringContains(t, publish(), `"status":"duplicate"`)
+	helpers.AssertIntEqual(t, 1, mockQueue.GetEventCount())
+
+	w := httptest.NewRecorder()
+	server.HandleStats(w, httptest.NewRequest("GET", "/api/v1/stats", nil))
+	helpers.AssertStringContains(t, w.Body.String(), `"rest":1`)
+}
+
+func TestRESTAPIPayments(t *testing.T) {
+	server := NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mocks.NewMockCache(), config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+
+	t.Run("Unavailable without payments", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.HandleGetPayments(w, httptest.NewRequest("GET", "/api/v1/admin/payments", nil))
+		helpers.AssertIntEqual(t, http.StatusServiceUnavailable, w.Code)
+	})
+
+	manager, err := payments.New(config.PaymentsConfig{})
+	helpers.AssertNoError(t, err)
+	server.SetPayments(manager)
+	writer := strings.Repeat("cd", 32)
+
+	t.Run("Invoices need a backend", func(t *testing.T) {
+		body, _ := json.Marshal(InvoiceRequest{Pubkey: writer})
+		w := httptest.NewRecorder()
+		server.HandleRequestInvoice(w, httptest.NewRequest("POST", "/api/v1/payments/invoice", bytes.NewReader(body)))
+		helpers.AssertIntEqual(t, http.StatusServiceUnavailable, w.Code)
+	})
+
+	t.Run("Grants and lists", func(t *testing.T) {
+		req := mux.SetURLVars(httptest.NewRequest("POST", "/api/v1/admin/payments/"+writer+"/grant", nil), map[string]string{"pubkey": writer})
+		w := httptest.NewRecorder()
+		server.HandleGrantPaidAccess(w, req)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertTrue(t, manager.Admitted(writer))
+
+		w = httptest.NewRecorder()
+		server.HandleGetPayments(w, httptest.NewRequest("GET", "/api/v1/admin/payments", nil))
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		var response struct {
+			Data struct {
+				Admissions []payments.Admission `json:"admissions"`
+			} `json:"data"`
+		}
+		helpers.AssertNoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+		helpers.AssertIntEqual(t, 1, len(response.Data.Admissions))
+		helpers.AssertStringEqual(t, payments.MethodAdmin, response.Data.Admissions[0].Method)
+	})
+
+	t.Run("Revokes", func(t *testing.T) {
+		req := mux.SetURLVars(httptest.NewRequest("DELETE", "/api/v1/admin/payments/"+writer, nil), map[string]string{"pubkey": writer})
+		w := httptest.NewRecorder()
+		server.HandleRevokePaidAccess(w, req)
+		helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+		helpers.AssertFalse(t, manager.Admitted(writer))
+
+		w = httptest.NewRecorder()
+		server.HandleRevokePaidAccess(w, req)
+		helpers.AssertIntEqual(t, http.StatusNotFound, w.Code)
+	})
+
+	t.Run("Rejects invalid pubkeys", func(t *testing.T) {
+		req := mux.SetURLVars(httptest.NewRequest("POST", "/api/v1/admin/payments/nope/grant", nil), map[string]string{"pubkey": "nope"})
+		w := httptest.NewRecorder()
+		server.HandleGrantPaidAccess(w, req)
+		helpers.AssertIntEqual(t, http.StatusBadRequest, w.Code)
+	})
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+
+	"mercury-relay/internal/retention"
+)
+
+// SetRetention enables the admin retention endpoints
+func (r *RESTAPIServer) SetRetention(p *retention.Pruner) {
+	r.retention = p
+}
+
+// HandleGetRetention shows how many events retention deleted, by rule, and
+// the last pass (admin only)
+func (r *RESTAPIServer) HandleGetRetention(w http.ResponseWriter, req *http.Request) {
+	if r.retention == nil {
+		r.sendError(w, "Retention is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	r.sendSuccess(w, r.retention.Stats())
+}
+
+// HandleRunRetention runs a pruning pass now (admin only). With
+// ?dry_run=true it only reports what would be deleted.
+func (r *RESTAPIServer) HandleRunRetention(w http.ResponseWriter, req *http.Request) {
+	if r.retention == nil {
+		r.sendError(w, "Retention is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+	dryRun := req.URL.Query().Get("dry_run") == "true"
+	r.sendSuccess(w, r.retention.Prune(req.Context(), dryRun))
+}
@@ -0,0 +1,376 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/problem"
+
+	"github.com/gorilla/mux"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Revision is one stored version of a publication event
+type Revision struct {
+	Version   int    `json:"version"`
+	EventID   string `json:"event_id"`
+	CreatedAt int64  `json:"created_at"`
+	Current   bool   `json:"current"`
+}
+
+// SectionChange describes one metadata field or section that differs
+// between two revisions
+type SectionChange struct {
+	Section string `json:"section"`
+	Change  string `json:"change"` // added, removed, modified or moved
+	From    string `json:"from,omitempty"`
+	To      string `json:"to,omitempty"`
+}
+
+// RevisionDiff lists the changes between two revisions of a publication
+type RevisionDiff struct {
+	Metadata []SectionChange `json:"metadata"`
+	Sections []SectionChange `json:"sections"`
+}
+
+// HandleEbookRevisions lists the stored versions of a 30040 or 30041 event
+func (r *RESTAPIServer) HandleEbookRevisions(w http.ResponseWriter, req *http.Request) {
+	event, revisions, ok := r.loadRevisions(req.Context(), w, mux.Vars(req)["id"])
+	if !ok {
+		return
+	}
+
+	r.sendSuccess(w, map[string]interface{}{
+		"id":        event.ID,
+		"kind":      event.Kind,
+		"address":   publicationAddress(event),
+		"revisions": revisions,
+	})
+}
+
+// HandleEbookDiff returns the changed sections between two revisions. The
+// from and to query parameters are version numbers and default to the
+// previous and current revision.
+func (r *RESTAPIServer) HandleEbookDiff(w http.ResponseWriter, req *http.Request) {
+	event, revisions, ok := r.loadRevisions(req.Context(), w, mux.Vars(req)["id"])
+	if !ok {
+		return
+	}
+	if len(revisions) < 2 && req.URL.Query().Get("from") == "" {
+		r.sendProblem(w, http.StatusNotFound, problem.CodeNotFound, "Publication has no earlier revision to compare")
+		return
+	}
+
+	// revisions are ordered newest first
+	toVersion := revisions[0].Version
+	fromVersion := toVersion
+	if len(revisions) > 1 {
+		fromVersion = revisions[1].Version
+	}
+	for param, target := range map[string]*int{"from": &fromVersion, "to": &toVersion} {
+		if value := req.URL.Query().Get(param); value != "" {
+			v, err := strconv.Atoi(value)
+			if err != nil {
+				r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidRequest, fmt.Sprintf("Invalid %s version", param))
+				return
+			}
+			*target = v
+		}
+	}
+
+	from := findRevision(revisions, fromVersion)
+	to := findRevision(revisions, toVersion)
+	if from == nil || to == nil {
+		r.sendProblem(w, http.StatusNotFound, problem.CodeNotFound, "Revision not found")
+		return
+	}
+
+	events, err := cache.Collect(r.cache.GetEvents(req.Context(), nostr.Filter{IDs: []string{from.EventID, to.EventID}}))
+	if err != nil {
+		r.sendError(w, fmt.Sprintf("Failed to get revisions: %v", err), http.StatusInternalServerError)
+		return
+	}
+	byID := make(map[string]*models.Event, len(events))
+	for _, e := range events {
+		byID[e.ID] = e
+	}
+	if byID[from.EventID] == nil || byID[to.EventID] == nil {
+		r.sendProblem(w, http.StatusNotFound, problem.CodeNotFound, "Revision content is no longer stored")
+		return
+	}
+
+	r.sendSuccess(w, map[string]interface{}{
+		"id":      event.ID,
+		"address": publicationAddress(event),
+		"from":    from,
+		"to":      to,
+		"diff":    diffRevisions(byID[from.EventID], byID[to.EventID]),
+	})
+}
+
+// loadRevisions looks up a publication event by ID and returns its history
+// ordered newest first. It writes the error response when ok is false.
+func (r *RESTAPIServer) loadRevisions(ctx context.Context, w http.ResponseWriter, id string) (event *models.Event, revisions []Revision, ok bool) {
+	if id == "" {
+		r.sendError(w, "Book ID is required", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	events, err := cache.Collect(r.cache.GetEvents(ctx, nostr.Filter{Kinds: []int{30040, 30041}, IDs: []string{id}}))
+	if err != nil {
+		r.sendError(w, fmt.Sprintf("Failed to get book: %v", err), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	if len(events) == 0 {
+		r.sendError(w, "Book not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	event = events[0]
+
+	history, err := r.cache.GetReplaceableEventHistory(event.Kind, event.PubKey, dTagOf(event))
+	if err != nil {
+		r.sendError(w, fmt.Sprintf("Failed to get revisions: %v", err), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	revisions = make([]Revision, 0, len(history))
+	for _, version := range history {
+		rev := Revision{EventID: fmt.Sprint(version["event_id"])}
+		if v, ok := version["version"].(float64); ok {
+			rev.Version = int(v)
+		}
+		if t, ok := version["created_at"].(float64); ok {
+			rev.CreatedAt = int64(t)
+		}
+		revisions = append(revisions, rev)
+	}
+	if len(revisions) == 0 {
+		// Stored before history tracking, the event is its own only revision
+		revisions = append(revisions, Revision{Version: 1, EventID: event.ID, CreatedAt: int64(event.CreatedAt)})
+	}
+
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].Version > revisions[j].Version
+	})
+	revisions[0].Current = true
+
+	return event, revisions, true
+}
+
+func findRevision(revisions []Revision, version int) *Revision {
+	for i := range revisions {
+		if revisions[i].Version == version {
+			return &revisions[i]
+		}
+	}
+	return nil
+}
+
+func dTagOf(event *models.Event) string {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "d" {
+			return tag[1]
+		}
+	}
+	return ""
+}
+
+func publicationAddress(event *models.Event) string {
+	return fmt.Sprintf("%d:%s:%s", event.Kind, event.PubKey, dTagOf(event))
+}
+
+// diffRevisions compares metadata tags (and JSON metadata content) and the
+// sections of two revisions. Index events (30040) are compared by the
+// sections they reference, content events by their headings.
+func diffRevisions(from, to *models.Event) RevisionDiff {
+	fromMeta, toMeta := revisionMetadata(from), revisionMetadata(to)
+	diff := RevisionDiff{
+		Metadata: diffKeyed(sortedKeys(fromMeta, toMeta), fromMeta, toMeta),
+		Sections: []SectionChange{},
+	}
+
+	if to.Kind == 30040 {
+		diff.Sections = diffReferences(sectionReferences(from), sectionReferences(to))
+		return diff
+	}
+
+	fromSections, fromOrder := splitSections(from.Content)
+	toSections, toOrder := splitSections(to.Content)
+	diff.Sections = diffKeyed(mergeOrder(fromOrder, toOrder), fromSections, toSections)
+	return diff
+}
+
+// revisionMetadata collects the single-value tags that describe a publication
+// plus top-level fields of JSON content
+func revisionMetadata(event *models.Event) map[string]string {
+	meta := make(map[string]string)
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "a", "e", "d", "p":
+			continue
+		}
+		if _, exists := meta[tag[0]]; exists {
+			meta[tag[0]] += ", " + tag[1]
+		} else {
+			meta[tag[0]] = tag[1]
+		}
+	}
+
+	if event.Kind == 30040 {
+		var content map[string]interface{}
+		if err := json.Unmarshal([]byte(event.Content), &content); err == nil {
+			for key, value := range content {
+				meta[key] = fmt.Sprint(value)
+			}
+		}
+	}
+	return meta
+}
+
+// sectionReferences returns the ordered sections an index event links to
+func sectionReferences(event *models.Event) []string {
+	var refs []string
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && (tag[0] == "a" || tag[0] == "e") {
+			refs = append(refs, tag[1])
+		}
+	}
+	return refs
+}
+
+func diffReferences(from, to []string) []SectionChange {
+	fromIndex := make(map[string]int, len(from))
+	for i, ref := range from {
+		fromIndex[ref] = i
+	}
+	toIndex := make(map[string]int, len(to))
+	for i, ref := range to {
+		toIndex[ref] = i
+	}
+
+	// Positions among the sections both revisions share, so an insertion
+	// does not mark every later section as moved
+	var common []string
+	for _, ref := range from {
+		if _, ok := toIndex[ref]; ok {
+			common = append(common, ref)
+		}
+	}
+	commonPos := make(map[string]int, len(common))
+	for i, ref := range common {
+		commonPos[ref] = i
+	}
+
+	var changes []SectionChange
+	pos := 0
+	for _, ref := range to {
+		i, existed := fromIndex[ref]
+		if !existed {
+			changes = append(changes, SectionChange{Section: ref, Change: "added", To: strconv.Itoa(toIndex[ref] + 1)})
+			continue
+		}
+		if commonPos[ref] != pos {
+			changes = append(changes, SectionChange{Section: ref, Change: "moved", From: strconv.Itoa(i + 1), To: strconv.Itoa(toIndex[ref] + 1)})
+		}
+		pos++
+	}
+	for _, ref := range from {
+		if _, kept := toIndex[ref]; !kept {
+			changes = append(changes, SectionChange{Section: ref, Change: "removed", From: strconv.Itoa(fromIndex[ref] + 1)})
+		}
+	}
+	if changes == nil {
+		changes = []SectionChange{}
+	}
+	return changes
+}
+
+// splitSections splits AsciiDoc or Markdown content at heading lines. Text
+// before the first heading is the "preamble" section.
+func splitSections(content string) (map[string]string, []string) {
+	sections := make(map[string]string)
+	var order []string
+	current := "preamble"
+	var body []string
+
+	flush := func() {
+		text := strings.TrimSpace(strings.Join(body, "\n"))
+		if text != "" || current != "preamble" {
+			if _, exists := sections[current]; !exists {
+				order = append(order, current)
+			}
+			sections[current] = text
+		}
+		body = nil
+	}
+
+	for _, line := range strings.Split(content, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if heading := strings.TrimLeft(trimmed, "=#"); heading != trimmed && strings.HasPrefix(heading, " ") {
+			flush()
+			current = strings.TrimSpace(heading)
+			continue
+		}
+		body = append(body, line)
+	}
+	flush()
+
+	return sections, order
+}
+
+func diffKeyed(keys []string, from, to map[string]string) []SectionChange {
+	changes := []SectionChange{}
+	for _, key := range keys {
+		before, inFrom := from[key]
+		after, inTo := to[key]
+		switch {
+		case inFrom && !inTo:
+			changes = append(changes, SectionChange{Section: key, Change: "removed", From: before})
+		case !inFrom && inTo:
+			changes = append(changes, SectionChange{Section: key, Change: "added", To: after})
+		case before != after:
+			changes = append(changes, SectionChange{Section: key, Change: "modified", From: before, To: after})
+		}
+	}
+	return changes
+}
+
+func sortedKeys(maps ...map[string]string) []string {
+	set := make(map[string]bool)
+	for _, m := range maps {
+		for key := range m {
+			set[key] = true
+		}
+	}
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// mergeOrder returns the keys of to in order followed by keys only in from
+func mergeOrder(from, to []string) []string {
+	seen := make(map[string]bool, len(to))
+	merged := append([]string{}, to...)
+	for _, key := range to {
+		seen[key] = true
+	}
+	for _, key := range from {
+		if !seen[key] {
+			merged = append(merged, key)
+		}
+	}
+	return merged
+}
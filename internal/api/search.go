@@ -0,0 +1,156 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/mirror"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/problem"
+	"mercury-relay/internal/search"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// SetSearchIndex enables the search endpoint and NIP-50 search filters
+func (r *RESTAPIServer) SetSearchIndex(idx *search.Index) {
+	r.search = idx
+	r.streams.setSearch(idx)
+}
+
+// checkSearch refuses a NIP-50 search filter the relay can't answer,
+// reporting false once it has written the response
+func (r *RESTAPIServer) checkSearch(w http.ResponseWriter, filter nostr.Filter) bool {
+	if filter.Search == "" {
+		return true
+	}
+	if r.search == nil {
+		r.sendError(w, "Search is not enabled", http.StatusServiceUnavailable)
+		return false
+	}
+	if err := r.search.CheckQuery(filter.Search); err != nil {
+		r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidFilter, "Missing search terms in search")
+		return false
+	}
+	return true
+}
+
+// findEvents loads the events matching filter: from the search index, best
+// match first, when it has a NIP-50 search string, else from the cache,
+// with requested IDs it no longer holds taken from storage
+func (r *RESTAPIServer) findEvents(ctx context.Context, filter nostr.Filter) ([]*models.Event, error) {
+	if filter.Search != "" {
+		return r.search.Filter(filter)
+	}
+	events, err := cache.Collect(r.cache.GetEvents(ctx, filter))
+	if err != nil || r.storage == nil || len(filter.IDs) == 0 {
+		return events, err
+	}
+	found := make(map[string]bool, len(events))
+	for _, event := range events {
+		found[event.ID] = true
+	}
+	for _, id := range filter.IDs {
+		if found[id] || (filter.Limit > 0 && len(events) >= filter.Limit) {
+			continue
+		}
+		event, err := r.storage.GetEvent(ctx, id)
+		if err != nil {
+			continue
+		}
+		if event.MatchesFilter(filter) {
+			found[id] = true
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+// searchHit is a search hit with its event
+type searchHit struct {
+	search.Hit
+	Event eventResponse `json:"event"`
+}
+
+// HandleSearch answers one query over every searchable kind, with counts
+// per type, highlighted excerpts and offset pagination
+func (r *RESTAPIServer) HandleSearch(w http.ResponseWriter, req *http.Request) {
+	if r.search == nil {
+		r.sendError(w, "Search is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	params := req.URL.Query()
+	q := search.Query{Text: params.Get("q")}
+	if types := params.Get("types"); types != "" {
+		for _, t := range strings.Split(types, ",") {
+			t = strings.TrimSpace(t)
+			if !knownSearchType(t) {
+				r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidFilter, fmt.Sprintf("Invalid type %q", t))
+				return
+			}
+			q.Types = append(q.Types, t)
+		}
+	}
+	if authors := params.Get("authors"); authors != "" {
+		for _, author := range strings.Split(authors, ",") {
+			pubkey, err := mirror.ParsePubkey(strings.TrimSpace(author))
+			if err != nil {
+				r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidFilter, fmt.Sprintf("Invalid author %q", author))
+				return
+			}
+			q.Authors = append(q.Authors, pubkey)
+		}
+	}
+	for name, target := range map[string]*int{"limit": &q.Limit, "offset": &q.Offset} {
+		if value := params.Get(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 0 {
+				r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidFilter, fmt.Sprintf("Invalid %s %q", name, value))
+				return
+			}
+			*target = n
+		}
+	}
+
+	result, err := r.search.Search(q)
+	if errors.Is(err, search.ErrEmptyQuery) {
+		r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidFilter, "Missing search terms in q")
+		return
+	}
+	if err != nil {
+		r.sendError(w, fmt.Sprintf("Failed to search: %v", err), http.StatusInternalServerError)
+		return
+	}
+
+	hits := make([]searchHit, 0, len(result.Hits))
+	for _, hit := range result.Hits {
+		hits = append(hits, searchHit{Hit: hit, Event: newEventResponse(hit.Event)})
+	}
+	response := map[string]interface{}{
+		"query":  q.Text,
+		"total":  result.Total,
+		"offset": result.Offset,
+		"limit":  result.Limit,
+		"facets": result.Facets,
+		"hits":   hits,
+	}
+	if next := result.Offset + len(result.Hits); next < result.Total {
+		response["next_offset"] = next
+	}
+	r.sendSuccess(w, response)
+}
+
+func knownSearchType(t string) bool {
+	for _, known := range search.Types {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,197 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/render"
+	"mercury-relay/pkg/ebooks"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// resolveBookSections returns the kind 30041 sections of a publication. The
+// index's "a" and "e" tags are followed regardless of who wrote the section,
+// so books with delegated chapters are complete. A section addressed by an
+// "a" tag must be signed by the pubkey in that address. Sections by the index
+// author that point back at the book with an "a" tag are included as well.
+func (r *RESTAPIServer) resolveBookSections(ctx context.Context, bookEvent *models.Event, bookIdentifier string) ([]*models.Event, error) {
+	// Addresses listed by the index, keyed by "pubkey:d"
+	addressed := make(map[string]bool)
+	authors := []string{bookEvent.PubKey}
+	var ids []string
+	for _, tag := range bookEvent.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "a":
+			parts := strings.SplitN(tag[1], ":", 3)
+			if len(parts) != 3 || parts[0] != "30041" {
+				continue
+			}
+			if !containsString(authors, parts[1]) {
+				authors = append(authors, parts[1])
+			}
+			addressed[parts[1]+":"+parts[2]] = true
+		case "e":
+			if nostr.IsValid32ByteHex(tag[1]) {
+				ids = append(ids, tag[1])
+			}
+		}
+	}
+
+	contentEvents, err := cache.Collect(r.cache.GetEvents(ctx, nostr.Filter{
+		Kinds:   []int{30041},
+		Authors: authors,
+	}))
+	if err != nil {
+		return nil, err
+	}
+
+	bookAddress := fmt.Sprintf("30040:%s:%s", bookEvent.PubKey, bookIdentifier)
+	seen := make(map[string]bool)
+	var sections []*models.Event
+	add := func(event *models.Event) {
+		if !seen[event.ID] {
+			seen[event.ID] = true
+			sections = append(sections, event)
+		}
+	}
+
+	for _, event := range contentEvents {
+		// The address's pubkey is the author, so a section only fills an
+		// address it was signed for
+		if addressed[event.PubKey+":"+eventDTag(event)] {
+			add(event)
+			continue
+		}
+		if event.PubKey != bookEvent.PubKey {
+			continue
+		}
+		for _, tag := range event.Tags {
+			if len(tag) >= 2 && tag[0] == "a" && tag[1] == bookAddress {
+				add(event)
+				break
+			}
+		}
+	}
+
+	// "e" tags pin a specific revision; the ID already commits to its author
+	if len(ids) > 0 {
+		pinned, err := cache.Collect(r.cache.GetEvents(ctx, nostr.Filter{Kinds: []int{30041}, IDs: ids}))
+		if err != nil {
+			log.Printf("Failed to resolve pinned sections for book %s: %v", bookEvent.ID, err)
+		}
+		for _, event := range pinned {
+			if event.Kind == 30041 {
+				add(event)
+			}
+		}
+	}
+
+	return sections, nil
+}
+
+// sectionAuthors looks up the kind 0 profile of every pubkey that wrote a
+// section. Authors without a cached profile get a pubkey-only entry.
+func (r *RESTAPIServer) sectionAuthors(ctx context.Context, sections []*models.Event) map[string]*ebooks.Contributor {
+	profiles := make(map[string]*ebooks.Contributor)
+	var pubkeys []string
+	for _, event := range sections {
+		if _, ok := profiles[event.PubKey]; ok {
+			continue
+		}
+		profiles[event.PubKey] = &ebooks.Contributor{PubKey: event.PubKey}
+		pubkeys = append(pubkeys, event.PubKey)
+	}
+	if len(pubkeys) == 0 {
+		return profiles
+	}
+
+	metadata, err := cache.Collect(r.cache.GetEvents(ctx, nostr.Filter{Kinds: []int{0}, Authors: pubkeys}))
+	if err != nil {
+		log.Printf("Failed to load section author profiles: %v", err)
+		return profiles
+	}
+
+	// Keep the newest profile per author
+	newest := make(map[string]nostr.Timestamp)
+	for _, event := range metadata {
+		profile, ok := profiles[event.PubKey]
+		if !ok || event.CreatedAt < newest[event.PubKey] {
+			continue
+		}
+		var fields map[string]interface{}
+		if err := json.Unmarshal([]byte(event.Content), &fields); err != nil {
+			continue
+		}
+		newest[event.PubKey] = event.CreatedAt
+		profile.Name = getString(fields, "name", "")
+		profile.DisplayName = getString(fields, "display_name", "")
+		profile.Picture = getString(fields, "picture", "")
+		profile.NIP05 = getString(fields, "nip05", "")
+	}
+
+	return profiles
+}
+
+// sectionLinks resolves wikilinks and cross references between a book's
+// sections by matching the target against each section's d tag, then its
+// title. href links to the section at index i.
+func sectionLinks(sections []*models.Event, href func(i int, section *models.Event) string) render.Resolver {
+	targets := make(map[string]string)
+	for i, section := range sections {
+		link := href(i, section)
+		if d := render.Slug(eventDTag(section)); d != "" {
+			targets[d] = link
+		}
+		var content map[string]interface{}
+		if json.Unmarshal([]byte(section.Content), &content) != nil {
+			continue
+		}
+		if title := render.Slug(getString(content, "title", "")); title != "" {
+			if _, taken := targets[title]; !taken {
+				targets[title] = link
+			}
+		}
+	}
+	return func(target string) (string, bool) {
+		link, ok := targets[render.Slug(target)]
+		return link, ok
+	}
+}
+
+// renderStructure renders the content of node and its children as XHTML
+func renderStructure(node *ebooks.Node, opts render.Options) {
+	if node.Content != "" {
+		node.Content = render.HTML(node.Content, node.Format, opts)
+		node.Format = "html"
+	}
+	for _, child := range node.Children {
+		renderStructure(child, opts)
+	}
+}
+
+func eventDTag(event *models.Event) string {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "d" {
+			return tag[1]
+		}
+	}
+	return ""
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,91 @@
+package api
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"mercury-relay/internal/identity"
+)
+
+// SetIdentity gives the API the relay's key; with sign_responses every
+// response carries a signature over its body
+func (r *RESTAPIServer) SetIdentity(id *identity.Identity) {
+	r.identity = id
+}
+
+// signingMiddleware buffers responses and signs them with the relay's key.
+// Streams are sent unsigned as soon as a handler flushes.
+func (r *RESTAPIServer) signingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if r.identity == nil || !r.identity.SignsResponses() {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		sw := &signingWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, req)
+		if sw.streaming {
+			return
+		}
+
+		timestamp := time.Now().Unix()
+		sig, err := r.identity.Sign(identity.ResponseMessage(timestamp, req.Method, req.URL.RequestURI(), sw.body.Bytes()))
+		if err != nil {
+			log.Printf("Failed to sign response: %v", err)
+		} else {
+			w.Header().Set(identity.PubkeyHeader, r.identity.PublicKey())
+			w.Header().Set(identity.SignatureHeader, sig)
+			w.Header().Set(identity.TimestampHeader, strconv.FormatInt(timestamp, 10))
+		}
+		w.WriteHeader(sw.statusCode())
+		w.Write(sw.body.Bytes())
+	})
+}
+
+// signingWriter holds a response back until it can be signed
+type signingWriter struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	streaming bool
+}
+
+func (sw *signingWriter) WriteHeader(status int) {
+	if sw.streaming {
+		sw.ResponseWriter.WriteHeader(status)
+		return
+	}
+	if sw.status == 0 {
+		sw.status = status
+	}
+}
+
+func (sw *signingWriter) Write(p []byte) (int, error) {
+	if sw.streaming {
+		return sw.ResponseWriter.Write(p)
+	}
+	return sw.body.Write(p)
+}
+
+// Flush gives up on signing and sends what was written so far
+func (sw *signingWriter) Flush() {
+	if !sw.streaming {
+		sw.streaming = true
+		sw.ResponseWriter.WriteHeader(sw.statusCode())
+		sw.ResponseWriter.Write(sw.body.Bytes())
+		sw.body.Reset()
+	}
+	if flusher, ok := sw.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (sw *signingWriter) statusCode() int {
+	if sw.status == 0 {
+		return http.StatusOK
+	}
+	return sw.status
+}
@@ -0,0 +1,303 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mercury-relay/internal/classify"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/problem"
+	"mercury-relay/internal/search"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// streamBuffer is how many new events a slow /stream reader may fall behind
+// before events are dropped for it
+const streamBuffer = 256
+
+var (
+	errTooManyStreams          = fmt.Errorf("too many open streams on this relay")
+	errTooManyStreamsForClient = fmt.Errorf("too many open streams for this client")
+)
+
+// eventStream is one open /api/v1/stream request
+type eventStream struct {
+	client    string
+	filter    nostr.Filter
+	languages []string
+	events    chan *models.Event
+	missed    atomic.Int64
+}
+
+// matches reports whether event belongs on the stream. A NIP-50 search is
+// matched with idx.
+func (s *eventStream) matches(event *models.Event, idx *search.Index) bool {
+	f := s.filter
+	if f.Search != "" && (idx == nil || !idx.Matches(event, f.Search)) {
+		return false
+	}
+	if !event.MatchesFilter(f) {
+		return false
+	}
+	return len(s.languages) == 0 || classify.MatchesLanguage(classify.EventLanguage(event), s.languages)
+}
+
+// streamHub fans new events out to the open /api/v1/stream requests
+type streamHub struct {
+	config    config.StreamConfig
+	search    *search.Index
+	streams   map[*eventStream]struct{}
+	perClient map[string]int
+	mu        sync.RWMutex
+}
+
+func newStreamHub(cfg config.StreamConfig) *streamHub {
+	return &streamHub{
+		config:    cfg,
+		streams:   make(map[*eventStream]struct{}),
+		perClient: make(map[string]int),
+	}
+}
+
+// open registers a stream for client, refusing it beyond the relay-wide
+// and per-client limits
+func (h *streamHub) open(client string, filter nostr.Filter, languages []string) (*eventStream, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.config.MaxStreams > 0 && len(h.streams) >= h.config.MaxStreams {
+		return nil, errTooManyStreams
+	}
+	if h.config.MaxStreamsPerClient > 0 && h.perClient[client] >= h.config.MaxStreamsPerClient {
+		return nil, errTooManyStreamsForClient
+	}
+	stream := &eventStream{
+		client:    client,
+		filter:    filter,
+		languages: languages,
+		events:    make(chan *models.Event, streamBuffer),
+	}
+	h.streams[stream] = struct{}{}
+	h.perClient[client]++
+	return stream, nil
+}
+
+// setSearch matches the NIP-50 searches of streams with idx
+func (h *streamHub) setSearch(idx *search.Index) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.search = idx
+}
+
+// close unregisters stream
+func (h *streamHub) close(stream *eventStream) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.streams[stream]; !ok {
+		return
+	}
+	delete(h.streams, stream)
+	if h.perClient[stream.client]--; h.perClient[stream.client] <= 0 {
+		delete(h.perClient, stream.client)
+	}
+}
+
+// publish delivers event to the streams it matches without blocking;
+// streams that fell too far behind count it as missed
+func (h *streamHub) publish(event *models.Event) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for stream := range h.streams {
+		if !stream.matches(event, h.search) {
+			continue
+		}
+		select {
+		case stream.events <- event:
+		default:
+			stream.missed.Add(1)
+		}
+	}
+}
+
+// filterValues counts the ids, authors, kinds and tag values of filter
+func filterValues(filter nostr.Filter) int {
+	n := len(filter.IDs) + len(filter.Authors) + len(filter.Kinds)
+	for _, values := range filter.Tags {
+		n += len(values)
+	}
+	return n
+}
+
+// streamSink writes the messages of an event stream in one wire format
+type streamSink interface {
+	contentType() string
+	event(event *models.Event) error
+	// message writes a control message: eose, missed or heartbeat
+	message(kind string, fields map[string]interface{}) error
+}
+
+// ndjsonSink writes one JSON object per line, {"type": ...}
+type ndjsonSink struct {
+	encoder *json.Encoder
+}
+
+func (s ndjsonSink) contentType() string { return "application/x-ndjson" }
+
+func (s ndjsonSink) event(event *models.Event) error {
+	return s.encoder.Encode(map[string]interface{}{"type": "event", "data": newEventResponse(event)})
+}
+
+func (s ndjsonSink) message(kind string, fields map[string]interface{}) error {
+	message := map[string]interface{}{"type": kind}
+	for k, v := range fields {
+		message[k] = v
+	}
+	return s.encoder.Encode(message)
+}
+
+// sseSink writes Server-Sent Events; Nostr events are "nostr" events with
+// the signed event as data and its ID as the SSE id
+type sseSink struct {
+	w http.ResponseWriter
+}
+
+func (s sseSink) contentType() string { return "text/event-stream" }
+
+func (s sseSink) event(event *models.Event) error {
+	data, err := json.Marshal(event.ToNostrEvent())
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.w, "id: %s\nevent: nostr\ndata: %s\n\n", event.ID, data)
+	return err
+}
+
+func (s sseSink) message(kind string, fields map[string]interface{}) error {
+	if fields == nil {
+		fields = map[string]interface{}{}
+	}
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(s.w, "event: %s\ndata: %s\n\n", kind, data)
+	return err
+}
+
+// HandleStream sends the stored events matching the query's filter as
+// newline-delimited JSON, then an "eose" line, then new matching events as
+// they are stored until the client disconnects. A filter whose until lies
+// in the past ends the stream after the stored events.
+func (r *RESTAPIServer) HandleStream(w http.ResponseWriter, req *http.Request) {
+	r.serveEventStream(w, req, ndjsonSink{encoder: json.NewEncoder(w)})
+}
+
+// handleSSEEvents is HandleStream over Server-Sent Events, for clients
+// without WebSocket or chunked fetch support
+func (r *RESTAPIServer) handleSSEEvents(w http.ResponseWriter, req *http.Request) {
+	r.serveEventStream(w, req, sseSink{w: w})
+}
+
+// serveEventStream streams the events matching the query's filter to sink:
+// stored ones, eose, then live ones until the client disconnects
+func (r *RESTAPIServer) serveEventStream(w http.ResponseWriter, req *http.Request, sink streamSink) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		r.sendError(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	filter, err := filterQuery(req.URL.Query())
+	if err != nil {
+		r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidFilter, err.Error())
+		return
+	}
+	limit := r.config.Stream.MaxFilterValues
+	if limit > 0 && filterValues(filter) > limit {
+		r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidFilter,
+			fmt.Sprintf("filter has more than %d values", limit))
+		return
+	}
+	languages := languageParam(req)
+	if !r.checkSearch(w, filter) {
+		return
+	}
+
+	live := filter.Until == nil || *filter.Until >= nostr.Now()
+	var stream *eventStream
+	if live {
+		// Open before loading stored events so nothing stored in between
+		// is missed; duplicates are skipped below
+		stream, err = r.streams.open(r.rateLimitClient(req), filter, languages)
+		if err != nil {
+			r.sendProblem(w, http.StatusTooManyRequests, problem.CodeQuotaExceeded, err.Error())
+			return
+		}
+		defer r.streams.close(stream)
+	}
+
+	events, err := r.findEvents(req.Context(), filter)
+	if err != nil {
+		r.sendError(w, fmt.Sprintf("Failed to get events: %v", err), http.StatusInternalServerError)
+		return
+	}
+	events = filterLanguage(events, languages)
+
+	w.Header().Set("Content-Type", sink.contentType())
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	sent := make(map[string]bool)
+	sendEvent := func(event *models.Event) bool {
+		sent[event.ID] = true
+		if sink.event(event) != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+	sendMessage := func(kind string, fields map[string]interface{}) bool {
+		if sink.message(kind, fields) != nil {
+			return false
+		}
+		flusher.Flush()
+		return true
+	}
+
+	for _, event := range events {
+		if !event.IsQuarantined && !sendEvent(event) {
+			return
+		}
+	}
+	if !sendMessage("eose", nil) || !live {
+		return
+	}
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case event := <-stream.events:
+			if missed := stream.missed.Swap(0); missed > 0 {
+				if !sendMessage("missed", map[string]interface{}{"count": missed}) {
+					return
+				}
+			}
+			if !sent[event.ID] && !sendEvent(event) {
+				return
+			}
+		case <-ticker.C:
+			if !sendMessage("heartbeat", map[string]interface{}{"timestamp": time.Now().Unix()}) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"mercury-relay/internal/bloom"
+	"mercury-relay/internal/problem"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// maxSyncEvents caps the missing events returned by one sync round
+const maxSyncEvents = 1000
+
+// SyncRequest describes the events a client already has for a filter
+type SyncRequest struct {
+	Filter nostr.Filter `json:"filter"`
+	Bloom  SyncBloom    `json:"bloom"`
+}
+
+// SyncBloom is a bloom filter over the client's event IDs, see bloom.Filter
+// for the layout
+type SyncBloom struct {
+	Bits   string `json:"bits"`
+	Hashes int    `json:"hashes"`
+	Tweak  uint32 `json:"tweak,omitempty"`
+}
+
+// HandleSync returns the events matching a filter that are not in the
+// client's bloom filter, so reconnecting clients only download what they
+// missed. When complete is false the client adds the returned events to its
+// filter and syncs again.
+func (r *RESTAPIServer) HandleSync(w http.ResponseWriter, req *http.Request) {
+	var syncReq SyncRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, req.Body, 2*bloom.MaxBytes)).Decode(&syncReq); err != nil {
+		r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidFilter, "Invalid JSON")
+		return
+	}
+
+	have, err := bloom.Decode(syncReq.Bloom.Bits, syncReq.Bloom.Hashes, syncReq.Bloom.Tweak)
+	if err != nil {
+		r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidFilter, err.Error())
+		return
+	}
+
+	limit := maxSyncEvents
+	if syncReq.Filter.Limit > 0 && syncReq.Filter.Limit < limit {
+		limit = syncReq.Filter.Limit
+	}
+	// The limit applies to the missing events, not to everything matched
+	filter := syncReq.Filter
+	filter.Limit = 0
+
+	missing := []nostr.Event{}
+	checked := 0
+	complete := true
+	for event, err := range r.cache.GetEvents(req.Context(), filter) {
+		if err != nil {
+			r.sendError(w, fmt.Sprintf("Failed to sync events: %v", err), http.StatusInternalServerError)
+			return
+		}
+		checked++
+		if have.Has(event.ID) {
+			continue
+		}
+		if len(missing) == limit {
+			complete = false
+			break
+		}
+		missing = append(missing, *event.ToNostrEvent())
+	}
+
+	r.sendSuccess(w, map[string]interface{}{
+		"events":   missing,
+		"checked":  checked,
+		"complete": complete,
+	})
+}
@@ -0,0 +1,288 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/models"
+
+	"github.com/gorilla/mux"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	// topicBuffer is how many events a slow topic subscriber may fall behind
+	// before events are dropped for it
+	topicBuffer = 64
+
+	// topicBacklogLimit is the default number of stored events replayed when
+	// a topic stream opens
+	topicBacklogLimit = 50
+)
+
+// Thread and chat kinds delivered on topic streams
+const (
+	kindChatMessage = 9    // NIP-29 group chat message
+	kindThreadReply = 10   // NIP-29 threaded reply (legacy)
+	kindThread      = 11   // NIP-7D thread root
+	kindThreadNote  = 12   // NIP-29 thread reply (legacy)
+	kindComment     = 1111 // NIP-22 comment
+)
+
+var groupKinds = []int{kindChatMessage, kindThreadReply, kindThread, kindThreadNote}
+
+// threadTopic and groupTopic name the streams an event is delivered on
+func threadTopic(root string) string { return "thread:" + root }
+func groupTopic(group string) string { return "group:" + group }
+
+// eventTopics returns the topics event belongs to: the thread it starts or
+// replies to, and the NIP-29 group named by its "h" tag
+func eventTopics(event *models.Event) []string {
+	var topics []string
+	switch event.Kind {
+	case kindThread:
+		topics = append(topics, threadTopic(event.ID))
+	case kindComment, kindThreadReply, kindThreadNote:
+		if root := threadRoot(event); root != "" {
+			topics = append(topics, threadTopic(root))
+		}
+	}
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "h" && tag[1] != "" {
+			topics = append(topics, groupTopic(tag[1]))
+			break
+		}
+	}
+	return topics
+}
+
+// threadRoot finds the root event of a reply: the NIP-22 "E" tag, else an
+// "e" tag marked root, else the first "e" tag
+func threadRoot(event *models.Event) string {
+	var first string
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch {
+		case tag[0] == "E":
+			return tag[1]
+		case tag[0] == "e" && len(tag) >= 4 && tag[3] == "root":
+			return tag[1]
+		case tag[0] == "e" && first == "":
+			first = tag[1]
+		}
+	}
+	return first
+}
+
+// topicHub fans new events out to topic stream subscribers
+type topicHub struct {
+	subscribers map[string]map[chan *models.Event]struct{}
+	mu          sync.RWMutex
+}
+
+func newTopicHub() *topicHub {
+	return &topicHub{subscribers: make(map[string]map[chan *models.Event]struct{})}
+}
+
+// subscribe returns a channel receiving events for topic and a function
+// that unsubscribes it
+func (h *topicHub) subscribe(topic string) (chan *models.Event, func()) {
+	ch := make(chan *models.Event, topicBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[topic] == nil {
+		h.subscribers[topic] = make(map[chan *models.Event]struct{})
+	}
+	h.subscribers[topic][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subscribers[topic], ch)
+		if len(h.subscribers[topic]) == 0 {
+			delete(h.subscribers, topic)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// publish delivers event to the subscribers of its topics without blocking;
+// subscribers that fell too far behind miss it
+func (h *topicHub) publish(event *models.Event) {
+	topics := eventTopics(event)
+	if len(topics) == 0 {
+		return
+	}
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, topic := range topics {
+		for ch := range h.subscribers[topic] {
+			select {
+			case ch <- event:
+			default:
+			}
+		}
+	}
+}
+
+// DeliverEvent passes a newly stored event to the topic and live event
+// streams
+func (r *RESTAPIServer) DeliverEvent(event *models.Event) {
+	if event.IsQuarantined {
+		return
+	}
+	r.topics.publish(event)
+	r.streams.publish(event)
+}
+
+// HandleThreadSSE streams a discussion: the kind 11 thread root and its
+// kind 1111 comments (or legacy NIP-29 replies), as Server-Sent Events
+func (r *RESTAPIServer) HandleThreadSSE(w http.ResponseWriter, req *http.Request) {
+	root := mux.Vars(req)["id"]
+	if !nostr.IsValid32ByteHex(root) {
+		r.sendError(w, "Invalid thread root event ID", http.StatusBadRequest)
+		return
+	}
+
+	r.streamTopic(w, req, threadTopic(root), []nostr.Filter{
+		{IDs: []string{root}},
+		{Kinds: []int{kindComment, kindThreadReply, kindThreadNote}, Tags: nostr.TagMap{"E": {root}}},
+		{Kinds: []int{kindComment, kindThreadReply, kindThreadNote}, Tags: nostr.TagMap{"e": {root}}},
+	})
+}
+
+// HandleGroupSSE streams a NIP-29 group's chat messages and threads as
+// Server-Sent Events
+func (r *RESTAPIServer) HandleGroupSSE(w http.ResponseWriter, req *http.Request) {
+	group := mux.Vars(req)["group"]
+	if group == "" {
+		r.sendError(w, "Group ID is required", http.StatusBadRequest)
+		return
+	}
+
+	r.streamTopic(w, req, groupTopic(group), []nostr.Filter{
+		{Kinds: groupKinds, Tags: nostr.TagMap{"h": {group}}},
+	})
+}
+
+// streamTopic replays recent stored events of topic, oldest first, then
+// sends new ones as they arrive. ?limit= bounds the replay and ?since=
+// (unix seconds) skips older events.
+func (r *RESTAPIServer) streamTopic(w http.ResponseWriter, req *http.Request, topic string, backlog []nostr.Filter) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		r.sendError(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	limit := topicBacklogLimit
+	if l, err := strconv.Atoi(req.URL.Query().Get("limit")); err == nil && l >= 0 {
+		limit = l
+	}
+	var since *nostr.Timestamp
+	if s, err := strconv.ParseInt(req.URL.Query().Get("since"), 10, 64); err == nil {
+		ts := nostr.Timestamp(s)
+		since = &ts
+	}
+
+	// Subscribe before loading the backlog so nothing published in between
+	// is missed; duplicates are skipped below
+	events, unsubscribe := r.topics.subscribe(topic)
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	fmt.Fprintf(w, "event: connected\n")
+	fmt.Fprintf(w, "data: {\"topic\": %q}\n\n", topic)
+
+	sent := make(map[string]bool)
+	for _, event := range r.topicBacklog(req.Context(), topic, backlog, since, limit) {
+		writeTopicEvent(w, event)
+		sent[event.ID] = true
+	}
+	fmt.Fprintf(w, "event: eose\ndata: {}\n\n")
+	flusher.Flush()
+
+	ticker := time.NewTicker(30 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case event := <-events:
+			if sent[event.ID] {
+				continue
+			}
+			sent[event.ID] = true
+			writeTopicEvent(w, event)
+			flusher.Flush()
+		case <-ticker.C:
+			fmt.Fprintf(w, "event: heartbeat\n")
+			fmt.Fprintf(w, "data: {\"timestamp\": %d}\n\n", time.Now().Unix())
+			flusher.Flush()
+		}
+	}
+}
+
+// topicBacklog loads up to limit of the newest stored events on topic,
+// returned oldest first
+func (r *RESTAPIServer) topicBacklog(ctx context.Context, topic string, filters []nostr.Filter, since *nostr.Timestamp, limit int) []*models.Event {
+	if limit == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	var backlog []*models.Event
+	for _, filter := range filters {
+		filter.Since = since
+		events, err := cache.Collect(r.cache.GetEvents(ctx, filter))
+		if err != nil {
+			log.Printf("Failed to load backlog for %s: %v", topic, err)
+			continue
+		}
+		for _, event := range events {
+			// Not every cache backend applies tag filters. A thread root
+			// of any kind belongs to its own thread.
+			inTopic := containsString(eventTopics(event), topic) || topic == threadTopic(event.ID)
+			if seen[event.ID] || event.IsQuarantined || !inTopic {
+				continue
+			}
+			if since != nil && event.CreatedAt < *since {
+				continue
+			}
+			seen[event.ID] = true
+			backlog = append(backlog, event)
+		}
+	}
+
+	sort.Slice(backlog, func(i, j int) bool {
+		return backlog[i].CreatedAt < backlog[j].CreatedAt
+	})
+	if len(backlog) > limit {
+		backlog = backlog[len(backlog)-limit:]
+	}
+	return backlog
+}
+
+func writeTopicEvent(w http.ResponseWriter, event *models.Event) {
+	data, err := json.Marshal(event.ToNostrEvent())
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(w, "id: %s\nevent: event\ndata: %s\n\n", event.ID, data)
+}
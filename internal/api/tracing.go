@@ -0,0 +1,39 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"mercury-relay/internal/logging"
+	"mercury-relay/internal/problem"
+	"mercury-relay/internal/tracing"
+
+	"github.com/gorilla/mux"
+)
+
+// tracingMiddleware records a server span per request, continuing the
+// client's trace when it sent a traceparent header
+func tracingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if tracing.Default() == nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+		route := req.URL.Path
+		if current := mux.CurrentRoute(req); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		ctx, span := tracing.Continue(req.Context(), req.Header.Get(tracing.TraceParentHeader), tracing.KindServer,
+			req.Method+" "+route, "http.method", req.Method, "http.route", route, logging.KeyRequestID, problem.RequestID(req))
+		defer span.End()
+
+		sw := &statusWriter{ResponseWriter: w}
+		next.ServeHTTP(sw, req.WithContext(ctx))
+		span.SetAttributes("http.status_code", sw.statusCode())
+		if sw.statusCode() >= 500 {
+			span.RecordError(errors.New(http.StatusText(sw.statusCode())))
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"mercury-relay/internal/problem"
+	"mercury-relay/internal/trending"
+)
+
+// maxTrendingLimit caps the events returned per kind
+const maxTrendingLimit = 100
+
+// SetTrending enables the trending endpoint
+func (r *RESTAPIServer) SetTrending(tracker *trending.Tracker) {
+	r.trending = tracker
+}
+
+// HandleTrending ranks notes, articles and books by the reactions, zaps and
+// replies they received in a sliding window, per kind
+func (r *RESTAPIServer) HandleTrending(w http.ResponseWriter, req *http.Request) {
+	if r.trending == nil {
+		r.sendError(w, "Trending is not enabled", http.StatusServiceUnavailable)
+		return
+	}
+
+	var q trending.Query
+	params := req.URL.Query()
+	if window := params.Get("window"); window != "" {
+		d, err := time.ParseDuration(window)
+		if err != nil || d <= 0 {
+			r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidFilter, fmt.Sprintf("Invalid window %q", window))
+			return
+		}
+		q.Window = d
+	}
+	if kinds := params.Get("kinds"); kinds != "" {
+		for _, kind := range strings.Split(kinds, ",") {
+			k, err := strconv.Atoi(strings.TrimSpace(kind))
+			if err != nil {
+				r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidFilter, fmt.Sprintf("Invalid kind %q", kind))
+				return
+			}
+			q.Kinds = append(q.Kinds, k)
+		}
+	}
+	if limit := params.Get("limit"); limit != "" {
+		l, err := strconv.Atoi(limit)
+		if err != nil || l <= 0 {
+			r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidFilter, fmt.Sprintf("Invalid limit %q", limit))
+			return
+		}
+		q.Limit = min(l, maxTrendingLimit)
+	}
+
+	result, err := r.trending.Top(req.Context(), q)
+	if errors.Is(err, trending.ErrInvalidWindow) {
+		r.sendProblem(w, http.StatusBadRequest, problem.CodeInvalidFilter, err.Error())
+		return
+	}
+	if err != nil {
+		r.sendError(w, fmt.Sprintf("Failed to rank events: %v", err), http.StatusInternalServerError)
+		return
+	}
+	r.sendSuccess(w, result)
+}
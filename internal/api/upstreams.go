@@ -0,0 +1,23 @@
+package api
+
+import (
+	"net/http"
+
+	"mercury-relay/internal/problem"
+	"mercury-relay/internal/streaming"
+)
+
+// SetUpstreamManager enables the admin endpoint reporting upstream health
+func (r *RESTAPIServer) SetUpstreamManager(upstreams *streaming.UpstreamManager) {
+	r.upstreams = upstreams
+}
+
+// HandleGetUpstreams returns the health and failover state of every enabled
+// upstream relay, by priority (admin only)
+func (r *RESTAPIServer) HandleGetUpstreams(w http.ResponseWriter, req *http.Request) {
+	if r.upstreams == nil {
+		r.sendProblem(w, http.StatusServiceUnavailable, problem.CodeUnavailable, "Streaming is not enabled")
+		return
+	}
+	r.sendSuccess(w, map[string]interface{}{"upstreams": r.upstreams.Health()})
+}
@@ -0,0 +1,69 @@
+package api
+
+import (
+	"net/http"
+
+	"mercury-relay/internal/access"
+	"mercury-relay/internal/mirror"
+
+	"github.com/gorilla/mux"
+)
+
+// SetAccessController enables the admin endpoints for reviewing pending
+// writer pubkeys
+func (r *RESTAPIServer) SetAccessController(accessControl *access.Controller) {
+	r.accessControl = accessControl
+}
+
+// HandleGetPendingWriters lists pubkeys waiting for write access, oldest
+// first, with the first event each one sent (admin only)
+func (r *RESTAPIServer) HandleGetPendingWriters(w http.ResponseWriter, req *http.Request) {
+	if r.accessControl == nil {
+		r.sendError(w, "Writer approval is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	r.sendSuccess(w, map[string]interface{}{
+		"writers": r.accessControl.PendingWriters(),
+	})
+}
+
+// HandleApproveWriter grants a pubkey write access (admin only)
+func (r *RESTAPIServer) HandleApproveWriter(w http.ResponseWriter, req *http.Request) {
+	r.decideWriter(w, req, access.WriterApproved)
+}
+
+// HandleDenyWriter rejects a pubkey's write request or revokes an earlier
+// approval (admin only)
+func (r *RESTAPIServer) HandleDenyWriter(w http.ResponseWriter, req *http.Request) {
+	r.decideWriter(w, req, access.WriterDenied)
+}
+
+func (r *RESTAPIServer) decideWriter(w http.ResponseWriter, req *http.Request, status access.WriterStatus) {
+	if r.accessControl == nil {
+		r.sendError(w, "Writer approval is not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	pubkey, err := mirror.ParsePubkey(mux.Vars(req)["pubkey"])
+	if err != nil {
+		r.sendError(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	admin := r.auth.GetAuthenticatedNpub(req)
+	if status == access.WriterApproved {
+		err = r.accessControl.ApproveWriter(pubkey, admin)
+	} else {
+		err = r.accessControl.DenyWriter(pubkey, admin)
+	}
+	if err != nil {
+		r.sendError(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	r.sendSuccess(w, map[string]interface{}{
+		"pubkey": pubkey,
+		"status": status,
+	})
+}
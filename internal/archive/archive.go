@@ -0,0 +1,411 @@
+// Package archive copies finalized publications to external storage: an
+// S3-compatible bucket, the Internet Archive, or both. Each copy holds the
+// book as an EPUB, the raw signed events it was built from and a manifest of
+// their IDs and signatures, so readers can verify the archive without the
+// relay. Where each book was archived is recorded and served back over REST.
+package archive
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// KindBook is the publication index archived with its sections
+const KindBook = 30040
+
+var (
+	ErrIncomplete = fmt.Errorf("publication is incomplete")
+	ErrRestricted = fmt.Errorf("publication is restricted to entitled readers")
+	ErrNoTargets  = fmt.Errorf("no archive targets configured")
+)
+
+// File is one object uploaded for a package
+type File struct {
+	Name        string
+	ContentType string
+	Data        []byte
+}
+
+// Package is a publication ready to upload
+type Package struct {
+	Book    string // address "30040:<pubkey>:<d>"
+	EventID string // the book version packaged
+	Title   string
+	Author  string
+	Files   []File
+}
+
+// Manifest describes a package; it is uploaded as manifest.json
+type Manifest struct {
+	Book       string          `json:"book"`
+	EventID    string          `json:"event_id"`
+	Title      string          `json:"title"`
+	Author     string          `json:"author"`
+	CreatedAt  int64           `json:"created_at"`
+	ArchivedAt time.Time       `json:"archived_at"`
+	Events     []ManifestEvent `json:"events"`
+	Files      []ManifestFile  `json:"files"`
+}
+
+// ManifestEvent lists a packaged event with its signature
+type ManifestEvent struct {
+	ID     string `json:"id"`
+	Kind   int    `json:"kind"`
+	PubKey string `json:"pubkey"`
+	Sig    string `json:"sig"`
+}
+
+// ManifestFile lists a packaged file with its digest
+type ManifestFile struct {
+	Name   string `json:"name"`
+	Size   int    `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Build packages book, its sections and the EPUB rendered from them
+func Build(book *models.Event, sections []*models.Event, title string, epub []byte) (*Package, error) {
+	d := book.Tags.GetD()
+	if book.Kind != KindBook || d == "" {
+		return nil, fmt.Errorf("%w: not an addressable book", ErrIncomplete)
+	}
+	if title == "" {
+		title = d
+	}
+
+	var events strings.Builder
+	manifest := Manifest{
+		Book:       fmt.Sprintf("%d:%s:%s", KindBook, book.PubKey, d),
+		EventID:    book.ID,
+		Title:      title,
+		Author:     book.PubKey,
+		CreatedAt:  int64(book.CreatedAt),
+		ArchivedAt: time.Now().UTC(),
+	}
+	for _, event := range append([]*models.Event{book}, sections...) {
+		line, err := json.Marshal(event.ToNostrEvent())
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode event %s: %w", event.ID, err)
+		}
+		events.Write(line)
+		events.WriteByte('\n')
+		manifest.Events = append(manifest.Events, ManifestEvent{ID: event.ID, Kind: event.Kind, PubKey: event.PubKey, Sig: event.Sig})
+	}
+
+	files := []File{
+		{Name: slug(title) + ".epub", ContentType: "application/epub+zip", Data: epub},
+		{Name: "events.jsonl", ContentType: "application/x-ndjson", Data: []byte(events.String())},
+	}
+	for _, f := range files {
+		sum := sha256.Sum256(f.Data)
+		manifest.Files = append(manifest.Files, ManifestFile{Name: f.Name, Size: len(f.Data), SHA256: hex.EncodeToString(sum[:])})
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	files = append(files, File{Name: "manifest.json", ContentType: "application/json", Data: data})
+
+	return &Package{Book: manifest.Book, EventID: book.ID, Title: title, Author: book.PubKey, Files: files}, nil
+}
+
+var unsafeChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// slug turns a title into a file or identifier safe name
+func slug(s string) string {
+	s = strings.Trim(unsafeChars.ReplaceAllString(strings.ToLower(s), "-"), "-")
+	if len(s) > 60 {
+		s = strings.TrimRight(s[:60], "-")
+	}
+	if s == "" {
+		return "book"
+	}
+	return s
+}
+
+// Target is somewhere packages are uploaded
+type Target interface {
+	// Name identifies the target in records
+	Name() string
+	// Upload stores every file of pkg and returns where the copy can be found
+	Upload(ctx context.Context, pkg *Package) (string, error)
+}
+
+// Packager renders a stored book into a package
+type Packager interface {
+	PackageBook(ctx context.Context, book *models.Event) (*Package, error)
+}
+
+// Record notes one archived copy of a book version
+type Record struct {
+	Book       string    `json:"book"`
+	EventID    string    `json:"event_id"`
+	Target     string    `json:"target"`
+	URL        string    `json:"url"`
+	ArchivedAt time.Time `json:"archived_at"`
+}
+
+// Archiver uploads packages to its targets and keeps the records in path
+type Archiver struct {
+	config   config.ArchiveConfig
+	cache    cache.Cache
+	targets  []Target
+	packager Packager
+
+	mu      sync.Mutex
+	records []Record
+	running map[string]bool // event IDs being archived
+}
+
+// NewArchiver sets up the targets enabled in cfg and loads the records
+// saved at cfg.Path. Books in c are archived by Run once finalized.
+func NewArchiver(cfg config.ArchiveConfig, c cache.Cache) (*Archiver, error) {
+	if cfg.Interval <= 0 {
+		cfg.Interval = time.Hour
+	}
+	if cfg.FinalizeAfter <= 0 {
+		cfg.FinalizeAfter = 24 * time.Hour
+	}
+
+	a := &Archiver{config: cfg, cache: c, running: make(map[string]bool)}
+	if cfg.S3.Enabled {
+		target, err := NewS3(cfg.S3)
+		if err != nil {
+			return nil, err
+		}
+		a.targets = append(a.targets, target)
+	}
+	if cfg.InternetArchive.Enabled {
+		target, err := NewInternetArchive(cfg.InternetArchive)
+		if err != nil {
+			return nil, err
+		}
+		a.targets = append(a.targets, target)
+	}
+
+	if err := a.load(); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// AddTarget uploads packages to t as well
+func (a *Archiver) AddTarget(t Target) {
+	a.targets = append(a.targets, t)
+}
+
+// SetPackager renders books for the archiver
+func (a *Archiver) SetPackager(p Packager) {
+	a.packager = p
+}
+
+// Records returns where versions of book have been archived, newest first
+func (a *Archiver) Records(book string) []Record {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	var out []Record
+	for _, r := range a.records {
+		if r.Book == book {
+			out = append(out, r)
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].ArchivedAt.After(out[j].ArchivedAt) })
+	return out
+}
+
+// Archive uploads pkg to every target that doesn't hold this version yet and
+// records the copies. Records made before a target failed are kept.
+func (a *Archiver) Archive(ctx context.Context, pkg *Package) ([]Record, error) {
+	if len(a.targets) == 0 {
+		return nil, ErrNoTargets
+	}
+
+	a.mu.Lock()
+	if a.running[pkg.EventID] {
+		a.mu.Unlock()
+		return nil, fmt.Errorf("book version %s is already being archived", pkg.EventID)
+	}
+	a.running[pkg.EventID] = true
+	done := a.archivedLocked(pkg.EventID)
+	a.mu.Unlock()
+	defer func() {
+		a.mu.Lock()
+		delete(a.running, pkg.EventID)
+		a.mu.Unlock()
+	}()
+
+	var made []Record
+	var errs []error
+	for _, target := range a.targets {
+		if done[target.Name()] {
+			continue
+		}
+		url, err := target.Upload(ctx, pkg)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", target.Name(), err))
+			continue
+		}
+		record := Record{Book: pkg.Book, EventID: pkg.EventID, Target: target.Name(), URL: url, ArchivedAt: time.Now().UTC()}
+		a.mu.Lock()
+		a.records = append(a.records, record)
+		err = a.saveLocked()
+		a.mu.Unlock()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		made = append(made, record)
+	}
+	return made, errors.Join(errs...)
+}
+
+// Archived reports whether every target holds the book version eventID
+func (a *Archiver) Archived(eventID string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	done := a.archivedLocked(eventID)
+	for _, target := range a.targets {
+		if !done[target.Name()] {
+			return false
+		}
+	}
+	return true
+}
+
+// archivedLocked returns the targets holding eventID. a.mu must be held.
+func (a *Archiver) archivedLocked(eventID string) map[string]bool {
+	done := make(map[string]bool)
+	for _, r := range a.records {
+		if r.EventID == eventID {
+			done[r.Target] = true
+		}
+	}
+	return done
+}
+
+// Run archives finalized books every interval until ctx is done
+func (a *Archiver) Run(ctx context.Context) {
+	ticker := time.NewTicker(a.config.Interval)
+	defer ticker.Stop()
+	for {
+		a.archiveFinalized(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// archiveFinalized archives the latest version of every book that hasn't
+// been revised for FinalizeAfter
+func (a *Archiver) archiveFinalized(ctx context.Context) {
+	if a.packager == nil || a.cache == nil || len(a.targets) == 0 {
+		return
+	}
+	for _, book := range a.Finalized(ctx) {
+		if a.Archived(book.ID) {
+			continue
+		}
+		pkg, err := a.packager.PackageBook(ctx, book)
+		if errors.Is(err, ErrIncomplete) || errors.Is(err, ErrRestricted) {
+			continue
+		}
+		if err != nil {
+			log.Printf("Failed to package book %s: %v", book.ID, err)
+			continue
+		}
+		records, err := a.Archive(ctx, pkg)
+		for _, r := range records {
+			log.Printf("Archived book %s to %s: %s", r.Book, r.Target, r.URL)
+		}
+		if err != nil {
+			log.Printf("Failed to archive book %s: %v", pkg.Book, err)
+		}
+	}
+}
+
+// Finalized returns the latest version of each cached book last revised
+// more than FinalizeAfter ago
+func (a *Archiver) Finalized(ctx context.Context) []*models.Event {
+	latest := make(map[string]*models.Event)
+	for event, err := range a.cache.GetEvents(ctx, nostr.Filter{Kinds: []int{KindBook}}) {
+		if err != nil {
+			log.Printf("Failed to list books to archive: %v", err)
+			return nil
+		}
+		if event.IsQuarantined {
+			continue
+		}
+		key := event.PubKey + ":" + event.Tags.GetD()
+		if current, ok := latest[key]; !ok || event.CreatedAt > current.CreatedAt {
+			latest[key] = event
+		}
+	}
+
+	cutoff := time.Now().Add(-a.config.FinalizeAfter)
+	var books []*models.Event
+	for _, book := range latest {
+		if book.CreatedTime().Before(cutoff) {
+			books = append(books, book)
+		}
+	}
+	sort.Slice(books, func(i, j int) bool { return books[i].CreatedAt < books[j].CreatedAt })
+	return books
+}
+
+func (a *Archiver) load() error {
+	if a.config.Path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(a.config.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", a.config.Path, err)
+	}
+	if err := json.Unmarshal(data, &a.records); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", a.config.Path, err)
+	}
+	return nil
+}
+
+// saveLocked atomically writes the records to path. Callers must hold a.mu.
+func (a *Archiver) saveLocked() error {
+	if a.config.Path == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(a.records, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode archive records: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(a.config.Path), 0755); err != nil {
+		return fmt.Errorf("failed to write archive records: %w", err)
+	}
+	tmp := a.config.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write archive records: %w", err)
+	}
+	if err := os.Rename(tmp, a.config.Path); err != nil {
+		return fmt.Errorf("failed to write archive records: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"mercury-relay/internal/config"
+)
+
+// InternetArchive uploads packages as Internet Archive items through its
+// S3-like API, one item per book version
+type InternetArchive struct {
+	config config.InternetArchiveConfig
+	client *http.Client
+}
+
+// NewInternetArchive checks cfg and returns its target
+func NewInternetArchive(cfg config.InternetArchiveConfig) (*InternetArchive, error) {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3.us.archive.org"
+	}
+	if cfg.DetailsURL == "" {
+		cfg.DetailsURL = "https://archive.org/details"
+	}
+	if cfg.IdentifierPrefix == "" {
+		cfg.IdentifierPrefix = "mercury"
+	}
+	if cfg.Collection == "" {
+		cfg.Collection = "opensource"
+	}
+	if cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("internet archive needs an access key and secret key")
+	}
+	if _, err := url.Parse(cfg.Endpoint); err != nil {
+		return nil, fmt.Errorf("invalid internet archive endpoint %q", cfg.Endpoint)
+	}
+	return &InternetArchive{config: cfg, client: &http.Client{Timeout: uploadTimeout}}, nil
+}
+
+// Name identifies the target in records
+func (ia *InternetArchive) Name() string {
+	return "internet_archive"
+}
+
+// Identifier is the item a book version is uploaded to
+func (ia *InternetArchive) Identifier(pkg *Package) string {
+	parts := strings.SplitN(pkg.Book, ":", 3)
+	id := slug(ia.config.IdentifierPrefix) + "-" + slug(parts[2])
+	if len(id) > 80 {
+		id = strings.TrimRight(id[:80], "-")
+	}
+	version := pkg.EventID
+	if len(version) > 16 {
+		version = version[:16]
+	}
+	return id + "-" + version
+}
+
+// Upload creates the item with the book's metadata and returns its page
+func (ia *InternetArchive) Upload(ctx context.Context, pkg *Package) (string, error) {
+	identifier := ia.Identifier(pkg)
+	for i, f := range pkg.Files {
+		fileURL := strings.TrimRight(ia.config.Endpoint, "/") + "/" + identifier + "/" + url.PathEscape(f.Name)
+		req, err := http.NewRequestWithContext(ctx, http.MethodPut, fileURL, bytes.NewReader(f.Data))
+		if err != nil {
+			return "", fmt.Errorf("failed to create upload request: %w", err)
+		}
+		req.Header.Set("Authorization", "LOW "+ia.config.AccessKey+":"+ia.config.SecretKey)
+		req.Header.Set("Content-Type", f.ContentType)
+		if i == 0 {
+			// The first file creates the item
+			req.Header.Set("x-archive-auto-make-bucket", "1")
+			req.Header.Set("x-archive-meta-mediatype", "texts")
+			req.Header.Set("x-archive-meta-collection", ia.config.Collection)
+			req.Header.Set("x-archive-meta-title", headerValue(pkg.Title))
+			req.Header.Set("x-archive-meta-creator", pkg.Author)
+			req.Header.Set("x-archive-meta-source", "nostr:"+pkg.Book)
+			req.Header.Set("x-archive-meta-external-identifier", "nostr:"+pkg.EventID)
+		}
+
+		resp, err := ia.client.Do(req)
+		if err != nil {
+			return "", fmt.Errorf("failed to upload %s: %w", f.Name, err)
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			return "", fmt.Errorf("failed to upload %s: %s: %s", f.Name, resp.Status, strings.TrimSpace(string(body)))
+		}
+	}
+	return strings.TrimRight(ia.config.DetailsURL, "/") + "/" + identifier, nil
+}
+
+// headerValue keeps non-ASCII metadata intact using the archive's uri()
+// encoding for header values
+func headerValue(s string) string {
+	for _, r := range s {
+		if r > 126 || r < 32 {
+			return "uri(" + url.PathEscape(s) + ")"
+		}
+	}
+	return s
+}
@@ -0,0 +1,206 @@
+package archive
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"mercury-relay/internal/config"
+)
+
+// uploadTimeout bounds a single object upload
+const uploadTimeout = 5 * time.Minute
+
+// S3 uploads packages to an S3-compatible bucket, one prefix per book
+// version: <prefix>/<pubkey>/<d>/<event id>/<file>
+type S3 struct {
+	config   config.S3ArchiveConfig
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+// NewS3 checks cfg and returns its target. Requests are signed with AWS
+// Signature Version 4 and use path-style URLs unless VirtualHost is set.
+func NewS3(cfg config.S3ArchiveConfig) (*S3, error) {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3.amazonaws.com"
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("s3 archive needs a bucket, access key and secret key")
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 archive endpoint %q", cfg.Endpoint)
+	}
+	return &S3{config: cfg, endpoint: endpoint, client: &http.Client{Timeout: uploadTimeout}, now: time.Now}, nil
+}
+
+// Name identifies the target in records
+func (s *S3) Name() string {
+	return "s3"
+}
+
+// Upload puts every file of pkg and returns the manifest's URL
+func (s *S3) Upload(ctx context.Context, pkg *Package) (string, error) {
+	dir := s.keyPrefix(pkg)
+	var manifest string
+	for _, f := range pkg.Files {
+		objectURL := s.objectURL(dir + f.Name)
+		if err := s.put(ctx, objectURL, f); err != nil {
+			return "", err
+		}
+		if f.Name == "manifest.json" {
+			manifest = objectURL.String()
+			if s.config.PublicURL != "" {
+				manifest = strings.TrimRight(s.config.PublicURL, "/") + "/" + dir + f.Name
+			}
+		}
+	}
+	return manifest, nil
+}
+
+// keyPrefix is the directory a book version is stored under
+func (s *S3) keyPrefix(pkg *Package) string {
+	parts := strings.SplitN(pkg.Book, ":", 3)
+	prefix := strings.Trim(s.config.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return prefix + parts[1] + "/" + slug(parts[2]) + "/" + pkg.EventID + "/"
+}
+
+func (s *S3) objectURL(key string) *url.URL {
+	u := *s.endpoint
+	if s.config.VirtualHost {
+		u.Host = s.config.Bucket + "." + u.Host
+		u.Path = "/" + key
+	} else {
+		u.Path = "/" + s.config.Bucket + "/" + key
+	}
+	return &u
+}
+
+func (s *S3) put(ctx context.Context, objectURL *url.URL, f File) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectURL.String(), bytes.NewReader(f.Data))
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.Header.Set("Content-Type", f.ContentType)
+	sum := sha256.Sum256(f.Data)
+	SignV4(req, hex.EncodeToString(sum[:]), s.config.AccessKey, s.config.SecretKey, s.config.Region, s.now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to upload %s: %w", f.Name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("failed to upload %s: %s: %s", f.Name, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// SignV4 adds an AWS Signature Version 4 Authorization header to req for
+// the s3 service, covering the host and every header already set
+func SignV4(req *http.Request, payloadHash, accessKey, secretKey, region string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		canonicalPath(req.URL.Path),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+secretKey), date)
+	for _, part := range []string{region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalPath URI-encodes each segment of path
+func canonicalPath(path string) string {
+	if path == "" {
+		return "/"
+	}
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = uriEncode(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// canonicalQuery sorts and encodes query parameters
+func canonicalQuery(values url.Values) string {
+	var pairs []string
+	for name, list := range values {
+		for _, value := range list {
+			pairs = append(pairs, uriEncode(name)+"="+uriEncode(value))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything but unreserved characters
+func uriEncode(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '_' || c == '.' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -11,6 +11,7 @@ import (
 	"mercury-relay/internal/cache"
 	"mercury-relay/internal/config"
 	"mercury-relay/internal/models"
+	"mercury-relay/internal/problem"
 	"mercury-relay/internal/queue"
 
 	"github.com/nbd-wtf/go-nostr"
@@ -252,7 +253,7 @@ func (ua *UniversalAuthenticator) GetAdminNpubs() []string {
 func (ua *UniversalAuthenticator) RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !ua.AuthenticateRequest(r) {
-			http.Error(w, "Unauthorized: Nostr authentication required", http.StatusUnauthorized)
+			problem.Write(w, http.StatusUnauthorized, "", "Unauthorized: Nostr authentication required")
 			return
 		}
 		next(w, r)
@@ -264,7 +265,7 @@ func (ua *UniversalAuthenticator) RequireAdmin(next http.HandlerFunc) http.Handl
 	return func(w http.ResponseWriter, r *http.Request) {
 		npub := r.Header.Get("X-Nostr-Pubkey")
 		if npub == "" || !ua.IsAdmin(npub) {
-			http.Error(w, "Forbidden: Admin access required", http.StatusForbidden)
+			problem.Write(w, http.StatusForbidden, "", "Forbidden: Admin access required")
 			return
 		}
 		next(w, r)
@@ -0,0 +1,332 @@
+// Package backfill imports events from other relays. Each relay is paged
+// back in time through a filter; fetched events are verified, checked by
+// quality control and stored in the cache and storage like events published
+// to the relay. Progress is checkpointed after every page so an interrupted
+// import resumes where it stopped.
+package backfill
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/normalize"
+	"mercury-relay/internal/storage"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	defaultPageSize = 500
+
+	// maxPages bounds how far back one relay is paged in a single run
+	maxPages = 10000
+)
+
+// Fetcher queries a relay for stored events
+type Fetcher interface {
+	Fetch(ctx context.Context, url string, filter nostr.Filter) ([]*nostr.Event, error)
+}
+
+// Quality is the part of quality control imported events go through
+type Quality interface {
+	IsNpubBlocked(npub string) bool
+	IsEventBanned(eventID string) bool
+	Rescore(event *models.Event) error
+}
+
+// Options controls a backfill run
+type Options struct {
+	// Relays to import from, one after the other
+	Relays []string
+	// Filter selects the events to import; limit is ignored
+	Filter nostr.Filter
+	// PageSize is the number of events asked for per request
+	PageSize int
+	// CheckpointPath, if set, records progress after every page
+	CheckpointPath string
+	// Resume continues the run in CheckpointPath with its relays and filter
+	Resume bool
+}
+
+// RelayProgress is what was imported from one relay
+type RelayProgress struct {
+	URL        string `json:"url"`
+	Until      int64  `json:"until,omitempty"` // the next page ends at this time
+	Fetched    int64  `json:"fetched"`
+	Imported   int64  `json:"imported"`
+	Duplicates int64  `json:"duplicates"`
+	Rejected   int64  `json:"rejected"`
+	Invalid    int64  `json:"invalid"`
+	Failed     int64  `json:"failed"`
+	Error      string `json:"error,omitempty"`
+	Done       bool   `json:"done"`
+}
+
+// Progress is reported after every page and persisted as the checkpoint
+type Progress struct {
+	Filter    nostr.Filter     `json:"filter"`
+	Relays    []*RelayProgress `json:"relays"`
+	StartedAt time.Time        `json:"started_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+	Done      bool             `json:"done"`
+}
+
+// Totals sums the progress of every relay
+func (p Progress) Totals() RelayProgress {
+	var total RelayProgress
+	for _, relay := range p.Relays {
+		total.Fetched += relay.Fetched
+		total.Imported += relay.Imported
+		total.Duplicates += relay.Duplicates
+		total.Rejected += relay.Rejected
+		total.Invalid += relay.Invalid
+		total.Failed += relay.Failed
+	}
+	return total
+}
+
+// Backfiller imports events from other relays
+type Backfiller struct {
+	fetcher    Fetcher
+	quality    Quality
+	cache      cache.Cache
+	storage    storage.Storage
+	normalizer *normalize.Normalizer
+	onProgress func(Progress)
+}
+
+// NewBackfiller stores imported events in c and s; quality and s may be nil
+func NewBackfiller(fetcher Fetcher, quality Quality, c cache.Cache, s storage.Storage) *Backfiller {
+	return &Backfiller{
+		fetcher: fetcher,
+		quality: quality,
+		cache:   c,
+		storage: s,
+	}
+}
+
+// SetNormalizer canonicalizes tag values of imported events before they are
+// stored
+func (b *Backfiller) SetNormalizer(normalizer *normalize.Normalizer) {
+	b.normalizer = normalizer
+}
+
+// OnProgress sets a callback invoked after every page
+func (b *Backfiller) OnProgress(fn func(Progress)) {
+	b.onProgress = fn
+}
+
+// Run imports from every relay until each is exhausted or ctx is cancelled.
+// A relay that fails is recorded and skipped, leaving the run not done; an
+// unfinished run can be continued with Options.Resume.
+func (b *Backfiller) Run(ctx context.Context, opts Options) (Progress, error) {
+	progress := Progress{Filter: opts.Filter, StartedAt: time.Now()}
+	if opts.Resume && opts.CheckpointPath != "" {
+		var err error
+		if progress, err = LoadCheckpoint(opts.CheckpointPath); err != nil {
+			return progress, err
+		}
+	} else {
+		seen := make(map[string]bool)
+		for _, url := range opts.Relays {
+			url = nostr.NormalizeURL(url)
+			if url != "" && !seen[url] {
+				seen[url] = true
+				progress.Relays = append(progress.Relays, &RelayProgress{URL: url})
+			}
+		}
+	}
+	if len(progress.Relays) == 0 {
+		return progress, fmt.Errorf("no relays to backfill from")
+	}
+
+	pageSize := opts.PageSize
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+
+	for _, relay := range progress.Relays {
+		if relay.Done {
+			continue
+		}
+		if err := b.backfillRelay(ctx, relay, &progress, pageSize, opts.CheckpointPath); err != nil {
+			return progress, err
+		}
+	}
+
+	progress.Done = true
+	for _, relay := range progress.Relays {
+		progress.Done = progress.Done && relay.Done
+	}
+	progress.UpdatedAt = time.Now()
+	if opts.CheckpointPath != "" {
+		if err := SaveCheckpoint(opts.CheckpointPath, progress); err != nil {
+			return progress, err
+		}
+	}
+	return progress, nil
+}
+
+// backfillRelay pages back through one relay, reporting after every page.
+// It only returns an error when ctx is done or the checkpoint can't be saved.
+func (b *Backfiller) backfillRelay(ctx context.Context, relay *RelayProgress, progress *Progress, pageSize int, checkpointPath string) error {
+	found := make(map[string]bool)
+	filter := progress.Filter
+	filter.Limit = pageSize
+
+	for page := 0; page < maxPages; page++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if relay.Until != 0 {
+			until := nostr.Timestamp(relay.Until)
+			filter.Until = &until
+		}
+
+		events, err := b.fetcher.Fetch(ctx, relay.URL, filter)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			relay.Error = err.Error()
+			log.Printf("Backfill from %s failed: %v", relay.URL, err)
+			break
+		}
+		relay.Error = ""
+
+		fresh := 0
+		oldest := nostr.Timestamp(0)
+		for _, event := range events {
+			if found[event.ID] {
+				continue
+			}
+			found[event.ID] = true
+			fresh++
+			relay.Fetched++
+			if oldest == 0 || event.CreatedAt < oldest {
+				oldest = event.CreatedAt
+			}
+			b.importEvent(ctx, event, relay, progress.Filter)
+		}
+
+		// Page back from the oldest event seen until a page brings nothing
+		// new, requesting the boundary second again so events sharing it
+		// aren't skipped. Relays may cap the page below the limit, so a
+		// short page isn't the end.
+		if fresh == 0 {
+			relay.Done = true
+		} else {
+			relay.Until = int64(oldest)
+		}
+		if err := b.report(progress, checkpointPath); err != nil {
+			return err
+		}
+		if relay.Done {
+			return nil
+		}
+	}
+
+	// Given up on: the run carries on with the next relay and a resumed run
+	// retries this one from its cursor
+	return b.report(progress, checkpointPath)
+}
+
+// importEvent verifies, checks and stores one fetched event
+func (b *Backfiller) importEvent(ctx context.Context, ne *nostr.Event, relay *RelayProgress, filter nostr.Filter) {
+	if !ne.CheckID() || !filter.Matches(ne) {
+		relay.Invalid++
+		return
+	}
+	if ok, err := ne.CheckSignature(); err != nil || !ok {
+		relay.Invalid++
+		return
+	}
+
+	existing, err := cache.Collect(b.cache.GetEvents(ctx, nostr.Filter{IDs: []string{ne.ID}}))
+	if err == nil && len(existing) > 0 {
+		relay.Duplicates++
+		return
+	}
+
+	event := models.FromNostrEvent(ne)
+	if b.quality != nil {
+		if b.quality.IsNpubBlocked(event.PubKey) || b.quality.IsEventBanned(event.ID) {
+			relay.Rejected++
+			return
+		}
+		if err := b.quality.Rescore(event); err != nil {
+			relay.Rejected++
+			return
+		}
+	} else {
+		event.QualityScore = event.CalculateQualityScore()
+	}
+	event.AddProvenance(models.ProvenanceReplay, relay.URL, "")
+	if b.normalizer != nil {
+		b.normalizer.Apply(event)
+	}
+
+	if err := b.cache.StoreEvent(event); err != nil {
+		relay.Failed++
+		log.Printf("Backfill failed to cache event %s: %v", event.ID, err)
+		return
+	}
+	if b.storage != nil {
+		if err := b.storage.StoreEvent(event); err != nil {
+			relay.Failed++
+			log.Printf("Backfill failed to store event %s: %v", event.ID, err)
+			return
+		}
+	}
+	relay.Imported++
+}
+
+// report saves the checkpoint and calls the progress callback
+func (b *Backfiller) report(progress *Progress, checkpointPath string) error {
+	progress.UpdatedAt = time.Now()
+	if checkpointPath != "" {
+		if err := SaveCheckpoint(checkpointPath, *progress); err != nil {
+			return err
+		}
+	}
+	if b.onProgress != nil {
+		b.onProgress(*progress)
+	}
+	return nil
+}
+
+// LoadCheckpoint reads backfill progress saved by SaveCheckpoint
+func LoadCheckpoint(path string) (Progress, error) {
+	var progress Progress
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return progress, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	if err := json.Unmarshal(data, &progress); err != nil {
+		return progress, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	return progress, nil
+}
+
+// SaveCheckpoint atomically writes backfill progress to path
+func SaveCheckpoint(path string, progress Progress) error {
+	data, err := json.MarshalIndent(progress, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package backfill
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+	"mercury-relay/test/mocks"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// relayFetcher serves events per relay URL newest first, honoring until and
+// limit like a relay would
+type relayFetcher struct {
+	events map[string][]*nostr.Event
+	fail   map[string]bool
+	cancel func() // called after the first page when set
+}
+
+func (f *relayFetcher) Fetch(ctx context.Context, url string, filter nostr.Filter) ([]*nostr.Event, error) {
+	if f.fail[url] {
+		return nil, fmt.Errorf("connection refused")
+	}
+	if f.cancel != nil {
+		defer f.cancel()
+	}
+	var page []*nostr.Event
+	for _, event := range f.events[url] {
+		if filter.Until != nil && event.CreatedAt > *filter.Until {
+			continue
+		}
+		if len(page) == filter.Limit {
+			break
+		}
+		page = append(page, event)
+	}
+	return page, nil
+}
+
+type blockingQuality struct {
+	blocked string
+}
+
+func (q *blockingQuality) IsNpubBlocked(npub string) bool    { return npub == q.blocked }
+func (q *blockingQuality) IsEventBanned(eventID string) bool { return false }
+func (q *blockingQuality) Rescore(event *models.Event) error {
+	event.QualityScore = 1
+	return nil
+}
+
+// signedEvents returns n kind 30040 events by sk, one second apart, newest
+// first
+func signedEvents(t *testing.T, sk string, n int) []*nostr.Event {
+	events := make([]*nostr.Event, n)
+	for i := range events {
+		event := &nostr.Event{
+			Kind:      30040,
+			CreatedAt: nostr.Timestamp(1700000000 + n - i),
+			Tags:      nostr.Tags{{"d", fmt.Sprintf("book-%d", i)}},
+			Content:   "index",
+		}
+		helpers.AssertNoError(t, event.Sign(sk))
+		events[i] = event
+	}
+	return events
+}
+
+func TestBackfillRun(t *testing.T) {
+	author, blocked := nostr.GeneratePrivateKey(), nostr.GeneratePrivateKey()
+	authorEvents := signedEvents(t, author, 7)
+	blockedEvents := signedEvents(t, blocked, 1)
+	blockedPubkey, _ := nostr.GetPublicKey(blocked)
+
+	tampered := *authorEvents[6]
+	tampered.Content = "tampered"
+	other := append(append([]*nostr.Event{}, authorEvents[:3]...), blockedEvents[0], &tampered)
+	sort.SliceStable(other, func(i, j int) bool { return other[i].CreatedAt > other[j].CreatedAt })
+
+	fetcher := &relayFetcher{
+		events: map[string][]*nostr.Event{
+			"wss://one.example.com":   authorEvents,
+			"wss://other.example.com": other,
+		},
+		fail: map[string]bool{"wss://down.example.com": true},
+	}
+	eventCache := mocks.NewMockCache()
+	b := NewBackfiller(fetcher, &blockingQuality{blocked: blockedPubkey}, eventCache, nil)
+	pages := 0
+	b.OnProgress(func(Progress) { pages++ })
+
+	progress, err := b.Run(context.Background(), Options{
+		Relays:   []string{"wss://one.example.com", "wss://down.example.com", "wss://other.example.com/"},
+		Filter:   nostr.Filter{Kinds: []int{30040}},
+		PageSize: 3,
+	})
+	helpers.AssertNoError(t, err)
+
+	one, down, second := progress.Relays[0], progress.Relays[1], progress.Relays[2]
+	helpers.AssertInt64Equal(t, 7, one.Imported)
+	helpers.AssertBoolEqual(t, true, one.Done)
+	helpers.AssertBoolEqual(t, false, down.Done)
+	helpers.AssertStringContains(t, down.Error, "connection refused")
+	helpers.AssertInt64Equal(t, 3, second.Duplicates)
+	helpers.AssertInt64Equal(t, 1, second.Rejected)
+	helpers.AssertInt64Equal(t, 1, second.Invalid)
+	helpers.AssertInt64Equal(t, 0, second.Imported)
+	helpers.AssertBoolEqual(t, false, progress.Done)
+	helpers.AssertIntEqual(t, 7, eventCache.GetEventCount())
+	helpers.AssertInt64Equal(t, 7, progress.Totals().Imported)
+	helpers.AssertTrue(t, pages >= 5)
+}
+
+func TestBackfillResume(t *testing.T) {
+	events := signedEvents(t, nostr.GeneratePrivateKey(), 5)
+	checkpoint := filepath.Join(t.TempDir(), "backfill.json")
+	ctx, cancel := context.WithCancel(context.Background())
+	fetcher := &relayFetcher{
+		events: map[string][]*nostr.Event{"wss://one.example.com": events},
+		cancel: cancel,
+	}
+	eventCache := mocks.NewMockCache()
+	b := NewBackfiller(fetcher, nil, eventCache, nil)
+
+	// Interrupted after the first page
+	progress, err := b.Run(ctx, Options{
+		Relays:         []string{"wss://one.example.com"},
+		Filter:         nostr.Filter{Kinds: []int{30040}},
+		PageSize:       2,
+		CheckpointPath: checkpoint,
+	})
+	helpers.AssertError(t, err)
+	helpers.AssertInt64Equal(t, 2, progress.Relays[0].Imported)
+	helpers.AssertInt64Equal(t, int64(events[1].CreatedAt), progress.Relays[0].Until)
+
+	// Resumed from the checkpoint, without relays or filter
+	fetcher.cancel = nil
+	progress, err = b.Run(context.Background(), Options{PageSize: 2, CheckpointPath: checkpoint, Resume: true})
+	helpers.AssertNoError(t, err)
+	helpers.AssertBoolEqual(t, true, progress.Done)
+	helpers.AssertInt64Equal(t, 5, progress.Relays[0].Imported)
+	helpers.AssertInt64Equal(t, 1, progress.Relays[0].Duplicates)
+	helpers.AssertIntEqual(t, 5, eventCache.GetEventCount())
+
+	saved, err := LoadCheckpoint(checkpoint)
+	helpers.AssertNoError(t, err)
+	helpers.AssertBoolEqual(t, true, saved.Done)
+	helpers.AssertStringEqual(t, "[30040]", fmt.Sprint(saved.Filter.Kinds))
+}
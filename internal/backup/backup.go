@@ -0,0 +1,442 @@
+// Package backup snapshots the event store on a schedule. A snapshot is a
+// gzipped tar holding a manifest, every stored event in the dump package's
+// jsonl format and the SSH public keys. Snapshots go to a local directory or
+// an S3-compatible bucket, optionally encrypted to an npub with NIP-44, and
+// only the newest are kept. Restore loads one back through the importer.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/dump"
+	"mercury-relay/internal/storage"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+const (
+	snapshotPrefix  = "mercury-backup-"
+	snapshotSuffix  = ".tar.gz"
+	encryptedSuffix = ".nip44"
+	timeLayout      = "20060102T150405Z"
+
+	manifestFile = "manifest.json"
+	eventsFile   = "events.jsonl"
+	sshKeysDir   = "ssh_keys/"
+)
+
+// Manifest describes a snapshot; it is the first file in the tar
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Events    int64     `json:"events"`
+	SSHKeys   []string  `json:"ssh_keys"`
+}
+
+// RestoreResult is what a restore loaded
+type RestoreResult struct {
+	Snapshot string              `json:"snapshot"`
+	Manifest Manifest            `json:"manifest"`
+	Events   dump.ImportProgress `json:"events"`
+	SSHKeys  int                 `json:"ssh_keys"` // written; existing keys are kept
+}
+
+// Backup takes, rotates and restores snapshots
+type Backup struct {
+	config    config.BackupConfig
+	source    storage.Scanner
+	sshKeys   config.SSHKeyStorage
+	target    Target
+	recipient string // hex pubkey, empty for plain snapshots
+	now       func() time.Time
+}
+
+// New snapshots source and the SSH public keys of sshKeys to the target cfg
+// describes
+func New(cfg config.BackupConfig, source storage.Scanner, sshKeys config.SSHKeyStorage) (*Backup, error) {
+	var target Target
+	var err error
+	if cfg.S3.Enabled {
+		target, err = NewS3Target(cfg.S3)
+	} else {
+		target, err = NewDirTarget(cfg.Path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	b := &Backup{config: cfg, source: source, sshKeys: sshKeys, target: target, now: time.Now}
+	if cfg.Recipient != "" {
+		if b.recipient, err = parsePubkey(cfg.Recipient); err != nil {
+			return nil, err
+		}
+	}
+	return b, nil
+}
+
+// SetTarget replaces where snapshots are kept
+func (b *Backup) SetTarget(target Target) {
+	b.target = target
+}
+
+// Run takes a snapshot whenever the newest one is Interval old, checking
+// now and then every minute, until ctx is done
+func (b *Backup) Run(ctx context.Context) {
+	if !b.config.Enabled {
+		return
+	}
+
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+
+	for {
+		if b.due(ctx) {
+			if name, err := b.Snapshot(ctx); err != nil {
+				log.Printf("Backup to %s failed: %v", b.target.Name(), err)
+			} else {
+				log.Printf("Backup %s written to %s", name, b.target.Name())
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// due reports whether the newest snapshot is at least Interval old
+func (b *Backup) due(ctx context.Context) bool {
+	names, err := b.List(ctx)
+	if err != nil {
+		log.Printf("Failed to list backups in %s: %v", b.target.Name(), err)
+		return false
+	}
+	if len(names) == 0 {
+		return true
+	}
+	taken, ok := snapshotTime(names[len(names)-1])
+	return !ok || b.now().Sub(taken) >= b.config.Interval
+}
+
+// List returns the snapshot names, oldest first
+func (b *Backup) List(ctx context.Context) ([]string, error) {
+	names, err := b.target.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// Snapshot writes a snapshot now, removes those beyond Keep and returns the
+// new snapshot's name
+func (b *Backup) Snapshot(ctx context.Context) (string, error) {
+	name := snapshotPrefix + b.now().UTC().Format(timeLayout) + snapshotSuffix
+	if b.recipient != "" {
+		name += encryptedSuffix
+	}
+
+	tmpDir := b.config.Path
+	if err := os.MkdirAll(tmpDir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	// Events go to their own file first since tar needs the size up front
+	events, err := os.CreateTemp(tmpDir, ".events-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	defer os.Remove(events.Name())
+	defer events.Close()
+	exported, err := dump.Export(ctx, b.source, events, nostr.Filter{}, dump.FormatJSONL, nil)
+	if err != nil {
+		return "", err
+	}
+
+	snapshot, err := os.CreateTemp(tmpDir, ".snapshot-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to create snapshot: %w", err)
+	}
+	defer os.Remove(snapshot.Name())
+	if err := b.writeSnapshot(snapshot, events, exported.Exported); err != nil {
+		snapshot.Close()
+		return "", err
+	}
+	if err := snapshot.Close(); err != nil {
+		return "", fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	if err := b.target.Put(ctx, name, snapshot.Name()); err != nil {
+		return "", err
+	}
+	if err := b.rotate(ctx); err != nil {
+		log.Printf("Failed to remove old backups from %s: %v", b.target.Name(), err)
+	}
+	return name, nil
+}
+
+// writeSnapshot writes the tar of the manifest, events and SSH public keys
+// to w, gzipped and encrypted when a recipient is set
+func (b *Backup) writeSnapshot(w io.Writer, events *os.File, count int64) error {
+	var encrypted *encryptWriter
+	if b.recipient != "" {
+		var err error
+		if encrypted, err = newEncryptWriter(w, b.recipient); err != nil {
+			return err
+		}
+		w = encrypted
+	}
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	keys := b.sshPublicKeys()
+	manifest := Manifest{Version: 1, CreatedAt: b.now().UTC(), Events: count, SSHKeys: []string{}}
+	for _, key := range keys {
+		manifest.SSHKeys = append(manifest.SSHKeys, filepath.Base(key))
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode manifest: %w", err)
+	}
+	if err := writeFile(tw, manifestFile, int64(len(data)), strings.NewReader(string(data))); err != nil {
+		return err
+	}
+
+	info, err := events.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to read exported events: %w", err)
+	}
+	if _, err := events.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read exported events: %w", err)
+	}
+	if err := writeFile(tw, eventsFile, info.Size(), events); err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		data, err := os.ReadFile(key)
+		if err != nil {
+			return fmt.Errorf("failed to read ssh key: %w", err)
+		}
+		if err := writeFile(tw, sshKeysDir+filepath.Base(key), int64(len(data)), strings.NewReader(string(data))); err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	if encrypted != nil {
+		return encrypted.Close()
+	}
+	return nil
+}
+
+func writeFile(tw *tar.Writer, name string, size int64, r io.Reader) error {
+	header := &tar.Header{Name: name, Mode: 0600, Size: size, ModTime: time.Now()}
+	if err := tw.WriteHeader(header); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	if _, err := io.Copy(tw, r); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	return nil
+}
+
+// sshPublicKeys returns the paths of the SSH public keys; private keys are
+// never backed up
+func (b *Backup) sshPublicKeys() []string {
+	if b.sshKeys.KeyDir == "" || b.sshKeys.PublicKeyExt == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(b.sshKeys.KeyDir)
+	if err != nil {
+		return nil
+	}
+	var keys []string
+	for _, entry := range entries {
+		if !entry.IsDir() && filepath.Ext(entry.Name()) == b.sshKeys.PublicKeyExt {
+			keys = append(keys, filepath.Join(b.sshKeys.KeyDir, entry.Name()))
+		}
+	}
+	return keys
+}
+
+// rotate deletes the oldest snapshots beyond Keep
+func (b *Backup) rotate(ctx context.Context) error {
+	if b.config.Keep < 0 {
+		return nil
+	}
+	names, err := b.List(ctx)
+	if err != nil {
+		return err
+	}
+	for len(names) > max(b.config.Keep, 1) {
+		if err := b.target.Delete(ctx, names[0]); err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// Restore loads the snapshot name, or the newest when name is empty,
+// importing its events through importer and writing SSH public keys missing
+// from the key directory. Encrypted snapshots need the recipient's secret
+// key, an nsec or hex.
+func (b *Backup) Restore(ctx context.Context, name, secretKey string, importer *dump.Importer) (*RestoreResult, error) {
+	if name == "" {
+		names, err := b.List(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if len(names) == 0 {
+			return nil, fmt.Errorf("no backups in %s", b.target.Name())
+		}
+		name = names[len(names)-1]
+	}
+
+	download, err := os.CreateTemp("", ".restore-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to download backup: %w", err)
+	}
+	defer os.Remove(download.Name())
+	defer download.Close()
+	if err := b.target.Get(ctx, name, download); err != nil {
+		return nil, err
+	}
+	if _, err := download.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	var r io.Reader = download
+	if strings.HasSuffix(name, encryptedSuffix) {
+		if secretKey == "" {
+			return nil, fmt.Errorf("%s is encrypted; the recipient's secret key is needed", name)
+		}
+		sk, err := parseSecretKey(secretKey)
+		if err != nil {
+			return nil, err
+		}
+		if r, err = newDecryptReader(download, sk); err != nil {
+			return nil, err
+		}
+	}
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backup: %w", err)
+	}
+	defer gz.Close()
+
+	result := &RestoreResult{Snapshot: name}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return result, nil
+		}
+		if err != nil {
+			return result, fmt.Errorf("failed to read backup: %w", err)
+		}
+
+		switch {
+		case header.Name == manifestFile:
+			if err := json.NewDecoder(tr).Decode(&result.Manifest); err != nil {
+				return result, fmt.Errorf("failed to parse manifest: %w", err)
+			}
+		case header.Name == eventsFile:
+			if result.Events, err = importer.Import(ctx, tr); err != nil {
+				return result, err
+			}
+		case strings.HasPrefix(header.Name, sshKeysDir):
+			written, err := b.restoreSSHKey(path.Base(header.Name), tr)
+			if err != nil {
+				return result, err
+			}
+			if written {
+				result.SSHKeys++
+			}
+		}
+	}
+}
+
+// restoreSSHKey writes a public key unless one of that name exists
+func (b *Backup) restoreSSHKey(name string, r io.Reader) (bool, error) {
+	if b.sshKeys.KeyDir == "" {
+		return false, nil
+	}
+	if err := os.MkdirAll(b.sshKeys.KeyDir, 0700); err != nil {
+		return false, fmt.Errorf("failed to create key directory: %w", err)
+	}
+	file, err := os.OpenFile(filepath.Join(b.sshKeys.KeyDir, name), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if os.IsExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to restore ssh key %s: %w", name, err)
+	}
+	defer file.Close()
+	if _, err := io.Copy(file, r); err != nil {
+		return false, fmt.Errorf("failed to restore ssh key %s: %w", name, err)
+	}
+	return true, nil
+}
+
+// isSnapshot reports whether name is a snapshot file
+func isSnapshot(name string) bool {
+	return strings.HasPrefix(name, snapshotPrefix) &&
+		(strings.HasSuffix(name, snapshotSuffix) || strings.HasSuffix(name, snapshotSuffix+encryptedSuffix))
+}
+
+// snapshotTime returns when the snapshot name was taken
+func snapshotTime(name string) (time.Time, bool) {
+	stamp := strings.TrimPrefix(name, snapshotPrefix)
+	stamp, _, _ = strings.Cut(stamp, ".")
+	t, err := time.Parse(timeLayout, stamp)
+	return t, err == nil
+}
+
+// parsePubkey accepts an npub or a hex pubkey
+func parsePubkey(key string) (string, error) {
+	if nostr.IsValidPublicKey(key) {
+		return key, nil
+	}
+	prefix, data, err := nip19.Decode(key)
+	if err != nil || prefix != "npub" {
+		return "", fmt.Errorf("invalid backup recipient %q: expected an npub or hex pubkey", key)
+	}
+	return data.(string), nil
+}
+
+// parseSecretKey accepts an nsec or a hex secret key
+func parseSecretKey(key string) (string, error) {
+	if strings.HasPrefix(key, "nsec1") {
+		prefix, data, err := nip19.Decode(key)
+		if err != nil || prefix != "nsec" {
+			return "", fmt.Errorf("invalid secret key: expected an nsec or hex key")
+		}
+		return data.(string), nil
+	}
+	if _, err := nostr.GetPublicKey(key); err != nil {
+		return "", fmt.Errorf("invalid secret key: expected an nsec or hex key")
+	}
+	return key, nil
+}
@@ -0,0 +1,230 @@
+package backup
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/dump"
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+	"mercury-relay/test/mocks"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+func signedEvents(t *testing.T, n int) []*models.Event {
+	sk := nostr.GeneratePrivateKey()
+	events := make([]*models.Event, n)
+	for i := range events {
+		ne := &nostr.Event{Kind: 1, CreatedAt: nostr.Timestamp(1700000000 + i), Tags: nostr.Tags{}, Content: fmt.Sprintf("note %d", i)}
+		helpers.AssertNoError(t, ne.Sign(sk))
+		events[i] = models.FromNostrEvent(ne)
+	}
+	return events
+}
+
+func TestEncryption(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	pubkey, _ := nostr.GetPublicKey(sk)
+	data := bytes.Repeat([]byte("0123456789abcdef"), chunkSize/8) // two full chunks
+
+	var encrypted bytes.Buffer
+	w, err := newEncryptWriter(&encrypted, pubkey)
+	helpers.AssertNoError(t, err)
+	_, err = w.Write(data)
+	helpers.AssertNoError(t, err)
+	helpers.AssertNoError(t, w.Close())
+	helpers.AssertTrue(t, !bytes.Contains(encrypted.Bytes(), []byte("0123456789")))
+
+	r, err := newDecryptReader(bytes.NewReader(encrypted.Bytes()), sk)
+	helpers.AssertNoError(t, err)
+	decrypted, err := io.ReadAll(r)
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, bytes.Equal(data, decrypted))
+
+	t.Run("wrong key", func(t *testing.T) {
+		r, err := newDecryptReader(bytes.NewReader(encrypted.Bytes()), nostr.GeneratePrivateKey())
+		helpers.AssertNoError(t, err)
+		_, err = io.ReadAll(r)
+		helpers.AssertErrorContains(t, err, "wrong key")
+	})
+
+	t.Run("truncated", func(t *testing.T) {
+		lines := strings.SplitAfter(encrypted.String(), "\n")
+		r, err := newDecryptReader(strings.NewReader(strings.Join(lines[:3], "")), sk)
+		helpers.AssertNoError(t, err)
+		_, err = io.ReadAll(r)
+		helpers.AssertErrorContains(t, err, "truncated")
+	})
+
+	t.Run("reordered", func(t *testing.T) {
+		lines := strings.SplitAfter(encrypted.String(), "\n")
+		lines[1], lines[2] = lines[2], lines[1]
+		r, err := newDecryptReader(strings.NewReader(strings.Join(lines, "")), sk)
+		helpers.AssertNoError(t, err)
+		_, err = io.ReadAll(r)
+		helpers.AssertErrorContains(t, err, "out of order")
+	})
+}
+
+func TestSnapshotAndRestore(t *testing.T) {
+	dir := t.TempDir()
+	keyDir := filepath.Join(dir, "keys")
+	helpers.AssertNoError(t, os.Mkdir(keyDir, 0700))
+	helpers.AssertNoError(t, os.WriteFile(filepath.Join(keyDir, "deploy.pub"), []byte("ssh-rsa AAAA deploy\n"), 0644))
+	helpers.AssertNoError(t, os.WriteFile(filepath.Join(keyDir, "deploy.pem"), []byte("PRIVATE"), 0600))
+	sshKeys := config.SSHKeyStorage{KeyDir: keyDir, PrivateKeyExt: ".pem", PublicKeyExt: ".pub"}
+
+	sk := nostr.GeneratePrivateKey()
+	pubkey, _ := nostr.GetPublicKey(sk)
+	npub, _ := nip19.EncodePublicKey(pubkey)
+	nsec, _ := nip19.EncodePrivateKey(sk)
+
+	events := signedEvents(t, 3)
+	cfg := config.BackupConfig{Enabled: true, Interval: time.Hour, Path: filepath.Join(dir, "backups"), Keep: 2, Recipient: npub}
+	b, err := New(cfg, mocks.NewMockScanner(events), sshKeys)
+	helpers.AssertNoError(t, err)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	helpers.AssertBoolEqual(t, true, b.due(context.Background()))
+	for i := 0; i < 3; i++ {
+		name, err := b.Snapshot(context.Background())
+		helpers.AssertNoError(t, err)
+		helpers.AssertTrue(t, strings.HasSuffix(name, ".tar.gz.nip44"))
+		helpers.AssertBoolEqual(t, false, b.due(context.Background()))
+		now = now.Add(time.Hour)
+	}
+	helpers.AssertBoolEqual(t, true, b.due(context.Background()))
+
+	names, err := b.List(context.Background())
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, "[mercury-backup-20260101T010000Z.tar.gz.nip44 mercury-backup-20260101T020000Z.tar.gz.nip44]", fmt.Sprint(names))
+	leftovers, _ := filepath.Glob(filepath.Join(cfg.Path, ".*"))
+	helpers.AssertIntEqual(t, 0, len(leftovers))
+
+	// Restored into an empty relay: the public key comes back, the private
+	// key was never backed up
+	helpers.AssertNoError(t, os.RemoveAll(keyDir))
+	eventCache := mocks.NewMockCache()
+	_, err = b.Restore(context.Background(), "", "", dump.NewImporter(nil, eventCache, nil))
+	helpers.AssertErrorContains(t, err, "secret key is needed")
+
+	result, err := b.Restore(context.Background(), "", nsec, dump.NewImporter(nil, eventCache, nil))
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, names[1], result.Snapshot)
+	helpers.AssertInt64Equal(t, 3, result.Manifest.Events)
+	helpers.AssertInt64Equal(t, 3, result.Events.Imported)
+	helpers.AssertIntEqual(t, 1, result.SSHKeys)
+	helpers.AssertIntEqual(t, 3, eventCache.GetEventCount())
+	restored, err := os.ReadFile(filepath.Join(keyDir, "deploy.pub"))
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, "ssh-rsa AAAA deploy\n", string(restored))
+	_, err = os.Stat(filepath.Join(keyDir, "deploy.pem"))
+	helpers.AssertTrue(t, os.IsNotExist(err))
+
+	// Restoring again skips what is already there
+	result, err = b.Restore(context.Background(), names[0], sk, dump.NewImporter(nil, eventCache, nil))
+	helpers.AssertNoError(t, err)
+	helpers.AssertInt64Equal(t, 3, result.Events.Duplicates)
+	helpers.AssertIntEqual(t, 0, result.SSHKeys)
+}
+
+func TestPlainSnapshot(t *testing.T) {
+	cfg := config.BackupConfig{Path: t.TempDir(), Keep: -1}
+	b, err := New(cfg, mocks.NewMockScanner(signedEvents(t, 2)), config.SSHKeyStorage{})
+	helpers.AssertNoError(t, err)
+
+	name, err := b.Snapshot(context.Background())
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, strings.HasSuffix(name, ".tar.gz"))
+
+	result, err := b.Restore(context.Background(), name, "", dump.NewImporter(nil, mocks.NewMockCache(), nil))
+	helpers.AssertNoError(t, err)
+	helpers.AssertInt64Equal(t, 2, result.Events.Imported)
+
+	_, err = New(config.BackupConfig{Path: cfg.Path, Recipient: "alice"}, nil, config.SSHKeyStorage{})
+	helpers.AssertErrorContains(t, err, "invalid backup recipient")
+}
+
+// bucket is an S3-compatible server keeping objects in memory
+func bucket(t *testing.T) (map[string][]byte, *httptest.Server) {
+	var mu sync.Mutex
+	objects := make(map[string][]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !strings.HasPrefix(req.Header.Get("Authorization"), "AWS4-HMAC-SHA256 ") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		key := strings.TrimPrefix(req.URL.Path, "/backups/")
+		switch req.Method {
+		case http.MethodPut:
+			objects[key], _ = io.ReadAll(req.Body)
+		case http.MethodDelete:
+			delete(objects, key)
+		case http.MethodGet:
+			if key != "" {
+				data, ok := objects[key]
+				if !ok {
+					w.WriteHeader(http.StatusNotFound)
+					return
+				}
+				w.Write(data)
+				return
+			}
+			fmt.Fprint(w, "<ListBucketResult>")
+			for key := range objects {
+				if strings.HasPrefix(key, req.URL.Query().Get("prefix")) {
+					fmt.Fprintf(w, "<Contents><Key>%s</Key></Contents>", key)
+				}
+			}
+			fmt.Fprint(w, "<IsTruncated>false</IsTruncated></ListBucketResult>")
+		}
+	}))
+	t.Cleanup(server.Close)
+	return objects, server
+}
+
+func TestS3Target(t *testing.T) {
+	objects, server := bucket(t)
+	cfg := config.BackupConfig{
+		Path: t.TempDir(),
+		Keep: 1,
+		S3:   config.S3ArchiveConfig{Enabled: true, Endpoint: server.URL, Bucket: "backups", Prefix: "relay1", AccessKey: "key", SecretKey: "secret"},
+	}
+	b, err := New(cfg, mocks.NewMockScanner(signedEvents(t, 2)), config.SSHKeyStorage{})
+	helpers.AssertNoError(t, err)
+
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	b.now = func() time.Time { return now }
+	_, err = b.Snapshot(context.Background())
+	helpers.AssertNoError(t, err)
+	now = now.Add(time.Hour)
+	name, err := b.Snapshot(context.Background())
+	helpers.AssertNoError(t, err)
+
+	helpers.AssertIntEqual(t, 1, len(objects))
+	_, ok := objects["relay1/"+name]
+	helpers.AssertBoolEqual(t, true, ok)
+	leftovers, _ := os.ReadDir(cfg.Path)
+	helpers.AssertIntEqual(t, 0, len(leftovers))
+
+	result, err := b.Restore(context.Background(), "", "", dump.NewImporter(nil, mocks.NewMockCache(), nil))
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, name, result.Snapshot)
+	helpers.AssertInt64Equal(t, 2, result.Events.Imported)
+}
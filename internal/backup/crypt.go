@@ -0,0 +1,156 @@
+package backup
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip44"
+)
+
+// encryptedHeader starts the first line of an encrypted snapshot, followed
+// by the ephemeral pubkey the conversation key was derived with
+const encryptedHeader = "mercury-backup nip44 v1 "
+
+// chunkSize is the snapshot data carried per NIP-44 payload, below its
+// 64KiB plaintext limit
+const chunkSize = 32 * 1024
+
+// chunk flags
+const (
+	chunkMore = 0
+	chunkLast = 1
+)
+
+// encryptWriter encrypts what is written to it for the holder of one key.
+// The snapshot is split into chunks, each a NIP-44 payload on its own line
+// with its index and whether it is the last, so reordered or truncated
+// snapshots are detected.
+type encryptWriter struct {
+	w     io.Writer
+	key   [32]byte
+	buf   []byte
+	index uint32
+}
+
+// newEncryptWriter encrypts to recipient, a hex pubkey, with a fresh
+// ephemeral key whose pubkey is written first
+func newEncryptWriter(w io.Writer, recipient string) (*encryptWriter, error) {
+	ephemeral := nostr.GeneratePrivateKey()
+	key, err := nip44.GenerateConversationKey(recipient, ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive backup key: %w", err)
+	}
+	pubkey, err := nostr.GetPublicKey(ephemeral)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive backup key: %w", err)
+	}
+	if _, err := io.WriteString(w, encryptedHeader+pubkey+"\n"); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, key: key, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+func (e *encryptWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), chunkSize-len(e.buf))
+		e.buf = append(e.buf, p[:n]...)
+		p = p[n:]
+		written += n
+		if len(e.buf) == chunkSize {
+			if err := e.flush(chunkMore); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close writes the last chunk; it doesn't close the underlying writer
+func (e *encryptWriter) Close() error {
+	return e.flush(chunkLast)
+}
+
+func (e *encryptWriter) flush(flag byte) error {
+	plain := make([]byte, 5, 5+len(e.buf))
+	plain[0] = flag
+	binary.BigEndian.PutUint32(plain[1:], e.index)
+	plain = append(plain, e.buf...)
+
+	payload, err := nip44.Encrypt(string(plain), e.key)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt backup: %w", err)
+	}
+	if _, err := io.WriteString(e.w, payload+"\n"); err != nil {
+		return err
+	}
+	e.index++
+	e.buf = e.buf[:0]
+	return nil
+}
+
+// decryptReader reads a snapshot written by encryptWriter
+type decryptReader struct {
+	lines *bufio.Scanner
+	key   [32]byte
+	buf   []byte
+	index uint32
+	done  bool
+}
+
+// newDecryptReader decrypts r with sk, the recipient's hex secret key
+func newDecryptReader(r io.Reader, sk string) (*decryptReader, error) {
+	lines := bufio.NewScanner(r)
+	lines.Buffer(make([]byte, 0, 64*1024), 128*1024)
+	if !lines.Scan() {
+		return nil, fmt.Errorf("backup is empty")
+	}
+	pubkey, ok := strings.CutPrefix(lines.Text(), encryptedHeader)
+	if !ok {
+		return nil, fmt.Errorf("backup is not encrypted")
+	}
+	key, err := nip44.GenerateConversationKey(pubkey, sk)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive backup key: %w", err)
+	}
+	return &decryptReader{lines: lines, key: key}, nil
+}
+
+func (d *decryptReader) Read(p []byte) (int, error) {
+	for len(d.buf) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.next(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.buf)
+	d.buf = d.buf[n:]
+	return n, nil
+}
+
+// next decrypts the next chunk into buf
+func (d *decryptReader) next() error {
+	if !d.lines.Scan() {
+		if err := d.lines.Err(); err != nil {
+			return fmt.Errorf("failed to read backup: %w", err)
+		}
+		return fmt.Errorf("backup is truncated after chunk %d", d.index)
+	}
+	plain, err := nip44.Decrypt(d.lines.Text(), d.key)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt backup chunk %d (wrong key?): %w", d.index, err)
+	}
+	if len(plain) < 5 || binary.BigEndian.Uint32([]byte(plain[1:5])) != d.index {
+		return fmt.Errorf("backup chunk %d is out of order", d.index)
+	}
+	d.index++
+	d.done = plain[0] == chunkLast
+	d.buf = []byte(plain[5:])
+	return nil
+}
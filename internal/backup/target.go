@@ -0,0 +1,252 @@
+package backup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"mercury-relay/internal/archive"
+	"mercury-relay/internal/config"
+)
+
+// Target is where snapshots are kept
+type Target interface {
+	Name() string
+	// Put stores the snapshot file at path under name
+	Put(ctx context.Context, name, path string) error
+	// List returns the names of the stored snapshots
+	List(ctx context.Context) ([]string, error)
+	// Get writes the snapshot name to w
+	Get(ctx context.Context, name string, w io.Writer) error
+	Delete(ctx context.Context, name string) error
+}
+
+// dirTarget keeps snapshots in a local directory
+type dirTarget struct {
+	dir string
+}
+
+// NewDirTarget keeps snapshots in dir, creating it when needed
+func NewDirTarget(dir string) (Target, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	return &dirTarget{dir: dir}, nil
+}
+
+func (t *dirTarget) Name() string {
+	return t.dir
+}
+
+func (t *dirTarget) Put(ctx context.Context, name, path string) error {
+	if err := os.Rename(path, filepath.Join(t.dir, name)); err != nil {
+		return fmt.Errorf("failed to move snapshot into place: %w", err)
+	}
+	return nil
+}
+
+func (t *dirTarget) List(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(t.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && isSnapshot(entry.Name()) {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+func (t *dirTarget) Get(ctx context.Context, name string, w io.Writer) error {
+	file, err := os.Open(filepath.Join(t.dir, filepath.Base(name)))
+	if err != nil {
+		return fmt.Errorf("failed to open backup: %w", err)
+	}
+	defer file.Close()
+	if _, err := io.Copy(w, file); err != nil {
+		return fmt.Errorf("failed to read backup: %w", err)
+	}
+	return nil
+}
+
+func (t *dirTarget) Delete(ctx context.Context, name string) error {
+	if err := os.Remove(filepath.Join(t.dir, filepath.Base(name))); err != nil {
+		return fmt.Errorf("failed to delete backup: %w", err)
+	}
+	return nil
+}
+
+// requestTimeout bounds a single request to the bucket
+const requestTimeout = 30 * time.Minute
+
+// s3Target keeps snapshots in an S3-compatible bucket under the prefix
+type s3Target struct {
+	config   config.S3ArchiveConfig
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3Target keeps snapshots in the bucket of cfg. Requests are signed with
+// AWS Signature Version 4 and use path-style URLs unless VirtualHost is set.
+func NewS3Target(cfg config.S3ArchiveConfig) (Target, error) {
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3.amazonaws.com"
+	}
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Bucket == "" || cfg.AccessKey == "" || cfg.SecretKey == "" {
+		return nil, fmt.Errorf("s3 backups need a bucket, access key and secret key")
+	}
+	endpoint, err := url.Parse(cfg.Endpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid s3 backup endpoint %q", cfg.Endpoint)
+	}
+	return &s3Target{config: cfg, endpoint: endpoint, client: &http.Client{Timeout: requestTimeout}}, nil
+}
+
+func (t *s3Target) Name() string {
+	return "s3://" + t.config.Bucket + "/" + t.prefix()
+}
+
+func (t *s3Target) prefix() string {
+	prefix := strings.Trim(t.config.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return prefix
+}
+
+// bucketURL addresses the bucket, or an object in it when key is set
+func (t *s3Target) bucketURL(key string) *url.URL {
+	u := *t.endpoint
+	if t.config.VirtualHost {
+		u.Host = t.config.Bucket + "." + u.Host
+		u.Path = "/" + key
+	} else {
+		u.Path = "/" + t.config.Bucket + "/" + key
+	}
+	return &u
+}
+
+func (t *s3Target) Put(ctx context.Context, name, path string) error {
+	defer os.Remove(path)
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open snapshot: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read snapshot: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, t.bucketURL(t.prefix()+name).String(), file)
+	if err != nil {
+		return fmt.Errorf("failed to create upload request: %w", err)
+	}
+	req.ContentLength = size
+	req.Header.Set("Content-Type", "application/octet-stream")
+	return t.do(req, hex.EncodeToString(hash.Sum(nil)), nil)
+}
+
+func (t *s3Target) List(ctx context.Context) ([]string, error) {
+	var names []string
+	token := ""
+	for {
+		u := t.bucketURL("")
+		query := url.Values{"list-type": {"2"}, "prefix": {t.prefix()}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u.RawQuery = query.Encode()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create list request: %w", err)
+		}
+
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = t.do(req, emptyPayloadHash, func(body io.Reader) error {
+			return xml.NewDecoder(body).Decode(&result)
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range result.Contents {
+			name := strings.TrimPrefix(object.Key, t.prefix())
+			if isSnapshot(name) {
+				names = append(names, name)
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			sort.Strings(names)
+			return names, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (t *s3Target) Get(ctx context.Context, name string, w io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.bucketURL(t.prefix()+name).String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create download request: %w", err)
+	}
+	return t.do(req, emptyPayloadHash, func(body io.Reader) error {
+		_, err := io.Copy(w, body)
+		return err
+	})
+}
+
+func (t *s3Target) Delete(ctx context.Context, name string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.bucketURL(t.prefix()+name).String(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create delete request: %w", err)
+	}
+	return t.do(req, emptyPayloadHash, nil)
+}
+
+// emptyPayloadHash is the SHA-256 of an empty request body
+const emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// do signs and sends req, passing a successful response body to read
+func (t *s3Target) do(req *http.Request, payloadHash string, read func(io.Reader) error) error {
+	archive.SignV4(req, payloadHash, t.config.AccessKey, t.config.SecretKey, t.config.Region, time.Now())
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("s3 %s failed: %w", strings.ToLower(req.Method), err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("s3 %s failed: %s: %s", strings.ToLower(req.Method), resp.Status, strings.TrimSpace(string(body)))
+	}
+	if read != nil {
+		if err := read(resp.Body); err != nil {
+			return fmt.Errorf("failed to read s3 response: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package bench
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/config"
+	"mercury-relay/test/helpers"
+)
+
+func newMemoryTarget(t testing.TB) *MemoryTarget {
+	t.Helper()
+	c := cache.NewMemory(config.CacheConfig{MaxEvents: 1000000})
+	t.Cleanup(func() { c.Close() })
+	return NewMemoryTarget(c)
+}
+
+func TestNewPlan(t *testing.T) {
+	scenario := Scenario{Name: "small", Preload: 5, Events: 10, Queries: 6, Authors: 3}
+	base := time.Unix(1700000000, 0)
+
+	a, err := NewPlan(scenario, 42, base)
+	helpers.AssertNoError(t, err)
+	b, err := NewPlan(scenario, 42, base)
+	helpers.AssertNoError(t, err)
+	c, err := NewPlan(scenario, 43, base)
+	helpers.AssertNoError(t, err)
+
+	helpers.AssertIntEqual(t, 5, len(a.Preload))
+	helpers.AssertIntEqual(t, 10, len(a.Events))
+	helpers.AssertIntEqual(t, 6, len(a.Queries))
+
+	authors := make(map[string]bool)
+	for i, event := range a.Events {
+		helpers.AssertStringEqual(t, event.ID, b.Events[i].ID)
+		helpers.AssertTrue(t, event.ID != c.Events[i].ID)
+		ok, err := event.CheckSignature()
+		helpers.AssertNoError(t, err)
+		helpers.AssertTrue(t, ok)
+		authors[event.PubKey] = true
+	}
+	helpers.AssertTrue(t, len(authors) <= 3)
+}
+
+func TestRun(t *testing.T) {
+	scenario := Scenario{Name: "small", Preload: 20, Events: 30, Publishers: 3, Subscribers: 4, Queries: 9, Queriers: 2, Authors: 5}
+	plan, err := NewPlan(scenario, 1, time.Now())
+	helpers.AssertNoError(t, err)
+
+	report, err := Run(context.Background(), newMemoryTarget(t), plan, Options{Label: "test"})
+	helpers.AssertNoError(t, err)
+
+	helpers.AssertStringEqual(t, "memory", report.Target)
+	helpers.AssertStringEqual(t, "test", report.Label)
+	helpers.AssertIntEqual(t, 30, report.Publish.Count)
+	helpers.AssertIntEqual(t, 0, report.Publish.Errors)
+	helpers.AssertIntEqual(t, 9, report.Query.Count)
+	// Every subscriber sees every event published during the run, and none
+	// of the preloaded ones
+	helpers.AssertIntEqual(t, 120, report.Delivery.Count)
+	helpers.AssertIntEqual(t, 0, report.Delivery.Errors)
+	helpers.AssertTrue(t, report.Delivery.P50Ms <= report.Delivery.P95Ms)
+	helpers.AssertTrue(t, report.Publish.PerSecond > 0)
+}
+
+func TestCompare(t *testing.T) {
+	baseline := &Report{
+		Scenario: Scenario{Name: ScenarioIngest},
+		Publish:  OpStats{PerSecond: 1000, P95Ms: 10},
+	}
+	current := &Report{
+		Scenario: Scenario{Name: ScenarioIngest},
+		Publish:  OpStats{PerSecond: 950, P95Ms: 15},
+	}
+
+	regressions, err := Compare(baseline, current, 0.1)
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 1, len(regressions))
+	helpers.AssertStringEqual(t, "publish.p95_ms", regressions[0].Metric)
+
+	_, err = Compare(baseline, &Report{Scenario: Scenario{Name: ScenarioQuery}}, 0.1)
+	helpers.AssertError(t, err)
+}
+
+func TestLookup(t *testing.T) {
+	for _, s := range Scenarios() {
+		found, err := Lookup(s.Name)
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, s.Name, found.Name)
+	}
+	_, err := Lookup("nope")
+	helpers.AssertTrue(t, errors.Is(err, ErrUnknownScenario))
+}
+
+// BenchmarkScenarios runs every built-in scenario against the in-process
+// target, e.g. go test -bench . ./internal/bench
+func BenchmarkScenarios(b *testing.B) {
+	for _, scenario := range Scenarios() {
+		b.Run(scenario.Name, func(b *testing.B) {
+			plan, err := NewPlan(scenario, 1, time.Now())
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			var report *Report
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				target := newMemoryTarget(b)
+				b.StartTimer()
+
+				report, err = Run(context.Background(), target, plan, Options{})
+				if err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(report.Publish.PerSecond, "publish/s")
+			b.ReportMetric(report.Query.PerSecond, "query/s")
+			b.ReportMetric(report.Delivery.P95Ms, "delivery-p95-ms")
+		})
+	}
+}
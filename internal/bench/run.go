@@ -0,0 +1,289 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Options tunes how a plan is run
+type Options struct {
+	// QueryTimeout bounds each query; queries that don't finish count as errors
+	QueryTimeout time.Duration
+	// DeliveryTimeout is how long to wait for subscribers to receive every
+	// event after the last publish
+	DeliveryTimeout time.Duration
+	// Label identifies the build under test in the report, e.g. "v1.2.0"
+	Label string
+}
+
+// OpStats summarises one kind of operation
+type OpStats struct {
+	Count     int     `json:"count"`
+	Errors    int     `json:"errors"`
+	PerSecond float64 `json:"per_second"`
+	P50Ms     float64 `json:"p50_ms"`
+	P95Ms     float64 `json:"p95_ms"`
+	P99Ms     float64 `json:"p99_ms"`
+	MaxMs     float64 `json:"max_ms"`
+}
+
+// Report is the result of one run
+type Report struct {
+	Scenario   Scenario  `json:"scenario"`
+	Seed       int64     `json:"seed"`
+	Target     string    `json:"target"`
+	Label      string    `json:"label,omitempty"`
+	StartedAt  time.Time `json:"started_at"`
+	DurationMs float64   `json:"duration_ms"`
+	Publish    OpStats   `json:"publish"`
+	Query      OpStats   `json:"query"`
+	// Delivery latency runs from the start of a publish to a subscriber
+	// receiving the event; missed deliveries count as errors
+	Delivery OpStats `json:"delivery"`
+}
+
+// Run executes plan against target. Preloaded events are published before
+// the clock starts; everything else runs concurrently.
+func Run(ctx context.Context, target Target, plan *Plan, opts Options) (*Report, error) {
+	if opts.QueryTimeout <= 0 {
+		opts.QueryTimeout = 10 * time.Second
+	}
+	if opts.DeliveryTimeout <= 0 {
+		opts.DeliveryTimeout = 10 * time.Second
+	}
+	s := plan.Scenario
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	connect := func(n int) ([]Client, error) {
+		clients := make([]Client, 0, n)
+		for i := 0; i < n; i++ {
+			client, err := target.Connect(ctx)
+			if err != nil {
+				closeAll(clients)
+				return nil, err
+			}
+			clients = append(clients, client)
+		}
+		return clients, nil
+	}
+
+	publishers, err := connect(max(s.Publishers, 1))
+	if err != nil {
+		return nil, err
+	}
+	defer closeAll(publishers)
+	queriers, err := connect(s.Queriers)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAll(queriers)
+	subscribers, err := connect(s.Subscribers)
+	if err != nil {
+		return nil, err
+	}
+	defer closeAll(subscribers)
+
+	for _, event := range plan.Preload {
+		if err := publishers[0].Publish(ctx, event); err != nil {
+			return nil, fmt.Errorf("failed to preload event: %w", err)
+		}
+	}
+
+	var (
+		mu         sync.Mutex
+		sentAt     = make(map[string]time.Time, len(plan.Events))
+		deliveries []time.Duration
+		expected   = len(plan.Events) * s.Subscribers
+		allHere    = make(chan struct{})
+	)
+	if expected == 0 {
+		close(allHere)
+	}
+
+	for _, sub := range subscribers {
+		seen := make(map[string]bool)
+		deliver := func(event *nostr.Event) {
+			received := time.Now()
+			mu.Lock()
+			defer mu.Unlock()
+			sent, ok := sentAt[event.ID]
+			if !ok || seen[event.ID] {
+				return
+			}
+			seen[event.ID] = true
+			deliveries = append(deliveries, received.Sub(sent))
+			if len(deliveries) == expected {
+				close(allHere)
+			}
+		}
+		// Limit keeps the stored replay short; only events sent during the
+		// run are counted
+		filter := nostr.Filter{Kinds: []int{1}, Limit: 1}
+		if err := sub.Subscribe(ctx, filter, deliver); err != nil {
+			return nil, fmt.Errorf("failed to subscribe: %w", err)
+		}
+	}
+
+	report := &Report{
+		Scenario:  s,
+		Seed:      plan.Seed,
+		Target:    target.Name(),
+		Label:     opts.Label,
+		StartedAt: time.Now(),
+	}
+	var (
+		wg             sync.WaitGroup
+		publishTimes   []time.Duration
+		queryTimes     []time.Duration
+		publishErrors  int
+		queryErrors    int
+		publishedCount int
+	)
+
+	for p, client := range publishers {
+		wg.Add(1)
+		go func(p int, client Client) {
+			defer wg.Done()
+			for i := p; i < len(plan.Events); i += len(publishers) {
+				event := plan.Events[i]
+				start := time.Now()
+				mu.Lock()
+				sentAt[event.ID] = start
+				mu.Unlock()
+
+				err := client.Publish(ctx, event)
+				elapsed := time.Since(start)
+
+				mu.Lock()
+				if err != nil {
+					publishErrors++
+				} else {
+					publishedCount++
+					publishTimes = append(publishTimes, elapsed)
+				}
+				mu.Unlock()
+			}
+		}(p, client)
+	}
+
+	for q, client := range queriers {
+		wg.Add(1)
+		go func(q int, client Client) {
+			defer wg.Done()
+			for i := q; i < len(plan.Queries); i += len(queriers) {
+				start := time.Now()
+				queryCtx, cancel := context.WithTimeout(ctx, opts.QueryTimeout)
+				_, err := client.Query(queryCtx, plan.Queries[i])
+				cancel()
+				elapsed := time.Since(start)
+
+				mu.Lock()
+				if err != nil {
+					queryErrors++
+				} else {
+					queryTimes = append(queryTimes, elapsed)
+				}
+				mu.Unlock()
+			}
+		}(q, client)
+	}
+
+	wg.Wait()
+	publishDone := time.Since(report.StartedAt)
+
+	if s.Subscribers > 0 {
+		select {
+		case <-allHere:
+		case <-time.After(opts.DeliveryTimeout):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	elapsed := time.Since(report.StartedAt)
+
+	mu.Lock()
+	defer mu.Unlock()
+	report.DurationMs = ms(elapsed)
+	report.Publish = summarise(publishTimes, publishErrors, publishDone)
+	report.Query = summarise(queryTimes, queryErrors, publishDone)
+	report.Delivery = summarise(deliveries, publishedCount*s.Subscribers-len(deliveries), elapsed)
+	return report, nil
+}
+
+func closeAll(clients []Client) {
+	for _, client := range clients {
+		client.Close()
+	}
+}
+
+func summarise(times []time.Duration, errors int, elapsed time.Duration) OpStats {
+	stats := OpStats{Count: len(times), Errors: max(errors, 0)}
+	if len(times) == 0 {
+		return stats
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+	percentile := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(times)))) - 1
+		return ms(times[max(i, 0)])
+	}
+	if elapsed > 0 {
+		stats.PerSecond = float64(len(times)) / elapsed.Seconds()
+	}
+	stats.P50Ms = percentile(0.50)
+	stats.P95Ms = percentile(0.95)
+	stats.P99Ms = percentile(0.99)
+	stats.MaxMs = ms(times[len(times)-1])
+	return stats
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// Regression is a metric that got worse than the baseline allows
+type Regression struct {
+	Metric   string  `json:"metric"`
+	Baseline float64 `json:"baseline"`
+	Current  float64 `json:"current"`
+	// Change is relative, e.g. -0.25 for a quarter less throughput
+	Change float64 `json:"change"`
+}
+
+// Compare returns the metrics in current that are worse than baseline by
+// more than tolerance, e.g. 0.1 for 10%
+func Compare(baseline, current *Report, tolerance float64) ([]Regression, error) {
+	if baseline.Scenario.Name != current.Scenario.Name {
+		return nil, fmt.Errorf("cannot compare scenario %q with %q", current.Scenario.Name, baseline.Scenario.Name)
+	}
+
+	var regressions []Regression
+	check := func(metric string, base, cur float64, higherIsBetter bool) {
+		if base == 0 {
+			return
+		}
+		change := (cur - base) / base
+		if (higherIsBetter && change < -tolerance) || (!higherIsBetter && change > tolerance) {
+			regressions = append(regressions, Regression{Metric: metric, Baseline: base, Current: cur, Change: change})
+		}
+	}
+	for _, op := range []struct {
+		name      string
+		base, cur OpStats
+	}{
+		{"publish", baseline.Publish, current.Publish},
+		{"query", baseline.Query, current.Query},
+		{"delivery", baseline.Delivery, current.Delivery},
+	} {
+		check(op.name+".per_second", op.base.PerSecond, op.cur.PerSecond, true)
+		check(op.name+".p95_ms", op.base.P95Ms, op.cur.P95Ms, false)
+	}
+	return regressions, nil
+}
@@ -0,0 +1,160 @@
+// Package bench runs reproducible load scenarios against a relay and reports
+// throughput and latency as JSON, so performance can be compared across
+// releases.
+package bench
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Scenario names
+const (
+	ScenarioIngest = "ingest"
+	ScenarioFanout = "fanout"
+	ScenarioQuery  = "query"
+	ScenarioMixed  = "mixed"
+)
+
+// ErrUnknownScenario is returned by Lookup for names not in Scenarios
+var ErrUnknownScenario = fmt.Errorf("unknown scenario")
+
+// Scenario describes one load shape
+type Scenario struct {
+	Name string `json:"name"`
+	// Preload events are published before timing starts so queries have
+	// something to find
+	Preload int `json:"preload"`
+	// Events are published during the timed run, spread across Publishers
+	Events     int `json:"events"`
+	Publishers int `json:"publishers"`
+	// Subscribers each hold a REQ for text notes open and count deliveries
+	Subscribers int `json:"subscribers"`
+	// Queries are run during the timed run, spread across Queriers
+	Queries  int `json:"queries"`
+	Queriers int `json:"queriers"`
+	// Authors the generated events are spread across
+	Authors int `json:"authors"`
+}
+
+// Scenarios returns the built-in scenarios
+func Scenarios() []Scenario {
+	return []Scenario{
+		{Name: ScenarioIngest, Events: 2000, Publishers: 8, Authors: 50},
+		{Name: ScenarioFanout, Events: 500, Publishers: 2, Subscribers: 50, Authors: 20},
+		{Name: ScenarioQuery, Preload: 5000, Queries: 2000, Queriers: 8, Authors: 100},
+		{Name: ScenarioMixed, Preload: 2000, Events: 1000, Publishers: 4, Subscribers: 20, Queries: 1000, Queriers: 4, Authors: 100},
+	}
+}
+
+// Lookup returns the built-in scenario called name
+func Lookup(name string) (Scenario, error) {
+	for _, s := range Scenarios() {
+		if s.Name == name {
+			return s, nil
+		}
+	}
+	return Scenario{}, fmt.Errorf("%w %q", ErrUnknownScenario, name)
+}
+
+// Plan is a scenario with its signed events and query filters generated.
+// The same scenario, seed and base time always produce the same plan.
+type Plan struct {
+	Scenario Scenario
+	Seed     int64
+	Preload  []*nostr.Event
+	Events   []*nostr.Event
+	Queries  []nostr.Filter
+}
+
+var (
+	benchTopics = []string{"nostr", "bitcoin", "books", "relays", "music", "art", "science", "food"}
+	benchWords  = []string{
+		"relay", "note", "event", "signal", "library", "chapter", "garden", "river",
+		"market", "winter", "lantern", "orbit", "harbor", "meadow", "thread", "voice",
+	}
+)
+
+// NewPlan generates the workload for scenario. Events are dated up to ten
+// minutes before base so live relays don't reject them as stale.
+func NewPlan(scenario Scenario, seed int64, base time.Time) (*Plan, error) {
+	authors := scenario.Authors
+	if authors <= 0 {
+		authors = 1
+	}
+	keys := make([]string, authors)
+	for i := range keys {
+		sum := sha256.Sum256([]byte(fmt.Sprintf("mercury-bench:%d:%d", seed, i)))
+		keys[i] = hex.EncodeToString(sum[:])
+	}
+	pubkeys := make([]string, authors)
+	for i, sk := range keys {
+		pk, err := nostr.GetPublicKey(sk)
+		if err != nil {
+			return nil, fmt.Errorf("failed to derive author key: %w", err)
+		}
+		pubkeys[i] = pk
+	}
+
+	rng := rand.New(rand.NewSource(seed))
+	created := nostr.Timestamp(base.Unix())
+	newEvent := func(i int) (*nostr.Event, error) {
+		words := make([]string, 8+rng.Intn(24))
+		for j := range words {
+			words[j] = benchWords[rng.Intn(len(benchWords))]
+		}
+		event := &nostr.Event{
+			CreatedAt: created - nostr.Timestamp(i%600),
+			Kind:      1,
+			Tags:      nostr.Tags{{"t", benchTopics[rng.Intn(len(benchTopics))]}},
+			Content:   fmt.Sprintf("%s #%d", strings.Join(words, " "), i),
+		}
+		if err := event.Sign(keys[rng.Intn(authors)]); err != nil {
+			return nil, fmt.Errorf("failed to sign event: %w", err)
+		}
+		return event, nil
+	}
+
+	plan := &Plan{Scenario: scenario, Seed: seed}
+	for i := 0; i < scenario.Preload; i++ {
+		event, err := newEvent(i)
+		if err != nil {
+			return nil, err
+		}
+		plan.Preload = append(plan.Preload, event)
+	}
+	for i := 0; i < scenario.Events; i++ {
+		event, err := newEvent(scenario.Preload + i)
+		if err != nil {
+			return nil, err
+		}
+		plan.Events = append(plan.Events, event)
+	}
+
+	// Rotate between the lookups clients make most: an author's feed, the
+	// latest notes and a hashtag
+	for i := 0; i < scenario.Queries; i++ {
+		var filter nostr.Filter
+		switch i % 3 {
+		case 0:
+			filter = nostr.Filter{Authors: []string{pubkeys[rng.Intn(authors)]}, Limit: 20}
+		case 1:
+			filter = nostr.Filter{Kinds: []int{1}, Limit: 50}
+		default:
+			filter = nostr.Filter{
+				Kinds: []int{1},
+				Tags:  nostr.TagMap{"t": []string{benchTopics[rng.Intn(len(benchTopics))]}},
+				Limit: 20,
+			}
+		}
+		plan.Queries = append(plan.Queries, filter)
+	}
+
+	return plan, nil
+}
@@ -0,0 +1,191 @@
+package bench
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ErrNoEOSE is returned by Query when the relay doesn't end the stored
+// events before the query deadline
+var ErrNoEOSE = fmt.Errorf("no EOSE before deadline")
+
+// Target is what a scenario runs against
+type Target interface {
+	Name() string
+	// Connect opens one client; every publisher, subscriber and querier
+	// gets its own
+	Connect(ctx context.Context) (Client, error)
+}
+
+// Client is one connection to a target
+type Client interface {
+	// Publish returns once the event is accepted
+	Publish(ctx context.Context, event *nostr.Event) error
+	// Query returns the number of stored events matching filter
+	Query(ctx context.Context, filter nostr.Filter) (int, error)
+	// Subscribe returns once the subscription is live and calls deliver for
+	// every matching event until ctx is done
+	Subscribe(ctx context.Context, filter nostr.Filter, deliver func(*nostr.Event)) error
+	Close() error
+}
+
+// RelayTarget runs scenarios against a live relay over WebSocket
+type RelayTarget struct {
+	url string
+}
+
+func NewRelayTarget(url string) *RelayTarget {
+	return &RelayTarget{url: url}
+}
+
+func (t *RelayTarget) Name() string {
+	return t.url
+}
+
+func (t *RelayTarget) Connect(ctx context.Context) (Client, error) {
+	relay, err := nostr.RelayConnect(ctx, t.url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", t.url, err)
+	}
+	return &relayClient{relay: relay}, nil
+}
+
+type relayClient struct {
+	relay *nostr.Relay
+}
+
+func (c *relayClient) Publish(ctx context.Context, event *nostr.Event) error {
+	return c.relay.Publish(ctx, *event)
+}
+
+func (c *relayClient) Query(ctx context.Context, filter nostr.Filter) (int, error) {
+	sub, err := c.relay.Subscribe(ctx, nostr.Filters{filter})
+	if err != nil {
+		return 0, err
+	}
+	defer sub.Unsub()
+
+	n := 0
+	for {
+		select {
+		case _, ok := <-sub.Events:
+			if !ok {
+				return n, ErrNoEOSE
+			}
+			n++
+		case <-sub.EndOfStoredEvents:
+			return n, nil
+		case reason := <-sub.ClosedReason:
+			return n, fmt.Errorf("subscription closed: %s", reason)
+		case <-ctx.Done():
+			return n, ErrNoEOSE
+		}
+	}
+}
+
+func (c *relayClient) Subscribe(ctx context.Context, filter nostr.Filter, deliver func(*nostr.Event)) error {
+	sub, err := c.relay.Subscribe(ctx, nostr.Filters{filter})
+	if err != nil {
+		return err
+	}
+	go func() {
+		defer sub.Unsub()
+		for {
+			select {
+			case event, ok := <-sub.Events:
+				if !ok {
+					return
+				}
+				deliver(event)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return nil
+}
+
+func (c *relayClient) Close() error {
+	return c.relay.Close()
+}
+
+// MemoryTarget runs scenarios in-process against a cache, with subscriptions
+// matched the way the relay broadcasts them. It is what the package
+// benchmarks use.
+type MemoryTarget struct {
+	cache cache.Cache
+	subs  map[int]memorySubscription
+	next  int
+	mu    sync.RWMutex
+}
+
+type memorySubscription struct {
+	filter  nostr.Filter
+	deliver func(*nostr.Event)
+}
+
+func NewMemoryTarget(c cache.Cache) *MemoryTarget {
+	return &MemoryTarget{
+		cache: c,
+		subs:  make(map[int]memorySubscription),
+	}
+}
+
+func (t *MemoryTarget) Name() string {
+	return "memory"
+}
+
+func (t *MemoryTarget) Connect(ctx context.Context) (Client, error) {
+	return &memoryClient{target: t}, nil
+}
+
+type memoryClient struct {
+	target *MemoryTarget
+}
+
+func (c *memoryClient) Publish(ctx context.Context, event *nostr.Event) error {
+	if err := c.target.cache.StoreEvent(models.FromNostrEvent(event)); err != nil {
+		return err
+	}
+
+	c.target.mu.RLock()
+	defer c.target.mu.RUnlock()
+	for _, sub := range c.target.subs {
+		if sub.filter.Matches(event) {
+			sub.deliver(event)
+		}
+	}
+	return nil
+}
+
+func (c *memoryClient) Query(ctx context.Context, filter nostr.Filter) (int, error) {
+	events, err := cache.Collect(c.target.cache.GetEvents(ctx, filter))
+	return len(events), err
+}
+
+func (c *memoryClient) Subscribe(ctx context.Context, filter nostr.Filter, deliver func(*nostr.Event)) error {
+	t := c.target
+	t.mu.Lock()
+	id := t.next
+	t.next++
+	t.subs[id] = memorySubscription{filter: filter, deliver: deliver}
+	t.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		t.mu.Lock()
+		delete(t.subs, id)
+		t.mu.Unlock()
+	}()
+	return nil
+}
+
+func (c *memoryClient) Close() error {
+	return nil
+}
@@ -0,0 +1,505 @@
+// Package blocklist imports moderation lists published as Nostr events by
+// moderators the operator trusts: NIP-51 people lists (kind 30000, e.g. one
+// with d-tag "spam") and mute lists (kind 10000). Only lists whose ID and
+// signature check out and whose author is the subscribed moderator are
+// applied. Every pubkey a list names is blocked with the list as its
+// source, so a list dropping a pubkey, or the operator unsubscribing from a
+// list, lifts exactly the blocks that list made.
+package blocklist
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/mirror"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+const (
+	// KindMuteList is a user's NIP-51 mute list
+	KindMuteList = 10000
+	// KindPeopleList is a NIP-51 follow set, a named list of people
+	KindPeopleList = 30000
+)
+
+// ErrNotFound is returned for lists the relay is not subscribed to
+var ErrNotFound = fmt.Errorf("block list not found")
+
+// ErrExists is returned when subscribing to a list twice
+var ErrExists = fmt.Errorf("already subscribed to block list")
+
+// Blocker applies blocks on behalf of a source
+type Blocker interface {
+	BlockNpubFrom(npub, source string)
+	UnblockNpubFrom(npub, source string)
+}
+
+// List is a subscribed moderation list and what it currently blocks
+type List struct {
+	// ID is the list's "kind:pubkey:d-tag" address
+	ID        string    `json:"id"`
+	Kind      int       `json:"kind"`
+	Moderator string    `json:"moderator"`
+	DTag      string    `json:"d_tag"`
+	Relays    []string  `json:"relays,omitempty"`
+	Title     string    `json:"title,omitempty"`
+	AddedAt   time.Time `json:"added_at"`
+	// EventID and UpdatedAt identify the version of the list applied
+	EventID   string          `json:"event_id,omitempty"`
+	UpdatedAt nostr.Timestamp `json:"updated_at,omitempty"`
+	// Pubkeys are blocked with the list as their source
+	Pubkeys   []string  `json:"pubkeys"`
+	Count     int       `json:"count"`
+	Exempted  int       `json:"exempted,omitempty"`
+	LastFetch time.Time `json:"last_fetch,omitempty"`
+	LastError string    `json:"last_error,omitempty"`
+}
+
+// Source is the block source recorded for pubkeys the list blocks
+func (l List) Source() string {
+	return "list:" + l.ID
+}
+
+// Summary returns the list without its pubkeys
+func (l List) Summary() List {
+	l.Pubkeys = nil
+	return l
+}
+
+type state struct {
+	Lists []List `json:"lists"`
+}
+
+// Manager keeps the relay's block list subscriptions up to date
+type Manager struct {
+	config  config.BlockListsConfig
+	blocker Blocker
+	fetcher mirror.Fetcher
+	exempt  func(pubkey string) bool
+
+	mu    sync.Mutex
+	lists map[string]*List
+}
+
+// NewManager loads saved subscriptions, subscribes to the configured lists
+// and reapplies the blocks of every list
+func NewManager(cfg config.BlockListsConfig, blocker Blocker) (*Manager, error) {
+	m := &Manager{
+		config:  cfg,
+		blocker: blocker,
+		fetcher: mirror.NewRelayFetcher(cfg.FetchTimeout),
+		lists:   make(map[string]*List),
+	}
+
+	st, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	for i := range st.Lists {
+		list := st.Lists[i]
+		m.lists[list.ID] = &list
+		for _, pubkey := range list.Pubkeys {
+			blocker.BlockNpubFrom(pubkey, list.Source())
+		}
+	}
+
+	for _, address := range cfg.Lists {
+		if _, err := m.Subscribe(address, nil); err != nil && err != ErrExists {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// SetFetcher replaces how relays are queried
+func (m *Manager) SetFetcher(fetcher mirror.Fetcher) {
+	m.fetcher = fetcher
+}
+
+// SetExempt sets the pubkeys no list may block, such as the relay owner
+func (m *Manager) SetExempt(exempt func(pubkey string) bool) {
+	m.exempt = exempt
+}
+
+// ParseAddress accepts an naddr or a "kind:pubkey:d-tag" address (the
+// pubkey as hex or npub) of a people or mute list. Relay hints in an naddr
+// are returned.
+func ParseAddress(address string) (int, string, string, []string, error) {
+	if strings.HasPrefix(address, "naddr1") {
+		prefix, data, err := nip19.Decode(address)
+		if err != nil || prefix != "naddr" {
+			return 0, "", "", nil, fmt.Errorf("invalid naddr %q", address)
+		}
+		pointer := data.(nostr.EntityPointer)
+		if err := checkKind(pointer.Kind, pointer.Identifier); err != nil {
+			return 0, "", "", nil, err
+		}
+		return pointer.Kind, pointer.PublicKey, pointer.Identifier, pointer.Relays, nil
+	}
+
+	parts := strings.SplitN(address, ":", 3)
+	if len(parts) < 2 {
+		return 0, "", "", nil, fmt.Errorf("invalid list address %q: expected kind:pubkey:d-tag", address)
+	}
+	kind, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, "", "", nil, fmt.Errorf("invalid list kind %q", parts[0])
+	}
+	pubkey, err := mirror.ParsePubkey(parts[1])
+	if err != nil {
+		return 0, "", "", nil, fmt.Errorf("invalid list moderator %q", parts[1])
+	}
+	dTag := ""
+	if len(parts) == 3 {
+		dTag = parts[2]
+	}
+	if err := checkKind(kind, dTag); err != nil {
+		return 0, "", "", nil, err
+	}
+	return kind, pubkey, dTag, nil, nil
+}
+
+func checkKind(kind int, dTag string) error {
+	switch {
+	case kind == KindPeopleList && dTag == "":
+		return fmt.Errorf("people list address needs a d-tag")
+	case kind == KindMuteList && dTag != "":
+		return fmt.Errorf("mute lists have no d-tag")
+	case kind != KindPeopleList && kind != KindMuteList:
+		return fmt.Errorf("unsupported list kind %d: expected %d or %d", kind, KindPeopleList, KindMuteList)
+	}
+	return nil
+}
+
+// Subscribe adds the list at address, to be fetched from relays as well as
+// the configured relays. Its pubkeys are blocked once it is first fetched.
+func (m *Manager) Subscribe(address string, relays []string) (List, error) {
+	kind, moderator, dTag, hints, err := ParseAddress(address)
+	if err != nil {
+		return List{}, err
+	}
+	list := &List{
+		ID:        fmt.Sprintf("%d:%s:%s", kind, moderator, dTag),
+		Kind:      kind,
+		Moderator: moderator,
+		DTag:      dTag,
+		AddedAt:   time.Now().UTC(),
+		Pubkeys:   []string{},
+	}
+	seen := make(map[string]bool)
+	for _, url := range append(append([]string{}, relays...), hints...) {
+		url = nostr.NormalizeURL(url)
+		if url != "" && !seen[url] {
+			seen[url] = true
+			list.Relays = append(list.Relays, url)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.lists[list.ID]; ok {
+		return List{}, ErrExists
+	}
+	m.lists[list.ID] = list
+	if err := m.saveLocked(); err != nil {
+		delete(m.lists, list.ID)
+		return List{}, err
+	}
+	log.Printf("Subscribed to block list %s", list.ID)
+	return *list, nil
+}
+
+// Unsubscribe drops the list and lifts every block it made, returning how
+// many pubkeys it had blocked
+func (m *Manager) Unsubscribe(id string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list, ok := m.lists[id]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	delete(m.lists, id)
+	if err := m.saveLocked(); err != nil {
+		m.lists[id] = list
+		return 0, err
+	}
+	for _, pubkey := range list.Pubkeys {
+		m.blocker.UnblockNpubFrom(pubkey, list.Source())
+	}
+	log.Printf("Unsubscribed from block list %s, unblocking %d pubkeys", id, len(list.Pubkeys))
+	return len(list.Pubkeys), nil
+}
+
+// Lists returns every subscription without its pubkeys, sorted by ID
+func (m *Manager) Lists() []List {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	lists := make([]List, 0, len(m.lists))
+	for _, list := range m.lists {
+		lists = append(lists, list.Summary())
+	}
+	sort.Slice(lists, func(i, j int) bool { return lists[i].ID < lists[j].ID })
+	return lists
+}
+
+// Get returns the subscription id with the pubkeys it blocks
+func (m *Manager) Get(id string) (List, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list, ok := m.lists[id]
+	if !ok {
+		return List{}, ErrNotFound
+	}
+	snapshot := *list
+	snapshot.Pubkeys = append([]string{}, list.Pubkeys...)
+	return snapshot, nil
+}
+
+// Run refreshes every list now and then every RefreshInterval until ctx is
+// done
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.config.RefreshInterval)
+	defer ticker.Stop()
+	for {
+		for _, list := range m.Lists() {
+			if err := m.Refresh(ctx, list.ID); err != nil && ctx.Err() == nil {
+				log.Printf("Failed to refresh block list %s: %v", list.ID, err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Refresh fetches the list from its relays and applies the newest valid
+// version found
+func (m *Manager) Refresh(ctx context.Context, id string) error {
+	list, err := m.Get(id)
+	if err != nil {
+		return err
+	}
+	filter := nostr.Filter{Kinds: []int{list.Kind}, Authors: []string{list.Moderator}}
+	if list.Kind == KindPeopleList {
+		filter.Tags = nostr.TagMap{"d": []string{list.DTag}}
+	}
+
+	var newest *models.Event
+	var errs []string
+	for _, url := range m.relays(list) {
+		events, err := m.fetcher.Fetch(ctx, url, filter)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", url, err))
+			continue
+		}
+		for _, ne := range events {
+			event := models.FromNostrEvent(ne)
+			if verify(list, event) == nil && (newest == nil || event.CreatedAt > newest.CreatedAt) {
+				newest = event
+			}
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	current, ok := m.lists[id]
+	if !ok {
+		return ErrNotFound
+	}
+	current.LastFetch = time.Now().UTC()
+	current.LastError = ""
+	switch {
+	case newest != nil:
+		if newest.CreatedAt > current.UpdatedAt {
+			m.applyLocked(current, newest)
+		}
+	case len(errs) > 0:
+		current.LastError = strings.Join(errs, "; ")
+	}
+	if err := m.saveLocked(); err != nil {
+		return err
+	}
+	if newest == nil && len(errs) > 0 {
+		return fmt.Errorf("no relay returned the list: %s", current.LastError)
+	}
+	return nil
+}
+
+// Observe applies event if it is a newer version of a subscribed list,
+// such as one a moderator just published to this relay. It reports
+// whether the event was applied.
+func (m *Manager) Observe(event *models.Event) bool {
+	if event.Kind != KindPeopleList && event.Kind != KindMuteList {
+		return false
+	}
+	dTag := ""
+	if event.Kind == KindPeopleList {
+		dTag = tagValue(event, "d")
+	}
+	id := fmt.Sprintf("%d:%s:%s", event.Kind, event.PubKey, dTag)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list, ok := m.lists[id]
+	if !ok || event.CreatedAt <= list.UpdatedAt || verify(*list, event) != nil {
+		return false
+	}
+	m.applyLocked(list, event)
+	if err := m.saveLocked(); err != nil {
+		log.Printf("Failed to save block lists: %v", err)
+	}
+	return true
+}
+
+// verify checks that event is a version of list signed by its moderator
+func verify(list List, event *models.Event) error {
+	if event.Kind != list.Kind || event.PubKey != list.Moderator {
+		return fmt.Errorf("event is not list %s", list.ID)
+	}
+	if list.Kind == KindPeopleList && tagValue(event, "d") != list.DTag {
+		return fmt.Errorf("event is not list %s", list.ID)
+	}
+	ne := event.ToNostrEvent()
+	if !ne.CheckID() {
+		return fmt.Errorf("event ID does not match its content")
+	}
+	if ok, err := ne.CheckSignature(); err != nil || !ok {
+		return fmt.Errorf("invalid signature")
+	}
+	return nil
+}
+
+// applyLocked replaces the pubkeys list blocks with those event names.
+// Callers must hold m.mu.
+func (m *Manager) applyLocked(list *List, event *models.Event) {
+	source := list.Source()
+	next := make(map[string]bool)
+	exempted := 0
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "p" || !nostr.IsValid32ByteHex(tag[1]) || next[tag[1]] {
+			continue
+		}
+		if m.exempt != nil && m.exempt(tag[1]) {
+			exempted++
+			continue
+		}
+		next[tag[1]] = true
+	}
+
+	added, removed := 0, 0
+	for _, pubkey := range list.Pubkeys {
+		if !next[pubkey] {
+			m.blocker.UnblockNpubFrom(pubkey, source)
+			removed++
+		}
+	}
+	previous := make(map[string]bool, len(list.Pubkeys))
+	for _, pubkey := range list.Pubkeys {
+		previous[pubkey] = true
+	}
+	pubkeys := make([]string, 0, len(next))
+	for pubkey := range next {
+		if !previous[pubkey] {
+			m.blocker.BlockNpubFrom(pubkey, source)
+			added++
+		}
+		pubkeys = append(pubkeys, pubkey)
+	}
+	sort.Strings(pubkeys)
+
+	list.Pubkeys = pubkeys
+	list.Count = len(pubkeys)
+	list.Exempted = exempted
+	list.EventID = event.ID
+	list.UpdatedAt = event.CreatedAt
+	if title := tagValue(event, "title"); title != "" {
+		list.Title = title
+	}
+	if added > 0 || removed > 0 {
+		log.Printf("Block list %s: blocked %d, unblocked %d", list.ID, added, removed)
+	}
+}
+
+func (m *Manager) relays(list List) []string {
+	seen := make(map[string]bool)
+	var relays []string
+	for _, url := range append(append([]string{}, list.Relays...), m.config.Relays...) {
+		url = nostr.NormalizeURL(url)
+		if url != "" && !seen[url] {
+			seen[url] = true
+			relays = append(relays, url)
+		}
+	}
+	return relays
+}
+
+func tagValue(event *models.Event, name string) string {
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == name {
+			return tag[1]
+		}
+	}
+	return ""
+}
+
+func (m *Manager) load() (state, error) {
+	var st state
+	if m.config.Path == "" {
+		return st, nil
+	}
+	data, err := os.ReadFile(m.config.Path)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return st, fmt.Errorf("failed to read %s: %w", m.config.Path, err)
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return st, fmt.Errorf("failed to parse %s: %w", m.config.Path, err)
+	}
+	return st, nil
+}
+
+// saveLocked atomically writes the subscriptions to path. Callers must hold
+// m.mu.
+func (m *Manager) saveLocked() error {
+	if m.config.Path == "" {
+		return nil
+	}
+	st := state{Lists: make([]List, 0, len(m.lists))}
+	for _, list := range m.lists {
+		st.Lists = append(st.Lists, *list)
+	}
+	sort.Slice(st.Lists, func(i, j int) bool { return st.Lists[i].ID < st.Lists[j].ID })
+
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode block lists: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(m.config.Path), 0755); err != nil {
+		return fmt.Errorf("failed to write block lists: %w", err)
+	}
+	tmp := m.config.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write block lists: %w", err)
+	}
+	if err := os.Rename(tmp, m.config.Path); err != nil {
+		return fmt.Errorf("failed to write block lists: %w", err)
+	}
+	return nil
+}
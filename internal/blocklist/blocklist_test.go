@@ -0,0 +1,208 @@
+package blocklist
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// blocks records blocks per source like the quality controller
+type blocks map[string]map[string]bool
+
+func (b blocks) BlockNpubFrom(npub, source string) {
+	if b[npub] == nil {
+		b[npub] = make(map[string]bool)
+	}
+	b[npub][source] = true
+}
+
+func (b blocks) UnblockNpubFrom(npub, source string) {
+	delete(b[npub], source)
+	if len(b[npub]) == 0 {
+		delete(b, npub)
+	}
+}
+
+func (b blocks) blocked() []string {
+	var npubs []string
+	for npub := range b {
+		npubs = append(npubs, npub)
+	}
+	sort.Strings(npubs)
+	return npubs
+}
+
+// fetcher serves the events published to each relay
+type fetcher map[string][]*nostr.Event
+
+func (f fetcher) Fetch(ctx context.Context, url string, filter nostr.Filter) ([]*nostr.Event, error) {
+	events, ok := f[url]
+	if !ok {
+		return nil, fmt.Errorf("connection refused")
+	}
+	var matched []*nostr.Event
+	for _, event := range events {
+		if filter.Matches(event) {
+			matched = append(matched, event)
+		}
+	}
+	return matched, nil
+}
+
+func pubkey(n byte) string {
+	return fmt.Sprintf("%064x", n)
+}
+
+func signedList(t *testing.T, sk string, kind int, dTag string, createdAt nostr.Timestamp, pubkeys ...string) *nostr.Event {
+	t.Helper()
+	event := &nostr.Event{Kind: kind, CreatedAt: createdAt}
+	if dTag != "" {
+		event.Tags = append(event.Tags, nostr.Tag{"d", dTag}, nostr.Tag{"title", "Spammers"})
+	}
+	for _, pk := range pubkeys {
+		event.Tags = append(event.Tags, nostr.Tag{"p", pk})
+	}
+	helpers.AssertNoError(t, event.Sign(sk))
+	return event
+}
+
+func TestParseAddress(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	npub, _ := nip19.EncodePublicKey(pk)
+	naddr, _ := nip19.EncodeEntity(pk, KindPeopleList, "spam", []string{"wss://lists.example.com"})
+
+	for _, address := range []string{"30000:" + pk + ":spam", "30000:" + npub + ":spam", naddr} {
+		kind, moderator, dTag, _, err := ParseAddress(address)
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, KindPeopleList, kind)
+		helpers.AssertStringEqual(t, pk, moderator)
+		helpers.AssertStringEqual(t, "spam", dTag)
+	}
+	_, _, _, relays, _ := ParseAddress(naddr)
+	helpers.AssertEqual(t, "[wss://lists.example.com]", fmt.Sprint(relays))
+
+	_, _, dTag, _, err := ParseAddress("10000:" + pk)
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, "", dTag)
+
+	for _, address := range []string{"30000:" + pk, "10000:" + pk + ":spam", "3:" + pk + ":", "30000:nobody:spam", "spam"} {
+		_, _, _, _, err := ParseAddress(address)
+		helpers.AssertError(t, err)
+	}
+}
+
+func TestImportAndRollback(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	moderator, _ := nostr.GetPublicKey(sk)
+	path := filepath.Join(t.TempDir(), "block_lists.json")
+	cfg := config.BlockListsConfig{Relays: []string{"wss://a.example.com", "wss://down.example.com"}, Path: path}
+
+	b := blocks{}
+	b.BlockNpubFrom(pubkey(1), "manual")
+	m, err := NewManager(cfg, b)
+	helpers.AssertNoError(t, err)
+	f := fetcher{"wss://a.example.com": {
+		signedList(t, sk, KindPeopleList, "spam", 100, pubkey(1), pubkey(2)),
+		signedList(t, sk, KindPeopleList, "spam", 200, pubkey(1), pubkey(2), pubkey(3)),
+		signedList(t, sk, KindPeopleList, "friends", 300, pubkey(9)),
+	}}
+	m.SetFetcher(f)
+	m.SetExempt(func(pk string) bool { return pk == pubkey(3) })
+
+	list, err := m.Subscribe("30000:"+moderator+":spam", nil)
+	helpers.AssertNoError(t, err)
+	_, err = m.Subscribe("30000:"+moderator+":spam", nil)
+	helpers.AssertTrue(t, err == ErrExists)
+
+	// The newest version is applied, leaving exempt pubkeys alone
+	helpers.AssertNoError(t, m.Refresh(context.Background(), list.ID))
+	list, _ = m.Get(list.ID)
+	helpers.AssertEqual(t, fmt.Sprint([]string{pubkey(1), pubkey(2)}), fmt.Sprint(list.Pubkeys))
+	helpers.AssertIntEqual(t, 1, list.Exempted)
+	helpers.AssertInt64Equal(t, 200, int64(list.UpdatedAt))
+	helpers.AssertStringEqual(t, "Spammers", list.Title)
+	helpers.AssertStringEqual(t, "", list.LastError)
+	helpers.AssertEqual(t, fmt.Sprint([]string{pubkey(1), pubkey(2)}), fmt.Sprint(b.blocked()))
+	helpers.AssertTrue(t, b[pubkey(2)][list.Source()])
+
+	// A newer version seen live drops pubkey 2
+	update := models.FromNostrEvent(signedList(t, sk, KindPeopleList, "spam", 300, pubkey(1), pubkey(4)))
+	helpers.AssertTrue(t, m.Observe(update))
+	helpers.AssertFalse(t, m.Observe(update))
+	helpers.AssertEqual(t, fmt.Sprint([]string{pubkey(1), pubkey(4)}), fmt.Sprint(b.blocked()))
+
+	// Refreshing does not go back to an older version
+	helpers.AssertNoError(t, m.Refresh(context.Background(), list.ID))
+	list, _ = m.Get(list.ID)
+	helpers.AssertStringEqual(t, update.ID, list.EventID)
+
+	// Subscriptions and their blocks survive a restart
+	restarted := blocks{}
+	m2, err := NewManager(cfg, restarted)
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 1, len(m2.Lists()))
+	helpers.AssertEqual(t, fmt.Sprint([]string{pubkey(1), pubkey(4)}), fmt.Sprint(restarted.blocked()))
+
+	// Unsubscribing lifts only the list's blocks
+	n, err := m.Unsubscribe(list.ID)
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 2, n)
+	helpers.AssertEqual(t, fmt.Sprint([]string{pubkey(1)}), fmt.Sprint(b.blocked()))
+	helpers.AssertTrue(t, b[pubkey(1)]["manual"])
+	_, err = m.Unsubscribe(list.ID)
+	helpers.AssertTrue(t, err == ErrNotFound)
+}
+
+func TestForgedListsIgnored(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	moderator, _ := nostr.GetPublicKey(sk)
+	impostor := nostr.GeneratePrivateKey()
+
+	forged := signedList(t, sk, KindPeopleList, "spam", 200, pubkey(1))
+	forged.Tags = append(forged.Tags, nostr.Tag{"p", pubkey(2)})
+	badSig := signedList(t, sk, KindPeopleList, "spam", 300, pubkey(1))
+	badSig.Sig = signedList(t, sk, KindPeopleList, "spam", 300, pubkey(2)).Sig
+	byOther := signedList(t, impostor, KindPeopleList, "spam", 400, pubkey(3))
+	byOther.PubKey = moderator
+
+	b := blocks{}
+	m, err := NewManager(config.BlockListsConfig{Relays: []string{"wss://a.example.com"}}, b)
+	helpers.AssertNoError(t, err)
+	m.SetFetcher(fetcher{"wss://a.example.com": {forged, badSig, byOther}})
+	list, err := m.Subscribe("30000:"+moderator+":spam", nil)
+	helpers.AssertNoError(t, err)
+
+	helpers.AssertNoError(t, m.Refresh(context.Background(), list.ID))
+	helpers.AssertIntEqual(t, 0, len(b))
+	for _, event := range []*nostr.Event{forged, badSig, byOther} {
+		helpers.AssertFalse(t, m.Observe(models.FromNostrEvent(event)))
+	}
+
+	// With no relay reachable the error is kept on the list
+	m.SetFetcher(fetcher{})
+	helpers.AssertError(t, m.Refresh(context.Background(), list.ID))
+	list, _ = m.Get(list.ID)
+	helpers.AssertStringContains(t, list.LastError, "connection refused")
+}
+
+func TestMuteList(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	moderator, _ := nostr.GetPublicKey(sk)
+	b := blocks{}
+	m, err := NewManager(config.BlockListsConfig{Lists: []string{"10000:" + moderator}}, b)
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 1, len(m.Lists()))
+
+	helpers.AssertTrue(t, m.Observe(models.FromNostrEvent(signedList(t, sk, KindMuteList, "", 100, pubkey(5)))))
+	helpers.AssertEqual(t, fmt.Sprint([]string{pubkey(5)}), fmt.Sprint(b.blocked()))
+}
@@ -0,0 +1,107 @@
+package bloom
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	// MaxBytes bounds the bit array a client may send (8 Mbit, enough for
+	// about a million IDs at a 1% false positive rate)
+	MaxBytes = 1 << 20
+
+	// MaxHashes bounds the number of probes per ID
+	MaxHashes = 32
+)
+
+// ErrInvalidFilter is returned for a malformed bloom filter
+var ErrInvalidFilter = fmt.Errorf("invalid bloom filter")
+
+// Filter is a bloom filter over 32-byte event IDs. Event IDs are already
+// SHA-256 digests, so probes are derived from the ID itself by double
+// hashing, which keeps the filter simple to build on small clients:
+//
+//	h1 = uint64(id[0:8]) XOR tweak    (big endian)
+//	h2 = uint64(id[8:16]) OR 1
+//	bit i = (h1 + i*h2) mod (8*len(bits)), for i in [0, hashes)
+//
+// Bit n is bits[n/8] & (1 << (n%8)). Changing the tweak between syncs moves
+// false positives around so no event is hidden forever.
+type Filter struct {
+	bits   []byte
+	hashes int
+	tweak  uint32
+}
+
+// New returns an empty filter with size bytes and the given number of hashes
+func New(size, hashes int, tweak uint32) (*Filter, error) {
+	if size <= 0 || size > MaxBytes {
+		return nil, fmt.Errorf("%w: size must be between 1 and %d bytes", ErrInvalidFilter, MaxBytes)
+	}
+	if hashes <= 0 || hashes > MaxHashes {
+		return nil, fmt.Errorf("%w: hashes must be between 1 and %d", ErrInvalidFilter, MaxHashes)
+	}
+	return &Filter{bits: make([]byte, size), hashes: hashes, tweak: tweak}, nil
+}
+
+// Decode builds a filter from the base64 bit array a client sent
+func Decode(bits string, hashes int, tweak uint32) (*Filter, error) {
+	raw, err := base64.StdEncoding.DecodeString(bits)
+	if err != nil {
+		return nil, fmt.Errorf("%w: bits are not base64: %v", ErrInvalidFilter, err)
+	}
+	f, err := New(len(raw), hashes, tweak)
+	if err != nil {
+		return nil, err
+	}
+	copy(f.bits, raw)
+	return f, nil
+}
+
+// Encode returns the bit array as base64
+func (f *Filter) Encode() string {
+	return base64.StdEncoding.EncodeToString(f.bits)
+}
+
+// Add inserts a hex event ID
+func (f *Filter) Add(id string) error {
+	h1, h2, err := f.probes(id)
+	if err != nil {
+		return err
+	}
+	m := uint64(len(f.bits)) * 8
+	for i := 0; i < f.hashes; i++ {
+		n := (h1 + uint64(i)*h2) % m
+		f.bits[n/8] |= 1 << (n % 8)
+	}
+	return nil
+}
+
+// Has reports whether a hex event ID may be in the filter. Malformed IDs are
+// never in it.
+func (f *Filter) Has(id string) bool {
+	h1, h2, err := f.probes(id)
+	if err != nil {
+		return false
+	}
+	m := uint64(len(f.bits)) * 8
+	for i := 0; i < f.hashes; i++ {
+		n := (h1 + uint64(i)*h2) % m
+		if f.bits[n/8]&(1<<(n%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *Filter) probes(id string) (uint64, uint64, error) {
+	raw, err := hex.DecodeString(id)
+	if err != nil || len(raw) != 32 {
+		return 0, 0, fmt.Errorf("%w: %q is not a 32-byte hex ID", ErrInvalidFilter, id)
+	}
+	h1 := binary.BigEndian.Uint64(raw[0:8]) ^ uint64(f.tweak)
+	h2 := binary.BigEndian.Uint64(raw[8:16]) | 1
+	return h1, h2, nil
+}
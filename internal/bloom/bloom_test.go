@@ -0,0 +1,61 @@
+package bloom
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	"mercury-relay/test/helpers"
+)
+
+func eventID(i int) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("event %d", i)))
+	return hex.EncodeToString(sum[:])
+}
+
+func TestFilter(t *testing.T) {
+	// ~10 bits per ID and 7 hashes is about 1% false positives
+	f, err := New(1250, 7, 42)
+	helpers.AssertNoError(t, err)
+
+	for i := 0; i < 1000; i++ {
+		helpers.AssertNoError(t, f.Add(eventID(i)))
+	}
+	for i := 0; i < 1000; i++ {
+		helpers.AssertTrue(t, f.Has(eventID(i)))
+	}
+
+	falsePositives := 0
+	for i := 1000; i < 11000; i++ {
+		if f.Has(eventID(i)) {
+			falsePositives++
+		}
+	}
+	helpers.AssertTrue(t, falsePositives < 300)
+
+	helpers.AssertError(t, f.Add("not-an-id"))
+	helpers.AssertFalse(t, f.Has("not-an-id"))
+}
+
+func TestDecode(t *testing.T) {
+	f, _ := New(64, 3, 7)
+	helpers.AssertNoError(t, f.Add(eventID(1)))
+
+	decoded, err := Decode(f.Encode(), 3, 7)
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, decoded.Has(eventID(1)))
+
+	// Another tweak probes other bits
+	retweaked, _ := Decode(f.Encode(), 3, 8)
+	helpers.AssertFalse(t, retweaked.Has(eventID(1)))
+
+	_, err = Decode("***", 3, 0)
+	helpers.AssertError(t, err)
+	_, err = Decode("", 3, 0)
+	helpers.AssertError(t, err)
+	_, err = Decode(f.Encode(), 0, 0)
+	helpers.AssertError(t, err)
+	_, err = Decode(f.Encode(), MaxHashes+1, 0)
+	helpers.AssertError(t, err)
+}
@@ -1,15 +1,28 @@
 package cache
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"iter"
+	"time"
+
+	"mercury-relay/internal/config"
 	"mercury-relay/internal/models"
 
 	"github.com/nbd-wtf/go-nostr"
 )
 
+// EventIterator yields the events matching a query. A non-nil error ends
+// the iteration; when the query's context is done its error is yielded.
+type EventIterator = iter.Seq2[*models.Event, error]
+
 // Cache defines the interface for caching
 type Cache interface {
 	StoreEvent(event *models.Event) error
-	GetEvents(filter nostr.Filter) ([]*models.Event, error)
+	GetEvents(ctx context.Context, filter nostr.Filter) EventIterator
 	DeleteEvent(eventID string) error
 	GetStats() (map[string]interface{}, error)
 	Close() error
@@ -18,3 +31,62 @@ type Cache interface {
 	GetReplaceableEventHistory(kind int, pubkey, dTag string) ([]map[string]interface{}, error)
 	GetLatestReplaceableEvent(kind int, pubkey, dTag string) (*models.Event, error)
 }
+
+// Retention is implemented by caches whose event TTL can change at runtime.
+// A new TTL applies to events stored afterwards.
+type Retention interface {
+	TTL() time.Duration
+	SetTTL(ttl time.Duration)
+}
+
+// BatchStore is implemented by caches that can store several events in
+// fewer round trips than one StoreEvent call each
+type BatchStore interface {
+	StoreEvents(events []*models.Event) error
+}
+
+// StoreEvents stores events in one batch when c supports it, one by one
+// otherwise. Every event is attempted; the errors are joined.
+func StoreEvents(c Cache, events []*models.Event) error {
+	if batch, ok := c.(BatchStore); ok {
+		return batch.StoreEvents(events)
+	}
+	var errs []error
+	for _, event := range events {
+		if err := c.StoreEvent(event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Collect runs a query to completion and returns its events
+func Collect(events EventIterator) ([]*models.Event, error) {
+	var collected []*models.Event
+	for event, err := range events {
+		if err != nil {
+			return nil, err
+		}
+		collected = append(collected, event)
+	}
+	return collected, nil
+}
+
+// New creates the cache backend selected by cfg.Backend
+func New(cfg config.CacheConfig, redisConfig config.RedisConfig) (Cache, error) {
+	switch cfg.Backend {
+	case "", "redis":
+		return NewRedis(redisConfig)
+	case "memory":
+		return NewMemory(cfg), nil
+	default:
+		return nil, fmt.Errorf("unknown cache backend: %s", cfg.Backend)
+	}
+}
+
+// eventHash generates a hash for event comparison
+func eventHash(event *models.Event) string {
+	content := fmt.Sprintf("%s:%s:%d:%s", event.ID, event.PubKey, event.Kind, event.Content)
+	hash := sha256.Sum256([]byte(content))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,628 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// wheelSlots is the number of buckets in the expiry wheel. Each slot covers
+// TTL/wheelSlots, so an event is swept at most one slot after it expires.
+const wheelSlots = 256
+
+// scanCheckInterval is how many events a query visits between checks of its
+// context
+const scanCheckInterval = 1024
+
+// Memory is an in-process Cache for tests and small nodes that don't run
+// Redis. Events are spread over sharded maps, expired by a TTL wheel and
+// evicted oldest-first once a shard is full. Mirrored events are exempt from
+// both.
+type Memory struct {
+	config config.CacheConfig
+	shards []*memoryShard
+	wheel  *ttlWheel
+
+	history   map[string]*memoryHistory
+	historyMu sync.RWMutex
+
+	hits        int64
+	misses      int64
+	evictions   int64
+	expirations int64
+
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+type memoryShard struct {
+	mu      sync.RWMutex
+	limit   int
+	events  map[string]*memoryEntry
+	order   *list.List // event IDs in insertion order
+	authors map[string]map[string]struct{}
+	kinds   map[int]map[string]struct{}
+}
+
+type memoryEntry struct {
+	event   *models.Event
+	expires time.Time
+	elem    *list.Element
+}
+
+// memoryHistory tracks the versions of one replaceable event, newest first
+type memoryHistory struct {
+	seq      int64
+	versions []map[string]interface{}
+	latest   string
+	latestAt nostr.Timestamp
+}
+
+func NewMemory(cfg config.CacheConfig) *Memory {
+	if cfg.Shards <= 0 {
+		cfg.Shards = 16
+	}
+	if cfg.MaxEvents <= 0 {
+		cfg.MaxEvents = 100000
+	}
+
+	limit := (cfg.MaxEvents + cfg.Shards - 1) / cfg.Shards
+	m := &Memory{
+		config:  cfg,
+		shards:  make([]*memoryShard, cfg.Shards),
+		history: make(map[string]*memoryHistory),
+		stop:    make(chan struct{}),
+	}
+	for i := range m.shards {
+		m.shards[i] = &memoryShard{
+			limit:   limit,
+			events:  make(map[string]*memoryEntry),
+			order:   list.New(),
+			authors: make(map[string]map[string]struct{}),
+			kinds:   make(map[int]map[string]struct{}),
+		}
+	}
+
+	if cfg.TTL > 0 {
+		m.wheel = newTTLWheel(cfg.TTL/wheelSlots, time.Now())
+		go m.sweepLoop()
+	}
+
+	return m
+}
+
+func (m *Memory) shardFor(id string) *memoryShard {
+	h := fnv.New32a()
+	h.Write([]byte(id))
+	return m.shards[h.Sum32()%uint32(len(m.shards))]
+}
+
+func (m *Memory) StoreEvent(event *models.Event) error {
+	if event == nil || event.ID == "" {
+		return fmt.Errorf("event ID is required")
+	}
+
+	// Versions older than the latest one of a replaceable event are dropped
+	if models.IsReplaceableKind(event.Kind) && m.superseded(event) {
+		return nil
+	}
+
+	now := time.Now()
+	shard := m.shardFor(event.ID)
+
+	shard.mu.Lock()
+	if entry, exists := shard.events[event.ID]; exists {
+		if !entry.expired(now) {
+			// Event already exists, don't store duplicate; just note how it
+			// arrived this time
+			entry.event.Provenance, _ = models.MergeProvenance(entry.event.Provenance, event.Provenance)
+			if entry.event.TrustLabel == "" {
+				entry.event.TrustLabel = event.TrustLabel
+			}
+			if event.Mirrored && !entry.event.Mirrored {
+				shard.mirror(entry)
+			}
+			shard.mu.Unlock()
+			return nil
+		}
+		shard.remove(event.ID)
+	}
+
+	stored := *event
+	entry := &memoryEntry{event: &stored}
+	if m.config.TTL > 0 && !stored.Mirrored {
+		entry.expires = now.Add(m.config.TTL)
+	}
+
+	var evicted []*models.Event
+	for len(shard.events) >= shard.limit && shard.order.Len() > 0 {
+		oldest := shard.order.Front().Value.(string)
+		evicted = append(evicted, shard.remove(oldest))
+	}
+	shard.insert(entry)
+	shard.mu.Unlock()
+
+	atomic.AddInt64(&m.evictions, int64(len(evicted)))
+	for _, old := range evicted {
+		m.forgetLatest(old)
+	}
+
+	if m.wheel != nil && !entry.expires.IsZero() {
+		m.wheel.schedule(event.ID, entry.expires)
+	}
+
+	if models.IsReplaceableKind(event.Kind) {
+		m.storeReplaceableEvent(&stored)
+	}
+
+	return nil
+}
+
+func (m *Memory) GetEvents(ctx context.Context, filter nostr.Filter) EventIterator {
+	return traceQuery(ctx, "memory", filter, func(yield func(*models.Event, error) bool) {
+		events, err := m.query(ctx, filter)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for _, event := range events {
+			if !yield(event, nil) {
+				return
+			}
+		}
+	})
+}
+
+// query returns the events matching filter, newest first. Results are
+// sorted and limited, so the whole match is gathered before any is yielded;
+// ctx is checked as the shards are scanned.
+func (m *Memory) query(ctx context.Context, filter nostr.Filter) ([]*models.Event, error) {
+	now := time.Now()
+
+	var candidates []*models.Event
+	if len(filter.IDs) > 0 {
+		for _, id := range filter.IDs {
+			if event := m.get(id, now); event != nil {
+				candidates = append(candidates, event)
+			}
+		}
+	} else {
+		for _, shard := range m.shards {
+			found, err := shard.scan(ctx, filter, now)
+			if err != nil {
+				return nil, err
+			}
+			candidates = append(candidates, found...)
+		}
+	}
+
+	var events []*models.Event
+	seen := make(map[string]bool)
+	for i, event := range candidates {
+		if i%scanCheckInterval == 0 && ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+
+		// Tag filters match the normalized tags
+		if !event.MatchesFilter(filter) {
+			continue
+		}
+
+		// For replaceable events, only return the latest version unless a
+		// specific revision was requested by ID. A superseded version is
+		// dropped rather than swapped for the latest, which is a candidate
+		// of its own if it matches the filter
+		if models.IsReplaceableKind(event.Kind) && len(filter.IDs) == 0 {
+			latest, err := m.GetLatestReplaceableEvent(event.Kind, event.PubKey, event.DTag())
+			if err != nil || latest.ID != event.ID {
+				continue
+			}
+		}
+		if seen[event.ID] {
+			continue
+		}
+		seen[event.ID] = true
+		events = append(events, event)
+	}
+
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].CreatedAt > events[j].CreatedAt
+	})
+	if filter.Limit > 0 && len(events) > filter.Limit {
+		events = events[:filter.Limit]
+	}
+
+	return events, nil
+}
+
+// get returns a copy of the event with id if it is present and unexpired
+func (m *Memory) get(id string, now time.Time) *models.Event {
+	shard := m.shardFor(id)
+	shard.mu.RLock()
+	entry, ok := shard.events[id]
+	shard.mu.RUnlock()
+
+	if !ok || entry.expired(now) {
+		atomic.AddInt64(&m.misses, 1)
+		return nil
+	}
+	atomic.AddInt64(&m.hits, 1)
+	event := *entry.event
+	return &event
+}
+
+func (m *Memory) DeleteEvent(eventID string) error {
+	shard := m.shardFor(eventID)
+	shard.mu.Lock()
+	shard.remove(eventID)
+	shard.mu.Unlock()
+	return nil
+}
+
+func (m *Memory) GetStats() (map[string]interface{}, error) {
+	total := 0
+	for _, shard := range m.shards {
+		shard.mu.RLock()
+		total += len(shard.events)
+		shard.mu.RUnlock()
+	}
+
+	m.historyMu.RLock()
+	replaceable := len(m.history)
+	m.historyMu.RUnlock()
+
+	return map[string]interface{}{
+		"backend":           "memory",
+		"total_events":      total,
+		"max_events":        m.config.MaxEvents,
+		"shards":            len(m.shards),
+		"replaceable_keys":  replaceable,
+		"keyspace_hits":     atomic.LoadInt64(&m.hits),
+		"keyspace_misses":   atomic.LoadInt64(&m.misses),
+		"evicted_events":    atomic.LoadInt64(&m.evictions),
+		"expired_events":    atomic.LoadInt64(&m.expirations),
+		"connected_clients": 0,
+	}, nil
+}
+
+func (m *Memory) Close() error {
+	m.closeOnce.Do(func() {
+		close(m.stop)
+	})
+	return nil
+}
+
+// superseded reports whether the cache holds a later version of event
+func (m *Memory) superseded(event *models.Event) bool {
+	m.historyMu.RLock()
+	defer m.historyMu.RUnlock()
+	h, ok := m.history[replaceableKey(event.Kind, event.PubKey, event.DTag())]
+	return ok && h.supersedes(event)
+}
+
+// supersedes reports whether the latest version replaces event
+func (h *memoryHistory) supersedes(event *models.Event) bool {
+	latest := models.Event{ID: h.latest, CreatedAt: h.latestAt}
+	return h.latest != "" && h.latest != event.ID && latest.Supersedes(event)
+}
+
+// storeReplaceableEvent records a new version and moves the latest pointer
+func (m *Memory) storeReplaceableEvent(event *models.Event) {
+	key := replaceableKey(event.Kind, event.PubKey, event.DTag())
+
+	m.historyMu.Lock()
+	defer m.historyMu.Unlock()
+
+	h, ok := m.history[key]
+	if !ok {
+		h = &memoryHistory{}
+		m.history[key] = h
+	}
+	if h.supersedes(event) {
+		// A later version was stored since the check in StoreEvent
+		return
+	}
+	h.seq++
+
+	// Numbers are float64 to match versions decoded from the Redis backend
+	version := map[string]interface{}{
+		"event_id":   event.ID,
+		"version":    float64(h.seq),
+		"created_at": float64(event.CreatedAt),
+		"hash":       eventHash(event),
+	}
+	h.versions = append([]map[string]interface{}{version}, h.versions...)
+	if m.config.HistoryDepth > 0 && len(h.versions) > m.config.HistoryDepth {
+		h.versions = h.versions[:m.config.HistoryDepth]
+	}
+	h.latest = event.ID
+	h.latestAt = event.CreatedAt
+}
+
+// forgetLatest drops the history of a replaceable event once its latest
+// version has left the cache, so history stays bounded with the events
+func (m *Memory) forgetLatest(event *models.Event) {
+	if event == nil || !models.IsReplaceableKind(event.Kind) {
+		return
+	}
+	key := replaceableKey(event.Kind, event.PubKey, event.DTag())
+
+	m.historyMu.Lock()
+	if h, ok := m.history[key]; ok && h.latest == event.ID {
+		delete(m.history, key)
+	}
+	m.historyMu.Unlock()
+}
+
+// GetReplaceableEventHistory returns the history of a replaceable event
+func (m *Memory) GetReplaceableEventHistory(kind int, pubkey, dTag string) ([]map[string]interface{}, error) {
+	m.historyMu.RLock()
+	defer m.historyMu.RUnlock()
+
+	h, ok := m.history[replaceableKey(kind, pubkey, dTag)]
+	if !ok {
+		return nil, nil
+	}
+
+	history := make([]map[string]interface{}, 0, len(h.versions))
+	for _, version := range h.versions {
+		v := make(map[string]interface{}, len(version))
+		for k, val := range version {
+			v[k] = val
+		}
+		history = append(history, v)
+	}
+	return history, nil
+}
+
+// GetLatestReplaceableEvent returns the latest version of a replaceable event
+func (m *Memory) GetLatestReplaceableEvent(kind int, pubkey, dTag string) (*models.Event, error) {
+	m.historyMu.RLock()
+	h, ok := m.history[replaceableKey(kind, pubkey, dTag)]
+	var latest string
+	if ok {
+		latest = h.latest
+	}
+	m.historyMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("failed to get latest event ID: no versions for %s", replaceableKey(kind, pubkey, dTag))
+	}
+
+	event := m.get(latest, time.Now())
+	if event == nil {
+		return nil, fmt.Errorf("failed to get event: %s not cached", latest)
+	}
+	return event, nil
+}
+
+// sweepLoop removes expired events as the wheel turns
+func (m *Memory) sweepLoop() {
+	ticker := time.NewTicker(m.wheel.tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-m.stop:
+			return
+		case now := <-ticker.C:
+			m.sweep(now)
+		}
+	}
+}
+
+// sweep expires events whose wheel slots have come due. Entries that were
+// replaced and rescheduled since are left alone.
+func (m *Memory) sweep(now time.Time) {
+	for _, id := range m.wheel.advance(now) {
+		shard := m.shardFor(id)
+		shard.mu.Lock()
+		entry, ok := shard.events[id]
+		if !ok {
+			shard.mu.Unlock()
+			continue
+		}
+		if entry.expires.IsZero() {
+			// Mirrored since it was scheduled
+			shard.mu.Unlock()
+			continue
+		}
+		if !entry.expired(now) {
+			shard.mu.Unlock()
+			m.wheel.schedule(id, entry.expires)
+			continue
+		}
+		event := shard.remove(id)
+		shard.mu.Unlock()
+
+		atomic.AddInt64(&m.expirations, 1)
+		m.forgetLatest(event)
+	}
+}
+
+func (e *memoryEntry) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// insert adds entry and indexes it. Mirrored events are left out of the
+// eviction order. Callers must hold mu.
+func (s *memoryShard) insert(entry *memoryEntry) {
+	event := entry.event
+	if !event.Mirrored {
+		entry.elem = s.order.PushBack(event.ID)
+	}
+	s.events[event.ID] = entry
+
+	if s.authors[event.PubKey] == nil {
+		s.authors[event.PubKey] = make(map[string]struct{})
+	}
+	s.authors[event.PubKey][event.ID] = struct{}{}
+
+	if s.kinds[event.Kind] == nil {
+		s.kinds[event.Kind] = make(map[string]struct{})
+	}
+	s.kinds[event.Kind][event.ID] = struct{}{}
+}
+
+// remove deletes id and its index entries, returning the removed event.
+// Callers must hold mu.
+func (s *memoryShard) remove(id string) *models.Event {
+	entry, ok := s.events[id]
+	if !ok {
+		return nil
+	}
+	event := entry.event
+
+	delete(s.events, id)
+	if entry.elem != nil {
+		s.order.Remove(entry.elem)
+	}
+
+	if ids := s.authors[event.PubKey]; ids != nil {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(s.authors, event.PubKey)
+		}
+	}
+	if ids := s.kinds[event.Kind]; ids != nil {
+		delete(ids, id)
+		if len(ids) == 0 {
+			delete(s.kinds, event.Kind)
+		}
+	}
+
+	return event
+}
+
+// mirror keeps an already cached event for good: it stops expiring, can no
+// longer be evicted and is released from quarantine. Callers must hold mu.
+func (s *memoryShard) mirror(entry *memoryEntry) {
+	entry.event.Mirrored = true
+	entry.event.IsQuarantined = false
+	entry.event.QuarantineReason = ""
+	entry.expires = time.Time{}
+	if entry.elem != nil {
+		s.order.Remove(entry.elem)
+		entry.elem = nil
+	}
+}
+
+// scan returns copies of unexpired events narrowed by the author or kind
+// index. The full filter is applied by the caller.
+func (s *memoryShard) scan(ctx context.Context, filter nostr.Filter, now time.Time) ([]*models.Event, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var events []*models.Event
+	visited := 0
+	add := func(id string) bool {
+		visited++
+		if visited%scanCheckInterval == 0 && ctx.Err() != nil {
+			return false
+		}
+		if entry, ok := s.events[id]; ok && !entry.expired(now) {
+			event := *entry.event
+			events = append(events, &event)
+		}
+		return true
+	}
+
+	switch {
+	case len(filter.Authors) > 0:
+		for _, author := range filter.Authors {
+			for id := range s.authors[author] {
+				if !add(id) {
+					return nil, ctx.Err()
+				}
+			}
+		}
+	case len(filter.Kinds) > 0:
+		for _, kind := range filter.Kinds {
+			for id := range s.kinds[kind] {
+				if !add(id) {
+					return nil, ctx.Err()
+				}
+			}
+		}
+	default:
+		for id := range s.events {
+			if !add(id) {
+				return nil, ctx.Err()
+			}
+		}
+	}
+
+	return events, ctx.Err()
+}
+
+// ttlWheel is a hashed timing wheel of event IDs bucketed by expiry
+type ttlWheel struct {
+	mu    sync.Mutex
+	tick  time.Duration
+	slots []map[string]struct{}
+	pos   int
+	at    time.Time // start of the slot at pos
+}
+
+func newTTLWheel(tick time.Duration, now time.Time) *ttlWheel {
+	if tick < time.Second {
+		tick = time.Second
+	}
+	w := &ttlWheel{
+		tick:  tick,
+		slots: make([]map[string]struct{}, wheelSlots),
+		at:    now,
+	}
+	for i := range w.slots {
+		w.slots[i] = make(map[string]struct{})
+	}
+	return w
+}
+
+// schedule places id in the slot covering expires. Expiries beyond the
+// wheel's span go in the furthest slot and are rescheduled when it comes due.
+func (w *ttlWheel) schedule(id string, expires time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	offset := int(expires.Sub(w.at) / w.tick)
+	if offset < 0 {
+		offset = 0
+	}
+	if offset >= len(w.slots) {
+		offset = len(w.slots) - 1
+	}
+	w.slots[(w.pos+offset)%len(w.slots)][id] = struct{}{}
+}
+
+// advance turns the wheel up to now and returns the IDs in the slots passed
+func (w *ttlWheel) advance(now time.Time) []string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	var due []string
+	for !now.Before(w.at.Add(w.tick)) {
+		slot := w.slots[w.pos]
+		for id := range slot {
+			due = append(due, id)
+		}
+		w.slots[w.pos] = make(map[string]struct{})
+		w.pos = (w.pos + 1) % len(w.slots)
+		w.at = w.at.Add(w.tick)
+	}
+	return due
+}
+
+func replaceableKey(kind int, pubkey, dTag string) string {
+	return fmt.Sprintf("%d:%s:%s", kind, pubkey, dTag)
+}
@@ -0,0 +1,374 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestMemoryCacheStoreAndQuery(t *testing.T) {
+	m := NewMemory(config.CacheConfig{Shards: 4})
+	defer m.Close()
+
+	eg := models.NewEventGenerator()
+	npub1 := eg.GetRandomNpub()
+	npub2 := eg.GetRandomNpub()
+	for npub2 == npub1 {
+		npub2 = eg.GetRandomNpub()
+	}
+
+	note := eg.GenerateTextNote(npub1, "First", nostr.Tags{{"t", "books"}})
+	other := eg.GenerateTextNote(npub2, "Second", nostr.Tags{})
+	helpers.AssertNoError(t, m.StoreEvent(note))
+	helpers.AssertNoError(t, m.StoreEvent(note)) // duplicates are ignored
+	helpers.AssertNoError(t, m.StoreEvent(other))
+
+	events, err := Collect(m.GetEvents(context.Background(), nostr.Filter{Authors: []string{npub1}}))
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 1, len(events))
+	helpers.AssertStringEqual(t, note.ID, events[0].ID)
+
+	events, err = Collect(m.GetEvents(context.Background(), nostr.Filter{Kinds: []int{1}, Tags: nostr.TagMap{"t": {"books"}}}))
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 1, len(events))
+
+	events, err = Collect(m.GetEvents(context.Background(), nostr.Filter{IDs: []string{other.ID}}))
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 1, len(events))
+
+	helpers.AssertNoError(t, m.DeleteEvent(other.ID))
+	events, err = Collect(m.GetEvents(context.Background(), nostr.Filter{}))
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 1, len(events))
+}
+
+func TestMemoryCacheNormalizedTags(t *testing.T) {
+	m := NewMemory(config.CacheConfig{})
+	defer m.Close()
+
+	eg := models.NewEventGenerator()
+	note := eg.GenerateTextNote(eg.GetRandomNpub(), "Tagged", nostr.Tags{{"t", "#Books"}})
+	note.NormalizedTags = nostr.Tags{{"t", "books"}}
+	helpers.AssertNoError(t, m.StoreEvent(note))
+
+	events, err := Collect(m.GetEvents(context.Background(), nostr.Filter{Tags: nostr.TagMap{"t": {"books"}}}))
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 1, len(events))
+	helpers.AssertStringEqual(t, "#Books", events[0].Tags[0][1])
+}
+
+func TestMemoryCacheProvenance(t *testing.T) {
+	m := NewMemory(config.CacheConfig{})
+	defer m.Close()
+
+	eg := models.NewEventGenerator()
+	note := eg.GenerateTextNote(eg.GetRandomNpub(), "Seen twice", nostr.Tags{})
+	note.AddProvenance(models.ProvenanceUpstream, "wss://relay.one", "")
+	helpers.AssertNoError(t, m.StoreEvent(note))
+
+	again := *note
+	again.Provenance = nil
+	again.AddProvenance(models.ProvenanceUpstream, "wss://relay.two", "")
+	again.TrustLabel = "owner-wot"
+	helpers.AssertNoError(t, m.StoreEvent(&again))
+
+	events, err := Collect(m.GetEvents(context.Background(), nostr.Filter{IDs: []string{note.ID}}))
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 2, len(events[0].Provenance))
+	helpers.AssertStringEqual(t, "wss://relay.two", events[0].Provenance[1].Detail)
+	helpers.AssertStringEqual(t, "owner-wot", events[0].TrustLabel)
+}
+
+func TestMemoryCacheReplaceableEvents(t *testing.T) {
+	m := NewMemory(config.CacheConfig{HistoryDepth: 2})
+	defer m.Close()
+
+	eg := models.NewEventGenerator()
+	npub := eg.GetRandomNpub()
+
+	var last *models.Event
+	for i := 0; i < 3; i++ {
+		tags := nostr.Tags{{"d", "article"}}
+		if i == 0 {
+			tags = append(tags, nostr.Tag{"t", "draft"})
+		}
+		last = eg.GenerateTextNote(npub, fmt.Sprintf("Revision %d", i), tags)
+		last.Kind = 30023
+		last.CreatedAt = nostr.Timestamp(1700000000 + i)
+		helpers.AssertNoError(t, m.StoreEvent(last))
+	}
+
+	events, err := Collect(m.GetEvents(context.Background(), nostr.Filter{Kinds: []int{30023}}))
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 1, len(events))
+	helpers.AssertStringEqual(t, last.ID, events[0].ID)
+
+	// Only the first revision was tagged; the latest doesn't match in its place
+	events, err = Collect(m.GetEvents(context.Background(), nostr.Filter{Tags: nostr.TagMap{"t": {"draft"}}}))
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 0, len(events))
+
+	history, err := m.GetReplaceableEventHistory(30023, npub, "article")
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 2, len(history))
+	helpers.AssertFloat64Equal(t, 3, history[0]["version"].(float64), 0)
+	helpers.AssertStringEqual(t, last.ID, history[0]["event_id"].(string))
+}
+
+func TestMemoryCacheReplaceableOrder(t *testing.T) {
+	m := NewMemory(config.CacheConfig{})
+	defer m.Close()
+
+	eg := models.NewEventGenerator()
+	npub := eg.GetRandomNpub()
+	version := func(kind int, at nostr.Timestamp, tags nostr.Tags) *models.Event {
+		event := eg.GenerateTextNote(npub, fmt.Sprintf("%d at %d", kind, at), tags)
+		event.Kind = kind
+		event.CreatedAt = at
+		return event
+	}
+
+	// A version older than the latest is dropped, whatever order they arrive in
+	newer := version(0, 1700000100, nil)
+	older := version(0, 1700000000, nil)
+	helpers.AssertNoError(t, m.StoreEvent(newer))
+	helpers.AssertNoError(t, m.StoreEvent(older))
+	events, err := Collect(m.GetEvents(context.Background(), nostr.Filter{IDs: []string{older.ID}}))
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 0, len(events))
+
+	// Kinds 0, 3 and 1xxxx ignore d tags; only addressable kinds are keyed by them
+	relays := version(10002, 1700000000, nostr.Tags{{"d", "a"}})
+	relaysAgain := version(10002, 1700000001, nostr.Tags{{"d", "b"}})
+	articleA := version(30023, 1700000000, nostr.Tags{{"d", "a"}})
+	articleB := version(30023, 1700000000, nostr.Tags{{"d", "b"}})
+	for _, event := range []*models.Event{relays, relaysAgain, articleA, articleB} {
+		helpers.AssertNoError(t, m.StoreEvent(event))
+	}
+	events, err = Collect(m.GetEvents(context.Background(), nostr.Filter{Kinds: []int{0, 10002, 30023}}))
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 4, len(events))
+	ids := make([]string, len(events))
+	for i, event := range events {
+		ids[i] = event.ID
+	}
+	helpers.AssertContains(t, ids, newer.ID)
+	helpers.AssertContains(t, ids, relaysAgain.ID)
+
+	// The first version is kept whatever its timestamp
+	contacts := version(3, 0, nil)
+	helpers.AssertNoError(t, m.StoreEvent(contacts))
+	latest, err := m.GetLatestReplaceableEvent(3, npub, "")
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, contacts.ID, latest.ID)
+
+	// Other kinds are never replaced
+	for i := 0; i < 2; i++ {
+		helpers.AssertNoError(t, m.StoreEvent(version(7, nostr.Timestamp(1700000000+i), nil)))
+	}
+	events, err = Collect(m.GetEvents(context.Background(), nostr.Filter{Kinds: []int{7}}))
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 2, len(events))
+}
+
+func TestMemoryCacheBounds(t *testing.T) {
+	t.Run("Evicts oldest events when full", func(t *testing.T) {
+		m := NewMemory(config.CacheConfig{MaxEvents: 3, Shards: 1})
+		defer m.Close()
+
+		eg := models.NewEventGenerator()
+		var notes []*models.Event
+		for i := 0; i < 5; i++ {
+			note := eg.GenerateTextNote(eg.GetRandomNpub(), fmt.Sprintf("Note %d", i), nostr.Tags{})
+			notes = append(notes, note)
+			helpers.AssertNoError(t, m.StoreEvent(note))
+		}
+
+		events, err := Collect(m.GetEvents(context.Background(), nostr.Filter{IDs: []string{notes[0].ID, notes[1].ID, notes[4].ID}}))
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, 1, len(events))
+		helpers.AssertStringEqual(t, notes[4].ID, events[0].ID)
+
+		stats, err := m.GetStats()
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, 3, stats["total_events"].(int))
+		helpers.AssertInt64Equal(t, 2, stats["evicted_events"].(int64))
+	})
+
+	t.Run("Expires events after TTL", func(t *testing.T) {
+		m := NewMemory(config.CacheConfig{TTL: time.Hour})
+		defer m.Close()
+
+		eg := models.NewEventGenerator()
+		note := eg.GenerateTextNote(eg.GetRandomNpub(), "Short lived", nostr.Tags{})
+		helpers.AssertNoError(t, m.StoreEvent(note))
+
+		m.sweep(time.Now().Add(30 * time.Minute))
+		events, _ := Collect(m.GetEvents(context.Background(), nostr.Filter{IDs: []string{note.ID}}))
+		helpers.AssertIntEqual(t, 1, len(events))
+
+		m.sweep(time.Now().Add(time.Hour + time.Minute))
+		stats, _ := m.GetStats()
+		helpers.AssertIntEqual(t, 0, stats["total_events"].(int))
+		helpers.AssertInt64Equal(t, 1, stats["expired_events"].(int64))
+	})
+
+	t.Run("Keeps mirrored events", func(t *testing.T) {
+		m := NewMemory(config.CacheConfig{MaxEvents: 2, Shards: 1, TTL: time.Hour})
+		defer m.Close()
+
+		eg := models.NewEventGenerator()
+		mirrored := eg.GenerateTextNote(eg.GetRandomNpub(), "Mirrored", nostr.Tags{})
+		mirrored.Mirrored = true
+		helpers.AssertNoError(t, m.StoreEvent(mirrored))
+
+		// Cached before its author was mirrored, then seen again mirrored
+		upgraded := eg.GenerateTextNote(eg.GetRandomNpub(), "Upgraded", nostr.Tags{})
+		upgraded.IsQuarantined = true
+		upgraded.QuarantineReason = "Low quality score"
+		helpers.AssertNoError(t, m.StoreEvent(upgraded))
+		again := *upgraded
+		again.Mirrored = true
+		again.IsQuarantined = false
+		helpers.AssertNoError(t, m.StoreEvent(&again))
+
+		for i := 0; i < 5; i++ {
+			note := eg.GenerateTextNote(eg.GetRandomNpub(), fmt.Sprintf("Note %d", i), nostr.Tags{})
+			helpers.AssertNoError(t, m.StoreEvent(note))
+		}
+		m.sweep(time.Now().Add(2 * time.Hour))
+
+		events, err := Collect(m.GetEvents(context.Background(), nostr.Filter{IDs: []string{mirrored.ID, upgraded.ID}}))
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, 2, len(events))
+		for _, event := range events {
+			helpers.AssertTrue(t, event.Mirrored)
+			helpers.AssertFalse(t, event.IsQuarantined)
+		}
+	})
+}
+
+func TestMemoryCacheQueryCancellation(t *testing.T) {
+	m := NewMemory(config.CacheConfig{Shards: 4})
+	defer m.Close()
+
+	eg := models.NewEventGenerator()
+	for i := 0; i < 20000; i++ {
+		m.StoreEvent(eg.GenerateTextNote(eg.GetRandomNpub(), fmt.Sprintf("Note %d", i), nostr.Tags{}))
+	}
+
+	t.Run("Cancelled queries abort", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		start := time.Now()
+		events, err := Collect(m.GetEvents(ctx, nostr.Filter{Kinds: []int{1}}))
+		helpers.AssertTrue(t, errors.Is(err, context.Canceled))
+		helpers.AssertIntEqual(t, 0, len(events))
+		helpers.AssertTrue(t, time.Since(start) < time.Second)
+	})
+
+	t.Run("Expired deadlines abort", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Nanosecond)
+		defer cancel()
+		time.Sleep(time.Millisecond)
+
+		_, err := Collect(m.GetEvents(ctx, nostr.Filter{}))
+		helpers.AssertTrue(t, errors.Is(err, context.DeadlineExceeded))
+	})
+
+	t.Run("Consumers can stop early", func(t *testing.T) {
+		seen := 0
+		for _, err := range m.GetEvents(context.Background(), nostr.Filter{Limit: 500}) {
+			helpers.AssertNoError(t, err)
+			seen++
+			if seen == 10 {
+				break
+			}
+		}
+		helpers.AssertIntEqual(t, 10, seen)
+	})
+
+	t.Run("Queries are lazy", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		events := m.GetEvents(ctx, nostr.Filter{Limit: 5})
+		cancel()
+
+		_, err := Collect(events)
+		helpers.AssertTrue(t, errors.Is(err, context.Canceled))
+	})
+}
+
+func TestNewCacheBackend(t *testing.T) {
+	c, err := New(config.CacheConfig{Backend: "memory"}, config.RedisConfig{})
+	helpers.AssertNoError(t, err)
+	defer c.Close()
+
+	stats, err := c.GetStats()
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, "memory", stats["backend"].(string))
+
+	_, err = New(config.CacheConfig{Backend: "memcached"}, config.RedisConfig{})
+	helpers.AssertError(t, err)
+}
+
+// benchmarkCaches returns the backends to compare. Redis is included when
+// REDIS_HOST points at a reachable server.
+func benchmarkCaches(b *testing.B) map[string]Cache {
+	caches := map[string]Cache{
+		"memory": NewMemory(config.CacheConfig{MaxEvents: 1000000, TTL: time.Hour}),
+	}
+	if host := os.Getenv("REDIS_HOST"); host != "" {
+		if redis, err := NewRedis(config.RedisConfig{Host: host, TTL: time.Hour}); err == nil {
+			caches["redis"] = redis
+		} else {
+			b.Logf("skipping redis: %v", err)
+		}
+	}
+	return caches
+}
+
+func BenchmarkCacheStoreEvent(b *testing.B) {
+	eg := models.NewEventGenerator()
+	events := make([]*models.Event, 10000)
+	for i := range events {
+		events[i] = eg.GenerateTextNote(eg.GetRandomNpub(), fmt.Sprintf("Benchmark %d", i), nostr.Tags{})
+	}
+
+	for name, c := range benchmarkCaches(b) {
+		defer c.Close()
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				c.StoreEvent(events[i%len(events)])
+			}
+		})
+	}
+}
+
+func BenchmarkCacheGetEvents(b *testing.B) {
+	eg := models.NewEventGenerator()
+	authors := []string{eg.GetRandomNpub(), eg.GetRandomNpub(), eg.GetRandomNpub()}
+
+	for name, c := range benchmarkCaches(b) {
+		defer c.Close()
+		for i := 0; i < 3000; i++ {
+			c.StoreEvent(eg.GenerateTextNote(authors[i%len(authors)], fmt.Sprintf("Benchmark %d", i), nostr.Tags{}))
+		}
+
+		b.Run(name, func(b *testing.B) {
+			filter := nostr.Filter{Authors: authors[:1], Limit: 50}
+			for i := 0; i < b.N; i++ {
+				Collect(c.GetEvents(context.Background(), filter))
+			}
+		})
+	}
+}
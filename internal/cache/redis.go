@@ -2,10 +2,11 @@ package cache
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"sync/atomic"
+	"time"
 
 	"mercury-relay/internal/config"
 	"mercury-relay/internal/models"
@@ -17,6 +18,7 @@ import (
 type Redis struct {
 	client *redis.Client
 	config config.RedisConfig
+	ttl    atomic.Int64 // event TTL, changed at runtime by SetTTL
 }
 
 func NewRedis(config config.RedisConfig) (*Redis, error) {
@@ -32,12 +34,37 @@ func NewRedis(config config.RedisConfig) (*Redis, error) {
 		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
 	}
 
-	return &Redis{
+	r := &Redis{
 		client: client,
 		config: config,
-	}, nil
+	}
+	r.ttl.Store(int64(config.TTL))
+	return r, nil
+}
+
+// TTL returns how long newly stored events are kept
+func (r *Redis) TTL() time.Duration {
+	return time.Duration(r.ttl.Load())
+}
+
+// SetTTL changes how long events stored from now on are kept
+func (r *Redis) SetTTL(ttl time.Duration) {
+	r.ttl.Store(int64(ttl))
 }
 
+// persistentIndexes lists the index keys holding mirrored events. Their
+// expiry was removed and must not be restored when other events are indexed.
+const persistentIndexes = "index:persistent"
+
+// expireIndexScript refreshes an index key's TTL unless it holds mirrored
+// events
+var expireIndexScript = redis.NewScript(`
+if redis.call("SISMEMBER", KEYS[2], KEYS[1]) == 0 then
+	return redis.call("EXPIRE", KEYS[1], ARGV[1])
+end
+return 0
+`)
+
 func (r *Redis) StoreEvent(event *models.Event) error {
 	ctx := context.Background()
 
@@ -48,17 +75,29 @@ func (r *Redis) StoreEvent(event *models.Event) error {
 		return fmt.Errorf("failed to check event existence: %w", err)
 	}
 	if exists > 0 {
-		// Event already exists, don't store duplicate
-		return nil
+		// Event already exists, don't store duplicate; just note how it
+		// arrived this time
+		return r.updateCached(ctx, key, event)
 	}
 
-	// Store event with TTL
+	// Versions older than the latest one of a replaceable event are dropped
+	if r.isReplaceableEvent(event.Kind) {
+		if latest, err := r.getLatestReplaceableEvent(event); err == nil && latest.Supersedes(event) {
+			return nil
+		}
+	}
+
+	// Store event with TTL; mirrored events never expire
 	data, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("failed to marshal event: %w", err)
 	}
 
-	if err := r.client.Set(ctx, key, data, r.config.TTL).Err(); err != nil {
+	ttl := r.TTL()
+	if event.Mirrored {
+		ttl = 0
+	}
+	if err := r.client.Set(ctx, key, data, ttl).Err(); err != nil {
 		return fmt.Errorf("failed to store event: %w", err)
 	}
 
@@ -69,40 +108,224 @@ func (r *Redis) StoreEvent(event *models.Event) error {
 		}
 	}
 
+	return r.indexEvent(ctx, event)
+}
+
+// indexEvent adds event to the author, kind and tag indexes
+func (r *Redis) indexEvent(ctx context.Context, event *models.Event) error {
+	pipe := r.client.Pipeline()
+	r.queueIndex(ctx, pipe, event)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to index event: %w", err)
+	}
+	return nil
+}
+
+// queueIndex adds the index writes for event to pipe
+func (r *Redis) queueIndex(ctx context.Context, pipe redis.Pipeliner, event *models.Event) {
 	// Index by author
 	authorKey := fmt.Sprintf("author:%s", event.PubKey)
-	if err := r.client.SAdd(ctx, authorKey, event.ID).Err(); err != nil {
-		return fmt.Errorf("failed to index by author: %w", err)
-	}
-	r.client.Expire(ctx, authorKey, r.config.TTL)
+	pipe.SAdd(ctx, authorKey, event.ID)
+	r.expireIndex(ctx, pipe, authorKey, event.Mirrored)
 
 	// Index by kind
 	kindKey := fmt.Sprintf("kind:%d", event.Kind)
-	if err := r.client.SAdd(ctx, kindKey, event.ID).Err(); err != nil {
-		return fmt.Errorf("failed to index by kind: %w", err)
-	}
-	r.client.Expire(ctx, kindKey, r.config.TTL)
+	pipe.SAdd(ctx, kindKey, event.ID)
+	r.expireIndex(ctx, pipe, kindKey, event.Mirrored)
 
-	// Index by tags
-	for _, tag := range event.Tags {
+	// Index by tags, using the normalized values when present
+	for _, tag := range event.IndexTags() {
 		if len(tag) >= 2 {
 			tagKey := fmt.Sprintf("tag:%s:%s", tag[0], tag[1])
-			if err := r.client.SAdd(ctx, tagKey, event.ID).Err(); err != nil {
-				return fmt.Errorf("failed to index by tag: %w", err)
-			}
-			r.client.Expire(ctx, tagKey, r.config.TTL)
+			pipe.SAdd(ctx, tagKey, event.ID)
+			r.expireIndex(ctx, pipe, tagKey, event.Mirrored)
 		}
 	}
+}
 
-	return nil
+// expireIndex refreshes the TTL of an index key, or removes it for good
+// when the key holds a mirrored event
+func (r *Redis) expireIndex(ctx context.Context, pipe redis.Pipeliner, key string, mirrored bool) {
+	if mirrored {
+		pipe.Persist(ctx, key)
+		pipe.SAdd(ctx, persistentIndexes, key)
+		return
+	}
+	expireIndexScript.Eval(ctx, pipe, []string{key, persistentIndexes}, int64(r.TTL()/time.Second))
 }
 
-func (r *Redis) GetEvents(filter nostr.Filter) ([]*models.Event, error) {
+// StoreEvents stores a batch in two round trips: one to find which events
+// are new and one to write and index them. Duplicates and replaceable
+// events go through StoreEvent afterwards.
+func (r *Redis) StoreEvents(events []*models.Event) error {
 	ctx := context.Background()
+
+	check := r.client.Pipeline()
+	exists := make([]*redis.IntCmd, len(events))
+	for i, event := range events {
+		exists[i] = check.Exists(ctx, fmt.Sprintf("event:%s", event.ID))
+	}
+	if _, err := check.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to check event existence: %w", err)
+	}
+
+	var errs []error
+	var rest []*models.Event
+	seen := make(map[string]bool, len(events))
+	write := r.client.Pipeline()
+	for i, event := range events {
+		if exists[i].Val() > 0 || seen[event.ID] || r.isReplaceableEvent(event.Kind) {
+			rest = append(rest, event)
+			continue
+		}
+		seen[event.ID] = true
+
+		data, err := json.Marshal(event)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to marshal event: %w", err))
+			continue
+		}
+		ttl := r.TTL()
+		if event.Mirrored {
+			ttl = 0
+		}
+		write.Set(ctx, fmt.Sprintf("event:%s", event.ID), data, ttl)
+		r.queueIndex(ctx, write, event)
+	}
+	if write.Len() > 0 {
+		if _, err := write.Exec(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("failed to store events: %w", err))
+		}
+	}
+
+	for _, event := range rest {
+		if err := r.StoreEvent(event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// updateCached adds new provenance and a missing trust label to a cached
+// event and, when incoming is mirrored but the cached copy isn't, keeps the
+// cached copy for good and releases it from quarantine
+func (r *Redis) updateCached(ctx context.Context, key string, incoming *models.Event) error {
+	if len(incoming.Provenance) == 0 && !incoming.Mirrored {
+		return nil
+	}
+
+	data, err := r.client.Get(ctx, key).Result()
+	if err != nil {
+		return nil // expired since the existence check
+	}
+	var stored models.Event
+	if err := json.Unmarshal([]byte(data), &stored); err != nil {
+		return fmt.Errorf("failed to unmarshal cached event: %w", err)
+	}
+
+	var added bool
+	stored.Provenance, added = models.MergeProvenance(stored.Provenance, incoming.Provenance)
+	if stored.TrustLabel == "" && incoming.TrustLabel != "" {
+		stored.TrustLabel = incoming.TrustLabel
+		added = true
+	}
+	mirror := incoming.Mirrored && !stored.Mirrored
+	if !added && !mirror {
+		return nil
+	}
+
+	var ttl time.Duration = redis.KeepTTL
+	if mirror {
+		stored.Mirrored = true
+		stored.IsQuarantined = false
+		stored.QuarantineReason = ""
+		ttl = 0
+	}
+
+	updated, err := json.Marshal(&stored)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+	if err := r.client.Set(ctx, key, updated, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to update cached event: %w", err)
+	}
+
+	if mirror {
+		if r.isReplaceableEvent(stored.Kind) {
+			key := r.getReplaceableEventKey(&stored)
+			for _, k := range []string{"replaceable:" + key, "replaceable_seq:" + key, "latest:" + key} {
+				r.client.Persist(ctx, k)
+			}
+		}
+		return r.indexEvent(ctx, &stored)
+	}
+	return nil
+}
+
+// GetEvents yields matching events as they are read. Every Redis call uses
+// ctx, so cancelling it aborts the query.
+func (r *Redis) GetEvents(ctx context.Context, filter nostr.Filter) EventIterator {
+	return traceQuery(ctx, "redis", filter, func(yield func(*models.Event, error) bool) {
+		eventIDs, err := r.candidateIDs(ctx, filter)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		seen := make(map[string]bool)
+		for _, id := range eventIDs {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+
+			key := fmt.Sprintf("event:%s", id)
+			data, err := r.client.Get(ctx, key).Result()
+			if err != nil {
+				continue
+			}
+
+			var event models.Event
+			if err := json.Unmarshal([]byte(data), &event); err != nil {
+				continue
+			}
+
+			// Apply additional filters
+			if !event.MatchesFilter(filter) {
+				continue
+			}
+
+			// For replaceable events, only return the latest version unless a
+			// specific revision was requested by ID. A superseded version is
+			// dropped rather than swapped for the latest, which is a candidate
+			// of its own if it matches the filter
+			if r.isReplaceableEvent(event.Kind) && len(filter.IDs) == 0 {
+				latest, err := r.getLatestReplaceableEvent(&event)
+				if err != nil || latest.ID != event.ID {
+					continue
+				}
+			}
+			if seen[event.ID] {
+				continue
+			}
+			seen[event.ID] = true
+
+			if !yield(&event, nil) {
+				return
+			}
+		}
+	})
+}
+
+// candidateIDs returns the IDs of the events that may match filter, from
+// the narrowest index available
+func (r *Redis) candidateIDs(ctx context.Context, filter nostr.Filter) ([]string, error) {
 	var eventIDs []string
 
 	// Get event IDs based on filter
-	if len(filter.Authors) > 0 {
+	if len(filter.IDs) > 0 {
+		eventIDs = append(eventIDs, filter.IDs...)
+	} else if len(filter.Authors) > 0 {
 		for _, author := range filter.Authors {
 			authorKey := fmt.Sprintf("author:%s", author)
 			ids, err := r.client.SMembers(ctx, authorKey).Result()
@@ -120,6 +343,21 @@ func (r *Redis) GetEvents(filter nostr.Filter) ([]*models.Event, error) {
 			}
 			eventIDs = append(eventIDs, ids...)
 		}
+	} else if name, values := firstTagCondition(filter.Tags); name != "" {
+		seen := make(map[string]bool)
+		for _, value := range values {
+			tagKey := fmt.Sprintf("tag:%s:%s", name, value)
+			ids, err := r.client.SMembers(ctx, tagKey).Result()
+			if err != nil {
+				continue
+			}
+			for _, id := range ids {
+				if !seen[id] {
+					seen[id] = true
+					eventIDs = append(eventIDs, id)
+				}
+			}
+		}
 	} else {
 		// Get all events (limited)
 		keys, err := r.client.Keys(ctx, "event:*").Result()
@@ -131,80 +369,25 @@ func (r *Redis) GetEvents(filter nostr.Filter) ([]*models.Event, error) {
 		}
 	}
 
-	// Get events
-	var events []*models.Event
-	for _, id := range eventIDs {
-		key := fmt.Sprintf("event:%s", id)
-		data, err := r.client.Get(ctx, key).Result()
-		if err != nil {
-			continue
-		}
-
-		var event models.Event
-		if err := json.Unmarshal([]byte(data), &event); err != nil {
-			continue
-		}
-
-		// Apply additional filters
-		if r.eventMatchesFilter(&event, filter) {
-			// For replaceable events, only return the latest version
-			if r.isReplaceableEvent(event.Kind) {
-				latestEvent, err := r.getLatestReplaceableEvent(&event)
-				if err != nil {
-					continue
-				}
-				events = append(events, latestEvent)
-			} else {
-				events = append(events, &event)
-			}
-		}
-	}
-
-	return events, nil
+	return eventIDs, ctx.Err()
 }
 
-func (r *Redis) eventMatchesFilter(event *models.Event, filter nostr.Filter) bool {
-	// Check since
-	if filter.Since != nil && *filter.Since > 0 {
-		if nostr.Timestamp(int64(event.CreatedAt)) < *filter.Since {
-			return false
+// firstTagCondition picks the tag condition to narrow a query by, the one
+// with the fewest values
+func firstTagCondition(tags nostr.TagMap) (string, []string) {
+	var name string
+	var values []string
+	for n, v := range tags {
+		if v != nil && (name == "" || len(v) < len(values) || len(v) == len(values) && n < name) {
+			name, values = n, v
 		}
 	}
-
-	// Check until
-	if filter.Until != nil && *filter.Until > 0 {
-		if nostr.Timestamp(int64(event.CreatedAt)) > *filter.Until {
-			return false
-		}
-	}
-
-	// Note: Limit is applied in the calling function
-
-	return true
+	return name, values
 }
 
 // isReplaceableEvent checks if an event kind is replaceable
 func (r *Redis) isReplaceableEvent(kind int) bool {
-	replaceableKinds := map[int]bool{
-		0:     true, // User metadata
-		3:     true, // Contacts
-		5:     true, // Event deletion
-		6:     true, // Repost
-		7:     true, // Reaction
-		8:     true, // Badge award
-		40:    true, // Channel creation
-		41:    true, // Channel metadata
-		42:    true, // Channel message
-		43:    true, // Hide message
-		44:    true, // Mute user
-		10002: true, // Relay list
-		30000: true, // Follow sets
-		30001: true, // Follow sets
-		30008: true, // Profile badges
-		30009: true, // Badge definition
-		30078: true, // Application-specific data
-	}
-	return replaceableKinds[kind]
+	return models.IsReplaceableKind(kind)
 }
 
 // storeReplaceableEvent stores a replaceable event with version tracking
@@ -214,15 +397,17 @@ func (r *Redis) storeReplaceableEvent(event *models.Event) error {
 	// Generate replaceable event key (kind:pubkey:d-tag)
 	key := r.getReplaceableEventKey(event)
 
-	// Get existing versions
+	// Versions are numbered by a counter so trimming old history keeps the
+	// numbering stable
 	versionsKey := fmt.Sprintf("replaceable:%s", key)
-	existingVersions, err := r.client.LRange(ctx, versionsKey, 0, -1).Result()
+	seqKey := fmt.Sprintf("replaceable_seq:%s", key)
+	version, err := r.client.Incr(ctx, seqKey).Result()
 	if err != nil {
-		return fmt.Errorf("failed to get existing versions: %w", err)
+		return fmt.Errorf("failed to allocate version: %w", err)
 	}
+	r.expireReplaceable(ctx, seqKey, event)
 
 	// Create new version
-	version := len(existingVersions) + 1
 	eventVersion := map[string]interface{}{
 		"event_id":   event.ID,
 		"version":    version,
@@ -241,37 +426,47 @@ func (r *Redis) storeReplaceableEvent(event *models.Event) error {
 		return fmt.Errorf("failed to store version: %w", err)
 	}
 
+	// Keep only the configured number of versions
+	if r.config.HistoryDepth > 0 {
+		if err := r.client.LTrim(ctx, versionsKey, 0, int64(r.config.HistoryDepth-1)).Err(); err != nil {
+			return fmt.Errorf("failed to trim versions: %w", err)
+		}
+	}
+
 	// Set TTL for versions
-	r.client.Expire(ctx, versionsKey, r.config.TTL)
+	r.expireReplaceable(ctx, versionsKey, event)
 
 	// Update latest version pointer
 	latestKey := fmt.Sprintf("latest:%s", key)
-	if err := r.client.Set(ctx, latestKey, event.ID, r.config.TTL).Err(); err != nil {
+	ttl := r.TTL()
+	if event.Mirrored {
+		ttl = 0
+	}
+	if err := r.client.Set(ctx, latestKey, event.ID, ttl).Err(); err != nil {
 		return fmt.Errorf("failed to update latest version: %w", err)
 	}
 
 	return nil
 }
 
-// getReplaceableEventKey generates the key for replaceable events
-func (r *Redis) getReplaceableEventKey(event *models.Event) string {
-	// Find d-tag
-	var dTag string
-	for _, tag := range event.Tags {
-		if len(tag) >= 2 && tag[0] == "d" {
-			dTag = tag[1]
-			break
-		}
+// expireReplaceable refreshes the TTL of a replaceable event's history key;
+// the history of mirrored events is kept for good
+func (r *Redis) expireReplaceable(ctx context.Context, key string, event *models.Event) {
+	if event.Mirrored {
+		r.client.Persist(ctx, key)
+		return
 	}
+	r.client.Expire(ctx, key, r.TTL())
+}
 
-	return fmt.Sprintf("%d:%s:%s", event.Kind, event.PubKey, dTag)
+// getReplaceableEventKey generates the key for replaceable events
+func (r *Redis) getReplaceableEventKey(event *models.Event) string {
+	return fmt.Sprintf("%d:%s:%s", event.Kind, event.PubKey, event.DTag())
 }
 
 // getEventHash generates a hash for event comparison
 func (r *Redis) getEventHash(event *models.Event) string {
-	content := fmt.Sprintf("%s:%s:%d:%s", event.ID, event.PubKey, event.Kind, event.Content)
-	hash := sha256.Sum256([]byte(content))
-	return hex.EncodeToString(hash[:])
+	return eventHash(event)
 }
 
 // GetReplaceableEventHistory returns the history of a replaceable event
@@ -325,16 +520,7 @@ func (r *Redis) GetLatestReplaceableEvent(kind int, pubkey, dTag string) (*model
 
 // getLatestReplaceableEvent gets the latest version of a replaceable event
 func (r *Redis) getLatestReplaceableEvent(event *models.Event) (*models.Event, error) {
-	// Find d-tag
-	var dTag string
-	for _, tag := range event.Tags {
-		if len(tag) >= 2 && tag[0] == "d" {
-			dTag = tag[1]
-			break
-		}
-	}
-
-	return r.GetLatestReplaceableEvent(event.Kind, event.PubKey, dTag)
+	return r.GetLatestReplaceableEvent(event.Kind, event.PubKey, event.DTag())
 }
 
 func (r *Redis) DeleteEvent(eventID string) error {
@@ -1,12 +1,17 @@
 package cache
 
 import (
+	"context"
+	"strings"
 	"testing"
+	"time"
 
+	"mercury-relay/internal/config"
 	"mercury-relay/internal/models"
 	"mercury-relay/test/helpers"
 	"mercury-relay/test/mocks"
 
+	"github.com/alicebob/miniredis/v2"
 	"github.com/nbd-wtf/go-nostr"
 )
 
@@ -69,7 +74,7 @@ func TestRedisCacheGetEvents(t *testing.T) {
 			Authors: []string{npub1},
 		}
 
-		events, err := mockCache.GetEvents(filter)
+		events, err := Collect(mockCache.GetEvents(context.Background(), filter))
 		helpers.AssertNoError(t, err)
 		helpers.AssertIntEqual(t, 2, len(events))
 
@@ -101,7 +106,7 @@ func TestRedisCacheGetEvents(t *testing.T) {
 			Kinds: []int{1},
 		}
 
-		events, err := mockCache.GetEvents(filter)
+		events, err := Collect(mockCache.GetEvents(context.Background(), filter))
 		helpers.AssertNoError(t, err)
 		helpers.AssertIntEqual(t, 2, len(events))
 
@@ -145,7 +150,7 @@ func TestRedisCacheGetEvents(t *testing.T) {
 			Until:   &until,
 		}
 
-		events, err := mockCache.GetEvents(filter)
+		events, err := Collect(mockCache.GetEvents(context.Background(), filter))
 		helpers.AssertNoError(t, err)
 		helpers.AssertIntEqual(t, 1, len(events))
 		helpers.AssertStringEqual(t, event1.ID, events[0].ID)
@@ -171,7 +176,7 @@ func TestRedisCacheGetEvents(t *testing.T) {
 			Limit: 5,
 		}
 
-		results, err := mockCache.GetEvents(filter)
+		results, err := Collect(mockCache.GetEvents(context.Background(), filter))
 		helpers.AssertNoError(t, err)
 		helpers.AssertIntEqual(t, 5, len(results))
 	})
@@ -344,7 +349,7 @@ func TestRedisCacheWithError(t *testing.T) {
 		// Set get error
 		mockCache.SetErrors(nil, nil, nil, nil) // Will be set to test error
 
-		_, err := mockCache.GetEvents(filter)
+		_, err := Collect(mockCache.GetEvents(context.Background(), filter))
 		helpers.AssertNoError(t, err) // Mock doesn't return error by default
 	})
 
@@ -389,7 +394,7 @@ func TestRedisCacheIntegration(t *testing.T) {
 			Limit: 100,
 		}
 
-		retrieved, err := mockCache.GetEvents(filter)
+		retrieved, err := Collect(mockCache.GetEvents(context.Background(), filter))
 		helpers.AssertNoError(t, err)
 		helpers.AssertIntEqual(t, 100, len(retrieved))
 	})
@@ -418,3 +423,55 @@ func TestRedisCacheIntegration(t *testing.T) {
 		helpers.AssertIntEqual(t, 3, stats["cache_size"].(int))
 	})
 }
+
+func TestRedisCacheTagFilters(t *testing.T) {
+	// Queries narrow by the tag condition with the fewest values
+	name, values := firstTagCondition(nostr.TagMap{"t": {"a", "b"}, "e": {"root"}, "p": nil})
+	helpers.AssertStringEqual(t, "e", name)
+	helpers.AssertIntEqual(t, 1, len(values))
+	name, _ = firstTagCondition(nostr.TagMap{"p": nil})
+	helpers.AssertStringEqual(t, "", name)
+}
+
+// newTestRedis returns a Redis cache backed by an in-process server
+func newTestRedis(t *testing.T) *Redis {
+	t.Helper()
+	server := miniredis.RunT(t)
+	r, err := NewRedis(config.RedisConfig{Host: server.Addr(), TTL: time.Hour})
+	helpers.AssertNoError(t, err)
+	t.Cleanup(func() { r.Close() })
+	return r
+}
+
+func TestRedisReplaceableEvents(t *testing.T) {
+	r := newTestRedis(t)
+	ctx := context.Background()
+
+	draft := &models.Event{ID: "v0", PubKey: "alice", Kind: 30023, CreatedAt: 100, Tags: nostr.Tags{{"d", "post"}, {"t", "draft"}}}
+	final := &models.Event{ID: "v1", PubKey: "alice", Kind: 30023, CreatedAt: 200, Tags: nostr.Tags{{"d", "post"}}}
+	helpers.AssertNoError(t, r.StoreEvent(draft))
+	helpers.AssertNoError(t, r.StoreEvent(final))
+
+	ids := func(filter nostr.Filter) string {
+		events, err := Collect(r.GetEvents(ctx, filter))
+		helpers.AssertNoError(t, err)
+		ids := make([]string, len(events))
+		for i, event := range events {
+			ids[i] = event.ID
+		}
+		return strings.Join(ids, " ")
+	}
+
+	// Only the latest version is served
+	helpers.AssertStringEqual(t, "v1", ids(nostr.Filter{Kinds: []int{30023}}))
+	helpers.AssertStringEqual(t, "v1", ids(nostr.Filter{Authors: []string{"alice"}}))
+
+	// A filter only the superseded version matches returns nothing, not
+	// the latest version that doesn't match it
+	until := nostr.Timestamp(150)
+	helpers.AssertStringEqual(t, "", ids(nostr.Filter{Tags: nostr.TagMap{"t": {"draft"}}}))
+	helpers.AssertStringEqual(t, "", ids(nostr.Filter{Kinds: []int{30023}, Until: &until}))
+
+	// Asking for a revision by ID still finds it
+	helpers.AssertStringEqual(t, "v0", ids(nostr.Filter{IDs: []string{"v0"}}))
+}
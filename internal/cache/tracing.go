@@ -0,0 +1,34 @@
+package cache
+
+import (
+	"context"
+
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/tracing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// traceQuery records a span for a query, from the first event asked for
+// until the caller stops iterating
+func traceQuery(ctx context.Context, backend string, filter nostr.Filter, events EventIterator) EventIterator {
+	if tracing.Default() == nil {
+		return events
+	}
+	return func(yield func(*models.Event, error) bool) {
+		_, span := tracing.Start(ctx, tracing.KindClient, "cache query", "cache.backend", backend, "filter", filter.String())
+		defer span.End()
+		count := 0
+		for event, err := range events {
+			if err != nil {
+				span.RecordError(err)
+			} else {
+				count++
+			}
+			if !yield(event, err) {
+				break
+			}
+		}
+		span.SetAttributes("events", count)
+	}
+}
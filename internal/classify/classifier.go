@@ -0,0 +1,242 @@
+package classify
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Undetermined is the ISO 639 code reported when no language can be detected
+const Undetermined = "und"
+
+// minStopwordHits is how many stopwords a text needs before a Latin-script
+// language is reported
+const minStopwordHits = 2
+
+// stopwords holds common function words for Latin-script languages
+var stopwords = map[string][]string{
+	"en": {"the", "and", "is", "are", "was", "of", "to", "in", "that", "it", "for", "with", "this", "you", "not", "have", "but", "what"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ich", "ein", "eine", "mit", "auf", "den", "sich", "auch", "wie", "zu", "von"},
+	"es": {"el", "la", "los", "las", "que", "y", "es", "en", "por", "una", "con", "para", "del", "pero", "muy", "como"},
+	"fr": {"le", "la", "les", "et", "est", "des", "une", "que", "pas", "pour", "dans", "avec", "sur", "qui", "je", "du"},
+	"pt": {"o", "os", "as", "que", "e", "não", "uma", "com", "para", "do", "da", "em", "mas", "muito", "você"},
+	"it": {"il", "lo", "gli", "che", "e", "è", "non", "una", "per", "con", "della", "sono", "ma", "anche", "come"},
+	"nl": {"de", "het", "een", "en", "is", "niet", "van", "dat", "op", "met", "voor", "ook", "maar", "zijn", "ik"},
+}
+
+// Classification is the language and topics detected for a piece of content
+type Classification struct {
+	Language string
+	Topics   []string
+}
+
+// Classifier detects the language of event content and matches it against
+// configured topic keywords
+type Classifier struct {
+	topics map[string][]string
+}
+
+// NewClassifier creates a classifier for the given topic -> keywords map.
+// Keywords are matched case-insensitively against whole words and hashtags.
+func NewClassifier(topics map[string][]string) *Classifier {
+	normalized := make(map[string][]string, len(topics))
+	for topic, keywords := range topics {
+		for _, keyword := range keywords {
+			keyword = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(keyword), "#"))
+			if keyword != "" {
+				normalized[topic] = append(normalized[topic], keyword)
+			}
+		}
+	}
+	return &Classifier{topics: normalized}
+}
+
+// Classify detects the language of content and the topics matched by content
+// or hashtags. Topics are returned sorted.
+func (c *Classifier) Classify(content string, hashtags []string) Classification {
+	words := tokenize(content)
+
+	seen := make(map[string]bool, len(words)+len(hashtags))
+	for _, word := range words {
+		seen[word] = true
+	}
+	for _, tag := range hashtags {
+		seen[strings.ToLower(strings.TrimPrefix(tag, "#"))] = true
+	}
+
+	var topics []string
+	for topic, keywords := range c.topics {
+		for _, keyword := range keywords {
+			if seen[keyword] || (strings.Contains(keyword, " ") && strings.Contains(strings.ToLower(content), keyword)) {
+				topics = append(topics, topic)
+				break
+			}
+		}
+	}
+	sort.Strings(topics)
+
+	return Classification{
+		Language: detectLanguage(content, words),
+		Topics:   topics,
+	}
+}
+
+// DetectLanguage returns the ISO 639-1 code for content, or Undetermined
+func DetectLanguage(content string) string {
+	return detectLanguage(content, tokenize(content))
+}
+
+// labelNamespace is the NIP-32 namespace for ISO 639-1 language labels
+const labelNamespace = "ISO-639-1"
+
+// EventLanguage returns the language recorded for event at ingest. Events
+// stored without one are labeled on the fly: a NIP-32
+// ["l", code, "ISO-639-1"] tag wins, else the language is detected from
+// content.
+func EventLanguage(event *models.Event) string {
+	if event.Language != "" {
+		return event.Language
+	}
+	return labeledLanguage(event.Tags, event.Content)
+}
+
+func labeledLanguage(tags nostr.Tags, content string) string {
+	for _, tag := range tags {
+		if len(tag) >= 3 && tag[0] == "l" && tag[2] == labelNamespace && tag[1] != "" {
+			return strings.ToLower(tag[1])
+		}
+	}
+	return DetectLanguage(content)
+}
+
+// MatchesLanguage reports whether lang is one of languages. Empty languages
+// match everything; Undetermined must be listed explicitly.
+func MatchesLanguage(lang string, languages []string) bool {
+	return Classification{Language: lang}.Matches(languages, nil)
+}
+
+func detectLanguage(content string, words []string) string {
+	if lang := detectScript(content); lang != "" {
+		return lang
+	}
+
+	best, bestHits := Undetermined, 0
+	for lang, list := range stopwords {
+		hits := 0
+		for _, word := range words {
+			for _, stop := range list {
+				if word == stop {
+					hits++
+					break
+				}
+			}
+		}
+		// Ties are broken alphabetically so results are stable
+		if hits > bestHits || (hits == bestHits && hits > 0 && lang < best) {
+			best, bestHits = lang, hits
+		}
+	}
+	if bestHits < minStopwordHits {
+		return Undetermined
+	}
+	return best
+}
+
+// detectScript identifies languages with a distinctive script when they make
+// up the majority of letters in content
+func detectScript(content string) string {
+	counts := make(map[string]int)
+	letters := 0
+	for _, r := range content {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		switch {
+		case unicode.Is(unicode.Hiragana, r), unicode.Is(unicode.Katakana, r):
+			counts["ja"]++
+		case unicode.Is(unicode.Hangul, r):
+			counts["ko"]++
+		case unicode.Is(unicode.Han, r):
+			counts["zh"]++
+		case unicode.Is(unicode.Cyrillic, r):
+			counts["ru"]++
+		case unicode.Is(unicode.Arabic, r):
+			counts["ar"]++
+		case unicode.Is(unicode.Greek, r):
+			counts["el"]++
+		case unicode.Is(unicode.Hebrew, r):
+			counts["he"]++
+		case unicode.Is(unicode.Thai, r):
+			counts["th"]++
+		}
+	}
+	if letters == 0 {
+		return ""
+	}
+
+	// Japanese mixes kana with Han characters
+	if counts["ja"] > 0 {
+		counts["ja"] += counts["zh"]
+		counts["zh"] = 0
+	}
+
+	for lang, n := range counts {
+		if n*2 > letters {
+			return lang
+		}
+	}
+	return ""
+}
+
+// tokenize lowercases content and splits it into words, skipping URLs and
+// nostr: references
+func tokenize(content string) []string {
+	var words []string
+	for _, field := range strings.Fields(strings.ToLower(content)) {
+		if strings.Contains(field, "://") || strings.HasPrefix(field, "nostr:") {
+			continue
+		}
+		word := strings.TrimFunc(field, func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+	return words
+}
+
+// Matches reports whether the classification satisfies an accept rule. Empty
+// lists accept everything; Undetermined must be listed explicitly to accept
+// content whose language could not be detected.
+func (c Classification) Matches(languages, topics []string) bool {
+	if len(languages) > 0 {
+		ok := false
+		for _, lang := range languages {
+			if strings.EqualFold(lang, c.Language) {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+
+	if len(topics) == 0 {
+		return true
+	}
+	for _, want := range topics {
+		for _, got := range c.Topics {
+			if want == got {
+				return true
+			}
+		}
+	}
+	return false
+}
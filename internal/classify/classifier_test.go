@@ -0,0 +1,83 @@
+package classify
+
+import (
+	"testing"
+
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		content  string
+		expected string
+	}{
+		{"The relay is running and this is what you wanted", "en"},
+		{"Ich weiß nicht, wie das auf dem Server läuft und ist", "de"},
+		{"Esto es muy bueno para los usuarios", "es"},
+		{"Привет, как дела?", "ru"},
+		{"今日はいい天気ですね", "ja"},
+		{"gm", Undetermined},
+		{"https://example.com/image.png", Undetermined},
+	}
+
+	for _, tt := range tests {
+		helpers.AssertStringEqual(t, tt.expected, DetectLanguage(tt.content))
+	}
+}
+
+func TestClassifyTopics(t *testing.T) {
+	c := NewClassifier(map[string][]string{
+		"bitcoin": {"#Bitcoin", "lightning", "sats"},
+		"books":   {"ebook", "reading list"},
+	})
+
+	result := c.Classify("Stacking sats and adding this to my reading list", nil)
+	helpers.AssertStringEqual(t, "en", result.Language)
+	helpers.AssertIntEqual(t, 2, len(result.Topics))
+	helpers.AssertStringEqual(t, "bitcoin", result.Topics[0])
+	helpers.AssertStringEqual(t, "books", result.Topics[1])
+
+	result = c.Classify("gm", []string{"bitcoin"})
+	helpers.AssertIntEqual(t, 1, len(result.Topics))
+	helpers.AssertStringEqual(t, "bitcoin", result.Topics[0])
+
+	result = c.Classify("lightningnetwork", nil)
+	helpers.AssertIntEqual(t, 0, len(result.Topics))
+}
+
+func TestClassificationMatches(t *testing.T) {
+	english := Classification{Language: "en", Topics: []string{"books"}}
+	unknown := Classification{Language: Undetermined}
+
+	helpers.AssertTrue(t, english.Matches(nil, nil))
+	helpers.AssertTrue(t, english.Matches([]string{"EN", "de"}, nil))
+	helpers.AssertFalse(t, english.Matches([]string{"de"}, nil))
+	helpers.AssertTrue(t, english.Matches(nil, []string{"bitcoin", "books"}))
+	helpers.AssertFalse(t, english.Matches([]string{"en"}, []string{"bitcoin"}))
+	helpers.AssertFalse(t, unknown.Matches([]string{"en"}, nil))
+	helpers.AssertTrue(t, unknown.Matches([]string{"en", Undetermined}, nil))
+}
+
+func TestEventLanguage(t *testing.T) {
+	german := "Ich weiß nicht, wie das auf dem Server läuft und ist"
+
+	helpers.AssertStringEqual(t, "de", EventLanguage(&models.Event{Content: german}))
+
+	// A NIP-32 label wins over detection
+	labeled := nostr.Tags{{"L", "ISO-639-1"}, {"l", "FR", "ISO-639-1"}}
+	helpers.AssertStringEqual(t, "fr", EventLanguage(&models.Event{Tags: labeled, Content: german}))
+
+	// Labels in other namespaces are ignored
+	other := nostr.Tags{{"l", "fr", "ugc"}}
+	helpers.AssertStringEqual(t, "de", EventLanguage(&models.Event{Tags: other, Content: german}))
+
+	// The language recorded at ingest is kept
+	helpers.AssertStringEqual(t, "it", EventLanguage(&models.Event{Language: "it", Content: german}))
+
+	helpers.AssertTrue(t, MatchesLanguage("de", nil))
+	helpers.AssertTrue(t, MatchesLanguage("de", []string{"en", "DE"}))
+	helpers.AssertFalse(t, MatchesLanguage(Undetermined, []string{"de"}))
+}
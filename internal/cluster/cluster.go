@@ -0,0 +1,238 @@
+// Package cluster coordinates relay instances that share storage. Every
+// instance heartbeats a membership record, and background jobs that must
+// not run twice (mirror backfill, archiving) run only on the instance that
+// holds the job's lease. A leader that stops renewing its lease, because it
+// exited or lost Redis, is replaced once the lease expires.
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/config"
+)
+
+// Member is an instance as seen by the others
+type Member struct {
+	ID        string    `json:"id"`
+	Host      string    `json:"host"`
+	Advertise string    `json:"advertise,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	// Leading lists the singleton jobs running on the instance
+	Leading []string `json:"leading,omitempty"`
+}
+
+// Store is the shared state instances coordinate through
+type Store interface {
+	// Acquire takes the lease on job for owner, or renews it if owner holds
+	// it, and reports whether owner holds it now
+	Acquire(ctx context.Context, job, owner string, ttl time.Duration) (bool, error)
+	// Release gives up owner's lease on job
+	Release(ctx context.Context, job, owner string) error
+	// Leaders returns the holder of every held lease
+	Leaders(ctx context.Context) (map[string]string, error)
+	// Heartbeat records member until ttl passes without another heartbeat
+	Heartbeat(ctx context.Context, member Member, ttl time.Duration) error
+	// Members returns the members whose heartbeat has not expired
+	Members(ctx context.Context) ([]Member, error)
+	// Leave removes member id
+	Leave(ctx context.Context, id string) error
+}
+
+// Node is this instance's view of the cluster
+type Node struct {
+	config config.ClusterConfig
+	store  Store
+	self   Member
+
+	mu      sync.Mutex
+	leading map[string]bool
+}
+
+// NewNode joins the cluster kept in store
+func NewNode(cfg config.ClusterConfig, store Store) *Node {
+	if cfg.LeaseTTL <= 0 {
+		cfg.LeaseTTL = 15 * time.Second
+	}
+	host, _ := os.Hostname()
+	id := cfg.InstanceID
+	if id == "" {
+		id = fmt.Sprintf("%s-%d", host, os.Getpid())
+	}
+	return &Node{
+		config: cfg,
+		store:  store,
+		self: Member{
+			ID:        id,
+			Host:      host,
+			Advertise: cfg.Advertise,
+			StartedAt: time.Now().UTC(),
+		},
+		leading: make(map[string]bool),
+	}
+}
+
+// ID returns this instance's ID
+func (n *Node) ID() string {
+	return n.self.ID
+}
+
+// renewInterval leaves two renewals before a lease or heartbeat expires
+func (n *Node) renewInterval() time.Duration {
+	return n.config.LeaseTTL / 3
+}
+
+// Run heartbeats this instance's membership until ctx is done, then leaves
+func (n *Node) Run(ctx context.Context) {
+	ticker := time.NewTicker(n.renewInterval())
+	defer ticker.Stop()
+	for {
+		if err := n.store.Heartbeat(ctx, n.member(), n.config.LeaseTTL); err != nil && ctx.Err() == nil {
+			log.Printf("Cluster heartbeat failed: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			leaveCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			if err := n.store.Leave(leaveCtx, n.self.ID); err != nil {
+				log.Printf("Failed to leave cluster: %v", err)
+			}
+			cancel()
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (n *Node) member() Member {
+	member := n.self
+	member.LastSeen = time.Now().UTC()
+	member.Leading = n.Leading()
+	return member
+}
+
+// Leading returns the jobs this instance is running, sorted
+func (n *Node) Leading() []string {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	jobs := make([]string, 0, len(n.leading))
+	for job := range n.leading {
+		jobs = append(jobs, job)
+	}
+	sort.Strings(jobs)
+	return jobs
+}
+
+func (n *Node) setLeading(job string, leading bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if leading {
+		n.leading[job] = true
+	} else {
+		delete(n.leading, job)
+	}
+}
+
+// RunSingleton runs job on whichever instance holds its lease. run gets a
+// context that is cancelled when this instance loses the lease; it is
+// started again if the lease comes back. RunSingleton returns once ctx is
+// done or run returns on its own.
+func (n *Node) RunSingleton(ctx context.Context, job string, run func(context.Context)) {
+	ticker := time.NewTicker(n.renewInterval())
+	defer ticker.Stop()
+
+	var (
+		cancel  context.CancelFunc
+		done    chan struct{}
+		expires time.Time // end of the lease as last renewed
+	)
+	stop := func() {
+		if cancel == nil {
+			return
+		}
+		cancel()
+		<-done
+		cancel = nil
+		n.setLeading(job, false)
+		log.Printf("Cluster: %s stopped running %s", n.self.ID, job)
+	}
+	defer func() {
+		stop()
+		releaseCtx, cancelRelease := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancelRelease()
+		if err := n.store.Release(releaseCtx, job, n.self.ID); err != nil {
+			log.Printf("Failed to release %s lease: %v", job, err)
+		}
+	}()
+
+	for {
+		attempt := time.Now()
+		held, err := n.store.Acquire(ctx, job, n.self.ID, n.config.LeaseTTL)
+		switch {
+		case err != nil:
+			if ctx.Err() != nil {
+				return
+			}
+			// Stop before the lease can expire and be taken by another
+			// instance: the next attempt may come too late
+			held = cancel != nil && time.Now().Add(n.renewInterval()).Before(expires)
+			log.Printf("Cluster: failed to renew %s lease: %v", job, err)
+		case held:
+			expires = attempt.Add(n.config.LeaseTTL)
+		}
+
+		switch {
+		case held && cancel == nil:
+			var jobCtx context.Context
+			jobCtx, cancel = context.WithCancel(ctx)
+			done = make(chan struct{})
+			n.setLeading(job, true)
+			log.Printf("Cluster: %s is running %s", n.self.ID, job)
+			go func(done chan struct{}) {
+				defer close(done)
+				run(jobCtx)
+			}(done)
+		case !held && cancel != nil:
+			stop()
+		}
+
+		var finished chan struct{}
+		if cancel != nil {
+			finished = done
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-finished:
+			// The job ended by itself
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Status is the cluster view reported in stats
+type Status struct {
+	Instance string            `json:"instance"`
+	Members  []Member          `json:"members"`
+	Leaders  map[string]string `json:"leaders"`
+}
+
+// Status returns the live members and the holder of every job lease
+func (n *Node) Status(ctx context.Context) (Status, error) {
+	members, err := n.store.Members(ctx)
+	if err != nil {
+		return Status{}, fmt.Errorf("failed to list cluster members: %w", err)
+	}
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+	leaders, err := n.store.Leaders(ctx)
+	if err != nil {
+		return Status{}, fmt.Errorf("failed to list job leaders: %w", err)
+	}
+	return Status{Instance: n.self.ID, Members: members, Leaders: leaders}, nil
+}
@@ -0,0 +1,171 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/test/helpers"
+)
+
+const testTTL = 90 * time.Millisecond
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// job counts how many instances run it at once
+type job struct {
+	running atomic.Int32
+	maxSeen atomic.Int32
+	runs    atomic.Int32
+}
+
+func (j *job) run(ctx context.Context) {
+	j.runs.Add(1)
+	if n := j.running.Add(1); n > j.maxSeen.Load() {
+		j.maxSeen.Store(n)
+	}
+	<-ctx.Done()
+	j.running.Add(-1)
+}
+
+func TestSingletonFailover(t *testing.T) {
+	store := NewMemoryStore()
+	a := NewNode(config.ClusterConfig{InstanceID: "a", LeaseTTL: testTTL}, store)
+	b := NewNode(config.ClusterConfig{InstanceID: "b", LeaseTTL: testTTL}, store)
+	j := &job{}
+
+	ctxA, stopA := context.WithCancel(context.Background())
+	ctxB, stopB := context.WithCancel(context.Background())
+	defer stopB()
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); a.RunSingleton(ctxA, "archive", j.run) }()
+	waitFor(t, func() bool { return j.running.Load() == 1 })
+	go func() { defer wg.Done(); b.RunSingleton(ctxB, "archive", j.run) }()
+
+	// Several renewals later only a is running it
+	time.Sleep(3 * testTTL)
+	helpers.AssertIntEqual(t, 1, int(j.maxSeen.Load()))
+	helpers.AssertIntEqual(t, 1, int(j.runs.Load()))
+	helpers.AssertEqual(t, "[archive]", fmt.Sprint(a.Leading()))
+	helpers.AssertEqual(t, "[]", fmt.Sprint(b.Leading()))
+
+	status, err := b.Status(context.Background())
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, "a", status.Leaders["archive"])
+
+	// a shuts down and releases the lease; b takes over
+	stopA()
+	waitFor(t, func() bool { return j.runs.Load() == 2 && j.running.Load() == 1 })
+	helpers.AssertEqual(t, "[archive]", fmt.Sprint(b.Leading()))
+	helpers.AssertIntEqual(t, 1, int(j.maxSeen.Load()))
+
+	stopB()
+	wg.Wait()
+	helpers.AssertIntEqual(t, 0, int(j.running.Load()))
+	leaders, _ := store.Leaders(context.Background())
+	helpers.AssertIntEqual(t, 0, len(leaders))
+}
+
+// flakyStore fails every call while down is set
+type flakyStore struct {
+	*MemoryStore
+	down atomic.Bool
+}
+
+func (f *flakyStore) Acquire(ctx context.Context, job, owner string, ttl time.Duration) (bool, error) {
+	if f.down.Load() {
+		return false, fmt.Errorf("connection refused")
+	}
+	return f.MemoryStore.Acquire(ctx, job, owner, ttl)
+}
+
+func TestLeaseLostWhenStoreUnreachable(t *testing.T) {
+	store := &flakyStore{MemoryStore: NewMemoryStore()}
+	node := NewNode(config.ClusterConfig{InstanceID: "a", LeaseTTL: testTTL}, store)
+	j := &job{}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go node.RunSingleton(ctx, "mirror", j.run)
+	waitFor(t, func() bool { return j.running.Load() == 1 })
+
+	// Without renewals the job stops before others could take the lease
+	store.down.Store(true)
+	lost := time.Now()
+	waitFor(t, func() bool { return j.running.Load() == 0 })
+	helpers.AssertTrue(t, time.Since(lost) < testTTL)
+
+	store.down.Store(false)
+	waitFor(t, func() bool { return j.running.Load() == 1 })
+	helpers.AssertIntEqual(t, 2, int(j.runs.Load()))
+}
+
+func TestJobEndingByItself(t *testing.T) {
+	store := NewMemoryStore()
+	node := NewNode(config.ClusterConfig{InstanceID: "a", LeaseTTL: testTTL}, store)
+
+	done := make(chan struct{})
+	go func() {
+		node.RunSingleton(context.Background(), "disabled", func(context.Context) {})
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("RunSingleton did not return")
+	}
+	leaders, _ := store.Leaders(context.Background())
+	helpers.AssertIntEqual(t, 0, len(leaders))
+}
+
+func TestMembership(t *testing.T) {
+	store := NewMemoryStore()
+	a := NewNode(config.ClusterConfig{InstanceID: "a", Advertise: "wss://a.example.com", LeaseTTL: testTTL}, store)
+	b := NewNode(config.ClusterConfig{InstanceID: "b", LeaseTTL: testTTL}, store)
+
+	ctxA, stopA := context.WithCancel(context.Background())
+	ctxB, stopB := context.WithCancel(context.Background())
+	defer stopB()
+	go a.Run(ctxA)
+	go b.Run(ctxB)
+
+	waitFor(t, func() bool {
+		status, _ := a.Status(context.Background())
+		return len(status.Members) == 2
+	})
+	status, err := a.Status(context.Background())
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, "a", status.Instance)
+	helpers.AssertStringEqual(t, "a", status.Members[0].ID)
+	helpers.AssertStringEqual(t, "wss://a.example.com", status.Members[0].Advertise)
+	helpers.AssertStringEqual(t, "b", status.Members[1].ID)
+
+	// Leaving is immediate
+	stopA()
+	waitFor(t, func() bool {
+		status, _ := b.Status(context.Background())
+		return len(status.Members) == 1
+	})
+
+	// A member that stops heartbeating expires
+	store.Heartbeat(context.Background(), Member{ID: "crashed", LastSeen: time.Now()}, testTTL)
+	members, _ := store.Members(context.Background())
+	helpers.AssertIntEqual(t, 2, len(members))
+	time.Sleep(testTTL + 10*time.Millisecond)
+	members, _ = store.Members(context.Background())
+	helpers.AssertIntEqual(t, 1, len(members))
+}
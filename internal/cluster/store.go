@@ -0,0 +1,214 @@
+package cluster
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	leaderPrefix = "mercury:cluster:leader:"
+	membersKey   = "mercury:cluster:members"
+)
+
+// RedisStore keeps leases as expiring keys and members in a hash
+type RedisStore struct {
+	client *redis.Client
+}
+
+// NewRedisStore connects to the Redis the instances share
+func NewRedisStore(cfg config.RedisConfig) (*RedisStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Host,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	return &RedisStore{client: client}, nil
+}
+
+// Take the lease if free, extend it if ours
+var acquireScript = redis.NewScript(`
+local holder = redis.call("GET", KEYS[1])
+if holder == false then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+if holder == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+func (r *RedisStore) Acquire(ctx context.Context, job, owner string, ttl time.Duration) (bool, error) {
+	held, err := acquireScript.Run(ctx, r.client, []string{leaderPrefix + job}, owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, fmt.Errorf("failed to acquire lease: %w", err)
+	}
+	return held == 1, nil
+}
+
+func (r *RedisStore) Release(ctx context.Context, job, owner string) error {
+	if err := releaseScript.Run(ctx, r.client, []string{leaderPrefix + job}, owner).Err(); err != nil {
+		return fmt.Errorf("failed to release lease: %w", err)
+	}
+	return nil
+}
+
+func (r *RedisStore) Leaders(ctx context.Context) (map[string]string, error) {
+	leaders := make(map[string]string)
+	iter := r.client.Scan(ctx, 0, leaderPrefix+"*", 100).Iterator()
+	for iter.Next(ctx) {
+		holder, err := r.client.Get(ctx, iter.Val()).Result()
+		if err == redis.Nil {
+			continue // expired while scanning
+		}
+		if err != nil {
+			return nil, err
+		}
+		leaders[strings.TrimPrefix(iter.Val(), leaderPrefix)] = holder
+	}
+	return leaders, iter.Err()
+}
+
+// Heartbeat stores member with the time it expires; expired members are
+// dropped by Members
+func (r *RedisStore) Heartbeat(ctx context.Context, member Member, ttl time.Duration) error {
+	data, err := json.Marshal(memberRecord{Member: member, Expires: member.LastSeen.Add(ttl)})
+	if err != nil {
+		return err
+	}
+	return r.client.HSet(ctx, membersKey, member.ID, data).Err()
+}
+
+func (r *RedisStore) Members(ctx context.Context) ([]Member, error) {
+	records, err := r.client.HGetAll(ctx, membersKey).Result()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	members := []Member{}
+	for id, data := range records {
+		var record memberRecord
+		if err := json.Unmarshal([]byte(data), &record); err != nil || now.After(record.Expires) {
+			r.client.HDel(ctx, membersKey, id)
+			continue
+		}
+		members = append(members, record.Member)
+	}
+	return members, nil
+}
+
+func (r *RedisStore) Leave(ctx context.Context, id string) error {
+	return r.client.HDel(ctx, membersKey, id).Err()
+}
+
+// Close closes the Redis connection
+func (r *RedisStore) Close() error {
+	return r.client.Close()
+}
+
+type memberRecord struct {
+	Member
+	Expires time.Time `json:"expires"`
+}
+
+// MemoryStore coordinates nodes within one process, for single instances
+// and tests
+type MemoryStore struct {
+	mu      sync.Mutex
+	leases  map[string]lease
+	members map[string]memberRecord
+}
+
+type lease struct {
+	owner   string
+	expires time.Time
+}
+
+// NewMemoryStore returns an empty in-process store
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		leases:  make(map[string]lease),
+		members: make(map[string]memberRecord),
+	}
+}
+
+func (m *MemoryStore) Acquire(ctx context.Context, job, owner string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	if l, ok := m.leases[job]; ok && l.owner != owner && now.Before(l.expires) {
+		return false, nil
+	}
+	m.leases[job] = lease{owner: owner, expires: now.Add(ttl)}
+	return true, nil
+}
+
+func (m *MemoryStore) Release(ctx context.Context, job, owner string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.leases[job].owner == owner {
+		delete(m.leases, job)
+	}
+	return nil
+}
+
+func (m *MemoryStore) Leaders(ctx context.Context) (map[string]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	leaders := make(map[string]string)
+	for job, l := range m.leases {
+		if now.Before(l.expires) {
+			leaders[job] = l.owner
+		}
+	}
+	return leaders, nil
+}
+
+func (m *MemoryStore) Heartbeat(ctx context.Context, member Member, ttl time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.members[member.ID] = memberRecord{Member: member, Expires: time.Now().Add(ttl)}
+	return nil
+}
+
+func (m *MemoryStore) Members(ctx context.Context) ([]Member, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	members := []Member{}
+	for id, record := range m.members {
+		if now.After(record.Expires) {
+			delete(m.members, id)
+			continue
+		}
+		members = append(members, record.Member)
+	}
+	return members, nil
+}
+
+func (m *MemoryStore) Leave(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.members, id)
+	return nil
+}
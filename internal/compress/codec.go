@@ -0,0 +1,285 @@
+package compress
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"mercury-relay/internal/config"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Content encodings recorded next to compressed content. Dictionary encodings
+// carry the dictionary ID, e.g. "zstd-dict:3f2a9c01".
+const (
+	EncodingZstd     = "zstd"
+	EncodingZstdDict = "zstd-dict"
+)
+
+var (
+	ErrUnknownEncoding   = fmt.Errorf("unknown content encoding")
+	ErrUnknownDictionary = fmt.Errorf("unknown compression dictionary")
+)
+
+// KindStats measures the storage savings for one event kind
+type KindStats struct {
+	Events      int64 `json:"events"`
+	Compressed  int64 `json:"compressed"`
+	RawBytes    int64 `json:"raw_bytes"`
+	StoredBytes int64 `json:"stored_bytes"`
+}
+
+// Codec compresses event content for storage. It starts without a
+// dictionary, collects samples of the configured kinds and trains one once
+// enough have been seen; the dictionary is saved so stored content stays
+// readable across restarts.
+type Codec struct {
+	config config.CompressionConfig
+	kinds  map[int]bool
+
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+
+	dictionary  []byte
+	dictID      string
+	dictEncoder *zstd.Encoder
+	dictDecoder *zstd.Decoder
+	samples     []string
+
+	stats map[int]*KindStats
+	mu    sync.RWMutex
+}
+
+// NewCodec creates a codec, loading the dictionary at cfg.DictionaryPath if
+// one was trained before
+func NewCodec(cfg config.CompressionConfig) (*Codec, error) {
+	c := &Codec{
+		config: cfg,
+		kinds:  make(map[int]bool),
+		stats:  make(map[int]*KindStats),
+	}
+	for _, kind := range cfg.Kinds {
+		c.kinds[kind] = true
+	}
+
+	var err error
+	if c.encoder, err = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBetterCompression)); err != nil {
+		return nil, fmt.Errorf("failed to create compressor: %w", err)
+	}
+	if c.decoder, err = zstd.NewReader(nil); err != nil {
+		return nil, fmt.Errorf("failed to create decompressor: %w", err)
+	}
+
+	if cfg.DictionaryPath != "" {
+		dictionary, err := os.ReadFile(cfg.DictionaryPath)
+		switch {
+		case err == nil:
+			if err := c.setDictionary(dictionary); err != nil {
+				return nil, fmt.Errorf("failed to load compression dictionary: %w", err)
+			}
+		case !os.IsNotExist(err):
+			return nil, fmt.Errorf("failed to load compression dictionary: %w", err)
+		}
+	}
+
+	return c, nil
+}
+
+// Enabled reports whether content of kind is compressed
+func (c *Codec) Enabled(kind int) bool {
+	return c.config.Enabled && c.kinds[kind]
+}
+
+// Encode compresses content of an event of kind. It returns the stored form
+// and its encoding, or content unchanged and an empty encoding when the kind
+// isn't compressed or compression doesn't save space.
+func (c *Codec) Encode(kind int, content string) (string, string) {
+	if !c.Enabled(kind) {
+		return content, ""
+	}
+
+	c.sample(content)
+
+	stored, encoding := content, ""
+	if len(content) >= c.config.MinSize {
+		c.mu.RLock()
+		encoder, name := c.encoder, EncodingZstd
+		if c.dictEncoder != nil {
+			encoder, name = c.dictEncoder, EncodingZstdDict+":"+c.dictID
+		}
+		c.mu.RUnlock()
+
+		compressed := encoder.EncodeAll([]byte(content), nil)
+		if encoded := base64.StdEncoding.EncodeToString(compressed); len(encoded) < len(content) {
+			stored, encoding = encoded, name
+		}
+	}
+
+	c.mu.Lock()
+	s := c.kindStats(kind)
+	s.Events++
+	s.RawBytes += int64(len(content))
+	s.StoredBytes += int64(len(stored))
+	if encoding != "" {
+		s.Compressed++
+	}
+	c.mu.Unlock()
+
+	return stored, encoding
+}
+
+// Decode reverses Encode. Content with an empty encoding is returned as is.
+func (c *Codec) Decode(encoding, stored string) (string, error) {
+	if encoding == "" {
+		return stored, nil
+	}
+
+	var decoder *zstd.Decoder
+	name, dictID, _ := strings.Cut(encoding, ":")
+	switch name {
+	case EncodingZstd:
+		decoder = c.decoder
+	case EncodingZstdDict:
+		c.mu.RLock()
+		if dictID == c.dictID {
+			decoder = c.dictDecoder
+		}
+		c.mu.RUnlock()
+		if decoder == nil {
+			return "", fmt.Errorf("%w: %s", ErrUnknownDictionary, dictID)
+		}
+	default:
+		return "", fmt.Errorf("%w: %s", ErrUnknownEncoding, encoding)
+	}
+
+	compressed, err := base64.StdEncoding.DecodeString(stored)
+	if err != nil {
+		return "", fmt.Errorf("failed to decode compressed content: %w", err)
+	}
+	content, err := decoder.DecodeAll(compressed, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to decompress content: %w", err)
+	}
+	return string(content), nil
+}
+
+// GetStats returns per-kind savings and the dictionary state
+func (c *Codec) GetStats() map[string]interface{} {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	kinds := make(map[int]KindStats, len(c.stats))
+	var raw, stored int64
+	for kind, s := range c.stats {
+		kinds[kind] = *s
+		raw += s.RawBytes
+		stored += s.StoredBytes
+	}
+
+	saved := 0.0
+	if raw > 0 {
+		saved = float64(raw-stored) / float64(raw)
+	}
+
+	return map[string]interface{}{
+		"enabled":          c.config.Enabled,
+		"kinds":            kinds,
+		"raw_bytes":        raw,
+		"stored_bytes":     stored,
+		"savings_ratio":    saved,
+		"dictionary_id":    c.dictID,
+		"dictionary_bytes": len(c.dictionary),
+		"training_samples": len(c.samples),
+	}
+}
+
+func (c *Codec) kindStats(kind int) *KindStats {
+	s, ok := c.stats[kind]
+	if !ok {
+		s = &KindStats{}
+		c.stats[kind] = s
+	}
+	return s
+}
+
+// sample collects training content until the dictionary is trained
+func (c *Codec) sample(content string) {
+	c.mu.Lock()
+	if c.dictionary != nil || c.config.TrainingSamples <= 0 {
+		c.mu.Unlock()
+		return
+	}
+	c.samples = append(c.samples, content)
+	if len(c.samples) < c.config.TrainingSamples {
+		c.mu.Unlock()
+		return
+	}
+	samples := c.samples
+	c.samples = nil
+	c.mu.Unlock()
+
+	dictionary := TrainDictionary(samples, c.config.DictionarySize)
+	if len(dictionary) == 0 {
+		return
+	}
+
+	// Content compressed with an unsaved dictionary couldn't be read after a
+	// restart, so only switch once it is on disk
+	if c.config.DictionaryPath != "" {
+		if err := saveDictionary(c.config.DictionaryPath, dictionary); err != nil {
+			log.Printf("Failed to save compression dictionary: %v", err)
+			return
+		}
+	}
+
+	c.mu.Lock()
+	err := c.setDictionary(dictionary)
+	dictID := c.dictID
+	c.mu.Unlock()
+	if err != nil {
+		log.Printf("Failed to use compression dictionary: %v", err)
+		return
+	}
+	log.Printf("Trained %d byte compression dictionary %s from %d samples", len(dictionary), dictID, len(samples))
+}
+
+// setDictionary switches compression to dictionary. Its ID is written into
+// each zstd frame as well as the encoding, so the frames stay self-describing.
+func (c *Codec) setDictionary(dictionary []byte) error {
+	sum := sha256.Sum256(dictionary)
+	id := binary.BigEndian.Uint32(sum[:4])
+
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBetterCompression), zstd.WithEncoderDictRaw(id, dictionary))
+	if err != nil {
+		return err
+	}
+	decoder, err := zstd.NewReader(nil, zstd.WithDecoderDictRaw(id, dictionary))
+	if err != nil {
+		return err
+	}
+
+	c.dictionary = dictionary
+	c.dictID = hex.EncodeToString(sum[:4])
+	c.dictEncoder = encoder
+	c.dictDecoder = decoder
+	return nil
+}
+
+func saveDictionary(path string, dictionary []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, dictionary, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,134 @@
+package compress
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/test/helpers"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// chapter returns book-like content that shares boilerplate across samples
+func chapter(i int) string {
+	return fmt.Sprintf("= Chapter %d\n\nThe relay keeps every section of the publication in order. ", i) +
+		strings.Repeat(fmt.Sprintf("Paragraph %d of the chapter describes the journey of the messenger across the mountains. ", i), 6)
+}
+
+func testConfig(t *testing.T) config.CompressionConfig {
+	return config.CompressionConfig{
+		Enabled:         true,
+		Kinds:           []int{30041},
+		MinSize:         64,
+		DictionaryPath:  filepath.Join(t.TempDir(), "compression.dict"),
+		DictionarySize:  4096,
+		TrainingSamples: 20,
+	}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	codec, err := NewCodec(testConfig(t))
+	helpers.AssertNoError(t, err)
+
+	content := chapter(1)
+	stored, encoding := codec.Encode(30041, content)
+	helpers.AssertStringEqual(t, EncodingZstd, encoding)
+	helpers.AssertTrue(t, len(stored) < len(content))
+
+	decoded, err := codec.Decode(encoding, stored)
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, content, decoded)
+
+	t.Run("Kinds not listed are stored as is", func(t *testing.T) {
+		stored, encoding := codec.Encode(1, content)
+		helpers.AssertStringEqual(t, "", encoding)
+		helpers.AssertStringEqual(t, content, stored)
+	})
+
+	t.Run("Short content is stored as is", func(t *testing.T) {
+		_, encoding := codec.Encode(30041, "short")
+		helpers.AssertStringEqual(t, "", encoding)
+	})
+
+	t.Run("Unknown encodings are rejected", func(t *testing.T) {
+		_, err := codec.Decode("brotli", stored)
+		helpers.AssertError(t, err)
+		_, err = codec.Decode(EncodingZstdDict+":00000000", stored)
+		helpers.AssertError(t, err)
+	})
+}
+
+func TestCodecDictionaryTraining(t *testing.T) {
+	cfg := testConfig(t)
+	codec, err := NewCodec(cfg)
+	helpers.AssertNoError(t, err)
+
+	for i := 0; i < cfg.TrainingSamples; i++ {
+		codec.Encode(30041, chapter(i))
+	}
+
+	stats := codec.GetStats()
+	helpers.AssertTrue(t, stats["dictionary_id"].(string) != "")
+	_, err = os.Stat(cfg.DictionaryPath)
+	helpers.AssertNoError(t, err)
+
+	content := chapter(100)
+	stored, encoding := codec.Encode(30041, content)
+	helpers.AssertTrue(t, strings.HasPrefix(encoding, EncodingZstdDict+":"))
+
+	// The dictionary beats plain zstd on content like its samples
+	plain := codec.encoder.EncodeAll([]byte(content), nil)
+	withDict := codec.dictEncoder.EncodeAll([]byte(content), nil)
+	helpers.AssertTrue(t, len(withDict) < len(plain))
+
+	// Each frame names its dictionary
+	frame, err := base64.StdEncoding.DecodeString(stored)
+	helpers.AssertNoError(t, err)
+	var header zstd.Header
+	helpers.AssertNoError(t, header.Decode(frame))
+	helpers.AssertStringEqual(t, encoding, fmt.Sprintf("%s:%08x", EncodingZstdDict, header.DictionaryID))
+
+	// A restarted codec loads the saved dictionary and reads old content
+	restarted, err := NewCodec(cfg)
+	helpers.AssertNoError(t, err)
+	decoded, err := restarted.Decode(encoding, stored)
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, content, decoded)
+
+	stats = restarted.GetStats()
+	helpers.AssertIntEqual(t, 0, len(stats["kinds"].(map[int]KindStats)))
+}
+
+func TestCodecStats(t *testing.T) {
+	codec, err := NewCodec(testConfig(t))
+	helpers.AssertNoError(t, err)
+
+	codec.Encode(30041, chapter(1))
+	codec.Encode(30041, "short")
+
+	stats := codec.GetStats()
+	kind := stats["kinds"].(map[int]KindStats)[30041]
+	helpers.AssertInt64Equal(t, 2, kind.Events)
+	helpers.AssertInt64Equal(t, 1, kind.Compressed)
+	helpers.AssertTrue(t, kind.StoredBytes < kind.RawBytes)
+	helpers.AssertTrue(t, stats["savings_ratio"].(float64) > 0.5)
+}
+
+func TestTrainDictionary(t *testing.T) {
+	var samples []string
+	for i := 0; i < 10; i++ {
+		samples = append(samples, chapter(i))
+	}
+
+	dictionary := TrainDictionary(samples, 512)
+	helpers.AssertTrue(t, len(dictionary) > 0)
+	helpers.AssertTrue(t, len(dictionary) <= 512)
+	helpers.AssertTrue(t, strings.Contains(string(dictionary), "messenger"))
+
+	helpers.AssertIntEqual(t, 0, len(TrainDictionary(nil, 512)))
+}
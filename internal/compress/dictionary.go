@@ -0,0 +1,95 @@
+package compress
+
+import (
+	"sort"
+	"strings"
+)
+
+const (
+	// gramSize is the substring length counted across samples
+	gramSize = 8
+	// segmentSize is the length of the sample pieces a dictionary is built from
+	segmentSize = 64
+	// maxDictionarySize is the size zstd's own trainer defaults to; larger
+	// dictionaries cost memory without helping short content further
+	maxDictionarySize = 110 * 1024
+)
+
+// TrainDictionary builds a preset dictionary of up to size bytes from
+// samples. Sample segments are scored by how many other samples share their
+// substrings, greedily picked so no substring is covered twice, and laid out
+// with the most useful segments last, where back-references are cheapest.
+func TrainDictionary(samples []string, size int) []byte {
+	if size <= 0 || size > maxDictionarySize {
+		size = maxDictionarySize
+	}
+
+	// Count the samples each gram appears in; repeats within one sample are
+	// already handled by the compressor itself
+	frequency := make(map[string]int)
+	for _, sample := range samples {
+		seen := make(map[string]bool)
+		for i := 0; i+gramSize <= len(sample); i++ {
+			gram := sample[i : i+gramSize]
+			if !seen[gram] {
+				seen[gram] = true
+				frequency[gram]++
+			}
+		}
+	}
+
+	type segment struct {
+		text  string
+		score int
+	}
+	score := func(text string) int {
+		total := 0
+		for i := 0; i+gramSize <= len(text); i++ {
+			if n := frequency[text[i:i+gramSize]]; n > 1 {
+				total += n - 1
+			}
+		}
+		return total
+	}
+
+	var segments []segment
+	unique := make(map[string]bool)
+	for _, sample := range samples {
+		for start := 0; start < len(sample); start += segmentSize {
+			text := sample[start:min(start+segmentSize, len(sample))]
+			if unique[text] {
+				continue
+			}
+			unique[text] = true
+			if s := score(text); s > 0 {
+				segments = append(segments, segment{text: text, score: s})
+			}
+		}
+	}
+	sort.SliceStable(segments, func(i, j int) bool {
+		return segments[i].score > segments[j].score
+	})
+
+	var chosen []string
+	total := 0
+	for _, seg := range segments {
+		if total+len(seg.text) > size {
+			continue
+		}
+		// Skip segments whose substrings earlier picks already cover
+		if score(seg.text)*2 < seg.score {
+			continue
+		}
+		chosen = append(chosen, seg.text)
+		total += len(seg.text)
+		for i := 0; i+gramSize <= len(seg.text); i++ {
+			frequency[seg.text[i:i+gramSize]] = 0
+		}
+	}
+
+	var b strings.Builder
+	for i := len(chosen) - 1; i >= 0; i-- {
+		b.WriteString(chosen[i])
+	}
+	return []byte(b.String())
+}
@@ -11,21 +11,71 @@ import (
 )
 
 type Config struct {
-	Server    ServerConfig    `yaml:"server"`
-	Tor       TorConfig       `yaml:"tor"`
-	I2P       I2PConfig       `yaml:"i2p"`
-	SSH       SSHConfig       `yaml:"ssh"`
-	RabbitMQ  RabbitMQConfig  `yaml:"rabbitmq"`
-	Redis     RedisConfig     `yaml:"redis"`
-	XFTP      XFTPConfig      `yaml:"xftp"`
-	Postgres  PostgresConfig  `yaml:"postgres"`
-	Quality   QualityConfig   `yaml:"quality"`
-	Access    AccessConfig    `yaml:"access"`
-	Admin     AdminConfig     `yaml:"admin"`
-	GRPC      GRPCConfig      `yaml:"grpc"`
-	RESTAPI   RESTAPIConfig   `yaml:"rest_api"`
-	Streaming StreamingConfig `yaml:"streaming"`
-	Logging   LoggingConfig   `yaml:"logging"`
+	// Profile names the preset the file was applied on top of, see
+	// profiles.go
+	Profile    string           `yaml:"profile"`
+	Server     ServerConfig     `yaml:"server"`
+	Tor        TorConfig        `yaml:"tor"`
+	I2P        I2PConfig        `yaml:"i2p"`
+	SSH        SSHConfig        `yaml:"ssh"`
+	RabbitMQ   RabbitMQConfig   `yaml:"rabbitmq"`
+	Queue      QueueConfig      `yaml:"queue"`
+	Redis      RedisConfig      `yaml:"redis"`
+	Cache      CacheConfig      `yaml:"cache"`
+	XFTP       XFTPConfig       `yaml:"xftp"`
+	Storage    StorageConfig    `yaml:"storage"`
+	Postgres   PostgresConfig   `yaml:"postgres"`
+	Quality    QualityConfig    `yaml:"quality"`
+	Access     AccessConfig     `yaml:"access"`
+	Admin      AdminConfig      `yaml:"admin"`
+	GRPC       GRPCConfig       `yaml:"grpc"`
+	RESTAPI    RESTAPIConfig    `yaml:"rest_api"`
+	Streaming  StreamingConfig  `yaml:"streaming"`
+	Logging    LoggingConfig    `yaml:"logging"`
+	Forwarding ForwardingConfig `yaml:"forwarding"`
+	Notices    NoticeConfig     `yaml:"notices"`
+	Mirror     MirrorConfig     `yaml:"mirror"`
+	Trending   TrendingConfig   `yaml:"trending"`
+	Reputation ReputationConfig `yaml:"reputation"`
+	Language   LanguageConfig   `yaml:"language"`
+	Disk       DiskConfig       `yaml:"disk"`
+	// Entitlements unlock paid and restricted publications per reader
+	Entitlements EntitlementsConfig `yaml:"entitlements"`
+	// Identity is the relay's own Nostr key
+	Identity IdentityConfig `yaml:"identity"`
+	// Search indexes notes, articles, books and wiki pages for full-text search
+	Search SearchConfig `yaml:"search"`
+
+	// Archive copies finalized publications to S3 or the Internet Archive
+	Archive ArchiveConfig `yaml:"archive"`
+
+	// Profiling samples the runtime for /api/v1/stats/runtime and pprof
+	Profiling ProfilingConfig `yaml:"profiling"`
+	// Push delivers events matching users' stored filters while they are
+	// offline
+	Push PushConfig `yaml:"push"`
+	// Cluster coordinates instances that share storage
+	Cluster ClusterConfig `yaml:"cluster"`
+	// BlockLists imports moderation lists signed by trusted moderators
+	BlockLists BlockListsConfig `yaml:"block_lists"`
+	// LargeObjects keeps oversized events out of the queue and cache
+	LargeObjects LargeObjectConfig `yaml:"large_objects"`
+	// Live tracks NIP-53 live activities and their viewers
+	Live LiveConfig `yaml:"live"`
+	// Sync answers NIP-77 negentropy reconciliation from other relays
+	Sync SyncConfig `yaml:"sync"`
+	// Retention prunes old and expired events from the cache and storage
+	Retention RetentionConfig `yaml:"retention"`
+	// Tracing exports OpenTelemetry spans of ingestion and queries
+	Tracing TracingConfig `yaml:"tracing"`
+	// Outbox republishes the owner's events to external relays
+	Outbox OutboxConfig `yaml:"outbox"`
+	// Dedup acknowledges events seen before without processing them again
+	Dedup DedupConfig `yaml:"dedup"`
+	// Backup snapshots the event store on a schedule
+	Backup BackupConfig `yaml:"backup"`
+	// Payments let unknown pubkeys buy write access
+	Payments PaymentsConfig `yaml:"payments"`
 }
 
 type ServerConfig struct {
@@ -33,6 +83,38 @@ type ServerConfig struct {
 	Port         int           `yaml:"port"`
 	ReadTimeout  time.Duration `yaml:"read_timeout"`
 	WriteTimeout time.Duration `yaml:"write_timeout"`
+	// EnforceMuteLists hides events from pubkeys on an authenticated
+	// reader's kind 10000 mute list
+	EnforceMuteLists bool `yaml:"enforce_mute_lists"`
+	// REQ flood protection per connection: REQRateLimit REQs per second
+	// with bursts up to REQBurst, and at most MaxConcurrentReplays
+	// subscriptions replaying stored events at once. Negative disables.
+	REQRateLimit         float64 `yaml:"req_rate_limit"`
+	REQBurst             int     `yaml:"req_burst"`
+	MaxConcurrentReplays int     `yaml:"max_concurrent_replays"`
+	// Per-connection limits. A REQ over MaxSubscriptions or MaxFilters is
+	// CLOSED, EVENTs over MaxEventsPerMinute are refused with OK false, and
+	// messages over MaxMessageSize end the connection. After MaxViolations
+	// refused messages, or once MaxPendingEvents live events wait for a
+	// client that doesn't read them, the connection is dropped. Negative
+	// disables.
+	MaxSubscriptions   int `yaml:"max_subscriptions"`
+	MaxFilters         int `yaml:"max_filters"`
+	MaxEventsPerMinute int `yaml:"max_events_per_minute"`
+	MaxMessageSize     int `yaml:"max_message_size"`
+	MaxViolations      int `yaml:"max_violations"`
+	MaxPendingEvents   int `yaml:"max_pending_events"`
+	// AllowedOrigins lists the browser origins that may open WebSockets
+	// and post the SSH key forms, e.g. "https://app.example.com" or
+	// "https://*.example.com". The relay's own origin is always allowed.
+	// Empty or "*" allows any origin, as Nostr web clients expect.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+	// TrustForwardedHost takes the relay's own host from X-Forwarded-Host;
+	// only enable behind a reverse proxy that sets it
+	TrustForwardedHost bool `yaml:"trust_forwarded_host"`
+	// SequenceNumbers adds {"seq": n} to EVENT messages sent to
+	// authenticated clients, numbering each subscription's events from 1
+	SequenceNumbers bool `yaml:"sequence_numbers"`
 }
 
 type TorConfig struct {
@@ -95,6 +177,10 @@ type TerminalInterface struct {
 	Host        string `yaml:"host"`
 	Interactive bool   `yaml:"interactive"`
 	LogLevel    string `yaml:"log_level"`
+
+	// Failed challenge responses allowed per IP within AuthWindow
+	MaxAuthAttempts int           `yaml:"max_auth_attempts"`
+	AuthWindow      time.Duration `yaml:"auth_window"`
 }
 
 type RabbitMQConfig struct {
@@ -105,11 +191,42 @@ type RabbitMQConfig struct {
 	TTL          time.Duration `yaml:"ttl"`
 }
 
+// QueueConfig selects the event queue. RabbitMQ suits clustered
+// deployments; the memory backend is a bounded in-process queue so a single
+// relay runs without a broker. When it is full, Overflow decides: block
+// waits up to BlockTimeout, drop_newest rejects the event, drop_oldest
+// discards the oldest queued one, and spill appends to SpillPath until
+// there is room again.
+type QueueConfig struct {
+	Backend      string        `yaml:"backend"` // "rabbitmq" or "memory"
+	Capacity     int           `yaml:"capacity"`
+	Overflow     string        `yaml:"overflow"`
+	BlockTimeout time.Duration `yaml:"block_timeout"`
+	SpillPath    string        `yaml:"spill_path"`
+}
+
 type RedisConfig struct {
-	Host     string        `yaml:"host"`
-	Password string        `yaml:"password"`
-	DB       int           `yaml:"db"`
-	TTL      time.Duration `yaml:"ttl"`
+	Host         string        `yaml:"host"`
+	Password     string        `yaml:"password"`
+	DB           int           `yaml:"db"`
+	TTL          time.Duration `yaml:"ttl"`
+	HistoryDepth int           `yaml:"history_depth"` // Versions kept per replaceable event (0 keeps all)
+}
+
+// CacheConfig selects the cache backend. The memory backend keeps events in
+// process for tests and small nodes that don't run Redis.
+type CacheConfig struct {
+	Backend      string        `yaml:"backend"`    // "redis" or "memory"
+	MaxEvents    int           `yaml:"max_events"` // memory backend size bound
+	Shards       int           `yaml:"shards"`
+	TTL          time.Duration `yaml:"ttl"`           // defaults to redis.ttl
+	HistoryDepth int           `yaml:"history_depth"` // defaults to redis.history_depth
+	// Ingest writes are grouped: a batch is stored once it holds
+	// WriteBatchSize events or its first event waited WriteBatchDelay, and
+	// the queue messages are acknowledged only after it is stored. A size
+	// of 1 stores every event on its own.
+	WriteBatchSize  int           `yaml:"write_batch_size"`
+	WriteBatchDelay time.Duration `yaml:"write_batch_delay"`
 }
 
 type XFTPConfig struct {
@@ -119,33 +236,157 @@ type XFTPConfig struct {
 	TTL        string `yaml:"ttl"`
 }
 
+// StorageConfig picks the persistent storage backend and holds settings
+// shared by the backends. Backend is xftp, postgres, file (an event log
+// under Path, for single-binary deployments), sqlite (a database under
+// Path, likewise) or none; it defaults to the enabled one of xftp and
+// postgres. WarmupEvents of the newest stored events are loaded into the
+// cache at start; negative disables.
+type StorageConfig struct {
+	Backend      string            `yaml:"backend"`
+	Path         string            `yaml:"path"`
+	WarmupEvents int               `yaml:"warmup_events"`
+	Compression  CompressionConfig `yaml:"compression"`
+}
+
+// CompressionConfig compresses the content of the listed kinds before it is
+// stored. The preset dictionary is trained from the first TrainingSamples
+// events of those kinds and kept at DictionaryPath.
+type CompressionConfig struct {
+	Enabled         bool   `yaml:"enabled"`
+	Kinds           []int  `yaml:"kinds"`
+	MinSize         int    `yaml:"min_size"` // content shorter than this is stored as is
+	DictionaryPath  string `yaml:"dictionary_path"`
+	DictionarySize  int    `yaml:"dictionary_size"`
+	TrainingSamples int    `yaml:"training_samples"`
+}
+
+// PostgresConfig connects the Postgres event store. Host is host[:port] or
+// a Unix socket directory; SSLMode is disable, prefer, require or
+// verify-full. With AutoMigrate the schema is upgraded at start, otherwise
+// mercury migrate does it.
 type PostgresConfig struct {
-	Host     string `yaml:"host"`
-	User     string `yaml:"user"`
-	Password string `yaml:"password"`
-	DBName   string `yaml:"dbname"`
-	SSLMode  string `yaml:"sslmode"`
+	Enabled        bool   `yaml:"enabled"`
+	Host           string `yaml:"host"`
+	User           string `yaml:"user"`
+	Password       string `yaml:"password"`
+	DBName         string `yaml:"dbname"`
+	SSLMode        string `yaml:"sslmode"`
+	MaxConnections int    `yaml:"max_connections"`
+	AutoMigrate    bool   `yaml:"auto_migrate"`
+	// Tablespaces lists tablespace directories watched for disk pressure
+	Tablespaces []string `yaml:"tablespaces"`
 }
 
 type QualityConfig struct {
-	SpamThreshold        float64 `yaml:"spam_threshold"`
-	RateLimitPerMinute   int     `yaml:"rate_limit_per_minute"`
-	MaxContentLength     int     `yaml:"max_content_length"`
-	QuarantineSuspicious bool    `yaml:"quarantine_suspicious"`
+	SpamThreshold        float64          `yaml:"spam_threshold"`
+	RateLimitPerMinute   int              `yaml:"rate_limit_per_minute"`
+	MaxContentLength     int              `yaml:"max_content_length"`
+	QuarantineSuspicious bool             `yaml:"quarantine_suspicious"`
+	Reports              ReportConfig     `yaml:"reports"`
+	Probation            ProbationConfig  `yaml:"probation"`
+	Moderation           ModerationConfig `yaml:"moderation"`
+	Quarantine           QuarantineConfig `yaml:"quarantine"`
+}
+
+// QuarantineConfig holds quarantined events for admin review instead of
+// storing and broadcasting them; the held events are kept in Path. Events
+// left unreviewed for ExpireAfter are purged, and beyond MaxItems the
+// oldest are purged first. Negative disables either.
+type QuarantineConfig struct {
+	Enabled     bool          `yaml:"enabled"`
+	Path        string        `yaml:"path"`
+	ExpireAfter time.Duration `yaml:"expire_after"`
+	MaxItems    int           `yaml:"max_items"`
+}
+
+// ModerationConfig says where blocked pubkeys and quarantined events are
+// kept so moderation decisions survive restarts: a JSON file at Path, or a
+// key in the Redis of the redis section.
+type ModerationConfig struct {
+	Backend string `yaml:"backend"` // file (default), redis or none
+	Path    string `yaml:"path"`
+}
+
+// ProbationConfig holds back pubkeys the relay first saw less than Age ago:
+// they get RateLimitPerMinute, must attach MinPoW bits of NIP-13 proof of
+// work, and their events beyond QuarantineAfter within VelocityWindow are
+// quarantined. The limits relax towards the normal ones as the key ages or
+// collects clean (accepted, unquarantined) events, whichever is further
+// along, and lift at Age or CleanEvents. First-seen times are kept in Path.
+type ProbationConfig struct {
+	Enabled            bool          `yaml:"enabled"`
+	Path               string        `yaml:"path"`
+	Age                time.Duration `yaml:"age"`
+	CleanEvents        int           `yaml:"clean_events"`
+	RateLimitPerMinute int           `yaml:"rate_limit_per_minute"`
+	MinPoW             int           `yaml:"min_pow"`
+	QuarantineAfter    int           `yaml:"quarantine_after"`
+	VelocityWindow     time.Duration `yaml:"velocity_window"`
+}
+
+// ReportConfig weights kind 1984 reports by the reporter's trust. Reports add
+// up per target and trigger automatic actions at the thresholds.
+type ReportConfig struct {
+	Enabled             bool    `yaml:"enabled"`
+	QuarantineThreshold float64 `yaml:"quarantine_threshold"` // Weighted score that quarantines a reported event
+	BlockThreshold      float64 `yaml:"block_threshold"`      // Weighted score that blocks a reported pubkey (0 disables)
+	OwnerWeight         float64 `yaml:"owner_weight"`         // Reports from the relay owner
+	FollowWeight        float64 `yaml:"follow_weight"`        // Reports from npubs the owner follows
+	UnknownWeight       float64 `yaml:"unknown_weight"`       // Reports from everyone else
+	AccuracyWeight      float64 `yaml:"accuracy_weight"`      // 0-1, how much past upheld/overturned reports scale the weight
 }
 
 type AccessConfig struct {
-	AdminNpubs       []string      `yaml:"admin_npubs"`
-	UpdateInterval   time.Duration `yaml:"update_interval"`
-	RelayURL         string        `yaml:"relay_url"`
-	AllowPublicRead  bool          `yaml:"allow_public_read"`
-	AllowPublicWrite bool          `yaml:"allow_public_write"`
+	AdminNpubs          []string      `yaml:"admin_npubs"`
+	UpdateInterval      time.Duration `yaml:"update_interval"`
+	RelayURL            string        `yaml:"relay_url"`
+	AllowPublicRead     bool          `yaml:"allow_public_read"`
+	AllowPublicWrite    bool          `yaml:"allow_public_write"`
+	AnonymousWriteKinds []int         `yaml:"anonymous_write_kinds"` // Kinds anyone may publish without follow list membership
+
+	// The owner's follow list is fetched over WebSocket from RelayURL and
+	// RelayURLs; the newest one any of them has wins. QueryTimeout bounds
+	// each fetch.
+	RelayURLs    []string      `yaml:"relay_urls"`
+	QueryTimeout time.Duration `yaml:"query_timeout"`
+
+	// Writer approval queues unknown pubkeys for admin review instead of
+	// denying them outright. Decisions are kept in WritersPath.
+	WriterApproval    bool   `yaml:"writer_approval"`
+	WritersPath       string `yaml:"writers_path"`
+	MaxPendingWriters int    `yaml:"max_pending_writers"`
+
+	// FollowRelays subscribes upstream to the relays followed npubs publish
+	// to according to their NIP-65 relay lists, for their events only.
+	// MaxFollowRelays caps how many, those shared by the most follows
+	// first; negative is unlimited.
+	FollowRelays    bool `yaml:"follow_relays"`
+	MaxFollowRelays int  `yaml:"max_follow_relays"`
+
+	// WoT extends write access beyond the owner's follows
+	WoT WoTAccessConfig `yaml:"wot"`
+}
+
+// WoTAccessConfig extends write access from the owner's follows to the
+// pubkeys they follow, and so on, up to Depth hops; 1 is the follows only.
+// The trust graph is rebuilt on every follow list refresh and holds at
+// most MaxPubkeys, negative is unlimited. RateMultipliers scale
+// max_events_per_minute for writers at a depth, e.g. {2: 0.5, 3: 0.25};
+// depths without one get the full rate.
+type WoTAccessConfig struct {
+	Enabled         bool            `yaml:"enabled"`
+	Depth           int             `yaml:"depth"`
+	MaxPubkeys      int             `yaml:"max_pubkeys"`
+	RateMultipliers map[int]float64 `yaml:"rate_multipliers"`
 }
 
 type AdminConfig struct {
 	Enabled bool   `yaml:"enabled"`
 	Port    int    `yaml:"port"`
 	APIKey  string `yaml:"api_key"`
+	// AnnotationsPath keeps admins' private notes on pubkeys and events
+	AnnotationsPath string `yaml:"annotations_path"`
 }
 
 type GRPCConfig struct {
@@ -168,6 +409,34 @@ type LoggingConfig struct {
 	Level  string `yaml:"level"`
 	Format string `yaml:"format"`
 	File   string `yaml:"file"`
+	// Rejections configures logging of refused events
+	Rejections RejectionLogConfig `yaml:"rejections"`
+}
+
+// TracingConfig exports spans over OTLP/HTTP with JSON encoding, which
+// OpenTelemetry collectors and Jaeger accept alike; the stdout exporter logs
+// them instead. SampleRate is the fraction of traces started here that are
+// recorded; negative records none. Traces continued from a client's
+// traceparent header keep the client's sampling decision.
+type TracingConfig struct {
+	Enabled       bool              `yaml:"enabled"`
+	Exporter      string            `yaml:"exporter"` // otlp, jaeger or stdout
+	Endpoint      string            `yaml:"endpoint"`
+	Headers       map[string]string `yaml:"headers"`
+	ServiceName   string            `yaml:"service_name"`
+	SampleRate    float64           `yaml:"sample_rate"`
+	BatchSize     int               `yaml:"batch_size"`
+	FlushInterval time.Duration     `yaml:"flush_interval"`
+	Timeout       time.Duration     `yaml:"timeout"`
+}
+
+// RejectionLogConfig samples refused events into the log and keeps the
+// last BufferSize of them for /api/v1/admin/rejections. SampleRate is the
+// fraction of rejections logged; negative logs none. Every rejection is
+// counted and buffered regardless.
+type RejectionLogConfig struct {
+	SampleRate float64 `yaml:"sample_rate"`
+	BufferSize int     `yaml:"buffer_size"`
 }
 
 type RESTAPIConfig struct {
@@ -177,6 +446,52 @@ type RESTAPIConfig struct {
 	CORSOrigins        []string         `yaml:"cors_origins"`
 	RateLimitPerMinute int              `yaml:"rate_limit_per_minute"`
 	Endpoints          RESTAPIEndpoints `yaml:"endpoints"`
+	// PublicMirror serves read-only catalogs without authentication
+	PublicMirror PublicMirrorConfig `yaml:"public_mirror"`
+	// Idempotency dedupes retried publishes
+	Idempotency IdempotencyConfig `yaml:"idempotency"`
+	// Stream bounds the live event streams of /api/v1/stream
+	Stream StreamConfig `yaml:"stream"`
+}
+
+// StreamConfig bounds /api/v1/stream, which sends matching stored events and
+// then new ones as they arrive. Negative values disable a limit.
+type StreamConfig struct {
+	MaxStreams          int `yaml:"max_streams"`            // open streams on this relay
+	MaxStreamsPerClient int `yaml:"max_streams_per_client"` // open streams per client
+	MaxFilterValues     int `yaml:"max_filter_values"`      // ids, authors, kinds and tag values in one filter
+}
+
+// IdempotencyConfig makes POST /api/v1/publish safe to retry. Publishes are
+// keyed by their Idempotency-Key header, scoped to the authenticated pubkey,
+// or by event ID without one. Successful results are kept for Window in the
+// log at Path and returned to retries instead of publishing again.
+type IdempotencyConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Window  time.Duration `yaml:"window"`
+	Path    string        `yaml:"path"`
+}
+
+// PublicMirrorConfig serves /api/v1/public/ebooks, /articles and /events
+// from pre-rendered responses refreshed in the background, so popular
+// catalogs survive cache and storage hiccups and can sit behind a CDN
+type PublicMirrorConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	MaxAge          time.Duration `yaml:"max_age"`   // Cache-Control max-age
+	StaleTTL        time.Duration `yaml:"stale_ttl"` // served stale on errors, dropped after this long unrequested
+	Limit           int           `yaml:"limit"`     // events per response
+	MaxViews        int           `yaml:"max_views"` // distinct pre-rendered responses
+	// Filters are the only filters /api/v1/public/events serves, by name
+	Filters map[string]PublicFilter `yaml:"filters"`
+}
+
+// PublicFilter is a safelisted event filter
+type PublicFilter struct {
+	Kinds   []int               `yaml:"kinds"`
+	Authors []string            `yaml:"authors"`
+	Tags    map[string][]string `yaml:"tags"` // e.g. t: [books]
+	Limit   int                 `yaml:"limit"`
 }
 
 type RESTAPIEndpoints struct {
@@ -194,12 +509,73 @@ type StreamingConfig struct {
 	ConnectionPoolSize int              `yaml:"connection_pool_size"`
 	ReconnectInterval  time.Duration    `yaml:"reconnect_interval"`
 	Timeout            time.Duration    `yaml:"timeout"`
+	// Classification detects language and topics of upstream events
+	Classification ClassificationConfig `yaml:"classification"`
+	// TrustLabels labels upstream events by how the relay knows their author
+	TrustLabels TrustLabelConfig `yaml:"trust_labels"`
+	// MaintenanceBuffer is how many upstream events are held while writes
+	// are paused; they are stored once writes resume
+	MaintenanceBuffer int `yaml:"maintenance_buffer"`
+	// Deadlines bound each step of an upstream subscription
+	Deadlines UpstreamDeadlines `yaml:"deadlines"`
+	// Failover picks which upstream relays to stream from
+	Failover UpstreamFailover `yaml:"failover"`
+}
+
+// UpstreamFailover keeps MaxActive upstream relays connected, lowest
+// Priority first; zero connects to every enabled relay. A relay that fails
+// to connect, or drops within StableAfter, is retried after the reconnect
+// interval, doubling with every consecutive failure up to MaxBackoff, and
+// the next relay by priority stands in meanwhile. Relays whose recent error
+// rate exceeds MaxErrorRate, or whose latency exceeds MaxLatency, rank
+// after the healthy ones. Negative disables a check.
+type UpstreamFailover struct {
+	MaxActive     int           `yaml:"max_active"`
+	CheckInterval time.Duration `yaml:"check_interval"`
+	StableAfter   time.Duration `yaml:"stable_after"`
+	MaxBackoff    time.Duration `yaml:"max_backoff"`
+	MaxErrorRate  float64       `yaml:"max_error_rate"`
+	MaxLatency    time.Duration `yaml:"max_latency"`
+}
+
+// UpstreamDeadlines bound each step of an upstream subscription. A
+// connection that misses one is torn down and re-established. Negative
+// disables a deadline.
+type UpstreamDeadlines struct {
+	Dial       time.Duration `yaml:"dial"`        // TCP, TLS and WebSocket handshake
+	Subscribe  time.Duration `yaml:"subscribe"`   // sending the REQ after connecting
+	FirstEvent time.Duration `yaml:"first_event"` // first EVENT or EOSE after the REQ
+	Idle       time.Duration `yaml:"idle"`        // longest gap between messages
+}
+
+// ClassificationConfig enables language and topic detection at ingest.
+// Topics maps a topic name to the keywords and hashtags that select it.
+type ClassificationConfig struct {
+	Enabled bool                `yaml:"enabled"`
+	Topics  map[string][]string `yaml:"topics"`
 }
 
 type UpstreamRelay struct {
 	URL      string `yaml:"url"`
 	Enabled  bool   `yaml:"enabled"`
 	Priority int    `yaml:"priority"`
+	// Languages and Topics restrict ingest from this relay to matching
+	// events when classification is enabled; empty accepts everything
+	Languages []string `yaml:"languages"`
+	Topics    []string `yaml:"topics"`
+	// Filters are what the relay is subscribed to; empty subscribes to
+	// everything
+	Filters []UpstreamFilter `yaml:"filters"`
+}
+
+// UpstreamFilter is one filter of an upstream subscription. Authors are
+// npubs or hex pubkeys; Tags map a tag name to its values, e.g. t: [books].
+// Limit caps the stored events requested, 1000 when unset.
+type UpstreamFilter struct {
+	Kinds   []int               `yaml:"kinds"`
+	Authors []string            `yaml:"authors"`
+	Tags    map[string][]string `yaml:"tags"`
+	Limit   int                 `yaml:"limit"`
 }
 
 type TransportMethods struct {
@@ -212,20 +588,471 @@ type TransportMethods struct {
 	GRPC          bool `yaml:"grpc"`
 }
 
+// ForwardingConfig routes matching events to external MQTT brokers and AMQP exchanges
+type ForwardingConfig struct {
+	Enabled bool             `yaml:"enabled"`
+	MQTT    MQTTTarget       `yaml:"mqtt"`
+	AMQP    AMQPTarget       `yaml:"amqp"`
+	Rules   []ForwardingRule `yaml:"rules"`
+}
+
+type MQTTTarget struct {
+	Broker   string `yaml:"broker"`
+	ClientID string `yaml:"client_id"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+type AMQPTarget struct {
+	URL          string `yaml:"url"`
+	Exchange     string `yaml:"exchange"`
+	ExchangeType string `yaml:"exchange_type"`
+}
+
+// ForwardingRule maps a Nostr filter to a topic (MQTT) or routing key (AMQP).
+// Topic and Template are Go text/templates evaluated against the event.
+type ForwardingRule struct {
+	Name     string              `yaml:"name"`
+	Target   string              `yaml:"target"` // "mqtt" or "amqp"
+	Kinds    []int               `yaml:"kinds"`
+	Authors  []string            `yaml:"authors"`
+	Tags     map[string][]string `yaml:"tags"`
+	Topic    string              `yaml:"topic"`
+	QoS      byte                `yaml:"qos"`
+	Retain   bool                `yaml:"retain"`
+	Template string              `yaml:"template"`
+}
+
+// MirrorConfig keeps a complete, permanent copy of everything the listed
+// authors publish. Their events are searched for on Relays, the upstream
+// relays and, unless SkipRelayLists is set, the write relays of their
+// NIP-65 relay lists.
+type MirrorConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	Authors        []string      `yaml:"authors"` // npubs or hex pubkeys
+	Relays         []string      `yaml:"relays"`
+	SkipRelayLists bool          `yaml:"skip_relay_lists"`
+	SyncInterval   time.Duration `yaml:"sync_interval"`
+	PageSize       int           `yaml:"page_size"` // events requested per REQ while paging back
+	FetchTimeout   time.Duration `yaml:"fetch_timeout"`
+}
+
+// OutboxConfig republishes events by the relay owner and Authors to
+// external relays (NIP-65 outbox). With UseRelayList the write relays of
+// the owner's kind 10002 relay list are used along with Relays. A relay
+// that fails is retried with exponential backoff up to MaxBackoff and keeps
+// its newest MaxPending events meanwhile.
+type OutboxConfig struct {
+	Enabled      bool          `yaml:"enabled"`
+	Relays       []string      `yaml:"relays"`
+	Authors      []string      `yaml:"authors"` // npubs or hex pubkeys besides the owner
+	UseRelayList bool          `yaml:"use_relay_list"`
+	Timeout      time.Duration `yaml:"timeout"`
+	MaxBackoff   time.Duration `yaml:"max_backoff"`
+	MaxPending   int           `yaml:"max_pending"`
+}
+
+// DedupConfig keeps the IDs of accepted events so copies arriving again,
+// from other upstream relays or republishing clients, are acknowledged
+// without being queued, stored or broadcast again. The newest Size IDs are
+// kept in memory (negative keeps none, for the redis backend only); with
+// the redis backend IDs are also kept in Redis for TTL, shared by every
+// instance and surviving restarts.
+type DedupConfig struct {
+	Enabled bool          `yaml:"enabled"`
+	Backend string        `yaml:"backend"` // "memory" or "redis"
+	Size    int           `yaml:"size"`
+	TTL     time.Duration `yaml:"ttl"`
+}
+
+// BackupConfig snapshots the event store and the SSH public keys every
+// Interval into Path, or into an S3-compatible bucket when S3 is enabled,
+// keeping the newest Keep snapshots (negative keeps all). With Recipient
+// set to an npub, snapshots are encrypted to it with NIP-44 and only its
+// nsec restores them.
+type BackupConfig struct {
+	Enabled   bool            `yaml:"enabled"`
+	Interval  time.Duration   `yaml:"interval"`
+	Path      string          `yaml:"path"`
+	Keep      int             `yaml:"keep"`
+	Recipient string          `yaml:"recipient"`
+	S3        S3ArchiveConfig `yaml:"s3"`
+}
+
+// PaymentsConfig lets pubkeys without write access buy it: by paying an
+// invoice of Price sats issued through Backend ("lnurl", "lnd" or "cln"),
+// or by having received zaps worth ZapThreshold sats in receipts signed by
+// one of ZapProviders. Zero Price or ZapThreshold turns that way off.
+// Admissions last Duration, zero is for good. They are kept in Path with
+// the pending invoices, which are checked every PollInterval until they
+// expire after InvoiceExpiry.
+type PaymentsConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	Path          string        `yaml:"path"`
+	Price         int64         `yaml:"price"`
+	Duration      time.Duration `yaml:"duration"`
+	InvoiceExpiry time.Duration `yaml:"invoice_expiry"`
+	PollInterval  time.Duration `yaml:"poll_interval"`
+	Backend       string        `yaml:"backend"`
+	LNURL         LNURLConfig   `yaml:"lnurl"`
+	LND           LNDConfig     `yaml:"lnd"`
+	CLN           CLNConfig     `yaml:"cln"`
+	ZapThreshold  int64         `yaml:"zap_threshold"`
+	ZapProviders  []string      `yaml:"zap_providers"`
+}
+
+// LNURLConfig issues invoices from a lightning address (name@domain) or an
+// https LNURL-pay URL. The service must support LUD-21 so payments can be
+// verified.
+type LNURLConfig struct {
+	Address string `yaml:"address"`
+}
+
+// LNDConfig issues invoices from an LND node's REST API. Macaroon is the
+// hex invoice macaroon; TLSCert is the node's certificate when it isn't
+// signed by a known authority.
+type LNDConfig struct {
+	URL      string `yaml:"url"`
+	Macaroon string `yaml:"macaroon"`
+	TLSCert  string `yaml:"tls_cert"`
+}
+
+// CLNConfig issues invoices from a Core Lightning node's REST API
+// (clnrest), authorized by Rune
+type CLNConfig struct {
+	URL     string `yaml:"url"`
+	Rune    string `yaml:"rune"`
+	TLSCert string `yaml:"tls_cert"`
+}
+
+// RetentionConfig prunes events from the cache and storage every Interval.
+// The first rule matching an event decides how long it is kept; events no
+// rule matches are kept for DefaultTTL. A TTL of 0 keeps events for good.
+// Events are also deleted once their NIP-40 expiration passes, and events
+// of mirrored authors are never pruned. With DryRun the job only counts
+// what it would delete.
+type RetentionConfig struct {
+	Enabled    bool            `yaml:"enabled"`
+	Interval   time.Duration   `yaml:"interval"`
+	DryRun     bool            `yaml:"dry_run"`
+	DefaultTTL time.Duration   `yaml:"default_ttl"`
+	BatchSize  int             `yaml:"batch_size"` // events examined per query
+	Rules      []RetentionRule `yaml:"rules"`
+}
+
+// RetentionRule keeps events of Kinds (any kind when empty) by authors of
+// AuthorClass for TTL. Author classes are owner, writer (the owner, follows
+// and approved writers) and other; empty matches any author.
+type RetentionRule struct {
+	Name        string        `yaml:"name"`
+	Kinds       []int         `yaml:"kinds"`
+	AuthorClass string        `yaml:"author_class"`
+	TTL         time.Duration `yaml:"ttl"`
+}
+
+// TrendingConfig ranks notes, articles and books by the reactions, zaps and
+// replies they received within Window. Older engagement counts less, halving
+// every HalfLife.
+type TrendingConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	Window     time.Duration `yaml:"window"` // longest window clients may ask for
+	HalfLife   time.Duration `yaml:"half_life"`
+	CacheTTL   time.Duration `yaml:"cache_ttl"`
+	MaxTargets int           `yaml:"max_targets"` // events tracked at once
+}
+
+// ReputationConfig screens client IPs at the WebSocket upgrade and in the
+// REST API against local deny lists and DNSBL zones. Actions are "deny",
+// "require_auth" or "rate_limit".
+type ReputationConfig struct {
+	Enabled        bool          `yaml:"enabled"`
+	DenyCIDRs      []string      `yaml:"deny_cidrs"`
+	DenyListPath   string        `yaml:"deny_list_path"` // one IP or CIDR per line, # comments
+	DenyListAction string        `yaml:"deny_list_action"`
+	DNSBLZones     []string      `yaml:"dnsbl_zones"` // e.g. zen.spamhaus.org
+	DNSBLAction    string        `yaml:"dnsbl_action"`
+	DNSBLTimeout   time.Duration `yaml:"dnsbl_timeout"`
+	CacheTTL       time.Duration `yaml:"cache_ttl"` // how long DNSBL answers are kept
+	// RateLimitDivisor divides the normal limits for rate_limit matches
+	RateLimitDivisor int `yaml:"rate_limit_divisor"`
+	// TrustForwardedFor takes the client IP from X-Forwarded-For or
+	// X-Real-IP, for relays behind a reverse proxy
+	TrustForwardedFor bool `yaml:"trust_forwarded_for"`
+}
+
+// DiskConfig watches disk usage of the XFTP storage directory, Postgres
+// tablespaces and any extra Paths. Crossing WarnPercent or CriticalPercent
+// alerts through WebhookURL and, with Notice, a NOTICE to every connection.
+// With TightenRetention the cache TTL is scaled by TightenFactor on every
+// check spent at the critical level, never below MinTTL, and restored once
+// usage is back under WarnPercent.
+type DiskConfig struct {
+	Enabled          bool          `yaml:"enabled"`
+	Paths            []string      `yaml:"paths"`
+	Interval         time.Duration `yaml:"interval"`
+	WarnPercent      float64       `yaml:"warn_percent"`
+	CriticalPercent  float64       `yaml:"critical_percent"`
+	WebhookURL       string        `yaml:"webhook_url"`
+	Notice           bool          `yaml:"notice"`
+	TightenRetention bool          `yaml:"tighten_retention"`
+	TightenFactor    float64       `yaml:"tighten_factor"`
+	MinTTL           time.Duration `yaml:"min_ttl"`
+}
+
+// EntitlementsConfig enables per-reader access to publications whose kind
+// 30041 sections are NIP-44 encrypted to the relay. PrivateKey (nsec or hex)
+// is the relay key authors encrypt to; entitled readers get sections
+// re-encrypted to their own pubkey. Grants are kept in Path. Zap receipts
+// signed by one of ZapProviders that pay a book's price unlock it for the
+// sender; without providers only authors and admins grant access.
+type EntitlementsConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	PrivateKey   string   `yaml:"private_key"`
+	Path         string   `yaml:"path"`
+	ZapProviders []string `yaml:"zap_providers"`
+}
+
+// SearchConfig keeps an in-memory full-text index of the notes, articles,
+// books and wiki pages stored by the relay, loaded from the cache at start.
+// MaxDocuments bounds it; the oldest indexed are dropped first. It answers
+// /api/v1/search and NIP-50 search filters. Language picks the text
+// analysis: "simple" indexes words as written, "english" also drops stop
+// words and folds plurals. Ranking orders NIP-50 results unless a filter
+// asks otherwise: "relevance" or "recent".
+type SearchConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	MaxDocuments int    `yaml:"max_documents"`
+	Language     string `yaml:"language"`
+	Ranking      string `yaml:"ranking"`
+}
+
+// ArchiveConfig copies finalized publications to external storage. A book
+// is finalized once its latest version is FinalizeAfter old; Run checks
+// every Interval. Each copy holds the EPUB, the raw signed events and a
+// manifest. Where each version was archived is recorded in Path.
+type ArchiveConfig struct {
+	Enabled         bool                  `yaml:"enabled"`
+	Path            string                `yaml:"path"`
+	Interval        time.Duration         `yaml:"interval"`
+	FinalizeAfter   time.Duration         `yaml:"finalize_after"`
+	S3              S3ArchiveConfig       `yaml:"s3"`
+	InternetArchive InternetArchiveConfig `yaml:"internet_archive"`
+}
+
+// S3ArchiveConfig uploads to an S3-compatible bucket. PublicURL, when set,
+// replaces the endpoint and bucket in recorded URLs.
+type S3ArchiveConfig struct {
+	Enabled     bool   `yaml:"enabled"`
+	Endpoint    string `yaml:"endpoint"`
+	Region      string `yaml:"region"`
+	Bucket      string `yaml:"bucket"`
+	Prefix      string `yaml:"prefix"`
+	AccessKey   string `yaml:"access_key"`
+	SecretKey   string `yaml:"secret_key"`
+	VirtualHost bool   `yaml:"virtual_host"`
+	PublicURL   string `yaml:"public_url"`
+}
+
+// InternetArchiveConfig uploads each book version as an Internet Archive
+// item named IdentifierPrefix-<d>-<event id prefix>, using the account's S3
+// API keys
+type InternetArchiveConfig struct {
+	Enabled          bool   `yaml:"enabled"`
+	Endpoint         string `yaml:"endpoint"`
+	DetailsURL       string `yaml:"details_url"`
+	AccessKey        string `yaml:"access_key"`
+	SecretKey        string `yaml:"secret_key"`
+	IdentifierPrefix string `yaml:"identifier_prefix"`
+	Collection       string `yaml:"collection"`
+}
+
+// PushConfig lets authenticated users store filters whose matching events
+// are pushed to a webhook, ntfy topic or WebPush endpoint while they have
+// no WebSocket connection open. Events are batched for BatchWindow, at most
+// MaxBatch per notification; failed deliveries back off exponentially up to
+// MaxBackoff. Subscriptions are kept in Path. WebPush requests are signed
+// with VAPIDPrivateKey (base64url P-256 scalar, generated and kept in Path
+// when empty) and VAPIDSubject, a mailto: or https: contact. Targets on
+// private networks are refused unless AllowPrivateTargets is set.
+type PushConfig struct {
+	Enabled             bool          `yaml:"enabled"`
+	Path                string        `yaml:"path"`
+	MaxPerUser          int           `yaml:"max_per_user"`
+	BatchWindow         time.Duration `yaml:"batch_window"`
+	MaxBatch            int           `yaml:"max_batch"`
+	MaxBackoff          time.Duration `yaml:"max_backoff"`
+	Timeout             time.Duration `yaml:"timeout"`
+	VAPIDPrivateKey     string        `yaml:"vapid_private_key"`
+	VAPIDSubject        string        `yaml:"vapid_subject"`
+	AllowPrivateTargets bool          `yaml:"allow_private_targets"`
+}
+
+// ClusterConfig lets several instances share Redis and storage. Each
+// instance announces itself in Redis every LeaseTTL/3 and is listed in
+// /api/v1/stats until it misses LeaseTTL; singleton background jobs run
+// only on the instance holding their lease. InstanceID defaults to the
+// hostname and process ID; Advertise is the address shown to other
+// instances.
+type ClusterConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	InstanceID string        `yaml:"instance_id"`
+	Advertise  string        `yaml:"advertise"`
+	LeaseTTL   time.Duration `yaml:"lease_ttl"`
+}
+
+// BlockListsConfig subscribes the relay to people lists (kind 30000, or
+// kind 10000 mute lists) published by trusted moderators. Lists are given
+// as naddr or "kind:pubkey:d-tag" addresses and fetched from Relays every
+// RefreshInterval; only lists signed by their author are applied. Pubkeys a
+// list adds are blocked in its name and unblocked when it drops them or the
+// list is unsubscribed. Subscriptions added at runtime are kept in Path.
+type BlockListsConfig struct {
+	Enabled         bool          `yaml:"enabled"`
+	Lists           []string      `yaml:"lists"`
+	Relays          []string      `yaml:"relays"`
+	RefreshInterval time.Duration `yaml:"refresh_interval"`
+	FetchTimeout    time.Duration `yaml:"fetch_timeout"`
+	Path            string        `yaml:"path"`
+}
+
+// LargeObjectConfig routes events whose content and tags exceed Threshold
+// bytes around the queue and cache: the full event goes to the large-object
+// store, XFTP when storage is enabled or files under Path otherwise, and a
+// stub without content takes its place until a query needs it. Events over
+// MaxEventSize are rejected; both limits are advertised via NIP-11.
+type LargeObjectConfig struct {
+	Enabled      bool   `yaml:"enabled"`
+	Threshold    int    `yaml:"threshold"`      // bytes
+	MaxEventSize int    `yaml:"max_event_size"` // bytes
+	Path         string `yaml:"path"`
+}
+
+// LiveConfig tracks NIP-53 live activities (kind 30311) and their chat
+// (kind 1311). An activity marked live counts as live until it ends, or
+// until StaleAfter passes without an update from its host. Live chat is
+// fanned out ahead of other events.
+type LiveConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	StaleAfter time.Duration `yaml:"stale_after"`
+}
+
+// SyncConfig enables NIP-77 negentropy set reconciliation over WebSocket
+// (NEG-OPEN, NEG-MSG, NEG-CLOSE), letting other relays and clients find the
+// events they are missing without downloading everything. A NEG-OPEN whose
+// filter matches more than MaxEvents is refused, and a connection may hold
+// at most MaxSessions open reconciliations. Negative disables a limit.
+type SyncConfig struct {
+	Enabled     bool `yaml:"enabled"`
+	MaxEvents   int  `yaml:"max_events"`
+	MaxSessions int  `yaml:"max_sessions"`
+}
+
+// ProfilingConfig tunes the always-on runtime sampler behind
+// /api/v1/stats/runtime. MutexFraction samples one in that many mutex
+// contention events (0 leaves mutex profiling off); BlockRate samples
+// blocking events lasting that many nanoseconds (0 leaves it off). Pprof
+// serves full pprof profiles to admins under /api/v1/debug/pprof/.
+type ProfilingConfig struct {
+	Enabled       bool          `yaml:"enabled"`
+	Interval      time.Duration `yaml:"interval"`
+	TopN          int           `yaml:"top_n"`
+	MutexFraction int           `yaml:"mutex_fraction"`
+	BlockRate     int           `yaml:"block_rate"`
+	Pprof         bool          `yaml:"pprof"`
+}
+
+// TrustLabelConfig labels events stored from upstream relays: owner-wot when
+// the relay owner is or follows their author, verified-nip05 when the
+// author's NIP-05 identifier resolves to them (with VerifyNIP05, rechecked
+// after NIP05TTL) and unknown otherwise. With WebSocket, authenticated
+// clients get the label after the event in EVENT messages.
+type TrustLabelConfig struct {
+	Enabled      bool          `yaml:"enabled"`
+	VerifyNIP05  bool          `yaml:"verify_nip05"`
+	NIP05TTL     time.Duration `yaml:"nip05_ttl"`
+	NIP05Timeout time.Duration `yaml:"nip05_timeout"`
+	WebSocket    bool          `yaml:"websocket"`
+}
+
+// IdentityConfig gives the relay its own Nostr key. PrivateKey (nsec or
+// hex) wins; otherwise the key saved at KeyPath is used, generated on first
+// start. SignResponses adds a signature header over every REST response;
+// SignNotices attaches a signed event to service NOTICEs.
+type IdentityConfig struct {
+	PrivateKey    string `yaml:"private_key"`
+	KeyPath       string `yaml:"key_path"`
+	SignResponses bool   `yaml:"sign_responses"`
+	SignNotices   bool   `yaml:"sign_notices"`
+}
+
+// LanguageConfig enables language detection for events published to this
+// relay. The result is kept as internal metadata, not in the signed tags; a
+// NIP-32 ISO-639-1 "l" label on the event wins over detection.
+type LanguageConfig struct {
+	Detect bool `yaml:"detect"`
+}
+
+// NoticeConfig configures NOTICE messages sent to WebSocket clients. Messages
+// are Go text/templates; see the notice package for the available variables.
+type NoticeConfig struct {
+	Welcome   string            `yaml:"welcome"`
+	Variables map[string]string `yaml:"variables"`
+	Scheduled []ScheduledNotice `yaml:"scheduled"`
+}
+
+// ScheduledNotice is broadcast to every connection at At, and again every
+// Repeat if set
+type ScheduledNotice struct {
+	ID      string        `yaml:"id" json:"id"`
+	Message string        `yaml:"message" json:"message"`
+	At      time.Time     `yaml:"at" json:"at"`
+	Repeat  time.Duration `yaml:"repeat" json:"repeat,omitempty"`
+}
+
 func Load(path string) (*Config, error) {
+	return LoadProfile(path, "")
+}
+
+// LoadProfile loads the config file on top of the named profile. Without a
+// name the MERCURY_PROFILE environment variable is used, then the file's
+// profile key; no profile at all is fine.
+func LoadProfile(path, profile string) (*Config, error) {
 	var config Config
+	var data []byte
 
 	// Load from file if it exists
 	if path != "" {
-		data, err := os.ReadFile(path)
+		var err error
+		data, err = os.ReadFile(path)
 		if err != nil {
 			return nil, fmt.Errorf("failed to read config file: %w", err)
 		}
+	}
+
+	if profile == "" {
+		profile = os.Getenv("MERCURY_PROFILE")
+	}
+	if profile == "" && data != nil {
+		var header struct {
+			Profile string `yaml:"profile"`
+		}
+		if err := yaml.Unmarshal(data, &header); err != nil {
+			return nil, fmt.Errorf("failed to parse config file: %w", err)
+		}
+		profile = header.Profile
+	}
+	if profile != "" {
+		if err := applyProfile(&config, profile); err != nil {
+			return nil, err
+		}
+	}
 
+	if data != nil {
 		if err := yaml.Unmarshal(data, &config); err != nil {
 			return nil, fmt.Errorf("failed to parse config file: %w", err)
 		}
 	}
+	config.Profile = profile
 
 	// Set defaults for any unset fields
 	setDefaults(&config)
@@ -251,6 +1078,33 @@ func setDefaults(config *Config) {
 	if config.Server.WriteTimeout == 0 {
 		config.Server.WriteTimeout = 30 * time.Second
 	}
+	if config.Server.REQRateLimit == 0 {
+		config.Server.REQRateLimit = 5
+	}
+	if config.Server.REQBurst == 0 {
+		config.Server.REQBurst = 20
+	}
+	if config.Server.MaxConcurrentReplays == 0 {
+		config.Server.MaxConcurrentReplays = 4
+	}
+	if config.Server.MaxSubscriptions == 0 {
+		config.Server.MaxSubscriptions = 20
+	}
+	if config.Server.MaxFilters == 0 {
+		config.Server.MaxFilters = 10
+	}
+	if config.Server.MaxEventsPerMinute == 0 {
+		config.Server.MaxEventsPerMinute = 120
+	}
+	if config.Server.MaxMessageSize == 0 {
+		config.Server.MaxMessageSize = 512 * 1024
+	}
+	if config.Server.MaxViolations == 0 {
+		config.Server.MaxViolations = 20
+	}
+	if config.Server.MaxPendingEvents == 0 {
+		config.Server.MaxPendingEvents = 5000
+	}
 
 	// Access defaults
 	if len(config.Access.AdminNpubs) == 0 {
@@ -269,6 +1123,438 @@ func setDefaults(config *Config) {
 	if config.Access.UpdateInterval == 0 {
 		config.Access.UpdateInterval = time.Hour
 	}
+	if config.Access.WritersPath == "" {
+		config.Access.WritersPath = "data/writers.json"
+	}
+	if config.Access.MaxPendingWriters == 0 {
+		config.Access.MaxPendingWriters = 1000
+	}
+	if config.Access.QueryTimeout == 0 {
+		config.Access.QueryTimeout = 10 * time.Second
+	}
+	if config.Access.MaxFollowRelays == 0 {
+		config.Access.MaxFollowRelays = 20
+	}
+	if config.Access.WoT.Depth == 0 {
+		config.Access.WoT.Depth = 2
+	}
+	if config.Access.WoT.MaxPubkeys == 0 {
+		config.Access.WoT.MaxPubkeys = 100000
+	}
+	if config.Admin.AnnotationsPath == "" {
+		config.Admin.AnnotationsPath = "data/annotations.json"
+	}
+
+	// Queue defaults
+	if config.Queue.Backend == "" {
+		config.Queue.Backend = "rabbitmq"
+	}
+	if config.Queue.Capacity <= 0 {
+		config.Queue.Capacity = 10000
+	}
+	if config.Queue.Overflow == "" {
+		config.Queue.Overflow = "block"
+	}
+	if config.Queue.BlockTimeout <= 0 {
+		config.Queue.BlockTimeout = 5 * time.Second
+	}
+	if config.Queue.SpillPath == "" {
+		config.Queue.SpillPath = "data/queue-spill.jsonl"
+	}
+
+	// Cache defaults
+	if config.Cache.Backend == "" {
+		config.Cache.Backend = "redis"
+	}
+	if config.Cache.MaxEvents <= 0 {
+		config.Cache.MaxEvents = 100000
+	}
+	if config.Cache.Shards <= 0 {
+		config.Cache.Shards = 16
+	}
+	if config.Cache.TTL == 0 {
+		config.Cache.TTL = config.Redis.TTL
+	}
+	if config.Cache.HistoryDepth == 0 {
+		config.Cache.HistoryDepth = config.Redis.HistoryDepth
+	}
+	if config.Cache.WriteBatchSize <= 0 {
+		config.Cache.WriteBatchSize = 100
+	}
+	if config.Cache.WriteBatchDelay <= 0 {
+		config.Cache.WriteBatchDelay = 50 * time.Millisecond
+	}
+
+	// Storage backend defaults
+	if config.Storage.Backend == "" {
+		switch {
+		case config.XFTP.Enabled:
+			config.Storage.Backend = "xftp"
+		case config.Postgres.Enabled:
+			config.Storage.Backend = "postgres"
+		default:
+			config.Storage.Backend = "none"
+		}
+	}
+	if config.Storage.Path == "" {
+		config.Storage.Path = "data/events"
+	}
+	if config.Storage.WarmupEvents == 0 {
+		config.Storage.WarmupEvents = 10000
+	}
+
+	// Storage compression defaults: long-form articles, wiki pages and
+	// publication sections
+	if len(config.Storage.Compression.Kinds) == 0 {
+		config.Storage.Compression.Kinds = []int{30023, 30024, 30041, 30818}
+	}
+	if config.Storage.Compression.MinSize == 0 {
+		config.Storage.Compression.MinSize = 256
+	}
+	if config.Storage.Compression.DictionaryPath == "" {
+		config.Storage.Compression.DictionaryPath = "data/compression.dict"
+	}
+	if config.Storage.Compression.DictionarySize == 0 {
+		config.Storage.Compression.DictionarySize = 32 * 1024
+	}
+	if config.Storage.Compression.TrainingSamples == 0 {
+		config.Storage.Compression.TrainingSamples = 500
+	}
+
+	// Retention defaults
+	if config.Retention.Interval <= 0 {
+		config.Retention.Interval = time.Hour
+	}
+	if config.Retention.BatchSize <= 0 {
+		config.Retention.BatchSize = 500
+	}
+	for i := range config.Retention.Rules {
+		if config.Retention.Rules[i].Name == "" {
+			config.Retention.Rules[i].Name = fmt.Sprintf("rule %d", i+1)
+		}
+	}
+
+	// Mirror defaults
+	if config.Mirror.SyncInterval == 0 {
+		config.Mirror.SyncInterval = time.Hour
+	}
+	if config.Mirror.PageSize <= 0 {
+		config.Mirror.PageSize = 500
+	}
+	if config.Mirror.FetchTimeout == 0 {
+		config.Mirror.FetchTimeout = 30 * time.Second
+	}
+
+	// Streaming defaults
+	if config.Streaming.ReconnectInterval == 0 {
+		config.Streaming.ReconnectInterval = 5 * time.Second
+	}
+	if config.Streaming.Failover.CheckInterval == 0 {
+		config.Streaming.Failover.CheckInterval = 10 * time.Second
+	}
+	if config.Streaming.Failover.StableAfter == 0 {
+		config.Streaming.Failover.StableAfter = time.Minute
+	}
+	if config.Streaming.Failover.MaxBackoff == 0 {
+		config.Streaming.Failover.MaxBackoff = 10 * time.Minute
+	}
+	if config.Streaming.Failover.MaxErrorRate == 0 {
+		config.Streaming.Failover.MaxErrorRate = 0.5
+	}
+	if config.Streaming.Failover.MaxLatency == 0 {
+		config.Streaming.Failover.MaxLatency = 5 * time.Second
+	}
+	if config.Streaming.MaintenanceBuffer == 0 {
+		config.Streaming.MaintenanceBuffer = 10000
+	}
+	if config.Streaming.Deadlines.Dial == 0 {
+		config.Streaming.Deadlines.Dial = 10 * time.Second
+	}
+	if config.Streaming.Deadlines.Subscribe == 0 {
+		config.Streaming.Deadlines.Subscribe = 10 * time.Second
+	}
+	if config.Streaming.Deadlines.FirstEvent == 0 {
+		config.Streaming.Deadlines.FirstEvent = time.Minute
+	}
+	if config.Streaming.Deadlines.Idle == 0 {
+		config.Streaming.Deadlines.Idle = 5 * time.Minute
+	}
+
+	// Disk monitoring defaults
+	if config.Disk.Interval == 0 {
+		config.Disk.Interval = time.Minute
+	}
+	if config.Disk.WarnPercent == 0 {
+		config.Disk.WarnPercent = 80
+	}
+	if config.Disk.CriticalPercent == 0 {
+		config.Disk.CriticalPercent = 90
+	}
+	if config.Disk.TightenFactor == 0 {
+		config.Disk.TightenFactor = 0.5
+	}
+	if config.Disk.MinTTL == 0 {
+		config.Disk.MinTTL = 24 * time.Hour
+	}
+
+	// Postgres defaults
+	if config.Postgres.Host == "" {
+		config.Postgres.Host = "localhost:5432"
+	}
+	if config.Postgres.MaxConnections == 0 {
+		config.Postgres.MaxConnections = 10
+	}
+
+	// Search defaults
+	if config.Search.MaxDocuments == 0 {
+		config.Search.MaxDocuments = 100000
+	}
+	if config.Search.Language == "" {
+		config.Search.Language = "simple"
+	}
+	if config.Search.Ranking == "" {
+		config.Search.Ranking = "relevance"
+	}
+
+	// Push notification defaults
+	if config.Push.Path == "" {
+		config.Push.Path = "./data/push.json"
+	}
+	if config.Push.MaxPerUser == 0 {
+		config.Push.MaxPerUser = 10
+	}
+	if config.Push.BatchWindow == 0 {
+		config.Push.BatchWindow = 30 * time.Second
+	}
+	if config.Push.MaxBatch == 0 {
+		config.Push.MaxBatch = 50
+	}
+	if config.Push.MaxBackoff == 0 {
+		config.Push.MaxBackoff = time.Hour
+	}
+	if config.Push.Timeout == 0 {
+		config.Push.Timeout = 10 * time.Second
+	}
+
+	// Cluster defaults
+	if config.Cluster.LeaseTTL == 0 {
+		config.Cluster.LeaseTTL = 15 * time.Second
+	}
+
+	// Large object defaults
+	if config.LargeObjects.Threshold == 0 {
+		config.LargeObjects.Threshold = 64 * 1024
+	}
+	if config.LargeObjects.MaxEventSize == 0 {
+		config.LargeObjects.MaxEventSize = 16 * 1024 * 1024
+	}
+	if config.LargeObjects.Path == "" {
+		config.LargeObjects.Path = "./data/large"
+	}
+
+	// Live activity defaults
+	if config.Live.StaleAfter == 0 {
+		config.Live.StaleAfter = time.Hour
+	}
+
+	// Negentropy sync defaults
+	if config.Sync.MaxEvents == 0 {
+		config.Sync.MaxEvents = 500000
+	}
+	if config.Sync.MaxSessions == 0 {
+		config.Sync.MaxSessions = 4
+	}
+
+	// Block list defaults
+	if config.BlockLists.RefreshInterval == 0 {
+		config.BlockLists.RefreshInterval = time.Hour
+	}
+	if config.BlockLists.FetchTimeout == 0 {
+		config.BlockLists.FetchTimeout = 30 * time.Second
+	}
+	if config.BlockLists.Path == "" {
+		config.BlockLists.Path = "./data/block_lists.json"
+	}
+
+	// Profiling defaults
+	if config.Profiling.Interval == 0 {
+		config.Profiling.Interval = 30 * time.Second
+	}
+	if config.Profiling.TopN == 0 {
+		config.Profiling.TopN = 10
+	}
+	if config.Profiling.MutexFraction == 0 {
+		config.Profiling.MutexFraction = 100
+	}
+
+	// Archive defaults
+	if config.Archive.Interval == 0 {
+		config.Archive.Interval = time.Hour
+	}
+	if config.Archive.FinalizeAfter == 0 {
+		config.Archive.FinalizeAfter = 24 * time.Hour
+	}
+
+	// Trust label defaults
+	if config.Streaming.TrustLabels.NIP05TTL == 0 {
+		config.Streaming.TrustLabels.NIP05TTL = 24 * time.Hour
+	}
+	if config.Streaming.TrustLabels.NIP05Timeout == 0 {
+		config.Streaming.TrustLabels.NIP05Timeout = 5 * time.Second
+	}
+
+	// Relay identity defaults
+	if config.Identity.KeyPath == "" {
+		config.Identity.KeyPath = "./data/relay.key"
+	}
+
+	// Logging defaults
+	if config.Logging.Level == "" {
+		config.Logging.Level = "info"
+	}
+	if config.Logging.Format == "" {
+		config.Logging.Format = "text"
+	}
+
+	// Tracing defaults
+	if config.Tracing.Exporter == "" {
+		config.Tracing.Exporter = "otlp"
+	}
+	if config.Tracing.Endpoint == "" && config.Tracing.Exporter != "stdout" {
+		config.Tracing.Endpoint = "http://localhost:4318/v1/traces"
+	}
+	if config.Tracing.ServiceName == "" {
+		config.Tracing.ServiceName = "mercury-relay"
+	}
+	if config.Tracing.SampleRate == 0 {
+		config.Tracing.SampleRate = 1
+	}
+	if config.Tracing.BatchSize == 0 {
+		config.Tracing.BatchSize = 512
+	}
+	if config.Tracing.FlushInterval == 0 {
+		config.Tracing.FlushInterval = 5 * time.Second
+	}
+	if config.Tracing.Timeout == 0 {
+		config.Tracing.Timeout = 10 * time.Second
+	}
+
+	// Outbox defaults
+	if config.Outbox.Timeout == 0 {
+		config.Outbox.Timeout = 10 * time.Second
+	}
+	if config.Outbox.MaxBackoff == 0 {
+		config.Outbox.MaxBackoff = time.Hour
+	}
+	if config.Outbox.MaxPending == 0 {
+		config.Outbox.MaxPending = 1000
+	}
+
+	// Dedup defaults
+	if config.Dedup.Backend == "" {
+		config.Dedup.Backend = "memory"
+	}
+	if config.Dedup.Size == 0 {
+		config.Dedup.Size = 100000
+	}
+	if config.Dedup.TTL == 0 {
+		config.Dedup.TTL = 24 * time.Hour
+	}
+
+	// Backup defaults
+	if config.Backup.Interval == 0 {
+		config.Backup.Interval = 24 * time.Hour
+	}
+	if config.Backup.Path == "" {
+		config.Backup.Path = "./data/backups"
+	}
+	if config.Backup.Keep == 0 {
+		config.Backup.Keep = 7
+	}
+	if config.Payments.Path == "" {
+		config.Payments.Path = "data/payments.json"
+	}
+	if config.Payments.InvoiceExpiry == 0 {
+		config.Payments.InvoiceExpiry = time.Hour
+	}
+	if config.Payments.PollInterval == 0 {
+		config.Payments.PollInterval = 10 * time.Second
+	}
+
+	// Rejection log defaults
+	if config.Logging.Rejections.SampleRate == 0 {
+		config.Logging.Rejections.SampleRate = 1
+	}
+	if config.Logging.Rejections.BufferSize == 0 {
+		config.Logging.Rejections.BufferSize = 500
+	}
+
+	// Trending defaults
+	if config.Trending.Window == 0 {
+		config.Trending.Window = 7 * 24 * time.Hour
+	}
+	if config.Trending.HalfLife == 0 {
+		config.Trending.HalfLife = 6 * time.Hour
+	}
+	if config.Trending.CacheTTL == 0 {
+		config.Trending.CacheTTL = time.Minute
+	}
+	if config.Trending.MaxTargets == 0 {
+		config.Trending.MaxTargets = 100000
+	}
+
+	// Public mirror defaults
+	if config.RESTAPI.PublicMirror.RefreshInterval == 0 {
+		config.RESTAPI.PublicMirror.RefreshInterval = 5 * time.Minute
+	}
+	if config.RESTAPI.PublicMirror.MaxAge == 0 {
+		config.RESTAPI.PublicMirror.MaxAge = time.Hour
+	}
+	if config.RESTAPI.PublicMirror.StaleTTL == 0 {
+		config.RESTAPI.PublicMirror.StaleTTL = 24 * time.Hour
+	}
+	if config.RESTAPI.PublicMirror.Limit == 0 {
+		config.RESTAPI.PublicMirror.Limit = 200
+	}
+	if config.RESTAPI.PublicMirror.MaxViews == 0 {
+		config.RESTAPI.PublicMirror.MaxViews = 1000
+	}
+
+	// Publish idempotency defaults
+	if config.RESTAPI.Idempotency.Window == 0 {
+		config.RESTAPI.Idempotency.Window = 24 * time.Hour
+	}
+	if config.RESTAPI.Idempotency.Path == "" {
+		config.RESTAPI.Idempotency.Path = "./data/idempotency.jsonl"
+	}
+
+	// Live stream defaults
+	if config.RESTAPI.Stream.MaxStreams == 0 {
+		config.RESTAPI.Stream.MaxStreams = 500
+	}
+	if config.RESTAPI.Stream.MaxStreamsPerClient == 0 {
+		config.RESTAPI.Stream.MaxStreamsPerClient = 5
+	}
+	if config.RESTAPI.Stream.MaxFilterValues == 0 {
+		config.RESTAPI.Stream.MaxFilterValues = 500
+	}
+
+	// Reputation defaults
+	if config.Reputation.DenyListAction == "" {
+		config.Reputation.DenyListAction = "deny"
+	}
+	if config.Reputation.DNSBLAction == "" {
+		config.Reputation.DNSBLAction = "require_auth"
+	}
+	if config.Reputation.DNSBLTimeout == 0 {
+		config.Reputation.DNSBLTimeout = time.Second
+	}
+	if config.Reputation.CacheTTL == 0 {
+		config.Reputation.CacheTTL = time.Hour
+	}
+	if config.Reputation.RateLimitDivisor == 0 {
+		config.Reputation.RateLimitDivisor = 10
+	}
 
 	// Quality defaults
 	if config.Quality.MaxContentLength == 0 {
@@ -280,6 +1566,39 @@ func setDefaults(config *Config) {
 	if config.Quality.SpamThreshold == 0 {
 		config.Quality.SpamThreshold = 0.7
 	}
+	if config.Quality.Moderation.Backend == "" {
+		config.Quality.Moderation.Backend = "file"
+	}
+	if config.Quality.Moderation.Path == "" {
+		config.Quality.Moderation.Path = "./data/moderation.json"
+	}
+	if config.Quality.Quarantine.Path == "" {
+		config.Quality.Quarantine.Path = "./data/quarantine.json"
+	}
+	if config.Quality.Quarantine.ExpireAfter == 0 {
+		config.Quality.Quarantine.ExpireAfter = 7 * 24 * time.Hour
+	}
+	if config.Quality.Quarantine.MaxItems == 0 {
+		config.Quality.Quarantine.MaxItems = 10000
+	}
+	if config.Quality.Probation.Path == "" {
+		config.Quality.Probation.Path = "./data/pubkeys.json"
+	}
+	if config.Quality.Probation.Age == 0 {
+		config.Quality.Probation.Age = 72 * time.Hour
+	}
+	if config.Quality.Probation.CleanEvents == 0 {
+		config.Quality.Probation.CleanEvents = 50
+	}
+	if config.Quality.Probation.RateLimitPerMinute == 0 {
+		config.Quality.Probation.RateLimitPerMinute = 5
+	}
+	if config.Quality.Probation.QuarantineAfter == 0 {
+		config.Quality.Probation.QuarantineAfter = 20
+	}
+	if config.Quality.Probation.VelocityWindow == 0 {
+		config.Quality.Probation.VelocityWindow = 10 * time.Minute
+	}
 
 	// RabbitMQ defaults
 	if config.RabbitMQ.ExchangeName == "" {
@@ -332,6 +1651,12 @@ func setDefaults(config *Config) {
 	if config.SSH.TerminalInterface.LogLevel == "" {
 		config.SSH.TerminalInterface.LogLevel = "info"
 	}
+	if config.SSH.TerminalInterface.MaxAuthAttempts == 0 {
+		config.SSH.TerminalInterface.MaxAuthAttempts = 5
+	}
+	if config.SSH.TerminalInterface.AuthWindow == 0 {
+		config.SSH.TerminalInterface.AuthWindow = 15 * time.Minute
+	}
 
 	// SSH authentication defaults
 	if config.SSH.Authentication.APIKey == "" {
@@ -367,6 +1692,9 @@ func applyEnvOverrides(config *Config) {
 			config.Server.Port = p
 		}
 	}
+	if mute := os.Getenv("MERCURY_ENFORCE_MUTE_LISTS"); mute != "" {
+		config.Server.EnforceMuteLists = mute == "true"
+	}
 
 	// Access config
 	if adminNpubs := os.Getenv("MERCURY_ADMIN_NPUBS"); adminNpubs != "" {
@@ -379,6 +1707,14 @@ func applyEnvOverrides(config *Config) {
 	if url := os.Getenv("ACCESS_RELAY_URL"); url != "" {
 		config.Access.RelayURL = url
 	}
+	if urls := os.Getenv("ACCESS_RELAY_URLS"); urls != "" {
+		config.Access.RelayURLs = nil
+		for _, url := range strings.Split(urls, ",") {
+			if url = strings.TrimSpace(url); url != "" {
+				config.Access.RelayURLs = append(config.Access.RelayURLs, url)
+			}
+		}
+	}
 	if read := os.Getenv("ACCESS_PUBLIC_READ"); read != "" {
 		config.Access.AllowPublicRead = read == "true"
 	}
@@ -390,6 +1726,15 @@ func applyEnvOverrides(config *Config) {
 			config.Access.UpdateInterval = d
 		}
 	}
+	if kinds := os.Getenv("ACCESS_ANONYMOUS_WRITE_KINDS"); kinds != "" {
+		// Parse comma-separated kinds
+		config.Access.AnonymousWriteKinds = nil
+		for _, kind := range strings.Split(kinds, ",") {
+			if k, err := strconv.Atoi(strings.TrimSpace(kind)); err == nil {
+				config.Access.AnonymousWriteKinds = append(config.Access.AnonymousWriteKinds, k)
+			}
+		}
+	}
 
 	// Admin config
 	if port := os.Getenv("ADMIN_PORT"); port != "" {
@@ -485,6 +1830,9 @@ func applyEnvOverrides(config *Config) {
 	if xftp := os.Getenv("XFTP_ENABLED"); xftp != "" {
 		config.XFTP.Enabled = xftp == "true"
 	}
+	if compression := os.Getenv("STORAGE_COMPRESSION"); compression != "" {
+		config.Storage.Compression.Enabled = compression == "true"
+	}
 
 	// Quality config
 	if rate := os.Getenv("RATE_LIMIT_PER_MINUTE"); rate != "" {
@@ -506,6 +1854,29 @@ func applyEnvOverrides(config *Config) {
 		}
 	}
 
+	// Cache config
+	if backend := os.Getenv("CACHE_BACKEND"); backend != "" {
+		config.Cache.Backend = backend
+	}
+
+	// Logging config
+	if level := os.Getenv("LOG_LEVEL"); level != "" {
+		config.Logging.Level = level
+	}
+	if format := os.Getenv("LOG_FORMAT"); format != "" {
+		config.Logging.Format = format
+	}
+
+	// Tracing config
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		config.Tracing.Endpoint = endpoint
+	}
+
+	// Queue config
+	if backend := os.Getenv("QUEUE_BACKEND"); backend != "" {
+		config.Queue.Backend = backend
+	}
+
 	// RabbitMQ config
 	if host := os.Getenv("RABBITMQ_HOST"); host != "" {
 		username := os.Getenv("RABBITMQ_USERNAME")
@@ -547,6 +1918,145 @@ func (c *Config) Validate() error {
 	if c.Access.UpdateInterval < 0 {
 		return fmt.Errorf("invalid access config: negative update interval")
 	}
+	if c.Access.QueryTimeout < 0 {
+		return fmt.Errorf("invalid access config: negative query timeout")
+	}
+	if c.Access.WoT.Enabled {
+		// Beyond four hops the graph is most of the network
+		if c.Access.WoT.Depth < 1 || c.Access.WoT.Depth > 4 {
+			return fmt.Errorf("invalid access config: wot depth must be between 1 and 4")
+		}
+		for depth, multiplier := range c.Access.WoT.RateMultipliers {
+			if depth < 1 || depth > c.Access.WoT.Depth {
+				return fmt.Errorf("invalid access config: wot rate multiplier for depth %d beyond depth %d", depth, c.Access.WoT.Depth)
+			}
+			if multiplier <= 0 {
+				return fmt.Errorf("invalid access config: wot rate multiplier for depth %d must be positive", depth)
+			}
+		}
+	}
+	for _, kind := range c.Access.AnonymousWriteKinds {
+		if kind < 0 || kind > 65535 {
+			return fmt.Errorf("invalid access config: anonymous write kind %d", kind)
+		}
+	}
+
+	// Validate cache config
+	if c.Cache.Backend != "" && c.Cache.Backend != "redis" && c.Cache.Backend != "memory" {
+		return fmt.Errorf("invalid cache config: unknown backend %q", c.Cache.Backend)
+	}
+
+	// Validate logging config
+	switch strings.ToLower(c.Logging.Level) {
+	case "", "debug", "info", "warn", "warning", "error":
+	default:
+		return fmt.Errorf("invalid logging config: unknown level %q", c.Logging.Level)
+	}
+	switch strings.ToLower(c.Logging.Format) {
+	case "", "text", "json":
+	default:
+		return fmt.Errorf("invalid logging config: unknown format %q", c.Logging.Format)
+	}
+
+	// Validate tracing config
+	switch c.Tracing.Exporter {
+	case "", "otlp", "jaeger", "stdout":
+	default:
+		return fmt.Errorf("invalid tracing config: unknown exporter %q", c.Tracing.Exporter)
+	}
+	if c.Tracing.SampleRate > 1 {
+		return fmt.Errorf("invalid tracing config: sample_rate must be at most 1")
+	}
+
+	// Validate upstream filters
+	for _, relay := range c.Streaming.UpstreamRelays {
+		for _, filter := range relay.Filters {
+			for _, kind := range filter.Kinds {
+				if kind < 0 || kind > 65535 {
+					return fmt.Errorf("invalid streaming config: filter kind %d for %s", kind, relay.URL)
+				}
+			}
+			for name := range filter.Tags {
+				if len(strings.TrimPrefix(name, "#")) != 1 {
+					return fmt.Errorf("invalid streaming config: filter tag %q for %s must be a single letter", name, relay.URL)
+				}
+			}
+		}
+	}
+
+	// Validate upstream failover config
+	if c.Streaming.Failover.MaxActive < 0 {
+		return fmt.Errorf("invalid streaming config: negative failover max_active")
+	}
+	if c.Streaming.Failover.MaxErrorRate > 1 {
+		return fmt.Errorf("invalid streaming config: failover max_error_rate must be at most 1")
+	}
+
+	// Validate outbox config
+	if c.Outbox.Enabled && len(c.Outbox.Relays) == 0 && !c.Outbox.UseRelayList {
+		return fmt.Errorf("invalid outbox config: no relays and use_relay_list is off")
+	}
+	for _, relay := range c.Outbox.Relays {
+		if !strings.HasPrefix(relay, "ws://") && !strings.HasPrefix(relay, "wss://") {
+			return fmt.Errorf("invalid outbox config: relay %q must be a ws:// or wss:// URL", relay)
+		}
+	}
+
+	// Validate dedup config
+	if c.Dedup.Backend != "" && c.Dedup.Backend != "memory" && c.Dedup.Backend != "redis" {
+		return fmt.Errorf("invalid dedup config: unknown backend %q", c.Dedup.Backend)
+	}
+	if c.Dedup.Enabled && c.Dedup.Size < 0 && c.Dedup.Backend != "redis" {
+		return fmt.Errorf("invalid dedup config: the memory backend needs a positive size")
+	}
+
+	// Validate backup config
+	if c.Backup.Enabled && c.Backup.Interval < time.Minute {
+		return fmt.Errorf("invalid backup config: interval must be at least a minute")
+	}
+
+	// Validate payments config
+	if c.Payments.Enabled {
+		if c.Payments.Price < 0 || c.Payments.ZapThreshold < 0 || c.Payments.Duration < 0 {
+			return fmt.Errorf("invalid payments config: negative price, zap threshold or duration")
+		}
+		switch c.Payments.Backend {
+		case "":
+			if c.Payments.Price > 0 {
+				return fmt.Errorf("invalid payments config: a price needs a backend")
+			}
+		case "lnurl":
+			if c.Payments.LNURL.Address == "" {
+				return fmt.Errorf("invalid payments config: lnurl backend needs an address")
+			}
+		case "lnd":
+			if c.Payments.LND.URL == "" || c.Payments.LND.Macaroon == "" {
+				return fmt.Errorf("invalid payments config: lnd backend needs a url and macaroon")
+			}
+		case "cln":
+			if c.Payments.CLN.URL == "" || c.Payments.CLN.Rune == "" {
+				return fmt.Errorf("invalid payments config: cln backend needs a url and rune")
+			}
+		default:
+			return fmt.Errorf("invalid payments config: unknown backend %q", c.Payments.Backend)
+		}
+		if c.Payments.Backend != "" && c.Payments.Price == 0 {
+			return fmt.Errorf("invalid payments config: backend %s needs a price", c.Payments.Backend)
+		}
+		if c.Payments.ZapThreshold > 0 && len(c.Payments.ZapProviders) == 0 {
+			return fmt.Errorf("invalid payments config: a zap threshold needs zap providers")
+		}
+	}
+
+	// Validate queue config
+	if c.Queue.Backend != "" && c.Queue.Backend != "rabbitmq" && c.Queue.Backend != "memory" {
+		return fmt.Errorf("invalid queue config: unknown backend %q", c.Queue.Backend)
+	}
+	switch c.Queue.Overflow {
+	case "", "block", "drop_newest", "drop_oldest", "spill":
+	default:
+		return fmt.Errorf("invalid queue config: unknown overflow policy %q", c.Queue.Overflow)
+	}
 
 	// Validate quality config
 	if c.Quality.MaxContentLength <= 0 {
@@ -558,6 +2068,75 @@ func (c *Config) Validate() error {
 	if c.Quality.SpamThreshold < 0 || c.Quality.SpamThreshold > 1 {
 		return fmt.Errorf("invalid quality config: spam threshold %f", c.Quality.SpamThreshold)
 	}
+	switch c.Quality.Moderation.Backend {
+	case "", "file", "redis", "none":
+	default:
+		return fmt.Errorf("invalid quality config: unknown moderation backend %q", c.Quality.Moderation.Backend)
+	}
+
+	// Validate reputation actions
+	for _, action := range []string{c.Reputation.DenyListAction, c.Reputation.DNSBLAction} {
+		if action != "" && action != "deny" && action != "require_auth" && action != "rate_limit" {
+			return fmt.Errorf("invalid reputation config: unknown action %q", action)
+		}
+	}
+
+	// Validate retention rules
+	for _, rule := range c.Retention.Rules {
+		switch rule.AuthorClass {
+		case "", "owner", "writer", "other":
+		default:
+			return fmt.Errorf("invalid retention config: unknown author class %q", rule.AuthorClass)
+		}
+		if rule.TTL < 0 {
+			return fmt.Errorf("invalid retention config: negative ttl for %q", rule.Name)
+		}
+	}
+	if c.Retention.DefaultTTL < 0 {
+		return fmt.Errorf("invalid retention config: negative default ttl")
+	}
+
+	// Validate storage backend
+	switch c.Storage.Backend {
+	case "", "none", "xftp", "postgres", "file", "sqlite":
+	default:
+		return fmt.Errorf("invalid storage config: unknown backend %q", c.Storage.Backend)
+	}
+
+	// Validate postgres TLS mode
+	switch c.Postgres.SSLMode {
+	case "", "disable", "prefer", "require", "verify-full":
+	default:
+		return fmt.Errorf("invalid postgres config: unsupported sslmode %q", c.Postgres.SSLMode)
+	}
+
+	// Validate search analysis and ranking
+	if c.Search.Language != "" && c.Search.Language != "simple" && c.Search.Language != "english" {
+		return fmt.Errorf("invalid search config: unknown language %q", c.Search.Language)
+	}
+	if c.Search.Ranking != "" && c.Search.Ranking != "relevance" && c.Search.Ranking != "recent" {
+		return fmt.Errorf("invalid search config: unknown ranking %q", c.Search.Ranking)
+	}
+
+	// Validate large object limits
+	if c.LargeObjects.Enabled && c.LargeObjects.Threshold >= c.LargeObjects.MaxEventSize {
+		return fmt.Errorf("invalid large objects config: threshold %d is not below max event size %d", c.LargeObjects.Threshold, c.LargeObjects.MaxEventSize)
+	}
+
+	// Validate forwarding rules
+	if c.Forwarding.Enabled {
+		for _, rule := range c.Forwarding.Rules {
+			if rule.Target != "mqtt" && rule.Target != "amqp" {
+				return fmt.Errorf("invalid forwarding rule %q: unknown target %q", rule.Name, rule.Target)
+			}
+			if rule.Topic == "" {
+				return fmt.Errorf("invalid forwarding rule %q: topic is required", rule.Name)
+			}
+			if rule.QoS > 2 {
+				return fmt.Errorf("invalid forwarding rule %q: qos %d", rule.Name, rule.QoS)
+			}
+		}
+	}
 
 	return nil
 }
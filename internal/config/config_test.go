@@ -240,6 +240,18 @@ server:
 		helpers.AssertIntEqual(t, 10000, cfg.Quality.MaxContentLength)      // Default
 		helpers.AssertIntEqual(t, 100, cfg.Quality.RateLimitPerMinute)      // Default
 		helpers.AssertFloat64Equal(t, 0.7, cfg.Quality.SpamThreshold, 0.01) // Default
+		helpers.AssertStringEqual(t, "redis", cfg.Cache.Backend)            // Default
+		helpers.AssertIntEqual(t, 100000, cfg.Cache.MaxEvents)              // Default
+		helpers.AssertStringEqual(t, "rabbitmq", cfg.Queue.Backend)         // Default
+		helpers.AssertStringEqual(t, "block", cfg.Queue.Overflow)           // Default
+		helpers.AssertStringEqual(t, "info", cfg.Logging.Level)             // Default
+		helpers.AssertStringEqual(t, "text", cfg.Logging.Format)            // Default
+		helpers.AssertStringEqual(t, "otlp", cfg.Tracing.Exporter)          // Default
+		helpers.AssertFloat64Equal(t, 1, cfg.Tracing.SampleRate, 0.01)      // Default
+		helpers.AssertBoolEqual(t, false, cfg.Storage.Compression.Enabled)  // Default
+		helpers.AssertIntEqual(t, 4, len(cfg.Storage.Compression.Kinds))    // Default
+		helpers.AssertBoolEqual(t, false, cfg.Mirror.Enabled)               // Default
+		helpers.AssertIntEqual(t, 500, cfg.Mirror.PageSize)                 // Default
 	})
 
 	t.Run("Invalid config values", func(t *testing.T) {
@@ -354,43 +366,125 @@ func TestConfigValidation(t *testing.T) {
 		helpers.AssertError(t, err)
 		helpers.AssertErrorContains(t, err, "invalid quality config")
 	})
+
+	t.Run("Unknown cache backend", func(t *testing.T) {
+		cfg := &Config{
+			Server: ServerConfig{
+				Host: "localhost",
+				Port: 8080,
+			},
+			Cache: CacheConfig{Backend: "memcached"},
+		}
+
+		err := cfg.Validate()
+		helpers.AssertError(t, err)
+		helpers.AssertErrorContains(t, err, "invalid cache config")
+	})
+
+	t.Run("Large object threshold above max event size", func(t *testing.T) {
+		cfg := &Config{
+			Server:       ServerConfig{Host: "localhost", Port: 8080},
+			Quality:      QualityConfig{MaxContentLength: 10000, RateLimitPerMinute: 100},
+			LargeObjects: LargeObjectConfig{Enabled: true, Threshold: 1 << 20, MaxEventSize: 1 << 16},
+		}
+
+		err := cfg.Validate()
+		helpers.AssertError(t, err)
+		helpers.AssertErrorContains(t, err, "invalid large objects config")
+	})
+
+	t.Run("Upstream filter tag longer than a letter", func(t *testing.T) {
+		cfg := &Config{
+			Server:  ServerConfig{Host: "localhost", Port: 8080},
+			Quality: QualityConfig{MaxContentLength: 10000, RateLimitPerMinute: 100},
+			Streaming: StreamingConfig{UpstreamRelays: []UpstreamRelay{{
+				URL:     "wss://relay.example.com",
+				Filters: []UpstreamFilter{{Kinds: []int{30040}, Tags: map[string][]string{"title": {"x"}}}},
+			}}},
+		}
+
+		err := cfg.Validate()
+		helpers.AssertError(t, err)
+		helpers.AssertErrorContains(t, err, "invalid streaming config")
+	})
+
+	t.Run("WoT rate multiplier beyond the depth", func(t *testing.T) {
+		cfg := &Config{
+			Server:  ServerConfig{Host: "localhost", Port: 8080},
+			Quality: QualityConfig{MaxContentLength: 10000, RateLimitPerMinute: 100},
+			Access: AccessConfig{WoT: WoTAccessConfig{
+				Enabled:         true,
+				Depth:           2,
+				RateMultipliers: map[int]float64{3: 0.25},
+			}},
+		}
+
+		err := cfg.Validate()
+		helpers.AssertErrorContains(t, err, "wot rate multiplier for depth 3")
+
+		cfg.Access.WoT.RateMultipliers = map[int]float64{2: 0}
+		helpers.AssertErrorContains(t, cfg.Validate(), "must be positive")
+
+		cfg.Access.WoT.RateMultipliers = map[int]float64{2: 0.5}
+		helpers.AssertNoError(t, cfg.Validate())
+	})
+
+	t.Run("Payments backend without its settings", func(t *testing.T) {
+		cfg := &Config{
+			Server:   ServerConfig{Host: "localhost", Port: 8080},
+			Quality:  QualityConfig{MaxContentLength: 10000, RateLimitPerMinute: 100},
+			Payments: PaymentsConfig{Enabled: true, Price: 21, Backend: "lnd", LND: LNDConfig{URL: "https://localhost:8080"}},
+		}
+
+		helpers.AssertErrorContains(t, cfg.Validate(), "lnd backend needs a url and macaroon")
+
+		cfg.Payments.LND.Macaroon = "abcd"
+		helpers.AssertNoError(t, cfg.Validate())
+
+		cfg.Payments.Price = 0
+		helpers.AssertErrorContains(t, cfg.Validate(), "needs a price")
+
+		cfg.Payments = PaymentsConfig{Enabled: true, ZapThreshold: 1000}
+		helpers.AssertErrorContains(t, cfg.Validate(), "zap threshold needs zap providers")
+	})
 }
 
 func TestConfigEnvironmentVariables(t *testing.T) {
 	t.Run("All environment variables", func(t *testing.T) {
 		// Set all environment variables
 		envVars := map[string]string{
-			"MERCURY_ADMIN_NPUBS":    "npub1env",
-			"NOSTR_RELAY_PORT":       "9090",
-			"ADMIN_PORT":             "9091",
-			"REST_API_PORT":          "9092",
-			"LOG_LEVEL":              "debug",
-			"STREAMING_ENABLED":      "true",
-			"UPSTREAM_RELAYS":        "wss://relay1.com,wss://relay2.com",
-			"TOR_ENABLED":            "true",
-			"TOR_SOCKS_PORT":         "9050",
-			"TOR_CONTROL_PORT":       "9051",
-			"I2P_ENABLED":            "true",
-			"I2P_SAM_PORT":           "7656",
-			"XFTP_ENABLED":           "true",
-			"XFTP_PORT":              "8443",
-			"XFTP_MAX_FILE_SIZE":     "100MB",
-			"API_KEY":                "secret-key",
-			"CORS_ENABLED":           "true",
-			"RATE_LIMIT_PER_MINUTE":  "200",
-			"ACCESS_PUBLIC_READ":     "true",
-			"ACCESS_PUBLIC_WRITE":    "false",
-			"ACCESS_UPDATE_INTERVAL": "2h",
-			"ACCESS_RELAY_URL":       "https://custom-relay.com",
-			"REDIS_HOST":             "redis.example.com",
-			"REDIS_PORT":             "6380",
-			"REDIS_PASSWORD":         "redis-pass",
-			"REDIS_DB":               "5",
-			"RABBITMQ_HOST":          "rabbit.example.com",
-			"RABBITMQ_PORT":          "5673",
-			"RABBITMQ_USERNAME":      "rabbit-user",
-			"RABBITMQ_PASSWORD":      "rabbit-pass",
-			"RABBITMQ_VHOST":         "/custom",
+			"MERCURY_ADMIN_NPUBS":          "npub1env",
+			"NOSTR_RELAY_PORT":             "9090",
+			"ADMIN_PORT":                   "9091",
+			"REST_API_PORT":                "9092",
+			"LOG_LEVEL":                    "debug",
+			"STREAMING_ENABLED":            "true",
+			"UPSTREAM_RELAYS":              "wss://relay1.com,wss://relay2.com",
+			"TOR_ENABLED":                  "true",
+			"TOR_SOCKS_PORT":               "9050",
+			"TOR_CONTROL_PORT":             "9051",
+			"I2P_ENABLED":                  "true",
+			"I2P_SAM_PORT":                 "7656",
+			"XFTP_ENABLED":                 "true",
+			"XFTP_PORT":                    "8443",
+			"XFTP_MAX_FILE_SIZE":           "100MB",
+			"API_KEY":                      "secret-key",
+			"CORS_ENABLED":                 "true",
+			"RATE_LIMIT_PER_MINUTE":        "200",
+			"ACCESS_PUBLIC_READ":           "true",
+			"ACCESS_PUBLIC_WRITE":          "false",
+			"ACCESS_UPDATE_INTERVAL":       "2h",
+			"ACCESS_RELAY_URL":             "https://custom-relay.com",
+			"ACCESS_ANONYMOUS_WRITE_KINDS": "7, 9735",
+			"REDIS_HOST":                   "redis.example.com",
+			"REDIS_PORT":                   "6380",
+			"REDIS_PASSWORD":               "redis-pass",
+			"REDIS_DB":                     "5",
+			"RABBITMQ_HOST":                "rabbit.example.com",
+			"RABBITMQ_PORT":                "5673",
+			"RABBITMQ_USERNAME":            "rabbit-user",
+			"RABBITMQ_PASSWORD":            "rabbit-pass",
+			"RABBITMQ_VHOST":               "/custom",
 		}
 
 		for key, value := range envVars {
@@ -439,6 +533,8 @@ server:
 		helpers.AssertBoolEqual(t, false, cfg.Access.AllowPublicWrite)
 		helpers.AssertDurationEqual(t, 2*time.Hour, cfg.Access.UpdateInterval)
 		helpers.AssertStringEqual(t, "https://custom-relay.com", cfg.Access.RelayURL)
+		helpers.AssertIntEqual(t, 2, len(cfg.Access.AnonymousWriteKinds))
+		helpers.AssertIntEqual(t, 9735, cfg.Access.AnonymousWriteKinds[1])
 		helpers.AssertStringEqual(t, "redis.example.com", cfg.Redis.Host)
 		helpers.AssertStringEqual(t, "redis-pass", cfg.Redis.Password)
 		helpers.AssertIntEqual(t, 5, cfg.Redis.DB)
@@ -502,3 +598,74 @@ func TestConfigEmptyFile(t *testing.T) {
 		helpers.AssertBoolEqual(t, false, cfg.Access.AllowPublicWrite)
 	})
 }
+
+func TestConfigProfiles(t *testing.T) {
+	writeConfig := func(t *testing.T, content string) string {
+		path := t.TempDir() + "/config.yaml"
+		helpers.AssertNoError(t, os.WriteFile(path, []byte(content), 0644))
+		return path
+	}
+
+	t.Run("Every profile loads and validates", func(t *testing.T) {
+		for _, profile := range Profiles() {
+			cfg, err := LoadProfile("", profile.Name)
+			helpers.AssertNoError(t, err)
+			helpers.AssertStringEqual(t, profile.Name, cfg.Profile)
+			helpers.AssertNoError(t, cfg.Validate())
+		}
+		helpers.AssertIntEqual(t, 5, len(Profiles()))
+	})
+
+	t.Run("Profile presets subsystems", func(t *testing.T) {
+		cfg, err := LoadProfile("", "dm-inbox")
+		helpers.AssertNoError(t, err)
+		helpers.AssertFalse(t, cfg.Streaming.Enabled)
+		helpers.AssertIntEqual(t, 3, len(cfg.Access.AnonymousWriteKinds))
+		helpers.AssertTrue(t, cfg.Cache.TTL == 2160*time.Hour)
+
+		cfg, err = LoadProfile("", "library")
+		helpers.AssertNoError(t, err)
+		helpers.AssertTrue(t, cfg.RESTAPI.PublicMirror.Enabled)
+		helpers.AssertTrue(t, cfg.Storage.Compression.Enabled)
+	})
+
+	t.Run("Config file overrides the profile", func(t *testing.T) {
+		path := writeConfig(t, `
+profile: community
+access:
+  writer_approval: false
+redis:
+  ttl: 24h
+`)
+		cfg, err := Load(path)
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, "community", cfg.Profile)
+		helpers.AssertFalse(t, cfg.Access.WriterApproval)
+		helpers.AssertTrue(t, cfg.Redis.TTL == 24*time.Hour)
+		// Untouched profile settings remain
+		helpers.AssertTrue(t, cfg.Reputation.Enabled)
+		helpers.AssertIntEqual(t, 120, cfg.RESTAPI.RateLimitPerMinute)
+	})
+
+	t.Run("Flag beats the file's profile key", func(t *testing.T) {
+		path := writeConfig(t, "profile: community\n")
+		cfg, err := LoadProfile(path, "archive")
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, "archive", cfg.Profile)
+		helpers.AssertIntEqual(t, 500, cfg.Cache.WriteBatchSize)
+	})
+
+	t.Run("Environment selects a profile", func(t *testing.T) {
+		t.Setenv("MERCURY_PROFILE", "personal")
+		cfg, err := Load("")
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, "personal", cfg.Profile)
+		helpers.AssertFalse(t, cfg.Streaming.Enabled)
+	})
+
+	t.Run("Unknown profile", func(t *testing.T) {
+		_, err := LoadProfile("", "enterprise")
+		helpers.AssertError(t, err)
+		helpers.AssertErrorContains(t, err, "unknown config profile")
+	})
+}
@@ -0,0 +1,173 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ErrUnknownProfile is returned for a profile name that isn't defined
+var ErrUnknownProfile = fmt.Errorf("unknown config profile")
+
+// Profile presets access, retention, quality and subsystems for a common
+// deployment shape. Its settings are applied before the config file, so
+// anything the file sets explicitly wins.
+type Profile struct {
+	Name        string
+	Description string
+	Settings    string // YAML in config file layout
+}
+
+var profiles = map[string]Profile{
+	"personal": {
+		Name:        "personal",
+		Description: "One person's relay: only the owner and their follows write, events are kept for a year, no upstream ingest",
+		Settings: `
+access:
+  allow_public_read: true
+  allow_public_write: false
+  writer_approval: false
+redis:
+  ttl: 8760h
+quality:
+  rate_limit_per_minute: 300
+  quarantine_suspicious: false
+streaming:
+  enabled: false
+trending:
+  enabled: false
+reputation:
+  enabled: false
+`,
+	},
+	"community": {
+		Name:        "community",
+		Description: "A group relay: unknown writers wait for admin approval, reports and IP reputation are on, events are kept for 90 days",
+		Settings: `
+access:
+  allow_public_read: true
+  allow_public_write: false
+  writer_approval: true
+redis:
+  ttl: 2160h
+quality:
+  rate_limit_per_minute: 60
+  quarantine_suspicious: true
+  reports:
+    enabled: true
+rest_api:
+  rate_limit_per_minute: 120
+streaming:
+  enabled: true
+trending:
+  enabled: true
+reputation:
+  enabled: true
+`,
+	},
+	"archive": {
+		Name:        "archive",
+		Description: "Long-term copy of upstream relays: ingest from upstream, events are kept for ten years, large write batches, no local writers",
+		Settings: `
+access:
+  allow_public_read: true
+  allow_public_write: false
+redis:
+  ttl: 87600h
+  history_depth: 100
+cache:
+  write_batch_size: 500
+  write_batch_delay: 200ms
+quality:
+  quarantine_suspicious: true
+streaming:
+  enabled: true
+  maintenance_buffer: 100000
+storage:
+  compression:
+    enabled: true
+trending:
+  enabled: false
+`,
+	},
+	"dm-inbox": {
+		Name:        "dm-inbox",
+		Description: "An inbox for direct messages: anyone may deliver encrypted DMs and gift wraps, nothing else is accepted from strangers",
+		Settings: `
+access:
+  allow_public_read: true
+  allow_public_write: false
+  anonymous_write_kinds: [4, 1059, 10050]
+redis:
+  ttl: 2160h
+quality:
+  rate_limit_per_minute: 30
+streaming:
+  enabled: false
+trending:
+  enabled: false
+rest_api:
+  public_mirror:
+    enabled: false
+reputation:
+  enabled: true
+`,
+	},
+	"library": {
+		Name:        "library",
+		Description: "Books and long-form articles: compressed storage, a cached public catalog and trending, events are kept for ten years",
+		Settings: `
+access:
+  allow_public_read: true
+  allow_public_write: false
+  writer_approval: true
+redis:
+  ttl: 87600h
+quality:
+  max_content_length: 200000
+storage:
+  compression:
+    enabled: true
+    kinds: [30023, 30024, 30040, 30041, 30818]
+rest_api:
+  public_mirror:
+    enabled: true
+streaming:
+  enabled: true
+trending:
+  enabled: true
+`,
+	},
+}
+
+// Profiles returns the defined profiles sorted by name
+func Profiles() []Profile {
+	list := make([]Profile, 0, len(profiles))
+	for _, profile := range profiles {
+		list = append(list, profile)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// LookupProfile returns the named profile
+func LookupProfile(name string) (Profile, error) {
+	profile, ok := profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("%w %q", ErrUnknownProfile, name)
+	}
+	return profile, nil
+}
+
+// applyProfile writes the named profile's settings into config
+func applyProfile(config *Config, name string) error {
+	profile, err := LookupProfile(name)
+	if err != nil {
+		return err
+	}
+	if err := yaml.Unmarshal([]byte(profile.Settings), config); err != nil {
+		return fmt.Errorf("failed to apply profile %s: %w", name, err)
+	}
+	return nil
+}
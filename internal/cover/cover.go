@@ -0,0 +1,348 @@
+package cover
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+
+	// DefaultWidth is the cover width in pixels; height is 3:2 portrait
+	DefaultWidth = 600
+	MinWidth     = 100
+	MaxWidth     = 1600
+)
+
+var ErrUnsupportedFormat = fmt.Errorf("unsupported cover format")
+
+// Book is what a generated cover shows. Seed picks the colors, so the same
+// book always gets the same cover; the event ID is a good seed.
+type Book struct {
+	Seed   string
+	Title  string
+	Author string
+}
+
+// ContentType returns the MIME type for format
+func ContentType(format string) string {
+	if format == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// Generator renders typographic covers and keeps the most recent renders
+type Generator struct {
+	maxEntries int
+	entries    map[string][]byte
+	order      []string
+	mu         sync.Mutex
+}
+
+// NewGenerator creates a generator that caches up to maxEntries covers
+func NewGenerator(maxEntries int) *Generator {
+	return &Generator{
+		maxEntries: maxEntries,
+		entries:    make(map[string][]byte),
+	}
+}
+
+// Key identifies a render; it doubles as an HTTP ETag
+func Key(book Book, format string, width int) string {
+	h := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%s\x00%s\x00%s", format, width, book.Seed, book.Title, book.Author)))
+	return hex.EncodeToString(h[:16])
+}
+
+// Render returns the cover for book in format (png or svg) at width pixels
+func (g *Generator) Render(book Book, format string, width int) ([]byte, error) {
+	if width <= 0 {
+		width = DefaultWidth
+	}
+	if width < MinWidth {
+		width = MinWidth
+	}
+	if width > MaxWidth {
+		width = MaxWidth
+	}
+
+	key := Key(book, format, width)
+	g.mu.Lock()
+	if data, ok := g.entries[key]; ok {
+		g.mu.Unlock()
+		return data, nil
+	}
+	g.mu.Unlock()
+
+	var data []byte
+	var err error
+	switch format {
+	case FormatPNG:
+		data, err = PNG(book, width)
+	case FormatSVG:
+		data = SVG(book, width)
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	g.mu.Lock()
+	if _, ok := g.entries[key]; !ok && g.maxEntries > 0 {
+		if len(g.order) >= g.maxEntries {
+			delete(g.entries, g.order[0])
+			g.order = g.order[1:]
+		}
+		g.entries[key] = data
+		g.order = append(g.order, key)
+	}
+	g.mu.Unlock()
+
+	return data, nil
+}
+
+// palette derives the background, accent and text colors from seed
+func palette(seed string) (background, accent, text color.RGBA) {
+	h := sha256.Sum256([]byte(seed))
+	hue := float64(int(h[0])<<8|int(h[1])) / 65536 * 360
+	saturation := 0.35 + float64(h[2])/255*0.25
+	return hsl(hue, saturation, 0.28), hsl(hue, saturation, 0.55), color.RGBA{R: 245, G: 242, B: 232, A: 255}
+}
+
+func hsl(hue, saturation, lightness float64) color.RGBA {
+	c := (1 - math.Abs(2*lightness-1)) * saturation
+	x := c * (1 - math.Abs(math.Mod(hue/60, 2)-1))
+	m := lightness - c/2
+
+	var r, g, b float64
+	switch {
+	case hue < 60:
+		r, g, b = c, x, 0
+	case hue < 120:
+		r, g, b = x, c, 0
+	case hue < 180:
+		r, g, b = 0, c, x
+	case hue < 240:
+		r, g, b = 0, x, c
+	case hue < 300:
+		r, g, b = x, 0, c
+	default:
+		r, g, b = c, 0, x
+	}
+	return color.RGBA{
+		R: uint8(math.Round((r + m) * 255)),
+		G: uint8(math.Round((g + m) * 255)),
+		B: uint8(math.Round((b + m) * 255)),
+		A: 255,
+	}
+}
+
+// wrap breaks text into at most maxLines lines of up to maxChars runes,
+// ending with an ellipsis when it doesn't fit
+func wrap(text string, maxChars, maxLines int) []string {
+	var lines []string
+	var line []rune
+	for _, word := range strings.Fields(text) {
+		w := []rune(word)
+		for len(w) > maxChars {
+			if len(line) > 0 {
+				lines = append(lines, string(line))
+				line = nil
+			}
+			lines = append(lines, string(w[:maxChars]))
+			w = w[maxChars:]
+		}
+		switch {
+		case len(line) == 0:
+			line = w
+		case len(line)+1+len(w) <= maxChars:
+			line = append(append(line, ' '), w...)
+		default:
+			lines = append(lines, string(line))
+			line = w
+		}
+	}
+	if len(line) > 0 {
+		lines = append(lines, string(line))
+	}
+
+	if len(lines) > maxLines {
+		lines = lines[:maxLines]
+		last := []rune(lines[maxLines-1])
+		if len(last) > maxChars-3 {
+			last = last[:maxChars-3]
+			// Prefer cutting at a word boundary
+			if i := strings.LastIndex(string(last), " "); i > 0 {
+				last = []rune(string(last)[:i])
+			}
+		}
+		lines[maxLines-1] = strings.TrimRight(string(last), " ") + "..."
+	}
+	return lines
+}
+
+// layout holds the shared geometry of PNG and SVG covers
+type layout struct {
+	width, height int
+	titleScale    int // bitmap font pixel size
+	authorScale   int
+	titleLines    []string
+	authorLines   []string
+	titleTop      int
+	authorTop     int
+	margin        int
+}
+
+func newLayout(book Book, width int, forBitmap bool) layout {
+	l := layout{
+		width:       width,
+		height:      width * 3 / 2,
+		titleScale:  max(1, width/100),
+		authorScale: max(1, width/160),
+		margin:      width / 12,
+	}
+
+	title, author := book.Title, book.Author
+	if forBitmap {
+		title, author = bitmapText(title), bitmapText(author)
+	}
+	if strings.TrimSpace(title) == "" && !forBitmap {
+		title = "Untitled"
+	}
+
+	usable := l.width - 2*l.margin
+	l.titleLines = wrap(title, max(1, usable/((glyphWidth+1)*l.titleScale)), 5)
+	l.authorLines = wrap(author, max(1, usable/((glyphWidth+1)*l.authorScale)), 2)
+	l.titleTop = l.height / 4
+	l.authorTop = l.height - l.height/5
+	return l
+}
+
+// bitmapText upper-cases s and drops runes the bitmap font can't draw
+func bitmapText(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToUpper(s) {
+		if unicode.IsSpace(r) {
+			b.WriteRune(' ')
+			continue
+		}
+		if _, ok := glyphs[r]; ok {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// PNG renders book as a PNG cover using the built-in bitmap font. Text
+// outside its ASCII coverage is left out; SVG covers keep every character.
+func PNG(book Book, width int) ([]byte, error) {
+	l := newLayout(book, width, true)
+	background, accent, text := palette(book.Seed)
+
+	img := image.NewRGBA(image.Rect(0, 0, l.width, l.height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{C: background}, image.Point{}, draw.Src)
+
+	// Accent bands and a thin frame
+	band := l.height / 40
+	fill(img, image.Rect(0, l.height/10, l.width, l.height/10+band), accent)
+	fill(img, image.Rect(0, l.height-l.height/10-band, l.width, l.height-l.height/10), accent)
+	inset := l.margin / 2
+	frame := max(1, l.width/300)
+	fill(img, image.Rect(inset, inset, l.width-inset, inset+frame), text)
+	fill(img, image.Rect(inset, l.height-inset-frame, l.width-inset, l.height-inset), text)
+	fill(img, image.Rect(inset, inset, inset+frame, l.height-inset), text)
+	fill(img, image.Rect(l.width-inset-frame, inset, l.width-inset, l.height-inset), text)
+
+	y := l.titleTop
+	for _, line := range l.titleLines {
+		drawLine(img, line, y, l.titleScale, text)
+		y += (glyphHeight + 3) * l.titleScale
+	}
+	y = l.authorTop
+	for _, line := range l.authorLines {
+		drawLine(img, line, y, l.authorScale, accent)
+		y += (glyphHeight + 3) * l.authorScale
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode cover: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func fill(img *image.RGBA, r image.Rectangle, c color.RGBA) {
+	draw.Draw(img, r, &image.Uniform{C: c}, image.Point{}, draw.Src)
+}
+
+// drawLine draws line centered horizontally with its top at y
+func drawLine(img *image.RGBA, line string, y, scale int, c color.RGBA) {
+	runes := []rune(line)
+	lineWidth := len(runes)*(glyphWidth+1)*scale - scale
+	x := (img.Bounds().Dx() - lineWidth) / 2
+	for _, r := range runes {
+		glyph, ok := glyphs[r]
+		if !ok {
+			continue
+		}
+		for row, bits := range glyph {
+			for col, bit := range bits {
+				if bit != '#' {
+					continue
+				}
+				px, py := x+col*scale, y+row*scale
+				fill(img, image.Rect(px, py, px+scale, py+scale), c)
+			}
+		}
+		x += (glyphWidth + 1) * scale
+	}
+}
+
+// SVG renders book as an SVG cover with the reader's serif font
+func SVG(book Book, width int) []byte {
+	l := newLayout(book, width, false)
+	background, accent, text := palette(book.Seed)
+	rgb := func(c color.RGBA) string { return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B) }
+
+	titleSize := (glyphHeight + 1) * l.titleScale
+	authorSize := (glyphHeight + 1) * l.authorScale
+	inset := l.margin / 2
+	band := l.height / 40
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, l.width, l.height, l.width, l.height)
+	fmt.Fprintf(&b, `<rect width="100%%" height="100%%" fill="%s"/>`, rgb(background))
+	fmt.Fprintf(&b, `<rect y="%d" width="%d" height="%d" fill="%s"/>`, l.height/10, l.width, band, rgb(accent))
+	fmt.Fprintf(&b, `<rect y="%d" width="%d" height="%d" fill="%s"/>`, l.height-l.height/10-band, l.width, band, rgb(accent))
+	fmt.Fprintf(&b, `<rect x="%d" y="%d" width="%d" height="%d" fill="none" stroke="%s" stroke-width="%d"/>`,
+		inset, inset, l.width-2*inset, l.height-2*inset, rgb(text), max(1, l.width/300))
+
+	y := l.titleTop + titleSize
+	for _, line := range l.titleLines {
+		fmt.Fprintf(&b, `<text x="50%%" y="%d" text-anchor="middle" font-family="Georgia, serif" font-size="%d" fill="%s">%s</text>`,
+			y, titleSize, rgb(text), html.EscapeString(line))
+		y += titleSize + titleSize/4
+	}
+	y = l.authorTop + authorSize
+	for _, line := range l.authorLines {
+		fmt.Fprintf(&b, `<text x="50%%" y="%d" text-anchor="middle" font-family="Georgia, serif" font-style="italic" font-size="%d" fill="%s">%s</text>`,
+			y, authorSize, rgb(accent), html.EscapeString(line))
+		y += authorSize + authorSize/4
+	}
+	b.WriteString(`</svg>`)
+
+	return []byte(b.String())
+}
@@ -0,0 +1,75 @@
+package cover
+
+import (
+	"bytes"
+	"errors"
+	"image/png"
+	"strings"
+	"testing"
+
+	"mercury-relay/test/helpers"
+)
+
+func TestPNGCover(t *testing.T) {
+	book := Book{Seed: strings.Repeat("a", 64), Title: "The Long Road Home", Author: "Jane Doe"}
+
+	data, err := PNG(book, 300)
+	helpers.AssertNoError(t, err)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 300, img.Bounds().Dx())
+	helpers.AssertIntEqual(t, 450, img.Bounds().Dy())
+
+	// Same book, same cover
+	again, err := PNG(book, 300)
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, bytes.Equal(data, again))
+
+	// Another seed changes the colors
+	background, _, _ := palette(book.Seed)
+	other, _, _ := palette(strings.Repeat("b", 64))
+	helpers.AssertNotEqual(t, background, other)
+}
+
+func TestSVGCover(t *testing.T) {
+	svg := string(SVG(Book{Seed: "seed", Title: "Fish & <Chips>", Author: "Ōe"}, 600))
+
+	helpers.AssertTrue(t, strings.HasPrefix(svg, "<svg"))
+	helpers.AssertTrue(t, strings.Contains(svg, "&lt;Chips&gt;"))
+	helpers.AssertTrue(t, strings.Contains(svg, "Ōe"))
+
+	untitled := string(SVG(Book{Seed: "seed"}, 600))
+	helpers.AssertTrue(t, strings.Contains(untitled, "Untitled"))
+}
+
+func TestWrap(t *testing.T) {
+	lines := wrap("a tale of two cities and more", 10, 2)
+	helpers.AssertIntEqual(t, 2, len(lines))
+	helpers.AssertStringEqual(t, "a tale of", lines[0])
+	helpers.AssertStringEqual(t, "two...", lines[1])
+
+	lines = wrap("Supercalifragilistic", 8, 5)
+	helpers.AssertIntEqual(t, 3, len(lines))
+	helpers.AssertStringEqual(t, "Supercal", lines[0])
+}
+
+func TestGeneratorCache(t *testing.T) {
+	g := NewGenerator(1)
+	book := Book{Seed: "one", Title: "One"}
+
+	first, err := g.Render(book, FormatSVG, 0)
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 1, len(g.entries))
+
+	cached, err := g.Render(book, FormatSVG, 0)
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, &first[0] == &cached[0])
+
+	_, err = g.Render(Book{Seed: "two", Title: "Two"}, FormatPNG, 200)
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 1, len(g.entries))
+
+	_, err = g.Render(book, "gif", 0)
+	helpers.AssertTrue(t, errors.Is(err, ErrUnsupportedFormat))
+}
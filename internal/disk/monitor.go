@@ -0,0 +1,333 @@
+package disk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/config"
+)
+
+// Pressure levels
+const (
+	LevelOK       = "ok"
+	LevelWarning  = "warning"
+	LevelCritical = "critical"
+)
+
+// webhookTimeout bounds delivering one alert
+const webhookTimeout = 10 * time.Second
+
+// Usage is the state of the filesystem holding a watched path
+type Usage struct {
+	Path        string  `json:"path"`
+	TotalBytes  uint64  `json:"total_bytes"`
+	UsedBytes   uint64  `json:"used_bytes"`
+	FreeBytes   uint64  `json:"free_bytes"`
+	UsedPercent float64 `json:"used_percent"`
+	Level       string  `json:"level"`
+	Error       string  `json:"error,omitempty"`
+}
+
+func newUsage(path string, total, free uint64) Usage {
+	usage := Usage{Path: path, TotalBytes: total, FreeBytes: free}
+	if free < total {
+		usage.UsedBytes = total - free
+	}
+	if total > 0 {
+		usage.UsedPercent = float64(usage.UsedBytes) / float64(total) * 100
+	}
+	return usage
+}
+
+// Alert is sent to the webhook when a path changes level
+type Alert struct {
+	Path        string    `json:"path"`
+	Level       string    `json:"level"`
+	Previous    string    `json:"previous"`
+	UsedPercent float64   `json:"used_percent"`
+	FreeBytes   uint64    `json:"free_bytes"`
+	TTL         string    `json:"ttl,omitempty"` // cache TTL after tightening
+	At          time.Time `json:"at"`
+}
+
+// Monitor checks disk usage of the storage paths on an interval, alerts on
+// threshold crossings and tightens cache retention under pressure
+type Monitor struct {
+	config config.DiskConfig
+	paths  []string
+	stat   func(path string) (Usage, error)
+	client *http.Client
+
+	retention cache.Retention
+	notify    func(message string)
+
+	mu        sync.Mutex
+	usage     map[string]Usage
+	baseTTL   time.Duration // TTL before tightening; 0 while not tightened
+	tightened int
+	alerts    int64
+}
+
+// NewMonitor watches paths plus cfg.Paths. Duplicates and empty paths are
+// dropped.
+func NewMonitor(cfg config.DiskConfig, paths ...string) *Monitor {
+	seen := make(map[string]bool)
+	var watched []string
+	for _, path := range append(paths, cfg.Paths...) {
+		if path != "" && !seen[path] {
+			seen[path] = true
+			watched = append(watched, path)
+		}
+	}
+	sort.Strings(watched)
+
+	return &Monitor{
+		config: cfg,
+		paths:  watched,
+		stat:   statUsage,
+		client: &http.Client{Timeout: webhookTimeout},
+		usage:  make(map[string]Usage),
+	}
+}
+
+// SetRetention lets the monitor tighten the cache TTL at critical usage
+func (m *Monitor) SetRetention(retention cache.Retention) {
+	m.retention = retention
+}
+
+// SetNotifier sends rising pressure alerts to connected clients as NOTICEs
+// when the config asks for it
+func (m *Monitor) SetNotifier(notify func(message string)) {
+	m.notify = notify
+}
+
+// Run checks usage every interval until ctx is done
+func (m *Monitor) Run(ctx context.Context) {
+	m.Check(ctx)
+
+	ticker := time.NewTicker(m.config.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.Check(ctx)
+		}
+	}
+}
+
+// Check reads the usage of every path once, alerting on level changes and
+// adjusting retention to the worst level
+func (m *Monitor) Check(ctx context.Context) {
+	worst := LevelOK
+	var changed []Alert
+
+	for _, path := range m.paths {
+		usage, err := m.stat(path)
+		if err != nil {
+			usage = Usage{Path: path, Level: LevelOK, Error: err.Error()}
+		} else {
+			usage.Level = m.level(usage.UsedPercent)
+		}
+
+		m.mu.Lock()
+		previous, known := m.usage[path]
+		m.usage[path] = usage
+		m.mu.Unlock()
+
+		if err != nil {
+			log.Printf("Disk monitor: %v", err)
+			continue
+		}
+		if rank(usage.Level) > rank(worst) {
+			worst = usage.Level
+		}
+		if !known {
+			previous.Level = LevelOK
+		}
+		if usage.Level != previous.Level {
+			changed = append(changed, Alert{
+				Path:        path,
+				Level:       usage.Level,
+				Previous:    previous.Level,
+				UsedPercent: usage.UsedPercent,
+				FreeBytes:   usage.FreeBytes,
+				At:          time.Now(),
+			})
+		}
+	}
+
+	ttl := m.adjustRetention(worst)
+	for _, alert := range changed {
+		if ttl > 0 {
+			alert.TTL = ttl.String()
+		}
+		m.alert(ctx, alert)
+	}
+}
+
+// level classifies a used percentage against the thresholds
+func (m *Monitor) level(usedPercent float64) string {
+	switch {
+	case usedPercent >= m.config.CriticalPercent:
+		return LevelCritical
+	case usedPercent >= m.config.WarnPercent:
+		return LevelWarning
+	default:
+		return LevelOK
+	}
+}
+
+func rank(level string) int {
+	switch level {
+	case LevelCritical:
+		return 2
+	case LevelWarning:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// adjustRetention scales the cache TTL down at the critical level and
+// restores it once usage is back to ok. It returns the TTL while tightened.
+func (m *Monitor) adjustRetention(worst string) time.Duration {
+	if !m.config.TightenRetention || m.retention == nil {
+		return 0
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	current := m.retention.TTL()
+	switch worst {
+	case LevelCritical:
+		if current <= 0 {
+			// Events are kept forever; there is no TTL to scale
+			return 0
+		}
+		next := time.Duration(float64(current) * m.config.TightenFactor)
+		if next < m.config.MinTTL {
+			next = m.config.MinTTL
+		}
+		if next >= current {
+			return current
+		}
+		if m.baseTTL == 0 {
+			m.baseTTL = current
+		}
+		m.retention.SetTTL(next)
+		m.tightened++
+		log.Printf("Disk pressure is critical, cache TTL tightened from %s to %s", current, next)
+		return next
+	case LevelOK:
+		if m.baseTTL != 0 {
+			log.Printf("Disk pressure relieved, cache TTL restored to %s", m.baseTTL)
+			m.retention.SetTTL(m.baseTTL)
+			m.baseTTL = 0
+		}
+		return 0
+	default:
+		// Hold a tightened TTL until usage is back under the warning level
+		if m.baseTTL != 0 {
+			return current
+		}
+		return 0
+	}
+}
+
+// alert reports a level change to the log, the webhook and connected clients
+func (m *Monitor) alert(ctx context.Context, alert Alert) {
+	m.mu.Lock()
+	m.alerts++
+	m.mu.Unlock()
+
+	message := fmt.Sprintf("Disk usage of %s is %s (%.1f%% used)", alert.Path, alert.Level, alert.UsedPercent)
+	log.Printf("Disk monitor: %s, was %s", message, alert.Previous)
+
+	if m.notify != nil && m.config.Notice && alert.Level != LevelOK {
+		m.notify(fmt.Sprintf("Relay storage is nearly full (%s), stored events may expire sooner", alert.Level))
+	}
+
+	if m.config.WebhookURL == "" {
+		return
+	}
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+	go func() {
+		req, err := http.NewRequestWithContext(context.WithoutCancel(ctx), http.MethodPost, m.config.WebhookURL, bytes.NewReader(body))
+		if err != nil {
+			log.Printf("Disk monitor: invalid webhook: %v", err)
+			return
+		}
+		req.Header.Set("Content-Type", "application/json")
+		resp, err := m.client.Do(req)
+		if err != nil {
+			log.Printf("Disk monitor: failed to deliver alert: %v", err)
+			return
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			log.Printf("Disk monitor: webhook answered %s", resp.Status)
+		}
+	}()
+}
+
+// Usage returns the last reading of every watched path
+func (m *Monitor) Usage() []Usage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	usage := make([]Usage, 0, len(m.paths))
+	for _, path := range m.paths {
+		if u, ok := m.usage[path]; ok {
+			usage = append(usage, u)
+		}
+	}
+	return usage
+}
+
+// Stats returns the last readings, thresholds and retention state
+func (m *Monitor) Stats() map[string]interface{} {
+	usage := m.Usage()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	worst := LevelOK
+	for _, u := range usage {
+		if rank(u.Level) > rank(worst) {
+			worst = u.Level
+		}
+	}
+	stats := map[string]interface{}{
+		"level":            worst,
+		"paths":            usage,
+		"warn_percent":     m.config.WarnPercent,
+		"critical_percent": m.config.CriticalPercent,
+		"alerts":           m.alerts,
+	}
+	if m.retention != nil {
+		retention := map[string]interface{}{
+			"ttl":         m.retention.TTL().String(),
+			"tightened":   m.baseTTL != 0,
+			"tightenings": m.tightened,
+		}
+		if m.baseTTL != 0 {
+			retention["base_ttl"] = m.baseTTL.String()
+		}
+		stats["retention"] = retention
+	}
+	return stats
+}
@@ -0,0 +1,172 @@
+package disk
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/test/helpers"
+)
+
+// fakeRetention is a cache TTL the monitor can change
+type fakeRetention struct {
+	ttl time.Duration
+}
+
+func (r *fakeRetention) TTL() time.Duration       { return r.ttl }
+func (r *fakeRetention) SetTTL(ttl time.Duration) { r.ttl = ttl }
+
+func testConfig() config.DiskConfig {
+	return config.DiskConfig{
+		Enabled:          true,
+		Interval:         time.Minute,
+		WarnPercent:      80,
+		CriticalPercent:  90,
+		TightenRetention: true,
+		TightenFactor:    0.5,
+		MinTTL:           24 * time.Hour,
+	}
+}
+
+// monitorAt returns a monitor whose paths report the used percentages in
+// used
+func monitorAt(cfg config.DiskConfig, used map[string]float64, paths ...string) *Monitor {
+	m := NewMonitor(cfg, paths...)
+	m.stat = func(path string) (Usage, error) {
+		percent, ok := used[path]
+		if !ok {
+			return Usage{}, fmt.Errorf("no such path")
+		}
+		return newUsage(path, 1000, uint64(1000-percent*10)), nil
+	}
+	return m
+}
+
+func TestMonitorLevels(t *testing.T) {
+	used := map[string]float64{"/data": 50, "/pg": 85}
+	m := monitorAt(testConfig(), used, "/data", "/pg", "", "/data")
+	m.Check(context.Background())
+
+	usage := m.Usage()
+	helpers.AssertIntEqual(t, 2, len(usage))
+	helpers.AssertStringEqual(t, LevelOK, usage[0].Level)
+	helpers.AssertStringEqual(t, LevelWarning, usage[1].Level)
+	helpers.AssertStringEqual(t, LevelWarning, m.Stats()["level"].(string))
+
+	used["/data"] = 95
+	m.Check(context.Background())
+	helpers.AssertStringEqual(t, LevelCritical, m.Usage()[0].Level)
+	helpers.AssertTrue(t, m.Stats()["alerts"].(int64) == 2)
+}
+
+func TestMonitorRetention(t *testing.T) {
+	used := map[string]float64{"/data": 95}
+	m := monitorAt(testConfig(), used, "/data")
+	retention := &fakeRetention{ttl: 30 * 24 * time.Hour}
+	m.SetRetention(retention)
+
+	// Each critical check halves the TTL down to the floor
+	m.Check(context.Background())
+	helpers.AssertTrue(t, retention.ttl == 15*24*time.Hour)
+	for i := 0; i < 10; i++ {
+		m.Check(context.Background())
+	}
+	helpers.AssertTrue(t, retention.ttl == 24*time.Hour)
+
+	// Warning holds the tightened TTL, ok restores it
+	used["/data"] = 85
+	m.Check(context.Background())
+	helpers.AssertTrue(t, retention.ttl == 24*time.Hour)
+	used["/data"] = 40
+	m.Check(context.Background())
+	helpers.AssertTrue(t, retention.ttl == 30*24*time.Hour)
+
+	// Keeping events forever is left alone
+	retention.ttl = 0
+	used["/data"] = 95
+	m.Check(context.Background())
+	helpers.AssertTrue(t, retention.ttl == 0)
+}
+
+func TestMonitorRetentionDisabled(t *testing.T) {
+	cfg := testConfig()
+	cfg.TightenRetention = false
+	m := monitorAt(cfg, map[string]float64{"/data": 99}, "/data")
+	retention := &fakeRetention{ttl: time.Hour * 100}
+	m.SetRetention(retention)
+	m.Check(context.Background())
+	helpers.AssertTrue(t, retention.ttl == 100*time.Hour)
+}
+
+func TestMonitorAlerts(t *testing.T) {
+	var mu sync.Mutex
+	var alerts []Alert
+	received := make(chan struct{}, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var alert Alert
+		json.NewDecoder(req.Body).Decode(&alert)
+		mu.Lock()
+		alerts = append(alerts, alert)
+		mu.Unlock()
+		received <- struct{}{}
+	}))
+	defer server.Close()
+
+	cfg := testConfig()
+	cfg.WebhookURL = server.URL
+	cfg.Notice = true
+	used := map[string]float64{"/data": 92}
+	m := monitorAt(cfg, used, "/data")
+
+	var notices []string
+	m.SetNotifier(func(message string) { notices = append(notices, message) })
+
+	m.Check(context.Background())
+	m.Check(context.Background()) // no change, no alert
+	used["/data"] = 10
+	m.Check(context.Background())
+
+	for i := 0; i < 2; i++ {
+		select {
+		case <-received:
+		case <-time.After(2 * time.Second):
+			t.Fatal("webhook not called")
+		}
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	helpers.AssertIntEqual(t, 2, len(alerts))
+	levels := map[string]string{}
+	for _, alert := range alerts {
+		levels[alert.Level] = alert.Previous
+	}
+	helpers.AssertStringEqual(t, LevelOK, levels[LevelCritical])
+	helpers.AssertStringEqual(t, LevelCritical, levels[LevelOK])
+
+	// Only rising pressure is announced to clients
+	helpers.AssertIntEqual(t, 1, len(notices))
+}
+
+func TestMonitorStatErrors(t *testing.T) {
+	m := monitorAt(testConfig(), map[string]float64{}, "/missing")
+	m.Check(context.Background())
+	usage := m.Usage()
+	helpers.AssertIntEqual(t, 1, len(usage))
+	helpers.AssertTrue(t, usage[0].Error != "")
+}
+
+func TestStatUsage(t *testing.T) {
+	usage, err := statUsage(os.TempDir())
+	if err != nil {
+		t.Skipf("statfs not available: %v", err)
+	}
+	helpers.AssertTrue(t, usage.TotalBytes > 0)
+	helpers.AssertTrue(t, usage.UsedPercent >= 0 && usage.UsedPercent <= 100)
+}
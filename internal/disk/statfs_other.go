@@ -0,0 +1,10 @@
+//go:build !unix
+
+package disk
+
+import "fmt"
+
+// statUsage is not supported on this platform
+func statUsage(path string) (Usage, error) {
+	return Usage{}, fmt.Errorf("disk usage of %s is not supported on this platform", path)
+}
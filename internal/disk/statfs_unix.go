@@ -0,0 +1,21 @@
+//go:build unix
+
+package disk
+
+import (
+	"fmt"
+	"syscall"
+)
+
+// statUsage reads the usage of the filesystem holding path
+func statUsage(path string) (Usage, error) {
+	var fs syscall.Statfs_t
+	if err := syscall.Statfs(path, &fs); err != nil {
+		return Usage{}, fmt.Errorf("failed to stat %s: %w", path, err)
+	}
+	blockSize := uint64(fs.Bsize)
+	total := uint64(fs.Blocks) * blockSize
+	// Blocks reserved for root count as used, as df reports them
+	free := uint64(fs.Bavail) * blockSize
+	return newUsage(path, total, free), nil
+}
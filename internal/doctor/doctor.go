@@ -0,0 +1,241 @@
+// Package doctor checks that a configuration can run: that it validates, the
+// owner and relay keys are usable, data directories are writable, ports are
+// free and the services it depends on answer.
+package doctor
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/identity"
+
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// Check statuses
+const (
+	StatusOK   = "ok"
+	StatusWarn = "warn"
+	StatusFail = "fail"
+)
+
+// dialTimeout bounds each connection attempt to a dependency
+const dialTimeout = 3 * time.Second
+
+// Check is the outcome of one check
+type Check struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Report is the outcome of every check
+type Report []Check
+
+// Failed reports whether any check failed
+func (r Report) Failed() bool {
+	for _, check := range r {
+		if check.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+func ok(name, format string, args ...interface{}) Check {
+	return Check{Name: name, Status: StatusOK, Detail: fmt.Sprintf(format, args...)}
+}
+
+func warn(name, format string, args ...interface{}) Check {
+	return Check{Name: name, Status: StatusWarn, Detail: fmt.Sprintf(format, args...)}
+}
+
+func fail(name, format string, args ...interface{}) Check {
+	return Check{Name: name, Status: StatusFail, Detail: fmt.Sprintf(format, args...)}
+}
+
+// Run checks cfg. Dependencies are dialled, so ctx bounds the run.
+func Run(ctx context.Context, cfg *config.Config) Report {
+	var report Report
+	if err := cfg.Validate(); err != nil {
+		report = append(report, fail("config", "%v", err))
+	} else {
+		report = append(report, ok("config", "valid"))
+	}
+	report = append(report, checkOwner(cfg))
+	report = append(report, checkIdentity(cfg.Identity))
+	for _, dir := range dataDirs(cfg) {
+		report = append(report, checkWritable(dir))
+	}
+	for _, port := range ports(cfg) {
+		report = append(report, checkPort(port.name, cfg.Server.Host, port.port))
+	}
+	if cfg.Cache.Backend == "redis" {
+		report = append(report, checkDial(ctx, "redis", cfg.Redis.Host))
+	}
+	if cfg.GRPC.Enabled && cfg.GRPC.TLSEnabled {
+		report = append(report, checkTLS(cfg.GRPC.CertFile, cfg.GRPC.KeyFile))
+	}
+	return report
+}
+
+func checkOwner(cfg *config.Config) Check {
+	if len(cfg.Access.AdminNpubs) == 0 {
+		return fail("owner", "no admin npubs configured")
+	}
+	owner := cfg.Access.AdminNpubs[0]
+	if prefix, _, err := nip19.Decode(owner); err != nil || prefix != "npub" {
+		return fail("owner", "%q is not an npub", owner)
+	}
+	return ok("owner", "%s", owner)
+}
+
+// checkIdentity loads the relay key without generating one
+func checkIdentity(cfg config.IdentityConfig) Check {
+	key := cfg.PrivateKey
+	if key == "" {
+		data, err := os.ReadFile(cfg.KeyPath)
+		if os.IsNotExist(err) {
+			return warn("identity", "no key at %s yet; one is generated on first start", cfg.KeyPath)
+		}
+		if err != nil {
+			return fail("identity", "%v", err)
+		}
+		key = strings.TrimSpace(string(data))
+	}
+	id, err := identity.New(key, false, false)
+	if err != nil {
+		return fail("identity", "%v", err)
+	}
+	if cfg.PrivateKey == "" {
+		if info, err := os.Stat(cfg.KeyPath); err == nil && info.Mode().Perm()&0077 != 0 {
+			return warn("identity", "%s is readable by other users (mode %o)", cfg.KeyPath, info.Mode().Perm())
+		}
+	}
+	return ok("identity", "%s", id.Npub())
+}
+
+// dataDirs lists the directories the relay writes to, for the enabled
+// subsystems
+func dataDirs(cfg *config.Config) []string {
+	dirs := []string{
+		filepath.Dir(cfg.Identity.KeyPath),
+		filepath.Dir(cfg.Access.WritersPath),
+		filepath.Dir(cfg.Admin.AnnotationsPath),
+	}
+	if cfg.XFTP.Enabled {
+		dirs = append(dirs, cfg.XFTP.StorageDir)
+	}
+	if cfg.Storage.Backend == "file" || cfg.Storage.Backend == "sqlite" {
+		dirs = append(dirs, cfg.Storage.Path)
+	}
+	if cfg.Queue.Backend == "memory" && cfg.Queue.Overflow == "spill" {
+		dirs = append(dirs, filepath.Dir(cfg.Queue.SpillPath))
+	}
+	if cfg.SSH.Enabled {
+		dirs = append(dirs, cfg.SSH.KeyStorage.KeyDir)
+	}
+	if cfg.BlockLists.Enabled {
+		dirs = append(dirs, filepath.Dir(cfg.BlockLists.Path))
+	}
+	if cfg.LargeObjects.Enabled {
+		dirs = append(dirs, cfg.LargeObjects.Path)
+	}
+	if cfg.RESTAPI.Idempotency.Enabled {
+		dirs = append(dirs, filepath.Dir(cfg.RESTAPI.Idempotency.Path))
+	}
+
+	seen := make(map[string]bool)
+	var unique []string
+	for _, dir := range dirs {
+		dir = filepath.Clean(dir)
+		if !seen[dir] {
+			seen[dir] = true
+			unique = append(unique, dir)
+		}
+	}
+	return unique
+}
+
+func checkWritable(dir string) Check {
+	name := "dir " + dir
+	info, err := os.Stat(dir)
+	if os.IsNotExist(err) {
+		return warn(name, "missing; created on first start if the parent is writable")
+	}
+	if err != nil {
+		return fail(name, "%v", err)
+	}
+	if !info.IsDir() {
+		return fail(name, "not a directory")
+	}
+	probe, err := os.CreateTemp(dir, ".doctor-*")
+	if err != nil {
+		return fail(name, "not writable: %v", err)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return ok(name, "writable")
+}
+
+type port struct {
+	name string
+	port int
+}
+
+// ports lists the ports the enabled listeners bind
+func ports(cfg *config.Config) []port {
+	list := []port{{"relay", cfg.Server.Port}}
+	if cfg.RESTAPI.Enabled && cfg.RESTAPI.Port > 0 && cfg.RESTAPI.Port != cfg.Server.Port {
+		list = append(list, port{"rest_api", cfg.RESTAPI.Port})
+	}
+	if cfg.GRPC.Enabled && cfg.GRPC.ServerPort > 0 {
+		list = append(list, port{"grpc", cfg.GRPC.ServerPort})
+	}
+	if cfg.Admin.Enabled && cfg.Admin.Port > 0 {
+		list = append(list, port{"admin", cfg.Admin.Port})
+	}
+	return list
+}
+
+// checkPort tries to bind a port. One in use is a warning: it may be this
+// relay already running.
+func checkPort(name, host string, p int) Check {
+	name = "port " + name
+	address := net.JoinHostPort(host, strconv.Itoa(p))
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return warn(name, "%s is in use: %v", address, err)
+	}
+	listener.Close()
+	return ok(name, "%s is free", address)
+}
+
+func checkDial(ctx context.Context, name, address string) Check {
+	dialer := net.Dialer{Timeout: dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return fail(name, "can't reach %s: %v", address, err)
+	}
+	conn.Close()
+	return ok(name, "%s reachable", address)
+}
+
+func checkTLS(certFile, keyFile string) Check {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return fail("tls", "%v", err)
+	}
+	if cert.Leaf != nil && time.Now().After(cert.Leaf.NotAfter) {
+		return fail("tls", "%s expired on %s", certFile, cert.Leaf.NotAfter.Format(time.DateOnly))
+	}
+	return ok("tls", "%s", certFile)
+}
@@ -0,0 +1,87 @@
+package doctor
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+func find(report Report, name string) Check {
+	for _, check := range report {
+		if check.Name == name {
+			return check
+		}
+	}
+	return Check{}
+}
+
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	dir := t.TempDir()
+	pk, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	npub, _ := nip19.EncodePublicKey(pk)
+	cfg, err := config.Load("")
+	helpers.AssertNoError(t, err)
+	cfg.Server.Host = "127.0.0.1"
+	cfg.Access.AdminNpubs = []string{npub}
+	cfg.Cache.Backend = "memory"
+	cfg.Identity.KeyPath = filepath.Join(dir, "relay.key")
+	cfg.Access.WritersPath = filepath.Join(dir, "writers.json")
+	cfg.Admin.AnnotationsPath = filepath.Join(dir, "annotations.json")
+	return cfg
+}
+
+func TestHealthyConfig(t *testing.T) {
+	cfg := testConfig(t)
+	report := Run(context.Background(), cfg)
+	helpers.AssertFalse(t, report.Failed())
+	helpers.AssertStringEqual(t, StatusOK, find(report, "config").Status)
+	helpers.AssertStringEqual(t, StatusOK, find(report, "owner").Status)
+	helpers.AssertStringEqual(t, StatusOK, find(report, "dir "+filepath.Dir(cfg.Identity.KeyPath)).Status)
+
+	// The relay key is generated on first start
+	helpers.AssertStringEqual(t, StatusWarn, find(report, "identity").Status)
+	sk := nostr.GeneratePrivateKey()
+	helpers.AssertNoError(t, os.WriteFile(cfg.Identity.KeyPath, []byte(sk+"\n"), 0600))
+	pk, _ := nostr.GetPublicKey(sk)
+	npub, _ := nip19.EncodePublicKey(pk)
+	check := find(Run(context.Background(), cfg), "identity")
+	helpers.AssertStringEqual(t, StatusOK, check.Status)
+	helpers.AssertStringEqual(t, npub, check.Detail)
+
+	// A port in use may be the relay itself
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	helpers.AssertNoError(t, err)
+	defer listener.Close()
+	cfg.Server.Port = listener.Addr().(*net.TCPAddr).Port
+	report = Run(context.Background(), cfg)
+	helpers.AssertStringEqual(t, StatusWarn, find(report, "port relay").Status)
+	helpers.AssertFalse(t, report.Failed())
+}
+
+func TestBrokenConfig(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.Access.AdminNpubs = []string{"not-an-npub"}
+	cfg.Quality.MaxContentLength = 0
+	helpers.AssertNoError(t, os.WriteFile(cfg.Identity.KeyPath, []byte("garbage\n"), 0644))
+	cfg.Cache.Backend = "redis"
+	cfg.Redis.Host = "127.0.0.1:1"
+	file := filepath.Join(t.TempDir(), "file")
+	helpers.AssertNoError(t, os.WriteFile(file, nil, 0644))
+	cfg.XFTP.Enabled = true
+	cfg.XFTP.StorageDir = file
+
+	report := Run(context.Background(), cfg)
+	helpers.AssertTrue(t, report.Failed())
+	for _, name := range []string{"config", "owner", "identity", "redis", "dir " + file} {
+		helpers.AssertStringEqual(t, StatusFail, find(report, name).Status)
+	}
+}
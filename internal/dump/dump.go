@@ -0,0 +1,250 @@
+// Package dump exports stored events to JSONL, one event per line, and
+// imports such dumps. The strfry format is plain NIP-01 events as written by
+// strfry and nostream exports; the jsonl format also keeps what Mercury knows
+// about each event (quality score, quarantine, provenance). Imports accept
+// either: every line is verified, checked by quality control and stored
+// unless the relay already holds the event.
+package dump
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/normalize"
+	"mercury-relay/internal/storage"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Dump formats
+const (
+	FormatJSONL  = "jsonl"  // Mercury events with their metadata
+	FormatStrfry = "strfry" // plain NIP-01 events
+)
+
+const (
+	scanBatch = 500
+
+	// maxLineSize bounds one line of an imported dump
+	maxLineSize = 16 << 20
+
+	// progressEvery is how many events pass between progress reports
+	progressEvery = 1000
+
+	// maxLoggedErrors bounds the invalid lines logged per import
+	maxLoggedErrors = 10
+)
+
+// ExportProgress is reported while exporting
+type ExportProgress struct {
+	Scanned   int64     `json:"scanned"`
+	Exported  int64     `json:"exported"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// Export writes the stored events matching filter to w in format, reporting
+// progress every thousand events and at the end when onProgress is set. The
+// filter's limit is ignored.
+func Export(ctx context.Context, source storage.Scanner, w io.Writer, filter nostr.Filter, format string, onProgress func(ExportProgress)) (ExportProgress, error) {
+	progress := ExportProgress{StartedAt: time.Now()}
+	if format != FormatJSONL && format != FormatStrfry {
+		return progress, fmt.Errorf("unknown dump format %q (use jsonl or strfry)", format)
+	}
+	filter.Limit = 0
+
+	out := bufio.NewWriter(w)
+	enc := json.NewEncoder(out)
+	cursor := ""
+	for {
+		events, next, err := source.ScanEvents(ctx, cursor, scanBatch)
+		if err != nil {
+			return progress, fmt.Errorf("failed to scan storage at cursor %q: %w", cursor, err)
+		}
+		for _, event := range events {
+			progress.Scanned++
+			if progress.Scanned%progressEvery == 0 && onProgress != nil {
+				onProgress(progress)
+			}
+			if !filter.Matches(event.ToNostrEvent()) {
+				continue
+			}
+			var line interface{} = event
+			if format == FormatStrfry {
+				line = event.ToNostrEvent()
+			}
+			if err := enc.Encode(line); err != nil {
+				return progress, fmt.Errorf("failed to write event %s: %w", event.ID, err)
+			}
+			progress.Exported++
+		}
+
+		if next == "" || len(events) == 0 {
+			break
+		}
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+		cursor = next
+	}
+
+	if err := out.Flush(); err != nil {
+		return progress, fmt.Errorf("failed to write dump: %w", err)
+	}
+	if onProgress != nil {
+		onProgress(progress)
+	}
+	return progress, nil
+}
+
+// Quality is the part of quality control imported events go through
+type Quality interface {
+	IsNpubBlocked(npub string) bool
+	IsEventBanned(eventID string) bool
+	Rescore(event *models.Event) error
+}
+
+// ImportProgress is reported while importing
+type ImportProgress struct {
+	Lines      int64     `json:"lines"`
+	Bytes      int64     `json:"bytes"` // read so far, to compare with the dump size
+	Imported   int64     `json:"imported"`
+	Duplicates int64     `json:"duplicates"`
+	Rejected   int64     `json:"rejected"`
+	Invalid    int64     `json:"invalid"`
+	Failed     int64     `json:"failed"`
+	StartedAt  time.Time `json:"started_at"`
+}
+
+// Importer loads dumps into the cache and storage
+type Importer struct {
+	quality    Quality
+	cache      cache.Cache
+	storage    storage.Storage
+	normalizer *normalize.Normalizer
+	onProgress func(ImportProgress)
+}
+
+// NewImporter stores imported events in c and s; quality and s may be nil
+func NewImporter(quality Quality, c cache.Cache, s storage.Storage) *Importer {
+	return &Importer{quality: quality, cache: c, storage: s}
+}
+
+// SetNormalizer canonicalizes tag values of imported events before they are
+// stored
+func (im *Importer) SetNormalizer(normalizer *normalize.Normalizer) {
+	im.normalizer = normalizer
+}
+
+// OnProgress sets a callback invoked every thousand lines and at the end
+func (im *Importer) OnProgress(fn func(ImportProgress)) {
+	im.onProgress = fn
+}
+
+// Import reads a dump in either format from r. Invalid lines are counted
+// and skipped; only a read error or ctx stops the import early.
+func (im *Importer) Import(ctx context.Context, r io.Reader) (ImportProgress, error) {
+	progress := ImportProgress{StartedAt: time.Now()}
+	seen := make(map[string]bool)
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxLineSize)
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		progress.Lines++
+		progress.Bytes += int64(len(line)) + 1
+		if len(line) > 0 {
+			im.importLine(ctx, line, seen, &progress)
+		}
+
+		if progress.Lines%progressEvery == 0 {
+			if err := ctx.Err(); err != nil {
+				return progress, err
+			}
+			if im.onProgress != nil {
+				im.onProgress(progress)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return progress, fmt.Errorf("failed to read dump at line %d: %w", progress.Lines+1, err)
+	}
+
+	if im.onProgress != nil {
+		im.onProgress(progress)
+	}
+	return progress, nil
+}
+
+// importLine verifies, checks and stores the event on one line
+func (im *Importer) importLine(ctx context.Context, line []byte, seen map[string]bool, progress *ImportProgress) {
+	event := &models.Event{}
+	if err := json.Unmarshal(line, event); err != nil {
+		im.invalid(progress, fmt.Errorf("not a JSON event: %w", err))
+		return
+	}
+	ne := event.ToNostrEvent()
+	if !ne.CheckID() {
+		im.invalid(progress, fmt.Errorf("event %s has the wrong ID", event.ID))
+		return
+	}
+	if ok, err := ne.CheckSignature(); err != nil || !ok {
+		im.invalid(progress, fmt.Errorf("event %s has an invalid signature", event.ID))
+		return
+	}
+
+	if seen[event.ID] {
+		progress.Duplicates++
+		return
+	}
+	seen[event.ID] = true
+	existing, err := cache.Collect(im.cache.GetEvents(ctx, nostr.Filter{IDs: []string{event.ID}}))
+	if err == nil && len(existing) > 0 {
+		progress.Duplicates++
+		return
+	}
+
+	if im.quality != nil {
+		if im.quality.IsNpubBlocked(event.PubKey) || im.quality.IsEventBanned(event.ID) {
+			progress.Rejected++
+			return
+		}
+		if err := im.quality.Rescore(event); err != nil {
+			progress.Rejected++
+			return
+		}
+	} else if event.QualityScore == 0 {
+		event.QualityScore = event.CalculateQualityScore()
+	}
+	event.AddProvenance(models.ProvenanceReplay, "import", "")
+	if im.normalizer != nil {
+		im.normalizer.Apply(event)
+	}
+
+	if err := im.cache.StoreEvent(event); err != nil {
+		progress.Failed++
+		log.Printf("Import failed to cache event %s: %v", event.ID, err)
+		return
+	}
+	if im.storage != nil {
+		if err := im.storage.StoreEvent(event); err != nil {
+			progress.Failed++
+			log.Printf("Import failed to store event %s: %v", event.ID, err)
+			return
+		}
+	}
+	progress.Imported++
+}
+
+func (im *Importer) invalid(progress *ImportProgress, err error) {
+	progress.Invalid++
+	if progress.Invalid <= maxLoggedErrors {
+		log.Printf("Import skipped line %d: %v", progress.Lines, err)
+	}
+}
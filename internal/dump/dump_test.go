@@ -0,0 +1,104 @@
+package dump
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+	"mercury-relay/test/mocks"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+type blockingQuality struct {
+	blocked string
+}
+
+func (q *blockingQuality) IsNpubBlocked(npub string) bool    { return npub == q.blocked }
+func (q *blockingQuality) IsEventBanned(eventID string) bool { return false }
+func (q *blockingQuality) Rescore(event *models.Event) error {
+	event.QualityScore = 0.9
+	return nil
+}
+
+// signedEvents returns n signed events by sk alternating kinds 1 and 30023,
+// the first quarantined
+func signedEvents(t *testing.T, sk string, n int) []*models.Event {
+	events := make([]*models.Event, n)
+	for i := range events {
+		ne := &nostr.Event{
+			Kind:      []int{1, 30023}[i%2],
+			CreatedAt: nostr.Timestamp(1700000000 + i),
+			Tags:      nostr.Tags{{"d", fmt.Sprintf("post-%d", i)}},
+			Content:   fmt.Sprintf("post %d", i),
+		}
+		helpers.AssertNoError(t, ne.Sign(sk))
+		events[i] = models.FromNostrEvent(ne)
+	}
+	events[0].IsQuarantined = true
+	events[0].QuarantineReason = "reported"
+	return events
+}
+
+func TestExport(t *testing.T) {
+	source := mocks.NewMockScanner(signedEvents(t, nostr.GeneratePrivateKey(), 5))
+
+	var jsonl bytes.Buffer
+	progress, err := Export(context.Background(), source, &jsonl, nostr.Filter{}, FormatJSONL, nil)
+	helpers.AssertNoError(t, err)
+	helpers.AssertInt64Equal(t, 5, progress.Exported)
+	lines := strings.Split(strings.TrimSpace(jsonl.String()), "\n")
+	helpers.AssertIntEqual(t, 5, len(lines))
+	helpers.AssertStringContains(t, lines[0], `"quarantine_reason":"reported"`)
+
+	var strfry bytes.Buffer
+	progress, err = Export(context.Background(), source, &strfry, nostr.Filter{Kinds: []int{30023}}, FormatStrfry, nil)
+	helpers.AssertNoError(t, err)
+	helpers.AssertInt64Equal(t, 5, progress.Scanned)
+	helpers.AssertInt64Equal(t, 2, progress.Exported)
+	helpers.AssertTrue(t, !strings.Contains(strfry.String(), "quality_score"))
+
+	_, err = Export(context.Background(), source, &strfry, nostr.Filter{}, "csv", nil)
+	helpers.AssertErrorContains(t, err, "unknown dump format")
+}
+
+func TestImport(t *testing.T) {
+	sk, blocked := nostr.GeneratePrivateKey(), nostr.GeneratePrivateKey()
+	blockedPubkey, _ := nostr.GetPublicKey(blocked)
+	events := signedEvents(t, sk, 4)
+
+	var dump bytes.Buffer
+	_, err := Export(context.Background(), mocks.NewMockScanner(events), &dump, nostr.Filter{}, FormatJSONL, nil)
+	helpers.AssertNoError(t, err)
+	_, err = Export(context.Background(), mocks.NewMockScanner(signedEvents(t, blocked, 1)), &dump, nostr.Filter{}, FormatStrfry, nil)
+	helpers.AssertNoError(t, err)
+
+	tampered := *events[1]
+	tampered.Content = "tampered"
+	_, err = Export(context.Background(), mocks.NewMockScanner([]*models.Event{events[2], &tampered}), &dump, nostr.Filter{}, FormatStrfry, nil)
+	helpers.AssertNoError(t, err)
+	dump.WriteString("\nnot json\n")
+
+	eventCache := mocks.NewMockCache()
+	helpers.AssertNoError(t, eventCache.StoreEvent(events[3]))
+
+	importer := NewImporter(&blockingQuality{blocked: blockedPubkey}, eventCache, nil)
+	progress, err := importer.Import(context.Background(), &dump)
+	helpers.AssertNoError(t, err)
+	helpers.AssertInt64Equal(t, 3, progress.Imported)
+	helpers.AssertInt64Equal(t, 2, progress.Duplicates)
+	helpers.AssertInt64Equal(t, 1, progress.Rejected)
+	helpers.AssertInt64Equal(t, 2, progress.Invalid)
+	helpers.AssertIntEqual(t, 4, eventCache.GetEventCount())
+
+	// Metadata in the jsonl format survives the import
+	imported := eventCache.GetEventsByKind(1)
+	helpers.AssertIntEqual(t, 2, len(imported))
+	for _, event := range imported {
+		helpers.AssertBoolEqual(t, event.ID == events[0].ID, event.IsQuarantined)
+	}
+}
@@ -0,0 +1,271 @@
+// Package entitlement keeps track of which readers may read a paid or
+// restricted publication. Locked books keep their kind 30041 sections NIP-44
+// encrypted to the relay's key; entitled readers get them re-encrypted to
+// their own pubkey. Access is granted by the book's author, by an admin, or
+// by paying the book's price with a zap.
+package entitlement
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/config"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// Grant sources
+const (
+	SourceAuthor = "author"
+	SourceAdmin  = "admin"
+	SourceZap    = "zap"
+)
+
+var (
+	ErrNotFound     = fmt.Errorf("entitlement not found")
+	ErrInvalidGrant = fmt.Errorf("invalid entitlement")
+)
+
+// Grant lets Reader read Book, a publication address "30040:<pubkey>:<d>".
+// Grants follow the address, so they cover every revision of the book.
+type Grant struct {
+	Book      string    `json:"book"`
+	Reader    string    `json:"reader"`
+	Source    string    `json:"source"`
+	GrantedBy string    `json:"granted_by,omitempty"`
+	Reference string    `json:"reference,omitempty"` // Zap receipt ID for purchases
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Manager holds grants in memory, saves them to path after every change and
+// re-encrypts locked sections for entitled readers
+type Manager struct {
+	path      string
+	secretKey string
+	publicKey string
+	providers map[string]bool
+	grants    map[string]*Grant
+	mu        sync.RWMutex
+}
+
+// NewManager loads the grants saved at cfg.Path. An empty path keeps them in
+// memory only. Without a private key books can still be granted and sold,
+// but their sections can't be unlocked.
+func NewManager(cfg config.EntitlementsConfig) (*Manager, error) {
+	m := &Manager{
+		path:      cfg.Path,
+		providers: make(map[string]bool),
+		grants:    make(map[string]*Grant),
+	}
+
+	if cfg.PrivateKey != "" {
+		sk, err := parseSecretKey(cfg.PrivateKey)
+		if err != nil {
+			return nil, err
+		}
+		pub, err := nostr.GetPublicKey(sk)
+		if err != nil {
+			return nil, fmt.Errorf("invalid entitlements private key: %w", err)
+		}
+		m.secretKey, m.publicKey = sk, pub
+	}
+
+	for _, provider := range cfg.ZapProviders {
+		pubkey, err := parsePubkey(provider)
+		if err != nil {
+			return nil, fmt.Errorf("invalid zap provider: %w", err)
+		}
+		m.providers[pubkey] = true
+	}
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// PublicKey is the key authors encrypt locked sections to, empty when
+// unlocking is not configured
+func (m *Manager) PublicKey() string {
+	return m.publicKey
+}
+
+// Grant lets reader read book. Granting an existing entitlement again
+// returns the original grant.
+func (m *Manager) Grant(book, reader, source, grantedBy, reference string) (Grant, error) {
+	reader = strings.ToLower(reader)
+	if _, _, err := ParseBookAddress(book); err != nil {
+		return Grant{}, err
+	}
+	if !nostr.IsValid32ByteHex(reader) {
+		return Grant{}, fmt.Errorf("%w: reader must be a 64 character hex pubkey", ErrInvalidGrant)
+	}
+	if source != SourceAuthor && source != SourceAdmin && source != SourceZap {
+		return Grant{}, fmt.Errorf("%w: unknown source %q", ErrInvalidGrant, source)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := grantKey(book, reader)
+	if existing, ok := m.grants[key]; ok {
+		return *existing, nil
+	}
+	g := &Grant{
+		Book:      book,
+		Reader:    reader,
+		Source:    source,
+		GrantedBy: grantedBy,
+		Reference: reference,
+		CreatedAt: time.Now(),
+	}
+	m.grants[key] = g
+	if err := m.saveLocked(); err != nil {
+		delete(m.grants, key)
+		return Grant{}, err
+	}
+	return *g, nil
+}
+
+// Revoke takes reader's access to book away
+func (m *Manager) Revoke(book, reader string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := grantKey(book, strings.ToLower(reader))
+	g, ok := m.grants[key]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(m.grants, key)
+	if err := m.saveLocked(); err != nil {
+		m.grants[key] = g
+		return err
+	}
+	return nil
+}
+
+// Entitled reports whether reader may read book. Authors may always read
+// their own books.
+func (m *Manager) Entitled(book, reader string) bool {
+	reader = strings.ToLower(reader)
+	if author, _, err := ParseBookAddress(book); err == nil && author == reader {
+		return true
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.grants[grantKey(book, reader)]
+	return ok
+}
+
+// Grants returns the grants on book, oldest first
+func (m *Manager) Grants(book string) []Grant {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	list := []Grant{}
+	for _, g := range m.grants {
+		if g.Book == book {
+			list = append(list, *g)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// ParseBookAddress splits a publication address into its author and d tag
+func ParseBookAddress(book string) (author, d string, err error) {
+	parts := strings.SplitN(book, ":", 3)
+	if len(parts) != 3 || parts[0] != "30040" || !nostr.IsValid32ByteHex(parts[1]) {
+		return "", "", fmt.Errorf("%w: book must be a 30040:<pubkey>:<d> address", ErrInvalidGrant)
+	}
+	return parts[1], parts[2], nil
+}
+
+func grantKey(book, reader string) string {
+	return book + "|" + reader
+}
+
+func parseSecretKey(key string) (string, error) {
+	if strings.HasPrefix(key, "nsec") {
+		prefix, data, err := nip19.Decode(key)
+		if err != nil || prefix != "nsec" {
+			return "", fmt.Errorf("invalid entitlements private key: expected an nsec or hex key")
+		}
+		return data.(string), nil
+	}
+	if !nostr.IsValid32ByteHex(key) {
+		return "", fmt.Errorf("invalid entitlements private key: expected an nsec or hex key")
+	}
+	return strings.ToLower(key), nil
+}
+
+func parsePubkey(key string) (string, error) {
+	if nostr.IsValid32ByteHex(key) {
+		return strings.ToLower(key), nil
+	}
+	prefix, data, err := nip19.Decode(key)
+	if err != nil || prefix != "npub" {
+		return "", fmt.Errorf("%q: expected an npub or hex pubkey", key)
+	}
+	return data.(string), nil
+}
+
+func (m *Manager) load() error {
+	if m.path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(m.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", m.path, err)
+	}
+
+	var list []*Grant
+	if err := json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", m.path, err)
+	}
+	for _, g := range list {
+		m.grants[grantKey(g.Book, g.Reader)] = g
+	}
+	return nil
+}
+
+// saveLocked atomically writes the grants to path. Callers must hold m.mu.
+func (m *Manager) saveLocked() error {
+	if m.path == "" {
+		return nil
+	}
+
+	list := make([]*Grant, 0, len(m.grants))
+	for _, g := range m.grants {
+		list = append(list, g)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode entitlements: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.path), 0755); err != nil {
+		return fmt.Errorf("failed to write entitlements: %w", err)
+	}
+	tmp := m.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write entitlements: %w", err)
+	}
+	if err := os.Rename(tmp, m.path); err != nil {
+		return fmt.Errorf("failed to write entitlements: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package entitlement
+
+import (
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip44"
+)
+
+func newKey() (string, string) {
+	sk := nostr.GeneratePrivateKey()
+	pub, _ := nostr.GetPublicKey(sk)
+	return sk, pub
+}
+
+func testBook(author string, tags ...nostr.Tag) *models.Event {
+	return &models.Event{ID: "book", PubKey: author, Kind: 30040, Tags: append(nostr.Tags{{"d", "novel"}}, tags...)}
+}
+
+// zapReceipt builds a receipt signed by providerKey for a zap by senderKey
+// of the book address, paying invoice
+func zapReceipt(t *testing.T, providerKey, senderKey, book, invoice, amount string) *models.Event {
+	t.Helper()
+	request := nostr.Event{Kind: KindZapRequest, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"a", book}}}
+	if amount != "" {
+		request.Tags = append(request.Tags, nostr.Tag{"amount", amount})
+	}
+	helpers.AssertNoError(t, request.Sign(senderKey))
+	description, _ := json.Marshal(request)
+	receipt := nostr.Event{
+		Kind:      KindZapReceipt,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"bolt11", invoice}, {"description", string(description)}, {"a", book}},
+	}
+	helpers.AssertNoError(t, receipt.Sign(providerKey))
+	return models.FromNostrEvent(&receipt)
+}
+
+func TestGrants(t *testing.T) {
+	_, author := newKey()
+	_, reader := newKey()
+	book := "30040:" + author + ":novel"
+
+	path := filepath.Join(t.TempDir(), "entitlements.json")
+	m, err := NewManager(config.EntitlementsConfig{Path: path})
+	helpers.AssertNoError(t, err)
+
+	helpers.AssertFalse(t, m.Entitled(book, reader))
+	helpers.AssertTrue(t, m.Entitled(book, author))
+
+	g, err := m.Grant(book, reader, SourceAuthor, author, "")
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, m.Entitled(book, reader))
+
+	again, err := m.Grant(book, reader, SourceAdmin, "admin", "")
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, SourceAuthor, again.Source)
+	helpers.AssertTrue(t, g.CreatedAt.Equal(again.CreatedAt))
+
+	_, err = m.Grant("30023:"+author+":novel", reader, SourceAdmin, "admin", "")
+	helpers.AssertTrue(t, errors.Is(err, ErrInvalidGrant))
+	_, err = m.Grant(book, "npub", SourceAdmin, "admin", "")
+	helpers.AssertTrue(t, errors.Is(err, ErrInvalidGrant))
+
+	// Grants survive a restart
+	reloaded, err := NewManager(config.EntitlementsConfig{Path: path})
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, reloaded.Entitled(book, reader))
+	helpers.AssertIntEqual(t, 1, len(reloaded.Grants(book)))
+
+	helpers.AssertNoError(t, reloaded.Revoke(book, reader))
+	helpers.AssertFalse(t, reloaded.Entitled(book, reader))
+	helpers.AssertTrue(t, errors.Is(reloaded.Revoke(book, reader), ErrNotFound))
+}
+
+func TestPurchase(t *testing.T) {
+	_, author := newKey()
+	senderKey, sender := newKey()
+	providerKey, provider := newKey()
+	strangerKey, stranger := newKey()
+	address := "30040:" + author + ":novel"
+	book := testBook(author, nostr.Tag{"price", "2000", "sats"})
+
+	m, err := NewManager(config.EntitlementsConfig{ZapProviders: []string{provider}})
+	helpers.AssertNoError(t, err)
+
+	t.Run("Paid zap unlocks the book", func(t *testing.T) {
+		receipt := zapReceipt(t, providerKey, senderKey, address, "lnbc21u1pexample", "2100000")
+		zap, err := m.ParseZap(receipt)
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, sender, zap.Sender)
+		helpers.AssertTrue(t, zap.Msats == 2_100_000)
+
+		g, err := m.Purchase(zap, book)
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, SourceZap, g.Source)
+		helpers.AssertStringEqual(t, receipt.ID, g.Reference)
+		helpers.AssertTrue(t, m.Entitled(address, sender))
+	})
+
+	t.Run("Underpaid zap", func(t *testing.T) {
+		zap, err := m.ParseZap(zapReceipt(t, providerKey, senderKey, address, "lnbc1u1pexample", ""))
+		helpers.AssertNoError(t, err)
+		_, err = m.Purchase(zap, book)
+		helpers.AssertTrue(t, errors.Is(err, ErrUnderpaid))
+	})
+
+	t.Run("Book without a price", func(t *testing.T) {
+		zap, err := m.ParseZap(zapReceipt(t, providerKey, senderKey, address, "lnbc21u1pexample", ""))
+		helpers.AssertNoError(t, err)
+		_, err = m.Purchase(zap, testBook(author))
+		helpers.AssertTrue(t, errors.Is(err, ErrNotForSale))
+	})
+
+	t.Run("Untrusted provider", func(t *testing.T) {
+		_, err := m.ParseZap(zapReceipt(t, strangerKey, senderKey, address, "lnbc21u1pexample", ""))
+		helpers.AssertTrue(t, errors.Is(err, ErrUntrustedZap))
+	})
+
+	t.Run("Amount differs from the request", func(t *testing.T) {
+		_, err := m.ParseZap(zapReceipt(t, providerKey, senderKey, address, "lnbc21u1pexample", "5000000"))
+		helpers.AssertTrue(t, errors.Is(err, ErrInvalidZap))
+	})
+
+	t.Run("Tampered zap request", func(t *testing.T) {
+		receipt := zapReceipt(t, providerKey, senderKey, address, "lnbc21u1pexample", "")
+		var request nostr.Event
+		json.Unmarshal([]byte(receipt.Tags[1][1]), &request)
+		request.PubKey = stranger
+		description, _ := json.Marshal(request)
+		receipt.Tags[1][1] = string(description)
+
+		// Re-signed by the provider, so only the request is wrong
+		signed := receipt.ToNostrEvent()
+		helpers.AssertNoError(t, signed.Sign(providerKey))
+		_, err := m.ParseZap(models.FromNostrEvent(signed))
+		helpers.AssertTrue(t, errors.Is(err, ErrInvalidZap))
+	})
+
+	t.Run("Forged provider receipt", func(t *testing.T) {
+		// A receipt under the provider's pubkey, signed by someone else
+		forged := zapReceipt(t, strangerKey, senderKey, address, "lnbc21u1pexample", "")
+		forged.PubKey = provider
+		_, err := m.ParseZap(forged)
+		helpers.AssertErrorContains(t, err, "receipt ID doesn't match")
+
+		// ... or carrying an ID computed for the provider
+		signed := forged.ToNostrEvent()
+		signed.ID = signed.GetID()
+		_, err = m.ParseZap(models.FromNostrEvent(signed))
+		helpers.AssertErrorContains(t, err, "bad receipt signature")
+		helpers.AssertFalse(t, m.Entitled(address, stranger))
+	})
+
+	t.Run("Zaps of notes buy nothing", func(t *testing.T) {
+		_, err := m.ParseZap(zapReceipt(t, providerKey, senderKey, "1:"+author, "lnbc21u1pexample", ""))
+		helpers.AssertErrorContains(t, err, "zap is not for a book")
+	})
+}
+
+func TestParseZap(t *testing.T) {
+	providerKey, provider := newKey()
+	senderKey, sender := newKey()
+	_, recipient := newKey()
+	providers := map[string]bool{provider: true}
+
+	request := nostr.Event{Kind: KindZapRequest, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"p", recipient}}}
+	helpers.AssertNoError(t, request.Sign(senderKey))
+	description, _ := json.Marshal(request)
+	receipt := func(p string) *models.Event {
+		event := nostr.Event{
+			Kind:      KindZapReceipt,
+			CreatedAt: nostr.Now(),
+			Tags:      nostr.Tags{{"p", p}, {"bolt11", "lnbc5u1pexample"}, {"description", string(description)}},
+		}
+		helpers.AssertNoError(t, event.Sign(providerKey))
+		return models.FromNostrEvent(&event)
+	}
+
+	zap, err := ParseZap(receipt(recipient), providers)
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, sender, zap.Sender)
+	helpers.AssertStringEqual(t, recipient, zap.Recipient)
+	helpers.AssertStringEqual(t, "", zap.Book)
+	helpers.AssertInt64Equal(t, 500_000, zap.Msats)
+
+	_, err = ParseZap(receipt(sender), providers)
+	helpers.AssertErrorContains(t, err, "different recipients")
+	_, err = ParseZap(receipt(recipient), nil)
+	helpers.AssertTrue(t, errors.Is(err, ErrUntrustedZap))
+}
+
+func TestInvoiceMsats(t *testing.T) {
+	for invoice, want := range map[string]int64{
+		"lnbc25m1pexample":   2_500_000_000,
+		"lnbc2500u1pexample": 250_000_000,
+		"lnbc100n1pexample":  10_000,
+		"lnbc10p1pexample":   1,
+		"lntb21u1pexample":   2_100_000,
+		"lnbcrt50u1pexample": 5_000_000,
+		"LNBC2500U1PEXAMPLE": 250_000_000,
+	} {
+		got, err := InvoiceMsats(invoice)
+		helpers.AssertNoError(t, err)
+		if got != want {
+			t.Errorf("%s: expected %d msats, got %d", invoice, want, got)
+		}
+	}
+
+	for _, invoice := range []string{"", "lnbc1", "lnbc1pexample", "lnbcp1pexample", "lnbc15p1pexample", "bitcoin:abc"} {
+		_, err := InvoiceMsats(invoice)
+		helpers.AssertError(t, err)
+	}
+}
+
+func TestUnlock(t *testing.T) {
+	relayKey, relayPub := newKey()
+	authorKey, author := newKey()
+	readerKey, reader := newKey()
+
+	m, err := NewManager(config.EntitlementsConfig{PrivateKey: relayKey})
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, relayPub, m.PublicKey())
+
+	toRelay, _ := nip44.GenerateConversationKey(relayPub, authorKey)
+	ciphertext, err := nip44.Encrypt("= Chapter One\nIt was a dark and stormy night.", toRelay)
+	helpers.AssertNoError(t, err)
+	section := &models.Event{ID: "s1", PubKey: author, Kind: 30041, Content: ciphertext, Tags: nostr.Tags{{"encrypted", "nip44"}}}
+	helpers.AssertTrue(t, Locked(testBook(author), []*models.Event{section}))
+
+	unlocked, err := m.Unlock(section, reader)
+	helpers.AssertNoError(t, err)
+	fromRelay, _ := nip44.GenerateConversationKey(relayPub, readerKey)
+	plaintext, err := nip44.Decrypt(unlocked, fromRelay)
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, "= Chapter One\nIt was a dark and stormy night.", plaintext)
+
+	plain := &models.Event{ID: "s2", PubKey: author, Kind: 30041, Content: "free preview"}
+	content, err := m.Unlock(plain, reader)
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, "free preview", content)
+	helpers.AssertFalse(t, Locked(testBook(author), []*models.Event{plain}))
+
+	keyless, _ := NewManager(config.EntitlementsConfig{})
+	_, err = keyless.Unlock(section, reader)
+	helpers.AssertTrue(t, errors.Is(err, ErrNoKey))
+}
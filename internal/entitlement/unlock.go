@@ -0,0 +1,67 @@
+package entitlement
+
+import (
+	"fmt"
+
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr/nip44"
+)
+
+var ErrNoKey = fmt.Errorf("unlocking is not configured")
+
+// Encrypted reports whether a section's content is NIP-44 encrypted to the
+// relay, marked with an ["encrypted", "nip44"] tag
+func Encrypted(section *models.Event) bool {
+	for _, tag := range section.Tags {
+		if len(tag) >= 2 && tag[0] == "encrypted" && tag[1] == "nip44" {
+			return true
+		}
+	}
+	return false
+}
+
+// Locked reports whether a book needs an entitlement: it has a price or an
+// encrypted section
+func Locked(book *models.Event, sections []*models.Event) bool {
+	if _, ok := Price(book); ok {
+		return true
+	}
+	for _, section := range sections {
+		if Encrypted(section) {
+			return true
+		}
+	}
+	return false
+}
+
+// Unlock decrypts a section the author encrypted to the relay and encrypts
+// it again to reader, who decrypts it with the relay's public key.
+// Unencrypted sections are returned as they are.
+func (m *Manager) Unlock(section *models.Event, reader string) (string, error) {
+	if !Encrypted(section) {
+		return section.Content, nil
+	}
+	if m.secretKey == "" {
+		return "", ErrNoKey
+	}
+
+	authorKey, err := nip44.GenerateConversationKey(section.PubKey, m.secretKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to derive author key: %w", err)
+	}
+	plaintext, err := nip44.Decrypt(section.Content, authorKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt section %s: %w", section.ID, err)
+	}
+
+	readerKey, err := nip44.GenerateConversationKey(reader, m.secretKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to derive reader key: %w", err)
+	}
+	ciphertext, err := nip44.Encrypt(plaintext, readerKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt section %s: %w", section.ID, err)
+	}
+	return ciphertext, nil
+}
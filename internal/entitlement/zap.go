@@ -0,0 +1,193 @@
+package entitlement
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Zap kinds (NIP-57)
+const (
+	KindZapRequest = 9734
+	KindZapReceipt = 9735
+)
+
+var (
+	ErrNotForSale   = fmt.Errorf("book is not for sale")
+	ErrInvalidZap   = fmt.Errorf("invalid zap receipt")
+	ErrUnderpaid    = fmt.Errorf("zap is below the book's price")
+	ErrUntrustedZap = fmt.Errorf("zap receipt is not from a trusted provider")
+)
+
+// Zap is a parsed zap receipt
+type Zap struct {
+	Receipt   string // Receipt event ID
+	Book      string // Publication address, empty unless the zap paid for a book
+	Sender    string // Zap request pubkey, who gets the book
+	Recipient string // Pubkey the zap paid
+	Msats     int64  // Amount paid according to the invoice
+}
+
+// Price returns a book's price in millisats from its NIP-99 style
+// ["price", "<amount>", "<currency>"] tag. Only sats and msats are
+// understood; books without such a tag are not for sale.
+func Price(book *models.Event) (int64, bool) {
+	for _, tag := range book.Tags {
+		if len(tag) < 2 || tag[0] != "price" {
+			continue
+		}
+		amount, err := strconv.ParseInt(tag[1], 10, 64)
+		if err != nil || amount <= 0 {
+			return 0, false
+		}
+		currency := "sats"
+		if len(tag) >= 3 {
+			currency = strings.ToLower(tag[2])
+		}
+		switch currency {
+		case "sat", "sats":
+			return amount * 1000, true
+		case "msat", "msats":
+			return amount, true
+		}
+		return 0, false
+	}
+	return 0, false
+}
+
+// ParseZap checks a zap receipt signed by one of providers. The amount is
+// taken from the receipt's bolt11 invoice, which must match the amount the
+// sender asked for when the request names one.
+func ParseZap(receipt *models.Event, providers map[string]bool) (Zap, error) {
+	if receipt.Kind != KindZapReceipt {
+		return Zap{}, fmt.Errorf("%w: kind %d", ErrInvalidZap, receipt.Kind)
+	}
+	if !providers[receipt.PubKey] {
+		return Zap{}, ErrUntrustedZap
+	}
+
+	// Anyone can publish a receipt under a provider's pubkey; only its
+	// signature shows the provider saw the payment
+	signed := receipt.ToNostrEvent()
+	if !signed.CheckID() {
+		return Zap{}, fmt.Errorf("%w: receipt ID doesn't match its content", ErrInvalidZap)
+	}
+	if ok, err := signed.CheckSignature(); !ok {
+		return Zap{}, fmt.Errorf("%w: bad receipt signature: %v", ErrInvalidZap, err)
+	}
+
+	var request nostr.Event
+	if err := json.Unmarshal([]byte(tagValue(receipt.Tags, "description")), &request); err != nil {
+		return Zap{}, fmt.Errorf("%w: unreadable zap request: %v", ErrInvalidZap, err)
+	}
+	if request.Kind != KindZapRequest {
+		return Zap{}, fmt.Errorf("%w: zap request has kind %d", ErrInvalidZap, request.Kind)
+	}
+	if ok, err := request.CheckSignature(); !ok {
+		return Zap{}, fmt.Errorf("%w: bad zap request signature: %v", ErrInvalidZap, err)
+	}
+
+	recipient := tagValue(request.Tags, "p")
+	if tagValue(receipt.Tags, "p") != recipient {
+		return Zap{}, fmt.Errorf("%w: receipt and request name different recipients", ErrInvalidZap)
+	}
+
+	msats, err := InvoiceMsats(tagValue(receipt.Tags, "bolt11"))
+	if err != nil {
+		return Zap{}, fmt.Errorf("%w: %v", ErrInvalidZap, err)
+	}
+	if requested := tagValue(request.Tags, "amount"); requested != "" && requested != strconv.FormatInt(msats, 10) {
+		return Zap{}, fmt.Errorf("%w: invoice amount doesn't match the zap request", ErrInvalidZap)
+	}
+
+	zap := Zap{Receipt: receipt.ID, Sender: request.PubKey, Recipient: recipient, Msats: msats}
+	if book := tagValue(request.Tags, "a"); book != "" {
+		if _, _, err := ParseBookAddress(book); err == nil {
+			zap.Book = book
+		}
+	}
+	return zap, nil
+}
+
+// ParseZap checks a zap receipt from a trusted provider and returns the book
+// it paid for
+func (m *Manager) ParseZap(receipt *models.Event) (Zap, error) {
+	zap, err := ParseZap(receipt, m.providers)
+	if err != nil {
+		return Zap{}, err
+	}
+	if zap.Book == "" {
+		return Zap{}, fmt.Errorf("%w: zap is not for a book", ErrInvalidZap)
+	}
+	return zap, nil
+}
+
+// Purchase grants zap's sender access to book when the zap paid its price
+func (m *Manager) Purchase(zap Zap, book *models.Event) (Grant, error) {
+	if book.Kind != 30040 || fmt.Sprintf("30040:%s:%s", book.PubKey, tagValue(book.Tags, "d")) != zap.Book {
+		return Grant{}, fmt.Errorf("%w: zap is for %s", ErrInvalidZap, zap.Book)
+	}
+	price, ok := Price(book)
+	if !ok {
+		return Grant{}, ErrNotForSale
+	}
+	if zap.Msats < price {
+		return Grant{}, fmt.Errorf("%w: paid %d of %d msats", ErrUnderpaid, zap.Msats, price)
+	}
+	return m.Grant(zap.Book, zap.Sender, SourceZap, "", zap.Receipt)
+}
+
+// InvoiceMsats reads the amount from a bolt11 invoice's human-readable part,
+// e.g. "lnbc2500u1..." is 2500 micro-bitcoin
+func InvoiceMsats(invoice string) (int64, error) {
+	invoice = strings.ToLower(invoice)
+	sep := strings.LastIndex(invoice, "1")
+	if !strings.HasPrefix(invoice, "ln") || sep < 0 {
+		return 0, fmt.Errorf("missing bolt11 invoice")
+	}
+	hrp := invoice[2:sep]
+
+	// Skip the network prefix (bc, tb, bcrt, ...) up to the amount
+	start := strings.IndexAny(hrp, "0123456789")
+	if start < 0 {
+		return 0, fmt.Errorf("invoice has no amount")
+	}
+	amount := hrp[start:]
+
+	// Millisats per unit of each multiplier; one bitcoin is 1e11 msats
+	multipliers := map[byte]int64{'m': 100_000_000, 'u': 100_000, 'n': 100}
+	unit := int64(100_000_000_000)
+	last := amount[len(amount)-1]
+	switch {
+	case last == 'p':
+		// A pico-bitcoin is a tenth of a millisat
+		n, err := strconv.ParseInt(amount[:len(amount)-1], 10, 64)
+		if err != nil || n%10 != 0 {
+			return 0, fmt.Errorf("invalid invoice amount %q", amount)
+		}
+		return n / 10, nil
+	case multipliers[last] != 0:
+		unit = multipliers[last]
+		amount = amount[:len(amount)-1]
+	}
+
+	n, err := strconv.ParseInt(amount, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid invoice amount %q", amount)
+	}
+	return n * unit, nil
+}
+
+func tagValue(tags nostr.Tags, name string) string {
+	for _, tag := range tags {
+		if len(tag) >= 2 && tag[0] == name {
+			return tag[1]
+		}
+	}
+	return ""
+}
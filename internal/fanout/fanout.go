@@ -0,0 +1,299 @@
+// Package fanout delivers events to a WebSocket connection in the order they
+// were pushed, along with the EOSE and CLOSED messages that end a
+// subscription's stored events and the subscription itself, and every other
+// message for the connection such as OK, NOTICE and AUTH. Each connection
+// has one Queue drained by a single writer, the only goroutine writing to
+// its socket, so live events, stored events replayed to new subscriptions
+// and replies never race each other onto it. Pushing live events to every
+// queue under one lock gives all connections the same ingest order.
+package fanout
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"mercury-relay/internal/models"
+)
+
+// ErrClosed is returned when pushing to a closed stream or queue
+var ErrClosed = fmt.Errorf("stream closed")
+
+// ErrFull is returned by Push and PushPriority when the queue holds its
+// limit of events: the client isn't reading them
+var ErrFull = fmt.Errorf("queue full")
+
+// Message types; events have none
+const (
+	TypeEOSE   = "EOSE"
+	TypeClosed = "CLOSED"
+	// TypeFrame is any other message for the connection, see Queue.Send
+	TypeFrame = "FRAME"
+)
+
+// Message is an event, EOSE or CLOSED queued for one subscription
+type Message struct {
+	Type  string
+	SubID string
+	Event *models.Event
+	// Seq numbers the events of the subscription from 1 in the order they
+	// are written
+	Seq uint64
+	// Reason is the CLOSED message
+	Reason string
+	// Frame is the message of TypeFrame, written as is
+	Frame interface{}
+}
+
+type entry struct {
+	stream   *Stream // nil for frames
+	msg      Message
+	priority bool
+	final    bool // written although the stream is closed
+}
+
+// writable reports whether e is still to be written when it comes up
+func (e entry) writable() bool {
+	return e.stream == nil || !e.stream.closed || e.final
+}
+
+// Queue is the FIFO of events waiting to be written to one connection
+type Queue struct {
+	mu      sync.Mutex
+	pending []entry
+	closed  bool
+	limit   int
+
+	wake chan struct{} // an event was pushed
+	room chan struct{} // an event was written
+	done chan struct{}
+}
+
+// NewQueue returns an empty queue
+func NewQueue() *Queue {
+	return &Queue{
+		wake: make(chan struct{}, 1),
+		room: make(chan struct{}, 1),
+		done: make(chan struct{}),
+	}
+}
+
+// Stream is one subscription's share of a queue
+type Stream struct {
+	queue  *Queue
+	id     string
+	seq    uint64
+	closed bool
+}
+
+// Open starts a stream for subscription subID, numbered from 1
+func (q *Queue) Open(subID string) *Stream {
+	return &Stream{queue: q, id: subID}
+}
+
+// SetLimit bounds the events Push and PushPriority may leave waiting;
+// 0 leaves the queue unbounded
+func (q *Queue) SetLimit(limit int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.limit = limit
+}
+
+// Len returns how many events wait to be written
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.pending)
+}
+
+// Close drops the pending events and stops Run
+func (q *Queue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		q.pending = nil
+		close(q.done)
+	}
+}
+
+// Run writes queued messages in order until ctx is done, the queue is
+// closed or write fails. Events of streams closed while they waited are
+// skipped, the CLOSED message that ended a stream is not.
+func (q *Queue) Run(ctx context.Context, write func(Message) error) error {
+	for {
+		q.mu.Lock()
+		var next *entry
+		for len(q.pending) > 0 && next == nil {
+			if q.pending[0].writable() {
+				e := q.pending[0]
+				next = &e
+			}
+			q.pending[0] = entry{}
+			q.pending = q.pending[1:]
+		}
+		q.mu.Unlock()
+
+		if next == nil {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-q.done:
+				return ErrClosed
+			case <-q.wake:
+			}
+			continue
+		}
+
+		if err := write(next.msg); err != nil {
+			q.Close()
+			return err
+		}
+		signal(q.room)
+	}
+}
+
+// Send queues frame, a message for the connection that belongs to no
+// subscription such as OK or NOTICE, behind everything pushed before it. It
+// never blocks and is not held back by the queue's limit.
+func (q *Queue) Send(frame interface{}) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	q.pending = append(q.pending, entry{msg: Message{Type: TypeFrame, Frame: frame}})
+	signal(q.wake)
+	return nil
+}
+
+// Push queues event behind everything pushed before it. It never blocks.
+func (s *Stream) Push(event *models.Event) error {
+	q := s.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.full() {
+		return ErrFull
+	}
+	return s.pushLocked(event)
+}
+
+// PushPriority queues event ahead of ordinary events, behind earlier
+// priority events and the stream's own pending events so each subscription
+// still sees its events in order. It never blocks.
+func (s *Stream) PushPriority(event *models.Event) error {
+	q := s.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.full() {
+		return ErrFull
+	}
+	if err := s.pushLocked(event); err != nil {
+		return err
+	}
+	last := len(q.pending) - 1
+	at := 0
+	for i := last - 1; i >= 0; i-- {
+		if q.pending[i].priority || q.pending[i].stream == s {
+			at = i + 1
+			break
+		}
+	}
+	e := q.pending[last]
+	e.priority = true
+	copy(q.pending[at+1:], q.pending[at:last])
+	q.pending[at] = e
+	return nil
+}
+
+// PushWait is Push for producers that should not outrun the client: it
+// waits while max or more events are pending on the queue
+func (s *Stream) PushWait(ctx context.Context, event *models.Event, max int) error {
+	q := s.queue
+	for {
+		q.mu.Lock()
+		if len(q.pending) < max || s.closed || q.closed {
+			err := s.pushLocked(event)
+			q.mu.Unlock()
+			return err
+		}
+		q.mu.Unlock()
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-q.done:
+			return ErrClosed
+		case <-q.room:
+		}
+	}
+}
+
+// full reports whether the queue holds its limit. q.mu must be held.
+func (q *Queue) full() bool {
+	return q.limit > 0 && len(q.pending) >= q.limit && !q.closed
+}
+
+// pushLocked numbers and queues event. q.mu must be held.
+func (s *Stream) pushLocked(event *models.Event) error {
+	q := s.queue
+	if s.closed || q.closed {
+		return ErrClosed
+	}
+	s.seq++
+	q.pending = append(q.pending, entry{stream: s, msg: Message{SubID: s.id, Event: event, Seq: s.seq}})
+	signal(q.wake)
+	return nil
+}
+
+// EOSE queues the end of stored events behind the stream's events. It is
+// not held back by the queue's limit.
+func (s *Stream) EOSE() error {
+	q := s.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if s.closed || q.closed {
+		return ErrClosed
+	}
+	q.pending = append(q.pending, entry{stream: s, msg: Message{Type: TypeEOSE, SubID: s.id}})
+	signal(q.wake)
+	return nil
+}
+
+// Finish ends the stream with a CLOSED message giving reason. Its events
+// not yet written are dropped; later pushes fail.
+func (s *Stream) Finish(reason string) {
+	q := s.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if s.closed || q.closed {
+		return
+	}
+	s.closed = true
+	kept := q.pending[:0]
+	for _, e := range q.pending {
+		if e.stream != s {
+			kept = append(kept, e)
+		}
+	}
+	clear(q.pending[len(kept):])
+	q.pending = append(kept, entry{stream: s, msg: Message{Type: TypeClosed, SubID: s.id, Reason: reason}, final: true})
+	signal(q.wake)
+	signal(q.room)
+}
+
+// Close drops the stream's pending events; later pushes fail
+func (s *Stream) Close() {
+	s.queue.mu.Lock()
+	s.closed = true
+	s.queue.mu.Unlock()
+	// Waiting producers may have room now that nothing of s will be written
+	signal(s.queue.room)
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
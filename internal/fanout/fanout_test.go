@@ -0,0 +1,286 @@
+package fanout
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+)
+
+type recorder struct {
+	mu       sync.Mutex
+	messages []Message
+}
+
+func (r *recorder) write(m Message) error {
+	r.mu.Lock()
+	r.messages = append(r.messages, m)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *recorder) bySub(subID string) []Message {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var out []Message
+	for _, m := range r.messages {
+		if m.SubID == subID {
+			out = append(out, m)
+		}
+	}
+	return out
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOrderingUnderConcurrentIngest(t *testing.T) {
+	const producers, perProducer, connections = 8, 200, 3
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	queues := make([]*Queue, connections)
+	live := make([]*Stream, connections)
+	recorders := make([]*recorder, connections)
+	for i := range queues {
+		queues[i] = NewQueue()
+		live[i] = queues[i].Open("live")
+		recorders[i] = &recorder{}
+		go queues[i].Run(ctx, recorders[i].write)
+	}
+
+	// A replay on the first connection competes with live delivery
+	replay := queues[0].Open("replay")
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 500; i++ {
+			helpers.AssertNoError(t, replay.PushWait(ctx, &models.Event{ID: fmt.Sprintf("stored-%d", i)}, 16))
+		}
+	}()
+
+	// Producers ingest concurrently; fan-out is serialized like broadcastEvent
+	var broadcast sync.Mutex
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				event := &models.Event{ID: fmt.Sprintf("%d-%d", p, i)}
+				broadcast.Lock()
+				for _, stream := range live {
+					stream.Push(event)
+				}
+				broadcast.Unlock()
+			}
+		}(p)
+	}
+	wg.Wait()
+
+	total := producers * perProducer
+	for _, r := range recorders {
+		waitFor(t, func() bool { return len(r.bySub("live")) == total })
+	}
+	waitFor(t, func() bool { return len(recorders[0].bySub("replay")) == 500 })
+
+	reference := recorders[0].bySub("live")
+	for c, r := range recorders {
+		got := r.bySub("live")
+		last := make(map[int]int)
+		for i, m := range got {
+			// Every connection sees the same ingest order
+			helpers.AssertStringEqual(t, reference[i].Event.ID, m.Event.ID)
+			// Sequence numbers are gap-free in write order
+			helpers.AssertIntEqual(t, i+1, int(m.Seq))
+			// Each producer's events keep their order
+			var p, n int
+			fmt.Sscanf(m.Event.ID, "%d-%d", &p, &n)
+			if seen, ok := last[p]; ok && n <= seen {
+				t.Fatalf("connection %d: event %s after %d-%d", c, m.Event.ID, p, seen)
+			}
+			last[p] = n
+		}
+	}
+
+	for i, m := range recorders[0].bySub("replay") {
+		helpers.AssertStringEqual(t, fmt.Sprintf("stored-%d", i), m.Event.ID)
+		helpers.AssertIntEqual(t, i+1, int(m.Seq))
+	}
+}
+
+func TestClosedStream(t *testing.T) {
+	q := NewQueue()
+	a, b := q.Open("a"), q.Open("b")
+	helpers.AssertNoError(t, a.Push(&models.Event{ID: "a1"}))
+	helpers.AssertNoError(t, b.Push(&models.Event{ID: "b1"}))
+	helpers.AssertNoError(t, a.Push(&models.Event{ID: "a2"}))
+	a.Close()
+	helpers.AssertTrue(t, a.Push(&models.Event{ID: "a3"}) == ErrClosed)
+
+	// A reopened subscription is numbered from 1 again
+	again := q.Open("a")
+	helpers.AssertNoError(t, again.Push(&models.Event{ID: "a4"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := &recorder{}
+	stopped := make(chan struct{})
+	go func() {
+		q.Run(ctx, r.write)
+		close(stopped)
+	}()
+	waitFor(t, func() bool { return q.Len() == 0 && len(r.bySub("a"))+len(r.bySub("b")) == 2 })
+
+	helpers.AssertStringEqual(t, "b1", r.messages[0].Event.ID)
+	helpers.AssertStringEqual(t, "a4", r.messages[1].Event.ID)
+	helpers.AssertIntEqual(t, 1, int(r.messages[1].Seq))
+
+	// A full queue releases waiting producers once closed
+	cancel()
+	<-stopped
+	done := make(chan error)
+	q.mu.Lock()
+	for i := 0; i < 4; i++ {
+		q.pending = append(q.pending, entry{stream: b, msg: Message{SubID: "b"}})
+	}
+	q.mu.Unlock()
+	go func() { done <- b.PushWait(context.Background(), &models.Event{ID: "b2"}, 2) }()
+	q.Close()
+	helpers.AssertTrue(t, <-done == ErrClosed)
+}
+
+func TestPushPriority(t *testing.T) {
+	q := NewQueue()
+	feed, chat := q.Open("feed"), q.Open("chat")
+	helpers.AssertNoError(t, feed.Push(&models.Event{ID: "f1"}))
+	helpers.AssertNoError(t, chat.Push(&models.Event{ID: "c1"}))
+	helpers.AssertNoError(t, feed.Push(&models.Event{ID: "f2"}))
+	helpers.AssertNoError(t, chat.PushPriority(&models.Event{ID: "c2"}))
+	helpers.AssertNoError(t, feed.PushPriority(&models.Event{ID: "f3"}))
+	helpers.AssertNoError(t, chat.PushPriority(&models.Event{ID: "c3"}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := &recorder{}
+	go q.Run(ctx, r.write)
+	waitFor(t, func() bool { return q.Len() == 0 && len(r.bySub("feed"))+len(r.bySub("chat")) == 6 })
+
+	// Priority events skip ahead of other streams but not their own
+	var order []string
+	for _, m := range r.messages {
+		order = append(order, m.Event.ID)
+	}
+	helpers.AssertEqual(t, fmt.Sprint([]string{"f1", "c1", "c2", "f2", "f3", "c3"}), fmt.Sprint(order))
+	for _, sub := range []string{"feed", "chat"} {
+		for i, m := range r.bySub(sub) {
+			helpers.AssertIntEqual(t, i+1, int(m.Seq))
+		}
+	}
+}
+
+func TestLimit(t *testing.T) {
+	q := NewQueue()
+	q.SetLimit(2)
+	s := q.Open("feed")
+	helpers.AssertNoError(t, s.Push(&models.Event{ID: "e1"}))
+	helpers.AssertNoError(t, s.PushPriority(&models.Event{ID: "e2"}))
+	helpers.AssertTrue(t, s.Push(&models.Event{ID: "e3"}) == ErrFull)
+	helpers.AssertTrue(t, s.PushPriority(&models.Event{ID: "e3"}) == ErrFull)
+
+	// Refused events aren't numbered; there is room again once one is written
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := &recorder{}
+	go q.Run(ctx, r.write)
+	waitFor(t, func() bool { return q.Len() == 0 })
+	helpers.AssertNoError(t, s.Push(&models.Event{ID: "e4"}))
+	waitFor(t, func() bool { return len(r.bySub("feed")) == 3 })
+	helpers.AssertIntEqual(t, 3, int(r.bySub("feed")[2].Seq))
+
+	q.Close()
+	helpers.AssertTrue(t, s.Push(&models.Event{ID: "e5"}) == ErrClosed)
+}
+
+func TestEOSEAndClosed(t *testing.T) {
+	q := NewQueue()
+	q.SetLimit(2)
+	feed, chat := q.Open("feed"), q.Open("chat")
+	helpers.AssertNoError(t, feed.Push(&models.Event{ID: "f1"}))
+	helpers.AssertNoError(t, chat.Push(&models.Event{ID: "c1"}))
+	// EOSE is queued even when the queue is full
+	helpers.AssertNoError(t, feed.EOSE())
+	helpers.AssertNoError(t, chat.PushWait(context.Background(), &models.Event{ID: "c2"}, 10))
+	chat.Finish("error: shutting down")
+	helpers.AssertTrue(t, chat.PushWait(context.Background(), &models.Event{ID: "c3"}, 10) == ErrClosed)
+	helpers.AssertTrue(t, chat.EOSE() == ErrClosed)
+	chat.Finish("ignored")
+
+	// Refusing a REQ finishes a stream that never had events
+	q.Open("refused").Finish("rate-limited: slow down")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := &recorder{}
+	go q.Run(ctx, r.write)
+	waitFor(t, func() bool { return q.Len() == 0 && len(r.messages) == 4 })
+
+	var order []string
+	for _, m := range r.messages {
+		if m.Type == "" {
+			order = append(order, m.Event.ID)
+		} else {
+			order = append(order, m.SubID+" "+m.Type+" "+m.Reason)
+		}
+	}
+	helpers.AssertEqual(t, fmt.Sprint([]string{
+		"f1", "feed EOSE ", "chat CLOSED error: shutting down", "refused CLOSED rate-limited: slow down",
+	}), fmt.Sprint(order))
+}
+
+func TestSend(t *testing.T) {
+	q := NewQueue()
+	q.SetLimit(1)
+	feed := q.Open("feed")
+	helpers.AssertNoError(t, feed.Push(&models.Event{ID: "f1"}))
+	helpers.AssertTrue(t, feed.Push(&models.Event{ID: "f2"}) == ErrFull)
+	// Frames are queued even when the queue is full, and outlive the
+	// streams queued around them
+	helpers.AssertNoError(t, q.Send([]interface{}{"OK", "f1", true, ""}))
+	helpers.AssertNoError(t, feed.EOSE())
+	helpers.AssertNoError(t, q.Send([]interface{}{"NOTICE", "hello"}))
+	feed.Finish("closed: done")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	r := &recorder{}
+	go q.Run(ctx, r.write)
+	waitFor(t, func() bool { return q.Len() == 0 && len(r.messages) == 3 })
+
+	var order []string
+	for _, m := range r.messages {
+		if m.Type == TypeFrame {
+			order = append(order, fmt.Sprint(m.Frame))
+		} else {
+			order = append(order, m.SubID+" "+m.Type)
+		}
+	}
+	helpers.AssertEqual(t, fmt.Sprint([]string{
+		"[OK f1 true ]", "[NOTICE hello]", "feed CLOSED",
+	}), fmt.Sprint(order))
+
+	q.Close()
+	helpers.AssertTrue(t, q.Send([]interface{}{"NOTICE", "late"}) == ErrClosed)
+}
@@ -0,0 +1,95 @@
+package forwarding
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/config"
+
+	"github.com/rabbitmq/amqp091-go"
+)
+
+// AMQPPublisher forwards events to an external AMQP exchange. The rule topic
+// is used as the routing key.
+type AMQPPublisher struct {
+	config  config.AMQPTarget
+	conn    *amqp091.Connection
+	channel *amqp091.Channel
+	mu      sync.Mutex
+}
+
+func NewAMQPPublisher(cfg config.AMQPTarget) (*AMQPPublisher, error) {
+	if cfg.ExchangeType == "" {
+		cfg.ExchangeType = "topic"
+	}
+
+	conn, err := amqp091.Dial(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to AMQP broker: %w", err)
+	}
+
+	channel, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open channel: %w", err)
+	}
+
+	if err := channel.ExchangeDeclare(
+		cfg.Exchange,
+		cfg.ExchangeType,
+		true,  // durable
+		false, // auto-delete
+		false, // internal
+		false, // no-wait
+		nil,   // arguments
+	); err != nil {
+		channel.Close()
+		conn.Close()
+		return nil, fmt.Errorf("failed to declare exchange: %w", err)
+	}
+
+	return &AMQPPublisher{
+		config:  cfg,
+		conn:    conn,
+		channel: channel,
+	}, nil
+}
+
+// Publish sends payload with topic as the routing key. QoS above 0 marks the
+// message persistent; retain has no AMQP equivalent and is ignored.
+func (p *AMQPPublisher) Publish(topic string, qos byte, retain bool, payload []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	deliveryMode := amqp091.Transient
+	if qos > 0 {
+		deliveryMode = amqp091.Persistent
+	}
+
+	if err := p.channel.Publish(
+		p.config.Exchange,
+		topic,
+		false, // mandatory
+		false, // immediate
+		amqp091.Publishing{
+			ContentType:  "application/json",
+			DeliveryMode: deliveryMode,
+			Body:         payload,
+			Timestamp:    time.Now(),
+		},
+	); err != nil {
+		return fmt.Errorf("failed to publish to exchange %s: %w", p.config.Exchange, err)
+	}
+	return nil
+}
+
+func (p *AMQPPublisher) Close() error {
+	if p.channel != nil {
+		p.channel.Close()
+	}
+	if p.conn != nil {
+		return p.conn.Close()
+	}
+	return nil
+}
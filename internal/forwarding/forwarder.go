@@ -0,0 +1,211 @@
+package forwarding
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"text/template"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Publisher delivers a payload to a topic on an external broker
+type Publisher interface {
+	Publish(topic string, qos byte, retain bool, payload []byte) error
+	Close() error
+}
+
+// RuleStats tracks delivery metrics for a single forwarding rule
+type RuleStats struct {
+	Matched   int64     `json:"matched"`
+	Delivered int64     `json:"delivered"`
+	Failed    int64     `json:"failed"`
+	LastError string    `json:"last_error,omitempty"`
+	LastSent  time.Time `json:"last_sent,omitempty"`
+}
+
+type rule struct {
+	config   config.ForwardingRule
+	filter   nostr.Filter
+	topic    *template.Template
+	template *template.Template
+}
+
+// Forwarder matches events against forwarding rules and publishes them
+type Forwarder struct {
+	config     config.ForwardingConfig
+	rules      []*rule
+	publishers map[string]Publisher
+
+	stats map[string]*RuleStats
+	mu    sync.Mutex
+}
+
+// templateData is what topic and payload templates are evaluated against
+type templateData struct {
+	*models.Event
+	JSON string
+}
+
+func NewForwarder(cfg config.ForwardingConfig) (*Forwarder, error) {
+	f := &Forwarder{
+		config:     cfg,
+		publishers: make(map[string]Publisher),
+		stats:      make(map[string]*RuleStats),
+	}
+
+	for i, rc := range cfg.Rules {
+		name := rc.Name
+		if name == "" {
+			name = fmt.Sprintf("rule-%d", i)
+			rc.Name = name
+		}
+
+		topic, err := template.New(name + "-topic").Parse(rc.Topic)
+		if err != nil {
+			return nil, fmt.Errorf("invalid topic template for rule %s: %w", name, err)
+		}
+
+		r := &rule{
+			config: rc,
+			topic:  topic,
+			filter: nostr.Filter{
+				Kinds:   rc.Kinds,
+				Authors: rc.Authors,
+				Tags:    nostr.TagMap(rc.Tags),
+			},
+		}
+
+		if rc.Template != "" {
+			r.template, err = template.New(name + "-payload").Parse(rc.Template)
+			if err != nil {
+				return nil, fmt.Errorf("invalid payload template for rule %s: %w", name, err)
+			}
+		}
+
+		f.rules = append(f.rules, r)
+		f.stats[name] = &RuleStats{}
+	}
+
+	return f, nil
+}
+
+// SetPublisher registers the publisher for a target ("mqtt" or "amqp")
+func (f *Forwarder) SetPublisher(target string, publisher Publisher) {
+	f.publishers[target] = publisher
+}
+
+// Start connects to the brokers referenced by the configured rules
+func (f *Forwarder) Start(ctx context.Context) error {
+	targets := make(map[string]bool)
+	for _, r := range f.rules {
+		targets[r.config.Target] = true
+	}
+
+	if targets["mqtt"] && f.publishers["mqtt"] == nil {
+		publisher, err := NewMQTTPublisher(f.config.MQTT)
+		if err != nil {
+			return fmt.Errorf("failed to connect to MQTT broker: %w", err)
+		}
+		f.publishers["mqtt"] = publisher
+	}
+
+	if targets["amqp"] && f.publishers["amqp"] == nil {
+		publisher, err := NewAMQPPublisher(f.config.AMQP)
+		if err != nil {
+			return fmt.Errorf("failed to connect to AMQP broker: %w", err)
+		}
+		f.publishers["amqp"] = publisher
+	}
+
+	log.Printf("Event forwarding started with %d rule(s)", len(f.rules))
+	return nil
+}
+
+// Forward publishes event to every rule whose filter it matches
+func (f *Forwarder) Forward(event *models.Event) {
+	for _, r := range f.rules {
+		if !r.filter.Matches(event.ToNostrEvent()) {
+			continue
+		}
+
+		err := f.deliver(r, event)
+
+		f.mu.Lock()
+		stats := f.stats[r.config.Name]
+		stats.Matched++
+		if err != nil {
+			stats.Failed++
+			stats.LastError = err.Error()
+		} else {
+			stats.Delivered++
+			stats.LastSent = time.Now()
+		}
+		f.mu.Unlock()
+
+		if err != nil {
+			log.Printf("Failed to forward event %s via rule %s: %v", event.ID, r.config.Name, err)
+		}
+	}
+}
+
+func (f *Forwarder) deliver(r *rule, event *models.Event) error {
+	publisher := f.publishers[r.config.Target]
+	if publisher == nil {
+		return fmt.Errorf("no %s publisher configured", r.config.Target)
+	}
+
+	raw, err := json.Marshal(event.ToNostrEvent())
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	data := templateData{Event: event, JSON: string(raw)}
+
+	var topic bytes.Buffer
+	if err := r.topic.Execute(&topic, data); err != nil {
+		return fmt.Errorf("failed to render topic: %w", err)
+	}
+
+	payload := raw
+	if r.template != nil {
+		var buf bytes.Buffer
+		if err := r.template.Execute(&buf, data); err != nil {
+			return fmt.Errorf("failed to render payload: %w", err)
+		}
+		payload = buf.Bytes()
+	}
+
+	return publisher.Publish(topic.String(), r.config.QoS, r.config.Retain, payload)
+}
+
+// GetStats returns delivery metrics keyed by rule name
+func (f *Forwarder) GetStats() map[string]RuleStats {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	stats := make(map[string]RuleStats, len(f.stats))
+	for name, s := range f.stats {
+		stats[name] = *s
+	}
+	return stats
+}
+
+func (f *Forwarder) Close() error {
+	var errors []error
+	for target, publisher := range f.publishers {
+		if err := publisher.Close(); err != nil {
+			errors = append(errors, fmt.Errorf("%s: %w", target, err))
+		}
+	}
+	if len(errors) > 0 {
+		return fmt.Errorf("forwarder close errors: %v", errors)
+	}
+	return nil
+}
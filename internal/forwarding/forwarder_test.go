@@ -0,0 +1,142 @@
+package forwarding
+
+import (
+	"bufio"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+type recordedMessage struct {
+	topic   string
+	qos     byte
+	payload string
+}
+
+type fakePublisher struct {
+	messages []recordedMessage
+}
+
+func (f *fakePublisher) Publish(topic string, qos byte, retain bool, payload []byte) error {
+	f.messages = append(f.messages, recordedMessage{topic: topic, qos: qos, payload: string(payload)})
+	return nil
+}
+
+func (f *fakePublisher) Close() error { return nil }
+
+func TestForwarderRules(t *testing.T) {
+	eg := models.NewEventGenerator()
+
+	forwarder, err := NewForwarder(config.ForwardingConfig{
+		Enabled: true,
+		Rules: []config.ForwardingRule{
+			{
+				Name:     "epaper",
+				Target:   "mqtt",
+				Kinds:    []int{1},
+				Tags:     map[string][]string{"t": {"weather"}},
+				Topic:    "nostr/{{.Kind}}/{{.PubKey}}",
+				QoS:      1,
+				Template: `{"text":{{printf "%q" .Content}}}`,
+			},
+			{
+				Name:   "archive",
+				Target: "amqp",
+				Topic:  "events.{{.Kind}}",
+			},
+		},
+	})
+	helpers.AssertNoError(t, err)
+
+	mqtt := &fakePublisher{}
+	amqp := &fakePublisher{}
+	forwarder.SetPublisher("mqtt", mqtt)
+	forwarder.SetPublisher("amqp", amqp)
+
+	npub := eg.GetRandomNpub()
+	weather := eg.GenerateTextNote(npub, "Sunny", nostr.Tags{{"t", "weather"}})
+	other := eg.GenerateTextNote(npub, "Unrelated", nostr.Tags{{"t", "news"}})
+
+	forwarder.Forward(weather)
+	forwarder.Forward(other)
+
+	helpers.AssertIntEqual(t, 1, len(mqtt.messages))
+	helpers.AssertStringEqual(t, "nostr/1/"+npub, mqtt.messages[0].topic)
+	helpers.AssertStringEqual(t, `{"text":"Sunny"}`, mqtt.messages[0].payload)
+	helpers.AssertIntEqual(t, 1, int(mqtt.messages[0].qos))
+
+	helpers.AssertIntEqual(t, 2, len(amqp.messages))
+	helpers.AssertStringEqual(t, "events.1", amqp.messages[0].topic)
+	helpers.AssertBoolEqual(t, true, strings.Contains(amqp.messages[0].payload, `"content":"Sunny"`))
+
+	stats := forwarder.GetStats()
+	helpers.AssertIntEqual(t, 1, int(stats["epaper"].Delivered))
+	helpers.AssertIntEqual(t, 2, int(stats["archive"].Matched))
+}
+
+func TestForwarderMissingPublisher(t *testing.T) {
+	eg := models.NewEventGenerator()
+
+	forwarder, err := NewForwarder(config.ForwardingConfig{
+		Rules: []config.ForwardingRule{{Name: "orphan", Target: "mqtt", Topic: "nostr"}},
+	})
+	helpers.AssertNoError(t, err)
+
+	forwarder.Forward(eg.GenerateTextNote(eg.GetRandomNpub(), "hello", nostr.Tags{}))
+
+	stats := forwarder.GetStats()
+	helpers.AssertIntEqual(t, 1, int(stats["orphan"].Failed))
+	helpers.AssertBoolEqual(t, true, stats["orphan"].LastError != "")
+}
+
+func TestMQTTPublisher(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	helpers.AssertNoError(t, err)
+	defer listener.Close()
+
+	received := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		p := &MQTTPublisher{conn: conn}
+		p.reader = bufio.NewReader(conn)
+
+		// CONNECT -> CONNACK
+		if packetType, _, err := p.readPacket(); err != nil || packetType != mqttConnect {
+			return
+		}
+		conn.Write([]byte{mqttConnack << 4, 2, 0, 0})
+
+		// PUBLISH QoS 1 -> PUBACK
+		_, body, err := p.readPacket()
+		if err != nil {
+			return
+		}
+		topicLen := int(binary.BigEndian.Uint16(body))
+		topic := string(body[2 : 2+topicLen])
+		id := body[2+topicLen : 4+topicLen]
+		payload := string(body[4+topicLen:])
+		conn.Write([]byte{mqttPuback << 4, 2, id[0], id[1]})
+
+		received <- topic + " " + payload
+	}()
+
+	publisher, err := NewMQTTPublisher(config.MQTTTarget{Broker: "tcp://" + listener.Addr().String(), ClientID: "test"})
+	helpers.AssertNoError(t, err)
+	defer publisher.Close()
+
+	err = publisher.Publish("nostr/1", 1, false, []byte("hello"))
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, "nostr/1 hello", <-received)
+}
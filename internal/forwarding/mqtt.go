@@ -0,0 +1,271 @@
+package forwarding
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/config"
+)
+
+// MQTT 3.1.1 control packet types
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttPuback     = 4
+	mqttPubrec     = 5
+	mqttPubrel     = 6
+	mqttPubcomp    = 7
+	mqttPingreq    = 12
+	mqttDisconnect = 14
+)
+
+const (
+	mqttKeepAlive   = 60 * time.Second
+	mqttDialTimeout = 10 * time.Second
+	mqttAckTimeout  = 10 * time.Second
+)
+
+// MQTTPublisher is a minimal MQTT 3.1.1 client that only publishes. QoS 1 and
+// 2 deliveries wait for the broker's acknowledgement before returning.
+type MQTTPublisher struct {
+	config   config.MQTTTarget
+	conn     net.Conn
+	reader   *bufio.Reader
+	packetID uint16
+	mu       sync.Mutex
+	done     chan struct{}
+}
+
+func NewMQTTPublisher(cfg config.MQTTTarget) (*MQTTPublisher, error) {
+	p := &MQTTPublisher{
+		config: cfg,
+		done:   make(chan struct{}),
+	}
+	if err := p.connect(); err != nil {
+		return nil, err
+	}
+	go p.keepAlive()
+	return p, nil
+}
+
+func (p *MQTTPublisher) connect() error {
+	broker, err := url.Parse(p.config.Broker)
+	if err != nil {
+		return fmt.Errorf("invalid broker URL: %w", err)
+	}
+
+	var conn net.Conn
+	switch broker.Scheme {
+	case "tcp", "mqtt", "":
+		conn, err = net.DialTimeout("tcp", broker.Host, mqttDialTimeout)
+	case "ssl", "tls", "mqtts":
+		dialer := &net.Dialer{Timeout: mqttDialTimeout}
+		conn, err = tls.DialWithDialer(dialer, "tcp", broker.Host, &tls.Config{ServerName: broker.Hostname()})
+	default:
+		return fmt.Errorf("unsupported broker scheme %q", broker.Scheme)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to dial broker: %w", err)
+	}
+
+	p.conn = conn
+	p.reader = bufio.NewReader(conn)
+
+	if _, err := conn.Write(p.connectPacket()); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to send CONNECT: %w", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(mqttAckTimeout))
+	packetType, body, err := p.readPacket()
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to read CONNACK: %w", err)
+	}
+	if packetType != mqttConnack || len(body) < 2 {
+		conn.Close()
+		return fmt.Errorf("unexpected packet %d while waiting for CONNACK", packetType)
+	}
+	if body[1] != 0 {
+		conn.Close()
+		return fmt.Errorf("broker refused connection with code %d", body[1])
+	}
+
+	return nil
+}
+
+func (p *MQTTPublisher) connectPacket() []byte {
+	clientID := p.config.ClientID
+	if clientID == "" {
+		clientID = fmt.Sprintf("mercury-relay-%d", time.Now().UnixNano())
+	}
+
+	flags := byte(0x02) // clean session
+	var payload []byte
+	payload = appendString(payload, clientID)
+	if p.config.Username != "" {
+		flags |= 0x80
+		payload = appendString(payload, p.config.Username)
+	}
+	if p.config.Password != "" {
+		flags |= 0x40
+		payload = appendString(payload, p.config.Password)
+	}
+
+	var variable []byte
+	variable = appendString(variable, "MQTT")
+	variable = append(variable, 4, flags) // protocol level 4 = 3.1.1
+	variable = binary.BigEndian.AppendUint16(variable, uint16(mqttKeepAlive/time.Second))
+
+	return encodePacket(mqttConnect<<4, append(variable, payload...))
+}
+
+// Publish sends payload to topic and, for QoS 1 and 2, waits for the broker
+// to acknowledge it
+func (p *MQTTPublisher) Publish(topic string, qos byte, retain bool, payload []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if qos > 2 {
+		return fmt.Errorf("invalid qos %d", qos)
+	}
+
+	header := byte(mqttPublish<<4) | qos<<1
+	if retain {
+		header |= 0x01
+	}
+
+	body := appendString(nil, topic)
+	var id uint16
+	if qos > 0 {
+		p.packetID++
+		if p.packetID == 0 {
+			p.packetID = 1
+		}
+		id = p.packetID
+		body = binary.BigEndian.AppendUint16(body, id)
+	}
+	body = append(body, payload...)
+
+	if _, err := p.conn.Write(encodePacket(header, body)); err != nil {
+		return fmt.Errorf("failed to send PUBLISH: %w", err)
+	}
+
+	switch qos {
+	case 1:
+		return p.awaitAck(mqttPuback, id)
+	case 2:
+		if err := p.awaitAck(mqttPubrec, id); err != nil {
+			return err
+		}
+		rel := encodePacket(mqttPubrel<<4|0x02, binary.BigEndian.AppendUint16(nil, id))
+		if _, err := p.conn.Write(rel); err != nil {
+			return fmt.Errorf("failed to send PUBREL: %w", err)
+		}
+		return p.awaitAck(mqttPubcomp, id)
+	}
+	return nil
+}
+
+// awaitAck reads packets until the acknowledgement for id arrives. Callers
+// must hold p.mu.
+func (p *MQTTPublisher) awaitAck(want byte, id uint16) error {
+	p.conn.SetReadDeadline(time.Now().Add(mqttAckTimeout))
+	defer p.conn.SetReadDeadline(time.Time{})
+
+	for {
+		packetType, body, err := p.readPacket()
+		if err != nil {
+			return fmt.Errorf("failed waiting for acknowledgement: %w", err)
+		}
+		if packetType == want && len(body) >= 2 && binary.BigEndian.Uint16(body) == id {
+			return nil
+		}
+	}
+}
+
+func (p *MQTTPublisher) readPacket() (byte, []byte, error) {
+	header, err := p.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length := 0
+	for shift := 0; ; shift += 7 {
+		b, err := p.reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(b&0x7f) << shift
+		if b&0x80 == 0 {
+			break
+		}
+		if shift >= 21 {
+			return 0, nil, fmt.Errorf("malformed remaining length")
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(p.reader, body); err != nil {
+		return 0, nil, err
+	}
+	return header >> 4, body, nil
+}
+
+func (p *MQTTPublisher) keepAlive() {
+	ticker := time.NewTicker(mqttKeepAlive / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.mu.Lock()
+			p.conn.Write(encodePacket(mqttPingreq<<4, nil))
+			p.mu.Unlock()
+		}
+	}
+}
+
+func (p *MQTTPublisher) Close() error {
+	close(p.done)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.conn.Write(encodePacket(mqttDisconnect<<4, nil))
+	return p.conn.Close()
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// encodePacket prefixes body with the fixed header and variable-length size
+func encodePacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	length := len(body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
@@ -0,0 +1,253 @@
+// Package idempotency makes retried REST publishes safe. A publish runs once
+// per key; concurrent retries wait for it and later retries within the
+// window get its stored result instead of enqueueing the event again.
+//
+// Results are appended to a log file as they are stored, so a restart keeps
+// the window. The log is compacted when loaded and whenever it has grown to
+// twice the keys it last kept.
+package idempotency
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/config"
+)
+
+// minCompaction is the fewest kept keys compaction is scheduled for, so
+// small stores are not rewritten on every publish
+const minCompaction = 1024
+
+// ErrMismatch is returned when a key is reused for a different event
+var ErrMismatch = fmt.Errorf("idempotency key reused for a different event")
+
+// Result is the response of a publish
+type Result struct {
+	Status    int             `json:"status"`
+	Header    http.Header     `json:"header,omitempty"`
+	Body      json.RawMessage `json:"body,omitempty"`
+	EventID   string          `json:"event_id"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// record is one line of the log
+type record struct {
+	Key string `json:"key"`
+	Result
+}
+
+// call is a publish in flight
+type call struct {
+	eventID string
+	result  Result
+	done    chan struct{}
+}
+
+// Store remembers publish results per key for a window
+type Store struct {
+	config   config.IdempotencyConfig
+	mu       sync.Mutex
+	results  map[string]Result
+	inflight map[string]*call
+	file     *os.File
+	lines    int // results logged since the last compaction, kept included
+	kept     int // results kept by the last compaction
+	now      func() time.Time
+}
+
+// NewStore loads the results still within the window from cfg.Path
+func NewStore(cfg config.IdempotencyConfig) (*Store, error) {
+	s := &Store{
+		config:   cfg,
+		results:  make(map[string]Result),
+		inflight: make(map[string]*call),
+		now:      time.Now,
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	if err := s.compactLocked(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// stored reports whether a result is kept for later retries. Failed
+// publishes are not, so retrying them tries again.
+func stored(result Result) bool {
+	return result.Status >= 200 && result.Status < 300
+}
+
+// Do runs publish for key unless it already ran within the window, and
+// returns its result. Calls with the same key while publish runs wait for
+// it. replayed is set when the result came from another call. A key used
+// for a different event fails with ErrMismatch.
+func (s *Store) Do(key, eventID string, publish func() Result) (result Result, replayed bool, err error) {
+	s.mu.Lock()
+	if previous, ok := s.results[key]; ok && s.now().Sub(previous.CreatedAt) < s.config.Window {
+		s.mu.Unlock()
+		if previous.EventID != eventID {
+			return Result{}, false, ErrMismatch
+		}
+		return previous, true, nil
+	}
+	if c, ok := s.inflight[key]; ok {
+		s.mu.Unlock()
+		<-c.done
+		if c.eventID != eventID {
+			return Result{}, false, ErrMismatch
+		}
+		return c.result, true, nil
+	}
+	c := &call{eventID: eventID, done: make(chan struct{})}
+	s.inflight[key] = c
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		delete(s.inflight, key)
+		if stored(c.result) {
+			s.results[key] = c.result
+			if err := s.appendLocked(key, c.result); err != nil {
+				log.Printf("Failed to persist idempotency key: %v", err)
+			}
+		}
+		s.mu.Unlock()
+		close(c.done)
+	}()
+	c.result = publish()
+	c.result.EventID = eventID
+	c.result.CreatedAt = s.now()
+	return c.result, false, nil
+}
+
+// Len returns how many keys are remembered
+func (s *Store) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.results)
+}
+
+// Close closes the log file
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *Store) load() error {
+	if s.config.Path == "" {
+		return nil
+	}
+	file, err := os.Open(s.config.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", s.config.Path, err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var r record
+		// A line cut short by a crash is skipped
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil || r.Key == "" {
+			continue
+		}
+		s.results[r.Key] = r.Result
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %s: %w", s.config.Path, err)
+	}
+	return nil
+}
+
+// expireLocked forgets results older than the window
+func (s *Store) expireLocked() {
+	now := s.now()
+	for key, result := range s.results {
+		if now.Sub(result.CreatedAt) >= s.config.Window {
+			delete(s.results, key)
+		}
+	}
+}
+
+// compactLocked forgets expired results, rewrites the log with the rest and
+// reopens it for appending. Callers must hold s.mu.
+func (s *Store) compactLocked() error {
+	s.expireLocked()
+	s.kept = len(s.results)
+	s.lines = s.kept
+	if s.config.Path == "" {
+		return nil
+	}
+	if s.file != nil {
+		s.file.Close()
+		s.file = nil
+	}
+	if err := os.MkdirAll(filepath.Dir(s.config.Path), 0755); err != nil {
+		return fmt.Errorf("failed to write idempotency keys: %w", err)
+	}
+	tmp := s.config.Path + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write idempotency keys: %w", err)
+	}
+	w := bufio.NewWriter(file)
+	encoder := json.NewEncoder(w)
+	for key, result := range s.results {
+		if err := encoder.Encode(record{Key: key, Result: result}); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write idempotency keys: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write idempotency keys: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write idempotency keys: %w", err)
+	}
+	if err := os.Rename(tmp, s.config.Path); err != nil {
+		return fmt.Errorf("failed to write idempotency keys: %w", err)
+	}
+	s.file, err = os.OpenFile(s.config.Path, os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open idempotency keys: %w", err)
+	}
+	return nil
+}
+
+// appendLocked logs a stored result, compacting the log once it has grown
+// to twice the keys kept at the last compaction. Callers must hold s.mu.
+func (s *Store) appendLocked(key string, result Result) error {
+	s.lines++
+	if s.lines > 2*max(s.kept, minCompaction) || (s.file == nil && s.config.Path != "") {
+		return s.compactLocked()
+	}
+	if s.file == nil {
+		return nil
+	}
+	data, err := json.Marshal(record{Key: key, Result: result})
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotency key: %w", err)
+	}
+	if _, err := s.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write idempotency keys: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,136 @@
+package idempotency
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/test/helpers"
+)
+
+func newStore(t *testing.T, path string) *Store {
+	t.Helper()
+	s, err := NewStore(config.IdempotencyConfig{Window: time.Hour, Path: path})
+	helpers.AssertNoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestRetryStorm(t *testing.T) {
+	s := newStore(t, "")
+	var runs atomic.Int32
+	release := make(chan struct{})
+	publish := func() Result {
+		runs.Add(1)
+		<-release
+		return Result{Status: http.StatusOK, Body: []byte(`{"status":"published"}`)}
+	}
+
+	// Every retry sent while the first publish runs waits for its result
+	var wg sync.WaitGroup
+	var replays atomic.Int32
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			result, replayed, err := s.Do("key:alice:1", "event1", publish)
+			helpers.AssertNoError(t, err)
+			helpers.AssertIntEqual(t, http.StatusOK, result.Status)
+			if replayed {
+				replays.Add(1)
+			}
+		}()
+	}
+	for runs.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	helpers.AssertIntEqual(t, 1, int(runs.Load()))
+	helpers.AssertIntEqual(t, 49, int(replays.Load()))
+
+	// So does one sent afterwards
+	result, replayed, err := s.Do("key:alice:1", "event1", publish)
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, replayed)
+	helpers.AssertStringEqual(t, `{"status":"published"}`, string(result.Body))
+	helpers.AssertIntEqual(t, 1, int(runs.Load()))
+
+	// A key can't be reused for another event
+	_, _, err = s.Do("key:alice:1", "event2", publish)
+	helpers.AssertTrue(t, err == ErrMismatch)
+}
+
+func TestFailuresNotKept(t *testing.T) {
+	s := newStore(t, "")
+	var runs int
+	fail := func() Result {
+		runs++
+		return Result{Status: http.StatusTooManyRequests}
+	}
+	for i := 0; i < 3; i++ {
+		_, replayed, err := s.Do("event:e1", "e1", fail)
+		helpers.AssertNoError(t, err)
+		helpers.AssertFalse(t, replayed)
+	}
+	helpers.AssertIntEqual(t, 3, runs)
+	helpers.AssertIntEqual(t, 0, s.Len())
+}
+
+func TestWindowSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "idempotency.jsonl")
+	s := newStore(t, path)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	ok := func() Result { return Result{Status: http.StatusOK, Body: []byte(`{}`)} }
+	_, _, err := s.Do("event:old", "old", ok)
+	helpers.AssertNoError(t, err)
+	now = now.Add(30 * time.Minute)
+	_, _, err = s.Do("event:new", "new", ok)
+	helpers.AssertNoError(t, err)
+	helpers.AssertNoError(t, s.Close())
+
+	// A line cut short by a crash is skipped
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	helpers.AssertNoError(t, err)
+	f.WriteString(`{"key":"event:torn","status":2`)
+	f.Close()
+
+	restarted := newStore(t, path)
+	helpers.AssertIntEqual(t, 2, restarted.Len())
+	restarted.now = func() time.Time { return now.Add(45 * time.Minute) }
+	_, replayed, err := restarted.Do("event:new", "new", func() Result { t.Fatal("published twice"); return Result{} })
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, replayed)
+
+	// Past the window the event is published again
+	_, replayed, err = restarted.Do("event:old", "old", ok)
+	helpers.AssertNoError(t, err)
+	helpers.AssertFalse(t, replayed)
+}
+
+func TestCompaction(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "idempotency.jsonl")
+	s := newStore(t, path)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+	ok := func() Result { return Result{Status: http.StatusCreated} }
+	for i := 0; i < 2*minCompaction; i++ {
+		s.Do(fmt.Sprintf("event:%d", i), fmt.Sprint(i), ok)
+	}
+
+	// Once the window has passed the next compaction drops everything
+	now = now.Add(2 * time.Hour)
+	s.Do("event:last", "last", ok)
+	helpers.AssertIntEqual(t, 1, s.Len())
+	data, err := os.ReadFile(path)
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 1, strings.Count(string(data), "\n"))
+}
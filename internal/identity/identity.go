@@ -0,0 +1,190 @@
+// Package identity holds the relay's own Nostr key. It signs REST responses
+// and service NOTICEs so clients can tell they are talking to the authentic
+// relay, even through mirrors and proxies.
+package identity
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"mercury-relay/internal/config"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// KindServiceMessage is the ephemeral kind of signed service NOTICEs
+const KindServiceMessage = 20100
+
+// Response signature headers
+const (
+	PubkeyHeader    = "X-Relay-Pubkey"
+	SignatureHeader = "X-Relay-Signature"
+	TimestampHeader = "X-Relay-Signature-Timestamp"
+)
+
+var ErrInvalidKey = fmt.Errorf("invalid relay identity key")
+
+// Identity is the relay's key pair and what it signs
+type Identity struct {
+	secretKey     string
+	publicKey     string
+	signResponses bool
+	signNotices   bool
+}
+
+// Load returns the identity from cfg.PrivateKey, or from the key saved at
+// cfg.KeyPath, generating and saving one on first start
+func Load(cfg config.IdentityConfig) (*Identity, error) {
+	sk := cfg.PrivateKey
+	if sk == "" {
+		var err error
+		if sk, err = loadOrGenerate(cfg.KeyPath); err != nil {
+			return nil, err
+		}
+	}
+	return New(sk, cfg.SignResponses, cfg.SignNotices)
+}
+
+// New returns the identity of a secret key given as nsec or hex
+func New(secretKey string, signResponses, signNotices bool) (*Identity, error) {
+	sk, err := parseSecretKey(secretKey)
+	if err != nil {
+		return nil, err
+	}
+	pub, err := nostr.GetPublicKey(sk)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	return &Identity{secretKey: sk, publicKey: pub, signResponses: signResponses, signNotices: signNotices}, nil
+}
+
+// PublicKey returns the relay's hex pubkey
+func (id *Identity) PublicKey() string {
+	return id.publicKey
+}
+
+// Npub returns the relay's pubkey in NIP-19 form
+func (id *Identity) Npub() string {
+	npub, _ := nip19.EncodePublicKey(id.publicKey)
+	return npub
+}
+
+// SignsResponses reports whether REST responses should carry a signature
+func (id *Identity) SignsResponses() bool {
+	return id.signResponses
+}
+
+// SignsNotices reports whether service NOTICEs should carry a signed event
+func (id *Identity) SignsNotices() bool {
+	return id.signNotices
+}
+
+// Sign returns the hex Schnorr signature of message's SHA-256 hash
+func (id *Identity) Sign(message []byte) (string, error) {
+	skBytes, err := hex.DecodeString(id.secretKey)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	priv, _ := btcec.PrivKeyFromBytes(skBytes)
+	hash := sha256.Sum256(message)
+	sig, err := schnorr.Sign(priv, hash[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign: %w", err)
+	}
+	return hex.EncodeToString(sig.Serialize()), nil
+}
+
+// Verify checks a signature made by Sign
+func Verify(pubkey string, message []byte, signature string) bool {
+	pubBytes, err := hex.DecodeString(pubkey)
+	if err != nil {
+		return false
+	}
+	pub, err := schnorr.ParsePubKey(pubBytes)
+	if err != nil {
+		return false
+	}
+	sigBytes, err := hex.DecodeString(signature)
+	if err != nil {
+		return false
+	}
+	sig, err := schnorr.ParseSignature(sigBytes)
+	if err != nil {
+		return false
+	}
+	hash := sha256.Sum256(message)
+	return sig.Verify(hash[:], pub)
+}
+
+// ResponseMessage is what a REST response signature covers: the timestamp
+// header, the request method and URI, and the body. Binding the request
+// keeps a mirror from passing one endpoint's response off as another's.
+func ResponseMessage(timestamp int64, method, requestURI string, body []byte) []byte {
+	header := strconv.FormatInt(timestamp, 10) + "\n" + method + " " + requestURI + "\n"
+	return append([]byte(header), body...)
+}
+
+// ServiceMessage returns message as an ephemeral event signed by the relay
+func (id *Identity) ServiceMessage(message string) (*nostr.Event, error) {
+	event := &nostr.Event{
+		Kind:      KindServiceMessage,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{},
+		Content:   message,
+	}
+	if err := event.Sign(id.secretKey); err != nil {
+		return nil, fmt.Errorf("failed to sign service message: %w", err)
+	}
+	return event, nil
+}
+
+// loadOrGenerate reads the hex key saved at path, or generates one and saves
+// it there
+func loadOrGenerate(path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("%w: set a private key or key path", ErrInvalidKey)
+	}
+
+	data, err := os.ReadFile(path)
+	if err == nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	sk := nostr.GeneratePrivateKey()
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return "", fmt.Errorf("failed to save relay identity key: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, []byte(sk+"\n"), 0600); err != nil {
+		return "", fmt.Errorf("failed to save relay identity key: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return "", fmt.Errorf("failed to save relay identity key: %w", err)
+	}
+	return sk, nil
+}
+
+func parseSecretKey(key string) (string, error) {
+	if strings.HasPrefix(key, "nsec") {
+		prefix, data, err := nip19.Decode(key)
+		if err != nil || prefix != "nsec" {
+			return "", fmt.Errorf("%w: expected an nsec or hex key", ErrInvalidKey)
+		}
+		return data.(string), nil
+	}
+	if !nostr.IsValid32ByteHex(key) {
+		return "", fmt.Errorf("%w: expected an nsec or hex key", ErrInvalidKey)
+	}
+	return strings.ToLower(key), nil
+}
@@ -0,0 +1,77 @@
+package identity
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+func TestLoad(t *testing.T) {
+	t.Run("Configured key", func(t *testing.T) {
+		sk := nostr.GeneratePrivateKey()
+		pub, _ := nostr.GetPublicKey(sk)
+		nsec, _ := nip19.EncodePrivateKey(sk)
+
+		id, err := Load(config.IdentityConfig{PrivateKey: nsec, SignResponses: true})
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, pub, id.PublicKey())
+		helpers.AssertTrue(t, id.SignsResponses())
+		helpers.AssertFalse(t, id.SignsNotices())
+	})
+
+	t.Run("Generated key is kept", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "keys", "relay.key")
+		first, err := Load(config.IdentityConfig{KeyPath: path})
+		helpers.AssertNoError(t, err)
+		second, err := Load(config.IdentityConfig{KeyPath: path})
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, first.PublicKey(), second.PublicKey())
+
+		info, err := os.Stat(path)
+		helpers.AssertNoError(t, err)
+		helpers.AssertTrue(t, info.Mode().Perm() == 0600)
+	})
+
+	t.Run("Invalid keys", func(t *testing.T) {
+		_, err := Load(config.IdentityConfig{PrivateKey: "nsec1nope"})
+		helpers.AssertTrue(t, errors.Is(err, ErrInvalidKey))
+		_, err = Load(config.IdentityConfig{})
+		helpers.AssertTrue(t, errors.Is(err, ErrInvalidKey))
+	})
+}
+
+func TestSign(t *testing.T) {
+	id, err := New(nostr.GeneratePrivateKey(), true, true)
+	helpers.AssertNoError(t, err)
+
+	message := ResponseMessage(1700000000, "GET", "/api/v1/health", []byte(`{"success":true}`))
+	sig, err := id.Sign(message)
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, Verify(id.PublicKey(), message, sig))
+
+	tampered := ResponseMessage(1700000000, "GET", "/api/v1/stats", []byte(`{"success":true}`))
+	helpers.AssertFalse(t, Verify(id.PublicKey(), tampered, sig))
+	other, _ := New(nostr.GeneratePrivateKey(), true, true)
+	helpers.AssertFalse(t, Verify(other.PublicKey(), message, sig))
+	helpers.AssertFalse(t, Verify(id.PublicKey(), message, "zz"))
+}
+
+func TestServiceMessage(t *testing.T) {
+	id, err := New(nostr.GeneratePrivateKey(), false, true)
+	helpers.AssertNoError(t, err)
+
+	event, err := id.ServiceMessage("Relay restarting in 5 minutes")
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, KindServiceMessage, event.Kind)
+	helpers.AssertStringEqual(t, id.PublicKey(), event.PubKey)
+	ok, err := event.CheckSignature()
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, ok)
+}
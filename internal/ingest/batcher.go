@@ -0,0 +1,170 @@
+// Package ingest groups queued events into batches so storage is written
+// once per batch instead of once per event, and queue messages are
+// acknowledged only after their batch is stored.
+package ingest
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/logging"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/queue"
+	"mercury-relay/internal/tracing"
+)
+
+const (
+	// idlePoll is how long to wait on an empty queue
+	idlePoll = 100 * time.Millisecond
+	// fillPoll is how long to wait for more events while a batch is open
+	fillPoll = 5 * time.Millisecond
+	// errorBackoff is how long to wait after the queue failed
+	errorBackoff = time.Second
+)
+
+// Batcher consumes events in batches and stores each batch at once
+type Batcher struct {
+	source queue.BatchConsumer
+	store  cache.Cache
+	size   int
+	delay  time.Duration
+	hold   func(event *models.Event) bool
+}
+
+// NewBatcher groups events from source into batches of up to
+// cfg.WriteBatchSize, waiting at most cfg.WriteBatchDelay for one to fill
+func NewBatcher(source queue.BatchConsumer, store cache.Cache, cfg config.CacheConfig) *Batcher {
+	size := cfg.WriteBatchSize
+	if size < 1 {
+		size = 1
+	}
+	return &Batcher{
+		source: source,
+		store:  store,
+		size:   size,
+		delay:  cfg.WriteBatchDelay,
+	}
+}
+
+// SetHold keeps the events hold takes, such as quarantined ones, out of the
+// cache: their messages are acknowledged but they are neither stored nor
+// delivered
+func (b *Batcher) SetHold(hold func(event *models.Event) bool) {
+	b.hold = hold
+}
+
+// Run stores batches until ctx is done, calling deliver for every stored
+// event in queue order
+func (b *Batcher) Run(ctx context.Context, deliver func(event *models.Event)) {
+	for ctx.Err() == nil {
+		for _, event := range b.Commit(b.Next(ctx)) {
+			deliver(event)
+		}
+	}
+}
+
+// Next waits until a batch is full or its first event waited the batch
+// delay. When ctx is done it returns what it has, possibly nothing.
+func (b *Batcher) Next(ctx context.Context) []queue.Delivery {
+	var batch []queue.Delivery
+	var deadline time.Time
+
+	for {
+		wait := idlePoll
+		got, err := b.source.ConsumeBatch(b.size - len(batch))
+		if err != nil {
+			slog.Error("Error consuming events", "error", err)
+			if len(batch) > 0 {
+				return batch
+			}
+			wait = errorBackoff
+		}
+
+		if len(batch) == 0 && len(got) > 0 {
+			deadline = time.Now().Add(b.delay)
+		}
+		batch = append(batch, got...)
+		if len(batch) >= b.size || (len(batch) > 0 && !time.Now().Before(deadline)) {
+			return batch
+		}
+		if len(batch) > 0 {
+			wait = min(fillPoll, time.Until(deadline))
+		}
+
+		select {
+		case <-ctx.Done():
+			return batch
+		case <-time.After(wait):
+		}
+	}
+}
+
+// Commit stores batch and acknowledges its messages, returning the stored
+// events. When the batch fails as a whole each event is retried on its own:
+// failures are requeued once and dropped when they fail again.
+func (b *Batcher) Commit(batch []queue.Delivery) []*models.Event {
+	if b.hold != nil {
+		kept := batch[:0]
+		for _, d := range batch {
+			if !b.hold(d.Event) {
+				kept = append(kept, d)
+			} else if err := d.Ack(); err != nil {
+				eventLog(d.Event).Error("Error acknowledging event", "error", err)
+			}
+		}
+		batch = kept
+	}
+	if len(batch) == 0 {
+		return nil
+	}
+
+	events := make([]*models.Event, len(batch))
+	spans := make([]*tracing.Span, len(batch))
+	for i, d := range batch {
+		events[i] = d.Event
+		_, spans[i] = tracing.Continue(context.Background(), d.Event.TraceParent, tracing.KindConsumer, "cache store",
+			logging.KeyEventID, d.Event.ID, "batch.size", len(batch))
+	}
+	err := cache.StoreEvents(b.store, events)
+	for _, span := range spans {
+		span.RecordError(err)
+		span.End()
+	}
+	if err == nil {
+		for _, d := range batch {
+			if err := d.Ack(); err != nil {
+				eventLog(d.Event).Error("Error acknowledging event", "error", err)
+			}
+		}
+		return events
+	}
+
+	slog.Warn("Error storing batch, retrying one by one", "events", len(batch), "error", err)
+	stored := make([]*models.Event, 0, len(batch))
+	for _, d := range batch {
+		if err := b.store.StoreEvent(d.Event); err != nil {
+			if d.Redelivered {
+				eventLog(d.Event).Error("Dropping event after a second failed store", "error", err)
+			} else {
+				eventLog(d.Event).Warn("Requeueing event after a failed store", "error", err)
+			}
+			if err := d.Nack(!d.Redelivered); err != nil {
+				eventLog(d.Event).Error("Error rejecting event", "error", err)
+			}
+			continue
+		}
+		if err := d.Ack(); err != nil {
+			eventLog(d.Event).Error("Error acknowledging event", "error", err)
+		}
+		stored = append(stored, d.Event)
+	}
+	return stored
+}
+
+// eventLog returns a logger tagged with the event and the trace it belongs to
+func eventLog(event *models.Event) *slog.Logger {
+	return slog.With(logging.KeyEventID, event.ID, logging.KeyTraceID, event.TraceID)
+}
@@ -0,0 +1,231 @@
+package ingest
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/queue"
+	"mercury-relay/test/helpers"
+	"mercury-relay/test/mocks"
+)
+
+// fakeQueue hands out events and records how their messages were settled
+type fakeQueue struct {
+	pending     []*models.Event
+	redelivered map[string]bool
+	acked       []string
+	dropped     []string
+	mu          sync.Mutex
+}
+
+func newFakeQueue(events ...*models.Event) *fakeQueue {
+	return &fakeQueue{pending: events, redelivered: make(map[string]bool)}
+}
+
+func (q *fakeQueue) ConsumeBatch(max int) ([]queue.Delivery, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := min(max, len(q.pending))
+	deliveries := make([]queue.Delivery, 0, n)
+	for _, event := range q.pending[:n] {
+		event := event
+		deliveries = append(deliveries, queue.Delivery{
+			Event:       event,
+			Redelivered: q.redelivered[event.ID],
+			Ack: func() error {
+				q.mu.Lock()
+				defer q.mu.Unlock()
+				q.acked = append(q.acked, event.ID)
+				return nil
+			},
+			Nack: func(requeue bool) error {
+				q.mu.Lock()
+				defer q.mu.Unlock()
+				if requeue {
+					q.pending = append(q.pending, event)
+					q.redelivered[event.ID] = true
+				} else {
+					q.dropped = append(q.dropped, event.ID)
+				}
+				return nil
+			},
+		})
+	}
+	q.pending = q.pending[n:]
+	return deliveries, nil
+}
+
+// batchCache counts batch writes and can fail them, and individual writes of
+// chosen events
+type batchCache struct {
+	*mocks.MockCache
+	latency   time.Duration
+	batches   int
+	failBatch bool
+	failIDs   map[string]bool
+}
+
+func newBatchCache() *batchCache {
+	return &batchCache{MockCache: mocks.NewMockCache(), failIDs: make(map[string]bool)}
+}
+
+func (c *batchCache) StoreEvent(event *models.Event) error {
+	time.Sleep(c.latency)
+	if c.failIDs[event.ID] {
+		return fmt.Errorf("store failed")
+	}
+	return c.MockCache.StoreEvent(event)
+}
+
+func (c *batchCache) StoreEvents(events []*models.Event) error {
+	// Two round trips, like the Redis backend
+	time.Sleep(2 * c.latency)
+	c.batches++
+	if c.failBatch {
+		return fmt.Errorf("batch failed")
+	}
+	for _, event := range events {
+		c.MockCache.StoreEvent(event)
+	}
+	return nil
+}
+
+func testEvents(n int) []*models.Event {
+	events := make([]*models.Event, n)
+	for i := range events {
+		events[i] = &models.Event{ID: strconv.Itoa(i), Kind: 1, Content: "note"}
+	}
+	return events
+}
+
+func TestBatcher(t *testing.T) {
+	t.Run("Fills batches up to the size", func(t *testing.T) {
+		q := newFakeQueue(testEvents(25)...)
+		store := newBatchCache()
+		b := NewBatcher(q, store, config.CacheConfig{WriteBatchSize: 10, WriteBatchDelay: time.Second})
+
+		batch := b.Next(context.Background())
+		helpers.AssertIntEqual(t, 10, len(batch))
+		stored := b.Commit(batch)
+		helpers.AssertIntEqual(t, 10, len(stored))
+		helpers.AssertIntEqual(t, 10, len(q.acked))
+		helpers.AssertIntEqual(t, 1, store.batches)
+		helpers.AssertIntEqual(t, 10, store.GetEventCount())
+	})
+
+	t.Run("Closes a partial batch after the delay", func(t *testing.T) {
+		q := newFakeQueue(testEvents(3)...)
+		b := NewBatcher(q, newBatchCache(), config.CacheConfig{WriteBatchSize: 100, WriteBatchDelay: 20 * time.Millisecond})
+
+		start := time.Now()
+		batch := b.Next(context.Background())
+		helpers.AssertIntEqual(t, 3, len(batch))
+		helpers.AssertTrue(t, time.Since(start) >= 20*time.Millisecond)
+	})
+
+	t.Run("Keeps held events out of the cache", func(t *testing.T) {
+		q := newFakeQueue(testEvents(4)...)
+		store := newBatchCache()
+		b := NewBatcher(q, store, config.CacheConfig{WriteBatchSize: 4, WriteBatchDelay: time.Second})
+		b.SetHold(func(event *models.Event) bool { return event.ID == "1" || event.ID == "2" })
+
+		stored := b.Commit(b.Next(context.Background()))
+		helpers.AssertIntEqual(t, 2, len(stored))
+		helpers.AssertStringEqual(t, "0", stored[0].ID)
+		helpers.AssertStringEqual(t, "3", stored[1].ID)
+		helpers.AssertFalse(t, store.HasEvent("1"))
+		helpers.AssertIntEqual(t, 4, len(q.acked))
+
+		// A batch held whole stores nothing
+		q = newFakeQueue(testEvents(3)[1:]...)
+		b = NewBatcher(q, store, config.CacheConfig{WriteBatchSize: 2, WriteBatchDelay: time.Second})
+		b.SetHold(func(*models.Event) bool { return true })
+		helpers.AssertIntEqual(t, 0, len(b.Commit(b.Next(context.Background()))))
+		helpers.AssertIntEqual(t, 1, store.batches)
+	})
+
+	t.Run("Defers acks until the batch is stored", func(t *testing.T) {
+		q := newFakeQueue(testEvents(5)...)
+		b := NewBatcher(q, newBatchCache(), config.CacheConfig{WriteBatchSize: 5, WriteBatchDelay: time.Second})
+
+		batch := b.Next(context.Background())
+		helpers.AssertIntEqual(t, 0, len(q.acked))
+		b.Commit(batch)
+		helpers.AssertIntEqual(t, 5, len(q.acked))
+	})
+
+	t.Run("Retries a failed batch one by one", func(t *testing.T) {
+		q := newFakeQueue(testEvents(4)...)
+		store := newBatchCache()
+		store.failBatch = true
+		store.failIDs["2"] = true
+		b := NewBatcher(q, store, config.CacheConfig{WriteBatchSize: 4, WriteBatchDelay: time.Second})
+
+		stored := b.Commit(b.Next(context.Background()))
+		helpers.AssertIntEqual(t, 3, len(stored))
+		helpers.AssertIntEqual(t, 3, len(q.acked))
+		helpers.AssertIntEqual(t, 1, len(q.pending))
+
+		// The requeued event fails again and is dropped
+		stored = b.Commit(b.Next(context.Background()))
+		helpers.AssertIntEqual(t, 0, len(stored))
+		helpers.AssertIntEqual(t, 1, len(q.dropped))
+		helpers.AssertStringEqual(t, "2", q.dropped[0])
+		helpers.AssertIntEqual(t, 0, len(q.pending))
+	})
+
+	t.Run("Run delivers stored events in order", func(t *testing.T) {
+		q := newFakeQueue(testEvents(7)...)
+		b := NewBatcher(q, newBatchCache(), config.CacheConfig{WriteBatchSize: 3, WriteBatchDelay: 5 * time.Millisecond})
+
+		ctx, cancel := context.WithCancel(context.Background())
+		var delivered []string
+		b.Run(ctx, func(event *models.Event) {
+			delivered = append(delivered, event.ID)
+			if len(delivered) == 7 {
+				cancel()
+			}
+		})
+		helpers.AssertIntEqual(t, 7, len(delivered))
+		for i, id := range delivered {
+			helpers.AssertStringEqual(t, strconv.Itoa(i), id)
+		}
+	})
+}
+
+// BenchmarkIngest compares storing one event per write with group commit
+// against a store that sleeps on every round trip
+func BenchmarkIngest(b *testing.B) {
+	for _, size := range []int{1, 10, 100} {
+		b.Run(fmt.Sprintf("batch=%d", size), func(b *testing.B) {
+			store := newBatchCache()
+			store.latency = 100 * time.Microsecond
+			q := newFakeQueue(testEvents(b.N)...)
+			batcher := NewBatcher(q, store, config.CacheConfig{WriteBatchSize: size, WriteBatchDelay: time.Millisecond})
+
+			b.ResetTimer()
+			stored := 0
+			for stored < b.N {
+				batch := batcher.Next(context.Background())
+				if size == 1 {
+					// Per-event path: one StoreEvent each, as before batching
+					for _, d := range batch {
+						store.StoreEvent(d.Event)
+						d.Ack()
+					}
+					stored += len(batch)
+					continue
+				}
+				stored += len(batcher.Commit(batch))
+			}
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "events/s")
+		})
+	}
+}
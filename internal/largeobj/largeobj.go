@@ -0,0 +1,140 @@
+// Package largeobj keeps events too large for the queue and cache out of
+// them. Long-form articles and books with embedded data URIs can be
+// megabytes each; queued and cached whole they crowd out everything else.
+// Above a size threshold the full event goes to a large-object store (XFTP
+// or local files) and a stub with the event's fields and tags but no
+// content is queued and cached instead, so it is still indexed. Queries
+// reassemble stubs from the store as they are read.
+//
+// Wrap the queue with Router.Queue and the cache with Router.Cache before
+// handing them to the relay and its components.
+package largeobj
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+)
+
+// ErrTooLarge is returned for events over the maximum event size
+var ErrTooLarge = fmt.Errorf("event too large")
+
+// Router decides which events take the large-object path
+type Router struct {
+	config config.LargeObjectConfig
+	store  Store
+
+	offloaded   atomic.Int64
+	reassembled atomic.Int64
+	missing     atomic.Int64
+}
+
+// NewRouter offloads events over cfg.Threshold to store
+func NewRouter(cfg config.LargeObjectConfig, store Store) *Router {
+	return &Router{config: cfg, store: store}
+}
+
+// Threshold is the size above which events are offloaded
+func (r *Router) Threshold() int {
+	return r.config.Threshold
+}
+
+// MaxEventSize is the size of the largest event accepted
+func (r *Router) MaxEventSize() int {
+	return r.config.MaxEventSize
+}
+
+// Size is an event's payload size: its content and tag values in bytes
+func Size(event *models.Event) int {
+	size := len(event.Content)
+	for _, tag := range event.Tags {
+		for _, value := range tag {
+			size += len(value)
+		}
+	}
+	return size
+}
+
+// Check rejects events over the maximum event size
+func (r *Router) Check(event *models.Event) error {
+	if size := Size(event); r.config.MaxEventSize > 0 && size > r.config.MaxEventSize {
+		return fmt.Errorf("%w: %d bytes, the limit is %d", ErrTooLarge, size, r.config.MaxEventSize)
+	}
+	return nil
+}
+
+// IsLarge reports whether event takes the large-object path
+func (r *Router) IsLarge(event *models.Event) bool {
+	return !event.Offloaded && Size(event) > r.config.Threshold
+}
+
+// Offload stores a large event and returns the stub to queue and cache in
+// its place. Other events are returned as they are.
+func (r *Router) Offload(event *models.Event) (*models.Event, error) {
+	if !r.IsLarge(event) {
+		return event, nil
+	}
+	if err := r.store.StoreEvent(event); err != nil {
+		return nil, fmt.Errorf("failed to store large event %s: %w", event.ID, err)
+	}
+	r.offloaded.Add(1)
+	stub := *event
+	stub.Content = ""
+	stub.Offloaded = true
+	return &stub, nil
+}
+
+// Reassemble returns the full event for a stub, and other events as they
+// are. The stub's index metadata, which the relay may have added after
+// offloading, is kept.
+func (r *Router) Reassemble(ctx context.Context, event *models.Event) (*models.Event, error) {
+	if !event.Offloaded {
+		return event, nil
+	}
+	stored, err := r.store.GetEvent(ctx, event.ID)
+	if err != nil || stored == nil || stored.ID != event.ID {
+		r.missing.Add(1)
+		if err == nil {
+			err = fmt.Errorf("not found")
+		}
+		return nil, fmt.Errorf("failed to load large event %s: %w", event.ID, err)
+	}
+	r.reassembled.Add(1)
+	full := *event
+	full.Content = stored.Content
+	full.Tags = stored.Tags
+	full.Sig = stored.Sig
+	full.Offloaded = false
+	return &full, nil
+}
+
+// reassembleOrLog reassembles event, logging and returning nil when the
+// full event can't be loaded
+func (r *Router) reassembleOrLog(ctx context.Context, event *models.Event) *models.Event {
+	full, err := r.Reassemble(ctx, event)
+	if err != nil {
+		log.Printf("Skipping offloaded event: %v", err)
+		return nil
+	}
+	return full
+}
+
+// Delete removes a stub's full event from the store
+func (r *Router) Delete(eventID string) error {
+	return r.store.DeleteEvent(eventID)
+}
+
+// Stats counts offloaded and reassembled events since startup
+func (r *Router) Stats() map[string]interface{} {
+	return map[string]interface{}{
+		"threshold":      r.config.Threshold,
+		"max_event_size": r.config.MaxEventSize,
+		"offloaded":      r.offloaded.Load(),
+		"reassembled":    r.reassembled.Load(),
+		"missing":        r.missing.Load(),
+	}
+}
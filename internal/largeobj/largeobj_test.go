@@ -0,0 +1,140 @@
+package largeobj
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/queue"
+	"mercury-relay/test/helpers"
+	"mercury-relay/test/mocks"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func newRouter(t *testing.T) (*Router, string) {
+	t.Helper()
+	dir := t.TempDir()
+	store, err := NewFileStore(dir)
+	helpers.AssertNoError(t, err)
+	return NewRouter(config.LargeObjectConfig{Threshold: 1024, MaxEventSize: 8192}, store), dir
+}
+
+func signed(t *testing.T, kind int, content string, tags nostr.Tags) *models.Event {
+	t.Helper()
+	event := &nostr.Event{Kind: kind, CreatedAt: nostr.Now(), Tags: tags, Content: content}
+	helpers.AssertNoError(t, event.Sign(nostr.GeneratePrivateKey()))
+	return models.FromNostrEvent(event)
+}
+
+func TestSizeLimits(t *testing.T) {
+	router, _ := newRouter(t)
+	small := signed(t, 1, "hello", nostr.Tags{{"t", "nostr"}})
+	helpers.AssertIntEqual(t, 11, Size(small))
+	helpers.AssertFalse(t, router.IsLarge(small))
+	helpers.AssertNoError(t, router.Check(small))
+
+	// Tags count toward the size
+	large := signed(t, 1, "x", nostr.Tags{{"image", "data:image/png;base64," + strings.Repeat("A", 2000)}})
+	helpers.AssertTrue(t, router.IsLarge(large))
+
+	huge := signed(t, 30041, strings.Repeat("x", 9000), nil)
+	err := router.Check(huge)
+	helpers.AssertTrue(t, errors.Is(err, ErrTooLarge))
+	helpers.AssertErrorContains(t, err, "the limit is 8192")
+}
+
+func TestCacheStoresStubs(t *testing.T) {
+	router, dir := newRouter(t)
+	inner := cache.NewMemory(config.CacheConfig{})
+	c := router.Cache(inner)
+	ctx := context.Background()
+
+	small := signed(t, 1, "short note", nil)
+	book := signed(t, 30041, strings.Repeat("Chapter one. ", 200), nostr.Tags{{"d", "chapter-1"}, {"t", "fiction"}})
+	helpers.AssertNoError(t, c.StoreEvent(small))
+	helpers.AssertNoError(t, c.StoreEvent(book))
+
+	// The inner cache holds a stub that still matches tag filters
+	stubs, err := cache.Collect(inner.GetEvents(ctx, nostr.Filter{Tags: nostr.TagMap{"t": {"fiction"}}}))
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 1, len(stubs))
+	helpers.AssertTrue(t, stubs[0].Offloaded)
+	helpers.AssertStringEqual(t, "", stubs[0].Content)
+	_, err = os.Stat(filepath.Join(dir, book.ID[:2], book.ID+".json"))
+	helpers.AssertNoError(t, err)
+
+	// Reads get the full event back, signature intact
+	events, err := cache.Collect(c.GetEvents(ctx, nostr.Filter{Kinds: []int{1, 30041}}))
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 2, len(events))
+	for _, event := range events {
+		helpers.AssertFalse(t, event.Offloaded)
+		ok, err := event.ToNostrEvent().CheckSignature()
+		helpers.AssertNoError(t, err)
+		helpers.AssertTrue(t, ok)
+	}
+	helpers.AssertEqual(t, int64(1), router.Stats()["offloaded"])
+
+	// Deleting the event removes its full copy too
+	helpers.AssertNoError(t, c.DeleteEvent(book.ID))
+	_, err = os.Stat(filepath.Join(dir, book.ID[:2], book.ID+".json"))
+	helpers.AssertTrue(t, os.IsNotExist(err))
+}
+
+func TestMissingObjectsSkipped(t *testing.T) {
+	router, _ := newRouter(t)
+	c := router.Cache(cache.NewMemory(config.CacheConfig{}))
+	book := signed(t, 30023, strings.Repeat("long read ", 200), nostr.Tags{{"d", "essay"}})
+	helpers.AssertNoError(t, cache.StoreEvents(c, []*models.Event{book, signed(t, 1, "short", nil)}))
+	helpers.AssertNoError(t, router.Delete(book.ID))
+
+	events, err := cache.Collect(c.GetEvents(context.Background(), nostr.Filter{}))
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 1, len(events))
+	helpers.AssertEqual(t, int64(1), router.Stats()["missing"])
+
+	_, err = router.Reassemble(context.Background(), &models.Event{ID: book.ID, Offloaded: true})
+	helpers.AssertErrorContains(t, err, "failed to load large event")
+}
+
+// batchQueue is a queue that can defer acknowledgements
+type batchQueue struct {
+	*mocks.MockQueue
+}
+
+func (b batchQueue) ConsumeBatch(max int) ([]queue.Delivery, error) {
+	return nil, nil
+}
+
+func TestQueuePublishesStubs(t *testing.T) {
+	router, _ := newRouter(t)
+	inner := mocks.NewMockQueue()
+	q := router.Queue(inner)
+	_, batching := q.(queue.BatchConsumer)
+	helpers.AssertFalse(t, batching)
+
+	book := signed(t, 30041, strings.Repeat("Chapter two. ", 200), nil)
+	helpers.AssertNoError(t, q.PublishEvent(book))
+	helpers.AssertNoError(t, q.PublishEvent(signed(t, 1, "short", nil)))
+	queued := inner.GetEvents()
+	helpers.AssertIntEqual(t, 2, len(queued))
+	helpers.AssertTrue(t, queued[0].Offloaded)
+	helpers.AssertStringEqual(t, "", queued[0].Content)
+	helpers.AssertFalse(t, queued[1].Offloaded)
+
+	// The relay reassembles consumed stubs before delivering them
+	full, err := router.Reassemble(context.Background(), queued[0])
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, book.Content, full.Content)
+
+	// Batch consumers stay batch consumers
+	_, batching = router.Queue(batchQueue{inner}).(queue.BatchConsumer)
+	helpers.AssertTrue(t, batching)
+}
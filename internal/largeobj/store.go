@@ -0,0 +1,90 @@
+package largeobj
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Store keeps full large events. XFTP storage implements it.
+type Store interface {
+	StoreEvent(event *models.Event) error
+	GetEvent(ctx context.Context, eventID string) (*models.Event, error)
+	DeleteEvent(eventID string) error
+}
+
+// FileStore keeps each event as a JSON file under a directory, sharded by
+// the first two characters of its ID
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore stores events under dir, creating it if needed
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create large object directory: %w", err)
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+func (f *FileStore) path(eventID string) (string, error) {
+	if !nostr.IsValid32ByteHex(eventID) {
+		return "", fmt.Errorf("invalid event ID %q", eventID)
+	}
+	return filepath.Join(f.dir, eventID[:2], eventID+".json"), nil
+}
+
+func (f *FileStore) StoreEvent(event *models.Event) error {
+	path, err := f.path(event.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to encode event: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write event: %w", err)
+	}
+	return nil
+}
+
+func (f *FileStore) GetEvent(ctx context.Context, eventID string) (*models.Event, error) {
+	path, err := f.path(eventID)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read event: %w", err)
+	}
+	var event models.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return nil, fmt.Errorf("failed to parse event: %w", err)
+	}
+	return &event, nil
+}
+
+func (f *FileStore) DeleteEvent(eventID string) error {
+	path, err := f.path(eventID)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete event: %w", err)
+	}
+	return nil
+}
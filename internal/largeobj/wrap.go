@@ -0,0 +1,127 @@
+package largeobj
+
+import (
+	"context"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/queue"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Queue returns q publishing stubs in place of large events. Consumers get
+// the stubs; the relay reassembles them before delivering.
+func (r *Router) Queue(q queue.Queue) queue.Queue {
+	wrapped := &offloadQueue{Queue: q, router: r}
+	if consumer, ok := q.(queue.BatchConsumer); ok {
+		return &offloadBatchQueue{offloadQueue: wrapped, BatchConsumer: consumer}
+	}
+	return wrapped
+}
+
+type offloadQueue struct {
+	queue.Queue
+	router *Router
+}
+
+func (q *offloadQueue) PublishEvent(event *models.Event) error {
+	stub, err := q.router.Offload(event)
+	if err != nil {
+		return err
+	}
+	return q.Queue.PublishEvent(stub)
+}
+
+type offloadBatchQueue struct {
+	*offloadQueue
+	queue.BatchConsumer
+}
+
+// Cache returns c storing stubs in place of large events and reassembling
+// them when they are read
+func (r *Router) Cache(c cache.Cache) cache.Cache {
+	wrapped := &offloadCache{Cache: c, router: r}
+	if retention, ok := c.(cache.Retention); ok {
+		return &retainingCache{offloadCache: wrapped, Retention: retention}
+	}
+	return wrapped
+}
+
+type offloadCache struct {
+	cache.Cache
+	router *Router
+}
+
+func (c *offloadCache) StoreEvent(event *models.Event) error {
+	stub, err := c.router.Offload(event)
+	if err != nil {
+		return err
+	}
+	return c.Cache.StoreEvent(stub)
+}
+
+// StoreEvents offloads the large events of a batch and stores the batch
+func (c *offloadCache) StoreEvents(events []*models.Event) error {
+	stubs := make([]*models.Event, 0, len(events))
+	var firstErr error
+	for _, event := range events {
+		stub, err := c.router.Offload(event)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		stubs = append(stubs, stub)
+	}
+	if err := cache.StoreEvents(c.Cache, stubs); err != nil {
+		return err
+	}
+	return firstErr
+}
+
+func (c *offloadCache) GetEvents(ctx context.Context, filter nostr.Filter) cache.EventIterator {
+	return func(yield func(*models.Event, error) bool) {
+		for event, err := range c.Cache.GetEvents(ctx, filter) {
+			if err == nil && event.Offloaded {
+				if event = c.router.reassembleOrLog(ctx, event); event == nil {
+					continue
+				}
+			}
+			if !yield(event, err) {
+				return
+			}
+		}
+	}
+}
+
+func (c *offloadCache) GetLatestReplaceableEvent(kind int, pubkey, dTag string) (*models.Event, error) {
+	event, err := c.Cache.GetLatestReplaceableEvent(kind, pubkey, dTag)
+	if err != nil || event == nil {
+		return event, err
+	}
+	return c.router.Reassemble(context.Background(), event)
+}
+
+// DeleteEvent also removes the full event when the cached one is a stub
+func (c *offloadCache) DeleteEvent(eventID string) error {
+	var offloaded bool
+	for event, err := range c.Cache.GetEvents(context.Background(), nostr.Filter{IDs: []string{eventID}}) {
+		if err == nil && event.Offloaded {
+			offloaded = true
+		}
+	}
+	if err := c.Cache.DeleteEvent(eventID); err != nil {
+		return err
+	}
+	if offloaded {
+		return c.router.Delete(eventID)
+	}
+	return nil
+}
+
+type retainingCache struct {
+	*offloadCache
+	cache.Retention
+}
@@ -0,0 +1,291 @@
+// Package live tracks NIP-53 live activities hosted through the relay: the
+// kind 30311 events announcing streams, the kind 1311 chat posted to them
+// and the connections watching them. A connection watches an activity while
+// it holds a subscription naming the activity's address in an "#a" filter,
+// which is how clients follow a stream's chat and zaps.
+package live
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+)
+
+// NIP-53 kinds
+const (
+	KindLiveActivity = 30311
+	KindLiveChat     = 1311
+)
+
+// StatusLive is the status tag of an activity that is streaming
+const StatusLive = "live"
+
+// IsLiveKind reports whether kind is live activity traffic, which is fanned
+// out ahead of other events
+func IsLiveKind(kind int) bool {
+	return kind == KindLiveActivity || kind == KindLiveChat
+}
+
+// IsAddress reports whether address names a live activity
+func IsAddress(address string) bool {
+	return strings.HasPrefix(address, strconv.Itoa(KindLiveActivity)+":")
+}
+
+// Activity is the latest version of a live activity with its audience
+type Activity struct {
+	Address             string   `json:"address"`
+	EventID             string   `json:"event_id"`
+	Host                string   `json:"pubkey"`
+	DTag                string   `json:"d"`
+	Title               string   `json:"title,omitempty"`
+	Summary             string   `json:"summary,omitempty"`
+	Image               string   `json:"image,omitempty"`
+	Streaming           string   `json:"streaming,omitempty"`
+	Status              string   `json:"status"`
+	Starts              int64    `json:"starts,omitempty"`
+	Ends                int64    `json:"ends,omitempty"`
+	Participants        []string `json:"participants,omitempty"`
+	CurrentParticipants int      `json:"current_participants,omitempty"`
+	UpdatedAt           int64    `json:"updated_at"`
+	Viewers             int      `json:"viewers"`
+	ChatMessages        int64    `json:"chat_messages"`
+	LastChat            int64    `json:"last_chat,omitempty"`
+}
+
+// Tracker indexes live activities and counts their viewers and chat
+type Tracker struct {
+	config     config.LiveConfig
+	mu         sync.Mutex
+	activities map[string]*Activity
+	watching   map[interface{}]map[string][]string // viewer → subscription → addresses
+	now        func() time.Time
+}
+
+// NewTracker creates an empty tracker
+func NewTracker(cfg config.LiveConfig) *Tracker {
+	return &Tracker{
+		config:     cfg,
+		activities: make(map[string]*Activity),
+		watching:   make(map[interface{}]map[string][]string),
+		now:        time.Now,
+	}
+}
+
+// Record indexes a live activity or counts a chat message, reporting
+// whether event changed the index
+func (t *Tracker) Record(event *models.Event) bool {
+	switch event.Kind {
+	case KindLiveActivity:
+		return t.recordActivity(event)
+	case KindLiveChat:
+		return t.recordChat(event)
+	}
+	return false
+}
+
+func (t *Tracker) recordActivity(event *models.Event) bool {
+	activity := &Activity{Host: event.PubKey, EventID: event.ID, UpdatedAt: int64(event.CreatedAt)}
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "d":
+			activity.DTag = tag[1]
+		case "title":
+			activity.Title = tag[1]
+		case "summary":
+			activity.Summary = tag[1]
+		case "image":
+			activity.Image = tag[1]
+		case "streaming":
+			activity.Streaming = tag[1]
+		case "status":
+			activity.Status = tag[1]
+		case "starts":
+			activity.Starts, _ = strconv.ParseInt(tag[1], 10, 64)
+		case "ends":
+			activity.Ends, _ = strconv.ParseInt(tag[1], 10, 64)
+		case "current_participants":
+			activity.CurrentParticipants, _ = strconv.Atoi(tag[1])
+		case "p":
+			activity.Participants = append(activity.Participants, tag[1])
+		}
+	}
+	activity.Address = strconv.Itoa(KindLiveActivity) + ":" + event.PubKey + ":" + activity.DTag
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	existing := t.activities[activity.Address]
+	if existing != nil {
+		if activity.UpdatedAt <= existing.UpdatedAt {
+			return false
+		}
+		activity.ChatMessages = existing.ChatMessages
+		activity.LastChat = existing.LastChat
+	}
+	t.activities[activity.Address] = activity
+	return true
+}
+
+func (t *Tracker) recordChat(event *models.Event) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	counted := false
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "a" {
+			continue
+		}
+		if activity := t.activities[tag[1]]; activity != nil {
+			activity.ChatMessages++
+			if at := int64(event.CreatedAt); at > activity.LastChat {
+				activity.LastChat = at
+			}
+			counted = true
+		}
+	}
+	return counted
+}
+
+// Watch records that viewer's subscription subID follows addresses,
+// replacing what it followed before. Addresses that are not live
+// activities are ignored.
+func (t *Tracker) Watch(viewer interface{}, subID string, addresses []string) {
+	var watched []string
+	for _, address := range addresses {
+		if IsAddress(address) {
+			watched = append(watched, address)
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if len(watched) == 0 {
+		t.unwatchLocked(viewer, subID)
+		return
+	}
+	if t.watching[viewer] == nil {
+		t.watching[viewer] = make(map[string][]string)
+	}
+	t.watching[viewer][subID] = watched
+}
+
+// Unwatch forgets a closed subscription
+func (t *Tracker) Unwatch(viewer interface{}, subID string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.unwatchLocked(viewer, subID)
+}
+
+func (t *Tracker) unwatchLocked(viewer interface{}, subID string) {
+	delete(t.watching[viewer], subID)
+	if len(t.watching[viewer]) == 0 {
+		delete(t.watching, viewer)
+	}
+}
+
+// Leave forgets a disconnected viewer
+func (t *Tracker) Leave(viewer interface{}) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.watching, viewer)
+}
+
+// viewersLocked counts the distinct viewers of each address
+func (t *Tracker) viewersLocked() map[string]int {
+	counts := make(map[string]int)
+	for _, subs := range t.watching {
+		seen := make(map[string]bool)
+		for _, addresses := range subs {
+			for _, address := range addresses {
+				if !seen[address] {
+					seen[address] = true
+					counts[address]++
+				}
+			}
+		}
+	}
+	return counts
+}
+
+// Viewers counts the connections watching address
+func (t *Tracker) Viewers(address string) int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.viewersLocked()[address]
+}
+
+// isLive reports whether activity is streaming at now: marked live, not
+// past its end and updated within the stale period
+func (t *Tracker) isLive(activity *Activity, now time.Time) bool {
+	if activity.Status != StatusLive {
+		return false
+	}
+	if activity.Ends > 0 && activity.Ends <= now.Unix() {
+		return false
+	}
+	return t.config.StaleAfter <= 0 || now.Sub(time.Unix(activity.UpdatedAt, 0)) < t.config.StaleAfter
+}
+
+// Get returns the activity at address with its current viewers
+func (t *Tracker) Get(address string) (Activity, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	activity, ok := t.activities[address]
+	if !ok {
+		return Activity{}, false
+	}
+	result := *activity
+	result.Viewers = t.viewersLocked()[address]
+	return result, true
+}
+
+// Live lists the activities streaming now, the most watched first.
+// Activities that stopped streaming long ago are dropped from the index.
+func (t *Tracker) Live() []Activity {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	viewers := t.viewersLocked()
+	live := make([]Activity, 0)
+	for address, activity := range t.activities {
+		if t.isLive(activity, now) {
+			result := *activity
+			result.Viewers = viewers[address]
+			live = append(live, result)
+			continue
+		}
+		if t.config.StaleAfter > 0 && now.Sub(time.Unix(activity.UpdatedAt, 0)) > 24*t.config.StaleAfter {
+			delete(t.activities, address)
+		}
+	}
+	sort.Slice(live, func(i, j int) bool {
+		if live[i].Viewers != live[j].Viewers {
+			return live[i].Viewers > live[j].Viewers
+		}
+		return live[i].UpdatedAt > live[j].UpdatedAt
+	})
+	return live
+}
+
+// Stats counts tracked and live activities and their viewers
+func (t *Tracker) Stats() map[string]interface{} {
+	live := t.Live()
+	viewers := 0
+	for _, activity := range live {
+		viewers += activity.Viewers
+	}
+	t.mu.Lock()
+	tracked := len(t.activities)
+	t.mu.Unlock()
+	return map[string]interface{}{
+		"tracked": tracked,
+		"live":    len(live),
+		"viewers": viewers,
+	}
+}
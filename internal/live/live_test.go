@@ -0,0 +1,117 @@
+package live
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+var start = time.Unix(1700000000, 0)
+
+func newTracker() *Tracker {
+	t := NewTracker(config.LiveConfig{StaleAfter: time.Hour})
+	t.now = func() time.Time { return start }
+	return t
+}
+
+func activity(id, pubkey, dTag, status string, at time.Time, extra ...nostr.Tag) *models.Event {
+	tags := nostr.Tags{{"d", dTag}, {"title", "Stream " + dTag}, {"status", status}, {"streaming", "https://video.example.com/" + dTag + ".m3u8"}}
+	return &models.Event{ID: id, PubKey: pubkey, Kind: KindLiveActivity, CreatedAt: nostr.Timestamp(at.Unix()), Tags: append(tags, extra...)}
+}
+
+func chat(id string, at time.Time, addresses ...string) *models.Event {
+	event := &models.Event{ID: id, Kind: KindLiveChat, CreatedAt: nostr.Timestamp(at.Unix()), Content: "hi"}
+	for _, address := range addresses {
+		event.Tags = append(event.Tags, nostr.Tag{"a", address})
+	}
+	return event
+}
+
+func TestRecordActivities(t *testing.T) {
+	tracker := newTracker()
+	address := "30311:host:show"
+	helpers.AssertTrue(t, tracker.Record(activity("e1", "host", "show", "planned", start.Add(-time.Minute))))
+	helpers.AssertIntEqual(t, 0, len(tracker.Live()))
+
+	// A newer version going live replaces it; an older one doesn't
+	helpers.AssertTrue(t, tracker.Record(activity("e2", "host", "show", "live", start, nostr.Tag{"p", "guest"},
+		nostr.Tag{"current_participants", "12"}, nostr.Tag{"starts", strconv.FormatInt(start.Unix(), 10)})))
+	helpers.AssertFalse(t, tracker.Record(activity("e0", "host", "show", "ended", start.Add(-time.Hour))))
+	live := tracker.Live()
+	helpers.AssertIntEqual(t, 1, len(live))
+	helpers.AssertStringEqual(t, address, live[0].Address)
+	helpers.AssertStringEqual(t, "e2", live[0].EventID)
+	helpers.AssertStringEqual(t, "Stream show", live[0].Title)
+	helpers.AssertIntEqual(t, 12, live[0].CurrentParticipants)
+	helpers.AssertEqual(t, "[guest]", fmt.Sprint(live[0].Participants))
+
+	// Chat is counted for known activities only
+	helpers.AssertTrue(t, tracker.Record(chat("c1", start.Add(time.Second), address)))
+	helpers.AssertTrue(t, tracker.Record(chat("c2", start, address, "30311:other:show")))
+	helpers.AssertFalse(t, tracker.Record(chat("c3", start, "30311:other:show")))
+	helpers.AssertFalse(t, tracker.Record(&models.Event{ID: "n1", Kind: 1}))
+	got, ok := tracker.Get(address)
+	helpers.AssertTrue(t, ok)
+	helpers.AssertInt64Equal(t, 2, got.ChatMessages)
+	helpers.AssertInt64Equal(t, start.Unix()+1, got.LastChat)
+
+	// Updates keep the chat count
+	tracker.Record(activity("e3", "host", "show", "live", start.Add(time.Second)))
+	got, _ = tracker.Get(address)
+	helpers.AssertInt64Equal(t, 2, got.ChatMessages)
+}
+
+func TestEndedAndStale(t *testing.T) {
+	tracker := newTracker()
+	tracker.Record(activity("e1", "a", "over", "live", start, nostr.Tag{"ends", strconv.FormatInt(start.Unix()-1, 10)}))
+	tracker.Record(activity("e2", "b", "quiet", "live", start.Add(-2*time.Hour)))
+	tracker.Record(activity("e3", "c", "done", "ended", start))
+	tracker.Record(activity("e4", "d", "old", "ended", start.Add(-48*time.Hour)))
+	helpers.AssertIntEqual(t, 0, len(tracker.Live()))
+
+	// Long-finished activities leave the index
+	_, ok := tracker.Get("30311:c:done")
+	helpers.AssertTrue(t, ok)
+	_, ok = tracker.Get("30311:d:old")
+	helpers.AssertFalse(t, ok)
+}
+
+func TestPresence(t *testing.T) {
+	tracker := newTracker()
+	show, talk := "30311:host:show", "30311:host:talk"
+	tracker.Record(activity("e1", "host", "show", "live", start))
+	tracker.Record(activity("e2", "host", "talk", "live", start.Add(-time.Minute)))
+
+	type conn struct{ id int }
+	alice, bob := &conn{1}, &conn{2}
+	tracker.Watch(alice, "chat", []string{show})
+	tracker.Watch(alice, "zaps", []string{show, "30023:host:article"})
+	tracker.Watch(bob, "chat", []string{show, talk})
+	helpers.AssertIntEqual(t, 2, tracker.Viewers(show))
+	helpers.AssertIntEqual(t, 1, tracker.Viewers(talk))
+
+	// The most watched activity comes first
+	live := tracker.Live()
+	helpers.AssertStringEqual(t, show, live[0].Address)
+	helpers.AssertIntEqual(t, 2, live[0].Viewers)
+
+	// Viewers count until their last subscription closes
+	tracker.Unwatch(alice, "chat")
+	helpers.AssertIntEqual(t, 2, tracker.Viewers(show))
+	tracker.Watch(alice, "zaps", []string{talk})
+	helpers.AssertIntEqual(t, 1, tracker.Viewers(show))
+	helpers.AssertIntEqual(t, 2, tracker.Viewers(talk))
+
+	tracker.Leave(bob)
+	tracker.Watch(alice, "zaps", nil)
+	helpers.AssertIntEqual(t, 0, tracker.Viewers(talk))
+	helpers.AssertIntEqual(t, 0, len(tracker.watching))
+	helpers.AssertEqual(t, 2, tracker.Stats()["live"])
+}
@@ -0,0 +1,148 @@
+// Package logging sets up the structured logger from LoggingConfig and
+// carries per-connection and per-request loggers through contexts. Calls
+// to the standard log package keep working: their lines go through the
+// same handler, at a level guessed from how the message starts.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mercury-relay/internal/config"
+)
+
+// Log formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Attribute keys shared across modules, so aggregated logs can be joined
+const (
+	KeyConnID    = "conn_id"
+	KeyRequestID = "request_id"
+	KeyTraceID   = "trace_id"
+	KeyEventID   = "event_id"
+	KeyRemote    = "remote"
+	KeyRelay     = "relay"
+)
+
+// ParseLevel maps debug, info, warn and error to slog levels
+func ParseLevel(level string) (slog.Level, error) {
+	switch strings.ToLower(level) {
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "debug":
+		return slog.LevelDebug, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return 0, fmt.Errorf("unknown log level %q", level)
+}
+
+// New builds a logger writing to w in the configured level and format
+func New(cfg config.LoggingConfig, w io.Writer) (*slog.Logger, error) {
+	level, err := ParseLevel(cfg.Level)
+	if err != nil {
+		return nil, err
+	}
+	options := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(cfg.Format) {
+	case "", FormatText:
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+}
+
+// Setup makes the configured logger the default for slog and the standard
+// log package. Logs go to cfg.File when set, appended, and to stderr
+// otherwise. The returned closer closes the file.
+func Setup(cfg config.LoggingConfig) (io.Closer, error) {
+	var w io.Writer = os.Stderr
+	var closer io.Closer = io.NopCloser(os.Stderr)
+	if cfg.File != "" {
+		if err := os.MkdirAll(filepath.Dir(cfg.File), 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create log directory: %w", err)
+		}
+		file, err := os.OpenFile(cfg.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open log file: %w", err)
+		}
+		w, closer = file, file
+	}
+
+	logger, err := New(cfg, w)
+	if err != nil {
+		closer.Close()
+		return nil, err
+	}
+	slog.SetDefault(logger)
+	// After SetDefault, so standard log lines get a level of their own
+	log.SetFlags(0)
+	log.SetOutput(&legacyWriter{logger: logger})
+	return closer, nil
+}
+
+// legacyWriter logs lines from the standard log package, taking the level
+// from the first word: errors and failures are errors, warnings warnings
+// and the rest info
+type legacyWriter struct {
+	logger *slog.Logger
+}
+
+func (w *legacyWriter) Write(p []byte) (int, error) {
+	message := strings.TrimRight(string(p), "\n")
+	w.logger.Log(context.Background(), legacyLevel(message), message)
+	return len(p), nil
+}
+
+func legacyLevel(message string) slog.Level {
+	first, _, _ := strings.Cut(strings.ToLower(message), " ")
+	first = strings.TrimRight(first, ":")
+	switch first {
+	case "error", "failed", "fatal", "panic":
+		return slog.LevelError
+	case "warning", "warn":
+		return slog.LevelWarn
+	}
+	if strings.HasPrefix(first, "error") {
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+type contextKey struct{}
+
+// WithLogger returns a context carrying logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, contextKey{}, logger)
+}
+
+// FromContext returns the logger carried by ctx, or the default one
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(contextKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+	return slog.Default()
+}
+
+// NewID returns a short random ID for a connection or job
+func NewID() string {
+	b := make([]byte, 6)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,67 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/test/helpers"
+)
+
+func TestParseLevel(t *testing.T) {
+	for level, want := range map[string]slog.Level{
+		"":      slog.LevelInfo,
+		"debug": slog.LevelDebug,
+		"INFO":  slog.LevelInfo,
+		"warn":  slog.LevelWarn,
+		"error": slog.LevelError,
+	} {
+		got, err := ParseLevel(level)
+		helpers.AssertNoError(t, err)
+		helpers.AssertTrue(t, got == want)
+	}
+	_, err := ParseLevel("verbose")
+	helpers.AssertTrue(t, err != nil)
+}
+
+func TestNewJSON(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := New(config.LoggingConfig{Level: "info", Format: FormatJSON}, &buf)
+	helpers.AssertNoError(t, err)
+
+	logger.Debug("hidden")
+	logger.With(KeyConnID, "abc").Info("opened", KeyTraceID, "t1")
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	helpers.AssertIntEqual(t, 1, len(lines))
+
+	var record map[string]any
+	helpers.AssertNoError(t, json.Unmarshal([]byte(lines[0]), &record))
+	helpers.AssertStringEqual(t, "opened", record["msg"].(string))
+	helpers.AssertStringEqual(t, "INFO", record["level"].(string))
+	helpers.AssertStringEqual(t, "abc", record[KeyConnID].(string))
+	helpers.AssertStringEqual(t, "t1", record[KeyTraceID].(string))
+
+	_, err = New(config.LoggingConfig{Format: "xml"}, &buf)
+	helpers.AssertTrue(t, err != nil)
+}
+
+func TestLegacyLevel(t *testing.T) {
+	helpers.AssertTrue(t, legacyLevel("Error storing event: boom") == slog.LevelError)
+	helpers.AssertTrue(t, legacyLevel("Failed to connect") == slog.LevelError)
+	helpers.AssertTrue(t, legacyLevel("Warning: disk almost full") == slog.LevelWarn)
+	helpers.AssertTrue(t, legacyLevel("Starting REST API server on port 8082") == slog.LevelInfo)
+}
+
+func TestFromContext(t *testing.T) {
+	helpers.AssertTrue(t, FromContext(context.Background()) == slog.Default())
+
+	logger := slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil))
+	helpers.AssertTrue(t, FromContext(WithLogger(context.Background(), logger)) == logger)
+
+	helpers.AssertIntEqual(t, 12, len(NewID()))
+	helpers.AssertTrue(t, NewID() != NewID())
+}
@@ -0,0 +1,98 @@
+// Package maintenance pauses ingest while reads keep working, e.g. during
+// storage migrations.
+package maintenance
+
+import (
+	"sync"
+	"time"
+)
+
+// Prefix starts every rejection sent while writes are paused, so clients
+// can tell maintenance apart from other OK/NOTICE failures
+const Prefix = "maintenance:"
+
+// State is whether writes are paused, why and since when
+type State struct {
+	Enabled bool      `json:"enabled"`
+	Reason  string    `json:"reason,omitempty"`
+	Since   time.Time `json:"since,omitempty"`
+}
+
+// Mode is the relay-wide maintenance switch
+type Mode struct {
+	state     State
+	listeners []func(State)
+	mu        sync.RWMutex
+}
+
+// New returns a Mode with writes accepted
+func New() *Mode {
+	return &Mode{}
+}
+
+// Enable pauses writes. Calling it again only updates the reason.
+func (m *Mode) Enable(reason string) {
+	m.set(func(s *State) {
+		if !s.Enabled {
+			s.Since = time.Now()
+		}
+		s.Enabled = true
+		s.Reason = reason
+	})
+}
+
+// Disable accepts writes again
+func (m *Mode) Disable() {
+	m.set(func(s *State) {
+		*s = State{}
+	})
+}
+
+func (m *Mode) set(update func(*State)) {
+	m.mu.Lock()
+	before := m.state
+	update(&m.state)
+	state := m.state
+	listeners := append([]func(State){}, m.listeners...)
+	m.mu.Unlock()
+
+	if state == before {
+		return
+	}
+	for _, listener := range listeners {
+		listener(state)
+	}
+}
+
+// Active reports whether writes are paused
+func (m *Mode) Active() bool {
+	if m == nil {
+		return false
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state.Enabled
+}
+
+// State returns the current state
+func (m *Mode) State() State {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.state
+}
+
+// OnChange calls listener after every change of state
+func (m *Mode) OnChange(listener func(State)) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.listeners = append(m.listeners, listener)
+}
+
+// Message is the machine-readable rejection for writes in state s, e.g.
+// "maintenance: storage migration"
+func (s State) Message() string {
+	if s.Reason == "" {
+		return Prefix + " writes are paused"
+	}
+	return Prefix + " " + s.Reason
+}
@@ -0,0 +1,39 @@
+package maintenance
+
+import (
+	"strings"
+	"testing"
+
+	"mercury-relay/test/helpers"
+)
+
+func TestMode(t *testing.T) {
+	var nilMode *Mode
+	helpers.AssertFalse(t, nilMode.Active())
+
+	m := New()
+	var changes []State
+	m.OnChange(func(s State) { changes = append(changes, s) })
+
+	helpers.AssertFalse(t, m.Active())
+
+	m.Enable("storage migration")
+	helpers.AssertTrue(t, m.Active())
+	since := m.State().Since
+	helpers.AssertFalse(t, since.IsZero())
+	helpers.AssertStringEqual(t, "maintenance: storage migration", m.State().Message())
+
+	// Updating the reason keeps the start time
+	m.Enable("")
+	helpers.AssertTrue(t, m.State().Since.Equal(since))
+	helpers.AssertTrue(t, strings.HasPrefix(m.State().Message(), Prefix))
+
+	// Disabling twice only notifies once
+	m.Disable()
+	m.Disable()
+	helpers.AssertFalse(t, m.Active())
+
+	helpers.AssertIntEqual(t, 3, len(changes))
+	helpers.AssertTrue(t, changes[0].Enabled)
+	helpers.AssertFalse(t, changes[2].Enabled)
+}
@@ -0,0 +1,449 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/normalize"
+	"mercury-relay/internal/storage"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+const (
+	// KindRelayList is the NIP-65 relay list used to find where an author
+	// publishes
+	KindRelayList = 10002
+
+	// maxPages bounds how far back one relay is paged in a single sync
+	maxPages = 1000
+
+	// maxMissing bounds the missing event IDs listed in a report
+	maxMissing = 100
+
+	// reportBatch is how many event IDs are looked up per cache query
+	reportBatch = 100
+)
+
+// Relay sources in completeness reports
+const (
+	SourceConfigured = "configured" // mirror relays and upstream relays
+	SourceRelayList  = "relay_list" // a write relay from the author's NIP-65 list
+)
+
+// Fetcher queries a relay for stored events
+type Fetcher interface {
+	Fetch(ctx context.Context, url string, filter nostr.Filter) ([]*nostr.Event, error)
+}
+
+// RelayReport is what one relay holds for a mirrored author
+type RelayReport struct {
+	URL      string    `json:"url"`
+	Source   string    `json:"source"`
+	Events   int       `json:"events"`
+	LastSync time.Time `json:"last_sync,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// Report shows whether every event found for a mirrored author is stored
+type Report struct {
+	Pubkey   string        `json:"pubkey"`
+	Seen     int           `json:"seen"`   // distinct events found on the relays
+	Stored   int           `json:"stored"` // of those, events the relay holds
+	Missing  []string      `json:"missing,omitempty"`
+	Complete bool          `json:"complete"`
+	LastSync time.Time     `json:"last_sync,omitempty"`
+	Relays   []RelayReport `json:"relays"`
+}
+
+// authorState tracks what the syncs found for one author
+type authorState struct {
+	seen     map[string]bool
+	relays   map[string]*RelayReport
+	lastSync time.Time
+}
+
+// Mirror keeps a verbatim, permanent copy of everything selected authors
+// publish. Their events are marked Mirrored at ingest, and a periodic sync
+// pages through every relay they publish to and stores what is missing.
+type Mirror struct {
+	config     config.MirrorConfig
+	authors    []string
+	mirrored   map[string]bool
+	bootstrap  []string
+	cache      cache.Cache
+	storage    storage.Storage
+	fetcher    Fetcher
+	normalizer *normalize.Normalizer
+
+	state map[string]*authorState
+	mu    sync.RWMutex
+}
+
+// NewMirror creates a mirror of the configured authors. upstreams are the
+// upstream relay URLs, searched along with the configured relays; storage
+// may be nil.
+func NewMirror(cfg config.MirrorConfig, upstreams []string, c cache.Cache, s storage.Storage) (*Mirror, error) {
+	m := &Mirror{
+		config:   cfg,
+		mirrored: make(map[string]bool),
+		cache:    c,
+		storage:  s,
+		fetcher:  &relayFetcher{timeout: cfg.FetchTimeout},
+		state:    make(map[string]*authorState),
+	}
+
+	for _, author := range cfg.Authors {
+		pubkey, err := ParsePubkey(author)
+		if err != nil {
+			return nil, err
+		}
+		if !m.mirrored[pubkey] {
+			m.mirrored[pubkey] = true
+			m.authors = append(m.authors, pubkey)
+		}
+	}
+
+	seen := make(map[string]bool)
+	for _, url := range append(append([]string{}, cfg.Relays...), upstreams...) {
+		url = nostr.NormalizeURL(url)
+		if url != "" && !seen[url] {
+			seen[url] = true
+			m.bootstrap = append(m.bootstrap, url)
+		}
+	}
+
+	return m, nil
+}
+
+// SetFetcher replaces how relays are queried
+func (m *Mirror) SetFetcher(fetcher Fetcher) {
+	m.fetcher = fetcher
+}
+
+// SetNormalizer canonicalizes tag values of fetched events before they are
+// cached
+func (m *Mirror) SetNormalizer(normalizer *normalize.Normalizer) {
+	m.normalizer = normalizer
+}
+
+// Authors returns the mirrored pubkeys
+func (m *Mirror) Authors() []string {
+	return append([]string{}, m.authors...)
+}
+
+// IsMirrored reports whether pubkey is a mirrored author
+func (m *Mirror) IsMirrored(pubkey string) bool {
+	return m.mirrored[pubkey]
+}
+
+// Mark flags an event of a mirrored author so it is kept for good and never
+// quarantined, and reports whether it did
+func (m *Mirror) Mark(event *models.Event) bool {
+	if !m.mirrored[event.PubKey] {
+		return false
+	}
+	event.Mirrored = true
+	event.IsQuarantined = false
+	event.QuarantineReason = ""
+	return true
+}
+
+// Run syncs every mirrored author now and then every SyncInterval until ctx
+// is done
+func (m *Mirror) Run(ctx context.Context) {
+	if !m.config.Enabled || len(m.authors) == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(m.config.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		for _, author := range m.authors {
+			if err := m.Sync(ctx, author); err != nil {
+				log.Printf("Mirror sync of %s failed: %v", author, err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sync fetches everything author has published on the configured relays,
+// then on the write relays of their relay list, and stores what the relay
+// doesn't hold yet
+func (m *Mirror) Sync(ctx context.Context, author string) error {
+	if !m.mirrored[author] {
+		return fmt.Errorf("%s is not a mirrored author", author)
+	}
+
+	visited := make(map[string]bool)
+	stored := 0
+	for _, url := range m.bootstrap {
+		visited[url] = true
+		stored += m.syncRelay(ctx, author, url, SourceConfigured)
+	}
+
+	// The relay list itself was fetched above if any configured relay has it
+	if !m.config.SkipRelayLists {
+		for _, url := range m.writeRelays(ctx, author) {
+			if !visited[url] {
+				visited[url] = true
+				stored += m.syncRelay(ctx, author, url, SourceRelayList)
+			}
+		}
+	}
+
+	m.mu.Lock()
+	m.author(author).lastSync = time.Now()
+	m.mu.Unlock()
+
+	if stored > 0 {
+		log.Printf("Mirror sync of %s stored %d new events from %d relays", author, stored, len(visited))
+	}
+	return ctx.Err()
+}
+
+// syncRelay pages back through author's events on one relay and returns how
+// many new events were stored
+func (m *Mirror) syncRelay(ctx context.Context, author, url, source string) int {
+	found := make(map[string]bool)
+	stored := 0
+	var fetchErr error
+
+	filter := nostr.Filter{Authors: []string{author}, Limit: m.config.PageSize}
+	for page := 0; page < maxPages && ctx.Err() == nil; page++ {
+		events, err := m.fetcher.Fetch(ctx, url, filter)
+		if err != nil {
+			fetchErr = err
+			break
+		}
+
+		fresh := 0
+		oldest := nostr.Timestamp(0)
+		for _, event := range events {
+			if event.PubKey != author || found[event.ID] {
+				continue
+			}
+			if !event.CheckID() {
+				continue
+			}
+			if ok, err := event.CheckSignature(); err != nil || !ok {
+				continue
+			}
+			found[event.ID] = true
+			fresh++
+			if oldest == 0 || event.CreatedAt < oldest {
+				oldest = event.CreatedAt
+			}
+			if m.store(ctx, event, url) {
+				stored++
+			}
+		}
+
+		// Page back from the oldest event seen until a page brings nothing
+		// new. Relays may cap the page below PageSize, so a short page isn't
+		// the end. The boundary second is requested again so events sharing
+		// it aren't skipped.
+		if fresh == 0 {
+			break
+		}
+		until := oldest
+		filter.Until = &until
+	}
+
+	m.mu.Lock()
+	state := m.author(author)
+	for id := range found {
+		state.seen[id] = true
+	}
+	report := state.relays[url]
+	if report == nil {
+		report = &RelayReport{URL: url, Source: source}
+		state.relays[url] = report
+	}
+	report.Error = ""
+	if fetchErr != nil {
+		report.Error = fetchErr.Error()
+	}
+	if fetchErr == nil || len(found) > 0 {
+		report.Events = len(found)
+		report.LastSync = time.Now()
+	}
+	m.mu.Unlock()
+
+	return stored
+}
+
+// store saves a fetched event verbatim unless the relay already holds it as
+// a mirrored event, and reports whether it was new
+func (m *Mirror) store(ctx context.Context, ne *nostr.Event, url string) bool {
+	existing, err := cache.Collect(m.cache.GetEvents(ctx, nostr.Filter{IDs: []string{ne.ID}}))
+	if err == nil && len(existing) > 0 && existing[0].Mirrored {
+		return false
+	}
+
+	event := models.FromNostrEvent(ne)
+	event.Mirrored = true
+	event.QualityScore = event.CalculateQualityScore()
+	event.AddProvenance(models.ProvenanceMirror, url, "")
+	if m.normalizer != nil {
+		m.normalizer.Apply(event)
+	}
+
+	if err := m.cache.StoreEvent(event); err != nil {
+		log.Printf("Mirror failed to cache event %s: %v", event.ID, err)
+		return false
+	}
+	if m.storage != nil {
+		if err := m.storage.StoreEvent(event); err != nil {
+			log.Printf("Mirror failed to store event %s: %v", event.ID, err)
+		}
+	}
+	return true
+}
+
+// writeRelays returns the relays author publishes to according to their
+// cached NIP-65 relay list: entries marked "write" or unmarked
+func (m *Mirror) writeRelays(ctx context.Context, author string) []string {
+	events, err := cache.Collect(m.cache.GetEvents(ctx, nostr.Filter{Authors: []string{author}, Kinds: []int{KindRelayList}}))
+	if err != nil || len(events) == 0 {
+		return nil
+	}
+
+	latest := events[0]
+	for _, event := range events[1:] {
+		if event.CreatedAt > latest.CreatedAt {
+			latest = event
+		}
+	}
+
+	var relays []string
+	for _, tag := range latest.Tags {
+		if len(tag) < 2 || tag[0] != "r" {
+			continue
+		}
+		if len(tag) >= 3 && tag[2] == "read" {
+			continue
+		}
+		if url := nostr.NormalizeURL(tag[1]); url != "" {
+			relays = append(relays, url)
+		}
+	}
+	return relays
+}
+
+// Report checks every event found for author against the cache
+func (m *Mirror) Report(ctx context.Context, author string) (*Report, error) {
+	if !m.mirrored[author] {
+		return nil, fmt.Errorf("%s is not a mirrored author", author)
+	}
+
+	m.mu.RLock()
+	state := m.state[author]
+	report := &Report{Pubkey: author, Relays: []RelayReport{}}
+	var ids []string
+	if state != nil {
+		report.LastSync = state.lastSync
+		for id := range state.seen {
+			ids = append(ids, id)
+		}
+		for _, relay := range state.relays {
+			report.Relays = append(report.Relays, *relay)
+		}
+	}
+	m.mu.RUnlock()
+
+	sort.Strings(ids)
+	sort.Slice(report.Relays, func(i, j int) bool {
+		return report.Relays[i].URL < report.Relays[j].URL
+	})
+
+	report.Seen = len(ids)
+	for start := 0; start < len(ids); start += reportBatch {
+		batch := ids[start:min(start+reportBatch, len(ids))]
+		events, err := cache.Collect(m.cache.GetEvents(ctx, nostr.Filter{IDs: batch}))
+		if err != nil {
+			return nil, fmt.Errorf("failed to check stored events: %w", err)
+		}
+		have := make(map[string]bool, len(events))
+		for _, event := range events {
+			have[event.ID] = true
+		}
+		for _, id := range batch {
+			if have[id] {
+				report.Stored++
+			} else if len(report.Missing) < maxMissing {
+				report.Missing = append(report.Missing, id)
+			}
+		}
+	}
+	report.Complete = !report.LastSync.IsZero() && report.Stored == report.Seen
+
+	return report, nil
+}
+
+// author returns the sync state of author. Callers must hold mu.
+func (m *Mirror) author(author string) *authorState {
+	state, ok := m.state[author]
+	if !ok {
+		state = &authorState{
+			seen:   make(map[string]bool),
+			relays: make(map[string]*RelayReport),
+		}
+		m.state[author] = state
+	}
+	return state
+}
+
+// ParsePubkey accepts an npub or a hex pubkey
+func ParsePubkey(author string) (string, error) {
+	if nostr.IsValidPublicKey(author) {
+		return author, nil
+	}
+	prefix, data, err := nip19.Decode(author)
+	if err != nil || prefix != "npub" {
+		return "", fmt.Errorf("invalid mirror author %q: expected an npub or hex pubkey", author)
+	}
+	return data.(string), nil
+}
+
+// relayFetcher queries relays over a fresh WebSocket connection each time
+type relayFetcher struct {
+	timeout time.Duration
+}
+
+// NewRelayFetcher queries relays over WebSocket, giving up on each after
+// timeout
+func NewRelayFetcher(timeout time.Duration) Fetcher {
+	return &relayFetcher{timeout: timeout}
+}
+
+func (f *relayFetcher) Fetch(ctx context.Context, url string, filter nostr.Filter) ([]*nostr.Event, error) {
+	if f.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.timeout)
+		defer cancel()
+	}
+
+	relay, err := nostr.RelayConnect(ctx, url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer relay.Close()
+
+	return relay.QuerySync(ctx, filter)
+}
@@ -0,0 +1,191 @@
+package mirror
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// fakeFetcher serves fixed events per relay, newest first, at most limit
+// per query
+type fakeFetcher struct {
+	relays  map[string][]*nostr.Event
+	limit   int
+	queried []string
+}
+
+func (f *fakeFetcher) Fetch(ctx context.Context, url string, filter nostr.Filter) ([]*nostr.Event, error) {
+	f.queried = append(f.queried, url)
+	events, ok := f.relays[url]
+	if !ok {
+		return nil, fmt.Errorf("connection refused")
+	}
+
+	sorted := append([]*nostr.Event{}, events...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].CreatedAt > sorted[j].CreatedAt })
+
+	var page []*nostr.Event
+	for _, event := range sorted {
+		if filter.Until != nil && event.CreatedAt > *filter.Until {
+			continue
+		}
+		if len(filter.Authors) > 0 && event.PubKey != filter.Authors[0] {
+			continue
+		}
+		page = append(page, event)
+		if len(page) == f.limit {
+			break
+		}
+	}
+	return page, nil
+}
+
+type author struct {
+	sk string
+	pk string
+}
+
+func newAuthor() author {
+	sk := nostr.GeneratePrivateKey()
+	pk, _ := nostr.GetPublicKey(sk)
+	return author{sk: sk, pk: pk}
+}
+
+func (a author) sign(kind int, createdAt int64, content string, tags nostr.Tags) *nostr.Event {
+	event := &nostr.Event{
+		PubKey:    a.pk,
+		CreatedAt: nostr.Timestamp(createdAt),
+		Kind:      kind,
+		Tags:      tags,
+		Content:   content,
+	}
+	event.Sign(a.sk)
+	return event
+}
+
+func newTestMirror(t *testing.T, authors []string, relays []string, fetcher *fakeFetcher) (*Mirror, cache.Cache) {
+	t.Helper()
+	c := cache.NewMemory(config.CacheConfig{})
+	t.Cleanup(func() { c.Close() })
+
+	m, err := NewMirror(config.MirrorConfig{
+		Enabled:  true,
+		Authors:  authors,
+		Relays:   relays,
+		PageSize: 500,
+	}, nil, c, nil)
+	helpers.AssertNoError(t, err)
+	m.SetFetcher(fetcher)
+	return m, c
+}
+
+func TestMirrorSync(t *testing.T) {
+	alice := newAuthor()
+	bob := newAuthor()
+
+	var notes []*nostr.Event
+	for i := 0; i < 7; i++ {
+		// Two events share each second so paging has to revisit the boundary
+		notes = append(notes, alice.sign(1, int64(1700000000+i/2), fmt.Sprintf("Note %d", i), nostr.Tags{}))
+	}
+	relayList := alice.sign(KindRelayList, 1700000100, "", nostr.Tags{
+		{"r", "wss://write.example.com"},
+		{"r", "wss://read.example.com", "read"},
+		{"r", "wss://both.example.com", "write"},
+	})
+	forged := alice.sign(1, 1700000050, "Forged", nostr.Tags{})
+	forged.Content = "Tampered"
+	other := bob.sign(1, 1700000060, "Not mirrored", nostr.Tags{})
+	extra := alice.sign(1, 1700000070, "Only on her write relay", nostr.Tags{})
+
+	fetcher := &fakeFetcher{
+		limit: 3, // below PageSize, like a relay capping results
+		relays: map[string][]*nostr.Event{
+			"wss://seed.example.com":  append(append([]*nostr.Event{}, notes...), relayList, forged, other),
+			"wss://write.example.com": {extra, notes[0]},
+			"wss://read.example.com":  {alice.sign(1, 1700000080, "Read relay", nostr.Tags{})},
+		},
+	}
+
+	npub, _ := nip19.EncodePublicKey(alice.pk)
+	m, c := newTestMirror(t, []string{npub}, []string{"wss://seed.example.com/"}, fetcher)
+	helpers.AssertTrue(t, m.IsMirrored(alice.pk))
+	helpers.AssertFalse(t, m.IsMirrored(bob.pk))
+
+	helpers.AssertNoError(t, m.Sync(context.Background(), alice.pk))
+
+	events, err := cache.Collect(c.GetEvents(context.Background(), nostr.Filter{Authors: []string{alice.pk}}))
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, len(notes)+2, len(events))
+	for _, event := range events {
+		helpers.AssertTrue(t, event.Mirrored)
+		helpers.AssertTrue(t, event.ID != forged.ID)
+		helpers.AssertStringEqual(t, models.ProvenanceMirror, event.Provenance[0].Source)
+	}
+
+	for _, url := range fetcher.queried {
+		helpers.AssertTrue(t, url != "wss://read.example.com")
+	}
+
+	report, err := m.Report(context.Background(), alice.pk)
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, len(notes)+2, report.Seen)
+	helpers.AssertIntEqual(t, report.Seen, report.Stored)
+	helpers.AssertTrue(t, report.Complete)
+
+	sources := make(map[string]RelayReport)
+	for _, relay := range report.Relays {
+		sources[relay.URL] = relay
+	}
+	helpers.AssertStringEqual(t, SourceConfigured, sources["wss://seed.example.com"].Source)
+	helpers.AssertStringEqual(t, SourceRelayList, sources["wss://write.example.com"].Source)
+	helpers.AssertIntEqual(t, 2, sources["wss://write.example.com"].Events)
+	helpers.AssertTrue(t, sources["wss://both.example.com"].Error != "")
+
+	// Losing an event shows up in the next report
+	helpers.AssertNoError(t, c.DeleteEvent(extra.ID))
+	report, err = m.Report(context.Background(), alice.pk)
+	helpers.AssertNoError(t, err)
+	helpers.AssertFalse(t, report.Complete)
+	helpers.AssertIntEqual(t, 1, len(report.Missing))
+	helpers.AssertStringEqual(t, extra.ID, report.Missing[0])
+
+	// ...and is restored by the next sync
+	helpers.AssertNoError(t, m.Sync(context.Background(), alice.pk))
+	report, _ = m.Report(context.Background(), alice.pk)
+	helpers.AssertTrue(t, report.Complete)
+
+	helpers.AssertError(t, m.Sync(context.Background(), bob.pk))
+	_, err = m.Report(context.Background(), bob.pk)
+	helpers.AssertError(t, err)
+}
+
+func TestMirrorMark(t *testing.T) {
+	alice := newAuthor()
+	m, _ := newTestMirror(t, []string{alice.pk}, nil, &fakeFetcher{})
+
+	event := models.FromNostrEvent(alice.sign(1, 1700000000, "Hello", nostr.Tags{}))
+	event.IsQuarantined = true
+	event.QuarantineReason = "Low quality score"
+	helpers.AssertTrue(t, m.Mark(event))
+	helpers.AssertTrue(t, event.Mirrored)
+	helpers.AssertFalse(t, event.IsQuarantined)
+
+	other := models.FromNostrEvent(newAuthor().sign(1, 1700000000, "Hello", nostr.Tags{}))
+	helpers.AssertFalse(t, m.Mark(other))
+	helpers.AssertFalse(t, other.Mirrored)
+}
+
+func TestNewMirrorInvalidAuthor(t *testing.T) {
+	_, err := NewMirror(config.MirrorConfig{Authors: []string{"nsec1notapubkey"}}, nil, cache.NewMemory(config.CacheConfig{}), nil)
+	helpers.AssertError(t, err)
+}
@@ -2,9 +2,12 @@ package models
 
 import (
 	"fmt"
+	"slices"
+	"strconv"
 	"time"
 
 	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
 )
 
 // Event represents a Nostr event with additional metadata
@@ -20,6 +23,162 @@ type Event struct {
 	IsQuarantined    bool            `json:"is_quarantined" db:"is_quarantined"`
 	QuarantineReason string          `json:"quarantine_reason" db:"quarantine_reason"`
 	CreatedAtDB      time.Time       `json:"created_at_db" db:"created_at_db"`
+	// Language is the ISO 639-1 code detected at ingest, backing language
+	// filters; Topics are set by upstream classification for analytics
+	Language string   `json:"language,omitempty" db:"language"`
+	Topics   []string `json:"topics,omitempty" db:"topics"`
+	// NormalizedTags holds canonical tag values used for indexing when they
+	// differ from the signed tags, which are kept as published
+	NormalizedTags nostr.Tags `json:"normalized_tags,omitempty" db:"normalized_tags"`
+	// Provenance records how the event reached the relay, first sighting first
+	Provenance []Provenance `json:"provenance,omitempty" db:"provenance"`
+	// Mirrored events belong to an author the relay mirrors: they are kept
+	// without expiry and never quarantined
+	Mirrored bool `json:"mirrored,omitempty" db:"mirrored"`
+	// TrustLabel says how the relay knows the author of an upstream event,
+	// see the trust package
+	TrustLabel string `json:"trust_label,omitempty" db:"trust_label"`
+	// Offloaded events are stubs without content standing in for an event
+	// too large for the queue and cache; see the largeobj package
+	Offloaded bool `json:"offloaded,omitempty" db:"offloaded"`
+	// TraceID is the connection or request the event was submitted on,
+	// carried through the queue so its log lines can be joined
+	TraceID string `json:"trace_id,omitempty" db:"-"`
+	// TraceParent is the W3C trace context of the span that queued the
+	// event, so tracing continues on the consuming side
+	TraceParent string `json:"traceparent,omitempty" db:"-"`
+}
+
+// IndexTags returns the tags to index and match filters against
+func (e *Event) IndexTags() nostr.Tags {
+	if e.NormalizedTags != nil {
+		return e.NormalizedTags
+	}
+	return e.Tags
+}
+
+// IsReplaceableKind reports whether a later event of kind replaces the
+// earlier ones of the same author (NIP-01): kinds 0, 3 and 10000-19999, and
+// the addressable kinds, which are also told apart by their d tag
+func IsReplaceableKind(kind int) bool {
+	return kind == 0 || kind == 3 || (kind >= 10000 && kind < 20000) || IsAddressableKind(kind)
+}
+
+// IsAddressableKind reports whether kind is addressable, 30000-39999
+func IsAddressableKind(kind int) bool {
+	return kind >= 30000 && kind < 40000
+}
+
+// DTag returns the d tag value of an addressable event, and "" for other
+// kinds, whose versions are keyed by kind and author alone
+func (e *Event) DTag() string {
+	if !IsAddressableKind(e.Kind) {
+		return ""
+	}
+	for _, tag := range e.Tags {
+		if len(tag) >= 2 && tag[0] == "d" {
+			return tag[1]
+		}
+	}
+	return ""
+}
+
+// Nevent returns the NIP-19 nevent of the event with its author and relays
+// as hints
+func (e *Event) Nevent(relays []string) (string, error) {
+	return nip19.EncodeEvent(e.ID, relays, e.PubKey)
+}
+
+// Naddr returns the NIP-19 naddr of a replaceable event, which follows the
+// author's latest version of it
+func (e *Event) Naddr(relays []string) (string, error) {
+	if !IsReplaceableKind(e.Kind) {
+		return "", fmt.Errorf("kind %d is not replaceable", e.Kind)
+	}
+	return nip19.EncodeEntity(e.PubKey, e.Kind, e.DTag(), relays)
+}
+
+// Identifier returns the identifier clients should open the event by: its
+// naddr when replaceable, its nevent otherwise
+func (e *Event) Identifier(relays []string) (string, error) {
+	if IsReplaceableKind(e.Kind) {
+		return e.Naddr(relays)
+	}
+	return e.Nevent(relays)
+}
+
+// Expiration returns the NIP-40 expiration time of the event, if it has a
+// valid expiration tag
+func (e *Event) Expiration() (nostr.Timestamp, bool) {
+	for _, tag := range e.Tags {
+		if len(tag) >= 2 && tag[0] == "expiration" {
+			at, err := strconv.ParseInt(tag[1], 10, 64)
+			if err != nil || at <= 0 {
+				return 0, false
+			}
+			return nostr.Timestamp(at), true
+		}
+	}
+	return 0, false
+}
+
+// Supersedes reports whether e replaces other as the latest version of a
+// replaceable event: it is newer, or as old with the lower ID
+func (e *Event) Supersedes(other *Event) bool {
+	if e.CreatedAt != other.CreatedAt {
+		return e.CreatedAt > other.CreatedAt
+	}
+	return e.ID < other.ID
+}
+
+// MatchesTags reports whether the event satisfies every "#x" condition of a
+// filter: for each tag name, one of its index tags must carry one of the
+// listed values. A nil list sets no condition, as in nostr.Filter.
+func (e *Event) MatchesTags(conditions nostr.TagMap) bool {
+	for name, values := range conditions {
+		if values != nil && !e.IndexTags().ContainsAny(name, values) {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchesFilter reports whether the event satisfies the NIP-01 conditions of
+// filter. Tags are matched by MatchesTags; search and limit are left to the
+// caller.
+func (e *Event) MatchesFilter(filter nostr.Filter) bool {
+	if len(filter.IDs) > 0 && !slices.Contains(filter.IDs, e.ID) {
+		return false
+	}
+	if len(filter.Authors) > 0 && !slices.Contains(filter.Authors, e.PubKey) {
+		return false
+	}
+	if len(filter.Kinds) > 0 && !slices.Contains(filter.Kinds, e.Kind) {
+		return false
+	}
+	if filter.Since != nil && e.CreatedAt < *filter.Since {
+		return false
+	}
+	if filter.Until != nil && e.CreatedAt > *filter.Until {
+		return false
+	}
+	return e.MatchesTags(filter.Tags)
+}
+
+// Timestamp converts t to the canonical event timestamp, dropping anything
+// below whole seconds
+func Timestamp(t time.Time) nostr.Timestamp {
+	return nostr.Timestamp(t.Unix())
+}
+
+// CreatedTime returns CreatedAt as a time.Time
+func (e *Event) CreatedTime() time.Time {
+	return e.CreatedAt.Time()
+}
+
+// SetCreatedTime sets CreatedAt from a time.Time
+func (e *Event) SetCreatedTime(t time.Time) {
+	e.CreatedAt = Timestamp(t)
 }
 
 // ToNostrEvent converts our Event to a nostr.Event
@@ -52,12 +211,12 @@ func FromNostrEvent(ne *nostr.Event) *Event {
 // Validate performs basic validation on the event
 func (e *Event) Validate() error {
 	// Check if event is not too old (1 hour tolerance)
-	if time.Since(e.CreatedAt.Time()) > time.Hour {
+	if time.Since(e.CreatedTime()) > time.Hour {
 		return ErrEventTooOld
 	}
 
 	// Check if event is not in the future (5 minutes tolerance)
-	if e.CreatedAt.Time().After(time.Now().Add(5 * time.Minute)) {
+	if e.CreatedTime().After(time.Now().Add(5 * time.Minute)) {
 		return ErrEventInFuture
 	}
 
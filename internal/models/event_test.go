@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
 )
 
 // Test helper functions
@@ -91,7 +92,7 @@ func TestEventValidation(t *testing.T) {
 
 	t.Run("Event too old", func(t *testing.T) {
 		event := eg.GenerateTextNote(eg.GetRandomNpub(), "Test content", nostr.Tags{})
-		event.CreatedAt = nostr.Timestamp(time.Now().Add(-2 * time.Hour).Unix()) // 2 hours ago
+		event.SetCreatedTime(time.Now().Add(-2 * time.Hour)) // 2 hours ago
 		err := event.Validate()
 		assertError(t, err)
 		assertErrorContains(t, err, "too old")
@@ -99,7 +100,7 @@ func TestEventValidation(t *testing.T) {
 
 	t.Run("Event in future", func(t *testing.T) {
 		event := eg.GenerateTextNote(eg.GetRandomNpub(), "Test content", nostr.Tags{})
-		event.CreatedAt = nostr.Timestamp(time.Now().Add(10 * time.Minute).Unix()) // 10 minutes in future
+		event.SetCreatedTime(time.Now().Add(10 * time.Minute)) // 10 minutes in future
 		err := event.Validate()
 		assertError(t, err)
 		assertErrorContains(t, err, "future")
@@ -214,6 +215,41 @@ func TestEventSerialization(t *testing.T) {
 	})
 }
 
+func TestEventTimestamps(t *testing.T) {
+	created := time.Date(2024, 3, 1, 12, 30, 45, 500_000_000, time.UTC)
+
+	t.Run("Helpers truncate to whole seconds", func(t *testing.T) {
+		event := &Event{}
+		event.SetCreatedTime(created)
+		helpers.AssertInt64Equal(t, created.Unix(), int64(event.CreatedAt))
+		helpers.AssertTrue(t, event.CreatedTime().Equal(created.Truncate(time.Second)))
+		helpers.AssertInt64Equal(t, created.Unix(), int64(Timestamp(created)))
+	})
+
+	t.Run("JSON encodes unix seconds", func(t *testing.T) {
+		event := &Event{ID: "abc", CreatedAt: Timestamp(created)}
+		data, err := json.Marshal(event)
+		assertNoError(t, err)
+		helpers.AssertStringContains(t, string(data), fmt.Sprintf(`"created_at":%d,`, created.Unix()))
+
+		var decoded Event
+		assertNoError(t, json.Unmarshal(data, &decoded))
+		helpers.AssertTrue(t, decoded.CreatedTime().Equal(event.CreatedTime()))
+	})
+
+	t.Run("nostr.Event round trip", func(t *testing.T) {
+		event := &Event{ID: "abc", CreatedAt: Timestamp(created), Kind: 1}
+		ne := event.ToNostrEvent()
+		helpers.AssertInt64Equal(t, created.Unix(), int64(ne.CreatedAt))
+
+		data, err := json.Marshal(ne)
+		assertNoError(t, err)
+		var decoded nostr.Event
+		assertNoError(t, json.Unmarshal(data, &decoded))
+		helpers.AssertInt64Equal(t, int64(event.CreatedAt), int64(FromNostrEvent(&decoded).CreatedAt))
+	})
+}
+
 func TestSpamDetection(t *testing.T) {
 	eg := NewEventGenerator()
 
@@ -346,3 +382,133 @@ func TestEventQualityScoreEdgeCases(t *testing.T) {
 		}
 	})
 }
+
+func TestEventProvenance(t *testing.T) {
+	event := &Event{ID: "test-id", Kind: 1}
+	event.AddProvenance(ProvenanceUpstream, "wss://relay.one", "")
+	event.AddProvenance(ProvenanceUpstream, "wss://relay.one", "") // same sighting
+	event.AddProvenance(ProvenanceWebSocket, "203.0.113.7:5000", "")
+
+	helpers.AssertIntEqual(t, 2, len(event.Provenance))
+	helpers.AssertStringEqual(t, ProvenanceUpstream, event.Provenance[0].Source)
+	helpers.AssertStringEqual(t, "wss://relay.one", event.Provenance[0].Detail)
+
+	merged, added := MergeProvenance(event.Provenance, []Provenance{{Source: ProvenanceUpstream, Detail: "wss://relay.two", At: time.Now()}})
+	helpers.AssertTrue(t, added)
+	helpers.AssertIntEqual(t, 3, len(merged))
+
+	_, added = MergeProvenance(merged, []Provenance{{Source: ProvenanceUpstream, Detail: "wss://relay.two"}})
+	helpers.AssertFalse(t, added)
+
+	// Sightings are bounded
+	for i := 0; i < 2*maxProvenance; i++ {
+		event.AddProvenance(ProvenanceUpstream, fmt.Sprintf("wss://relay%d.example.com", i), "")
+	}
+	helpers.AssertIntEqual(t, maxProvenance, len(event.Provenance))
+}
+
+func TestEventMatchesTags(t *testing.T) {
+	event := &Event{Kind: 1, Tags: nostr.Tags{{"e", "root", "", "root"}, {"p", "alice"}, {"t", "Nostr"}}}
+	helpers.AssertTrue(t, event.MatchesTags(nil))
+	helpers.AssertTrue(t, event.MatchesTags(nostr.TagMap{"e": {"other", "root"}, "p": {"alice"}}))
+	helpers.AssertFalse(t, event.MatchesTags(nostr.TagMap{"e": {"root"}, "p": {"bob"}}))
+	helpers.AssertFalse(t, event.MatchesTags(nostr.TagMap{"d": {"root"}}))
+	helpers.AssertTrue(t, event.MatchesTags(nostr.TagMap{"d": nil}))
+
+	// Normalized values stand in for the signed ones
+	event.NormalizedTags = nostr.Tags{{"e", "root"}, {"p", "alice"}, {"t", "nostr"}}
+	helpers.AssertTrue(t, event.MatchesTags(nostr.TagMap{"t": {"nostr"}}))
+	helpers.AssertFalse(t, event.MatchesTags(nostr.TagMap{"t": {"Nostr"}}))
+}
+
+func TestEventMatchesFilter(t *testing.T) {
+	event := &Event{
+		ID:             "e1",
+		PubKey:         "alice",
+		CreatedAt:      1700000000,
+		Kind:           1,
+		Tags:           nostr.Tags{{"e", "root"}, {"t", "Books"}},
+		NormalizedTags: nostr.Tags{{"e", "root"}, {"t", "books"}},
+	}
+	before, at, after := nostr.Timestamp(1699999999), nostr.Timestamp(1700000000), nostr.Timestamp(1700000001)
+
+	for _, filter := range []nostr.Filter{
+		{},
+		{IDs: []string{"e0", "e1"}, Authors: []string{"alice"}, Kinds: []int{0, 1}},
+		{Since: &at, Until: &at},
+		{Since: &before, Until: &after, Limit: 1},
+		{Tags: nostr.TagMap{"e": {"root"}, "t": {"books"}}},
+		// Search is left to the caller
+		{Search: "anything"},
+	} {
+		helpers.AssertTrue(t, event.MatchesFilter(filter))
+	}
+	for _, filter := range []nostr.Filter{
+		{IDs: []string{"e0"}},
+		{Authors: []string{"bob"}},
+		{Kinds: []int{0}},
+		{Since: &after},
+		{Until: &before},
+		{Tags: nostr.TagMap{"t": {"Books"}}},
+		{Kinds: []int{1}, Tags: nostr.TagMap{"p": {"alice"}}},
+	} {
+		helpers.AssertFalse(t, event.MatchesFilter(filter))
+	}
+}
+
+func TestEventReplaceable(t *testing.T) {
+	for kind, replaceable := range map[int]bool{0: true, 1: false, 3: true, 7: false, 10002: true, 20000: false, 30023: true, 39999: true, 40000: false} {
+		helpers.AssertEqual(t, replaceable, IsReplaceableKind(kind))
+	}
+
+	event := &Event{ID: "b", Kind: 10002, CreatedAt: 1700000000, Tags: nostr.Tags{{"d", "ignored"}}}
+	helpers.AssertStringEqual(t, "", event.DTag())
+	event.Kind = 30023
+	helpers.AssertStringEqual(t, "ignored", event.DTag())
+
+	// Newer wins; a tie goes to the lower ID
+	helpers.AssertTrue(t, event.Supersedes(&Event{ID: "a", CreatedAt: 1699999999}))
+	helpers.AssertFalse(t, event.Supersedes(&Event{ID: "a", CreatedAt: 1700000000}))
+	helpers.AssertTrue(t, event.Supersedes(&Event{ID: "c", CreatedAt: 1700000000}))
+}
+
+func TestEventExpiration(t *testing.T) {
+	event := &Event{Kind: 1, Tags: nostr.Tags{{"t", "nostr"}, {"expiration", "1700000000"}}}
+	at, ok := event.Expiration()
+	helpers.AssertTrue(t, ok)
+	helpers.AssertEqual(t, nostr.Timestamp(1700000000), at)
+
+	for _, tags := range []nostr.Tags{nil, {{"expiration", "soon"}}, {{"expiration"}}} {
+		_, ok := (&Event{Tags: tags}).Expiration()
+		helpers.AssertFalse(t, ok)
+	}
+}
+
+func TestEventIdentifiers(t *testing.T) {
+	pubkey, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	relays := []string{"wss://relay.example.com"}
+
+	note := &Event{ID: strings.Repeat("ab", 32), PubKey: pubkey, Kind: 1}
+	nevent, err := note.Identifier(relays)
+	helpers.AssertNoError(t, err)
+	prefix, value, err := nip19.Decode(nevent)
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, "nevent", prefix)
+	pointer := value.(nostr.EventPointer)
+	helpers.AssertStringEqual(t, note.ID, pointer.ID)
+	helpers.AssertStringEqual(t, pubkey, pointer.Author)
+	helpers.AssertStringEqual(t, relays[0], pointer.Relays[0])
+	_, err = note.Naddr(relays)
+	helpers.AssertTrue(t, err != nil)
+
+	book := &Event{ID: strings.Repeat("cd", 32), PubKey: pubkey, Kind: 30040, Tags: nostr.Tags{{"d", "atlas"}}}
+	naddr, err := book.Identifier(relays)
+	helpers.AssertNoError(t, err)
+	prefix, value, err = nip19.Decode(naddr)
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, "naddr", prefix)
+	entity := value.(nostr.EntityPointer)
+	helpers.AssertStringEqual(t, "atlas", entity.Identifier)
+	helpers.AssertIntEqual(t, 30040, entity.Kind)
+	helpers.AssertStringEqual(t, pubkey, entity.PublicKey)
+}
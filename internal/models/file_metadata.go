@@ -0,0 +1,97 @@
+package models
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// KindFileMetadata is the NIP-94 file metadata event kind
+const KindFileMetadata = 1063
+
+// ErrInvalidFileMetadata is returned when a kind 1063 event is missing or has malformed required tags
+var ErrInvalidFileMetadata = fmt.Errorf("invalid file metadata")
+
+// FileMetadata is the parsed form of a NIP-94 kind 1063 event
+type FileMetadata struct {
+	EventID        string `json:"event_id"`
+	URL            string `json:"url"`
+	MimeType       string `json:"mime_type"`
+	SHA256         string `json:"sha256"`
+	OriginalSHA256 string `json:"original_sha256,omitempty"`
+	Size           int64  `json:"size,omitempty"`
+	Dimensions     string `json:"dim,omitempty"`
+	Blurhash       string `json:"blurhash,omitempty"`
+	Alt            string `json:"alt,omitempty"`
+	Summary        string `json:"summary,omitempty"`
+	Role           string `json:"role,omitempty"`
+}
+
+// ParseFileMetadata validates a kind 1063 event and extracts its file tags.
+// The url, m (mime type) and x (SHA-256 of the file) tags are required.
+func ParseFileMetadata(event *Event) (*FileMetadata, error) {
+	if event.Kind != KindFileMetadata {
+		return nil, fmt.Errorf("%w: kind %d is not %d", ErrInvalidFileMetadata, event.Kind, KindFileMetadata)
+	}
+
+	file := &FileMetadata{
+		EventID: event.ID,
+		Summary: event.Content,
+	}
+
+	for _, tag := range event.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		switch tag[0] {
+		case "url":
+			file.URL = tag[1]
+		case "m":
+			file.MimeType = strings.ToLower(tag[1])
+		case "x":
+			file.SHA256 = strings.ToLower(tag[1])
+		case "ox":
+			file.OriginalSHA256 = strings.ToLower(tag[1])
+		case "size":
+			size, err := strconv.ParseInt(tag[1], 10, 64)
+			if err != nil || size < 0 {
+				return nil, fmt.Errorf("%w: size %q", ErrInvalidFileMetadata, tag[1])
+			}
+			file.Size = size
+		case "dim":
+			file.Dimensions = tag[1]
+		case "blurhash":
+			file.Blurhash = tag[1]
+		case "alt":
+			file.Alt = tag[1]
+		case "summary":
+			file.Summary = tag[1]
+		}
+	}
+
+	if file.URL == "" {
+		return nil, fmt.Errorf("%w: missing url tag", ErrInvalidFileMetadata)
+	}
+	if u, err := url.Parse(file.URL); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("%w: url %q is not an http(s) URL", ErrInvalidFileMetadata, file.URL)
+	}
+	if file.MimeType == "" || !strings.Contains(file.MimeType, "/") {
+		return nil, fmt.Errorf("%w: missing or malformed m tag", ErrInvalidFileMetadata)
+	}
+	if !nostr.IsValid32ByteHex(file.SHA256) {
+		return nil, fmt.Errorf("%w: x tag must be a hex SHA-256", ErrInvalidFileMetadata)
+	}
+	if file.OriginalSHA256 != "" && !nostr.IsValid32ByteHex(file.OriginalSHA256) {
+		return nil, fmt.Errorf("%w: ox tag must be a hex SHA-256", ErrInvalidFileMetadata)
+	}
+
+	return file, nil
+}
+
+// IsImage reports whether the file is an image, e.g. a cover candidate
+func (f *FileMetadata) IsImage() bool {
+	return strings.HasPrefix(f.MimeType, "image/")
+}
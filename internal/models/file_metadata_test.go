@@ -0,0 +1,57 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestParseFileMetadata(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+
+	t.Run("Valid file metadata", func(t *testing.T) {
+		event := &Event{
+			ID:      "file-1",
+			Kind:    KindFileMetadata,
+			Content: "Cover art",
+			Tags: nostr.Tags{
+				{"url", "https://cdn.example.com/cover.jpg"},
+				{"m", "Image/JPEG"},
+				{"x", strings.ToUpper(hash)},
+				{"size", "20480"},
+				{"dim", "600x800"},
+			},
+		}
+
+		file, err := ParseFileMetadata(event)
+		assertNoError(t, err)
+		assertEqual(t, "https://cdn.example.com/cover.jpg", file.URL)
+		assertEqual(t, "image/jpeg", file.MimeType)
+		assertEqual(t, hash, file.SHA256)
+		assertEqual(t, int64(20480), file.Size)
+		assertEqual(t, "Cover art", file.Summary)
+		assertTrue(t, file.IsImage())
+	})
+
+	invalid := map[string]nostr.Tags{
+		"missing url":    {{"m", "image/png"}, {"x", hash}},
+		"non-http url":   {{"url", "ftp://example.com/a.png"}, {"m", "image/png"}, {"x", hash}},
+		"missing mime":   {{"url", "https://example.com/a.png"}, {"x", hash}},
+		"malformed hash": {{"url", "https://example.com/a.png"}, {"m", "image/png"}, {"x", "abc"}},
+		"negative size":  {{"url", "https://example.com/a.png"}, {"m", "image/png"}, {"x", hash}, {"size", "-1"}},
+	}
+	for name, tags := range invalid {
+		t.Run("Rejects "+name, func(t *testing.T) {
+			_, err := ParseFileMetadata(&Event{Kind: KindFileMetadata, Tags: tags})
+			assertError(t, err)
+			assertTrue(t, errors.Is(err, ErrInvalidFileMetadata))
+		})
+	}
+
+	t.Run("Rejects other kinds", func(t *testing.T) {
+		_, err := ParseFileMetadata(&Event{Kind: 1})
+		assertErrorContains(t, err, "is not 1063")
+	})
+}
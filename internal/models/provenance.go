@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+// Provenance sources
+const (
+	ProvenanceWebSocket = "websocket" // published by a client over the relay WebSocket
+	ProvenanceREST      = "rest"      // published through the REST API
+	ProvenanceGRPC      = "grpc"      // published over the gRPC event stream
+	ProvenanceUpstream  = "upstream"  // streamed from an upstream relay
+	ProvenanceReplay    = "replay"    // rewritten by a replay/backfill job
+	ProvenanceMirror    = "mirror"    // fetched by the mirror sync of a mirrored author
+)
+
+// maxProvenance bounds the sightings kept per event so popular events seen
+// on many upstreams don't grow without limit
+const maxProvenance = 20
+
+// Provenance records one way an event reached the relay
+type Provenance struct {
+	Source string    `json:"source"`
+	Detail string    `json:"detail,omitempty"` // remote address, upstream URL or job name
+	Pubkey string    `json:"pubkey,omitempty"` // authenticated submitter, if any
+	At     time.Time `json:"at"`
+}
+
+// AddProvenance records that the event arrived from source now
+func (e *Event) AddProvenance(source, detail, pubkey string) {
+	e.Provenance, _ = MergeProvenance(e.Provenance, []Provenance{{
+		Source: source,
+		Detail: detail,
+		Pubkey: pubkey,
+		At:     time.Now().UTC(),
+	}})
+}
+
+// MergeProvenance appends incoming sightings to existing, keeping only the
+// first sighting per source and detail. It reports whether anything was added.
+func MergeProvenance(existing, incoming []Provenance) ([]Provenance, bool) {
+	added := false
+	for _, p := range incoming {
+		if len(existing) >= maxProvenance {
+			break
+		}
+		seen := false
+		for _, e := range existing {
+			if e.Source == p.Source && e.Detail == p.Detail {
+				seen = true
+				break
+			}
+		}
+		if !seen {
+			existing = append(existing, p)
+			added = true
+		}
+	}
+	return existing, added
+}
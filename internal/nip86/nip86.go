@@ -0,0 +1,224 @@
+// Package nip86 serves the NIP-86 relay management API: JSON-RPC-like
+// requests POSTed to the relay URL, authorized with a NIP-98 HTTP auth
+// event signed by an admin.
+package nip86
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ContentType marks NIP-86 requests and responses
+const ContentType = "application/nostr+json+rpc"
+
+// KindHTTPAuth is the NIP-98 HTTP auth event kind
+const KindHTTPAuth = 27235
+
+// maxBodySize caps a management request
+const maxBodySize = 64 << 10
+
+// authWindow is how far the auth event's created_at may be from now
+const authWindow = time.Minute
+
+// Request is a management call
+type Request struct {
+	Method string            `json:"method"`
+	Params []json.RawMessage `json:"params"`
+}
+
+// Response carries a call's result or error
+type Response struct {
+	Result any    `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Method handles one management method for the admin with pubkey
+type Method func(ctx context.Context, admin string, params Params) (any, error)
+
+// IsRequest reports whether req is a NIP-86 call
+func IsRequest(req *http.Request) bool {
+	return req.Method == http.MethodPost && strings.HasPrefix(req.Header.Get("Content-Type"), ContentType)
+}
+
+// Handler dispatches management calls to the registered methods
+type Handler struct {
+	authorize func(pubkey string) bool
+	methods   map[string]Method
+	mu        sync.RWMutex
+	now       func() time.Time
+}
+
+// NewHandler returns a handler allowing the pubkeys authorize accepts
+func NewHandler(authorize func(pubkey string) bool) *Handler {
+	return &Handler{
+		authorize: authorize,
+		methods:   make(map[string]Method),
+		now:       time.Now,
+	}
+}
+
+// Handle registers fn for method
+func (h *Handler) Handle(method string, fn Method) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.methods[method] = fn
+}
+
+// Methods lists the supported methods, sorted
+func (h *Handler) Methods() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	methods := []string{"supportedmethods"}
+	for method := range h.methods {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// ServeHTTP answers one management call
+func (h *Handler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(req.Body, maxBodySize))
+	if err != nil {
+		h.respond(w, http.StatusBadRequest, Response{Error: "failed to read request"})
+		return
+	}
+
+	admin, err := h.verifyAuth(req, body)
+	if err != nil {
+		h.respond(w, http.StatusUnauthorized, Response{Error: err.Error()})
+		return
+	}
+
+	var call Request
+	if err := json.Unmarshal(body, &call); err != nil {
+		h.respond(w, http.StatusBadRequest, Response{Error: "invalid request"})
+		return
+	}
+	if call.Method == "supportedmethods" {
+		h.respond(w, http.StatusOK, Response{Result: h.Methods()})
+		return
+	}
+
+	h.mu.RLock()
+	fn, ok := h.methods[call.Method]
+	h.mu.RUnlock()
+	if !ok {
+		h.respond(w, http.StatusOK, Response{Error: fmt.Sprintf("unsupported method %q", call.Method)})
+		return
+	}
+
+	result, err := fn(req.Context(), admin, Params(call.Params))
+	if err != nil {
+		h.respond(w, http.StatusOK, Response{Error: err.Error()})
+		return
+	}
+	slog.Info("Relay management call", "audit", true, "admin", admin, "method", call.Method)
+	h.respond(w, http.StatusOK, Response{Result: result})
+}
+
+func (h *Handler) respond(w http.ResponseWriter, status int, response Response) {
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(response); err != nil {
+		slog.Error("Error writing management response", "error", err)
+	}
+}
+
+// verifyAuth checks the NIP-98 Authorization header of req and returns the
+// pubkey of the admin who signed it
+func (h *Handler) verifyAuth(req *http.Request, body []byte) (string, error) {
+	value := req.Header.Get("Authorization")
+	encoded, ok := strings.CutPrefix(value, "Nostr ")
+	if !ok {
+		return "", fmt.Errorf("missing NIP-98 authorization")
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return "", fmt.Errorf("invalid NIP-98 authorization")
+	}
+	var event nostr.Event
+	if err := json.Unmarshal(data, &event); err != nil {
+		return "", fmt.Errorf("invalid NIP-98 authorization")
+	}
+
+	if event.Kind != KindHTTPAuth {
+		return "", fmt.Errorf("authorization event must be kind %d", KindHTTPAuth)
+	}
+	if ok, err := event.CheckSignature(); err != nil || !ok {
+		return "", fmt.Errorf("invalid authorization signature")
+	}
+	if age := h.now().Sub(event.CreatedAt.Time()); age > authWindow || age < -authWindow {
+		return "", fmt.Errorf("authorization event expired")
+	}
+	if tag := event.Tags.GetFirst([]string{"method", ""}); tag == nil || !strings.EqualFold((*tag)[1], req.Method) {
+		return "", fmt.Errorf("authorization method does not match")
+	}
+	if tag := event.Tags.GetFirst([]string{"u", ""}); tag == nil || !sameURL((*tag)[1], req) {
+		return "", fmt.Errorf("authorization url does not match")
+	}
+	sum := sha256.Sum256(body)
+	if tag := event.Tags.GetFirst([]string{"payload", ""}); tag == nil || (*tag)[1] != hex.EncodeToString(sum[:]) {
+		return "", fmt.Errorf("authorization payload does not match")
+	}
+	if !h.authorize(event.PubKey) {
+		return "", fmt.Errorf("pubkey is not a relay admin")
+	}
+	return event.PubKey, nil
+}
+
+// sameURL compares the host and path of the signed URL with the request's.
+// The scheme is ignored: clients sign the ws(s) or http(s) form alike, and
+// TLS often ends at a proxy.
+func sameURL(signed string, req *http.Request) bool {
+	u, err := url.Parse(signed)
+	if err != nil {
+		return false
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	return strings.EqualFold(u.Host, req.Host) && path == strings.TrimSuffix(req.URL.Path, "/")
+}
+
+// Params are the positional parameters of a call
+type Params []json.RawMessage
+
+// String returns parameter i as a string; optional ones may be missing
+func (p Params) String(i int, required bool) (string, error) {
+	if i >= len(p) {
+		if required {
+			return "", fmt.Errorf("missing parameter %d", i+1)
+		}
+		return "", nil
+	}
+	var value string
+	if err := json.Unmarshal(p[i], &value); err != nil {
+		return "", fmt.Errorf("parameter %d must be a string", i+1)
+	}
+	return value, nil
+}
+
+// Int returns the required parameter i as an integer
+func (p Params) Int(i int) (int, error) {
+	if i >= len(p) {
+		return 0, fmt.Errorf("missing parameter %d", i+1)
+	}
+	var value int
+	if err := json.Unmarshal(p[i], &value); err != nil {
+		return 0, fmt.Errorf("parameter %d must be a number", i+1)
+	}
+	return value, nil
+}
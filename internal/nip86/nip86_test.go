@@ -0,0 +1,103 @@
+package nip86
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// call posts body to handler with a NIP-98 header signed by sk for url
+func call(handler http.Handler, sk, url, body string, at time.Time) (int, Response) {
+	sum := sha256.Sum256([]byte(body))
+	auth := nostr.Event{
+		Kind:      KindHTTPAuth,
+		CreatedAt: nostr.Timestamp(at.Unix()),
+		Tags:      nostr.Tags{{"u", url}, {"method", "POST"}, {"payload", hex.EncodeToString(sum[:])}},
+	}
+	auth.Sign(sk)
+	data, _ := json.Marshal(auth)
+
+	req := httptest.NewRequest("POST", "http://relay.example.com/", strings.NewReader(body))
+	req.Header.Set("Content-Type", ContentType)
+	req.Header.Set("Authorization", "Nostr "+base64.StdEncoding.EncodeToString(data))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	var response Response
+	json.Unmarshal(w.Body.Bytes(), &response)
+	return w.Code, response
+}
+
+func TestManagementCalls(t *testing.T) {
+	adminKey := nostr.GeneratePrivateKey()
+	admin, _ := nostr.GetPublicKey(adminKey)
+	banned := map[string]string{}
+
+	h := NewHandler(func(pubkey string) bool { return pubkey == admin })
+	h.Handle("banpubkey", func(ctx context.Context, by string, params Params) (any, error) {
+		pubkey, err := params.String(0, true)
+		if err != nil {
+			return nil, err
+		}
+		reason, err := params.String(1, false)
+		if err != nil {
+			return nil, err
+		}
+		banned[pubkey] = reason
+		return true, nil
+	})
+	now := time.Now()
+
+	t.Run("Lists supported methods", func(t *testing.T) {
+		code, response := call(h, adminKey, "wss://relay.example.com", `{"method":"supportedmethods","params":[]}`, now)
+		helpers.AssertIntEqual(t, http.StatusOK, code)
+		helpers.AssertStringEqual(t, "[banpubkey supportedmethods]", fmt.Sprint(response.Result))
+	})
+
+	t.Run("Runs a method", func(t *testing.T) {
+		code, response := call(h, adminKey, "https://relay.example.com/", `{"method":"banpubkey","params":["abc","spam"]}`, now)
+		helpers.AssertIntEqual(t, http.StatusOK, code)
+		helpers.AssertEqual(t, true, response.Result)
+		helpers.AssertStringEqual(t, "spam", banned["abc"])
+
+		_, response = call(h, adminKey, "https://relay.example.com/", `{"method":"banpubkey","params":[]}`, now)
+		helpers.AssertStringEqual(t, "missing parameter 1", response.Error)
+		_, response = call(h, adminKey, "https://relay.example.com/", `{"method":"blockip","params":["1.2.3.4"]}`, now)
+		helpers.AssertStringContains(t, response.Error, "unsupported method")
+	})
+
+	t.Run("Refuses bad authorization", func(t *testing.T) {
+		body := `{"method":"supportedmethods","params":[]}`
+		code, _ := call(h, nostr.GeneratePrivateKey(), "wss://relay.example.com", body, now)
+		helpers.AssertIntEqual(t, http.StatusUnauthorized, code)
+		code, _ = call(h, adminKey, "wss://other.example.com", body, now)
+		helpers.AssertIntEqual(t, http.StatusUnauthorized, code)
+		code, _ = call(h, adminKey, "wss://relay.example.com", body, now.Add(-5*time.Minute))
+		helpers.AssertIntEqual(t, http.StatusUnauthorized, code)
+
+		req := httptest.NewRequest("POST", "http://relay.example.com/", strings.NewReader(body))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, req)
+		helpers.AssertIntEqual(t, http.StatusUnauthorized, w.Code)
+	})
+}
+
+func TestIsRequest(t *testing.T) {
+	req := httptest.NewRequest("POST", "/", nil)
+	req.Header.Set("Content-Type", ContentType)
+	helpers.AssertTrue(t, IsRequest(req))
+	req.Header.Set("Content-Type", "application/json")
+	helpers.AssertFalse(t, IsRequest(req))
+}
@@ -0,0 +1,199 @@
+package normalize
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// Rules applied to tag values, used as metric names
+const (
+	RuleNostrURI  = "nostr_uri" // "nostr:" prefix stripped
+	RuleBech32    = "bech32"    // npub/nprofile/note/nevent/naddr decoded to hex
+	RuleLowercase = "lowercase" // upper case hex lowered
+	RuleHashtag   = "hashtag"   // "t" values lowered and "#" stripped
+)
+
+// Stats counts the normalizations applied since startup
+type Stats struct {
+	EventsNormalized int64            `json:"events_normalized"`
+	TagsNormalized   int64            `json:"tags_normalized"`
+	Rules            map[string]int64 `json:"rules"`
+}
+
+// Normalizer canonicalizes common tag values before events are indexed. The
+// signed tags are never changed; the canonical form goes in NormalizedTags.
+type Normalizer struct {
+	stats Stats
+	mu    sync.Mutex
+}
+
+// NewNormalizer creates a normalizer with empty metrics
+func NewNormalizer() *Normalizer {
+	return &Normalizer{stats: Stats{Rules: make(map[string]int64)}}
+}
+
+// Apply sets event.NormalizedTags when any tag value needs rewriting and
+// returns the number of tags changed. Re-applying to the same event is safe.
+func (n *Normalizer) Apply(event *models.Event) int {
+	tags, rules := Tags(event.Tags)
+	if len(rules) == 0 {
+		event.NormalizedTags = nil
+		return 0
+	}
+	event.NormalizedTags = tags
+
+	n.mu.Lock()
+	n.stats.EventsNormalized++
+	n.stats.TagsNormalized += int64(len(rules))
+	for _, applied := range rules {
+		for _, rule := range applied {
+			n.stats.Rules[rule]++
+		}
+	}
+	n.mu.Unlock()
+
+	return len(rules)
+}
+
+// GetStats returns a copy of the normalization metrics
+func (n *Normalizer) GetStats() Stats {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	rules := make(map[string]int64, len(n.stats.Rules))
+	for rule, count := range n.stats.Rules {
+		rules[rule] = count
+	}
+	stats := n.stats
+	stats.Rules = rules
+	return stats
+}
+
+// Tags returns the canonical form of tags and, keyed by tag index, the rules
+// that changed each tag. The input is not modified; when nothing changes the
+// returned map is empty.
+func Tags(tags nostr.Tags) (nostr.Tags, map[int][]string) {
+	rules := make(map[int][]string)
+	var normalized nostr.Tags
+	for i, tag := range tags {
+		if len(tag) < 2 {
+			continue
+		}
+		value, applied := Value(tag[0], tag[1])
+		if len(applied) == 0 {
+			continue
+		}
+		if normalized == nil {
+			normalized = make(nostr.Tags, len(tags))
+			copy(normalized, tags)
+		}
+		canonical := make(nostr.Tag, len(tag))
+		copy(canonical, tag)
+		canonical[1] = value
+		normalized[i] = canonical
+		rules[i] = applied
+	}
+	if normalized == nil {
+		return tags, rules
+	}
+	return normalized, rules
+}
+
+// Value canonicalizes a single tag value: p tags become lowercase hex
+// pubkeys, e and q tags lowercase hex event IDs, a tags "kind:pubkey:d"
+// addresses with a lowercase pubkey and t tags lowercase hashtags. Values
+// that can't be canonicalized are returned unchanged.
+func Value(name, value string) (string, []string) {
+	var applied []string
+
+	switch name {
+	case "p", "e", "q", "a":
+	case "t":
+		lowered := strings.ToLower(strings.TrimPrefix(value, "#"))
+		if lowered != value {
+			applied = append(applied, RuleHashtag)
+		}
+		return lowered, applied
+	default:
+		return value, nil
+	}
+
+	if trimmed := strings.TrimPrefix(value, "nostr:"); trimmed != value {
+		value = trimmed
+		applied = append(applied, RuleNostrURI)
+	}
+
+	if decoded, ok := decodeBech32(name, value); ok {
+		return decoded, append(applied, RuleBech32)
+	}
+
+	lowered := value
+	if name == "a" {
+		// Only the pubkey part of an address is hex; d tags are case sensitive
+		if parts := strings.SplitN(value, ":", 3); len(parts) == 3 && isHex(parts[1]) {
+			lowered = parts[0] + ":" + strings.ToLower(parts[1]) + ":" + parts[2]
+		}
+	} else if isHex(value) {
+		lowered = strings.ToLower(value)
+	}
+	if lowered != value {
+		applied = append(applied, RuleLowercase)
+	}
+
+	return lowered, applied
+}
+
+// decodeBech32 decodes the NIP-19 entity expected in a tag of the given name
+func decodeBech32(name, value string) (string, bool) {
+	if !strings.HasPrefix(value, "npub1") && !strings.HasPrefix(value, "nprofile1") &&
+		!strings.HasPrefix(value, "note1") && !strings.HasPrefix(value, "nevent1") &&
+		!strings.HasPrefix(value, "naddr1") {
+		return "", false
+	}
+
+	prefix, data, err := nip19.Decode(value)
+	if err != nil {
+		return "", false
+	}
+
+	switch name {
+	case "p":
+		switch prefix {
+		case "npub":
+			return data.(string), true
+		case "nprofile":
+			return data.(nostr.ProfilePointer).PublicKey, true
+		}
+	case "e", "q":
+		switch prefix {
+		case "note":
+			return data.(string), true
+		case "nevent":
+			return data.(nostr.EventPointer).ID, true
+		}
+	case "a":
+		if prefix == "naddr" {
+			pointer := data.(nostr.EntityPointer)
+			return fmt.Sprintf("%d:%s:%s", pointer.Kind, pointer.PublicKey, pointer.Identifier), true
+		}
+	}
+	return "", false
+}
+
+func isHex(value string) bool {
+	if len(value) != 64 {
+		return false
+	}
+	for _, c := range value {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
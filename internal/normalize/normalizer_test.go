@@ -0,0 +1,89 @@
+package normalize
+
+import (
+	"strings"
+	"testing"
+
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+const (
+	testPubkey = "3bf0c63fcb93463407af97a5e5ee64fa883d107ef9e558472c4eb9aaaefa459d"
+	testID     = "5c83da77af1dec6d7289834998ad7aafbd9e2191396d75ec3cc27f5a77226f36"
+)
+
+func TestValue(t *testing.T) {
+	npub, _ := nip19.EncodePublicKey(testPubkey)
+	note, _ := nip19.EncodeNote(testID)
+	naddr, _ := nip19.EncodeEntity(testPubkey, 30023, "Chapter-One", nil)
+
+	tests := []struct {
+		name     string
+		tag      string
+		value    string
+		expected string
+		rules    []string
+	}{
+		{"Canonical pubkey", "p", testPubkey, testPubkey, nil},
+		{"Uppercase pubkey", "p", strings.ToUpper(testPubkey), testPubkey, []string{RuleLowercase}},
+		{"npub in p tag", "p", npub, testPubkey, []string{RuleBech32}},
+		{"nostr URI in p tag", "p", "nostr:" + npub, testPubkey, []string{RuleNostrURI, RuleBech32}},
+		{"note in e tag", "e", note, testID, []string{RuleBech32}},
+		{"npub in e tag is left alone", "e", npub, npub, nil},
+		{"naddr in a tag", "a", naddr, "30023:" + testPubkey + ":Chapter-One", []string{RuleBech32}},
+		{"Address keeps d tag case", "a", "30023:" + strings.ToUpper(testPubkey) + ":Chapter-One", "30023:" + testPubkey + ":Chapter-One", []string{RuleLowercase}},
+		{"Hashtag", "t", "#Bitcoin", "bitcoin", []string{RuleHashtag}},
+		{"Other tags are untouched", "d", "Chapter-One", "Chapter-One", nil},
+		{"Invalid values are untouched", "p", "nostr:npub1invalid", "npub1invalid", []string{RuleNostrURI}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			value, rules := Value(tt.tag, tt.value)
+			helpers.AssertStringEqual(t, tt.expected, value)
+			helpers.AssertStringEqual(t, strings.Join(tt.rules, ","), strings.Join(rules, ","))
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	n := NewNormalizer()
+	npub, _ := nip19.EncodePublicKey(testPubkey)
+
+	event := &models.Event{
+		Kind: 1,
+		Tags: nostr.Tags{
+			{"p", "nostr:" + npub, "wss://relay.example.com"},
+			{"e", strings.ToUpper(testID)},
+			{"t", "nostr"},
+		},
+	}
+
+	helpers.AssertIntEqual(t, 2, n.Apply(event))
+
+	// The signed tags are preserved
+	helpers.AssertStringEqual(t, "nostr:"+npub, event.Tags[0][1])
+	helpers.AssertStringEqual(t, strings.ToUpper(testID), event.Tags[1][1])
+
+	// Indexing uses the canonical values and keeps extra tag fields
+	tags := event.IndexTags()
+	helpers.AssertStringEqual(t, testPubkey, tags[0][1])
+	helpers.AssertStringEqual(t, "wss://relay.example.com", tags[0][2])
+	helpers.AssertStringEqual(t, testID, tags[1][1])
+	helpers.AssertStringEqual(t, "nostr", tags[2][1])
+
+	clean := &models.Event{Kind: 1, Tags: nostr.Tags{{"p", testPubkey}}}
+	helpers.AssertIntEqual(t, 0, n.Apply(clean))
+	helpers.AssertTrue(t, clean.NormalizedTags == nil)
+
+	stats := n.GetStats()
+	helpers.AssertInt64Equal(t, 1, stats.EventsNormalized)
+	helpers.AssertInt64Equal(t, 2, stats.TagsNormalized)
+	helpers.AssertInt64Equal(t, 1, stats.Rules[RuleNostrURI])
+	helpers.AssertInt64Equal(t, 1, stats.Rules[RuleBech32])
+	helpers.AssertInt64Equal(t, 1, stats.Rules[RuleLowercase])
+}
@@ -0,0 +1,260 @@
+package notice
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"text/template"
+	"time"
+
+	"mercury-relay/internal/config"
+)
+
+// ErrNoticeNotFound is returned when a scheduled notice ID is unknown
+var ErrNoticeNotFound = fmt.Errorf("scheduled notice not found")
+
+// Variables are the relay values available to notice templates, e.g.
+// "Welcome to {{.Host}}, {{.Connections}} users online. Contact: {{.Vars.contact}}"
+type Variables struct {
+	Host        string
+	Port        int
+	Connections int
+	Uptime      time.Duration
+	Now         time.Time
+	Vars        map[string]string
+}
+
+// BroadcastFunc sends a rendered NOTICE to every connection and returns how
+// many connections it reached
+type BroadcastFunc func(message string) int
+
+// Manager renders the welcome NOTICE and broadcasts scheduled notices
+type Manager struct {
+	welcome     *template.Template
+	welcomeText string
+	vars        map[string]string
+	scheduled   map[string]*scheduledNotice
+	nextID      int
+
+	broadcast BroadcastFunc
+	variables func() Variables
+
+	mu sync.RWMutex
+}
+
+type scheduledNotice struct {
+	config.ScheduledNotice
+	template *template.Template
+}
+
+func NewManager(cfg config.NoticeConfig) (*Manager, error) {
+	m := &Manager{
+		vars:      cfg.Variables,
+		scheduled: make(map[string]*scheduledNotice),
+	}
+	if m.vars == nil {
+		m.vars = make(map[string]string)
+	}
+
+	if err := m.SetWelcome(cfg.Welcome); err != nil {
+		return nil, err
+	}
+	for _, n := range cfg.Scheduled {
+		if _, err := m.Schedule(n); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// SetBroadcaster connects the manager to the relay's connections. vars is
+// called each time a notice is rendered.
+func (m *Manager) SetBroadcaster(broadcast BroadcastFunc, vars func() Variables) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.broadcast = broadcast
+	m.variables = vars
+}
+
+// SetWelcome replaces the welcome NOTICE template. An empty message disables it.
+func (m *Manager) SetWelcome(message string) error {
+	var tmpl *template.Template
+	if message != "" {
+		var err error
+		tmpl, err = parse("welcome", message)
+		if err != nil {
+			return err
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.welcome = tmpl
+	m.welcomeText = message
+	return nil
+}
+
+// GetWelcome returns the welcome NOTICE template
+func (m *Manager) GetWelcome() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.welcomeText
+}
+
+// Welcome renders the welcome NOTICE for a new connection. It returns an
+// empty string when no welcome message is configured.
+func (m *Manager) Welcome(vars Variables) (string, error) {
+	m.mu.RLock()
+	tmpl := m.welcome
+	m.mu.RUnlock()
+
+	if tmpl == nil {
+		return "", nil
+	}
+	return m.render(tmpl, vars)
+}
+
+// Schedule adds a notice to be broadcast at n.At. A zero At broadcasts on
+// the next tick.
+func (m *Manager) Schedule(n config.ScheduledNotice) (config.ScheduledNotice, error) {
+	if n.Message == "" {
+		return n, fmt.Errorf("notice message is required")
+	}
+	if n.Repeat < 0 {
+		return n, fmt.Errorf("notice repeat interval must not be negative")
+	}
+
+	tmpl, err := parse("scheduled", n.Message)
+	if err != nil {
+		return n, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if n.ID == "" {
+		m.nextID++
+		n.ID = fmt.Sprintf("notice-%d", m.nextID)
+	}
+	if n.At.IsZero() {
+		n.At = time.Now()
+	}
+	m.scheduled[n.ID] = &scheduledNotice{ScheduledNotice: n, template: tmpl}
+	return n, nil
+}
+
+// Cancel removes a scheduled notice
+func (m *Manager) Cancel(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.scheduled[id]; !exists {
+		return fmt.Errorf("%w: %s", ErrNoticeNotFound, id)
+	}
+	delete(m.scheduled, id)
+	return nil
+}
+
+// List returns the pending scheduled notices ordered by next delivery time
+func (m *Manager) List() []config.ScheduledNotice {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	notices := make([]config.ScheduledNotice, 0, len(m.scheduled))
+	for _, n := range m.scheduled {
+		notices = append(notices, n.ScheduledNotice)
+	}
+	sort.Slice(notices, func(i, j int) bool {
+		return notices[i].At.Before(notices[j].At)
+	})
+	return notices
+}
+
+// Run broadcasts scheduled notices as they come due until ctx is cancelled
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			m.deliverDue(now)
+		}
+	}
+}
+
+// deliverDue broadcasts every notice due at or before now, then reschedules
+// repeating notices and drops one-shot ones
+func (m *Manager) deliverDue(now time.Time) {
+	m.mu.Lock()
+	broadcast := m.broadcast
+	var due []*scheduledNotice
+	for id, n := range m.scheduled {
+		if n.At.After(now) {
+			continue
+		}
+		due = append(due, n)
+		if n.Repeat > 0 {
+			for !n.At.After(now) {
+				n.At = n.At.Add(n.Repeat)
+			}
+		} else {
+			delete(m.scheduled, id)
+		}
+	}
+	m.mu.Unlock()
+
+	if broadcast == nil {
+		return
+	}
+
+	for _, n := range due {
+		message, err := m.render(n.template, m.currentVariables())
+		if err != nil {
+			log.Printf("Failed to render scheduled notice %s: %v", n.ID, err)
+			continue
+		}
+		sent := broadcast(message)
+		log.Printf("Broadcast scheduled notice %s to %d connection(s)", n.ID, sent)
+	}
+}
+
+func (m *Manager) currentVariables() Variables {
+	m.mu.RLock()
+	variables := m.variables
+	m.mu.RUnlock()
+
+	if variables == nil {
+		return Variables{Now: time.Now()}
+	}
+	return variables()
+}
+
+func (m *Manager) render(tmpl *template.Template, vars Variables) (string, error) {
+	if vars.Vars == nil {
+		vars.Vars = m.vars
+	}
+	if vars.Now.IsZero() {
+		vars.Now = time.Now()
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, vars); err != nil {
+		return "", fmt.Errorf("failed to render notice: %w", err)
+	}
+	return buf.String(), nil
+}
+
+func parse(name, message string) (*template.Template, error) {
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(message)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notice template: %w", err)
+	}
+	return tmpl, nil
+}
@@ -0,0 +1,97 @@
+package notice
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/config"
+)
+
+func TestWelcomeNotice(t *testing.T) {
+	m, err := NewManager(config.NoticeConfig{
+		Welcome:   "Welcome to {{.Host}} ({{.Connections}} online). Contact {{.Vars.contact}}{{.Vars.missing}}",
+		Variables: map[string]string{"contact": "admin@example.com"},
+	})
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	message, err := m.Welcome(Variables{Host: "relay.example.com", Connections: 3})
+	if err != nil {
+		t.Fatalf("Welcome failed: %v", err)
+	}
+	expected := "Welcome to relay.example.com (3 online). Contact admin@example.com"
+	if message != expected {
+		t.Errorf("Expected %q, got %q", expected, message)
+	}
+
+	if err := m.SetWelcome(""); err != nil {
+		t.Fatalf("SetWelcome failed: %v", err)
+	}
+	if message, _ := m.Welcome(Variables{}); message != "" {
+		t.Errorf("Expected no welcome after clearing it, got %q", message)
+	}
+
+	if err := m.SetWelcome("{{.Host"); err == nil {
+		t.Error("Expected invalid template to be rejected")
+	}
+}
+
+func TestScheduledNotices(t *testing.T) {
+	m, err := NewManager(config.NoticeConfig{})
+	if err != nil {
+		t.Fatalf("NewManager failed: %v", err)
+	}
+
+	var sent []string
+	m.SetBroadcaster(func(message string) int {
+		sent = append(sent, message)
+		return 1
+	}, func() Variables {
+		return Variables{Host: "relay"}
+	})
+
+	now := time.Now()
+	once, err := m.Schedule(config.ScheduledNotice{Message: "maintenance on {{.Host}}", At: now})
+	if err != nil {
+		t.Fatalf("Schedule failed: %v", err)
+	}
+	if once.ID == "" {
+		t.Fatal("Expected an ID to be assigned")
+	}
+	if _, err := m.Schedule(config.ScheduledNotice{ID: "daily", Message: "daily", At: now, Repeat: 24 * time.Hour}); err != nil {
+		t.Fatalf("Schedule failed: %v", err)
+	}
+	if _, err := m.Schedule(config.ScheduledNotice{ID: "later", Message: "later", At: now.Add(time.Hour)}); err != nil {
+		t.Fatalf("Schedule failed: %v", err)
+	}
+
+	m.deliverDue(now)
+
+	if len(sent) != 2 {
+		t.Fatalf("Expected 2 notices broadcast, got %d: %v", len(sent), sent)
+	}
+
+	pending := m.List()
+	if len(pending) != 2 {
+		t.Fatalf("Expected 2 pending notices, got %d", len(pending))
+	}
+	if pending[0].ID != "later" || pending[1].ID != "daily" {
+		t.Errorf("Unexpected pending order: %v", pending)
+	}
+	if !pending[1].At.Equal(now.Add(24 * time.Hour)) {
+		t.Errorf("Expected repeating notice to be rescheduled a day later, got %v", pending[1].At)
+	}
+
+	if err := m.Cancel("later"); err != nil {
+		t.Errorf("Cancel failed: %v", err)
+	}
+	if err := m.Cancel("later"); !errors.Is(err, ErrNoticeNotFound) {
+		t.Errorf("Expected ErrNoticeNotFound, got %v", err)
+	}
+
+	if _, err := m.Schedule(config.ScheduledNotice{}); err == nil {
+		t.Error("Expected empty message to be rejected")
+	}
+}
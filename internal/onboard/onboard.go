@@ -0,0 +1,453 @@
+// Package onboard is the setup wizard behind `mercury init`. It asks a new
+// operator for the few settings that differ between deployments, renders a
+// commented config file from the answers and prepares what the relay needs
+// on disk: data directories, the relay's identity key and, optionally, a
+// self-signed TLS certificate.
+package onboard
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/identity"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// ErrExists is returned when the config file would be overwritten
+var ErrExists = fmt.Errorf("config file already exists")
+
+// Cache backends offered by the wizard
+const (
+	CacheMemory = "memory"
+	CacheRedis  = "redis"
+)
+
+// Answers are the operator's choices
+type Answers struct {
+	OwnerNpub string
+	Profile   string // "" for none
+	Host      string
+	Port      int
+	RESTPort  int // 0 disables the REST API
+	GRPCPort  int // 0 disables gRPC
+	Cache     string
+	RedisHost string
+	DataDir   string
+	// XFTP keeps events in XFTP storage under DataDir, otherwise they are
+	// kept in the file storage backend there
+	XFTP       bool
+	XFTPServer string
+	Tor        bool
+	I2P        bool
+	SSH        bool
+	Trending   bool
+	Search     bool
+	Live       bool
+	// TLS provisions a self-signed certificate for TLSHosts, used by gRPC
+	TLS      bool
+	TLSHosts []string
+}
+
+// Defaults are the answers offered when the operator just presses enter
+func Defaults() Answers {
+	return Answers{
+		Host:       "0.0.0.0",
+		Port:       8080,
+		RESTPort:   8082,
+		Cache:      CacheMemory,
+		RedisHost:  "localhost:6379",
+		DataDir:    "./data",
+		XFTPServer: "xftp://localhost:443",
+		Trending:   true,
+		Search:     true,
+		TLSHosts:   []string{"localhost"},
+	}
+}
+
+// Paths of the files the relay keeps under the data directory
+func (a Answers) KeyPath() string  { return filepath.Join(a.DataDir, "relay.key") }
+func (a Answers) CertFile() string { return filepath.Join(a.DataDir, "tls", "cert.pem") }
+func (a Answers) KeyFile() string  { return filepath.Join(a.DataDir, "tls", "key.pem") }
+
+// Prompter asks questions on a terminal
+type Prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// NewPrompter reads answers from in and writes questions to out
+func NewPrompter(in io.Reader, out io.Writer) *Prompter {
+	return &Prompter{in: bufio.NewReader(in), out: out}
+}
+
+// Ask returns the line typed, or def for an empty one
+func (p *Prompter) Ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	line, err := p.in.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", fmt.Errorf("no answer to %q: %w", question, err)
+	}
+	if line = strings.TrimSpace(line); line == "" {
+		return def, nil
+	}
+	return line, nil
+}
+
+// Confirm asks a yes/no question
+func (p *Prompter) Confirm(question string, def bool) (bool, error) {
+	hint := "y/N"
+	if def {
+		hint = "Y/n"
+	}
+	for {
+		answer, err := p.Ask(question+" ("+hint+")", "")
+		if err != nil {
+			return false, err
+		}
+		switch strings.ToLower(answer) {
+		case "":
+			return def, nil
+		case "y", "yes":
+			return true, nil
+		case "n", "no":
+			return false, nil
+		}
+		fmt.Fprintln(p.out, "  Please answer y or n.")
+	}
+}
+
+// Choose asks for one of options
+func (p *Prompter) Choose(question string, options []string, def string) (string, error) {
+	for {
+		answer, err := p.Ask(question+" ("+strings.Join(options, ", ")+")", def)
+		if err != nil {
+			return "", err
+		}
+		for _, option := range options {
+			if answer == option {
+				return answer, nil
+			}
+		}
+		fmt.Fprintf(p.out, "  Please choose one of: %s\n", strings.Join(options, ", "))
+	}
+}
+
+// port asks for a TCP port; 0 is accepted when optional
+func (p *Prompter) port(question string, def int, optional bool) (int, error) {
+	for {
+		answer, err := p.Ask(question, strconv.Itoa(def))
+		if err != nil {
+			return 0, err
+		}
+		n, err := strconv.Atoi(answer)
+		if err == nil && (n > 0 && n <= 65535 || optional && n == 0) {
+			return n, nil
+		}
+		fmt.Fprintln(p.out, "  Please enter a port between 1 and 65535.")
+	}
+}
+
+// ParseOwner accepts the owner's key as npub or hex and returns the npub
+func ParseOwner(key string) (string, error) {
+	key = strings.TrimSpace(key)
+	if strings.HasPrefix(key, "npub") {
+		if prefix, _, err := nip19.Decode(key); err == nil && prefix == "npub" {
+			return key, nil
+		}
+	} else if nostr.IsValidPublicKey(key) {
+		return nip19.EncodePublicKey(strings.ToLower(key))
+	}
+	return "", fmt.Errorf("%q is not an npub or hex public key", key)
+}
+
+// Interview asks for every answer, starting from Defaults
+func Interview(p *Prompter) (Answers, error) {
+	a := Defaults()
+	var err error
+
+	for a.OwnerNpub == "" {
+		owner, err := p.Ask("Owner npub (your own key; the owner administers the relay)", "")
+		if err != nil {
+			return a, err
+		}
+		if a.OwnerNpub, err = ParseOwner(owner); err != nil {
+			fmt.Fprintf(p.out, "  %v\n", err)
+		}
+	}
+
+	profiles := []string{"none"}
+	for _, profile := range config.Profiles() {
+		profiles = append(profiles, profile.Name)
+	}
+	if a.Profile, err = p.Choose("Deployment profile", profiles, "none"); err != nil {
+		return a, err
+	}
+	if a.Profile == "none" {
+		a.Profile = ""
+	}
+
+	if a.Host, err = p.Ask("Listen address", a.Host); err != nil {
+		return a, err
+	}
+	if a.Port, err = p.port("Relay WebSocket port", a.Port, false); err != nil {
+		return a, err
+	}
+	if a.RESTPort, err = p.port("REST API port (0 disables it)", a.RESTPort, true); err != nil {
+		return a, err
+	}
+	if a.GRPCPort, err = p.port("gRPC port (0 disables it)", a.GRPCPort, true); err != nil {
+		return a, err
+	}
+
+	if a.Cache, err = p.Choose("Event cache backend", []string{CacheMemory, CacheRedis}, a.Cache); err != nil {
+		return a, err
+	}
+	if a.Cache == CacheRedis {
+		if a.RedisHost, err = p.Ask("Redis address", a.RedisHost); err != nil {
+			return a, err
+		}
+	}
+	if a.DataDir, err = p.Ask("Data directory", a.DataDir); err != nil {
+		return a, err
+	}
+	a.DataDir = filepath.Clean(a.DataDir)
+	if a.XFTP, err = p.Confirm("Keep events in XFTP storage", a.XFTP); err != nil {
+		return a, err
+	}
+	if a.XFTP {
+		if a.XFTPServer, err = p.Ask("XFTP server", a.XFTPServer); err != nil {
+			return a, err
+		}
+	}
+
+	subsystems := []struct {
+		question string
+		answer   *bool
+	}{
+		{"Serve over Tor", &a.Tor},
+		{"Serve over I2P", &a.I2P},
+		{"Offer SSH tunnels", &a.SSH},
+		{"Rank trending content", &a.Trending},
+		{"Index events for full-text search", &a.Search},
+		{"Track NIP-53 live streams", &a.Live},
+	}
+	for _, s := range subsystems {
+		if *s.answer, err = p.Confirm(s.question, *s.answer); err != nil {
+			return a, err
+		}
+	}
+
+	if a.GRPCPort > 0 {
+		if a.TLS, err = p.Confirm("Generate a self-signed TLS certificate for gRPC", a.TLS); err != nil {
+			return a, err
+		}
+		if a.TLS {
+			hosts, err := p.Ask("Certificate host names, comma separated", strings.Join(a.TLSHosts, ","))
+			if err != nil {
+				return a, err
+			}
+			a.TLSHosts = nil
+			for _, host := range strings.Split(hosts, ",") {
+				if host = strings.TrimSpace(host); host != "" {
+					a.TLSHosts = append(a.TLSHosts, host)
+				}
+			}
+		}
+	}
+	return a, nil
+}
+
+var configTemplate = template.Must(template.New("config").Funcs(template.FuncMap{"quote": strconv.Quote}).Parse(
+	`# Mercury Relay configuration generated by mercury init. Everything not set
+# here takes its default; see docs/configuration.md for every setting.
+{{- if .Profile}}
+
+# Preset applied under this file (see mercury profiles)
+profile: {{quote .Profile}}
+{{- end}}
+
+server:
+  host: {{quote .Host}}
+  port: {{.Port}}
+
+# The first admin npub is the relay owner
+access:
+  admin_npubs:
+    - {{quote .OwnerNpub}}
+  writers_path: {{quote (print .DataDir "/writers.json")}}
+
+admin:
+  annotations_path: {{quote (print .DataDir "/annotations.json")}}
+
+# The relay's own key, generated by mercury init
+identity:
+  key_path: {{quote .KeyPath}}
+
+cache:
+  backend: {{quote .Cache}}
+{{- if eq .Cache "redis"}}
+
+redis:
+  host: {{quote .RedisHost}}
+{{- end}}
+
+# A single relay queues events in process; spilled events survive restarts
+queue:
+  backend: memory
+  overflow: spill
+  spill_path: {{quote (print .DataDir "/queue-spill.jsonl")}}
+
+xftp:
+  enabled: {{.XFTP}}
+{{- if .XFTP}}
+  server_url: {{quote .XFTPServer}}
+  storage_dir: {{quote (print .DataDir "/xftp")}}
+{{- else}}
+
+# Without XFTP, events are kept in an event log under the data directory
+storage:
+  backend: file
+  path: {{quote (print .DataDir "/events")}}
+{{- end}}
+
+rest_api:
+  enabled: {{gt .RESTPort 0}}
+{{- if gt .RESTPort 0}}
+  port: {{.RESTPort}}
+{{- end}}
+
+grpc:
+  enabled: {{gt .GRPCPort 0}}
+{{- if gt .GRPCPort 0}}
+  server_host: {{quote .Host}}
+  server_port: {{.GRPCPort}}
+  tls_enabled: {{.TLS}}
+{{- if .TLS}}
+  cert_file: {{quote .CertFile}}
+  key_file: {{quote .KeyFile}}
+{{- end}}
+{{- end}}
+
+tor:
+  enabled: {{.Tor}}
+
+i2p:
+  enabled: {{.I2P}}
+
+ssh:
+  enabled: {{.SSH}}
+{{- if .SSH}}
+  key_storage:
+    key_dir: {{quote (print .DataDir "/ssh-keys")}}
+{{- end}}
+
+trending:
+  enabled: {{.Trending}}
+
+search:
+  enabled: {{.Search}}
+
+live:
+  enabled: {{.Live}}
+`))
+
+// Render returns the config file for a
+func Render(a Answers) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := configTemplate.Execute(&buf, a); err != nil {
+		return nil, fmt.Errorf("failed to render config: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// directory is a data directory and the permissions it gets
+type directory struct {
+	path string
+	mode os.FileMode
+}
+
+// Result is what Apply set up
+type Result struct {
+	ConfigPath  string
+	RelayNpub   string
+	Directories []string
+	CertFile    string
+}
+
+// Apply writes the config file for a to path, refusing to replace an
+// existing one unless force is set, and prepares the data directory, the
+// relay key and the TLS certificate
+func Apply(a Answers, path string, force bool) (*Result, error) {
+	data, err := Render(a)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &Result{ConfigPath: path}
+	dirs := []directory{{a.DataDir, 0750}}
+	if a.XFTP {
+		dirs = append(dirs, directory{filepath.Join(a.DataDir, "xftp"), 0750})
+	} else {
+		dirs = append(dirs, directory{filepath.Join(a.DataDir, "events"), 0750})
+	}
+	if a.SSH {
+		dirs = append(dirs, directory{filepath.Join(a.DataDir, "ssh-keys"), 0700})
+	}
+	for _, dir := range dirs {
+		if err := os.MkdirAll(dir.path, dir.mode); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", dir.path, err)
+		}
+		// MkdirAll leaves existing directories as they are
+		if err := os.Chmod(dir.path, dir.mode); err != nil {
+			return nil, fmt.Errorf("failed to set permissions on %s: %w", dir.path, err)
+		}
+		result.Directories = append(result.Directories, dir.path)
+	}
+
+	id, err := identity.Load(config.IdentityConfig{KeyPath: a.KeyPath()})
+	if err != nil {
+		return nil, err
+	}
+	result.RelayNpub = id.Npub()
+
+	if a.TLS && a.GRPCPort > 0 {
+		if err := GenerateCertificate(a.CertFile(), a.KeyFile(), a.TLSHosts); err != nil {
+			return nil, err
+		}
+		result.CertFile = a.CertFile()
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+	file, err := os.OpenFile(path, flags, 0640)
+	if os.IsExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrExists, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := file.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return result, nil
+}
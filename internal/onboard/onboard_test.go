@@ -0,0 +1,121 @@
+package onboard
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+func ownerKey(t *testing.T) (string, string) {
+	t.Helper()
+	pk, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	npub, err := nip19.EncodePublicKey(pk)
+	helpers.AssertNoError(t, err)
+	return pk, npub
+}
+
+func TestInterview(t *testing.T) {
+	pk, npub := ownerKey(t)
+	dataDir := filepath.Join(t.TempDir(), "data")
+	input := strings.Join([]string{
+		"npub1nonsense", // re-asked
+		pk,              // hex is converted to an npub
+		"library",
+		"",      // listen address
+		"99999", // re-asked
+		"7777",
+		"0", // no REST API
+		"9090",
+		"redis",
+		"redis.internal:6379",
+		dataDir,
+		"y", "", // XFTP with the default server
+		"n", "maybe", "n", "y", "", "", "yes",
+		"y", "relay.example.com, 10.0.0.5",
+	}, "\n") + "\n"
+	var out bytes.Buffer
+	a, err := Interview(NewPrompter(strings.NewReader(input), &out))
+	helpers.AssertNoError(t, err)
+
+	helpers.AssertStringEqual(t, npub, a.OwnerNpub)
+	helpers.AssertStringEqual(t, "library", a.Profile)
+	helpers.AssertStringEqual(t, "0.0.0.0", a.Host)
+	helpers.AssertIntEqual(t, 7777, a.Port)
+	helpers.AssertIntEqual(t, 0, a.RESTPort)
+	helpers.AssertIntEqual(t, 9090, a.GRPCPort)
+	helpers.AssertStringEqual(t, "redis.internal:6379", a.RedisHost)
+	helpers.AssertStringEqual(t, dataDir, a.DataDir)
+	helpers.AssertTrue(t, a.XFTP)
+	helpers.AssertStringEqual(t, "xftp://localhost:443", a.XFTPServer)
+	helpers.AssertFalse(t, a.Tor)
+	helpers.AssertFalse(t, a.I2P)
+	helpers.AssertTrue(t, a.SSH)
+	helpers.AssertTrue(t, a.Trending && a.Search && a.Live)
+	helpers.AssertTrue(t, a.TLS)
+	helpers.AssertEqual(t, "[relay.example.com 10.0.0.5]", fmt.Sprint(a.TLSHosts))
+	helpers.AssertStringContains(t, out.String(), "is not an npub or hex public key")
+	helpers.AssertStringContains(t, out.String(), "Please enter a port")
+	helpers.AssertStringContains(t, out.String(), "Please answer y or n")
+
+	// Input that ends early is an error, not a half-answered config
+	_, err = Interview(NewPrompter(strings.NewReader(npub+"\n"), &out))
+	helpers.AssertErrorContains(t, err, "no answer")
+}
+
+func TestApply(t *testing.T) {
+	_, npub := ownerKey(t)
+	dir := t.TempDir()
+	a := Defaults()
+	a.OwnerNpub = npub
+	a.Profile = "community"
+	a.DataDir = filepath.Join(dir, "data")
+	a.GRPCPort = 9090
+	a.TLS = true
+	a.SSH = true
+	a.Live = true
+	path := filepath.Join(dir, "config.yaml")
+
+	result, err := Apply(a, path, false)
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, strings.HasPrefix(result.RelayNpub, "npub1"))
+
+	// The generated file loads and validates with the answers in place
+	cfg, err := config.Load(path)
+	helpers.AssertNoError(t, err)
+	helpers.AssertNoError(t, cfg.Validate())
+	helpers.AssertStringEqual(t, "community", cfg.Profile)
+	helpers.AssertStringEqual(t, npub, cfg.Access.AdminNpubs[0])
+	helpers.AssertStringEqual(t, a.KeyPath(), cfg.Identity.KeyPath)
+	helpers.AssertStringEqual(t, "memory", cfg.Cache.Backend)
+	helpers.AssertStringEqual(t, "memory", cfg.Queue.Backend)
+	helpers.AssertTrue(t, cfg.Access.WriterApproval)
+	helpers.AssertTrue(t, cfg.Live.Enabled)
+	helpers.AssertTrue(t, cfg.GRPC.TLSEnabled)
+	_, err = tls.LoadX509KeyPair(cfg.GRPC.CertFile, cfg.GRPC.KeyFile)
+	helpers.AssertNoError(t, err)
+
+	// Secrets are kept from other users
+	for path, mode := range map[string]os.FileMode{a.KeyPath(): 0600, a.KeyFile(): 0600, a.DataDir: 0750, filepath.Join(a.DataDir, "ssh-keys"): 0700} {
+		info, err := os.Stat(path)
+		helpers.AssertNoError(t, err)
+		helpers.AssertEqual(t, mode, info.Mode().Perm())
+	}
+
+	// An existing config is only replaced when forced, keeping the key
+	_, err = Apply(a, path, false)
+	helpers.AssertTrue(t, errors.Is(err, ErrExists))
+	again, err := Apply(a, path, true)
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, result.RelayNpub, again.RelayNpub)
+}
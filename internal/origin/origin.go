@@ -0,0 +1,85 @@
+package origin
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Checker decides whether a browser request's Origin may use the relay's
+// WebSocket and browser form endpoints
+type Checker struct {
+	allowAll       bool
+	exact          map[string]bool
+	wildcards      []string // "https://.example.com" for "https://*.example.com"
+	trustForwarded bool
+}
+
+// NewChecker allows the listed origins, such as "https://app.example.com"
+// or "https://*.example.com", plus the relay's own origin. An empty list or
+// "*" allows every origin. With trustForwarded the relay's own host is
+// taken from X-Forwarded-Host, for relays behind a reverse proxy.
+func NewChecker(allowed []string, trustForwarded bool) *Checker {
+	c := &Checker{
+		allowAll:       len(allowed) == 0,
+		exact:          make(map[string]bool),
+		trustForwarded: trustForwarded,
+	}
+	for _, entry := range allowed {
+		entry = strings.ToLower(strings.TrimRight(strings.TrimSpace(entry), "/"))
+		switch {
+		case entry == "*":
+			c.allowAll = true
+		case strings.Contains(entry, "://*."):
+			c.wildcards = append(c.wildcards, strings.Replace(entry, "://*.", "://.", 1))
+		case entry != "":
+			c.exact[entry] = true
+		}
+	}
+	return c
+}
+
+// Check reports whether req may proceed. Requests without an Origin header
+// don't come from a browser page and are allowed.
+func (c *Checker) Check(req *http.Request) bool {
+	if c == nil || c.allowAll {
+		return true
+	}
+	header := req.Header.Get("Origin")
+	if header == "" {
+		return true
+	}
+	if header == "null" {
+		return false
+	}
+	u, err := url.Parse(header)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	origin := strings.ToLower(u.Scheme + "://" + u.Host)
+
+	if strings.EqualFold(u.Host, c.host(req)) {
+		return true
+	}
+	if c.exact[origin] {
+		return true
+	}
+	for _, suffix := range c.wildcards {
+		scheme, domain, _ := strings.Cut(suffix, "://")
+		if u.Scheme == scheme && strings.HasSuffix(strings.ToLower(u.Host), domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// host is the host the client addressed, as seen through a trusted proxy
+func (c *Checker) host(req *http.Request) string {
+	if c.trustForwarded {
+		if forwarded := req.Header.Get("X-Forwarded-Host"); forwarded != "" {
+			host, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(host)
+		}
+	}
+	return req.Host
+}
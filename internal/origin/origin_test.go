@@ -0,0 +1,55 @@
+package origin
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"mercury-relay/test/helpers"
+)
+
+func TestChecker(t *testing.T) {
+	check := func(c *Checker, host, origin string, headers ...string) bool {
+		req := httptest.NewRequest("GET", "http://"+host+"/", nil)
+		if origin != "" {
+			req.Header.Set("Origin", origin)
+		}
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		return c.Check(req)
+	}
+
+	t.Run("Empty list allows every origin", func(t *testing.T) {
+		c := NewChecker(nil, false)
+		helpers.AssertTrue(t, check(c, "relay.example.com", "https://evil.example.net"))
+	})
+
+	t.Run("Allow-list", func(t *testing.T) {
+		c := NewChecker([]string{"https://app.example.com/", "https://*.nostr.example"}, false)
+
+		helpers.AssertTrue(t, check(c, "relay.example.com", ""))
+		helpers.AssertTrue(t, check(c, "relay.example.com", "https://relay.example.com"))
+		helpers.AssertTrue(t, check(c, "relay.example.com", "https://app.example.com"))
+		helpers.AssertTrue(t, check(c, "relay.example.com", "https://web.nostr.example"))
+		helpers.AssertFalse(t, check(c, "relay.example.com", "http://app.example.com"))
+		helpers.AssertFalse(t, check(c, "relay.example.com", "https://evil.example.net"))
+		helpers.AssertFalse(t, check(c, "relay.example.com", "https://evilnostr.example"))
+		helpers.AssertFalse(t, check(c, "relay.example.com", "null"))
+	})
+
+	t.Run("Star allows every origin", func(t *testing.T) {
+		c := NewChecker([]string{"https://app.example.com", "*"}, false)
+		helpers.AssertTrue(t, check(c, "relay.example.com", "https://evil.example.net"))
+	})
+
+	t.Run("Forwarded host", func(t *testing.T) {
+		proxied := []string{"X-Forwarded-Host", "relay.example.com"}
+
+		c := NewChecker([]string{"https://app.example.com"}, false)
+		helpers.AssertFalse(t, check(c, "127.0.0.1:8080", "https://relay.example.com", proxied...))
+
+		c = NewChecker([]string{"https://app.example.com"}, true)
+		helpers.AssertTrue(t, check(c, "127.0.0.1:8080", "https://relay.example.com", proxied...))
+		helpers.AssertFalse(t, check(c, "127.0.0.1:8080", "https://127.0.0.1:8080", proxied...))
+	})
+}
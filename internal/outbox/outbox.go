@@ -0,0 +1,346 @@
+// Package outbox republishes events by the relay owner and a list of
+// authors to external relays, NIP-65 outbox style. Each relay has its own
+// queue: a relay that is down backs off exponentially and keeps the newest
+// events until it comes back, without holding up the others.
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/mirror"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Relay sources in the status
+const (
+	SourceConfigured = "configured" // outbox.relays
+	SourceRelayList  = "relay_list" // a write relay from the owner's NIP-65 list
+)
+
+// maxBatch is how many events are published per connection
+const maxBatch = 100
+
+// Publisher sends events to a relay and returns how many it accepted
+// before the first failure
+type Publisher interface {
+	Publish(ctx context.Context, url string, events []*nostr.Event) (int, error)
+}
+
+// RelayStatus is the delivery state of one outbox relay
+type RelayStatus struct {
+	URL           string     `json:"url"`
+	Source        string     `json:"source"`
+	Published     int64      `json:"published"`
+	Dropped       int64      `json:"dropped"`
+	Pending       int        `json:"pending"`
+	Failures      int        `json:"failures"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastPublished *time.Time `json:"last_published,omitempty"`
+	NextAttempt   *time.Time `json:"next_attempt,omitempty"`
+}
+
+// target is an outbox relay with the events waiting for it
+type target struct {
+	status  RelayStatus
+	pending []*models.Event
+	sending bool
+}
+
+// Outbox queues owned events for the outbox relays and publishes them
+type Outbox struct {
+	config  config.OutboxConfig
+	authors map[string]bool
+
+	mu         sync.Mutex
+	targets    map[string]*target
+	relayList  nostr.Timestamp // created_at of the relay list applied
+	isOwner    func(pubkey string) bool
+	publisher  Publisher
+	now        func() time.Time
+	retryDelay time.Duration // first backoff step
+}
+
+// NewOutbox returns an outbox publishing to the configured relays
+func NewOutbox(cfg config.OutboxConfig) (*Outbox, error) {
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Hour
+	}
+	if cfg.MaxPending <= 0 {
+		cfg.MaxPending = 1000
+	}
+
+	o := &Outbox{
+		config:     cfg,
+		authors:    make(map[string]bool),
+		targets:    make(map[string]*target),
+		isOwner:    func(string) bool { return false },
+		publisher:  NewRelayPublisher(cfg.Timeout),
+		now:        time.Now,
+		retryDelay: 10 * time.Second,
+	}
+	for _, author := range cfg.Authors {
+		pubkey, err := mirror.ParsePubkey(author)
+		if err != nil {
+			return nil, err
+		}
+		o.authors[pubkey] = true
+	}
+	for _, relay := range cfg.Relays {
+		url := nostr.NormalizeURL(relay)
+		if url == "" {
+			return nil, fmt.Errorf("invalid outbox relay %q", relay)
+		}
+		o.targets[url] = &target{status: RelayStatus{URL: url, Source: SourceConfigured}}
+	}
+	return o, nil
+}
+
+// SetOwner tells the outbox whose events belong to the relay owner
+func (o *Outbox) SetOwner(isOwner func(pubkey string) bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.isOwner = isOwner
+}
+
+// SetPublisher replaces how events are sent to relays
+func (o *Outbox) SetPublisher(publisher Publisher) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.publisher = publisher
+}
+
+// IsOwned reports whether events by pubkey are republished
+func (o *Outbox) IsOwned(pubkey string) bool {
+	o.mu.Lock()
+	isOwner := o.isOwner
+	o.mu.Unlock()
+	return o.authors[pubkey] || isOwner(pubkey)
+}
+
+// Push queues event for every outbox relay if an owned author signed it.
+// Quarantined and ephemeral events stay here, and no event is sent back to
+// a relay it was fetched from. An owner's relay list also updates the
+// relay-list relays when UseRelayList is set.
+func (o *Outbox) Push(event *models.Event) {
+	if event.IsQuarantined || event.Offloaded || (event.Kind >= 20000 && event.Kind < 30000) {
+		return
+	}
+	if !o.IsOwned(event.PubKey) {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.config.UseRelayList && event.Kind == mirror.KindRelayList && o.isOwner(event.PubKey) {
+		o.applyRelayListLocked(event)
+	}
+
+	for url, t := range o.targets {
+		if fetchedFrom(event, url) {
+			continue
+		}
+		t.pending = append(t.pending, event)
+		// Keep the newest events while the relay is down
+		if over := len(t.pending) - o.config.MaxPending; over > 0 {
+			t.pending = t.pending[over:]
+			t.status.Dropped += int64(over)
+		}
+	}
+}
+
+// applyRelayListLocked replaces the relay-list relays with the write relays
+// of list, unless a newer list was applied. Callers must hold o.mu.
+func (o *Outbox) applyRelayListLocked(list *models.Event) {
+	if list.CreatedAt < o.relayList {
+		return
+	}
+	o.relayList = list.CreatedAt
+
+	write := make(map[string]bool)
+	for _, tag := range list.Tags {
+		if len(tag) < 2 || tag[0] != "r" || (len(tag) >= 3 && tag[2] == "read") {
+			continue
+		}
+		if url := nostr.NormalizeURL(tag[1]); url != "" {
+			write[url] = true
+		}
+	}
+
+	for url, t := range o.targets {
+		if t.status.Source == SourceRelayList && !write[url] {
+			delete(o.targets, url)
+		}
+	}
+	for url := range write {
+		if _, ok := o.targets[url]; !ok {
+			o.targets[url] = &target{status: RelayStatus{URL: url, Source: SourceRelayList}}
+		}
+	}
+	log.Printf("Outbox relays updated from relay list: %d write relay(s)", len(write))
+}
+
+// Status returns the state of every outbox relay, sorted by URL
+func (o *Outbox) Status() []RelayStatus {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	statuses := make([]RelayStatus, 0, len(o.targets))
+	for _, t := range o.targets {
+		status := t.status
+		status.Pending = len(t.pending)
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].URL < statuses[j].URL })
+	return statuses
+}
+
+// Retry clears the backoff of every relay so pending events go out on the
+// next flush
+func (o *Outbox) Retry() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, t := range o.targets {
+		t.status.NextAttempt = nil
+	}
+}
+
+// Run publishes pending events every second until ctx is done
+func (o *Outbox) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			o.flush(ctx)
+		}
+	}
+}
+
+// flush starts publishing to every relay with pending events that is not
+// already sending or backing off
+func (o *Outbox) flush(ctx context.Context) {
+	now := o.now()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for url, t := range o.targets {
+		if t.sending || len(t.pending) == 0 {
+			continue
+		}
+		if t.status.NextAttempt != nil && now.Before(*t.status.NextAttempt) {
+			continue
+		}
+		batch := t.pending[:min(len(t.pending), maxBatch)]
+		t.sending = true
+		go o.deliver(ctx, url, t, batch)
+	}
+}
+
+// deliver publishes batch to url and records the outcome. Events accepted
+// before a failure are not sent again.
+func (o *Outbox) deliver(ctx context.Context, url string, t *target, batch []*models.Event) {
+	events := make([]*nostr.Event, len(batch))
+	for i, event := range batch {
+		events[i] = event.ToNostrEvent()
+	}
+
+	o.mu.Lock()
+	publisher := o.publisher
+	o.mu.Unlock()
+	published, err := publisher.Publish(ctx, url, events)
+	now := o.now().UTC()
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	t.sending = false
+
+	sent := make(map[*models.Event]bool, published)
+	for _, event := range batch[:published] {
+		sent[event] = true
+	}
+	// The batch may have been trimmed from the front while sending
+	remaining := t.pending[:0]
+	for _, event := range t.pending {
+		if !sent[event] {
+			remaining = append(remaining, event)
+		}
+	}
+	t.pending = remaining
+	t.status.Published += int64(published)
+	if published > 0 {
+		t.status.LastPublished = &now
+	}
+
+	if err != nil {
+		t.status.Failures++
+		t.status.LastError = err.Error()
+		next := now.Add(o.backoff(t.status.Failures))
+		t.status.NextAttempt = &next
+		log.Printf("Outbox publish to %s failed: %v", url, err)
+		return
+	}
+	t.status.Failures = 0
+	t.status.LastError = ""
+	t.status.NextAttempt = nil
+}
+
+// backoff doubles the retry delay with every consecutive failure
+func (o *Outbox) backoff(failures int) time.Duration {
+	delay := o.retryDelay
+	for i := 1; i < failures && delay < o.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, o.config.MaxBackoff)
+}
+
+// fetchedFrom reports whether event was streamed or mirrored from url
+func fetchedFrom(event *models.Event, url string) bool {
+	for _, p := range event.Provenance {
+		if (p.Source == models.ProvenanceUpstream || p.Source == models.ProvenanceMirror) &&
+			nostr.NormalizeURL(p.Detail) == url {
+			return true
+		}
+	}
+	return false
+}
+
+// relayPublisher publishes over a fresh WebSocket connection each time
+type relayPublisher struct {
+	timeout time.Duration
+}
+
+// NewRelayPublisher publishes over WebSocket, giving up on a relay after
+// timeout
+func NewRelayPublisher(timeout time.Duration) Publisher {
+	return &relayPublisher{timeout: timeout}
+}
+
+func (p *relayPublisher) Publish(ctx context.Context, url string, events []*nostr.Event) (int, error) {
+	if p.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.timeout)
+		defer cancel()
+	}
+
+	relay, err := nostr.RelayConnect(ctx, url)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer relay.Close()
+
+	for i, event := range events {
+		if err := relay.Publish(ctx, *event); err != nil {
+			return i, fmt.Errorf("event %s: %w", event.ID, err)
+		}
+	}
+	return len(events), nil
+}
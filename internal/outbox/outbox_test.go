@@ -0,0 +1,209 @@
+package outbox
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// fakePublisher accepts up to accept events per call on each relay, or all
+// of them when accept is negative
+type fakePublisher struct {
+	mu        sync.Mutex
+	accept    map[string]int
+	published map[string][]string
+}
+
+func newFakePublisher() *fakePublisher {
+	return &fakePublisher{accept: make(map[string]int), published: make(map[string][]string)}
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, url string, events []*nostr.Event) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	n, ok := p.accept[url]
+	if !ok || n < 0 || n >= len(events) {
+		n = len(events)
+	}
+	for _, event := range events[:n] {
+		p.published[url] = append(p.published[url], event.ID)
+	}
+	if n < len(events) {
+		return n, fmt.Errorf("relay is down")
+	}
+	return n, nil
+}
+
+func (p *fakePublisher) sent(url string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return strings.Join(p.published[url], ",")
+}
+
+func newTestOutbox(t *testing.T, cfg config.OutboxConfig) (*Outbox, *fakePublisher) {
+	t.Helper()
+	o, err := NewOutbox(cfg)
+	helpers.AssertNoError(t, err)
+	publisher := newFakePublisher()
+	o.SetPublisher(publisher)
+	return o, publisher
+}
+
+// flushAndWait flushes the outbox and waits for the deliveries to finish
+func flushAndWait(o *Outbox) {
+	o.flush(context.Background())
+	for {
+		o.mu.Lock()
+		sending := false
+		for _, t := range o.targets {
+			sending = sending || t.sending
+		}
+		o.mu.Unlock()
+		if !sending {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func newPubkey() string {
+	pubkey, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	return pubkey
+}
+
+func status(o *Outbox, url string) RelayStatus {
+	for _, s := range o.Status() {
+		if s.URL == url {
+			return s
+		}
+	}
+	return RelayStatus{}
+}
+
+func TestPush(t *testing.T) {
+	owner := newPubkey()
+	author := newPubkey()
+	stranger := newPubkey()
+	o, publisher := newTestOutbox(t, config.OutboxConfig{
+		Relays:  []string{"wss://one.example.com", "wss://two.example.com/"},
+		Authors: []string{author},
+	})
+	o.SetOwner(func(pubkey string) bool { return pubkey == owner })
+
+	o.Push(&models.Event{ID: "1", PubKey: owner, Kind: 1})
+	o.Push(&models.Event{ID: "2", PubKey: author, Kind: 30023})
+	o.Push(&models.Event{ID: "3", PubKey: stranger, Kind: 1})
+	o.Push(&models.Event{ID: "4", PubKey: owner, Kind: 1, IsQuarantined: true})
+	o.Push(&models.Event{ID: "5", PubKey: owner, Kind: 22242})
+	fetched := &models.Event{ID: "6", PubKey: owner, Kind: 1}
+	fetched.AddProvenance(models.ProvenanceUpstream, "wss://two.example.com", "")
+	o.Push(fetched)
+
+	flushAndWait(o)
+	helpers.AssertStringEqual(t, "1,2,6", publisher.sent("wss://one.example.com"))
+	helpers.AssertStringEqual(t, "1,2", publisher.sent("wss://two.example.com"))
+	helpers.AssertIntEqual(t, 3, int(status(o, "wss://one.example.com").Published))
+	helpers.AssertIntEqual(t, 0, status(o, "wss://one.example.com").Pending)
+}
+
+func TestBackoff(t *testing.T) {
+	owner := newPubkey()
+	o, publisher := newTestOutbox(t, config.OutboxConfig{
+		Relays:     []string{"wss://up.example.com", "wss://down.example.com"},
+		Authors:    []string{owner},
+		MaxBackoff: 30 * time.Second,
+	})
+	now := time.Unix(1700000000, 0)
+	o.now = func() time.Time { return now }
+	publisher.accept["wss://down.example.com"] = 1
+
+	o.Push(&models.Event{ID: "1", PubKey: owner, Kind: 1})
+	o.Push(&models.Event{ID: "2", PubKey: owner, Kind: 1})
+	flushAndWait(o)
+
+	// The healthy relay is not held up by the failing one
+	helpers.AssertStringEqual(t, "1,2", publisher.sent("wss://up.example.com"))
+	helpers.AssertStringEqual(t, "1", publisher.sent("wss://down.example.com"))
+	down := status(o, "wss://down.example.com")
+	helpers.AssertIntEqual(t, 1, down.Pending)
+	helpers.AssertIntEqual(t, 1, down.Failures)
+	helpers.AssertStringEqual(t, "relay is down", down.LastError)
+	helpers.AssertTrue(t, down.NextAttempt.Equal(now.Add(10*time.Second)))
+
+	// Nothing is retried while backing off
+	flushAndWait(o)
+	helpers.AssertStringEqual(t, "1", publisher.sent("wss://down.example.com"))
+
+	publisher.accept["wss://down.example.com"] = 0
+	now = now.Add(10 * time.Second)
+	flushAndWait(o)
+	down = status(o, "wss://down.example.com")
+	helpers.AssertIntEqual(t, 2, down.Failures)
+	helpers.AssertTrue(t, down.NextAttempt.Equal(now.Add(20*time.Second)))
+	helpers.AssertTrue(t, o.backoff(5) == 30*time.Second)
+
+	// Retry skips the backoff, and success resets it
+	delete(publisher.accept, "wss://down.example.com")
+	o.Retry()
+	flushAndWait(o)
+	down = status(o, "wss://down.example.com")
+	helpers.AssertStringEqual(t, "1,2", publisher.sent("wss://down.example.com"))
+	helpers.AssertIntEqual(t, 0, down.Pending)
+	helpers.AssertIntEqual(t, 0, down.Failures)
+	helpers.AssertTrue(t, down.NextAttempt == nil)
+}
+
+func TestMaxPending(t *testing.T) {
+	owner := newPubkey()
+	o, publisher := newTestOutbox(t, config.OutboxConfig{
+		Relays:     []string{"wss://one.example.com"},
+		Authors:    []string{owner},
+		MaxPending: 2,
+	})
+	for i := 1; i <= 3; i++ {
+		o.Push(&models.Event{ID: fmt.Sprint(i), PubKey: owner, Kind: 1})
+	}
+	helpers.AssertIntEqual(t, 1, int(status(o, "wss://one.example.com").Dropped))
+	flushAndWait(o)
+	helpers.AssertStringEqual(t, "2,3", publisher.sent("wss://one.example.com"))
+}
+
+func TestRelayList(t *testing.T) {
+	owner := newPubkey()
+	o, _ := newTestOutbox(t, config.OutboxConfig{
+		Relays:       []string{"wss://configured.example.com"},
+		UseRelayList: true,
+	})
+	o.SetOwner(func(pubkey string) bool { return pubkey == owner })
+
+	urls := func() string {
+		var urls []string
+		for _, s := range o.Status() {
+			urls = append(urls, s.URL+"="+s.Source)
+		}
+		return strings.Join(urls, " ")
+	}
+
+	o.Push(&models.Event{ID: "1", PubKey: owner, Kind: 10002, CreatedAt: 100, Tags: nostr.Tags{
+		{"r", "wss://write.example.com"},
+		{"r", "wss://read.example.com", "read"},
+		{"r", "wss://both.example.com"},
+		{"r", "wss://configured.example.com", "write"},
+	}})
+	helpers.AssertStringEqual(t, "wss://both.example.com=relay_list wss://configured.example.com=configured wss://write.example.com=relay_list", urls())
+
+	// Older lists are ignored; newer ones replace the relay-list relays
+	o.Push(&models.Event{ID: "0", PubKey: owner, Kind: 10002, CreatedAt: 50, Tags: nostr.Tags{{"r", "wss://old.example.com"}}})
+	helpers.AssertStringEqual(t, "wss://both.example.com=relay_list wss://configured.example.com=configured wss://write.example.com=relay_list", urls())
+	o.Push(&models.Event{ID: "2", PubKey: owner, Kind: 10002, CreatedAt: 200, Tags: nostr.Tags{{"r", "wss://new.example.com", "write"}}})
+	helpers.AssertStringEqual(t, "wss://configured.example.com=configured wss://new.example.com=relay_list", urls())
+}
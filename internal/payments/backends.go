@@ -0,0 +1,356 @@
+package payments
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/entitlement"
+)
+
+// backendTimeout bounds one request to an invoice backend
+const backendTimeout = 15 * time.Second
+
+// Backend issues Lightning invoices and tells whether they were paid
+type Backend interface {
+	Name() string
+	CreateInvoice(ctx context.Context, msats int64, memo string, expiry time.Duration) (Invoice, error)
+	Settled(ctx context.Context, invoice Invoice) (bool, error)
+}
+
+// NewBackend returns the backend cfg.Backend names, or nil when invoices
+// are turned off
+func NewBackend(cfg config.PaymentsConfig) (Backend, error) {
+	switch cfg.Backend {
+	case "":
+		return nil, nil
+	case "lnurl":
+		return newLNURLBackend(cfg.LNURL)
+	case "lnd":
+		client, err := httpClient(cfg.LND.TLSCert)
+		if err != nil {
+			return nil, err
+		}
+		return &lndBackend{url: strings.TrimRight(cfg.LND.URL, "/"), macaroon: cfg.LND.Macaroon, client: client}, nil
+	case "cln":
+		client, err := httpClient(cfg.CLN.TLSCert)
+		if err != nil {
+			return nil, err
+		}
+		return &clnBackend{url: strings.TrimRight(cfg.CLN.URL, "/"), rune: cfg.CLN.Rune, client: client}, nil
+	}
+	return nil, fmt.Errorf("unknown payments backend %q", cfg.Backend)
+}
+
+// httpClient trusts certFile, a PEM certificate, on top of the system's
+// authorities when it is set
+func httpClient(certFile string) (*http.Client, error) {
+	client := &http.Client{Timeout: backendTimeout}
+	if certFile == "" {
+		return client, nil
+	}
+	cert, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read backend certificate: %w", err)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(cert) {
+		return nil, fmt.Errorf("no certificate found in %s", certFile)
+	}
+	client.Transport = &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}
+	return client, nil
+}
+
+// doJSON sends body, when not nil, as JSON and decodes the response into out
+func doJSON(ctx context.Context, client *http.Client, method, url string, header http.Header, body, out interface{}) error {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		return fmt.Errorf("%s returned %s: %s", url, resp.Status, strings.TrimSpace(string(data)))
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("unreadable response from %s: %w", url, err)
+	}
+	return nil
+}
+
+// lndBackend uses the invoices endpoints of LND's REST API
+type lndBackend struct {
+	url      string
+	macaroon string
+	client   *http.Client
+}
+
+func (b *lndBackend) Name() string { return "lnd" }
+
+func (b *lndBackend) header() http.Header {
+	return http.Header{"Grpc-Metadata-Macaroon": []string{b.macaroon}}
+}
+
+func (b *lndBackend) CreateInvoice(ctx context.Context, msats int64, memo string, expiry time.Duration) (Invoice, error) {
+	request := map[string]string{
+		"value_msat": strconv.FormatInt(msats, 10),
+		"memo":       memo,
+		"expiry":     strconv.FormatInt(int64(expiry.Seconds()), 10),
+	}
+	var response struct {
+		RHash          string `json:"r_hash"`
+		PaymentRequest string `json:"payment_request"`
+	}
+	if err := doJSON(ctx, b.client, http.MethodPost, b.url+"/v1/invoices", b.header(), request, &response); err != nil {
+		return Invoice{}, err
+	}
+	hash, err := base64.StdEncoding.DecodeString(response.RHash)
+	if err != nil || len(hash) != 32 {
+		return Invoice{}, fmt.Errorf("lnd returned an invalid payment hash")
+	}
+	return Invoice{ID: hex.EncodeToString(hash), Bolt11: response.PaymentRequest}, nil
+}
+
+func (b *lndBackend) Settled(ctx context.Context, invoice Invoice) (bool, error) {
+	var response struct {
+		State string `json:"state"`
+	}
+	if err := doJSON(ctx, b.client, http.MethodGet, b.url+"/v1/invoice/"+invoice.ID, b.header(), nil, &response); err != nil {
+		return false, err
+	}
+	return response.State == "SETTLED", nil
+}
+
+// clnBackend uses Core Lightning's clnrest plugin
+type clnBackend struct {
+	url    string
+	rune   string
+	client *http.Client
+}
+
+func (b *clnBackend) Name() string { return "cln" }
+
+func (b *clnBackend) header() http.Header {
+	return http.Header{"Rune": []string{b.rune}}
+}
+
+func (b *clnBackend) CreateInvoice(ctx context.Context, msats int64, memo string, expiry time.Duration) (Invoice, error) {
+	// Labels must be unique on the node
+	label := make([]byte, 8)
+	if _, err := rand.Read(label); err != nil {
+		return Invoice{}, err
+	}
+	request := map[string]interface{}{
+		"amount_msat": msats,
+		"label":       "mercury-" + hex.EncodeToString(label),
+		"description": memo,
+		"expiry":      int64(expiry.Seconds()),
+	}
+	var response struct {
+		PaymentHash string `json:"payment_hash"`
+		Bolt11      string `json:"bolt11"`
+		ExpiresAt   int64  `json:"expires_at"`
+	}
+	if err := doJSON(ctx, b.client, http.MethodPost, b.url+"/v1/invoice", b.header(), request, &response); err != nil {
+		return Invoice{}, err
+	}
+	inv := Invoice{ID: response.PaymentHash, Bolt11: response.Bolt11}
+	if response.ExpiresAt > 0 {
+		inv.ExpiresAt = time.Unix(response.ExpiresAt, 0)
+	}
+	return inv, nil
+}
+
+func (b *clnBackend) Settled(ctx context.Context, invoice Invoice) (bool, error) {
+	var response struct {
+		Invoices []struct {
+			Status string `json:"status"`
+		} `json:"invoices"`
+	}
+	request := map[string]string{"payment_hash": invoice.ID}
+	if err := doJSON(ctx, b.client, http.MethodPost, b.url+"/v1/listinvoices", b.header(), request, &response); err != nil {
+		return false, err
+	}
+	return len(response.Invoices) > 0 && response.Invoices[0].Status == "paid", nil
+}
+
+// lnurlBackend requests invoices from an LNURL-pay service and checks them
+// through their LUD-21 verify URLs
+type lnurlBackend struct {
+	url    string
+	client *http.Client
+}
+
+func newLNURLBackend(cfg config.LNURLConfig) (*lnurlBackend, error) {
+	address := cfg.Address
+	if name, domain, ok := strings.Cut(address, "@"); ok && !strings.Contains(address, "/") {
+		address = "https://" + domain + "/.well-known/lnurlp/" + name
+	}
+	if u, err := url.Parse(address); err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return nil, fmt.Errorf("invalid lnurl address %q: expected a lightning address or https URL", cfg.Address)
+	}
+	return &lnurlBackend{url: address, client: &http.Client{Timeout: backendTimeout}}, nil
+}
+
+func (b *lnurlBackend) Name() string { return "lnurl" }
+
+func (b *lnurlBackend) CreateInvoice(ctx context.Context, msats int64, memo string, expiry time.Duration) (Invoice, error) {
+	var params struct {
+		Tag            string `json:"tag"`
+		Callback       string `json:"callback"`
+		MinSendable    int64  `json:"minSendable"`
+		MaxSendable    int64  `json:"maxSendable"`
+		CommentAllowed int    `json:"commentAllowed"`
+	}
+	if err := doJSON(ctx, b.client, http.MethodGet, b.url, nil, nil, &params); err != nil {
+		return Invoice{}, err
+	}
+	if params.Tag != "payRequest" || params.Callback == "" {
+		return Invoice{}, fmt.Errorf("%s is not an LNURL-pay service", b.url)
+	}
+	if msats < params.MinSendable || (params.MaxSendable > 0 && msats > params.MaxSendable) {
+		return Invoice{}, fmt.Errorf("price of %d msats is outside the %d-%d msats the service accepts", msats, params.MinSendable, params.MaxSendable)
+	}
+
+	callback, err := url.Parse(params.Callback)
+	if err != nil {
+		return Invoice{}, fmt.Errorf("invalid lnurl callback: %w", err)
+	}
+	query := callback.Query()
+	query.Set("amount", strconv.FormatInt(msats, 10))
+	if params.CommentAllowed > 0 {
+		query.Set("comment", memo[:min(len(memo), params.CommentAllowed)])
+	}
+	callback.RawQuery = query.Encode()
+
+	var response struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+		PR     string `json:"pr"`
+		Verify string `json:"verify"`
+	}
+	if err := doJSON(ctx, b.client, http.MethodGet, callback.String(), nil, nil, &response); err != nil {
+		return Invoice{}, err
+	}
+	if response.Status == "ERROR" {
+		return Invoice{}, fmt.Errorf("lnurl service refused: %s", response.Reason)
+	}
+	if response.Verify == "" {
+		return Invoice{}, fmt.Errorf("lnurl service doesn't support payment verification (LUD-21)")
+	}
+	if paid, err := entitlement.InvoiceMsats(response.PR); err != nil || paid != msats {
+		return Invoice{}, fmt.Errorf("lnurl service returned an invoice for the wrong amount")
+	}
+	hash, err := paymentHash(response.PR)
+	if err != nil {
+		return Invoice{}, err
+	}
+	return Invoice{ID: hash, Bolt11: response.PR, Verify: response.Verify}, nil
+}
+
+func (b *lnurlBackend) Settled(ctx context.Context, invoice Invoice) (bool, error) {
+	var response struct {
+		Status  string `json:"status"`
+		Reason  string `json:"reason"`
+		Settled bool   `json:"settled"`
+	}
+	if err := doJSON(ctx, b.client, http.MethodGet, invoice.Verify, nil, nil, &response); err != nil {
+		return false, err
+	}
+	if response.Status == "ERROR" {
+		return false, fmt.Errorf("lnurl verify failed: %s", response.Reason)
+	}
+	return response.Settled, nil
+}
+
+// bech32Charset maps bech32 characters to their 5-bit values
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// paymentHash reads the payment hash from a bolt11 invoice's tagged fields.
+// The checksum is the payer's wallet's business, it isn't verified.
+func paymentHash(bolt11 string) (string, error) {
+	bolt11 = strings.ToLower(bolt11)
+	sep := strings.LastIndex(bolt11, "1")
+	if !strings.HasPrefix(bolt11, "ln") || sep < 0 {
+		return "", fmt.Errorf("invalid bolt11 invoice")
+	}
+	words := make([]byte, 0, len(bolt11)-sep-1)
+	for _, c := range bolt11[sep+1:] {
+		v := strings.IndexRune(bech32Charset, c)
+		if v < 0 {
+			return "", fmt.Errorf("invalid bolt11 invoice")
+		}
+		words = append(words, byte(v))
+	}
+
+	// A 7 word timestamp, tagged fields, a 104 word signature and a 6 word
+	// checksum
+	if len(words) < 7+104+6 {
+		return "", fmt.Errorf("invalid bolt11 invoice")
+	}
+	fields := words[7 : len(words)-104-6]
+	for len(fields) >= 3 {
+		tag := fields[0]
+		length := int(fields[1])<<5 | int(fields[2])
+		if len(fields) < 3+length {
+			break
+		}
+		data := fields[3 : 3+length]
+		fields = fields[3+length:]
+		if tag != 1 || length != 52 { // "p", the payment hash
+			continue
+		}
+
+		hash := make([]byte, 0, 32)
+		var acc, bits uint
+		for _, w := range data {
+			acc = acc<<5 | uint(w)
+			bits += 5
+			if bits >= 8 {
+				bits -= 8
+				hash = append(hash, byte(acc>>bits))
+			}
+		}
+		return hex.EncodeToString(hash[:32]), nil
+	}
+	return "", fmt.Errorf("bolt11 invoice has no payment hash")
+}
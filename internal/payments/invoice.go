@@ -0,0 +1,226 @@
+package payments
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// maxPendingInvoices bounds the invoices waiting for payment, so requesting
+// invoices can't grow the state without limit
+const maxPendingInvoices = 1000
+
+var (
+	ErrNoBackend       = fmt.Errorf("paying for write access is not available")
+	ErrAlreadyAdmitted = fmt.Errorf("pubkey already has write access")
+	ErrTooManyInvoices = fmt.Errorf("too many unpaid invoices, try again later")
+	ErrUnknownInvoice  = fmt.Errorf("invoice not found")
+)
+
+// Invoice is a Lightning invoice that admits Pubkey once paid. ID is the
+// payment hash.
+type Invoice struct {
+	ID        string    `json:"id"`
+	Pubkey    string    `json:"pubkey"`
+	Bolt11    string    `json:"bolt11"`
+	Msats     int64     `json:"msats"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Verify    string    `json:"verify,omitempty"` // LUD-21 verify URL for LNURL invoices
+}
+
+// InvoiceStatus is an invoice and, once paid, the admission it bought
+type InvoiceStatus struct {
+	Invoice
+	Paid      bool       `json:"paid"`
+	Admission *Admission `json:"admission,omitempty"`
+}
+
+// RequestInvoice returns an invoice admitting pubkey once paid. A pubkey
+// with an unpaid invoice that hasn't expired gets that one again.
+func (m *Manager) RequestInvoice(ctx context.Context, pubkey string) (Invoice, error) {
+	if m.backend == nil {
+		return Invoice{}, ErrNoBackend
+	}
+	pubkey, err := parsePubkey(pubkey)
+	if err != nil {
+		return Invoice{}, err
+	}
+
+	m.mu.Lock()
+	if a, ok := m.admissions[pubkey]; ok && a.ExpiresAt == nil {
+		m.mu.Unlock()
+		return Invoice{}, ErrAlreadyAdmitted
+	}
+	for _, inv := range m.invoices {
+		if inv.Pubkey == pubkey && m.now().Before(inv.ExpiresAt) {
+			m.mu.Unlock()
+			return *inv, nil
+		}
+	}
+	if len(m.invoices) >= maxPendingInvoices {
+		m.mu.Unlock()
+		return Invoice{}, ErrTooManyInvoices
+	}
+	m.mu.Unlock()
+
+	msats := m.cfg.Price * 1000
+	inv, err := m.backend.CreateInvoice(ctx, msats, "Write access for "+pubkey, m.cfg.InvoiceExpiry)
+	if err != nil {
+		return Invoice{}, fmt.Errorf("failed to create invoice: %w", err)
+	}
+	inv.Pubkey = pubkey
+	inv.Msats = msats
+	if inv.ExpiresAt.IsZero() {
+		inv.ExpiresAt = m.now().Add(m.cfg.InvoiceExpiry)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.invoices[inv.ID] = &inv
+	if err := m.saveLocked(); err != nil {
+		delete(m.invoices, inv.ID)
+		return Invoice{}, err
+	}
+	return inv, nil
+}
+
+// CheckInvoice asks the backend whether the invoice id was paid, admitting
+// its pubkey when it was
+func (m *Manager) CheckInvoice(ctx context.Context, id string) (InvoiceStatus, error) {
+	m.mu.Lock()
+	inv, pending := m.invoices[id]
+	if !pending {
+		defer m.mu.Unlock()
+		for _, a := range m.admissions {
+			if a.Method == MethodInvoice && a.Reference == id {
+				admission := *a
+				return InvoiceStatus{Invoice: Invoice{ID: id, Pubkey: a.Pubkey, Msats: a.Msats}, Paid: true, Admission: &admission}, nil
+			}
+		}
+		return InvoiceStatus{}, ErrUnknownInvoice
+	}
+	invoice := *inv
+	m.mu.Unlock()
+
+	settled, err := m.backend.Settled(ctx, invoice)
+	if err != nil {
+		return InvoiceStatus{}, fmt.Errorf("failed to check invoice: %w", err)
+	}
+	if !settled {
+		return InvoiceStatus{Invoice: invoice}, nil
+	}
+	a, err := m.settle(invoice)
+	if err != nil {
+		return InvoiceStatus{}, err
+	}
+	return InvoiceStatus{Invoice: invoice, Paid: true, Admission: &a}, nil
+}
+
+// Run checks pending invoices every poll interval, and drops expired
+// invoices and admissions
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.cfg.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.poll(ctx)
+			m.expire()
+		}
+	}
+}
+
+// poll admits the pubkeys whose pending invoices were paid
+func (m *Manager) poll(ctx context.Context) {
+	if m.backend == nil {
+		return
+	}
+
+	m.mu.Lock()
+	pending := make([]Invoice, 0, len(m.invoices))
+	for _, inv := range m.invoices {
+		pending = append(pending, *inv)
+	}
+	m.mu.Unlock()
+
+	for _, inv := range pending {
+		if ctx.Err() != nil {
+			return
+		}
+		settled, err := m.backend.Settled(ctx, inv)
+		if err != nil {
+			log.Printf("Failed to check invoice %s: %v", inv.ID, err)
+			continue
+		}
+		if !settled {
+			continue
+		}
+		if _, err := m.settle(inv); err != nil {
+			log.Printf("Failed to admit %s for invoice %s: %v", inv.Pubkey, inv.ID, err)
+		}
+	}
+}
+
+// settle admits the pubkey of a paid invoice. An invoice settled by a poll
+// and a check at once only admits once.
+func (m *Manager) settle(inv Invoice) (Admission, error) {
+	m.mu.Lock()
+	if _, ok := m.invoices[inv.ID]; !ok {
+		m.mu.Unlock()
+		status, err := m.CheckInvoice(context.Background(), inv.ID)
+		if err != nil || status.Admission == nil {
+			return Admission{}, ErrUnknownInvoice
+		}
+		return *status.Admission, nil
+	}
+	delete(m.invoices, inv.ID)
+	previous := m.admissions[inv.Pubkey]
+	a := m.admitLocked(inv.Pubkey, MethodInvoice, inv.Msats, inv.ID)
+	if err := m.saveLocked(); err != nil {
+		m.invoices[inv.ID] = &inv
+		m.restoreLocked(inv.Pubkey, previous)
+		m.mu.Unlock()
+		return Admission{}, err
+	}
+	admission := *a
+	m.mu.Unlock()
+
+	log.Printf("Admitted %s for paying invoice %s (%d msats)", inv.Pubkey, inv.ID, inv.Msats)
+	m.changed()
+	return admission, nil
+}
+
+// expire drops invoices and admissions past their expiry
+func (m *Manager) expire() {
+	m.mu.Lock()
+	removed := 0
+	for id, inv := range m.invoices {
+		// Give payments made at the last moment one more poll to show up
+		if m.now().After(inv.ExpiresAt.Add(m.cfg.PollInterval)) {
+			delete(m.invoices, id)
+			removed++
+		}
+	}
+	expired := 0
+	for pubkey, a := range m.admissions {
+		if m.expired(a) {
+			delete(m.admissions, pubkey)
+			expired++
+		}
+	}
+	if removed+expired > 0 {
+		if err := m.saveLocked(); err != nil {
+			log.Printf("Failed to save payments: %v", err)
+		}
+	}
+	m.mu.Unlock()
+
+	if expired > 0 {
+		log.Printf("%d paid admissions expired", expired)
+		m.changed()
+	}
+}
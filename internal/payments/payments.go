@@ -0,0 +1,368 @@
+// Package payments lets pubkeys without write access buy it, by paying a
+// Lightning invoice issued through an LNURL, LND or Core Lightning backend,
+// or by having received enough zaps. Admissions are saved with the pending
+// invoices and zap totals, and can be granted or revoked by admins.
+package payments
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/config"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// Admission methods
+const (
+	MethodInvoice = "invoice"
+	MethodZaps    = "zaps"
+	MethodAdmin   = "admin"
+)
+
+var (
+	ErrNotFound      = fmt.Errorf("admission not found")
+	ErrInvalidPubkey = fmt.Errorf("pubkey must be an npub or 64 character hex pubkey")
+)
+
+// Admission lets Pubkey write until ExpiresAt, or for good when it is nil
+type Admission struct {
+	Pubkey    string     `json:"pubkey"`
+	Method    string     `json:"method"`
+	Msats     int64      `json:"msats,omitempty"`
+	Reference string     `json:"reference,omitempty"` // Invoice ID or last zap receipt ID
+	GrantedBy string     `json:"granted_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// Manager holds admissions, pending invoices and zap totals in memory and
+// saves them to path after every change
+type Manager struct {
+	cfg        config.PaymentsConfig
+	backend    Backend
+	providers  map[string]bool
+	admissions map[string]*Admission
+	invoices   map[string]*Invoice
+	zaps       map[string]*zapTotal
+	onChange   func()
+	now        func() time.Time
+	mu         sync.Mutex
+}
+
+type state struct {
+	Admissions []*Admission `json:"admissions"`
+	Invoices   []*Invoice   `json:"invoices"`
+	Zaps       []*zapTotal  `json:"zaps"`
+}
+
+// New loads the state saved at cfg.Path and sets up the configured invoice
+// backend. An empty path keeps everything in memory only.
+func New(cfg config.PaymentsConfig) (*Manager, error) {
+	m := &Manager{
+		cfg:        cfg,
+		providers:  make(map[string]bool),
+		admissions: make(map[string]*Admission),
+		invoices:   make(map[string]*Invoice),
+		zaps:       make(map[string]*zapTotal),
+		now:        time.Now,
+	}
+
+	backend, err := NewBackend(cfg)
+	if err != nil {
+		return nil, err
+	}
+	m.backend = backend
+
+	for _, provider := range cfg.ZapProviders {
+		pubkey, err := parsePubkey(provider)
+		if err != nil {
+			return nil, fmt.Errorf("invalid zap provider %q: %w", provider, err)
+		}
+		m.providers[pubkey] = true
+	}
+
+	if err := m.load(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// OnChange calls fn whenever a pubkey is admitted or its admission is
+// revoked. Admissions running out don't call it; callers caching Admitted
+// should keep the expiry AdmittedUntil returns.
+func (m *Manager) OnChange(fn func()) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.onChange = fn
+}
+
+// Admitted reports whether pubkey has paid, or been granted, write access
+// that hasn't expired
+func (m *Manager) Admitted(pubkey string) bool {
+	_, ok := m.AdmittedUntil(pubkey)
+	return ok
+}
+
+// AdmittedUntil is Admitted, also returning when the admission runs out:
+// the zero time when it is for good
+func (m *Manager) AdmittedUntil(pubkey string) (time.Time, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	a, ok := m.admissions[strings.ToLower(pubkey)]
+	if !ok || m.expired(a) {
+		return time.Time{}, false
+	}
+	if a.ExpiresAt == nil {
+		return time.Time{}, true
+	}
+	return *a.ExpiresAt, true
+}
+
+// Grant admits pubkey on an admin's behalf, for good. Granting an admitted
+// pubkey again makes its admission permanent.
+func (m *Manager) Grant(pubkey, grantedBy string) (Admission, error) {
+	pubkey, err := parsePubkey(pubkey)
+	if err != nil {
+		return Admission{}, err
+	}
+
+	m.mu.Lock()
+	previous := m.admissions[pubkey]
+	a := &Admission{
+		Pubkey:    pubkey,
+		Method:    MethodAdmin,
+		GrantedBy: grantedBy,
+		CreatedAt: m.now(),
+	}
+	m.admissions[pubkey] = a
+	if err := m.saveLocked(); err != nil {
+		m.restoreLocked(pubkey, previous)
+		m.mu.Unlock()
+		return Admission{}, err
+	}
+	m.mu.Unlock()
+
+	m.changed()
+	return *a, nil
+}
+
+// Revoke takes pubkey's admission away
+func (m *Manager) Revoke(pubkey string) error {
+	pubkey, err := parsePubkey(pubkey)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	a, ok := m.admissions[pubkey]
+	if !ok {
+		m.mu.Unlock()
+		return ErrNotFound
+	}
+	delete(m.admissions, pubkey)
+	if err := m.saveLocked(); err != nil {
+		m.admissions[pubkey] = a
+		m.mu.Unlock()
+		return err
+	}
+	m.mu.Unlock()
+
+	m.changed()
+	return nil
+}
+
+// Admissions returns the admissions that haven't expired, oldest first
+func (m *Manager) Admissions() []Admission {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	list := []Admission{}
+	for _, a := range m.admissions {
+		if !m.expired(a) {
+			list = append(list, *a)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list
+}
+
+// Price is what an invoice for write access costs in sats, 0 when invoices
+// are turned off
+func (m *Manager) Price() int64 {
+	if m.backend == nil {
+		return 0
+	}
+	return m.cfg.Price
+}
+
+// ZapThreshold is how many sats in zaps a pubkey must receive to be
+// admitted, 0 when zaps don't admit
+func (m *Manager) ZapThreshold() int64 {
+	return m.cfg.ZapThreshold
+}
+
+// Stats counts admissions per method and pending invoices
+func (m *Manager) Stats() map[string]interface{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	methods := make(map[string]int)
+	for _, a := range m.admissions {
+		if !m.expired(a) {
+			methods[a.Method]++
+		}
+	}
+	backend := ""
+	if m.backend != nil {
+		backend = m.backend.Name()
+	}
+	return map[string]interface{}{
+		"backend":          backend,
+		"price_sats":       m.cfg.Price,
+		"zap_threshold":    m.cfg.ZapThreshold,
+		"admissions":       methods,
+		"pending_invoices": len(m.invoices),
+		"zap_recipients":   len(m.zaps),
+	}
+}
+
+// admitLocked admits pubkey after a payment. Payments while admitted extend
+// the admission from when it would have expired. Callers must hold m.mu and
+// save afterwards.
+func (m *Manager) admitLocked(pubkey, method string, msats int64, reference string) *Admission {
+	now := m.now()
+	a := &Admission{
+		Pubkey:    pubkey,
+		Method:    method,
+		Msats:     msats,
+		Reference: reference,
+		CreatedAt: now,
+	}
+	previous, ok := m.admissions[pubkey]
+	if ok && previous.ExpiresAt == nil && !m.expired(previous) {
+		// Already admitted for good
+		return previous
+	}
+	if m.cfg.Duration > 0 {
+		start := now
+		if ok && !m.expired(previous) {
+			start = *previous.ExpiresAt
+		}
+		expires := start.Add(m.cfg.Duration)
+		a.ExpiresAt = &expires
+	}
+	m.admissions[pubkey] = a
+	return a
+}
+
+// restoreLocked puts back the admission a failed save replaced
+func (m *Manager) restoreLocked(pubkey string, previous *Admission) {
+	if previous == nil {
+		delete(m.admissions, pubkey)
+		return
+	}
+	m.admissions[pubkey] = previous
+}
+
+func (m *Manager) expired(a *Admission) bool {
+	return a.ExpiresAt != nil && !m.now().Before(*a.ExpiresAt)
+}
+
+// changed tells the OnChange callback admissions changed. Callers must not
+// hold m.mu.
+func (m *Manager) changed() {
+	m.mu.Lock()
+	fn := m.onChange
+	m.mu.Unlock()
+	if fn != nil {
+		fn()
+	}
+}
+
+func parsePubkey(key string) (string, error) {
+	if nostr.IsValid32ByteHex(key) {
+		return strings.ToLower(key), nil
+	}
+	prefix, data, err := nip19.Decode(key)
+	if err != nil || prefix != "npub" {
+		return "", ErrInvalidPubkey
+	}
+	return data.(string), nil
+}
+
+func (m *Manager) load() error {
+	if m.cfg.Path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(m.cfg.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", m.cfg.Path, err)
+	}
+
+	var s state
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", m.cfg.Path, err)
+	}
+	for _, a := range s.Admissions {
+		m.admissions[a.Pubkey] = a
+	}
+	for _, inv := range s.Invoices {
+		m.invoices[inv.ID] = inv
+	}
+	for _, z := range s.Zaps {
+		m.zaps[z.Pubkey] = z
+	}
+	return nil
+}
+
+// saveLocked atomically writes the state to path. Callers must hold m.mu.
+func (m *Manager) saveLocked() error {
+	if m.cfg.Path == "" {
+		return nil
+	}
+
+	s := state{
+		Admissions: make([]*Admission, 0, len(m.admissions)),
+		Invoices:   make([]*Invoice, 0, len(m.invoices)),
+		Zaps:       make([]*zapTotal, 0, len(m.zaps)),
+	}
+	for _, a := range m.admissions {
+		s.Admissions = append(s.Admissions, a)
+	}
+	for _, inv := range m.invoices {
+		s.Invoices = append(s.Invoices, inv)
+	}
+	for _, z := range m.zaps {
+		s.Zaps = append(s.Zaps, z)
+	}
+	sort.Slice(s.Admissions, func(i, j int) bool { return s.Admissions[i].CreatedAt.Before(s.Admissions[j].CreatedAt) })
+	sort.Slice(s.Invoices, func(i, j int) bool { return s.Invoices[i].ExpiresAt.Before(s.Invoices[j].ExpiresAt) })
+	sort.Slice(s.Zaps, func(i, j int) bool { return s.Zaps[i].Pubkey < s.Zaps[j].Pubkey })
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode payments: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(m.cfg.Path), 0755); err != nil {
+		return fmt.Errorf("failed to write payments: %w", err)
+	}
+	tmp := m.cfg.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write payments: %w", err)
+	}
+	if err := os.Rename(tmp, m.cfg.Path); err != nil {
+		return fmt.Errorf("failed to write payments: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,387 @@
+package payments
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/entitlement"
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+func newKey() (string, string) {
+	sk := nostr.GeneratePrivateKey()
+	pub, _ := nostr.GetPublicKey(sk)
+	return sk, pub
+}
+
+// testBolt11 builds an invoice for amount, e.g. "2500u", with hash as its
+// payment hash and a zero signature and checksum
+func testBolt11(amount string, hash []byte) string {
+	words := make([]byte, 7, 200)
+	words = append(words, 1, 52>>5, 52&31)
+	var acc, bits uint
+	for _, b := range hash {
+		acc = acc<<8 | uint(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			words = append(words, byte(acc>>bits)&31)
+		}
+	}
+	words = append(words, byte(acc<<(5-bits))&31)
+	words = append(words, make([]byte, 104+6)...)
+
+	var b strings.Builder
+	b.WriteString("lnbc" + amount + "1")
+	for _, w := range words {
+		b.WriteByte(bech32Charset[w])
+	}
+	return b.String()
+}
+
+func testHash(seed byte) []byte {
+	hash := make([]byte, 32)
+	for i := range hash {
+		hash[i] = seed + byte(i)
+	}
+	return hash
+}
+
+func TestAdmissions(t *testing.T) {
+	_, pubkey := newKey()
+	npub, _ := nip19.EncodePublicKey(pubkey)
+	path := filepath.Join(t.TempDir(), "payments.json")
+	m, err := New(config.PaymentsConfig{Path: path})
+	helpers.AssertNoError(t, err)
+
+	changes := 0
+	m.OnChange(func() { changes++ })
+
+	helpers.AssertFalse(t, m.Admitted(pubkey))
+	a, err := m.Grant(npub, "admin")
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, pubkey, a.Pubkey)
+	helpers.AssertStringEqual(t, MethodAdmin, a.Method)
+	helpers.AssertTrue(t, a.ExpiresAt == nil)
+	helpers.AssertTrue(t, m.Admitted(pubkey))
+	helpers.AssertIntEqual(t, 1, changes)
+
+	_, err = m.Grant("alice", "admin")
+	helpers.AssertTrue(t, errors.Is(err, ErrInvalidPubkey))
+	_, err = m.RequestInvoice(context.Background(), pubkey)
+	helpers.AssertTrue(t, errors.Is(err, ErrNoBackend))
+
+	// Admissions survive a restart
+	reloaded, err := New(config.PaymentsConfig{Path: path})
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, reloaded.Admitted(pubkey))
+	helpers.AssertIntEqual(t, 1, len(reloaded.Admissions()))
+
+	helpers.AssertNoError(t, reloaded.Revoke(pubkey))
+	helpers.AssertFalse(t, reloaded.Admitted(pubkey))
+	helpers.AssertTrue(t, errors.Is(reloaded.Revoke(pubkey), ErrNotFound))
+}
+
+// lnd is an LND REST API keeping invoices in memory
+func lnd(t *testing.T) (*httptest.Server, func(hash string)) {
+	var mu sync.Mutex
+	settled := make(map[string]bool)
+	next := byte(0)
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		if req.Header.Get("Grpc-Metadata-Macaroon") != "abcd" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case req.Method == http.MethodPost && req.URL.Path == "/v1/invoices":
+			var body map[string]string
+			json.NewDecoder(req.Body).Decode(&body)
+			if body["value_msat"] != "21000" || body["expiry"] != "3600" {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			hash := testHash(next)
+			next++
+			settled[hex.EncodeToString(hash)] = false
+			json.NewEncoder(w).Encode(map[string]string{
+				"r_hash":          base64.StdEncoding.EncodeToString(hash),
+				"payment_request": testBolt11("210n", hash),
+			})
+		case req.Method == http.MethodGet && strings.HasPrefix(req.URL.Path, "/v1/invoice/"):
+			state := "OPEN"
+			if settled[strings.TrimPrefix(req.URL.Path, "/v1/invoice/")] {
+				state = "SETTLED"
+			}
+			json.NewEncoder(w).Encode(map[string]string{"state": state})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+	return server, func(hash string) {
+		mu.Lock()
+		defer mu.Unlock()
+		settled[hash] = true
+	}
+}
+
+func TestInvoices(t *testing.T) {
+	server, pay := lnd(t)
+	certFile := filepath.Join(t.TempDir(), "tls.cert")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	helpers.AssertNoError(t, os.WriteFile(certFile, cert, 0600))
+
+	cfg := config.PaymentsConfig{
+		Price:         21,
+		Duration:      24 * time.Hour,
+		InvoiceExpiry: time.Hour,
+		PollInterval:  time.Second,
+		Backend:       "lnd",
+		LND:           config.LNDConfig{URL: server.URL, Macaroon: "abcd", TLSCert: certFile},
+	}
+	m, err := New(cfg)
+	helpers.AssertNoError(t, err)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+	changes := 0
+	m.OnChange(func() { changes++ })
+
+	_, pubkey := newKey()
+	inv, err := m.RequestInvoice(context.Background(), pubkey)
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, hex.EncodeToString(testHash(0)), inv.ID)
+	helpers.AssertInt64Equal(t, 21000, inv.Msats)
+	helpers.AssertTrue(t, inv.ExpiresAt.Equal(now.Add(time.Hour)))
+
+	// Asking again returns the unpaid invoice
+	again, err := m.RequestInvoice(context.Background(), pubkey)
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, inv.ID, again.ID)
+
+	status, err := m.CheckInvoice(context.Background(), inv.ID)
+	helpers.AssertNoError(t, err)
+	helpers.AssertFalse(t, status.Paid)
+	helpers.AssertFalse(t, m.Admitted(pubkey))
+
+	pay(inv.ID)
+	m.poll(context.Background())
+	helpers.AssertTrue(t, m.Admitted(pubkey))
+	helpers.AssertIntEqual(t, 1, changes)
+
+	status, err = m.CheckInvoice(context.Background(), inv.ID)
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, status.Paid)
+	helpers.AssertTrue(t, status.Admission.ExpiresAt.Equal(now.Add(24*time.Hour)))
+	_, err = m.CheckInvoice(context.Background(), "unknown")
+	helpers.AssertTrue(t, errors.Is(err, ErrUnknownInvoice))
+
+	// Paying again extends the admission
+	renewal, err := m.RequestInvoice(context.Background(), pubkey)
+	helpers.AssertNoError(t, err)
+	pay(renewal.ID)
+	status, err = m.CheckInvoice(context.Background(), renewal.ID)
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, status.Admission.ExpiresAt.Equal(now.Add(48*time.Hour)))
+
+	// Unpaid invoices and admissions expire
+	_, stranger := newKey()
+	_, err = m.RequestInvoice(context.Background(), stranger)
+	helpers.AssertNoError(t, err)
+	now = now.Add(48 * time.Hour)
+	m.expire()
+	helpers.AssertFalse(t, m.Admitted(pubkey))
+	helpers.AssertIntEqual(t, 0, len(m.Admissions()))
+	helpers.AssertIntEqual(t, 0, m.Stats()["pending_invoices"].(int))
+	helpers.AssertIntEqual(t, 3, changes)
+}
+
+func TestCLNBackend(t *testing.T) {
+	hash := hex.EncodeToString(testHash(7))
+	paid := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Header.Get("Rune") != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var body map[string]interface{}
+		json.NewDecoder(req.Body).Decode(&body)
+		switch req.URL.Path {
+		case "/v1/invoice":
+			helpers.AssertTrue(t, strings.HasPrefix(body["label"].(string), "mercury-"))
+			json.NewEncoder(w).Encode(map[string]interface{}{"payment_hash": hash, "bolt11": "lnbc210n1test", "expires_at": 1767229200})
+		case "/v1/listinvoices":
+			status := "unpaid"
+			if paid && body["payment_hash"] == hash {
+				status = "paid"
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"invoices": []map[string]string{{"status": status}}})
+		}
+	}))
+	defer server.Close()
+
+	backend, err := NewBackend(config.PaymentsConfig{Backend: "cln", CLN: config.CLNConfig{URL: server.URL, Rune: "secret"}})
+	helpers.AssertNoError(t, err)
+	inv, err := backend.CreateInvoice(context.Background(), 21000, "memo", time.Hour)
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, hash, inv.ID)
+	helpers.AssertInt64Equal(t, 1767229200, inv.ExpiresAt.Unix())
+
+	settled, err := backend.Settled(context.Background(), inv)
+	helpers.AssertNoError(t, err)
+	helpers.AssertFalse(t, settled)
+	paid = true
+	settled, err = backend.Settled(context.Background(), inv)
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, settled)
+
+	_, err = NewBackend(config.PaymentsConfig{Backend: "cln", CLN: config.CLNConfig{URL: server.URL, TLSCert: "/nonexistent"}})
+	helpers.AssertErrorContains(t, err, "failed to read backend certificate")
+}
+
+func TestLNURLBackend(t *testing.T) {
+	hash := testHash(3)
+	verify := true
+	paid := false
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		switch req.URL.Path {
+		case "/.well-known/lnurlp/relay":
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"tag": "payRequest", "callback": server.URL + "/pay", "minSendable": 1000, "maxSendable": 100000,
+			})
+		case "/pay":
+			response := map[string]string{"pr": testBolt11("210n", hash)}
+			if verify {
+				response["verify"] = server.URL + "/verify"
+			}
+			json.NewEncoder(w).Encode(response)
+		case "/verify":
+			json.NewEncoder(w).Encode(map[string]interface{}{"status": "OK", "settled": paid})
+		}
+	}))
+	defer server.Close()
+
+	backend, err := NewBackend(config.PaymentsConfig{Backend: "lnurl", LNURL: config.LNURLConfig{Address: server.URL + "/.well-known/lnurlp/relay"}})
+	helpers.AssertNoError(t, err)
+	inv, err := backend.CreateInvoice(context.Background(), 21000, "memo", time.Hour)
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, hex.EncodeToString(hash), inv.ID)
+
+	settled, err := backend.Settled(context.Background(), inv)
+	helpers.AssertNoError(t, err)
+	helpers.AssertFalse(t, settled)
+	paid = true
+	settled, err = backend.Settled(context.Background(), inv)
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, settled)
+
+	_, err = backend.CreateInvoice(context.Background(), 500000, "memo", time.Hour)
+	helpers.AssertErrorContains(t, err, "outside")
+	verify = false
+	_, err = backend.CreateInvoice(context.Background(), 21000, "memo", time.Hour)
+	helpers.AssertErrorContains(t, err, "LUD-21")
+
+	// Lightning addresses resolve to their well-known URL
+	address, err := newLNURLBackend(config.LNURLConfig{Address: "relay@example.com"})
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, "https://example.com/.well-known/lnurlp/relay", address.url)
+	_, err = newLNURLBackend(config.LNURLConfig{Address: "relay"})
+	helpers.AssertErrorContains(t, err, "invalid lnurl address")
+}
+
+// zapReceipt builds a receipt signed by providerKey for a zap of recipient
+// by senderKey, paying invoice
+func zapReceipt(t *testing.T, providerKey, senderKey, recipient, invoice string) *models.Event {
+	t.Helper()
+	request := nostr.Event{Kind: entitlement.KindZapRequest, CreatedAt: nostr.Now(), Tags: nostr.Tags{{"p", recipient}}}
+	helpers.AssertNoError(t, request.Sign(senderKey))
+	description, _ := json.Marshal(request)
+	receipt := nostr.Event{
+		Kind:      entitlement.KindZapReceipt,
+		CreatedAt: nostr.Now(),
+		Tags:      nostr.Tags{{"p", recipient}, {"bolt11", invoice}, {"description", string(description)}},
+	}
+	helpers.AssertNoError(t, receipt.Sign(providerKey))
+	return models.FromNostrEvent(&receipt)
+}
+
+func TestZaps(t *testing.T) {
+	providerKey, provider := newKey()
+	strangerKey, _ := newKey()
+	senderKey, _ := newKey()
+	otherSenderKey, _ := newKey()
+	recipientKey, recipient := newKey()
+
+	m, err := New(config.PaymentsConfig{ZapThreshold: 1000, ZapProviders: []string{provider}})
+	helpers.AssertNoError(t, err)
+	changes := 0
+	m.OnChange(func() { changes++ })
+
+	first := zapReceipt(t, providerKey, senderKey, recipient, "lnbc5u1pexample")
+	admitted, err := m.RecordZap(first)
+	helpers.AssertNoError(t, err)
+	helpers.AssertFalse(t, admitted)
+
+	// Receipts count once, self-zaps and strangers' receipts not at all
+	admitted, err = m.RecordZap(first)
+	helpers.AssertNoError(t, err)
+	helpers.AssertFalse(t, admitted)
+	admitted, err = m.RecordZap(zapReceipt(t, providerKey, recipientKey, recipient, "lnbc10u1pexample"))
+	helpers.AssertNoError(t, err)
+	helpers.AssertFalse(t, admitted)
+	_, err = m.RecordZap(zapReceipt(t, strangerKey, senderKey, recipient, "lnbc10u1pexample"))
+	helpers.AssertTrue(t, errors.Is(err, entitlement.ErrUntrustedZap))
+	helpers.AssertFalse(t, m.Admitted(recipient))
+
+	// A receipt published under the provider's pubkey by anyone else
+	forged := zapReceipt(t, strangerKey, senderKey, recipient, "lnbc10u1pexample").ToNostrEvent()
+	forged.PubKey = provider
+	forged.ID = forged.GetID()
+	_, err = m.RecordZap(models.FromNostrEvent(forged))
+	helpers.AssertTrue(t, errors.Is(err, entitlement.ErrInvalidZap))
+	helpers.AssertFalse(t, m.Admitted(recipient))
+
+	admitted, err = m.RecordZap(zapReceipt(t, providerKey, otherSenderKey, recipient, "lnbc5u1pexample"))
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, admitted)
+	helpers.AssertTrue(t, m.Admitted(recipient))
+	helpers.AssertIntEqual(t, 1, changes)
+	a := m.Admissions()[0]
+	helpers.AssertStringEqual(t, MethodZaps, a.Method)
+	helpers.AssertInt64Equal(t, 1_000_000, a.Msats)
+
+	mismatched := zapReceipt(t, providerKey, senderKey, recipient, "lnbc5u1pexample").ToNostrEvent()
+	mismatched.Tags[0][1] = provider
+	helpers.AssertNoError(t, mismatched.Sign(providerKey))
+	_, err = m.RecordZap(models.FromNostrEvent(mismatched))
+	helpers.AssertTrue(t, errors.Is(err, entitlement.ErrInvalidZap))
+}
+
+func TestPaymentHash(t *testing.T) {
+	hash := testHash(9)
+	got, err := paymentHash(testBolt11("2500u", hash))
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, hex.EncodeToString(hash), got)
+
+	_, err = paymentHash("lnbc2500u1pexample")
+	helpers.AssertErrorContains(t, err, "invalid bolt11")
+}
@@ -0,0 +1,82 @@
+package payments
+
+import (
+	"fmt"
+	"log"
+
+	"mercury-relay/internal/entitlement"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// zapTotal sums the zaps a pubkey received until they reach the threshold
+type zapTotal struct {
+	Pubkey   string   `json:"pubkey"`
+	Msats    int64    `json:"msats"`
+	Receipts []string `json:"receipts"`
+}
+
+// RecordZap counts a zap receipt from a trusted provider towards what its
+// recipient received, admitting the recipient once the total reaches the
+// zap threshold. Receipts are counted once; self-zaps don't count.
+func (m *Manager) RecordZap(receipt *models.Event) (bool, error) {
+	if m.cfg.ZapThreshold <= 0 {
+		return false, nil
+	}
+	zap, err := entitlement.ParseZap(receipt, m.providers)
+	if err != nil {
+		return false, err
+	}
+	recipient, msats := zap.Recipient, zap.Msats
+	if !nostr.IsValidPublicKey(recipient) {
+		return false, fmt.Errorf("%w: zap names no recipient", entitlement.ErrInvalidZap)
+	}
+	if zap.Sender == recipient {
+		return false, nil
+	}
+
+	m.mu.Lock()
+	if a, ok := m.admissions[recipient]; ok && !m.expired(a) {
+		m.mu.Unlock()
+		return false, nil
+	}
+	total, ok := m.zaps[recipient]
+	if !ok {
+		total = &zapTotal{Pubkey: recipient}
+		m.zaps[recipient] = total
+	}
+	for _, id := range total.Receipts {
+		if id == receipt.ID {
+			m.mu.Unlock()
+			return false, nil
+		}
+	}
+	total.Msats += msats
+	total.Receipts = append(total.Receipts, receipt.ID)
+
+	var previous *Admission
+	admitted := total.Msats >= m.cfg.ZapThreshold*1000
+	if admitted {
+		previous = m.admissions[recipient]
+		m.admitLocked(recipient, MethodZaps, total.Msats, receipt.ID)
+		delete(m.zaps, recipient)
+	}
+	if err := m.saveLocked(); err != nil {
+		if admitted {
+			m.restoreLocked(recipient, previous)
+			m.zaps[recipient] = total
+		}
+		total.Msats -= msats
+		total.Receipts = total.Receipts[:len(total.Receipts)-1]
+		m.mu.Unlock()
+		return false, err
+	}
+	m.mu.Unlock()
+
+	if admitted {
+		log.Printf("Admitted %s for receiving %d msats in zaps", recipient, total.Msats)
+		m.changed()
+	}
+	return admitted, nil
+}
@@ -0,0 +1,305 @@
+// Package probation holds back pubkeys the relay has only just met. Fresh
+// keys that publish a burst of events straight away are a strong spam
+// signal, so until a key is old enough or has a clean history it gets a
+// lower rate limit, must attach NIP-13 proof of work, and has its events
+// quarantined once it publishes too fast.
+package probation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr/nip13"
+)
+
+// QuarantineReason marks events quarantined for a new key's velocity
+const QuarantineReason = "New pubkey publishing too fast"
+
+// saveInterval is how often changed first-seen records are written
+const saveInterval = time.Minute
+
+// ErrNotFound is returned when releasing a pubkey that is not on probation
+var ErrNotFound = fmt.Errorf("pubkey not on probation")
+
+// record is what is kept per pubkey
+type record struct {
+	FirstSeen time.Time `json:"first_seen"`
+	Clean     int       `json:"clean_events"`
+	Released  bool      `json:"released,omitempty"`
+
+	// Accepted events within the velocity window, oldest first
+	recent []time.Time
+}
+
+// Status describes a pubkey's probation
+type Status struct {
+	Pubkey             string    `json:"pubkey"`
+	FirstSeen          time.Time `json:"first_seen"`
+	CleanEvents        int       `json:"clean_events"`
+	OnProbation        bool      `json:"on_probation"`
+	Progress           float64   `json:"progress"` // 0 for a new key, 1 once off probation
+	RateLimitPerMinute int       `json:"rate_limit_per_minute,omitempty"`
+	RequiredPoW        int       `json:"required_pow,omitempty"`
+	RecentEvents       int       `json:"recent_events"` // within the velocity window
+}
+
+// Tracker records when pubkeys were first seen and screens the events of
+// those on probation
+type Tracker struct {
+	config    config.ProbationConfig
+	baseLimit int // the rate limit keys relax towards
+
+	mu      sync.Mutex
+	records map[string]*record
+	dirty   bool
+
+	now func() time.Time
+}
+
+// NewTracker returns a tracker loading first-seen records from cfg.Path.
+// Keys on probation relax towards baseLimit events per minute.
+func NewTracker(cfg config.ProbationConfig, baseLimit int) (*Tracker, error) {
+	if cfg.Age <= 0 {
+		cfg.Age = 72 * time.Hour
+	}
+	if cfg.RateLimitPerMinute <= 0 {
+		cfg.RateLimitPerMinute = 5
+	}
+	if cfg.VelocityWindow <= 0 {
+		cfg.VelocityWindow = 10 * time.Minute
+	}
+	if baseLimit < cfg.RateLimitPerMinute {
+		baseLimit = cfg.RateLimitPerMinute
+	}
+
+	t := &Tracker{
+		config:    cfg,
+		baseLimit: baseLimit,
+		records:   make(map[string]*record),
+		now:       time.Now,
+	}
+	if err := t.load(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// Screen checks event against its author's probation. It returns a NIP-01
+// OK message and false when the event must be refused; events over the
+// velocity threshold are accepted but quarantined. Every accepted event
+// counts towards the author's history.
+func (t *Tracker) Screen(event *models.Event) (string, bool) {
+	now := t.now()
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	r, ok := t.records[event.PubKey]
+	if !ok {
+		r = &record{FirstSeen: now}
+		t.records[event.PubKey] = r
+		t.dirty = true
+	}
+
+	progress := t.progress(r, now)
+	if progress >= 1 {
+		r.recent = nil
+		return "", true
+	}
+
+	if required := t.requiredPoW(progress); required > 0 {
+		nostrEvent := event.ToNostrEvent()
+		if !nostrEvent.CheckID() || nip13.CommittedDifficulty(nostrEvent) < required {
+			return fmt.Sprintf("pow: new pubkeys need %d bits of committed proof of work (NIP-13)", required), false
+		}
+	}
+
+	r.recent = pruneBefore(r.recent, now.Add(-t.config.VelocityWindow))
+	limit := t.rateLimit(progress)
+	if countSince(r.recent, now.Add(-time.Minute)) >= limit {
+		return fmt.Sprintf("rate-limited: new pubkeys may publish %d events per minute", limit), false
+	}
+	r.recent = append(r.recent, now)
+
+	if t.config.QuarantineAfter > 0 && len(r.recent) > t.config.QuarantineAfter && !event.IsQuarantined {
+		event.IsQuarantined = true
+		event.QuarantineReason = QuarantineReason
+	}
+	if !event.IsQuarantined {
+		r.Clean++
+		t.dirty = true
+	}
+	return "", true
+}
+
+// Status returns pubkey's probation, or false if the relay has not seen it
+func (t *Tracker) Status(pubkey string) (Status, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.records[pubkey]
+	if !ok {
+		return Status{}, false
+	}
+	return t.statusLocked(pubkey, r, t.now()), true
+}
+
+// OnProbation lists the pubkeys on probation, newest first
+func (t *Tracker) OnProbation() []Status {
+	now := t.now()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	statuses := []Status{}
+	for pubkey, r := range t.records {
+		if t.progress(r, now) < 1 {
+			statuses = append(statuses, t.statusLocked(pubkey, r, now))
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].FirstSeen.After(statuses[j].FirstSeen)
+	})
+	return statuses
+}
+
+// Release ends pubkey's probation early
+func (t *Tracker) Release(pubkey string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	r, ok := t.records[pubkey]
+	if !ok || t.progress(r, t.now()) >= 1 {
+		return ErrNotFound
+	}
+	r.Released = true
+	r.recent = nil
+	t.dirty = true
+	return nil
+}
+
+// Run saves changed records every minute and once more when ctx is done
+func (t *Tracker) Run(ctx context.Context) {
+	ticker := time.NewTicker(saveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			t.save()
+			return
+		case <-ticker.C:
+			t.save()
+		}
+	}
+}
+
+func (t *Tracker) statusLocked(pubkey string, r *record, now time.Time) Status {
+	progress := t.progress(r, now)
+	status := Status{
+		Pubkey:       pubkey,
+		FirstSeen:    r.FirstSeen,
+		CleanEvents:  r.Clean,
+		OnProbation:  progress < 1,
+		Progress:     math.Round(progress*100) / 100,
+		RecentEvents: countSince(r.recent, now.Add(-t.config.VelocityWindow)),
+	}
+	if status.OnProbation {
+		status.RateLimitPerMinute = t.rateLimit(progress)
+		status.RequiredPoW = t.requiredPoW(progress)
+	}
+	return status
+}
+
+// progress is how far r is through its probation: the further along of its
+// age and its clean events, from 0 to 1
+func (t *Tracker) progress(r *record, now time.Time) float64 {
+	if r.Released {
+		return 1
+	}
+	progress := float64(now.Sub(r.FirstSeen)) / float64(t.config.Age)
+	if t.config.CleanEvents > 0 {
+		progress = max(progress, float64(r.Clean)/float64(t.config.CleanEvents))
+	}
+	return min(max(progress, 0), 1)
+}
+
+// rateLimit rises linearly from the probation limit to the base limit
+func (t *Tracker) rateLimit(progress float64) int {
+	span := float64(t.baseLimit - t.config.RateLimitPerMinute)
+	return t.config.RateLimitPerMinute + int(span*progress)
+}
+
+// requiredPoW falls linearly from MinPoW to none
+func (t *Tracker) requiredPoW(progress float64) int {
+	return int(math.Ceil(float64(t.config.MinPoW) * (1 - progress)))
+}
+
+func pruneBefore(times []time.Time, cutoff time.Time) []time.Time {
+	i := 0
+	for i < len(times) && times[i].Before(cutoff) {
+		i++
+	}
+	return times[i:]
+}
+
+func countSince(times []time.Time, cutoff time.Time) int {
+	return len(pruneBefore(times, cutoff))
+}
+
+func (t *Tracker) load() error {
+	if t.config.Path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(t.config.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", t.config.Path, err)
+	}
+	if err := json.Unmarshal(data, &t.records); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", t.config.Path, err)
+	}
+	return nil
+}
+
+// save writes the records if they changed since the last save
+func (t *Tracker) save() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.dirty || t.config.Path == "" {
+		return
+	}
+	if err := t.saveLocked(); err != nil {
+		log.Printf("Failed to save pubkey probation records: %v", err)
+		return
+	}
+	t.dirty = false
+}
+
+// saveLocked atomically writes the records to path. Callers must hold t.mu.
+func (t *Tracker) saveLocked() error {
+	data, err := json.Marshal(t.records)
+	if err != nil {
+		return fmt.Errorf("failed to encode probation records: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(t.config.Path), 0755); err != nil {
+		return fmt.Errorf("failed to write probation records: %w", err)
+	}
+	tmp := t.config.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write probation records: %w", err)
+	}
+	if err := os.Rename(tmp, t.config.Path); err != nil {
+		return fmt.Errorf("failed to write probation records: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,148 @@
+package probation
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip13"
+)
+
+var pubkey = strings.Repeat("a", 64)
+
+// minedEvent returns an event by pubkey whose ID commits to difficulty bits
+func minedEvent(t *testing.T, content string, difficulty int) *models.Event {
+	t.Helper()
+	event := nostr.Event{PubKey: pubkey, CreatedAt: nostr.Now(), Kind: 1, Content: content, Tags: nostr.Tags{}}
+	if difficulty > 0 {
+		nonce, err := nip13.DoWork(context.Background(), event, difficulty)
+		helpers.AssertNoError(t, err)
+		event.Tags = append(event.Tags, nonce)
+	}
+	event.ID = event.GetID()
+	return models.FromNostrEvent(&event)
+}
+
+func newTestTracker(t *testing.T, cfg config.ProbationConfig) (*Tracker, *time.Time) {
+	t.Helper()
+	tracker, err := NewTracker(cfg, 100)
+	helpers.AssertNoError(t, err)
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	tracker.now = func() time.Time { return now }
+	return tracker, &now
+}
+
+func TestProofOfWork(t *testing.T) {
+	tracker, now := newTestTracker(t, config.ProbationConfig{Age: time.Hour, MinPoW: 8, RateLimitPerMinute: 100})
+
+	message, ok := tracker.Screen(minedEvent(t, "no work", 0))
+	helpers.AssertFalse(t, ok)
+	helpers.AssertStringEqual(t, "pow: new pubkeys need 8 bits of committed proof of work (NIP-13)", message)
+
+	// A forged ID claiming zeros is not work
+	forged := minedEvent(t, "forged", 0)
+	forged.ID = "0000" + forged.ID[4:]
+	_, ok = tracker.Screen(forged)
+	helpers.AssertFalse(t, ok)
+
+	_, ok = tracker.Screen(minedEvent(t, "mined", 8))
+	helpers.AssertTrue(t, ok)
+
+	// Half way through probation half the work is required
+	*now = now.Add(30 * time.Minute)
+	status, _ := tracker.Status(pubkey)
+	helpers.AssertIntEqual(t, 4, status.RequiredPoW)
+	_, ok = tracker.Screen(minedEvent(t, "less work", 4))
+	helpers.AssertTrue(t, ok)
+
+	*now = now.Add(30 * time.Minute)
+	_, ok = tracker.Screen(minedEvent(t, "graduated", 0))
+	helpers.AssertTrue(t, ok)
+	status, _ = tracker.Status(pubkey)
+	helpers.AssertFalse(t, status.OnProbation)
+}
+
+func TestVelocity(t *testing.T) {
+	tracker, now := newTestTracker(t, config.ProbationConfig{
+		Age: 24 * time.Hour, CleanEvents: 1000, RateLimitPerMinute: 3,
+		QuarantineAfter: 5, VelocityWindow: 10 * time.Minute,
+	})
+
+	for i := 0; i < 3; i++ {
+		_, ok := tracker.Screen(minedEvent(t, "hello", 0))
+		helpers.AssertTrue(t, ok)
+	}
+	message, ok := tracker.Screen(minedEvent(t, "too fast", 0))
+	helpers.AssertFalse(t, ok)
+	helpers.AssertStringEqual(t, "rate-limited: new pubkeys may publish 3 events per minute", message)
+
+	// Within the rate limit but over the velocity threshold: quarantined
+	var last *models.Event
+	for i := 0; i < 3; i++ {
+		*now = now.Add(2 * time.Minute)
+		last = minedEvent(t, "steady", 0)
+		_, ok := tracker.Screen(last)
+		helpers.AssertTrue(t, ok)
+	}
+	helpers.AssertTrue(t, last.IsQuarantined)
+	helpers.AssertStringEqual(t, QuarantineReason, last.QuarantineReason)
+
+	status, _ := tracker.Status(pubkey)
+	helpers.AssertIntEqual(t, 5, status.CleanEvents)
+	helpers.AssertIntEqual(t, 6, status.RecentEvents)
+	helpers.AssertIntEqual(t, 1, len(tracker.OnProbation()))
+
+	// Once the window passes the key may publish cleanly again
+	*now = now.Add(15 * time.Minute)
+	event := minedEvent(t, "later", 0)
+	tracker.Screen(event)
+	helpers.AssertFalse(t, event.IsQuarantined)
+
+	helpers.AssertNoError(t, tracker.Release(pubkey))
+	helpers.AssertIntEqual(t, 0, len(tracker.OnProbation()))
+	helpers.AssertTrue(t, tracker.Release(pubkey) == ErrNotFound)
+}
+
+func TestCleanHistoryRelaxes(t *testing.T) {
+	tracker, now := newTestTracker(t, config.ProbationConfig{Age: 24 * time.Hour, CleanEvents: 10, RateLimitPerMinute: 10})
+
+	for i := 0; i < 5; i++ {
+		*now = now.Add(time.Minute)
+		tracker.Screen(minedEvent(t, "clean", 0))
+	}
+	status, _ := tracker.Status(pubkey)
+	helpers.AssertTrue(t, status.OnProbation)
+	helpers.AssertTrue(t, status.Progress == 0.5)
+	helpers.AssertIntEqual(t, 55, status.RateLimitPerMinute)
+
+	for i := 0; i < 5; i++ {
+		*now = now.Add(time.Minute)
+		tracker.Screen(minedEvent(t, "clean", 0))
+	}
+	status, _ = tracker.Status(pubkey)
+	helpers.AssertFalse(t, status.OnProbation)
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pubkeys.json")
+	tracker, now := newTestTracker(t, config.ProbationConfig{Path: path, Age: time.Hour})
+	tracker.Screen(minedEvent(t, "hello", 0))
+	tracker.save()
+
+	// After a restart the key keeps its first-seen time
+	reloaded, err := NewTracker(config.ProbationConfig{Path: path, Age: time.Hour}, 100)
+	helpers.AssertNoError(t, err)
+	reloaded.now = func() time.Time { return now.Add(2 * time.Hour) }
+	status, ok := reloaded.Status(pubkey)
+	helpers.AssertTrue(t, ok)
+	helpers.AssertTrue(t, status.FirstSeen.Equal(*now))
+	helpers.AssertIntEqual(t, 1, status.CleanEvents)
+	helpers.AssertFalse(t, status.OnProbation)
+}
@@ -0,0 +1,142 @@
+// Package problem writes RFC 7807 application/problem+json error responses
+// and carries the request IDs used to correlate them with logs.
+package problem
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"regexp"
+)
+
+// ContentType is the media type of problem responses
+const ContentType = "application/problem+json"
+
+// RequestIDHeader is echoed on every response and accepted from clients
+const RequestIDHeader = "X-Request-ID"
+
+// Machine-readable error codes
+const (
+	CodeInvalidRequest      = "invalid_request"
+	CodeInvalidFilter       = "invalid_filter"
+	CodeInvalidEvent        = "invalid_event"
+	CodeUnauthorized        = "unauthorized"
+	CodeForbidden           = "forbidden"
+	CodeNotFound            = "not_found"
+	CodeMethodNotAllowed    = "method_not_allowed"
+	CodeConflict            = "conflict"
+	CodeQuotaExceeded       = "quota_exceeded"
+	CodeInternal            = "internal_error"
+	CodeNotImplemented      = "not_implemented"
+	CodeUpstreamUnavailable = "upstream_unavailable"
+	CodeUnavailable         = "service_unavailable"
+	CodeMaintenance         = "maintenance"
+	CodePaymentRequired     = "payment_required"
+)
+
+// Problem is an RFC 7807 problem details object with Mercury's code and
+// request_id extension members. Success and Error mirror the older
+// {"success": false, "error": ...} envelope so existing clients keep working.
+type Problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Code      string `json:"code"`
+	RequestID string `json:"request_id,omitempty"`
+	Success   bool   `json:"success"`
+	Error     string `json:"error,omitempty"`
+}
+
+// TypeURI returns the problem type URI for a code
+func TypeURI(code string) string {
+	return "urn:mercury-relay:problem:" + code
+}
+
+// CodeForStatus maps an HTTP status to its default error code
+func CodeForStatus(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return CodeInvalidRequest
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusPaymentRequired:
+		return CodePaymentRequired
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusMethodNotAllowed:
+		return CodeMethodNotAllowed
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusTooManyRequests:
+		return CodeQuotaExceeded
+	case http.StatusNotImplemented:
+		return CodeNotImplemented
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return CodeUpstreamUnavailable
+	case http.StatusServiceUnavailable:
+		return CodeUnavailable
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeInvalidRequest
+}
+
+// Write sends a problem response. An empty code is derived from status, and
+// the request ID is taken from the response headers set by Middleware.
+func Write(w http.ResponseWriter, status int, code, detail string) {
+	if code == "" {
+		code = CodeForStatus(status)
+	}
+
+	p := Problem{
+		Type:      TypeURI(code),
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    detail,
+		Code:      code,
+		RequestID: w.Header().Get(RequestIDHeader),
+		Error:     detail,
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(p)
+}
+
+type contextKey struct{}
+
+// validRequestID limits client supplied IDs to something safe to log
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// Middleware assigns every request an ID, reusing a well-formed client
+// supplied X-Request-ID, and echoes it in the response headers
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(RequestIDHeader)
+		if !validRequestID.MatchString(id) {
+			id = newRequestID()
+		}
+
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(req.Context(), contextKey{}, id)
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// RequestID returns the ID Middleware assigned to the request
+func RequestID(req *http.Request) string {
+	id, _ := req.Context().Value(contextKey{}).(string)
+	return id
+}
+
+func newRequestID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
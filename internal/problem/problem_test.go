@@ -0,0 +1,75 @@
+package problem
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWrite(t *testing.T) {
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if RequestID(req) == "" {
+			t.Error("Expected request ID in context")
+		}
+		Write(w, http.StatusTooManyRequests, "", "slow down")
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "client-req-42")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	if w.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Expected %s, got %s", ContentType, ct)
+	}
+	if id := w.Header().Get(RequestIDHeader); id != "client-req-42" {
+		t.Errorf("Expected client request ID to be echoed, got %q", id)
+	}
+
+	var p Problem
+	if err := json.Unmarshal(w.Body.Bytes(), &p); err != nil {
+		t.Fatalf("Invalid problem body: %v", err)
+	}
+	if p.Code != CodeQuotaExceeded || p.Type != TypeURI(CodeQuotaExceeded) || p.Status != 429 {
+		t.Errorf("Unexpected problem: %+v", p)
+	}
+	if p.Detail != "slow down" || p.RequestID != "client-req-42" || p.Title != "Too Many Requests" {
+		t.Errorf("Unexpected problem: %+v", p)
+	}
+}
+
+func TestMiddlewareGeneratesRequestID(t *testing.T) {
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "bad id\nwith newline")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	id := w.Header().Get(RequestIDHeader)
+	if id == "" || id == "bad id\nwith newline" {
+		t.Errorf("Expected a generated request ID, got %q", id)
+	}
+}
+
+func TestCodeForStatus(t *testing.T) {
+	cases := map[int]string{
+		http.StatusBadRequest:          CodeInvalidRequest,
+		http.StatusUnauthorized:        CodeUnauthorized,
+		http.StatusPaymentRequired:     CodePaymentRequired,
+		http.StatusTooManyRequests:     CodeQuotaExceeded,
+		http.StatusBadGateway:          CodeUpstreamUnavailable,
+		http.StatusServiceUnavailable:  CodeUnavailable,
+		http.StatusInternalServerError: CodeInternal,
+		http.StatusTeapot:              CodeInvalidRequest,
+	}
+	for status, code := range cases {
+		if got := CodeForStatus(status); got != code {
+			t.Errorf("CodeForStatus(%d) = %s, want %s", status, got, code)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package profiling
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RWMutex is a sync.RWMutex that measures how long callers wait for it.
+// The uncontended path costs one TryLock; only waits are timed. The zero
+// value is an unlocked mutex.
+type RWMutex struct {
+	sync.RWMutex
+
+	acquired  atomic.Uint64
+	contended atomic.Uint64
+	waitNanos atomic.Int64
+	maxNanos  atomic.Int64
+}
+
+// Lock locks for writing, timing the wait when the mutex is held
+func (m *RWMutex) Lock() {
+	m.acquired.Add(1)
+	if m.RWMutex.TryLock() {
+		return
+	}
+	start := time.Now()
+	m.RWMutex.Lock()
+	m.recordWait(time.Since(start))
+}
+
+// RLock locks for reading, timing the wait when a writer holds the mutex
+func (m *RWMutex) RLock() {
+	m.acquired.Add(1)
+	if m.RWMutex.TryRLock() {
+		return
+	}
+	start := time.Now()
+	m.RWMutex.RLock()
+	m.recordWait(time.Since(start))
+}
+
+func (m *RWMutex) recordWait(wait time.Duration) {
+	m.contended.Add(1)
+	m.waitNanos.Add(int64(wait))
+	for {
+		max := m.maxNanos.Load()
+		if int64(wait) <= max || m.maxNanos.CompareAndSwap(max, int64(wait)) {
+			return
+		}
+	}
+}
+
+// MutexStats summarizes the waits on a tracked mutex
+type MutexStats struct {
+	Name      string  `json:"name"`
+	Acquired  uint64  `json:"acquired"`
+	Contended uint64  `json:"contended"`
+	Ratio     float64 `json:"contention_ratio"`
+	TotalWait string  `json:"total_wait"`
+	MaxWait   string  `json:"max_wait"`
+	waitNanos int64
+}
+
+// Stats returns the waits recorded so far under name
+func (m *RWMutex) Stats(name string) MutexStats {
+	s := MutexStats{
+		Name:      name,
+		Acquired:  m.acquired.Load(),
+		Contended: m.contended.Load(),
+		waitNanos: m.waitNanos.Load(),
+		MaxWait:   time.Duration(m.maxNanos.Load()).String(),
+	}
+	s.TotalWait = time.Duration(s.waitNanos).String()
+	if s.Acquired > 0 {
+		s.Ratio = float64(s.Contended) / float64(s.Acquired)
+	}
+	return s
+}
@@ -0,0 +1,354 @@
+// Package profiling keeps a cheap, always-on picture of the relay's runtime
+// for production triage: goroutine counts, memory, the busiest allocation
+// sites and where goroutines wait on locks. Full pprof profiles are served
+// separately to admins.
+package profiling
+
+import (
+	"bytes"
+	"context"
+	"runtime"
+	"runtime/pprof"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/config"
+)
+
+const (
+	// historySize is how many goroutine counts are kept
+	historySize = 60
+	// maxRecords bounds a single runtime profile read; larger profiles are
+	// left out of the summary
+	maxRecords = 4096
+)
+
+// Site is a code location with the cost attributed to it
+type Site struct {
+	Function string `json:"function"`
+	File     string `json:"file,omitempty"`
+	Line     int    `json:"line,omitempty"`
+	// Allocation sites
+	AllocBytes   int64 `json:"alloc_bytes,omitempty"`   // since the previous sample
+	AllocObjects int64 `json:"alloc_objects,omitempty"` // since the previous sample
+	InUseBytes   int64 `json:"in_use_bytes,omitempty"`
+	// Contention sites
+	Contentions int64  `json:"contentions,omitempty"` // since the previous sample
+	Delay       string `json:"delay,omitempty"`       // since the previous sample
+	delayNanos  int64
+}
+
+// Memory is a snapshot of the heap and garbage collector
+type Memory struct {
+	HeapAllocBytes uint64 `json:"heap_alloc_bytes"`
+	HeapObjects    uint64 `json:"heap_objects"`
+	SysBytes       uint64 `json:"sys_bytes"`
+	NumGC          uint32 `json:"num_gc"`
+	GCPauseTotal   string `json:"gc_pause_total"`
+	LastGCPause    string `json:"last_gc_pause"`
+}
+
+// Summary is the latest sample
+type Summary struct {
+	SampledAt        time.Time    `json:"sampled_at"`
+	Interval         string       `json:"interval"`
+	Goroutines       int          `json:"goroutines"`
+	GoroutineHistory []int        `json:"goroutine_history"` // oldest first
+	Memory           Memory       `json:"memory"`
+	TopAllocations   []Site       `json:"top_allocations"`
+	MutexContention  []Site       `json:"mutex_contention"`
+	Blocking         []Site       `json:"blocking,omitempty"`
+	Mutexes          []MutexStats `json:"mutexes"`
+	Pprof            bool         `json:"pprof"`
+}
+
+// Sampler samples the runtime every interval
+type Sampler struct {
+	config config.ProfilingConfig
+
+	mu      sync.Mutex
+	mutexes map[string]*RWMutex
+	summary Summary
+	history []int
+
+	// Cumulative profile values at the previous sample, by site
+	lastAlloc map[string][2]int64
+	lastMutex map[string][2]int64
+	lastBlock map[string][2]int64
+}
+
+// NewSampler enables mutex (and, with BlockRate, blocking) profiling in the
+// runtime at the configured rates
+func NewSampler(cfg config.ProfilingConfig) *Sampler {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 30 * time.Second
+	}
+	if cfg.TopN <= 0 {
+		cfg.TopN = 10
+	}
+	if cfg.MutexFraction > 0 {
+		runtime.SetMutexProfileFraction(cfg.MutexFraction)
+	}
+	if cfg.BlockRate > 0 {
+		runtime.SetBlockProfileRate(cfg.BlockRate)
+	}
+	return &Sampler{
+		config:    cfg,
+		mutexes:   make(map[string]*RWMutex),
+		lastAlloc: make(map[string][2]int64),
+		lastMutex: make(map[string][2]int64),
+		lastBlock: make(map[string][2]int64),
+	}
+}
+
+// PprofEnabled reports whether admins may download pprof profiles
+func (s *Sampler) PprofEnabled() bool {
+	return s.config.Pprof
+}
+
+// Track reports the waits on m under name in every summary
+func (s *Sampler) Track(name string, m *RWMutex) {
+	s.mu.Lock()
+	s.mutexes[name] = m
+	s.mu.Unlock()
+}
+
+// Run samples every interval until ctx is done
+func (s *Sampler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.config.Interval)
+	defer ticker.Stop()
+	for {
+		s.Sample()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Sample takes a sample now
+func (s *Sampler) Sample() {
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	goroutines := runtime.NumGoroutine()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.history = append(s.history, goroutines)
+	if len(s.history) > historySize {
+		s.history = s.history[len(s.history)-historySize:]
+	}
+
+	summary := Summary{
+		SampledAt:        time.Now(),
+		Interval:         s.config.Interval.String(),
+		Goroutines:       goroutines,
+		GoroutineHistory: append([]int(nil), s.history...),
+		Memory: Memory{
+			HeapAllocBytes: mem.HeapAlloc,
+			HeapObjects:    mem.HeapObjects,
+			SysBytes:       mem.Sys,
+			NumGC:          mem.NumGC,
+			GCPauseTotal:   time.Duration(mem.PauseTotalNs).String(),
+			LastGCPause:    time.Duration(mem.PauseNs[(mem.NumGC+255)%256]).String(),
+		},
+		TopAllocations:  s.allocations(),
+		MutexContention: s.contention(runtime.MutexProfile, s.lastMutex),
+		Mutexes:         []MutexStats{},
+		Pprof:           s.config.Pprof,
+	}
+	if s.config.BlockRate > 0 {
+		summary.Blocking = s.contention(runtime.BlockProfile, s.lastBlock)
+	}
+
+	for name, m := range s.mutexes {
+		summary.Mutexes = append(summary.Mutexes, m.Stats(name))
+	}
+	sort.Slice(summary.Mutexes, func(i, j int) bool {
+		return summary.Mutexes[i].waitNanos > summary.Mutexes[j].waitNanos
+	})
+	s.summary = summary
+}
+
+// Summary returns the latest sample, taking one if none was taken yet
+func (s *Sampler) Summary() Summary {
+	s.mu.Lock()
+	sampled := !s.summary.SampledAt.IsZero()
+	s.mu.Unlock()
+	if !sampled {
+		s.Sample()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.summary
+}
+
+// allocations returns the sites that allocated most since the previous
+// sample. s.mu must be held.
+func (s *Sampler) allocations() []Site {
+	records := make([]runtime.MemProfileRecord, 256)
+	n, ok := runtime.MemProfile(records, true)
+	for !ok && n <= maxRecords {
+		// Sites were added since the count; read again with room to spare
+		records = make([]runtime.MemProfileRecord, n+64)
+		n, ok = runtime.MemProfile(records, true)
+	}
+	if !ok {
+		return nil
+	}
+
+	sites := make(map[string]*Site)
+	totals := make(map[string][2]int64)
+	for _, r := range records[:n] {
+		site := siteOf(r.Stack())
+		key := site.Function
+		if existing, ok := sites[key]; ok {
+			site = existing
+		} else {
+			sites[key] = site
+		}
+		site.InUseBytes += r.InUseBytes()
+		t := totals[key]
+		totals[key] = [2]int64{t[0] + r.AllocBytes, t[1] + r.AllocObjects}
+	}
+
+	out := make([]Site, 0, len(sites))
+	for key, site := range sites {
+		last := s.lastAlloc[key]
+		site.AllocBytes = totals[key][0] - last[0]
+		site.AllocObjects = totals[key][1] - last[1]
+		if site.AllocBytes > 0 || site.InUseBytes > 0 {
+			out = append(out, *site)
+		}
+	}
+	s.lastAlloc = totals
+
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].AllocBytes != out[j].AllocBytes {
+			return out[i].AllocBytes > out[j].AllocBytes
+		}
+		return out[i].InUseBytes > out[j].InUseBytes
+	})
+	return s.top(out)
+}
+
+// contention returns the sites that waited most since the previous sample
+// in the mutex or block profile read by profile. s.mu must be held.
+func (s *Sampler) contention(profile func([]runtime.BlockProfileRecord) (int, bool), last map[string][2]int64) []Site {
+	records := make([]runtime.BlockProfileRecord, 256)
+	n, ok := profile(records)
+	for !ok && n <= maxRecords {
+		records = make([]runtime.BlockProfileRecord, n+64)
+		n, ok = profile(records)
+	}
+	if !ok {
+		return nil
+	}
+
+	sites := make(map[string]*Site)
+	totals := make(map[string][2]int64)
+	for _, r := range records[:n] {
+		site := siteOf(r.Stack())
+		key := site.Function
+		if _, ok := sites[key]; !ok {
+			sites[key] = site
+		}
+		t := totals[key]
+		totals[key] = [2]int64{t[0] + r.Count, t[1] + cyclesToNanos(r.Cycles)}
+	}
+
+	out := make([]Site, 0, len(sites))
+	for key, site := range sites {
+		previous := last[key]
+		site.Contentions = totals[key][0] - previous[0]
+		site.delayNanos = totals[key][1] - previous[1]
+		site.Delay = time.Duration(site.delayNanos).String()
+		if site.Contentions > 0 {
+			out = append(out, *site)
+		}
+	}
+	for key, total := range totals {
+		last[key] = total
+	}
+
+	sort.Slice(out, func(i, j int) bool { return out[i].delayNanos > out[j].delayNanos })
+	return s.top(out)
+}
+
+func (s *Sampler) top(sites []Site) []Site {
+	if len(sites) > s.config.TopN {
+		sites = sites[:s.config.TopN]
+	}
+	return sites
+}
+
+// siteOf attributes a stack to its first frame outside the runtime and
+// sync packages
+func siteOf(stack []uintptr) *Site {
+	frames := runtime.CallersFrames(stack)
+	var first *Site
+	for {
+		frame, more := frames.Next()
+		site := &Site{Function: frame.Function, File: frame.File, Line: frame.Line}
+		if first == nil {
+			first = site
+		}
+		if !internalFrame(frame.Function) {
+			return site
+		}
+		if !more {
+			break
+		}
+	}
+	if first == nil {
+		first = &Site{Function: "unknown"}
+	}
+	return first
+}
+
+func internalFrame(function string) bool {
+	for _, prefix := range []string{"runtime.", "sync.", "internal/", "mercury-relay/internal/profiling.(*RWMutex)"} {
+		if strings.HasPrefix(function, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	cyclesOnce      sync.Once
+	cyclesPerSecond float64
+)
+
+// cyclesToNanos converts profile cycles to nanoseconds
+func cyclesToNanos(cycles int64) int64 {
+	cyclesOnce.Do(func() {
+		cyclesPerSecond = estimateCyclesPerSecond()
+	})
+	if cyclesPerSecond <= 0 {
+		return 0
+	}
+	return int64(float64(cycles) / cyclesPerSecond * 1e9)
+}
+
+// estimateCyclesPerSecond reads the tick rate the runtime reports in the
+// text form of the mutex profile
+func estimateCyclesPerSecond() float64 {
+	var buf bytes.Buffer
+	if err := pprof.Lookup("mutex").WriteTo(&buf, 1); err != nil {
+		return 0
+	}
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if value, ok := strings.CutPrefix(line, "cycles/second="); ok {
+			rate, _ := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			return rate
+		}
+	}
+	return 0
+}
@@ -0,0 +1,103 @@
+package profiling
+
+import (
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/test/helpers"
+)
+
+var sink [][]byte
+
+//go:noinline
+func allocateBuffers() {
+	for i := 0; i < 2000; i++ {
+		sink = append(sink, make([]byte, 4096))
+	}
+}
+
+func TestRWMutexStats(t *testing.T) {
+	var m RWMutex
+	m.RLock()
+	m.RUnlock()
+	helpers.AssertIntEqual(t, 0, int(m.Stats("idle").Contended))
+
+	m.Lock()
+	done := make(chan struct{})
+	go func() {
+		m.RLock()
+		m.RUnlock()
+		close(done)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	m.Unlock()
+	<-done
+
+	stats := m.Stats("conn")
+	helpers.AssertStringEqual(t, "conn", stats.Name)
+	helpers.AssertIntEqual(t, 3, int(stats.Acquired))
+	helpers.AssertIntEqual(t, 1, int(stats.Contended))
+	wait, err := time.ParseDuration(stats.MaxWait)
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, wait >= 10*time.Millisecond)
+}
+
+func TestSampler(t *testing.T) {
+	s := NewSampler(config.ProfilingConfig{MutexFraction: 1, TopN: 50})
+	var conn RWMutex
+	s.Track("relay.connMutex", &conn)
+
+	s.Sample()
+	allocateBuffers()
+
+	// Contend a plain mutex so it shows up in the runtime's mutex profile
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				mu.Lock()
+				time.Sleep(10 * time.Microsecond)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	// Allocations show up in the profile once a GC cycle completes
+	runtime.GC()
+	s.Sample()
+
+	summary := s.Summary()
+	helpers.AssertTrue(t, summary.Goroutines > 0)
+	helpers.AssertIntEqual(t, 2, len(summary.GoroutineHistory))
+	helpers.AssertTrue(t, summary.Memory.HeapAllocBytes > 0)
+	helpers.AssertIntEqual(t, 1, len(summary.Mutexes))
+	helpers.AssertStringEqual(t, "relay.connMutex", summary.Mutexes[0].Name)
+
+	found := false
+	for _, site := range summary.TopAllocations {
+		if strings.HasSuffix(site.Function, "allocateBuffers") {
+			found = site.AllocBytes > 0
+		}
+	}
+	helpers.AssertTrue(t, found)
+
+	helpers.AssertTrue(t, len(summary.MutexContention) > 0)
+	for _, site := range summary.MutexContention {
+		helpers.AssertFalse(t, strings.HasPrefix(site.Function, "sync."))
+	}
+
+	// Deltas: nothing new was allocated by allocateBuffers since
+	s.Sample()
+	for _, site := range s.Summary().TopAllocations {
+		if strings.HasSuffix(site.Function, "allocateBuffers") {
+			helpers.AssertIntEqual(t, 0, int(site.AllocBytes))
+		}
+	}
+}
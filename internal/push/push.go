@@ -0,0 +1,498 @@
+// Package push keeps users' filters on the server and notifies them of
+// matching events while they are offline. Each subscription delivers to a
+// webhook, an ntfy topic or a WebPush endpoint; events are batched per
+// subscription and failed deliveries back off exponentially.
+package push
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Delivery target types
+const (
+	TargetWebhook = "webhook"
+	TargetNtfy    = "ntfy"
+	TargetWebPush = "webpush"
+)
+
+var (
+	// ErrNotFound is returned for unknown subscriptions and subscriptions of
+	// other users
+	ErrNotFound = fmt.Errorf("subscription not found")
+	// ErrLimit is returned when a user has as many subscriptions as allowed
+	ErrLimit = fmt.Errorf("subscription limit reached")
+)
+
+// Target is where a subscription's notifications go
+type Target struct {
+	Type string `json:"type"` // webhook, ntfy or webpush
+	// URL is the webhook URL, the ntfy topic URL (https://ntfy.sh/topic) or
+	// the WebPush endpoint
+	URL string `json:"url"`
+	// Token is an ntfy access token
+	Token string `json:"token,omitempty"`
+	// P256DH and Auth are the WebPush subscription keys (base64url)
+	P256DH string `json:"p256dh,omitempty"`
+	Auth   string `json:"auth,omitempty"`
+	// Secret signs webhook bodies; generated by the relay
+	Secret string `json:"secret,omitempty"`
+}
+
+// Subscription is a stored filter and where to deliver its matches
+type Subscription struct {
+	ID        string       `json:"id"`
+	Owner     string       `json:"owner"`
+	Name      string       `json:"name,omitempty"`
+	Filter    nostr.Filter `json:"filter"`
+	Target    Target       `json:"target"`
+	CreatedAt time.Time    `json:"created_at"`
+
+	// Delivery state
+	Delivered     int64      `json:"delivered"`
+	Dropped       int64      `json:"dropped"`
+	Failures      int        `json:"failures"`
+	LastError     string     `json:"last_error,omitempty"`
+	LastDelivered *time.Time `json:"last_delivered,omitempty"`
+	NextAttempt   *time.Time `json:"next_attempt,omitempty"`
+	Disabled      bool       `json:"disabled,omitempty"` // the push service expired the endpoint
+	Pending       int        `json:"pending"`
+}
+
+// Redacted returns s without the target's credentials, for listing
+func (s Subscription) Redacted() Subscription {
+	s.Target.Token = ""
+	s.Target.Auth = ""
+	s.Target.Secret = ""
+	return s
+}
+
+// entry is a subscription with the events waiting to be delivered
+type entry struct {
+	sub     Subscription
+	pending []*models.Event
+	since   time.Time // when the oldest pending event arrived
+	sending bool
+}
+
+// state is what is kept in Path
+type state struct {
+	VAPIDPrivateKey string         `json:"vapid_private_key,omitempty"`
+	Subscriptions   []Subscription `json:"subscriptions"`
+}
+
+// Manager stores subscriptions and delivers their notifications
+type Manager struct {
+	config config.PushConfig
+	client *httpClient
+	vapid  *vapidKey
+
+	mu      sync.Mutex
+	entries map[string]*entry
+
+	online     func(pubkey string) bool
+	canAccess  func(pubkey string, event *models.Event) bool
+	now        func() time.Time
+	retryDelay time.Duration // first backoff step
+}
+
+// NewManager loads the subscriptions in cfg.Path
+func NewManager(cfg config.PushConfig) (*Manager, error) {
+	if cfg.MaxPerUser <= 0 {
+		cfg.MaxPerUser = 10
+	}
+	if cfg.BatchWindow <= 0 {
+		cfg.BatchWindow = 30 * time.Second
+	}
+	if cfg.MaxBatch <= 0 {
+		cfg.MaxBatch = 50
+	}
+	if cfg.MaxBackoff <= 0 {
+		cfg.MaxBackoff = time.Hour
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 10 * time.Second
+	}
+
+	m := &Manager{
+		config:     cfg,
+		client:     newHTTPClient(cfg.Timeout, cfg.AllowPrivateTargets),
+		entries:    make(map[string]*entry),
+		online:     func(string) bool { return false },
+		canAccess:  func(string, *models.Event) bool { return true },
+		now:        time.Now,
+		retryDelay: 30 * time.Second,
+	}
+
+	st, err := m.load()
+	if err != nil {
+		return nil, err
+	}
+	for _, sub := range st.Subscriptions {
+		m.entries[sub.ID] = &entry{sub: sub}
+	}
+
+	key := cfg.VAPIDPrivateKey
+	if key == "" {
+		key = st.VAPIDPrivateKey
+	}
+	if m.vapid, err = loadVAPIDKey(key); err != nil {
+		return nil, err
+	}
+	if cfg.VAPIDPrivateKey == "" && st.VAPIDPrivateKey == "" {
+		// Keep the generated key; browsers subscribed with its public half
+		m.mu.Lock()
+		err = m.saveLocked()
+		m.mu.Unlock()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// SetPresence tells the manager which users are connected; they get no
+// notifications
+func (m *Manager) SetPresence(online func(pubkey string) bool) {
+	m.online = online
+}
+
+// SetAccessCheck limits notifications to events the owner may read
+func (m *Manager) SetAccessCheck(canAccess func(pubkey string, event *models.Event) bool) {
+	m.canAccess = canAccess
+}
+
+// VAPIDPublicKey returns the application server key browsers subscribe
+// with (base64url, uncompressed P-256 point)
+func (m *Manager) VAPIDPublicKey() string {
+	return m.vapid.publicKey
+}
+
+// Create validates and stores a subscription for owner. Webhook targets get
+// a fresh signing secret.
+func (m *Manager) Create(owner, name string, filter nostr.Filter, target Target) (Subscription, error) {
+	if err := m.validateTarget(&target); err != nil {
+		return Subscription{}, err
+	}
+	target.Secret = ""
+	if target.Type == TargetWebhook {
+		target.Secret = randomHex(32)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	count := 0
+	for _, e := range m.entries {
+		if e.sub.Owner == owner {
+			count++
+		}
+	}
+	if count >= m.config.MaxPerUser {
+		return Subscription{}, ErrLimit
+	}
+
+	sub := Subscription{
+		ID:        randomHex(8),
+		Owner:     owner,
+		Name:      name,
+		Filter:    filter,
+		Target:    target,
+		CreatedAt: m.now().UTC(),
+	}
+	m.entries[sub.ID] = &entry{sub: sub}
+	if err := m.saveLocked(); err != nil {
+		delete(m.entries, sub.ID)
+		return Subscription{}, err
+	}
+	return sub, nil
+}
+
+// List returns owner's subscriptions, oldest first
+func (m *Manager) List(owner string) []Subscription {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	subs := []Subscription{}
+	for _, e := range m.entries {
+		if e.sub.Owner == owner {
+			subs = append(subs, e.snapshot())
+		}
+	}
+	sort.Slice(subs, func(i, j int) bool { return subs[i].CreatedAt.Before(subs[j].CreatedAt) })
+	return subs
+}
+
+// Get returns owner's subscription id
+func (m *Manager) Get(owner, id string) (Subscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[id]
+	if !ok || e.sub.Owner != owner {
+		return Subscription{}, ErrNotFound
+	}
+	return e.snapshot(), nil
+}
+
+// Delete removes owner's subscription id and drops its pending events
+func (m *Manager) Delete(owner, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e, ok := m.entries[id]
+	if !ok || e.sub.Owner != owner {
+		return ErrNotFound
+	}
+	delete(m.entries, id)
+	if err := m.saveLocked(); err != nil {
+		m.entries[id] = e
+		return err
+	}
+	return nil
+}
+
+// Notify queues event for the subscriptions it matches whose owner is
+// offline. Owners are not notified of their own events.
+func (m *Manager) Notify(event *models.Event) {
+	if event.IsQuarantined {
+		return
+	}
+	nostrEvent := event.ToNostrEvent()
+	now := m.now()
+
+	m.mu.Lock()
+	var matched []*entry
+	for _, e := range m.entries {
+		if !e.sub.Disabled && e.sub.Owner != event.PubKey && e.sub.Filter.Matches(nostrEvent) {
+			matched = append(matched, e)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, e := range matched {
+		// Presence and access are checked outside m.mu; they take relay locks
+		if m.online(e.sub.Owner) || !m.canAccess(e.sub.Owner, event) {
+			continue
+		}
+		m.mu.Lock()
+		if len(e.pending) == 0 {
+			e.since = now
+		}
+		e.pending = append(e.pending, event)
+		// Keep the newest events when the target is down for long
+		if over := len(e.pending) - 2*m.config.MaxBatch; over > 0 {
+			e.pending = e.pending[over:]
+			e.sub.Dropped += int64(over)
+		}
+		m.mu.Unlock()
+	}
+}
+
+// Run delivers due batches until ctx is done
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			m.flush(ctx)
+		}
+	}
+}
+
+// flush starts a delivery for every subscription with a due batch: one
+// that waited BatchWindow or is full, and is not backing off
+func (m *Manager) flush(ctx context.Context) {
+	now := m.now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, e := range m.entries {
+		if e.sending || len(e.pending) == 0 {
+			continue
+		}
+		if e.sub.NextAttempt != nil && now.Before(*e.sub.NextAttempt) {
+			continue
+		}
+		if len(e.pending) < m.config.MaxBatch && now.Sub(e.since) < m.config.BatchWindow {
+			continue
+		}
+
+		batch := e.pending[:min(len(e.pending), m.config.MaxBatch)]
+		e.sending = true
+		go m.deliver(ctx, e, e.sub, batch)
+	}
+}
+
+// deliver sends batch to sub's target and records the outcome
+func (m *Manager) deliver(ctx context.Context, e *entry, sub Subscription, batch []*models.Event) {
+	err := m.send(ctx, sub, batch)
+	now := m.now().UTC()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e.sending = false
+
+	if err != nil {
+		e.sub.Failures++
+		e.sub.LastError = err.Error()
+		if isGone(err) {
+			e.sub.Disabled = true
+			e.pending = nil
+		} else {
+			next := now.Add(m.backoff(e.sub.Failures))
+			e.sub.NextAttempt = &next
+		}
+		log.Printf("Push delivery for subscription %s failed: %v", sub.ID, err)
+	} else {
+		e.sub.Failures = 0
+		e.sub.LastError = ""
+		e.sub.NextAttempt = nil
+		e.sub.Delivered += int64(len(batch))
+		e.sub.LastDelivered = &now
+		// The batch may have been trimmed from the front while sending
+		sent := make(map[*models.Event]bool, len(batch))
+		for _, event := range batch {
+			sent[event] = true
+		}
+		remaining := e.pending[:0]
+		for _, event := range e.pending {
+			if !sent[event] {
+				remaining = append(remaining, event)
+			}
+		}
+		e.pending = remaining
+		e.since = now
+	}
+
+	if _, ok := m.entries[sub.ID]; ok {
+		if err := m.saveLocked(); err != nil {
+			log.Printf("Failed to save push subscriptions: %v", err)
+		}
+	}
+}
+
+// backoff doubles the retry delay with every consecutive failure
+func (m *Manager) backoff(failures int) time.Duration {
+	delay := m.retryDelay
+	for i := 1; i < failures && delay < m.config.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, m.config.MaxBackoff)
+}
+
+// send delivers batch to sub's target
+func (m *Manager) send(ctx context.Context, sub Subscription, batch []*models.Event) error {
+	switch sub.Target.Type {
+	case TargetWebhook:
+		return m.sendWebhook(ctx, sub, batch)
+	case TargetNtfy:
+		return m.sendNtfy(ctx, sub, batch)
+	case TargetWebPush:
+		return m.sendWebPush(ctx, sub, batch)
+	default:
+		return fmt.Errorf("unknown target type %q", sub.Target.Type)
+	}
+}
+
+func (m *Manager) validateTarget(target *Target) error {
+	u, err := url.Parse(target.URL)
+	if err != nil || u.Host == "" || (u.Scheme != "https" && u.Scheme != "http") {
+		return fmt.Errorf("target url must be an http(s) URL")
+	}
+	if u.Scheme == "http" && !m.config.AllowPrivateTargets {
+		return fmt.Errorf("target url must use https")
+	}
+
+	switch target.Type {
+	case TargetWebhook, TargetNtfy:
+	case TargetWebPush:
+		if _, err := decodeBase64URL(target.P256DH); err != nil || target.P256DH == "" {
+			return fmt.Errorf("webpush targets need the subscription's p256dh key")
+		}
+		if auth, err := decodeBase64URL(target.Auth); err != nil || len(auth) != 16 {
+			return fmt.Errorf("webpush targets need the subscription's 16 byte auth secret")
+		}
+	default:
+		return fmt.Errorf("target type must be webhook, ntfy or webpush")
+	}
+	return nil
+}
+
+func (e *entry) snapshot() Subscription {
+	sub := e.sub
+	sub.Pending = len(e.pending)
+	return sub
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (m *Manager) load() (state, error) {
+	var st state
+	if m.config.Path == "" {
+		return st, nil
+	}
+	data, err := os.ReadFile(m.config.Path)
+	if os.IsNotExist(err) {
+		return st, nil
+	}
+	if err != nil {
+		return st, fmt.Errorf("failed to read %s: %w", m.config.Path, err)
+	}
+	if err := json.Unmarshal(data, &st); err != nil {
+		return st, fmt.Errorf("failed to parse %s: %w", m.config.Path, err)
+	}
+	return st, nil
+}
+
+// saveLocked atomically writes the subscriptions to path. Callers must hold
+// m.mu.
+func (m *Manager) saveLocked() error {
+	if m.config.Path == "" {
+		return nil
+	}
+	st := state{Subscriptions: make([]Subscription, 0, len(m.entries))}
+	if m.config.VAPIDPrivateKey == "" {
+		st.VAPIDPrivateKey = m.vapid.privateKey
+	}
+	for _, e := range m.entries {
+		st.Subscriptions = append(st.Subscriptions, e.sub)
+	}
+	sort.Slice(st.Subscriptions, func(i, j int) bool { return st.Subscriptions[i].ID < st.Subscriptions[j].ID })
+
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode push subscriptions: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(m.config.Path), 0755); err != nil {
+		return fmt.Errorf("failed to write push subscriptions: %w", err)
+	}
+	tmp := m.config.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write push subscriptions: %w", err)
+	}
+	if err := os.Rename(tmp, m.config.Path); err != nil {
+		return fmt.Errorf("failed to write push subscriptions: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+package push
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func b64(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := decodeBase64URL(s)
+	helpers.AssertNoError(t, err)
+	return b
+}
+
+// RFC 8291 appendix A
+func TestWebPushKeys(t *testing.T) {
+	asPrivate, err := ecdh.P256().NewPrivateKey(b64(t, "yfWPiYE-n46HLnH0KqZOF1fJJU3MYrct3AELtAQ-oRw"))
+	helpers.AssertNoError(t, err)
+	uaPublic := b64(t, "BCVxsr7N_eNgVRqvHtD0zTZsEc6-VV-JvLexhqUzORcxaOzi6-AYWXvTBHm4bjyPjs7Vd8pZGH6SRpkNtoIAiw4")
+	uaKey, err := ecdh.P256().NewPublicKey(uaPublic)
+	helpers.AssertNoError(t, err)
+	shared, err := asPrivate.ECDH(uaKey)
+	helpers.AssertNoError(t, err)
+
+	cek, nonce, err := webPushKeys(shared, b64(t, "BTBZMqHH6r4Tts7J_aSIgg"), b64(t, "DGv6ra1nlYgDCS1FRnbzlw"), uaPublic, asPrivate.PublicKey().Bytes())
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, "oIhVW04MRdy2XN9CiKLxTg", base64.RawURLEncoding.EncodeToString(cek))
+	helpers.AssertStringEqual(t, "4h_95klXJ5E_qnoN", base64.RawURLEncoding.EncodeToString(nonce))
+}
+
+func TestEncryptWebPush(t *testing.T) {
+	uaPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	helpers.AssertNoError(t, err)
+	auth := "BTBZMqHH6r4Tts7J_aSIgg"
+	p256dh := base64.RawURLEncoding.EncodeToString(uaPrivate.PublicKey().Bytes())
+
+	body, err := encryptWebPush([]byte("hello from the relay"), p256dh, auth+"==")
+	helpers.AssertNoError(t, err)
+
+	// Decrypt as the browser would
+	salt, keyLen := body[:16], int(body[20])
+	helpers.AssertIntEqual(t, recordSize, int(binary.BigEndian.Uint32(body[16:20])))
+	asPublic := body[21 : 21+keyLen]
+	asKey, err := ecdh.P256().NewPublicKey(asPublic)
+	helpers.AssertNoError(t, err)
+	shared, err := uaPrivate.ECDH(asKey)
+	helpers.AssertNoError(t, err)
+	cek, nonce, err := webPushKeys(shared, b64(t, auth), salt, uaPrivate.PublicKey().Bytes(), asPublic)
+	helpers.AssertNoError(t, err)
+	block, _ := aes.NewCipher(cek)
+	gcm, _ := cipher.NewGCM(block)
+	plaintext, err := gcm.Open(nil, nonce, body[21+keyLen:], nil)
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, "hello from the relay\x02", string(plaintext))
+}
+
+func TestVAPID(t *testing.T) {
+	key, err := loadVAPIDKey("")
+	helpers.AssertNoError(t, err)
+	reloaded, err := loadVAPIDKey(key.privateKey)
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, key.publicKey, reloaded.publicKey)
+
+	header, err := key.authorization("https://push.example.com/send/abc", "mailto:ops@example.com", time.Unix(1700000000, 0))
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, strings.HasSuffix(header, ", k="+key.publicKey))
+	token := strings.TrimSuffix(strings.TrimPrefix(header, "vapid t="), ", k="+key.publicKey)
+	parts := strings.Split(token, ".")
+	helpers.AssertIntEqual(t, 3, len(parts))
+
+	var claims map[string]interface{}
+	helpers.AssertNoError(t, json.Unmarshal(b64(t, parts[1]), &claims))
+	helpers.AssertStringEqual(t, "https://push.example.com", claims["aud"].(string))
+	helpers.AssertStringEqual(t, "mailto:ops@example.com", claims["sub"].(string))
+
+	signature := b64(t, parts[2])
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	r, s := new(big.Int).SetBytes(signature[:32]), new(big.Int).SetBytes(signature[32:])
+	helpers.AssertTrue(t, ecdsa.Verify(&key.key.PublicKey, digest[:], r, s))
+}
+
+type webhookServer struct {
+	mu       sync.Mutex
+	status   int
+	payloads []WebhookPayload
+	bodies   [][]byte
+	sigs     []string
+}
+
+func (s *webhookServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.status != 0 {
+		w.WriteHeader(s.status)
+		return
+	}
+	var payload WebhookPayload
+	json.Unmarshal(body, &payload)
+	s.payloads = append(s.payloads, payload)
+	s.bodies = append(s.bodies, body)
+	s.sigs = append(s.sigs, req.Header.Get("X-Mercury-Signature"))
+}
+
+func (s *webhookServer) received() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.payloads)
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func note(author, content string) *models.Event {
+	return &models.Event{ID: content, PubKey: author, Kind: 1, Content: content, CreatedAt: nostr.Now()}
+}
+
+func TestManager(t *testing.T) {
+	hook := &webhookServer{}
+	server := httptest.NewServer(hook)
+	defer server.Close()
+
+	path := filepath.Join(t.TempDir(), "push.json")
+	cfg := config.PushConfig{Path: path, MaxPerUser: 2, BatchWindow: time.Minute, MaxBatch: 3, MaxBackoff: 10 * time.Minute, AllowPrivateTargets: true}
+	m, err := NewManager(cfg)
+	helpers.AssertNoError(t, err)
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	alice, bob := strings.Repeat("a", 64), strings.Repeat("b", 64)
+	online := false
+	m.SetPresence(func(pubkey string) bool { return pubkey == alice && online })
+
+	t.Run("Validates targets", func(t *testing.T) {
+		_, err := m.Create(alice, "", nostr.Filter{}, Target{Type: "sms", URL: server.URL})
+		helpers.AssertTrue(t, err != nil)
+		_, err = m.Create(alice, "", nostr.Filter{}, Target{Type: TargetWebPush, URL: server.URL, P256DH: "x"})
+		helpers.AssertTrue(t, err != nil)
+		_, err = m.Create(alice, "", nostr.Filter{}, Target{Type: TargetWebhook, URL: "ftp://example.com"})
+		helpers.AssertTrue(t, err != nil)
+	})
+
+	sub, err := m.Create(alice, "mentions", nostr.Filter{Kinds: []int{1}}, Target{Type: TargetWebhook, URL: server.URL})
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, len(sub.Target.Secret) == 64)
+
+	t.Run("Batches events while the owner is offline", func(t *testing.T) {
+		m.Notify(note(bob, "one"))
+		m.Notify(note(alice, "own event"))
+		online = true
+		m.Notify(note(bob, "seen live"))
+		online = false
+		m.Notify(&models.Event{ID: "reaction", PubKey: bob, Kind: 7})
+		m.Notify(note(bob, "two"))
+
+		// Not due before the batch window passes
+		m.flush(ctx)
+		time.Sleep(20 * time.Millisecond)
+		helpers.AssertIntEqual(t, 0, hook.received())
+
+		now = now.Add(time.Minute)
+		m.flush(ctx)
+		waitFor(t, func() bool { return hook.received() == 1 })
+		payload := hook.payloads[0]
+		helpers.AssertStringEqual(t, sub.ID, payload.Subscription)
+		helpers.AssertIntEqual(t, 2, payload.Count)
+		helpers.AssertStringEqual(t, "one", payload.Events[0].Content)
+		helpers.AssertStringEqual(t, "two", payload.Events[1].Content)
+		helpers.AssertStringEqual(t, "sha256="+Sign(sub.Target.Secret, hook.bodies[0]), hook.sigs[0])
+
+		waitFor(t, func() bool {
+			got, _ := m.Get(alice, sub.ID)
+			return got.Delivered == 2 && got.Pending == 0
+		})
+	})
+
+	t.Run("Full batches go out immediately", func(t *testing.T) {
+		for _, content := range []string{"a", "b", "c", "d"} {
+			m.Notify(note(bob, content))
+		}
+		m.flush(ctx)
+		waitFor(t, func() bool { return hook.received() == 2 })
+		helpers.AssertIntEqual(t, 3, hook.payloads[1].Count)
+		waitFor(t, func() bool {
+			got, _ := m.Get(alice, sub.ID)
+			return got.Pending == 1
+		})
+	})
+
+	t.Run("Backs off after failures", func(t *testing.T) {
+		hook.mu.Lock()
+		hook.status = http.StatusInternalServerError
+		hook.mu.Unlock()
+
+		now = now.Add(time.Minute)
+		m.flush(ctx)
+		waitFor(t, func() bool {
+			got, _ := m.Get(alice, sub.ID)
+			return got.Failures == 1
+		})
+		got, _ := m.Get(alice, sub.ID)
+		helpers.AssertTrue(t, got.NextAttempt.Equal(now.Add(30*time.Second)))
+		helpers.AssertIntEqual(t, 1, got.Pending)
+		helpers.AssertIntEqual(t, 60, int(m.backoff(2).Seconds()))
+		helpers.AssertIntEqual(t, 600, int(m.backoff(10).Seconds()))
+
+		// Still backing off
+		m.flush(ctx)
+		time.Sleep(20 * time.Millisecond)
+		got, _ = m.Get(alice, sub.ID)
+		helpers.AssertIntEqual(t, 1, got.Failures)
+
+		hook.mu.Lock()
+		hook.status = http.StatusGone
+		hook.mu.Unlock()
+		now = now.Add(time.Minute)
+		m.flush(ctx)
+		waitFor(t, func() bool {
+			got, _ := m.Get(alice, sub.ID)
+			return got.Disabled
+		})
+	})
+
+	t.Run("Persists subscriptions per owner", func(t *testing.T) {
+		_, err := m.Create(alice, "", nostr.Filter{}, Target{Type: TargetNtfy, URL: server.URL, Token: "tk"})
+		helpers.AssertNoError(t, err)
+		_, err = m.Create(alice, "", nostr.Filter{}, Target{Type: TargetNtfy, URL: server.URL})
+		helpers.AssertTrue(t, err == ErrLimit)
+
+		reloaded, err := NewManager(cfg)
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, m.VAPIDPublicKey(), reloaded.VAPIDPublicKey())
+		helpers.AssertIntEqual(t, 2, len(reloaded.List(alice)))
+		helpers.AssertIntEqual(t, 0, len(reloaded.List(bob)))
+
+		_, err = reloaded.Get(bob, sub.ID)
+		helpers.AssertTrue(t, err == ErrNotFound)
+		helpers.AssertTrue(t, reloaded.Delete(bob, sub.ID) == ErrNotFound)
+		helpers.AssertNoError(t, reloaded.Delete(alice, sub.ID))
+		helpers.AssertIntEqual(t, 1, len(reloaded.List(alice)))
+	})
+}
+
+func TestPrivateTargetsRefused(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+
+	client := newHTTPClient(time.Second, false)
+	err := client.post(context.Background(), server.URL, nil, http.Header{})
+	helpers.AssertTrue(t, err != nil && strings.Contains(err.Error(), "private address"))
+}
@@ -0,0 +1,164 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+	"unicode/utf8"
+
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// previewLength bounds the event content quoted in ntfy and WebPush
+// notifications
+const previewLength = 140
+
+// errGone is returned when the target no longer exists (404 or 410); the
+// subscription is disabled
+var errGone = fmt.Errorf("target is gone")
+
+func isGone(err error) bool {
+	return errors.Is(err, errGone)
+}
+
+// httpClient sends notifications, refusing private addresses unless allowed
+type httpClient struct {
+	client *http.Client
+}
+
+func newHTTPClient(timeout time.Duration, allowPrivate bool) *httpClient {
+	dialer := &net.Dialer{Timeout: timeout}
+	if !allowPrivate {
+		// Checked on the resolved address, so DNS cannot point inside
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if ip := net.ParseIP(host); ip == nil || privateIP(ip) {
+				return fmt.Errorf("refusing to connect to private address %s", host)
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = dialer.DialContext
+	transport.Proxy = nil
+	return &httpClient{client: &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}}
+}
+
+func privateIP(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsUnspecified() || ip.IsMulticast()
+}
+
+// post sends body to url and turns error statuses into errors
+func (c *httpClient) post(ctx context.Context, url string, body []byte, header http.Header) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach target: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return fmt.Errorf("%w: status %d", errGone, resp.StatusCode)
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("target returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// WebhookPayload is the body POSTed to webhook targets
+type WebhookPayload struct {
+	Subscription string         `json:"subscription"`
+	Name         string         `json:"name,omitempty"`
+	Count        int            `json:"count"`
+	Events       []*nostr.Event `json:"events"`
+}
+
+// sendWebhook POSTs the batch as JSON, signed with the subscription secret
+// in X-Mercury-Signature: sha256=<hex HMAC of the body>
+func (m *Manager) sendWebhook(ctx context.Context, sub Subscription, batch []*models.Event) error {
+	payload := WebhookPayload{Subscription: sub.ID, Name: sub.Name, Count: len(batch)}
+	for _, event := range batch {
+		payload.Events = append(payload.Events, event.ToNostrEvent())
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to encode webhook payload: %w", err)
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/json")
+	header.Set("X-Mercury-Signature", "sha256="+Sign(sub.Target.Secret, body))
+	return m.client.post(ctx, sub.Target.URL, body, header)
+}
+
+// Sign returns the hex HMAC-SHA256 of body under secret, as sent in
+// X-Mercury-Signature
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendNtfy publishes a plain text summary to the ntfy topic URL
+func (m *Manager) sendNtfy(ctx context.Context, sub Subscription, batch []*models.Event) error {
+	header := http.Header{}
+	header.Set("Title", notificationTitle(sub, batch))
+	header.Set("Tags", "mercury")
+	if sub.Target.Token != "" {
+		header.Set("Authorization", "Bearer "+sub.Target.Token)
+	}
+	return m.client.post(ctx, sub.Target.URL, []byte(preview(batch[len(batch)-1])), header)
+}
+
+func notificationTitle(sub Subscription, batch []*models.Event) string {
+	name := sub.Name
+	if name == "" {
+		name = "your subscription"
+	}
+	if len(batch) == 1 {
+		return fmt.Sprintf("New event for %s", name)
+	}
+	return fmt.Sprintf("%d new events for %s", len(batch), name)
+}
+
+// preview shortens event's content to previewLength runes
+func preview(event *models.Event) string {
+	content := strings.TrimSpace(event.Content)
+	if utf8.RuneCountInString(content) <= previewLength {
+		return content
+	}
+	runes := []rune(content)
+	return string(runes[:previewLength]) + "…"
+}
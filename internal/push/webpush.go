@@ -0,0 +1,240 @@
+package push
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"mercury-relay/internal/models"
+)
+
+const (
+	// webPushTTL is how long push services keep undelivered notifications
+	webPushTTL = 24 * time.Hour
+	// vapidExpiry is the lifetime of VAPID tokens; at most 24h is accepted
+	vapidExpiry = 12 * time.Hour
+	// recordSize is the aes128gcm record size; notifications fit one record
+	recordSize = 4096
+)
+
+// vapidKey signs VAPID tokens (RFC 8292)
+type vapidKey struct {
+	key        *ecdsa.PrivateKey
+	privateKey string // base64url scalar
+	publicKey  string // base64url uncompressed point
+}
+
+// loadVAPIDKey parses a base64url P-256 scalar, generating one when empty
+func loadVAPIDKey(encoded string) (*vapidKey, error) {
+	var private *ecdh.PrivateKey
+	var err error
+	if encoded == "" {
+		private, err = ecdh.P256().GenerateKey(rand.Reader)
+	} else {
+		var raw []byte
+		if raw, err = decodeBase64URL(encoded); err == nil {
+			private, err = ecdh.P256().NewPrivateKey(raw)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid VAPID private key: %w", err)
+	}
+
+	public := private.PublicKey().Bytes()
+	return &vapidKey{
+		key: &ecdsa.PrivateKey{
+			PublicKey: ecdsa.PublicKey{
+				Curve: elliptic.P256(),
+				X:     new(big.Int).SetBytes(public[1:33]),
+				Y:     new(big.Int).SetBytes(public[33:]),
+			},
+			D: new(big.Int).SetBytes(private.Bytes()),
+		},
+		privateKey: base64.RawURLEncoding.EncodeToString(private.Bytes()),
+		publicKey:  base64.RawURLEncoding.EncodeToString(public),
+	}, nil
+}
+
+// authorization returns the VAPID Authorization header for endpoint
+func (k *vapidKey) authorization(endpoint, subject string, now time.Time) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid endpoint: %w", err)
+	}
+	claims := map[string]interface{}{
+		"aud": u.Scheme + "://" + u.Host,
+		"exp": now.Add(vapidExpiry).Unix(),
+	}
+	if subject != "" {
+		claims["sub"] = subject
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode VAPID claims: %w", err)
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString([]byte(`{"typ":"JWT","alg":"ES256"}`)) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signingInput))
+	r, s, err := ecdsa.Sign(rand.Reader, k.key, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign VAPID token: %w", err)
+	}
+	signature := make([]byte, 64)
+	r.FillBytes(signature[:32])
+	s.FillBytes(signature[32:])
+
+	token := signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+	return fmt.Sprintf("vapid t=%s, k=%s", token, k.publicKey), nil
+}
+
+// WebPushMessage is the JSON a service worker receives in its push event
+type WebPushMessage struct {
+	Subscription string `json:"subscription"`
+	Title        string `json:"title"`
+	Body         string `json:"body"`
+	Count        int    `json:"count"`
+	EventID      string `json:"event_id"`
+	Kind         int    `json:"kind"`
+	Pubkey       string `json:"pubkey"`
+}
+
+// sendWebPush encrypts a summary of the batch to the browser's keys and
+// posts it to the push service
+func (m *Manager) sendWebPush(ctx context.Context, sub Subscription, batch []*models.Event) error {
+	latest := batch[len(batch)-1]
+	message, err := json.Marshal(WebPushMessage{
+		Subscription: sub.ID,
+		Title:        notificationTitle(sub, batch),
+		Body:         preview(latest),
+		Count:        len(batch),
+		EventID:      latest.ID,
+		Kind:         latest.Kind,
+		Pubkey:       latest.PubKey,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to encode push message: %w", err)
+	}
+	body, err := encryptWebPush(message, sub.Target.P256DH, sub.Target.Auth)
+	if err != nil {
+		return err
+	}
+	authorization, err := m.vapid.authorization(sub.Target.URL, m.config.VAPIDSubject, m.now())
+	if err != nil {
+		return err
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	header.Set("Content-Encoding", "aes128gcm")
+	header.Set("TTL", fmt.Sprint(int(webPushTTL.Seconds())))
+	header.Set("Authorization", authorization)
+	return m.client.post(ctx, sub.Target.URL, body, header)
+}
+
+// encryptWebPush encrypts plaintext for a browser push subscription as a
+// single aes128gcm record (RFC 8291)
+func encryptWebPush(plaintext []byte, p256dh, authSecret string) ([]byte, error) {
+	uaPublicBytes, err := decodeBase64URL(p256dh)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	uaPublic, err := ecdh.P256().NewPublicKey(uaPublicBytes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid p256dh key: %w", err)
+	}
+	auth, err := decodeBase64URL(authSecret)
+	if err != nil {
+		return nil, fmt.Errorf("invalid auth secret: %w", err)
+	}
+	if len(plaintext)+1+16 > recordSize-86 {
+		return nil, fmt.Errorf("push message too long")
+	}
+
+	asPrivate, err := ecdh.P256().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	asPublic := asPrivate.PublicKey().Bytes()
+	sharedSecret, err := asPrivate.ECDH(uaPublic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to derive shared secret: %w", err)
+	}
+
+	salt := make([]byte, 16)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	cek, nonce, err := webPushKeys(sharedSecret, auth, salt, uaPublicBytes, asPublic)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(cek)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	// 0x02 marks the last (and only) record
+	ciphertext := gcm.Seal(nil, nonce, append(plaintext, 0x02), nil)
+
+	// Header: salt, record size, key ID length and the sender's public key
+	body := make([]byte, 0, 16+4+1+len(asPublic)+len(ciphertext))
+	body = append(body, salt...)
+	body = binary.BigEndian.AppendUint32(body, recordSize)
+	body = append(body, byte(len(asPublic)))
+	body = append(body, asPublic...)
+	return append(body, ciphertext...), nil
+}
+
+// webPushKeys derives the content encryption key and nonce (RFC 8291
+// section 3.4)
+func webPushKeys(sharedSecret, auth, salt, uaPublic, asPublic []byte) ([]byte, []byte, error) {
+	prkKey, err := hkdf.Extract(sha256.New, sharedSecret, auth)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive keys: %w", err)
+	}
+	keyInfo := "WebPush: info\x00" + string(uaPublic) + string(asPublic)
+	ikm, err := hkdf.Expand(sha256.New, prkKey, keyInfo, 32)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive keys: %w", err)
+	}
+
+	prk, err := hkdf.Extract(sha256.New, ikm, salt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive keys: %w", err)
+	}
+	cek, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: aes128gcm\x00", 16)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive keys: %w", err)
+	}
+	nonce, err := hkdf.Expand(sha256.New, prk, "Content-Encoding: nonce\x00", 12)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to derive keys: %w", err)
+	}
+	return cek, nonce, nil
+}
+
+// decodeBase64URL accepts base64url with or without padding, as browsers
+// hand out subscription keys either way
+func decodeBase64URL(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,19 +15,53 @@ import (
 	"mercury-relay/internal/queue"
 )
 
+// ErrRateLimitExceeded is returned when a pubkey publishes faster than the
+// configured per-minute limit
+var ErrRateLimitExceeded = fmt.Errorf("rate limit exceeded")
+
+// ErrNpubBlocked is returned for events from blocked pubkeys
+var ErrNpubBlocked = fmt.Errorf("npub is blocked")
+
+// ErrEventBanned is returned for events an operator banned
+var ErrEventBanned = fmt.Errorf("event is banned")
+
+// lowQualityReason is the quarantine reason for events below the spam threshold
+const lowQualityReason = "Low quality score"
+
 type Controller struct {
+	rabbitMQ queue.Queue
+	cache    cache.Cache
+
+	// Thresholds and kind configs, replaced on config reload
 	config           config.QualityConfig
-	rabbitMQ         queue.Queue
-	cache            cache.Cache
 	kindConfigLoader *KindConfigLoader
+	configMutex      sync.RWMutex
 
 	// Rate limiting
 	rateLimiter map[string][]time.Time
 	rateMutex   sync.RWMutex
 
-	// Blocked npubs
-	blockedNpubs map[string]bool
+	// Blocked npubs, the sources that blocked each one and why operators
+	// blocked them
+	blockedNpubs map[string]map[string]bool
+	blockReasons map[string]string
 	blockMutex   sync.RWMutex
+
+	// Events quarantined or banned by moderation and why, and where all of
+	// it is saved
+	quarantined     map[string]string
+	bannedEvents    map[string]string
+	quarantineMutex sync.RWMutex
+	moderationStore ModerationStore
+	saveMutex       sync.Mutex
+
+	// Rolling window of validated and rejected events
+	stats *statsTracker
+
+	// Weighted kind 1984 reports and the actions they trigger
+	reports    *reportTracker
+	trust      TrustSource
+	trustMutex sync.RWMutex
 }
 
 func NewController(
@@ -38,7 +74,12 @@ func NewController(
 		rabbitMQ:     rabbitMQ,
 		cache:        cache,
 		rateLimiter:  make(map[string][]time.Time),
-		blockedNpubs: make(map[string]bool),
+		blockedNpubs: make(map[string]map[string]bool),
+		blockReasons: make(map[string]string),
+		quarantined:  make(map[string]string),
+		bannedEvents: make(map[string]string),
+		stats:        newStatsTracker(defaultStatsWindow),
+		reports:      newReportTracker(config.Reports),
 	}
 }
 
@@ -55,61 +96,132 @@ func (c *Controller) Start(ctx context.Context) error {
 func (c *Controller) ValidateEvent(event *models.Event) error {
 	// Check if npub is blocked
 	c.blockMutex.RLock()
-	if c.blockedNpubs[event.PubKey] {
+	if len(c.blockedNpubs[event.PubKey]) > 0 {
 		c.blockMutex.RUnlock()
-		return fmt.Errorf("npub is blocked")
+		c.recordRejection(event, RejectBlocked)
+		return ErrNpubBlocked
 	}
 	c.blockMutex.RUnlock()
 
+	if c.IsEventBanned(event.ID) {
+		c.recordRejection(event, RejectBlocked)
+		return ErrEventBanned
+	}
+
 	// Check rate limiting
 	if err := c.checkRateLimit(event.PubKey); err != nil {
+		c.recordRejection(event, RejectRateLimited)
 		return fmt.Errorf("rate limit exceeded: %w", err)
 	}
 
 	// Check content length
-	if len(event.Content) > c.config.MaxContentLength {
+	if len(event.Content) > c.MaxContentLength() {
+		c.recordRejection(event, RejectContentTooLong)
 		return fmt.Errorf("content too long")
 	}
 
-	// Use kind-specific validation if available
-	if c.kindConfigLoader != nil {
-		// Convert nostr.Tags to [][]string
-		tags := make([][]string, len(event.Tags))
-		for i, tag := range event.Tags {
-			tags[i] = make([]string, len(tag))
-			copy(tags[i], tag)
+	// NIP-94 file metadata must carry a usable URL, mime type and hash
+	if event.Kind == models.KindFileMetadata {
+		if _, err := models.ParseFileMetadata(event); err != nil {
+			c.recordRejection(event, RejectKindValidation)
+			return fmt.Errorf("file metadata validation failed: %w", err)
 		}
+	}
 
-		if err := c.kindConfigLoader.ValidateEventKind(event.Kind, event.Content, tags); err != nil {
+	// Use kind-specific validation if available
+	if loader := c.kinds(); loader != nil {
+		if err := loader.ValidateEventKind(event.Kind, event.Content, eventTags(event)); err != nil {
+			c.recordRejection(event, RejectKindValidation)
 			return fmt.Errorf("kind-specific validation failed: %w", err)
 		}
-
-		// Calculate quality score using kind config
-		if score, err := c.kindConfigLoader.CalculateQualityScore(event.Kind, event.Content, tags); err == nil {
-			event.QualityScore = score
-		} else {
-			event.QualityScore = event.CalculateQualityScore()
-		}
-	} else {
-		// Fallback to default quality calculation
-		event.QualityScore = event.CalculateQualityScore()
 	}
 
-	if event.QualityScore < c.config.SpamThreshold {
+	c.applyQualityScore(event)
+	if reason, ok := c.QuarantineReason(event.ID); ok && !event.Mirrored {
 		event.IsQuarantined = true
-		event.QuarantineReason = "Low quality score"
+		event.QuarantineReason = reason
 	}
 
 	// Publish event to queue
 	if err := c.rabbitMQ.PublishEvent(event); err != nil {
+		c.recordRejection(event, RejectPublishFailed)
 		return fmt.Errorf("failed to publish event: %w", err)
 	}
 
+	c.stats.record(statsSample{
+		at:          time.Now(),
+		kind:        event.Kind,
+		pubkey:      event.PubKey,
+		size:        len(event.Content),
+		quarantined: event.IsQuarantined,
+	})
+
 	log.Printf("Quality controller published event %s to queue", event.ID)
+
+	c.ProcessReport(event)
 	return nil
 }
 
+// applyQualityScore sets the event's quality score, using the kind config
+// when available, and quarantines it if the score is below the spam threshold.
+// Mirrored events are scored but never quarantined.
+func (c *Controller) applyQualityScore(event *models.Event) {
+	event.QualityScore = event.CalculateQualityScore()
+	if loader := c.kinds(); loader != nil {
+		if score, err := loader.CalculateQualityScore(event.Kind, event.Content, eventTags(event)); err == nil {
+			event.QualityScore = score
+		}
+	}
+
+	if event.QualityScore < c.settings().SpamThreshold && !event.Mirrored {
+		event.IsQuarantined = true
+		event.QuarantineReason = lowQualityReason
+	}
+}
+
+// Rescore recomputes the quality score and quarantine state of a stored
+// event without rate limiting, stats or publishing. Events that were only
+// quarantined for a low score are released if they now pass.
+func (c *Controller) Rescore(event *models.Event) error {
+	if event.IsQuarantined && event.QuarantineReason == lowQualityReason {
+		event.IsQuarantined = false
+		event.QuarantineReason = ""
+	}
+
+	if loader := c.kinds(); loader != nil {
+		if err := loader.ValidateEventKind(event.Kind, event.Content, eventTags(event)); err != nil {
+			return fmt.Errorf("kind-specific validation failed: %w", err)
+		}
+	}
+
+	c.applyQualityScore(event)
+	return nil
+}
+
+// eventTags converts nostr.Tags to the [][]string used by kind configs
+func eventTags(event *models.Event) [][]string {
+	tags := make([][]string, len(event.Tags))
+	for i, tag := range event.Tags {
+		tags[i] = make([]string, len(tag))
+		copy(tags[i], tag)
+	}
+	return tags
+}
+
+// recordRejection adds a rejected event to the rolling stats window
+func (c *Controller) recordRejection(event *models.Event, reason string) {
+	c.stats.record(statsSample{
+		at:       time.Now(),
+		kind:     event.Kind,
+		pubkey:   event.PubKey,
+		size:     len(event.Content),
+		rejected: reason,
+	})
+}
+
 func (c *Controller) checkRateLimit(npub string) error {
+	limit := c.settings().RateLimitPerMinute
+
 	c.rateMutex.Lock()
 	defer c.rateMutex.Unlock()
 
@@ -128,8 +240,8 @@ func (c *Controller) checkRateLimit(npub string) error {
 	}
 
 	// Check rate limit
-	if len(c.rateLimiter[npub]) >= c.config.RateLimitPerMinute {
-		return fmt.Errorf("rate limit exceeded")
+	if len(c.rateLimiter[npub]) >= limit {
+		return ErrRateLimitExceeded
 	}
 
 	// Add current time
@@ -137,29 +249,135 @@ func (c *Controller) checkRateLimit(npub string) error {
 	return nil
 }
 
+// GetRateLimitStatus returns how many events npub has published in the
+// current one-minute window and the configured per-minute limit
+func (c *Controller) GetRateLimitStatus(npub string) (int, int) {
+	limit := c.settings().RateLimitPerMinute
+
+	c.rateMutex.RLock()
+	defer c.rateMutex.RUnlock()
+
+	cutoff := time.Now().Add(-time.Minute)
+	used := 0
+	for _, t := range c.rateLimiter[npub] {
+		if t.After(cutoff) {
+			used++
+		}
+	}
+
+	return used, limit
+}
+
+// RateLimitWindow returns npub's usage and limit like GetRateLimitStatus,
+// plus when the oldest counted event leaves the window
+func (c *Controller) RateLimitWindow(npub string) (int, int, time.Time) {
+	limit := c.settings().RateLimitPerMinute
+
+	c.rateMutex.RLock()
+	defer c.rateMutex.RUnlock()
+
+	now := time.Now()
+	cutoff := now.Add(-time.Minute)
+	used := 0
+	reset := now
+	for _, t := range c.rateLimiter[npub] {
+		if t.After(cutoff) {
+			if used == 0 {
+				reset = t.Add(time.Minute)
+			}
+			used++
+		}
+	}
+
+	return used, limit, reset
+}
+
+// SourceManual attributes blocks made by an operator
+const SourceManual = "manual"
+
 func (c *Controller) BlockNpub(npub string) error {
+	return c.BlockNpubWithReason(npub, "")
+}
+
+// UnblockNpub lifts every block on npub, whatever its source
+func (c *Controller) UnblockNpub(npub string) error {
 	c.blockMutex.Lock()
-	defer c.blockMutex.Unlock()
+	delete(c.blockedNpubs, npub)
+	delete(c.blockReasons, npub)
+	c.blockMutex.Unlock()
 
-	c.blockedNpubs[npub] = true
-	log.Printf("Blocked npub: %s", npub)
-	return nil
+	log.Printf("Unblocked npub: %s", npub)
+	return c.saveModeration()
 }
 
-func (c *Controller) UnblockNpub(npub string) error {
+// BlockNpubFrom blocks npub on behalf of source. The npub stays blocked
+// until every source that blocked it lifts its block.
+func (c *Controller) BlockNpubFrom(npub, source string) {
+	c.blockNpub(npub, source)
+	c.saveSourceChange(source)
+}
+
+func (c *Controller) blockNpub(npub, source string) {
 	c.blockMutex.Lock()
 	defer c.blockMutex.Unlock()
 
-	delete(c.blockedNpubs, npub)
-	log.Printf("Unblocked npub: %s", npub)
-	return nil
+	sources := c.blockedNpubs[npub]
+	if sources == nil {
+		sources = make(map[string]bool)
+		c.blockedNpubs[npub] = sources
+	}
+	sources[source] = true
+}
+
+// UnblockNpubFrom lifts source's block on npub, leaving other sources' blocks
+func (c *Controller) UnblockNpubFrom(npub, source string) {
+	c.blockMutex.Lock()
+	delete(c.blockedNpubs[npub], source)
+	if len(c.blockedNpubs[npub]) == 0 {
+		delete(c.blockedNpubs, npub)
+	}
+	if source == SourceManual {
+		delete(c.blockReasons, npub)
+	}
+	c.blockMutex.Unlock()
+
+	c.saveSourceChange(source)
+}
+
+// saveSourceChange saves the moderation state after source changed a
+// block, unless block lists own the source
+func (c *Controller) saveSourceChange(source string) {
+	if strings.HasPrefix(source, listSourcePrefix) {
+		return
+	}
+	if err := c.saveModeration(); err != nil {
+		log.Printf("Failed to save moderation state: %v", err)
+	}
+}
+
+// BlockSources returns the sources blocking npub, sorted
+func (c *Controller) BlockSources(npub string) []string {
+	c.blockMutex.RLock()
+	defer c.blockMutex.RUnlock()
+
+	sources := make([]string, 0, len(c.blockedNpubs[npub]))
+	for source := range c.blockedNpubs[npub] {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	return sources
+}
+
+// MaxContentLength is the longest content accepted, as advertised via NIP-11
+func (c *Controller) MaxContentLength() int {
+	return c.settings().MaxContentLength
 }
 
 func (c *Controller) IsNpubBlocked(npub string) bool {
 	c.blockMutex.RLock()
 	defer c.blockMutex.RUnlock()
 
-	return c.blockedNpubs[npub]
+	return len(c.blockedNpubs[npub]) > 0
 }
 
 func (c *Controller) GetBlockedNpubs() []string {
@@ -226,9 +444,34 @@ func (c *Controller) monitorQuality(ctx context.Context) {
 }
 
 func (c *Controller) SetKindConfigLoader(loader *KindConfigLoader) {
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
 	c.kindConfigLoader = loader
 }
 
+// UpdateConfig applies reloaded thresholds and rate limits to events
+// validated from now on. Report weights and actions keep their startup
+// values.
+func (c *Controller) UpdateConfig(cfg config.QualityConfig) {
+	c.configMutex.Lock()
+	defer c.configMutex.Unlock()
+	c.config = cfg
+}
+
+// settings returns the current thresholds
+func (c *Controller) settings() config.QualityConfig {
+	c.configMutex.RLock()
+	defer c.configMutex.RUnlock()
+	return c.config
+}
+
+// kinds returns the current kind configs, nil without any
+func (c *Controller) kinds() *KindConfigLoader {
+	c.configMutex.RLock()
+	defer c.configMutex.RUnlock()
+	return c.kindConfigLoader
+}
+
 func (c *Controller) GetQualityStats() (map[string]interface{}, error) {
 	stats := make(map[string]interface{})
 
@@ -244,5 +487,14 @@ func (c *Controller) GetQualityStats() (map[string]interface{}, error) {
 	c.blockMutex.RUnlock()
 	stats["blocked_npubs"] = blockedCount
 
+	// Rolling window breakdowns
+	samples := c.stats.snapshot()
+	stats["window"] = c.stats.window.String()
+	stats["content_size"] = sizeDistribution(samples)
+	stats["rejections"] = rejectionBreakdown(samples)
+	stats["kinds"] = kindBreakdown(samples)
+	stats["top_offenders"] = topOffenders(samples, topOffendersLimit)
+	stats["reports"] = c.reports.summary()
+
 	return stats, nil
 }
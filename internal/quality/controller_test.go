@@ -2,9 +2,13 @@ package quality
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
 	"testing"
 	"time"
 
+	"mercury-relay/internal/cache"
 	"mercury-relay/internal/config"
 	"mercury-relay/internal/models"
 	"mercury-relay/test/helpers"
@@ -202,6 +206,27 @@ func TestBlockingUnblocking(t *testing.T) {
 		helpers.AssertContains(t, blocked, npub1)
 		helpers.AssertContains(t, blocked, npub2)
 	})
+
+	t.Run("Blocks attributed to sources", func(t *testing.T) {
+		controller := NewController(config.QualityConfig{MaxContentLength: 10000, RateLimitPerMinute: 100}, mocks.NewMockQueue(), mocks.NewMockCache())
+
+		controller.BlockNpubFrom(npub, "list:a")
+		controller.BlockNpubFrom(npub, "list:b")
+		helpers.AssertEqual(t, "[list:a list:b]", fmt.Sprint(controller.BlockSources(npub)))
+
+		// Still blocked while another source blocks it
+		controller.UnblockNpubFrom(npub, "list:a")
+		helpers.AssertBoolEqual(t, true, controller.IsNpubBlocked(npub))
+		controller.UnblockNpubFrom(npub, "list:b")
+		helpers.AssertBoolEqual(t, false, controller.IsNpubBlocked(npub))
+
+		// A manual unblock overrides every source
+		controller.BlockNpubFrom(npub, "list:a")
+		controller.BlockNpub(npub)
+		helpers.AssertEqual(t, "[list:a manual]", fmt.Sprint(controller.BlockSources(npub)))
+		controller.UnblockNpub(npub)
+		helpers.AssertIntEqual(t, 0, len(controller.BlockSources(npub)))
+	})
 }
 
 func TestKindSpecificValidation(t *testing.T) {
@@ -519,3 +544,263 @@ func TestRateLimiterCleanup(t *testing.T) {
 		helpers.AssertIntEqual(t, 1, len(times))
 	})
 }
+
+func TestRateLimitStatus(t *testing.T) {
+	eg := models.NewEventGenerator()
+	npub := eg.GetRandomNpub()
+
+	cfg := config.QualityConfig{
+		MaxContentLength:   10000,
+		RateLimitPerMinute: 5,
+		SpamThreshold:      0.7,
+	}
+	controller := NewController(cfg, mocks.NewMockQueue(), mocks.NewMockCache())
+
+	used, limit := controller.GetRateLimitStatus(npub)
+	helpers.AssertIntEqual(t, 0, used)
+	helpers.AssertIntEqual(t, 5, limit)
+
+	for i := 0; i < 3; i++ {
+		event := eg.GenerateTextNote(npub, "Test message", nostr.Tags{})
+		helpers.AssertNoError(t, controller.ValidateEvent(event))
+	}
+
+	used, _ = controller.GetRateLimitStatus(npub)
+	helpers.AssertIntEqual(t, 3, used)
+
+	// Entries older than the window are not counted
+	controller.rateMutex.Lock()
+	controller.rateLimiter[npub] = append(controller.rateLimiter[npub], time.Now().Add(-2*time.Minute))
+	controller.rateMutex.Unlock()
+
+	used, _ = controller.GetRateLimitStatus(npub)
+	helpers.AssertIntEqual(t, 3, used)
+}
+
+func TestQualityStatsAccounting(t *testing.T) {
+	eg := models.NewEventGenerator()
+	cfg := config.QualityConfig{
+		MaxContentLength:   100,
+		RateLimitPerMinute: 100,
+		SpamThreshold:      0.7,
+	}
+	controller := NewController(cfg, mocks.NewMockQueue(), mocks.NewMockCache())
+
+	good := eg.GetRandomNpub()
+	spammer := eg.GetRandomNpub()
+
+	err := controller.ValidateEvent(eg.GenerateTextNote(good, "A perfectly reasonable note.", nostr.Tags{{"t", "test"}}))
+	helpers.AssertNoError(t, err)
+
+	err = controller.ValidateEvent(eg.GenerateSpamEvent(spammer))
+	helpers.AssertNoError(t, err)
+
+	long := eg.GenerateTextNote(spammer, string(make([]byte, 200)), nostr.Tags{})
+	err = controller.ValidateEvent(long)
+	helpers.AssertError(t, err)
+
+	controller.BlockNpub(spammer)
+	err = controller.ValidateEvent(eg.GenerateTextNote(spammer, "blocked", nostr.Tags{}))
+	helpers.AssertError(t, err)
+
+	stats, err := controller.GetQualityStats()
+	helpers.AssertNoError(t, err)
+
+	rejections := stats["rejections"].(map[string]int)
+	helpers.AssertIntEqual(t, 1, rejections[RejectContentTooLong])
+	helpers.AssertIntEqual(t, 1, rejections[RejectBlocked])
+
+	size := stats["content_size"].(SizeDistribution)
+	helpers.AssertIntEqual(t, 4, size.Count)
+	helpers.AssertIntEqual(t, 200, size.Max)
+
+	kinds := stats["kinds"].(map[string]*KindStats)
+	helpers.AssertNotNil(t, kinds["1"])
+	helpers.AssertIntEqual(t, 1, kinds["1"].Quarantined)
+
+	offenders := stats["top_offenders"].([]Offender)
+	helpers.AssertIntEqual(t, 1, len(offenders))
+	helpers.AssertStringEqual(t, spammer, offenders[0].PubKey)
+	helpers.AssertIntEqual(t, 2, offenders[0].Rejected)
+	helpers.AssertIntEqual(t, 1, offenders[0].Quarantined)
+}
+
+type staticTrust map[string]int
+
+func (s staticTrust) WoTDistance(pubkey string) int {
+	if d, ok := s[pubkey]; ok {
+		return d
+	}
+	return -1
+}
+
+func TestReportWeighting(t *testing.T) {
+	cfg := config.QualityConfig{
+		MaxContentLength:   10000,
+		RateLimitPerMinute: 100,
+		SpamThreshold:      0.1,
+		Reports: config.ReportConfig{
+			Enabled:             true,
+			QuarantineThreshold: 3,
+			OwnerWeight:         3,
+			FollowWeight:        1,
+			UnknownWeight:       0.2,
+			AccuracyWeight:      0.5,
+		},
+	}
+	mockCache := mocks.NewMockCache()
+	controller := NewController(cfg, mocks.NewMockQueue(), mockCache)
+	controller.SetTrustSource(staticTrust{"owner": 0, "follower": 1})
+
+	eg := models.NewEventGenerator()
+	target := eg.GenerateTextNote("author", "reported note", nostr.Tags{})
+	mockCache.StoreEvent(target)
+
+	report := func(reporter, eventID string) *models.Event {
+		return &models.Event{
+			ID:     reporter + "-" + eventID,
+			PubKey: reporter,
+			Kind:   KindReport,
+			Tags:   nostr.Tags{{"e", eventID, "spam"}, {"p", "author"}},
+		}
+	}
+
+	t.Run("Untrusted reports stay below the threshold", func(t *testing.T) {
+		controller.ProcessReport(report("stranger1", target.ID))
+		controller.ProcessReport(report("stranger2", target.ID))
+		controller.ProcessReport(report("follower", target.ID))
+		controller.ProcessReport(report("follower", target.ID)) // counted once
+
+		helpers.AssertIntEqual(t, 0, len(controller.ReportActions()))
+	})
+
+	t.Run("Owner report crosses the threshold", func(t *testing.T) {
+		controller.ProcessReport(report("owner", target.ID))
+
+		actions := controller.ReportActions()
+		helpers.AssertIntEqual(t, 1, len(actions))
+		helpers.AssertStringEqual(t, ReportActionQuarantine, actions[0].Action)
+		helpers.AssertIntEqual(t, 4, len(actions[0].Reports))
+		helpers.AssertFloat64Equal(t, 4.4, actions[0].Score, 0.001)
+
+		stored, _ := cache.Collect(mockCache.GetEvents(context.Background(), nostr.Filter{IDs: []string{target.ID}}))
+		helpers.AssertBoolEqual(t, true, stored[0].IsQuarantined)
+	})
+
+	t.Run("Overturned action releases the event and lowers accuracy", func(t *testing.T) {
+		action, err := controller.ResolveReportAction(target.ID, false)
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, ResolutionOverturned, action.Resolution)
+
+		stored, _ := cache.Collect(mockCache.GetEvents(context.Background(), nostr.Filter{IDs: []string{target.ID}}))
+		helpers.AssertBoolEqual(t, false, stored[0].IsQuarantined)
+
+		_, err = controller.ResolveReportAction(target.ID, true)
+		helpers.AssertError(t, err)
+
+		// Accuracy is now 1/3, so weights scale by 1 + 0.5*(2/3-1)
+		other := eg.GenerateTextNote("author", "another note", nostr.Tags{})
+		controller.ProcessReport(report("follower", other.ID))
+		helpers.AssertFloat64Equal(t, 0.8333, controller.reports.targets[other.ID].score, 0.001)
+
+		controller.ProcessReport(report("owner", other.ID))
+		actions := controller.ReportActions()
+		helpers.AssertIntEqual(t, 2, len(actions))
+		helpers.AssertFloat64Equal(t, 3.3333, actions[0].Score, 0.001)
+	})
+}
+
+func TestModerationPersistence(t *testing.T) {
+	cfg := config.QualityConfig{MaxContentLength: 10000, RateLimitPerMinute: 100}
+	path := filepath.Join(t.TempDir(), "moderation.json")
+	mockCache := mocks.NewMockCache()
+
+	eg := models.NewEventGenerator()
+	target := eg.GenerateTextNote("author", "reported note", nostr.Tags{})
+	mockCache.StoreEvent(target)
+
+	first := NewController(cfg, mocks.NewMockQueue(), mockCache)
+	helpers.AssertNoError(t, first.SetModerationStore(NewFileModerationStore(path)))
+	helpers.AssertNoError(t, first.BlockNpub("spammer"))
+	helpers.AssertNoError(t, first.BlockNpub("forgiven"))
+	first.BlockNpubFrom("listed", "list:abc")
+	first.BlockNpubFrom("spammer", "list:abc")
+	helpers.AssertNoError(t, first.UnblockNpub("forgiven"))
+	helpers.AssertNoError(t, first.setReportQuarantine(target.ID, true))
+
+	// A restarted relay gets the decisions back, except block list entries
+	second := NewController(cfg, mocks.NewMockQueue(), mocks.NewMockCache())
+	helpers.AssertNoError(t, second.SetModerationStore(NewFileModerationStore(path)))
+	helpers.AssertTrue(t, second.IsNpubBlocked("spammer"))
+	helpers.AssertIntEqual(t, 1, len(second.BlockSources("spammer")))
+	helpers.AssertFalse(t, second.IsNpubBlocked("forgiven"))
+	helpers.AssertFalse(t, second.IsNpubBlocked("listed"))
+
+	reason, ok := second.QuarantineReason(target.ID)
+	helpers.AssertTrue(t, ok)
+	helpers.AssertStringEqual(t, reportQuarantineReason, reason)
+
+	again := *target
+	helpers.AssertNoError(t, second.ValidateEvent(&again))
+	helpers.AssertEventQuarantined(t, &again, true)
+	helpers.AssertStringEqual(t, reportQuarantineReason, again.QuarantineReason)
+	helpers.AssertTrue(t, errors.Is(second.ValidateEvent(eg.GenerateTextNote("spammer", "hi", nostr.Tags{})), ErrNpubBlocked))
+}
+
+func TestBanEvent(t *testing.T) {
+	cfg := config.QualityConfig{MaxContentLength: 10000, RateLimitPerMinute: 100}
+	controller := NewController(cfg, mocks.NewMockQueue(), mocks.NewMockCache())
+	event := models.NewEventGenerator().GenerateTextNote("author", "hello", nostr.Tags{})
+
+	helpers.AssertNoError(t, controller.BanEvent(event.ID, "illegal"))
+	helpers.AssertTrue(t, errors.Is(controller.ValidateEvent(event), ErrEventBanned))
+	helpers.AssertStringEqual(t, "illegal", controller.BannedEvents()[event.ID])
+
+	helpers.AssertNoError(t, controller.UnbanEvent(event.ID))
+	helpers.AssertNoError(t, controller.ValidateEvent(event))
+
+	helpers.AssertNoError(t, controller.BlockNpubWithReason("spammer", "spam"))
+	helpers.AssertStringEqual(t, "spam", controller.BlockReason("spammer"))
+	helpers.AssertNoError(t, controller.UnblockNpub("spammer"))
+	helpers.AssertStringEqual(t, "", controller.BlockReason("spammer"))
+}
+
+func TestUpdateConfig(t *testing.T) {
+	eg := models.NewEventGenerator()
+	npub := "npub1reloaded"
+	controller := NewController(config.QualityConfig{
+		MaxContentLength:   10000,
+		RateLimitPerMinute: 2,
+		SpamThreshold:      0.7,
+	}, mocks.NewMockQueue(), mocks.NewMockCache())
+
+	spam := eg.GenerateSpamEvent("npub1spammer")
+	helpers.AssertNoError(t, controller.ValidateEvent(spam))
+	helpers.AssertEventQuarantined(t, spam, true)
+
+	for i := 0; i < 2; i++ {
+		helpers.AssertNoError(t, controller.ValidateEvent(eg.GenerateTextNote(npub, "Test message", nostr.Tags{})))
+	}
+	helpers.AssertError(t, controller.ValidateEvent(eg.GenerateTextNote(npub, "Test message", nostr.Tags{})))
+
+	controller.UpdateConfig(config.QualityConfig{
+		MaxContentLength:   10,
+		RateLimitPerMinute: 5,
+		SpamThreshold:      0,
+	})
+
+	spam = eg.GenerateSpamEvent("npub1spammer2")
+	spam.Content = "short"
+	helpers.AssertNoError(t, controller.ValidateEvent(spam))
+	helpers.AssertEventQuarantined(t, spam, false)
+
+	// The window counted before the reload still applies
+	helpers.AssertNoError(t, controller.ValidateEvent(eg.GenerateTextNote(npub, "Test", nostr.Tags{})))
+	used, limit := controller.GetRateLimitStatus(npub)
+	helpers.AssertIntEqual(t, 3, used)
+	helpers.AssertIntEqual(t, 5, limit)
+
+	err := controller.ValidateEvent(eg.GenerateTextNote("npub1verbose", "Longer than ten bytes", nostr.Tags{}))
+	helpers.AssertErrorContains(t, err, "content too long")
+	helpers.AssertIntEqual(t, 10, controller.MaxContentLength())
+}
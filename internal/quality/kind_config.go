@@ -442,6 +442,22 @@ func (k *KindConfigLoader) calculateRuleScore(rule QualityRule, content string,
 			return 1.0
 		}
 		return 0.8 // Even without AsciiDoc, content is still valid
+	case "valid_file_url":
+		for _, tag := range tags {
+			if len(tag) >= 2 && tag[0] == "url" {
+				if strings.HasPrefix(tag[1], "https://") || strings.HasPrefix(tag[1], "http://") {
+					return 1.0
+				}
+			}
+		}
+		return 0.0
+	case "valid_sha256":
+		for _, tag := range tags {
+			if len(tag) >= 2 && tag[0] == "x" && len(tag[1]) == 64 {
+				return 1.0
+			}
+		}
+		return 0.0
 	case "valid_wikilinks":
 		// Check for wikilinks in double brackets
 		if strings.Contains(content, "[[") && strings.Contains(content, "]]") {
@@ -0,0 +1,306 @@
+package quality
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"mercury-relay/internal/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// moderationKey is the Redis key holding the moderation state
+const moderationKey = "mercury:moderation"
+
+// listSourcePrefix marks blocks owned by subscribed block lists, which
+// restore their own pubkeys at startup and so aren't persisted here
+const listSourcePrefix = "list:"
+
+// ModerationState is what the controller persists: the sources blocking
+// each pubkey and why, the reason each quarantined event was quarantined,
+// and the banned events
+type ModerationState struct {
+	Blocked      map[string][]string `json:"blocked"`
+	Reasons      map[string]string   `json:"reasons,omitempty"`
+	Quarantined  map[string]string   `json:"quarantined"`
+	BannedEvents map[string]string   `json:"banned_events,omitempty"`
+}
+
+// ModerationStore loads and saves the moderation state
+type ModerationStore interface {
+	Load() (ModerationState, error)
+	Save(state ModerationState) error
+}
+
+// NewModerationStore returns the store cfg selects, or nil for "none"
+func NewModerationStore(cfg config.ModerationConfig, redisCfg config.RedisConfig) (ModerationStore, error) {
+	switch cfg.Backend {
+	case "", "file":
+		return NewFileModerationStore(cfg.Path), nil
+	case "redis":
+		return NewRedisModerationStore(redisCfg)
+	case "none":
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown moderation backend %q", cfg.Backend)
+}
+
+// FileModerationStore keeps the moderation state in a JSON file
+type FileModerationStore struct {
+	path string
+}
+
+// NewFileModerationStore returns a store writing to path
+func NewFileModerationStore(path string) *FileModerationStore {
+	return &FileModerationStore{path: path}
+}
+
+// Load reads the state, which is empty if the file doesn't exist yet
+func (s *FileModerationStore) Load() (ModerationState, error) {
+	var state ModerationState
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to read %s: %w", s.path, err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+	return state, nil
+}
+
+// Save atomically replaces the file with state
+func (s *FileModerationStore) Save(state ModerationState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode moderation state: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to write moderation state: %w", err)
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write moderation state: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to write moderation state: %w", err)
+	}
+	return nil
+}
+
+// RedisModerationStore keeps the moderation state under one Redis key, so
+// relays sharing a Redis share their moderation decisions
+type RedisModerationStore struct {
+	client *redis.Client
+}
+
+// NewRedisModerationStore connects to the Redis in cfg
+func NewRedisModerationStore(cfg config.RedisConfig) (*RedisModerationStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Host,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	return &RedisModerationStore{client: client}, nil
+}
+
+// Load reads the state, which is empty if it was never saved
+func (s *RedisModerationStore) Load() (ModerationState, error) {
+	var state ModerationState
+	data, err := s.client.Get(context.Background(), moderationKey).Bytes()
+	if err == redis.Nil {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("failed to load moderation state: %w", err)
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, fmt.Errorf("failed to parse moderation state: %w", err)
+	}
+	return state, nil
+}
+
+// Save replaces the stored state
+func (s *RedisModerationStore) Save(state ModerationState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode moderation state: %w", err)
+	}
+	if err := s.client.Set(context.Background(), moderationKey, data, 0).Err(); err != nil {
+		return fmt.Errorf("failed to save moderation state: %w", err)
+	}
+	return nil
+}
+
+// SetModerationStore loads the blocks and quarantines saved in store and
+// saves every later change there. Blocks made meanwhile are kept.
+func (c *Controller) SetModerationStore(store ModerationStore) error {
+	state, err := store.Load()
+	if err != nil {
+		return err
+	}
+
+	c.blockMutex.Lock()
+	for pubkey, sources := range state.Blocked {
+		for _, source := range sources {
+			if c.blockedNpubs[pubkey] == nil {
+				c.blockedNpubs[pubkey] = make(map[string]bool)
+			}
+			c.blockedNpubs[pubkey][source] = true
+		}
+	}
+	for pubkey, reason := range state.Reasons {
+		c.blockReasons[pubkey] = reason
+	}
+	c.blockMutex.Unlock()
+
+	c.quarantineMutex.Lock()
+	for eventID, reason := range state.Quarantined {
+		c.quarantined[eventID] = reason
+	}
+	for eventID, reason := range state.BannedEvents {
+		c.bannedEvents[eventID] = reason
+	}
+	c.moderationStore = store
+	c.quarantineMutex.Unlock()
+	return nil
+}
+
+// QuarantineReason returns why the event with eventID was quarantined by
+// moderation, if it was
+func (c *Controller) QuarantineReason(eventID string) (string, bool) {
+	c.quarantineMutex.RLock()
+	defer c.quarantineMutex.RUnlock()
+	reason, ok := c.quarantined[eventID]
+	return reason, ok
+}
+
+// setQuarantined records or clears a moderation quarantine and saves it
+func (c *Controller) setQuarantined(eventID, reason string, quarantined bool) error {
+	c.quarantineMutex.Lock()
+	if quarantined {
+		c.quarantined[eventID] = reason
+	} else {
+		delete(c.quarantined, eventID)
+	}
+	c.quarantineMutex.Unlock()
+	return c.saveModeration()
+}
+
+// saveModeration writes the persisted blocks and quarantines to the store
+func (c *Controller) saveModeration() error {
+	c.saveMutex.Lock()
+	defer c.saveMutex.Unlock()
+
+	c.quarantineMutex.RLock()
+	store := c.moderationStore
+	state := ModerationState{
+		Blocked:      make(map[string][]string),
+		Reasons:      make(map[string]string),
+		Quarantined:  make(map[string]string, len(c.quarantined)),
+		BannedEvents: make(map[string]string, len(c.bannedEvents)),
+	}
+	for eventID, reason := range c.quarantined {
+		state.Quarantined[eventID] = reason
+	}
+	for eventID, reason := range c.bannedEvents {
+		state.BannedEvents[eventID] = reason
+	}
+	c.quarantineMutex.RUnlock()
+	if store == nil {
+		return nil
+	}
+
+	c.blockMutex.RLock()
+	for pubkey, sources := range c.blockedNpubs {
+		for source := range sources {
+			if !strings.HasPrefix(source, listSourcePrefix) {
+				state.Blocked[pubkey] = append(state.Blocked[pubkey], source)
+			}
+		}
+		sort.Strings(state.Blocked[pubkey])
+	}
+	for pubkey, reason := range c.blockReasons {
+		state.Reasons[pubkey] = reason
+	}
+	c.blockMutex.RUnlock()
+	return store.Save(state)
+}
+
+// ClearQuarantine forgets the moderation quarantine of the event with
+// eventID, once an admin released it
+func (c *Controller) ClearQuarantine(eventID string) error {
+	if _, ok := c.QuarantineReason(eventID); !ok {
+		return nil
+	}
+	return c.setQuarantined(eventID, "", false)
+}
+
+// BlockNpubWithReason blocks npub as an operator and keeps why
+func (c *Controller) BlockNpubWithReason(npub, reason string) error {
+	c.blockNpub(npub, SourceManual)
+	c.blockMutex.Lock()
+	if reason != "" {
+		c.blockReasons[npub] = reason
+	}
+	c.blockMutex.Unlock()
+	log.Printf("Blocked npub: %s", npub)
+	return c.saveModeration()
+}
+
+// BlockReason returns why an operator blocked npub, if they said
+func (c *Controller) BlockReason(npub string) string {
+	c.blockMutex.RLock()
+	defer c.blockMutex.RUnlock()
+	return c.blockReasons[npub]
+}
+
+// BanEvent refuses the event with eventID from now on
+func (c *Controller) BanEvent(eventID, reason string) error {
+	c.quarantineMutex.Lock()
+	c.bannedEvents[eventID] = reason
+	c.quarantineMutex.Unlock()
+	return c.saveModeration()
+}
+
+// UnbanEvent accepts the event with eventID again
+func (c *Controller) UnbanEvent(eventID string) error {
+	c.quarantineMutex.Lock()
+	_, ok := c.bannedEvents[eventID]
+	delete(c.bannedEvents, eventID)
+	c.quarantineMutex.Unlock()
+	if !ok {
+		return nil
+	}
+	return c.saveModeration()
+}
+
+// IsEventBanned reports whether the event with eventID is banned
+func (c *Controller) IsEventBanned(eventID string) bool {
+	c.quarantineMutex.RLock()
+	defer c.quarantineMutex.RUnlock()
+	_, ok := c.bannedEvents[eventID]
+	return ok
+}
+
+// BannedEvents returns the banned event IDs with the reason for each
+func (c *Controller) BannedEvents() map[string]string {
+	c.quarantineMutex.RLock()
+	defer c.quarantineMutex.RUnlock()
+	banned := make(map[string]string, len(c.bannedEvents))
+	for eventID, reason := range c.bannedEvents {
+		banned[eventID] = reason
+	}
+	return banned
+}
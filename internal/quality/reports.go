@@ -0,0 +1,460 @@
+package quality
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// KindReport is the NIP-56 report event kind
+const KindReport = 1984
+
+const (
+	ReportActionQuarantine = "quarantine"
+	ReportActionBlock      = "block"
+
+	ResolutionUpheld     = "upheld"
+	ResolutionOverturned = "overturned"
+
+	// reportQuarantineReason marks events quarantined by weighted reports
+	reportQuarantineReason = "Reported by trusted users"
+
+	// maxReportTargets bounds the targets tracked without an action
+	maxReportTargets = 50000
+)
+
+// ErrReportActionNotFound is returned when resolving an unknown action
+var ErrReportActionNotFound = fmt.Errorf("report action not found")
+
+// TrustSource reports a pubkey's web of trust distance from the relay owner:
+// 0 for the owner, 1 for npubs the owner follows and -1 for unknown npubs
+type TrustSource interface {
+	WoTDistance(pubkey string) int
+}
+
+// ReportRecord is one report counted towards a target
+type ReportRecord struct {
+	ReportID string    `json:"report_id"`
+	Reporter string    `json:"reporter"`
+	Type     string    `json:"type,omitempty"`
+	Distance int       `json:"wot_distance"`
+	Accuracy float64   `json:"accuracy"`
+	Weight   float64   `json:"weight"`
+	At       time.Time `json:"at"`
+}
+
+// ReportAction is an automated action triggered by weighted reports, with
+// the reports that triggered it
+type ReportAction struct {
+	Target      string         `json:"target"`
+	TargetType  string         `json:"target_type"` // event or pubkey
+	Action      string         `json:"action"`
+	Score       float64        `json:"score"`
+	Threshold   float64        `json:"threshold"`
+	Reports     []ReportRecord `json:"reports"`
+	TriggeredAt time.Time      `json:"triggered_at"`
+	Resolution  string         `json:"resolution,omitempty"`
+	ResolvedAt  *time.Time     `json:"resolved_at,omitempty"`
+}
+
+// ReporterStats is a reporter's track record in resolved actions
+type ReporterStats struct {
+	Pubkey     string  `json:"pubkey"`
+	Upheld     int     `json:"upheld"`
+	Overturned int     `json:"overturned"`
+	Accuracy   float64 `json:"accuracy"`
+}
+
+type reportTarget struct {
+	targetType string
+	reports    map[string]ReportRecord // by reporter
+	score      float64
+}
+
+type reporterHistory struct {
+	upheld     int
+	overturned int
+}
+
+// accuracy is the Laplace-smoothed share of upheld reports, 0.5 for a
+// reporter with no resolved reports
+func (h reporterHistory) accuracy() float64 {
+	return float64(h.upheld+1) / float64(h.upheld+h.overturned+2)
+}
+
+// reportTracker accumulates weighted reports per target
+type reportTracker struct {
+	config    config.ReportConfig
+	targets   map[string]*reportTarget
+	reporters map[string]*reporterHistory
+	actions   map[string]*ReportAction
+	mu        sync.Mutex
+}
+
+func newReportTracker(cfg config.ReportConfig) *reportTracker {
+	if cfg.QuarantineThreshold <= 0 {
+		cfg.QuarantineThreshold = 3
+	}
+	if cfg.OwnerWeight <= 0 {
+		cfg.OwnerWeight = 3
+	}
+	if cfg.FollowWeight <= 0 {
+		cfg.FollowWeight = 1
+	}
+	if cfg.AccuracyWeight < 0 || cfg.AccuracyWeight > 1 {
+		cfg.AccuracyWeight = 0.5
+	}
+
+	return &reportTracker{
+		config:    cfg,
+		targets:   make(map[string]*reportTarget),
+		reporters: make(map[string]*reporterHistory),
+		actions:   make(map[string]*ReportAction),
+	}
+}
+
+// weight returns the weight of a report from a reporter at distance, scaled
+// by their accuracy between (1-AccuracyWeight) and (1+AccuracyWeight)
+func (t *reportTracker) weight(distance int, history reporterHistory) (float64, float64) {
+	base := t.config.UnknownWeight
+	switch distance {
+	case 0:
+		base = t.config.OwnerWeight
+	case 1:
+		base = t.config.FollowWeight
+	}
+
+	accuracy := history.accuracy()
+	return base * (1 + t.config.AccuracyWeight*(2*accuracy-1)), accuracy
+}
+
+// add counts a report against target and returns the action it triggers,
+// if any. Each reporter counts once per target.
+func (t *reportTracker) add(target, targetType string, record ReportRecord) *ReportAction {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, actioned := t.actions[target]; actioned {
+		return nil
+	}
+
+	entry, exists := t.targets[target]
+	if !exists {
+		if len(t.targets) >= maxReportTargets {
+			t.evictOne()
+		}
+		entry = &reportTarget{targetType: targetType, reports: make(map[string]ReportRecord)}
+		t.targets[target] = entry
+	}
+	if _, counted := entry.reports[record.Reporter]; counted {
+		return nil
+	}
+
+	history := reporterHistory{}
+	if h, ok := t.reporters[record.Reporter]; ok {
+		history = *h
+	}
+	record.Weight, record.Accuracy = t.weight(record.Distance, history)
+	entry.reports[record.Reporter] = record
+	entry.score += record.Weight
+
+	action, threshold := ReportActionQuarantine, t.config.QuarantineThreshold
+	if targetType == "pubkey" {
+		if t.config.BlockThreshold <= 0 {
+			return nil
+		}
+		action, threshold = ReportActionBlock, t.config.BlockThreshold
+	}
+	if entry.score < threshold {
+		return nil
+	}
+
+	triggered := &ReportAction{
+		Target:      target,
+		TargetType:  targetType,
+		Action:      action,
+		Score:       entry.score,
+		Threshold:   threshold,
+		Reports:     sortedReports(entry.reports),
+		TriggeredAt: time.Now(),
+	}
+	t.actions[target] = triggered
+	delete(t.targets, target)
+
+	copied := *triggered
+	return &copied
+}
+
+// evictOne drops the lowest scoring pending target. Callers must hold mu.
+func (t *reportTracker) evictOne() {
+	var lowest string
+	for target, entry := range t.targets {
+		if lowest == "" || entry.score < t.targets[lowest].score {
+			lowest = target
+		}
+	}
+	delete(t.targets, lowest)
+}
+
+// resolve records an admin decision on an action and updates the track
+// record of every reporter that contributed to it
+func (t *reportTracker) resolve(target string, upheld bool) (ReportAction, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	action, exists := t.actions[target]
+	if !exists {
+		return ReportAction{}, fmt.Errorf("%w: %s", ErrReportActionNotFound, target)
+	}
+	if action.Resolution != "" {
+		return *action, fmt.Errorf("report action for %s already %s", target, action.Resolution)
+	}
+
+	now := time.Now()
+	action.ResolvedAt = &now
+	action.Resolution = ResolutionOverturned
+	if upheld {
+		action.Resolution = ResolutionUpheld
+	}
+
+	for _, report := range action.Reports {
+		history, ok := t.reporters[report.Reporter]
+		if !ok {
+			history = &reporterHistory{}
+			t.reporters[report.Reporter] = history
+		}
+		if upheld {
+			history.upheld++
+		} else {
+			history.overturned++
+		}
+	}
+
+	return *action, nil
+}
+
+func (t *reportTracker) list() []ReportAction {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	actions := make([]ReportAction, 0, len(t.actions))
+	for _, action := range t.actions {
+		actions = append(actions, *action)
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		return actions[i].TriggeredAt.After(actions[j].TriggeredAt)
+	})
+	return actions
+}
+
+func (t *reportTracker) reporterStats() []ReporterStats {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	stats := make([]ReporterStats, 0, len(t.reporters))
+	for pubkey, h := range t.reporters {
+		stats = append(stats, ReporterStats{
+			Pubkey:     pubkey,
+			Upheld:     h.upheld,
+			Overturned: h.overturned,
+			Accuracy:   h.accuracy(),
+		})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Pubkey < stats[j].Pubkey
+	})
+	return stats
+}
+
+func (t *reportTracker) summary() map[string]interface{} {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	pending := 0
+	for _, action := range t.actions {
+		if action.Resolution == "" {
+			pending++
+		}
+	}
+	return map[string]interface{}{
+		"enabled":         t.config.Enabled,
+		"tracked_targets": len(t.targets),
+		"actions":         len(t.actions),
+		"pending_review":  pending,
+		"reporters":       len(t.reporters),
+	}
+}
+
+func sortedReports(reports map[string]ReportRecord) []ReportRecord {
+	records := make([]ReportRecord, 0, len(reports))
+	for _, r := range reports {
+		records = append(records, r)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].At.Before(records[j].At)
+	})
+	return records
+}
+
+// SetTrustSource sets where reporter web of trust distances come from.
+// Without one every reporter is weighted as unknown.
+func (c *Controller) SetTrustSource(trust TrustSource) {
+	c.trustMutex.Lock()
+	defer c.trustMutex.Unlock()
+	c.trust = trust
+}
+
+func (c *Controller) wotDistance(pubkey string) int {
+	c.trustMutex.RLock()
+	trust := c.trust
+	c.trustMutex.RUnlock()
+
+	if trust == nil {
+		return -1
+	}
+	return trust.WoTDistance(pubkey)
+}
+
+// ProcessReport counts a kind 1984 report towards the events and pubkeys it
+// reports and applies any automated action it triggers. Other kinds are
+// ignored.
+func (c *Controller) ProcessReport(event *models.Event) {
+	if event.Kind != KindReport || !c.reports.config.Enabled {
+		return
+	}
+
+	distance := c.wotDistance(event.PubKey)
+	record := func(reportType string) ReportRecord {
+		return ReportRecord{
+			ReportID: event.ID,
+			Reporter: event.PubKey,
+			Type:     reportType,
+			Distance: distance,
+			At:       time.Now(),
+		}
+	}
+
+	// Per NIP-56 an "e" tag reports a note and the "p" tag names its author;
+	// a "p" tag on its own reports the pubkey
+	reportedEvent := false
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "e" || tag[1] == "" {
+			continue
+		}
+		reportedEvent = true
+		reportType := ""
+		if len(tag) >= 3 {
+			reportType = tag[2]
+		}
+		if action := c.reports.add(tag[1], "event", record(reportType)); action != nil {
+			c.applyReportAction(action)
+		}
+	}
+	if reportedEvent {
+		return
+	}
+
+	for _, tag := range event.Tags {
+		if len(tag) < 2 || tag[0] != "p" || tag[1] == "" || tag[1] == event.PubKey {
+			continue
+		}
+		reportType := ""
+		if len(tag) >= 3 {
+			reportType = tag[2]
+		}
+		if action := c.reports.add(tag[1], "pubkey", record(reportType)); action != nil {
+			c.applyReportAction(action)
+		}
+	}
+}
+
+func (c *Controller) applyReportAction(action *ReportAction) {
+	log.Printf("Reports triggered %s of %s %s (score %.2f >= %.2f from %d report(s))",
+		action.Action, action.TargetType, action.Target, action.Score, action.Threshold, len(action.Reports))
+
+	switch action.Action {
+	case ReportActionBlock:
+		c.BlockNpub(action.Target)
+	case ReportActionQuarantine:
+		if err := c.setReportQuarantine(action.Target, true); err != nil {
+			log.Printf("Failed to quarantine reported event %s: %v", action.Target, err)
+		}
+	}
+}
+
+// setReportQuarantine quarantines or releases a stored event in the cache
+func (c *Controller) setReportQuarantine(eventID string, quarantined bool) error {
+	if c.cache == nil {
+		return fmt.Errorf("no cache configured")
+	}
+
+	events, err := cache.Collect(c.cache.GetEvents(context.Background(), nostr.Filter{IDs: []string{eventID}}))
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		return fmt.Errorf("event not found")
+	}
+
+	event := events[0]
+	if quarantined && event.Mirrored {
+		return fmt.Errorf("event belongs to a mirrored author")
+	}
+	if err := c.setQuarantined(eventID, reportQuarantineReason, quarantined); err != nil {
+		return err
+	}
+	if quarantined {
+		event.IsQuarantined = true
+		event.QuarantineReason = reportQuarantineReason
+	} else if event.QuarantineReason == reportQuarantineReason {
+		event.IsQuarantined = false
+		event.QuarantineReason = ""
+	} else {
+		return nil
+	}
+
+	// The cache ignores events it already holds, so replace the stored copy
+	if err := c.cache.DeleteEvent(eventID); err != nil {
+		return err
+	}
+	return c.cache.StoreEvent(event)
+}
+
+// ReportActions returns the automated actions triggered by reports, newest
+// first, with the reports behind each one
+func (c *Controller) ReportActions() []ReportAction {
+	return c.reports.list()
+}
+
+// ReporterStats returns the track record of reporters with resolved reports
+func (c *Controller) ReporterStats() []ReporterStats {
+	return c.reports.reporterStats()
+}
+
+// ResolveReportAction records whether an admin upheld an automated action.
+// Overturned actions are reverted and count against the reporters' accuracy.
+func (c *Controller) ResolveReportAction(target string, upheld bool) (ReportAction, error) {
+	action, err := c.reports.resolve(target, upheld)
+	if err != nil || upheld {
+		return action, err
+	}
+
+	switch action.Action {
+	case ReportActionBlock:
+		c.UnblockNpub(action.Target)
+	case ReportActionQuarantine:
+		if err := c.setReportQuarantine(action.Target, false); err != nil {
+			log.Printf("Failed to release reported event %s: %v", action.Target, err)
+		}
+	}
+	return action, nil
+}
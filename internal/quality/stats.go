@@ -0,0 +1,230 @@
+package quality
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Rejection reasons recorded by the quality controller
+const (
+	RejectBlocked        = "blocked"
+	RejectRateLimited    = "rate_limited"
+	RejectContentTooLong = "content_too_long"
+	RejectKindValidation = "kind_validation"
+	RejectPublishFailed  = "publish_failed"
+)
+
+const (
+	defaultStatsWindow    = time.Hour
+	maxStatsSamples       = 100000
+	topOffendersLimit     = 10
+	contentSizeBucketBase = 256
+)
+
+// statsSample is a single validated or rejected event inside the rolling window
+type statsSample struct {
+	at          time.Time
+	kind        int
+	pubkey      string
+	size        int
+	rejected    string
+	quarantined bool
+}
+
+// statsTracker keeps a rolling window of event samples for GetQualityStats
+type statsTracker struct {
+	window  time.Duration
+	samples []statsSample
+	mu      sync.Mutex
+}
+
+// KindStats summarises events of a single kind within the stats window
+type KindStats struct {
+	Events         int     `json:"events"`
+	Rejected       int     `json:"rejected"`
+	Quarantined    int     `json:"quarantined"`
+	QuarantineRate float64 `json:"quarantine_rate"`
+	TotalBytes     int     `json:"total_bytes"`
+	AvgSize        float64 `json:"avg_size"`
+}
+
+// Offender is an author ranked by rejected and quarantined events
+type Offender struct {
+	PubKey      string `json:"pubkey"`
+	Rejected    int    `json:"rejected"`
+	Quarantined int    `json:"quarantined"`
+	TotalBytes  int    `json:"total_bytes"`
+}
+
+// SizeDistribution describes content sizes seen within the stats window
+type SizeDistribution struct {
+	Count   int            `json:"count"`
+	Min     int            `json:"min"`
+	Max     int            `json:"max"`
+	Avg     float64        `json:"avg"`
+	P50     int            `json:"p50"`
+	P90     int            `json:"p90"`
+	P99     int            `json:"p99"`
+	Buckets map[string]int `json:"buckets"`
+}
+
+func newStatsTracker(window time.Duration) *statsTracker {
+	return &statsTracker{window: window}
+}
+
+func (s *statsTracker) record(sample statsSample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.samples = append(s.samples, sample)
+	s.trim(sample.at)
+}
+
+// trim drops samples older than the window. Callers must hold s.mu.
+func (s *statsTracker) trim(now time.Time) {
+	cutoff := now.Add(-s.window)
+	drop := 0
+	for drop < len(s.samples) && !s.samples[drop].at.After(cutoff) {
+		drop++
+	}
+	if len(s.samples)-drop > maxStatsSamples {
+		drop = len(s.samples) - maxStatsSamples
+	}
+	if drop > 0 {
+		s.samples = append(s.samples[:0], s.samples[drop:]...)
+	}
+}
+
+func (s *statsTracker) snapshot() []statsSample {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.trim(time.Now())
+	samples := make([]statsSample, len(s.samples))
+	copy(samples, s.samples)
+	return samples
+}
+
+// sizeBucket returns the power-of-four bucket label for a content size
+func sizeBucket(size int) string {
+	upper := contentSizeBucketBase
+	lower := 0
+	for size >= upper && upper < 1<<20 {
+		lower = upper
+		upper *= 4
+	}
+	if size >= upper {
+		return strconv.Itoa(upper) + "+"
+	}
+	return strconv.Itoa(lower) + "-" + strconv.Itoa(upper)
+}
+
+func percentile(sorted []int, p float64) int {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted)-1) * p)
+	return sorted[idx]
+}
+
+func sizeDistribution(samples []statsSample) SizeDistribution {
+	dist := SizeDistribution{Buckets: make(map[string]int)}
+	if len(samples) == 0 {
+		return dist
+	}
+
+	sizes := make([]int, 0, len(samples))
+	total := 0
+	for _, sample := range samples {
+		sizes = append(sizes, sample.size)
+		total += sample.size
+		dist.Buckets[sizeBucket(sample.size)]++
+	}
+	sort.Ints(sizes)
+
+	dist.Count = len(sizes)
+	dist.Min = sizes[0]
+	dist.Max = sizes[len(sizes)-1]
+	dist.Avg = float64(total) / float64(len(sizes))
+	dist.P50 = percentile(sizes, 0.50)
+	dist.P90 = percentile(sizes, 0.90)
+	dist.P99 = percentile(sizes, 0.99)
+	return dist
+}
+
+func kindBreakdown(samples []statsSample) map[string]*KindStats {
+	kinds := make(map[string]*KindStats)
+	for _, sample := range samples {
+		key := strconv.Itoa(sample.kind)
+		ks, exists := kinds[key]
+		if !exists {
+			ks = &KindStats{}
+			kinds[key] = ks
+		}
+		ks.Events++
+		ks.TotalBytes += sample.size
+		if sample.rejected != "" {
+			ks.Rejected++
+		}
+		if sample.quarantined {
+			ks.Quarantined++
+		}
+	}
+
+	for _, ks := range kinds {
+		ks.QuarantineRate = float64(ks.Quarantined) / float64(ks.Events)
+		ks.AvgSize = float64(ks.TotalBytes) / float64(ks.Events)
+	}
+	return kinds
+}
+
+func rejectionBreakdown(samples []statsSample) map[string]int {
+	reasons := make(map[string]int)
+	for _, sample := range samples {
+		if sample.rejected != "" {
+			reasons[sample.rejected]++
+		}
+	}
+	return reasons
+}
+
+func topOffenders(samples []statsSample, limit int) []Offender {
+	byAuthor := make(map[string]*Offender)
+	for _, sample := range samples {
+		o, exists := byAuthor[sample.pubkey]
+		if !exists {
+			o = &Offender{PubKey: sample.pubkey}
+			byAuthor[sample.pubkey] = o
+		}
+		o.TotalBytes += sample.size
+		if sample.rejected != "" {
+			o.Rejected++
+		}
+		if sample.quarantined {
+			o.Quarantined++
+		}
+	}
+
+	offenders := make([]Offender, 0, len(byAuthor))
+	for _, o := range byAuthor {
+		if o.Rejected+o.Quarantined > 0 {
+			offenders = append(offenders, *o)
+		}
+	}
+
+	sort.Slice(offenders, func(i, j int) bool {
+		si := offenders[i].Rejected + offenders[i].Quarantined
+		sj := offenders[j].Rejected + offenders[j].Quarantined
+		if si != sj {
+			return si > sj
+		}
+		return offenders[i].PubKey < offenders[j].PubKey
+	})
+
+	if len(offenders) > limit {
+		offenders = offenders[:limit]
+	}
+	return offenders
+}
@@ -0,0 +1,326 @@
+// Package quarantine holds quarantined events for review. Held events are
+// kept here and go no further: they are not cached, stored, broadcast or
+// forwarded, so no read serves them, until an admin releases them onto the
+// normal path. Purged events are deleted, and so are events nobody
+// reviewed in time.
+package quarantine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+)
+
+// saveInterval is how often held events are written and expired
+const saveInterval = time.Minute
+
+// ErrNotFound is returned for events that are not held
+var ErrNotFound = fmt.Errorf("event not in quarantine")
+
+// Entry is a held event awaiting review
+type Entry struct {
+	Event         *models.Event `json:"event"`
+	Reason        string        `json:"reason"`
+	QualityScore  float64       `json:"quality_score"`
+	QuarantinedAt time.Time     `json:"quarantined_at"`
+}
+
+// Queue holds quarantined events until they are released, purged or expire
+type Queue struct {
+	config config.QuarantineConfig
+
+	mu      sync.Mutex
+	entries map[string]*Entry
+	dirty   bool
+
+	onRelease func(event *models.Event)
+	onPurge   func(event *models.Event)
+
+	now func() time.Time
+}
+
+// NewQueue returns a queue loading the events held before from cfg.Path
+func NewQueue(cfg config.QuarantineConfig) (*Queue, error) {
+	q := &Queue{
+		config:  cfg,
+		entries: make(map[string]*Entry),
+		now:     time.Now,
+	}
+	if err := q.load(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// OnRelease sets what happens to released events: they are handed back
+// unflagged, to continue where they were held
+func (q *Queue) OnRelease(fn func(event *models.Event)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.onRelease = fn
+}
+
+// OnPurge sets what happens to purged and expired events
+func (q *Queue) OnPurge(fn func(event *models.Event)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.onPurge = fn
+}
+
+// Hold takes event into the queue if it is quarantined and reports whether
+// it did. Mirrored events are never held.
+func (q *Queue) Hold(event *models.Event) bool {
+	if !event.IsQuarantined || event.Mirrored {
+		return false
+	}
+
+	q.mu.Lock()
+	if _, ok := q.entries[event.ID]; !ok {
+		q.entries[event.ID] = &Entry{
+			Event:         event,
+			Reason:        event.QuarantineReason,
+			QualityScore:  event.QualityScore,
+			QuarantinedAt: q.now(),
+		}
+		q.dirty = true
+	}
+	evicted := q.evictLocked()
+	onPurge := q.onPurge
+	q.mu.Unlock()
+
+	purged(onPurge, evicted)
+	return true
+}
+
+// List returns the held events, oldest first, only author's when author is
+// set
+func (q *Queue) List(author string) []Entry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	entries := []Entry{}
+	for _, entry := range q.entries {
+		if author == "" || entry.Event.PubKey == author {
+			entries = append(entries, *entry)
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].QuarantinedAt.Before(entries[j].QuarantinedAt)
+	})
+	return entries
+}
+
+// Len returns how many events are held
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.entries)
+}
+
+// Release lets the held event with id continue onto the normal path
+func (q *Queue) Release(id string) (Entry, error) {
+	entries := q.take(func(entry *Entry) bool { return entry.Event.ID == id })
+	if len(entries) == 0 {
+		return Entry{}, ErrNotFound
+	}
+	q.release(entries)
+	return entries[0], nil
+}
+
+// ReleaseAuthor releases every held event by author and returns them
+func (q *Queue) ReleaseAuthor(author string) []Entry {
+	entries := q.take(func(entry *Entry) bool { return entry.Event.PubKey == author })
+	q.release(entries)
+	return entries
+}
+
+// Purge deletes the held event with id for good
+func (q *Queue) Purge(id string) (Entry, error) {
+	entries := q.take(func(entry *Entry) bool { return entry.Event.ID == id })
+	if len(entries) == 0 {
+		return Entry{}, ErrNotFound
+	}
+	q.purge(entries)
+	return entries[0], nil
+}
+
+// PurgeAuthor deletes every held event by author and returns them
+func (q *Queue) PurgeAuthor(author string) []Entry {
+	entries := q.take(func(entry *Entry) bool { return entry.Event.PubKey == author })
+	q.purge(entries)
+	return entries
+}
+
+// Expire purges the events held longer than ExpireAfter and returns how
+// many there were
+func (q *Queue) Expire() int {
+	if q.config.ExpireAfter <= 0 {
+		return 0
+	}
+	cutoff := q.now().Add(-q.config.ExpireAfter)
+	entries := q.take(func(entry *Entry) bool { return entry.QuarantinedAt.Before(cutoff) })
+	q.purge(entries)
+	return len(entries)
+}
+
+// Run expires unreviewed events and saves the queue every minute, and
+// saves once more when ctx is done
+func (q *Queue) Run(ctx context.Context) {
+	ticker := time.NewTicker(saveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			q.save()
+			return
+		case <-ticker.C:
+			if n := q.Expire(); n > 0 {
+				log.Printf("Purged %d unreviewed quarantined event(s)", n)
+			}
+			q.save()
+		}
+	}
+}
+
+// take removes and returns the entries matching match, oldest first
+func (q *Queue) take(match func(entry *Entry) bool) []Entry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var taken []Entry
+	for id, entry := range q.entries {
+		if match(entry) {
+			taken = append(taken, *entry)
+			delete(q.entries, id)
+		}
+	}
+	if len(taken) > 0 {
+		q.dirty = true
+	}
+	sort.Slice(taken, func(i, j int) bool {
+		return taken[i].QuarantinedAt.Before(taken[j].QuarantinedAt)
+	})
+	return taken
+}
+
+func (q *Queue) release(entries []Entry) {
+	q.mu.Lock()
+	onRelease := q.onRelease
+	q.mu.Unlock()
+
+	for _, entry := range entries {
+		entry.Event.IsQuarantined = false
+		entry.Event.QuarantineReason = ""
+		if onRelease != nil {
+			onRelease(entry.Event)
+		}
+	}
+}
+
+func (q *Queue) purge(entries []Entry) {
+	q.mu.Lock()
+	onPurge := q.onPurge
+	q.mu.Unlock()
+	purged(onPurge, entries)
+}
+
+func purged(onPurge func(event *models.Event), entries []Entry) {
+	if onPurge == nil {
+		return
+	}
+	for _, entry := range entries {
+		onPurge(entry.Event)
+	}
+}
+
+// evictLocked drops the oldest entries beyond MaxItems. Callers must hold
+// q.mu.
+func (q *Queue) evictLocked() []Entry {
+	if q.config.MaxItems <= 0 || len(q.entries) <= q.config.MaxItems {
+		return nil
+	}
+	all := make([]*Entry, 0, len(q.entries))
+	for _, entry := range q.entries {
+		all = append(all, entry)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return all[i].QuarantinedAt.Before(all[j].QuarantinedAt)
+	})
+
+	var evicted []Entry
+	for _, entry := range all[:len(all)-q.config.MaxItems] {
+		evicted = append(evicted, *entry)
+		delete(q.entries, entry.Event.ID)
+	}
+	return evicted
+}
+
+func (q *Queue) load() error {
+	if q.config.Path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(q.config.Path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", q.config.Path, err)
+	}
+	var entries []*Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", q.config.Path, err)
+	}
+	for _, entry := range entries {
+		if entry.Event != nil {
+			q.entries[entry.Event.ID] = entry
+		}
+	}
+	return nil
+}
+
+// save writes the held events if they changed since the last save
+func (q *Queue) save() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.dirty || q.config.Path == "" {
+		return
+	}
+	if err := q.saveLocked(); err != nil {
+		log.Printf("Failed to save quarantined events: %v", err)
+		return
+	}
+	q.dirty = false
+}
+
+// saveLocked atomically writes the held events to path. Callers must hold
+// q.mu.
+func (q *Queue) saveLocked() error {
+	entries := make([]*Entry, 0, len(q.entries))
+	for _, entry := range q.entries {
+		entries = append(entries, entry)
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return fmt.Errorf("failed to encode quarantined events: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(q.config.Path), 0755); err != nil {
+		return fmt.Errorf("failed to write quarantined events: %w", err)
+	}
+	tmp := q.config.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write quarantined events: %w", err)
+	}
+	if err := os.Rename(tmp, q.config.Path); err != nil {
+		return fmt.Errorf("failed to write quarantined events: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package quarantine
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+)
+
+func quarantined(id, pubkey string) *models.Event {
+	return &models.Event{ID: id, PubKey: pubkey, Kind: 1, IsQuarantined: true, QuarantineReason: "Low quality score", QualityScore: 0.2}
+}
+
+func TestHoldReleasePurge(t *testing.T) {
+	q, err := NewQueue(config.QuarantineConfig{})
+	helpers.AssertNoError(t, err)
+	var released, purged []string
+	q.OnRelease(func(event *models.Event) {
+		helpers.AssertFalse(t, event.IsQuarantined)
+		released = append(released, event.ID)
+	})
+	q.OnPurge(func(event *models.Event) { purged = append(purged, event.ID) })
+
+	helpers.AssertFalse(t, q.Hold(&models.Event{ID: "clean"}))
+	mirrored := quarantined("mirrored", "alice")
+	mirrored.Mirrored = true
+	helpers.AssertFalse(t, q.Hold(mirrored))
+
+	helpers.AssertTrue(t, q.Hold(quarantined("a1", "alice")))
+	helpers.AssertTrue(t, q.Hold(quarantined("a2", "alice")))
+	helpers.AssertTrue(t, q.Hold(quarantined("b1", "bob")))
+	helpers.AssertIntEqual(t, 3, q.Len())
+	helpers.AssertIntEqual(t, 2, len(q.List("alice")))
+
+	entry, err := q.Release("b1")
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, "Low quality score", entry.Reason)
+	helpers.AssertFloat64Equal(t, 0.2, entry.QualityScore, 0.001)
+	_, err = q.Release("b1")
+	helpers.AssertTrue(t, err == ErrNotFound)
+
+	helpers.AssertIntEqual(t, 2, len(q.PurgeAuthor("alice")))
+	helpers.AssertIntEqual(t, 0, q.Len())
+	helpers.AssertStringEqual(t, "b1", strings.Join(released, ","))
+	helpers.AssertIntEqual(t, 2, len(purged))
+}
+
+func TestExpireAndEvict(t *testing.T) {
+	q, err := NewQueue(config.QuarantineConfig{ExpireAfter: time.Hour, MaxItems: 2})
+	helpers.AssertNoError(t, err)
+	var purged []string
+	q.OnPurge(func(event *models.Event) { purged = append(purged, event.ID) })
+
+	now := time.Now()
+	q.now = func() time.Time { return now }
+	q.Hold(quarantined("old", "alice"))
+	q.now = func() time.Time { return now.Add(30 * time.Minute) }
+	q.Hold(quarantined("mid", "alice"))
+	q.now = func() time.Time { return now.Add(50 * time.Minute) }
+	q.Hold(quarantined("new", "alice"))
+
+	// Over MaxItems, the oldest goes first
+	helpers.AssertStringEqual(t, "old", strings.Join(purged, ","))
+
+	q.now = func() time.Time { return now.Add(95 * time.Minute) }
+	helpers.AssertIntEqual(t, 1, q.Expire())
+	helpers.AssertStringEqual(t, "old,mid", strings.Join(purged, ","))
+	helpers.AssertStringEqual(t, "new", q.List("")[0].Event.ID)
+}
+
+func TestPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quarantine.json")
+	q, err := NewQueue(config.QuarantineConfig{Path: path})
+	helpers.AssertNoError(t, err)
+	q.Hold(quarantined("a1", "alice"))
+	q.save()
+
+	reloaded, err := NewQueue(config.QuarantineConfig{Path: path})
+	helpers.AssertNoError(t, err)
+	entries := reloaded.List("")
+	helpers.AssertIntEqual(t, 1, len(entries))
+	helpers.AssertStringEqual(t, "a1", entries[0].Event.ID)
+	helpers.AssertStringEqual(t, "Low quality score", entries[0].Reason)
+}
@@ -0,0 +1,161 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// ErrInvalidQuery is returned when a filter expression cannot be parsed
+var ErrInvalidQuery = fmt.Errorf("invalid query")
+
+// ParseFilter parses a filter expression such as
+//
+//	kind=1 author=npub1... since=2h limit=50 #t=bitcoin
+//
+// into a Nostr filter. Values may be comma separated and keys may repeat.
+func ParseFilter(expr string) (nostr.Filter, error) {
+	return parseTerms(strings.Fields(expr), time.Now())
+}
+
+// ParseArgs parses filter terms that were already split, e.g. from os.Args
+func ParseArgs(args []string) (nostr.Filter, error) {
+	return parseTerms(args, time.Now())
+}
+
+func parseTerms(terms []string, now time.Time) (nostr.Filter, error) {
+	var filter nostr.Filter
+
+	for _, term := range terms {
+		key, value, ok := strings.Cut(term, "=")
+		if !ok || key == "" || value == "" {
+			return filter, fmt.Errorf("%w: expected key=value, got %q", ErrInvalidQuery, term)
+		}
+		values := strings.Split(value, ",")
+
+		switch {
+		case key == "kind" || key == "kinds":
+			for _, v := range values {
+				kind, err := strconv.Atoi(v)
+				if err != nil {
+					return filter, fmt.Errorf("%w: kind %q is not a number", ErrInvalidQuery, v)
+				}
+				filter.Kinds = append(filter.Kinds, kind)
+			}
+		case key == "author" || key == "authors":
+			for _, v := range values {
+				pubkey, err := decodePubkey(v)
+				if err != nil {
+					return filter, err
+				}
+				filter.Authors = append(filter.Authors, pubkey)
+			}
+		case key == "id" || key == "ids":
+			for _, v := range values {
+				id, err := decodeEventID(v)
+				if err != nil {
+					return filter, err
+				}
+				filter.IDs = append(filter.IDs, id)
+			}
+		case key == "since" || key == "until":
+			ts, err := parseTime(value, now)
+			if err != nil {
+				return filter, err
+			}
+			if key == "since" {
+				filter.Since = &ts
+			} else {
+				filter.Until = &ts
+			}
+		case key == "limit":
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 0 {
+				return filter, fmt.Errorf("%w: limit %q is not a positive number", ErrInvalidQuery, value)
+			}
+			filter.Limit = limit
+		case key == "search":
+			filter.Search = value
+		case strings.HasPrefix(key, "#") && len(key) == 2:
+			if filter.Tags == nil {
+				filter.Tags = make(nostr.TagMap)
+			}
+			filter.Tags[key[1:]] = append(filter.Tags[key[1:]], values...)
+		default:
+			return filter, fmt.Errorf("%w: unknown key %q", ErrInvalidQuery, key)
+		}
+	}
+
+	return filter, nil
+}
+
+// decodePubkey accepts either an npub or a 64 character hex pubkey
+func decodePubkey(value string) (string, error) {
+	if strings.HasPrefix(value, "npub1") {
+		prefix, data, err := nip19.Decode(value)
+		if err != nil || prefix != "npub" {
+			return "", fmt.Errorf("%w: bad npub %q", ErrInvalidQuery, value)
+		}
+		return data.(string), nil
+	}
+	if !nostr.IsValid32ByteHex(value) {
+		return "", fmt.Errorf("%w: author %q is neither npub nor hex", ErrInvalidQuery, value)
+	}
+	return value, nil
+}
+
+// decodeEventID accepts either a note1 bech32 ID or a hex event ID
+func decodeEventID(value string) (string, error) {
+	if strings.HasPrefix(value, "note1") {
+		prefix, data, err := nip19.Decode(value)
+		if err != nil || prefix != "note" {
+			return "", fmt.Errorf("%w: bad note id %q", ErrInvalidQuery, value)
+		}
+		return data.(string), nil
+	}
+	if !nostr.IsValid32ByteHex(value) {
+		return "", fmt.Errorf("%w: id %q is neither note1 nor hex", ErrInvalidQuery, value)
+	}
+	return value, nil
+}
+
+// parseTime accepts a unix timestamp, an RFC3339 or YYYY-MM-DD date, or a
+// duration relative to now such as 30m, 2h, 7d or 1w
+func parseTime(value string, now time.Time) (nostr.Timestamp, error) {
+	if unix, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return nostr.Timestamp(unix), nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return nostr.Timestamp(t.Unix()), nil
+	}
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return nostr.Timestamp(t.Unix()), nil
+	}
+
+	d, err := parseRelative(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: cannot parse time %q", ErrInvalidQuery, value)
+	}
+	return nostr.Timestamp(now.Add(-d).Unix()), nil
+}
+
+// parseRelative extends time.ParseDuration with d (days) and w (weeks)
+func parseRelative(value string) (time.Duration, error) {
+	unit := value[len(value)-1]
+	if unit == 'd' || unit == 'w' {
+		n, err := strconv.Atoi(value[:len(value)-1])
+		if err != nil {
+			return 0, err
+		}
+		day := 24 * time.Hour
+		if unit == 'w' {
+			return time.Duration(n) * 7 * day, nil
+		}
+		return time.Duration(n) * day, nil
+	}
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,79 @@
+package query
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+func TestParseFilter(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	hexPubkey := strings.Repeat("ab", 32)
+	npub, err := nip19.EncodePublicKey(hexPubkey)
+	helpers.AssertNoError(t, err)
+
+	t.Run("Full expression", func(t *testing.T) {
+		filter, err := parseTerms(strings.Fields("kind=1,30023 author="+npub+" since=2h limit=50 #t=bitcoin,nostr"), now)
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, 2, len(filter.Kinds))
+		helpers.AssertIntEqual(t, 30023, filter.Kinds[1])
+		helpers.AssertStringEqual(t, hexPubkey, filter.Authors[0])
+		helpers.AssertIntEqual(t, 50, filter.Limit)
+		helpers.AssertIntEqual(t, int(now.Add(-2*time.Hour).Unix()), int(*filter.Since))
+		helpers.AssertIntEqual(t, 2, len(filter.Tags["t"]))
+	})
+
+	t.Run("Days, weeks and absolute times", func(t *testing.T) {
+		filter, err := parseTerms([]string{"since=1w", "until=1d"}, now)
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, int(now.Add(-7*24*time.Hour).Unix()), int(*filter.Since))
+		helpers.AssertIntEqual(t, int(now.Add(-24*time.Hour).Unix()), int(*filter.Until))
+
+		filter, err = parseTerms([]string{"since=1690000000", "until=2024-01-15"}, now)
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, 1690000000, int(*filter.Since))
+		helpers.AssertIntEqual(t, 1705276800, int(*filter.Until))
+	})
+
+	t.Run("Invalid terms", func(t *testing.T) {
+		for _, expr := range []string{"kind=abc", "author=bob", "color=red", "limit", "since=yesterday", "#tag=x"} {
+			_, err := ParseFilter(expr)
+			helpers.AssertBoolEqual(t, true, errors.Is(err, ErrInvalidQuery))
+		}
+	})
+}
+
+func TestWriteEvents(t *testing.T) {
+	events := []*models.Event{{
+		ID:        strings.Repeat("1", 64),
+		PubKey:    strings.Repeat("2", 64),
+		CreatedAt: nostr.Timestamp(1700000000),
+		Kind:      1,
+		Content:   "hello\nworld",
+	}}
+
+	t.Run("ndjson", func(t *testing.T) {
+		var buf bytes.Buffer
+		helpers.AssertNoError(t, WriteEvents(&buf, events, FormatNDJSON))
+		helpers.AssertIntEqual(t, 1, strings.Count(buf.String(), "\n"))
+	})
+
+	t.Run("table", func(t *testing.T) {
+		var buf bytes.Buffer
+		helpers.AssertNoError(t, WriteEvents(&buf, events, FormatTable))
+		helpers.AssertBoolEqual(t, true, strings.Contains(buf.String(), "hello world"))
+		helpers.AssertBoolEqual(t, true, strings.Contains(buf.String(), "1 event(s)"))
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		helpers.AssertError(t, WriteEvents(&bytes.Buffer{}, events, "xml"))
+	})
+}
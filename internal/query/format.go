@@ -0,0 +1,83 @@
+package query
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"mercury-relay/internal/models"
+)
+
+// Output formats supported by WriteEvents
+const (
+	FormatTable  = "table"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+)
+
+const contentPreviewLength = 60
+
+// WriteEvents renders events to w in the requested format
+func WriteEvents(w io.Writer, events []*models.Event, format string) error {
+	switch format {
+	case FormatTable, "":
+		return writeTable(w, events)
+	case FormatJSON:
+		nostrEvents := make([]interface{}, 0, len(events))
+		for _, event := range events {
+			nostrEvents = append(nostrEvents, event.ToNostrEvent())
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(nostrEvents)
+	case FormatNDJSON:
+		enc := json.NewEncoder(w)
+		for _, event := range events {
+			if err := enc.Encode(event.ToNostrEvent()); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q (use table, json or ndjson)", format)
+	}
+}
+
+func writeTable(w io.Writer, events []*models.Event) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tKIND\tAUTHOR\tCREATED\tCONTENT")
+	for _, event := range events {
+		created := event.CreatedTime().Format("2006-01-02 15:04")
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t%s\n",
+			shorten(event.ID, 12),
+			event.Kind,
+			shorten(event.PubKey, 12),
+			created,
+			preview(event.Content),
+		)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "\n%d event(s)\n", len(events))
+	return err
+}
+
+func shorten(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "…"
+}
+
+// preview flattens content onto a single line and truncates it for the table
+func preview(content string) string {
+	content = strings.Join(strings.Fields(content), " ")
+	runes := []rune(content)
+	if len(runes) > contentPreviewLength {
+		return string(runes[:contentPreviewLength]) + "…"
+	}
+	return content
+}
@@ -0,0 +1,105 @@
+package query
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Source answers filter queries from either local storage or a remote relay
+type Source interface {
+	Query(ctx context.Context, filter nostr.Filter) ([]*models.Event, error)
+}
+
+// CacheSource queries the relay's local event cache directly
+type CacheSource struct {
+	cache cache.Cache
+}
+
+func NewCacheSource(cache cache.Cache) *CacheSource {
+	return &CacheSource{cache: cache}
+}
+
+func (s *CacheSource) Query(ctx context.Context, filter nostr.Filter) ([]*models.Event, error) {
+	var events []*models.Event
+	for event, err := range s.cache.GetEvents(ctx, filter) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to query cache: %w", err)
+		}
+		events = append(events, event)
+		if filter.Limit > 0 && len(events) == filter.Limit {
+			break
+		}
+	}
+	return events, nil
+}
+
+// RESTSource queries a remote Mercury relay through its /api/v1/query endpoint
+type RESTSource struct {
+	baseURL string
+	npub    string
+	client  *http.Client
+}
+
+func NewRESTSource(baseURL, npub string) *RESTSource {
+	return &RESTSource{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		npub:    npub,
+		client:  &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *RESTSource) Query(ctx context.Context, filter nostr.Filter) ([]*models.Event, error) {
+	body, err := json.Marshal(map[string]interface{}{"filter": filter})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode filter: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", s.baseURL+"/api/v1/query", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if s.npub != "" {
+		req.Header.Set("X-Nostr-Pubkey", s.npub)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query relay: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	var result struct {
+		Success bool          `json:"success"`
+		Data    []nostr.Event `json:"data"`
+		Error   string        `json:"error"`
+	}
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("relay returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(data)))
+	}
+	if !result.Success {
+		return nil, fmt.Errorf("relay returned status %d: %s", resp.StatusCode, result.Error)
+	}
+
+	events := make([]*models.Event, 0, len(result.Data))
+	for i := range result.Data {
+		events = append(events, models.FromNostrEvent(&result.Data[i]))
+	}
+	return events, nil
+}
@@ -14,3 +14,19 @@ type Queue interface {
 	GetKindQueueStats(kind int) (int, error)
 	GetAllKindQueueStats() (map[int]int, error)
 }
+
+// Delivery is a consumed event whose message stays unacknowledged until Ack
+// or Nack is called. Redelivered is set when the broker handed the message
+// out before.
+type Delivery struct {
+	Event       *models.Event
+	Redelivered bool
+	Ack         func() error
+	Nack        func(requeue bool) error
+}
+
+// BatchConsumer is implemented by queues that can hand out several messages
+// at once and defer their acknowledgement until the caller has stored them
+type BatchConsumer interface {
+	ConsumeBatch(max int) ([]Delivery, error)
+}
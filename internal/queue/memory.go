@@ -0,0 +1,468 @@
+package queue
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/logging"
+	"mercury-relay/internal/models"
+)
+
+// Overflow policies of the memory queue
+const (
+	OverflowBlock      = "block"
+	OverflowDropNewest = "drop_newest"
+	OverflowDropOldest = "drop_oldest"
+	OverflowSpill      = "spill"
+)
+
+var (
+	// ErrQueueFull is returned by PublishEvent when the memory queue is
+	// full and its overflow policy rejects the event
+	ErrQueueFull = errors.New("queue is full")
+	// ErrQueueClosed is returned by PublishEvent after Close
+	ErrQueueClosed = errors.New("queue is closed")
+)
+
+// dropLogEvery is how many dropped events are counted between log lines
+const dropLogEvery = 1000
+
+// Memory is an in-process Queue for relays that run without a broker: a
+// bounded channel of events, with a copy of each kept on its kind topic as
+// RabbitMQ does. Events are held only in memory, so they are lost on a
+// crash unless they were spilled to disk.
+type Memory struct {
+	events   chan *models.Event
+	config   config.QueueConfig
+	requeued []*models.Event // nacked for redelivery, handed out first
+	kinds    map[int][]*models.Event
+	spill    *spillFile
+	dropped  int64
+	closed   bool
+	mu       sync.Mutex
+}
+
+// NewMemory creates a memory queue. With the spill policy, events left in
+// the spill file by the last run are queued again.
+func NewMemory(cfg config.QueueConfig) (*Memory, error) {
+	capacity := cfg.Capacity
+	if capacity <= 0 {
+		capacity = 10000
+	}
+	m := &Memory{
+		events: make(chan *models.Event, capacity),
+		config: cfg,
+		kinds:  make(map[int][]*models.Event),
+	}
+	if cfg.Overflow == OverflowSpill {
+		spill, err := openSpillFile(cfg.SpillPath)
+		if err != nil {
+			return nil, err
+		}
+		m.spill = spill
+		if spill.pending > 0 {
+			slog.Info("Requeueing spilled events", "events", spill.pending, "path", cfg.SpillPath)
+		}
+		m.mu.Lock()
+		m.refill()
+		m.mu.Unlock()
+	}
+	return m, nil
+}
+
+// PublishEvent queues event, applying the overflow policy when the queue is
+// full
+func (m *Memory) PublishEvent(event *models.Event) error {
+	if m.config.Overflow == OverflowBlock || m.config.Overflow == "" {
+		if err := m.publishBlocking(event); err != nil {
+			return err
+		}
+		m.routeToKind(event)
+		return nil
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return ErrQueueClosed
+	}
+	switch m.config.Overflow {
+	case OverflowDropNewest:
+		select {
+		case m.events <- event:
+		default:
+			return ErrQueueFull
+		}
+	case OverflowDropOldest:
+		for queued := false; !queued; {
+			select {
+			case m.events <- event:
+				queued = true
+			default:
+				select {
+				case old := <-m.events:
+					m.dropped++
+					if m.dropped%dropLogEvery == 1 {
+						slog.Warn("Memory queue full, dropping oldest events", "dropped", m.dropped,
+							logging.KeyEventID, old.ID, logging.KeyTraceID, old.TraceID)
+					}
+				default:
+				}
+			}
+		}
+	case OverflowSpill:
+		// Once anything is spilled, later events go after it to keep order
+		queued := false
+		if m.spill.pending == 0 {
+			select {
+			case m.events <- event:
+				queued = true
+			default:
+			}
+		}
+		if !queued {
+			if err := m.spill.append(event); err != nil {
+				return fmt.Errorf("failed to spill event: %w", err)
+			}
+		}
+	}
+	m.routeToKindLocked(event)
+	return nil
+}
+
+// publishBlocking waits up to the block timeout for room in the queue
+func (m *Memory) publishBlocking(event *models.Event) error {
+	m.mu.Lock()
+	closed := m.closed
+	m.mu.Unlock()
+	if closed {
+		return ErrQueueClosed
+	}
+	select {
+	case m.events <- event:
+		return nil
+	default:
+	}
+	timeout := m.config.BlockTimeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case m.events <- event:
+		return nil
+	case <-timer.C:
+		return ErrQueueFull
+	}
+}
+
+func (m *Memory) routeToKind(event *models.Event) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.routeToKindLocked(event)
+}
+
+// routeToKindLocked keeps a copy of event on its kind topic, dropping the
+// oldest copy when the topic is full
+func (m *Memory) routeToKindLocked(event *models.Event) {
+	topic := kindTopic(event)
+	queued := m.kinds[topic]
+	if len(queued) >= cap(m.events) {
+		queued = queued[1:]
+	}
+	m.kinds[topic] = append(queued, event)
+}
+
+// ConsumeEvents takes the next queued event, if any
+func (m *Memory) ConsumeEvents() ([]*models.Event, error) {
+	deliveries, err := m.ConsumeBatch(1)
+	if err != nil {
+		return nil, err
+	}
+	events := make([]*models.Event, len(deliveries))
+	for i, d := range deliveries {
+		events[i] = d.Event
+	}
+	return events, nil
+}
+
+// ConsumeBatch takes up to max queued events without waiting. Ack is a
+// no-op; Nack with requeue hands the event out again before newer ones.
+func (m *Memory) ConsumeBatch(max int) ([]Delivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deliveries []Delivery
+	for len(deliveries) < max && len(m.requeued) > 0 {
+		deliveries = append(deliveries, m.delivery(m.requeued[0], true))
+		m.requeued = m.requeued[1:]
+	}
+drain:
+	for len(deliveries) < max {
+		select {
+		case event := <-m.events:
+			deliveries = append(deliveries, m.delivery(event, false))
+		default:
+			if m.spill == nil || m.spill.pending == 0 {
+				break drain
+			}
+			m.refill()
+		}
+	}
+	m.refill()
+	return deliveries, nil
+}
+
+func (m *Memory) delivery(event *models.Event, redelivered bool) Delivery {
+	return Delivery{
+		Event:       event,
+		Redelivered: redelivered,
+		Ack:         func() error { return nil },
+		Nack: func(requeue bool) error {
+			if requeue {
+				m.mu.Lock()
+				m.requeued = append(m.requeued, event)
+				m.mu.Unlock()
+			}
+			return nil
+		},
+	}
+}
+
+// refill moves spilled events into the queue while it has room; the caller
+// holds the lock
+func (m *Memory) refill() {
+	for m.spill != nil && m.spill.pending > 0 && len(m.events) < cap(m.events) {
+		event, err := m.spill.next()
+		if err != nil {
+			slog.Error("Failed to read spilled event", "error", err)
+			continue
+		}
+		m.events <- event
+	}
+}
+
+// GetQueueStats returns the number of queued events, spilled ones included
+func (m *Memory) GetQueueStats() (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	count := len(m.events) + len(m.requeued)
+	if m.spill != nil {
+		count += m.spill.pending
+	}
+	return count, nil
+}
+
+// ConsumeEventsByKind takes the next event from a kind topic
+func (m *Memory) ConsumeEventsByKind(kind int) ([]*models.Event, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	topic := consumerTopic(kind)
+	queued := m.kinds[topic]
+	if len(queued) == 0 {
+		return []*models.Event{}, nil
+	}
+	m.kinds[topic] = queued[1:]
+	return []*models.Event{queued[0]}, nil
+}
+
+// GetKindQueueStats returns the number of events on a kind topic
+func (m *Memory) GetKindQueueStats(kind int) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return len(m.kinds[consumerTopic(kind)]), nil
+}
+
+// GetAllKindQueueStats returns the number of events on every kind topic
+func (m *Memory) GetAllKindQueueStats() (map[int]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stats := make(map[int]int)
+	for _, kind := range getCommonKinds() {
+		stats[kind] = len(m.kinds[kind])
+	}
+	stats[topicUndefined] = len(m.kinds[topicUndefined])
+	stats[topicModeration] = len(m.kinds[topicModeration])
+	return stats, nil
+}
+
+// consumerTopic maps a requested kind to its topic, as for RabbitMQ's kind
+// queues
+func consumerTopic(kind int) int {
+	if kind == topicUndefined || kind == topicModeration {
+		return kind
+	}
+	for _, knownKind := range getCommonKinds() {
+		if kind == knownKind {
+			return kind
+		}
+	}
+	return topicUndefined
+}
+
+// Close stops accepting events. With the spill policy, the events still
+// queued are written to the spill file ahead of those already there, so the
+// next start picks them up in order.
+func (m *Memory) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closed {
+		return nil
+	}
+	m.closed = true
+	if m.spill == nil {
+		return nil
+	}
+
+	queued := m.requeued
+	m.requeued = nil
+	for len(m.events) > 0 {
+		queued = append(queued, <-m.events)
+	}
+	if err := m.spill.prepend(queued); err != nil {
+		m.spill.close()
+		return fmt.Errorf("failed to spill queued events: %w", err)
+	}
+	return m.spill.close()
+}
+
+// spillFile is a JSON lines file of events that didn't fit in the memory
+// queue. Events are appended at the end and read from the front; the file
+// is truncated once it has been read through.
+type spillFile struct {
+	path    string
+	writer  *os.File
+	reader  *os.File
+	buf     *bufio.Reader
+	pending int
+}
+
+func openSpillFile(path string) (*spillFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create spill directory: %w", err)
+	}
+	writer, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spill file: %w", err)
+	}
+	reader, err := os.Open(path)
+	if err != nil {
+		writer.Close()
+		return nil, fmt.Errorf("failed to open spill file: %w", err)
+	}
+	s := &spillFile{path: path, writer: writer, reader: reader, buf: bufio.NewReader(reader)}
+
+	// Count what the last run left behind
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) > 0 {
+			s.pending++
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		s.close()
+		return nil, fmt.Errorf("failed to read spill file: %w", err)
+	}
+	if _, err := reader.Seek(0, io.SeekStart); err != nil {
+		s.close()
+		return nil, fmt.Errorf("failed to read spill file: %w", err)
+	}
+	return s, nil
+}
+
+func (s *spillFile) append(event *models.Event) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	if _, err := s.writer.Write(append(data, '\n')); err != nil {
+		return err
+	}
+	s.pending++
+	return nil
+}
+
+// next reads the oldest spilled event
+func (s *spillFile) next() (*models.Event, error) {
+	line, err := s.buf.ReadBytes('\n')
+	if err != nil && !(err == io.EOF && len(line) > 0) {
+		// The count is off, e.g. a torn last line; start over empty
+		s.pending = 0
+		s.reset()
+		return nil, err
+	}
+	s.pending--
+	if s.pending == 0 {
+		s.reset()
+	}
+	var event models.Event
+	if err := json.Unmarshal(line, &event); err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// reset empties the file once everything in it has been read
+func (s *spillFile) reset() {
+	if err := s.writer.Truncate(0); err != nil {
+		slog.Error("Failed to truncate spill file", "path", s.path, "error", err)
+	}
+	s.reader.Seek(0, io.SeekStart)
+	s.buf.Reset(s.reader)
+}
+
+// prepend rewrites the file with events ahead of the unread spilled ones
+func (s *spillFile) prepend(events []*models.Event) error {
+	if len(events) == 0 {
+		return nil
+	}
+	tmpPath := s.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	for _, event := range events {
+		if err = encoder.Encode(event); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		_, err = io.Copy(writer, s.buf)
+	}
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, s.path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+	s.pending += len(events)
+	return nil
+}
+
+func (s *spillFile) close() error {
+	s.reader.Close()
+	return s.writer.Close()
+}
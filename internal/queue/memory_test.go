@@ -0,0 +1,159 @@
+package queue
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func memoryEvent(i int) *models.Event {
+	return &models.Event{
+		ID:        fmt.Sprintf("%064d", i),
+		PubKey:    "pubkey",
+		Sig:       "sig",
+		CreatedAt: nostr.Now(),
+		Kind:      1,
+		Content:   fmt.Sprintf("event %d", i),
+	}
+}
+
+func consumeIDs(t *testing.T, q *Memory, max int) []string {
+	t.Helper()
+	deliveries, err := q.ConsumeBatch(max)
+	helpers.AssertNoError(t, err)
+	ids := make([]string, len(deliveries))
+	for i, d := range deliveries {
+		ids[i] = d.Event.Content
+	}
+	return ids
+}
+
+func TestMemoryQueueOverflow(t *testing.T) {
+	t.Run("drop newest rejects when full", func(t *testing.T) {
+		q, err := NewMemory(config.QueueConfig{Capacity: 2, Overflow: OverflowDropNewest})
+		helpers.AssertNoError(t, err)
+		helpers.AssertNoError(t, q.PublishEvent(memoryEvent(1)))
+		helpers.AssertNoError(t, q.PublishEvent(memoryEvent(2)))
+		helpers.AssertTrue(t, errors.Is(q.PublishEvent(memoryEvent(3)), ErrQueueFull))
+		helpers.AssertStringEqual(t, "[event 1 event 2]", fmt.Sprint(consumeIDs(t, q, 10)))
+	})
+
+	t.Run("drop oldest keeps the newest", func(t *testing.T) {
+		q, err := NewMemory(config.QueueConfig{Capacity: 2, Overflow: OverflowDropOldest})
+		helpers.AssertNoError(t, err)
+		for i := 1; i <= 3; i++ {
+			helpers.AssertNoError(t, q.PublishEvent(memoryEvent(i)))
+		}
+		helpers.AssertStringEqual(t, "[event 2 event 3]", fmt.Sprint(consumeIDs(t, q, 10)))
+	})
+
+	t.Run("block times out", func(t *testing.T) {
+		q, err := NewMemory(config.QueueConfig{Capacity: 1, Overflow: OverflowBlock, BlockTimeout: 20 * time.Millisecond})
+		helpers.AssertNoError(t, err)
+		helpers.AssertNoError(t, q.PublishEvent(memoryEvent(1)))
+		helpers.AssertTrue(t, errors.Is(q.PublishEvent(memoryEvent(2)), ErrQueueFull))
+
+		// A consumer makes room for a waiting publisher
+		go func() {
+			time.Sleep(5 * time.Millisecond)
+			q.ConsumeBatch(1)
+		}()
+		q.config.BlockTimeout = time.Second
+		helpers.AssertNoError(t, q.PublishEvent(memoryEvent(3)))
+		helpers.AssertStringEqual(t, "[event 3]", fmt.Sprint(consumeIDs(t, q, 10)))
+	})
+}
+
+func TestMemoryQueueRequeue(t *testing.T) {
+	q, err := NewMemory(config.QueueConfig{Capacity: 10, Overflow: OverflowBlock})
+	helpers.AssertNoError(t, err)
+	helpers.AssertNoError(t, q.PublishEvent(memoryEvent(1)))
+	helpers.AssertNoError(t, q.PublishEvent(memoryEvent(2)))
+
+	deliveries, err := q.ConsumeBatch(1)
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 1, len(deliveries))
+	helpers.AssertNoError(t, deliveries[0].Nack(true))
+
+	deliveries, err = q.ConsumeBatch(10)
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 2, len(deliveries))
+	helpers.AssertStringEqual(t, "event 1", deliveries[0].Event.Content)
+	helpers.AssertTrue(t, deliveries[0].Redelivered)
+	helpers.AssertFalse(t, deliveries[1].Redelivered)
+
+	count, _ := q.GetQueueStats()
+	helpers.AssertIntEqual(t, 0, count)
+}
+
+func TestMemoryQueueSpill(t *testing.T) {
+	cfg := config.QueueConfig{
+		Capacity:  2,
+		Overflow:  OverflowSpill,
+		SpillPath: filepath.Join(t.TempDir(), "spill", "queue.jsonl"),
+	}
+	q, err := NewMemory(cfg)
+	helpers.AssertNoError(t, err)
+	for i := 1; i <= 5; i++ {
+		helpers.AssertNoError(t, q.PublishEvent(memoryEvent(i)))
+	}
+	count, _ := q.GetQueueStats()
+	helpers.AssertIntEqual(t, 5, count)
+
+	// Spilled events come back in order as room frees up
+	helpers.AssertStringEqual(t, "[event 1]", fmt.Sprint(consumeIDs(t, q, 1)))
+	helpers.AssertNoError(t, q.PublishEvent(memoryEvent(6)))
+	helpers.AssertStringEqual(t, "[event 2 event 3]", fmt.Sprint(consumeIDs(t, q, 2)))
+
+	// What is left survives a restart, queued events ahead of spilled ones
+	helpers.AssertNoError(t, q.Close())
+	helpers.AssertTrue(t, errors.Is(q.PublishEvent(memoryEvent(7)), ErrQueueClosed))
+	q, err = NewMemory(cfg)
+	helpers.AssertNoError(t, err)
+	count, _ = q.GetQueueStats()
+	helpers.AssertIntEqual(t, 3, count)
+	helpers.AssertStringEqual(t, "[event 4 event 5 event 6]", fmt.Sprint(consumeIDs(t, q, 10)))
+	helpers.AssertNoError(t, q.Close())
+}
+
+func TestMemoryQueueKindTopics(t *testing.T) {
+	q, err := NewMemory(config.QueueConfig{Capacity: 10, Overflow: OverflowBlock})
+	helpers.AssertNoError(t, err)
+	invalid := memoryEvent(2)
+	invalid.Sig = ""
+	helpers.AssertNoError(t, q.PublishEvent(memoryEvent(1)))
+	helpers.AssertNoError(t, q.PublishEvent(invalid))
+
+	count, _ := q.GetKindQueueStats(1)
+	helpers.AssertIntEqual(t, 1, count)
+	count, _ = q.GetKindQueueStats(topicModeration)
+	helpers.AssertIntEqual(t, 1, count)
+	stats, _ := q.GetAllKindQueueStats()
+	helpers.AssertIntEqual(t, 1, stats[1])
+
+	events, err := q.ConsumeEventsByKind(1)
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 1, len(events))
+	helpers.AssertStringEqual(t, "event 1", events[0].Content)
+
+	// The main queue is consumed separately from the kind topics
+	queued, _ := q.GetQueueStats()
+	helpers.AssertIntEqual(t, 2, queued)
+}
+
+func TestNewQueueBackend(t *testing.T) {
+	cfg := &config.Config{Queue: config.QueueConfig{Backend: BackendMemory, Capacity: 5, Overflow: OverflowDropNewest}}
+	q, err := New(cfg)
+	helpers.AssertNoError(t, err)
+	_, ok := q.(BatchConsumer)
+	helpers.AssertTrue(t, ok)
+	helpers.AssertNoError(t, q.Close())
+}
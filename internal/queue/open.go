@@ -0,0 +1,25 @@
+package queue
+
+import "mercury-relay/internal/config"
+
+// Queue backends selectable with queue.backend
+const (
+	BackendRabbitMQ = "rabbitmq"
+	BackendMemory   = "memory"
+)
+
+// New opens the configured queue backend
+func New(cfg *config.Config) (Queue, error) {
+	if cfg.Queue.Backend == BackendMemory {
+		memory, err := NewMemory(cfg.Queue)
+		if err != nil {
+			return nil, err
+		}
+		return memory, nil
+	}
+	rabbit, err := NewRabbitMQ(cfg.RabbitMQ)
+	if err != nil {
+		return nil, err
+	}
+	return rabbit, nil
+}
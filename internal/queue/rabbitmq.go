@@ -3,7 +3,7 @@ package queue
 import (
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"strconv"
 	"strings"
@@ -242,6 +242,9 @@ func (r *RabbitMQ) PublishEvent(event *models.Event) error {
 			Body:        body,
 			Timestamp:   time.Now(),
 			MessageId:   event.ID,
+			// The trace IDs also travel in the body; here other consumers see them
+			CorrelationId: event.TraceID,
+			Headers:       traceHeaders(event),
 		},
 	); err != nil {
 		return fmt.Errorf("failed to publish to main exchange: %w", err)
@@ -260,29 +263,13 @@ func (r *RabbitMQ) PublishToKindTopic(event *models.Event) error {
 
 	// Determine routing key based on kind and quality control
 	var routingKey string
-
-	// First, check if the event is valid (basic validation)
-	if !r.isValidEvent(event) {
-		// Invalid events go to moderation topic
+	switch topic := kindTopic(event); topic {
+	case topicModeration:
 		routingKey = "kind.moderation"
-	} else {
-		// Check if this is a known kind from configuration
-		commonKinds := getCommonKinds()
-		isKnown := false
-		for _, knownKind := range commonKinds {
-			if event.Kind == knownKind {
-				isKnown = true
-				break
-			}
-		}
-
-		if isKnown {
-			// Known kinds go to their specific topic
-			routingKey = fmt.Sprintf("kind.%d", event.Kind)
-		} else {
-			// Unknown kinds go to undefined topic
-			routingKey = "kind.undefined"
-		}
+	case topicUndefined:
+		routingKey = "kind.undefined"
+	default:
+		routingKey = fmt.Sprintf("kind.%d", topic)
 	}
 
 	return r.channel.Publish(
@@ -295,12 +282,35 @@ func (r *RabbitMQ) PublishToKindTopic(event *models.Event) error {
 			Body:        body,
 			Timestamp:   time.Now(),
 			MessageId:   event.ID,
+			// The trace IDs also travel in the body; here other consumers see them
+			CorrelationId: event.TraceID,
+			Headers:       traceHeaders(event),
 		},
 	)
 }
 
+// Kind topics that don't stand for a single kind
+const (
+	topicUndefined  = -1 // kinds without a dedicated topic
+	topicModeration = -2 // events failing basic validation
+)
+
+// kindTopic picks the kind topic an event is routed to: invalid events go
+// to moderation, known kinds to their own topic and the rest to undefined
+func kindTopic(event *models.Event) int {
+	if !isValidEvent(event) {
+		return topicModeration
+	}
+	for _, knownKind := range getCommonKinds() {
+		if event.Kind == knownKind {
+			return event.Kind
+		}
+	}
+	return topicUndefined
+}
+
 // isValidEvent performs basic validation on an event
-func (r *RabbitMQ) isValidEvent(event *models.Event) bool {
+func isValidEvent(event *models.Event) bool {
 	// Basic validation checks
 	if event == nil {
 		return false
@@ -342,7 +352,7 @@ func (r *RabbitMQ) ConsumeEvents() ([]*models.Event, error) {
 
 	var event models.Event
 	if err := json.Unmarshal(msg.Body, &event); err != nil {
-		log.Printf("Failed to unmarshal event: %v", err)
+		slog.Warn("Failed to unmarshal event", "message_id", msg.MessageId, "error", err)
 		msg.Nack(false, false) // Reject and don't requeue
 		return []*models.Event{}, nil
 	}
@@ -353,6 +363,41 @@ func (r *RabbitMQ) ConsumeEvents() ([]*models.Event, error) {
 	return []*models.Event{&event}, nil
 }
 
+// ConsumeBatch gets up to max messages without acknowledging them. Messages
+// that don't decode are rejected right away.
+func (r *RabbitMQ) ConsumeBatch(max int) ([]Delivery, error) {
+	var deliveries []Delivery
+	for len(deliveries) < max {
+		msg, ok, err := r.channel.Get(r.config.QueueName, false) // false = no auto-ack
+		if err != nil {
+			if len(deliveries) > 0 {
+				// Hand out what we have; the error will show up again
+				return deliveries, nil
+			}
+			return nil, fmt.Errorf("failed to get message: %w", err)
+		}
+		if !ok {
+			break
+		}
+
+		var event models.Event
+		if err := json.Unmarshal(msg.Body, &event); err != nil {
+			slog.Warn("Failed to unmarshal event", "message_id", msg.MessageId, "error", err)
+			msg.Nack(false, false) // Reject and don't requeue
+			continue
+		}
+
+		tag := msg.DeliveryTag
+		deliveries = append(deliveries, Delivery{
+			Event:       &event,
+			Redelivered: msg.Redelivered,
+			Ack:         func() error { return r.channel.Ack(tag, false) },
+			Nack:        func(requeue bool) error { return r.channel.Nack(tag, false, requeue) },
+		})
+	}
+	return deliveries, nil
+}
+
 func (r *RabbitMQ) Close() error {
 	if r.channel != nil {
 		r.channel.Close()
@@ -404,7 +449,7 @@ func (r *RabbitMQ) ConsumeEventsByKind(kind int) ([]*models.Event, error) {
 
 	var event models.Event
 	if err := json.Unmarshal(msg.Body, &event); err != nil {
-		log.Printf("Failed to unmarshal event from kind queue: %v", err)
+		slog.Warn("Failed to unmarshal event from kind queue", "message_id", msg.MessageId, "error", err)
 		msg.Nack(false, false) // Reject and don't requeue
 		return []*models.Event{}, nil
 	}
@@ -481,3 +526,11 @@ func (r *RabbitMQ) GetAllKindQueueStats() (map[int]int, error) {
 
 	return stats, nil
 }
+
+// traceHeaders carries the event's W3C trace context as a message header
+func traceHeaders(event *models.Event) amqp091.Table {
+	if event.TraceParent == "" {
+		return nil
+	}
+	return amqp091.Table{"traceparent": event.TraceParent}
+}
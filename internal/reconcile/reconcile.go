@@ -0,0 +1,99 @@
+// Package reconcile synchronizes event sets with other relays using NIP-77
+// negentropy set reconciliation. Both sides exchange fingerprints of ranges
+// of (created_at, id) pairs until they know which IDs only one of them has,
+// so only the missing events are transferred instead of everything matching
+// a filter.
+package reconcile
+
+import (
+	"context"
+	"fmt"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip77/negentropy"
+	"github.com/nbd-wtf/go-nostr/nip77/negentropy/storage/vector"
+)
+
+// FrameSizeLimit bounds each negentropy message, in bytes before hex
+// encoding. Larger differences take more round trips.
+const FrameSizeLimit = 60000
+
+// Direction says which way missing events are copied
+type Direction string
+
+const (
+	// Pull copies events only the remote relay has to the local store
+	Pull Direction = "pull"
+	// Push copies events only the local store has to the remote relay
+	Push Direction = "push"
+	// Both pulls and pushes
+	Both Direction = "both"
+)
+
+// ParseDirection parses a direction name
+func ParseDirection(name string) (Direction, error) {
+	switch dir := Direction(name); dir {
+	case Pull, Push, Both:
+		return dir, nil
+	}
+	return "", fmt.Errorf("unknown sync direction %q, expected pull, push or both", name)
+}
+
+func (d Direction) pulls() bool  { return d == Pull || d == Both }
+func (d Direction) pushes() bool { return d == Push || d == Both }
+
+// Store is the local side of a sync
+type Store interface {
+	Query(ctx context.Context, filter nostr.Filter) ([]*models.Event, error)
+	Save(ctx context.Context, event *models.Event) error
+}
+
+// cacheStore syncs the event cache
+type cacheStore struct {
+	cache cache.Cache
+}
+
+// NewCacheStore returns a Store reading and writing c
+func NewCacheStore(c cache.Cache) Store {
+	return &cacheStore{cache: c}
+}
+
+func (s *cacheStore) Query(ctx context.Context, filter nostr.Filter) ([]*models.Event, error) {
+	return cache.Collect(s.cache.GetEvents(ctx, filter))
+}
+
+func (s *cacheStore) Save(ctx context.Context, event *models.Event) error {
+	return s.cache.StoreEvent(event)
+}
+
+// Session is the relay side of one NEG-OPEN: it answers the client's
+// messages from the set of events matching its filter
+type Session struct {
+	neg *negentropy.Negentropy
+}
+
+// NewSession prepares a session over events
+func NewSession(events []*models.Event) *Session {
+	return &Session{neg: negentropy.New(newVector(events), FrameSizeLimit)}
+}
+
+// Reconcile answers a NEG-MSG (or the message of the NEG-OPEN)
+func (s *Session) Reconcile(message string) (string, error) {
+	return s.neg.Reconcile(message)
+}
+
+// newVector returns the sealed (created_at, id) set of events. Events
+// without a valid ID can't take part and are left out.
+func newVector(events []*models.Event) *vector.Vector {
+	vec := vector.New()
+	for _, event := range events {
+		if nostr.IsValid32ByteHex(event.ID) {
+			vec.Insert(event.CreatedAt, event.ID)
+		}
+	}
+	vec.Seal()
+	return vec
+}
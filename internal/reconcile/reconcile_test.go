@@ -0,0 +1,222 @@
+package reconcile
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/gorilla/websocket"
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip77/negentropy"
+)
+
+// memoryStore is a Store, and the event set of the test relay
+type memoryStore struct {
+	events map[string]*models.Event
+	mu     sync.Mutex
+}
+
+func newMemoryStore(events ...*models.Event) *memoryStore {
+	s := &memoryStore{events: make(map[string]*models.Event)}
+	for _, event := range events {
+		s.events[event.ID] = event
+	}
+	return s
+}
+
+func (s *memoryStore) Query(ctx context.Context, filter nostr.Filter) ([]*models.Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var events []*models.Event
+	for _, event := range s.events {
+		if len(filter.IDs) > 0 && !slices.Contains(filter.IDs, event.ID) {
+			continue
+		}
+		if len(filter.Kinds) > 0 && !slices.Contains(filter.Kinds, event.Kind) {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (s *memoryStore) Save(ctx context.Context, event *models.Event) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events[event.ID] = event
+	return nil
+}
+
+func (s *memoryStore) has(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.events[id]
+	return ok
+}
+
+// testRelay serves NEG-OPEN, NEG-MSG, REQ by ID and EVENT from store
+func testRelay(t *testing.T, store *memoryStore) *httptest.Server {
+	upgrader := websocket.Upgrader{}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		conn, err := upgrader.Upgrade(w, req, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		var session *Session
+		for {
+			var msg []json.RawMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				return
+			}
+			var label, subID string
+			json.Unmarshal(msg[0], &label)
+			json.Unmarshal(msg[1], &subID)
+			switch label {
+			case "NEG-OPEN", "NEG-MSG":
+				var message string
+				json.Unmarshal(msg[len(msg)-1], &message)
+				if label == "NEG-OPEN" {
+					var filter nostr.Filter
+					json.Unmarshal(msg[2], &filter)
+					events, _ := store.Query(context.Background(), filter)
+					session = NewSession(events)
+				}
+				reply, err := session.Reconcile(message)
+				if err != nil {
+					conn.WriteJSON([]interface{}{"NEG-ERR", subID, err.Error()})
+					continue
+				}
+				conn.WriteJSON([]interface{}{"NEG-MSG", subID, reply})
+			case "REQ":
+				var filter nostr.Filter
+				json.Unmarshal(msg[2], &filter)
+				events, _ := store.Query(context.Background(), nostr.Filter{IDs: filter.IDs})
+				for _, event := range events {
+					conn.WriteJSON([]interface{}{"EVENT", subID, event.ToNostrEvent()})
+				}
+				conn.WriteJSON([]interface{}{"EOSE", subID})
+			case "EVENT":
+				var event nostr.Event
+				json.Unmarshal(msg[1], &event)
+				store.Save(context.Background(), models.FromNostrEvent(&event))
+				conn.WriteJSON([]interface{}{"OK", event.ID, true, ""})
+			}
+		}
+	}))
+}
+
+func signedEvents(t *testing.T, n int, prefix string) []*models.Event {
+	sk := nostr.GeneratePrivateKey()
+	events := make([]*models.Event, n)
+	for i := range events {
+		event := nostr.Event{
+			Kind:      1,
+			CreatedAt: nostr.Timestamp(1700000000 + i),
+			Tags:      nostr.Tags{},
+			Content:   fmt.Sprintf("%s %d", prefix, i),
+		}
+		helpers.AssertNoError(t, event.Sign(sk))
+		events[i] = models.FromNostrEvent(&event)
+	}
+	return events
+}
+
+func TestSession(t *testing.T) {
+	shared := signedEvents(t, 100, "shared")
+	onlyClient := signedEvents(t, 3, "client")
+	onlyServer := signedEvents(t, 5, "server")
+
+	server := NewSession(append(slices.Clone(shared), onlyServer...))
+	client := negentropy.New(newVector(append(slices.Clone(shared), onlyClient...)), FrameSizeLimit)
+
+	var haves, haveNots []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		haves, haveNots = collectIDs(context.Background(), client)
+	}()
+
+	message := client.Start()
+	for rounds := 0; message != ""; rounds++ {
+		helpers.AssertTrue(t, rounds < 20)
+		reply, err := server.Reconcile(message)
+		helpers.AssertNoError(t, err)
+		message, err = client.Reconcile(reply)
+		helpers.AssertNoError(t, err)
+	}
+	<-done
+
+	helpers.AssertIntEqual(t, len(onlyClient), len(haves))
+	helpers.AssertIntEqual(t, len(onlyServer), len(haveNots))
+	for _, event := range onlyServer {
+		helpers.AssertTrue(t, slices.Contains(haveNots, event.ID))
+	}
+}
+
+func TestSync(t *testing.T) {
+	shared := signedEvents(t, 50, "shared")
+	onlyLocal := signedEvents(t, 4, "local")
+	onlyRemote := signedEvents(t, 6, "remote")
+
+	t.Run("Both directions", func(t *testing.T) {
+		local := newMemoryStore(append(slices.Clone(shared), onlyLocal...)...)
+		remote := newMemoryStore(append(slices.Clone(shared), onlyRemote...)...)
+		ts := testRelay(t, remote)
+		defer ts.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		result, err := Sync(ctx, local, "ws"+strings.TrimPrefix(ts.URL, "http"), nostr.Filter{Kinds: []int{1}}, Both)
+		helpers.AssertNoError(t, err)
+
+		helpers.AssertIntEqual(t, len(shared)+len(onlyLocal), result.Local)
+		helpers.AssertIntEqual(t, len(onlyRemote), result.Missing)
+		helpers.AssertIntEqual(t, len(onlyLocal), result.Extra)
+		helpers.AssertIntEqual(t, len(onlyRemote), result.Pulled)
+		helpers.AssertIntEqual(t, len(onlyLocal), result.Pushed)
+		helpers.AssertIntEqual(t, 0, result.Failed)
+		for _, event := range onlyRemote {
+			helpers.AssertTrue(t, local.has(event.ID))
+		}
+		for _, event := range onlyLocal {
+			helpers.AssertTrue(t, remote.has(event.ID))
+		}
+	})
+
+	t.Run("Pull only", func(t *testing.T) {
+		local := newMemoryStore(append(slices.Clone(shared), onlyLocal...)...)
+		remote := newMemoryStore(append(slices.Clone(shared), onlyRemote...)...)
+		ts := testRelay(t, remote)
+		defer ts.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		result, err := Sync(ctx, local, "ws"+strings.TrimPrefix(ts.URL, "http"), nostr.Filter{}, Pull)
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, len(onlyRemote), result.Pulled)
+		helpers.AssertIntEqual(t, 0, result.Pushed)
+		for _, event := range onlyLocal {
+			helpers.AssertFalse(t, remote.has(event.ID))
+		}
+	})
+}
+
+func TestParseDirection(t *testing.T) {
+	dir, err := ParseDirection("pull")
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, dir == Pull)
+	_, err = ParseDirection("sideways")
+	helpers.AssertTrue(t, err != nil)
+}
@@ -0,0 +1,173 @@
+package reconcile
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip77"
+	"github.com/nbd-wtf/go-nostr/nip77/negentropy"
+)
+
+// syncID is the NEG-OPEN subscription ID of a sync; each sync uses its own
+// connection
+const syncID = "mercury-sync"
+
+// batchSize is how many events are fetched or published per request once
+// the missing IDs are known
+const batchSize = 100
+
+// Result reports what a sync found and copied
+type Result struct {
+	Local   int `json:"local"`   // local events matching the filter
+	Missing int `json:"missing"` // events only the remote relay has
+	Extra   int `json:"extra"`   // events only the local store has
+	Pulled  int `json:"pulled"`  // events copied from the remote relay
+	Pushed  int `json:"pushed"`  // events copied to the remote relay
+	Failed  int `json:"failed"`  // events that could not be copied
+}
+
+// Sync reconciles the events of store matching filter with those of the
+// relay at url, then copies missing events in direction dir. Pulled events
+// must carry a valid signature.
+func Sync(ctx context.Context, store Store, url string, filter nostr.Filter, dir Direction) (Result, error) {
+	var result Result
+
+	local, err := store.Query(ctx, filter)
+	if err != nil {
+		return result, fmt.Errorf("failed to query local events: %w", err)
+	}
+	result.Local = len(local)
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	neg := negentropy.New(newVector(local), FrameSizeLimit)
+	failed := make(chan error, 1)
+	fail := func(err error) {
+		select {
+		case failed <- err:
+		default:
+		}
+	}
+
+	var relay *nostr.Relay
+	relay, err = nostr.RelayConnect(ctx, url, nostr.WithCustomHandler(func(data string) {
+		switch env := nip77.ParseNegMessage(data).(type) {
+		case *nip77.ErrorEnvelope:
+			fail(fmt.Errorf("relay refused sync: %s", env.Reason))
+		case *nip77.MessageEnvelope:
+			if env.SubscriptionID != syncID {
+				return
+			}
+			next, err := neg.Reconcile(env.Message)
+			if err != nil {
+				fail(fmt.Errorf("failed to reconcile: %w", err))
+				return
+			}
+			if next != "" {
+				message, _ := nip77.MessageEnvelope{SubscriptionID: syncID, Message: next}.MarshalJSON()
+				relay.Write(message)
+			}
+		}
+	}))
+	if err != nil {
+		return result, fmt.Errorf("failed to connect to %s: %w", url, err)
+	}
+	defer relay.Close()
+
+	// Reconcile pushes IDs while it runs, so collect them alongside
+	var haves, haveNots []string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		haves, haveNots = collectIDs(ctx, neg)
+	}()
+
+	open, _ := nip77.OpenEnvelope{SubscriptionID: syncID, Filter: filter, Message: neg.Start()}.MarshalJSON()
+	if err := <-relay.Write(open); err != nil {
+		return result, fmt.Errorf("failed to write to %s: %w", url, err)
+	}
+
+	select {
+	case <-done:
+	case err := <-failed:
+		return result, err
+	}
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	closeMessage, _ := nip77.CloseEnvelope{SubscriptionID: syncID}.MarshalJSON()
+	relay.Write(closeMessage)
+
+	result.Extra = len(haves)
+	result.Missing = len(haveNots)
+
+	if dir.pulls() {
+		for batch := range slices.Chunk(haveNots, batchSize) {
+			events, err := relay.QuerySync(ctx, nostr.Filter{IDs: batch})
+			if err != nil {
+				return result, fmt.Errorf("failed to fetch missing events: %w", err)
+			}
+			for _, event := range events {
+				if ok, _ := event.CheckSignature(); !ok {
+					result.Failed++
+					continue
+				}
+				event := models.FromNostrEvent(event)
+				event.AddProvenance(models.ProvenanceUpstream, url, "")
+				if err := store.Save(ctx, event); err != nil {
+					result.Failed++
+					continue
+				}
+				result.Pulled++
+			}
+		}
+	}
+
+	if dir.pushes() {
+		for batch := range slices.Chunk(haves, batchSize) {
+			events, err := store.Query(ctx, nostr.Filter{IDs: batch})
+			if err != nil {
+				return result, fmt.Errorf("failed to load local events: %w", err)
+			}
+			for _, event := range events {
+				if err := relay.Publish(ctx, *event.ToNostrEvent()); err != nil {
+					result.Failed++
+					continue
+				}
+				result.Pushed++
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// collectIDs gathers the IDs only the local side has (haves) and only the
+// remote side has (haveNots) until the reconciliation finishes
+func collectIDs(ctx context.Context, neg *negentropy.Negentropy) (haves, haveNots []string) {
+	havesCh, haveNotsCh := neg.Haves, neg.HaveNots
+	for havesCh != nil || haveNotsCh != nil {
+		select {
+		case <-ctx.Done():
+			return haves, haveNots
+		case id, ok := <-havesCh:
+			if !ok {
+				havesCh = nil
+				continue
+			}
+			haves = append(haves, id)
+		case id, ok := <-haveNotsCh:
+			if !ok {
+				haveNotsCh = nil
+				continue
+			}
+			haveNots = append(haveNots, id)
+		}
+	}
+	return haves, haveNots
+}
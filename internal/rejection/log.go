@@ -0,0 +1,182 @@
+package rejection
+
+import (
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/config"
+)
+
+// Sources an event can be refused on
+const (
+	SourceWebSocket = "websocket"
+	SourceREST      = "rest"
+	SourceGRPC      = "grpc"
+)
+
+// ReasonOther is the reason for messages without a NIP-01 prefix
+const ReasonOther = "error"
+
+// reasons are the machine-readable NIP-01 OK message prefixes
+var reasons = map[string]bool{
+	"duplicate":     true,
+	"pow":           true,
+	"blocked":       true,
+	"rate-limited":  true,
+	"invalid":       true,
+	"restricted":    true,
+	"mute":          true,
+	"error":         true,
+	"auth-required": true,
+}
+
+// Reason returns the NIP-01 prefix of an OK message, or ReasonOther
+func Reason(message string) string {
+	prefix, _, ok := strings.Cut(message, ":")
+	if ok && reasons[prefix] {
+		return prefix
+	}
+	return ReasonOther
+}
+
+// Rejection is one refused event
+type Rejection struct {
+	At      time.Time `json:"at"`
+	Reason  string    `json:"reason"`
+	Message string    `json:"message"`
+	EventID string    `json:"event_id,omitempty"`
+	Kind    int       `json:"kind"`
+	PubKey  string    `json:"pubkey,omitempty"`
+	Source  string    `json:"source"`
+	Remote  string    `json:"remote,omitempty"`
+}
+
+// Query selects buffered rejections; zero fields match everything
+type Query struct {
+	Reason string
+	Kind   *int
+	PubKey string
+	Source string
+	Limit  int
+}
+
+func (q Query) matches(r Rejection) bool {
+	return (q.Reason == "" || q.Reason == r.Reason) &&
+		(q.Kind == nil || *q.Kind == r.Kind) &&
+		(q.PubKey == "" || q.PubKey == r.PubKey) &&
+		(q.Source == "" || q.Source == r.Source)
+}
+
+// Log counts refused events, writes a sample of them to the log and keeps
+// the most recent ones in a ring buffer
+type Log struct {
+	sampleRate float64
+	random     func() float64
+
+	mu       sync.Mutex
+	ring     []Rejection
+	next     int
+	full     bool
+	byReason map[string]int64
+	bySource map[string]int64
+	total    int64
+	logged   int64
+}
+
+// NewLog creates a rejection log from cfg
+func NewLog(cfg config.RejectionLogConfig) *Log {
+	size := cfg.BufferSize
+	if size <= 0 {
+		size = 1
+	}
+	return &Log{
+		sampleRate: cfg.SampleRate,
+		random:     rand.Float64,
+		ring:       make([]Rejection, size),
+		byReason:   make(map[string]int64),
+		bySource:   make(map[string]int64),
+	}
+}
+
+// Record notes a refused event. The reason is taken from the message's
+// NIP-01 prefix when not given.
+func (l *Log) Record(r Rejection) {
+	if l == nil {
+		return
+	}
+	if r.At.IsZero() {
+		r.At = time.Now()
+	}
+	if r.Reason == "" {
+		r.Reason = Reason(r.Message)
+	}
+
+	l.mu.Lock()
+	l.ring[l.next] = r
+	l.next = (l.next + 1) % len(l.ring)
+	if l.next == 0 {
+		l.full = true
+	}
+	l.byReason[r.Reason]++
+	l.bySource[r.Source]++
+	l.total++
+	sampled := l.sampleRate > 0 && (l.sampleRate >= 1 || l.random() < l.sampleRate)
+	if sampled {
+		l.logged++
+	}
+	l.mu.Unlock()
+
+	if sampled {
+		log.Printf("event rejected reason=%s kind=%d pubkey=%s id=%s source=%s remote=%s message=%q",
+			r.Reason, r.Kind, r.PubKey, r.EventID, r.Source, r.Remote, r.Message)
+	}
+}
+
+// Recent returns the buffered rejections matching q, newest first
+func (l *Log) Recent(q Query) []Rejection {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	n := l.next
+	if l.full {
+		n = len(l.ring)
+	}
+	matched := []Rejection{}
+	for i := 1; i <= n; i++ {
+		r := l.ring[(l.next-i+len(l.ring))%len(l.ring)]
+		if !q.matches(r) {
+			continue
+		}
+		matched = append(matched, r)
+		if q.Limit > 0 && len(matched) == q.Limit {
+			break
+		}
+	}
+	return matched
+}
+
+// Stats returns rejection counts by reason and source since startup
+func (l *Log) Stats() map[string]interface{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	byReason := make(map[string]int64, len(l.byReason))
+	for reason, n := range l.byReason {
+		byReason[reason] = n
+	}
+	bySource := make(map[string]int64, len(l.bySource))
+	for source, n := range l.bySource {
+		bySource[source] = n
+	}
+	return map[string]interface{}{
+		"total":       l.total,
+		"logged":      l.logged,
+		"sample_rate": l.sampleRate,
+		"buffer_size": len(l.ring),
+		"by_reason":   byReason,
+		"by_source":   bySource,
+	}
+}
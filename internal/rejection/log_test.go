@@ -0,0 +1,73 @@
+package rejection
+
+import (
+	"fmt"
+	"testing"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/test/helpers"
+)
+
+func TestReason(t *testing.T) {
+	helpers.AssertStringEqual(t, "restricted", Reason("restricted: write access denied"))
+	helpers.AssertStringEqual(t, "rate-limited", Reason("rate-limited: slow down"))
+	helpers.AssertStringEqual(t, ReasonOther, Reason("Quality control failed: too short"))
+	helpers.AssertStringEqual(t, ReasonOther, Reason(""))
+}
+
+func TestLog(t *testing.T) {
+	t.Run("Keeps the last rejections, newest first", func(t *testing.T) {
+		l := NewLog(config.RejectionLogConfig{SampleRate: -1, BufferSize: 3})
+		for i := 0; i < 5; i++ {
+			l.Record(Rejection{EventID: fmt.Sprint(i), Kind: i % 2, Message: "invalid: bad", Source: SourceWebSocket})
+		}
+
+		recent := l.Recent(Query{})
+		helpers.AssertIntEqual(t, 3, len(recent))
+		helpers.AssertStringEqual(t, "4", recent[0].EventID)
+		helpers.AssertStringEqual(t, "2", recent[2].EventID)
+		helpers.AssertStringEqual(t, "invalid", recent[0].Reason)
+
+		stats := l.Stats()
+		helpers.AssertTrue(t, stats["total"].(int64) == 5)
+		helpers.AssertTrue(t, stats["logged"].(int64) == 0)
+		helpers.AssertTrue(t, stats["by_reason"].(map[string]int64)["invalid"] == 5)
+	})
+
+	t.Run("Filters buffered rejections", func(t *testing.T) {
+		l := NewLog(config.RejectionLogConfig{SampleRate: -1, BufferSize: 10})
+		l.Record(Rejection{Kind: 1, PubKey: "alice", Message: "restricted: no", Source: SourceWebSocket})
+		l.Record(Rejection{Kind: 7, PubKey: "bob", Message: "invalid: no", Source: SourceREST})
+		l.Record(Rejection{Kind: 1, PubKey: "bob", Message: "rate-limited: no", Source: SourceGRPC})
+
+		kind := 1
+		helpers.AssertIntEqual(t, 2, len(l.Recent(Query{Kind: &kind})))
+		helpers.AssertIntEqual(t, 2, len(l.Recent(Query{PubKey: "bob"})))
+		helpers.AssertIntEqual(t, 1, len(l.Recent(Query{Reason: "invalid"})))
+		helpers.AssertIntEqual(t, 1, len(l.Recent(Query{Source: SourceGRPC})))
+		helpers.AssertIntEqual(t, 1, len(l.Recent(Query{Limit: 1})))
+		helpers.AssertIntEqual(t, 0, len(l.Recent(Query{PubKey: "carol"})))
+	})
+
+	t.Run("Samples log lines", func(t *testing.T) {
+		l := NewLog(config.RejectionLogConfig{SampleRate: 0.5, BufferSize: 10})
+		draws := []float64{0.1, 0.9, 0.4, 0.6}
+		l.random = func() float64 {
+			draw := draws[0]
+			draws = draws[1:]
+			return draw
+		}
+		for i := 0; i < 4; i++ {
+			l.Record(Rejection{Message: "blocked: spam"})
+		}
+		stats := l.Stats()
+		helpers.AssertTrue(t, stats["total"].(int64) == 4)
+		helpers.AssertTrue(t, stats["logged"].(int64) == 2)
+		helpers.AssertIntEqual(t, 4, len(l.Recent(Query{})))
+	})
+
+	t.Run("Nil log ignores records", func(t *testing.T) {
+		var l *Log
+		l.Record(Rejection{Message: "invalid: bad"})
+	})
+}
@@ -0,0 +1,14 @@
+package relay
+
+import (
+	"mercury-relay/internal/archive"
+)
+
+// SetArchiver copies finalized publications to external storage and serves
+// where they were archived over REST
+func (s *Server) SetArchiver(a *archive.Archiver) {
+	s.archiver = a
+	if s.restAPI != nil {
+		s.restAPI.SetArchiver(a)
+	}
+}
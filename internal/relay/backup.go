@@ -0,0 +1,11 @@
+package relay
+
+import (
+	"mercury-relay/internal/backup"
+)
+
+// SetBackup snapshots the event store on its schedule, on one instance of a
+// cluster
+func (s *Server) SetBackup(b *backup.Backup) {
+	s.backup = b
+}
@@ -0,0 +1,18 @@
+package relay
+
+import (
+	"mercury-relay/internal/blocklist"
+)
+
+// SetBlockLists applies moderation lists from trusted moderators. The owner
+// and mirrored authors are never blocked by a list.
+func (s *Server) SetBlockLists(manager *blocklist.Manager) {
+	s.blockLists = manager
+	manager.SetExempt(func(pubkey string) bool {
+		return (s.accessControl != nil && s.accessControl.IsOwner(pubkey)) ||
+			(s.mirror != nil && s.mirror.IsMirrored(pubkey))
+	})
+	if s.restAPI != nil {
+		s.restAPI.SetBlockLists(manager)
+	}
+}
@@ -0,0 +1,25 @@
+package relay
+
+import (
+	"context"
+
+	"mercury-relay/internal/cluster"
+)
+
+// SetCluster makes this instance a member of a cluster sharing storage.
+// Singleton jobs then run only on the instance holding their lease.
+func (s *Server) SetCluster(node *cluster.Node) {
+	s.cluster = node
+	if s.restAPI != nil {
+		s.restAPI.SetCluster(node)
+	}
+}
+
+// runSingleton starts a background job that must run on one instance only
+func (s *Server) runSingleton(ctx context.Context, job string, run func(context.Context)) {
+	if s.cluster == nil {
+		go run(ctx)
+		return
+	}
+	go s.cluster.RunSingleton(ctx, job, run)
+}
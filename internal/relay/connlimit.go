@@ -0,0 +1,202 @@
+package relay
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mercury-relay/internal/reputation"
+
+	"github.com/gorilla/websocket"
+)
+
+// Reasons for messages refused by the per-connection limits
+const (
+	reasonSubscriptions = "rate-limited: too many open subscriptions, close some first"
+	reasonFilters       = "invalid: too many filters in one REQ"
+	reasonEventRate     = "rate-limited: too many events, slow down"
+	reasonViolations    = "too many refused messages"
+	reasonSlowReader    = "not reading events fast enough"
+)
+
+// connLimiter holds the per-connection limits besides REQ flood protection:
+// open subscriptions, filters per REQ, an EVENT token bucket and the count
+// of refused messages that gets a connection dropped
+type connLimiter struct {
+	maxSubscriptions int     // <= 0 disables
+	maxFilters       int     // <= 0 disables
+	eventRate        float64 // EVENTs per second, <= 0 disables
+	eventBurst       float64
+	tokens           float64
+	last             time.Time
+	maxViolations    int64 // <= 0 disables
+	violations       int64
+
+	dropped atomic.Bool
+
+	mu sync.Mutex
+}
+
+func newConnLimiter(subscriptions, filters, eventsPerMinute, violations int) *connLimiter {
+	return &connLimiter{
+		maxSubscriptions: subscriptions,
+		maxFilters:       filters,
+		eventRate:        float64(eventsPerMinute) / 60,
+		eventBurst:       float64(eventsPerMinute),
+		tokens:           float64(eventsPerMinute),
+		last:             time.Now(),
+		maxViolations:    int64(violations),
+	}
+}
+
+// allowEvent takes cost tokens for an EVENT message, at most the burst
+func (l *connLimiter) allowEvent(now time.Time, cost float64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.eventRate <= 0 {
+		return true
+	}
+	l.tokens += now.Sub(l.last).Seconds() * l.eventRate
+	if l.tokens > l.eventBurst {
+		l.tokens = l.eventBurst
+	}
+	l.last = now
+	cost = min(cost, l.eventBurst)
+	if l.tokens < cost {
+		return false
+	}
+	l.tokens -= cost
+	return true
+}
+
+// violation counts a refused message and reports whether the connection
+// has now had too many
+func (l *connLimiter) violation() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.violations++
+	return l.maxViolations > 0 && l.violations >= l.maxViolations
+}
+
+func (l *connLimiter) snapshot() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.violations
+}
+
+// connCounters totals messages refused by the per-connection limits and
+// dropped connections, including closed ones
+type connCounters struct {
+	subscriptionLimited atomic.Int64
+	filterLimited       atomic.Int64
+	eventRateLimited    atomic.Int64
+	dropped             atomic.Int64
+	slowDropped         atomic.Int64
+}
+
+// newConnLimits returns the limits for a new connection; connections the
+// IP reputation check rate limits get a fraction of the EVENT rate
+func (s *Server) newConnLimits(verdict reputation.Verdict) *connLimiter {
+	limits := s.limits()
+	events := limits.MaxEventsPerMinute
+	if verdict.Action == reputation.ActionRateLimit && events > 0 {
+		events = max(events/s.reputation.RateLimitDivisor(), 1)
+	}
+	return newConnLimiter(limits.MaxSubscriptions, limits.MaxFilters, events, limits.MaxViolations)
+}
+
+// eventCost is what an EVENT by pubkey takes from the connection's event
+// rate: writers further out in the trust graph may get a fraction of it
+func (s *Server) eventCost(pubkey string) float64 {
+	if s.accessControl == nil {
+		return 1
+	}
+	return 1 / s.accessControl.RateMultiplier(pubkey)
+}
+
+// readLimit is the largest message a connection may send, 0 for no limit.
+// Large objects, when enabled, raise it to their maximum event size.
+func (s *Server) readLimit() int64 {
+	limit := s.limits().MaxMessageSize
+	if s.largeObjects != nil && (limit <= 0 || s.largeObjects.MaxEventSize() > limit) {
+		limit = s.largeObjects.MaxEventSize()
+	}
+	return int64(max(limit, 0))
+}
+
+// noticeWait is how long a dropped connection's writer gets to send the
+// NOTICE saying why before the connection is closed regardless
+const noticeWait = 2 * time.Second
+
+// closeFrame, queued behind a connection's other messages, has its writer
+// close the connection
+type closeFrame struct {
+	reason string
+}
+
+// refuse counts a refused message against conn and drops the connection
+// once it has had too many. The NOTICE saying why is written before the
+// close frame, unless the client stops reading.
+func (s *Server) refuse(conn *Connection) {
+	if !conn.limits.violation() || !conn.limits.dropped.CompareAndSwap(false, true) {
+		return
+	}
+	s.connCounters.dropped.Add(1)
+	conn.log.Warn("Dropping connection", "reason", reasonViolations)
+	s.sendError(conn, "closed", reasonViolations)
+	if err := conn.out.Send(closeFrame{reason: reasonViolations}); err != nil {
+		closeConnection(conn, reasonViolations)
+		return
+	}
+	time.AfterFunc(noticeWait, func() { closeConnection(conn, reasonViolations) })
+}
+
+// dropSlowReader drops a connection whose queue of live events is full
+func (s *Server) dropSlowReader(conn *Connection) {
+	if s.dropConnection(conn, reasonSlowReader) {
+		s.connCounters.slowDropped.Add(1)
+	}
+}
+
+// dropConnection closes conn at once, after which its read loop ends and
+// cleans up. It may be called from any goroutine; only the first call
+// closes and returns true.
+func (s *Server) dropConnection(conn *Connection, reason string) bool {
+	if !conn.limits.dropped.CompareAndSwap(false, true) {
+		return false
+	}
+	conn.log.Warn("Dropping connection", "reason", reason)
+	closeConnection(conn, reason)
+	return true
+}
+
+// closeConnection sends a policy violation close frame and closes conn.
+// gorilla/websocket lets any goroutine send close frames, and closing
+// twice is harmless.
+func closeConnection(conn *Connection, reason string) {
+	message := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, reason)
+	conn.conn.WriteControl(websocket.CloseMessage, message, time.Now().Add(time.Second))
+	conn.conn.Close()
+}
+
+// checkSubscriptionLimits refuses a REQ with more than the allowed filters,
+// or one opening a subscription beyond the connection's limit. Replacing
+// an open subscription is always allowed.
+func (s *Server) checkSubscriptionLimits(conn *Connection, subID string, filters int) (string, bool) {
+	if conn.limits.maxFilters > 0 && filters > conn.limits.maxFilters {
+		s.connCounters.filterLimited.Add(1)
+		return reasonFilters, false
+	}
+	if conn.limits.maxSubscriptions <= 0 {
+		return "", true
+	}
+	conn.subMutex.RLock()
+	_, replacing := conn.subs[subID]
+	open := len(conn.subs)
+	conn.subMutex.RUnlock()
+	if !replacing && open >= conn.limits.maxSubscriptions {
+		s.connCounters.subscriptionLimited.Add(1)
+		return reasonSubscriptions, false
+	}
+	return "", true
+}
@@ -0,0 +1,52 @@
+package relay
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"mercury-relay/test/helpers"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRefuseSendsNoticeBeforeClosing(t *testing.T) {
+	s := &Server{}
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		conn := testConnection()
+		conn.conn = ws
+		conn.limits = newConnLimiter(0, 0, 0, 2)
+		go s.writeEvents(conn)
+
+		// Messages queued before the NOTICE are written first
+		s.sendError(conn, "error", "first refusal")
+		s.refuse(conn)
+		s.refuse(conn)
+		s.refuse(conn) // already dropped
+	}))
+	defer server.Close()
+
+	client, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(server.URL, "http"), nil)
+	helpers.AssertNoError(t, err)
+	defer client.Close()
+	client.SetReadDeadline(time.Now().Add(noticeWait / 2))
+
+	var notices []string
+	for {
+		var msg []string
+		if err := client.ReadJSON(&msg); err != nil {
+			helpers.AssertTrue(t, websocket.IsCloseError(err, websocket.ClosePolicyViolation))
+			break
+		}
+		notices = append(notices, strings.Join(msg, " "))
+	}
+	helpers.AssertStringEqual(t, "NOTICE [error] first refusal|NOTICE [closed] too many refused messages", strings.Join(notices, "|"))
+	helpers.AssertInt64Equal(t, 1, s.connCounters.dropped.Load())
+}
@@ -0,0 +1,17 @@
+package relay
+
+import (
+	"mercury-relay/internal/seen"
+)
+
+// SetSeenIndex acknowledges copies of accepted events without processing
+// them again, on WebSocket, REST and upstream ingest alike
+func (s *Server) SetSeenIndex(index *seen.Index) {
+	s.seen = index
+	if s.upstreamMgr != nil {
+		s.upstreamMgr.SetSeenIndex(index)
+	}
+	if s.restAPI != nil {
+		s.restAPI.SetSeenIndex(index)
+	}
+}
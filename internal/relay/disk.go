@@ -0,0 +1,19 @@
+package relay
+
+import (
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/disk"
+)
+
+// SetDiskMonitor watches storage disk usage, alerting connected clients and
+// tightening cache retention under pressure
+func (s *Server) SetDiskMonitor(m *disk.Monitor) {
+	s.disk = m
+	m.SetNotifier(func(message string) { s.broadcastNotice(message) })
+	if retention, ok := s.cache.(cache.Retention); ok {
+		m.SetRetention(retention)
+	}
+	if s.restAPI != nil {
+		s.restAPI.SetDiskMonitor(m)
+	}
+}
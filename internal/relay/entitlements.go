@@ -0,0 +1,67 @@
+package relay
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/entitlement"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// purchaseLookupTimeout bounds finding the book a zap paid for
+const purchaseLookupTimeout = 10 * time.Second
+
+// SetEntitlements unlocks books for readers who zap their price, and serves
+// locked books to entitled readers over REST
+func (s *Server) SetEntitlements(m *entitlement.Manager) {
+	s.entitlements = m
+	if s.restAPI != nil {
+		s.restAPI.SetEntitlements(m)
+	}
+}
+
+// recordPurchase grants the sender of a stored zap receipt access to the
+// book it paid for
+func (s *Server) recordPurchase(receipt *models.Event) {
+	// Receipts from other providers, zaps of notes and malformed receipts
+	// are skipped
+	zap, err := s.entitlements.ParseZap(receipt)
+	if err != nil {
+		return
+	}
+
+	author, d, _ := entitlement.ParseBookAddress(zap.Book)
+	ctx, cancel := context.WithTimeout(context.Background(), purchaseLookupTimeout)
+	defer cancel()
+	events, err := cache.Collect(s.cache.GetEvents(ctx, nostr.Filter{
+		Kinds:   []int{30040},
+		Authors: []string{author},
+		Tags:    nostr.TagMap{"d": []string{d}},
+	}))
+	if err != nil {
+		log.Printf("Failed to look up %s for zap %s: %v", zap.Book, receipt.ID, err)
+		return
+	}
+
+	var book *models.Event
+	for _, event := range events {
+		if event.PubKey == author && event.Tags.GetD() == d && (book == nil || event.CreatedAt > book.CreatedAt) {
+			book = event
+		}
+	}
+	if book == nil {
+		log.Printf("Zap %s paid for unknown book %s", receipt.ID, zap.Book)
+		return
+	}
+
+	g, err := s.entitlements.Purchase(zap, book)
+	if err != nil {
+		log.Printf("Zap %s did not unlock %s: %v", receipt.ID, zap.Book, err)
+		return
+	}
+	log.Printf("Unlocked %s for %s (zap %s, %d msats)", g.Book, g.Reader, receipt.ID, zap.Msats)
+}
@@ -0,0 +1,78 @@
+package relay
+
+import (
+	"fmt"
+	"log"
+
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/rejection"
+	"mercury-relay/internal/transport"
+)
+
+// SetEventStream accepts events published over the gRPC event stream and
+// sends it every stored event
+func (s *Server) SetEventStream(stream *transport.EventStreamServer) {
+	s.eventStream = stream
+	stream.SetSink(s)
+}
+
+// IngestEvent runs an event published over the gRPC event stream through
+// the same checks as a WebSocket EVENT and queues it for storage
+func (s *Server) IngestEvent(event *models.Event, remoteAddr string) (err error) {
+	defer func() {
+		if err != nil {
+			s.reject(event, rejection.SourceGRPC, remoteAddr, err.Error())
+		}
+	}()
+
+	if s.maintenance.Active() {
+		return fmt.Errorf("%s", s.maintenance.State().Message())
+	}
+
+	if s.largeObjects != nil {
+		if err := s.largeObjects.Check(event); err != nil {
+			return fmt.Errorf("invalid: %v", err)
+		}
+	}
+
+	if ok, err := event.ToNostrEvent().CheckSignature(); err != nil || !ok {
+		return fmt.Errorf("invalid: bad event id or signature")
+	}
+
+	if !s.accessControl.CanWriteKind(event.PubKey, event.Kind) {
+		if message, queued := s.requestWriteAccess(event); queued {
+			return fmt.Errorf("%s", message)
+		}
+		return fmt.Errorf("restricted: write access denied for kind %d", event.Kind)
+	}
+
+	s.markMirrored(event)
+
+	if err := validateEvent(event); err != nil {
+		return fmt.Errorf("invalid: %v", err)
+	}
+
+	event.QualityScore = event.CalculateQualityScore()
+	if !event.Mirrored && event.IsSpam(0.7) {
+		event.IsQuarantined = true
+		event.QuarantineReason = "Low quality score"
+	}
+
+	event.AddProvenance(models.ProvenanceGRPC, remoteAddr, "")
+
+	if s.normalizer != nil {
+		s.normalizer.Apply(event)
+	}
+	s.labelLanguage(event)
+
+	if err := s.rabbitMQ.PublishEvent(event); err != nil {
+		log.Printf("Failed to queue gRPC event %s: %v", event.ID, err)
+		return fmt.Errorf("error: failed to store event")
+	}
+
+	if s.qualityControl != nil {
+		s.qualityControl.ProcessReport(event)
+	}
+
+	return nil
+}
@@ -0,0 +1,31 @@
+package relay
+
+import (
+	"log"
+
+	"mercury-relay/internal/identity"
+)
+
+// SetIdentity gives the relay its own Nostr key, advertised in NIP-11 and
+// used to sign service NOTICEs and REST responses when enabled
+func (s *Server) SetIdentity(id *identity.Identity) {
+	s.identity = id
+	if s.restAPI != nil {
+		s.restAPI.SetIdentity(id)
+	}
+}
+
+// noticeMessage is the NOTICE frame for a service message. With signed
+// notices the relay's signed event follows the text; clients that only read
+// the text are unaffected.
+func (s *Server) noticeMessage(message string) []interface{} {
+	if s.identity == nil || !s.identity.SignsNotices() {
+		return []interface{}{"NOTICE", message}
+	}
+	event, err := s.identity.ServiceMessage(message)
+	if err != nil {
+		log.Printf("Failed to sign notice: %v", err)
+		return []interface{}{"NOTICE", message}
+	}
+	return []interface{}{"NOTICE", message, event}
+}
@@ -0,0 +1,31 @@
+package relay
+
+import (
+	"mercury-relay/internal/classify"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+)
+
+// SetLanguageDetection records the language of published events as internal
+// metadata
+func (s *Server) SetLanguageDetection(cfg config.LanguageConfig) {
+	s.detectLanguage = cfg.Detect
+	if s.restAPI != nil {
+		s.restAPI.SetLanguageDetection(cfg)
+	}
+}
+
+// labelLanguage records event's language when detection is enabled. A
+// language set by the client is never kept.
+func (s *Server) labelLanguage(event *models.Event) {
+	event.Language = ""
+	if s.detectLanguage {
+		event.Language = classify.EventLanguage(event)
+	}
+}
+
+// matchesLanguage reports whether event is in one of the subscription's
+// languages
+func (sub *Subscription) matchesLanguage(event *models.Event) bool {
+	return len(sub.Languages) == 0 || classify.MatchesLanguage(classify.EventLanguage(event), sub.Languages)
+}
@@ -0,0 +1,33 @@
+package relay
+
+import (
+	"context"
+	"log"
+
+	"mercury-relay/internal/largeobj"
+	"mercury-relay/internal/models"
+)
+
+// SetLargeObjects rejects events over the maximum event size and reassembles
+// offloaded events before delivering them. The queue and cache handed to
+// NewServer should be wrapped by the same router.
+func (s *Server) SetLargeObjects(router *largeobj.Router) {
+	s.largeObjects = router
+	if s.restAPI != nil {
+		s.restAPI.SetLargeObjects(router)
+	}
+}
+
+// reassemble returns the full event for a consumed stub, or nil when it
+// can't be loaded
+func (s *Server) reassemble(event *models.Event) *models.Event {
+	if s.largeObjects == nil || !event.Offloaded {
+		return event
+	}
+	full, err := s.largeObjects.Reassemble(context.Background(), event)
+	if err != nil {
+		log.Printf("Not delivering offloaded event: %v", err)
+		return nil
+	}
+	return full
+}
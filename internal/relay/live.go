@@ -0,0 +1,25 @@
+package relay
+
+import (
+	"encoding/json"
+
+	"mercury-relay/internal/live"
+	"mercury-relay/internal/wire"
+)
+
+// SetLive tracks NIP-53 live activities and their viewers and fans live
+// chat out ahead of other events
+func (s *Server) SetLive(tracker *live.Tracker) {
+	s.live = tracker
+	if s.restAPI != nil {
+		s.restAPI.SetLive(tracker)
+	}
+}
+
+// watchLive counts conn as a viewer of the live activities a subscription
+// filter names in "#a", or stops counting it for subID
+func (s *Server) watchLive(conn *Connection, subID string, filter json.RawMessage) {
+	if s.live != nil {
+		s.live.Watch(conn, subID, wire.FilterTag(filter, "a"))
+	}
+}
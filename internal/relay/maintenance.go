@@ -0,0 +1,32 @@
+package relay
+
+import (
+	"log"
+
+	"mercury-relay/internal/maintenance"
+)
+
+// SetMaintenance lets admins pause writes. While paused, EVENTs are
+// rejected with a "maintenance:" OK, REQs are served as usual and upstream
+// events are buffered until writes resume.
+func (s *Server) SetMaintenance(mode *maintenance.Mode) {
+	s.maintenance = mode
+	mode.OnChange(s.announceMaintenance)
+	if s.upstreamMgr != nil {
+		s.upstreamMgr.SetMaintenance(mode)
+	}
+	if s.restAPI != nil {
+		s.restAPI.SetMaintenance(mode)
+	}
+}
+
+// announceMaintenance tells every connected client that writes were paused
+// or resumed
+func (s *Server) announceMaintenance(state maintenance.State) {
+	message := "Writes are accepted again"
+	if state.Enabled {
+		message = state.Message()
+	}
+	sent := s.broadcastNotice(message)
+	log.Printf("Maintenance mode %v announced to %d connections", state.Enabled, sent)
+}
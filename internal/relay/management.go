@@ -0,0 +1,249 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"mercury-relay/internal/logging"
+	"mercury-relay/internal/mirror"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/nip86"
+	"mercury-relay/internal/quarantine"
+)
+
+// infoOverrides are the NIP-11 fields changed through NIP-86
+type infoOverrides struct {
+	name        string
+	description string
+	icon        string
+	mu          sync.RWMutex
+}
+
+// pubkeyReason and eventReason are the list entries NIP-86 returns
+type pubkeyReason struct {
+	Pubkey string `json:"pubkey"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type eventReason struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// SetManagement serves the NIP-86 management API at the relay URL to the
+// admins listed (npub or hex), normally access.admin_npubs
+func (s *Server) SetManagement(admins []string) error {
+	allowed := make(map[string]bool, len(admins))
+	for _, admin := range admins {
+		pubkey, err := mirror.ParsePubkey(admin)
+		if err != nil {
+			return fmt.Errorf("invalid admin %q: %w", admin, err)
+		}
+		allowed[pubkey] = true
+	}
+
+	h := nip86.NewHandler(func(pubkey string) bool { return allowed[pubkey] })
+	h.Handle("banpubkey", s.banPubkey)
+	h.Handle("unbanpubkey", s.unbanPubkey)
+	h.Handle("listbannedpubkeys", s.listBannedPubkeys)
+	h.Handle("allowpubkey", s.allowPubkey)
+	h.Handle("unallowpubkey", s.unallowPubkey)
+	h.Handle("listallowedpubkeys", s.listAllowedPubkeys)
+	h.Handle("listeventsneedingmoderation", s.listEventsNeedingModeration)
+	h.Handle("allowevent", s.allowEvent)
+	h.Handle("banevent", s.banEvent)
+	h.Handle("listbannedevents", s.listBannedEvents)
+	h.Handle("changerelayname", s.changeInfo(func(o *infoOverrides, v string) { o.name = v }))
+	h.Handle("changerelaydescription", s.changeInfo(func(o *infoOverrides, v string) { o.description = v }))
+	h.Handle("changerelayicon", s.changeInfo(func(o *infoOverrides, v string) { o.icon = v }))
+	s.management = h
+	return nil
+}
+
+// checkBanned refuses events from banned pubkeys and banned events
+func (s *Server) checkBanned(event *models.Event) (string, bool) {
+	if s.qualityControl == nil {
+		return "", true
+	}
+	if s.qualityControl.IsNpubBlocked(event.PubKey) {
+		return "blocked: pubkey is banned", false
+	}
+	if s.qualityControl.IsEventBanned(event.ID) {
+		return "blocked: event is banned", false
+	}
+	return "", true
+}
+
+func (s *Server) banPubkey(ctx context.Context, admin string, params nip86.Params) (any, error) {
+	if s.qualityControl == nil {
+		return nil, fmt.Errorf("quality control is not enabled")
+	}
+	pubkey, reason, err := pubkeyParams(params)
+	if err != nil {
+		return nil, err
+	}
+	return true, s.qualityControl.BlockNpubWithReason(pubkey, reason)
+}
+
+func (s *Server) unbanPubkey(ctx context.Context, admin string, params nip86.Params) (any, error) {
+	if s.qualityControl == nil {
+		return nil, fmt.Errorf("quality control is not enabled")
+	}
+	pubkey, _, err := pubkeyParams(params)
+	if err != nil {
+		return nil, err
+	}
+	return true, s.qualityControl.UnblockNpub(pubkey)
+}
+
+func (s *Server) listBannedPubkeys(ctx context.Context, admin string, params nip86.Params) (any, error) {
+	if s.qualityControl == nil {
+		return nil, fmt.Errorf("quality control is not enabled")
+	}
+	banned := []pubkeyReason{}
+	for _, pubkey := range s.qualityControl.GetBlockedNpubs() {
+		banned = append(banned, pubkeyReason{Pubkey: pubkey, Reason: s.qualityControl.BlockReason(pubkey)})
+	}
+	return banned, nil
+}
+
+func (s *Server) allowPubkey(ctx context.Context, admin string, params nip86.Params) (any, error) {
+	if s.accessControl == nil {
+		return nil, fmt.Errorf("access control is not enabled")
+	}
+	pubkey, _, err := pubkeyParams(params)
+	if err != nil {
+		return nil, err
+	}
+	return true, s.accessControl.ApproveWriter(pubkey, admin)
+}
+
+func (s *Server) unallowPubkey(ctx context.Context, admin string, params nip86.Params) (any, error) {
+	if s.accessControl == nil {
+		return nil, fmt.Errorf("access control is not enabled")
+	}
+	pubkey, _, err := pubkeyParams(params)
+	if err != nil {
+		return nil, err
+	}
+	return true, s.accessControl.DenyWriter(pubkey, admin)
+}
+
+func (s *Server) listAllowedPubkeys(ctx context.Context, admin string, params nip86.Params) (any, error) {
+	if s.accessControl == nil {
+		return nil, fmt.Errorf("access control is not enabled")
+	}
+	allowed := []pubkeyReason{}
+	for _, pubkey := range s.accessControl.GetAllowedNpubs() {
+		allowed = append(allowed, pubkeyReason{Pubkey: pubkey, Reason: "followed"})
+	}
+	for _, pubkey := range s.accessControl.ApprovedWriters() {
+		allowed = append(allowed, pubkeyReason{Pubkey: pubkey, Reason: "approved writer"})
+	}
+	return allowed, nil
+}
+
+func (s *Server) listEventsNeedingModeration(ctx context.Context, admin string, params nip86.Params) (any, error) {
+	if s.quarantine == nil {
+		return nil, fmt.Errorf("quarantine review is not enabled")
+	}
+	events := []eventReason{}
+	for _, entry := range s.quarantine.List("") {
+		events = append(events, eventReason{ID: entry.Event.ID, Reason: entry.Reason})
+	}
+	return events, nil
+}
+
+// allowEvent lifts a ban on the event and releases it from quarantine
+func (s *Server) allowEvent(ctx context.Context, admin string, params nip86.Params) (any, error) {
+	id, err := params.String(0, true)
+	if err != nil {
+		return nil, err
+	}
+	if s.qualityControl != nil {
+		if err := s.qualityControl.UnbanEvent(id); err != nil {
+			return nil, err
+		}
+	}
+	if s.quarantine != nil {
+		if _, err := s.quarantine.Release(id); err != nil && err != quarantine.ErrNotFound {
+			return nil, err
+		}
+	}
+	return true, nil
+}
+
+// banEvent refuses the event from now on and deletes every copy held
+func (s *Server) banEvent(ctx context.Context, admin string, params nip86.Params) (any, error) {
+	if s.qualityControl == nil {
+		return nil, fmt.Errorf("quality control is not enabled")
+	}
+	id, err := params.String(0, true)
+	if err != nil {
+		return nil, err
+	}
+	reason, err := params.String(1, false)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.qualityControl.BanEvent(id, reason); err != nil {
+		return nil, err
+	}
+
+	if s.quarantine != nil {
+		s.quarantine.Purge(id)
+	}
+	if err := s.cache.DeleteEvent(id); err != nil {
+		slog.Warn("Failed to delete banned event from cache", logging.KeyEventID, id, "error", err)
+	}
+	if s.storage != nil {
+		if err := s.storage.DeleteEvent(id); err != nil {
+			slog.Warn("Failed to delete banned event from storage", logging.KeyEventID, id, "error", err)
+		}
+	}
+	return true, nil
+}
+
+func (s *Server) listBannedEvents(ctx context.Context, admin string, params nip86.Params) (any, error) {
+	if s.qualityControl == nil {
+		return nil, fmt.Errorf("quality control is not enabled")
+	}
+	banned := []eventReason{}
+	for id, reason := range s.qualityControl.BannedEvents() {
+		banned = append(banned, eventReason{ID: id, Reason: reason})
+	}
+	return banned, nil
+}
+
+// changeInfo returns a method setting one NIP-11 field
+func (s *Server) changeInfo(set func(o *infoOverrides, value string)) nip86.Method {
+	return func(ctx context.Context, admin string, params nip86.Params) (any, error) {
+		value, err := params.String(0, true)
+		if err != nil {
+			return nil, err
+		}
+		s.info.mu.Lock()
+		set(&s.info, value)
+		s.info.mu.Unlock()
+		return true, nil
+	}
+}
+
+// pubkeyParams reads a pubkey (npub or hex) and an optional reason
+func pubkeyParams(params nip86.Params) (string, string, error) {
+	value, err := params.String(0, true)
+	if err != nil {
+		return "", "", err
+	}
+	pubkey, err := mirror.ParsePubkey(value)
+	if err != nil {
+		return "", "", err
+	}
+	reason, err := params.String(1, false)
+	if err != nil {
+		return "", "", err
+	}
+	return pubkey, reason, nil
+}
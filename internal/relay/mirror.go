@@ -0,0 +1,42 @@
+package relay
+
+import (
+	"errors"
+
+	"mercury-relay/internal/mirror"
+	"mercury-relay/internal/models"
+)
+
+// SetMirror keeps every event of the mirrored authors for good and syncs
+// their history from the relays they publish to
+func (s *Server) SetMirror(m *mirror.Mirror) {
+	s.mirror = m
+	if s.upstreamMgr != nil {
+		s.upstreamMgr.SetMirror(m)
+	}
+	if s.restAPI != nil {
+		s.restAPI.SetMirror(m)
+	}
+}
+
+// markMirrored flags a published event of a mirrored author. Mirroring
+// skips quarantine, so only events with a valid signature are marked.
+func (s *Server) markMirrored(event *models.Event) {
+	if s.mirror == nil || !s.mirror.IsMirrored(event.PubKey) {
+		return
+	}
+	if ok, err := event.ToNostrEvent().CheckSignature(); err != nil || !ok {
+		return
+	}
+	s.mirror.Mark(event)
+}
+
+// validateEvent runs event.Validate, letting mirrored authors republish
+// their old events
+func validateEvent(event *models.Event) error {
+	err := event.Validate()
+	if event.Mirrored && errors.Is(err, models.ErrEventTooOld) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,96 @@
+package relay
+
+import (
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/logging"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// KindMuteList is the NIP-51 mute list kind
+const KindMuteList = 10000
+
+// muteList holds the public "p" entries of a reader's latest kind 10000 event
+type muteList struct {
+	pubkeys   map[string]bool
+	createdAt nostr.Timestamp
+}
+
+func newMuteList(event *models.Event) *muteList {
+	list := &muteList{
+		pubkeys:   make(map[string]bool),
+		createdAt: event.CreatedAt,
+	}
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "p" {
+			list.pubkeys[tag[1]] = true
+		}
+	}
+	return list
+}
+
+// isMuted reports whether the reader on this connection has muted pubkey
+func (c *Connection) isMuted(pubkey string) bool {
+	c.muteMutex.RLock()
+	defer c.muteMutex.RUnlock()
+
+	if c.mutes == nil {
+		return false
+	}
+	return c.mutes.pubkeys[pubkey]
+}
+
+// setMuteList replaces the connection's mute list unless event is older than
+// the one already applied
+func (c *Connection) setMuteList(event *models.Event) bool {
+	c.muteMutex.Lock()
+	defer c.muteMutex.Unlock()
+
+	if c.mutes != nil && event.CreatedAt < c.mutes.createdAt {
+		return false
+	}
+	c.mutes = newMuteList(event)
+	return true
+}
+
+// loadMuteList fetches the reader's latest mute list from the cache
+func (s *Server) loadMuteList(conn *Connection, pubkey string) {
+	if !s.config.EnforceMuteLists || s.cache == nil {
+		return
+	}
+
+	events, err := cache.Collect(s.cache.GetEvents(conn.ctx, nostr.Filter{
+		Kinds:   []int{KindMuteList},
+		Authors: []string{pubkey},
+	}))
+	if err != nil {
+		conn.log.Error("Failed to load mute list", "pubkey", pubkey, "error", err)
+		return
+	}
+
+	var latest *models.Event
+	for _, event := range events {
+		if event.Kind != KindMuteList || event.PubKey != pubkey {
+			continue
+		}
+		if latest == nil || event.CreatedAt > latest.CreatedAt {
+			latest = event
+		}
+	}
+
+	if latest != nil && conn.setMuteList(latest) {
+		conn.log.Debug("Applied mute list", logging.KeyEventID, latest.ID, "pubkey", pubkey)
+	}
+}
+
+// applyPushedMuteList updates the connection when the reader publishes a new
+// mute list of their own over it
+func (s *Server) applyPushedMuteList(conn *Connection, event *models.Event) {
+	if !s.config.EnforceMuteLists || event.Kind != KindMuteList || event.PubKey != conn.authPubkey() {
+		return
+	}
+	if conn.setMuteList(event) {
+		conn.log.Debug("Updated mute list from published event", logging.KeyEventID, event.ID, "pubkey", event.PubKey)
+	}
+}
@@ -0,0 +1,180 @@
+package relay
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/reconcile"
+	"mercury-relay/internal/wire"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Reasons for refused NEG-OPENs
+const (
+	reasonSyncSessions = "blocked: too many open sync sessions, close some first"
+	reasonSyncEvents   = "blocked: too many events match, narrow the filter"
+)
+
+// SetSync answers NIP-77 negentropy reconciliation (NEG-OPEN, NEG-MSG and
+// NEG-CLOSE) within the configured limits
+func (s *Server) SetSync(cfg config.SyncConfig) {
+	s.syncConfig = cfg
+}
+
+// handleNEGOPEN starts a reconciliation over the events matching the
+// filter, replacing one with the same subscription ID
+func (s *Server) handleNEGOPEN(conn *Connection, args []json.RawMessage) error {
+	if !s.syncConfig.Enabled {
+		return fmt.Errorf("negentropy sync is not enabled")
+	}
+	if len(args) < 3 {
+		return fmt.Errorf("NEG-OPEN requires subscription ID, filter and message")
+	}
+	subID, ok := wire.String(args[0])
+	if !ok {
+		return fmt.Errorf("invalid subscription ID")
+	}
+	filter, _, err := wire.ParseFilter(args[1])
+	if err != nil {
+		s.sendNegError(conn, subID, fmt.Sprintf("invalid: %v", err))
+		return nil
+	}
+	message, ok := wire.String(args[2])
+	if !ok {
+		s.sendNegError(conn, subID, "invalid: message must be a hex string")
+		return nil
+	}
+	if reason, ok := s.checkReadAccess(conn, filter); !ok {
+		s.sendNegError(conn, subID, reason)
+		return nil
+	}
+
+	conn.negMutex.Lock()
+	_, replacing := conn.negSessions[subID]
+	open := len(conn.negSessions)
+	conn.negMutex.Unlock()
+	if limit := s.syncConfig.MaxSessions; limit > 0 && !replacing && open >= limit {
+		s.sendNegError(conn, subID, reasonSyncSessions)
+		return nil
+	}
+
+	events, ok := s.syncEvents(conn, filter)
+	if !ok {
+		s.sendNegError(conn, subID, reasonSyncEvents)
+		return nil
+	}
+
+	session := reconcile.NewSession(events)
+	reply, err := session.Reconcile(message)
+	if err != nil {
+		s.sendNegError(conn, subID, fmt.Sprintf("invalid: %v", err))
+		return nil
+	}
+
+	conn.negMutex.Lock()
+	if conn.negSessions == nil {
+		conn.negSessions = make(map[string]*reconcile.Session)
+	}
+	conn.negSessions[subID] = session
+	conn.negMutex.Unlock()
+
+	s.sendNegMessage(conn, subID, reply)
+	return nil
+}
+
+// handleNEGMSG continues an open reconciliation
+func (s *Server) handleNEGMSG(conn *Connection, args []json.RawMessage) error {
+	if !s.syncConfig.Enabled {
+		return fmt.Errorf("negentropy sync is not enabled")
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("NEG-MSG requires subscription ID and message")
+	}
+	subID, ok := wire.String(args[0])
+	if !ok {
+		return fmt.Errorf("invalid subscription ID")
+	}
+	message, ok := wire.String(args[1])
+	if !ok {
+		s.sendNegError(conn, subID, "invalid: message must be a hex string")
+		return nil
+	}
+
+	conn.negMutex.Lock()
+	session, exists := conn.negSessions[subID]
+	conn.negMutex.Unlock()
+	if !exists {
+		s.sendNegError(conn, subID, "closed: no open sync session with this ID")
+		return nil
+	}
+
+	reply, err := session.Reconcile(message)
+	if err != nil {
+		s.closeNegSession(conn, subID)
+		s.sendNegError(conn, subID, fmt.Sprintf("invalid: %v", err))
+		return nil
+	}
+	s.sendNegMessage(conn, subID, reply)
+	return nil
+}
+
+// handleNEGCLOSE ends a reconciliation
+func (s *Server) handleNEGCLOSE(conn *Connection, args []json.RawMessage) error {
+	if len(args) < 1 {
+		return fmt.Errorf("NEG-CLOSE requires subscription ID")
+	}
+	subID, ok := wire.String(args[0])
+	if !ok {
+		return fmt.Errorf("invalid subscription ID")
+	}
+	s.closeNegSession(conn, subID)
+	return nil
+}
+
+func (s *Server) closeNegSession(conn *Connection, subID string) {
+	conn.negMutex.Lock()
+	delete(conn.negSessions, subID)
+	conn.negMutex.Unlock()
+}
+
+// syncEvents loads the stored events matching filter that the connection
+// may see, the same ones a REQ would replay. It reports false once more
+// than the configured maximum match.
+func (s *Server) syncEvents(conn *Connection, filter nostr.Filter) ([]*models.Event, bool) {
+	privacyFilter := NewPrivacyFilter(conn.authPubkey())
+	limit := s.syncConfig.MaxEvents
+
+	var events []*models.Event
+	for event, err := range s.cache.GetEvents(conn.ctx, filter) {
+		if err != nil {
+			if conn.ctx.Err() == nil {
+				log.Printf("Error getting events for sync: %v", err)
+			}
+			break
+		}
+		if !s.eventMatchesFilter(event, filter) || !privacyFilter.CanAccessEvent(event) {
+			continue
+		}
+		if limit > 0 && len(events) >= limit {
+			return nil, false
+		}
+		events = append(events, event)
+	}
+	return events, true
+}
+
+func (s *Server) sendNegMessage(conn *Connection, subID, message string) {
+	if err := s.send(conn, []interface{}{"NEG-MSG", subID, message}); err != nil {
+		log.Printf("Error sending NEG-MSG: %v", err)
+	}
+}
+
+func (s *Server) sendNegError(conn *Connection, subID, reason string) {
+	if err := s.send(conn, []interface{}{"NEG-ERR", subID, reason}); err != nil {
+		log.Printf("Error sending NEG-ERR: %v", err)
+	}
+}
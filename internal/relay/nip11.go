@@ -0,0 +1,111 @@
+package relay
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+
+	"mercury-relay/internal/maintenance"
+	"mercury-relay/internal/web"
+)
+
+// supportedNIPs are advertised in the relay information document
+var supportedNIPs = []int{1, 11, 42}
+
+// relayInfo is the NIP-11 relay information document
+type relayInfo struct {
+	Name          string             `json:"name"`
+	Description   string             `json:"description"`
+	Icon          string             `json:"icon,omitempty"`
+	Software      string             `json:"software"`
+	Version       string             `json:"version"`
+	Self          string             `json:"self,omitempty"` // The relay's own pubkey
+	SupportedNIPs []int              `json:"supported_nips"`
+	Limitation    relayLimitation    `json:"limitation"`
+	Maintenance   *maintenance.State `json:"maintenance,omitempty"`
+}
+
+type relayLimitation struct {
+	MaxMessageLength int  `json:"max_message_length,omitempty"`
+	MaxContentLength int  `json:"max_content_length,omitempty"`
+	AuthRequired     bool `json:"auth_required"`
+	RestrictedWrites bool `json:"restricted_writes"`
+}
+
+// relayInformation builds the NIP-11 document. While writes are paused it
+// reports restricted writes and the maintenance state.
+func (s *Server) relayInformation() relayInfo {
+	info := relayInfo{
+		Name:          "Mercury Relay",
+		Description:   "Nostr relay with quality control, e-book support and Tor, I2P and SSH transports",
+		Software:      "https://github.com/Silberengel/mercury-relay",
+		Version:       "1.0.0",
+		SupportedNIPs: supportedNIPs,
+	}
+	s.info.mu.RLock()
+	if s.info.name != "" {
+		info.Name = s.info.name
+	}
+	if s.info.description != "" {
+		info.Description = s.info.description
+	}
+	info.Icon = s.info.icon
+	s.info.mu.RUnlock()
+
+	if s.search != nil || s.management != nil || s.syncConfig.Enabled {
+		info.SupportedNIPs = slices.Clone(supportedNIPs)
+		if s.search != nil {
+			info.SupportedNIPs = append(info.SupportedNIPs, 50)
+		}
+		if s.syncConfig.Enabled {
+			info.SupportedNIPs = append(info.SupportedNIPs, 77)
+		}
+		if s.management != nil {
+			info.SupportedNIPs = append(info.SupportedNIPs, 86)
+		}
+	}
+	if s.identity != nil {
+		info.Self = s.identity.PublicKey()
+	}
+	if s.qualityControl != nil {
+		info.Limitation.MaxContentLength = s.qualityControl.MaxContentLength()
+	}
+	if s.largeObjects != nil {
+		info.Limitation.MaxMessageLength = s.largeObjects.MaxEventSize()
+	}
+	if s.accessControl != nil {
+		info.Limitation.RestrictedWrites = !s.accessControl.AllowsPublicWrite()
+		info.Limitation.AuthRequired = !s.accessControl.AllowsPublicRead()
+	}
+	if s.maintenance.Active() {
+		state := s.maintenance.State()
+		info.Maintenance = &state
+		info.Limitation.RestrictedWrites = true
+	}
+	return info
+}
+
+// handleRelayInfo serves the NIP-11 document
+func (s *Server) handleRelayInfo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/nostr+json")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if err := json.NewEncoder(w).Encode(s.relayInformation()); err != nil {
+		log.Printf("Error writing relay information: %v", err)
+	}
+}
+
+// handleRelayPage shows the NIP-11 document to browsers
+func (s *Server) handleRelayPage(w http.ResponseWriter, r *http.Request) {
+	scheme := "ws"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "wss"
+	}
+	web.Render(w, r, "relay", web.Page{
+		Title: "relay.title",
+		Data: struct {
+			Info relayInfo
+			URL  string
+		}{s.relayInformation(), scheme + "://" + r.Host + r.URL.Path},
+	})
+}
@@ -0,0 +1,146 @@
+package relay
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// authMaxAge bounds how far an AUTH event's created_at may be from now
+const authMaxAge = 10 * time.Minute
+
+// newAuthChallenge returns a random NIP-42 challenge for one connection
+func newAuthChallenge() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to read random challenge: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// authPubkey returns the pubkey the connection authenticated as, or ""
+func (c *Connection) authPubkey() string {
+	c.pubkeyMutex.RLock()
+	defer c.pubkeyMutex.RUnlock()
+	return c.pubkey
+}
+
+func (c *Connection) setAuthPubkey(pubkey string) {
+	c.pubkeyMutex.Lock()
+	c.pubkey = pubkey
+	c.pubkeyMutex.Unlock()
+}
+
+// sendAuthChallenge asks a new connection to authenticate with NIP-42
+func (s *Server) sendAuthChallenge(conn *Connection) {
+	if err := s.send(conn, []interface{}{"AUTH", conn.challenge}); err != nil {
+		log.Printf("Error sending AUTH challenge: %v", err)
+	}
+}
+
+// handleAUTH authenticates the connection as the signer of a kind 22242
+// event answering its challenge. Private events, read access and the
+// reader's mute list follow the authenticated pubkey from then on.
+func (s *Server) handleAUTH(conn *Connection, args []json.RawMessage) error {
+	if len(args) < 1 {
+		return fmt.Errorf("AUTH requires an event")
+	}
+
+	var event nostr.Event
+	if err := json.Unmarshal(args[0], &event); err != nil {
+		return fmt.Errorf("invalid AUTH event: %w", err)
+	}
+	if err := verifyAuth(&event, conn.challenge, conn.host, time.Now()); err != nil {
+		conn.log.Debug("AUTH refused", "pubkey", event.PubKey, "error", err)
+		s.sendOK(conn, event.ID, false, "auth-required: "+err.Error())
+		return nil
+	}
+
+	conn.setAuthPubkey(event.PubKey)
+	conn.log.Debug("Connection authenticated", "pubkey", event.PubKey)
+	s.sendOK(conn, event.ID, true, "")
+	go s.loadMuteList(conn, event.PubKey)
+	return nil
+}
+
+// verifyAuth checks a NIP-42 AUTH event against the connection's challenge
+// and the host the client connected to
+func verifyAuth(event *nostr.Event, challenge, host string, now time.Time) error {
+	if event.Kind != nostr.KindClientAuthentication {
+		return fmt.Errorf("expected kind %d, got %d", nostr.KindClientAuthentication, event.Kind)
+	}
+
+	created := event.CreatedAt.Time()
+	if created.Before(now.Add(-authMaxAge)) || created.After(now.Add(authMaxAge)) {
+		return fmt.Errorf("created_at is not recent")
+	}
+
+	if event.Tags.FindWithValue("challenge", challenge) == nil {
+		return fmt.Errorf("challenge doesn't match")
+	}
+
+	// Relays are reached under several names behind proxies; the host is
+	// what matters, not the scheme, port or path
+	relay := event.Tags.Find("relay")
+	if relay == nil {
+		return fmt.Errorf("missing relay tag")
+	}
+	if u, err := url.Parse(relay[1]); err != nil || !strings.EqualFold(u.Hostname(), hostname(host)) {
+		return fmt.Errorf("relay tag names another relay")
+	}
+
+	if !event.CheckID() {
+		return fmt.Errorf("bad event id")
+	}
+	if ok, err := event.CheckSignature(); err != nil || !ok {
+		return fmt.Errorf("bad signature")
+	}
+	return nil
+}
+
+// hostname strips the port from a request's Host
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// isPrivateKind reports whether events of kind are only served to their
+// author or recipients, see PrivacyFilter: NIP-04 direct messages and
+// NIP-59 gift wraps. Other kinds in the 1000s, such as files, comments, live
+// chat and reports, are public.
+func isPrivateKind(kind int) bool {
+	return kind == 4 || kind == 1059
+}
+
+// checkReadAccess decides whether conn may open a subscription for filter:
+// unauthenticated connections are asked to authenticate when the relay
+// restricts reads or the filter only asks for private events
+func (s *Server) checkReadAccess(conn *Connection, filter nostr.Filter) (string, bool) {
+	pubkey := conn.authPubkey()
+	if s.accessControl != nil && !s.accessControl.CanRead(pubkey) {
+		if pubkey == "" {
+			return "auth-required: this relay only serves authenticated readers", false
+		}
+		return "restricted: read access denied", false
+	}
+
+	if pubkey == "" && len(filter.Kinds) > 0 {
+		for _, kind := range filter.Kinds {
+			if !isPrivateKind(kind) {
+				return "", true
+			}
+		}
+		return "auth-required: private events are only served to authenticated readers", false
+	}
+	return "", true
+}
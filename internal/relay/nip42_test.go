@@ -0,0 +1,210 @@
+package relay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/access"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/fanout"
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// testConnection returns a connection to relay.example.com with challenge
+// "challenge", as handleWebSocket sets it up
+func testConnection() *Connection {
+	return &Connection{
+		subs:      make(map[string]*Subscription),
+		challenge: "challenge",
+		host:      "relay.example.com:7777",
+		ctx:       context.Background(),
+		out:       fanout.NewQueue(),
+		log:       slog.Default(),
+	}
+}
+
+// written drains n messages from conn's queue
+func written(t *testing.T, conn *Connection, n int) []fanout.Message {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	messages := make(chan fanout.Message, n)
+	go conn.out.Run(ctx, func(m fanout.Message) error {
+		messages <- m
+		return nil
+	})
+
+	var out []fanout.Message
+	for len(out) < n {
+		select {
+		case m := <-messages:
+			out = append(out, m)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %d of %d messages", len(out), n)
+		}
+	}
+	return out
+}
+
+// authEvent returns a kind 22242 event signed by sk, edited before signing
+func authEvent(t *testing.T, sk string, edit func(*nostr.Event)) *nostr.Event {
+	t.Helper()
+	event := &nostr.Event{
+		Kind:      nostr.KindClientAuthentication,
+		CreatedAt: nostr.Now(),
+		Tags: nostr.Tags{
+			{"relay", "wss://relay.example.com/"},
+			{"challenge", "challenge"},
+		},
+	}
+	if edit != nil {
+		edit(event)
+	}
+	helpers.AssertNoError(t, event.Sign(sk))
+	return event
+}
+
+func TestVerifyAuth(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		edit func(*nostr.Event)
+		// tamper changes the event after it was signed
+		tamper func(*nostr.Event)
+		err    string
+	}{
+		{name: "Valid"},
+		{name: "Relay named with another scheme and port", edit: func(e *nostr.Event) {
+			e.Tags[0] = nostr.Tag{"relay", "ws://RELAY.example.com:8080/path"}
+		}},
+		{name: "Wrong kind", edit: func(e *nostr.Event) { e.Kind = 1 }, err: "expected kind 22242, got 1"},
+		{name: "Stale created_at", edit: func(e *nostr.Event) {
+			e.CreatedAt = nostr.Timestamp(now.Add(-time.Hour).Unix())
+		}, err: "created_at is not recent"},
+		{name: "created_at in the future", edit: func(e *nostr.Event) {
+			e.CreatedAt = nostr.Timestamp(now.Add(time.Hour).Unix())
+		}, err: "created_at is not recent"},
+		{name: "Wrong challenge", edit: func(e *nostr.Event) {
+			e.Tags[1] = nostr.Tag{"challenge", "another"}
+		}, err: "challenge doesn't match"},
+		{name: "Missing relay tag", edit: func(e *nostr.Event) { e.Tags = e.Tags[1:] }, err: "missing relay tag"},
+		{name: "Wrong relay tag", edit: func(e *nostr.Event) {
+			e.Tags[0] = nostr.Tag{"relay", "wss://other.example.com"}
+		}, err: "relay tag names another relay"},
+		{name: "Bad event ID", tamper: func(e *nostr.Event) { e.Content = "changed" }, err: "bad event id"},
+		{name: "Bad signature", tamper: func(e *nostr.Event) {
+			e.Sig = authEvent(t, nostr.GeneratePrivateKey(), nil).Sig
+		}, err: "bad signature"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			event := authEvent(t, sk, test.edit)
+			if test.tamper != nil {
+				test.tamper(event)
+			}
+			err := verifyAuth(event, "challenge", "relay.example.com:7777", now)
+			if test.err == "" {
+				helpers.AssertNoError(t, err)
+				return
+			}
+			helpers.AssertError(t, err)
+			helpers.AssertStringEqual(t, test.err, err.Error())
+		})
+	}
+}
+
+func TestHandleAUTH(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	pubkey, _ := nostr.GetPublicKey(sk)
+	s := &Server{}
+
+	t.Run("Refused", func(t *testing.T) {
+		conn := testConnection()
+		event := authEvent(t, sk, func(e *nostr.Event) { e.Tags[1] = nostr.Tag{"challenge", "stale"} })
+		data, _ := json.Marshal(event)
+		helpers.AssertNoError(t, s.handleAUTH(conn, []json.RawMessage{data}))
+
+		frame := written(t, conn, 1)[0].Frame
+		helpers.AssertStringEqual(t, fmt.Sprint([]interface{}{"OK", event.ID, false, "auth-required: challenge doesn't match"}), fmt.Sprint(frame))
+		helpers.AssertStringEqual(t, "", conn.authPubkey())
+	})
+
+	t.Run("Accepted", func(t *testing.T) {
+		conn := testConnection()
+		event := authEvent(t, sk, nil)
+		data, _ := json.Marshal(event)
+		helpers.AssertNoError(t, s.handleAUTH(conn, []json.RawMessage{data}))
+
+		frame := written(t, conn, 1)[0].Frame
+		helpers.AssertStringEqual(t, fmt.Sprint([]interface{}{"OK", event.ID, true, ""}), fmt.Sprint(frame))
+		helpers.AssertStringEqual(t, pubkey, conn.authPubkey())
+	})
+
+	t.Run("Malformed", func(t *testing.T) {
+		conn := testConnection()
+		helpers.AssertError(t, s.handleAUTH(conn, nil))
+		helpers.AssertError(t, s.handleAUTH(conn, []json.RawMessage{json.RawMessage(`"challenge"`)}))
+		helpers.AssertStringEqual(t, "", conn.authPubkey())
+	})
+}
+
+func TestIsPrivateKind(t *testing.T) {
+	// Files (NIP-94), comments (NIP-22), live chat (NIP-53) and reports
+	// (NIP-56) are public
+	for kind, private := range map[int]bool{0: false, 1: false, 4: true, 1059: true, 1063: false, 1111: false, 1311: false, 1984: false, 2000: false, 30023: false} {
+		helpers.AssertBoolEqual(t, private, isPrivateKind(kind))
+
+		// Replays agree with the REQ check
+		event := &models.Event{PubKey: "author", Kind: kind}
+		helpers.AssertBoolEqual(t, !private, NewPrivacyFilter("").CanAccessEvent(event))
+		helpers.AssertTrue(t, NewPrivacyFilter("author").CanAccessEvent(event))
+	}
+}
+
+func TestCheckReadAccess(t *testing.T) {
+	reader := "reader_pubkey"
+
+	tests := []struct {
+		name       string
+		publicRead bool
+		pubkey     string
+		kinds      []int
+		reason     string
+	}{
+		{name: "Public read", publicRead: true, kinds: []int{1}},
+		{name: "Public read without kinds", publicRead: true},
+		{name: "Mixed kinds", publicRead: true, kinds: []int{1, 4}},
+		{name: "Private kinds unauthenticated", publicRead: true, kinds: []int{4, 1059},
+			reason: "auth-required: private events are only served to authenticated readers"},
+		{name: "Private kinds authenticated", publicRead: true, pubkey: "someone", kinds: []int{4}},
+		{name: "Public kinds in the 1000s unauthenticated", publicRead: true, kinds: []int{1063, 1111, 1311, 1984}},
+		{name: "Restricted read unauthenticated", kinds: []int{1},
+			reason: "auth-required: this relay only serves authenticated readers"},
+		{name: "Restricted read as another pubkey", pubkey: "someone", kinds: []int{1},
+			reason: "restricted: read access denied"},
+		{name: "Restricted read as an allowed reader", pubkey: reader, kinds: []int{4}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			s := &Server{accessControl: access.NewController(config.AccessConfig{
+				AdminNpubs:      []string{reader},
+				AllowPublicRead: test.publicRead,
+			})}
+			conn := testConnection()
+			conn.setAuthPubkey(test.pubkey)
+
+			reason, ok := s.checkReadAccess(conn, nostr.Filter{Kinds: test.kinds})
+			helpers.AssertBoolEqual(t, test.reason == "", ok)
+			helpers.AssertStringEqual(t, test.reason, reason)
+		})
+	}
+}
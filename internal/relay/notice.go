@@ -0,0 +1,65 @@
+package relay
+
+import (
+	"log"
+	"time"
+
+	"mercury-relay/internal/notice"
+)
+
+// sendWelcome tells a new connection when writes are paused and sends the
+// configured welcome NOTICE
+func (s *Server) sendWelcome(conn *Connection) {
+	if s.maintenance.Active() {
+		if err := s.sendNotice(conn, s.maintenance.State().Message()); err != nil {
+			log.Printf("Error sending maintenance notice: %v", err)
+		}
+	}
+
+	if s.notices == nil {
+		return
+	}
+
+	message, err := s.notices.Welcome(s.noticeVariables())
+	if err != nil {
+		log.Printf("Failed to render welcome notice: %v", err)
+		return
+	}
+	if message == "" {
+		return
+	}
+
+	if err := s.sendNotice(conn, message); err != nil {
+		log.Printf("Error sending welcome notice: %v", err)
+	}
+}
+
+// broadcastNotice sends message to every open connection
+func (s *Server) broadcastNotice(message string) int {
+	s.connMutex.RLock()
+	defer s.connMutex.RUnlock()
+
+	sent := 0
+	for _, conn := range s.connections {
+		if err := s.sendNotice(conn, message); err != nil {
+			log.Printf("Error broadcasting notice: %v", err)
+			continue
+		}
+		sent++
+	}
+	return sent
+}
+
+func (s *Server) noticeVariables() notice.Variables {
+	s.connMutex.RLock()
+	connections := len(s.connections)
+	s.connMutex.RUnlock()
+
+	return notice.Variables{
+		Host:        s.config.Host,
+		Port:        s.config.Port,
+		Connections: connections,
+		Uptime:      time.Since(s.startedAt).Round(time.Second),
+		Now:         time.Now(),
+	}
+}
@@ -0,0 +1,50 @@
+package relay
+
+import (
+	"fmt"
+
+	"mercury-relay/internal/fanout"
+)
+
+// errConnectionClosed ends a writer that closed its connection
+var errConnectionClosed = fmt.Errorf("connection closed")
+
+// replayBacklog is how many queued events a stored-event replay may run
+// ahead of the client
+const replayBacklog = 256
+
+// writeEvents writes the connection's queued events, EOSE, CLOSED and other
+// messages in order until it disconnects. It is the only writer of the
+// connection's socket apart from close frames, which gorilla/websocket lets
+// any goroutine send.
+func (s *Server) writeEvents(conn *Connection) {
+	conn.out.Run(conn.ctx, func(m fanout.Message) error {
+		switch m.Type {
+		case fanout.TypeFrame:
+			if frame, ok := m.Frame.(closeFrame); ok {
+				closeConnection(conn, frame.reason)
+				return errConnectionClosed
+			}
+			return conn.conn.WriteJSON(m.Frame)
+		case fanout.TypeEOSE:
+			return conn.conn.WriteJSON([]interface{}{"EOSE", m.SubID})
+		case fanout.TypeClosed:
+			return conn.conn.WriteJSON([]interface{}{"CLOSED", m.SubID, m.Reason})
+		}
+		return s.sendEvent(conn, m)
+	})
+}
+
+// eventExtensions returns the extra EVENT element for m: the trust label and,
+// with sequence numbers enabled, the subscription sequence number. Both go
+// to authenticated clients only.
+func (s *Server) eventExtensions(conn *Connection, m fanout.Message) map[string]interface{} {
+	extensions := make(map[string]interface{})
+	if label := s.trustLabelFor(conn, m.Event); label != "" {
+		extensions["trust_label"] = label
+	}
+	if s.config.SequenceNumbers && conn.authPubkey() != "" {
+		extensions["seq"] = m.Seq
+	}
+	return extensions
+}
@@ -0,0 +1,17 @@
+package relay
+
+import (
+	"mercury-relay/internal/outbox"
+)
+
+// SetOutbox republishes events by the relay owner and the outbox authors
+// to external relays
+func (s *Server) SetOutbox(o *outbox.Outbox) {
+	s.outbox = o
+	if s.accessControl != nil {
+		o.SetOwner(s.accessControl.IsOwner)
+	}
+	if s.restAPI != nil {
+		s.restAPI.SetOutbox(o)
+	}
+}
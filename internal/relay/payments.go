@@ -0,0 +1,52 @@
+package relay
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"mercury-relay/internal/entitlement"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/payments"
+)
+
+// SetPayments lets pubkeys without write access buy it with an invoice or
+// earn it with zaps, and serves the payment endpoints over REST
+func (s *Server) SetPayments(p *payments.Manager) {
+	s.payments = p
+	if s.accessControl != nil {
+		s.accessControl.SetPaidAccess(p)
+		p.OnChange(s.accessControl.PaidAccessChanged)
+	}
+	if s.restAPI != nil {
+		s.restAPI.SetPayments(p)
+	}
+}
+
+// paymentOffer tells a writer without access how to buy it
+func (s *Server) paymentOffer() (string, bool) {
+	if s.payments == nil {
+		return "", false
+	}
+	var ways []string
+	if price := s.payments.Price(); price > 0 {
+		ways = append(ways, fmt.Sprintf("pay %d sats at /api/v1/payments/invoice", price))
+	}
+	if threshold := s.payments.ZapThreshold(); threshold > 0 {
+		ways = append(ways, fmt.Sprintf("receive %d sats in zaps", threshold))
+	}
+	if len(ways) == 0 {
+		return "", false
+	}
+	return "restricted: write access is paid; " + strings.Join(ways, " or "), true
+}
+
+// recordZap counts a stored zap receipt towards its recipient's admission
+func (s *Server) recordZap(receipt *models.Event) {
+	_, err := s.payments.RecordZap(receipt)
+	// Receipts from other providers are none of our business
+	if err != nil && !errors.Is(err, entitlement.ErrUntrustedZap) {
+		log.Printf("Zap %s not counted towards write access: %v", receipt.ID, err)
+	}
+}
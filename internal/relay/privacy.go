@@ -38,11 +38,6 @@ func (pf *PrivacyFilter) CanAccessEvent(event *models.Event) bool {
 		return event.PubKey == pf.requesterPubkey
 	}
 
-	// Handle other encrypted events (kinds 1060, 1061, etc.) - only return to author
-	if event.Kind >= 1059 && event.Kind <= 1999 {
-		return event.PubKey == pf.requesterPubkey
-	}
-
 	// For all other events, allow access
 	return true
 }
@@ -66,28 +61,7 @@ func (pf *PrivacyFilter) canAccessDM(event *models.Event) bool {
 
 // IsReplaceableEvent checks if an event is replaceable
 func IsReplaceableEvent(kind int) bool {
-	// Replaceable events according to NIP-16
-	replaceableKinds := map[int]bool{
-		0:     true, // User metadata
-		3:     true, // Contacts
-		5:     true, // Event deletion
-		6:     true, // Repost
-		7:     true, // Reaction
-		8:     true, // Badge award
-		40:    true, // Channel creation
-		41:    true, // Channel metadata
-		42:    true, // Channel message
-		43:    true, // Hide message
-		44:    true, // Mute user
-		10002: true, // Relay list
-		30000: true, // Follow sets
-		30001: true, // Follow sets
-		30008: true, // Profile badges
-		30009: true, // Badge definition
-		30078: true, // Application-specific data
-	}
-
-	return replaceableKinds[kind]
+	return models.IsReplaceableKind(kind)
 }
 
 // GetReplaceableEventKey generates the key for replaceable events (kind:pubkey:d-tag)
@@ -95,22 +69,7 @@ func GetReplaceableEventKey(event *models.Event) string {
 	if !IsReplaceableEvent(event.Kind) {
 		return ""
 	}
-
-	// Find d-tag
-	var dTag string
-	for _, tag := range event.Tags {
-		if len(tag) >= 2 && tag[0] == "d" {
-			dTag = tag[1]
-			break
-		}
-	}
-
-	// If no d-tag, use empty string
-	if dTag == "" {
-		dTag = ""
-	}
-
-	return fmt.Sprintf("%d:%s:%s", event.Kind, event.PubKey, dTag)
+	return fmt.Sprintf("%d:%s:%s", event.Kind, event.PubKey, event.DTag())
 }
 
 // IsEncryptedEvent checks if an event is encrypted
@@ -0,0 +1,24 @@
+package relay
+
+import (
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/probation"
+)
+
+// SetProbation holds back writes from pubkeys the relay first saw recently,
+// over WebSocket and REST
+func (s *Server) SetProbation(tracker *probation.Tracker) {
+	s.probation = tracker
+	if s.restAPI != nil {
+		s.restAPI.SetProbation(tracker)
+	}
+}
+
+// screenProbation applies the author's probation to event. Known writers
+// and mirrored authors are exempt.
+func (s *Server) screenProbation(event *models.Event) (string, bool) {
+	if s.probation == nil || event.Mirrored || s.accessControl.IsKnownWriter(event.PubKey) {
+		return "", true
+	}
+	return s.probation.Screen(event)
+}
@@ -0,0 +1,18 @@
+package relay
+
+import (
+	"mercury-relay/internal/profiling"
+)
+
+// SetProfiler samples the runtime for /api/v1/stats/runtime, including
+// contention on the connection maps, and serves pprof to admins when enabled
+func (s *Server) SetProfiler(p *profiling.Sampler) {
+	s.profiler = p
+	p.Track("relay.connMutex", &s.connMutex)
+	if s.upstreamMgr != nil {
+		s.upstreamMgr.SetProfiler(p)
+	}
+	if s.restAPI != nil {
+		s.restAPI.SetProfiler(p)
+	}
+}
@@ -0,0 +1,31 @@
+package relay
+
+import (
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/push"
+)
+
+// SetPush enables stored subscriptions that notify users of matching events
+// while they have no open connection
+func (s *Server) SetPush(manager *push.Manager) {
+	s.push = manager
+	manager.SetPresence(s.isOnline)
+	manager.SetAccessCheck(func(pubkey string, event *models.Event) bool {
+		return NewPrivacyFilter(pubkey).CanAccessEvent(event)
+	})
+	if s.restAPI != nil {
+		s.restAPI.SetPush(manager)
+	}
+}
+
+// isOnline reports whether pubkey is authenticated on any connection
+func (s *Server) isOnline(pubkey string) bool {
+	s.connMutex.RLock()
+	defer s.connMutex.RUnlock()
+	for _, connection := range s.connections {
+		if connection.authPubkey() == pubkey {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+package relay
+
+import (
+	"log/slog"
+
+	"mercury-relay/internal/logging"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/quarantine"
+)
+
+// SetQuarantine holds quarantined events for review instead of caching,
+// storing and broadcasting them. Released events continue onto the normal
+// path; purged ones are dropped.
+func (s *Server) SetQuarantine(q *quarantine.Queue) {
+	s.quarantine = q
+	q.OnRelease(s.releaseQuarantined)
+	q.OnPurge(s.purgeQuarantined)
+	if s.restAPI != nil {
+		s.restAPI.SetQuarantine(q)
+	}
+}
+
+// holdQuarantined takes a quarantined event into the review queue, keeping
+// it from every read path until it is released
+func (s *Server) holdQuarantined(event *models.Event) bool {
+	return s.quarantine != nil && s.quarantine.Hold(event)
+}
+
+// releaseQuarantined caches and delivers the event as if it had just
+// arrived, replacing any flagged copy cached before it was held
+func (s *Server) releaseQuarantined(event *models.Event) {
+	if s.qualityControl != nil {
+		if err := s.qualityControl.ClearQuarantine(event.ID); err != nil {
+			slog.Warn("Failed to clear quarantine", logging.KeyEventID, event.ID, "error", err)
+		}
+	}
+	// The cache ignores events it already holds, so replace the stored copy
+	if err := s.cache.DeleteEvent(event.ID); err != nil {
+		slog.Warn("Failed to replace released event in cache", logging.KeyEventID, event.ID, "error", err)
+	}
+	if err := s.cache.StoreEvent(event); err != nil {
+		slog.Error("Error storing released event in cache", logging.KeyEventID, event.ID, "error", err)
+	}
+	s.deliverStored(event)
+}
+
+func (s *Server) purgeQuarantined(event *models.Event) {
+	if err := s.cache.DeleteEvent(event.ID); err != nil {
+		slog.Warn("Failed to delete purged event from cache", logging.KeyEventID, event.ID, "error", err)
+	}
+}
@@ -0,0 +1,40 @@
+package relay
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/quarantine"
+	"mercury-relay/test/helpers"
+	"mercury-relay/test/mocks"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestQuarantinedEventsAreNotServed(t *testing.T) {
+	q, err := quarantine.NewQueue(config.QuarantineConfig{Enabled: true, Path: filepath.Join(t.TempDir(), "quarantine.json")})
+	helpers.AssertNoError(t, err)
+	cache := mocks.NewMockCache()
+	s := &Server{cache: cache}
+	s.SetQuarantine(q)
+
+	clean := &models.Event{ID: "clean", PubKey: "alice", Kind: 1, CreatedAt: 200}
+	spam := &models.Event{ID: "spam", PubKey: "mallory", Kind: 1, CreatedAt: 100, IsQuarantined: true, QuarantineReason: "Low quality score"}
+	s.ingestEvent(context.Background(), clean)
+	s.ingestEvent(context.Background(), spam)
+
+	// The held event waits for review outside the cache
+	helpers.AssertIntEqual(t, 1, len(q.List("")))
+	helpers.AssertFalse(t, cache.HasEvent("spam"))
+	helpers.AssertStringEqual(t, "clean EOSE", replay(t, s, nostr.Filter{}))
+	helpers.AssertStringEqual(t, "EOSE", replay(t, s, nostr.Filter{IDs: []string{"spam"}}))
+
+	// Once released it is served like any other event
+	_, err = q.Release("spam")
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, cache.HasEvent("spam"))
+	helpers.AssertStringEqual(t, "spam EOSE", replay(t, s, nostr.Filter{Authors: []string{"mallory"}}))
+}
@@ -0,0 +1,27 @@
+package relay
+
+import (
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/rejection"
+)
+
+// SetRejectionLog records refused events for the admin API and samples them
+// into the log
+func (s *Server) SetRejectionLog(l *rejection.Log) {
+	s.rejections = l
+	if s.restAPI != nil {
+		s.restAPI.SetRejectionLog(l)
+	}
+}
+
+// reject records that event was refused with message
+func (s *Server) reject(event *models.Event, source, remote, message string) {
+	s.rejections.Record(rejection.Rejection{
+		Message: message,
+		EventID: event.ID,
+		Kind:    event.Kind,
+		PubKey:  event.PubKey,
+		Source:  source,
+		Remote:  remote,
+	})
+}
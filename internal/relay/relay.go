@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"strings"
 	"sync"
@@ -12,14 +13,50 @@ import (
 
 	"mercury-relay/internal/access"
 	"mercury-relay/internal/api"
+	"mercury-relay/internal/archive"
+	"mercury-relay/internal/backup"
+	"mercury-relay/internal/blocklist"
 	"mercury-relay/internal/cache"
+	"mercury-relay/internal/cluster"
 	"mercury-relay/internal/config"
+	"mercury-relay/internal/disk"
+	"mercury-relay/internal/entitlement"
+	"mercury-relay/internal/fanout"
+	"mercury-relay/internal/forwarding"
+	"mercury-relay/internal/identity"
+	"mercury-relay/internal/ingest"
+	"mercury-relay/internal/largeobj"
+	"mercury-relay/internal/live"
+	"mercury-relay/internal/logging"
+	"mercury-relay/internal/maintenance"
+	"mercury-relay/internal/mirror"
 	"mercury-relay/internal/models"
+	"mercury-relay/internal/nip86"
+	"mercury-relay/internal/normalize"
+	"mercury-relay/internal/notice"
+	"mercury-relay/internal/origin"
+	"mercury-relay/internal/outbox"
+	"mercury-relay/internal/payments"
+	"mercury-relay/internal/probation"
+	"mercury-relay/internal/profiling"
+	"mercury-relay/internal/push"
 	"mercury-relay/internal/quality"
+	"mercury-relay/internal/quarantine"
 	"mercury-relay/internal/queue"
+	"mercury-relay/internal/reconcile"
+	"mercury-relay/internal/rejection"
+	"mercury-relay/internal/reputation"
+	"mercury-relay/internal/retention"
+	"mercury-relay/internal/search"
+	"mercury-relay/internal/seen"
 	"mercury-relay/internal/storage"
 	"mercury-relay/internal/streaming"
+	"mercury-relay/internal/tracing"
 	"mercury-relay/internal/transport"
+	"mercury-relay/internal/trending"
+	"mercury-relay/internal/trust"
+	"mercury-relay/internal/web"
+	"mercury-relay/internal/wire"
 
 	"github.com/gorilla/websocket"
 	"github.com/nbd-wtf/go-nostr"
@@ -35,6 +72,48 @@ type Server struct {
 	accessControl  *access.Controller
 	upstreamMgr    *streaming.UpstreamManager
 	restAPI        *api.RESTAPIServer
+	forwarder      *forwarding.Forwarder
+	notices        *notice.Manager
+	normalizer     *normalize.Normalizer
+	eventStream    *transport.EventStreamServer
+	mirror         *mirror.Mirror
+	trending       *trending.Tracker
+	live           *live.Tracker
+	maintenance    *maintenance.Mode
+	reputation     *reputation.Checker
+	batcher        *ingest.Batcher
+	detectLanguage bool
+	rejections     *rejection.Log
+	disk           *disk.Monitor
+	entitlements   *entitlement.Manager
+	payments       *payments.Manager
+	identity       *identity.Identity
+	trustLabels    *trust.Labeler
+	search         *search.Index
+	archiver       *archive.Archiver
+	profiler       *profiling.Sampler
+	probation      *probation.Tracker
+	push           *push.Manager
+	cluster        *cluster.Node
+	blockLists     *blocklist.Manager
+	largeObjects   *largeobj.Router
+	retention      *retention.Pruner
+	quarantine     *quarantine.Queue
+	outbox         *outbox.Outbox
+	seen           *seen.Index
+	backup         *backup.Backup
+	management     *nip86.Handler
+	info           infoOverrides
+	syncConfig     config.SyncConfig
+	warmupEvents   int
+	startedAt      time.Time
+	reqCounters    reqCounters
+	connCounters   connCounters
+
+	// Per-connection limits replaced on config reload; connections keep
+	// the limits they were opened with
+	limitsMutex sync.RWMutex
+	reloader    *configReloader
 
 	// WebSocket upgrader
 	upgrader websocket.Upgrader
@@ -44,24 +123,90 @@ type Server struct {
 
 	// Active connections
 	connections map[*websocket.Conn]*Connection
-	connMutex   sync.RWMutex
+	connMutex   profiling.RWMutex
+
+	// Serializes live fan-out so every connection gets events in ingest order
+	broadcastMutex sync.Mutex
 
 	// Event handlers
 	eventHandlers map[string]EventHandler
 }
 
 type Connection struct {
-	conn     *websocket.Conn
-	subs     map[string]*Subscription
-	subMutex sync.RWMutex
-	lastPing time.Time
-	pubkey   string // Authenticated user's public key
+	conn        *websocket.Conn
+	subs        map[string]*Subscription
+	subMutex    sync.RWMutex
+	lastPing    time.Time
+	remoteAddr  string
+	connectedAt time.Time
+
+	// Pubkey the client authenticated as with NIP-42, also read from other
+	// goroutines, see authPubkey
+	pubkey      string
+	pubkeyMutex sync.RWMutex
+
+	// NIP-42 challenge sent on connect, and the Host the client connected
+	// to, which AUTH events must name
+	challenge string
+	host      string
+
+	// Reader's mute list, only populated when EnforceMuteLists is set
+	mutes     *muteList
+	muteMutex sync.RWMutex
+
+	// REQ flood protection
+	reqLimit *reqLimiter
+
+	// Subscription, filter, EVENT rate and refused message limits
+	limits *connLimiter
+
+	// Done when the client disconnects, aborting its queries
+	ctx context.Context
+
+	// IP reputation verdict from the upgrade
+	reputation reputation.Verdict
+
+	// Events waiting to be written, in delivery order
+	out *fanout.Queue
+
+	// Open NIP-77 reconciliations by subscription ID
+	negSessions map[string]*reconcile.Session
+	negMutex    sync.Mutex
+
+	// id tags the connection's log lines and the events it submits
+	id  string
+	log *slog.Logger
 }
 
+// debugSubscriptionID is a reserved REQ subscription ID. Instead of opening a
+// subscription, the relay answers with a NOTICE describing the connection.
+const debugSubscriptionID = "mercury:debug"
+
 type Subscription struct {
 	ID     string
 	Filter nostr.Filter
 	Active bool
+
+	// Languages opts in to events in these ISO 639-1 languages only
+	Languages []string
+
+	// Aborts the stored-event query started for this subscription
+	cancel context.CancelFunc
+
+	// The subscription's events in the connection's queue
+	stream *fanout.Stream
+}
+
+// close deactivates the subscription, aborts its query and drops its
+// events not yet written
+func (sub *Subscription) close() {
+	sub.Active = false
+	if sub.cancel != nil {
+		sub.cancel()
+	}
+	if sub.stream != nil {
+		sub.stream.Close()
+	}
 }
 
 type EventHandler func(*models.Event) error
@@ -88,24 +233,114 @@ func NewServer(
 		upstreamMgr:    upstreamMgr,
 		restAPI:        restAPI,
 		upgrader: websocket.Upgrader{
-			CheckOrigin: func(r *http.Request) bool {
-				return true // Allow all origins for now
-			},
+			CheckOrigin: origin.NewChecker(cfg.AllowedOrigins, cfg.TrustForwardedHost).Check,
 		},
 		connections:   make(map[*websocket.Conn]*Connection),
 		eventHandlers: make(map[string]EventHandler),
+		startedAt:     time.Now(),
+	}
+
+	// Serve stored events the cache no longer holds over REST
+	if restAPI != nil && storage != nil {
+		restAPI.SetStorage(storage)
+	}
+
+	// Let admins toggle transports through the REST API
+	if restAPI != nil && transportMgr != nil {
+		restAPI.SetTransportManager(transportMgr)
+	}
+
+	// Expose live connections and REQ counters to the REST API
+	if restAPI != nil {
+		restAPI.SetConnectionSource(server)
+	}
+
+	// Report upstream relay health through the REST API
+	if restAPI != nil && upstreamMgr != nil {
+		restAPI.SetUpstreamManager(upstreamMgr)
+	}
+
+	// Let admins review pending writers through the REST API
+	if restAPI != nil && accessControl != nil {
+		restAPI.SetAccessController(accessControl)
+	}
+
+	// Weight reports by the reporter's distance from the owner
+	if qualityControl != nil && accessControl != nil {
+		qualityControl.SetTrustSource(accessControl)
+	}
+
+	// Stream from the relays the owner's follows publish to
+	if accessControl != nil && upstreamMgr != nil {
+		accessControl.OnFollowRelays(func(relays []config.UpstreamRelay) {
+			if err := upstreamMgr.SetFollowRelays(relays); err != nil {
+				log.Printf("Failed to update follow relays: %v", err)
+			}
+		})
 	}
 
 	// Initialize SSH tunnel if SSH transport is available
 	if transportMgr != nil {
 		if sshTransport := transportMgr.GetSSHTransport(); sshTransport != nil {
 			server.sshTunnel = transport.NewWebSocketSSHTunnel(sshTransport)
+			server.sshTunnel.SetOriginCheck(server.upgrader.CheckOrigin)
 		}
 	}
 
 	return server
 }
 
+// SetForwarder enables forwarding of stored events to external brokers
+func (s *Server) SetForwarder(forwarder *forwarding.Forwarder) {
+	s.forwarder = forwarder
+	if s.restAPI != nil {
+		s.restAPI.SetForwarder(forwarder)
+	}
+}
+
+// SetNormalizer canonicalizes tag values of published and upstream events
+// before they are indexed
+func (s *Server) SetNormalizer(normalizer *normalize.Normalizer) {
+	s.normalizer = normalizer
+	if s.upstreamMgr != nil {
+		s.upstreamMgr.SetNormalizer(normalizer)
+	}
+	if s.restAPI != nil {
+		s.restAPI.SetNormalizer(normalizer)
+	}
+}
+
+// SetTrending counts engagement of stored events and enables the trending
+// endpoint
+func (s *Server) SetTrending(tracker *trending.Tracker) {
+	s.trending = tracker
+	if s.restAPI != nil {
+		s.restAPI.SetTrending(tracker)
+	}
+}
+
+// SetWriteBatching stores queued events in batches of up to
+// cfg.WriteBatchSize, acknowledging them only once stored. It has no effect
+// when the queue can't defer acknowledgements or the size is 1.
+func (s *Server) SetWriteBatching(cfg config.CacheConfig) {
+	consumer, ok := s.rabbitMQ.(queue.BatchConsumer)
+	if !ok || cfg.WriteBatchSize <= 1 {
+		s.batcher = nil
+		return
+	}
+	s.batcher = ingest.NewBatcher(consumer, s.cache, cfg)
+	s.batcher.SetHold(s.holdQuarantined)
+}
+
+// SetNotices enables the welcome NOTICE and scheduled broadcast notices
+func (s *Server) SetNotices(notices *notice.Manager) {
+	s.notices = notices
+	notices.SetBroadcaster(s.broadcastNotice, s.noticeVariables)
+	if s.restAPI != nil {
+		s.restAPI.SetNoticeManager(notices)
+	}
+}
+
 func (s *Server) Start(ctx context.Context) error {
 	// Start transport manager
 	if err := s.transportMgr.Start(ctx); err != nil {
@@ -124,6 +359,14 @@ func (s *Server) Start(ctx context.Context) error {
 		}
 	}
 
+	// Connect forwarding targets
+	if s.forwarder != nil {
+		if err := s.forwarder.Start(ctx); err != nil {
+			return fmt.Errorf("failed to start event forwarding: %w", err)
+		}
+		defer s.forwarder.Close()
+	}
+
 	// Start REST API
 	if s.restAPI != nil {
 		go func() {
@@ -133,12 +376,116 @@ func (s *Server) Start(ctx context.Context) error {
 		}()
 	}
 
+	// Start the gRPC event stream
+	if s.eventStream != nil {
+		go func() {
+			if err := s.eventStream.Start(ctx); err != nil {
+				log.Printf("gRPC event stream error: %v", err)
+			}
+		}()
+	}
+
+	// Announce this instance to the others sharing storage
+	if s.cluster != nil {
+		go s.cluster.Run(ctx)
+	}
+
 	// Start event processing
 	go s.processEvents(ctx)
 
+	// Start scheduled notices
+	if s.notices != nil {
+		go s.notices.Run(ctx)
+	}
+
+	// Start syncing mirrored authors
+	if s.mirror != nil {
+		s.runSingleton(ctx, "mirror", s.mirror.Run)
+	}
+
+	// Prune old and expired events
+	if s.retention != nil {
+		s.runSingleton(ctx, "retention", s.retention.Run)
+	}
+
+	// Start watching disk usage
+	if s.disk != nil {
+		go s.disk.Run(ctx)
+	}
+
+	// Load the newest stored events into the cache, then index what the
+	// cache holds for search
+	go func() {
+		s.warmCache(ctx)
+		if s.search != nil {
+			s.loadSearchIndex(ctx)
+		}
+	}()
+
+	// Sample the runtime for /api/v1/stats/runtime
+	if s.profiler != nil {
+		go s.profiler.Run(ctx)
+	}
+
+	// Archive finalized publications
+	if s.archiver != nil {
+		s.runSingleton(ctx, "archive", s.archiver.Run)
+	}
+
+	// Snapshot the event store
+	if s.backup != nil {
+		s.runSingleton(ctx, "backup", s.backup.Run)
+	}
+
+	// Admit pubkeys whose invoices were paid
+	if s.payments != nil {
+		go s.payments.Run(ctx)
+	}
+
+	// Persist when pubkeys were first seen
+	if s.probation != nil {
+		go s.probation.Run(ctx)
+	}
+
+	// Persist held events and purge the ones left unreviewed
+	if s.quarantine != nil {
+		go s.quarantine.Run(ctx)
+	}
+
+	// Deliver push notifications
+	if s.push != nil {
+		go s.push.Run(ctx)
+	}
+
+	// Republish owned events to the outbox relays
+	if s.outbox != nil {
+		go s.outbox.Run(ctx)
+	}
+
+	// Keep imported moderation lists current; every instance applies them
+	if s.blockLists != nil {
+		go s.blockLists.Run(ctx)
+	}
+
+	// Check NIP-05 identifiers of upstream authors
+	if s.trustLabels != nil {
+		go s.trustLabels.Run(ctx)
+	}
+
+	// Expire engagement counters that left the trending window
+	if s.trending != nil {
+		go s.trending.Run(ctx)
+	}
+
+	// Apply safe config changes without dropping connections
+	if s.reloader != nil {
+		go s.reloader.watcher.Run(ctx, s.reloadConfig)
+	}
+
 	// Start HTTP server
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", s.handleWebSocket)
+	mux.Handle(web.AssetPrefix, web.Assets())
 
 	// Add WebSocket over SSH endpoint if SSH tunnel is available
 	if s.sshTunnel != nil {
@@ -188,44 +535,89 @@ func (s *Server) handleWebSocketOverSSH(w http.ResponseWriter, r *http.Request)
 }
 
 func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	log.Printf("=== WebSocket handler called ===")
-	log.Printf("Request from: %s", r.RemoteAddr)
-	log.Printf("Request method: %s", r.Method)
-	log.Printf("Request URL: %s", r.URL.String())
-
 	// Check if this is a WebSocket upgrade request by examining headers manually
 	upgrade := r.Header.Get("Upgrade")
 	connection := r.Header.Get("Connection")
 
-	log.Printf("Upgrade header: %s", upgrade)
-	log.Printf("Connection header: %s", connection)
-
 	// Check if this is a proper WebSocket upgrade request
 	if upgrade != "websocket" || !strings.Contains(strings.ToLower(connection), "upgrade") {
+		// NIP-86 relay management
+		if s.management != nil && nip86.IsRequest(r) {
+			s.management.ServeHTTP(w, r)
+			return
+		}
+
+		// NIP-11 relay information document
+		if strings.Contains(r.Header.Get("Accept"), "application/nostr+json") {
+			s.handleRelayInfo(w, r)
+			return
+		}
+
+		// Browsers get the relay information as a page
+		if strings.Contains(r.Header.Get("Accept"), "text/html") {
+			s.handleRelayPage(w, r)
+			return
+		}
+
 		// For regular HTTP requests, return a simple response
-		log.Printf("Regular HTTP request, returning info page")
 		w.Header().Set("Content-Type", "text/plain")
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("Mercury Relay - WebSocket endpoint\nUse ws:// or wss:// to connect"))
 		return
 	}
 
-	log.Printf("Attempting WebSocket upgrade...")
+	verdict := s.screenConnection(r)
+	if verdict.Action == reputation.ActionDeny {
+		http.Error(w, "Connections from this network are not accepted", http.StatusForbidden)
+		return
+	}
+
+	id := logging.NewID()
+	logger := slog.With(logging.KeyConnID, id, logging.KeyRemote, r.RemoteAddr)
+	challenge, err := newAuthChallenge()
+	if err != nil {
+		logger.Error("Failed to create AUTH challenge", "error", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 	conn, err := s.upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Printf("WebSocket upgrade failed: %v", err)
+		logger.Warn("WebSocket upgrade failed", "error", err)
 		return
 	}
-	log.Printf("WebSocket upgrade successful! Connection established.")
+	logger.Info("WebSocket connection opened")
 	defer conn.Close()
+	// Oversized messages end the connection with a close frame
+	if limit := s.readLimit(); limit > 0 {
+		conn.SetReadLimit(limit)
+	}
+
+	// Queries of this connection are cancelled once it is gone
+	ctx, cancel := context.WithCancel(logging.WithLogger(r.Context(), logger))
+	defer cancel()
 
 	// Create connection
 	wsConnection := &Connection{
-		conn:     conn,
-		subs:     make(map[string]*Subscription),
-		lastPing: time.Now(),
-		pubkey:   "", // Will be extracted from first EVENT message
+		conn:        conn,
+		subs:        make(map[string]*Subscription),
+		lastPing:    time.Now(),
+		remoteAddr:  r.RemoteAddr,
+		connectedAt: time.Now(),
+		challenge:   challenge,
+		host:        r.Host,
+		reqLimit:    s.newConnectionLimiter(verdict),
+		limits:      s.newConnLimits(verdict),
+		ctx:         ctx,
+		reputation:  verdict,
+		out:         fanout.NewQueue(),
+		id:          id,
+		log:         logger,
 	}
+	if pending := s.limits().MaxPendingEvents; pending > 0 {
+		wsConnection.out.SetLimit(pending)
+	}
+	defer wsConnection.out.Close()
+	go s.writeEvents(wsConnection)
 
 	// Register connection
 	s.connMutex.Lock()
@@ -237,281 +629,404 @@ func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
 		s.connMutex.Lock()
 		delete(s.connections, conn)
 		s.connMutex.Unlock()
+		if s.live != nil {
+			s.live.Leave(wsConnection)
+		}
 	}()
 
+	s.sendWelcome(wsConnection)
+	s.sendAuthChallenge(wsConnection)
+
 	// Handle messages
-	log.Printf("Starting message handling loop for connection from %s", r.RemoteAddr)
 	for {
 		_, message, err := conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("WebSocket error: %v", err)
+				logger.Warn("WebSocket error", "error", err)
 			}
-			log.Printf("WebSocket connection closed: %v", err)
 			break
 		}
 
-		log.Printf("Received message from %s: %s", r.RemoteAddr, string(message))
+		logger.Debug("WebSocket message received", "message", string(message))
 		if err := s.handleMessage(wsConnection, message); err != nil {
-			log.Printf("Error handling message: %v", err)
-			s.sendError(conn, "error", err.Error())
+			logger.Info("WebSocket message refused", "error", err)
+			s.sendError(wsConnection, "error", err.Error())
 		}
 	}
-	log.Printf("Message handling loop ended for connection from %s", r.RemoteAddr)
+	logger.Info("WebSocket connection closed", "duration", time.Since(wsConnection.connectedAt).Round(time.Second).String())
 }
 
 func (s *Server) handleMessage(conn *Connection, message []byte) error {
-	var msg []interface{}
-	if err := json.Unmarshal(message, &msg); err != nil {
-		return fmt.Errorf("invalid JSON: %w", err)
-	}
-
-	if len(msg) < 2 {
-		return fmt.Errorf("message too short")
-	}
-
-	msgType, ok := msg[0].(string)
-	if !ok {
-		return fmt.Errorf("invalid message type")
+	msg, err := wire.ParseMessage(message)
+	if err != nil {
+		return err
 	}
 
-	switch msgType {
+	switch msg.Type {
 	case "REQ":
-		return s.handleREQ(conn, msg[1:])
+		return s.handleREQ(conn, msg.Args)
 	case "EVENT":
-		return s.handleEVENT(conn, msg[1:])
+		return s.handleEVENT(conn, msg.Args)
 	case "CLOSE":
-		return s.handleCLOSE(conn, msg[1:])
+		return s.handleCLOSE(conn, msg.Args)
+	case "AUTH":
+		return s.handleAUTH(conn, msg.Args)
+	case "NEG-OPEN":
+		return s.handleNEGOPEN(conn, msg.Args)
+	case "NEG-MSG":
+		return s.handleNEGMSG(conn, msg.Args)
+	case "NEG-CLOSE":
+		return s.handleNEGCLOSE(conn, msg.Args)
 	default:
-		return fmt.Errorf("unknown message type: %s", msgType)
+		return fmt.Errorf("unknown message type: %s", msg.Type)
 	}
 }
 
-func (s *Server) handleREQ(conn *Connection, args []interface{}) error {
+func (s *Server) handleREQ(conn *Connection, args []json.RawMessage) error {
 	if len(args) < 2 {
 		return fmt.Errorf("REQ requires subscription ID and filter")
 	}
 
-	subID, ok := args[0].(string)
+	subID, ok := wire.String(args[0])
 	if !ok {
 		return fmt.Errorf("invalid subscription ID")
 	}
 
-	filterData, ok := args[1].(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("invalid filter")
+	// Diagnostic request: report connection state instead of subscribing
+	if subID == debugSubscriptionID {
+		s.sendDebugSummary(conn)
+		return nil
 	}
 
-	// Parse filter
-	filter := nostr.Filter{}
-	if authors, ok := filterData["authors"].([]interface{}); ok {
-		for _, author := range authors {
-			if authorStr, ok := author.(string); ok {
-				filter.Authors = append(filter.Authors, authorStr)
-			}
-		}
+	filter, languages, err := wire.ParseFilter(args[1])
+	if err != nil {
+		s.sendClosed(conn, subID, fmt.Sprintf("invalid: %v", err))
+		return nil
 	}
-	if kinds, ok := filterData["kinds"].([]interface{}); ok {
-		for _, kind := range kinds {
-			if kindInt, ok := kind.(float64); ok {
-				filter.Kinds = append(filter.Kinds, int(kindInt))
-			}
-		}
+
+	// Restricted and private reads need a NIP-42 authenticated pubkey
+	if reason, ok := s.checkReadAccess(conn, filter); !ok {
+		s.sendClosed(conn, subID, reason)
+		return nil
 	}
-	if since, ok := filterData["since"].(float64); ok {
-		timestamp := nostr.Timestamp(since)
-		filter.Since = &timestamp
+
+	// NIP-50 searches are answered from the full-text index
+	if filter.Search != "" {
+		if reason, ok := s.checkSearch(filter.Search); !ok {
+			s.sendClosed(conn, subID, reason)
+			return nil
+		}
 	}
-	if until, ok := filterData["until"].(float64); ok {
-		timestamp := nostr.Timestamp(until)
-		filter.Until = &timestamp
+
+	// Refuse oversized REQs and subscriptions over the connection's limit
+	if reason, ok := s.checkSubscriptionLimits(conn, subID, len(args)-1); !ok {
+		s.sendClosed(conn, subID, reason)
+		s.refuse(conn)
+		return nil
 	}
-	if limit, ok := filterData["limit"].(float64); ok {
-		filter.Limit = int(limit)
+
+	// Refuse REQ floods before they cost a cache scan
+	if reason, ok := conn.reqLimit.admit(time.Now()); !ok {
+		if reason == reasonREQRate {
+			s.reqCounters.rateLimited.Add(1)
+		} else {
+			s.reqCounters.replayLimited.Add(1)
+		}
+		s.sendClosed(conn, subID, reason)
+		s.refuse(conn)
+		return nil
 	}
+	s.reqCounters.accepted.Add(1)
 
 	// Create subscription
+	ctx, cancel := context.WithCancel(conn.ctx)
 	sub := &Subscription{
-		ID:     subID,
-		Filter: filter,
-		Active: true,
+		ID:        subID,
+		Filter:    filter,
+		Active:    true,
+		Languages: languages,
+		cancel:    cancel,
+		stream:    conn.out.Open(subID),
 	}
 
+	// A REQ reusing a subscription ID replaces it
 	conn.subMutex.Lock()
+	if old, exists := conn.subs[subID]; exists {
+		old.close()
+	}
 	conn.subs[subID] = sub
 	conn.subMutex.Unlock()
+	s.watchLive(conn, subID, args[1])
 
-	// Send matching events
-	go s.sendMatchingEvents(conn, sub)
+	// Send matching events, holding the replay slot until done, then EOSE
+	go func() {
+		defer conn.reqLimit.release()
+		defer cancel()
+		if err := s.sendMatchingEvents(ctx, conn, sub); err != nil {
+			s.terminate(conn, sub, "error: could not read stored events")
+			return
+		}
+		sub.stream.EOSE()
+	}()
 
 	return nil
 }
 
-func (s *Server) handleEVENT(conn *Connection, args []interface{}) error {
+func (s *Server) handleEVENT(conn *Connection, args []json.RawMessage) error {
 	if len(args) < 1 {
 		return fmt.Errorf("EVENT requires event data")
 	}
 
-	eventData, ok := args[0].(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("invalid event data")
+	event, err := wire.ParseEvent(args[0])
+	if err != nil {
+		return err
 	}
-
-	// Parse event
-	event := &models.Event{}
-	if id, ok := eventData["id"].(string); ok {
-		event.ID = id
+	ctx, span := tracing.Start(conn.ctx, tracing.KindServer, "websocket EVENT",
+		logging.KeyEventID, event.ID, "event.kind", event.Kind, logging.KeyConnID, conn.id)
+	defer span.End()
+
+	if !conn.limits.allowEvent(time.Now(), s.eventCost(event.PubKey)) {
+		s.connCounters.eventRateLimited.Add(1)
+		s.sendOK(conn, event.ID, false, reasonEventRate)
+		s.refuse(conn)
+		return nil
 	}
-	if pubkey, ok := eventData["pubkey"].(string); ok {
-		event.PubKey = pubkey
-		// Store the pubkey in the connection for future use
-		if conn.pubkey == "" {
-			conn.pubkey = pubkey
-			log.Printf("Authenticated user: %s", pubkey)
+
+	if s.largeObjects != nil {
+		if err := s.largeObjects.Check(event); err != nil {
+			message := fmt.Sprintf("invalid: %v", err)
+			s.reject(event, rejection.SourceWebSocket, conn.remoteAddr, message)
+			s.sendOK(conn, event.ID, false, message)
+			return nil
 		}
 	}
-	if createdAt, ok := eventData["created_at"].(float64); ok {
-		event.CreatedAt = nostr.Timestamp(createdAt)
-	}
-	if kind, ok := eventData["kind"].(float64); ok {
-		event.Kind = int(kind)
+
+	// Reads keep working while writes are paused
+	if s.maintenance.Active() {
+		s.reject(event, rejection.SourceWebSocket, conn.remoteAddr, s.maintenance.State().Message())
+		s.sendOK(conn, event.ID, false, s.maintenance.State().Message())
+		return nil
 	}
-	if content, ok := eventData["content"].(string); ok {
-		event.Content = content
+
+	// Check access control; a NIP-42 authenticated writer may also publish
+	// events signed by others
+	authed := conn.authPubkey()
+	canWrite := s.accessControl.CanWriteKind(event.PubKey, event.Kind) ||
+		(authed != "" && s.accessControl.CanWriteKind(authed, event.Kind))
+	if !canWrite {
+		conn.log.Debug("Write access denied", logging.KeyEventID, event.ID, "kind", event.Kind)
+		if message, queued := s.requestWriteAccess(event); queued {
+			s.reject(event, rejection.SourceWebSocket, conn.remoteAddr, message)
+			s.sendOK(conn, event.ID, false, message)
+			return nil
+		}
+		if message, ok := s.paymentOffer(); ok {
+			s.reject(event, rejection.SourceWebSocket, conn.remoteAddr, message)
+			s.sendOK(conn, event.ID, false, message)
+			return nil
+		}
+		if authed == "" {
+			message := "auth-required: authenticate as a writer to publish events of others"
+			s.reject(event, rejection.SourceWebSocket, conn.remoteAddr, message)
+			s.sendOK(conn, event.ID, false, message)
+			return nil
+		}
+		s.reject(event, rejection.SourceWebSocket, conn.remoteAddr, fmt.Sprintf("restricted: write access denied for kind %d", event.Kind))
+		s.sendError(conn, "restricted", fmt.Sprintf("Write access denied for kind %d", event.Kind))
+		return fmt.Errorf("write access denied for npub: %s", event.PubKey)
 	}
-	if sig, ok := eventData["sig"].(string); ok {
-		event.Sig = sig
+
+	if message, ok := s.checkBanned(event); !ok {
+		s.reject(event, rejection.SourceWebSocket, conn.remoteAddr, message)
+		s.sendOK(conn, event.ID, false, message)
+		return nil
 	}
 
-	// Check access control
-	log.Printf("Checking write access for npub: %s", event.PubKey)
-	canWrite := s.accessControl.CanWrite(event.PubKey)
-	log.Printf("Access control result: %v", canWrite)
+	if message, ok := s.checkReputationWrite(conn, event); !ok {
+		s.reject(event, rejection.SourceWebSocket, conn.remoteAddr, message)
+		s.sendOK(conn, event.ID, false, message)
+		return nil
+	}
 
-	if !canWrite {
-		log.Printf("Write access denied for npub: %s", event.PubKey)
-		s.sendError(conn.conn, "restricted", "Write access denied")
-		return fmt.Errorf("write access denied for npub: %s", event.PubKey)
+	// Copies of accepted events are acknowledged, not processed again
+	if s.seen != nil && s.seen.Seen(seen.SourceWebSocket, event.ID) {
+		s.sendOK(conn, event.ID, true, "duplicate: already have this event")
+		return nil
 	}
 
+	s.markMirrored(event)
+
 	// Validate event
-	if err := event.Validate(); err != nil {
+	if err := validateEvent(event); err != nil {
+		s.reject(event, rejection.SourceWebSocket, conn.remoteAddr, fmt.Sprintf("invalid: %v", err))
 		return fmt.Errorf("event validation failed: %w", err)
 	}
 
 	// Calculate quality score
 	event.QualityScore = event.CalculateQualityScore()
 
-	// Check for spam
-	if event.IsSpam(0.7) {
+	// Check for spam; mirrored authors are never quarantined
+	if !event.Mirrored && event.IsSpam(0.7) {
 		event.IsQuarantined = true
 		event.QuarantineReason = "Low quality score"
 	}
 
-	// Publish to queue
-	if err := s.rabbitMQ.PublishEvent(event); err != nil {
+	// New pubkeys are rate limited, need proof of work and may be quarantined
+	if message, ok := s.screenProbation(event); !ok {
+		s.reject(event, rejection.SourceWebSocket, conn.remoteAddr, message)
+		s.sendOK(conn, event.ID, false, message)
+		return nil
+	}
+
+	event.AddProvenance(models.ProvenanceWebSocket, conn.remoteAddr, "")
+	event.TraceID = conn.id
+
+	// Canonicalize tag values for indexing; the signed tags are kept
+	if s.normalizer != nil {
+		s.normalizer.Apply(event)
+	}
+	s.labelLanguage(event)
+
+	// Publish to queue; consumers continue the trace from the publish span
+	_, publish := tracing.Start(ctx, tracing.KindProducer, "queue publish")
+	event.TraceParent = publish.TraceParent()
+	err = s.rabbitMQ.PublishEvent(event)
+	publish.RecordError(err)
+	publish.End()
+	if err != nil {
+		span.RecordError(err)
+		s.reject(event, rejection.SourceWebSocket, conn.remoteAddr, fmt.Sprintf("error: failed to publish event: %v", err))
 		return fmt.Errorf("failed to publish event: %w", err)
 	}
 
+	// A reader publishing their own mute list takes effect immediately
+	s.applyPushedMuteList(conn, event)
+
+	// Reports feed the weighted auto-moderation thresholds
+	if s.qualityControl != nil {
+		s.qualityControl.ProcessReport(event)
+	}
+
+	if s.seen != nil {
+		s.seen.Add(event.ID)
+	}
+
 	// Send OK response
-	s.sendOK(conn.conn, event.ID, true, "")
+	conn.log.Debug("Event queued", logging.KeyEventID, event.ID, "kind", event.Kind)
+	s.sendOK(conn, event.ID, true, "")
+
+	// Tell newly approved writers once
+	if s.accessControl.TakeApprovalNotice(event.PubKey) {
+		s.sendNotice(conn, "Your write access request was approved")
+	}
 
 	return nil
 }
 
-func (s *Server) handleCLOSE(conn *Connection, args []interface{}) error {
+func (s *Server) handleCLOSE(conn *Connection, args []json.RawMessage) error {
 	if len(args) < 1 {
 		return fmt.Errorf("CLOSE requires subscription ID")
 	}
 
-	subID, ok := args[0].(string)
+	subID, ok := wire.String(args[0])
 	if !ok {
 		return fmt.Errorf("invalid subscription ID")
 	}
 
 	conn.subMutex.Lock()
 	if sub, exists := conn.subs[subID]; exists {
-		sub.Active = false
+		sub.close()
 		delete(conn.subs, subID)
 	}
 	conn.subMutex.Unlock()
+	if s.live != nil {
+		s.live.Unwatch(conn, subID)
+	}
 
 	return nil
 }
 
-func (s *Server) sendMatchingEvents(conn *Connection, sub *Subscription) {
-	// Get events from cache first
-	events, err := s.cache.GetEvents(sub.Filter)
-	if err != nil {
-		log.Printf("Error getting events from cache: %v", err)
-	}
+// sendMatchingEvents replays stored events for a new subscription. The
+// query stops once ctx is done: the client closed the subscription or
+// disconnected. Only a failed query is returned as an error.
+func (s *Server) sendMatchingEvents(ctx context.Context, conn *Connection, sub *Subscription) error {
+	ctx, span := tracing.Start(ctx, tracing.KindServer, "websocket REQ", "subscription", sub.ID, logging.KeyConnID, conn.id)
+	defer span.End()
 
 	// Create privacy filter for the connection
-	privacyFilter := NewPrivacyFilter(conn.pubkey)
+	privacyFilter := NewPrivacyFilter(conn.authPubkey())
 
-	// Send events
-	for _, event := range events {
+	// Send events as the cache, or the search index, yields them
+	sent := make(map[string]bool)
+	send := func(event *models.Event) bool {
 		if !sub.Active {
-			break
+			return false
+		}
+		if sent[event.ID] {
+			return true
+		}
+
+		// Skip authors the reader has muted
+		if conn.isMuted(event.PubKey) {
+			return true
 		}
 
 		// Check if event matches filter
-		if s.eventMatchesFilter(event, sub.Filter) {
+		if s.eventMatchesFilter(event, sub.Filter) && sub.matchesLanguage(event) {
 			// Apply privacy filtering
 			if privacyFilter.CanAccessEvent(event) {
-				s.sendEvent(conn.conn, sub.ID, event)
+				// Replays wait for the client instead of piling up
+				if err := sub.stream.PushWait(ctx, event, replayBacklog); err != nil {
+					return false
+				}
+				sent[event.ID] = true
 			}
 		}
+		return sub.Filter.Limit <= 0 || len(sent) < sub.Filter.Limit
 	}
-}
 
-func (s *Server) eventMatchesFilter(event *models.Event, filter nostr.Filter) bool {
-	// Check authors
-	if len(filter.Authors) > 0 {
-		found := false
-		for _, author := range filter.Authors {
-			if event.PubKey == author {
-				found = true
-				break
-			}
-		}
-		if !found {
-			return false
-		}
+	events := s.cache.GetEvents(ctx, sub.Filter)
+	if sub.Filter.Search != "" {
+		events = s.searchEvents(sub.Filter)
 	}
-
-	// Check kinds
-	if len(filter.Kinds) > 0 {
-		found := false
-		for _, kind := range filter.Kinds {
-			if event.Kind == kind {
-				found = true
-				break
+	for event, err := range events {
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
 			}
+			span.RecordError(err)
+			logging.FromContext(ctx).Error("Error getting events from cache", "subscription", sub.ID, "error", err)
+			return err
 		}
-		if !found {
-			return false
+		if !send(event) {
+			return nil
 		}
 	}
 
-	// Check since
-	if filter.Since != nil && *filter.Since > 0 {
-		if nostr.Timestamp(int64(event.CreatedAt)) < *filter.Since {
-			return false
+	// Fill the rest from storage, for events that aged out of the cache
+	if sub.Filter.Search == "" {
+		if err := s.sendStoredEvents(ctx, sub, sent, send); err != nil {
+			span.RecordError(err)
+			return err
 		}
 	}
+	return nil
+}
 
-	// Check until
-	if filter.Until != nil && *filter.Until > 0 {
-		if nostr.Timestamp(int64(event.CreatedAt)) > *filter.Until {
-			return false
-		}
+func (s *Server) eventMatchesFilter(event *models.Event, filter nostr.Filter) bool {
+	// Check NIP-50 search words
+	if filter.Search != "" && (s.search == nil || !s.search.Matches(event, filter.Search)) {
+		return false
 	}
-
-	return true
+	return event.MatchesFilter(filter)
 }
 
 func (s *Server) processEvents(ctx context.Context) {
+	if s.batcher != nil {
+		s.batcher.Run(ctx, s.deliverStored)
+		return
+	}
+
 	for {
 		select {
 		case <-ctx.Done():
@@ -520,26 +1035,13 @@ func (s *Server) processEvents(ctx context.Context) {
 			// Process events from queue
 			events, err := s.rabbitMQ.ConsumeEvents()
 			if err != nil {
-				log.Printf("Error consuming events: %v", err)
+				slog.Error("Error consuming events", "error", err)
 				time.Sleep(time.Second)
 				continue
 			}
 
 			for _, event := range events {
-				// Store in cache
-				if err := s.cache.StoreEvent(event); err != nil {
-					log.Printf("Error storing event in cache: %v", err)
-				}
-
-				// Store in XFTP if enabled
-				if s.storage != nil {
-					if err := s.storage.StoreEvent(event); err != nil {
-						log.Printf("Error storing event in XFTP: %v", err)
-					}
-				}
-
-				// Broadcast to subscribers
-				s.broadcastEvent(event)
+				s.ingestEvent(ctx, event)
 			}
 
 			// Add delay to prevent tight loop and reduce consumer count
@@ -548,34 +1050,174 @@ func (s *Server) processEvents(ctx context.Context) {
 	}
 }
 
+// ingestEvent stores a queued event in the cache and delivers it
+func (s *Server) ingestEvent(ctx context.Context, event *models.Event) {
+	// Quarantined events wait for review outside the cache
+	if s.holdQuarantined(event) {
+		return
+	}
+
+	_, span := tracing.Continue(ctx, event.TraceParent, tracing.KindConsumer, "cache store", logging.KeyEventID, event.ID)
+	if err := s.cache.StoreEvent(event); err != nil {
+		span.RecordError(err)
+		slog.Error("Error storing event in cache", logging.KeyEventID, event.ID, logging.KeyTraceID, event.TraceID, "error", err)
+	}
+	span.End()
+	s.deliverStored(event)
+}
+
+// deliverStored hands an event that reached the cache to XFTP, subscribers
+// and the other consumers
+func (s *Server) deliverStored(event *models.Event) {
+	ctx, span := tracing.Continue(context.Background(), event.TraceParent, tracing.KindConsumer, "deliver",
+		logging.KeyEventID, event.ID, "event.kind", event.Kind)
+	defer span.End()
+
+	// Late arrivals of an older version of a replaceable event go nowhere
+	if models.IsReplaceableKind(event.Kind) && !s.replaceStored(event) {
+		return
+	}
+
+	// Subscribers get large events whole
+	if event = s.reassemble(event); event == nil {
+		return
+	}
+
+	// Live chat reaches viewers before the XFTP round trip
+	liveFirst := s.live != nil && live.IsLiveKind(event.Kind)
+	if liveFirst {
+		s.live.Record(event)
+		s.broadcastEvent(event)
+	}
+
+	// Persist to the storage backend if one is configured
+	if s.storage != nil {
+		_, store := tracing.Start(ctx, tracing.KindClient, "storage store")
+		if err := s.storage.StoreEvent(event); err != nil {
+			store.RecordError(err)
+			slog.Error("Error storing event", logging.KeyEventID, event.ID, logging.KeyTraceID, event.TraceID, "error", err)
+		}
+		store.End()
+	}
+
+	// Broadcast to subscribers
+	if !liveFirst {
+		_, broadcast := tracing.Start(ctx, tracing.KindInternal, "broadcast")
+		s.broadcastEvent(event)
+		broadcast.End()
+	}
+
+	// Deliver to REST topic streams
+	if s.restAPI != nil {
+		s.restAPI.DeliverEvent(event)
+	}
+
+	// Notify offline users with matching push subscriptions
+	if s.push != nil {
+		s.push.Notify(event)
+	}
+
+	// Apply new versions of subscribed moderation lists
+	if s.blockLists != nil {
+		s.blockLists.Observe(event)
+	}
+
+	// Send to gRPC event streams
+	if s.eventStream != nil {
+		s.eventStream.Broadcast(event)
+	}
+
+	// Count reactions, zaps and replies for trending
+	if s.trending != nil {
+		s.trending.Record(event)
+	}
+
+	// Index for full-text search
+	if s.search != nil {
+		s.search.Index(event)
+	}
+
+	// Schedule deletion at the NIP-40 expiration
+	if s.retention != nil {
+		s.retention.Track(event)
+	}
+
+	// Unlock books paid for with zaps
+	if s.entitlements != nil && event.Kind == entitlement.KindZapReceipt {
+		go s.recordPurchase(event)
+	}
+
+	// Admit writers who received enough zaps
+	if s.payments != nil && event.Kind == entitlement.KindZapReceipt {
+		s.recordZap(event)
+	}
+
+	// Forward to external brokers
+	if s.forwarder != nil && !event.IsQuarantined {
+		s.forwarder.Forward(event)
+	}
+
+	// Republish owned events to the outbox relays
+	if s.outbox != nil {
+		s.outbox.Push(event)
+	}
+}
+
+// broadcastEvent queues event for every matching subscription. Concurrent
+// broadcasts are serialized, so all connections see the same order. Live
+// activity events skip ahead of events still waiting to be written.
 func (s *Server) broadcastEvent(event *models.Event) {
+	priority := s.live != nil && live.IsLiveKind(event.Kind)
+	s.broadcastMutex.Lock()
+	defer s.broadcastMutex.Unlock()
 	s.connMutex.RLock()
 	defer s.connMutex.RUnlock()
 
-	for conn, connection := range s.connections {
+	for _, connection := range s.connections {
+		if connection.isMuted(event.PubKey) {
+			continue
+		}
+
 		connection.subMutex.RLock()
 		for _, sub := range connection.subs {
-			if sub.Active && s.eventMatchesFilter(event, sub.Filter) {
-				s.sendEvent(conn, sub.ID, event)
+			if sub.Active && s.eventMatchesFilter(event, sub.Filter) && sub.matchesLanguage(event) {
+				var err error
+				if priority {
+					err = sub.stream.PushPriority(event)
+				} else {
+					err = sub.stream.Push(event)
+				}
+				if err == fanout.ErrFull {
+					// A client this far behind is dropped rather than
+					// buffered without end
+					go s.dropSlowReader(connection)
+					break
+				}
 			}
 		}
 		connection.subMutex.RUnlock()
 	}
 }
 
-func (s *Server) sendEvent(conn *websocket.Conn, subID string, event *models.Event) {
+// sendEvent writes a queued event to the client
+func (s *Server) sendEvent(conn *Connection, m fanout.Message) error {
 	msg := []interface{}{
 		"EVENT",
-		subID,
-		event.ToNostrEvent(),
+		m.SubID,
+		m.Event.ToNostrEvent(),
+	}
+	if extensions := s.eventExtensions(conn, m); len(extensions) > 0 {
+		msg = append(msg, extensions)
 	}
 
-	if err := conn.WriteJSON(msg); err != nil {
-		log.Printf("Error sending event: %v", err)
+	if err := conn.conn.WriteJSON(msg); err != nil {
+		conn.log.Debug("Error sending event", logging.KeyEventID, m.Event.ID, "error", err)
+		return err
 	}
+	return nil
 }
 
-func (s *Server) sendOK(conn *websocket.Conn, eventID string, ok bool, message string) {
+func (s *Server) sendOK(conn *Connection, eventID string, ok bool, message string) {
 	msg := []interface{}{
 		"OK",
 		eventID,
@@ -583,18 +1225,114 @@ func (s *Server) sendOK(conn *websocket.Conn, eventID string, ok bool, message s
 		message,
 	}
 
-	if err := conn.WriteJSON(msg); err != nil {
+	if err := s.send(conn, msg); err != nil {
 		log.Printf("Error sending OK: %v", err)
 	}
 }
 
-func (s *Server) sendError(conn *websocket.Conn, errorType, message string) {
+// sendDebugSummary sends a NOTICE with a JSON summary of the connection's
+// subscriptions, rate limit status and authentication state
+func (s *Server) sendDebugSummary(conn *Connection) {
+	conn.subMutex.RLock()
+	subs := make([]map[string]interface{}, 0, len(conn.subs))
+	for _, sub := range conn.subs {
+		subs = append(subs, map[string]interface{}{
+			"id":     sub.ID,
+			"filter": sub.Filter,
+			"active": sub.Active,
+		})
+	}
+	conn.subMutex.RUnlock()
+
+	rateLimit := map[string]interface{}{
+		"enabled": false,
+	}
+	pubkey := conn.authPubkey()
+	if s.qualityControl != nil && pubkey != "" {
+		used, limit := s.qualityControl.GetRateLimitStatus(pubkey)
+		remaining := limit - used
+		if remaining < 0 {
+			remaining = 0
+		}
+		rateLimit = map[string]interface{}{
+			"enabled":      true,
+			"window":       "1m",
+			"used":         used,
+			"limit":        limit,
+			"remaining":    remaining,
+			"rate_limited": remaining == 0,
+		}
+	}
+
+	reqs := map[string]interface{}{"enabled": false}
+	if conn.reqLimit != nil {
+		accepted, rateLimited, replayLimited, replays := conn.reqLimit.snapshot()
+		reqs = map[string]interface{}{
+			"enabled":        conn.reqLimit.rate > 0 || conn.reqLimit.maxReplays > 0,
+			"accepted":       accepted,
+			"rate_limited":   rateLimited,
+			"replay_limited": replayLimited,
+			"active_replays": replays,
+		}
+	}
+
+	limits := map[string]interface{}{
+		"max_subscriptions":     conn.limits.maxSubscriptions,
+		"max_filters":           conn.limits.maxFilters,
+		"max_events_per_minute": int(conn.limits.eventBurst),
+		"refused":               conn.limits.snapshot(),
+		"pending_events":        conn.out.Len(),
+	}
+
+	auth := map[string]interface{}{
+		"authenticated": pubkey != "",
+		"pubkey":        pubkey,
+	}
+	if s.accessControl != nil && pubkey != "" {
+		auth["can_write"] = s.accessControl.CanWrite(pubkey)
+		auth["can_read"] = s.accessControl.CanRead(pubkey)
+	}
+
+	summary := map[string]interface{}{
+		"remote_addr":        conn.remoteAddr,
+		"connected_at":       conn.connectedAt.Unix(),
+		"subscription_count": len(subs),
+		"subscriptions":      subs,
+		"rate_limit":         rateLimit,
+		"req_limit":          reqs,
+		"limits":             limits,
+		"auth":               auth,
+	}
+
+	data, err := json.Marshal(summary)
+	if err != nil {
+		s.sendError(conn, "error", fmt.Sprintf("failed to build debug summary: %v", err))
+		return
+	}
+
+	s.sendError(conn, "debug", string(data))
+}
+
+// send queues msg for conn behind everything already queued for it. The
+// connection's writer, see writeEvents, is the only goroutine writing to
+// its socket.
+func (s *Server) send(conn *Connection, msg []interface{}) error {
+	return conn.out.Send(msg)
+}
+
+// sendNotice sends a service NOTICE without the [type] prefix used for
+// errors, signed when the relay signs notices
+func (s *Server) sendNotice(conn *Connection, message string) error {
+	return s.send(conn, s.noticeMessage(message))
+}
+
+func (s *Server) sendError(conn *Connection, errorType, message string) {
 	msg := []interface{}{
 		"NOTICE",
 		fmt.Sprintf("[%s] %s", errorType, message),
 	}
 
-	if err := conn.WriteJSON(msg); err != nil {
+	if err := s.send(conn, msg); err != nil {
 		log.Printf("Error sending error: %v", err)
 	}
 }
@@ -0,0 +1,99 @@
+package relay
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/quality"
+	"mercury-relay/internal/reload"
+)
+
+// configReloader is where reloaded settings are read from
+type configReloader struct {
+	path     string
+	profile  string
+	kindsDir string
+	watcher  *reload.Watcher
+}
+
+// SetConfigReload reloads the config file at path (under profile) and the
+// kind configs in kindsDir on SIGHUP or when they change, checking every
+// interval (0 for the default, negative for SIGHUP only)
+func (s *Server) SetConfigReload(path, profile, kindsDir string, interval time.Duration) {
+	paths := []string{path}
+	if kindsDir != "" {
+		paths = append(paths, kindsDir)
+	}
+	s.reloader = &configReloader{
+		path:     path,
+		profile:  profile,
+		kindsDir: kindsDir,
+		watcher:  reload.NewWatcher(interval, paths...),
+	}
+}
+
+// reloadConfig loads the watched files and applies them
+func (s *Server) reloadConfig() error {
+	cfg, err := config.LoadProfile(s.reloader.path, s.reloader.profile)
+	if err != nil {
+		return err
+	}
+	var kinds *quality.KindConfigLoader
+	if s.reloader.kindsDir != "" {
+		if kinds, err = quality.NewKindConfigLoaderFromDirectory(s.reloader.kindsDir); err != nil {
+			return fmt.Errorf("failed to load kind configs: %w", err)
+		}
+	}
+	return s.Reload(cfg, kinds)
+}
+
+// Reload applies the settings of cfg that are safe to change while
+// running: quality thresholds, the kind configs (when kinds is not nil),
+// public access flags, the upstream relay list and per-connection limits.
+// Open connections are kept; new limits apply to connections opened from
+// now on. Everything else needs a restart. An invalid cfg changes nothing.
+func (s *Server) Reload(cfg *config.Config, kinds *quality.KindConfigLoader) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	if s.upstreamMgr != nil && cfg.Streaming.Enabled {
+		if err := s.upstreamMgr.UpdateRelays(cfg.Streaming.UpstreamRelays); err != nil {
+			return fmt.Errorf("failed to update upstream relays: %w", err)
+		}
+	}
+	if s.qualityControl != nil {
+		s.qualityControl.UpdateConfig(cfg.Quality)
+		if kinds != nil {
+			s.qualityControl.SetKindConfigLoader(kinds)
+		}
+	}
+	if s.accessControl != nil {
+		s.accessControl.UpdatePolicy(cfg.Access)
+	}
+
+	s.limitsMutex.Lock()
+	s.config.REQRateLimit = cfg.Server.REQRateLimit
+	s.config.REQBurst = cfg.Server.REQBurst
+	s.config.MaxConcurrentReplays = cfg.Server.MaxConcurrentReplays
+	s.config.MaxSubscriptions = cfg.Server.MaxSubscriptions
+	s.config.MaxFilters = cfg.Server.MaxFilters
+	s.config.MaxEventsPerMinute = cfg.Server.MaxEventsPerMinute
+	s.config.MaxViolations = cfg.Server.MaxViolations
+	s.config.MaxPendingEvents = cfg.Server.MaxPendingEvents
+	s.config.MaxMessageSize = cfg.Server.MaxMessageSize
+	s.limitsMutex.Unlock()
+
+	log.Printf("Applied config: spam threshold %.2f, %d upstream relay(s), public read %v, public write %v",
+		cfg.Quality.SpamThreshold, len(cfg.Streaming.UpstreamRelays), cfg.Access.AllowPublicRead, cfg.Access.AllowPublicWrite)
+	return nil
+}
+
+// limits returns the server config with the current per-connection limits
+func (s *Server) limits() config.ServerConfig {
+	s.limitsMutex.RLock()
+	defer s.limitsMutex.RUnlock()
+	return s.config
+}
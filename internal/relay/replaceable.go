@@ -0,0 +1,35 @@
+package relay
+
+import (
+	"log"
+
+	"mercury-relay/internal/models"
+)
+
+// replaceStored checks a replaceable event against the latest version in the
+// cache. A version older than that one is stale and reports false; a new
+// latest version replaces the one before it in storage.
+func (s *Server) replaceStored(event *models.Event) bool {
+	latest, err := s.cache.GetLatestReplaceableEvent(event.Kind, event.PubKey, event.DTag())
+	if err != nil {
+		// No longer cached, so there is nothing to compare against
+		return true
+	}
+	if latest.ID != event.ID {
+		return false
+	}
+	if s.storage == nil {
+		return true
+	}
+
+	history, err := s.cache.GetReplaceableEventHistory(event.Kind, event.PubKey, event.DTag())
+	if err != nil || len(history) < 2 {
+		return true
+	}
+	if previous, ok := history[1]["event_id"].(string); ok && previous != event.ID {
+		if err := s.storage.DeleteEvent(previous); err != nil {
+			log.Printf("Error removing replaced event %s from XFTP: %v", previous, err)
+		}
+	}
+	return true
+}
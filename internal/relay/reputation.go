@@ -0,0 +1,61 @@
+package relay
+
+import (
+	"log"
+	"net/http"
+
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/reputation"
+)
+
+// SetReputation screens clients against the IP reputation lists at the
+// WebSocket upgrade and in the REST API
+func (s *Server) SetReputation(checker *reputation.Checker) {
+	s.reputation = checker
+	if s.restAPI != nil {
+		s.restAPI.SetReputation(checker)
+	}
+}
+
+// screenConnection checks the IP of an upgrade request
+func (s *Server) screenConnection(r *http.Request) reputation.Verdict {
+	if s.reputation == nil {
+		return reputation.Verdict{}
+	}
+	verdict := s.reputation.CheckRequest(r)
+	if verdict.Action != reputation.ActionAllow {
+		log.Printf("Connection from %s matched %s: %s", r.RemoteAddr, verdict.Source, verdict.Action)
+	}
+	return verdict
+}
+
+// newConnectionLimiter returns the REQ limiter for a new connection,
+// divided for rate_limit matches
+func (s *Server) newConnectionLimiter(verdict reputation.Verdict) *reqLimiter {
+	limits := s.limits()
+	rate, burst, replays := limits.REQRateLimit, limits.REQBurst, limits.MaxConcurrentReplays
+	if verdict.Action == reputation.ActionRateLimit {
+		divisor := s.reputation.RateLimitDivisor()
+		rate /= float64(divisor)
+		burst /= divisor
+		if replays > 1 {
+			replays = max(replays/divisor, 1)
+		}
+	}
+	return newREQLimiter(rate, burst, replays)
+}
+
+// checkReputationWrite only lets require_auth connections publish signed
+// events from known writers, closing public and anonymous writes to them
+func (s *Server) checkReputationWrite(conn *Connection, event *models.Event) (string, bool) {
+	if conn.reputation.Action != reputation.ActionRequireAuth {
+		return "", true
+	}
+	if ok, err := event.ToNostrEvent().CheckSignature(); err != nil || !ok {
+		return "auth-required: connections from this network must publish signed events", false
+	}
+	if !s.accessControl.IsKnownWriter(event.PubKey) {
+		return "auth-required: connections from this network may only publish as a known writer", false
+	}
+	return "", true
+}
@@ -0,0 +1,172 @@
+package relay
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mercury-relay/internal/api"
+)
+
+// CLOSED reasons for REQs refused by flood protection
+const (
+	reasonREQRate     = "rate-limited: too many REQs, slow down"
+	reasonReplayLimit = "rate-limited: too many concurrent queries on this connection"
+)
+
+// reqLimiter is a per-connection token bucket for REQ messages plus a count
+// of subscriptions still replaying stored events
+type reqLimiter struct {
+	rate       float64 // tokens per second, <= 0 disables
+	burst      float64
+	tokens     float64
+	last       time.Time
+	maxReplays int // <= 0 disables
+	replays    int
+
+	// Counters for stats and the admin connection view
+	accepted      int64
+	rateLimited   int64
+	replayLimited int64
+
+	mu sync.Mutex
+}
+
+func newREQLimiter(rate float64, burst, maxReplays int) *reqLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &reqLimiter{
+		rate:       rate,
+		burst:      float64(burst),
+		tokens:     float64(burst),
+		last:       time.Now(),
+		maxReplays: maxReplays,
+	}
+}
+
+// admit decides whether a REQ may open a subscription. On success a replay
+// slot is held until release is called; otherwise the CLOSED reason is
+// returned.
+func (l *reqLimiter) admit(now time.Time) (string, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > l.burst {
+			l.tokens = l.burst
+		}
+		l.last = now
+		if l.tokens < 1 {
+			l.rateLimited++
+			return reasonREQRate, false
+		}
+	}
+
+	if l.maxReplays > 0 && l.replays >= l.maxReplays {
+		l.replayLimited++
+		return reasonReplayLimit, false
+	}
+
+	if l.rate > 0 {
+		l.tokens--
+	}
+	l.replays++
+	l.accepted++
+	return "", true
+}
+
+// release frees the replay slot held by an admitted REQ
+func (l *reqLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.replays > 0 {
+		l.replays--
+	}
+}
+
+func (l *reqLimiter) snapshot() (accepted, rateLimited, replayLimited int64, replays int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.accepted, l.rateLimited, l.replayLimited, l.replays
+}
+
+// reqCounters totals REQ outcomes across every connection, including closed ones
+type reqCounters struct {
+	accepted      atomic.Int64
+	rateLimited   atomic.Int64
+	replayLimited atomic.Int64
+	fromStorage   atomic.Int64 // REQs the cache could not fully answer
+}
+
+// sendClosed refuses a REQ (NIP-01). The CLOSED message is written after
+// the events already queued on conn.
+func (s *Server) sendClosed(conn *Connection, subID, reason string) {
+	conn.out.Open(subID).Finish(reason)
+}
+
+// terminate ends sub on the relay's side, dropping its unwritten events,
+// and tells the client why with CLOSED
+func (s *Server) terminate(conn *Connection, sub *Subscription, reason string) {
+	conn.subMutex.Lock()
+	current := conn.subs[sub.ID] == sub
+	if current {
+		delete(conn.subs, sub.ID)
+	}
+	conn.subMutex.Unlock()
+
+	sub.Active = false
+	if sub.cancel != nil {
+		sub.cancel()
+	}
+	sub.stream.Finish(reason)
+	if current && s.live != nil {
+		s.live.Unwatch(conn, sub.ID)
+	}
+}
+
+// Connections lists the open WebSocket connections for the admin API
+func (s *Server) Connections() []api.ConnectionInfo {
+	s.connMutex.RLock()
+	defer s.connMutex.RUnlock()
+
+	infos := make([]api.ConnectionInfo, 0, len(s.connections))
+	for _, conn := range s.connections {
+		conn.subMutex.RLock()
+		subs := len(conn.subs)
+		conn.subMutex.RUnlock()
+
+		info := api.ConnectionInfo{
+			RemoteAddr:    conn.remoteAddr,
+			Pubkey:        conn.authPubkey(),
+			ConnectedAt:   conn.connectedAt,
+			Subscriptions: subs,
+		}
+		if conn.reqLimit != nil {
+			info.REQs, info.RateLimited, info.ReplayLimited, info.ActiveReplays = conn.reqLimit.snapshot()
+		}
+		if conn.limits != nil {
+			info.Refused = conn.limits.snapshot()
+		}
+		info.PendingEvents = conn.out.Len()
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+// REQStats totals REQ outcomes and the messages and connections refused by
+// the per-connection limits since startup for the stats endpoint
+func (s *Server) REQStats() map[string]int64 {
+	return map[string]int64{
+		"accepted":             s.reqCounters.accepted.Load(),
+		"rate_limited":         s.reqCounters.rateLimited.Load(),
+		"replay_limited":       s.reqCounters.replayLimited.Load(),
+		"storage_fallback":     s.reqCounters.fromStorage.Load(),
+		"subscription_limited": s.connCounters.subscriptionLimited.Load(),
+		"filter_limited":       s.connCounters.filterLimited.Load(),
+		"event_rate_limited":   s.connCounters.eventRateLimited.Load(),
+		"dropped":              s.connCounters.dropped.Load(),
+		"slow_dropped":         s.connCounters.slowDropped.Load(),
+	}
+}
@@ -0,0 +1,27 @@
+package relay
+
+import "mercury-relay/internal/retention"
+
+// SetRetention prunes events past their retention rule or NIP-40
+// expiration. Rules by author class see the owner, known writers and
+// everyone else.
+func (s *Server) SetRetention(p *retention.Pruner) {
+	s.retention = p
+	p.SetClassifier(s.authorClass)
+	if s.restAPI != nil {
+		s.restAPI.SetRetention(p)
+	}
+}
+
+func (s *Server) authorClass(pubkey string) string {
+	switch {
+	case s.accessControl == nil:
+		return retention.ClassOther
+	case s.accessControl.IsOwner(pubkey):
+		return retention.ClassOwner
+	case s.accessControl.IsKnownWriter(pubkey):
+		return retention.ClassWriter
+	default:
+		return retention.ClassOther
+	}
+}
@@ -0,0 +1,58 @@
+package relay
+
+import (
+	"context"
+	"log"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/search"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// SetSearchIndex indexes stored notes, articles, books and wiki pages and
+// enables the search endpoint and NIP-50 search filters
+func (s *Server) SetSearchIndex(idx *search.Index) {
+	s.search = idx
+	if s.restAPI != nil {
+		s.restAPI.SetSearchIndex(idx)
+	}
+}
+
+// loadSearchIndex indexes what the cache already holds
+func (s *Server) loadSearchIndex(ctx context.Context) {
+	if err := s.search.Load(ctx, s.cache); err != nil {
+		log.Printf("Failed to load search index: %v", err)
+		return
+	}
+	log.Printf("Search index loaded: %v", s.search.Stats()["documents"])
+}
+
+// checkSearch reports why a NIP-50 search can't be answered
+func (s *Server) checkSearch(query string) (string, bool) {
+	if s.search == nil {
+		return "unsupported: search is not enabled on this relay", false
+	}
+	if err := s.search.CheckQuery(query); err != nil {
+		return "invalid: " + err.Error(), false
+	}
+	return "", true
+}
+
+// searchEvents yields the indexed events answering a NIP-50 filter, in
+// rank order
+func (s *Server) searchEvents(filter nostr.Filter) cache.EventIterator {
+	return func(yield func(*models.Event, error) bool) {
+		events, err := s.search.Filter(filter)
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for _, event := range events {
+			if !yield(event, nil) {
+				return
+			}
+		}
+	}
+}
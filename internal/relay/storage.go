@@ -0,0 +1,106 @@
+package relay
+
+import (
+	"context"
+	"log"
+
+	"mercury-relay/internal/logging"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/storage"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// warmupPage is how many stored events are loaded per warm-up query
+const warmupPage = 1000
+
+// SetCacheWarmup loads up to limit of the newest stored events into the
+// cache at start, when the storage backend can query them
+func (s *Server) SetCacheWarmup(limit int) {
+	s.warmupEvents = limit
+}
+
+// warmCache copies the newest stored events into the cache, paging back
+// through created_at
+func (s *Server) warmCache(ctx context.Context) {
+	querier, ok := s.storage.(storage.Querier)
+	if !ok || s.warmupEvents <= 0 {
+		return
+	}
+
+	seen := make(map[string]bool)
+	filter := nostr.Filter{}
+	for len(seen) < s.warmupEvents {
+		filter.Limit = min(s.warmupEvents-len(seen), warmupPage)
+		events, err := querier.QueryEvents(ctx, filter)
+		if err != nil {
+			log.Printf("Failed to warm cache from storage: %v", err)
+			break
+		}
+		fresh := 0
+		for _, event := range events {
+			if seen[event.ID] {
+				continue
+			}
+			seen[event.ID] = true
+			fresh++
+			if err := s.cache.StoreEvent(event); err != nil {
+				log.Printf("Failed to cache stored event %s: %v", event.ID, err)
+			}
+		}
+		if fresh == 0 || len(events) < filter.Limit {
+			break
+		}
+		until := events[len(events)-1].CreatedAt
+		filter.Until = &until
+	}
+	log.Printf("Cache warmed with %d stored events", len(seen))
+}
+
+// sendStoredEvents answers the part of sub's filter the cache could not:
+// when fewer events than the filter's limit were sent, or it has no limit,
+// storage is queried and the events not yet sent are passed to send until
+// it reports the limit reached. ID lookups only ask for the missing IDs.
+func (s *Server) sendStoredEvents(ctx context.Context, sub *Subscription, sent map[string]bool, send func(*models.Event) bool) error {
+	querier, ok := s.storage.(storage.Querier)
+	if !ok || !sub.Active {
+		return nil
+	}
+	filter := sub.Filter
+	if filter.Limit > 0 && len(sent) >= filter.Limit {
+		return nil
+	}
+	if len(filter.IDs) > 0 {
+		var missing []string
+		for _, id := range filter.IDs {
+			if !sent[id] {
+				missing = append(missing, id)
+			}
+		}
+		if len(missing) == 0 {
+			return nil
+		}
+		filter.IDs = missing
+	}
+
+	// The newest limit stored events hold at most len(sent) already sent,
+	// so the filter's own limit is enough to fill the rest
+	events, err := querier.QueryEvents(ctx, filter)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil
+		}
+		logging.FromContext(ctx).Error("Error getting events from storage", "subscription", sub.ID, "error", err)
+		return err
+	}
+	s.reqCounters.fromStorage.Add(1)
+	for _, event := range events {
+		if sent[event.ID] {
+			continue
+		}
+		if !send(event) {
+			return nil
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package relay
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"mercury-relay/internal/fanout"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/storage"
+	"mercury-relay/test/helpers"
+	"mercury-relay/test/mocks"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// failingStorage is a queryable backend whose queries fail
+type failingStorage struct {
+	storage.Storage
+}
+
+func (failingStorage) QueryEvents(ctx context.Context, filter nostr.Filter) ([]*models.Event, error) {
+	return nil, fmt.Errorf("disk on fire")
+}
+
+var errStopped = fmt.Errorf("stopped at EOSE")
+
+// replay runs a REQ for filter as handleREQ does and returns the IDs sent
+// before EOSE, with "EOSE" last
+func replay(t *testing.T, s *Server, filter nostr.Filter) string {
+	t.Helper()
+	conn := testConnection()
+	sub := &Subscription{ID: "sub", Filter: filter, Active: true, stream: conn.out.Open("sub")}
+	helpers.AssertNoError(t, s.sendMatchingEvents(context.Background(), conn, sub))
+	helpers.AssertNoError(t, sub.stream.EOSE())
+
+	var ids []string
+	err := conn.out.Run(context.Background(), func(m fanout.Message) error {
+		if m.Type == fanout.TypeEOSE {
+			ids = append(ids, "EOSE")
+			return errStopped
+		}
+		ids = append(ids, m.Event.ID)
+		return nil
+	})
+	helpers.AssertEqual(t, errStopped, err)
+	return strings.Join(ids, " ")
+}
+
+func TestSendStoredEvents(t *testing.T) {
+	store, err := storage.NewFile(t.TempDir())
+	helpers.AssertNoError(t, err)
+	defer store.Close()
+
+	// Storage holds e1 (oldest) to e5, the cache only the newest
+	cache := mocks.NewMockCache()
+	for i := 1; i <= 5; i++ {
+		event := &models.Event{ID: fmt.Sprintf("e%d", i), PubKey: "alice", Kind: 1, CreatedAt: nostr.Timestamp(i * 100)}
+		helpers.AssertNoError(t, store.StoreEvent(event))
+		if i == 5 {
+			helpers.AssertNoError(t, cache.StoreEvent(event))
+		}
+	}
+	s := &Server{cache: cache, storage: store}
+
+	t.Run("Fills the limit newest first", func(t *testing.T) {
+		helpers.AssertStringEqual(t, "e5 e4 e3 EOSE", replay(t, s, nostr.Filter{Limit: 3}))
+	})
+
+	t.Run("Sends every stored event without a limit", func(t *testing.T) {
+		helpers.AssertStringEqual(t, "e5 e4 e3 e2 e1 EOSE", replay(t, s, nostr.Filter{}))
+	})
+
+	t.Run("Skips storage once the cache filled the limit", func(t *testing.T) {
+		before := s.reqCounters.fromStorage.Load()
+		helpers.AssertStringEqual(t, "e5 EOSE", replay(t, s, nostr.Filter{Limit: 1}))
+		helpers.AssertInt64Equal(t, before, s.reqCounters.fromStorage.Load())
+	})
+
+	t.Run("Looks up only the missing IDs", func(t *testing.T) {
+		helpers.AssertStringEqual(t, "e5 e1 EOSE", replay(t, s, nostr.Filter{IDs: []string{"e1", "e5", "e9"}}))
+		helpers.AssertStringEqual(t, "e5 EOSE", replay(t, s, nostr.Filter{IDs: []string{"e5"}, Authors: []string{"alice"}}))
+	})
+
+	t.Run("Stops at the limit", func(t *testing.T) {
+		var got []string
+		sub := &Subscription{ID: "sub", Filter: nostr.Filter{}, Active: true}
+		err := s.sendStoredEvents(context.Background(), sub, map[string]bool{"e5": true}, func(event *models.Event) bool {
+			got = append(got, event.ID)
+			return len(got) < 2
+		})
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, "e4 e3", strings.Join(got, " "))
+	})
+
+	t.Run("Closed subscriptions aren't filled", func(t *testing.T) {
+		sub := &Subscription{ID: "sub", Filter: nostr.Filter{}}
+		err := s.sendStoredEvents(context.Background(), sub, map[string]bool{}, func(event *models.Event) bool {
+			t.Fatalf("sent %s", event.ID)
+			return false
+		})
+		helpers.AssertNoError(t, err)
+	})
+
+	t.Run("Query errors end the replay before EOSE", func(t *testing.T) {
+		s := &Server{cache: cache, storage: failingStorage{store}}
+		conn := testConnection()
+		sub := &Subscription{ID: "sub", Filter: nostr.Filter{}, Active: true, stream: conn.out.Open("sub")}
+		helpers.AssertErrorContains(t, s.sendMatchingEvents(context.Background(), conn, sub), "disk on fire")
+
+		// A cancelled query is not an error
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		helpers.AssertNoError(t, s.sendStoredEvents(ctx, sub, map[string]bool{}, func(*models.Event) bool { return true }))
+	})
+}
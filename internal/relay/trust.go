@@ -0,0 +1,25 @@
+package relay
+
+import (
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/trust"
+)
+
+// SetTrustLabeler labels events stored from upstream relays with how the
+// relay knows their author
+func (s *Server) SetTrustLabeler(labeler *trust.Labeler) {
+	s.trustLabels = labeler
+	if s.upstreamMgr != nil {
+		s.upstreamMgr.SetTrustLabeler(labeler)
+	}
+}
+
+// trustLabelFor returns event's trust label for the extra EVENT element, or
+// "". Only authenticated clients get it, when enabled; the signed event
+// itself is never changed.
+func (s *Server) trustLabelFor(conn *Connection, event *models.Event) string {
+	if s.trustLabels == nil || !s.trustLabels.SendsToClients() || conn.authPubkey() == "" {
+		return ""
+	}
+	return event.TrustLabel
+}
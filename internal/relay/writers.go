@@ -0,0 +1,35 @@
+package relay
+
+import (
+	"errors"
+	"log"
+
+	"mercury-relay/internal/access"
+	"mercury-relay/internal/models"
+)
+
+// requestWriteAccess queues the author of a denied event for admin approval
+// and returns the OK message telling them where their request stands. It
+// reports false when writer approval is off. Only signed events are queued,
+// so nobody can file a request in someone else's name.
+func (s *Server) requestWriteAccess(event *models.Event) (string, bool) {
+	nostrEvent := event.ToNostrEvent()
+	if ok, err := nostrEvent.CheckSignature(); err != nil || !ok {
+		return "", false
+	}
+
+	status, err := s.accessControl.RequestWrite(nostrEvent)
+	switch {
+	case errors.Is(err, access.ErrWriterApprovalDisabled):
+		return "", false
+	case errors.Is(err, access.ErrPendingWritersFull):
+		return "restricted: write access requests are not being accepted right now", true
+	case err != nil:
+		log.Printf("Failed to record write request from %s: %v", event.PubKey, err)
+	}
+
+	if status == access.WriterDenied {
+		return "restricted: write access request denied", true
+	}
+	return "restricted: write access pending admin approval", true
+}
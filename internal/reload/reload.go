@@ -0,0 +1,139 @@
+// Package reload watches the config file and kind configs for changes and
+// calls back to apply them. A reload runs on SIGHUP or when the
+// modification time of a watched file changes; directories are watched
+// file by file, so adding, editing or removing a kind config counts.
+package reload
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// defaultInterval is how often watched files are checked
+const defaultInterval = 5 * time.Second
+
+// Watcher triggers reloads on SIGHUP and on file changes
+type Watcher struct {
+	paths    []string
+	interval time.Duration
+	trigger  chan struct{}
+}
+
+// NewWatcher watches paths, files or directories, every interval; 0 uses
+// the default of 5s and a negative interval only reloads on SIGHUP
+func NewWatcher(interval time.Duration, paths ...string) *Watcher {
+	if interval == 0 {
+		interval = defaultInterval
+	}
+	return &Watcher{
+		paths:    paths,
+		interval: interval,
+		trigger:  make(chan struct{}, 1),
+	}
+}
+
+// Trigger asks for a reload without waiting for a change
+func (w *Watcher) Trigger() {
+	select {
+	case w.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// Run calls apply on every SIGHUP, Trigger or change to a watched file
+// until ctx is done. A failed reload is logged and retried on the next
+// change.
+func (w *Watcher) Run(ctx context.Context, apply func() error) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var tick <-chan time.Time
+	if w.interval > 0 {
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	last := w.snapshot()
+	for {
+		var reason string
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			reason = "SIGHUP"
+		case <-w.trigger:
+			reason = "request"
+		case <-tick:
+			current := w.snapshot()
+			if sameFiles(last, current) {
+				continue
+			}
+			reason = "file change"
+		}
+
+		// Take the snapshot first so edits made while applying are caught
+		last = w.snapshot()
+		if err := apply(); err != nil {
+			log.Printf("Config reload on %s failed, keeping the current settings: %v", reason, err)
+			continue
+		}
+		log.Printf("Config reloaded on %s", reason)
+	}
+}
+
+// snapshot returns the modification time and size of every watched file
+func (w *Watcher) snapshot() map[string]fileState {
+	files := make(map[string]fileState)
+	for _, path := range w.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if !info.IsDir() {
+			files[path] = stateOf(info)
+			continue
+		}
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				continue
+			}
+			if info, err := entry.Info(); err == nil {
+				files[filepath.Join(path, entry.Name())] = stateOf(info)
+			}
+		}
+	}
+	return files
+}
+
+// fileState is what a change to a file is detected by
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func stateOf(info os.FileInfo) fileState {
+	return fileState{modTime: info.ModTime(), size: info.Size()}
+}
+
+func sameFiles(a, b map[string]fileState) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for path, state := range a {
+		if other, ok := b[path]; !ok || !other.modTime.Equal(state.modTime) || other.size != state.size {
+			return false
+		}
+	}
+	return true
+}
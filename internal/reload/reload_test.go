@@ -0,0 +1,104 @@
+package reload
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mercury-relay/test/helpers"
+)
+
+// waitReload waits for one call to apply
+func waitReload(t *testing.T, reloads <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-reloads:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected a reload")
+	}
+}
+
+// expectNoReload fails if apply is called within a few intervals
+func expectNoReload(t *testing.T, reloads <-chan struct{}) {
+	t.Helper()
+	select {
+	case <-reloads:
+		t.Fatal("expected no reload")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func TestWatcher(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	kindsDir := filepath.Join(dir, "kinds")
+	helpers.AssertNoError(t, os.WriteFile(configPath, []byte("quality: {}\n"), 0644))
+	helpers.AssertNoError(t, os.Mkdir(kindsDir, 0755))
+
+	w := NewWatcher(10*time.Millisecond, configPath, kindsDir)
+	reloads := make(chan struct{}, 10)
+	fail := make(chan bool, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx, func() error {
+		reloads <- struct{}{}
+		select {
+		case <-fail:
+			return fmt.Errorf("invalid config")
+		default:
+			return nil
+		}
+	})
+
+	t.Run("unchanged files", func(t *testing.T) {
+		expectNoReload(t, reloads)
+	})
+
+	t.Run("config edited", func(t *testing.T) {
+		helpers.AssertNoError(t, os.WriteFile(configPath, []byte("quality:\n  spam_threshold: 0.5\n"), 0644))
+		waitReload(t, reloads)
+		expectNoReload(t, reloads)
+	})
+
+	t.Run("kind config added", func(t *testing.T) {
+		helpers.AssertNoError(t, os.WriteFile(filepath.Join(kindsDir, "1.yml"), []byte("name: note\n"), 0644))
+		waitReload(t, reloads)
+	})
+
+	t.Run("kind config removed", func(t *testing.T) {
+		helpers.AssertNoError(t, os.Remove(filepath.Join(kindsDir, "1.yml")))
+		waitReload(t, reloads)
+	})
+
+	t.Run("failed reload keeps watching", func(t *testing.T) {
+		fail <- true
+		w.Trigger()
+		waitReload(t, reloads)
+		w.Trigger()
+		waitReload(t, reloads)
+	})
+}
+
+func TestWatcherSignalOnly(t *testing.T) {
+	dir := t.TempDir()
+	configPath := filepath.Join(dir, "config.yaml")
+	helpers.AssertNoError(t, os.WriteFile(configPath, []byte("a: 1\n"), 0644))
+
+	w := NewWatcher(-1, configPath)
+	reloads := make(chan struct{}, 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go w.Run(ctx, func() error {
+		reloads <- struct{}{}
+		return nil
+	})
+
+	helpers.AssertNoError(t, os.WriteFile(configPath, []byte("a: 12\n"), 0644))
+	expectNoReload(t, reloads)
+
+	w.Trigger()
+	waitReload(t, reloads)
+}
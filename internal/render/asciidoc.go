@@ -0,0 +1,957 @@
+package render
+
+import (
+	"strconv"
+	"strings"
+)
+
+// admonitions are the AsciiDoc admonition labels
+var admonitions = map[string]string{
+	"NOTE":      "Note",
+	"TIP":       "Tip",
+	"IMPORTANT": "Important",
+	"WARNING":   "Warning",
+	"CAUTION":   "Caution",
+}
+
+// builtinAttributes are the character replacement attributes AsciiDoc
+// defines for every document
+var builtinAttributes = map[string]string{
+	"nbsp":    "\u00a0",
+	"sp":      " ",
+	"empty":   "",
+	"zwsp":    "\u200b",
+	"amp":     "&",
+	"lt":      "<",
+	"gt":      ">",
+	"startsb": "[",
+	"endsb":   "]",
+	"vbar":    "|",
+	"quot":    `"`,
+	"apos":    "'",
+}
+
+// AsciiDoc renders the AsciiDoc publications are written in: section
+// titles, paragraphs, admonitions, delimited blocks, lists, tables, images,
+// links, cross references and document attributes
+func AsciiDoc(source string, opts Options) string {
+	a := &asciidoc{opts: opts, attributes: make(map[string]string), ids: make(map[string]int)}
+	return strings.TrimSuffix(a.blocks(strings.Split(normalize(source), "\n")), "\n")
+}
+
+type asciidoc struct {
+	opts       Options
+	attributes map[string]string
+	ids        map[string]int // section IDs in use, to keep them unique
+}
+
+// blockMeta is what block attribute, anchor and title lines say about the
+// block that follows them
+type blockMeta struct {
+	positional []string
+	named      map[string]string
+	options    map[string]bool
+	id         string
+	title      string
+}
+
+func (m blockMeta) style() string {
+	if len(m.positional) > 0 {
+		return m.positional[0]
+	}
+	return ""
+}
+
+func (m blockMeta) arg(i int) string {
+	if i < len(m.positional) {
+		return m.positional[i]
+	}
+	return ""
+}
+
+// delimiter returns the delimited block a line opens, if any
+func delimiter(trimmed string) string {
+	switch {
+	case trimmed == "--", trimmed == "|===":
+		return trimmed
+	case len(trimmed) >= 4 && strings.Trim(trimmed, trimmed[:1]) == "" && strings.Contains("-._=*+/", trimmed[:1]):
+		return trimmed
+	}
+	return ""
+}
+
+func (a *asciidoc) blocks(lines []string) string {
+	var out strings.Builder
+	var meta blockMeta
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			i++
+			continue
+		}
+
+		// Lines that describe the next block
+		if strings.HasPrefix(trimmed, "//") && !strings.HasPrefix(trimmed, "////") {
+			i++
+			continue
+		}
+		if name, value, ok := attributeEntry(trimmed); ok {
+			if strings.HasSuffix(name, "!") {
+				delete(a.attributes, strings.TrimSuffix(name, "!"))
+			} else {
+				a.attributes[name] = value
+			}
+			i++
+			continue
+		}
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") && !strings.HasPrefix(trimmed, "[[") {
+			meta = mergeMeta(meta, parseAttributes(trimmed[1:len(trimmed)-1]))
+			i++
+			continue
+		}
+		if len(trimmed) > 1 && trimmed[0] == '.' && trimmed[1] != '.' && trimmed[1] != ' ' {
+			meta.title = trimmed[1:]
+			i++
+			continue
+		}
+
+		switch {
+		case delimiter(trimmed) != "":
+			i = a.delimited(lines, i, meta, &out)
+		case sectionLevel(trimmed) > 0:
+			level := sectionLevel(trimmed)
+			title := strings.TrimSpace(trimmed[level:])
+			id := meta.id
+			if id == "" {
+				id = a.sectionID(title)
+			}
+			tag := "h" + strconv.Itoa(min(level, 6))
+			out.WriteString("<" + tag + ` id="` + escape(id) + `">` + a.inline(title) + "</" + tag + ">\n")
+			i++
+		case strings.HasPrefix(trimmed, "image::"):
+			out.WriteString(a.imageBlock(trimmed[len("image::"):], meta))
+			i++
+		case trimmed == "'''":
+			out.WriteString("<hr/>\n")
+			i++
+		case trimmed == "<<<":
+			i++ // page breaks are the reader's business
+		case adocListItem(line) != nil:
+			i = a.list(lines, i, &out)
+		case descriptionItem(line) != nil:
+			i = a.descriptionList(lines, i, &out)
+		case indent(line) > 0 && meta.style() == "":
+			// Literal paragraph
+			var literal []string
+			for ; i < len(lines) && !blank(lines[i]); i++ {
+				literal = append(literal, lines[i])
+			}
+			out.WriteString(a.titled(meta) + "<pre>" + escape(dedent(literal)) + "</pre>\n")
+		default:
+			i = a.paragraph(lines, i, meta, &out)
+		}
+		meta = blockMeta{}
+	}
+	return out.String()
+}
+
+// attributeEntry parses a ":name: value" document attribute line
+func attributeEntry(trimmed string) (string, string, bool) {
+	if !strings.HasPrefix(trimmed, ":") {
+		return "", "", false
+	}
+	end := strings.Index(trimmed[1:], ":")
+	if end <= 0 {
+		return "", "", false
+	}
+	name := trimmed[1 : end+1]
+	for _, r := range strings.TrimSuffix(name, "!") {
+		if !(r == '-' || r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z') {
+			return "", "", false
+		}
+	}
+	return strings.ToLower(name), strings.TrimSpace(trimmed[end+2:]), true
+}
+
+// parseAttributes parses the inside of a block attribute line such as
+// [source,go], [quote, Author, Source], [#id.role%header,cols="1,2"]
+func parseAttributes(inner string) blockMeta {
+	meta := blockMeta{named: make(map[string]string), options: make(map[string]bool)}
+	for n, attr := range splitAttributes(inner) {
+		if name, value, ok := strings.Cut(attr, "="); ok && !strings.ContainsAny(name, ` "'`) {
+			name = strings.TrimSpace(name)
+			value = strings.Trim(strings.TrimSpace(value), `"'`)
+			meta.named[name] = value
+			if name == "options" || name == "opts" {
+				for _, option := range strings.Split(value, ",") {
+					meta.options[strings.TrimSpace(option)] = true
+				}
+			}
+			if name == "id" {
+				meta.id = value
+			}
+			continue
+		}
+		if n == 0 {
+			// The first attribute may carry #id, .role and %option shorthands
+			style := attr
+			if cut := strings.IndexAny(style, "#.%"); cut >= 0 {
+				for _, part := range shorthands(style[cut:]) {
+					switch part[0] {
+					case '#':
+						meta.id = part[1:]
+					case '%':
+						meta.options[part[1:]] = true
+					}
+				}
+				style = style[:cut]
+			}
+			attr = style
+		}
+		meta.positional = append(meta.positional, strings.Trim(attr, `"'`))
+	}
+	return meta
+}
+
+// splitAttributes splits on commas outside quotes, trimming each part
+func splitAttributes(inner string) []string {
+	var parts []string
+	var part strings.Builder
+	quote := byte(0)
+	for i := 0; i < len(inner); i++ {
+		c := inner[i]
+		switch {
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == ',':
+			parts = append(parts, strings.TrimSpace(part.String()))
+			part.Reset()
+			continue
+		}
+		part.WriteByte(c)
+	}
+	return append(parts, strings.TrimSpace(part.String()))
+}
+
+// shorthands splits "#id.role%option" into its parts
+func shorthands(s string) []string {
+	var parts []string
+	start := 0
+	for i := 1; i <= len(s); i++ {
+		if i == len(s) || strings.IndexByte("#.%", s[i]) >= 0 {
+			if i-start > 1 {
+				parts = append(parts, s[start:i])
+			}
+			start = i
+		}
+	}
+	return parts
+}
+
+func mergeMeta(meta, attrs blockMeta) blockMeta {
+	attrs.title = meta.title
+	if attrs.id == "" {
+		attrs.id = meta.id
+	}
+	return attrs
+}
+
+// sectionLevel returns the level of a "== Title" line, 0 for other lines
+func sectionLevel(trimmed string) int {
+	level := 0
+	for level < len(trimmed) && trimmed[level] == '=' {
+		level++
+	}
+	if level == 0 || level > 6 || level >= len(trimmed) || trimmed[level] != ' ' {
+		return 0
+	}
+	return level
+}
+
+// sectionID derives a unique ID from a section title the way Asciidoctor
+// does, so <<_section_title>> cross references resolve
+func (a *asciidoc) sectionID(title string) string {
+	var b strings.Builder
+	b.WriteByte('_')
+	underscore := false
+	for _, r := range strings.ToLower(title) {
+		if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r >= 0x80 {
+			b.WriteRune(r)
+			underscore = false
+		} else if !underscore {
+			b.WriteByte('_')
+			underscore = true
+		}
+	}
+	id := strings.TrimRight(b.String(), "_")
+	a.ids[id]++
+	if n := a.ids[id]; n > 1 {
+		id += "_" + strconv.Itoa(n)
+	}
+	return id
+}
+
+// titled renders a block's title line, if it has one
+func (a *asciidoc) titled(meta blockMeta) string {
+	if meta.title == "" {
+		return ""
+	}
+	return `<div class="title">` + a.inline(meta.title) + "</div>\n"
+}
+
+func (a *asciidoc) paragraph(lines []string, i int, meta blockMeta, out *strings.Builder) int {
+	var text []string
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if trimmed == "" || (len(text) > 0 && (delimiter(trimmed) != "" || (strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") && !strings.HasPrefix(trimmed, "[[")))) {
+			break
+		}
+		text = append(text, trimmed)
+	}
+	joined := strings.Join(text, "\n")
+	if meta.options["hardbreaks"] {
+		joined = strings.ReplaceAll(joined, "\n", " +\n")
+	}
+
+	// NOTE: text, or [NOTE] before the paragraph
+	label, admonition := admonitions[meta.style()]
+	if !admonition {
+		if prefix, rest, ok := strings.Cut(joined, ": "); ok {
+			if label, admonition = admonitions[prefix]; admonition {
+				joined = rest
+			}
+		}
+	}
+	if admonition {
+		out.WriteString(admonitionBlock(label, a.titled(meta)+"<p>"+a.inline(joined)+"</p>\n"))
+		return i
+	}
+
+	switch meta.style() {
+	case "quote", "verse":
+		out.WriteString(a.quote(meta, "<p>"+a.inline(strings.ReplaceAll(joined, "\n", " +\n"))+"</p>\n"))
+	case "source", "listing":
+		out.WriteString(a.titled(meta) + codeBlock(strings.Join(text, "\n"), meta.arg(1)))
+	case "literal":
+		out.WriteString(a.titled(meta) + "<pre>" + escape(strings.Join(text, "\n")) + "</pre>\n")
+	default:
+		out.WriteString(a.titled(meta) + "<p>" + a.inline(joined) + "</p>\n")
+	}
+	return i
+}
+
+func admonitionBlock(label, content string) string {
+	return `<div class="admonition ` + strings.ToLower(label) + `">` + "\n" +
+		`<p class="admonition-label"><strong>` + label + "</strong></p>\n" + content + "</div>\n"
+}
+
+// quote wraps content in a blockquote with the attribution and citation of
+// [quote, attribution, citation]
+func (a *asciidoc) quote(meta blockMeta, content string) string {
+	attribution := meta.arg(1)
+	if cite := meta.arg(2); cite != "" {
+		if attribution != "" {
+			attribution += ", "
+		}
+		attribution += cite
+	}
+	if attribution != "" {
+		content += `<p class="attribution">&#8212; ` + a.inline(attribution) + "</p>\n"
+	}
+	return a.titled(meta) + "<blockquote>\n" + content + "</blockquote>\n"
+}
+
+// delimited renders a block between two identical delimiter lines
+func (a *asciidoc) delimited(lines []string, i int, meta blockMeta, out *strings.Builder) int {
+	open := strings.TrimSpace(lines[i])
+	start := i + 1
+	end := start
+	for end < len(lines) && strings.TrimSpace(lines[end]) != open {
+		end++
+	}
+	content := lines[start:end]
+	next := min(end+1, len(lines))
+
+	label, admonition := admonitions[meta.style()]
+	switch {
+	case open == "|===":
+		out.WriteString(a.table(content, meta))
+	case open[0] == '/':
+		// Comment block
+	case open[0] == '-' && open != "--", open[0] == '+':
+		// Listing blocks and passthroughs, which are shown rather than passed
+		lang := ""
+		if meta.style() == "source" {
+			lang = meta.arg(1)
+		}
+		out.WriteString(a.titled(meta) + codeBlock(strings.Join(content, "\n"), lang))
+	case open[0] == '.':
+		out.WriteString(a.titled(meta) + "<pre>" + escape(strings.Join(content, "\n")) + "</pre>\n")
+	case open[0] == '_' && meta.style() == "verse":
+		out.WriteString(a.quote(meta, `<p class="verse">`+a.inline(strings.ReplaceAll(strings.Join(content, "\n"), "\n", " +\n"))+"</p>\n"))
+	case open[0] == '_':
+		out.WriteString(a.quote(meta, a.blocks(content)))
+	case admonition:
+		out.WriteString(admonitionBlock(label, a.titled(meta)+a.blocks(content)))
+	case open[0] == '=':
+		out.WriteString(`<div class="example">` + "\n" + a.titled(meta) + a.blocks(content) + "</div>\n")
+	case open[0] == '*':
+		out.WriteString(`<div class="sidebar">` + "\n" + a.titled(meta) + a.blocks(content) + "</div>\n")
+	default:
+		out.WriteString(a.titled(meta) + a.blocks(content))
+	}
+	return next
+}
+
+// imageBlock renders image::target[alt] as a figure
+func (a *asciidoc) imageBlock(macro string, meta blockMeta) string {
+	target, attrs, _ := strings.Cut(macro, "[")
+	alt := strings.TrimSuffix(attrs, "]")
+	if parts := splitAttributes(alt); len(parts) > 0 {
+		alt = strings.Trim(parts[0], `"`)
+	}
+	if alt == "" {
+		alt = strings.TrimSuffix(target[strings.LastIndex(target, "/")+1:], "."+lastExt(target))
+	}
+	figure := "<figure>" + image(a.substitute(target), alt)
+	if meta.title != "" {
+		figure += "<figcaption>" + a.inline(meta.title) + "</figcaption>"
+	}
+	return figure + "</figure>\n"
+}
+
+func lastExt(name string) string {
+	if dot := strings.LastIndex(name, "."); dot >= 0 {
+		return name[dot+1:]
+	}
+	return ""
+}
+
+// dedent removes the indentation common to lines
+func dedent(lines []string) string {
+	common := -1
+	for _, line := range lines {
+		if !blank(line) && (common < 0 || indent(line) < common) {
+			common = indent(line)
+		}
+	}
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		out[i] = line[min(max(common, 0), len(line)):]
+	}
+	return strings.Join(out, "\n")
+}
+
+// adocItem is one item of an AsciiDoc list
+type adocItem struct {
+	marker  string // *, **, -, ., .., or 1. for explicitly numbered items
+	ordered bool
+	text    []string
+	blocks  []string // blocks attached with a + continuation
+}
+
+// adocListItem parses a list item line ("* item", ".. item", "1. item")
+func adocListItem(line string) *adocItem {
+	trimmed := strings.TrimLeft(line, " ")
+	n := 0
+	for n < len(trimmed) && (trimmed[n] == '*' || trimmed[n] == '.') && trimmed[n] == trimmed[0] {
+		n++
+	}
+	marker := ""
+	switch {
+	case n > 0 && n <= 5:
+		marker = trimmed[:n]
+	case strings.HasPrefix(trimmed, "-"):
+		n = 1
+		marker = "-"
+	default:
+		for n < len(trimmed) && trimmed[n] >= '0' && trimmed[n] <= '9' {
+			n++
+		}
+		if n == 0 || n >= len(trimmed) || trimmed[n] != '.' {
+			return nil
+		}
+		n++
+		marker = "1."
+	}
+	if n >= len(trimmed) || trimmed[n] != ' ' || strings.TrimSpace(trimmed[n:]) == "" {
+		return nil
+	}
+	return &adocItem{
+		marker:  marker,
+		ordered: marker[0] == '.' || marker == "1.",
+		text:    []string{strings.TrimSpace(trimmed[n:])},
+	}
+}
+
+func (a *asciidoc) list(lines []string, i int, out *strings.Builder) int {
+	var items []*adocItem
+	for i < len(lines) {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if item := adocListItem(line); item != nil {
+			items = append(items, item)
+			i++
+			continue
+		}
+		last := items[len(items)-1]
+		switch {
+		case trimmed == "+":
+			// The next block belongs to the item
+			i++
+			block, next := attachedBlock(lines, i)
+			last.blocks = append(last.blocks, block...)
+			last.blocks = append(last.blocks, "")
+			i = next
+			continue
+		case trimmed == "":
+			// Lists carry on across blank lines to the next item
+			next := i
+			for next < len(lines) && blank(lines[next]) {
+				next++
+			}
+			if next < len(lines) && adocListItem(lines[next]) != nil {
+				i = next
+				continue
+			}
+		case len(last.blocks) == 0 && delimiter(trimmed) == "" && sectionLevel(trimmed) == 0 &&
+			!strings.HasPrefix(trimmed, "[") && descriptionItem(line) == nil:
+			last.text = append(last.text, trimmed)
+			i++
+			continue
+		}
+		break
+	}
+	rendered, _ := a.renderList(items, 0, nil)
+	out.WriteString(rendered)
+	return i
+}
+
+// attachedBlock collects the block starting at lines[i]: a delimited block
+// or the lines up to the next blank one
+func attachedBlock(lines []string, i int) ([]string, int) {
+	start := i
+	if i < len(lines) {
+		if open := delimiter(strings.TrimSpace(lines[i])); open != "" {
+			for i++; i < len(lines) && strings.TrimSpace(lines[i]) != open; i++ {
+			}
+			end := min(i+1, len(lines))
+			return lines[start:end], end
+		}
+	}
+	for i < len(lines) && !blank(lines[i]) && strings.TrimSpace(lines[i]) != "+" && adocListItem(lines[i]) == nil {
+		i++
+	}
+	return lines[start:i], i
+}
+
+// renderList renders the items from i with the same marker as a list, and
+// items with other markers that follow one as lists nested in it. Markers
+// of enclosing lists end the list.
+func (a *asciidoc) renderList(items []*adocItem, i int, enclosing []string) (string, int) {
+	marker := items[i].marker
+	tag := "ul"
+	if items[i].ordered {
+		tag = "ol"
+	}
+	var out strings.Builder
+	out.WriteString("<" + tag + ">\n")
+	levels := append(enclosing[:len(enclosing):len(enclosing)], marker)
+	for i < len(items) && items[i].marker == marker {
+		item := items[i]
+		out.WriteString("<li>" + a.inline(strings.Join(item.text, "\n")))
+		if len(item.blocks) > 0 {
+			out.WriteString("\n" + strings.TrimSuffix(a.blocks(item.blocks), "\n"))
+		}
+		i++
+		for i < len(items) && items[i].marker != marker && !contains(levels, items[i].marker) {
+			var nested string
+			nested, i = a.renderList(items, i, levels)
+			out.WriteString("\n" + nested)
+		}
+		out.WriteString("</li>\n")
+	}
+	out.WriteString("</" + tag + ">\n")
+	return out.String(), i
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// descriptionItem parses a "term:: definition" line
+func descriptionItem(line string) []string {
+	trimmed := strings.TrimSpace(line)
+	term, definition, ok := strings.Cut(trimmed, "::")
+	if !ok || strings.TrimSpace(term) == "" || strings.Contains(term, "://") || strings.HasPrefix(trimmed, "image") {
+		return nil
+	}
+	if definition != "" && definition[0] != ' ' {
+		return nil
+	}
+	return []string{strings.TrimSpace(term), strings.TrimSpace(definition)}
+}
+
+func (a *asciidoc) descriptionList(lines []string, i int, out *strings.Builder) int {
+	out.WriteString("<dl>\n")
+	var definition []string
+	flush := func() {
+		if len(definition) > 0 {
+			out.WriteString("<dd>" + a.inline(strings.Join(definition, "\n")) + "</dd>\n")
+		}
+		definition = nil
+	}
+	for i < len(lines) {
+		if entry := descriptionItem(lines[i]); entry != nil {
+			flush()
+			out.WriteString("<dt>" + a.inline(entry[0]) + "</dt>\n")
+			if entry[1] != "" {
+				definition = append(definition, entry[1])
+			}
+			i++
+			continue
+		}
+		if blank(lines[i]) {
+			next := i
+			for next < len(lines) && blank(lines[next]) {
+				next++
+			}
+			if next < len(lines) && descriptionItem(lines[next]) != nil {
+				i = next
+				continue
+			}
+			break
+		}
+		if delimiter(strings.TrimSpace(lines[i])) != "" || adocListItem(lines[i]) != nil {
+			break
+		}
+		definition = append(definition, strings.TrimSpace(lines[i]))
+		i++
+	}
+	flush()
+	out.WriteString("</dl>\n")
+	return i
+}
+
+// columns counts the columns a cols attribute such as "1,2" or "3*" sets
+func columns(cols string) int {
+	count := 0
+	for _, spec := range strings.Split(cols, ",") {
+		if repeat, _, ok := strings.Cut(spec, "*"); ok {
+			if n, err := strconv.Atoi(strings.TrimSpace(repeat)); err == nil && n > 0 {
+				count += n
+				continue
+			}
+		}
+		count++
+	}
+	return count
+}
+
+// table renders the lines between |=== delimiters
+func (a *asciidoc) table(lines []string, meta blockMeta) string {
+	// Cells start at unescaped pipes; a blank line after the first line
+	// makes it the header
+	var cells []string
+	var cell strings.Builder
+	inCell := false
+	firstRowCells := 0
+	implicitHeader := len(lines) > 1 && !blank(lines[0]) && blank(lines[1])
+	for n, line := range lines {
+		if blank(line) {
+			if inCell {
+				cell.WriteString("\n")
+			}
+			continue
+		}
+		for i := 0; i < len(line); i++ {
+			switch {
+			case line[i] == '\\' && i+1 < len(line) && line[i+1] == '|':
+				cell.WriteByte('|')
+				i++
+			case line[i] == '|':
+				if inCell {
+					cells = append(cells, strings.TrimSpace(cell.String()))
+				}
+				cell.Reset()
+				inCell = true
+			default:
+				if inCell {
+					cell.WriteByte(line[i])
+				}
+			}
+		}
+		if inCell {
+			cell.WriteString("\n")
+		}
+		if n == 0 && inCell {
+			firstRowCells = strings.Count(strings.ReplaceAll(line, `\|`, ""), "|")
+		}
+	}
+	if inCell {
+		cells = append(cells, strings.TrimSpace(cell.String()))
+	}
+
+	cols := firstRowCells
+	if spec, ok := meta.named["cols"]; ok {
+		cols = columns(spec)
+	}
+	if cols <= 0 {
+		cols = max(len(cells), 1)
+	}
+	var rows [][]string
+	for start := 0; start < len(cells); start += cols {
+		row := make([]string, cols)
+		copy(row, cells[start:min(start+cols, len(cells))])
+		rows = append(rows, row)
+	}
+
+	var out strings.Builder
+	out.WriteString("<table>\n")
+	if meta.title != "" {
+		out.WriteString("<caption>" + a.inline(meta.title) + "</caption>\n")
+	}
+	writeRow := func(row []string, tag string) {
+		out.WriteString("<tr>")
+		for _, content := range row {
+			out.WriteString("<" + tag + ">" + a.inline(content) + "</" + tag + ">")
+		}
+		out.WriteString("</tr>\n")
+	}
+	if len(rows) > 0 && (implicitHeader || meta.options["header"]) && !meta.options["noheader"] {
+		out.WriteString("<thead>\n")
+		writeRow(rows[0], "th")
+		out.WriteString("</thead>\n")
+		rows = rows[1:]
+	}
+	if len(rows) > 0 {
+		out.WriteString("<tbody>\n")
+		for _, row := range rows {
+			writeRow(row, "td")
+		}
+		out.WriteString("</tbody>\n")
+	}
+	out.WriteString("</table>\n")
+	return out.String()
+}
+
+// substitute replaces {attribute} references
+func (a *asciidoc) substitute(s string) string {
+	if !strings.Contains(s, "{") {
+		return s
+	}
+	var out strings.Builder
+	for {
+		open := strings.IndexByte(s, '{')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(s[open:], '}')
+		if end < 0 {
+			break
+		}
+		name := strings.ToLower(s[open+1 : open+end])
+		value, ok := a.attributes[name]
+		if !ok {
+			value, ok = builtinAttributes[name]
+		}
+		out.WriteString(s[:open])
+		if ok {
+			out.WriteString(value)
+		} else {
+			out.WriteString(s[open : open+end+1])
+		}
+		s = s[open+end+1:]
+	}
+	out.WriteString(s)
+	return out.String()
+}
+
+// constrained reports whether the mark c at s[i] opens constrained
+// formatting such as *bold*, returning where its closing mark is
+func constrained(scan *scanner, i int, c byte) (int, bool) {
+	s := scan.s
+	if i > 0 && (isWord(s[i-1]) || s[i-1] == c) || i+1 >= len(s) || isSpace(s[i+1]) || s[i+1] == c {
+		return 0, false
+	}
+	kind := string(c)
+	if !scan.mayClose(kind, i) {
+		return 0, false
+	}
+	for j := i + 1; j < len(s); j++ {
+		if s[j] == c && !isSpace(s[j-1]) && (j+1 == len(s) || !isWord(s[j+1]) && s[j+1] != c) {
+			return j, true
+		}
+	}
+	scan.unclose(kind, i)
+	return 0, false
+}
+
+// inlineTags are the tags AsciiDoc formatting marks render as
+var inlineTags = map[byte]string{
+	'*': "strong",
+	'_': "em",
+	'`': "code",
+	'#': "mark",
+}
+
+// macroPrefixes start the inline link and image macros
+var macroPrefixes = []string{"https://", "http://", "mailto:", "link:", "xref:", "image:", "nostr:"}
+
+func (a *asciidoc) inline(s string) string {
+	s = a.substitute(s)
+	var out strings.Builder
+	scan := newScanner(s)
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("*_`#^~[]{}<+\\", s[i+1]) >= 0:
+			out.WriteString(escape(s[i+1 : i+2]))
+			i += 2
+			continue
+		case c == ' ' && strings.HasPrefix(s[i:], " +") && (i+2 == len(s) || s[i+2] == '\n'):
+			out.WriteString("<br/>")
+			i += 2
+			continue
+		case c == '+':
+			// Passthrough: shown as written, without formatting
+			if strings.HasPrefix(s[i:], "++") {
+				if end := scan.index(i+2, "++"); end > i+2 {
+					out.WriteString(escape(s[i+2 : end]))
+					i = end + 2
+					continue
+				}
+			} else if end, ok := constrained(scan, i, '+'); ok {
+				out.WriteString(escape(s[i+1 : end]))
+				i = end + 1
+				continue
+			}
+		case inlineTags[c] != "":
+			tag := inlineTags[c]
+			if i+1 < len(s) && s[i+1] == c {
+				// Unconstrained **bold** works mid-word
+				if end := scan.index(i+2, string([]byte{c, c})); end > i+2 {
+					out.WriteString("<" + tag + ">" + a.inline(s[i+2:end]) + "</" + tag + ">")
+					i = end + 2
+					continue
+				}
+			} else if end, ok := constrained(scan, i, c); ok {
+				out.WriteString("<" + tag + ">" + a.inline(s[i+1:end]) + "</" + tag + ">")
+				i = end + 1
+				continue
+			}
+		case c == '^' || c == '~':
+			if end := scan.index(i+1, string(c)); end > i+1 && !strings.ContainsAny(s[i+1:end], " \n") {
+				tag := "sup"
+				if c == '~' {
+					tag = "sub"
+				}
+				out.WriteString("<" + tag + ">" + a.inline(s[i+1:end]) + "</" + tag + ">")
+				i = end + 1
+				continue
+			}
+		case c == '[' && strings.HasPrefix(s[i:], "[["):
+			if end := scan.index(i+2, "]]"); end > i+2 && !lineBreakBefore(scan, i+2, end) {
+				out.WriteString(a.opts.wikilink(s[i+2 : end]))
+				i = end + 2
+				continue
+			}
+		case c == '<' && strings.HasPrefix(s[i:], "<<"):
+			if end := scan.index(i+2, ">>"); end > i+2 {
+				target, label, _ := strings.Cut(s[i+2:end], ",")
+				out.WriteString(a.xref(strings.TrimSpace(target), strings.TrimSpace(label)))
+				i = end + 2
+				continue
+			}
+		case i == 0 || !isWord(s[i-1]):
+			if rendered, next, ok := a.macro(scan, i); ok {
+				out.WriteString(rendered)
+				i = next
+				continue
+			}
+		}
+		out.WriteString(escape(s[i : i+1]))
+		i++
+	}
+	return out.String()
+}
+
+// macro renders a URL, link:, mailto:, xref: or image: macro at s[i]
+func (a *asciidoc) macro(scan *scanner, i int) (string, int, bool) {
+	s := scan.s
+	prefix := ""
+	for _, p := range macroPrefixes {
+		if strings.HasPrefix(s[i:], p) {
+			prefix = p
+			break
+		}
+	}
+	if prefix == "" {
+		return "", 0, false
+	}
+	rest := s[i:]
+	end := scan.indexAny(i, " \n[") - i
+	if end < 0 {
+		end = len(rest)
+	}
+	target := rest[:end]
+	hasLabel := end < len(rest) && rest[end] == '['
+	label := ""
+	next := i + end
+	if hasLabel {
+		close := scan.index(i+end, "]") - i - end
+		if close < 0 {
+			return "", 0, false
+		}
+		label = rest[end+1 : end+close]
+		next = i + end + close + 1
+	} else if prefix != "https://" && prefix != "http://" && prefix != "nostr:" {
+		// Other macros need their brackets
+		return "", 0, false
+	} else {
+		target = bareURL(target)
+		next = i + len(target)
+	}
+
+	switch prefix {
+	case "image:":
+		alt, _, _ := strings.Cut(label, ",")
+		return image(strings.TrimPrefix(target, prefix), strings.Trim(alt, `"`)), next, true
+	case "xref:":
+		return a.xref(strings.TrimPrefix(target, prefix), label), next, true
+	case "link:":
+		target = strings.TrimPrefix(target, prefix)
+	}
+	display := escape(strings.TrimPrefix(target, "mailto:"))
+	if label != "" {
+		text, _, _ := strings.Cut(label, ",")
+		display = a.inline(strings.Trim(text, `"`))
+	}
+	return link(target, display), next, true
+}
+
+// xref renders a cross reference. Targets naming another section resolve
+// like wikilinks; the rest point at an ID in this one.
+func (a *asciidoc) xref(target, label string) string {
+	target = strings.TrimSuffix(target, ".adoc")
+	if document, fragment, ok := strings.Cut(target, "#"); ok && document == "" {
+		target = fragment
+	}
+	if label == "" {
+		label = target
+	}
+	if a.opts.Wikilinks != nil {
+		if href, ok := a.opts.Wikilinks(target); ok {
+			return `<a class="wikilink" href="` + escape(href) + `">` + a.inline(label) + `</a>`
+		}
+	}
+	return `<a href="#` + escape(target) + `">` + a.inline(label) + `</a>`
+}
@@ -0,0 +1,713 @@
+package render
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Markdown renders CommonMark-style Markdown with GitHub tables,
+// strikethrough and bare URL links
+func Markdown(source string, opts Options) string {
+	m := &markdown{opts: opts}
+	return strings.TrimSuffix(m.blocks(strings.Split(normalize(source), "\n")), "\n")
+}
+
+type markdown struct {
+	opts  Options
+	tight bool // rendering a tight list item, whose paragraphs lose <p>
+}
+
+func (m *markdown) blocks(lines []string) string {
+	var out strings.Builder
+	for i := 0; i < len(lines); {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			i++
+			continue
+		}
+		if _, _, ok := codeFence(line); ok {
+			i = m.fencedCode(lines, i, &out)
+			continue
+		}
+		if indent(line) >= 4 {
+			i = m.indentedCode(lines, i, &out)
+			continue
+		}
+		if level, text, ok := atxHeading(trimmed); ok {
+			out.WriteString("<h" + strconv.Itoa(level) + ">" + m.inline(text) + "</h" + strconv.Itoa(level) + ">\n")
+			i++
+			continue
+		}
+		if thematicBreak(trimmed) {
+			out.WriteString("<hr/>\n")
+			i++
+			continue
+		}
+		if strings.HasPrefix(trimmed, ">") {
+			i = m.blockquote(lines, i, &out)
+			continue
+		}
+		if _, ok := listMarker(line); ok {
+			i = m.list(lines, i, &out)
+			continue
+		}
+		if i+1 < len(lines) && strings.Contains(line, "|") && tableDelimiter(lines[i+1]) != nil {
+			if next, ok := m.table(lines, i, &out); ok {
+				i = next
+				continue
+			}
+		}
+		i = m.paragraph(lines, i, &out)
+	}
+	return out.String()
+}
+
+// interrupts reports whether line starts a block that ends a paragraph
+func (m *markdown) interrupts(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	if trimmed == "" || thematicBreak(trimmed) || strings.HasPrefix(trimmed, ">") {
+		return true
+	}
+	if _, _, ok := codeFence(line); ok {
+		return true
+	}
+	if _, _, ok := atxHeading(trimmed); ok {
+		return true
+	}
+	// Only lists starting at 1 may interrupt a paragraph
+	if marker, ok := listMarker(line); ok && (!marker.ordered || marker.start == 1) {
+		return true
+	}
+	return false
+}
+
+func (m *markdown) paragraph(lines []string, i int, out *strings.Builder) int {
+	var text []string
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if len(text) > 0 && indent(lines[i]) < 4 {
+			// Setext headings underline their text
+			if level := setextLevel(trimmed); level > 0 {
+				tag := "h" + strconv.Itoa(level)
+				out.WriteString("<" + tag + ">" + m.inline(strings.Join(text, "\n")) + "</" + tag + ">\n")
+				return i + 1
+			}
+			if m.interrupts(lines[i]) {
+				break
+			}
+		}
+		if trimmed == "" {
+			break
+		}
+		text = append(text, strings.TrimLeft(lines[i], " "))
+	}
+	content := m.inline(strings.TrimRight(strings.Join(text, "\n"), " "))
+	if m.tight {
+		out.WriteString(content + "\n")
+	} else {
+		out.WriteString("<p>" + content + "</p>\n")
+	}
+	return i
+}
+
+func setextLevel(trimmed string) int {
+	if trimmed == "" {
+		return 0
+	}
+	if strings.Trim(trimmed, "=") == "" {
+		return 1
+	}
+	if strings.Trim(trimmed, "-") == "" {
+		return 2
+	}
+	return 0
+}
+
+// atxHeading parses "## Heading ##"
+func atxHeading(trimmed string) (int, string, bool) {
+	level := 0
+	for level < len(trimmed) && trimmed[level] == '#' {
+		level++
+	}
+	if level == 0 || level > 6 || (level < len(trimmed) && trimmed[level] != ' ') {
+		return 0, "", false
+	}
+	text := strings.TrimSpace(trimmed[level:])
+	if closing := strings.TrimRight(text, "#"); closing == "" || strings.HasSuffix(closing, " ") {
+		text = strings.TrimSpace(closing)
+	}
+	return level, text, true
+}
+
+// thematicBreak reports whether trimmed is three or more of -, * or _
+func thematicBreak(trimmed string) bool {
+	if len(trimmed) < 3 || !strings.ContainsRune("-*_", rune(trimmed[0])) {
+		return false
+	}
+	count := 0
+	for i := 0; i < len(trimmed); i++ {
+		switch trimmed[i] {
+		case trimmed[0]:
+			count++
+		case ' ':
+		default:
+			return false
+		}
+	}
+	return count >= 3
+}
+
+// codeFence parses an opening ``` or ~~~ fence, returning the fence and
+// the language of its info string
+func codeFence(line string) (string, string, bool) {
+	if indent(line) > 3 {
+		return "", "", false
+	}
+	trimmed := strings.TrimSpace(line)
+	if len(trimmed) < 3 || (trimmed[0] != '`' && trimmed[0] != '~') {
+		return "", "", false
+	}
+	n := 0
+	for n < len(trimmed) && trimmed[n] == trimmed[0] {
+		n++
+	}
+	if n < 3 {
+		return "", "", false
+	}
+	info := strings.TrimSpace(trimmed[n:])
+	if trimmed[0] == '`' && strings.Contains(info, "`") {
+		return "", "", false
+	}
+	lang, _, _ := strings.Cut(info, " ")
+	return trimmed[:n], lang, true
+}
+
+func (m *markdown) fencedCode(lines []string, i int, out *strings.Builder) int {
+	fence, lang, _ := codeFence(lines[i])
+	offset := indent(lines[i])
+	var code []string
+	for i++; i < len(lines); i++ {
+		trimmed := strings.TrimSpace(lines[i])
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			i++
+			break
+		}
+		line := lines[i]
+		line = line[min(offset, indent(line)):]
+		code = append(code, line)
+	}
+	out.WriteString(codeBlock(strings.Join(code, "\n"), lang))
+	return i
+}
+
+func (m *markdown) indentedCode(lines []string, i int, out *strings.Builder) int {
+	var code []string
+	for ; i < len(lines) && (indent(lines[i]) >= 4 || blank(lines[i])); i++ {
+		code = append(code, lines[i][min(4, len(lines[i])):])
+	}
+	for len(code) > 0 && blank(code[len(code)-1]) {
+		code = code[:len(code)-1]
+	}
+	out.WriteString(codeBlock(strings.Join(code, "\n"), ""))
+	return i
+}
+
+// codeBlock renders preformatted code, marked with its language if known
+func codeBlock(code, lang string) string {
+	class := ""
+	if lang != "" {
+		class = ` class="language-` + escape(lang) + `"`
+	}
+	return "<pre><code" + class + ">" + escape(code) + "</code></pre>\n"
+}
+
+func (m *markdown) blockquote(lines []string, i int, out *strings.Builder) int {
+	var quoted []string
+	for ; i < len(lines); i++ {
+		trimmed := strings.TrimLeft(lines[i], " ")
+		if strings.HasPrefix(trimmed, ">") {
+			trimmed = strings.TrimPrefix(trimmed[1:], " ")
+			quoted = append(quoted, trimmed)
+			continue
+		}
+		// Lazy continuation of a quoted paragraph
+		if len(quoted) > 0 && !blank(quoted[len(quoted)-1]) && !m.interrupts(lines[i]) {
+			quoted = append(quoted, trimmed)
+			continue
+		}
+		break
+	}
+	tight := m.tight
+	m.tight = false
+	out.WriteString("<blockquote>\n" + m.blocks(quoted) + "</blockquote>\n")
+	m.tight = tight
+	return i
+}
+
+type marker struct {
+	ordered bool
+	bullet  byte // -, * or + for bullet lists; . or ) for ordered ones
+	start   int
+	offset  int // where the item's content starts
+}
+
+// listMarker parses a bullet ("- ", "* ", "+ ") or ordered ("1. ", "1) ")
+// list item marker
+func listMarker(line string) (marker, bool) {
+	pos := indent(line)
+	if pos > 3 || pos >= len(line) {
+		return marker{}, false
+	}
+	var mk marker
+	switch c := line[pos]; {
+	case c == '-' || c == '*' || c == '+':
+		mk.bullet = c
+		pos++
+	case c >= '0' && c <= '9':
+		end := pos
+		for end < len(line) && end-pos < 9 && line[end] >= '0' && line[end] <= '9' {
+			end++
+		}
+		if end >= len(line) || (line[end] != '.' && line[end] != ')') {
+			return marker{}, false
+		}
+		mk.ordered = true
+		mk.bullet = line[end]
+		mk.start, _ = strconv.Atoi(line[pos:end])
+		pos = end + 1
+	default:
+		return marker{}, false
+	}
+	if pos < len(line) && line[pos] != ' ' {
+		return marker{}, false
+	}
+	if !mk.ordered && thematicBreak(strings.TrimSpace(line)) {
+		return marker{}, false
+	}
+	spaces := indent(line[pos:])
+	if spaces == 0 || spaces > 4 || pos+spaces == len(line) {
+		spaces = 1
+	}
+	mk.offset = pos + spaces
+	return mk, true
+}
+
+func (m *markdown) list(lines []string, i int, out *strings.Builder) int {
+	first, _ := listMarker(lines[i])
+	var items [][]string
+	offset := 0
+	loose := false
+	for i < len(lines) {
+		line := lines[i]
+		if mk, ok := listMarker(line); ok && (len(items) == 0 || indent(line) < offset) {
+			if mk.ordered != first.ordered || mk.bullet != first.bullet {
+				break
+			}
+			if len(items) > 0 && blank(items[len(items)-1][len(items[len(items)-1])-1]) {
+				loose = true
+			}
+			offset = mk.offset
+			content := ""
+			if mk.offset < len(line) {
+				content = line[mk.offset:]
+			}
+			items = append(items, []string{content})
+			i++
+			continue
+		}
+		item := items[len(items)-1]
+		if blank(line) {
+			items[len(items)-1] = append(item, "")
+			i++
+			continue
+		}
+		if indent(line) >= offset {
+			if blank(item[len(item)-1]) {
+				loose = loose || hasContent(item)
+			}
+			items[len(items)-1] = append(item, line[offset:])
+			i++
+			continue
+		}
+		// Lazy continuation of the item's last paragraph
+		if !blank(item[len(item)-1]) && !m.interrupts(line) {
+			items[len(items)-1] = append(item, strings.TrimLeft(line, " "))
+			i++
+			continue
+		}
+		break
+	}
+
+	tag := "ul"
+	open := "<ul>"
+	if first.ordered {
+		tag = "ol"
+		open = "<ol>"
+		if first.start != 1 {
+			open = `<ol start="` + strconv.Itoa(first.start) + `">`
+		}
+	}
+	tight := m.tight
+	m.tight = !loose
+	out.WriteString(open + "\n")
+	for _, item := range items {
+		for len(item) > 0 && blank(item[len(item)-1]) {
+			item = item[:len(item)-1]
+		}
+		out.WriteString("<li>" + strings.TrimSuffix(m.blocks(item), "\n") + "</li>\n")
+	}
+	out.WriteString("</" + tag + ">\n")
+	m.tight = tight
+	return i
+}
+
+// hasContent reports whether an item's lines hold text before a blank line,
+// making a later block inside it separate and the list loose
+func hasContent(item []string) bool {
+	for _, line := range item {
+		if !blank(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// tableDelimiter parses a table's delimiter row ("| --- | :-: |") into
+// the alignment of each column
+func tableDelimiter(line string) []string {
+	trimmed := strings.TrimSpace(line)
+	if !strings.Contains(trimmed, "-") {
+		return nil
+	}
+	cells := splitRow(trimmed)
+	aligns := make([]string, len(cells))
+	for i, cell := range cells {
+		cell = strings.TrimSpace(cell)
+		left, right := strings.HasPrefix(cell, ":"), strings.HasSuffix(cell, ":")
+		if strings.Trim(cell, ":") == "" || strings.Trim(strings.Trim(cell, ":"), "-") != "" {
+			return nil
+		}
+		switch {
+		case left && right:
+			aligns[i] = "center"
+		case left:
+			aligns[i] = "left"
+		case right:
+			aligns[i] = "right"
+		}
+	}
+	return aligns
+}
+
+// splitRow splits a table row on pipes that aren't escaped or in code
+func splitRow(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(row, "|")
+	if strings.HasSuffix(row, "|") && !strings.HasSuffix(row, `\|`) {
+		row = row[:len(row)-1]
+	}
+	var cells []string
+	var cell strings.Builder
+	code := false
+	for i := 0; i < len(row); i++ {
+		switch {
+		case row[i] == '\\' && i+1 < len(row) && row[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case row[i] == '`':
+			code = !code
+			cell.WriteByte('`')
+		case row[i] == '|' && !code:
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(row[i])
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+func (m *markdown) table(lines []string, i int, out *strings.Builder) (int, bool) {
+	header := splitRow(lines[i])
+	aligns := tableDelimiter(lines[i+1])
+	if len(header) != len(aligns) {
+		return i, false
+	}
+	row := func(cells []string, tag string) {
+		out.WriteString("<tr>")
+		for c, align := range aligns {
+			content := ""
+			if c < len(cells) {
+				content = m.inline(cells[c])
+			}
+			out.WriteString("<" + tag + alignStyle(align) + ">" + content + "</" + tag + ">")
+		}
+		out.WriteString("</tr>\n")
+	}
+	out.WriteString("<table>\n<thead>\n")
+	row(header, "th")
+	out.WriteString("</thead>\n<tbody>\n")
+	for i += 2; i < len(lines) && !blank(lines[i]) && !m.interrupts(lines[i]); i++ {
+		row(splitRow(lines[i]), "td")
+	}
+	out.WriteString("</tbody>\n</table>\n")
+	return i, true
+}
+
+func isPunct(c byte) bool {
+	return strings.IndexByte("!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~", c) >= 0
+}
+
+func (m *markdown) inline(s string) string {
+	var out strings.Builder
+	scan := newScanner(s)
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && isPunct(s[i+1]):
+			out.WriteString(escape(s[i+1 : i+2]))
+			i += 2
+			continue
+		case c == '\\' && i+1 < len(s) && s[i+1] == '\n':
+			out.WriteString("<br/>\n")
+			i += 2
+			continue
+		case c == ' ' && strings.HasPrefix(strings.TrimLeft(s[i:], " "), "\n"):
+			// Two trailing spaces break the line
+			spaces := len(s[i:]) - len(strings.TrimLeft(s[i:], " "))
+			if spaces >= 2 {
+				out.WriteString("<br/>")
+			}
+			i += spaces
+			continue
+		case c == '`':
+			if code, next, ok := codeSpan(s, i); ok {
+				out.WriteString("<code>" + escape(code) + "</code>")
+				i = next
+				continue
+			}
+			n := runLength(s, i)
+			out.WriteString(s[i : i+n])
+			i += n
+			continue
+		case c == '!' && i+1 < len(s) && s[i+1] == '[':
+			if label, dest, next, ok := linkParts(scan, i+1); ok {
+				out.WriteString(image(dest, label))
+				i = next
+				continue
+			}
+		case c == '[' && strings.HasPrefix(s[i:], "[[") && scan.index(i+2, "]]") >= 0:
+			end := scan.index(i+2, "]]")
+			if inner := s[i+2 : end]; inner != "" && !lineBreakBefore(scan, i+2, end) {
+				out.WriteString(m.opts.wikilink(inner))
+				i = end + 2
+				continue
+			}
+		case c == '[':
+			if label, dest, next, ok := linkParts(scan, i); ok {
+				out.WriteString(link(dest, m.inline(label)))
+				i = next
+				continue
+			}
+		case c == '<':
+			if end := scan.index(i, ">"); end > i {
+				target := s[i+1 : end]
+				if !strings.ContainsAny(target, " \n<") && strings.Contains(target, ":") {
+					out.WriteString(link(target, escape(target)))
+					i = end + 1
+					continue
+				}
+			}
+		case c == 'h' && (i == 0 || !isWord(s[i-1])) && (strings.HasPrefix(s[i:], "https://") || strings.HasPrefix(s[i:], "http://")):
+			target := bareURL(s[i:])
+			out.WriteString(link(target, escape(target)))
+			i += len(target)
+			continue
+		case c == '*' || c == '_' || c == '~':
+			if rendered, next, ok := m.emphasis(scan, i); ok {
+				out.WriteString(rendered)
+				i = next
+				continue
+			}
+			n := runLength(s, i)
+			out.WriteString(s[i : i+n])
+			i += n
+			continue
+		}
+		out.WriteString(escape(s[i : i+1]))
+		i++
+	}
+	return out.String()
+}
+
+// runLength counts the repeats of the character at s[i]
+func runLength(s string, i int) int {
+	n := 1
+	for i+n < len(s) && s[i+n] == s[i] {
+		n++
+	}
+	return n
+}
+
+// codeSpan parses a `code` span starting at s[i]
+func codeSpan(s string, i int) (string, int, bool) {
+	n := runLength(s, i)
+	for j := i + n; j < len(s); {
+		if s[j] != '`' {
+			j++
+			continue
+		}
+		r := runLength(s, j)
+		if r == n {
+			code := strings.ReplaceAll(s[i+n:j], "\n", " ")
+			if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+				code = code[1 : len(code)-1]
+			}
+			return code, j + r, true
+		}
+		j += r
+	}
+	return "", 0, false
+}
+
+// matchBrackets finds the ] closing each [ in s, skipping nested brackets,
+// escapes and code spans, and the ) closing each (, skipping escapes. Each
+// takes one pass, so links parse in linear time however many openers are
+// left unclosed.
+func matchBrackets(s string) []int {
+	closers := make([]int, len(s))
+	for j := range closers {
+		closers[j] = -1
+	}
+	var open []int
+	for j := 0; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '`':
+			if _, next, ok := codeSpan(s, j); ok {
+				j = next - 1
+			}
+		case '[':
+			open = append(open, j)
+		case ']':
+			if len(open) > 0 {
+				closers[open[len(open)-1]] = j
+				open = open[:len(open)-1]
+			}
+		}
+	}
+	open = open[:0]
+	for j := 0; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case '(':
+			open = append(open, j)
+		case ')':
+			if len(open) > 0 {
+				closers[open[len(open)-1]] = j
+				open = open[:len(open)-1]
+			}
+		}
+	}
+	return closers
+}
+
+// linkParts parses [label](destination "title") starting at s[i]
+func linkParts(scan *scanner, i int) (string, string, int, bool) {
+	if scan.closers == nil {
+		scan.closers = matchBrackets(scan.s)
+	}
+	s := scan.s
+	end := scan.closers[i]
+	if end < 0 || end+1 >= len(s) || s[end+1] != '(' {
+		return "", "", 0, false
+	}
+	j := scan.closers[end+1]
+	if j < 0 {
+		return "", "", 0, false
+	}
+	dest := strings.TrimSpace(s[end+2 : j])
+	if strings.HasPrefix(dest, "<") {
+		if close := strings.IndexByte(dest, '>'); close > 0 {
+			dest = dest[1:close]
+		}
+	} else if space := strings.IndexAny(dest, " \n"); space >= 0 {
+		dest = dest[:space] // drop the title
+	}
+	return s[i+1 : end], dest, j + 1, true
+}
+
+// bareURL takes a URL up to whitespace, leaving out trailing punctuation
+func bareURL(s string) string {
+	end := strings.IndexAny(s, " \n<")
+	if end < 0 {
+		end = len(s)
+	}
+	u := s[:end]
+	for len(u) > 0 && strings.IndexByte(".,;:!?*_~'\"", u[len(u)-1]) >= 0 {
+		u = u[:len(u)-1]
+	}
+	// A closing parenthesis belongs to the URL only if it opened one
+	for strings.HasSuffix(u, ")") && strings.Count(u, ")") > strings.Count(u, "(") {
+		u = u[:len(u)-1]
+	}
+	return u
+}
+
+// emphasis renders *em*, **strong**, ***both*** (or with _) and ~~del~~
+// starting at s[i]
+func (m *markdown) emphasis(scan *scanner, i int) (string, int, bool) {
+	s := scan.s
+	c := s[i]
+	n := min(runLength(s, i), 3)
+	if c == '~' && n != 2 {
+		return "", 0, false
+	}
+	if i+n >= len(s) || isSpace(s[i+n]) {
+		return "", 0, false
+	}
+	if c == '_' && i > 0 && isWord(s[i-1]) {
+		return "", 0, false
+	}
+	kind := s[i : i+n]
+	if !scan.mayClose(kind, i) {
+		return "", 0, false
+	}
+	for j := i + n; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+			continue
+		case '`':
+			if _, next, ok := codeSpan(s, j); ok {
+				j = next - 1
+			}
+			continue
+		case c:
+		default:
+			continue
+		}
+		r := runLength(s, j)
+		if r == n && !isSpace(s[j-1]) && (c != '_' || j+n >= len(s) || !isWord(s[j+n])) {
+			inner := m.inline(s[i+n : j])
+			var rendered string
+			switch {
+			case c == '~':
+				rendered = "<del>" + inner + "</del>"
+			case n == 1:
+				rendered = "<em>" + inner + "</em>"
+			case n == 2:
+				rendered = "<strong>" + inner + "</strong>"
+			default:
+				rendered = "<strong><em>" + inner + "</em></strong>"
+			}
+			return rendered, j + n, true
+		}
+		j += r - 1
+	}
+	scan.unclose(kind, i)
+	return "", 0, false
+}
@@ -0,0 +1,225 @@
+// Package render turns the Markdown and AsciiDoc of publication content into
+// well-formed XHTML for the ebook content endpoint and EPUB files. It covers
+// the common block and inline syntax of both, including code blocks, lists
+// and tables, plus [[wikilinks]] to other sections. Raw HTML in the source is
+// escaped, never passed through.
+package render
+
+import (
+	"html"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// Source formats
+const (
+	FormatAsciiDoc = "asciidoc"
+	FormatMarkdown = "markdown"
+	FormatText     = "text"
+)
+
+// Resolver returns the href of the section a wikilink target names, and
+// false for targets it doesn't know
+type Resolver func(target string) (string, bool)
+
+// Options tune rendering
+type Options struct {
+	// Wikilinks resolves [[target]] and [[target|label]] links. Links it
+	// can't resolve, or all of them when nil, render as their label.
+	Wikilinks Resolver
+}
+
+// HTML renders source in format. Unknown formats render as plain text.
+func HTML(source, format string, opts Options) string {
+	switch strings.ToLower(format) {
+	case FormatAsciiDoc, "adoc", "":
+		return AsciiDoc(source, opts)
+	case FormatMarkdown, "md":
+		return Markdown(source, opts)
+	default:
+		return Text(source)
+	}
+}
+
+// Text renders plain text, a paragraph per blank-line separated block
+func Text(source string) string {
+	var out strings.Builder
+	for _, block := range strings.Split(normalize(source), "\n\n") {
+		if block = strings.TrimSpace(block); block != "" {
+			out.WriteString("<p>" + strings.ReplaceAll(escape(block), "\n", "<br/>\n") + "</p>\n")
+		}
+	}
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+// Slug normalizes a wikilink target or section identifier for comparison:
+// lower case, with each run of other characters than letters and digits
+// turned into a single hyphen
+func Slug(s string) string {
+	var b strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if hyphen && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			hyphen = false
+			b.WriteRune(r)
+		} else {
+			hyphen = true
+		}
+	}
+	return b.String()
+}
+
+func normalize(source string) string {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	return strings.ReplaceAll(source, "\t", "    ")
+}
+
+func escape(s string) string {
+	return html.EscapeString(s)
+}
+
+// safeURL returns u when it is a link worth following: http(s), mailto and
+// nostr URIs, or a relative reference. Anything else, such as javascript:,
+// is refused.
+func safeURL(u string) (string, bool) {
+	u = strings.TrimSpace(u)
+	if u == "" {
+		return "", false
+	}
+	parsed, err := url.Parse(u)
+	if err != nil {
+		return "", false
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "", "http", "https", "mailto", "nostr":
+		return u, true
+	}
+	return "", false
+}
+
+// link renders an anchor around already rendered label
+func link(href, label string) string {
+	href, ok := safeURL(href)
+	if !ok {
+		return label
+	}
+	return `<a href="` + escape(href) + `">` + label + `</a>`
+}
+
+func image(src, alt string) string {
+	src, ok := safeURL(src)
+	if !ok {
+		return escape(alt)
+	}
+	return `<img src="` + escape(src) + `" alt="` + escape(alt) + `"/>`
+}
+
+// wikilink renders the contents of a [[...]] link
+func (o Options) wikilink(inner string) string {
+	target, label, found := strings.Cut(inner, "|")
+	target = strings.TrimSpace(target)
+	if !found {
+		label = target
+	}
+	label = strings.TrimSpace(label)
+	if o.Wikilinks != nil {
+		if href, ok := o.Wikilinks(target); ok {
+			return `<a class="wikilink" href="` + escape(href) + `">` + escape(label) + `</a>`
+		}
+	}
+	return `<span class="wikilink">` + escape(label) + `</span>`
+}
+
+// isWord reports whether r may be part of a word for emphasis boundaries
+func isWord(r byte) bool {
+	return r == '_' || r >= '0' && r <= '9' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= 0x80
+}
+
+func isSpace(r byte) bool {
+	return r == ' ' || r == '\n' || r == '\t'
+}
+
+// indent counts a line's leading spaces
+func indent(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " "))
+}
+
+// blank reports whether line has only whitespace
+func blank(line string) bool {
+	return strings.TrimSpace(line) == ""
+}
+
+// alignStyle renders a table cell alignment as an attribute
+func alignStyle(align string) string {
+	if align == "" {
+		return ""
+	}
+	return ` style="text-align: ` + align + `"`
+}
+
+// scanner remembers the lookups the inline parsers make on one run of text.
+// Openers are tried left to right, and without it every unclosed [, *, link:
+// and the like would scan the rest of the run again, which is quadratic in
+// the length of a section.
+type scanner struct {
+	s string
+	// Per separator, the last position searched from and where the
+	// separator was found, -1 for nowhere
+	found map[string][2]int
+	// Per kind of opener, the first position from which no closer was found
+	unclosed map[string]int
+	// The ] or ) matching each [ and ( in Markdown, see matchBrackets
+	closers []int
+}
+
+func newScanner(s string) *scanner {
+	return &scanner{s: s, found: make(map[string][2]int), unclosed: make(map[string]int)}
+}
+
+// index returns the position of the first sep at or after i, or -1
+func (sc *scanner) index(i int, sep string) int {
+	return sc.search(i, sep, func(s string) int { return strings.Index(s, sep) })
+}
+
+// indexAny returns the position of the first of chars at or after i, or -1
+func (sc *scanner) indexAny(i int, chars string) int {
+	return sc.search(i, "any:"+chars, func(s string) int { return strings.IndexAny(s, chars) })
+}
+
+func (sc *scanner) search(i int, key string, find func(string) int) int {
+	if last, ok := sc.found[key]; ok && i >= last[0] && (last[1] < 0 || i <= last[1]) {
+		return last[1]
+	}
+	at := -1
+	if i <= len(sc.s) {
+		if at = find(sc.s[i:]); at >= 0 {
+			at += i
+		}
+	}
+	sc.found[key] = [2]int{i, at}
+	return at
+}
+
+// lineBreakBefore reports whether s[i:end] spans a line break
+func lineBreakBefore(scan *scanner, i, end int) bool {
+	at := scan.index(i, "\n")
+	return at >= 0 && at < end
+}
+
+// mayClose reports whether an opener of kind at i may still be closed: once
+// a scan from an earlier position found no closer, none from later will
+func (sc *scanner) mayClose(kind string, i int) bool {
+	from, ok := sc.unclosed[kind]
+	return !ok || i < from
+}
+
+// unclose records that no closer for kind follows i
+func (sc *scanner) unclose(kind string, i int) {
+	if from, ok := sc.unclosed[kind]; !ok || i < from {
+		sc.unclosed[kind] = i
+	}
+}
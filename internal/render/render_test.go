@@ -0,0 +1,135 @@
+package render
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"mercury-relay/test/helpers"
+)
+
+var testOptions = Options{Wikilinks: func(target string) (string, bool) {
+	if Slug(target) == "the-sea" {
+		return "chapter-2.xhtml", true
+	}
+	return "", false
+}}
+
+// assertWellFormed fails unless rendered parses as XML
+func assertWellFormed(t *testing.T, rendered string) {
+	t.Helper()
+	decoder := xml.NewDecoder(strings.NewReader("<div>" + rendered + "</div>"))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			t.Fatalf("not well-formed: %v\n%s", err, rendered)
+		}
+	}
+}
+
+func TestMarkdown(t *testing.T) {
+	tests := []struct {
+		name, source, want string
+	}{
+		{"Heading", "## Maps ##", "<h2>Maps</h2>"},
+		{"Setext heading", "Maps\n====", "<h1>Maps</h1>"},
+		{"Emphasis", "*em* **strong** ~~del~~ snake_case_word", "<p><em>em</em> <strong>strong</strong> <del>del</del> snake_case_word</p>"},
+		{"Nested emphasis", "*a **b** c*", "<p><em>a <strong>b</strong> c</em></p>"},
+		{"Code span", "`a < b` and ``x ` y``", "<p><code>a &lt; b</code> and <code>x ` y</code></p>"},
+		{"Links", `[site](https://example.com "Title") <https://x.org> https://example.org/a_(b).`,
+			`<p><a href="https://example.com">site</a> <a href="https://x.org">https://x.org</a> <a href="https://example.org/a_(b)">https://example.org/a_(b)</a>.</p>`},
+		{"Image", "![A map](images/map.png)", `<p><img src="images/map.png" alt="A map"/></p>`},
+		{"Unsafe link", "[click](javascript:alert(1))", "<p>click</p>"},
+		{"Raw HTML is escaped", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>"},
+		{"Wikilinks", "[[The Sea|sea]] and [[Nowhere]]", `<p><a class="wikilink" href="chapter-2.xhtml">sea</a> and <span class="wikilink">Nowhere</span></p>`},
+		{"Hard break", "one  \ntwo\\\nthree", "<p>one<br/>\ntwo<br/>\nthree</p>"},
+		{"Fenced code", "```go\nif a < b {\n}\n```", "<pre><code class=\"language-go\">if a &lt; b {\n}</code></pre>"},
+		{"Indented code", "    x := 1\n\n    y := 2", "<pre><code>x := 1\n\ny := 2</code></pre>"},
+		{"Tight list", "- one\n- two\n  - nested\n- three", "<ul>\n<li>one</li>\n<li>two\n<ul>\n<li>nested</li>\n</ul></li>\n<li>three</li>\n</ul>"},
+		{"Loose ordered list", "3. one\n\n4. two", "<ol start=\"3\">\n<li><p>one</p></li>\n<li><p>two</p></li>\n</ol>"},
+		{"Table", "| a | b |\n|:-:|--:|\n| 1 | `x\\|y` |",
+			"<table>\n<thead>\n<tr><th style=\"text-align: center\">a</th><th style=\"text-align: right\">b</th></tr>\n</thead>\n<tbody>\n<tr><td style=\"text-align: center\">1</td><td style=\"text-align: right\"><code>x|y</code></td></tr>\n</tbody>\n</table>"},
+		{"Blockquote", "> quoted\nlazy\n\nafter", "<blockquote>\n<p>quoted\nlazy</p>\n</blockquote>\n<p>after</p>"},
+		{"Thematic break", "a\n\n***\n\nb", "<p>a</p>\n<hr/>\n<p>b</p>"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rendered := Markdown(test.source, testOptions)
+			helpers.AssertStringEqual(t, test.want, rendered)
+			assertWellFormed(t, rendered)
+		})
+	}
+}
+
+func TestAsciiDoc(t *testing.T) {
+	tests := []struct {
+		name, source, want string
+	}{
+		{"Sections", "= Book\n\n== Chapter One\n\n== Chapter One", `<h1 id="_book">Book</h1>` + "\n" + `<h2 id="_chapter_one">Chapter One</h2>` + "\n" + `<h2 id="_chapter_one_2">Chapter One</h2>`},
+		{"Formatting", "*bold* _em_ `mono` #mark# **un**constrained x^2^ H~2~O +*literal*+ \\*escaped*",
+			"<p><strong>bold</strong> <em>em</em> <code>mono</code> <mark>mark</mark> <strong>un</strong>constrained x<sup>2</sup> H<sub>2</sub>O *literal* *escaped*</p>"},
+		{"Not formatting", "a * b * c and C# and #hashtag is #great", "<p>a * b * c and C# and #hashtag is #great</p>"},
+		{"Attributes", ":ship: Pequod\n\nThe {ship}{nbsp}sails {unknown}.", "<p>The Pequod sails {unknown}.</p>"},
+		{"Links", "https://example.com[Example] https://x.org link:/local[Local] mailto:a@b.c[mail] link:javascript:alert(1)[no]",
+			`<p><a href="https://example.com">Example</a> <a href="https://x.org">https://x.org</a> <a href="/local">Local</a> <a href="mailto:a@b.c">mail</a> no</p>`},
+		{"Cross references", "<<_chapter_one,back>> xref:the-sea[Sea] [[The Sea]] [[Nowhere|elsewhere]]",
+			`<p><a href="#_chapter_one">back</a> <a class="wikilink" href="chapter-2.xhtml">Sea</a> <a class="wikilink" href="chapter-2.xhtml">The Sea</a> <span class="wikilink">elsewhere</span></p>`},
+		{"Hard break", "one +\ntwo\nthree", "<p>one<br/>\ntwo\nthree</p>"},
+		{"Admonition", "NOTE: Mind <this>.", "<div class=\"admonition note\">\n<p class=\"admonition-label\"><strong>Note</strong></p>\n<p>Mind &lt;this&gt;.</p>\n</div>"},
+		{"Source block", "[source,go]\n----\nif a < b {\n}\n----", "<pre><code class=\"language-go\">if a &lt; b {\n}</code></pre>"},
+		{"Literal", "....\n*raw*\n....\n\n  indented text", "<pre>*raw*</pre>\n<pre>indented text</pre>"},
+		{"Passthrough is shown", "++++\n<b>x</b>\n++++", "<pre><code>&lt;b&gt;x&lt;/b&gt;</code></pre>"},
+		{"Comments", "// note\n////\nhidden\n////\nshown", "<p>shown</p>"},
+		{"Lists", "* one\n** nested\n* two\n+\nmore\n. first\n. second", "<ul>\n<li>one\n<ul>\n<li>nested</li>\n</ul>\n</li>\n<li>two\n<p>more</p>\n<ol>\n<li>first</li>\n<li>second</li>\n</ol>\n</li>\n</ul>"},
+		{"Description list", "CPU:: the brain\nRAM:: memory", "<dl>\n<dt>CPU</dt>\n<dd>the brain</dd>\n<dt>RAM</dt>\n<dd>memory</dd>\n</dl>"},
+		{"Table", ".Sizes\n[cols=\"2*\",options=\"header\"]\n|===\n|Name |Size\n|a |1\n|b\n|2\n|===",
+			"<table>\n<caption>Sizes</caption>\n<thead>\n<tr><th>Name</th><th>Size</th></tr>\n</thead>\n<tbody>\n<tr><td>a</td><td>1</td></tr>\n<tr><td>b</td><td>2</td></tr>\n</tbody>\n</table>"},
+		{"Implicit table header", "|===\n|H1 |H2\n\n|c |d\n|===", "<table>\n<thead>\n<tr><th>H1</th><th>H2</th></tr>\n</thead>\n<tbody>\n<tr><td>c</td><td>d</td></tr>\n</tbody>\n</table>"},
+		{"Quote", "[quote, Ishmael, Moby Dick]\n____\nCall me Ishmael.\n____", "<blockquote>\n<p>Call me Ishmael.</p>\n<p class=\"attribution\">&#8212; Ishmael, Moby Dick</p>\n</blockquote>"},
+		{"Example admonition", "[WARNING]\n====\nDanger.\n====", "<div class=\"admonition warning\">\n<p class=\"admonition-label\"><strong>Warning</strong></p>\n<p>Danger.</p>\n</div>"},
+		{"Image", ".The map\nimage::https://e.com/map.png[]", `<figure><img src="https://e.com/map.png" alt="map"/><figcaption>The map</figcaption></figure>`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rendered := AsciiDoc(test.source, testOptions)
+			helpers.AssertStringEqual(t, test.want, rendered)
+			assertWellFormed(t, rendered)
+		})
+	}
+}
+
+func TestUnclosedMarkup(t *testing.T) {
+	// Sections full of openers that never close render in linear time;
+	// each took seconds when every opener rescanned the rest of the text
+	tests := []struct {
+		format  string
+		openers []string
+	}{
+		{FormatMarkdown, []string{"[", "[[", "![", "[a](", "<", "*a ", "_a ", "~~a ", "[[a\n"}},
+		{FormatAsciiDoc, []string{"pass:[", "image:a[", "footnote:[", "link:", "xref:", "[[", "<<", "*a ", "^", "[[a\n"}},
+	}
+	for _, test := range tests {
+		for _, opener := range test.openers {
+			t.Run(test.format+" "+opener, func(t *testing.T) {
+				source := strings.Repeat(opener, 100000/len(opener))
+				start := time.Now()
+				HTML(source, test.format, testOptions)
+				if elapsed := time.Since(start); elapsed > time.Second {
+					t.Errorf("rendering took %v", elapsed)
+				}
+			})
+		}
+	}
+}
+
+func TestHTML(t *testing.T) {
+	helpers.AssertStringEqual(t, "<h2>Maps</h2>", HTML("## Maps", "markdown", Options{}))
+	helpers.AssertStringEqual(t, `<h2 id="_maps">Maps</h2>`, HTML("== Maps", "", Options{}))
+	helpers.AssertStringEqual(t, "<p>a &lt;b&gt;<br/>\nc</p>\n<p>d</p>", HTML("a <b>\nc\n\nd", "html", Options{}))
+	helpers.AssertStringEqual(t, "the-sea-2", Slug("  The Sea, 2! "))
+}
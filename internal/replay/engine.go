@@ -0,0 +1,241 @@
+package replay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/storage"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ErrUnknownStage is returned when Options names a stage that is not registered
+var ErrUnknownStage = fmt.Errorf("unknown replay stage")
+
+const defaultBatchSize = 500
+
+// Options controls a replay run
+type Options struct {
+	// Stages to run, e.g. []string{"quality", "index"}. They always execute
+	// in pipeline order regardless of the order given here.
+	Stages []string
+	// Filter restricts the replay to matching events; limit is ignored
+	Filter nostr.Filter
+	// BatchSize is the number of events fetched from storage per page
+	BatchSize int
+	// Rate caps replayed events per second; zero means unlimited
+	Rate int
+	// CheckpointPath, if set, records progress after every batch
+	CheckpointPath string
+	// Resume continues from the cursor in CheckpointPath
+	Resume bool
+}
+
+// Progress is reported after every batch and persisted as the checkpoint
+type Progress struct {
+	Cursor      string           `json:"cursor"`
+	Scanned     int64            `json:"scanned"`
+	Replayed    int64            `json:"replayed"`
+	Skipped     int64            `json:"skipped"`
+	Failed      int64            `json:"failed"`
+	StageErrors map[string]int64 `json:"stage_errors"`
+	StartedAt   time.Time        `json:"started_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+	Done        bool             `json:"done"`
+}
+
+// Engine streams stored events through selected pipeline stages
+type Engine struct {
+	source     storage.Scanner
+	stages     map[string]Stage
+	onProgress func(Progress)
+}
+
+func NewEngine(source storage.Scanner) *Engine {
+	return &Engine{
+		source: source,
+		stages: make(map[string]Stage),
+	}
+}
+
+// RegisterStage makes a stage available to Run under its name
+func (e *Engine) RegisterStage(stage Stage) {
+	e.stages[stage.Name()] = stage
+}
+
+// OnProgress sets a callback invoked after every batch
+func (e *Engine) OnProgress(fn func(Progress)) {
+	e.onProgress = fn
+}
+
+// Run replays stored events until storage is exhausted or ctx is cancelled.
+// A cancelled run can be continued with Options.Resume.
+func (e *Engine) Run(ctx context.Context, opts Options) (Progress, error) {
+	stages, err := e.selectStages(opts.Stages)
+	if err != nil {
+		return Progress{}, err
+	}
+
+	progress := Progress{
+		StageErrors: make(map[string]int64),
+		StartedAt:   time.Now(),
+	}
+	if opts.Resume && opts.CheckpointPath != "" {
+		if progress, err = LoadCheckpoint(opts.CheckpointPath); err != nil {
+			return progress, err
+		}
+		if progress.Done {
+			return progress, nil
+		}
+	}
+
+	batchSize := opts.BatchSize
+	if batchSize <= 0 {
+		batchSize = defaultBatchSize
+	}
+	filtered := !filterIsEmpty(opts.Filter)
+
+	var pace <-chan time.Time
+	if opts.Rate > 0 {
+		ticker := time.NewTicker(time.Second / time.Duration(opts.Rate))
+		defer ticker.Stop()
+		pace = ticker.C
+	}
+
+	for {
+		events, next, err := e.source.ScanEvents(ctx, progress.Cursor, batchSize)
+		if err != nil {
+			return progress, fmt.Errorf("failed to scan storage at cursor %q: %w", progress.Cursor, err)
+		}
+
+		for _, event := range events {
+			progress.Scanned++
+			if filtered && !opts.Filter.Matches(event.ToNostrEvent()) {
+				progress.Skipped++
+				continue
+			}
+
+			if pace != nil {
+				select {
+				case <-ctx.Done():
+					return progress, ctx.Err()
+				case <-pace:
+				}
+			}
+
+			if e.replayEvent(event, stages, &progress) {
+				progress.Replayed++
+			} else {
+				progress.Failed++
+			}
+		}
+
+		// Only advance the checkpoint once the whole batch is processed so a
+		// resumed run never skips events
+		progress.Cursor = next
+		progress.Done = next == "" || len(events) == 0
+		progress.UpdatedAt = time.Now()
+
+		if opts.CheckpointPath != "" {
+			if err := SaveCheckpoint(opts.CheckpointPath, progress); err != nil {
+				return progress, err
+			}
+		}
+		if e.onProgress != nil {
+			e.onProgress(progress)
+		}
+
+		if progress.Done {
+			return progress, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return progress, err
+		}
+	}
+}
+
+// replayEvent runs event through stages, stopping at the first failure
+func (e *Engine) replayEvent(event *models.Event, stages []Stage, progress *Progress) bool {
+	for _, stage := range stages {
+		if err := stage.Process(event); err != nil {
+			progress.StageErrors[stage.Name()]++
+			log.Printf("Replay stage %s failed for event %s: %v", stage.Name(), event.ID, err)
+			return false
+		}
+	}
+	return true
+}
+
+// selectStages resolves names to registered stages in pipeline order
+func (e *Engine) selectStages(names []string) ([]Stage, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no replay stages selected")
+	}
+
+	selected := make(map[string]bool)
+	for _, name := range names {
+		if _, ok := e.stages[name]; !ok {
+			return nil, fmt.Errorf("%w: %s", ErrUnknownStage, name)
+		}
+		selected[name] = true
+	}
+
+	var stages []Stage
+	for _, name := range stageOrder {
+		if selected[name] {
+			stages = append(stages, e.stages[name])
+			delete(selected, name)
+		}
+	}
+	// Custom stages run after the built-in ones, in the order given
+	for _, name := range names {
+		if selected[name] {
+			stages = append(stages, e.stages[name])
+			delete(selected, name)
+		}
+	}
+	return stages, nil
+}
+
+func filterIsEmpty(f nostr.Filter) bool {
+	return len(f.IDs) == 0 && len(f.Kinds) == 0 && len(f.Authors) == 0 &&
+		len(f.Tags) == 0 && f.Since == nil && f.Until == nil && f.Search == ""
+}
+
+// LoadCheckpoint reads replay progress saved by SaveCheckpoint
+func LoadCheckpoint(path string) (Progress, error) {
+	var progress Progress
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return progress, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	if err := json.Unmarshal(data, &progress); err != nil {
+		return progress, fmt.Errorf("failed to parse checkpoint: %w", err)
+	}
+	if progress.StageErrors == nil {
+		progress.StageErrors = make(map[string]int64)
+	}
+	return progress, nil
+}
+
+// SaveCheckpoint atomically writes replay progress to path
+func SaveCheckpoint(path string, progress Progress) error {
+	data, err := json.MarshalIndent(progress, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode checkpoint: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"mercury-relay/internal/models"
+	"mercury-relay/test/mocks"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+type recordingStage struct {
+	name string
+	seen []string
+	fail map[string]bool
+}
+
+func (s *recordingStage) Name() string { return s.name }
+
+func (s *recordingStage) Process(event *models.Event) error {
+	s.seen = append(s.seen, s.name+":"+event.ID)
+	if s.fail[event.ID] {
+		return fmt.Errorf("boom")
+	}
+	return nil
+}
+
+func testEvents(n int) []*models.Event {
+	events := make([]*models.Event, n)
+	for i := range events {
+		events[i] = &models.Event{ID: fmt.Sprintf("event-%d", i), Kind: 1 + i%2}
+	}
+	return events
+}
+
+func TestReplayRun(t *testing.T) {
+	scanner := mocks.NewMockScanner(testEvents(10))
+	index := &recordingStage{name: StageIndex, fail: map[string]bool{"event-3": true}}
+	quality := &recordingStage{name: StageQuality}
+
+	engine := NewEngine(scanner)
+	engine.RegisterStage(index)
+	engine.RegisterStage(quality)
+
+	progress, err := engine.Run(context.Background(), Options{
+		Stages:    []string{StageIndex, StageQuality},
+		Filter:    nostr.Filter{Kinds: []int{2}},
+		BatchSize: 4,
+	})
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	if !progress.Done || progress.Scanned != 10 || progress.Skipped != 5 {
+		t.Errorf("Unexpected progress: %+v", progress)
+	}
+	if progress.Replayed != 4 || progress.Failed != 1 || progress.StageErrors[StageIndex] != 1 {
+		t.Errorf("Expected 4 replayed and 1 index failure, got %+v", progress)
+	}
+	if scanner.Calls != 3 {
+		t.Errorf("Expected 3 storage pages, got %d", scanner.Calls)
+	}
+
+	// Quality runs before index regardless of the order requested
+	if quality.seen[0] != "quality:event-1" || len(quality.seen) != 5 || len(index.seen) != 5 {
+		t.Errorf("Unexpected stage calls: quality=%v index=%v", quality.seen, index.seen)
+	}
+}
+
+func TestReplayCheckpointResume(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay.json")
+	scanner := mocks.NewMockScanner(testEvents(6))
+	stage := &recordingStage{name: StageIndex}
+
+	engine := NewEngine(scanner)
+	engine.RegisterStage(stage)
+
+	// Cancel after the first batch is checkpointed
+	ctx, cancel := context.WithCancel(context.Background())
+	engine.OnProgress(func(Progress) { cancel() })
+
+	progress, err := engine.Run(ctx, Options{Stages: []string{StageIndex}, BatchSize: 2, CheckpointPath: path})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if progress.Cursor != "2" || progress.Replayed != 2 {
+		t.Fatalf("Unexpected progress after cancel: %+v", progress)
+	}
+
+	saved, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Fatalf("LoadCheckpoint failed: %v", err)
+	}
+	if saved.Cursor != "2" {
+		t.Errorf("Expected checkpoint cursor 2, got %q", saved.Cursor)
+	}
+
+	engine.OnProgress(nil)
+	progress, err = engine.Run(context.Background(), Options{Stages: []string{StageIndex}, BatchSize: 2, CheckpointPath: path, Resume: true})
+	if err != nil {
+		t.Fatalf("Resumed run failed: %v", err)
+	}
+	if !progress.Done || progress.Replayed != 6 || len(stage.seen) != 6 {
+		t.Errorf("Expected every event replayed exactly once, got %+v (%d calls)", progress, len(stage.seen))
+	}
+}
+
+func TestReplayUnknownStage(t *testing.T) {
+	engine := NewEngine(mocks.NewMockScanner(nil))
+	if _, err := engine.Run(context.Background(), Options{Stages: []string{"bogus"}}); !errors.Is(err, ErrUnknownStage) {
+		t.Errorf("Expected ErrUnknownStage, got %v", err)
+	}
+}
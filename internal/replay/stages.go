@@ -0,0 +1,109 @@
+package replay
+
+import (
+	"fmt"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/normalize"
+	"mercury-relay/internal/quality"
+)
+
+// Pipeline stage names, in the order they run when selected together
+const (
+	StageQuality   = "quality"
+	StageNormalize = "normalize"
+	StageIndex     = "index"
+	StageCatalog   = "catalog"
+)
+
+var stageOrder = []string{StageQuality, StageNormalize, StageIndex, StageCatalog}
+
+// Stage is a step of the ingest pipeline that can be re-run over stored events
+type Stage interface {
+	Name() string
+	Process(event *models.Event) error
+}
+
+// QualityStage recomputes quality scores and quarantine state. Run it before
+// the index stage so the cache picks up the new scores.
+type QualityStage struct {
+	controller *quality.Controller
+}
+
+func NewQualityStage(controller *quality.Controller) *QualityStage {
+	return &QualityStage{controller: controller}
+}
+
+func (s *QualityStage) Name() string { return StageQuality }
+
+func (s *QualityStage) Process(event *models.Event) error {
+	return s.controller.Rescore(event)
+}
+
+// NormalizeStage recomputes canonical tag values for events stored before
+// normalization existed. Run it before the index stage so the tag indexes
+// pick up the normalized values.
+type NormalizeStage struct {
+	normalizer *normalize.Normalizer
+}
+
+func NewNormalizeStage(normalizer *normalize.Normalizer) *NormalizeStage {
+	return &NormalizeStage{normalizer: normalizer}
+}
+
+func (s *NormalizeStage) Name() string { return StageNormalize }
+
+func (s *NormalizeStage) Process(event *models.Event) error {
+	s.normalizer.Apply(event)
+	return nil
+}
+
+// IndexStage rewrites events into the cache, rebuilding the author, kind,
+// tag and replaceable event indexes
+type IndexStage struct {
+	cache cache.Cache
+}
+
+func NewIndexStage(cache cache.Cache) *IndexStage {
+	return &IndexStage{cache: cache}
+}
+
+func (s *IndexStage) Name() string { return StageIndex }
+
+func (s *IndexStage) Process(event *models.Event) error {
+	return reindex(s.cache, event, StageIndex)
+}
+
+// CatalogStage rebuilds the publication catalog served by /ebooks: kind
+// 30040 indexes, 30041 content and 1063 file metadata. Other kinds are skipped.
+type CatalogStage struct {
+	cache cache.Cache
+}
+
+func NewCatalogStage(cache cache.Cache) *CatalogStage {
+	return &CatalogStage{cache: cache}
+}
+
+func (s *CatalogStage) Name() string { return StageCatalog }
+
+func (s *CatalogStage) Process(event *models.Event) error {
+	switch event.Kind {
+	case 30040, 30041, models.KindFileMetadata:
+		return reindex(s.cache, event, StageCatalog)
+	}
+	return nil
+}
+
+// reindex replaces the cached copy of event; StoreEvent alone skips events
+// that are already cached
+func reindex(c cache.Cache, event *models.Event, stage string) error {
+	event.AddProvenance(models.ProvenanceReplay, stage, "")
+	if err := c.DeleteEvent(event.ID); err != nil {
+		return fmt.Errorf("failed to evict cached event: %w", err)
+	}
+	if err := c.StoreEvent(event); err != nil {
+		return fmt.Errorf("failed to store event: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,314 @@
+// Package reputation screens client IPs against local deny lists and DNSBL
+// zones before they reach the relay.
+package reputation
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mercury-relay/internal/config"
+)
+
+// Action is what happens to a client whose IP matched
+type Action string
+
+const (
+	ActionAllow       Action = ""
+	ActionDeny        Action = "deny"
+	ActionRequireAuth Action = "require_auth"
+	ActionRateLimit   Action = "rate_limit"
+)
+
+// severity orders actions so the strictest match wins
+var severity = map[Action]int{
+	ActionAllow:       0,
+	ActionRateLimit:   1,
+	ActionRequireAuth: 2,
+	ActionDeny:        3,
+}
+
+// maxCachedAddrs triggers a sweep of expired DNSBL answers
+const maxCachedAddrs = 100000
+
+// Verdict is the outcome of checking one IP. Source names the list that
+// matched, e.g. "cidr:203.0.113.0/24" or "dnsbl:zen.spamhaus.org".
+type Verdict struct {
+	Action Action `json:"action"`
+	Source string `json:"source,omitempty"`
+}
+
+// Stats counts checks and matches since startup
+type Stats struct {
+	Checks      int64            `json:"checks"`
+	Matches     map[string]int64 `json:"matches"`    // by source
+	Actions     map[string]int64 `json:"actions"`    // by action
+	CacheHits   int64            `json:"cache_hits"` // DNSBL answers served from cache
+	DNSBLErrors int64            `json:"dnsbl_errors"`
+}
+
+// Checker holds the deny lists and caches DNSBL answers
+type Checker struct {
+	config config.ReputationConfig
+	nets   []*net.IPNet
+	lookup func(ctx context.Context, host string) ([]string, error)
+
+	cache   map[string]cachedVerdict
+	cacheMu sync.Mutex
+
+	checks      atomic.Int64
+	cacheHits   atomic.Int64
+	dnsblErrors atomic.Int64
+	matches     map[string]int64
+	actions     map[Action]int64
+	statsMu     sync.Mutex
+}
+
+type cachedVerdict struct {
+	verdict Verdict
+	expires time.Time
+}
+
+// NewChecker parses the configured CIDRs and deny list file
+func NewChecker(cfg config.ReputationConfig) (*Checker, error) {
+	c := &Checker{
+		config:  cfg,
+		lookup:  net.DefaultResolver.LookupHost,
+		cache:   make(map[string]cachedVerdict),
+		matches: make(map[string]int64),
+		actions: make(map[Action]int64),
+	}
+
+	entries := append([]string{}, cfg.DenyCIDRs...)
+	if cfg.DenyListPath != "" {
+		file, err := readDenyList(cfg.DenyListPath)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, file...)
+	}
+	for _, entry := range entries {
+		ipNet, err := parseCIDR(entry)
+		if err != nil {
+			return nil, err
+		}
+		c.nets = append(c.nets, ipNet)
+	}
+	return c, nil
+}
+
+func readDenyList(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read deny list: %w", err)
+	}
+	defer file.Close()
+
+	var entries []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			entries = append(entries, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read deny list: %w", err)
+	}
+	return entries, nil
+}
+
+// parseCIDR accepts a CIDR or a single IP
+func parseCIDR(entry string) (*net.IPNet, error) {
+	if !strings.Contains(entry, "/") {
+		ip := net.ParseIP(entry)
+		if ip == nil {
+			return nil, fmt.Errorf("invalid deny list entry %q", entry)
+		}
+		bits := 128
+		if ip4 := ip.To4(); ip4 != nil {
+			ip, bits = ip4, 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, ipNet, err := net.ParseCIDR(entry)
+	if err != nil {
+		return nil, fmt.Errorf("invalid deny list entry %q: %w", entry, err)
+	}
+	return ipNet, nil
+}
+
+// ClientIP returns the IP a request came from, honouring proxy headers only
+// when trust_forwarded_for is set
+func (c *Checker) ClientIP(req *http.Request) net.IP {
+	if c.config.TrustForwardedFor {
+		if forwarded := req.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			if ip := net.ParseIP(strings.TrimSpace(first)); ip != nil {
+				return ip
+			}
+		}
+		if ip := net.ParseIP(req.Header.Get("X-Real-IP")); ip != nil {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// CheckRequest checks the client IP of req
+func (c *Checker) CheckRequest(req *http.Request) Verdict {
+	return c.Check(req.Context(), c.ClientIP(req))
+}
+
+// Check returns the strictest action any list prescribes for ip. A nil
+// Checker or an unparseable IP allows everything.
+func (c *Checker) Check(ctx context.Context, ip net.IP) Verdict {
+	if c == nil || ip == nil {
+		return Verdict{}
+	}
+	c.checks.Add(1)
+
+	verdict := c.checkNets(ip)
+	if severity[verdict.Action] < severity[Action(c.config.DNSBLAction)] {
+		if listed := c.checkDNSBL(ctx, ip); listed.Action != ActionAllow {
+			verdict = listed
+		}
+	}
+
+	if verdict.Action != ActionAllow {
+		c.statsMu.Lock()
+		c.matches[verdict.Source]++
+		c.actions[verdict.Action]++
+		c.statsMu.Unlock()
+	}
+	return verdict
+}
+
+func (c *Checker) checkNets(ip net.IP) Verdict {
+	for _, ipNet := range c.nets {
+		if ipNet.Contains(ip) {
+			return Verdict{Action: Action(c.config.DenyListAction), Source: "cidr:" + ipNet.String()}
+		}
+	}
+	return Verdict{}
+}
+
+// checkDNSBL queries every zone for ip, caching the combined answer.
+// Private and loopback addresses are never looked up.
+func (c *Checker) checkDNSBL(ctx context.Context, ip net.IP) Verdict {
+	if len(c.config.DNSBLZones) == 0 || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() {
+		return Verdict{}
+	}
+
+	key := ip.String()
+	now := time.Now()
+	c.cacheMu.Lock()
+	if cached, ok := c.cache[key]; ok && now.Before(cached.expires) {
+		c.cacheMu.Unlock()
+		c.cacheHits.Add(1)
+		return cached.verdict
+	}
+	c.cacheMu.Unlock()
+
+	verdict := Verdict{}
+	reversed := reverseIP(ip)
+	for _, zone := range c.config.DNSBLZones {
+		lookupCtx, cancel := context.WithTimeout(ctx, c.config.DNSBLTimeout)
+		addrs, err := c.lookup(lookupCtx, reversed+"."+zone)
+		cancel()
+		if err != nil {
+			// NXDOMAIN means not listed; anything else is a failed lookup
+			if dnsErr, ok := err.(*net.DNSError); !ok || !dnsErr.IsNotFound {
+				c.dnsblErrors.Add(1)
+			}
+			continue
+		}
+		if listedAnswer(addrs) {
+			verdict = Verdict{Action: Action(c.config.DNSBLAction), Source: "dnsbl:" + zone}
+			break
+		}
+	}
+
+	c.cacheMu.Lock()
+	if len(c.cache) >= maxCachedAddrs {
+		for k, cached := range c.cache {
+			if !now.Before(cached.expires) {
+				delete(c.cache, k)
+			}
+		}
+	}
+	c.cache[key] = cachedVerdict{verdict: verdict, expires: now.Add(c.config.CacheTTL)}
+	c.cacheMu.Unlock()
+
+	return verdict
+}
+
+// listedAnswer reports whether a DNSBL answered with a 127.0.0.0/8 listing
+// code. Other answers are zone errors, e.g. a blocked public resolver.
+func listedAnswer(addrs []string) bool {
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil && ip.To4() != nil && ip.To4()[0] == 127 {
+			return true
+		}
+	}
+	return false
+}
+
+// reverseIP formats ip for a DNSBL query: reversed octets for IPv4,
+// reversed nibbles for IPv6
+func reverseIP(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return fmt.Sprintf("%d.%d.%d.%d", ip4[3], ip4[2], ip4[1], ip4[0])
+	}
+	const hexDigits = "0123456789abcdef"
+	ip16 := ip.To16()
+	nibbles := make([]string, 0, 32)
+	for i := len(ip16) - 1; i >= 0; i-- {
+		nibbles = append(nibbles, string(hexDigits[ip16[i]&0x0f]), string(hexDigits[ip16[i]>>4]))
+	}
+	return strings.Join(nibbles, ".")
+}
+
+// Stats returns the counters since startup
+func (c *Checker) Stats() Stats {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+
+	stats := Stats{
+		Checks:      c.checks.Load(),
+		Matches:     make(map[string]int64, len(c.matches)),
+		Actions:     make(map[string]int64, len(c.actions)),
+		CacheHits:   c.cacheHits.Load(),
+		DNSBLErrors: c.dnsblErrors.Load(),
+	}
+	for source, n := range c.matches {
+		stats.Matches[source] = n
+	}
+	for action, n := range c.actions {
+		stats.Actions[string(action)] = n
+	}
+	return stats
+}
+
+// RateLimitDivisor is what normal limits are divided by for rate_limit
+// matches
+func (c *Checker) RateLimitDivisor() int {
+	if c.config.RateLimitDivisor < 1 {
+		return 1
+	}
+	return c.config.RateLimitDivisor
+}
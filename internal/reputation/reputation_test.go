@@ -0,0 +1,97 @@
+package reputation
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/test/helpers"
+)
+
+func TestCheckerDenyList(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "denylist.txt")
+	helpers.AssertNoError(t, os.WriteFile(path, []byte("# known abusers\n198.51.100.7\n2001:db8::/32 # test net\n\n"), 0644))
+
+	checker, err := NewChecker(config.ReputationConfig{
+		Enabled:        true,
+		DenyCIDRs:      []string{"203.0.113.0/24"},
+		DenyListPath:   path,
+		DenyListAction: string(ActionDeny),
+	})
+	helpers.AssertNoError(t, err)
+
+	ctx := context.Background()
+	verdict := checker.Check(ctx, net.ParseIP("203.0.113.50"))
+	helpers.AssertStringEqual(t, string(ActionDeny), string(verdict.Action))
+	helpers.AssertStringEqual(t, "cidr:203.0.113.0/24", verdict.Source)
+
+	helpers.AssertStringEqual(t, string(ActionDeny), string(checker.Check(ctx, net.ParseIP("198.51.100.7")).Action))
+	helpers.AssertStringEqual(t, string(ActionAllow), string(checker.Check(ctx, net.ParseIP("198.51.100.8")).Action))
+	helpers.AssertStringEqual(t, string(ActionDeny), string(checker.Check(ctx, net.ParseIP("2001:db8::1")).Action))
+
+	stats := checker.Stats()
+	helpers.AssertInt64Equal(t, 4, stats.Checks)
+	helpers.AssertInt64Equal(t, 3, stats.Actions["deny"])
+	helpers.AssertInt64Equal(t, 1, stats.Matches["cidr:203.0.113.0/24"])
+
+	_, err = NewChecker(config.ReputationConfig{DenyCIDRs: []string{"not-an-ip"}})
+	helpers.AssertError(t, err)
+}
+
+func TestCheckerDNSBL(t *testing.T) {
+	checker, err := NewChecker(config.ReputationConfig{
+		Enabled:      true,
+		DNSBLZones:   []string{"bl.example.org"},
+		DNSBLAction:  string(ActionRequireAuth),
+		DNSBLTimeout: time.Second,
+		CacheTTL:     time.Hour,
+	})
+	helpers.AssertNoError(t, err)
+
+	var lookups []string
+	checker.lookup = func(ctx context.Context, host string) ([]string, error) {
+		lookups = append(lookups, host)
+		if host == "2.0.0.192.bl.example.org" {
+			return []string{"127.0.0.2"}, nil
+		}
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+
+	ctx := context.Background()
+	verdict := checker.Check(ctx, net.ParseIP("192.0.0.2"))
+	helpers.AssertStringEqual(t, string(ActionRequireAuth), string(verdict.Action))
+	helpers.AssertStringEqual(t, "dnsbl:bl.example.org", verdict.Source)
+	helpers.AssertStringEqual(t, string(ActionAllow), string(checker.Check(ctx, net.ParseIP("192.0.0.3")).Action))
+
+	// Answers are cached and private addresses never looked up
+	checker.Check(ctx, net.ParseIP("192.0.0.2"))
+	checker.Check(ctx, net.ParseIP("10.0.0.1"))
+	checker.Check(ctx, net.ParseIP("127.0.0.1"))
+	helpers.AssertIntEqual(t, 2, len(lookups))
+	helpers.AssertInt64Equal(t, 1, checker.Stats().CacheHits)
+	helpers.AssertInt64Equal(t, 0, checker.Stats().DNSBLErrors)
+}
+
+func TestReverseIP(t *testing.T) {
+	helpers.AssertStringEqual(t, "4.3.2.1", reverseIP(net.ParseIP("1.2.3.4")))
+	helpers.AssertStringEqual(t,
+		"1.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.0.8.b.d.0.1.0.0.2",
+		reverseIP(net.ParseIP("2001:db8::1")))
+}
+
+func TestClientIP(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "127.0.0.1:5000"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, 10.0.0.1")
+
+	direct, _ := NewChecker(config.ReputationConfig{})
+	helpers.AssertStringEqual(t, "127.0.0.1", direct.ClientIP(req).String())
+
+	proxied, _ := NewChecker(config.ReputationConfig{TrustForwardedFor: true})
+	helpers.AssertStringEqual(t, "203.0.113.9", proxied.ClientIP(req).String())
+}
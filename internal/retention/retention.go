@@ -0,0 +1,377 @@
+// Package retention prunes events from the cache and storage once the
+// configured rules say they are too old, or their NIP-40 expiration passed.
+package retention
+
+import (
+	"container/heap"
+	"context"
+	"log"
+	"slices"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/storage"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Author classes rules can match
+const (
+	ClassOwner  = "owner"
+	ClassWriter = "writer"
+	ClassOther  = "other"
+)
+
+const (
+	// ReasonExpiration counts events deleted for their NIP-40 expiration
+	ReasonExpiration = "expiration"
+	// ReasonDefault counts events deleted by the default TTL
+	ReasonDefault = "default"
+)
+
+// Classifier returns the author class of a pubkey
+type Classifier func(pubkey string) string
+
+// Result is what one pruning pass deleted, or would have in a dry run.
+// Deleted counts events by the rule that expired them.
+type Result struct {
+	DryRun         bool           `json:"dry_run"`
+	Started        time.Time      `json:"started"`
+	Duration       string         `json:"duration"`
+	Examined       int            `json:"examined"`
+	Deleted        map[string]int `json:"deleted"`
+	CacheDeleted   int            `json:"cache_deleted"`
+	StorageDeleted int            `json:"storage_deleted"`
+	Errors         int            `json:"errors"`
+}
+
+// Stats reports the configuration and what the pruner deleted so far
+type Stats struct {
+	DryRun       bool             `json:"dry_run"`
+	Interval     string           `json:"interval"`
+	Runs         int              `json:"runs"`
+	Tracked      int              `json:"tracked_expirations"`
+	TotalDeleted map[string]int64 `json:"total_deleted"`
+	LastRun      *Result          `json:"last_run,omitempty"`
+}
+
+// Pruner applies the retention rules. Expirations of events seen through
+// Track, or found in storage at start, are kept in a heap so they are
+// deleted on time without scanning for expiration tags.
+type Pruner struct {
+	config     config.RetentionConfig
+	cache      cache.Cache
+	storage    storage.Storage
+	classify   Classifier
+	expiring   expiryHeap
+	tracked    map[string]bool
+	runs       int
+	total      map[string]int64
+	last       *Result
+	mu         sync.Mutex
+	pruneMutex sync.Mutex
+}
+
+// New creates a pruner over c and s; s may be nil
+func New(cfg config.RetentionConfig, c cache.Cache, s storage.Storage) *Pruner {
+	return &Pruner{
+		config:   cfg,
+		cache:    c,
+		storage:  s,
+		classify: func(string) string { return ClassOther },
+		tracked:  make(map[string]bool),
+		total:    make(map[string]int64),
+	}
+}
+
+// SetClassifier sets how authors are sorted into classes for rules with an
+// author_class. Without one every author is "other".
+func (p *Pruner) SetClassifier(classify Classifier) {
+	p.classify = classify
+}
+
+// Track remembers the expiration of a newly stored event
+func (p *Pruner) Track(event *models.Event) {
+	at, ok := event.Expiration()
+	if !ok || event.Mirrored {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.tracked[event.ID] {
+		return
+	}
+	p.tracked[event.ID] = true
+	heap.Push(&p.expiring, expiry{id: event.ID, at: at})
+}
+
+// Run tracks the expirations already in storage, then prunes every Interval
+// until ctx is done
+func (p *Pruner) Run(ctx context.Context) {
+	p.loadExpirations(ctx)
+
+	ticker := time.NewTicker(p.config.Interval)
+	defer ticker.Stop()
+	for {
+		result := p.Prune(ctx, p.config.DryRun)
+		if total := result.total(); total > 0 || result.Errors > 0 {
+			verb := "Pruned"
+			if result.DryRun {
+				verb = "Would prune"
+			}
+			log.Printf("%s %d events (%v), %d errors", verb, total, result.Deleted, result.Errors)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// loadExpirations pages through storage for events with an expiration tag
+func (p *Pruner) loadExpirations(ctx context.Context) {
+	scanner, ok := p.storage.(storage.Scanner)
+	if !ok {
+		return
+	}
+	cursor := ""
+	for ctx.Err() == nil {
+		events, next, err := scanner.ScanEvents(ctx, cursor, p.config.BatchSize)
+		if err != nil {
+			log.Printf("Failed to scan storage for expirations: %v", err)
+			return
+		}
+		for _, event := range events {
+			p.Track(event)
+		}
+		if next == "" {
+			return
+		}
+		cursor = next
+	}
+}
+
+// Prune runs one pass over the cache and storage. In a dry run nothing is
+// deleted and the counts are what a real pass would delete.
+func (p *Pruner) Prune(ctx context.Context, dryRun bool) *Result {
+	p.pruneMutex.Lock()
+	defer p.pruneMutex.Unlock()
+
+	now := time.Now()
+	result := &Result{DryRun: dryRun, Started: now, Deleted: make(map[string]int)}
+	seen := make(map[string]bool)
+
+	p.pruneExpired(now, result, seen)
+
+	queries := []func(context.Context, nostr.Filter) ([]*models.Event, error){
+		func(ctx context.Context, filter nostr.Filter) ([]*models.Event, error) {
+			return cache.Collect(p.cache.GetEvents(ctx, filter))
+		},
+	}
+	if querier, ok := p.storage.(storage.Querier); ok {
+		queries = append(queries, querier.QueryEvents)
+	}
+	for _, filter := range p.filters(now) {
+		for _, query := range queries {
+			if ctx.Err() != nil {
+				break
+			}
+			p.pruneQuery(ctx, query, filter, now, result, seen)
+		}
+	}
+
+	result.Duration = time.Since(now).Round(time.Millisecond).String()
+	p.mu.Lock()
+	p.runs++
+	p.last = result
+	if !dryRun {
+		for reason, count := range result.Deleted {
+			p.total[reason] += int64(count)
+		}
+	}
+	p.mu.Unlock()
+	return result
+}
+
+// pruneExpired deletes tracked events whose expiration passed
+func (p *Pruner) pruneExpired(now time.Time, result *Result, seen map[string]bool) {
+	p.mu.Lock()
+	var due []string
+	if result.DryRun {
+		for _, e := range p.expiring {
+			if e.at.Time().Before(now) {
+				due = append(due, e.id)
+			}
+		}
+	} else {
+		for len(p.expiring) > 0 && p.expiring[0].at.Time().Before(now) {
+			e := heap.Pop(&p.expiring).(expiry)
+			delete(p.tracked, e.id)
+			due = append(due, e.id)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, id := range due {
+		seen[id] = true
+		result.Examined++
+		p.delete(id, ReasonExpiration, result)
+	}
+}
+
+// filters returns one query per TTL in use, for the events older than it.
+// Which rule applies to each event found is decided by Policy.
+func (p *Pruner) filters(now time.Time) []nostr.Filter {
+	var filters []nostr.Filter
+	add := func(kinds []int, ttl time.Duration) {
+		if ttl <= 0 {
+			return
+		}
+		until := nostr.Timestamp(now.Add(-ttl).Unix())
+		filters = append(filters, nostr.Filter{Kinds: kinds, Until: &until, Limit: p.config.BatchSize})
+	}
+	for _, rule := range p.config.Rules {
+		add(rule.Kinds, rule.TTL)
+	}
+	add(nil, p.config.DefaultTTL)
+	return filters
+}
+
+// pruneQuery pages back through the events matching filter and deletes
+// those their rule has expired
+func (p *Pruner) pruneQuery(ctx context.Context, query func(context.Context, nostr.Filter) ([]*models.Event, error), filter nostr.Filter, now time.Time, result *Result, seen map[string]bool) {
+	for ctx.Err() == nil {
+		events, err := query(ctx, filter)
+		if err != nil {
+			log.Printf("Retention query failed: %v", err)
+			result.Errors++
+			return
+		}
+		kept := false
+		for _, event := range events {
+			if seen[event.ID] {
+				kept = true
+				continue
+			}
+			seen[event.ID] = true
+			result.Examined++
+			reason, expired := p.Policy(event, now)
+			if !expired {
+				kept = true
+				continue
+			}
+			p.delete(event.ID, reason, result)
+		}
+		if len(events) < filter.Limit {
+			return
+		}
+		// Deleted events drop out of the next page; move past the kept ones
+		if kept || result.DryRun {
+			oldest := events[len(events)-1].CreatedAt - 1
+			filter.Until = &oldest
+		}
+	}
+}
+
+// Policy reports whether event is past its retention and which rule, or
+// expiration, decided it
+func (p *Pruner) Policy(event *models.Event, now time.Time) (string, bool) {
+	if event.Mirrored {
+		return "", false
+	}
+	if at, ok := event.Expiration(); ok && at.Time().Before(now) {
+		return ReasonExpiration, true
+	}
+	reason, ttl := ReasonDefault, p.config.DefaultTTL
+	for _, rule := range p.config.Rules {
+		if p.matches(rule, event) {
+			reason, ttl = rule.Name, rule.TTL
+			break
+		}
+	}
+	if ttl <= 0 {
+		return "", false
+	}
+	return reason, event.CreatedTime().Before(now.Add(-ttl))
+}
+
+func (p *Pruner) matches(rule config.RetentionRule, event *models.Event) bool {
+	if len(rule.Kinds) > 0 && !slices.Contains(rule.Kinds, event.Kind) {
+		return false
+	}
+	return rule.AuthorClass == "" || p.classify(event.PubKey) == rule.AuthorClass
+}
+
+// delete removes an event from the cache and storage, or only counts it in
+// a dry run
+func (p *Pruner) delete(id, reason string, result *Result) {
+	result.Deleted[reason]++
+	if result.DryRun {
+		return
+	}
+	if err := p.cache.DeleteEvent(id); err != nil {
+		log.Printf("Failed to delete event %s from cache: %v", id, err)
+		result.Errors++
+	} else {
+		result.CacheDeleted++
+	}
+	if p.storage == nil {
+		return
+	}
+	if err := p.storage.DeleteEvent(id); err != nil {
+		log.Printf("Failed to delete event %s from storage: %v", id, err)
+		result.Errors++
+	} else {
+		result.StorageDeleted++
+	}
+}
+
+// Stats returns the totals deleted since start and the last pass
+func (p *Pruner) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	total := make(map[string]int64, len(p.total))
+	for reason, count := range p.total {
+		total[reason] = count
+	}
+	return Stats{
+		DryRun:       p.config.DryRun,
+		Interval:     p.config.Interval.String(),
+		Runs:         p.runs,
+		Tracked:      len(p.expiring),
+		TotalDeleted: total,
+		LastRun:      p.last,
+	}
+}
+
+func (r *Result) total() int {
+	total := 0
+	for _, count := range r.Deleted {
+		total += count
+	}
+	return total
+}
+
+// expiry is when a tracked event expires
+type expiry struct {
+	id string
+	at nostr.Timestamp
+}
+
+// expiryHeap orders tracked expirations, soonest first
+type expiryHeap []expiry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].at < h[j].at }
+func (h expiryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x any)        { *h = append(*h, x.(expiry)) }
+func (h *expiryHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
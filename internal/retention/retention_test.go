@@ -0,0 +1,136 @@
+package retention
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/storage"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+var seq int
+
+func event(kind int, pubkey string, age time.Duration, tags ...nostr.Tag) *models.Event {
+	seq++
+	return &models.Event{
+		ID:        fmt.Sprintf("%064d", seq),
+		PubKey:    pubkey,
+		Kind:      kind,
+		CreatedAt: nostr.Timestamp(time.Now().Add(-age).Unix()),
+		Tags:      nostr.Tags(tags),
+	}
+}
+
+func newPruner(t *testing.T, cfg config.RetentionConfig) (*Pruner, *cache.Memory, *storage.FileStorage) {
+	t.Helper()
+	c := cache.NewMemory(config.CacheConfig{})
+	s, err := storage.NewFile(t.TempDir())
+	helpers.AssertNoError(t, err)
+	t.Cleanup(func() { s.Close() })
+	if cfg.BatchSize == 0 {
+		cfg.BatchSize = 2
+	}
+	return New(cfg, c, s), c, s
+}
+
+func store(t *testing.T, c cache.Cache, s storage.Storage, events ...*models.Event) {
+	t.Helper()
+	for _, e := range events {
+		helpers.AssertNoError(t, c.StoreEvent(e))
+		helpers.AssertNoError(t, s.StoreEvent(e))
+	}
+}
+
+func present(c cache.Cache, id string) bool {
+	events, _ := cache.Collect(c.GetEvents(context.Background(), nostr.Filter{IDs: []string{id}}))
+	return len(events) == 1
+}
+
+func TestPruneRules(t *testing.T) {
+	day := 24 * time.Hour
+	p, c, s := newPruner(t, config.RetentionConfig{
+		DefaultTTL: 365 * day,
+		Rules: []config.RetentionRule{
+			{Name: "owner notes", Kinds: []int{1}, AuthorClass: ClassOwner},
+			{Name: "notes", Kinds: []int{1}, TTL: 90 * day},
+			{Name: "publications", Kinds: []int{30040, 30041}},
+		},
+	})
+	owner := "owner"
+	p.SetClassifier(func(pubkey string) string {
+		if pubkey == owner {
+			return ClassOwner
+		}
+		return ClassOther
+	})
+
+	oldNotes := []*models.Event{event(1, "alice", 100*day), event(1, "bob", 120*day), event(1, "carol", 200*day)}
+	recentNote := event(1, "alice", 10*day)
+	ownerNote := event(1, owner, 400*day)
+	book := event(30040, "alice", 800*day, nostr.Tag{"d", "book"})
+	oldReaction := event(7, "alice", 400*day)
+	store(t, c, s, append(oldNotes, recentNote, ownerNote, book, oldReaction)...)
+
+	// A dry run deletes nothing
+	result := p.Prune(context.Background(), true)
+	helpers.AssertIntEqual(t, 3, result.Deleted["notes"])
+	helpers.AssertIntEqual(t, 1, result.Deleted[ReasonDefault])
+	helpers.AssertTrue(t, present(c, oldNotes[0].ID))
+	helpers.AssertIntEqual(t, 0, len(p.Stats().TotalDeleted))
+
+	result = p.Prune(context.Background(), false)
+	helpers.AssertIntEqual(t, 3, result.Deleted["notes"])
+	helpers.AssertIntEqual(t, 1, result.Deleted[ReasonDefault])
+	helpers.AssertIntEqual(t, 4, result.CacheDeleted)
+	helpers.AssertIntEqual(t, 4, result.StorageDeleted)
+	for _, e := range append(oldNotes, oldReaction) {
+		helpers.AssertFalse(t, present(c, e.ID))
+		_, err := s.GetEvent(context.Background(), e.ID)
+		helpers.AssertTrue(t, err == storage.ErrEventNotFound)
+	}
+	for _, e := range []*models.Event{recentNote, ownerNote, book} {
+		helpers.AssertTrue(t, present(c, e.ID))
+	}
+
+	stats := p.Stats()
+	helpers.AssertIntEqual(t, 2, stats.Runs)
+	helpers.AssertTrue(t, stats.TotalDeleted["notes"] == 3)
+}
+
+func TestPruneExpiration(t *testing.T) {
+	p, c, s := newPruner(t, config.RetentionConfig{})
+	past := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+	future := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	expired := event(1, "alice", time.Hour, nostr.Tag{"expiration", past})
+	pending := event(1, "alice", time.Hour, nostr.Tag{"expiration", future})
+	mirrored := event(1, "bob", time.Hour, nostr.Tag{"expiration", past})
+	mirrored.Mirrored = true
+	store(t, c, s, expired, pending, mirrored)
+
+	// Expirations already in storage are found at start
+	p.loadExpirations(context.Background())
+	helpers.AssertIntEqual(t, 2, p.Stats().Tracked)
+
+	result := p.Prune(context.Background(), false)
+	helpers.AssertIntEqual(t, 1, result.Deleted[ReasonExpiration])
+	helpers.AssertFalse(t, present(c, expired.ID))
+	helpers.AssertTrue(t, present(c, pending.ID))
+	helpers.AssertTrue(t, present(c, mirrored.ID))
+	helpers.AssertIntEqual(t, 1, p.Stats().Tracked)
+
+	// New events are tracked as they are stored
+	soon := event(1, "carol", 0, nostr.Tag{"expiration", past})
+	store(t, c, s, soon)
+	p.Track(soon)
+	result = p.Prune(context.Background(), false)
+	helpers.AssertIntEqual(t, 1, result.Deleted[ReasonExpiration])
+	helpers.AssertFalse(t, present(c, soon.ID))
+}
@@ -0,0 +1,507 @@
+// Package search keeps an in-memory full-text index of the notes, articles,
+// books and wiki pages the relay hosts. Events are indexed as they are
+// stored; addressable events are indexed by address, so a new version
+// replaces the old one.
+package search
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"html"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Searchable kinds
+const (
+	KindNote        = 1
+	KindArticle     = 30023
+	KindBook        = 30040
+	KindBookSection = 30041
+	KindWiki        = 30818
+
+	kindDeletion = 5
+)
+
+// Document types, used as facets
+const (
+	TypeNote    = "note"
+	TypeArticle = "article"
+	TypeBook    = "book"
+	TypeSection = "section"
+	TypeWiki    = "wiki"
+)
+
+// Types maps searchable kinds to document types
+var Types = map[int]string{
+	KindNote:        TypeNote,
+	KindArticle:     TypeArticle,
+	KindBook:        TypeBook,
+	KindBookSection: TypeSection,
+	KindWiki:        TypeWiki,
+}
+
+// Field weights in a document's score
+const (
+	titleWeight   = 3
+	summaryWeight = 2
+	hashtagWeight = 2
+	contentWeight = 1
+)
+
+const (
+	// minTokenLength drops single characters from the index
+	minTokenLength = 2
+	// snippetRunes is the length of content highlights
+	snippetRunes = 160
+	// maxLimit caps the hits per page
+	maxLimit = 100
+	// defaultLimit is the page size when none is asked for
+	defaultLimit = 20
+)
+
+// ErrEmptyQuery is returned for a query without searchable terms
+var ErrEmptyQuery = fmt.Errorf("search query has no terms")
+
+// Query is a search
+type Query struct {
+	Text    string
+	Types   []string // all types when empty
+	Authors []string // hex pubkeys; all authors when empty
+	Limit   int
+	Offset  int
+}
+
+// Hit is one matching event
+type Hit struct {
+	Event *models.Event `json:"-"`
+	Type  string        `json:"type"`
+	Score float64       `json:"score"`
+	// Highlights holds HTML-escaped excerpts of the matching fields with
+	// the terms wrapped in <mark>
+	Highlights map[string]string `json:"highlights,omitempty"`
+}
+
+// Result is one page of hits
+type Result struct {
+	Total  int            `json:"total"`
+	Offset int            `json:"offset"`
+	Limit  int            `json:"limit"`
+	Facets map[string]int `json:"facets"` // matches per type, ignoring the type filter
+	Hits   []Hit          `json:"hits"`
+}
+
+// document is an indexed event
+type document struct {
+	key     string
+	event   *models.Event
+	docType string
+	title   string
+	summary string
+	terms   map[string]int // weighted term frequencies
+	order   *list.Element
+}
+
+// Index is an inverted index over searchable events
+type Index struct {
+	config   config.SearchConfig
+	docs     map[string]*document
+	ids      map[string]*document            // by event ID
+	postings map[string]map[string]*document // term -> key -> document
+	order    *list.List                      // documents, oldest indexed first
+	analyze  analyzer
+	mu       sync.RWMutex
+}
+
+// NewIndex creates an empty index
+func NewIndex(cfg config.SearchConfig) *Index {
+	return &Index{
+		config:   cfg,
+		docs:     make(map[string]*document),
+		ids:      make(map[string]*document),
+		postings: make(map[string]map[string]*document),
+		order:    list.New(),
+		analyze:  newAnalyzer(cfg.Language),
+	}
+}
+
+// Load indexes the searchable events already in c, newest first up to the
+// index size
+func (idx *Index) Load(ctx context.Context, c cache.Cache) error {
+	filter := nostr.Filter{Kinds: []int{KindNote, KindArticle, KindBook, KindBookSection, KindWiki}}
+	if idx.config.MaxDocuments > 0 {
+		filter.Limit = idx.config.MaxDocuments
+	}
+	events, err := cache.Collect(c.GetEvents(ctx, filter))
+	if err != nil {
+		return fmt.Errorf("failed to load searchable events: %w", err)
+	}
+	// Oldest first, so the newest are the last to be evicted
+	sort.Slice(events, func(i, j int) bool { return events[i].CreatedAt < events[j].CreatedAt })
+	for _, event := range events {
+		idx.Index(event)
+	}
+	return nil
+}
+
+// Index adds a stored event to the index. Newer versions of addressable
+// events replace older ones; deletions remove the events they delete.
+func (idx *Index) Index(event *models.Event) {
+	if event.IsQuarantined {
+		return
+	}
+	if event.Kind == kindDeletion {
+		idx.applyDeletion(event)
+		return
+	}
+	docType, ok := Types[event.Kind]
+	if !ok {
+		return
+	}
+
+	doc := idx.newDocument(event, docType)
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	if existing, ok := idx.docs[doc.key]; ok {
+		if existing.event.CreatedAt > event.CreatedAt {
+			return
+		}
+		idx.removeLocked(existing)
+	}
+	if idx.config.MaxDocuments > 0 && len(idx.docs) >= idx.config.MaxDocuments {
+		idx.removeLocked(idx.order.Front().Value.(*document))
+	}
+
+	doc.order = idx.order.PushBack(doc)
+	idx.docs[doc.key] = doc
+	idx.ids[event.ID] = doc
+	for term := range doc.terms {
+		if idx.postings[term] == nil {
+			idx.postings[term] = make(map[string]*document)
+		}
+		idx.postings[term][doc.key] = doc
+	}
+}
+
+// newDocument extracts the fields and weighted terms of event
+func (idx *Index) newDocument(event *models.Event, docType string) *document {
+	doc := &document{
+		key:     key(event),
+		event:   event,
+		docType: docType,
+		title:   firstTag(event, "title"),
+		summary: firstTag(event, "summary"),
+		terms:   make(map[string]int),
+	}
+	if doc.title == "" {
+		doc.title = firstTag(event, "name")
+	}
+	idx.addTerms(doc.terms, doc.title, titleWeight)
+	idx.addTerms(doc.terms, doc.summary, summaryWeight)
+	idx.addTerms(doc.terms, event.Content, contentWeight)
+	for _, tag := range event.IndexTags() {
+		if len(tag) >= 2 && tag[0] == "t" {
+			idx.addTerms(doc.terms, tag[1], hashtagWeight)
+		}
+	}
+	return doc
+}
+
+// applyDeletion removes the events a NIP-09 deletion by their author refers to
+func (idx *Index) applyDeletion(deletion *models.Event) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	for _, tag := range deletion.Tags {
+		if len(tag) < 2 {
+			continue
+		}
+		var doc *document
+		switch tag[0] {
+		case "a":
+			doc = idx.docs[tag[1]]
+		case "e":
+			doc = idx.ids[tag[1]]
+		}
+		if doc != nil && doc.event.PubKey == deletion.PubKey {
+			idx.removeLocked(doc)
+		}
+	}
+}
+
+// removeLocked drops doc from the index. idx.mu must be held.
+func (idx *Index) removeLocked(doc *document) {
+	delete(idx.docs, doc.key)
+	delete(idx.ids, doc.event.ID)
+	idx.order.Remove(doc.order)
+	for term := range doc.terms {
+		delete(idx.postings[term], doc.key)
+		if len(idx.postings[term]) == 0 {
+			delete(idx.postings, term)
+		}
+	}
+}
+
+// Search returns the page of documents matching every term of q, best first
+func (idx *Index) Search(q Query) (*Result, error) {
+	terms := idx.uniqueTerms(q.Text)
+	if len(terms) == 0 {
+		return nil, ErrEmptyQuery
+	}
+	if q.Limit <= 0 {
+		q.Limit = defaultLimit
+	}
+	q.Limit = min(q.Limit, maxLimit)
+	q.Offset = max(q.Offset, 0)
+
+	types := make(map[string]bool, len(q.Types))
+	for _, t := range q.Types {
+		types[t] = true
+	}
+	authors := make(map[string]bool, len(q.Authors))
+	for _, a := range q.Authors {
+		authors[a] = true
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	result := &Result{Offset: q.Offset, Limit: q.Limit, Facets: make(map[string]int)}
+	var hits []Hit
+	idx.scoreLocked(terms, func(doc *document, score float64) {
+		if len(authors) > 0 && !authors[doc.event.PubKey] {
+			return
+		}
+		result.Facets[doc.docType]++
+		if len(types) > 0 && !types[doc.docType] {
+			return
+		}
+		hits = append(hits, Hit{Event: doc.event, Type: doc.docType, Score: score})
+	})
+	sortHits(hits, RankRelevance)
+
+	result.Total = len(hits)
+	if q.Offset >= len(hits) {
+		result.Hits = []Hit{}
+		return result, nil
+	}
+	result.Hits = hits[q.Offset:min(q.Offset+q.Limit, len(hits))]
+	for i := range result.Hits {
+		doc := idx.docs[key(result.Hits[i].Event)]
+		result.Hits[i].Highlights = idx.highlights(doc, terms)
+	}
+	return result, nil
+}
+
+// scoreLocked calls each with every document holding all terms and its
+// TF-IDF score. idx.mu must be held.
+func (idx *Index) scoreLocked(terms []string, each func(doc *document, score float64)) {
+	// Walk the rarest term's postings and check the others
+	sort.Slice(terms, func(i, j int) bool { return len(idx.postings[terms[i]]) < len(idx.postings[terms[j]]) })
+	total := float64(len(idx.docs))
+	for _, doc := range idx.postings[terms[0]] {
+		score := 0.0
+		for _, term := range terms {
+			tf, ok := doc.terms[term]
+			if !ok {
+				score = -1
+				break
+			}
+			idf := math.Log(1 + total/float64(len(idx.postings[term])))
+			score += float64(tf) * idf
+		}
+		if score >= 0 {
+			each(doc, score)
+		}
+	}
+}
+
+// sortHits orders hits by rank, breaking ties by the other criterion and
+// then by ID
+func sortHits(hits []Hit, rank string) {
+	sort.Slice(hits, func(i, j int) bool {
+		a, b := hits[i], hits[j]
+		if rank == RankRecent && a.Event.CreatedAt != b.Event.CreatedAt {
+			return a.Event.CreatedAt > b.Event.CreatedAt
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if a.Event.CreatedAt != b.Event.CreatedAt {
+			return a.Event.CreatedAt > b.Event.CreatedAt
+		}
+		return a.Event.ID < b.Event.ID
+	})
+}
+
+// Stats reports the size of the index
+func (idx *Index) Stats() map[string]interface{} {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	types := make(map[string]int)
+	for _, doc := range idx.docs {
+		types[doc.docType]++
+	}
+	return map[string]interface{}{
+		"documents": len(idx.docs),
+		"terms":     len(idx.postings),
+		"types":     types,
+	}
+}
+
+// key identifies a document: its address for addressable kinds, its ID
+// otherwise
+func key(event *models.Event) string {
+	if event.Kind >= 30000 && event.Kind < 40000 {
+		return fmt.Sprintf("%d:%s:%s", event.Kind, event.PubKey, event.Tags.GetD())
+	}
+	return event.ID
+}
+
+func firstTag(event *models.Event, name string) string {
+	if tag := event.Tags.Find(name); tag != nil {
+		return tag.Value()
+	}
+	return ""
+}
+
+// tokenize splits text into lowercase words of letters and digits
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	tokens := words[:0]
+	for _, word := range words {
+		if utf8.RuneCountInString(word) >= minTokenLength {
+			tokens = append(tokens, word)
+		}
+	}
+	return tokens
+}
+
+func (idx *Index) addTerms(terms map[string]int, text string, weight int) {
+	for _, token := range tokenize(text) {
+		if term := idx.analyze(token); term != "" {
+			terms[term] += weight
+		}
+	}
+}
+
+func (idx *Index) uniqueTerms(text string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, token := range tokenize(text) {
+		if term := idx.analyze(token); term != "" && !seen[term] {
+			seen[term] = true
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// highlights returns the title and summary with terms marked, and an excerpt
+// of the content around the first term it contains
+func (idx *Index) highlights(doc *document, terms []string) map[string]string {
+	set := make(map[string]bool, len(terms))
+	for _, term := range terms {
+		set[term] = true
+	}
+	match := func(word string) bool {
+		return set[idx.analyze(strings.ToLower(word))]
+	}
+
+	out := make(map[string]string)
+	if marked, ok := mark(doc.title, match); ok {
+		out["title"] = marked
+	}
+	if marked, ok := mark(doc.summary, match); ok {
+		out["summary"] = marked
+	}
+	if marked, ok := mark(excerpt(doc.event.Content, match), match); ok {
+		out["content"] = marked
+	}
+	return out
+}
+
+// mark HTML-escapes text and wraps the words match accepts in <mark>,
+// reporting whether any matched
+func mark(text string, match func(word string) bool) (string, bool) {
+	var b strings.Builder
+	found := false
+	word := -1
+	flush := func(end int) {
+		if word < 0 {
+			return
+		}
+		w := text[word:end]
+		if match(w) {
+			found = true
+			b.WriteString("<mark>" + html.EscapeString(w) + "</mark>")
+		} else {
+			b.WriteString(html.EscapeString(w))
+		}
+		word = -1
+	}
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if word < 0 {
+				word = i
+			}
+			continue
+		}
+		flush(i)
+		b.WriteString(html.EscapeString(string(r)))
+	}
+	flush(len(text))
+	return b.String(), found
+}
+
+// excerpt cuts about snippetRunes of text around the first matching word
+func excerpt(text string, match func(word string) bool) string {
+	runes := []rune(text)
+	if len(runes) <= snippetRunes {
+		return text
+	}
+
+	start := 0
+	for i := 0; i < len(runes); {
+		if !unicode.IsLetter(runes[i]) && !unicode.IsDigit(runes[i]) {
+			i++
+			continue
+		}
+		j := i
+		for j < len(runes) && (unicode.IsLetter(runes[j]) || unicode.IsDigit(runes[j])) {
+			j++
+		}
+		if match(string(runes[i:j])) {
+			start = max(i-snippetRunes/4, 0)
+			break
+		}
+		i = j
+	}
+	end := min(start+snippetRunes, len(runes))
+	start = max(end-snippetRunes, 0)
+
+	snippet := strings.TrimSpace(string(runes[start:end]))
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(runes) {
+		snippet += "…"
+	}
+	return snippet
+}
@@ -0,0 +1,269 @@
+package search
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+var eventSeq int
+
+func doc(pubkey string, kind int, createdAt int64, content string, tags nostr.Tags) *models.Event {
+	eventSeq++
+	return &models.Event{
+		ID:        fmt.Sprintf("%064x", eventSeq),
+		PubKey:    pubkey,
+		CreatedAt: nostr.Timestamp(createdAt),
+		Kind:      kind,
+		Tags:      tags,
+		Content:   content,
+	}
+}
+
+func ids(result *Result) []string {
+	var out []string
+	for _, hit := range result.Hits {
+		out = append(out, hit.Event.ID)
+	}
+	return out
+}
+
+func TestSearch(t *testing.T) {
+	alice := strings.Repeat("a", 64)
+	bob := strings.Repeat("b", 64)
+
+	idx := NewIndex(config.SearchConfig{})
+	note := doc(alice, KindNote, 100, "Reading a great book about lighthouses tonight", nostr.Tags{{"t", "bookstr"}})
+	article := doc(bob, KindArticle, 200, "Lighthouses kept ships safe for centuries.", nostr.Tags{{"d", "lights"}, {"title", "A History of Lighthouses"}, {"summary", "Keepers & their lamps"}})
+	book := doc(alice, KindBook, 300, "", nostr.Tags{{"d", "keeper"}, {"title", "The Lighthouse Keeper"}})
+	section := doc(alice, KindBookSection, 300, "Chapter one: the keeper climbs the tower.", nostr.Tags{{"d", "keeper-1"}, {"title", "Chapter One"}})
+	wiki := doc(bob, KindWiki, 400, "A lighthouse is a tower that emits light.", nostr.Tags{{"d", "lighthouse"}, {"title", "Lighthouse"}})
+	reaction := doc(bob, 7, 500, "lighthouses", nil)
+	for _, event := range []*models.Event{note, article, book, section, wiki, reaction} {
+		idx.Index(event)
+	}
+
+	t.Run("Ranks by weighted matches", func(t *testing.T) {
+		result, err := idx.Search(Query{Text: "lighthouses"})
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, 2, result.Total)
+		// Title and content beat content alone
+		helpers.AssertStringEqual(t, article.ID, result.Hits[0].Event.ID)
+		helpers.AssertStringEqual(t, TypeArticle, result.Hits[0].Type)
+		helpers.AssertStringEqual(t, note.ID, result.Hits[1].Event.ID)
+	})
+
+	t.Run("Every term must match", func(t *testing.T) {
+		result, err := idx.Search(Query{Text: "keeper tower"})
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, section.ID, strings.Join(ids(result), ","))
+	})
+
+	t.Run("Facets ignore the type filter", func(t *testing.T) {
+		result, err := idx.Search(Query{Text: "keeper", Types: []string{TypeBook}})
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, book.ID, strings.Join(ids(result), ","))
+		helpers.AssertIntEqual(t, 1, result.Facets[TypeBook])
+		helpers.AssertIntEqual(t, 1, result.Facets[TypeSection])
+		helpers.AssertIntEqual(t, 0, result.Facets[TypeArticle]) // "Keepers" is another word
+	})
+
+	t.Run("Author filter", func(t *testing.T) {
+		result, err := idx.Search(Query{Text: "lighthouse", Authors: []string{bob}})
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, wiki.ID, strings.Join(ids(result), ","))
+	})
+
+	t.Run("Hashtags", func(t *testing.T) {
+		result, err := idx.Search(Query{Text: "#bookstr"})
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, note.ID, strings.Join(ids(result), ","))
+	})
+
+	t.Run("Highlights", func(t *testing.T) {
+		result, err := idx.Search(Query{Text: "keepers", Types: []string{TypeArticle}})
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, "<mark>Keepers</mark> &amp; their lamps", result.Hits[0].Highlights["summary"])
+		_, hasTitle := result.Hits[0].Highlights["title"]
+		helpers.AssertFalse(t, hasTitle)
+
+		long := doc(alice, KindNote, 600, strings.Repeat("filler words here ", 40)+"the <lantern> glows "+strings.Repeat("more filler ", 40), nil)
+		idx.Index(long)
+		result, err = idx.Search(Query{Text: "lantern"})
+		helpers.AssertNoError(t, err)
+		content := result.Hits[0].Highlights["content"]
+		helpers.AssertStringContains(t, content, "&lt;<mark>lantern</mark>&gt; glows")
+		helpers.AssertTrue(t, strings.HasPrefix(content, "…") && strings.HasSuffix(content, "…"))
+		helpers.AssertTrue(t, len([]rune(excerpt(long.Content, func(word string) bool { return word == "lantern" }))) <= snippetRunes+2)
+	})
+
+	t.Run("Pagination", func(t *testing.T) {
+		result, err := idx.Search(Query{Text: "lighthouse", Limit: 1})
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, 2, result.Total)
+		helpers.AssertIntEqual(t, 1, len(result.Hits))
+		first := result.Hits[0].Event.ID
+
+		result, err = idx.Search(Query{Text: "lighthouse", Limit: 1, Offset: 1})
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, 1, len(result.Hits))
+		helpers.AssertTrue(t, result.Hits[0].Event.ID != first)
+
+		result, err = idx.Search(Query{Text: "lighthouse", Offset: 5})
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, 0, len(result.Hits))
+	})
+
+	t.Run("Empty query", func(t *testing.T) {
+		_, err := idx.Search(Query{Text: " ! "})
+		helpers.AssertTrue(t, errors.Is(err, ErrEmptyQuery))
+	})
+}
+
+func TestIndexUpdates(t *testing.T) {
+	alice := strings.Repeat("a", 64)
+	mallory := strings.Repeat("c", 64)
+
+	t.Run("New versions replace old ones", func(t *testing.T) {
+		idx := NewIndex(config.SearchConfig{})
+		v1 := doc(alice, KindArticle, 100, "About sailing", nostr.Tags{{"d", "post"}})
+		v2 := doc(alice, KindArticle, 200, "About rowing", nostr.Tags{{"d", "post"}})
+		idx.Index(v1)
+		idx.Index(v2)
+		idx.Index(v1) // arrives late
+
+		result, _ := idx.Search(Query{Text: "sailing"})
+		helpers.AssertIntEqual(t, 0, result.Total)
+		result, _ = idx.Search(Query{Text: "rowing"})
+		helpers.AssertIntEqual(t, 1, result.Total)
+		helpers.AssertIntEqual(t, 1, idx.Stats()["documents"].(int))
+	})
+
+	t.Run("Deletions by the author", func(t *testing.T) {
+		idx := NewIndex(config.SearchConfig{})
+		note := doc(alice, KindNote, 100, "Regrettable take", nil)
+		article := doc(alice, KindArticle, 100, "Regrettable article", nostr.Tags{{"d", "oops"}})
+		idx.Index(note)
+		idx.Index(article)
+
+		idx.Index(doc(mallory, kindDeletion, 200, "", nostr.Tags{{"e", note.ID}}))
+		result, _ := idx.Search(Query{Text: "regrettable"})
+		helpers.AssertIntEqual(t, 2, result.Total)
+
+		idx.Index(doc(alice, kindDeletion, 200, "", nostr.Tags{{"e", note.ID}, {"a", "30023:" + alice + ":oops"}}))
+		result, _ = idx.Search(Query{Text: "regrettable"})
+		helpers.AssertIntEqual(t, 0, result.Total)
+	})
+
+	t.Run("Quarantined events are skipped", func(t *testing.T) {
+		idx := NewIndex(config.SearchConfig{})
+		spam := doc(alice, KindNote, 100, "Cheap pills", nil)
+		spam.IsQuarantined = true
+		idx.Index(spam)
+		helpers.AssertIntEqual(t, 0, idx.Stats()["documents"].(int))
+	})
+
+	t.Run("Bounded", func(t *testing.T) {
+		idx := NewIndex(config.SearchConfig{MaxDocuments: 2})
+		first := doc(alice, KindNote, 100, "first note", nil)
+		idx.Index(first)
+		idx.Index(doc(alice, KindNote, 200, "second note", nil))
+		idx.Index(doc(alice, KindNote, 300, "third note", nil))
+
+		result, _ := idx.Search(Query{Text: "note"})
+		helpers.AssertIntEqual(t, 2, result.Total)
+		result, _ = idx.Search(Query{Text: "first"})
+		helpers.AssertIntEqual(t, 0, result.Total)
+	})
+
+	t.Run("Load from the cache", func(t *testing.T) {
+		c := cache.NewMemory(config.CacheConfig{})
+		defer c.Close()
+		helpers.AssertNoError(t, c.StoreEvent(doc(alice, KindNote, 100, "cached note", nil)))
+		helpers.AssertNoError(t, c.StoreEvent(doc(alice, 7, 100, "cached reaction", nil)))
+
+		idx := NewIndex(config.SearchConfig{MaxDocuments: 10})
+		helpers.AssertNoError(t, idx.Load(context.Background(), c))
+		result, _ := idx.Search(Query{Text: "cached"})
+		helpers.AssertIntEqual(t, 1, result.Total)
+	})
+}
+
+func TestNIP50(t *testing.T) {
+	alice := strings.Repeat("a", 64)
+	bob := strings.Repeat("b", 64)
+
+	idx := NewIndex(config.SearchConfig{})
+	older := doc(alice, KindNote, 100, "Lighthouse lighthouse keepers", nil)
+	newer := doc(bob, KindNote, 200, "A lighthouse at dusk", nil)
+	french := doc(bob, KindNote, 300, "Le phare et le lighthouse", nostr.Tags{{"l", "fr", "ISO-639-1"}})
+	for _, event := range []*models.Event{older, newer, french} {
+		idx.Index(event)
+	}
+
+	t.Run("Ranks by relevance", func(t *testing.T) {
+		events, err := idx.Filter(nostr.Filter{Search: "lighthouse"})
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, 3, len(events))
+		helpers.AssertStringEqual(t, older.ID, events[0].ID)
+	})
+
+	t.Run("Sorts by recency", func(t *testing.T) {
+		events, err := idx.Filter(nostr.Filter{Search: "lighthouse sort:recent", Limit: 2})
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, 2, len(events))
+		helpers.AssertStringEqual(t, french.ID, events[0].ID)
+		helpers.AssertStringEqual(t, newer.ID, events[1].ID)
+	})
+
+	t.Run("Applies the other conditions", func(t *testing.T) {
+		events, err := idx.Filter(nostr.Filter{Search: "lighthouse include:spam", Authors: []string{bob}, Kinds: []int{KindNote}})
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, 2, len(events))
+
+		events, err = idx.Filter(nostr.Filter{Search: "lighthouse language:fr"})
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, 1, len(events))
+		helpers.AssertStringEqual(t, french.ID, events[0].ID)
+	})
+
+	t.Run("Needs words", func(t *testing.T) {
+		_, err := idx.Filter(nostr.Filter{Search: "sort:recent"})
+		helpers.AssertTrue(t, errors.Is(err, ErrEmptyQuery))
+		helpers.AssertTrue(t, errors.Is(idx.CheckQuery("domain:example.com"), ErrEmptyQuery))
+		helpers.AssertNoError(t, idx.CheckQuery("https://example.com"))
+	})
+
+	t.Run("Matches new events", func(t *testing.T) {
+		event := doc(alice, KindNote, 400, "Another lighthouse", nil)
+		helpers.AssertTrue(t, idx.Matches(event, "LIGHTHOUSE"))
+		helpers.AssertFalse(t, idx.Matches(event, "lighthouse keepers"))
+		helpers.AssertFalse(t, idx.Matches(doc(alice, 7, 400, "lighthouse", nil), "lighthouse"))
+	})
+}
+
+func TestEnglishAnalyzer(t *testing.T) {
+	idx := NewIndex(config.SearchConfig{Language: LanguageEnglish})
+	note := doc(strings.Repeat("a", 64), KindNote, 100, "Stories of the lighthouses", nil)
+	idx.Index(note)
+
+	events, err := idx.Filter(nostr.Filter{Search: "lighthouse story"})
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 1, len(events))
+
+	// Stop words alone are not a query
+	helpers.AssertTrue(t, errors.Is(idx.CheckQuery("the of"), ErrEmptyQuery))
+
+	for word, stem := range map[string]string{"stories": "story", "glass": "glass", "days": "day", "bus": "bus"} {
+		helpers.AssertStringEqual(t, stem, stemEnglishPlural(word))
+	}
+}
@@ -0,0 +1,61 @@
+package search
+
+// Text analysis languages
+const (
+	// LanguageSimple indexes words as they are written, lower cased
+	LanguageSimple = "simple"
+	// LanguageEnglish drops English stop words and folds plurals, so
+	// "lighthouses" finds "lighthouse"
+	LanguageEnglish = "english"
+)
+
+// analyzer turns a lower case token into the term it is indexed and
+// searched as, or "" for words that are not indexed
+type analyzer func(token string) string
+
+func newAnalyzer(language string) analyzer {
+	if language == LanguageEnglish {
+		return analyzeEnglish
+	}
+	return func(token string) string { return token }
+}
+
+// englishStopWords are too common to be worth indexing
+var englishStopWords = map[string]bool{
+	"an": true, "and": true, "are": true, "as": true, "at": true, "be": true,
+	"but": true, "by": true, "for": true, "if": true, "in": true, "into": true,
+	"is": true, "it": true, "no": true, "not": true, "of": true, "on": true,
+	"or": true, "such": true, "that": true, "the": true, "their": true,
+	"then": true, "there": true, "these": true, "they": true, "this": true,
+	"to": true, "was": true, "will": true, "with": true,
+}
+
+func analyzeEnglish(token string) string {
+	if englishStopWords[token] {
+		return ""
+	}
+	return stemEnglishPlural(token)
+}
+
+// stemEnglishPlural folds regular English plurals to their singular,
+// "stories" to "story" and "lighthouses" to "lighthouse". Words ending in
+// -ss, -us, -aes, -ees, -oes and -ies after a vowel are left alone.
+func stemEnglishPlural(word string) string {
+	n := len(word)
+	if n < 3 || word[n-1] != 's' {
+		return word
+	}
+	switch word[n-2] {
+	case 'u', 's':
+		return word
+	case 'e':
+		if n > 3 && word[n-3] == 'i' && word[n-4] != 'a' && word[n-4] != 'e' {
+			return word[:n-3] + "y"
+		}
+		switch word[n-3] {
+		case 'i', 'a', 'o', 'e':
+			return word
+		}
+	}
+	return word[:n-1]
+}
@@ -0,0 +1,136 @@
+package search
+
+import (
+	"strings"
+
+	"mercury-relay/internal/classify"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Rankings of NIP-50 results, chosen with a sort: extension
+const (
+	// RankRelevance puts the best matches first
+	RankRelevance = "relevance"
+	// RankRecent puts the newest matches first
+	RankRecent = "recent"
+)
+
+const (
+	// defaultFilterLimit bounds NIP-50 results when the filter has no limit
+	defaultFilterLimit = 100
+	// maxFilterLimit caps NIP-50 results
+	maxFilterLimit = 500
+)
+
+// nip50Query is a NIP-50 search string: words to match, plus key:value
+// extensions
+type nip50Query struct {
+	text      string
+	rank      string
+	languages []string
+}
+
+// parseSearch splits search into its words and extensions. Supported
+// extensions are sort:relevance, sort:recent and language:<ISO 639-1>;
+// others, such as include:spam or domain:, are ignored as NIP-50 allows.
+func (idx *Index) parseSearch(search string) nip50Query {
+	q := nip50Query{rank: idx.config.Ranking}
+	var words []string
+	for _, field := range strings.Fields(search) {
+		key, value, ok := strings.Cut(field, ":")
+		if !ok || !isExtensionKey(key) || value == "" || strings.HasPrefix(value, "//") {
+			words = append(words, field)
+			continue
+		}
+		switch key {
+		case "sort":
+			if value == RankRelevance || value == RankRecent {
+				q.rank = value
+			}
+		case "language":
+			q.languages = append(q.languages, strings.ToLower(value))
+		}
+	}
+	q.text = strings.Join(words, " ")
+	return q
+}
+
+func isExtensionKey(key string) bool {
+	if key == "" {
+		return false
+	}
+	for _, r := range key {
+		if (r < 'a' || r > 'z') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+func (q nip50Query) matchesLanguage(event *models.Event) bool {
+	return len(q.languages) == 0 || classify.MatchesLanguage(classify.EventLanguage(event), q.languages)
+}
+
+// CheckQuery returns ErrEmptyQuery if a NIP-50 search string has no words
+// to look up
+func (idx *Index) CheckQuery(search string) error {
+	if len(idx.uniqueTerms(idx.parseSearch(search).text)) == 0 {
+		return ErrEmptyQuery
+	}
+	return nil
+}
+
+// Filter answers a NIP-50 filter: the indexed events matching its search
+// string and its other conditions, best match first (newest first with
+// sort:recent), up to its limit
+func (idx *Index) Filter(filter nostr.Filter) ([]*models.Event, error) {
+	q := idx.parseSearch(filter.Search)
+	terms := idx.uniqueTerms(q.text)
+	if len(terms) == 0 {
+		return nil, ErrEmptyQuery
+	}
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = defaultFilterLimit
+	}
+	limit = min(limit, maxFilterLimit)
+
+	var hits []Hit
+	idx.mu.RLock()
+	idx.scoreLocked(terms, func(doc *document, score float64) {
+		if doc.event.MatchesFilter(filter) && q.matchesLanguage(doc.event) {
+			hits = append(hits, Hit{Event: doc.event, Type: doc.docType, Score: score})
+		}
+	})
+	idx.mu.RUnlock()
+
+	sortHits(hits, q.rank)
+	events := make([]*models.Event, 0, min(len(hits), limit))
+	for _, hit := range hits[:min(len(hits), limit)] {
+		events = append(events, hit.Event)
+	}
+	return events, nil
+}
+
+// Matches reports whether a newly stored event answers a NIP-50 search: it
+// is of a searchable kind and holds every word of it
+func (idx *Index) Matches(event *models.Event, search string) bool {
+	docType, ok := Types[event.Kind]
+	if !ok || event.IsQuarantined {
+		return false
+	}
+	q := idx.parseSearch(search)
+	terms := idx.uniqueTerms(q.text)
+	if len(terms) == 0 {
+		return false
+	}
+	doc := idx.newDocument(event, docType)
+	for _, term := range terms {
+		if _, ok := doc.terms[term]; !ok {
+			return false
+		}
+	}
+	return q.matchesLanguage(event)
+}
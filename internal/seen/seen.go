@@ -0,0 +1,212 @@
+// Package seen remembers the IDs of accepted events so copies arriving
+// again, from other upstream relays or clients republishing them, can be
+// acknowledged without being queued, stored and broadcast again. The newest
+// IDs are kept in an in-memory LRU; a Store such as Redis shares them
+// between instances and keeps them across restarts.
+package seen
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mercury-relay/internal/config"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Sources of duplicates in the stats
+const (
+	SourceWebSocket = "websocket"
+	SourceREST      = "rest"
+	SourceUpstream  = "upstream"
+)
+
+// Store keeps seen IDs beyond the in-memory window
+type Store interface {
+	Has(ctx context.Context, id string) (bool, error)
+	Add(ctx context.Context, id string) error
+}
+
+// Index is the seen-event index
+type Index struct {
+	size  int
+	store Store
+
+	mu      sync.Mutex
+	order   *list.List // most recent first
+	entries map[string]*list.Element
+
+	duplicates  map[string]*atomic.Int64
+	storeErrors atomic.Int64
+}
+
+// New returns the index cfg describes, or nil when dedup is disabled
+func New(cfg config.DedupConfig, redisCfg config.RedisConfig) (*Index, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+	index := NewIndex(cfg.Size)
+	switch cfg.Backend {
+	case "", "memory":
+	case "redis":
+		store, err := NewRedisStore(redisCfg, cfg.TTL)
+		if err != nil {
+			return nil, err
+		}
+		index.SetStore(store)
+	default:
+		return nil, fmt.Errorf("unknown dedup backend %q", cfg.Backend)
+	}
+	return index, nil
+}
+
+// NewIndex keeps the newest size IDs in memory; 0 or less keeps none
+func NewIndex(size int) *Index {
+	return &Index{
+		size:    max(size, 0),
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		duplicates: map[string]*atomic.Int64{
+			SourceWebSocket: new(atomic.Int64),
+			SourceREST:      new(atomic.Int64),
+			SourceUpstream:  new(atomic.Int64),
+		},
+	}
+}
+
+// SetStore also keeps IDs in store, checked when memory misses
+func (x *Index) SetStore(store Store) {
+	x.store = store
+}
+
+// Seen reports whether the event with id was accepted before, counting a
+// duplicate from source if so. A store that fails counts as a miss, so
+// events are never dropped for it.
+func (x *Index) Seen(source, id string) bool {
+	seen := x.remembered(id)
+	if !seen && x.store != nil {
+		ok, err := x.store.Has(context.Background(), id)
+		if err != nil {
+			x.storeError(err)
+		}
+		if ok {
+			seen = true
+			x.remember(id)
+		}
+	}
+	if seen {
+		if counter, ok := x.duplicates[source]; ok {
+			counter.Add(1)
+		}
+	}
+	return seen
+}
+
+// Add records that the event with id was accepted
+func (x *Index) Add(id string) {
+	x.remember(id)
+	if x.store != nil {
+		if err := x.store.Add(context.Background(), id); err != nil {
+			x.storeError(err)
+		}
+	}
+}
+
+// Stats reports the IDs held in memory and the duplicates suppressed by
+// source
+func (x *Index) Stats() map[string]interface{} {
+	x.mu.Lock()
+	held := x.order.Len()
+	x.mu.Unlock()
+
+	duplicates := make(map[string]int64, len(x.duplicates))
+	for source, counter := range x.duplicates {
+		duplicates[source] = counter.Load()
+	}
+	return map[string]interface{}{
+		"held":         held,
+		"capacity":     x.size,
+		"shared":       x.store != nil,
+		"duplicates":   duplicates,
+		"store_errors": x.storeErrors.Load(),
+	}
+}
+
+// remembered reports whether id is held in memory, marking it recent
+func (x *Index) remembered(id string) bool {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	element, ok := x.entries[id]
+	if ok {
+		x.order.MoveToFront(element)
+	}
+	return ok
+}
+
+// remember holds id in memory, evicting the least recent ID when full
+func (x *Index) remember(id string) {
+	if x.size == 0 {
+		return
+	}
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	if element, ok := x.entries[id]; ok {
+		x.order.MoveToFront(element)
+		return
+	}
+	x.entries[id] = x.order.PushFront(id)
+	if x.order.Len() > x.size {
+		oldest := x.order.Back()
+		x.order.Remove(oldest)
+		delete(x.entries, oldest.Value.(string))
+	}
+}
+
+func (x *Index) storeError(err error) {
+	// Log the first failure and then every thousandth
+	if x.storeErrors.Add(1)%1000 == 1 {
+		log.Printf("Seen-event store failed, treating events as new: %v", err)
+	}
+}
+
+// seenKeyPrefix prefixes the Redis keys of seen IDs
+const seenKeyPrefix = "mercury:seen:"
+
+// RedisStore keeps seen IDs in Redis, each for ttl
+type RedisStore struct {
+	client *redis.Client
+	ttl    time.Duration
+}
+
+// NewRedisStore connects to the Redis in cfg
+func NewRedisStore(cfg config.RedisConfig, ttl time.Duration) (*RedisStore, error) {
+	client := redis.NewClient(&redis.Options{
+		Addr:     cfg.Host,
+		Password: cfg.Password,
+		DB:       cfg.DB,
+	})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("failed to connect to Redis: %w", err)
+	}
+	return &RedisStore{client: client, ttl: ttl}, nil
+}
+
+func (s *RedisStore) Has(ctx context.Context, id string) (bool, error) {
+	n, err := s.client.Exists(ctx, seenKeyPrefix+id).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check seen event: %w", err)
+	}
+	return n > 0, nil
+}
+
+func (s *RedisStore) Add(ctx context.Context, id string) error {
+	if err := s.client.Set(ctx, seenKeyPrefix+id, 1, s.ttl).Err(); err != nil {
+		return fmt.Errorf("failed to record seen event: %w", err)
+	}
+	return nil
+}
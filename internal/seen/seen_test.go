@@ -0,0 +1,95 @@
+package seen
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/test/helpers"
+)
+
+// memoryStore is a Store shared by several indexes, failing while broken
+type memoryStore struct {
+	mu     sync.Mutex
+	ids    map[string]bool
+	broken bool
+}
+
+func (s *memoryStore) Has(ctx context.Context, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.broken {
+		return false, fmt.Errorf("connection refused")
+	}
+	return s.ids[id], nil
+}
+
+func (s *memoryStore) Add(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.broken {
+		return fmt.Errorf("connection refused")
+	}
+	s.ids[id] = true
+	return nil
+}
+
+func duplicates(x *Index, source string) int64 {
+	return x.Stats()["duplicates"].(map[string]int64)[source]
+}
+
+func TestIndex(t *testing.T) {
+	x := NewIndex(2)
+	helpers.AssertBoolEqual(t, false, x.Seen(SourceWebSocket, "a"))
+	x.Add("a")
+	helpers.AssertBoolEqual(t, true, x.Seen(SourceWebSocket, "a"))
+	helpers.AssertBoolEqual(t, true, x.Seen(SourceUpstream, "a"))
+
+	// The least recently seen ID is evicted
+	x.Add("b")
+	helpers.AssertBoolEqual(t, true, x.Seen(SourceREST, "a"))
+	x.Add("c")
+	helpers.AssertBoolEqual(t, false, x.Seen(SourceREST, "b"))
+	helpers.AssertBoolEqual(t, true, x.Seen(SourceREST, "a"))
+	helpers.AssertBoolEqual(t, true, x.Seen(SourceREST, "c"))
+
+	stats := x.Stats()
+	helpers.AssertIntEqual(t, 2, stats["held"].(int))
+	helpers.AssertInt64Equal(t, 1, duplicates(x, SourceWebSocket))
+	helpers.AssertInt64Equal(t, 1, duplicates(x, SourceUpstream))
+	helpers.AssertInt64Equal(t, 3, duplicates(x, SourceREST))
+}
+
+func TestSharedStore(t *testing.T) {
+	store := &memoryStore{ids: make(map[string]bool)}
+	first, second := NewIndex(10), NewIndex(0)
+	first.SetStore(store)
+	second.SetStore(store)
+
+	first.Add("a")
+	helpers.AssertBoolEqual(t, true, second.Seen(SourceUpstream, "a"))
+	helpers.AssertBoolEqual(t, false, second.Seen(SourceUpstream, "b"))
+	helpers.AssertIntEqual(t, 0, second.Stats()["held"].(int))
+
+	// A failing store never turns new events into duplicates
+	store.broken = true
+	helpers.AssertBoolEqual(t, false, second.Seen(SourceUpstream, "a"))
+	second.Add("c")
+	helpers.AssertBoolEqual(t, true, first.Seen(SourceUpstream, "a"))
+	helpers.AssertInt64Equal(t, 2, second.Stats()["store_errors"].(int64))
+}
+
+func TestNew(t *testing.T) {
+	x, err := New(config.DedupConfig{}, config.RedisConfig{})
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, x == nil)
+
+	x, err = New(config.DedupConfig{Enabled: true, Backend: "memory", Size: 5}, config.RedisConfig{})
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 5, x.Stats()["capacity"].(int))
+
+	_, err = New(config.DedupConfig{Enabled: true, Backend: "disk"}, config.RedisConfig{})
+	helpers.AssertErrorContains(t, err, "unknown dedup backend")
+}
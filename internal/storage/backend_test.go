@@ -0,0 +1,230 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"mercury-relay/internal/compress"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// localStore is a backend kept under a directory, as file and sqlite are
+type localStore interface {
+	Storage
+	Querier
+	Scanner
+	SetCodec(codec *compress.Codec)
+}
+
+// testLocalStore runs the behavior the file and sqlite backends share
+// against the backend open returns for a directory
+func testLocalStore(t *testing.T, open func(dir string) (localStore, error)) {
+	ctx := context.Background()
+
+	reopen := func(t *testing.T, store localStore, dir string) localStore {
+		t.Helper()
+		helpers.AssertNoError(t, store.Close())
+		store, err := open(dir)
+		helpers.AssertNoError(t, err)
+		t.Cleanup(func() { store.Close() })
+		return store
+	}
+	openEmpty := func(t *testing.T) (localStore, string) {
+		t.Helper()
+		dir := t.TempDir()
+		store, err := open(dir)
+		helpers.AssertNoError(t, err)
+		t.Cleanup(func() { store.Close() })
+		return store, dir
+	}
+	ids := func(events []*models.Event) string {
+		ids := make([]string, len(events))
+		for i, event := range events {
+			ids[i] = event.ID
+		}
+		return strings.Join(ids, " ")
+	}
+
+	t.Run("Stores, gets and deletes events", func(t *testing.T) {
+		store, dir := openEmpty(t)
+		note := testEvent("n1", 1, 100, nostr.Tags{{"t", "nostr"}})
+		helpers.AssertNoError(t, store.StoreEvent(note))
+		helpers.AssertNoError(t, store.StoreEvent(note)) // stored again
+
+		event, err := store.GetEvent(ctx, "n1")
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, "content of n1", event.Content)
+		_, err = store.GetEvent(ctx, "missing")
+		helpers.AssertEqual(t, ErrEventNotFound, err)
+
+		// Events survive a restart, deletions too
+		store = reopen(t, store, dir)
+		_, err = store.GetEvent(ctx, "n1")
+		helpers.AssertNoError(t, err)
+		helpers.AssertNoError(t, store.DeleteEvent("n1"))
+		helpers.AssertNoError(t, store.DeleteEvent("missing"))
+		store = reopen(t, store, dir)
+		_, err = store.GetEvent(ctx, "n1")
+		helpers.AssertEqual(t, ErrEventNotFound, err)
+	})
+
+	t.Run("Keeps the latest version of replaceable events", func(t *testing.T) {
+		store, dir := openEmpty(t)
+		for _, event := range []*models.Event{
+			testEvent("p2", 0, 200, nil),
+			testEvent("p1", 0, 100, nil), // older, arriving late
+			testEvent("a1", 30023, 100, nostr.Tags{{"d", "a"}}),
+			testEvent("a2", 30023, 300, nostr.Tags{{"d", "a"}}),
+			testEvent("b1", 30023, 100, nostr.Tags{{"d", "b"}}),
+			// As old as b1 with a lower ID, so it wins (NIP-01)
+			testEvent("b0", 30023, 100, nostr.Tags{{"d", "b"}}),
+		} {
+			helpers.AssertNoError(t, store.StoreEvent(event))
+		}
+
+		check := func(store localStore) {
+			t.Helper()
+			events, err := store.QueryEvents(ctx, nostr.Filter{})
+			helpers.AssertNoError(t, err)
+			helpers.AssertStringEqual(t, "a2 p2 b0", ids(events))
+			_, err = store.GetEvent(ctx, "a1")
+			helpers.AssertEqual(t, ErrEventNotFound, err)
+		}
+		check(store)
+		check(reopen(t, store, dir))
+	})
+
+	t.Run("Queries newest first up to the limit", func(t *testing.T) {
+		store, _ := openEmpty(t)
+		for i := 0; i < 5; i++ {
+			event := testEvent(fmt.Sprintf("n%d", i), 1, nostr.Timestamp(100+i), nostr.Tags{{"t", fmt.Sprintf("topic%d", i%2)}})
+			if i == 4 {
+				event.PubKey = "bob"
+			}
+			helpers.AssertNoError(t, store.StoreEvent(event))
+		}
+		helpers.AssertNoError(t, store.StoreEvent(testEvent("n5", 7, 103, nil)))
+		since, until := nostr.Timestamp(101), nostr.Timestamp(103)
+
+		for _, test := range []struct {
+			filter nostr.Filter
+			ids    string
+		}{
+			{nostr.Filter{}, "n4 n3 n5 n2 n1 n0"},
+			{nostr.Filter{Limit: 2}, "n4 n3"},
+			{nostr.Filter{Kinds: []int{1}, Authors: []string{"alice"}}, "n3 n2 n1 n0"},
+			{nostr.Filter{IDs: []string{"n1", "n5", "missing"}}, "n5 n1"},
+			{nostr.Filter{Since: &since, Until: &until}, "n3 n5 n2 n1"},
+			{nostr.Filter{Tags: nostr.TagMap{"t": {"topic1"}}}, "n3 n1"},
+			{nostr.Filter{Tags: nostr.TagMap{"t": {"topic0", "topic1"}}, Authors: []string{"bob"}}, "n4"},
+			{nostr.Filter{Tags: nostr.TagMap{"p": {"alice"}}}, ""},
+		} {
+			events, err := store.QueryEvents(ctx, test.filter)
+			helpers.AssertNoError(t, err)
+			helpers.AssertStringEqual(t, test.ids, ids(events))
+		}
+	})
+
+	t.Run("Matches normalized tags", func(t *testing.T) {
+		store, _ := openEmpty(t)
+		note := testEvent("n1", 1, 100, nostr.Tags{{"t", "#Nostr"}})
+		note.NormalizedTags = nostr.Tags{{"t", "nostr"}}
+		helpers.AssertNoError(t, store.StoreEvent(note))
+
+		events, err := store.QueryEvents(ctx, nostr.Filter{Tags: nostr.TagMap{"t": {"nostr"}}})
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, "n1", ids(events))
+		helpers.AssertStringEqual(t, "#Nostr", events[0].Tags[0][1])
+	})
+
+	t.Run("Scans in ID order", func(t *testing.T) {
+		store, _ := openEmpty(t)
+		for _, id := range []string{"c", "a", "e", "b", "d"} {
+			helpers.AssertNoError(t, store.StoreEvent(testEvent(id, 1, 100, nil)))
+		}
+
+		var pages []string
+		cursor := ""
+		for {
+			events, next, err := store.ScanEvents(ctx, cursor, 2)
+			helpers.AssertNoError(t, err)
+			pages = append(pages, ids(events))
+			if next == "" {
+				break
+			}
+			cursor = next
+		}
+		helpers.AssertStringEqual(t, "a b|c d|e", strings.Join(pages, "|"))
+	})
+
+	t.Run("Compresses content", func(t *testing.T) {
+		store, dir := openEmpty(t)
+		cfg := config.CompressionConfig{Enabled: true, Kinds: []int{30023}, MinSize: 16}
+		codec, err := compress.NewCodec(cfg)
+		helpers.AssertNoError(t, err)
+		store.SetCodec(codec)
+
+		article := testEvent("a1", 30023, 100, nostr.Tags{{"d", "a"}})
+		article.Content = strings.Repeat("The messenger crossed the mountains. ", 20)
+		helpers.AssertNoError(t, store.StoreEvent(article))
+		helpers.AssertNoError(t, store.StoreEvent(testEvent("n1", 1, 100, nil)))
+
+		stats, err := store.GetStats()
+		helpers.AssertNoError(t, err)
+		kind := stats["compression"].(map[string]interface{})["kinds"].(map[int]compress.KindStats)[30023]
+		helpers.AssertInt64Equal(t, 1, kind.Compressed)
+		helpers.AssertTrue(t, kind.StoredBytes < kind.RawBytes)
+
+		// Compressed content reads back as written, after a restart too
+		store = reopen(t, store, dir)
+		store.SetCodec(codec)
+		event, err := store.GetEvent(ctx, "a1")
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, article.Content, event.Content)
+		events, err := store.QueryEvents(ctx, nostr.Filter{Kinds: []int{30023}})
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, article.Content, events[0].Content)
+		events, _, err = store.ScanEvents(ctx, "", 10)
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, article.Content, events[0].Content)
+
+		// Without the codec compressed events can't be read
+		store = reopen(t, store, dir)
+		_, err = store.GetEvent(ctx, "a1")
+		helpers.AssertErrorContains(t, err, "compression is not configured")
+		event, err = store.GetEvent(ctx, "n1")
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, "content of n1", event.Content)
+	})
+}
+
+func TestNew(t *testing.T) {
+	cfg := &config.Config{}
+	cfg.Storage.Path = t.TempDir()
+
+	for backend, want := range map[string]string{BackendFile: "*storage.FileStorage", BackendSQLite: "*storage.SQLiteStorage"} {
+		cfg.Storage.Backend = backend
+		store, err := New(cfg)
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, want, fmt.Sprintf("%T", store))
+		stats, err := store.GetStats()
+		helpers.AssertNoError(t, err)
+		helpers.AssertNotNil(t, stats["compression"])
+		helpers.AssertNoError(t, store.Close())
+	}
+
+	cfg.Storage.Backend = BackendNone
+	store, err := New(cfg)
+	helpers.AssertNoError(t, err)
+	helpers.AssertNil(t, store)
+
+	cfg.Storage.Backend = "cassandra"
+	_, err = New(cfg)
+	helpers.AssertError(t, err)
+}
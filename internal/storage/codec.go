@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"fmt"
+
+	"mercury-relay/internal/compress"
+	"mercury-relay/internal/models"
+)
+
+// storedEvent is the stored form of an event. ContentEncoding is set when
+// Content holds compressed data.
+type storedEvent struct {
+	models.Event
+	ContentEncoding string `json:"content_encoding,omitempty"`
+}
+
+// encodeEvent compresses the content of event with codec, if there is one
+func encodeEvent(codec *compress.Codec, event *models.Event) storedEvent {
+	stored := storedEvent{Event: *event}
+	if codec != nil {
+		stored.Content, stored.ContentEncoding = codec.Encode(event.Kind, event.Content)
+	}
+	return stored
+}
+
+// decodeEvent restores the original content of a stored event
+func decodeEvent(codec *compress.Codec, stored *storedEvent) (*models.Event, error) {
+	event := stored.Event
+	if stored.ContentEncoding == "" {
+		return &event, nil
+	}
+	if codec == nil {
+		return nil, fmt.Errorf("event %s has %s content but compression is not configured", event.ID, stored.ContentEncoding)
+	}
+
+	content, err := codec.Decode(stored.ContentEncoding, stored.Content)
+	if err != nil {
+		return nil, fmt.Errorf("event %s: %w", event.ID, err)
+	}
+	event.Content = content
+	return &event, nil
+}
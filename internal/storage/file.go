@@ -0,0 +1,367 @@
+package storage
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
+
+	"mercury-relay/internal/compress"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	fileLogName = "events.jsonl"
+	// fileCompactMin is the least number of dead log lines worth compacting
+	fileCompactMin = 1000
+)
+
+// FileStorage keeps events in an append-only JSON lines log, indexed in
+// memory, so a single binary can persist events without a database. Only
+// the latest version of replaceable events is kept. The log is rewritten
+// once superseded and deleted events make up more than half of it. Events
+// are held as stored, compressed content included, and decoded as they are
+// read.
+type FileStorage struct {
+	path     string
+	file     *os.File
+	codec    *compress.Codec
+	events   map[string]*storedEvent
+	replaced map[string]string // replace key -> ID of the latest version
+	dead     int               // log lines that no longer hold a live event
+	size     int64
+	sorted   []string // IDs in order for ScanEvents, nil when stale
+	mu       sync.RWMutex
+}
+
+// fileRecord is one line of the log: an event, or the ID of a deleted one
+type fileRecord struct {
+	Event   *storedEvent `json:"event,omitempty"`
+	Deleted string       `json:"deleted,omitempty"`
+}
+
+// NewFile opens the event log in dir, creating it if needed
+func NewFile(dir string) (*FileStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	f := &FileStorage{
+		path:     filepath.Join(dir, fileLogName),
+		events:   make(map[string]*storedEvent),
+		replaced: make(map[string]string),
+	}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event log: %w", err)
+	}
+	f.file = file
+	return f, nil
+}
+
+// load replays the log. A torn last line, left by a crash mid-write, is
+// skipped.
+func (f *FileStorage) load() error {
+	file, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open event log: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		f.size += int64(len(scanner.Bytes())) + 1
+		var record fileRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			log.Printf("Skipping unreadable line %d of %s: %v", line, f.path, err)
+			f.dead++
+			continue
+		}
+		f.apply(record)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read event log: %w", err)
+	}
+	return nil
+}
+
+// apply updates the index with a record and reports whether it changed
+// anything; the caller holds the lock
+func (f *FileStorage) apply(record fileRecord) bool {
+	if record.Deleted != "" {
+		event, ok := f.events[record.Deleted]
+		if !ok {
+			f.dead++
+			return false
+		}
+		f.remove(event)
+		f.dead += 2 // the event and the deletion
+		return true
+	}
+
+	event := record.Event
+	if event == nil || event.ID == "" {
+		f.dead++
+		return false
+	}
+	if _, ok := f.events[event.ID]; ok {
+		// Stored again with new relay metadata
+		f.events[event.ID] = event
+		f.dead++
+		return true
+	}
+	if models.IsReplaceableKind(event.Kind) {
+		key := replaceKey(&event.Event)
+		if id, ok := f.replaced[key]; ok {
+			previous := f.events[id]
+			if !event.Supersedes(&previous.Event) {
+				f.dead++
+				return false
+			}
+			f.remove(previous)
+			f.dead++
+		}
+		f.replaced[key] = event.ID
+	}
+	f.events[event.ID] = event
+	f.sorted = nil
+	return true
+}
+
+func (f *FileStorage) remove(event *storedEvent) {
+	delete(f.events, event.ID)
+	if key := replaceKey(&event.Event); models.IsReplaceableKind(event.Kind) && f.replaced[key] == event.ID {
+		delete(f.replaced, key)
+	}
+	f.sorted = nil
+}
+
+// SetCodec compresses the content of events appended to the log and
+// decompresses it as events are read
+func (f *FileStorage) SetCodec(codec *compress.Codec) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.codec = codec
+}
+
+// StoreEvent appends event to the log unless a newer version of it is
+// already stored
+func (f *FileStorage) StoreEvent(event *models.Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if models.IsReplaceableKind(event.Kind) {
+		if id, ok := f.replaced[replaceKey(event)]; ok && id != event.ID && !event.Supersedes(&f.events[id].Event) {
+			return nil
+		}
+	}
+	stored := encodeEvent(f.codec, event)
+	if err := f.append(fileRecord{Event: &stored}); err != nil {
+		return fmt.Errorf("failed to store event: %w", err)
+	}
+	f.apply(fileRecord{Event: &stored})
+	return f.maybeCompact()
+}
+
+// GetEvent returns a stored event
+func (f *FileStorage) GetEvent(ctx context.Context, eventID string) (*models.Event, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	event, ok := f.events[eventID]
+	if !ok {
+		return nil, ErrEventNotFound
+	}
+	return decodeEvent(f.codec, event)
+}
+
+// DeleteEvent records the deletion of a stored event
+func (f *FileStorage) DeleteEvent(eventID string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.events[eventID]; !ok {
+		return nil
+	}
+	if err := f.append(fileRecord{Deleted: eventID}); err != nil {
+		return fmt.Errorf("failed to delete event: %w", err)
+	}
+	f.apply(fileRecord{Deleted: eventID})
+	return f.maybeCompact()
+}
+
+// QueryEvents returns the stored events matching the NIP-01 conditions of
+// filter, newest first, up to its limit. Search is not applied.
+func (f *FileStorage) QueryEvents(ctx context.Context, filter nostr.Filter) (events []*models.Event, err error) {
+	_, done := traceQuery(ctx, "file", filter)
+	defer func() { done(events, err) }()
+
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	// Filters don't look at content, so events are matched as stored
+	var matched []*storedEvent
+	for _, event := range f.events {
+		if event.MatchesFilter(filter) {
+			matched = append(matched, event)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		if matched[i].CreatedAt != matched[j].CreatedAt {
+			return matched[i].CreatedAt > matched[j].CreatedAt
+		}
+		return matched[i].ID < matched[j].ID
+	})
+	limit := filter.Limit
+	if limit <= 0 || limit > maxQueryLimit {
+		limit = maxQueryLimit
+	}
+	return f.decode(matched[:min(len(matched), limit)])
+}
+
+// decode restores the original content of stored events; the caller holds
+// the lock
+func (f *FileStorage) decode(stored []*storedEvent) ([]*models.Event, error) {
+	events := make([]*models.Event, len(stored))
+	for i, event := range stored {
+		decoded, err := decodeEvent(f.codec, event)
+		if err != nil {
+			return nil, err
+		}
+		events[i] = decoded
+	}
+	return events, nil
+}
+
+// ScanEvents pages through every stored event in ID order
+func (f *FileStorage) ScanEvents(ctx context.Context, cursor string, limit int) ([]*models.Event, string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.sorted == nil {
+		f.sorted = make([]string, 0, len(f.events))
+		for id := range f.events {
+			f.sorted = append(f.sorted, id)
+		}
+		slices.Sort(f.sorted)
+	}
+	start, _ := slices.BinarySearch(f.sorted, cursor)
+	if start < len(f.sorted) && f.sorted[start] == cursor {
+		start++
+	}
+	ids := f.sorted[start:min(start+limit, len(f.sorted))]
+	stored := make([]*storedEvent, len(ids))
+	for i, id := range ids {
+		stored[i] = f.events[id]
+	}
+	events, err := f.decode(stored)
+	if err != nil {
+		return nil, "", err
+	}
+	next := ""
+	if start+limit < len(f.sorted) && len(ids) > 0 {
+		next = ids[len(ids)-1]
+	}
+	return events, next, nil
+}
+
+// GetStats reports the event count and the size of the log
+func (f *FileStorage) GetStats() (map[string]interface{}, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	stats := map[string]interface{}{
+		"backend":    "file",
+		"events":     len(f.events),
+		"log_bytes":  f.size,
+		"dead_lines": f.dead,
+	}
+	if f.codec != nil {
+		stats["compression"] = f.codec.GetStats()
+	}
+	return stats, nil
+}
+
+// Close compacts the log if it is worth it and closes it
+func (f *FileStorage) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.maybeCompact(); err != nil {
+		log.Printf("Failed to compact %s: %v", f.path, err)
+	}
+	return f.file.Close()
+}
+
+func (f *FileStorage) append(record fileRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if _, err := f.file.Write(data); err != nil {
+		return err
+	}
+	f.size += int64(len(data))
+	return nil
+}
+
+// maybeCompact rewrites the log with only the live events once most of it
+// is dead
+func (f *FileStorage) maybeCompact() error {
+	if f.dead < fileCompactMin || f.dead < len(f.events) {
+		return nil
+	}
+
+	tmpPath := f.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to compact event log: %w", err)
+	}
+	writer := bufio.NewWriter(tmp)
+	encoder := json.NewEncoder(writer)
+	var size int64
+	for _, event := range f.events {
+		if err := encoder.Encode(fileRecord{Event: event}); err != nil {
+			tmp.Close()
+			os.Remove(tmpPath)
+			return fmt.Errorf("failed to compact event log: %w", err)
+		}
+	}
+	if err := writer.Flush(); err == nil {
+		err = tmp.Sync()
+	}
+	if info, statErr := tmp.Stat(); statErr == nil {
+		size = info.Size()
+	}
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, f.path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to compact event log: %w", err)
+	}
+
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to reopen event log: %w", err)
+	}
+	f.file.Close()
+	f.file = file
+	f.size = size
+	f.dead = 0
+	return nil
+}
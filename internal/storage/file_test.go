@@ -0,0 +1,91 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestFileStorage(t *testing.T) {
+	testLocalStore(t, func(dir string) (localStore, error) {
+		return NewFile(dir)
+	})
+}
+
+func TestFileStorageLog(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Skips a torn last line", func(t *testing.T) {
+		dir := t.TempDir()
+		store, err := NewFile(dir)
+		helpers.AssertNoError(t, err)
+		helpers.AssertNoError(t, store.StoreEvent(testEvent("n1", 1, 100, nil)))
+		helpers.AssertNoError(t, store.Close())
+
+		log, err := os.OpenFile(filepath.Join(dir, fileLogName), os.O_WRONLY|os.O_APPEND, 0o644)
+		helpers.AssertNoError(t, err)
+		log.WriteString(`{"event":{"id":"n2","pubk`)
+		log.Close()
+
+		store, err = NewFile(dir)
+		helpers.AssertNoError(t, err)
+		defer store.Close()
+		_, err = store.GetEvent(ctx, "n1")
+		helpers.AssertNoError(t, err)
+		stats, _ := store.GetStats()
+		helpers.AssertIntEqual(t, 1, stats["events"].(int))
+		helpers.AssertIntEqual(t, 1, stats["dead_lines"].(int))
+	})
+
+	t.Run("Reads logs written before compression", func(t *testing.T) {
+		dir := t.TempDir()
+		line := `{"event":{"id":"n1","pubkey":"alice","created_at":100,"kind":1,"tags":[],"content":"plain","sig":""}}` + "\n"
+		helpers.AssertNoError(t, os.WriteFile(filepath.Join(dir, fileLogName), []byte(line), 0o644))
+
+		store, err := NewFile(dir)
+		helpers.AssertNoError(t, err)
+		defer store.Close()
+		event, err := store.GetEvent(ctx, "n1")
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, "plain", event.Content)
+	})
+
+	t.Run("Compacts once most of the log is dead", func(t *testing.T) {
+		dir := t.TempDir()
+		store, err := NewFile(dir)
+		helpers.AssertNoError(t, err)
+
+		// Every version but the last supersedes the one before
+		for i := 0; i < fileCompactMin; i++ {
+			helpers.AssertNoError(t, store.StoreEvent(testEvent(fmt.Sprintf("p%04d", i), 0, nostr.Timestamp(100+i), nil)))
+		}
+		helpers.AssertNoError(t, store.StoreEvent(testEvent("n1", 1, 100, nil)))
+		stats, _ := store.GetStats()
+		helpers.AssertIntEqual(t, fileCompactMin-1, stats["dead_lines"].(int))
+
+		helpers.AssertNoError(t, store.StoreEvent(testEvent("p9999", 0, 100+fileCompactMin, nil)))
+		stats, _ = store.GetStats()
+		helpers.AssertIntEqual(t, 0, stats["dead_lines"].(int))
+		helpers.AssertIntEqual(t, 2, stats["events"].(int))
+		helpers.AssertNoError(t, store.Close())
+
+		data, err := os.ReadFile(filepath.Join(dir, fileLogName))
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, 2, strings.Count(string(data), "\n"))
+
+		store, err = NewFile(dir)
+		helpers.AssertNoError(t, err)
+		defer store.Close()
+		events, err := store.QueryEvents(ctx, nostr.Filter{})
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, 2, len(events))
+		helpers.AssertStringEqual(t, "p9999", events[0].ID)
+	})
+}
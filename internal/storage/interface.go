@@ -1,12 +1,34 @@
 package storage
 
-import "mercury-relay/internal/models"
+import (
+	"context"
+	"fmt"
+
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// ErrEventNotFound is returned by GetEvent for an event that isn't stored
+var ErrEventNotFound = fmt.Errorf("event not found")
 
 // Storage defines the interface for event storage
 type Storage interface {
 	StoreEvent(event *models.Event) error
-	GetEvent(eventID string) (*models.Event, error)
+	GetEvent(ctx context.Context, eventID string) (*models.Event, error)
 	DeleteEvent(eventID string) error
 	GetStats() (map[string]interface{}, error)
 	Close() error
 }
+
+// Scanner is implemented by backends that can enumerate every stored event.
+// ScanEvents returns up to limit events after cursor (empty for the start)
+// and the cursor to resume from; an empty next cursor means the scan is done.
+type Scanner interface {
+	ScanEvents(ctx context.Context, cursor string, limit int) (events []*models.Event, next string, err error)
+}
+
+// Querier is implemented by backends that answer NIP-01 filters themselves
+type Querier interface {
+	QueryEvents(ctx context.Context, filter nostr.Filter) ([]*models.Event, error)
+}
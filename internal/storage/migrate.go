@@ -0,0 +1,162 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLock is the advisory lock held while migrating, so instances
+// starting together don't apply the same migration twice
+const migrationLock = 7264011
+
+// Migration is one schema change, applied in a transaction of its own
+type Migration struct {
+	Version int
+	Name    string
+	sql     string
+}
+
+// Migrations lists the embedded migrations in order. Files are named
+// NNNN_name.sql.
+func Migrations() ([]Migration, error) {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+	var migrations []Migration
+	for _, entry := range entries {
+		base := strings.TrimSuffix(entry.Name(), ".sql")
+		number, name, ok := strings.Cut(base, "_")
+		version, err := strconv.Atoi(number)
+		if !ok || err != nil {
+			return nil, fmt.Errorf("migration %s is not named NNNN_name.sql", entry.Name())
+		}
+		data, err := migrationFiles.ReadFile(path.Join("migrations", entry.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read migration %s: %w", entry.Name(), err)
+		}
+		migrations = append(migrations, Migration{Version: version, Name: name, sql: string(data)})
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+func latestMigration() int {
+	migrations, _ := Migrations()
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version    integer PRIMARY KEY,
+	name       text NOT NULL,
+	applied_at timestamptz NOT NULL DEFAULT now()
+)`
+
+// SchemaVersion returns the version of the last applied migration, 0 for
+// an empty database
+func (p *PostgresStorage) SchemaVersion(ctx context.Context) (int, error) {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	defer conn.Close()
+	version, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read schema version: %w", err)
+	}
+	return version, nil
+}
+
+func schemaVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	var version int
+	err := conn.QueryRowContext(ctx, `SELECT coalesce(max(version), 0) FROM schema_migrations`).Scan(&version)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		// undefined_table: nothing applied yet
+		if errors.As(err, &pgErr) && pgErr.Code == "42P01" {
+			return 0, nil
+		}
+		return 0, err
+	}
+	return version, nil
+}
+
+// Migrate applies the migrations newer than the schema, each in its own
+// transaction, and returns those applied
+func (p *PostgresStorage) Migrate(ctx context.Context) ([]Migration, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+	applied, err := p.migrate(ctx, migrations)
+	if err != nil {
+		return applied, fmt.Errorf("failed to migrate postgres: %w", err)
+	}
+	return applied, nil
+}
+
+// migrate applies migrations on one connection, which holds the advisory
+// lock throughout
+func (p *PostgresStorage) migrate(ctx context.Context, migrations []Migration) ([]Migration, error) {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(ctx, createMigrationsTable); err != nil {
+		return nil, err
+	}
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLock); err != nil {
+		return nil, err
+	}
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLock)
+
+	version, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	var applied []Migration
+	for _, migration := range migrations {
+		if migration.Version <= version {
+			continue
+		}
+		if err := applyMigration(ctx, conn, migration); err != nil {
+			return applied, fmt.Errorf("migration %04d_%s: %w", migration.Version, migration.Name, err)
+		}
+		applied = append(applied, migration)
+	}
+	return applied, nil
+}
+
+func applyMigration(ctx context.Context, conn *sql.Conn, migration Migration) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	// Without parameters the statements go as one simple query, so a
+	// migration may hold several
+	if _, err := tx.ExecContext(ctx, migration.sql); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,31 @@
+package storage
+
+import (
+	"strings"
+	"testing"
+
+	"mercury-relay/test/helpers"
+)
+
+func TestMigrations(t *testing.T) {
+	migrations, err := Migrations()
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, len(migrations) > 0)
+
+	helpers.AssertIntEqual(t, 1, migrations[0].Version)
+	helpers.AssertStringEqual(t, "events", migrations[0].Name)
+	helpers.AssertStringContains(t, migrations[0].sql, "CREATE TABLE events")
+
+	// Versions are unique and ascending, ending at the latest
+	for i := 1; i < len(migrations); i++ {
+		helpers.AssertTrue(t, migrations[i-1].Version < migrations[i].Version)
+	}
+	helpers.AssertIntEqual(t, migrations[len(migrations)-1].Version, latestMigration())
+
+	// Migrations run inside the runner's transaction and mustn't end it
+	for _, migration := range migrations {
+		sql := strings.ToUpper(migration.sql)
+		helpers.AssertFalse(t, strings.Contains(sql, "COMMIT"))
+		helpers.AssertFalse(t, strings.Contains(sql, "BEGIN"))
+	}
+}
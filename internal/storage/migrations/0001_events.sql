@@ -0,0 +1,18 @@
+-- Events, one row per event and one per replaceable address. replace_key
+-- is kind:pubkey (plus :d for addressable kinds) and NULL for regular
+-- events; tag_index holds the single-letter tags as name:value.
+CREATE TABLE events (
+    id          text PRIMARY KEY,
+    pubkey      text NOT NULL,
+    kind        integer NOT NULL,
+    created_at  bigint NOT NULL,
+    replace_key text UNIQUE,
+    tag_index   text[] NOT NULL DEFAULT '{}',
+    event       json NOT NULL,
+    stored_at   timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX events_created_at_idx ON events (created_at DESC);
+CREATE INDEX events_pubkey_created_at_idx ON events (pubkey, created_at DESC);
+CREATE INDEX events_kind_created_at_idx ON events (kind, created_at DESC);
+CREATE INDEX events_tag_index_idx ON events USING gin (tag_index);
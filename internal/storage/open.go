@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"fmt"
+
+	"mercury-relay/internal/compress"
+	"mercury-relay/internal/config"
+)
+
+// Storage backends selectable with storage.backend
+const (
+	BackendNone     = "none"
+	BackendXFTP     = "xftp"
+	BackendPostgres = "postgres"
+	BackendFile     = "file"
+	BackendSQLite   = "sqlite"
+)
+
+// maxQueryLimit caps the events one QueryEvents call returns
+const maxQueryLimit = 5000
+
+// New opens the configured storage backend, compressing content as
+// storage.compression says. It returns nil for "none".
+func New(cfg *config.Config) (Storage, error) {
+	if cfg.Storage.Backend == BackendNone {
+		return nil, nil
+	}
+	codec, err := compress.NewCodec(cfg.Storage.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	switch cfg.Storage.Backend {
+	case BackendXFTP:
+		xftp, err := NewXFTP(cfg.XFTP)
+		if err != nil {
+			return nil, err
+		}
+		xftp.SetCodec(codec)
+		return xftp, nil
+	case BackendPostgres:
+		postgres, err := NewPostgres(cfg.Postgres)
+		if err != nil {
+			return nil, err
+		}
+		postgres.SetCodec(codec)
+		return postgres, nil
+	case BackendFile:
+		file, err := NewFile(cfg.Storage.Path)
+		if err != nil {
+			return nil, err
+		}
+		file.SetCodec(codec)
+		return file, nil
+	case BackendSQLite:
+		sqlite, err := NewSQLite(cfg.Storage.Path)
+		if err != nil {
+			return nil, err
+		}
+		sqlite.SetCodec(codec)
+		return sqlite, nil
+	}
+	return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage.Backend)
+}
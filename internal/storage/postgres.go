@@ -0,0 +1,391 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"mercury-relay/internal/compress"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// postgresTimeout bounds connecting and the schema check at start
+const postgresTimeout = 10 * time.Second
+
+// postgresBatchRows bounds the rows of one multi-row INSERT, well under the
+// protocol's 65535 parameters
+const postgresBatchRows = 1000
+
+// PostgresStorage keeps events in PostgreSQL. Replaceable and addressable
+// events are upserted so only the latest version of each is kept, and
+// single-letter tags are indexed for filter queries. The schema is created
+// and upgraded by Migrate.
+type PostgresStorage struct {
+	db    *sql.DB
+	codec *compress.Codec
+}
+
+// NewPostgres connects to the configured database. Unless auto_migrate is
+// set, the schema must already be current; see Migrate.
+func NewPostgres(cfg config.PostgresConfig) (*PostgresStorage, error) {
+	p, err := OpenPostgres(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	if cfg.AutoMigrate {
+		if _, err := p.Migrate(ctx); err != nil {
+			p.Close()
+			return nil, err
+		}
+		return p, nil
+	}
+	version, err := p.SchemaVersion(ctx)
+	if err != nil {
+		p.Close()
+		return nil, err
+	}
+	if latest := latestMigration(); version < latest {
+		p.Close()
+		return nil, fmt.Errorf("postgres schema is at version %d of %d, run mercury migrate or set postgres.auto_migrate", version, latest)
+	}
+	return p, nil
+}
+
+// OpenPostgres returns a store on the configured database without checking
+// its schema, for migration tooling. Connections are made on first use.
+func OpenPostgres(cfg config.PostgresConfig) (*PostgresStorage, error) {
+	connConfig, err := pgx.ParseConfig(postgresDSN(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres: %w", err)
+	}
+	db := stdlib.OpenDB(*connConfig)
+	db.SetMaxOpenConns(max(cfg.MaxConnections, 1))
+	db.SetMaxIdleConns(max(cfg.MaxConnections, 1))
+	return &PostgresStorage{db: db}, nil
+}
+
+// postgresDSN builds the connection string for cfg. Host is host[:port],
+// or the directory of a Unix socket.
+func postgresDSN(cfg config.PostgresConfig) string {
+	var params []string
+	param := func(key, value string) {
+		if value == "" {
+			return
+		}
+		value = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+		params = append(params, key+"='"+value+"'")
+	}
+	host, port := cfg.Host, ""
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		host, port = h, p
+	}
+	param("host", host)
+	param("port", port)
+	param("user", cfg.User)
+	param("password", cfg.Password)
+	param("dbname", cfg.DBName)
+	param("sslmode", cfg.SSLMode)
+	param("connect_timeout", strconv.Itoa(int(postgresTimeout/time.Second)))
+	return strings.Join(params, " ")
+}
+
+// SetCodec compresses event content as it is stored and decompresses it as
+// it is read
+func (p *PostgresStorage) SetCodec(codec *compress.Codec) {
+	p.codec = codec
+}
+
+// StoreEvent saves event, replacing an older version of a replaceable
+// event. Storing an event again updates its relay metadata.
+func (p *PostgresStorage) StoreEvent(event *models.Event) error {
+	return p.StoreEvents(context.Background(), []*models.Event{event})
+}
+
+// StoreEvents saves events in one transaction with multi-row inserts
+func (p *PostgresStorage) StoreEvents(ctx context.Context, events []*models.Event) error {
+	regular, replaceable := splitForUpsert(events)
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to store events: %w", err)
+	}
+	for _, batch := range []struct {
+		rows     []upsertRow
+		conflict string
+	}{
+		{regular, insertOnIDConflict},
+		{replaceable, insertOnReplaceConflict},
+	} {
+		for start := 0; start < len(batch.rows); start += postgresBatchRows {
+			rows := batch.rows[start:min(start+postgresBatchRows, len(batch.rows))]
+			query, args := p.insertEvents(rows, batch.conflict)
+			if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+				tx.Rollback()
+				return fmt.Errorf("failed to store events: %w", err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to store events: %w", err)
+	}
+	return nil
+}
+
+const (
+	insertOnIDConflict = `ON CONFLICT (id) DO UPDATE SET event = EXCLUDED.event`
+	// A replaceable event only replaces an older version, or one as old
+	// with a higher ID (NIP-01); the same event refreshes its metadata
+	insertOnReplaceConflict = `ON CONFLICT (replace_key) DO UPDATE SET
+		id = EXCLUDED.id, created_at = EXCLUDED.created_at, tag_index = EXCLUDED.tag_index,
+		event = EXCLUDED.event, stored_at = now()
+		WHERE events.created_at < EXCLUDED.created_at
+			OR (events.created_at = EXCLUDED.created_at AND events.id >= EXCLUDED.id)`
+)
+
+// upsertRow is an event as inserted into the events table
+type upsertRow struct {
+	event      *models.Event
+	replaceKey string
+}
+
+// splitForUpsert separates regular events from replaceable ones and keeps
+// one row per ID and per replaceable address, since a statement can't
+// update a row twice
+func splitForUpsert(events []*models.Event) (regular, replaceable []upsertRow) {
+	seen := make(map[string]bool)
+	latest := make(map[string]int)
+	for _, event := range events {
+		if seen[event.ID] {
+			continue
+		}
+		seen[event.ID] = true
+		if !models.IsReplaceableKind(event.Kind) {
+			regular = append(regular, upsertRow{event: event})
+			continue
+		}
+		key := replaceKey(event)
+		if i, ok := latest[key]; ok {
+			if event.Supersedes(replaceable[i].event) {
+				replaceable[i].event = event
+			}
+			continue
+		}
+		latest[key] = len(replaceable)
+		replaceable = append(replaceable, upsertRow{event: event, replaceKey: key})
+	}
+	return regular, replaceable
+}
+
+// replaceKey identifies the versions of a replaceable event: kind and
+// author, and the d tag of addressable kinds
+func replaceKey(event *models.Event) string {
+	key := strconv.Itoa(event.Kind) + ":" + event.PubKey
+	if models.IsAddressableKind(event.Kind) {
+		key += ":" + event.DTag()
+	}
+	return key
+}
+
+// tagIndex lists the single-letter tags of event as "name:value"
+func tagIndex(event *models.Event) []string {
+	index := []string{}
+	for _, tag := range event.IndexTags() {
+		if len(tag) >= 2 && len(tag[0]) == 1 {
+			index = append(index, tag[0]+":"+tag[1])
+		}
+	}
+	return index
+}
+
+// insertEvents builds a multi-row INSERT of rows, resolving conflicts as
+// conflict says
+func (p *PostgresStorage) insertEvents(rows []upsertRow, conflict string) (string, []any) {
+	var query strings.Builder
+	query.WriteString("INSERT INTO events (id, pubkey, kind, created_at, replace_key, tag_index, event) VALUES ")
+	args := make([]any, 0, len(rows)*7)
+	for i, row := range rows {
+		if i > 0 {
+			query.WriteString(", ")
+		}
+		n := len(args)
+		fmt.Fprintf(&query, "($%d, $%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6, n+7)
+		var key any
+		if row.replaceKey != "" {
+			key = row.replaceKey
+		}
+		data, _ := json.Marshal(encodeEvent(p.codec, row.event))
+		args = append(args, row.event.ID, row.event.PubKey, row.event.Kind, int64(row.event.CreatedAt),
+			key, tagIndex(row.event), string(data))
+	}
+	query.WriteString(" ")
+	query.WriteString(conflict)
+	return query.String(), args
+}
+
+// GetEvent loads an event by ID
+func (p *PostgresStorage) GetEvent(ctx context.Context, eventID string) (*models.Event, error) {
+	events, err := p.query(ctx, "SELECT event FROM events WHERE id = $1", eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event: %w", err)
+	}
+	if len(events) == 0 {
+		return nil, ErrEventNotFound
+	}
+	return events[0], nil
+}
+
+// QueryEvents returns the stored events matching the NIP-01 conditions of
+// filter, newest first, up to its limit. Search is not applied.
+func (p *PostgresStorage) QueryEvents(ctx context.Context, filter nostr.Filter) (events []*models.Event, err error) {
+	ctx, done := traceQuery(ctx, "postgres", filter)
+	defer func() { done(events, err) }()
+
+	query, args := selectEvents(filter)
+	events, err = p.query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %w", err)
+	}
+	return events, nil
+}
+
+// selectEvents builds the SELECT answering filter, its limit capped at
+// maxQueryLimit
+func selectEvents(filter nostr.Filter) (string, []any) {
+	var conditions []string
+	var args []any
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+	if len(filter.IDs) > 0 {
+		where("id = ANY($%d::text[])", filter.IDs)
+	}
+	if len(filter.Authors) > 0 {
+		where("pubkey = ANY($%d::text[])", filter.Authors)
+	}
+	if len(filter.Kinds) > 0 {
+		where("kind = ANY($%d::integer[])", filter.Kinds)
+	}
+	if filter.Since != nil {
+		where("created_at >= $%d", int64(*filter.Since))
+	}
+	if filter.Until != nil {
+		where("created_at <= $%d", int64(*filter.Until))
+	}
+	for name, values := range filter.Tags {
+		if values == nil {
+			continue
+		}
+		index := make([]string, len(values))
+		for i, value := range values {
+			index[i] = name + ":" + value
+		}
+		where("tag_index && $%d::text[]", index)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > maxQueryLimit {
+		limit = maxQueryLimit
+	}
+	query := "SELECT event FROM events"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, limit)
+	query += fmt.Sprintf(" ORDER BY created_at DESC, id LIMIT $%d", len(args))
+	return query, args
+}
+
+// ScanEvents pages through every stored event in ID order
+func (p *PostgresStorage) ScanEvents(ctx context.Context, cursor string, limit int) ([]*models.Event, string, error) {
+	events, err := p.query(ctx, "SELECT event FROM events WHERE id > $1 ORDER BY id LIMIT $2", cursor, limit)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to scan events: %w", err)
+	}
+	next := ""
+	if len(events) == limit && limit > 0 {
+		next = events[len(events)-1].ID
+	}
+	return events, next, nil
+}
+
+func (p *PostgresStorage) query(ctx context.Context, query string, args ...any) ([]*models.Event, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.Event
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var stored storedEvent
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return nil, fmt.Errorf("failed to decode event: %w", err)
+		}
+		event, err := decodeEvent(p.codec, &stored)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// DeleteEvent removes an event by ID
+func (p *PostgresStorage) DeleteEvent(eventID string) error {
+	if _, err := p.db.Exec("DELETE FROM events WHERE id = $1", eventID); err != nil {
+		return fmt.Errorf("failed to delete event: %w", err)
+	}
+	return nil
+}
+
+// GetStats reports the event count and the size of the events table
+func (p *PostgresStorage) GetStats() (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	var events sql.NullInt64
+	var size int64
+	// The planner's estimate, since counting a large table is slow
+	err := p.db.QueryRowContext(ctx, `SELECT
+		(SELECT reltuples::bigint FROM pg_class WHERE relname = 'events'),
+		pg_total_relation_size('events')`).Scan(&events, &size)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get stats: %w", err)
+	}
+	pool := p.db.Stats()
+	stats := map[string]interface{}{
+		"backend":         "postgres",
+		"events_estimate": max(events.Int64, 0),
+		"size_bytes":      size,
+		"pool": map[string]interface{}{
+			"in_use": pool.InUse,
+			"idle":   pool.Idle,
+			"max":    pool.MaxOpenConnections,
+		},
+	}
+	if p.codec != nil {
+		stats["compression"] = p.codec.GetStats()
+	}
+	return stats, nil
+}
+
+// Close closes the connections
+func (p *PostgresStorage) Close() error {
+	return p.db.Close()
+}
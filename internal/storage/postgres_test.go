@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"mercury-relay/internal/compress"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func testEvent(id string, kind int, createdAt nostr.Timestamp, tags nostr.Tags) *models.Event {
+	return &models.Event{ID: id, PubKey: "alice", Kind: kind, CreatedAt: createdAt, Tags: tags, Content: "content of " + id}
+}
+
+func TestSplitForUpsert(t *testing.T) {
+	note := testEvent("n1", 1, 100, nil)
+	profile := testEvent("p1", 0, 100, nil)
+	newerProfile := testEvent("p2", 0, 200, nil)
+	articleA := testEvent("a1", 30023, 100, nostr.Tags{{"d", "a"}})
+	articleB := testEvent("b1", 30023, 100, nostr.Tags{{"d", "b"}})
+
+	regular, replaceable := splitForUpsert([]*models.Event{note, note, newerProfile, profile, articleA, articleB})
+	helpers.AssertIntEqual(t, 1, len(regular))
+	helpers.AssertStringEqual(t, "n1", regular[0].event.ID)
+	helpers.AssertStringEqual(t, "", regular[0].replaceKey)
+
+	// One row per address, the latest version of each
+	helpers.AssertIntEqual(t, 3, len(replaceable))
+	helpers.AssertStringEqual(t, "p2", replaceable[0].event.ID)
+	helpers.AssertStringEqual(t, "0:alice", replaceable[0].replaceKey)
+	helpers.AssertStringEqual(t, "30023:alice:a", replaceable[1].replaceKey)
+	helpers.AssertStringEqual(t, "30023:alice:b", replaceable[2].replaceKey)
+}
+
+func TestReplaceKey(t *testing.T) {
+	// Only addressable kinds are keyed by their d tag
+	helpers.AssertStringEqual(t, "10002:alice", replaceKey(testEvent("r", 10002, 0, nostr.Tags{{"d", "ignored"}})))
+	helpers.AssertStringEqual(t, "30023:alice:", replaceKey(testEvent("a", 30023, 0, nil)))
+	helpers.AssertStringEqual(t, "30041:alice:chapter-1", replaceKey(testEvent("c", 30041, 0, nostr.Tags{{"d", "chapter-1"}})))
+}
+
+func TestTagIndex(t *testing.T) {
+	event := testEvent("n1", 1, 0, nostr.Tags{{"e", "root", "", "root"}, {"t", "Books"}, {"alt", "long name"}, {"p"}})
+	helpers.AssertStringEqual(t, "[e:root t:Books]", fmt.Sprint(tagIndex(event)))
+
+	// Normalized values are indexed in place of the signed ones
+	event.NormalizedTags = nostr.Tags{{"e", "root"}, {"t", "books"}}
+	helpers.AssertStringEqual(t, "[e:root t:books]", fmt.Sprint(tagIndex(event)))
+
+	// An event without tags indexes an empty array, not NULL
+	index := tagIndex(testEvent("n2", 1, 0, nil))
+	helpers.AssertTrue(t, index != nil)
+	helpers.AssertIntEqual(t, 0, len(index))
+}
+
+func TestInsertEvents(t *testing.T) {
+	p, err := OpenPostgres(config.PostgresConfig{})
+	helpers.AssertNoError(t, err)
+	defer p.Close()
+
+	regular, replaceable := splitForUpsert([]*models.Event{
+		testEvent("n1", 1, 100, nostr.Tags{{"t", "nostr"}}),
+		testEvent("n2", 1, 200, nil),
+		testEvent("a1", 30023, 300, nostr.Tags{{"d", "a"}}),
+	})
+
+	query, args := p.insertEvents(regular, insertOnIDConflict)
+	helpers.AssertStringEqual(t, "INSERT INTO events (id, pubkey, kind, created_at, replace_key, tag_index, event) VALUES "+
+		"($1, $2, $3, $4, $5, $6, $7), ($8, $9, $10, $11, $12, $13, $14) "+insertOnIDConflict, query)
+	helpers.AssertIntEqual(t, 14, len(args))
+	helpers.AssertEqual(t, "n1", args[0])
+	helpers.AssertEqual(t, 1, args[2])
+	helpers.AssertEqual(t, int64(100), args[3])
+	helpers.AssertNil(t, args[4])
+	helpers.AssertStringEqual(t, "[t:nostr]", fmt.Sprint(args[5]))
+
+	var stored storedEvent
+	helpers.AssertNoError(t, json.Unmarshal([]byte(args[6].(string)), &stored))
+	helpers.AssertStringEqual(t, "content of n1", stored.Content)
+	helpers.AssertStringEqual(t, "", stored.ContentEncoding)
+
+	query, args = p.insertEvents(replaceable, insertOnReplaceConflict)
+	helpers.AssertTrue(t, strings.HasSuffix(query, insertOnReplaceConflict))
+	helpers.AssertEqual(t, "30023:alice:a", args[4])
+
+	// Every parameter of a full batch is numbered
+	rows := make([]upsertRow, postgresBatchRows)
+	for i := range rows {
+		rows[i] = upsertRow{event: testEvent(fmt.Sprint(i), 1, 0, nil)}
+	}
+	query, args = p.insertEvents(rows, insertOnIDConflict)
+	helpers.AssertIntEqual(t, 7*postgresBatchRows, len(args))
+	helpers.AssertStringContains(t, query, fmt.Sprintf("$%d)", 7*postgresBatchRows))
+}
+
+func TestPostgresCompression(t *testing.T) {
+	codec, err := compress.NewCodec(config.CompressionConfig{Enabled: true, Kinds: []int{30023}, MinSize: 16})
+	helpers.AssertNoError(t, err)
+	p, err := OpenPostgres(config.PostgresConfig{})
+	helpers.AssertNoError(t, err)
+	defer p.Close()
+	p.SetCodec(codec)
+
+	article := testEvent("a1", 30023, 100, nostr.Tags{{"d", "a"}})
+	article.Content = strings.Repeat("The messenger crossed the mountains. ", 20)
+	_, replaceable := splitForUpsert([]*models.Event{article})
+	_, args := p.insertEvents(replaceable, insertOnReplaceConflict)
+
+	// The row holds compressed content, which reads back as the original
+	var stored storedEvent
+	helpers.AssertNoError(t, json.Unmarshal([]byte(args[6].(string)), &stored))
+	helpers.AssertStringEqual(t, compress.EncodingZstd, stored.ContentEncoding)
+	helpers.AssertTrue(t, len(stored.Content) < len(article.Content))
+
+	event, err := decodeEvent(p.codec, &stored)
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, article.Content, event.Content)
+
+	// Compressed rows can't be read without the codec
+	_, err = decodeEvent(nil, &stored)
+	helpers.AssertErrorContains(t, err, "compression is not configured")
+}
+
+func TestPostgresDSN(t *testing.T) {
+	for _, test := range []struct {
+		cfg config.PostgresConfig
+		dsn string
+	}{
+		{
+			config.PostgresConfig{Host: "db.example:5433", User: "mercury", Password: `it's a \ secret`, DBName: "mercury", SSLMode: "verify-full"},
+			`host='db.example' port='5433' user='mercury' password='it\'s a \\ secret' dbname='mercury' sslmode='verify-full' connect_timeout='10'`,
+		},
+		{
+			config.PostgresConfig{Host: "localhost", User: "mercury"},
+			`host='localhost' user='mercury' connect_timeout='10'`,
+		},
+		{
+			// A socket directory
+			config.PostgresConfig{Host: "/var/run/postgresql", DBName: "mercury"},
+			`host='/var/run/postgresql' dbname='mercury' connect_timeout='10'`,
+		},
+	} {
+		helpers.AssertStringEqual(t, test.dsn, postgresDSN(test.cfg))
+	}
+
+	// Settings the driver rejects fail at open
+	_, err := OpenPostgres(config.PostgresConfig{Host: "localhost", SSLMode: "sometimes"})
+	helpers.AssertError(t, err)
+}
+
+func TestSelectEvents(t *testing.T) {
+	since, until := nostr.Timestamp(100), nostr.Timestamp(200)
+
+	tests := []struct {
+		name   string
+		filter nostr.Filter
+		query  string
+		args   []any
+	}{
+		{
+			name:   "Empty filter",
+			filter: nostr.Filter{},
+			query:  "SELECT event FROM events ORDER BY created_at DESC, id LIMIT $1",
+			args:   []any{maxQueryLimit},
+		},
+		{
+			name:   "NIP-01 conditions",
+			filter: nostr.Filter{IDs: []string{"e1"}, Authors: []string{"alice", "bob"}, Kinds: []int{1, 30023}, Since: &since, Until: &until, Limit: 10},
+			query: "SELECT event FROM events WHERE id = ANY($1::text[]) AND pubkey = ANY($2::text[]) AND kind = ANY($3::integer[])" +
+				" AND created_at >= $4 AND created_at <= $5 ORDER BY created_at DESC, id LIMIT $6",
+			args: []any{[]string{"e1"}, []string{"alice", "bob"}, []int{1, 30023}, int64(100), int64(200), 10},
+		},
+		{
+			name:   "Tag conditions",
+			filter: nostr.Filter{Tags: nostr.TagMap{"t": {"nostr", "books"}, "p": nil}},
+			query:  "SELECT event FROM events WHERE tag_index && $1::text[] ORDER BY created_at DESC, id LIMIT $2",
+			args:   []any{[]string{"t:nostr", "t:books"}, maxQueryLimit},
+		},
+		{
+			name:   "Limits above the cap",
+			filter: nostr.Filter{Limit: maxQueryLimit + 1},
+			query:  "SELECT event FROM events ORDER BY created_at DESC, id LIMIT $1",
+			args:   []any{maxQueryLimit},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, args := selectEvents(test.filter)
+			helpers.AssertStringEqual(t, test.query, query)
+			helpers.AssertStringEqual(t, fmt.Sprint(test.args), fmt.Sprint(args))
+		})
+	}
+}
@@ -0,0 +1,361 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"mercury-relay/internal/compress"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+	_ "modernc.org/sqlite"
+)
+
+const sqliteFileName = "events.db"
+
+// sqliteSchema lists the schema versions in order; the database records the
+// ones applied in its user_version
+var sqliteSchema = []string{
+	// Events as in Postgres, one row per event and one per replaceable
+	// address. event_tags indexes the single-letter tags as name:value.
+	`CREATE TABLE events (
+		id          TEXT PRIMARY KEY,
+		pubkey      TEXT NOT NULL,
+		kind        INTEGER NOT NULL,
+		created_at  INTEGER NOT NULL,
+		replace_key TEXT UNIQUE,
+		event       TEXT NOT NULL
+	);
+	CREATE INDEX events_created_at_idx ON events (created_at DESC);
+	CREATE INDEX events_pubkey_created_at_idx ON events (pubkey, created_at DESC);
+	CREATE INDEX events_kind_created_at_idx ON events (kind, created_at DESC);
+	CREATE TABLE event_tags (
+		event_id TEXT NOT NULL,
+		tag      TEXT NOT NULL
+	);
+	CREATE INDEX event_tags_tag_idx ON event_tags (tag, event_id);
+	CREATE INDEX event_tags_event_id_idx ON event_tags (event_id);`,
+}
+
+// SQLiteStorage keeps events in a SQLite database under a directory, so a
+// single binary gets indexed queries without running Postgres. It follows
+// the Postgres store: only the latest version of replaceable events is kept
+// and single-letter tags are indexed for filter queries. The driver is pure
+// Go, so no cgo is needed.
+type SQLiteStorage struct {
+	db    *sql.DB
+	path  string
+	codec *compress.Codec
+}
+
+// NewSQLite opens the database in dir, creating it and upgrading its schema
+// as needed
+func NewSQLite(dir string) (*SQLiteStorage, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	path := filepath.Join(dir, sqliteFileName)
+	// WAL lets queries run while events are written; writes take the lock
+	// up front so concurrent transactions wait instead of failing
+	db, err := sql.Open("sqlite", "file:"+path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(10000)&_pragma=synchronous(NORMAL)&_txlock=immediate")
+	if err != nil {
+		return nil, fmt.Errorf("failed to open sqlite database: %w", err)
+	}
+	s := &SQLiteStorage{db: db, path: path}
+	if err := s.migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// migrate applies the schema versions the database doesn't have yet
+func (s *SQLiteStorage) migrate(ctx context.Context) error {
+	var version int
+	if err := s.db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read sqlite schema version: %w", err)
+	}
+	if version > len(sqliteSchema) {
+		return fmt.Errorf("sqlite schema is at version %d, newer than this relay's %d", version, len(sqliteSchema))
+	}
+	for ; version < len(sqliteSchema); version++ {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to migrate sqlite: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, sqliteSchema[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to migrate sqlite to version %d: %w", version+1, err)
+		}
+		// PRAGMA takes no parameters
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", version+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to migrate sqlite to version %d: %w", version+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to migrate sqlite to version %d: %w", version+1, err)
+		}
+	}
+	return nil
+}
+
+// SetCodec compresses event content as it is stored and decompresses it as
+// it is read
+func (s *SQLiteStorage) SetCodec(codec *compress.Codec) {
+	s.codec = codec
+}
+
+// StoreEvent saves event, replacing an older version of a replaceable
+// event. Storing an event again updates its relay metadata.
+func (s *SQLiteStorage) StoreEvent(event *models.Event) error {
+	return s.StoreEvents(context.Background(), []*models.Event{event})
+}
+
+// StoreEvents saves events in one transaction
+func (s *SQLiteStorage) StoreEvents(ctx context.Context, events []*models.Event) error {
+	regular, replaceable := splitForUpsert(events)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to store events: %w", err)
+	}
+	for _, row := range append(regular, replaceable...) {
+		if err := s.storeRow(ctx, tx, row); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to store events: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to store events: %w", err)
+	}
+	return nil
+}
+
+// storeRow upserts one event. A replaceable event only replaces an older
+// version, or one as old with a higher ID (NIP-01).
+func (s *SQLiteStorage) storeRow(ctx context.Context, tx *sql.Tx, row upsertRow) error {
+	var key any
+	if row.replaceKey != "" {
+		key = row.replaceKey
+		current := &models.Event{}
+		err := tx.QueryRowContext(ctx, "SELECT id, created_at FROM events WHERE replace_key = ?", row.replaceKey).
+			Scan(&current.ID, &current.CreatedAt)
+		switch {
+		case err == sql.ErrNoRows:
+		case err != nil:
+			return err
+		case current.ID == row.event.ID:
+		case !row.event.Supersedes(current):
+			return nil
+		default:
+			if err := deleteSQLiteEvent(ctx, tx, current.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	data, err := json.Marshal(encodeEvent(s.codec, row.event))
+	if err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO events (id, pubkey, kind, created_at, replace_key, event)
+		VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (id) DO UPDATE SET event = excluded.event`,
+		row.event.ID, row.event.PubKey, row.event.Kind, int64(row.event.CreatedAt), key, string(data))
+	if err != nil {
+		return err
+	}
+
+	// Normalized tags are relay metadata and may change when an event is
+	// stored again
+	if _, err := tx.ExecContext(ctx, "DELETE FROM event_tags WHERE event_id = ?", row.event.ID); err != nil {
+		return err
+	}
+	for _, tag := range tagIndex(row.event) {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO event_tags (event_id, tag) VALUES (?, ?)", row.event.ID, tag); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetEvent loads an event by ID
+func (s *SQLiteStorage) GetEvent(ctx context.Context, eventID string) (*models.Event, error) {
+	events, err := s.query(ctx, "SELECT event FROM events WHERE id = ?", eventID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get event: %w", err)
+	}
+	if len(events) == 0 {
+		return nil, ErrEventNotFound
+	}
+	return events[0], nil
+}
+
+// QueryEvents returns the stored events matching the NIP-01 conditions of
+// filter, newest first, up to its limit. Search is not applied.
+func (s *SQLiteStorage) QueryEvents(ctx context.Context, filter nostr.Filter) (events []*models.Event, err error) {
+	ctx, done := traceQuery(ctx, "sqlite", filter)
+	defer func() { done(events, err) }()
+
+	query, args := selectSQLiteEvents(filter)
+	events, err = s.query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query events: %w", err)
+	}
+	return events, nil
+}
+
+// selectSQLiteEvents builds the SELECT answering filter, its limit capped
+// at maxQueryLimit
+func selectSQLiteEvents(filter nostr.Filter) (string, []any) {
+	var conditions []string
+	var args []any
+	where := func(condition string, values ...any) {
+		conditions = append(conditions, condition)
+		args = append(args, values...)
+	}
+	if len(filter.IDs) > 0 {
+		where("id IN ("+placeholders(len(filter.IDs))+")", anySlice(filter.IDs)...)
+	}
+	if len(filter.Authors) > 0 {
+		where("pubkey IN ("+placeholders(len(filter.Authors))+")", anySlice(filter.Authors)...)
+	}
+	if len(filter.Kinds) > 0 {
+		where("kind IN ("+placeholders(len(filter.Kinds))+")", anySlice(filter.Kinds)...)
+	}
+	if filter.Since != nil {
+		where("created_at >= ?", int64(*filter.Since))
+	}
+	if filter.Until != nil {
+		where("created_at <= ?", int64(*filter.Until))
+	}
+	for name, values := range filter.Tags {
+		if values == nil {
+			continue
+		}
+		index := make([]any, len(values))
+		for i, value := range values {
+			index[i] = name + ":" + value
+		}
+		where("id IN (SELECT event_id FROM event_tags WHERE tag IN ("+placeholders(len(index))+"))", index...)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > maxQueryLimit {
+		limit = maxQueryLimit
+	}
+	query := "SELECT event FROM events"
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, limit)
+	return query + " ORDER BY created_at DESC, id LIMIT ?", args
+}
+
+// placeholders returns n comma-separated parameter markers
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func anySlice[T any](values []T) []any {
+	result := make([]any, len(values))
+	for i, value := range values {
+		result[i] = value
+	}
+	return result
+}
+
+// ScanEvents pages through every stored event in ID order
+func (s *SQLiteStorage) ScanEvents(ctx context.Context, cursor string, limit int) ([]*models.Event, string, error) {
+	events, err := s.query(ctx, "SELECT event FROM events WHERE id > ? ORDER BY id LIMIT ?", cursor, limit)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to scan events: %w", err)
+	}
+	next := ""
+	if len(events) == limit && limit > 0 {
+		next = events[len(events)-1].ID
+	}
+	return events, next, nil
+}
+
+func (s *SQLiteStorage) query(ctx context.Context, query string, args ...any) ([]*models.Event, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var events []*models.Event
+	for rows.Next() {
+		var data []byte
+		if err := rows.Scan(&data); err != nil {
+			return nil, err
+		}
+		var stored storedEvent
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return nil, fmt.Errorf("failed to decode event: %w", err)
+		}
+		event, err := decodeEvent(s.codec, &stored)
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+	return events, rows.Err()
+}
+
+// DeleteEvent removes an event by ID
+func (s *SQLiteStorage) DeleteEvent(eventID string) error {
+	ctx := context.Background()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete event: %w", err)
+	}
+	if err := deleteSQLiteEvent(ctx, tx, eventID); err != nil {
+		tx.Rollback()
+		return fmt.Errorf("failed to delete event: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to delete event: %w", err)
+	}
+	return nil
+}
+
+func deleteSQLiteEvent(ctx context.Context, tx *sql.Tx, eventID string) error {
+	if _, err := tx.ExecContext(ctx, "DELETE FROM event_tags WHERE event_id = ?", eventID); err != nil {
+		return err
+	}
+	_, err := tx.ExecContext(ctx, "DELETE FROM events WHERE id = ?", eventID)
+	return err
+}
+
+// GetStats reports the event count and the size of the database
+func (s *SQLiteStorage) GetStats() (map[string]interface{}, error) {
+	var events int64
+	if err := s.db.QueryRow("SELECT count(*) FROM events").Scan(&events); err != nil {
+		return nil, fmt.Errorf("failed to get stats: %w", err)
+	}
+	var size int64
+	for _, path := range []string{s.path, s.path + "-wal"} {
+		if info, err := os.Stat(path); err == nil {
+			size += info.Size()
+		}
+	}
+	stats := map[string]interface{}{
+		"backend":    "sqlite",
+		"events":     events,
+		"size_bytes": size,
+	}
+	if s.codec != nil {
+		stats["compression"] = s.codec.GetStats()
+	}
+	return stats, nil
+}
+
+// Close closes the database
+func (s *SQLiteStorage) Close() error {
+	return s.db.Close()
+}
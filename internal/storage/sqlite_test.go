@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestSQLiteStorage(t *testing.T) {
+	testLocalStore(t, func(dir string) (localStore, error) {
+		return NewSQLite(dir)
+	})
+}
+
+func TestSQLiteStorageBatches(t *testing.T) {
+	store, err := NewSQLite(t.TempDir())
+	helpers.AssertNoError(t, err)
+	defer store.Close()
+	ctx := context.Background()
+
+	// One transaction takes duplicates and several versions of an address
+	helpers.AssertNoError(t, store.StoreEvents(ctx, []*models.Event{
+		testEvent("n1", 1, 100, nil),
+		testEvent("n1", 1, 100, nil),
+		testEvent("p1", 0, 100, nil),
+		testEvent("p2", 0, 200, nil),
+	}))
+	events, err := store.QueryEvents(ctx, nostr.Filter{})
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 2, len(events))
+	helpers.AssertStringEqual(t, "p2", events[0].ID)
+
+	// A replaced version's tags no longer match
+	helpers.AssertNoError(t, store.StoreEvent(testEvent("a1", 30023, 100, nostr.Tags{{"d", "a"}, {"t", "draft"}})))
+	helpers.AssertNoError(t, store.StoreEvent(testEvent("a2", 30023, 200, nostr.Tags{{"d", "a"}})))
+	events, err = store.QueryEvents(ctx, nostr.Filter{Tags: nostr.TagMap{"t": {"draft"}}})
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 0, len(events))
+
+	var tags int
+	helpers.AssertNoError(t, store.db.QueryRow("SELECT count(*) FROM event_tags WHERE event_id = 'a1'").Scan(&tags))
+	helpers.AssertIntEqual(t, 0, tags)
+
+	stats, err := store.GetStats()
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, "sqlite", stats["backend"].(string))
+	helpers.AssertInt64Equal(t, 3, stats["events"].(int64))
+	helpers.AssertTrue(t, stats["size_bytes"].(int64) > 0)
+}
+
+func TestSQLiteSchema(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewSQLite(dir)
+	helpers.AssertNoError(t, err)
+	var version int
+	helpers.AssertNoError(t, store.db.QueryRow("PRAGMA user_version").Scan(&version))
+	helpers.AssertIntEqual(t, len(sqliteSchema), version)
+	helpers.AssertNoError(t, store.Close())
+
+	// Reopening applies nothing twice
+	store, err = NewSQLite(dir)
+	helpers.AssertNoError(t, err)
+
+	// A database from a newer relay is refused
+	_, err = store.db.Exec(fmt.Sprintf("PRAGMA user_version = %d", len(sqliteSchema)+1))
+	helpers.AssertNoError(t, err)
+	helpers.AssertNoError(t, store.Close())
+	_, err = NewSQLite(dir)
+	helpers.AssertErrorContains(t, err, "newer than this relay's")
+}
+
+func TestSelectSQLiteEvents(t *testing.T) {
+	since := nostr.Timestamp(100)
+
+	query, args := selectSQLiteEvents(nostr.Filter{})
+	helpers.AssertStringEqual(t, "SELECT event FROM events ORDER BY created_at DESC, id LIMIT ?", query)
+	helpers.AssertStringEqual(t, fmt.Sprint([]any{maxQueryLimit}), fmt.Sprint(args))
+
+	query, args = selectSQLiteEvents(nostr.Filter{
+		IDs:     []string{"e1", "e2"},
+		Authors: []string{"alice"},
+		Kinds:   []int{1, 30023},
+		Since:   &since,
+		Tags:    nostr.TagMap{"t": {"nostr", "books"}, "p": nil},
+		Limit:   10,
+	})
+	helpers.AssertStringEqual(t, "SELECT event FROM events WHERE id IN (?, ?) AND pubkey IN (?) AND kind IN (?, ?)"+
+		" AND created_at >= ? AND id IN (SELECT event_id FROM event_tags WHERE tag IN (?, ?))"+
+		" ORDER BY created_at DESC, id LIMIT ?", query)
+	helpers.AssertStringEqual(t, fmt.Sprint([]any{"e1", "e2", "alice", 1, 30023, int64(100), "t:nostr", "t:books", 10}), fmt.Sprint(args))
+}
@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"context"
+
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/tracing"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// traceQuery begins a span for a storage query; the returned function ends
+// it with the query's outcome
+func traceQuery(ctx context.Context, backend string, filter nostr.Filter) (context.Context, func([]*models.Event, error)) {
+	ctx, span := tracing.Start(ctx, tracing.KindClient, "storage query", "storage.backend", backend, "filter", filter.String())
+	return ctx, func(events []*models.Event, err error) {
+		span.RecordError(err)
+		span.SetAttributes("events", len(events))
+		span.End()
+	}
+}
@@ -1,12 +1,17 @@
 package storage
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
+	"strconv"
 	"time"
 
+	"mercury-relay/internal/compress"
 	"mercury-relay/internal/config"
 	"mercury-relay/internal/models"
 )
@@ -15,6 +20,7 @@ type XFTPStorage struct {
 	config     config.XFTPConfig
 	httpClient *http.Client
 	baseURL    string
+	codec      *compress.Codec
 }
 
 func NewXFTP(config config.XFTPConfig) (*XFTPStorage, error) {
@@ -35,15 +41,20 @@ func NewXFTP(config config.XFTPConfig) (*XFTPStorage, error) {
 	}, nil
 }
 
+// SetCodec compresses event content on upload and decompresses it on download
+func (x *XFTPStorage) SetCodec(codec *compress.Codec) {
+	x.codec = codec
+}
+
 func (x *XFTPStorage) StoreEvent(event *models.Event) error {
 	// Convert event to JSON
-	_, err := json.Marshal(event)
+	data, err := json.Marshal(encodeEvent(x.codec, event))
 	if err != nil {
 		return fmt.Errorf("failed to marshal event: %w", err)
 	}
 
 	// Create XFTP upload request
-	req, err := http.NewRequest("POST", x.baseURL+"/upload", nil)
+	req, err := http.NewRequest("POST", x.baseURL+"/upload", bytes.NewReader(data))
 	if err != nil {
 		return fmt.Errorf("failed to create request: %w", err)
 	}
@@ -69,9 +80,9 @@ func (x *XFTPStorage) StoreEvent(event *models.Event) error {
 	return nil
 }
 
-func (x *XFTPStorage) GetEvent(eventID string) (*models.Event, error) {
+func (x *XFTPStorage) GetEvent(ctx context.Context, eventID string) (*models.Event, error) {
 	// Create XFTP download request
-	req, err := http.NewRequest("GET", x.baseURL+"/download/"+eventID, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", x.baseURL+"/download/"+eventID, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -84,7 +95,7 @@ func (x *XFTPStorage) GetEvent(eventID string) (*models.Event, error) {
 	defer resp.Body.Close()
 
 	if resp.StatusCode == http.StatusNotFound {
-		return nil, fmt.Errorf("event not found")
+		return nil, ErrEventNotFound
 	}
 
 	if resp.StatusCode != http.StatusOK {
@@ -92,12 +103,12 @@ func (x *XFTPStorage) GetEvent(eventID string) (*models.Event, error) {
 	}
 
 	// Parse response
-	var event models.Event
-	if err := json.NewDecoder(resp.Body).Decode(&event); err != nil {
+	var stored storedEvent
+	if err := json.NewDecoder(resp.Body).Decode(&stored); err != nil {
 		return nil, fmt.Errorf("failed to decode event: %w", err)
 	}
 
-	return &event, nil
+	return decodeEvent(x.codec, &stored)
 }
 
 func (x *XFTPStorage) DeleteEvent(eventID string) error {
@@ -146,9 +157,56 @@ func (x *XFTPStorage) GetStats() (map[string]interface{}, error) {
 		return nil, fmt.Errorf("failed to decode stats: %w", err)
 	}
 
+	if x.codec != nil {
+		stats["compression"] = x.codec.GetStats()
+	}
+
 	return stats, nil
 }
 
+// ScanEvents lists stored events in upload order, resuming after cursor
+func (x *XFTPStorage) ScanEvents(ctx context.Context, cursor string, limit int) ([]*models.Event, string, error) {
+	params := url.Values{}
+	params.Set("limit", strconv.Itoa(limit))
+	if cursor != "" {
+		params.Set("cursor", cursor)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", x.baseURL+"/list?"+params.Encode(), nil)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to create request: %w", err)
+	}
+
+	resp, err := x.httpClient.Do(req)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list events: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, "", fmt.Errorf("list failed with status: %d", resp.StatusCode)
+	}
+
+	var page struct {
+		Events []*storedEvent `json:"events"`
+		Next   string         `json:"next"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&page); err != nil {
+		return nil, "", fmt.Errorf("failed to decode event list: %w", err)
+	}
+
+	events := make([]*models.Event, 0, len(page.Events))
+	for _, stored := range page.Events {
+		event, err := decodeEvent(x.codec, stored)
+		if err != nil {
+			return nil, "", err
+		}
+		events = append(events, event)
+	}
+
+	return events, page.Next, nil
+}
+
 func (x *XFTPStorage) Close() error {
 	// XFTP storage doesn't need explicit cleanup
 	return nil
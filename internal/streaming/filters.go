@@ -0,0 +1,253 @@
+package streaming
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/mirror"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// defaultLimit is how many stored events a subscription asks for
+const defaultLimit = 1000
+
+// UpstreamFilters turns the filters configured for relay into REQ filters.
+// A relay without filters gets one filter matching everything.
+func UpstreamFilters(relay config.UpstreamRelay) ([]nostr.Filter, error) {
+	if len(relay.Filters) == 0 {
+		return []nostr.Filter{{Limit: defaultLimit}}, nil
+	}
+
+	filters := make([]nostr.Filter, 0, len(relay.Filters))
+	for _, f := range relay.Filters {
+		filter := nostr.Filter{Kinds: f.Kinds, Limit: f.Limit}
+		if filter.Limit <= 0 {
+			filter.Limit = defaultLimit
+		}
+		for _, author := range f.Authors {
+			pubkey, err := mirror.ParsePubkey(author)
+			if err != nil {
+				return nil, fmt.Errorf("invalid filter for %s: %w", relay.URL, err)
+			}
+			filter.Authors = append(filter.Authors, pubkey)
+		}
+		if len(f.Tags) > 0 {
+			filter.Tags = make(nostr.TagMap, len(f.Tags))
+			for name, values := range f.Tags {
+				filter.Tags[strings.TrimPrefix(name, "#")] = values
+			}
+		}
+		filters = append(filters, filter)
+	}
+	return filters, nil
+}
+
+// matchesFilters reports whether event matches one of conn's configured
+// filters. Relays may ignore parts of a filter, so events are checked
+// again here.
+func (conn *UpstreamConnection) matchesFilters(event *models.Event) bool {
+	conn.subMutex.RLock()
+	filters, all := conn.filters, len(conn.Relay.Filters) == 0
+	conn.subMutex.RUnlock()
+	if all {
+		return true
+	}
+	nostrEvent := event.ToNostrEvent()
+	for _, filter := range filters {
+		// The limit only applies to stored events
+		filter.Limit = 0
+		if filter.Matches(nostrEvent) {
+			return true
+		}
+	}
+	return false
+}
+
+// setRelay gives conn a new configuration and the filters built from it
+func (conn *UpstreamConnection) setRelay(relay config.UpstreamRelay, filters []nostr.Filter) {
+	conn.subMutex.Lock()
+	defer conn.subMutex.Unlock()
+	conn.Relay = relay
+	conn.filters = filters
+}
+
+// relayConfig returns the configuration conn was last given
+func (conn *UpstreamConnection) relayConfig() config.UpstreamRelay {
+	conn.subMutex.RLock()
+	defer conn.subMutex.RUnlock()
+	return conn.Relay
+}
+
+// UpdateRelays applies a new upstream relay list: new relays are added to
+// the failover ranking, removed and disabled ones are disconnected, and
+// connected relays whose filters changed are re-subscribed
+func (u *UpstreamManager) UpdateRelays(relays []config.UpstreamRelay) error {
+	u.relayMutex.Lock()
+	defer u.relayMutex.Unlock()
+	u.statsMutex.Lock()
+	follow := u.followRelays
+	u.statsMutex.Unlock()
+	return u.applyRelays(relays, follow)
+}
+
+// SetFollowRelays streams from the relays the owner's follows publish to,
+// next to the configured upstream relays. They rank after the configured
+// ones, and a relay that is configured keeps its configured filters.
+func (u *UpstreamManager) SetFollowRelays(relays []config.UpstreamRelay) error {
+	u.relayMutex.Lock()
+	defer u.relayMutex.Unlock()
+	u.statsMutex.Lock()
+	configured := u.config.UpstreamRelays
+	u.statsMutex.Unlock()
+	return u.applyRelays(configured, relays)
+}
+
+// mergeRelays appends the follow relays not configured already to the
+// configured ones, with a priority after all of them
+func mergeRelays(configured, follow []config.UpstreamRelay) []config.UpstreamRelay {
+	if len(follow) == 0 {
+		return configured
+	}
+	merged := make([]config.UpstreamRelay, 0, len(configured)+len(follow))
+	known := make(map[string]bool, len(configured))
+	priority := 0
+	for _, relay := range configured {
+		merged = append(merged, relay)
+		known[relay.URL] = true
+		priority = max(priority, relay.Priority+1)
+	}
+	for _, relay := range follow {
+		if known[relay.URL] {
+			continue
+		}
+		known[relay.URL] = true
+		relay.Priority = priority
+		merged = append(merged, relay)
+	}
+	return merged
+}
+
+// applyRelays connects to the configured and follow relays. Callers must
+// hold u.relayMutex.
+func (u *UpstreamManager) applyRelays(configured, follow []config.UpstreamRelay) error {
+	relays := mergeRelays(configured, follow)
+	filters := make(map[string][]nostr.Filter, len(relays))
+	for _, relay := range relays {
+		f, err := UpstreamFilters(relay)
+		if err != nil {
+			return err
+		}
+		filters[relay.URL] = f
+	}
+
+	u.statsMutex.Lock()
+	u.config.UpstreamRelays = configured
+	u.followRelays = follow
+	u.statsMutex.Unlock()
+
+	enabled := make(map[string]bool, len(relays))
+	var changed []config.UpstreamRelay
+
+	u.healthMutex.Lock()
+	for i, relay := range relays {
+		if !relay.Enabled {
+			continue
+		}
+		enabled[relay.URL] = true
+		h, ok := u.health[relay.URL]
+		if !ok {
+			u.health[relay.URL] = &relayHealth{relay: relay, index: i}
+			continue
+		}
+		if !reflect.DeepEqual(h.relay.Filters, relay.Filters) {
+			changed = append(changed, relay)
+		}
+		h.relay = relay
+		h.index = i
+	}
+	for url, h := range u.health {
+		if enabled[url] {
+			continue
+		}
+		if h.running {
+			h.cancel()
+		}
+		delete(u.health, url)
+	}
+	u.healthMutex.Unlock()
+
+	u.connMutex.RLock()
+	for _, relay := range relays {
+		if conn, ok := u.connections[relay.URL]; ok {
+			conn.setRelay(relay, filters[relay.URL])
+		}
+	}
+	u.connMutex.RUnlock()
+
+	for _, relay := range changed {
+		u.connMutex.RLock()
+		conn, ok := u.connections[relay.URL]
+		u.connMutex.RUnlock()
+		if ok {
+			conn.log.Info("Upstream filters changed, re-subscribing")
+			go u.subscribe(conn)
+		}
+	}
+	return nil
+}
+
+// subscribe closes conn's subscriptions and opens one with its configured
+// filters
+func (u *UpstreamManager) subscribe(conn *UpstreamConnection) {
+	conn.writeMutex.Lock()
+	defer conn.writeMutex.Unlock()
+	if d := u.config.Deadlines.Subscribe; d > 0 {
+		conn.Conn.SetWriteDeadline(time.Now().Add(d))
+		defer conn.Conn.SetWriteDeadline(time.Time{})
+	}
+
+	conn.subMutex.Lock()
+	filters, filtered := conn.filters, len(conn.Relay.Filters) > 0
+	var open []string
+	for id := range conn.Subscriptions {
+		open = append(open, id)
+		delete(conn.Subscriptions, id)
+	}
+	conn.subMutex.Unlock()
+	for _, id := range open {
+		if err := conn.Conn.WriteJSON([]interface{}{"CLOSE", id}); err != nil {
+			u.removeConnection(conn, fmt.Errorf("failed to close subscription: %w", err))
+			return
+		}
+	}
+
+	subID := fmt.Sprintf("all-events-%d", time.Now().UnixNano())
+	if filtered {
+		subID = fmt.Sprintf("filtered-%d", time.Now().UnixNano())
+	}
+	req := []interface{}{"REQ", subID}
+	for _, filter := range filters {
+		req = append(req, filter)
+	}
+	if err := conn.Conn.WriteJSON(req); err != nil {
+		conn.log.Error("Failed to subscribe", "error", err)
+		u.removeConnection(conn, fmt.Errorf("failed to subscribe: %w", err))
+		return
+	}
+	conn.progress.subscribed(time.Now())
+
+	conn.subMutex.Lock()
+	conn.Subscriptions[subID] = &UpstreamSubscription{
+		ID:      subID,
+		Filters: filters,
+		Active:  true,
+	}
+	conn.subMutex.Unlock()
+
+	conn.log.Info("Subscribed to upstream relay", "subscription", subID, "filters", len(filters))
+}
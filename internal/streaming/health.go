@@ -0,0 +1,312 @@
+package streaming
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+
+	"mercury-relay/internal/config"
+)
+
+// Upstream relay states
+const (
+	StateConnected  = "connected"  // subscribed and streaming
+	StateConnecting = "connecting" // dialing or subscribing
+	StateBackoff    = "backoff"    // failed, waiting for next_attempt
+	StateStandby    = "standby"    // healthy, not needed while better relays are up
+)
+
+// healthWindow is how many recent sessions the error rate is taken over
+const healthWindow = 10
+
+// minSessions is how many sessions a relay needs before its error rate
+// counts
+const minSessions = 3
+
+// UpstreamHealth is the health of one upstream relay, as the admin API
+// reports it
+type UpstreamHealth struct {
+	URL         string     `json:"url"`
+	Priority    int        `json:"priority"`
+	State       string     `json:"state"`
+	Healthy     bool       `json:"healthy"`
+	LatencyMs   int64      `json:"latency_ms"`
+	ErrorRate   float64    `json:"error_rate"`
+	Failures    int        `json:"failures"` // consecutive
+	Stalls      int        `json:"stalls"`
+	LastEOSE    *time.Time `json:"last_eose,omitempty"`
+	LastEvent   *time.Time `json:"last_event,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	NextAttempt *time.Time `json:"next_attempt,omitempty"`
+}
+
+// relayHealth tracks one enabled upstream relay across reconnects
+type relayHealth struct {
+	relay config.UpstreamRelay
+	index int // position in the config, breaking priority ties
+
+	running     bool // a session is connecting or connected
+	connected   bool
+	connectedAt time.Time
+	cancel      context.CancelFunc
+
+	failures    int
+	sessions    []bool // recent session outcomes, true for failures
+	nextAttempt time.Time
+	lastError   string
+	latency     time.Duration
+	pingSentAt  time.Time
+	lastEOSE    time.Time
+}
+
+// errorRate is the share of recent sessions that failed
+func (h *relayHealth) errorRate() float64 {
+	if len(h.sessions) == 0 {
+		return 0
+	}
+	failed := 0
+	for _, failure := range h.sessions {
+		if failure {
+			failed++
+		}
+	}
+	return float64(failed) / float64(len(h.sessions))
+}
+
+// healthy reports whether h passes the error rate and latency checks
+func (u *UpstreamManager) healthy(h *relayHealth) bool {
+	failover := u.config.Failover
+	if failover.MaxErrorRate > 0 && len(h.sessions) >= minSessions && h.errorRate() > failover.MaxErrorRate {
+		return false
+	}
+	if failover.MaxLatency > 0 && h.latency > failover.MaxLatency {
+		return false
+	}
+	return true
+}
+
+// backoff is how long to wait after failures consecutive failed sessions:
+// the reconnect interval, doubling with every failure up to MaxBackoff
+func (u *UpstreamManager) backoff(failures int) time.Duration {
+	delay := max(u.config.ReconnectInterval, time.Second)
+	limit := max(u.config.Failover.MaxBackoff, delay)
+	for i := 1; i < failures && delay < limit; i++ {
+		delay *= 2
+	}
+	return min(delay, limit)
+}
+
+// supervise connects to the best upstream relays and keeps re-ranking them
+// until ctx is done
+func (u *UpstreamManager) supervise(ctx context.Context) {
+	interval := u.config.Failover.CheckInterval
+	if interval <= 0 {
+		interval = 10 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	u.rebalance(ctx, time.Now())
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			u.rebalance(ctx, now)
+		}
+	}
+}
+
+// rebalance starts sessions to the relays that should be connected and
+// stops the stand-ins once the relays they replaced are back. Relays rank
+// healthy first, then by priority (lowest first); relays backing off are
+// skipped.
+func (u *UpstreamManager) rebalance(ctx context.Context, now time.Time) {
+	u.healthMutex.Lock()
+	defer u.healthMutex.Unlock()
+
+	ranked := make([]*relayHealth, 0, len(u.health))
+	for _, h := range u.health {
+		if h.running || !now.Before(h.nextAttempt) {
+			ranked = append(ranked, h)
+		}
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		if ha, hb := u.healthy(a), u.healthy(b); ha != hb {
+			return ha
+		}
+		if a.relay.Priority != b.relay.Priority {
+			return a.relay.Priority < b.relay.Priority
+		}
+		return a.index < b.index
+	})
+
+	wanted := len(ranked)
+	if limit := u.config.Failover.MaxActive; limit > 0 && limit < wanted {
+		wanted = limit
+	}
+	desired := make(map[*relayHealth]bool, wanted)
+	connected := 0
+	for _, h := range ranked[:wanted] {
+		desired[h] = true
+		if h.connected {
+			connected++
+		}
+		if !h.running {
+			u.startSession(ctx, h)
+		}
+	}
+
+	// Stand-ins keep streaming until the relays they replaced are connected
+	if connected < wanted {
+		return
+	}
+	for _, h := range u.health {
+		if h.running && !desired[h] {
+			log.Printf("Upstream relay %s no longer needed, failing back", h.relay.URL)
+			h.cancel()
+		}
+	}
+}
+
+// startSession connects to h's relay in the background. Callers must hold
+// u.healthMutex.
+func (u *UpstreamManager) startSession(ctx context.Context, h *relayHealth) {
+	sessionCtx, cancel := context.WithCancel(ctx)
+	h.running = true
+	h.cancel = cancel
+	go func() {
+		defer cancel()
+		err := u.establishConnection(sessionCtx, h.relay)
+		u.sessionEnded(h, err, sessionCtx.Err() != nil, time.Now())
+	}()
+}
+
+// sessionConnected records that h's relay accepted the connection, dialing
+// in dial
+func (u *UpstreamManager) sessionConnected(url string, dial time.Duration, now time.Time) {
+	u.healthMutex.Lock()
+	defer u.healthMutex.Unlock()
+	if h, ok := u.health[url]; ok {
+		h.connected = true
+		h.connectedAt = now
+		h.latency = dial
+	}
+}
+
+// sessionEnded records the outcome of a session. Sessions that failed to
+// connect or dropped within StableAfter count as failures and back off;
+// sessions stopped on purpose count as neither.
+func (u *UpstreamManager) sessionEnded(h *relayHealth, err error, stopped bool, now time.Time) {
+	u.healthMutex.Lock()
+	defer u.healthMutex.Unlock()
+
+	wasConnected, connectedAt := h.connected, h.connectedAt
+	h.running = false
+	h.connected = false
+	if stopped {
+		return
+	}
+
+	failure := !wasConnected || now.Sub(connectedAt) < u.config.Failover.StableAfter
+	h.sessions = append(h.sessions, failure)
+	if len(h.sessions) > healthWindow {
+		h.sessions = h.sessions[len(h.sessions)-healthWindow:]
+	}
+	if err != nil {
+		h.lastError = err.Error()
+	}
+	if failure {
+		h.failures++
+	} else {
+		h.failures = 0
+	}
+	delay := u.backoff(max(h.failures, 1))
+	h.nextAttempt = now.Add(delay)
+	log.Printf("Upstream relay %s disconnected (%v), retrying in %s", h.relay.URL, err, delay)
+}
+
+// pingSent and pongReceived measure the round trip of keepalive pings
+func (u *UpstreamManager) pingSent(url string, at time.Time) {
+	u.healthMutex.Lock()
+	defer u.healthMutex.Unlock()
+	if h, ok := u.health[url]; ok {
+		h.pingSentAt = at
+	}
+}
+
+func (u *UpstreamManager) pongReceived(url string, at time.Time) {
+	u.healthMutex.Lock()
+	defer u.healthMutex.Unlock()
+	if h, ok := u.health[url]; ok && !h.pingSentAt.IsZero() {
+		h.latency = at.Sub(h.pingSentAt)
+		h.pingSentAt = time.Time{}
+	}
+}
+
+// recordEOSE notes that url finished sending stored events
+func (u *UpstreamManager) recordEOSE(url string, at time.Time) {
+	u.healthMutex.Lock()
+	defer u.healthMutex.Unlock()
+	if h, ok := u.health[url]; ok {
+		h.lastEOSE = at
+	}
+}
+
+// Health returns the health of every enabled upstream relay by priority
+func (u *UpstreamManager) Health() []UpstreamHealth {
+	now := time.Now()
+
+	u.statsMutex.Lock()
+	lastEvents := make(map[string]time.Time, len(u.lastEvents))
+	for url, at := range u.lastEvents {
+		lastEvents[url] = at
+	}
+	stalls := copyCounts(u.stalls)
+	u.statsMutex.Unlock()
+
+	u.healthMutex.Lock()
+	defer u.healthMutex.Unlock()
+	health := make([]UpstreamHealth, 0, len(u.health))
+	for url, h := range u.health {
+		status := UpstreamHealth{
+			URL:       url,
+			Priority:  h.relay.Priority,
+			Healthy:   u.healthy(h),
+			LatencyMs: h.latency.Milliseconds(),
+			ErrorRate: h.errorRate(),
+			Failures:  h.failures,
+			Stalls:    stalls[url],
+			LastError: h.lastError,
+		}
+		switch {
+		case h.connected:
+			status.State = StateConnected
+		case h.running:
+			status.State = StateConnecting
+		case now.Before(h.nextAttempt):
+			status.State = StateBackoff
+			next := h.nextAttempt
+			status.NextAttempt = &next
+		default:
+			status.State = StateStandby
+		}
+		if !h.lastEOSE.IsZero() {
+			at := h.lastEOSE
+			status.LastEOSE = &at
+		}
+		if at, ok := lastEvents[url]; ok {
+			status.LastEvent = &at
+		}
+		health = append(health, status)
+	}
+	sort.Slice(health, func(i, j int) bool {
+		if health[i].Priority != health[j].Priority {
+			return health[i].Priority < health[j].Priority
+		}
+		return health[i].URL < health[j].URL
+	})
+	return health
+}
@@ -0,0 +1,68 @@
+package streaming
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"mercury-relay/internal/maintenance"
+	"mercury-relay/internal/models"
+)
+
+// pausedIngest holds accepted upstream events while writes are paused
+type pausedIngest struct {
+	events  []pausedEvent
+	dropped int
+	mu      sync.Mutex
+}
+
+type pausedEvent struct {
+	conn  *UpstreamConnection
+	event *models.Event
+}
+
+// hold buffers event, dropping it once limit events are held
+func (p *pausedIngest) hold(conn *UpstreamConnection, event *models.Event, limit int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if limit > 0 && len(p.events) >= limit {
+		p.dropped++
+		return
+	}
+	p.events = append(p.events, pausedEvent{conn: conn, event: event})
+}
+
+// take empties the buffer and returns what it held and how many events were
+// dropped
+func (p *pausedIngest) take() ([]pausedEvent, int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	events, dropped := p.events, p.dropped
+	p.events, p.dropped = nil, 0
+	return events, dropped
+}
+
+// SetMaintenance buffers upstream events while writes are paused and stores
+// them once writes resume
+func (u *UpstreamManager) SetMaintenance(mode *maintenance.Mode) {
+	u.maintenance = mode
+	mode.OnChange(func(state maintenance.State) {
+		if !state.Enabled {
+			go u.resumeIngest()
+		}
+	})
+}
+
+// resumeIngest stores the upstream events held during maintenance
+func (u *UpstreamManager) resumeIngest() {
+	events, dropped := u.paused.take()
+	if dropped > 0 {
+		log.Printf("Dropped %d upstream events during maintenance, the buffer was full", dropped)
+	}
+	for _, held := range events {
+		u.storeEvent(context.Background(), held.conn, held.event)
+	}
+	log.Printf("Stored %d upstream events held during maintenance", len(events))
+}
@@ -3,17 +3,30 @@ package streaming
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/url"
 	"sync"
 	"time"
 
 	"mercury-relay/internal/cache"
+	"mercury-relay/internal/classify"
 	"mercury-relay/internal/config"
+	"mercury-relay/internal/logging"
+	"mercury-relay/internal/maintenance"
+	"mercury-relay/internal/mirror"
 	"mercury-relay/internal/models"
+	"mercury-relay/internal/normalize"
+	"mercury-relay/internal/profiling"
 	"mercury-relay/internal/quality"
 	"mercury-relay/internal/queue"
+	"mercury-relay/internal/seen"
+	"mercury-relay/internal/tracing"
+	"mercury-relay/internal/trust"
+	"mercury-relay/internal/wire"
 
 	"github.com/gorilla/websocket"
 	"github.com/nbd-wtf/go-nostr"
@@ -25,23 +38,63 @@ type UpstreamManager struct {
 	rabbitMQ       queue.Queue
 	cache          cache.Cache
 	connections    map[string]*UpstreamConnection
-	connMutex      sync.RWMutex
+	connMutex      profiling.RWMutex
 	transportMgr   *TransportManager
+	classifier     *classify.Classifier
+	normalizer     *normalize.Normalizer
+	mirror         *mirror.Mirror
+	maintenance    *maintenance.Mode
+	labeler        *trust.Labeler
+	seen           *seen.Index
+	paused         pausedIngest
+
+	// Watchdog history per upstream URL, kept across reconnects
+	lastEvents map[string]time.Time
+	stalls     map[string]int
+
+	// Health and failover state per upstream URL, see health.go
+	health      map[string]*relayHealth
+	healthMutex sync.Mutex
+
+	// Relays the owner's follows publish to, see filters.go
+	followRelays []config.UpstreamRelay
+	relayMutex   sync.Mutex
+
+	// Classification counters for analytics
+	languageCounts map[string]int
+	topicCounts    map[string]int
+	filtered       map[string]int
+	statsMutex     sync.Mutex
 }
 
 type UpstreamConnection struct {
 	URL           string
+	Relay         config.UpstreamRelay
 	Conn          *websocket.Conn
 	Active        bool
 	LastPing      time.Time
 	Subscriptions map[string]*UpstreamSubscription
 	subMutex      sync.RWMutex
+	writeMutex    sync.Mutex // serializes REQ and CLOSE writes
+
+	// filters are built from Relay.Filters, see filters.go
+	filters []nostr.Filter
+
+	// id names this connection in logs and in the trace ID of its events
+	id  string
+	log *slog.Logger
+
+	// Deadline tracking, see watchdog.go
+	progress  connProgress
+	cancel    context.CancelFunc
+	closeOnce sync.Once
+	closeErr  error
 }
 
 type UpstreamSubscription struct {
-	ID     string
-	Filter nostr.Filter
-	Active bool
+	ID      string
+	Filters []nostr.Filter
+	Active  bool
 }
 
 type TransportManager struct {
@@ -57,7 +110,7 @@ func NewUpstreamManager(
 	rabbitMQ queue.Queue,
 	cache cache.Cache,
 ) *UpstreamManager {
-	return &UpstreamManager{
+	u := &UpstreamManager{
 		config:         config,
 		qualityControl: qualityControl,
 		rabbitMQ:       rabbitMQ,
@@ -69,7 +122,46 @@ func NewUpstreamManager(
 			httpStreaming: config.TransportMethods.HTTPStreaming,
 			sseEnabled:    config.TransportMethods.SSE,
 		},
+		languageCounts: make(map[string]int),
+		topicCounts:    make(map[string]int),
+		filtered:       make(map[string]int),
+		lastEvents:     make(map[string]time.Time),
+		stalls:         make(map[string]int),
+		health:         make(map[string]*relayHealth),
+	}
+	if config.Classification.Enabled {
+		u.classifier = classify.NewClassifier(config.Classification.Topics)
 	}
+	return u
+}
+
+// SetNormalizer canonicalizes tag values of upstream events before they are
+// cached
+func (u *UpstreamManager) SetNormalizer(normalizer *normalize.Normalizer) {
+	u.normalizer = normalizer
+}
+
+// SetMirror keeps every upstream event of a mirrored author, however old or
+// off-topic
+func (u *UpstreamManager) SetMirror(m *mirror.Mirror) {
+	u.mirror = m
+}
+
+// SetTrustLabeler labels every upstream event with how the relay knows its
+// author
+func (u *UpstreamManager) SetTrustLabeler(labeler *trust.Labeler) {
+	u.labeler = labeler
+}
+
+// SetSeenIndex drops copies of events already accepted, as other upstream
+// relays send the same events
+func (u *UpstreamManager) SetSeenIndex(index *seen.Index) {
+	u.seen = index
+}
+
+// SetProfiler reports contention on the upstream connection map
+func (u *UpstreamManager) SetProfiler(p *profiling.Sampler) {
+	p.Track("upstream.connMutex", &u.connMutex)
 }
 
 func (u *UpstreamManager) Start(ctx context.Context) error {
@@ -78,34 +170,22 @@ func (u *UpstreamManager) Start(ctx context.Context) error {
 		return nil
 	}
 
-	// Start connections to upstream relays
-	for _, relay := range u.config.UpstreamRelays {
+	// Connect to the best upstream relays and fail over between them
+	u.healthMutex.Lock()
+	for i, relay := range u.config.UpstreamRelays {
 		if relay.Enabled {
-			go u.connectToRelay(ctx, relay)
+			u.health[relay.URL] = &relayHealth{relay: relay, index: i}
 		}
 	}
+	u.healthMutex.Unlock()
+	go u.supervise(ctx)
 
-	// Start connection health monitoring
-	go u.monitorConnections(ctx)
+	// Tear down connections that miss a deadline
+	go u.watchdog(ctx)
 
 	return nil
 }
 
-func (u *UpstreamManager) connectToRelay(ctx context.Context, relay config.UpstreamRelay) {
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		default:
-			if err := u.establishConnection(ctx, relay); err != nil {
-				log.Printf("Failed to connect to relay %s: %v", relay.URL, err)
-				time.Sleep(u.config.ReconnectInterval)
-				continue
-			}
-		}
-	}
-}
-
 func (u *UpstreamManager) establishConnection(ctx context.Context, relay config.UpstreamRelay) error {
 	// Parse relay URL
 	relayURL, err := url.Parse(relay.URL)
@@ -133,6 +213,11 @@ func (u *UpstreamManager) establishConnection(ctx context.Context, relay config.
 }
 
 func (u *UpstreamManager) establishWebSocketConnection(ctx context.Context, relay config.UpstreamRelay) error {
+	filters, err := UpstreamFilters(relay)
+	if err != nil {
+		return err
+	}
+
 	// Determine transport method
 	var dialer websocket.Dialer
 	if u.transportMgr.torEnabled {
@@ -142,37 +227,61 @@ func (u *UpstreamManager) establishWebSocketConnection(ctx context.Context, rela
 	}
 
 	// Connect to relay
-	conn, _, err := dialer.Dial(relay.URL, nil)
+	dialCtx := ctx
+	if d := u.config.Deadlines.Dial; d > 0 {
+		var cancel context.CancelFunc
+		dialCtx, cancel = context.WithTimeout(ctx, d)
+		defer cancel()
+	}
+	dialStart := time.Now()
+	conn, _, err := dialer.DialContext(dialCtx, relay.URL, nil)
 	if err != nil {
 		return fmt.Errorf("failed to dial relay: %w", err)
 	}
+	u.sessionConnected(relay.URL, time.Since(dialStart), time.Now())
+	conn.SetPongHandler(func(string) error {
+		u.pongReceived(relay.URL, time.Now())
+		return nil
+	})
 
-	// Create connection object
+	// Create connection object; cancelling connCtx stops its goroutines
+	connCtx, cancel := context.WithCancel(ctx)
 	upstreamConn := &UpstreamConnection{
 		URL:           relay.URL,
+		Relay:         relay,
 		Conn:          conn,
 		Active:        true,
 		LastPing:      time.Now(),
 		Subscriptions: make(map[string]*UpstreamSubscription),
+		filters:       filters,
+		cancel:        cancel,
+		id:            logging.NewID(),
 	}
+	upstreamConn.log = slog.With(logging.KeyRelay, relay.URL, logging.KeyConnID, upstreamConn.id)
+	upstreamConn.progress.connected(time.Now())
 
 	// Store connection
 	u.connMutex.Lock()
 	u.connections[relay.URL] = upstreamConn
 	u.connMutex.Unlock()
 
-	log.Printf("Connected to upstream relay: %s", relay.URL)
+	upstreamConn.log.Info("Connected to upstream relay")
 
 	// Start message handling
-	go u.handleUpstreamMessages(ctx, upstreamConn)
+	go u.handleUpstreamMessages(connCtx, upstreamConn)
 
-	// Start subscription to all events
-	go u.subscribeToAllEvents(ctx, upstreamConn)
+	// Subscribe with the relay's filters
+	go u.subscribe(upstreamConn)
 
-	// Keep connection alive
-	u.keepAlive(ctx, upstreamConn)
+	// Keep connection alive until it is torn down
+	u.keepAlive(connCtx, upstreamConn)
+	u.removeConnection(upstreamConn, ctx.Err())
 
-	return nil
+	if ctx.Err() != nil {
+		return nil
+	}
+	// Report why, so the reconnect waits out the reconnect interval
+	return upstreamConn.closeReason()
 }
 
 func (u *UpstreamManager) handleUpstreamMessages(ctx context.Context, conn *UpstreamConnection) {
@@ -183,182 +292,223 @@ func (u *UpstreamManager) handleUpstreamMessages(ctx context.Context, conn *Upst
 		case <-ctx.Done():
 			return
 		default:
+			if d := u.config.Deadlines.Idle; d > 0 {
+				conn.Conn.SetReadDeadline(time.Now().Add(d))
+			}
 			_, message, err := conn.Conn.ReadMessage()
 			if err != nil {
-				if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-					log.Printf("Upstream connection error: %v", err)
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					err = fmt.Errorf("no message for %s", u.config.Deadlines.Idle)
+					conn.log.Warn("Upstream relay went idle, reconnecting")
+				} else if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+					conn.log.Warn("Upstream connection error", "error", err)
 				}
-				u.removeConnection(conn.URL)
+				u.removeConnection(conn, err)
 				return
 			}
+			conn.progress.message(time.Now())
 
 			if err := u.handleUpstreamMessage(conn, message); err != nil {
-				log.Printf("Error handling upstream message: %v", err)
+				conn.log.Warn("Error handling upstream message", "error", err)
 			}
 		}
 	}
 }
 
 func (u *UpstreamManager) handleUpstreamMessage(conn *UpstreamConnection, message []byte) error {
-	var msg []interface{}
-	if err := json.Unmarshal(message, &msg); err != nil {
-		return fmt.Errorf("invalid JSON: %w", err)
-	}
-
-	if len(msg) < 2 {
-		return fmt.Errorf("message too short")
-	}
-
-	msgType, ok := msg[0].(string)
-	if !ok {
-		return fmt.Errorf("invalid message type")
+	msg, err := wire.ParseMessage(message)
+	if err != nil {
+		return err
 	}
 
-	switch msgType {
+	switch msg.Type {
 	case "EVENT":
-		return u.handleUpstreamEvent(conn, msg[1:])
+		u.recordEvent(conn, time.Now())
+		return u.handleUpstreamEvent(conn, msg.Args)
 	case "EOSE":
-		return u.handleUpstreamEOSE(conn, msg[1:])
+		conn.progress.answered()
+		return u.handleUpstreamEOSE(conn, msg.Args)
 	case "NOTICE":
-		return u.handleUpstreamNotice(conn, msg[1:])
+		return u.handleUpstreamNotice(conn, msg.Args)
 	default:
-		log.Printf("Unknown upstream message type: %s", msgType)
+		conn.log.Debug("Unknown upstream message type", "type", msg.Type)
 	}
 
 	return nil
 }
 
-func (u *UpstreamManager) handleUpstreamEvent(conn *UpstreamConnection, args []interface{}) error {
+func (u *UpstreamManager) handleUpstreamEvent(conn *UpstreamConnection, args []json.RawMessage) error {
 	if len(args) < 2 {
 		return fmt.Errorf("EVENT requires subscription ID and event data")
 	}
 
-	_, ok := args[0].(string)
-	if !ok {
+	if _, ok := wire.String(args[0]); !ok {
 		return fmt.Errorf("invalid subscription ID")
 	}
 
-	eventData, ok := args[1].(map[string]interface{})
-	if !ok {
-		return fmt.Errorf("invalid event data")
+	// Every tag value is kept so the event stays verifiable
+	event, err := wire.ParseEvent(args[1])
+	if err != nil {
+		return err
 	}
 
-	// Parse event
-	event := &models.Event{}
-	if id, ok := eventData["id"].(string); ok {
-		event.ID = id
-	}
-	if pubkey, ok := eventData["pubkey"].(string); ok {
-		event.PubKey = pubkey
-	}
-	if createdAt, ok := eventData["created_at"].(float64); ok {
-		event.CreatedAt = nostr.Timestamp(createdAt)
-	}
-	if kind, ok := eventData["kind"].(float64); ok {
-		event.Kind = int(kind)
-	}
-	if content, ok := eventData["content"].(string); ok {
-		event.Content = content
-	}
-	if sig, ok := eventData["sig"].(string); ok {
-		event.Sig = sig
+	// Copies from other relays were processed when they first arrived
+	if u.seen != nil && u.seen.Seen(seen.SourceUpstream, event.ID) {
+		return nil
 	}
 
-	// Parse tags
-	if tags, ok := eventData["tags"].([]interface{}); ok {
-		for _, tag := range tags {
-			if tagArray, ok := tag.([]interface{}); ok && len(tagArray) >= 2 {
-				if tagType, ok := tagArray[0].(string); ok {
-					if tagValue, ok := tagArray[1].(string); ok {
-						event.Tags = append(event.Tags, []string{tagType, tagValue})
-					}
-				}
-			}
+	ctx, span := tracing.Start(context.Background(), tracing.KindConsumer, "upstream EVENT",
+		logging.KeyRelay, conn.URL, logging.KeyEventID, event.ID, "event.kind", event.Kind)
+	defer span.End()
+
+	// Events of mirrored authors are kept verbatim once their signature checks out
+	if u.mirror != nil && u.mirror.IsMirrored(event.PubKey) {
+		if ok, err := event.ToNostrEvent().CheckSignature(); err != nil || !ok {
+			conn.log.Warn("Upstream event of a mirrored author has a bad signature", logging.KeyEventID, event.ID)
+			return nil
 		}
+		u.mirror.Mark(event)
+		event.QualityScore = event.CalculateQualityScore()
+		return u.storeEvent(ctx, conn, event)
 	}
 
 	// Validate event
 	if err := event.Validate(); err != nil {
-		log.Printf("Invalid upstream event: %v", err)
+		conn.log.Debug("Invalid upstream event", logging.KeyEventID, event.ID, "error", err)
+		return nil
+	}
+
+	// Relays may send more than was asked for
+	if !conn.matchesFilters(event) {
+		u.statsMutex.Lock()
+		u.filtered[conn.URL]++
+		u.statsMutex.Unlock()
+		return nil
+	}
+
+	// Classify and apply the relay's language/topic rules
+	if !u.classifyEvent(conn, event) {
 		return nil
 	}
 
 	// Check quality control
-	if err := u.qualityControl.ValidateEvent(event); err != nil {
-		log.Printf("Upstream event failed quality control: %v", err)
+	_, validate := tracing.Start(ctx, tracing.KindInternal, "quality validate")
+	err = u.qualityControl.ValidateEvent(event)
+	validate.RecordError(err)
+	validate.End()
+	if err != nil {
+		conn.log.Debug("Upstream event failed quality control", logging.KeyEventID, event.ID, "error", err)
+		return nil
+	}
+
+	return u.storeEvent(ctx, conn, event)
+}
+
+// storeEvent caches an accepted upstream event and queues it for storage
+func (u *UpstreamManager) storeEvent(ctx context.Context, conn *UpstreamConnection, event *models.Event) error {
+	// Held back while writes are paused
+	if u.maintenance.Active() {
+		u.paused.hold(conn, event, u.config.MaintenanceBuffer)
 		return nil
 	}
 
+	event.AddProvenance(models.ProvenanceUpstream, conn.URL, "")
+	event.TraceID = conn.id
+	if u.labeler != nil {
+		u.labeler.Apply(event)
+	}
+
+	// Canonicalize tag values for indexing
+	if u.normalizer != nil {
+		u.normalizer.Apply(event)
+	}
+
 	// Store in cache
+	_, store := tracing.Start(ctx, tracing.KindClient, "cache store")
 	if err := u.cache.StoreEvent(event); err != nil {
-		log.Printf("Failed to store upstream event in cache: %v", err)
+		store.RecordError(err)
+		conn.log.Error("Failed to store upstream event in cache", logging.KeyEventID, event.ID, logging.KeyTraceID, event.TraceID, "error", err)
 	}
+	store.End()
 
-	// Publish to queue
+	// Publish to queue; consumers continue the trace from the publish span
+	_, publish := tracing.Start(ctx, tracing.KindProducer, "queue publish")
+	event.TraceParent = publish.TraceParent()
 	if err := u.rabbitMQ.PublishEvent(event); err != nil {
-		log.Printf("Failed to publish upstream event: %v", err)
+		publish.RecordError(err)
+		conn.log.Error("Failed to publish upstream event", logging.KeyEventID, event.ID, logging.KeyTraceID, event.TraceID, "error", err)
+	} else if u.seen != nil {
+		u.seen.Add(event.ID)
 	}
+	publish.End()
 
 	return nil
 }
 
-func (u *UpstreamManager) handleUpstreamEOSE(conn *UpstreamConnection, args []interface{}) error {
+// classifyEvent records the detected language and topics on event and
+// reports whether the upstream's rules accept it
+func (u *UpstreamManager) classifyEvent(conn *UpstreamConnection, event *models.Event) bool {
+	if u.classifier == nil {
+		return true
+	}
+
+	var hashtags []string
+	for _, tag := range event.Tags {
+		if len(tag) >= 2 && tag[0] == "t" {
+			hashtags = append(hashtags, tag[1])
+		}
+	}
+
+	result := u.classifier.Classify(event.Content, hashtags)
+	event.Language = result.Language
+	event.Topics = result.Topics
+
+	relay := conn.relayConfig()
+	accepted := result.Matches(relay.Languages, relay.Topics)
+
+	u.statsMutex.Lock()
+	defer u.statsMutex.Unlock()
+	if !accepted {
+		u.filtered[conn.URL]++
+		return false
+	}
+	u.languageCounts[result.Language]++
+	for _, topic := range result.Topics {
+		u.topicCounts[topic]++
+	}
+	return true
+}
+
+func (u *UpstreamManager) handleUpstreamEOSE(conn *UpstreamConnection, args []json.RawMessage) error {
 	if len(args) < 1 {
 		return fmt.Errorf("EOSE requires subscription ID")
 	}
 
-	subID, ok := args[0].(string)
+	subID, ok := wire.String(args[0])
 	if !ok {
 		return fmt.Errorf("invalid subscription ID")
 	}
 
-	log.Printf("End of stored events for subscription %s from relay %s", subID, conn.URL)
+	u.recordEOSE(conn.URL, time.Now())
+	conn.log.Debug("End of stored events", "subscription", subID)
 	return nil
 }
 
-func (u *UpstreamManager) handleUpstreamNotice(conn *UpstreamConnection, args []interface{}) error {
+func (u *UpstreamManager) handleUpstreamNotice(conn *UpstreamConnection, args []json.RawMessage) error {
 	if len(args) < 1 {
 		return fmt.Errorf("NOTICE requires message")
 	}
 
-	message, ok := args[0].(string)
+	message, ok := wire.String(args[0])
 	if !ok {
 		return fmt.Errorf("invalid notice message")
 	}
 
-	log.Printf("Notice from relay %s: %s", conn.URL, message)
+	conn.log.Info("Notice from upstream relay", "notice", message)
 	return nil
 }
 
-func (u *UpstreamManager) subscribeToAllEvents(ctx context.Context, conn *UpstreamConnection) {
-	// Subscribe to all events
-	subID := fmt.Sprintf("all-events-%d", time.Now().Unix())
-
-	req := []interface{}{
-		"REQ",
-		subID,
-		map[string]interface{}{
-			"limit": 1000,
-		},
-	}
-
-	if err := conn.Conn.WriteJSON(req); err != nil {
-		log.Printf("Failed to subscribe to all events: %v", err)
-		return
-	}
-
-	// Store subscription
-	conn.subMutex.Lock()
-	conn.Subscriptions[subID] = &UpstreamSubscription{
-		ID:     subID,
-		Filter: nostr.Filter{Limit: 1000},
-		Active: true,
-	}
-	conn.subMutex.Unlock()
-
-	log.Printf("Subscribed to all events from relay %s with subscription ID %s", conn.URL, subID)
-}
-
 func (u *UpstreamManager) keepAlive(ctx context.Context, conn *UpstreamConnection) {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
@@ -368,48 +518,20 @@ func (u *UpstreamManager) keepAlive(ctx context.Context, conn *UpstreamConnectio
 		case <-ctx.Done():
 			return
 		case <-ticker.C:
-			if err := conn.Conn.WriteMessage(websocket.PingMessage, nil); err != nil {
-				log.Printf("Failed to ping upstream relay %s: %v", conn.URL, err)
-				u.removeConnection(conn.URL)
+			// WriteControl may run alongside the REQ write
+			u.pingSent(conn.URL, time.Now())
+			if err := conn.Conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(pingWriteWait)); err != nil {
+				conn.log.Warn("Failed to ping upstream relay", "error", err)
+				u.removeConnection(conn, fmt.Errorf("failed to ping: %w", err))
 				return
 			}
+			conn.subMutex.Lock()
 			conn.LastPing = time.Now()
+			conn.subMutex.Unlock()
 		}
 	}
 }
 
-func (u *UpstreamManager) monitorConnections(ctx context.Context) {
-	ticker := time.NewTicker(1 * time.Minute)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ctx.Done():
-			return
-		case <-ticker.C:
-			u.connMutex.RLock()
-			for url, conn := range u.connections {
-				if time.Since(conn.LastPing) > u.config.Timeout {
-					log.Printf("Upstream connection %s timed out", url)
-					u.removeConnection(url)
-				}
-			}
-			u.connMutex.RUnlock()
-		}
-	}
-}
-
-func (u *UpstreamManager) removeConnection(url string) {
-	u.connMutex.Lock()
-	defer u.connMutex.Unlock()
-
-	if conn, exists := u.connections[url]; exists {
-		conn.Conn.Close()
-		delete(u.connections, url)
-		log.Printf("Removed connection to relay: %s", url)
-	}
-}
-
 func (u *UpstreamManager) getTorDialer() websocket.Dialer {
 	// TODO: Implement Tor dialer
 	return websocket.Dialer{}
@@ -463,14 +585,59 @@ func (u *UpstreamManager) GetConnectionStats() map[string]interface{} {
 	}
 
 	for url, conn := range u.connections {
+		conn.subMutex.RLock()
 		connStats := map[string]interface{}{
 			"url":           url,
 			"active":        conn.Active,
 			"last_ping":     conn.LastPing,
 			"subscriptions": len(conn.Subscriptions),
 		}
+		conn.subMutex.RUnlock()
+		conn.progress.addStats(connStats)
 		stats["connections"] = append(stats["connections"].([]map[string]interface{}), connStats)
 	}
 
+	u.statsMutex.Lock()
+	relays := mergeRelays(u.config.UpstreamRelays, u.followRelays)
+	upstreams := make(map[string]interface{}, len(relays))
+	for i, relay := range relays {
+		if !relay.Enabled {
+			continue
+		}
+		upstream := map[string]interface{}{
+			"stalls": u.stalls[relay.URL],
+		}
+		if i >= len(u.config.UpstreamRelays) {
+			upstream["follow_relay"] = true
+		}
+		if at, ok := u.lastEvents[relay.URL]; ok {
+			upstream["last_event_at"] = at
+		}
+		upstreams[relay.URL] = upstream
+	}
+	u.statsMutex.Unlock()
+	stats["upstreams"] = upstreams
+
+	if u.classifier != nil {
+		u.statsMutex.Lock()
+		stats["classification"] = map[string]interface{}{
+			"languages": copyCounts(u.languageCounts),
+			"topics":    copyCounts(u.topicCounts),
+			"filtered":  copyCounts(u.filtered),
+		}
+		u.statsMutex.Unlock()
+	}
+	if u.labeler != nil {
+		stats["trust_labels"] = u.labeler.Stats()
+	}
+
 	return stats
 }
+
+func copyCounts(counts map[string]int) map[string]int {
+	out := make(map[string]int, len(counts))
+	for k, v := range counts {
+		out[k] = v
+	}
+	return out
+}
@@ -0,0 +1,155 @@
+package streaming
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// watchdogInterval is how often connections are checked against their
+	// deadlines
+	watchdogInterval = 5 * time.Second
+	// pingWriteWait bounds writing a keepalive ping
+	pingWriteWait = 10 * time.Second
+)
+
+// connProgress records when a connection reached each step, as UnixNano
+// (0 means not yet)
+type connProgress struct {
+	connectedAt  atomic.Int64
+	subscribedAt atomic.Int64
+	lastMessage  atomic.Int64
+	lastEvent    atomic.Int64
+	hasAnswer    atomic.Bool // an EVENT or EOSE arrived since the REQ
+}
+
+func (p *connProgress) connected(at time.Time) {
+	p.connectedAt.Store(at.UnixNano())
+	p.lastMessage.Store(at.UnixNano())
+}
+
+func (p *connProgress) subscribed(at time.Time) {
+	p.subscribedAt.Store(at.UnixNano())
+}
+
+func (p *connProgress) message(at time.Time) {
+	p.lastMessage.Store(at.UnixNano())
+}
+
+func (p *connProgress) answered() {
+	p.hasAnswer.Store(true)
+}
+
+// addStats adds the step timestamps to a connection's stats
+func (p *connProgress) addStats(stats map[string]interface{}) {
+	for name, at := range map[string]*atomic.Int64{
+		"connected_at":    &p.connectedAt,
+		"subscribed_at":   &p.subscribedAt,
+		"last_message_at": &p.lastMessage,
+		"last_event_at":   &p.lastEvent,
+	} {
+		if ns := at.Load(); ns != 0 {
+			stats[name] = time.Unix(0, ns)
+		}
+	}
+}
+
+// recordEvent notes that conn delivered an EVENT
+func (u *UpstreamManager) recordEvent(conn *UpstreamConnection, at time.Time) {
+	conn.progress.lastEvent.Store(at.UnixNano())
+	conn.progress.answered()
+
+	u.statsMutex.Lock()
+	u.lastEvents[conn.URL] = at
+	u.statsMutex.Unlock()
+}
+
+// missedDeadline returns why conn is stuck, or nil while it is on schedule
+func (u *UpstreamManager) missedDeadline(conn *UpstreamConnection, now time.Time) error {
+	deadlines := u.config.Deadlines
+	since := func(ns int64) time.Duration { return now.Sub(time.Unix(0, ns)) }
+
+	subscribedAt := conn.progress.subscribedAt.Load()
+	if subscribedAt == 0 {
+		if deadlines.Subscribe > 0 && since(conn.progress.connectedAt.Load()) > deadlines.Subscribe {
+			return fmt.Errorf("not subscribed within %s of connecting", deadlines.Subscribe)
+		}
+	} else if !conn.progress.hasAnswer.Load() && deadlines.FirstEvent > 0 && since(subscribedAt) > deadlines.FirstEvent {
+		return fmt.Errorf("no EVENT or EOSE within %s of subscribing", deadlines.FirstEvent)
+	}
+
+	// The read deadline catches silence; this catches a reader stuck
+	// handling a message
+	if deadlines.Idle > 0 && since(conn.progress.lastMessage.Load()) > deadlines.Idle {
+		return fmt.Errorf("no message for %s", deadlines.Idle)
+	}
+
+	conn.subMutex.RLock()
+	lastPing := conn.LastPing
+	conn.subMutex.RUnlock()
+	if u.config.Timeout > 0 && now.Sub(lastPing) > u.config.Timeout {
+		return fmt.Errorf("no ping for %s", u.config.Timeout)
+	}
+	return nil
+}
+
+// watchdog tears down connections that missed a deadline; connectToRelay
+// then re-establishes them
+func (u *UpstreamManager) watchdog(ctx context.Context) {
+	ticker := time.NewTicker(watchdogInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			stuck := make(map[*UpstreamConnection]error)
+			u.connMutex.RLock()
+			for _, conn := range u.connections {
+				if reason := u.missedDeadline(conn, now); reason != nil {
+					stuck[conn] = reason
+				}
+			}
+			u.connMutex.RUnlock()
+
+			for conn, reason := range stuck {
+				conn.log.Warn("Upstream relay is stuck, reconnecting", "reason", reason)
+				u.statsMutex.Lock()
+				u.stalls[conn.URL]++
+				u.statsMutex.Unlock()
+				u.removeConnection(conn, reason)
+			}
+		}
+	}
+}
+
+// removeConnection tears conn down for reason and forgets it, unless a newer
+// connection to the same relay has replaced it. Only the first reason is
+// kept.
+func (u *UpstreamManager) removeConnection(conn *UpstreamConnection, reason error) {
+	u.connMutex.Lock()
+	if u.connections[conn.URL] == conn {
+		delete(u.connections, conn.URL)
+		conn.log.Info("Removed connection to upstream relay")
+	}
+	u.connMutex.Unlock()
+
+	conn.closeOnce.Do(func() {
+		conn.closeErr = reason
+		if conn.cancel != nil {
+			conn.cancel()
+		}
+		conn.Conn.Close()
+	})
+}
+
+// closeReason is why conn was torn down
+func (conn *UpstreamConnection) closeReason() error {
+	if conn.closeErr == nil {
+		return fmt.Errorf("connection closed")
+	}
+	return fmt.Errorf("connection closed: %w", conn.closeErr)
+}
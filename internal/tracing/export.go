@@ -0,0 +1,211 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+
+	"mercury-relay/internal/config"
+)
+
+// Exporters
+const (
+	ExporterOTLP   = "otlp"
+	ExporterJaeger = "jaeger"
+	ExporterStdout = "stdout"
+)
+
+// Exporter sends finished spans somewhere
+type Exporter interface {
+	Export(ctx context.Context, spans []*Span) error
+}
+
+// NewExporter returns the exporter cfg names. Jaeger is reached through its
+// OTLP receiver, so it shares the OTLP exporter.
+func NewExporter(cfg config.TracingConfig) (Exporter, error) {
+	switch cfg.Exporter {
+	case "", ExporterOTLP, ExporterJaeger:
+		if cfg.Endpoint == "" {
+			return nil, fmt.Errorf("tracing endpoint is not set")
+		}
+		return &OTLPExporter{
+			endpoint: cfg.Endpoint,
+			headers:  cfg.Headers,
+			service:  cfg.ServiceName,
+			client:   &http.Client{Timeout: cfg.Timeout},
+		}, nil
+	case ExporterStdout:
+		return &WriterExporter{w: os.Stdout, service: cfg.ServiceName}, nil
+	}
+	return nil, fmt.Errorf("unknown tracing exporter %q", cfg.Exporter)
+}
+
+// OTLPExporter posts spans to an OTLP/HTTP endpoint with JSON encoding
+type OTLPExporter struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	client   *http.Client
+}
+
+// Export sends spans as one ExportTraceServiceRequest
+func (e *OTLPExporter) Export(ctx context.Context, spans []*Span) error {
+	body, err := json.Marshal(encodeRequest(e.service, spans))
+	if err != nil {
+		return fmt.Errorf("failed to encode spans: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create export request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to export spans: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("collector answered %s", resp.Status)
+	}
+	return nil
+}
+
+// WriterExporter writes each span as a line of OTLP JSON
+type WriterExporter struct {
+	w       io.Writer
+	service string
+}
+
+// NewWriterExporter returns an exporter writing spans to w
+func NewWriterExporter(w io.Writer, service string) *WriterExporter {
+	return &WriterExporter{w: w, service: service}
+}
+
+// Export writes spans, one per line
+func (e *WriterExporter) Export(ctx context.Context, spans []*Span) error {
+	encoder := json.NewEncoder(e.w)
+	for _, span := range spans {
+		if err := encoder.Encode(encodeSpan(span)); err != nil {
+			return fmt.Errorf("failed to write span: %w", err)
+		}
+	}
+	return nil
+}
+
+// The OTLP JSON encoding: IDs in hex, 64-bit integers as strings
+
+type otlpRequest struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            *otlpStatus     `json:"status,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"` // 2 is error
+	Message string `json:"message,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string         `json:"key"`
+	Value map[string]any `json:"value"`
+}
+
+func encodeRequest(service string, spans []*Span) otlpRequest {
+	encoded := make([]otlpSpan, len(spans))
+	for i, span := range spans {
+		encoded[i] = encodeSpan(span)
+	}
+	return otlpRequest{ResourceSpans: []otlpResourceSpans{{
+		Resource:   otlpResource{Attributes: encodeAttributes([]any{"service.name", service})},
+		ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: "mercury-relay"}, Spans: encoded}},
+	}}}
+}
+
+func encodeSpan(span *Span) otlpSpan {
+	span.mu.Lock()
+	defer span.mu.Unlock()
+	encoded := otlpSpan{
+		TraceID:           hex.EncodeToString(span.sc.TraceID[:]),
+		SpanID:            hex.EncodeToString(span.sc.SpanID[:]),
+		Name:              span.name,
+		Kind:              int(span.kind),
+		StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+		Attributes:        encodeAttributes(span.attrs),
+	}
+	if span.parent != [8]byte{} {
+		encoded.ParentSpanID = hex.EncodeToString(span.parent[:])
+	}
+	if span.err != "" {
+		encoded.Status = &otlpStatus{Code: 2, Message: span.err}
+	}
+	return encoded
+}
+
+// encodeAttributes turns alternating keys and values into OTLP attributes.
+// A trailing key without a value is dropped.
+func encodeAttributes(kv []any) []otlpAttribute {
+	var attrs []otlpAttribute
+	for i := 0; i+1 < len(kv); i += 2 {
+		key, ok := kv[i].(string)
+		if !ok {
+			key = fmt.Sprint(kv[i])
+		}
+		var value map[string]any
+		switch v := kv[i+1].(type) {
+		case string:
+			value = map[string]any{"stringValue": v}
+		case bool:
+			value = map[string]any{"boolValue": v}
+		case int:
+			value = map[string]any{"intValue": strconv.Itoa(v)}
+		case int64:
+			value = map[string]any{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			value = map[string]any{"doubleValue": v}
+		default:
+			value = map[string]any{"stringValue": fmt.Sprint(v)}
+		}
+		attrs = append(attrs, otlpAttribute{Key: key, Value: value})
+	}
+	return attrs
+}
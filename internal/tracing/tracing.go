@@ -0,0 +1,359 @@
+// Package tracing records OpenTelemetry spans of event ingestion and queries
+// and exports them over OTLP/HTTP. Trace context crosses process
+// boundaries as a W3C traceparent: HTTP headers on the way in, and the
+// event's TraceParent through the queue.
+//
+// Without a default tracer every call is a no-op and spans are nil; Span
+// methods accept a nil receiver so callers need not check.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+	mrand "math/rand/v2"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"mercury-relay/internal/config"
+)
+
+// Kind says what side of an operation a span is, as in OTLP
+type Kind int
+
+const (
+	KindInternal Kind = iota + 1
+	KindServer
+	KindClient
+	KindProducer
+	KindConsumer
+)
+
+// TraceParentHeader is the W3C trace context header
+const TraceParentHeader = "traceparent"
+
+// SpanContext identifies a span within its trace
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// Valid reports whether sc has both IDs set
+func (sc SpanContext) Valid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// TraceParent formats sc as a traceparent value, or "" when invalid
+func (sc SpanContext) TraceParent() string {
+	if !sc.Valid() {
+		return ""
+	}
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%x-%x-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceParent reads a version 00 traceparent value
+func ParseTraceParent(value string) (SpanContext, bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, false
+	}
+	var sc SpanContext
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return SpanContext{}, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.Valid()
+}
+
+// Span is one timed operation. Attributes are set as alternating keys and
+// values, like slog.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+	parent [8]byte
+	name   string
+	kind   Kind
+	start  time.Time
+	end    time.Time
+	attrs  []any
+	err    string
+	ended  bool
+	mu     sync.Mutex
+}
+
+// Context returns the span's identity, or an invalid one for a nil span
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.sc
+}
+
+// TraceParent returns the traceparent that continues this span's trace
+func (s *Span) TraceParent() string {
+	return s.Context().TraceParent()
+}
+
+// SetAttributes adds key/value pairs to the span
+func (s *Span) SetAttributes(kv ...any) {
+	if s == nil || !s.sc.Sampled {
+		return
+	}
+	s.mu.Lock()
+	s.attrs = append(s.attrs, kv...)
+	s.mu.Unlock()
+}
+
+// RecordError marks the span failed with err; nil errors are ignored
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil || !s.sc.Sampled {
+		return
+	}
+	s.mu.Lock()
+	s.err = err.Error()
+	s.mu.Unlock()
+}
+
+// End finishes the span and queues it for export. Later calls do nothing.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.end = time.Now()
+	s.mu.Unlock()
+	if s.sc.Sampled {
+		s.tracer.enqueue(s)
+	}
+}
+
+// Tracer creates spans and exports the sampled ones in batches
+type Tracer struct {
+	config   config.TracingConfig
+	exporter Exporter
+	queue    chan *Span
+	dropped  atomic.Int64
+	stop     chan struct{}
+	done     chan struct{}
+	once     sync.Once
+}
+
+// New creates a tracer exporting as cfg says and starts its export loop
+func New(cfg config.TracingConfig) (*Tracer, error) {
+	exporter, err := NewExporter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithExporter(cfg, exporter), nil
+}
+
+// NewWithExporter creates a tracer handing its spans to exporter
+func NewWithExporter(cfg config.TracingConfig, exporter Exporter) *Tracer {
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = 512
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = 5 * time.Second
+	}
+	t := &Tracer{
+		config:   cfg,
+		exporter: exporter,
+		queue:    make(chan *Span, cfg.BatchSize*4),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go t.run()
+	return t
+}
+
+// Start begins a span as a child of the span in ctx, or a new trace
+func (t *Tracer) Start(ctx context.Context, kind Kind, name string, kv ...any) (context.Context, *Span) {
+	return t.start(ctx, SpanFromContext(ctx).Context(), kind, name, kv)
+}
+
+// Continue begins a span as a child of the remote parent in traceparent.
+// Without a valid one it behaves like Start.
+func (t *Tracer) Continue(ctx context.Context, traceparent string, kind Kind, name string, kv ...any) (context.Context, *Span) {
+	parent, ok := ParseTraceParent(traceparent)
+	if !ok {
+		parent = SpanFromContext(ctx).Context()
+	}
+	return t.start(ctx, parent, kind, name, kv)
+}
+
+func (t *Tracer) start(ctx context.Context, parent SpanContext, kind Kind, name string, kv []any) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	span := &Span{tracer: t, name: name, kind: kind, start: time.Now()}
+	if parent.Valid() {
+		span.sc.TraceID = parent.TraceID
+		span.sc.Sampled = parent.Sampled
+		span.parent = parent.SpanID
+	} else {
+		rand.Read(span.sc.TraceID[:])
+		span.sc.Sampled = t.sample()
+	}
+	rand.Read(span.sc.SpanID[:])
+	span.SetAttributes(kv...)
+	return ContextWithSpan(ctx, span), span
+}
+
+func (t *Tracer) sample() bool {
+	switch rate := t.config.SampleRate; {
+	case rate >= 1:
+		return true
+	case rate <= 0:
+		return false
+	default:
+		return mrand.Float64() < rate
+	}
+}
+
+// Dropped returns how many spans were lost because the export queue was full
+func (t *Tracer) Dropped() int64 {
+	return t.dropped.Load()
+}
+
+// Shutdown exports the spans still queued, waiting until ctx is done at most
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	t.once.Do(func() { close(t.stop) })
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Tracer) enqueue(span *Span) {
+	select {
+	case t.queue <- span:
+	default:
+		t.dropped.Add(1)
+	}
+}
+
+// run exports spans once BatchSize are queued or every FlushInterval
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, t.config.BatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		timeout := t.config.Timeout
+		if timeout <= 0 {
+			timeout = 10 * time.Second
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		if err := t.exporter.Export(ctx, batch); err != nil {
+			slog.Warn("Failed to export spans", "spans", len(batch), "error", err)
+		}
+		cancel()
+		batch = make([]*Span, 0, t.config.BatchSize)
+	}
+
+	for {
+		select {
+		case span := <-t.queue:
+			batch = append(batch, span)
+			if len(batch) >= t.config.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-t.stop:
+			for {
+				select {
+				case span := <-t.queue:
+					batch = append(batch, span)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+type contextKey struct{}
+
+// ContextWithSpan returns a context carrying span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, contextKey{}, span)
+}
+
+// SpanFromContext returns the span carried by ctx, or nil
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(contextKey{}).(*Span)
+	return span
+}
+
+var defaultTracer atomic.Pointer[Tracer]
+
+// SetDefault makes t the tracer behind the package functions; nil turns
+// tracing off
+func SetDefault(t *Tracer) {
+	defaultTracer.Store(t)
+}
+
+// Default returns the default tracer, nil when tracing is off
+func Default() *Tracer {
+	return defaultTracer.Load()
+}
+
+// Setup makes a tracer for cfg the default when tracing is enabled. The
+// returned function flushes the spans not yet exported and turns tracing
+// off again.
+func Setup(cfg config.TracingConfig) (func(context.Context) error, error) {
+	if !cfg.Enabled {
+		return func(context.Context) error { return nil }, nil
+	}
+	t, err := New(cfg)
+	if err != nil {
+		return nil, err
+	}
+	SetDefault(t)
+	return func(ctx context.Context) error {
+		SetDefault(nil)
+		return t.Shutdown(ctx)
+	}, nil
+}
+
+// Start begins a span with the default tracer
+func Start(ctx context.Context, kind Kind, name string, kv ...any) (context.Context, *Span) {
+	return Default().Start(ctx, kind, name, kv...)
+}
+
+// Continue begins a span under a remote parent with the default tracer
+func Continue(ctx context.Context, traceparent string, kind Kind, name string, kv ...any) (context.Context, *Span) {
+	return Default().Continue(ctx, traceparent, kind, name, kv...)
+}
@@ -0,0 +1,134 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/test/helpers"
+)
+
+// recorder keeps exported spans
+type recorder struct {
+	spans []*Span
+	mu    sync.Mutex
+}
+
+func (r *recorder) Export(ctx context.Context, spans []*Span) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, spans...)
+	return nil
+}
+
+func TestTraceParent(t *testing.T) {
+	value := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceParent(value)
+	helpers.AssertTrue(t, ok)
+	helpers.AssertTrue(t, sc.Sampled)
+	helpers.AssertStringEqual(t, value, sc.TraceParent())
+
+	for _, bad := range []string{"", "01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01", "00-xyz-00f067aa0ba902b7-01"} {
+		_, ok := ParseTraceParent(bad)
+		helpers.AssertFalse(t, ok)
+	}
+	helpers.AssertStringEqual(t, "", SpanContext{}.TraceParent())
+}
+
+func TestSpansAcrossQueue(t *testing.T) {
+	rec := &recorder{}
+	tracer := NewWithExporter(config.TracingConfig{SampleRate: 1}, rec)
+
+	ctx, root := tracer.Start(context.Background(), KindServer, "websocket EVENT", "event.kind", 1)
+	_, publish := tracer.Start(ctx, KindProducer, "queue publish")
+	traceparent := publish.TraceParent()
+	publish.End()
+	root.End()
+
+	// The consumer only has the traceparent the event carried
+	_, consume := tracer.Continue(context.Background(), traceparent, KindConsumer, "cache store")
+	consume.RecordError(errors.New("boom"))
+	consume.End()
+	consume.End()
+
+	helpers.AssertNoError(t, tracer.Shutdown(context.Background()))
+	helpers.AssertIntEqual(t, 3, len(rec.spans))
+	helpers.AssertTrue(t, consume.Context().TraceID == root.Context().TraceID)
+	helpers.AssertTrue(t, consume.parent == publish.Context().SpanID)
+	helpers.AssertTrue(t, publish.parent == root.Context().SpanID)
+
+	encoded := encodeSpan(consume)
+	helpers.AssertIntEqual(t, 2, encoded.Status.Code)
+	helpers.AssertStringEqual(t, "boom", encoded.Status.Message)
+}
+
+func TestSampling(t *testing.T) {
+	rec := &recorder{}
+	tracer := NewWithExporter(config.TracingConfig{SampleRate: -1}, rec)
+	ctx, root := tracer.Start(context.Background(), KindServer, "root")
+	_, child := tracer.Start(ctx, KindInternal, "child")
+	helpers.AssertFalse(t, child.Context().Sampled)
+	child.End()
+	root.End()
+
+	// A sampled remote parent wins over the local rate
+	_, remote := tracer.Continue(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", KindServer, "remote")
+	remote.End()
+	helpers.AssertNoError(t, tracer.Shutdown(context.Background()))
+	helpers.AssertIntEqual(t, 1, len(rec.spans))
+	helpers.AssertStringEqual(t, "remote", rec.spans[0].name)
+}
+
+func TestDisabled(t *testing.T) {
+	SetDefault(nil)
+	ctx, span := Start(context.Background(), KindServer, "nothing")
+	helpers.AssertTrue(t, span == nil)
+	helpers.AssertTrue(t, SpanFromContext(ctx) == nil)
+	span.SetAttributes("a", 1)
+	span.RecordError(errors.New("ignored"))
+	span.End()
+	helpers.AssertStringEqual(t, "", span.TraceParent())
+}
+
+func TestOTLPExport(t *testing.T) {
+	var got otlpRequest
+	var header string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		header = req.Header.Get("Authorization")
+		json.NewDecoder(req.Body).Decode(&got)
+	}))
+	defer server.Close()
+
+	stop, err := Setup(config.TracingConfig{
+		Enabled:       true,
+		Endpoint:      server.URL,
+		Headers:       map[string]string{"Authorization": "Bearer token"},
+		ServiceName:   "relay-test",
+		SampleRate:    1,
+		FlushInterval: time.Hour,
+		Timeout:       time.Second,
+	})
+	helpers.AssertNoError(t, err)
+	_, span := Start(context.Background(), KindClient, "cache query", "cache.backend", "memory", "events", 3)
+	span.End()
+	helpers.AssertNoError(t, stop(context.Background()))
+	helpers.AssertTrue(t, Default() == nil)
+
+	helpers.AssertStringEqual(t, "Bearer token", header)
+	helpers.AssertIntEqual(t, 1, len(got.ResourceSpans))
+	resource := got.ResourceSpans[0]
+	helpers.AssertEqual(t, "relay-test", resource.Resource.Attributes[0].Value["stringValue"])
+	spans := resource.ScopeSpans[0].Spans
+	helpers.AssertIntEqual(t, 1, len(spans))
+	helpers.AssertStringEqual(t, "cache query", spans[0].Name)
+	helpers.AssertIntEqual(t, int(KindClient), spans[0].Kind)
+	helpers.AssertIntEqual(t, 32, len(spans[0].TraceID))
+	helpers.AssertEqual(t, "3", spans[0].Attributes[1].Value["intValue"])
+}
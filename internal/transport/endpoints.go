@@ -0,0 +1,96 @@
+package transport
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Endpoint is one way for clients to reach the relay. Clients try endpoints
+// in priority order (lowest first) and fail over to the next.
+type Endpoint struct {
+	Transport    string `json:"transport"`
+	URL          string `json:"url"`
+	Priority     int    `json:"priority"`
+	Instructions string `json:"instructions,omitempty"`
+}
+
+// Endpoint priorities for the transports the manager runs
+const (
+	PriorityTor = 20
+	PriorityI2P = 30
+	PrioritySSH = 40
+)
+
+// i2pBase64 is the I2P variant of base64 used for destinations
+var i2pBase64 = base64.NewEncoding("ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz0123456789-~")
+
+// HealthyEndpoints returns client-facing addresses for the Tor, I2P and SSH
+// transports that currently pass their health checks. relayPort is the
+// websocket port an SSH tunnel forwards to.
+func (m *Manager) HealthyEndpoints(relayPort int) []Endpoint {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var endpoints []Endpoint
+
+	if m.tor != nil && m.tor.IsHealthy() && m.tor.GetAddress() != "" {
+		host := m.tor.GetAddress()
+		if port := m.torConfig.HiddenServicePort; port != 0 && port != 80 {
+			host = fmt.Sprintf("%s:%d", host, port)
+		}
+		endpoints = append(endpoints, Endpoint{
+			Transport: TransportTor,
+			URL:       "ws://" + host,
+			Priority:  PriorityTor,
+		})
+	}
+
+	if m.i2p != nil && m.i2p.IsHealthy() {
+		if host := i2pB32Address(m.i2p.GetAddress()); host != "" {
+			endpoints = append(endpoints, Endpoint{
+				Transport: TransportI2P,
+				URL:       "ws://" + host,
+				Priority:  PriorityI2P,
+			})
+		}
+	}
+
+	if m.ssh != nil && m.ssh.IsHealthy() {
+		conn := m.sshConfig.Connection
+		login := conn.Host
+		if conn.Username != "" {
+			login = conn.Username + "@" + conn.Host
+		}
+		endpoints = append(endpoints, Endpoint{
+			Transport: TransportSSH,
+			URL:       fmt.Sprintf("ssh://%s:%d", login, conn.Port),
+			Priority:  PrioritySSH,
+			Instructions: fmt.Sprintf("ssh -N -L %d:localhost:%d -p %d %s, then connect to ws://localhost:%d",
+				relayPort, relayPort, conn.Port, login, relayPort),
+		})
+	}
+
+	return endpoints
+}
+
+// i2pB32Address turns an I2P destination into its .b32.i2p hostname.
+// Addresses that are already hostnames are returned unchanged.
+func i2pB32Address(destination string) string {
+	if destination == "" {
+		return ""
+	}
+	if strings.HasSuffix(destination, ".i2p") {
+		return destination
+	}
+
+	raw, err := i2pBase64.DecodeString(destination)
+	if err != nil {
+		return ""
+	}
+	hash := sha256.Sum256(raw)
+	b32 := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(hash[:])
+	return strings.ToLower(b32) + ".b32.i2p"
+}
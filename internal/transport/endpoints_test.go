@@ -0,0 +1,45 @@
+package transport
+
+import (
+	"strings"
+	"testing"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/test/helpers"
+)
+
+func TestHealthyEndpoints(t *testing.T) {
+	m := NewManager(
+		config.TorConfig{HiddenServicePort: 80},
+		config.I2PConfig{},
+		config.SSHConfig{Connection: config.SSHConnection{Host: "tunnel.example.com", Port: 2222, Username: "relay"}},
+	)
+	helpers.AssertIntEqual(t, 0, len(m.HealthyEndpoints(8080)))
+
+	m.tor = &TorTransport{address: "abcdefghijklmnop.onion", healthy: true}
+	m.i2p = &I2PTransport{address: strings.Repeat("A", 516) + "AAAA", healthy: false}
+	m.ssh = &SSHTransport{config: m.sshConfig, healthy: true}
+
+	endpoints := m.HealthyEndpoints(8080)
+	helpers.AssertIntEqual(t, 2, len(endpoints))
+
+	helpers.AssertStringEqual(t, TransportTor, endpoints[0].Transport)
+	helpers.AssertStringEqual(t, "ws://abcdefghijklmnop.onion", endpoints[0].URL)
+
+	helpers.AssertStringEqual(t, TransportSSH, endpoints[1].Transport)
+	helpers.AssertStringEqual(t, "ssh://relay@tunnel.example.com:2222", endpoints[1].URL)
+	helpers.AssertTrue(t, strings.Contains(endpoints[1].Instructions, "-L 8080:localhost:8080"))
+
+	m.i2p.healthy = true
+	endpoints = m.HealthyEndpoints(8080)
+	helpers.AssertIntEqual(t, 3, len(endpoints))
+	helpers.AssertTrue(t, strings.HasSuffix(endpoints[1].URL, ".b32.i2p"))
+}
+
+func TestI2PB32Address(t *testing.T) {
+	helpers.AssertStringEqual(t, "example.b32.i2p", i2pB32Address("example.b32.i2p"))
+	helpers.AssertStringEqual(t, "", i2pB32Address("not base64!"))
+
+	b32 := i2pB32Address("AAAA")
+	helpers.AssertIntEqual(t, 52+len(".b32.i2p"), len(b32))
+}
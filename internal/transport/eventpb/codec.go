@@ -0,0 +1,45 @@
+package eventpb
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc/encoding"
+)
+
+// CodecName is the gRPC content subtype of the event stream. Clients select
+// it with grpc.CallContentSubtype; the server picks the codec by subtype.
+const CodecName = "mercury-eventpb"
+
+func init() {
+	encoding.RegisterCodec(codec{})
+}
+
+// message is implemented by every type in this package
+type message interface {
+	Marshal() []byte
+	Unmarshal([]byte) error
+}
+
+// codec lets gRPC carry this package's messages, which don't implement
+// proto.Message
+type codec struct{}
+
+func (codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(message)
+	if !ok {
+		return nil, fmt.Errorf("eventpb: cannot marshal %T", v)
+	}
+	return m.Marshal(), nil
+}
+
+func (codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(message)
+	if !ok {
+		return fmt.Errorf("eventpb: cannot unmarshal into %T", v)
+	}
+	return m.Unmarshal(data)
+}
+
+func (codec) Name() string {
+	return CodecName
+}
@@ -0,0 +1,117 @@
+package eventpb
+
+import (
+	"time"
+
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// FromModel converts a models.Event to its binary form
+func FromModel(e *models.Event) *Event {
+	pb := &Event{
+		ID:               e.ID,
+		Pubkey:           e.PubKey,
+		CreatedAt:        int64(e.CreatedAt),
+		Kind:             int64(e.Kind),
+		Tags:             fromTags(e.Tags),
+		Content:          e.Content,
+		Sig:              e.Sig,
+		QualityScore:     e.QualityScore,
+		IsQuarantined:    e.IsQuarantined,
+		QuarantineReason: e.QuarantineReason,
+		ReceivedAt:       unixNano(e.CreatedAtDB),
+		Language:         e.Language,
+		Topics:           e.Topics,
+		NormalizedTags:   fromTags(e.NormalizedTags),
+		Mirrored:         e.Mirrored,
+	}
+	for _, p := range e.Provenance {
+		pb.Provenance = append(pb.Provenance, &Provenance{
+			Source: p.Source,
+			Detail: p.Detail,
+			Pubkey: p.Pubkey,
+			At:     unixNano(p.At),
+		})
+	}
+	return pb
+}
+
+// ToModel converts the event back to a models.Event. Tags are never nil, as
+// in a parsed NIP-01 event; times come back in UTC.
+func (e *Event) ToModel() *models.Event {
+	event := &models.Event{
+		ID:               e.ID,
+		PubKey:           e.Pubkey,
+		CreatedAt:        nostr.Timestamp(e.CreatedAt),
+		Kind:             int(e.Kind),
+		Tags:             toTags(e.Tags),
+		Content:          e.Content,
+		Sig:              e.Sig,
+		QualityScore:     e.QualityScore,
+		IsQuarantined:    e.IsQuarantined,
+		QuarantineReason: e.QuarantineReason,
+		CreatedAtDB:      fromUnixNano(e.ReceivedAt),
+		Language:         e.Language,
+		Topics:           e.Topics,
+		Mirrored:         e.Mirrored,
+	}
+	if event.Tags == nil {
+		event.Tags = nostr.Tags{}
+	}
+	if len(e.NormalizedTags) > 0 {
+		event.NormalizedTags = toTags(e.NormalizedTags)
+	}
+	for _, p := range e.Provenance {
+		event.Provenance = append(event.Provenance, models.Provenance{
+			Source: p.Source,
+			Detail: p.Detail,
+			Pubkey: p.Pubkey,
+			At:     fromUnixNano(p.At),
+		})
+	}
+	return event
+}
+
+func fromTags(tags nostr.Tags) []*Tag {
+	if tags == nil {
+		return nil
+	}
+	pb := make([]*Tag, len(tags))
+	for i, tag := range tags {
+		pb[i] = &Tag{Values: tag}
+	}
+	return pb
+}
+
+func toTags(pb []*Tag) nostr.Tags {
+	if pb == nil {
+		return nil
+	}
+	tags := make(nostr.Tags, len(pb))
+	for i, tag := range pb {
+		tags[i] = nostr.Tag(tag.Values)
+		if tags[i] == nil {
+			tags[i] = nostr.Tag{}
+		}
+	}
+	return tags
+}
+
+// The zero time.Time is outside the int64 nanosecond range, so it is sent
+// as 0
+
+func unixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n).UTC()
+}
@@ -0,0 +1,373 @@
+// Package eventpb is the protobuf wire format of the gRPC event stream,
+// described in event.proto. Messages are encoded with protowire directly,
+// so no generated code or protoc is needed.
+package eventpb
+
+import (
+	"fmt"
+	"math"
+
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+var ErrMalformed = fmt.Errorf("malformed protobuf message")
+
+// Event is the binary form of models.Event
+type Event struct {
+	ID               string
+	Pubkey           string
+	CreatedAt        int64
+	Kind             int64
+	Tags             []*Tag
+	Content          string
+	Sig              string
+	QualityScore     float64
+	IsQuarantined    bool
+	QuarantineReason string
+	ReceivedAt       int64 // unix nanoseconds, 0 when unset
+	Language         string
+	Topics           []string
+	NormalizedTags   []*Tag
+	Provenance       []*Provenance
+	Mirrored         bool
+}
+
+// Tag is one tag array, name first
+type Tag struct {
+	Values []string
+}
+
+// Provenance is the binary form of models.Provenance
+type Provenance struct {
+	Source string
+	Detail string
+	Pubkey string
+	At     int64 // unix nanoseconds, 0 when unset
+}
+
+// Ack answers a published event like a NIP-01 OK message
+type Ack struct {
+	EventID  string
+	Accepted bool
+	Message  string
+}
+
+// Frame is sent from the relay to stream clients; exactly one of Event and
+// Ack is set
+type Frame struct {
+	Event *Event
+	Ack   *Ack
+}
+
+// Marshal encodes the event
+func (e *Event) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, e.ID)
+	b = appendString(b, 2, e.Pubkey)
+	b = appendVarint(b, 3, uint64(e.CreatedAt))
+	b = appendVarint(b, 4, uint64(e.Kind))
+	for _, tag := range e.Tags {
+		b = appendMessage(b, 5, tag.Marshal())
+	}
+	b = appendString(b, 6, e.Content)
+	b = appendString(b, 7, e.Sig)
+	if e.QualityScore != 0 {
+		b = protowire.AppendTag(b, 8, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(e.QualityScore))
+	}
+	if e.IsQuarantined {
+		b = appendVarint(b, 9, 1)
+	}
+	b = appendString(b, 10, e.QuarantineReason)
+	b = appendVarint(b, 11, uint64(e.ReceivedAt))
+	b = appendString(b, 12, e.Language)
+	for _, topic := range e.Topics {
+		b = protowire.AppendTag(b, 13, protowire.BytesType)
+		b = protowire.AppendString(b, topic)
+	}
+	for _, tag := range e.NormalizedTags {
+		b = appendMessage(b, 14, tag.Marshal())
+	}
+	for _, p := range e.Provenance {
+		b = appendMessage(b, 15, p.Marshal())
+	}
+	if e.Mirrored {
+		b = appendVarint(b, 16, 1)
+	}
+	return b
+}
+
+// Unmarshal decodes b into the event, replacing its contents
+func (e *Event) Unmarshal(b []byte) error {
+	*e = Event{}
+	return decode(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &e.ID)
+		case 2:
+			return consumeString(b, typ, &e.Pubkey)
+		case 3:
+			return consumeInt64(b, typ, &e.CreatedAt)
+		case 4:
+			return consumeInt64(b, typ, &e.Kind)
+		case 5:
+			tag := &Tag{}
+			e.Tags = append(e.Tags, tag)
+			return consumeMessage(b, typ, tag.Unmarshal)
+		case 6:
+			return consumeString(b, typ, &e.Content)
+		case 7:
+			return consumeString(b, typ, &e.Sig)
+		case 8:
+			return consumeDouble(b, typ, &e.QualityScore)
+		case 9:
+			var v int64
+			n, err := consumeInt64(b, typ, &v)
+			e.IsQuarantined = v != 0
+			return n, err
+		case 10:
+			return consumeString(b, typ, &e.QuarantineReason)
+		case 11:
+			return consumeInt64(b, typ, &e.ReceivedAt)
+		case 12:
+			return consumeString(b, typ, &e.Language)
+		case 13:
+			var topic string
+			n, err := consumeString(b, typ, &topic)
+			e.Topics = append(e.Topics, topic)
+			return n, err
+		case 14:
+			tag := &Tag{}
+			e.NormalizedTags = append(e.NormalizedTags, tag)
+			return consumeMessage(b, typ, tag.Unmarshal)
+		case 15:
+			p := &Provenance{}
+			e.Provenance = append(e.Provenance, p)
+			return consumeMessage(b, typ, p.Unmarshal)
+		case 16:
+			var v int64
+			n, err := consumeInt64(b, typ, &v)
+			e.Mirrored = v != 0
+			return n, err
+		}
+		return unknownField, nil
+	})
+}
+
+// Marshal encodes the tag. Empty values are kept so positions don't shift.
+func (t *Tag) Marshal() []byte {
+	var b []byte
+	for _, value := range t.Values {
+		b = protowire.AppendTag(b, 1, protowire.BytesType)
+		b = protowire.AppendString(b, value)
+	}
+	return b
+}
+
+// Unmarshal decodes b into the tag, replacing its contents
+func (t *Tag) Unmarshal(b []byte) error {
+	t.Values = []string{}
+	return decode(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		if num != 1 {
+			return unknownField, nil
+		}
+		var value string
+		n, err := consumeString(b, typ, &value)
+		t.Values = append(t.Values, value)
+		return n, err
+	})
+}
+
+// Marshal encodes the provenance entry
+func (p *Provenance) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, p.Source)
+	b = appendString(b, 2, p.Detail)
+	b = appendString(b, 3, p.Pubkey)
+	b = appendVarint(b, 4, uint64(p.At))
+	return b
+}
+
+// Unmarshal decodes b into the provenance entry, replacing its contents
+func (p *Provenance) Unmarshal(b []byte) error {
+	*p = Provenance{}
+	return decode(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &p.Source)
+		case 2:
+			return consumeString(b, typ, &p.Detail)
+		case 3:
+			return consumeString(b, typ, &p.Pubkey)
+		case 4:
+			return consumeInt64(b, typ, &p.At)
+		}
+		return unknownField, nil
+	})
+}
+
+// Marshal encodes the ack
+func (a *Ack) Marshal() []byte {
+	var b []byte
+	b = appendString(b, 1, a.EventID)
+	if a.Accepted {
+		b = appendVarint(b, 2, 1)
+	}
+	b = appendString(b, 3, a.Message)
+	return b
+}
+
+// Unmarshal decodes b into the ack, replacing its contents
+func (a *Ack) Unmarshal(b []byte) error {
+	*a = Ack{}
+	return decode(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			return consumeString(b, typ, &a.EventID)
+		case 2:
+			var v int64
+			n, err := consumeInt64(b, typ, &v)
+			a.Accepted = v != 0
+			return n, err
+		case 3:
+			return consumeString(b, typ, &a.Message)
+		}
+		return unknownField, nil
+	})
+}
+
+// Marshal encodes the frame
+func (f *Frame) Marshal() []byte {
+	switch {
+	case f.Event != nil:
+		return appendMessage(nil, 1, f.Event.Marshal())
+	case f.Ack != nil:
+		return appendMessage(nil, 2, f.Ack.Marshal())
+	}
+	return nil
+}
+
+// Unmarshal decodes b into the frame, replacing its contents
+func (f *Frame) Unmarshal(b []byte) error {
+	*f = Frame{}
+	return decode(b, func(num protowire.Number, typ protowire.Type, b []byte) (int, error) {
+		switch num {
+		case 1:
+			f.Event, f.Ack = &Event{}, nil
+			return consumeMessage(b, typ, f.Event.Unmarshal)
+		case 2:
+			f.Event, f.Ack = nil, &Ack{}
+			return consumeMessage(b, typ, f.Ack.Unmarshal)
+		}
+		return unknownField, nil
+	})
+}
+
+// Proto3 leaves zero scalars off the wire
+
+func appendString(b []byte, num protowire.Number, value string) []byte {
+	if value == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, value)
+}
+
+func appendVarint(b []byte, num protowire.Number, value uint64) []byte {
+	if value == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, value)
+}
+
+func appendMessage(b []byte, num protowire.Number, message []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, message)
+}
+
+// unknownField is returned by a field decoder for fields it doesn't know,
+// which are skipped
+const unknownField = -1
+
+// decode walks the fields of a message. field consumes a known field and
+// returns the bytes used, or unknownField.
+func decode(b []byte, field func(protowire.Number, protowire.Type, []byte) (int, error)) error {
+	for len(b) > 0 {
+		num, typ, n := protowire.ConsumeTag(b)
+		if n < 0 {
+			return parseError(n)
+		}
+		b = b[n:]
+
+		n, err := field(num, typ, b)
+		if err != nil {
+			return fmt.Errorf("field %d: %w", num, err)
+		}
+		if n == unknownField {
+			if n = protowire.ConsumeFieldValue(num, typ, b); n < 0 {
+				return fmt.Errorf("field %d: %w", num, parseError(n))
+			}
+		}
+		b = b[n:]
+	}
+	return nil
+}
+
+// The consume helpers never return a negative length without an error, so
+// a truncated field can't be mistaken for unknownField
+
+func consumeString(b []byte, typ protowire.Type, dst *string) (int, error) {
+	if typ != protowire.BytesType {
+		return 0, wireTypeError(typ)
+	}
+	v, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return 0, parseError(n)
+	}
+	*dst = string(v)
+	return n, nil
+}
+
+func consumeInt64(b []byte, typ protowire.Type, dst *int64) (int, error) {
+	if typ != protowire.VarintType {
+		return 0, wireTypeError(typ)
+	}
+	v, n := protowire.ConsumeVarint(b)
+	if n < 0 {
+		return 0, parseError(n)
+	}
+	*dst = int64(v)
+	return n, nil
+}
+
+func consumeDouble(b []byte, typ protowire.Type, dst *float64) (int, error) {
+	if typ != protowire.Fixed64Type {
+		return 0, wireTypeError(typ)
+	}
+	v, n := protowire.ConsumeFixed64(b)
+	if n < 0 {
+		return 0, parseError(n)
+	}
+	*dst = math.Float64frombits(v)
+	return n, nil
+}
+
+func consumeMessage(b []byte, typ protowire.Type, unmarshal func([]byte) error) (int, error) {
+	if typ != protowire.BytesType {
+		return 0, wireTypeError(typ)
+	}
+	v, n := protowire.ConsumeBytes(b)
+	if n < 0 {
+		return 0, parseError(n)
+	}
+	return n, unmarshal(v)
+}
+
+func parseError(n int) error {
+	return fmt.Errorf("%w: %v", ErrMalformed, protowire.ParseError(n))
+}
+
+func wireTypeError(typ protowire.Type) error {
+	return fmt.Errorf("%w: unexpected wire type %d", ErrMalformed, typ)
+}
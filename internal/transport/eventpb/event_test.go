@@ -0,0 +1,187 @@
+package eventpb
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func sampleEvent() *models.Event {
+	received := time.Date(2025, 3, 14, 15, 9, 26, 535897932, time.UTC)
+	return &models.Event{
+		ID:        "5c83da77af1dec6d7289834998ad7aafbd9e2191396d75ec3cc27f5a77226f36",
+		PubKey:    "f7234bd4c1394dda46d09f35bd384dd30cc552ad5541990f98844fb06676e9ca",
+		CreatedAt: nostr.Timestamp(1741964966),
+		Kind:      30023,
+		Tags: nostr.Tags{
+			{"d", "grüße-aus-köln"},
+			{"title", "Ünïcödé 🚀 测试 — «quotes»"},
+			{"e", "a0b1c2d3e4f5a6b7c8d9e0f1a2b3c4d5e6f7a8b9c0d1e2f3a4b5c6d7e8f9a0b1", "", "root"},
+			{"t"},
+			{},
+		},
+		Content:          "# Hello\n\nEmoji 👩‍💻, RTL עברית, null byte \x00 and tabs\t.",
+		Sig:              "908a15e46fb4d8675bab026fc230a0e3542bfade63da02d542fb78b2a8513fcd0092619a2c8c1221e581946e0191f2af505dfdf8657a414dbca329186f009262",
+		QualityScore:     0.85,
+		IsQuarantined:    true,
+		QuarantineReason: "Low quality score",
+		CreatedAtDB:      received,
+		Language:         "de",
+		Topics:           []string{"travel", "food"},
+		NormalizedTags:   nostr.Tags{{"d", "grüße-aus-köln"}, {"t", "nostr"}},
+		Provenance: []models.Provenance{
+			{Source: models.ProvenanceWebSocket, Detail: "203.0.113.7:51234", At: received},
+			{Source: models.ProvenanceUpstream, Detail: "wss://relay.example.com", Pubkey: "abc", At: received.Add(time.Second)},
+		},
+		Mirrored: true,
+	}
+}
+
+func TestEventRoundTrip(t *testing.T) {
+	original := sampleEvent()
+
+	data := FromModel(original).Marshal()
+	decoded := &Event{}
+	helpers.AssertNoError(t, decoded.Unmarshal(data))
+	event := decoded.ToModel()
+
+	if !reflect.DeepEqual(original, event) {
+		t.Fatalf("round trip changed the event:\nwant %+v\ngot  %+v", original, event)
+	}
+}
+
+func TestEventRoundTripMinimal(t *testing.T) {
+	original := &models.Event{Tags: nostr.Tags{}}
+
+	decoded := &Event{}
+	helpers.AssertNoError(t, decoded.Unmarshal(FromModel(original).Marshal()))
+	event := decoded.ToModel()
+
+	if !reflect.DeepEqual(original, event) {
+		t.Fatalf("round trip changed the event:\nwant %+v\ngot  %+v", original, event)
+	}
+	helpers.AssertTrue(t, event.Tags != nil)
+	helpers.AssertTrue(t, event.NormalizedTags == nil)
+}
+
+func TestEventRoundTripNegativeValues(t *testing.T) {
+	original := &models.Event{Tags: nostr.Tags{}, Kind: -1, CreatedAt: 0, QualityScore: -0.5}
+
+	decoded := &Event{}
+	helpers.AssertNoError(t, decoded.Unmarshal(FromModel(original).Marshal()))
+
+	helpers.AssertIntEqual(t, -1, decoded.ToModel().Kind)
+	helpers.AssertFloat64Equal(t, -0.5, decoded.ToModel().QualityScore, 0)
+}
+
+func TestFrameRoundTrip(t *testing.T) {
+	t.Run("Event", func(t *testing.T) {
+		frame := &Frame{Event: FromModel(sampleEvent())}
+		decoded := &Frame{}
+		helpers.AssertNoError(t, decoded.Unmarshal(frame.Marshal()))
+		helpers.AssertTrue(t, decoded.Ack == nil)
+		helpers.AssertTrue(t, reflect.DeepEqual(sampleEvent(), decoded.Event.ToModel()))
+	})
+
+	t.Run("Ack", func(t *testing.T) {
+		frame := &Frame{Ack: &Ack{EventID: "abc", Message: "invalid: bad signature"}}
+		decoded := &Frame{}
+		helpers.AssertNoError(t, decoded.Unmarshal(frame.Marshal()))
+		helpers.AssertTrue(t, decoded.Event == nil)
+		helpers.AssertTrue(t, reflect.DeepEqual(frame.Ack, decoded.Ack))
+	})
+}
+
+func TestUnmarshalSkipsUnknownFields(t *testing.T) {
+	data := FromModel(sampleEvent()).Marshal()
+	data = protowire.AppendTag(data, 99, protowire.BytesType)
+	data = protowire.AppendString(data, "from a newer schema")
+	data = protowire.AppendTag(data, 100, protowire.VarintType)
+	data = protowire.AppendVarint(data, 42)
+
+	decoded := &Event{}
+	helpers.AssertNoError(t, decoded.Unmarshal(data))
+	helpers.AssertTrue(t, reflect.DeepEqual(sampleEvent(), decoded.ToModel()))
+}
+
+func TestUnmarshalMalformed(t *testing.T) {
+	t.Run("Truncated", func(t *testing.T) {
+		data := (&Event{Content: "cut short"}).Marshal()
+		err := (&Event{}).Unmarshal(data[:len(data)-1])
+		helpers.AssertTrue(t, errors.Is(err, ErrMalformed))
+	})
+
+	t.Run("Truncated nested message", func(t *testing.T) {
+		data := (&Event{Tags: []*Tag{{Values: []string{"t", "nostr"}}}}).Marshal()
+		err := (&Event{}).Unmarshal(data[:len(data)-2])
+		helpers.AssertTrue(t, errors.Is(err, ErrMalformed))
+	})
+
+	t.Run("Wrong wire type", func(t *testing.T) {
+		bad := protowire.AppendTag(nil, 1, protowire.VarintType)
+		bad = protowire.AppendVarint(bad, 7)
+		err := (&Event{}).Unmarshal(bad)
+		helpers.AssertTrue(t, errors.Is(err, ErrMalformed))
+	})
+}
+
+func TestCodec(t *testing.T) {
+	c := codec{}
+	helpers.AssertStringEqual(t, CodecName, c.Name())
+
+	data, err := c.Marshal(FromModel(sampleEvent()))
+	helpers.AssertNoError(t, err)
+
+	decoded := &Event{}
+	helpers.AssertNoError(t, c.Unmarshal(data, decoded))
+	helpers.AssertStringEqual(t, sampleEvent().Content, decoded.Content)
+
+	_, err = c.Marshal("not a message")
+	helpers.AssertError(t, err)
+}
+
+func TestEncodingSmallerThanJSON(t *testing.T) {
+	event := sampleEvent()
+	jsonData, err := json.Marshal(event)
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, len(FromModel(event).Marshal()) < len(jsonData))
+}
+
+func BenchmarkEncodeProtobuf(b *testing.B) {
+	event := sampleEvent()
+	for i := 0; i < b.N; i++ {
+		_ = FromModel(event).Marshal()
+	}
+}
+
+func BenchmarkEncodeJSON(b *testing.B) {
+	event := sampleEvent()
+	for i := 0; i < b.N; i++ {
+		_, _ = json.Marshal(event)
+	}
+}
+
+func BenchmarkDecodeProtobuf(b *testing.B) {
+	data := FromModel(sampleEvent()).Marshal()
+	for i := 0; i < b.N; i++ {
+		decoded := &Event{}
+		_ = decoded.Unmarshal(data)
+		_ = decoded.ToModel()
+	}
+}
+
+func BenchmarkDecodeJSON(b *testing.B) {
+	data, _ := json.Marshal(sampleEvent())
+	for i := 0; i < b.N; i++ {
+		var event models.Event
+		_ = json.Unmarshal(data, &event)
+	}
+}
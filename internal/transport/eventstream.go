@@ -0,0 +1,294 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/internal/transport/eventpb"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/peer"
+)
+
+// eventStreamMethod is the full name of the bidirectional stream in event.proto
+const eventStreamMethod = "/mercury.relay.v1.EventStream/Stream"
+
+// eventStreamBuffer is how many events a slow stream may fall behind before
+// events are dropped for it
+const eventStreamBuffer = 256
+
+// EventSink accepts events published over the gRPC event stream. A returned
+// error is sent back to the client in the Ack, so it should carry a NIP-01
+// machine-readable prefix such as "invalid:".
+type EventSink interface {
+	IngestEvent(event *models.Event, remoteAddr string) error
+}
+
+// eventStreamService is the handler type registered for the EventStream service
+type eventStreamService interface {
+	handleStream(stream grpc.ServerStream) error
+}
+
+var eventStreamDesc = grpc.ServiceDesc{
+	ServiceName: "mercury.relay.v1.EventStream",
+	HandlerType: (*eventStreamService)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName: "Stream",
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			return srv.(eventStreamService).handleStream(stream)
+		},
+		ServerStreams: true,
+		ClientStreams: true,
+	}},
+	Metadata: "event.proto",
+}
+
+// EventStreamServer serves the gRPC event stream: clients publish events in
+// protobuf form and receive every event the relay stores
+type EventStreamServer struct {
+	config config.GRPCConfig
+	server *grpc.Server
+	sink   EventSink
+
+	streams map[chan *eventpb.Event]struct{}
+	mu      sync.RWMutex
+
+	received  atomic.Int64
+	accepted  atomic.Int64
+	rejected  atomic.Int64
+	broadcast atomic.Int64
+	dropped   atomic.Int64
+}
+
+// NewEventStreamServer creates an event stream server listening on the
+// configured gRPC host and port
+func NewEventStreamServer(cfg config.GRPCConfig) (*EventStreamServer, error) {
+	var opts []grpc.ServerOption
+
+	if cfg.TLSEnabled {
+		creds, err := credentials.NewServerTLSFromFile(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load gRPC TLS credentials: %w", err)
+		}
+		opts = append(opts, grpc.Creds(creds))
+	}
+	if cfg.KeepAliveTime > 0 {
+		opts = append(opts, grpc.KeepaliveParams(keepalive.ServerParameters{
+			Time:    cfg.KeepAliveTime,
+			Timeout: cfg.KeepAliveTimeout,
+		}))
+	}
+	if cfg.MaxMessageSize > 0 {
+		opts = append(opts, grpc.MaxRecvMsgSize(cfg.MaxMessageSize), grpc.MaxSendMsgSize(cfg.MaxMessageSize))
+	}
+
+	s := &EventStreamServer{
+		config:  cfg,
+		server:  grpc.NewServer(opts...),
+		streams: make(map[chan *eventpb.Event]struct{}),
+	}
+	s.server.RegisterService(&eventStreamDesc, s)
+	return s, nil
+}
+
+// SetSink sets where published events go. Without a sink every published
+// event is rejected.
+func (s *EventStreamServer) SetSink(sink EventSink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sink = sink
+}
+
+// Start listens on the configured address and serves until ctx is done
+func (s *EventStreamServer) Start(ctx context.Context) error {
+	address := fmt.Sprintf("%s:%d", s.config.ServerHost, s.config.ServerPort)
+	lis, err := net.Listen("tcp", address)
+	if err != nil {
+		return fmt.Errorf("failed to listen for gRPC on %s: %w", address, err)
+	}
+	log.Printf("gRPC event stream listening on %s", lis.Addr())
+	return s.Serve(ctx, lis)
+}
+
+// Serve serves the event stream on lis until ctx is done. Streams are
+// long-lived, so open ones are cut rather than drained.
+func (s *EventStreamServer) Serve(ctx context.Context, lis net.Listener) error {
+	go func() {
+		<-ctx.Done()
+		s.server.Stop()
+	}()
+	return s.server.Serve(lis)
+}
+
+// Broadcast sends a stored event to every open stream without blocking;
+// streams that fell too far behind miss it
+func (s *EventStreamServer) Broadcast(event *models.Event) {
+	if event.IsQuarantined {
+		return
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if len(s.streams) == 0 {
+		return
+	}
+
+	pb := eventpb.FromModel(event)
+	for ch := range s.streams {
+		select {
+		case ch <- pb:
+			s.broadcast.Add(1)
+		default:
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// GetStats returns event stream counters
+func (s *EventStreamServer) GetStats() map[string]interface{} {
+	s.mu.RLock()
+	streams := len(s.streams)
+	s.mu.RUnlock()
+
+	return map[string]interface{}{
+		"streams":   streams,
+		"received":  s.received.Load(),
+		"accepted":  s.accepted.Load(),
+		"rejected":  s.rejected.Load(),
+		"broadcast": s.broadcast.Load(),
+		"dropped":   s.dropped.Load(),
+	}
+}
+
+func (s *EventStreamServer) handleStream(stream grpc.ServerStream) error {
+	ctx := stream.Context()
+	remoteAddr := ""
+	if p, ok := peer.FromContext(ctx); ok {
+		remoteAddr = p.Addr.String()
+	}
+
+	events := make(chan *eventpb.Event, eventStreamBuffer)
+	s.mu.Lock()
+	s.streams[events] = struct{}{}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.streams, events)
+		s.mu.Unlock()
+	}()
+
+	// gRPC streams don't allow concurrent sends, so acks are handed to the
+	// loop below rather than sent from the receiving goroutine
+	acks := make(chan *eventpb.Ack)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			in := &eventpb.Event{}
+			if err := stream.RecvMsg(in); err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case acks <- s.ingest(in, remoteAddr):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for {
+		var frame *eventpb.Frame
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case err := <-recvErr:
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		case ack := <-acks:
+			frame = &eventpb.Frame{Ack: ack}
+		case event := <-events:
+			frame = &eventpb.Frame{Event: event}
+		}
+		if err := stream.SendMsg(frame); err != nil {
+			return err
+		}
+	}
+}
+
+// ingest hands a published event to the sink. Only the signed fields are
+// taken from the client; relay metadata is recomputed.
+func (s *EventStreamServer) ingest(in *eventpb.Event, remoteAddr string) *eventpb.Ack {
+	s.received.Add(1)
+	event := models.FromNostrEvent(in.ToModel().ToNostrEvent())
+	ack := &eventpb.Ack{EventID: event.ID}
+
+	s.mu.RLock()
+	sink := s.sink
+	s.mu.RUnlock()
+
+	if sink == nil {
+		ack.Message = "error: publishing is not enabled on this stream"
+	} else if err := sink.IngestEvent(event, remoteAddr); err != nil {
+		ack.Message = err.Error()
+	} else {
+		ack.Accepted = true
+	}
+
+	if ack.Accepted {
+		s.accepted.Add(1)
+	} else {
+		s.rejected.Add(1)
+	}
+	return ack
+}
+
+// EventStream is a client's end of the gRPC event stream. Publish and Recv
+// may be used from different goroutines, but neither concurrently with itself.
+type EventStream struct {
+	stream grpc.ClientStream
+}
+
+// OpenEventStream opens the event stream on the connected relay
+func (g *GRPCTransport) OpenEventStream(ctx context.Context) (*EventStream, error) {
+	if !g.IsConnected() {
+		return nil, fmt.Errorf("gRPC transport not connected")
+	}
+	stream, err := g.conn.NewStream(ctx, &eventStreamDesc.Streams[0], eventStreamMethod,
+		grpc.CallContentSubtype(eventpb.CodecName))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open event stream: %w", err)
+	}
+	return &EventStream{stream: stream}, nil
+}
+
+// Publish sends an event to the relay; its Ack arrives through Recv
+func (e *EventStream) Publish(event *models.Event) error {
+	return e.stream.SendMsg(eventpb.FromModel(event))
+}
+
+// Recv returns the next frame from the relay: an Ack for a published event
+// or a newly stored event
+func (e *EventStream) Recv() (*eventpb.Frame, error) {
+	frame := &eventpb.Frame{}
+	if err := e.stream.RecvMsg(frame); err != nil {
+		return nil, err
+	}
+	return frame, nil
+}
+
+// CloseSend tells the relay no more events will be published, which ends
+// the stream
+func (e *EventStream) CloseSend() error {
+	return e.stream.CloseSend()
+}
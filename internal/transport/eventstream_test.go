@@ -0,0 +1,166 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+type fakeEventSink struct {
+	events []*models.Event
+	addrs  []string
+	reject string
+	mu     sync.Mutex
+}
+
+func (f *fakeEventSink) IngestEvent(event *models.Event, remoteAddr string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.reject != "" {
+		return fmt.Errorf("%s", f.reject)
+	}
+	f.events = append(f.events, event)
+	f.addrs = append(f.addrs, remoteAddr)
+	return nil
+}
+
+// startEventStream serves an event stream on a random port and returns a
+// client stream connected to it
+func startEventStream(t *testing.T, sink EventSink) (*EventStreamServer, *EventStream) {
+	t.Helper()
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	helpers.AssertNoError(t, err)
+	_, portStr, _ := net.SplitHostPort(lis.Addr().String())
+	port, _ := strconv.Atoi(portStr)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	server, err := NewEventStreamServer(config.GRPCConfig{Enabled: true})
+	helpers.AssertNoError(t, err)
+	if sink != nil {
+		server.SetSink(sink)
+	}
+	go server.Serve(ctx, lis)
+
+	client := NewGRPCTransport(config.GRPCConfig{
+		Enabled:       true,
+		ServerHost:    "127.0.0.1",
+		ServerPort:    port,
+		MaxRetries:    1,
+		RetryInterval: time.Second,
+	})
+	helpers.AssertNoError(t, client.Connect(ctx))
+	t.Cleanup(func() { client.Disconnect() })
+
+	stream, err := client.OpenEventStream(ctx)
+	helpers.AssertNoError(t, err)
+	return server, stream
+}
+
+func streamTestEvent(content string) *models.Event {
+	return &models.Event{
+		ID:        "5c83da77af1dec6d7289834998ad7aafbd9e2191396d75ec3cc27f5a77226f36",
+		PubKey:    "f7234bd4c1394dda46d09f35bd384dd30cc552ad5541990f98844fb06676e9ca",
+		CreatedAt: nostr.Now(),
+		Kind:      1,
+		Tags:      nostr.Tags{{"t", "grpc"}, {"p", "f7234bd4c1394dda46d09f35bd384dd30cc552ad5541990f98844fb06676e9ca", "wss://relay.example.com"}},
+		Content:   content,
+		Sig:       "908a15e46fb4d8675bab026fc230a0e3542bfade63da02d542fb78b2a8513fcd0092619a2c8c1221e581946e0191f2af505dfdf8657a414dbca329186f009262",
+	}
+}
+
+func TestEventStreamPublish(t *testing.T) {
+	t.Run("Accepted events are acked", func(t *testing.T) {
+		sink := &fakeEventSink{}
+		server, stream := startEventStream(t, sink)
+
+		event := streamTestEvent("héllo över gRPC 🚀")
+		// Relay metadata from clients is ignored
+		event.IsQuarantined = true
+		event.QualityScore = 1
+		helpers.AssertNoError(t, stream.Publish(event))
+
+		frame, err := stream.Recv()
+		helpers.AssertNoError(t, err)
+		helpers.AssertTrue(t, frame.Ack != nil)
+		helpers.AssertStringEqual(t, event.ID, frame.Ack.EventID)
+		helpers.AssertTrue(t, frame.Ack.Accepted)
+
+		sink.mu.Lock()
+		defer sink.mu.Unlock()
+		helpers.AssertIntEqual(t, 1, len(sink.events))
+		received := sink.events[0]
+		helpers.AssertStringEqual(t, event.Content, received.Content)
+		helpers.AssertIntEqual(t, 2, len(received.Tags))
+		helpers.AssertStringEqual(t, "wss://relay.example.com", received.Tags[1][2])
+		helpers.AssertFalse(t, received.IsQuarantined)
+		helpers.AssertFloat64Equal(t, 0, received.QualityScore, 0)
+		helpers.AssertTrue(t, sink.addrs[0] != "")
+
+		stats := server.GetStats()
+		helpers.AssertInt64Equal(t, 1, stats["accepted"].(int64))
+	})
+
+	t.Run("Rejections carry the sink's reason", func(t *testing.T) {
+		sink := &fakeEventSink{reject: "invalid: bad event id or signature"}
+		_, stream := startEventStream(t, sink)
+
+		helpers.AssertNoError(t, stream.Publish(streamTestEvent("spam")))
+
+		frame, err := stream.Recv()
+		helpers.AssertNoError(t, err)
+		helpers.AssertFalse(t, frame.Ack.Accepted)
+		helpers.AssertStringEqual(t, "invalid: bad event id or signature", frame.Ack.Message)
+	})
+
+	t.Run("Publishing without a sink is rejected", func(t *testing.T) {
+		_, stream := startEventStream(t, nil)
+
+		helpers.AssertNoError(t, stream.Publish(streamTestEvent("hello")))
+
+		frame, err := stream.Recv()
+		helpers.AssertNoError(t, err)
+		helpers.AssertFalse(t, frame.Ack.Accepted)
+	})
+}
+
+func TestEventStreamBroadcast(t *testing.T) {
+	server, stream := startEventStream(t, &fakeEventSink{})
+
+	// Wait for the server to register the stream
+	deadline := time.Now().Add(5 * time.Second)
+	for server.GetStats()["streams"].(int) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("stream was not registered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	quarantined := streamTestEvent("quarantined")
+	quarantined.IsQuarantined = true
+	server.Broadcast(quarantined)
+
+	event := streamTestEvent("stored event with ünïcödé")
+	event.Language = "en"
+	server.Broadcast(event)
+
+	frame, err := stream.Recv()
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, frame.Event != nil)
+	received := frame.Event.ToModel()
+	helpers.AssertStringEqual(t, event.Content, received.Content)
+	helpers.AssertStringEqual(t, "en", received.Language)
+	helpers.AssertIntEqual(t, len(event.Tags), len(received.Tags))
+}
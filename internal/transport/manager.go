@@ -4,10 +4,22 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	"mercury-relay/internal/config"
 )
 
+// Transport names accepted by EnableTransport and DisableTransport
+const (
+	TransportTor = "tor"
+	TransportI2P = "i2p"
+	TransportSSH = "ssh"
+)
+
+// ErrUnknownTransport is returned for transport names the manager does not know
+var ErrUnknownTransport = fmt.Errorf("unknown transport")
+
 type Manager struct {
 	torConfig config.TorConfig
 	i2pConfig config.I2PConfig
@@ -15,6 +27,21 @@ type Manager struct {
 	tor       *TorTransport
 	i2p       *I2PTransport
 	ssh       *SSHTransport
+
+	// ctx is the relay lifetime context captured in Start, used for transports
+	// brought up at runtime
+	ctx       context.Context
+	mu        sync.RWMutex
+	changedAt map[string]time.Time
+}
+
+// TransportStatus describes the runtime state of a single transport
+type TransportStatus struct {
+	Name      string    `json:"name"`
+	Enabled   bool      `json:"enabled"`
+	Healthy   bool      `json:"healthy"`
+	Address   string    `json:"address,omitempty"`
+	ChangedAt time.Time `json:"changed_at"`
 }
 
 func NewManager(torConfig config.TorConfig, i2pConfig config.I2PConfig, sshConfig config.SSHConfig) *Manager {
@@ -22,10 +49,15 @@ func NewManager(torConfig config.TorConfig, i2pConfig config.I2PConfig, sshConfi
 		torConfig: torConfig,
 		i2pConfig: i2pConfig,
 		sshConfig: sshConfig,
+		changedAt: make(map[string]time.Time),
 	}
 }
 
 func (m *Manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.ctx = ctx
 	var errors []error
 
 	// Start Tor if enabled
@@ -70,6 +102,9 @@ func (m *Manager) Start(ctx context.Context) error {
 }
 
 func (m *Manager) Stop() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
 	var errors []error
 
 	if m.tor != nil {
@@ -98,6 +133,9 @@ func (m *Manager) Stop() error {
 }
 
 func (m *Manager) GetTorAddress() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	if m.tor != nil {
 		return m.tor.GetAddress()
 	}
@@ -105,6 +143,9 @@ func (m *Manager) GetTorAddress() string {
 }
 
 func (m *Manager) GetI2PAddress() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	if m.i2p != nil {
 		return m.i2p.GetAddress()
 	}
@@ -112,6 +153,9 @@ func (m *Manager) GetI2PAddress() string {
 }
 
 func (m *Manager) IsTorHealthy() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	if m.tor != nil {
 		return m.tor.IsHealthy()
 	}
@@ -119,6 +163,9 @@ func (m *Manager) IsTorHealthy() bool {
 }
 
 func (m *Manager) IsI2PHealthy() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	if m.i2p != nil {
 		return m.i2p.IsHealthy()
 	}
@@ -126,6 +173,9 @@ func (m *Manager) IsI2PHealthy() bool {
 }
 
 func (m *Manager) GetSSHAddress() string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	if m.ssh != nil {
 		return m.ssh.GetAddress()
 	}
@@ -133,6 +183,9 @@ func (m *Manager) GetSSHAddress() string {
 }
 
 func (m *Manager) IsSSHHealthy() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	if m.ssh != nil {
 		return m.ssh.IsHealthy()
 	}
@@ -140,5 +193,126 @@ func (m *Manager) IsSSHHealthy() bool {
 }
 
 func (m *Manager) GetSSHTransport() *SSHTransport {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
 	return m.ssh
 }
+
+// EnableTransport starts the named transport without restarting the relay.
+// Enabling a transport that is already running is a no-op.
+func (m *Manager) EnableTransport(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	ctx := m.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	switch name {
+	case TransportTor:
+		if m.tor != nil {
+			return nil
+		}
+		tor := NewTorTransport(m.torConfig)
+		if err := tor.Start(ctx); err != nil {
+			tor.Stop()
+			return fmt.Errorf("failed to start Tor transport: %w", err)
+		}
+		m.tor = tor
+	case TransportI2P:
+		if m.i2p != nil {
+			return nil
+		}
+		i2p := NewI2PTransport(m.i2pConfig)
+		if err := i2p.Start(ctx); err != nil {
+			i2p.Stop()
+			return fmt.Errorf("failed to start I2P transport: %w", err)
+		}
+		m.i2p = i2p
+	case TransportSSH:
+		if m.ssh != nil {
+			return nil
+		}
+		ssh := NewSSHTransport(m.sshConfig)
+		if err := ssh.Start(ctx); err != nil {
+			ssh.Stop()
+			return fmt.Errorf("failed to start SSH transport: %w", err)
+		}
+		m.ssh = ssh
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownTransport, name)
+	}
+
+	m.changedAt[name] = time.Now()
+	log.Printf("Transport %s enabled at runtime", name)
+	return nil
+}
+
+// DisableTransport stops the named transport. Disabling a transport that is
+// not running is a no-op.
+func (m *Manager) DisableTransport(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var err error
+	switch name {
+	case TransportTor:
+		if m.tor == nil {
+			return nil
+		}
+		err = m.tor.Stop()
+		m.tor = nil
+	case TransportI2P:
+		if m.i2p == nil {
+			return nil
+		}
+		err = m.i2p.Stop()
+		m.i2p = nil
+	case TransportSSH:
+		if m.ssh == nil {
+			return nil
+		}
+		err = m.ssh.Stop()
+		m.ssh = nil
+	default:
+		return fmt.Errorf("%w: %s", ErrUnknownTransport, name)
+	}
+
+	m.changedAt[name] = time.Now()
+	log.Printf("Transport %s disabled at runtime", name)
+	if err != nil {
+		return fmt.Errorf("failed to stop %s transport: %w", name, err)
+	}
+	return nil
+}
+
+// GetTransportStatus returns the state of every transport the manager knows about
+func (m *Manager) GetTransportStatus() []TransportStatus {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tor := TransportStatus{Name: TransportTor, ChangedAt: m.changedAt[TransportTor]}
+	if m.tor != nil {
+		tor.Enabled = true
+		tor.Healthy = m.tor.IsHealthy()
+		tor.Address = m.tor.GetAddress()
+	}
+
+	i2p := TransportStatus{Name: TransportI2P, ChangedAt: m.changedAt[TransportI2P]}
+	if m.i2p != nil {
+		i2p.Enabled = true
+		i2p.Healthy = m.i2p.IsHealthy()
+		i2p.Address = m.i2p.GetAddress()
+	}
+
+	ssh := TransportStatus{Name: TransportSSH, ChangedAt: m.changedAt[TransportSSH]}
+	if m.ssh != nil {
+		ssh.Enabled = true
+		ssh.Healthy = m.ssh.IsHealthy()
+		ssh.Address = m.ssh.GetAddress()
+	}
+
+	return []TransportStatus{tor, i2p, ssh}
+}
@@ -0,0 +1,45 @@
+package transport
+
+import (
+	"errors"
+	"testing"
+
+	"mercury-relay/internal/config"
+	"mercury-relay/test/helpers"
+)
+
+func TestManagerTransportToggling(t *testing.T) {
+	m := NewManager(config.TorConfig{}, config.I2PConfig{}, config.SSHConfig{})
+
+	t.Run("Status lists all transports as disabled", func(t *testing.T) {
+		status := m.GetTransportStatus()
+		helpers.AssertIntEqual(t, 3, len(status))
+		helpers.AssertStringEqual(t, TransportTor, status[0].Name)
+		helpers.AssertStringEqual(t, TransportI2P, status[1].Name)
+		helpers.AssertStringEqual(t, TransportSSH, status[2].Name)
+		for _, s := range status {
+			helpers.AssertBoolEqual(t, false, s.Enabled)
+			helpers.AssertBoolEqual(t, false, s.Healthy)
+		}
+	})
+
+	t.Run("Unknown transport is rejected", func(t *testing.T) {
+		err := m.EnableTransport("carrier-pigeon")
+		helpers.AssertBoolEqual(t, true, errors.Is(err, ErrUnknownTransport))
+
+		err = m.DisableTransport("carrier-pigeon")
+		helpers.AssertBoolEqual(t, true, errors.Is(err, ErrUnknownTransport))
+	})
+
+	t.Run("Disabling a stopped transport is a no-op", func(t *testing.T) {
+		helpers.AssertNoError(t, m.DisableTransport(TransportSSH))
+		helpers.AssertBoolEqual(t, false, m.IsSSHHealthy())
+	})
+
+	t.Run("Failed enable leaves transport disabled", func(t *testing.T) {
+		// Nothing listens on port 1, so the SAM bridge dial fails
+		m := NewManager(config.TorConfig{}, config.I2PConfig{SAMHost: "127.0.0.1", SAMPort: 1}, config.SSHConfig{})
+		helpers.AssertError(t, m.EnableTransport(TransportI2P))
+		helpers.AssertBoolEqual(t, false, m.GetTransportStatus()[1].Enabled)
+	})
+}
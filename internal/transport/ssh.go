@@ -1,6 +1,7 @@
 package transport
 
 import (
+	"bufio"
 	"context"
 	"crypto/rand"
 	"crypto/rsa"
@@ -12,6 +13,7 @@ import (
 	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"time"
 
@@ -26,6 +28,9 @@ type SSHTransport struct {
 	keyManager *SSHKeyManager
 	mu         sync.RWMutex
 	healthy    bool
+
+	// Failed terminal logins per IP
+	terminalAttempts *terminalAttempts
 }
 
 type SSHKeyManager struct {
@@ -43,23 +48,28 @@ func NewSSHKeyManager(config config.SSHKeyStorage) *SSHKeyManager {
 }
 
 type SSHKey struct {
-	Name       string
-	PrivateKey *rsa.PrivateKey
-	PublicKey  ssh.PublicKey
-	CreatedAt  time.Time
-	Comment    string
-	OwnerNpub  string // Nostr pubkey of the owner
+	Name        string
+	PrivateKey  *rsa.PrivateKey
+	PublicKey   ssh.PublicKey
+	Fingerprint string // SHA256 fingerprint of the public key
+	CreatedAt   time.Time
+	Comment     string
+	OwnerNpub   string // Nostr pubkey of the owner
 }
 
 // SSHKeyInfo represents public information about an SSH key for API responses
 type SSHKeyInfo struct {
-	Name      string `json:"name"`
-	Type      string `json:"type"`
-	CreatedAt string `json:"created_at"`
-	Comment   string `json:"comment"`
-	OwnerNpub string `json:"owner_npub"`
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Fingerprint string `json:"fingerprint"`
+	CreatedAt   string `json:"created_at"`
+	Comment     string `json:"comment"`
+	OwnerNpub   string `json:"owner_npub"`
 }
 
+// ErrDuplicateSSHKey is returned when an owner uploads key material they have already stored
+var ErrDuplicateSSHKey = fmt.Errorf("ssh key with this fingerprint already exists")
+
 type SSHConnection struct {
 	Client     *ssh.Client
 	Session    *ssh.Session
@@ -79,6 +89,10 @@ func NewSSHTransport(config config.SSHConfig) *SSHTransport {
 		config:     config,
 		keyManager: keyManager,
 		healthy:    false,
+		terminalAttempts: newTerminalAttempts(
+			config.TerminalInterface.MaxAuthAttempts,
+			config.TerminalInterface.AuthWindow,
+		),
 	}
 }
 
@@ -127,6 +141,11 @@ func (s *SSHTransport) IsHealthy() bool {
 	return s.healthy
 }
 
+// GetKeyManager returns the key manager backing this transport
+func (s *SSHTransport) GetKeyManager() *SSHKeyManager {
+	return s.keyManager
+}
+
 func (s *SSHTransport) GetAddress() string {
 	return fmt.Sprintf("%s:%d", s.config.Connection.Host, s.config.Connection.Port)
 }
@@ -197,34 +216,80 @@ func (s *SSHTransport) startTerminalInterface(ctx context.Context) {
 	}
 }
 
+// handleTerminalConnection asks the client to sign a challenge with their
+// Nostr key before any command is accepted. Commands then only touch the
+// SSH keys of the authenticated pubkey.
 func (s *SSHTransport) handleTerminalConnection(conn net.Conn) {
 	defer conn.Close()
 
-	// Simple terminal interface for key management
+	ip := terminalRemoteIP(conn)
+	if !s.terminalAttempts.allow(ip, time.Now()) {
+		conn.Write([]byte("Too many failed authentication attempts, try again later.\n"))
+		return
+	}
+
+	challenge, err := newTerminalChallenge()
+	if err != nil {
+		log.Printf("Terminal connection error: %v", err)
+		return
+	}
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 4096), terminalMaxLine)
+
 	conn.Write([]byte("Mercury Relay SSH Key Manager\n"))
-	conn.Write([]byte("Commands: list, add, remove, help, quit\n"))
+	conn.Write([]byte("Sign a kind 22242 event with your Nostr key (nsec or browser extension)\n"))
+	conn.Write([]byte("carrying the tag [\"challenge\", \"" + challenge + "\"] and paste it as JSON on one line.\n"))
+	conn.Write([]byte("challenge: " + challenge + "\n"))
+
+	conn.SetReadDeadline(time.Now().Add(terminalAuthTimeout))
+	pubkey := ""
+	for pubkey == "" {
+		conn.Write([]byte("auth> "))
+		if !scanner.Scan() {
+			s.logTerminalError(scanner.Err())
+			return
+		}
 
-	buffer := make([]byte, 1024)
-	for {
-		conn.Write([]byte("ssh> "))
-		n, err := conn.Read(buffer)
+		signer, err := verifyTerminalAuth(strings.TrimSpace(scanner.Text()), challenge, time.Now())
 		if err != nil {
-			if err != io.EOF {
-				log.Printf("Terminal connection error: %v", err)
+			log.Printf("Terminal authentication from %s failed: %v", ip, err)
+			s.terminalAttempts.fail(ip, time.Now())
+			conn.Write([]byte("❌ " + err.Error() + "\n"))
+			if !s.terminalAttempts.allow(ip, time.Now()) {
+				conn.Write([]byte("Too many failed authentication attempts, try again later.\n"))
+				return
 			}
+			continue
+		}
+		pubkey = signer
+	}
+	conn.SetReadDeadline(time.Time{})
+	s.terminalAttempts.reset(ip)
+
+	log.Printf("Terminal user %s authenticated from %s", pubkey, ip)
+	conn.Write([]byte("✅ Authenticated as " + pubkey + "\n"))
+	conn.Write([]byte("Commands: list, add, remove <fingerprint>, help, quit\n"))
+
+	for {
+		conn.Write([]byte("ssh> "))
+		if !scanner.Scan() {
+			s.logTerminalError(scanner.Err())
 			return
 		}
 
-		command := string(buffer[:n])
-		command = command[:len(command)-1] // Remove newline
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
 
-		switch command {
+		switch fields[0] {
 		case "list":
-			s.handleListKeys(conn)
+			s.handleListKeys(conn, pubkey)
 		case "add":
 			s.handleAddKey(conn)
 		case "remove":
-			s.handleRemoveKey(conn)
+			s.handleRemoveKey(conn, pubkey, fields[1:])
 		case "help":
 			s.handleHelp(conn)
 		case "quit":
@@ -236,45 +301,53 @@ func (s *SSHTransport) handleTerminalConnection(conn net.Conn) {
 	}
 }
 
-func (s *SSHTransport) handleListKeys(conn net.Conn) {
-	conn.Write([]byte("❌ Authentication required for SSH key management.\n"))
-	conn.Write([]byte("Please use the Nostr-authenticated SSH key manager:\n"))
-	conn.Write([]byte("  export MERCURY_PRIVATE_KEY=\"nsec1your-private-key\"\n"))
-	conn.Write([]byte("  ./nostr-ssh-manager\n"))
+func (s *SSHTransport) logTerminalError(err error) {
+	if err != nil && err != io.EOF {
+		log.Printf("Terminal connection error: %v", err)
+	}
 }
 
+func (s *SSHTransport) handleListKeys(conn net.Conn, pubkey string) {
+	keys := s.keyManager.ListKeysByOwner(pubkey)
+	if len(keys) == 0 {
+		conn.Write([]byte("No SSH keys.\n"))
+		return
+	}
+	for _, key := range keys {
+		conn.Write([]byte(fmt.Sprintf("%s  %s  %s  %s\n", key.Name, key.Fingerprint, key.CreatedAt, key.Comment)))
+	}
+}
+
+// handleAddKey points to the REST API: key material shouldn't cross an
+// unencrypted TCP connection
 func (s *SSHTransport) handleAddKey(conn net.Conn) {
-	conn.Write([]byte("❌ Authentication required for SSH key management.\n"))
-	conn.Write([]byte("Please use the Nostr-authenticated SSH key manager:\n"))
+	conn.Write([]byte("Keys can't be uploaded over this connection. Use the Nostr-authenticated SSH key manager:\n"))
 	conn.Write([]byte("  export MERCURY_PRIVATE_KEY=\"nsec1your-private-key\"\n"))
 	conn.Write([]byte("  ./nostr-ssh-manager\n"))
 }
 
-func (s *SSHTransport) handleRemoveKey(conn net.Conn) {
-	conn.Write([]byte("❌ Authentication required for SSH key management.\n"))
-	conn.Write([]byte("Please use the Nostr-authenticated SSH key manager:\n"))
-	conn.Write([]byte("  export MERCURY_PRIVATE_KEY=\"nsec1your-private-key\"\n"))
-	conn.Write([]byte("  ./nostr-ssh-manager\n"))
+func (s *SSHTransport) handleRemoveKey(conn net.Conn, pubkey string, args []string) {
+	if len(args) != 1 {
+		conn.Write([]byte("Usage: remove <fingerprint>\n"))
+		return
+	}
+
+	name, err := s.keyManager.RemoveKeyByFingerprint(args[0], pubkey)
+	if err != nil {
+		conn.Write([]byte("❌ " + err.Error() + "\n"))
+		return
+	}
+	conn.Write([]byte("Removed " + name + "\n"))
 }
 
 func (s *SSHTransport) handleHelp(conn net.Conn) {
-	conn.Write([]byte("🔐 SSH Key Management - Nostr Authentication Required\n"))
-	conn.Write([]byte("==================================================\n"))
-	conn.Write([]byte("❌ This terminal interface requires Nostr authentication.\n"))
-	conn.Write([]byte("Please use the Nostr-authenticated SSH key manager:\n"))
-	conn.Write([]byte("\n"))
-	conn.Write([]byte("1. Set your Nostr private key:\n"))
-	conn.Write([]byte("   export MERCURY_PRIVATE_KEY=\"nsec1your-private-key\"\n"))
-	conn.Write([]byte("\n"))
-	conn.Write([]byte("2. Run the authenticated SSH key manager:\n"))
-	conn.Write([]byte("   ./nostr-ssh-manager\n"))
-	conn.Write([]byte("\n"))
-	conn.Write([]byte("Available commands in authenticated mode:\n"))
-	conn.Write([]byte("  list   - List your SSH keys\n"))
-	conn.Write([]byte("  add    - Add a new SSH key\n"))
-	conn.Write([]byte("  remove - Remove an SSH key\n"))
-	conn.Write([]byte("  help   - Show this help message\n"))
-	conn.Write([]byte("  quit   - Exit the terminal\n"))
+	conn.Write([]byte("🔐 SSH Key Management\n"))
+	conn.Write([]byte("====================\n"))
+	conn.Write([]byte("  list                 - List your SSH keys\n"))
+	conn.Write([]byte("  add                  - How to add a new SSH key\n"))
+	conn.Write([]byte("  remove <fingerprint> - Remove one of your SSH keys\n"))
+	conn.Write([]byte("  help                 - Show this help message\n"))
+	conn.Write([]byte("  quit                 - Exit the terminal\n"))
 }
 
 // SSHKeyManager methods
@@ -344,11 +417,12 @@ func (km *SSHKeyManager) loadKey(name string) error {
 
 	// Create SSH key object
 	sshKey := &SSHKey{
-		Name:       name,
-		PrivateKey: privateKey,
-		PublicKey:  publicKey,
-		CreatedAt:  time.Now(), // In practice, you'd get this from file metadata
-		Comment:    fmt.Sprintf("%s@mercury-relay", name),
+		Name:        name,
+		PrivateKey:  privateKey,
+		PublicKey:   publicKey,
+		Fingerprint: ssh.FingerprintSHA256(publicKey),
+		CreatedAt:   time.Now(), // In practice, you'd get this from file metadata
+		Comment:     fmt.Sprintf("%s@mercury-relay", name),
 	}
 
 	km.keys[name] = sshKey
@@ -373,11 +447,12 @@ func (km *SSHKeyManager) GenerateKey(name, comment string) (*SSHKey, error) {
 
 	// Create SSH key object
 	sshKey := &SSHKey{
-		Name:       name,
-		PrivateKey: privateKey,
-		PublicKey:  publicKey,
-		CreatedAt:  time.Now(),
-		Comment:    comment,
+		Name:        name,
+		PrivateKey:  privateKey,
+		PublicKey:   publicKey,
+		Fingerprint: ssh.FingerprintSHA256(publicKey),
+		CreatedAt:   time.Now(),
+		Comment:     comment,
 	}
 
 	// Save keys to disk
@@ -425,13 +500,7 @@ func (km *SSHKeyManager) ListKeys() []SSHKeyInfo {
 
 	keys := make([]SSHKeyInfo, 0, len(km.keys))
 	for _, key := range km.keys {
-		keys = append(keys, SSHKeyInfo{
-			Name:      key.Name,
-			Type:      "rsa", // Default type, could be determined from key
-			CreatedAt: key.CreatedAt.Format("2006-01-02 15:04:05"),
-			Comment:   key.Comment,
-			OwnerNpub: key.OwnerNpub,
-		})
+		keys = append(keys, key.Info())
 	}
 	return keys
 }
@@ -444,18 +513,46 @@ func (km *SSHKeyManager) ListKeysByOwner(ownerNpub string) []SSHKeyInfo {
 	keys := make([]SSHKeyInfo, 0)
 	for _, key := range km.keys {
 		if key.OwnerNpub == ownerNpub {
-			keys = append(keys, SSHKeyInfo{
-				Name:      key.Name,
-				Type:      "rsa", // Default type, could be determined from key
-				CreatedAt: key.CreatedAt.Format("2006-01-02 15:04:05"),
-				Comment:   key.Comment,
-				OwnerNpub: key.OwnerNpub,
-			})
+			keys = append(keys, key.Info())
 		}
 	}
 	return keys
 }
 
+// Info returns the public information about the key
+func (k *SSHKey) Info() SSHKeyInfo {
+	return SSHKeyInfo{
+		Name:        k.Name,
+		Type:        "rsa", // Default type, could be determined from key
+		Fingerprint: k.Fingerprint,
+		CreatedAt:   k.CreatedAt.Format("2006-01-02 15:04:05"),
+		Comment:     k.Comment,
+		OwnerNpub:   k.OwnerNpub,
+	}
+}
+
+// GetKeyByFingerprint looks up a key by its SHA256 fingerprint
+func (km *SSHKeyManager) GetKeyByFingerprint(fingerprint string) (*SSHKey, bool) {
+	km.mu.RLock()
+	defer km.mu.RUnlock()
+	return km.findByFingerprint(fingerprint, "")
+}
+
+// findByFingerprint returns the first key with the given fingerprint,
+// optionally restricted to one owner. Callers must hold km.mu.
+func (km *SSHKeyManager) findByFingerprint(fingerprint, ownerNpub string) (*SSHKey, bool) {
+	for _, key := range km.keys {
+		if key.Fingerprint != fingerprint {
+			continue
+		}
+		if ownerNpub != "" && key.OwnerNpub != ownerNpub {
+			continue
+		}
+		return key, true
+	}
+	return nil, false
+}
+
 // IsOwner checks if a Nostr pubkey owns a specific SSH key
 func (km *SSHKeyManager) IsOwner(keyName, ownerNpub string) bool {
 	km.mu.RLock()
@@ -472,6 +569,25 @@ func (km *SSHKeyManager) RemoveKey(name string) error {
 	km.mu.Lock()
 	defer km.mu.Unlock()
 
+	return km.removeKey(name)
+}
+
+// RemoveKeyByFingerprint removes the key owned by ownerNpub with the given
+// fingerprint and returns its name
+func (km *SSHKeyManager) RemoveKeyByFingerprint(fingerprint, ownerNpub string) (string, error) {
+	km.mu.Lock()
+	defer km.mu.Unlock()
+
+	key, exists := km.findByFingerprint(fingerprint, ownerNpub)
+	if !exists {
+		return "", fmt.Errorf("key with fingerprint %s not found", fingerprint)
+	}
+
+	return key.Name, km.removeKey(key.Name)
+}
+
+// removeKey deletes a key from disk and memory. Callers must hold km.mu.
+func (km *SSHKeyManager) removeKey(name string) error {
 	_, exists := km.keys[name]
 	if !exists {
 		return fmt.Errorf("key %s not found", name)
@@ -519,14 +635,21 @@ func (km *SSHKeyManager) SaveKey(name string, privateKeyData, publicKeyData []by
 		}
 	}
 
+	// Reject key material the owner has already stored under another name
+	fingerprint := ssh.FingerprintSHA256(publicKey)
+	if existing, exists := km.findByFingerprint(fingerprint, ownerNpub); exists {
+		return fmt.Errorf("%w: %s is already stored as %s", ErrDuplicateSSHKey, fingerprint, existing.Name)
+	}
+
 	// Create SSH key object
 	sshKey := &SSHKey{
-		Name:       name,
-		PrivateKey: privateKey,
-		PublicKey:  publicKey,
-		CreatedAt:  time.Now(),
-		Comment:    fmt.Sprintf("Uploaded key %s", name),
-		OwnerNpub:  ownerNpub,
+		Name:        name,
+		PrivateKey:  privateKey,
+		PublicKey:   publicKey,
+		Fingerprint: fingerprint,
+		CreatedAt:   time.Now(),
+		Comment:     fmt.Sprintf("Uploaded key %s", name),
+		OwnerNpub:   ownerNpub,
 	}
 
 	// Save private key to file
@@ -1,15 +1,22 @@
 package transport
 
 import (
+	"bufio"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
 	"mercury-relay/internal/config"
 	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
 )
 
 func TestSSHTransport(t *testing.T) {
@@ -333,6 +340,73 @@ func TestSSHKeyManager(t *testing.T) {
 	})
 }
 
+func TestSSHKeyFingerprints(t *testing.T) {
+	keyDir := fmt.Sprintf("./test-ssh-keys-fp-%d", time.Now().UnixNano())
+	defer os.RemoveAll(keyDir)
+
+	km := NewSSHKeyManager(config.SSHKeyStorage{
+		KeyDir:        keyDir,
+		PrivateKeyExt: ".pem",
+		PublicKeyExt:  ".pub",
+		KeySize:       2048,
+		KeyType:       "rsa",
+	})
+	helpers.AssertNoError(t, km.Initialize())
+
+	generated, err := km.GenerateKey("source-key", "source@mercury-relay")
+	helpers.AssertNoError(t, err)
+	helpers.AssertBoolEqual(t, true, strings.HasPrefix(generated.Fingerprint, "SHA256:"))
+
+	pemData, err := os.ReadFile(filepath.Join(keyDir, "source-key.pem"))
+	helpers.AssertNoError(t, err)
+
+	t.Run("Duplicate for same owner is rejected", func(t *testing.T) {
+		err := km.SaveKey("upload-1", pemData, nil, "npub1owner")
+		helpers.AssertNoError(t, err)
+
+		err = km.SaveKey("upload-2", pemData, nil, "npub1owner")
+		helpers.AssertError(t, err)
+		helpers.AssertBoolEqual(t, true, errors.Is(err, ErrDuplicateSSHKey))
+
+		_, exists := km.GetKey("upload-2")
+		helpers.AssertBoolEqual(t, false, exists)
+	})
+
+	t.Run("Same key for different owner is allowed", func(t *testing.T) {
+		err := km.SaveKey("other-upload", pemData, nil, "npub1other")
+		helpers.AssertNoError(t, err)
+	})
+
+	t.Run("Lookup by fingerprint", func(t *testing.T) {
+		key, exists := km.GetKeyByFingerprint(generated.Fingerprint)
+		helpers.AssertBoolEqual(t, true, exists)
+		helpers.AssertStringEqual(t, generated.Fingerprint, key.Fingerprint)
+
+		_, exists = km.GetKeyByFingerprint("SHA256:missing")
+		helpers.AssertBoolEqual(t, false, exists)
+	})
+
+	t.Run("Remove by fingerprint is scoped to owner", func(t *testing.T) {
+		_, err := km.RemoveKeyByFingerprint(generated.Fingerprint, "npub1stranger")
+		helpers.AssertError(t, err)
+
+		name, err := km.RemoveKeyByFingerprint(generated.Fingerprint, "npub1owner")
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, "upload-1", name)
+
+		_, exists := km.GetKey("upload-1")
+		helpers.AssertBoolEqual(t, false, exists)
+		_, exists = km.GetKey("other-upload")
+		helpers.AssertBoolEqual(t, true, exists)
+	})
+
+	t.Run("Fingerprint is listed", func(t *testing.T) {
+		for _, info := range km.ListKeysByOwner("npub1other") {
+			helpers.AssertStringEqual(t, generated.Fingerprint, info.Fingerprint)
+		}
+	})
+}
+
 func TestWebSocketSSHTunnel(t *testing.T) {
 	// Create test SSH config
 	sshConfig := config.SSHConfig{
@@ -398,3 +472,123 @@ func TestWebSocketSSHTunnel(t *testing.T) {
 		helpers.AssertIntEqual(t, 0, stats["total_connections"].(int))
 	})
 }
+
+// terminalSession drives a terminal connection over an in-memory pipe
+type terminalSession struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+func startTerminalSession(t *testing.T, s *SSHTransport) *terminalSession {
+	t.Helper()
+	client, server := net.Pipe()
+	go s.handleTerminalConnection(server)
+	t.Cleanup(func() { client.Close() })
+	client.SetDeadline(time.Now().Add(10 * time.Second))
+	return &terminalSession{conn: client, reader: bufio.NewReader(client)}
+}
+
+// readUntil returns the output up to and including marker
+func (ts *terminalSession) readUntil(t *testing.T, marker string) string {
+	t.Helper()
+	var out strings.Builder
+	for !strings.HasSuffix(out.String(), marker) {
+		b, err := ts.reader.ReadByte()
+		if err != nil {
+			t.Fatalf("reading until %q: %v (got %q)", marker, err, out.String())
+		}
+		out.WriteByte(b)
+	}
+	return out.String()
+}
+
+func (ts *terminalSession) send(line string) {
+	ts.conn.Write([]byte(line + "\n"))
+}
+
+func signTerminalAuth(sk, challenge string, createdAt time.Time) string {
+	event := nostr.Event{
+		Kind:      22242,
+		CreatedAt: nostr.Timestamp(createdAt.Unix()),
+		Tags:      nostr.Tags{{"relay", "ssh://localhost:2222"}, {"challenge", challenge}},
+	}
+	event.Sign(sk)
+	data, _ := json.Marshal(event)
+	return string(data)
+}
+
+func TestTerminalAuthentication(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	pubkey, _ := nostr.GetPublicKey(sk)
+
+	newTransport := func() *SSHTransport {
+		s := NewSSHTransport(config.SSHConfig{
+			TerminalInterface: config.TerminalInterface{MaxAuthAttempts: 2, AuthWindow: time.Minute},
+		})
+		s.keyManager.keys["mine"] = &SSHKey{Name: "mine", Fingerprint: "SHA256:mine", OwnerNpub: pubkey}
+		s.keyManager.keys["theirs"] = &SSHKey{Name: "theirs", Fingerprint: "SHA256:theirs", OwnerNpub: "someone-else"}
+		return s
+	}
+
+	challengeOf := func(banner string) string {
+		i := strings.Index(banner, "challenge: ")
+		return strings.TrimSpace(banner[i+len("challenge: ") : strings.Index(banner, "auth> ")])
+	}
+
+	t.Run("Commands require a signed challenge", func(t *testing.T) {
+		ts := startTerminalSession(t, newTransport())
+		challenge := challengeOf(ts.readUntil(t, "auth> "))
+
+		ts.send("list")
+		helpers.AssertStringContains(t, ts.readUntil(t, "auth> "), "expected a signed event")
+
+		ts.send(signTerminalAuth(sk, challenge, time.Now()))
+		helpers.AssertStringContains(t, ts.readUntil(t, "ssh> "), "Authenticated as "+pubkey)
+
+		ts.send("list")
+		listing := ts.readUntil(t, "ssh> ")
+		helpers.AssertStringContains(t, listing, "SHA256:mine")
+		helpers.AssertFalse(t, strings.Contains(listing, "SHA256:theirs"))
+
+		ts.send("quit")
+		helpers.AssertStringContains(t, ts.readUntil(t, "Goodbye!\n"), "Goodbye!")
+	})
+
+	t.Run("Rejects bad responses", func(t *testing.T) {
+		challenge := "abc"
+		now := time.Now()
+
+		_, err := verifyTerminalAuth(signTerminalAuth(sk, "other", now), challenge, now)
+		helpers.AssertTrue(t, errors.Is(err, ErrTerminalAuthFailed))
+
+		_, err = verifyTerminalAuth(signTerminalAuth(sk, challenge, now.Add(-time.Hour)), challenge, now)
+		helpers.AssertTrue(t, errors.Is(err, ErrTerminalAuthFailed))
+
+		var tampered nostr.Event
+		json.Unmarshal([]byte(signTerminalAuth(sk, challenge, now)), &tampered)
+		tampered.Content = "changed"
+		data, _ := json.Marshal(tampered)
+		_, err = verifyTerminalAuth(string(data), challenge, now)
+		helpers.AssertTrue(t, errors.Is(err, ErrTerminalAuthFailed))
+
+		signer, err := verifyTerminalAuth(signTerminalAuth(sk, challenge, now), challenge, now)
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, pubkey, signer)
+	})
+
+	t.Run("Limits failed attempts per IP", func(t *testing.T) {
+		s := newTransport()
+		ts := startTerminalSession(t, s)
+		ts.readUntil(t, "auth> ")
+		ts.send(signTerminalAuth(sk, "wrong", time.Now()))
+		ts.readUntil(t, "auth> ")
+		ts.send(signTerminalAuth(sk, "wrong", time.Now()))
+		helpers.AssertStringContains(t, ts.readUntil(t, "later.\n"), "Too many failed authentication attempts")
+
+		// A new connection from the same address is turned away at once
+		ts = startTerminalSession(t, s)
+		helpers.AssertStringContains(t, ts.readUntil(t, "later.\n"), "Too many failed authentication attempts")
+
+		helpers.AssertTrue(t, s.terminalAttempts.allow("pipe", time.Now().Add(2*time.Minute)))
+	})
+}
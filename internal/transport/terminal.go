@@ -0,0 +1,139 @@
+package transport
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+const (
+	// terminalAuthKind is the NIP-42 style event signed to answer a challenge
+	terminalAuthKind = 22242
+
+	// terminalAuthMaxAge bounds how far the signed event's created_at may be
+	// from now
+	terminalAuthMaxAge = 10 * time.Minute
+
+	// terminalAuthTimeout is how long a connection may take to authenticate
+	terminalAuthTimeout = 5 * time.Minute
+
+	// terminalMaxLine bounds a pasted line; signed events are well below it
+	terminalMaxLine = 64 * 1024
+)
+
+// ErrTerminalAuthFailed is returned when a challenge response doesn't verify
+var ErrTerminalAuthFailed = fmt.Errorf("terminal authentication failed")
+
+// newTerminalChallenge returns a random challenge for one connection
+func newTerminalChallenge() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate challenge: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// verifyTerminalAuth checks a pasted kind 22242 event answering challenge
+// and returns the signer's pubkey
+func verifyTerminalAuth(line, challenge string, now time.Time) (string, error) {
+	var event nostr.Event
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		return "", fmt.Errorf("%w: expected a signed event as JSON on one line", ErrTerminalAuthFailed)
+	}
+
+	if event.Kind != terminalAuthKind {
+		return "", fmt.Errorf("%w: expected kind %d, got %d", ErrTerminalAuthFailed, terminalAuthKind, event.Kind)
+	}
+
+	created := event.CreatedAt.Time()
+	if created.Before(now.Add(-terminalAuthMaxAge)) || created.After(now.Add(terminalAuthMaxAge)) {
+		return "", fmt.Errorf("%w: created_at is not recent", ErrTerminalAuthFailed)
+	}
+
+	if event.Tags.FindWithValue("challenge", challenge) == nil {
+		return "", fmt.Errorf("%w: challenge tag doesn't match", ErrTerminalAuthFailed)
+	}
+
+	if !event.CheckID() {
+		return "", fmt.Errorf("%w: bad event id", ErrTerminalAuthFailed)
+	}
+	if ok, err := event.CheckSignature(); err != nil || !ok {
+		return "", fmt.Errorf("%w: bad signature", ErrTerminalAuthFailed)
+	}
+
+	return event.PubKey, nil
+}
+
+// terminalAttempts counts failed challenge responses per IP
+type terminalAttempts struct {
+	max      int
+	window   time.Duration
+	failures map[string][]time.Time
+	mu       sync.Mutex
+}
+
+func newTerminalAttempts(max int, window time.Duration) *terminalAttempts {
+	return &terminalAttempts{
+		max:      max,
+		window:   window,
+		failures: make(map[string][]time.Time),
+	}
+}
+
+// allow reports whether ip may still try to authenticate
+func (a *terminalAttempts) allow(ip string, now time.Time) bool {
+	if a.max <= 0 {
+		return true
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.prune(ip, now)) < a.max
+}
+
+// fail records a failed attempt from ip
+func (a *terminalAttempts) fail(ip string, now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.failures[ip] = append(a.prune(ip, now), now)
+}
+
+// reset forgets the failures of ip once it authenticates
+func (a *terminalAttempts) reset(ip string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.failures, ip)
+}
+
+// prune drops failures older than the window. Callers must hold a.mu.
+func (a *terminalAttempts) prune(ip string, now time.Time) []time.Time {
+	failures := a.failures[ip]
+	kept := failures[:0]
+	for _, at := range failures {
+		if now.Sub(at) < a.window {
+			kept = append(kept, at)
+		}
+	}
+	if len(kept) == 0 {
+		delete(a.failures, ip)
+		return nil
+	}
+	a.failures[ip] = kept
+	return kept
+}
+
+// terminalRemoteIP returns the IP of a terminal connection, or its whole
+// address when it has no port
+func terminalRemoteIP(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
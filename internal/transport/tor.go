@@ -104,7 +104,7 @@ func (t *TorTransport) waitForHiddenService() {
 
 func (t *TorTransport) Stop() error {
 	t.cancel()
-	if t.process != nil {
+	if t.process != nil && t.process.Process != nil {
 		return t.process.Process.Kill()
 	}
 	return nil
@@ -37,7 +37,7 @@ func NewWebSocketSSHTunnel(sshTransport *SSHTransport) *WebSocketSSHTunnel {
 		sshTransport: sshTransport,
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
-				return true // Allow all origins for now
+				return true // Allow all origins until SetOriginCheck
 			},
 			ReadBufferSize:  4096,
 			WriteBufferSize: 4096,
@@ -46,6 +46,11 @@ func NewWebSocketSSHTunnel(sshTransport *SSHTransport) *WebSocketSSHTunnel {
 	}
 }
 
+// SetOriginCheck restricts which browser origins may open a tunnel
+func (wst *WebSocketSSHTunnel) SetOriginCheck(check func(r *http.Request) bool) {
+	wst.upgrader.CheckOrigin = check
+}
+
 func (wst *WebSocketSSHTunnel) HandleWebSocketOverSSH(w http.ResponseWriter, r *http.Request) error {
 	// Upgrade HTTP connection to WebSocket
 	wsConn, err := wst.upgrader.Upgrade(w, r, nil)
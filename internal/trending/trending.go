@@ -0,0 +1,486 @@
+package trending
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Kinds ranked when a query doesn't ask for specific ones
+const (
+	KindNote    = 1
+	KindArticle = 30023
+	KindBook    = 30040
+)
+
+// Engagement kinds counted at ingest
+const (
+	kindReaction = 7
+	kindComment  = 1111
+	kindZap      = 9735
+)
+
+// Weights of each kind of engagement in a score
+const (
+	reactionWeight = 1.0
+	replyWeight    = 3.0
+	zapWeight      = 5.0
+)
+
+// maxLookups bounds the cache lookups per ranked kind while resolving the
+// top targets, so one query can't walk every tracked event
+const maxLookups = 10
+
+// ErrInvalidWindow is returned for a window longer than the tracked one
+var ErrInvalidWindow = fmt.Errorf("invalid trending window")
+
+// DefaultKinds are the notes, articles and books ranked by default
+var DefaultKinds = []int{KindNote, KindArticle, KindBook}
+
+// Query selects what to rank
+type Query struct {
+	Window time.Duration
+	Kinds  []int
+	Limit  int
+}
+
+// Item is one trending event with the engagement it received in the window
+type Item struct {
+	Event     *nostr.Event `json:"event"`
+	Score     float64      `json:"score"`
+	Reactions int          `json:"reactions"`
+	Zaps      int          `json:"zaps"`
+	Replies   int          `json:"replies"`
+}
+
+// Result ranks events per kind
+type Result struct {
+	Window      string         `json:"window"`
+	GeneratedAt time.Time      `json:"generated_at"`
+	Kinds       map[int][]Item `json:"kinds"`
+}
+
+type engagement int
+
+const (
+	reaction engagement = iota
+	reply
+	zap
+)
+
+type hit struct {
+	at   time.Time
+	kind engagement
+}
+
+// target is an engaged event, keyed by event ID or by "kind:pubkey:d"
+// address for addressable events
+type target struct {
+	key  string
+	kind int // 0 until known
+	hits []hit
+}
+
+type cachedResult struct {
+	result  *Result
+	expires time.Time
+}
+
+// Tracker keeps engagement counters for recently engaged events and ranks
+// them with exponential decay
+type Tracker struct {
+	config  config.TrendingConfig
+	cache   cache.Cache
+	targets map[string]*target
+	seen    map[string]time.Time // counted engagement event IDs
+	results map[string]cachedResult
+	mu      sync.Mutex
+}
+
+// NewTracker creates a tracker that resolves ranked events from c
+func NewTracker(cfg config.TrendingConfig, c cache.Cache) *Tracker {
+	return &Tracker{
+		config:  cfg,
+		cache:   c,
+		targets: make(map[string]*target),
+		seen:    make(map[string]time.Time),
+		results: make(map[string]cachedResult),
+	}
+}
+
+// Record counts event if it is a reaction, zap receipt or reply
+func (t *Tracker) Record(event *models.Event) {
+	t.record(event, time.Now())
+}
+
+func (t *Tracker) record(event *models.Event, now time.Time) {
+	if event.IsQuarantined {
+		return
+	}
+
+	kind, ok := engagementKind(event)
+	if !ok {
+		return
+	}
+	key, targetKind := engagementTarget(event)
+	if key == "" || key == event.ID {
+		return
+	}
+
+	// Backfilled engagement from before the window doesn't count
+	at := event.CreatedTime()
+	if !at.After(now.Add(-t.config.Window)) {
+		return
+	}
+	if at.After(now) {
+		at = now
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, counted := t.seen[event.ID]; counted {
+		return
+	}
+	t.seen[event.ID] = at
+
+	tg, ok := t.targets[key]
+	if !ok {
+		if t.config.MaxTargets > 0 && len(t.targets) >= t.config.MaxTargets {
+			t.pruneLocked(now)
+			if len(t.targets) >= t.config.MaxTargets {
+				return
+			}
+		}
+		tg = &target{key: key}
+		t.targets[key] = tg
+	}
+	if tg.kind == 0 {
+		tg.kind = targetKind
+	}
+	tg.hits = append(tg.hits, hit{at: at, kind: kind})
+}
+
+// Run drops engagement older than the window until ctx is done
+func (t *Tracker) Run(ctx context.Context) {
+	interval := t.config.Window / 24
+	if interval < time.Minute {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			t.mu.Lock()
+			t.pruneLocked(now)
+			t.mu.Unlock()
+		}
+	}
+}
+
+// pruneLocked drops hits and counted IDs older than the window, and targets
+// left without hits. Callers must hold t.mu.
+func (t *Tracker) pruneLocked(now time.Time) {
+	cutoff := now.Add(-t.config.Window)
+	for key, tg := range t.targets {
+		kept := tg.hits[:0]
+		for _, h := range tg.hits {
+			if h.at.After(cutoff) {
+				kept = append(kept, h)
+			}
+		}
+		if len(kept) == 0 {
+			delete(t.targets, key)
+			continue
+		}
+		tg.hits = kept
+	}
+	for id, at := range t.seen {
+		if !at.After(cutoff) {
+			delete(t.seen, id)
+		}
+	}
+	for key, cached := range t.results {
+		if now.After(cached.expires) {
+			delete(t.results, key)
+		}
+	}
+}
+
+// Top ranks the events engaged with in q.Window, per kind. Results are
+// cached for the configured TTL.
+func (t *Tracker) Top(ctx context.Context, q Query) (*Result, error) {
+	return t.top(ctx, q, time.Now())
+}
+
+type scored struct {
+	key   string
+	kind  int
+	score float64
+	item  Item
+}
+
+func (t *Tracker) top(ctx context.Context, q Query, now time.Time) (*Result, error) {
+	if q.Window <= 0 {
+		q.Window = t.config.Window
+	}
+	if q.Window > t.config.Window {
+		return nil, fmt.Errorf("%w: at most %s", ErrInvalidWindow, t.config.Window)
+	}
+	if len(q.Kinds) == 0 {
+		q.Kinds = DefaultKinds
+	}
+	if q.Limit <= 0 {
+		q.Limit = 20
+	}
+
+	cacheKey := q.key()
+	t.mu.Lock()
+	if cached, ok := t.results[cacheKey]; ok && now.Before(cached.expires) {
+		t.mu.Unlock()
+		return cached.result, nil
+	}
+	ranked := t.scoreLocked(q.Window, now)
+	t.mu.Unlock()
+
+	wanted := make(map[int]bool, len(q.Kinds))
+	result := &Result{
+		Window:      q.Window.String(),
+		GeneratedAt: now,
+		Kinds:       make(map[int][]Item, len(q.Kinds)),
+	}
+	for _, kind := range q.Kinds {
+		wanted[kind] = true
+		result.Kinds[kind] = []Item{}
+	}
+
+	lookups := 0
+	maxTotal := maxLookups * q.Limit * len(q.Kinds)
+	for _, s := range ranked {
+		if s.kind != 0 && !wanted[s.kind] {
+			continue
+		}
+		if s.kind != 0 && len(result.Kinds[s.kind]) >= q.Limit {
+			continue
+		}
+		if lookups >= maxTotal {
+			break
+		}
+		lookups++
+
+		event, err := t.resolve(ctx, s.key)
+		if err != nil {
+			return nil, err
+		}
+		if event == nil {
+			continue
+		}
+		t.learnKind(s.key, event.Kind)
+		if event.IsQuarantined || !wanted[event.Kind] || len(result.Kinds[event.Kind]) >= q.Limit {
+			continue
+		}
+
+		item := s.item
+		item.Event = event.ToNostrEvent()
+		result.Kinds[event.Kind] = append(result.Kinds[event.Kind], item)
+
+		if full(result, q.Limit) {
+			break
+		}
+	}
+
+	t.mu.Lock()
+	t.results[cacheKey] = cachedResult{result: result, expires: now.Add(t.config.CacheTTL)}
+	t.mu.Unlock()
+
+	return result, nil
+}
+
+// scoreLocked sums the decayed engagement weights of every target within
+// window, highest first. Callers must hold t.mu.
+func (t *Tracker) scoreLocked(window time.Duration, now time.Time) []scored {
+	cutoff := now.Add(-window)
+	halfLife := t.config.HalfLife.Seconds()
+
+	var ranked []scored
+	for key, tg := range t.targets {
+		s := scored{key: key, kind: tg.kind}
+		for _, h := range tg.hits {
+			if !h.at.After(cutoff) {
+				continue
+			}
+			weight := reactionWeight
+			switch h.kind {
+			case reaction:
+				s.item.Reactions++
+			case reply:
+				s.item.Replies++
+				weight = replyWeight
+			case zap:
+				s.item.Zaps++
+				weight = zapWeight
+			}
+			if halfLife > 0 {
+				weight *= math.Pow(0.5, now.Sub(h.at).Seconds()/halfLife)
+			}
+			s.score += weight
+		}
+		if s.score == 0 {
+			continue
+		}
+		s.item.Score = math.Round(s.score*1000) / 1000
+		ranked = append(ranked, s)
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].score != ranked[j].score {
+			return ranked[i].score > ranked[j].score
+		}
+		return ranked[i].key < ranked[j].key
+	})
+	return ranked
+}
+
+// resolve loads the event behind a target key from the cache
+func (t *Tracker) resolve(ctx context.Context, key string) (*models.Event, error) {
+	filter := nostr.Filter{IDs: []string{key}, Limit: 1}
+	if kind, pubkey, d, ok := parseAddress(key); ok {
+		filter = nostr.Filter{Kinds: []int{kind}, Authors: []string{pubkey}, Tags: nostr.TagMap{"d": {d}}, Limit: 1}
+	}
+
+	for event, err := range t.cache.GetEvents(ctx, filter) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to load trending event: %w", err)
+		}
+		return event, nil
+	}
+	return nil, nil
+}
+
+func (t *Tracker) learnKind(key string, kind int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if tg, ok := t.targets[key]; ok && tg.kind == 0 {
+		tg.kind = kind
+	}
+}
+
+func full(result *Result, limit int) bool {
+	for _, items := range result.Kinds {
+		if len(items) < limit {
+			return false
+		}
+	}
+	return true
+}
+
+func (q Query) key() string {
+	kinds := append([]int{}, q.Kinds...)
+	sort.Ints(kinds)
+	parts := make([]string, len(kinds))
+	for i, kind := range kinds {
+		parts[i] = strconv.Itoa(kind)
+	}
+	return fmt.Sprintf("%s|%s|%d", q.Window, strings.Join(parts, ","), q.Limit)
+}
+
+// engagementKind reports whether event counts as engagement, and which.
+// Downvotes ("-" reactions) don't count.
+func engagementKind(event *models.Event) (engagement, bool) {
+	switch event.Kind {
+	case kindReaction:
+		return reaction, event.Content != "-"
+	case kindZap:
+		return zap, true
+	case KindNote:
+		return reply, hasTag(event, "e") || hasTag(event, "a")
+	case kindComment:
+		return reply, true
+	}
+	return 0, false
+}
+
+// engagementTarget returns the key of the event engaged with and its kind
+// when the tags tell. Comments count towards their root (NIP-22), replies
+// towards the event replied to (NIP-10), reactions and zaps towards the last
+// referenced event (NIP-25, NIP-57). Addresses win over event IDs so every
+// version of an article or book shares one counter.
+func engagementTarget(event *models.Event) (string, int) {
+	var address, id, kind string
+
+	switch event.Kind {
+	case kindComment:
+		address, id, kind = lastTag(event, "A"), lastTag(event, "E"), lastTag(event, "K")
+	case KindNote:
+		address = lastTag(event, "a")
+		id = markedTag(event, "reply")
+		if id == "" {
+			id = markedTag(event, "root")
+		}
+		if id == "" {
+			id = lastTag(event, "e")
+		}
+	default:
+		address, id, kind = lastTag(event, "a"), lastTag(event, "e"), lastTag(event, "k")
+	}
+
+	if k, _, _, ok := parseAddress(address); ok {
+		return address, k
+	}
+	if !nostr.IsValid32ByteHex(id) {
+		return "", 0
+	}
+	k, _ := strconv.Atoi(kind)
+	return id, k
+}
+
+func hasTag(event *models.Event, name string) bool {
+	return lastTag(event, name) != ""
+}
+
+func lastTag(event *models.Event, name string) string {
+	for i := len(event.Tags) - 1; i >= 0; i-- {
+		if tag := event.Tags[i]; len(tag) >= 2 && tag[0] == name {
+			return tag[1]
+		}
+	}
+	return ""
+}
+
+// markedTag returns the "e" tag with a NIP-10 marker
+func markedTag(event *models.Event, marker string) string {
+	for _, tag := range event.Tags {
+		if len(tag) >= 4 && tag[0] == "e" && tag[3] == marker {
+			return tag[1]
+		}
+	}
+	return ""
+}
+
+// parseAddress splits a "kind:pubkey:d" address of an addressable event
+func parseAddress(address string) (int, string, string, bool) {
+	parts := strings.SplitN(address, ":", 3)
+	if len(parts) != 3 {
+		return 0, "", "", false
+	}
+	kind, err := strconv.Atoi(parts[0])
+	if err != nil || kind < 30000 || kind >= 40000 || !nostr.IsValid32ByteHex(parts[1]) {
+		return 0, "", "", false
+	}
+	return kind, parts[1], parts[2], true
+}
@@ -0,0 +1,158 @@
+package trending
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+var engagementSeq int
+
+// engage returns a kind event by a fresh pubkey referencing tags
+func engage(kind int, at time.Time, content string, tags nostr.Tags) *models.Event {
+	engagementSeq++
+	return &models.Event{
+		ID:        fmt.Sprintf("%064x", engagementSeq),
+		PubKey:    strings.Repeat("f", 64),
+		CreatedAt: models.Timestamp(at),
+		Kind:      kind,
+		Tags:      tags,
+		Content:   content,
+	}
+}
+
+func newTestTracker(t *testing.T) (*Tracker, cache.Cache) {
+	t.Helper()
+	c := cache.NewMemory(config.CacheConfig{})
+	t.Cleanup(func() { c.Close() })
+	return NewTracker(config.TrendingConfig{
+		Window:     24 * time.Hour,
+		HalfLife:   6 * time.Hour,
+		CacheTTL:   time.Minute,
+		MaxTargets: 100,
+	}, c), c
+}
+
+func TestTrackerTop(t *testing.T) {
+	tracker, c := newTestTracker(t)
+	now := time.Now()
+	eg := models.NewEventGenerator()
+	npub := eg.GetRandomNpub()
+
+	popular := eg.GenerateTextNote(npub, "Popular", nostr.Tags{})
+	quiet := eg.GenerateTextNote(npub, "Quiet", nostr.Tags{})
+	stale := eg.GenerateTextNote(npub, "Was popular yesterday", nostr.Tags{})
+	article := eg.GenerateTextNote(npub, "Article body", nostr.Tags{{"d", "article"}, {"title", "Article"}})
+	article.Kind = KindArticle
+	article.PubKey = strings.Repeat("b", 64)
+	for _, event := range []*models.Event{popular, quiet, stale, article} {
+		helpers.AssertNoError(t, c.StoreEvent(event))
+	}
+	articleAddress := fmt.Sprintf("%d:%s:%s", article.Kind, article.PubKey, article.Tags.GetD())
+
+	for i := 0; i < 3; i++ {
+		tracker.record(engage(7, now.Add(-time.Hour), "+", nostr.Tags{{"e", popular.ID}, {"k", "1"}}), now)
+	}
+	tracker.record(engage(7, now.Add(-time.Hour), "-", nostr.Tags{{"e", popular.ID}}), now)
+	tracker.record(engage(9735, now.Add(-time.Hour), "", nostr.Tags{{"e", popular.ID}}), now)
+	tracker.record(engage(1, now.Add(-time.Hour), "Agreed", nostr.Tags{{"e", popular.ID, "", "root"}}), now)
+	tracker.record(engage(7, now.Add(-time.Hour), "+", nostr.Tags{{"e", quiet.ID}}), now)
+	for i := 0; i < 5; i++ {
+		tracker.record(engage(7, now.Add(-20*time.Hour), "+", nostr.Tags{{"e", stale.ID}}), now)
+	}
+	tracker.record(engage(1111, now.Add(-time.Hour), "Nice read", nostr.Tags{{"A", articleAddress}, {"K", "30023"}}), now)
+
+	result, err := tracker.top(context.Background(), Query{}, now)
+	helpers.AssertNoError(t, err)
+
+	notes := result.Kinds[KindNote]
+	helpers.AssertIntEqual(t, 3, len(notes))
+	helpers.AssertStringEqual(t, popular.ID, notes[0].Event.ID)
+	helpers.AssertIntEqual(t, 3, notes[0].Reactions)
+	helpers.AssertIntEqual(t, 1, notes[0].Zaps)
+	helpers.AssertIntEqual(t, 1, notes[0].Replies)
+	// Five old reactions decayed below one fresh one
+	helpers.AssertStringEqual(t, quiet.ID, notes[1].Event.ID)
+	helpers.AssertStringEqual(t, stale.ID, notes[2].Event.ID)
+
+	articles := result.Kinds[KindArticle]
+	helpers.AssertIntEqual(t, 1, len(articles))
+	helpers.AssertStringEqual(t, article.ID, articles[0].Event.ID)
+	helpers.AssertIntEqual(t, 0, len(result.Kinds[KindBook]))
+
+	t.Run("Shorter windows drop older engagement", func(t *testing.T) {
+		result, err := tracker.top(context.Background(), Query{Window: 6 * time.Hour, Kinds: []int{KindNote}}, now)
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, 2, len(result.Kinds[KindNote]))
+		helpers.AssertIntEqual(t, 1, len(result.Kinds))
+	})
+
+	t.Run("Results are cached", func(t *testing.T) {
+		tracker.record(engage(7, now, "+", nostr.Tags{{"e", quiet.ID}}), now)
+		cached, _ := tracker.top(context.Background(), Query{}, now)
+		helpers.AssertIntEqual(t, 1, cached.Kinds[KindNote][1].Reactions)
+
+		fresh, _ := tracker.top(context.Background(), Query{}, now.Add(2*time.Minute))
+		helpers.AssertIntEqual(t, 2, fresh.Kinds[KindNote][1].Reactions)
+	})
+
+	t.Run("Rejects windows longer than tracked", func(t *testing.T) {
+		_, err := tracker.top(context.Background(), Query{Window: 48 * time.Hour}, now)
+		helpers.AssertTrue(t, errors.Is(err, ErrInvalidWindow))
+	})
+}
+
+func TestTrackerRecord(t *testing.T) {
+	tracker, _ := newTestTracker(t)
+	now := time.Now()
+	target := strings.Repeat("a", 64)
+
+	reaction := engage(7, now, "+", nostr.Tags{{"e", target}})
+	tracker.record(reaction, now)
+	tracker.record(reaction, now)
+	helpers.AssertIntEqual(t, 1, len(tracker.targets[target].hits))
+
+	// Too old, quarantined or not engagement
+	tracker.record(engage(7, now.Add(-48*time.Hour), "+", nostr.Tags{{"e", target}}), now)
+	spam := engage(7, now, "+", nostr.Tags{{"e", target}})
+	spam.IsQuarantined = true
+	tracker.record(spam, now)
+	tracker.record(engage(1, now, "Not a reply", nostr.Tags{}), now)
+	helpers.AssertIntEqual(t, 1, len(tracker.targets[target].hits))
+	helpers.AssertIntEqual(t, 1, len(tracker.targets))
+
+	// Pruning drops engagement that left the window
+	tracker.pruneLocked(now.Add(25 * time.Hour))
+	helpers.AssertIntEqual(t, 0, len(tracker.targets))
+	helpers.AssertIntEqual(t, 0, len(tracker.seen))
+}
+
+func TestEngagementTarget(t *testing.T) {
+	root, parent := strings.Repeat("1", 64), strings.Repeat("2", 64)
+	address := "30040:" + strings.Repeat("3", 64) + ":my-book"
+
+	key, kind := engagementTarget(engage(1, time.Now(), "", nostr.Tags{{"e", root, "", "root"}, {"e", parent, "", "reply"}}))
+	helpers.AssertStringEqual(t, parent, key)
+	helpers.AssertIntEqual(t, 0, kind)
+
+	key, kind = engagementTarget(engage(7, time.Now(), "+", nostr.Tags{{"e", root}, {"a", address}}))
+	helpers.AssertStringEqual(t, address, key)
+	helpers.AssertIntEqual(t, KindBook, kind)
+
+	key, kind = engagementTarget(engage(1111, time.Now(), "", nostr.Tags{{"E", root}, {"K", "1"}, {"e", parent}}))
+	helpers.AssertStringEqual(t, root, key)
+	helpers.AssertIntEqual(t, KindNote, kind)
+
+	key, _ = engagementTarget(engage(7, time.Now(), "+", nostr.Tags{{"e", "not-an-id"}}))
+	helpers.AssertStringEqual(t, "", key)
+}
@@ -0,0 +1,293 @@
+// Package trust labels events stored from upstream relays by how the relay
+// knows their author, so clients can set vetted content apart from the rest.
+// Labels are computed once at ingest and kept with the cached event.
+package trust
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip05"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+// Trust labels, most trusted first
+const (
+	LabelOwnerWoT      = "owner-wot"      // the owner or someone the owner follows
+	LabelVerifiedNIP05 = "verified-nip05" // the author's NIP-05 identifier checks out
+	LabelUnknown       = "unknown"
+)
+
+const (
+	// maxVerifications bounds the NIP-05 results kept
+	maxVerifications = 100000
+	// verifyQueueSize bounds the authors waiting for a NIP-05 check; more
+	// are dropped and retried when they post again
+	verifyQueueSize = 1000
+)
+
+// WoT reports a pubkey's web of trust distance from the relay owner: 0 for
+// the owner, 1 for npubs the owner follows and -1 for everyone else
+type WoT interface {
+	WoTDistance(pubkey string) int
+}
+
+// verification is the outcome of checking an author's NIP-05 identifier
+type verification struct {
+	identifier string
+	verified   bool
+	checkedAt  time.Time
+}
+
+// request asks for an author's identifier to be checked. An empty
+// identifier is looked up from the author's cached profile.
+type request struct {
+	pubkey     string
+	identifier string
+}
+
+// Labeler computes trust labels. NIP-05 identifiers are checked in the
+// background: an author is labeled verified-nip05 from the first event after
+// the check succeeds, and unknown until then.
+type Labeler struct {
+	config config.TrustLabelConfig
+	wot    WoT
+	cache  cache.Cache
+
+	// resolve returns the pubkey a NIP-05 identifier points to
+	resolve func(ctx context.Context, identifier string) (string, error)
+
+	mu       sync.Mutex
+	verified map[string]verification // by pubkey
+	pending  map[string]bool
+	counts   map[string]int
+	queue    chan request
+}
+
+// NewLabeler labels against the owner's web of trust in wot, looking up
+// author profiles in c. Either may be nil.
+func NewLabeler(cfg config.TrustLabelConfig, wot WoT, c cache.Cache) *Labeler {
+	if cfg.NIP05TTL <= 0 {
+		cfg.NIP05TTL = 24 * time.Hour
+	}
+	if cfg.NIP05Timeout <= 0 {
+		cfg.NIP05Timeout = 5 * time.Second
+	}
+	return &Labeler{
+		config:   cfg,
+		wot:      wot,
+		cache:    c,
+		resolve:  resolveNIP05,
+		verified: make(map[string]verification),
+		pending:  make(map[string]bool),
+		counts:   make(map[string]int),
+		queue:    make(chan request, verifyQueueSize),
+	}
+}
+
+// SendsToClients reports whether labels are added to EVENT messages sent to
+// authenticated WebSocket clients
+func (l *Labeler) SendsToClients() bool {
+	return l.config.WebSocket
+}
+
+// Apply labels event
+func (l *Labeler) Apply(event *models.Event) {
+	event.TrustLabel = l.Label(event)
+
+	l.mu.Lock()
+	l.counts[event.TrustLabel]++
+	l.mu.Unlock()
+}
+
+// Label returns the trust label of event's author, scheduling a NIP-05
+// check when the last one is missing or stale
+func (l *Labeler) Label(event *models.Event) string {
+	if l.inWoT(event.PubKey) {
+		return LabelOwnerWoT
+	}
+	if !l.config.VerifyNIP05 {
+		return LabelUnknown
+	}
+
+	// A profile names the identifier to check; other kinds use the last one
+	// seen or the cached profile
+	identifier, profile := "", event.Kind == nostr.KindProfileMetadata
+	if profile {
+		identifier = profileIdentifier(event.Content)
+	}
+
+	l.mu.Lock()
+	result, checked := l.verified[event.PubKey]
+	if profile && identifier == "" {
+		// The author dropped their identifier
+		result, checked = verification{checkedAt: time.Now()}, true
+		l.recordLocked(event.PubKey, result)
+	}
+	l.mu.Unlock()
+
+	fresh := checked && time.Since(result.checkedAt) < l.config.NIP05TTL
+	if profile && checked && result.identifier != identifier {
+		fresh = false
+	}
+	if !fresh && (!profile || identifier != "") {
+		l.schedule(request{pubkey: event.PubKey, identifier: identifier})
+	}
+	if checked && result.verified && (!profile || result.identifier == identifier) {
+		return LabelVerifiedNIP05
+	}
+	return LabelUnknown
+}
+
+// inWoT reports whether pubkey (hex) is the owner or followed by the owner,
+// who may be configured as an npub
+func (l *Labeler) inWoT(pubkey string) bool {
+	if l.wot == nil {
+		return false
+	}
+	if l.wot.WoTDistance(pubkey) >= 0 {
+		return true
+	}
+	npub, err := nip19.EncodePublicKey(pubkey)
+	return err == nil && l.wot.WoTDistance(npub) >= 0
+}
+
+// schedule queues a NIP-05 check unless one is already waiting
+func (l *Labeler) schedule(req request) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.pending[req.pubkey] {
+		return
+	}
+	select {
+	case l.queue <- req:
+		l.pending[req.pubkey] = true
+	default:
+	}
+}
+
+// Run checks queued NIP-05 identifiers until ctx is done
+func (l *Labeler) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case req := <-l.queue:
+			l.verify(ctx, req)
+		}
+	}
+}
+
+// verify checks one author's identifier and records the outcome
+func (l *Labeler) verify(ctx context.Context, req request) {
+	defer func() {
+		l.mu.Lock()
+		delete(l.pending, req.pubkey)
+		l.mu.Unlock()
+	}()
+
+	if req.identifier == "" {
+		req.identifier = l.cachedIdentifier(ctx, req.pubkey)
+	}
+
+	result := verification{identifier: req.identifier, checkedAt: time.Now()}
+	if req.identifier != "" {
+		resolveCtx, cancel := context.WithTimeout(ctx, l.config.NIP05Timeout)
+		pubkey, err := l.resolve(resolveCtx, req.identifier)
+		cancel()
+		if err != nil {
+			log.Printf("NIP-05 check of %s for %s failed: %v", req.identifier, req.pubkey, err)
+		}
+		result.verified = err == nil && pubkey == req.pubkey
+	}
+
+	l.mu.Lock()
+	l.recordLocked(req.pubkey, result)
+	l.mu.Unlock()
+}
+
+// recordLocked keeps result for pubkey, evicting an arbitrary entry when
+// full. l.mu must be held.
+func (l *Labeler) recordLocked(pubkey string, result verification) {
+	if _, exists := l.verified[pubkey]; !exists && len(l.verified) >= maxVerifications {
+		for other := range l.verified {
+			delete(l.verified, other)
+			break
+		}
+	}
+	l.verified[pubkey] = result
+}
+
+// cachedIdentifier returns the NIP-05 identifier in pubkey's cached profile
+func (l *Labeler) cachedIdentifier(ctx context.Context, pubkey string) string {
+	if l.cache == nil {
+		return ""
+	}
+	filter := nostr.Filter{Authors: []string{pubkey}, Kinds: []int{nostr.KindProfileMetadata}, Limit: 1}
+	var latest *models.Event
+	for event, err := range l.cache.GetEvents(ctx, filter) {
+		if err != nil {
+			return ""
+		}
+		if latest == nil || event.CreatedAt > latest.CreatedAt {
+			latest = event
+		}
+	}
+	if latest == nil {
+		return ""
+	}
+	return profileIdentifier(latest.Content)
+}
+
+// profileIdentifier returns the nip05 field of a kind 0 profile
+func profileIdentifier(content string) string {
+	var profile struct {
+		NIP05 string `json:"nip05"`
+	}
+	if err := json.Unmarshal([]byte(content), &profile); err != nil {
+		return ""
+	}
+	return profile.NIP05
+}
+
+// resolveNIP05 looks identifier up at its domain's /.well-known/nostr.json
+func resolveNIP05(ctx context.Context, identifier string) (string, error) {
+	pointer, err := nip05.QueryIdentifier(ctx, identifier)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve NIP-05 identifier: %w", err)
+	}
+	return pointer.PublicKey, nil
+}
+
+// Stats returns how many events got each label and how many NIP-05 results
+// are kept
+func (l *Labeler) Stats() map[string]interface{} {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	labels := make(map[string]int, len(l.counts))
+	verified := 0
+	for label, count := range l.counts {
+		labels[label] = count
+	}
+	for _, result := range l.verified {
+		if result.verified {
+			verified++
+		}
+	}
+	return map[string]interface{}{
+		"labels":         labels,
+		"nip05_checked":  len(l.verified),
+		"nip05_verified": verified,
+		"nip05_pending":  len(l.pending),
+	}
+}
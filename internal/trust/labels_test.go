@@ -0,0 +1,141 @@
+package trust
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"mercury-relay/internal/cache"
+	"mercury-relay/internal/config"
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+	"github.com/nbd-wtf/go-nostr/nip19"
+)
+
+type staticWoT map[string]int
+
+func (w staticWoT) WoTDistance(pubkey string) int {
+	if distance, ok := w[pubkey]; ok {
+		return distance
+	}
+	return -1
+}
+
+func event(pubkey string, kind int, content string) *models.Event {
+	return &models.Event{ID: fmt.Sprintf("%s-%d-%s", pubkey, kind, content), PubKey: pubkey, Kind: kind, Content: content}
+}
+
+// drain runs the queued NIP-05 checks
+func drain(l *Labeler) {
+	for {
+		select {
+		case req := <-l.queue:
+			l.verify(context.Background(), req)
+		default:
+			return
+		}
+	}
+}
+
+func TestLabelWoT(t *testing.T) {
+	owner := nostr.GeneratePrivateKey()
+	ownerPub, _ := nostr.GetPublicKey(owner)
+	ownerNpub, _ := nip19.EncodePublicKey(ownerPub)
+	follow, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	stranger, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+
+	l := NewLabeler(config.TrustLabelConfig{Enabled: true}, staticWoT{ownerNpub: 0, follow: 1}, nil)
+	helpers.AssertStringEqual(t, LabelOwnerWoT, l.Label(event(ownerPub, 1, "gm")))
+	helpers.AssertStringEqual(t, LabelOwnerWoT, l.Label(event(follow, 1, "gm")))
+	helpers.AssertStringEqual(t, LabelUnknown, l.Label(event(stranger, 1, "gm")))
+
+	// Without NIP-05 checks nothing is queued
+	helpers.AssertIntEqual(t, 0, len(l.queue))
+
+	note := event(follow, 1, "labeled")
+	l.Apply(note)
+	helpers.AssertStringEqual(t, LabelOwnerWoT, note.TrustLabel)
+	helpers.AssertIntEqual(t, 1, l.Stats()["labels"].(map[string]int)[LabelOwnerWoT])
+}
+
+func TestLabelNIP05(t *testing.T) {
+	alice, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	mallory, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+	names := map[string]string{
+		"alice@example.com":   alice,
+		"alice@other.example": alice,
+		"admin@example.com":   alice, // mallory claims alice's name
+	}
+
+	memory := cache.NewMemory(config.CacheConfig{})
+	defer memory.Close()
+	l := NewLabeler(config.TrustLabelConfig{Enabled: true, VerifyNIP05: true}, nil, memory)
+	resolved := 0
+	l.resolve = func(ctx context.Context, identifier string) (string, error) {
+		resolved++
+		if pubkey, ok := names[identifier]; ok {
+			return pubkey, nil
+		}
+		return "", fmt.Errorf("no entry for %s", identifier)
+	}
+
+	t.Run("Verified after the check", func(t *testing.T) {
+		profile := event(alice, 0, `{"name":"alice","nip05":"alice@example.com"}`)
+		helpers.AssertStringEqual(t, LabelUnknown, l.Label(profile))
+		// Queued once however many events arrive before the check
+		l.Label(profile)
+		helpers.AssertIntEqual(t, 1, len(l.queue))
+		drain(l)
+
+		helpers.AssertStringEqual(t, LabelVerifiedNIP05, l.Label(profile))
+		helpers.AssertStringEqual(t, LabelVerifiedNIP05, l.Label(event(alice, 1, "gm")))
+		helpers.AssertIntEqual(t, 0, len(l.queue))
+	})
+
+	t.Run("Changed identifier is checked again", func(t *testing.T) {
+		profile := event(alice, 0, `{"nip05":"alice@other.example"}`)
+		helpers.AssertStringEqual(t, LabelUnknown, l.Label(profile))
+		drain(l)
+		helpers.AssertStringEqual(t, LabelVerifiedNIP05, l.Label(profile))
+	})
+
+	t.Run("Dropped identifier", func(t *testing.T) {
+		helpers.AssertStringEqual(t, LabelUnknown, l.Label(event(alice, 0, `{"name":"alice"}`)))
+		helpers.AssertStringEqual(t, LabelUnknown, l.Label(event(alice, 1, "gm again")))
+	})
+
+	t.Run("Identifier of someone else", func(t *testing.T) {
+		profile := event(mallory, 0, `{"nip05":"admin@example.com"}`)
+		l.Label(profile)
+		drain(l)
+		helpers.AssertStringEqual(t, LabelUnknown, l.Label(profile))
+	})
+
+	t.Run("Identifier from the cached profile", func(t *testing.T) {
+		bob, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+		names["bob@example.com"] = bob
+		helpers.AssertNoError(t, memory.StoreEvent(event(bob, 0, `{"nip05":"bob@example.com"}`)))
+
+		note := event(bob, 1, "gm")
+		helpers.AssertStringEqual(t, LabelUnknown, l.Label(note))
+		drain(l)
+		helpers.AssertStringEqual(t, LabelVerifiedNIP05, l.Label(note))
+	})
+
+	t.Run("No profile", func(t *testing.T) {
+		carol, _ := nostr.GetPublicKey(nostr.GeneratePrivateKey())
+		before := resolved
+		l.Label(event(carol, 1, "gm"))
+		drain(l)
+		helpers.AssertIntEqual(t, before, resolved)
+		helpers.AssertStringEqual(t, LabelUnknown, l.Label(event(carol, 1, "gm")))
+		helpers.AssertIntEqual(t, 0, len(l.queue))
+	})
+
+	stats := l.Stats()
+	helpers.AssertIntEqual(t, 4, stats["nip05_checked"].(int))
+	helpers.AssertIntEqual(t, 1, stats["nip05_verified"].(int)) // bob; alice dropped the identifier
+	helpers.AssertIntEqual(t, 0, stats["nip05_pending"].(int))
+}
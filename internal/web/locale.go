@@ -0,0 +1,109 @@
+package web
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLanguage is used when the request asks for nothing we have, and
+// for keys missing from a translation
+const DefaultLanguage = "en"
+
+// locales maps language codes to message keys and translations, loaded from
+// locales/<code>.json
+var locales = mustLoadLocales()
+
+func mustLoadLocales() map[string]map[string]string {
+	entries, err := files.ReadDir("locales")
+	if err != nil {
+		panic(fmt.Sprintf("web: failed to list locales: %v", err))
+	}
+
+	loaded := make(map[string]map[string]string, len(entries))
+	for _, entry := range entries {
+		data, err := files.ReadFile("locales/" + entry.Name())
+		if err != nil {
+			panic(fmt.Sprintf("web: failed to read locale %s: %v", entry.Name(), err))
+		}
+		var messages map[string]string
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic(fmt.Sprintf("web: failed to parse locale %s: %v", entry.Name(), err))
+		}
+		loaded[strings.TrimSuffix(entry.Name(), ".json")] = messages
+	}
+	if _, ok := loaded[DefaultLanguage]; !ok {
+		panic("web: default locale is missing")
+	}
+	return loaded
+}
+
+// Languages returns the available language codes
+func Languages() []string {
+	list := make([]string, 0, len(locales))
+	for lang := range locales {
+		list = append(list, lang)
+	}
+	sort.Strings(list)
+	return list
+}
+
+// Language picks the page language: ?lang= wins, then the best match in
+// Accept-Language, then DefaultLanguage
+func Language(req *http.Request) string {
+	if lang := strings.ToLower(req.URL.Query().Get("lang")); locales[lang] != nil {
+		return lang
+	}
+
+	type preference struct {
+		lang string
+		q    float64
+	}
+	var prefs []preference
+	for _, part := range strings.Split(req.Header.Get("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		// Only the primary subtag matters: de-AT reads German
+		primary, _, _ := strings.Cut(strings.ToLower(tag), "-")
+		if locales[primary] != nil && q > 0 {
+			prefs = append(prefs, preference{primary, q})
+		}
+	}
+	sort.SliceStable(prefs, func(i, j int) bool { return prefs[i].q > prefs[j].q })
+	if len(prefs) > 0 {
+		return prefs[0].lang
+	}
+	return DefaultLanguage
+}
+
+// translate returns key in lang, falling back to DefaultLanguage and then
+// to the key itself
+func translate(lang, key string) string {
+	if message, ok := locales[lang][key]; ok {
+		return message
+	}
+	if message, ok := locales[DefaultLanguage][key]; ok {
+		return message
+	}
+	return key
+}
+
+// messages returns every message in lang, for scripts
+func messages(lang string) map[string]string {
+	merged := make(map[string]string, len(locales[DefaultLanguage]))
+	for key, message := range locales[DefaultLanguage] {
+		merged[key] = message
+	}
+	for key, message := range locales[lang] {
+		merged[key] = message
+	}
+	return merged
+}
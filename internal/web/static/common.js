@@ -0,0 +1,27 @@
+// Shared helpers for the relay's pages. Pages carry their translations in
+// the #messages JSON block and the CSRF token on <body>.
+const mercury = (() => {
+    const messages = JSON.parse(document.getElementById('messages').textContent || '{}');
+
+    // t returns the translation of key, or the key itself
+    function t(key) {
+        return messages[key] || key;
+    }
+
+    function csrfToken() {
+        return document.body.dataset.csrfToken || '';
+    }
+
+    // status replaces the content of element with a message of the given
+    // class ("success" or "error"; empty for plain text)
+    function status(element, className, text) {
+        const div = document.createElement('div');
+        if (className) {
+            div.className = className;
+        }
+        div.textContent = text;
+        element.replaceChildren(div);
+    }
+
+    return { t, csrfToken, status };
+})();
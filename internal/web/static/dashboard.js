@@ -0,0 +1,127 @@
+// Admin dashboard: reads stats, storage, maintenance and rejections from
+// the admin API as the given npub
+(() => {
+    const { t, status } = mercury;
+    const npubInput = document.getElementById('npub');
+    const statusDiv = document.getElementById('dashboard-status');
+    const dashboard = document.getElementById('dashboard');
+
+    npubInput.value = sessionStorage.getItem('mercury-npub') || '';
+
+    async function api(path) {
+        const response = await fetch('/api/v1' + path, {
+            headers: { 'X-Nostr-Pubkey': npubInput.value.trim() }
+        });
+        if (response.status === 401 || response.status === 403) {
+            throw new Error(t('js.dashboard_forbidden'));
+        }
+        if (response.status === 503) {
+            // The feature is off on this relay
+            return null;
+        }
+        const result = await response.json();
+        if (!response.ok) {
+            throw new Error(result.detail || result.error || response.statusText);
+        }
+        return result.data;
+    }
+
+    function facts(element, entries) {
+        element.replaceChildren();
+        for (const [label, value] of entries) {
+            const dt = document.createElement('dt');
+            dt.textContent = label;
+            const dd = document.createElement('dd');
+            dd.textContent = value;
+            element.append(dt, dd);
+        }
+    }
+
+    function showStats(stats) {
+        stats = stats || {};
+        facts(document.getElementById('stats'), [
+            [t('js.dashboard_total_events'), stats.total_events],
+            [t('js.dashboard_connections'), stats.active_connections],
+            [t('js.dashboard_cache_size'), stats.cache_size],
+            [t('js.dashboard_queue_size'), stats.queue_size]
+        ]);
+
+        const storage = document.getElementById('storage');
+        const paths = (stats.storage && stats.storage.paths) || [];
+        if (paths.length === 0) {
+            status(storage, '', t('js.dashboard_no_storage'));
+            return;
+        }
+        facts(storage, paths.map(p => [p.path, p.used_percent.toFixed(1) + '% (' + p.level + ')']));
+    }
+
+    function showMaintenance(state) {
+        const element = document.getElementById('maintenance');
+        element.textContent = state && state.enabled
+            ? t('js.dashboard_writes_paused') + ' ' + (state.reason || '')
+            : t('js.dashboard_writes_open');
+    }
+
+    function showRejections(data) {
+        const body = document.getElementById('rejections');
+        if (!data || !data.rejections || data.rejections.length === 0) {
+            const row = document.createElement('tr');
+            const cell = document.createElement('td');
+            cell.colSpan = 4;
+            cell.textContent = t('js.dashboard_no_rejections');
+            row.append(cell);
+            body.replaceChildren(row);
+            return;
+        }
+        body.replaceChildren(...data.rejections.map(r => {
+            const row = document.createElement('tr');
+            for (const [value, className] of [[new Date(r.at).toLocaleString(), ''], [r.reason, ''], [r.kind, ''], [r.pubkey, 'pubkey']]) {
+                const cell = document.createElement('td');
+                cell.className = className;
+                cell.textContent = value;
+                row.append(cell);
+            }
+            return row;
+        }));
+    }
+
+    async function load() {
+        sessionStorage.setItem('mercury-npub', npubInput.value.trim());
+        status(statusDiv, '', '');
+        try {
+            const [stats, maintenance, rejections] = await Promise.all([
+                api('/stats'),
+                api('/admin/maintenance'),
+                api('/admin/rejections?limit=20')
+            ]);
+            showStats(stats);
+            showMaintenance(maintenance);
+            showRejections(rejections);
+            dashboard.hidden = false;
+        } catch (error) {
+            dashboard.hidden = true;
+            status(statusDiv, 'error', error.message);
+        }
+    }
+
+    document.getElementById('identify-form').addEventListener('submit', (e) => {
+        e.preventDefault();
+        load();
+    });
+
+    document.getElementById('use-extension').addEventListener('click', async () => {
+        if (typeof window.nostr === 'undefined') {
+            status(statusDiv, 'error', t('js.no_extension'));
+            return;
+        }
+        try {
+            npubInput.value = await window.nostr.getPublicKey();
+        } catch (error) {
+            status(statusDiv, 'error', t('js.error') + ' ' + error.message);
+        }
+    });
+
+    if (npubInput.value) {
+        load();
+    }
+})();
@@ -0,0 +1,48 @@
+// NIP-42 login through a NIP-07 browser extension
+(() => {
+    const { t, csrfToken, status } = mercury;
+    const statusDiv = document.getElementById('auth-status');
+
+    async function authenticateWithNostr() {
+        status(statusDiv, '', t('js.checking'));
+
+        try {
+            if (typeof window.nostr === 'undefined') {
+                status(statusDiv, 'error', t('js.no_extension'));
+                return;
+            }
+
+            const challengeResponse = await fetch('/api/v1/nostr/challenge');
+            const { challenge, relay } = await challengeResponse.json();
+
+            status(statusDiv, '', t('js.signing'));
+            const signedEvent = await window.nostr.signEvent({
+                kind: 22242,
+                created_at: Math.floor(Date.now() / 1000),
+                tags: [
+                    ['relay', relay],
+                    ['challenge', challenge]
+                ],
+                content: ''
+            });
+
+            const authResponse = await fetch('/api/v1/nostr/auth', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json', 'X-CSRF-Token': csrfToken() },
+                body: JSON.stringify({ event: signedEvent })
+            });
+
+            if (authResponse.ok) {
+                status(statusDiv, 'success', t('js.auth_ok'));
+                // Reload to show the SSH key management interface
+                setTimeout(() => window.location.reload(), 1000);
+            } else {
+                status(statusDiv, 'error', t('js.auth_failed'));
+            }
+        } catch (error) {
+            status(statusDiv, 'error', t('js.error') + ' ' + error.message);
+        }
+    }
+
+    document.getElementById('auth-button').addEventListener('click', authenticateWithNostr);
+})();
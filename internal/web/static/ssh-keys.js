@@ -0,0 +1,96 @@
+// SSH key upload, listing and deletion
+(() => {
+    const { t, csrfToken, status } = mercury;
+    const resultDiv = document.getElementById('result');
+    const keyListDiv = document.getElementById('key-list');
+
+    document.getElementById('upload-form').addEventListener('submit', async (e) => {
+        e.preventDefault();
+
+        const formData = new FormData(e.target);
+        const data = {
+            name: formData.get('name'),
+            private_key: formData.get('private_key'),
+            public_key: formData.get('public_key'),
+            description: formData.get('description')
+        };
+
+        try {
+            const response = await fetch('/api/v1/ssh-keys', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json', 'X-CSRF-Token': csrfToken() },
+                body: JSON.stringify(data)
+            });
+            const result = await response.json();
+
+            if (result.success) {
+                status(resultDiv, 'success', '✓ ' + result.message);
+                loadKeys();
+            } else {
+                status(resultDiv, 'error', '✗ ' + (result.message || result.error));
+            }
+        } catch (error) {
+            status(resultDiv, 'error', '✗ ' + t('js.error') + ' ' + error.message);
+        }
+    });
+
+    function keyItem(key) {
+        const item = document.createElement('div');
+        item.className = 'key-item';
+
+        const name = document.createElement('strong');
+        name.textContent = key.name;
+        item.append(name, ' (' + key.type + ')', document.createElement('br'));
+
+        for (const [label, value] of [['js.keys_fingerprint', key.fingerprint], ['js.keys_created', key.created_at]]) {
+            const line = document.createElement('small');
+            line.textContent = t(label) + ' ' + value;
+            item.append(line, document.createElement('br'));
+        }
+
+        const remove = document.createElement('button');
+        remove.type = 'button';
+        remove.textContent = t('js.keys_delete');
+        remove.addEventListener('click', () => deleteKey(key.name));
+        item.append(remove);
+        return item;
+    }
+
+    async function loadKeys() {
+        try {
+            const response = await fetch('/api/v1/ssh-keys');
+            const result = await response.json();
+
+            if (result.success && result.keys.length > 0) {
+                keyListDiv.replaceChildren(...result.keys.map(keyItem));
+            } else {
+                status(keyListDiv, '', t('js.keys_none'));
+            }
+        } catch (error) {
+            status(keyListDiv, 'error', t('js.keys_load_error') + ' ' + error.message);
+        }
+    }
+
+    async function deleteKey(keyName) {
+        if (!confirm(t('js.keys_confirm_delete') + ' (' + keyName + ')')) {
+            return;
+        }
+        try {
+            const response = await fetch('/api/v1/ssh-keys/' + encodeURIComponent(keyName), {
+                method: 'DELETE',
+                headers: { 'X-CSRF-Token': csrfToken() }
+            });
+            const result = await response.json();
+            if (result.success) {
+                loadKeys();
+            } else {
+                alert(t('js.error') + ' ' + (result.message || result.error));
+            }
+        } catch (error) {
+            alert(t('js.error') + ' ' + error.message);
+        }
+    }
+
+    document.getElementById('refresh-keys').addEventListener('click', loadKeys);
+    loadKeys();
+})();
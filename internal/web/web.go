@@ -0,0 +1,131 @@
+// Package web renders the HTML pages served by the relay (SSH key forms,
+// admin dashboard, relay information page) from templates, stylesheets,
+// scripts and translations embedded in the binary. Pages share one layout,
+// load scripts only from /assets/ and are sent with a strict Content
+// Security Policy, so no page runs inline script.
+package web
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+//go:embed templates static locales
+var files embed.FS
+
+// AssetPrefix is the path the embedded stylesheets and scripts are served
+// under
+const AssetPrefix = "/assets/"
+
+// ContentSecurityPolicy allows same-origin scripts, styles and requests only
+const ContentSecurityPolicy = "default-src 'none'; script-src 'self'; style-src 'self'; img-src 'self' data:; " +
+	"connect-src 'self'; form-action 'self'; frame-ancestors 'none'; base-uri 'none'"
+
+// Page is what a handler passes to a page template
+type Page struct {
+	Title     string // Message key of the page title
+	CSRFToken string
+	Data      interface{}
+}
+
+// view is a Page as the templates see it
+type view struct {
+	Page
+	Name     string
+	Lang     string
+	Messages map[string]string
+	Scripts  []string
+}
+
+// T returns the translation of key in the page's language
+func (v view) T(key string) string {
+	return translate(v.Lang, key)
+}
+
+// pageScripts lists the scripts each page loads after common.js
+var pageScripts = map[string][]string{
+	"ssh_login": {"nostr-login.js"},
+	"ssh_keys":  {"ssh-keys.js"},
+	"dashboard": {"dashboard.js"},
+	"relay":     nil,
+}
+
+var pages = mustParsePages()
+
+func mustParsePages() map[string]*template.Template {
+	parsed := make(map[string]*template.Template, len(pageScripts))
+	for name := range pageScripts {
+		tmpl, err := template.ParseFS(files, "templates/layout.html", "templates/"+name+".html")
+		if err != nil {
+			panic(fmt.Sprintf("web: failed to parse page %s: %v", name, err))
+		}
+		parsed[name] = tmpl
+	}
+	return parsed
+}
+
+// Render writes the named page in the language the request asks for, with
+// security headers. Unknown pages are a programming error and answer 500.
+func Render(w http.ResponseWriter, req *http.Request, name string, page Page) {
+	tmpl, ok := pages[name]
+	if !ok {
+		log.Printf("Unknown page %q", name)
+		http.Error(w, "Page not found", http.StatusInternalServerError)
+		return
+	}
+
+	lang := Language(req)
+	v := view{
+		Page:     page,
+		Name:     name,
+		Lang:     lang,
+		Messages: messages(lang),
+		Scripts:  append([]string{"common.js"}, pageScripts[name]...),
+	}
+
+	// Render into a buffer so a template error doesn't leave half a page
+	var buf bytes.Buffer
+	if err := tmpl.ExecuteTemplate(&buf, "layout", v); err != nil {
+		log.Printf("Failed to render page %s: %v", name, err)
+		http.Error(w, "Failed to render page", http.StatusInternalServerError)
+		return
+	}
+
+	SetSecurityHeaders(w)
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Language", lang)
+	w.Header().Add("Vary", "Accept-Language")
+	w.Write(buf.Bytes())
+}
+
+// SetSecurityHeaders sets the Content Security Policy and related headers
+// sent with every page
+func SetSecurityHeaders(w http.ResponseWriter) {
+	w.Header().Set("Content-Security-Policy", ContentSecurityPolicy)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Referrer-Policy", "same-origin")
+}
+
+// Assets serves the embedded stylesheets and scripts under AssetPrefix
+func Assets() http.Handler {
+	static, _ := fs.Sub(files, "static")
+	server := http.StripPrefix(AssetPrefix, http.FileServer(http.FS(static)))
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		// No directory listings
+		if strings.HasSuffix(req.URL.Path, "/") {
+			http.NotFound(w, req)
+			return
+		}
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(time.Hour.Seconds())))
+		server.ServeHTTP(w, req)
+	})
+}
@@ -0,0 +1,177 @@
+package web
+
+import (
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"mercury-relay/test/helpers"
+)
+
+// relayData mirrors what the relay passes to the relay page
+type relayData struct {
+	Info struct {
+		Name, Description, Software, Version, Self string
+		SupportedNIPs                              []int
+		Limitation                                 struct{ RestrictedWrites bool }
+		Maintenance                                *maintenanceState
+	}
+	URL string
+}
+
+type maintenanceState struct{ Reason string }
+
+func (m maintenanceState) Message() string { return "[maintenance] " + m.Reason }
+
+func render(t *testing.T, name string, page Page, target string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest("GET", target, nil)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	w := httptest.NewRecorder()
+	Render(w, req, name, page)
+	helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+	return w
+}
+
+func TestRender(t *testing.T) {
+	var relay relayData
+	relay.Info.Name = "Mercury Relay"
+	relay.Info.Self = "relay-pubkey"
+	relay.Info.SupportedNIPs = []int{1, 11}
+	relay.Info.Maintenance = &maintenanceState{Reason: "upgrading"}
+	relay.URL = "wss://relay.example.com/"
+
+	inlineScript := regexp.MustCompile(`<script(\s+type="application/json"[^>]*)?>[^<]`)
+	for name := range pageScripts {
+		t.Run(name, func(t *testing.T) {
+			w := render(t, name, Page{Title: "relay.title", CSRFToken: "token.sig", Data: relay}, "/", nil)
+			body := w.Body.String()
+
+			helpers.AssertStringEqual(t, ContentSecurityPolicy, w.Header().Get("Content-Security-Policy"))
+			helpers.AssertStringEqual(t, "text/html; charset=utf-8", w.Header().Get("Content-Type"))
+			helpers.AssertStringContains(t, body, `<html lang="en">`)
+			helpers.AssertStringContains(t, body, `data-csrf-token="token.sig"`)
+			helpers.AssertStringContains(t, body, `<script src="/assets/common.js"></script>`)
+
+			// The only inline script is the JSON messages block
+			for _, match := range inlineScript.FindAllStringSubmatch(body, -1) {
+				if match[1] == "" {
+					t.Errorf("inline script in %s: %q", name, match[0])
+				}
+			}
+			for _, script := range pageScripts[name] {
+				if _, err := fs.Stat(files, "static/"+script); err != nil {
+					t.Errorf("%s loads missing script %s", name, script)
+				}
+			}
+		})
+	}
+
+	t.Run("Relay page shows the document", func(t *testing.T) {
+		body := render(t, "relay", Page{Title: "relay.title", Data: relay}, "/", nil).Body.String()
+		helpers.AssertStringContains(t, body, "wss://relay.example.com/")
+		helpers.AssertStringContains(t, body, "relay-pubkey")
+		helpers.AssertStringContains(t, body, "1, 11")
+		helpers.AssertStringContains(t, body, "[maintenance] upgrading")
+	})
+
+	t.Run("Escapes data", func(t *testing.T) {
+		evil := relay
+		evil.Info.Name = `<script>alert(1)</script>`
+		body := render(t, "relay", Page{Title: "relay.title", Data: evil}, "/", nil).Body.String()
+		helpers.AssertFalse(t, strings.Contains(body, "<script>alert(1)"))
+	})
+
+	t.Run("Translates", func(t *testing.T) {
+		w := render(t, "ssh_login", Page{Title: "ssh.login.title"}, "/ssh-keys?lang=de", nil)
+		helpers.AssertStringEqual(t, "de", w.Header().Get("Content-Language"))
+		helpers.AssertStringContains(t, w.Body.String(), `<html lang="de">`)
+		helpers.AssertStringContains(t, w.Body.String(), "Mit Nostr anmelden")
+		helpers.AssertStringContains(t, w.Body.String(), `"js.auth_ok":"Anmeldung erfolgreich!`)
+	})
+
+	t.Run("Unknown page", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		Render(w, httptest.NewRequest("GET", "/", nil), "missing", Page{})
+		helpers.AssertIntEqual(t, http.StatusInternalServerError, w.Code)
+	})
+}
+
+func TestLanguage(t *testing.T) {
+	for _, tc := range []struct {
+		target, accept, want string
+	}{
+		{"/", "", "en"},
+		{"/?lang=de", "en", "de"},
+		{"/?lang=xx", "de", "de"},
+		{"/", "de-AT,de;q=0.9,en;q=0.8", "de"},
+		{"/", "fr, en;q=0.5, de;q=0.7", "de"},
+		{"/", "de;q=0", "en"},
+		{"/", "fr", "en"},
+	} {
+		req := httptest.NewRequest("GET", tc.target, nil)
+		req.Header.Set("Accept-Language", tc.accept)
+		if got := Language(req); got != tc.want {
+			t.Errorf("Language(%s, %q) = %s, want %s", tc.target, tc.accept, got, tc.want)
+		}
+	}
+	helpers.AssertStringEqual(t, "de,en", strings.Join(Languages(), ","))
+}
+
+func TestLocalesComplete(t *testing.T) {
+	// Keys used by templates and scripts
+	used := make(map[string]bool)
+	templateKey := regexp.MustCompile(`\.T "([^"]+)"`)
+	scriptKey := regexp.MustCompile(`\bt\('(js\.[^']+)'\)`)
+	fs.WalkDir(files, ".", func(path string, d fs.DirEntry, err error) error {
+		if d.IsDir() {
+			return nil
+		}
+		data, _ := fs.ReadFile(files, path)
+		for _, pattern := range []*regexp.Regexp{templateKey, scriptKey} {
+			for _, match := range pattern.FindAllStringSubmatch(string(data), -1) {
+				used[match[1]] = true
+			}
+		}
+		return nil
+	})
+	for _, page := range []string{"ssh.login.title", "ssh.keys.title", "dashboard.title", "relay.title"} {
+		used[page] = true
+	}
+
+	for key := range used {
+		if _, ok := locales[DefaultLanguage][key]; !ok {
+			t.Errorf("message %q is used but not defined", key)
+		}
+	}
+	for lang, messages := range locales {
+		for key := range locales[DefaultLanguage] {
+			if _, ok := messages[key]; !ok {
+				t.Errorf("%s is missing %q", lang, key)
+			}
+		}
+	}
+}
+
+func TestAssets(t *testing.T) {
+	assets := Assets()
+
+	w := httptest.NewRecorder()
+	assets.ServeHTTP(w, httptest.NewRequest("GET", "/assets/style.css", nil))
+	helpers.AssertIntEqual(t, http.StatusOK, w.Code)
+	helpers.AssertStringContains(t, w.Header().Get("Content-Type"), "text/css")
+	helpers.AssertStringEqual(t, "nosniff", w.Header().Get("X-Content-Type-Options"))
+
+	w = httptest.NewRecorder()
+	assets.ServeHTTP(w, httptest.NewRequest("GET", "/assets/", nil))
+	helpers.AssertIntEqual(t, http.StatusNotFound, w.Code)
+
+	w = httptest.NewRecorder()
+	assets.ServeHTTP(w, httptest.NewRequest("GET", "/assets/missing.js", nil))
+	helpers.AssertIntEqual(t, http.StatusNotFound, w.Code)
+}
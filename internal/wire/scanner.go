@@ -0,0 +1,332 @@
+package wire
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// maxDepth matches encoding/json's nesting limit
+const maxDepth = 10000
+
+// scanner walks JSON in place. It accepts exactly what encoding/json
+// accepts, so messages rejected before are still rejected.
+type scanner struct {
+	data []byte
+	pos  int
+}
+
+func (s *scanner) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("invalid JSON at offset %d: %s", s.pos, fmt.Sprintf(format, args...))
+}
+
+func (s *scanner) skipSpace() {
+	for s.pos < len(s.data) {
+		switch s.data[s.pos] {
+		case ' ', '\t', '\n', '\r':
+			s.pos++
+		default:
+			return
+		}
+	}
+}
+
+// peek returns the next non-space byte, or 0 at the end of input
+func (s *scanner) peek() byte {
+	s.skipSpace()
+	if s.pos >= len(s.data) {
+		return 0
+	}
+	return s.data[s.pos]
+}
+
+func (s *scanner) expect(c byte) error {
+	if s.peek() != c {
+		return s.errorf("expected %q", c)
+	}
+	s.pos++
+	return nil
+}
+
+// end fails unless only whitespace is left
+func (s *scanner) end() error {
+	if s.peek() != 0 {
+		return s.errorf("unexpected data after top-level value")
+	}
+	return nil
+}
+
+// array calls each for every element of the array at the cursor
+func (s *scanner) array(each func() error) error {
+	if err := s.expect('['); err != nil {
+		return err
+	}
+	if s.peek() == ']' {
+		s.pos++
+		return nil
+	}
+	for {
+		if err := each(); err != nil {
+			return err
+		}
+		switch s.peek() {
+		case ',':
+			s.pos++
+		case ']':
+			s.pos++
+			return nil
+		default:
+			return s.errorf("expected ',' or ']'")
+		}
+	}
+}
+
+// object calls each with every key of the object at the cursor; each must
+// consume the value
+func (s *scanner) object(each func(key []byte) error) error {
+	if err := s.expect('{'); err != nil {
+		return err
+	}
+	if s.peek() == '}' {
+		s.pos++
+		return nil
+	}
+	for {
+		if s.peek() != '"' {
+			return s.errorf("expected object key")
+		}
+		key, err := s.rawString()
+		if err != nil {
+			return err
+		}
+		if err := s.expect(':'); err != nil {
+			return err
+		}
+		if err := each(key); err != nil {
+			return err
+		}
+		switch s.peek() {
+		case ',':
+			s.pos++
+		case '}':
+			s.pos++
+			return nil
+		default:
+			return s.errorf("expected ',' or '}'")
+		}
+	}
+}
+
+// rawString consumes a string and returns its bytes between the quotes,
+// escapes included
+func (s *scanner) rawString() ([]byte, error) {
+	start := s.pos + 1
+	for i := start; i < len(s.data); i++ {
+		switch c := s.data[i]; {
+		case c == '"':
+			s.pos = i + 1
+			return s.data[start:i], nil
+		case c == '\\':
+			i++
+			if i >= len(s.data) {
+				break
+			}
+			switch s.data[i] {
+			case '"', '\\', '/', 'b', 'f', 'n', 'r', 't':
+			case 'u':
+				if i+4 >= len(s.data) || !isHex(s.data[i+1:i+5]) {
+					s.pos = i
+					return nil, s.errorf("invalid \\u escape")
+				}
+				i += 4
+			default:
+				s.pos = i
+				return nil, s.errorf("invalid escape")
+			}
+		case c < 0x20:
+			s.pos = i
+			return nil, s.errorf("control character in string")
+		}
+	}
+	s.pos = len(s.data)
+	return nil, s.errorf("unterminated string")
+}
+
+// string consumes a string and decodes it like encoding/json: escapes are
+// resolved and invalid UTF-8 becomes U+FFFD
+func (s *scanner) string() (string, error) {
+	raw, err := s.rawString()
+	if err != nil {
+		return "", err
+	}
+	return unquote(raw), nil
+}
+
+// stringKey compares a raw key to name without allocating; keys with
+// escapes are decoded first
+func stringKey(raw []byte, name string) bool {
+	if len(raw) == len(name) && string(raw) == name {
+		return true
+	}
+	return bytes.IndexByte(raw, '\\') >= 0 && unquote(raw) == name
+}
+
+func unquote(raw []byte) string {
+	if bytes.IndexByte(raw, '\\') < 0 && utf8.Valid(raw) {
+		return string(raw)
+	}
+
+	var b strings.Builder
+	b.Grow(len(raw))
+	for i := 0; i < len(raw); {
+		c := raw[i]
+		switch {
+		case c == '\\':
+			switch raw[i+1] {
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case 'u':
+				r := hexRune(raw[i+2 : i+6])
+				i += 6
+				if utf16.IsSurrogate(r) {
+					r2 := rune(-1)
+					if i+6 <= len(raw) && raw[i] == '\\' && raw[i+1] == 'u' {
+						r2 = hexRune(raw[i+2 : i+6])
+					}
+					if decoded := utf16.DecodeRune(r, r2); decoded != utf8.RuneError {
+						r = decoded
+						i += 6
+					} else {
+						r = utf8.RuneError
+					}
+				}
+				b.WriteRune(r)
+				continue
+			default: // '"', '\\', '/'
+				b.WriteByte(raw[i+1])
+			}
+			i += 2
+		case c < utf8.RuneSelf:
+			b.WriteByte(c)
+			i++
+		default:
+			r, size := utf8.DecodeRune(raw[i:])
+			b.WriteRune(r) // RuneError for invalid bytes, one per byte
+			i += size
+		}
+	}
+	return b.String()
+}
+
+func isHex(b []byte) bool {
+	for _, c := range b {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F') {
+			return false
+		}
+	}
+	return true
+}
+
+func hexRune(b []byte) rune {
+	r, _ := strconv.ParseUint(string(b), 16, 32)
+	return rune(r)
+}
+
+// number consumes a number and returns it as encoding/json would decode it
+// into an interface{}
+func (s *scanner) number() (float64, error) {
+	start := s.pos
+	i := s.pos
+	if i < len(s.data) && s.data[i] == '-' {
+		i++
+	}
+	switch {
+	case i < len(s.data) && s.data[i] == '0':
+		i++
+	case i < len(s.data) && '1' <= s.data[i] && s.data[i] <= '9':
+		i = digits(s.data, i)
+	default:
+		return 0, s.errorf("invalid number")
+	}
+	if i < len(s.data) && s.data[i] == '.' {
+		if j := digits(s.data, i+1); j > i+1 {
+			i = j
+		} else {
+			return 0, s.errorf("invalid number")
+		}
+	}
+	if i < len(s.data) && (s.data[i] == 'e' || s.data[i] == 'E') {
+		i++
+		if i < len(s.data) && (s.data[i] == '+' || s.data[i] == '-') {
+			i++
+		}
+		if j := digits(s.data, i); j > i {
+			i = j
+		} else {
+			return 0, s.errorf("invalid number")
+		}
+	}
+	s.pos = i
+	value, err := strconv.ParseFloat(string(s.data[start:i]), 64)
+	if err != nil {
+		return 0, s.errorf("number %s out of range", s.data[start:i])
+	}
+	return value, nil
+}
+
+func digits(data []byte, i int) int {
+	for i < len(data) && '0' <= data[i] && data[i] <= '9' {
+		i++
+	}
+	return i
+}
+
+// skip consumes and validates any value
+func (s *scanner) skip() error {
+	return s.skipDepth(0)
+}
+
+// skipDepth skips a value nested in depth containers
+func (s *scanner) skipDepth(depth int) error {
+	switch c := s.peek(); {
+	case (c == '{' || c == '[') && depth >= maxDepth:
+		return s.errorf("exceeded max depth")
+	case c == '{':
+		return s.object(func([]byte) error { return s.skipDepth(depth + 1) })
+	case c == '[':
+		return s.array(func() error { return s.skipDepth(depth + 1) })
+	case c == '"':
+		_, err := s.rawString()
+		return err
+	case c == '-' || '0' <= c && c <= '9':
+		_, err := s.number()
+		return err
+	case c == 't':
+		return s.literal("true")
+	case c == 'f':
+		return s.literal("false")
+	case c == 'n':
+		return s.literal("null")
+	default:
+		return s.errorf("unexpected character")
+	}
+}
+
+func (s *scanner) literal(word string) error {
+	if len(s.data)-s.pos < len(word) || string(s.data[s.pos:s.pos+len(word)]) != word {
+		return s.errorf("invalid literal")
+	}
+	s.pos += len(word)
+	return nil
+}
@@ -0,0 +1,309 @@
+// Package wire decodes NIP-01 client messages straight into events and
+// filters. Unlike unmarshalling into []interface{}, it builds no maps or
+// boxed values: the envelope is split into raw argument slices and only the
+// fields the relay reads are decoded. Inputs encoding/json rejects are
+// rejected, and fields of the wrong type are ignored as before.
+package wire
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+
+	"mercury-relay/internal/models"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// Message is a client message split into its type and raw arguments
+type Message struct {
+	Type string
+	// Args are slices of the input and only valid while it is
+	Args []json.RawMessage
+}
+
+// ParseMessage validates data and splits the ["TYPE", arg...] envelope
+func ParseMessage(data []byte) (Message, error) {
+	var msg Message
+	s := &scanner{data: data}
+	first := true
+	typed := true
+	err := s.array(func() error {
+		if first {
+			first = false
+			if s.peek() == '"' {
+				var err error
+				msg.Type, err = s.string()
+				return err
+			}
+			typed = false
+			return s.skipDepth(1)
+		}
+		s.skipSpace()
+		from := s.pos
+		if err := s.skipDepth(1); err != nil {
+			return err
+		}
+		msg.Args = append(msg.Args, json.RawMessage(data[from:s.pos]))
+		return nil
+	})
+	if err == nil {
+		err = s.end()
+	}
+	if err != nil {
+		return Message{}, err
+	}
+
+	if len(msg.Args) < 1 {
+		return Message{}, fmt.Errorf("message too short")
+	}
+	if !typed {
+		return Message{}, fmt.Errorf("invalid message type")
+	}
+	return msg, nil
+}
+
+// String decodes raw if it is a JSON string
+func String(raw []byte) (string, bool) {
+	s := &scanner{data: raw}
+	if s.peek() != '"' {
+		return "", false
+	}
+	value, err := s.string()
+	return value, err == nil
+}
+
+// ParseEvent decodes the event object in raw. Signature and ID are not
+// checked.
+func ParseEvent(raw []byte) (*models.Event, error) {
+	s := &scanner{data: raw}
+	if s.peek() != '{' {
+		return nil, fmt.Errorf("invalid event data")
+	}
+
+	event := &models.Event{}
+	err := s.object(func(key []byte) error {
+		var err error
+		switch {
+		case stringKey(key, "id"):
+			event.ID, err = s.optionalString()
+		case stringKey(key, "pubkey"):
+			event.PubKey, err = s.optionalString()
+		case stringKey(key, "content"):
+			event.Content, err = s.optionalString()
+		case stringKey(key, "sig"):
+			event.Sig, err = s.optionalString()
+		case stringKey(key, "created_at"):
+			var value float64
+			value, err = s.optionalNumber()
+			event.CreatedAt = nostr.Timestamp(value)
+		case stringKey(key, "kind"):
+			var value float64
+			value, err = s.optionalNumber()
+			event.Kind = int(value)
+		case stringKey(key, "tags"):
+			event.Tags, err = s.tags()
+		default:
+			err = s.skip()
+		}
+		return err
+	})
+	if err == nil {
+		err = s.end()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// ParseFilter decodes the filter object in raw, including the NIP-50
+// "search" field, along with the non-standard "lang" field, a code or a list of ISO 639-1 codes. Tag
+// conditions are read from single-letter "#x" keys as NIP-01 defines them.
+func ParseFilter(raw []byte) (nostr.Filter, []string, error) {
+	var filter nostr.Filter
+	var languages []string
+	s := &scanner{data: raw}
+	if s.peek() != '{' {
+		return filter, nil, fmt.Errorf("invalid filter")
+	}
+
+	err := s.object(func(key []byte) error {
+		var err error
+		switch {
+		case stringKey(key, "ids"):
+			filter.IDs, err = s.stringList()
+		case stringKey(key, "authors"):
+			filter.Authors, err = s.stringList()
+		case stringKey(key, "kinds"):
+			filter.Kinds = nil
+			if s.peek() != '[' {
+				return s.skip()
+			}
+			err = s.array(func() error {
+				if c := s.peek(); c != '-' && (c < '0' || c > '9') {
+					return s.skip()
+				}
+				kind, err := s.number()
+				filter.Kinds = append(filter.Kinds, int(kind))
+				return err
+			})
+		case stringKey(key, "since"):
+			filter.Since, err = s.timestamp()
+		case stringKey(key, "until"):
+			filter.Until, err = s.timestamp()
+		case stringKey(key, "limit"):
+			var limit float64
+			limit, err = s.optionalNumber()
+			filter.Limit = int(limit)
+		case stringKey(key, "search"):
+			filter.Search, err = s.optionalString()
+		case stringKey(key, "lang"):
+			languages = nil
+			switch s.peek() {
+			case '"':
+				var lang string
+				if lang, err = s.string(); lang != "" {
+					languages = []string{lang}
+				}
+			case '[':
+				var list []string
+				list, err = s.stringList()
+				for _, lang := range list {
+					if lang != "" {
+						languages = append(languages, lang)
+					}
+				}
+			default:
+				err = s.skip()
+			}
+		default:
+			name, ok := tagName(key)
+			if !ok {
+				return s.skip()
+			}
+			var values []string
+			if values, err = s.stringList(); err == nil {
+				if filter.Tags == nil {
+					filter.Tags = make(nostr.TagMap)
+				}
+				filter.Tags[name] = values
+			}
+		}
+		return err
+	})
+	if err == nil {
+		err = s.end()
+	}
+	if err != nil {
+		return nostr.Filter{}, nil, err
+	}
+	return filter, languages, nil
+}
+
+// tagName returns the tag name of a "#x" filter key, where x is a single
+// ASCII letter
+func tagName(key []byte) (string, bool) {
+	if bytes.IndexByte(key, '\\') >= 0 {
+		key = []byte(unquote(key))
+	}
+	if len(key) != 2 || key[0] != '#' {
+		return "", false
+	}
+	if c := key[1]; (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') {
+		return "", false
+	}
+	return string(key[1:]), true
+}
+
+// FilterTag returns the values of a filter's "#name" tag condition, or nil
+// when the filter has none or is malformed
+func FilterTag(raw []byte, name string) []string {
+	var values []string
+	s := &scanner{data: raw}
+	if s.peek() != '{' {
+		return nil
+	}
+	err := s.object(func(key []byte) error {
+		if !stringKey(key, "#"+name) {
+			return s.skip()
+		}
+		var err error
+		values, err = s.stringList()
+		return err
+	})
+	if err != nil {
+		return nil
+	}
+	return values
+}
+
+// optionalString decodes a string value, or skips a value of another type
+// and returns ""
+func (s *scanner) optionalString() (string, error) {
+	if s.peek() != '"' {
+		return "", s.skip()
+	}
+	return s.string()
+}
+
+// optionalNumber decodes a number value, or skips a value of another type
+// and returns 0
+func (s *scanner) optionalNumber() (float64, error) {
+	if c := s.peek(); c != '-' && (c < '0' || c > '9') {
+		return 0, s.skip()
+	}
+	return s.number()
+}
+
+func (s *scanner) timestamp() (*nostr.Timestamp, error) {
+	if c := s.peek(); c != '-' && (c < '0' || c > '9') {
+		return nil, s.skip()
+	}
+	value, err := s.number()
+	timestamp := nostr.Timestamp(value)
+	return &timestamp, err
+}
+
+// stringList decodes the strings of an array, skipping other elements
+func (s *scanner) stringList() ([]string, error) {
+	if s.peek() != '[' {
+		return nil, s.skip()
+	}
+	var values []string
+	err := s.array(func() error {
+		if s.peek() != '"' {
+			return s.skip()
+		}
+		value, err := s.string()
+		values = append(values, value)
+		return err
+	})
+	return values, err
+}
+
+// tags decodes an array of string arrays. Elements that are not arrays are
+// dropped, as are values that are not strings.
+func (s *scanner) tags() (nostr.Tags, error) {
+	if s.peek() != '[' {
+		return nil, s.skip()
+	}
+	var tags nostr.Tags
+	err := s.array(func() error {
+		if s.peek() != '[' {
+			return s.skip()
+		}
+		var tag nostr.Tag
+		err := s.array(func() error {
+			if s.peek() != '"' {
+				return s.skip()
+			}
+			value, err := s.string()
+			tag = append(tag, value)
+			return err
+		})
+		tags = append(tags, tag)
+		return err
+	})
+	return tags, err
+}
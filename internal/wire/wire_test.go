@@ -0,0 +1,315 @@
+package wire
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"mercury-relay/internal/models"
+	"mercury-relay/test/helpers"
+
+	"github.com/nbd-wtf/go-nostr"
+)
+
+func TestParseMessage(t *testing.T) {
+	msg, err := ParseMessage([]byte(` [ "REQ" , "sub1", {"kinds":[1]}, {"authors":[]} ] `))
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, "REQ", msg.Type)
+	helpers.AssertIntEqual(t, 3, len(msg.Args))
+	helpers.AssertStringEqual(t, `"sub1"`, string(msg.Args[0]))
+	helpers.AssertStringEqual(t, `{"kinds":[1]}`, string(msg.Args[1]))
+
+	subID, ok := String(msg.Args[0])
+	helpers.AssertTrue(t, ok)
+	helpers.AssertStringEqual(t, "sub1", subID)
+	_, ok = String(msg.Args[1])
+	helpers.AssertFalse(t, ok)
+
+	for input, want := range map[string]string{
+		`["REQ"]`:        "message too short",
+		`[]`:             "message too short",
+		`[1, "sub"]`:     "invalid message type",
+		`{"REQ": 1}`:     "invalid JSON",
+		`["REQ", "a"] x`: "invalid JSON",
+		``:               "invalid JSON",
+	} {
+		_, err := ParseMessage([]byte(input))
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseMessage(%q) = %v, want %q", input, err, want)
+		}
+	}
+}
+
+// Every input must be accepted or rejected as encoding/json does
+func TestValidity(t *testing.T) {
+	for _, input := range []string{
+		`["EVENT", {"content": "ok"}]`,
+		`["EVENT", {"content": "tab\there"}]`,
+		`["EVENT", {"content": "bad \x escape"}]`,
+		`["EVENT", {"content": "\u12"}]`,
+		`["EVENT", {"content": "unterminated}]`,
+		`["EVENT", {"kind": 01}]`,
+		`["EVENT", {"kind": -0.5e+3}]`,
+		`["EVENT", {"kind": 1.}]`,
+		`["EVENT", {"kind": .5}]`,
+		`["EVENT", {"kind": 1e400}]`,
+		`["EVENT", {"kind": +1}]`,
+		`["EVENT", {"kind": 1,}]`,
+		`["EVENT", {"kind" 1}]`,
+		`["EVENT", {1: 1}]`,
+		`["EVENT", [1, 2,]]`,
+		`["EVENT", tru]`,
+		`["EVENT", true, false, null]`,
+		`["EVENT", nul]`,
+		`["EVENT", {"a": {"b": [[], {}]}}]`,
+		"[\"EVENT\", \"raw\nnewline\"]",
+		`["EVENT", "` + strings.Repeat("[", 10) + `"]`,
+		`["EVENT", ` + strings.Repeat("[", 9998) + strings.Repeat("]", 9998) + `]`,
+		`["EVENT", ` + strings.Repeat("[", 9999) + strings.Repeat("]", 9999) + `]`,
+		`["EVENT", ` + strings.Repeat("[", 10000) + strings.Repeat("]", 10000) + `]`,
+	} {
+		var generic []interface{}
+		want := json.Unmarshal([]byte(input), &generic) == nil
+		_, err := ParseMessage([]byte(input))
+		if got := err == nil; got != want {
+			t.Errorf("ParseMessage(%.60q) valid = %v, encoding/json says %v (%v)", input, got, want, err)
+		}
+	}
+}
+
+func TestParseEvent(t *testing.T) {
+	sk := nostr.GeneratePrivateKey()
+	signed := nostr.Event{
+		CreatedAt: 1700000000,
+		Kind:      1,
+		Tags:      nostr.Tags{{"e", "abc", "wss://relay.example.com", "reply"}, {"t", "nostr"}},
+		Content:   "quotes \" backslash \\ newline \n emoji 🚀 escaped é",
+	}
+	helpers.AssertNoError(t, signed.Sign(sk))
+	raw, _ := json.Marshal(signed)
+
+	event, err := ParseEvent(raw)
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, signed.ID, event.ID)
+	helpers.AssertStringEqual(t, signed.PubKey, event.PubKey)
+	helpers.AssertStringEqual(t, signed.Content, event.Content)
+	helpers.AssertStringEqual(t, signed.Sig, event.Sig)
+	helpers.AssertIntEqual(t, 1, event.Kind)
+	helpers.AssertTrue(t, event.CreatedAt == signed.CreatedAt)
+	helpers.AssertEqual(t, fmt.Sprint(signed.Tags), fmt.Sprint(event.Tags))
+
+	ok, err := event.ToNostrEvent().CheckSignature()
+	helpers.AssertNoError(t, err)
+	helpers.AssertTrue(t, ok)
+
+	t.Run("Decodes strings like encoding/json", func(t *testing.T) {
+		for _, content := range []string{
+			`"🚀 pair"`,
+			`"\ud83d lone high"`,
+			`"\ude80 lone low"`,
+			`"\ud83dA broken pair"`,
+			"\"invalid \xff\xfe utf8\"",
+			`"\/ \b \f \r \t \u0000"`,
+			`"éé"`,
+		} {
+			var want string
+			helpers.AssertNoError(t, json.Unmarshal([]byte(content), &want))
+			event, err := ParseEvent([]byte(`{"content":` + content + `}`))
+			helpers.AssertNoError(t, err)
+			if event.Content != want {
+				t.Errorf("content %s decoded to %q, want %q", content, event.Content, want)
+			}
+		}
+	})
+
+	t.Run("Ignores mistyped fields", func(t *testing.T) {
+		event, err := ParseEvent([]byte(`{"id": 5, "kind": "1", "created_at": null, "content": ["x"],
+			"tags": [["p", 1, "abc"], "e", {"a": 1}], "extra": {"nested": [1, 2]}}`))
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, "", event.ID)
+		helpers.AssertIntEqual(t, 0, event.Kind)
+		helpers.AssertStringEqual(t, "", event.Content)
+		helpers.AssertEqual(t, fmt.Sprint(nostr.Tags{{"p", "abc"}}), fmt.Sprint(event.Tags))
+
+		// The last of duplicate keys wins, as with a map
+		event, err = ParseEvent([]byte(`{"kind": 1, "kind": "7", "kind2": 3, "pubkey": "abc"}`))
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, 0, event.Kind)
+		helpers.AssertStringEqual(t, "abc", event.PubKey)
+	})
+
+	_, err = ParseEvent([]byte(`["not", "an", "object"]`))
+	helpers.AssertErrorContains(t, err, "invalid event data")
+}
+
+func TestParseFilter(t *testing.T) {
+	filter, languages, err := ParseFilter([]byte(`{"authors": ["a", 1, "b"], "kinds": [1, "7", 30023],
+		"since": 1700000000, "until": "soon", "limit": 50.9, "lang": ["en", "", "de"], "#t": ["nostr"]}`))
+	helpers.AssertNoError(t, err)
+	helpers.AssertEqual(t, fmt.Sprint([]string{"a", "b"}), fmt.Sprint(filter.Authors))
+	helpers.AssertEqual(t, fmt.Sprint([]int{1, 30023}), fmt.Sprint(filter.Kinds))
+	helpers.AssertTrue(t, filter.Since != nil && *filter.Since == 1700000000)
+	helpers.AssertTrue(t, filter.Until == nil)
+	helpers.AssertIntEqual(t, 50, filter.Limit)
+	helpers.AssertEqual(t, fmt.Sprint([]string{"en", "de"}), fmt.Sprint(languages))
+	helpers.AssertEqual(t, fmt.Sprint(nostr.TagMap{"t": {"nostr"}}), fmt.Sprint(filter.Tags))
+
+	// Tag conditions are single letters; other "#" keys are ignored
+	filter, _, err = ParseFilter([]byte(`{"ids": ["x"], "#e": ["a", 2, "b"], "#\u0070": ["c"], "#D": [], "#tt": ["y"], "#": ["z"]}`))
+	helpers.AssertNoError(t, err)
+	helpers.AssertEqual(t, fmt.Sprint([]string{"x"}), fmt.Sprint(filter.IDs))
+	helpers.AssertEqual(t, fmt.Sprint(nostr.TagMap{"D": nil, "e": {"a", "b"}, "p": {"c"}}), fmt.Sprint(filter.Tags))
+
+	_, languages, err = ParseFilter([]byte(`{"lang": "fr"}`))
+	helpers.AssertNoError(t, err)
+	helpers.AssertEqual(t, fmt.Sprint([]string{"fr"}), fmt.Sprint(languages))
+
+	filter, _, err = ParseFilter([]byte(`{"kinds": [30023], "search": "lighthouse sort:recent"}`))
+	helpers.AssertNoError(t, err)
+	helpers.AssertStringEqual(t, "lighthouse sort:recent", filter.Search)
+
+	_, _, err = ParseFilter([]byte(`"nope"`))
+	helpers.AssertErrorContains(t, err, "invalid filter")
+}
+
+func TestFilterTag(t *testing.T) {
+	raw := []byte(`{"kinds": [1311], "#a": ["30311:abc:live", 7], "#t": ["nostr"]}`)
+	helpers.AssertEqual(t, fmt.Sprint([]string{"30311:abc:live"}), fmt.Sprint(FilterTag(raw, "a")))
+	helpers.AssertEqual(t, fmt.Sprint([]string{"nostr"}), fmt.Sprint(FilterTag(raw, "t")))
+	helpers.AssertIntEqual(t, 0, len(FilterTag(raw, "p")))
+	helpers.AssertIntEqual(t, 0, len(FilterTag([]byte(`{"#a": ["x"`), "a")))
+}
+
+var benchEvent = func() []byte {
+	sk := nostr.GeneratePrivateKey()
+	event := nostr.Event{
+		CreatedAt: 1700000000,
+		Kind:      1,
+		Tags: nostr.Tags{
+			{"e", strings.Repeat("a", 64), "wss://relay.example.com", "root"},
+			{"e", strings.Repeat("b", 64), "wss://relay.example.com", "reply"},
+			{"p", strings.Repeat("c", 64)},
+			{"t", "nostr"},
+		},
+		Content: strings.Repeat("A reasonably long note with some words in it. ", 6),
+	}
+	event.Sign(sk)
+	raw, _ := json.Marshal(event)
+	return []byte(`["EVENT",` + string(raw) + `]`)
+}()
+
+var benchREQ = []byte(`["REQ","feed",{"authors":["` + strings.Repeat("a", 64) + `","` + strings.Repeat("b", 64) +
+	`"],"kinds":[1,6,7,30023],"since":1700000000,"limit":100,"lang":"en"}]`)
+
+// legacyEvent decodes as the relay did before this package: a generic
+// unmarshal followed by type assertions
+func legacyEvent(data []byte) *models.Event {
+	var msg []interface{}
+	json.Unmarshal(data, &msg)
+	eventData := msg[1].(map[string]interface{})
+	event := &models.Event{}
+	event.ID, _ = eventData["id"].(string)
+	event.PubKey, _ = eventData["pubkey"].(string)
+	event.Content, _ = eventData["content"].(string)
+	event.Sig, _ = eventData["sig"].(string)
+	if createdAt, ok := eventData["created_at"].(float64); ok {
+		event.CreatedAt = nostr.Timestamp(createdAt)
+	}
+	if kind, ok := eventData["kind"].(float64); ok {
+		event.Kind = int(kind)
+	}
+	if tags, ok := eventData["tags"].([]interface{}); ok {
+		for _, tag := range tags {
+			values, ok := tag.([]interface{})
+			if !ok {
+				continue
+			}
+			var parsed nostr.Tag
+			for _, value := range values {
+				if str, ok := value.(string); ok {
+					parsed = append(parsed, str)
+				}
+			}
+			event.Tags = append(event.Tags, parsed)
+		}
+	}
+	return event
+}
+
+func legacyFilter(data []byte) nostr.Filter {
+	var msg []interface{}
+	json.Unmarshal(data, &msg)
+	filterData := msg[2].(map[string]interface{})
+	filter := nostr.Filter{}
+	for _, author := range filterData["authors"].([]interface{}) {
+		filter.Authors = append(filter.Authors, author.(string))
+	}
+	for _, kind := range filterData["kinds"].([]interface{}) {
+		filter.Kinds = append(filter.Kinds, int(kind.(float64)))
+	}
+	since := nostr.Timestamp(filterData["since"].(float64))
+	filter.Since = &since
+	filter.Limit = int(filterData["limit"].(float64))
+	return filter
+}
+
+func BenchmarkParseEVENT(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchEvent)))
+	for i := 0; i < b.N; i++ {
+		msg, err := ParseMessage(benchEvent)
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err := ParseEvent(msg.Args[0]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseEVENTLegacy(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchEvent)))
+	for i := 0; i < b.N; i++ {
+		legacyEvent(benchEvent)
+	}
+}
+
+func BenchmarkParseREQ(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchREQ)))
+	for i := 0; i < b.N; i++ {
+		msg, err := ParseMessage(benchREQ)
+		if err != nil {
+			b.Fatal(err)
+		}
+		String(msg.Args[0])
+		if _, _, err := ParseFilter(msg.Args[1]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParseREQLegacy(b *testing.B) {
+	b.ReportAllocs()
+	b.SetBytes(int64(len(benchREQ)))
+	for i := 0; i < b.N; i++ {
+		legacyFilter(benchREQ)
+	}
+}
+
+// The streaming decoder must produce what the generic decoder did
+func TestMatchesLegacy(t *testing.T) {
+	msg, err := ParseMessage(benchEvent)
+	helpers.AssertNoError(t, err)
+	event, err := ParseEvent(msg.Args[0])
+	helpers.AssertNoError(t, err)
+	helpers.AssertEqual(t, fmt.Sprintf("%+v", legacyEvent(benchEvent)), fmt.Sprintf("%+v", event))
+
+	msg, err = ParseMessage(benchREQ)
+	helpers.AssertNoError(t, err)
+	filter, _, err := ParseFilter(msg.Args[1])
+	helpers.AssertNoError(t, err)
+	helpers.AssertEqual(t, legacyFilter(benchREQ).String(), filter.String())
+}
@@ -0,0 +1,187 @@
+package ebooks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultTimeout bounds requests made with the default HTTP client
+const defaultTimeout = time.Minute
+
+// Error is an error response from the relay
+type Error struct {
+	Status    int    `json:"status"`
+	Code      string `json:"code"`
+	Detail    string `json:"detail"`
+	RequestID string `json:"request_id"`
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("relay returned %d", e.Status)
+	if e.Code != "" {
+		msg += " " + e.Code
+	}
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// Client calls the ebook endpoints of one relay
+type Client struct {
+	// BaseURL is the relay's REST address, e.g. "https://relay.example.com"
+	BaseURL string
+	// Pubkey is the authenticated npub sent with every request
+	Pubkey string
+	// HTTPClient sends the requests; nil uses a client with a one minute
+	// timeout
+	HTTPClient *http.Client
+}
+
+// NewClient returns a client for the relay at baseURL acting as pubkey
+func NewClient(baseURL, pubkey string) *Client {
+	return &Client{BaseURL: baseURL, Pubkey: pubkey, HTTPClient: &http.Client{Timeout: defaultTimeout}}
+}
+
+// ListOptions narrows the catalog
+type ListOptions struct {
+	Author    string   // hex pubkey of the publisher
+	Format    string   // epub, pdf, ...
+	Languages []string // ISO 639-1 codes
+	Limit     int
+}
+
+// List returns the books in the catalog
+func (c *Client) List(ctx context.Context, opts ListOptions) ([]Ebook, error) {
+	query := url.Values{}
+	if opts.Author != "" {
+		query.Set("author", opts.Author)
+	}
+	if opts.Format != "" {
+		query.Set("format", opts.Format)
+	}
+	if len(opts.Languages) > 0 {
+		query.Set("lang", strings.Join(opts.Languages, ","))
+	}
+	if opts.Limit > 0 {
+		query.Set("limit", strconv.Itoa(opts.Limit))
+	}
+
+	var catalog Catalog
+	if err := c.getJSON(ctx, "/api/v1/ebooks", query, &catalog); err != nil {
+		return nil, err
+	}
+	return catalog.Ebooks, nil
+}
+
+// ContentOptions shapes a book's content tree
+type ContentOptions struct {
+	Format string // asciidoc (default), html or markdown
+	Depth  int    // nesting levels kept, 3 by default
+	Images bool
+}
+
+// Content returns the book with ID id and its nested sections
+func (c *Client) Content(ctx context.Context, id string, opts ContentOptions) (*Book, error) {
+	query := url.Values{}
+	if opts.Format != "" {
+		query.Set("format", opts.Format)
+	}
+	if opts.Depth > 0 {
+		query.Set("depth", strconv.Itoa(opts.Depth))
+	}
+	if opts.Images {
+		query.Set("images", "true")
+	}
+
+	var content Content
+	if err := c.getJSON(ctx, "/api/v1/ebooks/"+url.PathEscape(id)+"/content", query, &content); err != nil {
+		return nil, err
+	}
+	return &content.Book, nil
+}
+
+// DownloadEPUB writes the book with ID id as an EPUB to w and returns the
+// file name the relay suggests
+func (c *Client) DownloadEPUB(ctx context.Context, id string, images bool, w io.Writer) (string, error) {
+	query := url.Values{}
+	if images {
+		query.Set("images", "true")
+	}
+	resp, err := c.get(ctx, "/api/v1/ebooks/"+url.PathEscape(id)+"/epub", query)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return "", fmt.Errorf("failed to download EPUB: %w", err)
+	}
+	name := id + ".epub"
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		name = params["filename"]
+	}
+	return name, nil
+}
+
+func (c *Client) getJSON(ctx context.Context, path string, query url.Values, v interface{}) error {
+	resp, err := c.get(ctx, path, query)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to decode %s: %w", path, err)
+	}
+	return nil
+}
+
+// get sends a GET request, turning error statuses into *Error
+func (c *Client) get(ctx context.Context, path string, query url.Values) (*http.Response, error) {
+	target := strings.TrimRight(c.BaseURL, "/") + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if c.Pubkey != "" {
+		req.Header.Set("X-Nostr-Pubkey", c.Pubkey)
+	}
+
+	client := c.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: defaultTimeout}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call %s: %w", path, err)
+	}
+	if resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	apiErr := &Error{}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if json.Unmarshal(body, apiErr) != nil || apiErr.Detail == "" {
+		// Older responses only carry {"success": false, "error": "..."}
+		var legacy struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(body, &legacy) == nil && legacy.Error != "" {
+			apiErr.Detail = legacy.Error
+		}
+	}
+	apiErr.Status = resp.StatusCode
+	return nil, apiErr
+}
@@ -0,0 +1,54 @@
+package ebooks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"mercury-relay/test/helpers"
+)
+
+func TestClient(t *testing.T) {
+	var lastQuery, lastPubkey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lastQuery, lastPubkey = req.URL.RawQuery, req.Header.Get("X-Nostr-Pubkey")
+		switch req.URL.Path {
+		case "/api/v1/ebooks":
+			json.NewEncoder(w).Encode(Catalog{Success: true, Count: 1, Ebooks: []Ebook{{ID: "book", Title: "Atlas"}}})
+		case "/api/v1/ebooks/problem/content":
+			w.Header().Set("Content-Type", "application/problem+json")
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"status":403,"code":"forbidden","detail":"Not yours","request_id":"abc"}`))
+		default:
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"success":false,"error":"Failed to get book"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL+"/", "npub1reader")
+
+	list, err := client.List(context.Background(), ListOptions{Format: "epub", Languages: []string{"en", "de"}, Limit: 5})
+	helpers.AssertNoError(t, err)
+	helpers.AssertIntEqual(t, 1, len(list))
+	helpers.AssertStringEqual(t, "Atlas", list[0].Title)
+	helpers.AssertStringEqual(t, "format=epub&lang=en%2Cde&limit=5", lastQuery)
+	helpers.AssertStringEqual(t, "npub1reader", lastPubkey)
+
+	_, err = client.Content(context.Background(), "problem", ContentOptions{})
+	var apiErr *Error
+	helpers.AssertTrue(t, errors.As(err, &apiErr))
+	helpers.AssertIntEqual(t, http.StatusForbidden, apiErr.Status)
+	helpers.AssertStringEqual(t, "forbidden", apiErr.Code)
+	helpers.AssertStringEqual(t, "abc", apiErr.RequestID)
+	helpers.AssertStringEqual(t, "relay returned 403 forbidden: Not yours", err.Error())
+
+	_, err = client.Content(context.Background(), "legacy", ContentOptions{Depth: 2})
+	helpers.AssertTrue(t, errors.As(err, &apiErr))
+	helpers.AssertIntEqual(t, http.StatusInternalServerError, apiErr.Status)
+	helpers.AssertStringEqual(t, "Failed to get book", apiErr.Detail)
+	helpers.AssertStringEqual(t, "depth=2", lastQuery)
+}
@@ -0,0 +1,98 @@
+// Package ebooks is a Go client for Mercury Relay's ebook REST endpoints:
+// the catalog of kind 30040 books, their nested content and EPUB downloads.
+// The relay builds its responses from the same types, so the client always
+// decodes what the server sends.
+package ebooks
+
+import (
+	"github.com/nbd-wtf/go-nostr"
+)
+
+// File is a NIP-94 file verified for a book, such as its cover or a
+// downloadable edition
+type File struct {
+	EventID        string `json:"event_id"`
+	URL            string `json:"url"`
+	MimeType       string `json:"mime_type"`
+	SHA256         string `json:"sha256"`
+	OriginalSHA256 string `json:"original_sha256,omitempty"`
+	Size           int64  `json:"size,omitempty"`
+	Dimensions     string `json:"dim,omitempty"`
+	Blurhash       string `json:"blurhash,omitempty"`
+	Alt            string `json:"alt,omitempty"`
+	Summary        string `json:"summary,omitempty"`
+	Role           string `json:"role,omitempty"`
+}
+
+// Ebook is a book in the catalog
+type Ebook struct {
+	ID             string     `json:"id"`
+	Naddr          string     `json:"naddr,omitempty"` // NIP-19 address with relay hint
+	Author         string     `json:"author"`          // hex pubkey of the publisher
+	Title          string     `json:"title"`
+	AuthorName     string     `json:"author_name"`
+	Format         string     `json:"format"`
+	Size           int64      `json:"size,omitempty"`
+	CreatedAt      int64      `json:"created_at"`
+	Tags           nostr.Tags `json:"tags"`
+	DownloadURL    string     `json:"download_url,omitempty"`
+	Cover          string     `json:"cover,omitempty"`
+	CoverSHA256    string     `json:"cover_sha256,omitempty"`
+	CoverGenerated bool       `json:"cover_generated,omitempty"`
+	Files          []File     `json:"files,omitempty"`
+}
+
+// Catalog is the response of GET /api/v1/ebooks
+type Catalog struct {
+	Success   bool    `json:"success"`
+	Count     int     `json:"count"`
+	Ebooks    []Ebook `json:"ebooks"`
+	Timestamp int64   `json:"timestamp"`
+}
+
+// Contributor is the profile of someone who wrote a section
+type Contributor struct {
+	PubKey      string `json:"pubkey"`
+	Name        string `json:"name,omitempty"`
+	DisplayName string `json:"display_name,omitempty"`
+	Picture     string `json:"picture,omitempty"`
+	NIP05       string `json:"nip05,omitempty"`
+}
+
+// Node is a section in a book's content tree. The root has type "root" and
+// holds the top-level sections as children.
+type Node struct {
+	ID        string        `json:"id,omitempty"`
+	Title     string        `json:"title"`
+	Type      string        `json:"type"` // root, chapter, section, ...
+	Content   string        `json:"content,omitempty"`
+	Format    string        `json:"format,omitempty"` // asciidoc, markdown, ...
+	CreatedAt int64         `json:"created_at,omitempty"`
+	Author    *Contributor  `json:"author,omitempty"`
+	Images    []interface{} `json:"images,omitempty"`
+	Children  []*Node       `json:"children"`
+}
+
+// Book is a book with its nested content
+type Book struct {
+	ID           string        `json:"id"`
+	Naddr        string        `json:"naddr,omitempty"`
+	Title        string        `json:"title"`
+	Author       string        `json:"author"`
+	Description  string        `json:"description"`
+	Format       string        `json:"format"`
+	Language     string        `json:"language"`
+	CreatedAt    int64         `json:"created_at"`
+	Contributors []Contributor `json:"contributors"`
+	Structure    *Node         `json:"structure"`
+}
+
+// Content is the response of GET /api/v1/ebooks/{id}/content
+type Content struct {
+	Success       bool   `json:"success"`
+	Book          Book   `json:"book"`
+	ContentFormat string `json:"content_format"`
+	IncludeImages bool   `json:"include_images"`
+	MaxDepth      int    `json:"max_depth"`
+	Timestamp     int64  `json:"timestamp"`
+}
@@ -4,8 +4,10 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -16,6 +18,7 @@ import (
 	"mercury-relay/internal/quality"
 	"mercury-relay/internal/relay"
 	"mercury-relay/internal/streaming"
+	"mercury-relay/pkg/ebooks"
 	"mercury-relay/test/helpers"
 	"mercury-relay/test/mocks"
 
@@ -492,6 +495,93 @@ func TestWebSocketIntegration(t *testing.T) {
 	})
 }
 
+func TestEbookClient(t *testing.T) {
+	mockCache := mocks.NewMockCache()
+	eg := models.NewEventGenerator()
+	author := strings.Repeat("a", 64)
+	other := strings.Repeat("b", 64)
+
+	book := eg.GenerateEbook(author, map[string]interface{}{
+		"identifier": "voyage",
+		"title":      "The Voyage",
+		"author":     "A. Sailor",
+		"format":     "epub",
+		"size":       2048,
+	})
+	chapter := eg.GenerateEbookContent(author, "voyage", map[string]interface{}{
+		"identifier": "chapter",
+		"title":      "Departure",
+		"type":       "chapter",
+		"content":    "We set sail at dawn.",
+	})
+	section := eg.GenerateEbookContent(author, "voyage", map[string]interface{}{
+		"identifier": "chapter-storm",
+		"title":      "The Storm",
+		"type":       "section",
+		"content":    "The wind rose.",
+	})
+	pamphlet := eg.GenerateEbook(other, map[string]interface{}{
+		"identifier": "pamphlet",
+		"title":      "A Pamphlet",
+		"format":     "pdf",
+	})
+	profile := eg.GenerateUserMetadata(author, map[string]interface{}{"name": "Sailor"})
+	mockCache.SetEvents([]*models.Event{book, chapter, section, pamphlet, profile})
+
+	server := api.NewRESTAPIServer(config.RESTAPIConfig{Enabled: true}, nil, mocks.NewMockQueue(), mockCache, config.SSHConfig{Enabled: false}, "ws://localhost:8080", &config.Config{})
+	httpServer := httptest.NewServer(createTestRouter(server))
+	defer httpServer.Close()
+	client := ebooks.NewClient(httpServer.URL, "npub1reader")
+	ctx := context.Background()
+
+	t.Run("Catalog", func(t *testing.T) {
+		list, err := client.List(ctx, ebooks.ListOptions{})
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, 2, len(list))
+
+		list, err = client.List(ctx, ebooks.ListOptions{Format: "epub", Author: author})
+		helpers.AssertNoError(t, err)
+		helpers.AssertIntEqual(t, 1, len(list))
+		helpers.AssertStringEqual(t, "The Voyage", list[0].Title)
+		helpers.AssertStringEqual(t, "A. Sailor", list[0].AuthorName)
+		helpers.AssertIntEqual(t, 2048, int(list[0].Size))
+		helpers.AssertTrue(t, list[0].CoverGenerated)
+		helpers.AssertStringEqual(t, "voyage", list[0].Tags.GetD())
+	})
+
+	t.Run("Content tree", func(t *testing.T) {
+		content, err := client.Content(ctx, book.ID, ebooks.ContentOptions{Depth: 2})
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, "The Voyage", content.Title)
+		helpers.AssertIntEqual(t, 1, len(content.Contributors))
+		helpers.AssertStringEqual(t, "Sailor", content.Contributors[0].Name)
+
+		helpers.AssertStringEqual(t, "root", content.Structure.Type)
+		helpers.AssertIntEqual(t, 1, len(content.Structure.Children))
+		departure := content.Structure.Children[0]
+		helpers.AssertStringEqual(t, "Departure", departure.Title)
+		helpers.AssertStringEqual(t, author, departure.Author.PubKey)
+		helpers.AssertIntEqual(t, 1, len(departure.Children))
+		helpers.AssertStringEqual(t, "The wind rose.", departure.Children[0].Content)
+	})
+
+	t.Run("EPUB download", func(t *testing.T) {
+		var epub bytes.Buffer
+		name, err := client.DownloadEPUB(ctx, book.ID, false, &epub)
+		helpers.AssertNoError(t, err)
+		helpers.AssertStringEqual(t, "The Voyage.epub", name)
+		helpers.AssertTrue(t, epub.Len() > 0)
+	})
+
+	t.Run("Errors", func(t *testing.T) {
+		_, err := client.Content(ctx, strings.Repeat("f", 64), ebooks.ContentOptions{})
+		var apiErr *ebooks.Error
+		helpers.AssertTrue(t, errors.As(err, &apiErr))
+		helpers.AssertIntEqual(t, http.StatusNotFound, apiErr.Status)
+		helpers.AssertStringEqual(t, "Book not found", apiErr.Detail)
+	})
+}
+
 // createTestRouter creates a test router for the REST API server
 func createTestRouter(server *api.RESTAPIServer) *mux.Router {
 	router := mux.NewRouter()
@@ -501,6 +591,9 @@ func createTestRouter(server *api.RESTAPIServer) *mux.Router {
 	router.HandleFunc("/api/v1/events", server.HandleGetEvents).Methods("GET", "POST")
 	router.HandleFunc("/api/v1/health", server.HandleHealth).Methods("GET")
 	router.HandleFunc("/api/v1/stats", server.HandleStats).Methods("GET")
+	router.HandleFunc("/api/v1/ebooks", server.HandleEbooks).Methods("GET")
+	router.HandleFunc("/api/v1/ebooks/{id}/content", server.HandleEbookContent).Methods("GET")
+	router.HandleFunc("/api/v1/ebooks/{id}/epub", server.HandleEbookEPUB).Methods("GET")
 
 	return router
 }
@@ -1,6 +1,9 @@
 package mocks
 
 import (
+	"context"
+	"fmt"
+	"iter"
 	"sync"
 
 	"mercury-relay/internal/models"
@@ -10,9 +13,10 @@ import (
 
 // MockCache implements the cache interface for testing
 type MockCache struct {
-	events map[string]*models.Event
-	stats  map[string]interface{}
-	mutex  sync.RWMutex
+	events  map[string]*models.Event
+	stats   map[string]interface{}
+	history map[string][]map[string]interface{}
+	mutex   sync.RWMutex
 }
 
 // NewMockCache creates a new mock cache
@@ -33,15 +37,15 @@ func (m *MockCache) StoreEvent(event *models.Event) error {
 	return nil
 }
 
-// GetEvents retrieves events matching the filter
-func (m *MockCache) GetEvents(filter nostr.Filter) ([]*models.Event, error) {
+// GetEvents retrieves events matching the filter, stopping once ctx is done
+func (m *MockCache) GetEvents(ctx context.Context, filter nostr.Filter) iter.Seq2[*models.Event, error] {
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
 	var result []*models.Event
 
 	for _, event := range m.events {
-		if m.eventMatchesFilter(event, filter) {
+		if event.MatchesFilter(filter) {
 			result = append(result, event)
 		}
 	}
@@ -51,7 +55,17 @@ func (m *MockCache) GetEvents(filter nostr.Filter) ([]*models.Event, error) {
 		result = result[:filter.Limit]
 	}
 
-	return result, nil
+	return func(yield func(*models.Event, error) bool) {
+		for _, event := range result {
+			if err := ctx.Err(); err != nil {
+				yield(nil, err)
+				return
+			}
+			if !yield(event, nil) {
+				return
+			}
+		}
+	}
 }
 
 // DeleteEvent removes an event from the mock cache
@@ -158,66 +172,6 @@ func (m *MockCache) GetEventsByKind(kind int) []*models.Event {
 
 // Private methods
 
-func (m *MockCache) eventMatchesFilter(event *models.Event, filter nostr.Filter) bool {
-	// Check authors
-	if len(filter.Authors) > 0 {
-		found := false
-		for _, author := range filter.Authors {
-			if event.PubKey == author {
-				found = true
-				break
-			}
-		}
-		if !found {
-			return false
-		}
-	}
-
-	// Check kinds
-	if len(filter.Kinds) > 0 {
-		found := false
-		for _, kind := range filter.Kinds {
-			if event.Kind == kind {
-				found = true
-				break
-			}
-		}
-		if !found {
-			return false
-		}
-	}
-
-	// Check since
-	if filter.Since != nil && *filter.Since > 0 {
-		if nostr.Timestamp(int64(event.CreatedAt)) < *filter.Since {
-			return false
-		}
-	}
-
-	// Check until
-	if filter.Until != nil && *filter.Until > 0 {
-		if nostr.Timestamp(int64(event.CreatedAt)) > *filter.Until {
-			return false
-		}
-	}
-
-	// Check IDs
-	if len(filter.IDs) > 0 {
-		found := false
-		for _, id := range filter.IDs {
-			if event.ID == id {
-				found = true
-				break
-			}
-		}
-		if !found {
-			return false
-		}
-	}
-
-	return true
-}
-
 func (m *MockCache) updateStats() {
 	m.stats["total_events"] = len(m.events)
 	m.stats["cache_size"] = len(m.events)
@@ -256,11 +210,13 @@ func (m *MockCacheWithError) StoreEvent(event *models.Event) error {
 }
 
 // GetEvents returns configured error
-func (m *MockCacheWithError) GetEvents(filter nostr.Filter) ([]*models.Event, error) {
+func (m *MockCacheWithError) GetEvents(ctx context.Context, filter nostr.Filter) iter.Seq2[*models.Event, error] {
 	if m.getError != nil {
-		return nil, m.getError
+		return func(yield func(*models.Event, error) bool) {
+			yield(nil, m.getError)
+		}
 	}
-	return m.MockCache.GetEvents(filter)
+	return m.MockCache.GetEvents(ctx, filter)
 }
 
 // DeleteEvent returns configured error
@@ -284,10 +240,26 @@ func (m *MockCache) GetReplaceableEventHistory(kind int, pubkey, dTag string) ([
 	m.mutex.RLock()
 	defer m.mutex.RUnlock()
 
+	if history, ok := m.history[fmt.Sprintf("%d:%s:%s", kind, pubkey, dTag)]; ok {
+		return history, nil
+	}
+
 	// Mock implementation - return empty history
 	return []map[string]interface{}{}, nil
 }
 
+// SetReplaceableEventHistory sets the history returned for a replaceable
+// event, newest version first as stored in Redis
+func (m *MockCache) SetReplaceableEventHistory(kind int, pubkey, dTag string, history []map[string]interface{}) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.history == nil {
+		m.history = make(map[string][]map[string]interface{})
+	}
+	m.history[fmt.Sprintf("%d:%s:%s", kind, pubkey, dTag)] = history
+}
+
 // GetLatestReplaceableEvent returns the latest version of a replaceable event
 func (m *MockCache) GetLatestReplaceableEvent(kind int, pubkey, dTag string) (*models.Event, error) {
 	m.mutex.RLock()
@@ -0,0 +1,35 @@
+package mocks
+
+import (
+	"context"
+	"strconv"
+
+	"mercury-relay/internal/models"
+)
+
+// MockScanner pages through a fixed list of events using the index as
+// cursor, counting the pages asked for
+type MockScanner struct {
+	Events []*models.Event
+	Calls  int
+}
+
+// NewMockScanner creates a scanner over events
+func NewMockScanner(events []*models.Event) *MockScanner {
+	return &MockScanner{Events: events}
+}
+
+// ScanEvents returns up to limit events from cursor and the cursor of the
+// next page, empty after the last
+func (s *MockScanner) ScanEvents(ctx context.Context, cursor string, limit int) ([]*models.Event, string, error) {
+	s.Calls++
+	start := 0
+	if cursor != "" {
+		start, _ = strconv.Atoi(cursor)
+	}
+	end := start + limit
+	if end >= len(s.Events) {
+		return s.Events[start:], "", nil
+	}
+	return s.Events[start:end], strconv.Itoa(end), nil
+}